@@ -0,0 +1,225 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package notarize
+
+import (
+	"archive/zip"
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sassoftware/relic/v7/cmdline/shared"
+	"github.com/sassoftware/relic/v7/config"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/fruit/dmg"
+	"github.com/sassoftware/relic/v7/lib/fruit/notary"
+	"github.com/sassoftware/relic/v7/lib/magic"
+)
+
+var NotarizeCmd = &cobra.Command{
+	Use:   "notarize FILE...",
+	Short: "Submit signed macOS software to Apple's notary service",
+	Long: `Upload signed installer packages, disk images, zipped app bundles or Mach-O
+binaries to Apple's notary service, wait for the result, and staple the
+ticket to the file. Mach-O binaries are zipped for submission and cannot be
+stapled.
+
+Credentials for the App Store Connect API are read from the "notary"
+section of the configuration file.`,
+	RunE: notarizeCmd,
+}
+
+var (
+	argNoStaple   bool
+	argStapleOnly bool
+)
+
+const (
+	defaultTimeout      = 3600
+	defaultPollInterval = 30
+)
+
+func init() {
+	shared.RootCmd.AddCommand(NotarizeCmd)
+	NotarizeCmd.Flags().BoolVar(&argNoStaple, "no-staple", false, "Don't staple the ticket after notarization succeeds")
+	NotarizeCmd.Flags().BoolVar(&argStapleOnly, "staple-only", false, "Staple the ticket of a file that was already notarized")
+	shared.AddPostSignHook("notarize", func(ctx context.Context, path string) error {
+		return notarize(ctx, path, true)
+	})
+}
+
+func notarizeCmd(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		return errors.New("expected 1 or more files")
+	}
+	if err := shared.InitClientConfig(); err != nil {
+		return shared.Fail(err)
+	}
+	ctx := context.Background()
+	for _, path := range args {
+		var err error
+		if argStapleOnly {
+			err = notary.Staple(ctx, nil, path)
+		} else {
+			err = notarize(ctx, path, !argNoStaple)
+		}
+		if err != nil {
+			return shared.Fail(fmt.Errorf("%s: %w", path, err))
+		}
+		if argStapleOnly {
+			fmt.Fprintln(os.Stderr, "Stapled", path)
+		}
+	}
+	return nil
+}
+
+func notarize(ctx context.Context, path string, staple bool) error {
+	if path == "-" {
+		return errors.New("can't notarize standard output")
+	}
+	client, conf, err := newClient()
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	upload := f
+	if !canStaple(f) {
+		// the notary service takes bare binaries only inside a zip
+		zipped, err := zipFile(f)
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(filepath.Dir(zipped.Name()))
+		defer zipped.Close()
+		upload = zipped
+		staple = false
+	}
+	id, err := client.Submit(ctx, upload)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Submitted %s for notarization as %s\n", path, id)
+	timeout := conf.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	interval := conf.PollInterval
+	if interval == 0 {
+		interval = defaultPollInterval
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+	defer cancel()
+	sub, err := client.Wait(waitCtx, id, time.Duration(interval)*time.Second)
+	if err != nil {
+		return fmt.Errorf("waiting for submission %s: %w", id, err)
+	}
+	if sub.Status != notary.StatusAccepted {
+		if log, err := client.Log(ctx, id); err == nil {
+			os.Stderr.Write(log)
+			fmt.Fprintln(os.Stderr)
+		}
+		return fmt.Errorf("submission %s: %s", id, sub.Status)
+	}
+	fmt.Fprintf(os.Stderr, "Notarized %s\n", path)
+	if !staple {
+		return nil
+	}
+	f.Close()
+	if err := notary.Staple(ctx, nil, path); err != nil {
+		return fmt.Errorf("stapling: %w", err)
+	}
+	fmt.Fprintln(os.Stderr, "Stapled", path)
+	return nil
+}
+
+func newClient() (*notary.Client, *config.NotaryConfig, error) {
+	if err := shared.InitClientConfig(); err != nil {
+		return nil, nil, err
+	}
+	conf := shared.CurrentConfig.Notary
+	if conf == nil || conf.KeyID == "" || conf.IssuerID == "" || conf.KeyFile == "" {
+		return nil, nil, errors.New("notary keyid, issuerid and keyfile must be set in the configuration")
+	}
+	blob, err := os.ReadFile(conf.KeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := certloader.ParseAnyPrivateKey(blob, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", conf.KeyFile, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, nil, fmt.Errorf("%s: unsupported key type", conf.KeyFile)
+	}
+	client := &notary.Client{
+		KeyID:    conf.KeyID,
+		IssuerID: conf.IssuerID,
+		Key:      signer,
+	}
+	return client, conf, nil
+}
+
+// installer packages, disk images and zipped apps can be stapled
+func canStaple(f *os.File) bool {
+	defer f.Seek(0, 0) //nolint:errcheck
+	switch magic.Detect(f) {
+	case magic.FileTypeXAR, magic.FileTypeIPA:
+		return true
+	}
+	_, err := dmg.Open(f)
+	return err == nil
+}
+
+func zipFile(f *os.File) (*os.File, error) {
+	dir, err := os.MkdirTemp("", "")
+	if err != nil {
+		return nil, err
+	}
+	out, err := os.Create(filepath.Join(dir, filepath.Base(f.Name())+".zip"))
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	zw := zip.NewWriter(out)
+	hdr := &zip.FileHeader{Name: filepath.Base(f.Name()), Method: zip.Deflate}
+	hdr.SetMode(0755)
+	w, err := zw.CreateHeader(hdr)
+	if err == nil {
+		_, err = io.Copy(w, f)
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		out.Close()
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return out, nil
+}
@@ -34,13 +34,17 @@ var GetKeyCmd = &cobra.Command{
 	RunE:  getKeyCmd,
 }
 
+var argAllVersions bool
+
 func init() {
 	RemoteCmd.AddCommand(GetKeyCmd)
+	GetKeyCmd.Flags().BoolVar(&argAllVersions, "all-versions", false, "Also output certificates of older versions of a rotated key")
 }
 
 type keyInfo struct {
-	X509Certificate string
-	PGPCertificate  string
+	X509Certificate  string
+	PGPCertificate   string
+	PreviousVersions []keyInfo
 }
 
 func getKeyInfo(keyName string) (keyInfo, error) {
@@ -71,6 +75,12 @@ func getKeyCmd(cmd *cobra.Command, args []string) error {
 		}
 		os.Stdout.WriteString(info.X509Certificate)
 		os.Stdout.WriteString(info.PGPCertificate)
+		if argAllVersions {
+			for _, prev := range info.PreviousVersions {
+				os.Stdout.WriteString(prev.X509Certificate)
+				os.Stdout.WriteString(prev.PGPCertificate)
+			}
+		}
 	}
 	return nil
 }
@@ -0,0 +1,89 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package remotecmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sassoftware/relic/v7/cmdline/shared"
+	"github.com/sassoftware/relic/v7/signers"
+)
+
+var SignAptCmd = &cobra.Command{
+	Use:   "sign-apt-repo",
+	Short: "Sign the Release files of an APT repository using a remote signing server",
+	Long: `Sign the Release file of each suite under the repository's dists/ directory,
+writing a detached Release.gpg and a clearsigned InRelease next to it. The
+index files listed in each Release file are checked before it is signed.`,
+	RunE: signAptCmd,
+}
+
+var (
+	argAptRepo        string
+	argAptSuites      []string
+	argAptCheckByHash bool
+)
+
+func init() {
+	RemoteCmd.AddCommand(SignAptCmd)
+	SignAptCmd.Flags().StringVarP(&argKeyName, "key", "k", "", "Name of key on remote server to use")
+	SignAptCmd.Flags().StringVar(&argAptRepo, "repo", "", "Root directory of the repository")
+	SignAptCmd.Flags().StringArrayVar(&argAptSuites, "suite", nil, "Suite to sign (default: all suites under dists/)")
+	SignAptCmd.Flags().BoolVar(&argAptCheckByHash, "check-by-hash", false, "Check that by-hash copies of the index files are present")
+	shared.AddDigestFlag(SignAptCmd)
+}
+
+func signAptCmd(cmd *cobra.Command, args []string) error {
+	if argAptRepo == "" || argKeyName == "" {
+		return errors.New("--repo and --key are required")
+	}
+	mod := signers.ByName("apt-release")
+	if mod == nil {
+		return errors.New("APT signing is not available")
+	}
+	suites := argAptSuites
+	if len(suites) == 0 {
+		matches, err := filepath.Glob(filepath.Join(argAptRepo, "dists", "*", "Release"))
+		if err != nil {
+			return shared.Fail(err)
+		}
+		for _, m := range matches {
+			suites = append(suites, filepath.Base(filepath.Dir(m)))
+		}
+		if len(suites) == 0 {
+			return shared.Fail(errors.New("no Release files found under dists/"))
+		}
+	}
+	flags := &signers.FlagValues{
+		Defs:   mod.Flags(),
+		Values: map[string]string{"apt-check-by-hash": strconv.FormatBool(argAptCheckByHash)},
+	}
+	for _, suite := range suites {
+		release := filepath.Join(argAptRepo, "dists", suite, "Release")
+		if _, err := signFile(mod, flags, argKeyName, release, release); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Signed %s\n", release)
+	}
+	return nil
+}
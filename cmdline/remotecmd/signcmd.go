@@ -17,8 +17,10 @@
 package remotecmd
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -48,6 +50,7 @@ func init() {
 	SignCmd.Flags().StringVarP(&argSigType, "sig-type", "T", "", "Specify signature type (default: auto-detect)")
 	SignCmd.Flags().BoolVar(&argIfUnsigned, "if-unsigned", false, "Skip signing if the file already has a signature")
 	shared.AddDigestFlag(SignCmd)
+	shared.AddAttestFlags(SignCmd)
 	shared.AddLateHook(func() {
 		signers.MergeFlags(SignCmd)
 	})
@@ -73,77 +76,129 @@ func signCmd(cmd *cobra.Command, args []string) (err error) {
 	if err != nil {
 		return shared.Fail(err)
 	}
-	infile, err := shared.OpenForPatching(argFile, argOutput)
+	attest, err := shared.StartAttestation(argFile, argOutput)
 	if err != nil {
 		return shared.Fail(err)
+	}
+	skipped, err := signFile(mod, flags, argKeyName, argFile, argOutput)
+	if err != nil {
+		return err
+	} else if skipped {
+		return nil
+	}
+	if attest != nil {
+		if err := signAttestation(attest, mod); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Signed %s\n", argFile)
+	return nil
+}
+
+// Have the server sign provenance for the file that was just signed
+func signAttestation(attest *shared.Attestation, mod *signers.Signer) error {
+	intotoMod := signers.ByName("intoto")
+	if intotoMod == nil {
+		return shared.Fail(errors.New("in-toto attestations are not available"))
+	}
+	stmt, err := attest.Statement(argOutput, map[string]interface{}{"sigType": mod.Name, "key": argKeyName})
+	if err != nil {
+		return shared.Fail(err)
+	}
+	tmp, err := ioutil.TempFile("", "relic-attest-")
+	if err != nil {
+		return shared.Fail(err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(stmt)
+	tmp.Close()
+	if err != nil {
+		return shared.Fail(err)
+	}
+	// the statement is always unsigned, so don't try to check it
+	argIfUnsigned = false
+	if _, err := signFile(intotoMod, nil, argKeyName, tmp.Name(), attest.Path(argOutput)); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "Wrote attestation to", attest.Path(argOutput))
+	return nil
+}
+
+// Sign one file using the remote server, returning true if it was skipped
+// because it was already signed
+func signFile(mod *signers.Signer, flags *signers.FlagValues, keyName, file, output string) (skipped bool, err error) {
+	infile, err := shared.OpenForPatching(file, output)
+	if err != nil {
+		return false, shared.Fail(err)
 	} else if infile == os.Stdin {
 		if !mod.AllowStdin {
-			return shared.Fail(errors.New("this signature type does not support reading from stdin"))
+			return false, shared.Fail(errors.New("this signature type does not support reading from stdin"))
 		}
 	} else {
 		defer infile.Close()
 	}
 	if argIfUnsigned {
 		if infile == os.Stdin {
-			return shared.Fail(errors.New("cannot use --if-unsigned with standard input"))
+			return false, shared.Fail(errors.New("cannot use --if-unsigned with standard input"))
 		}
 		if signed, err := mod.IsSigned(infile); err != nil {
-			return shared.Fail(err)
+			return false, shared.Fail(err)
 		} else if signed {
-			fmt.Fprintf(os.Stderr, "skipping already-signed file: %s\n", argFile)
-			return nil
+			fmt.Fprintf(os.Stderr, "skipping already-signed file: %s\n", file)
+			return true, nil
 		}
 		if _, err := infile.Seek(0, 0); err != nil {
-			return shared.Fail(fmt.Errorf("rewinding input file: %w", err))
+			return false, shared.Fail(fmt.Errorf("rewinding input file: %w", err))
 		}
 	}
 	// transform input if needed
 	hash, err := shared.GetDigest()
 	if err != nil {
-		return err
+		return false, err
 	}
 	opts := signers.SignOpts{
-		Path:  argFile,
+		Path:  file,
 		Hash:  hash,
 		Flags: flags,
 	}
 	transform, err := mod.GetTransform(infile, opts)
 	if err != nil {
-		return shared.Fail(err)
+		return false, shared.Fail(err)
 	}
 	// build request
 	values := url.Values{}
-	values.Add("key", argKeyName)
-	values.Add("filename", filepath.Base(argFile))
+	values.Add("key", keyName)
+	values.Add("filename", filepath.Base(file))
 	values.Add("sigtype", mod.Name)
 	if err := flags.ToQuery(values); err != nil {
-		return shared.Fail(err)
+		return false, shared.Fail(err)
 	}
 	if err := setDigestQueryParam(values); err != nil {
-		return err
+		return false, err
 	}
 	// do request
 	response, err := CallRemote("sign", "POST", &values, transform)
 	if err != nil {
-		return shared.Fail(err)
+		return false, shared.Fail(err)
 	}
 	defer response.Body.Close()
 	// apply the result
-	if err := transform.Apply(argOutput, response.Header.Get("Content-Type"), response.Body); err != nil {
-		return shared.Fail(err)
+	if err := transform.Apply(output, response.Header.Get("Content-Type"), response.Body); err != nil {
+		return false, shared.Fail(err)
 	}
 	// if needed, do a final fixup step
 	if mod.Fixup != nil {
-		f, err := os.OpenFile(argOutput, os.O_RDWR, 0)
+		f, err := os.OpenFile(output, os.O_RDWR, 0)
 		if err != nil {
-			return shared.Fail(err)
+			return false, shared.Fail(err)
 		}
 		defer f.Close()
 		if err := mod.Fixup(f); err != nil {
-			return shared.Fail(err)
+			return false, shared.Fail(err)
 		}
 	}
-
-	fmt.Fprintf(os.Stderr, "Signed %s\n", argFile)
-	return nil
+	if err := shared.RunPostSignHooks(context.Background(), flags, output); err != nil {
+		return false, shared.Fail(err)
+	}
+	return false, nil
 }
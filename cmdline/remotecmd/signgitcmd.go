@@ -0,0 +1,45 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package remotecmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/sassoftware/relic/v7/cmdline/shared"
+)
+
+var SignGitCmd = &cobra.Command{
+	Use:   "sign-git",
+	Short: "Sign git commits and tags",
+	Long:  "This command accepts the arguments git uses when invoking gpg.program, gpg.x509.program or gpg.ssh.program. Data is read from standard input and signed with the named key, producing a PGP signature for PGP keys or a gpgsm-compatible CMS signature for X.509 keys. When invoked like ssh-keygen, an SSH signature is written next to the input file. Verification is passed through to gpg, gpgsm or ssh-keygen.",
+	RunE:  signGitCmd,
+}
+
+func init() {
+	shared.AddGitSignFlags(SignGitCmd)
+	RemoteCmd.AddCommand(SignGitCmd)
+}
+
+func signGitCmd(cmd *cobra.Command, args []string) error {
+	return shared.CallGitSign(SignCmd, args, func(keyName string) (bool, error) {
+		info, err := getKeyInfo(keyName)
+		if err != nil {
+			return false, err
+		}
+		return info.PGPCertificate == "" && info.X509Certificate != "", nil
+	})
+}
@@ -0,0 +1,158 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package remotecmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sassoftware/relic/v7/cmdline/shared"
+	"github.com/sassoftware/relic/v7/lib/cosign"
+	"github.com/sassoftware/relic/v7/lib/oci"
+	"github.com/sassoftware/relic/v7/lib/sigstore"
+	"github.com/sassoftware/relic/v7/signers"
+)
+
+var SignImageCmd = &cobra.Command{
+	Use:   "sign-image IMAGE...",
+	Short: "Sign container images in a registry using a remote signing server",
+	Long: `Sign container images by digest in a format cosign can verify, and push the
+signatures to the image's registry. Tags are resolved to a digest first.
+
+With the default --scheme tag, a simple signing payload is attached under the
+sha256-<digest>.sig tag, which every version of cosign understands. With
+--scheme referrers, a Sigstore bundle is attached as an OCI 1.1 referrer of
+the image, falling back to the referrers tag schema on registries that don't
+implement the referrers API.
+
+Registry credentials are read from the docker or podman configuration.`,
+	RunE: signImageCmd,
+}
+
+var (
+	argImageScheme      string
+	argImageAnnotations []string
+	argImageInsecure    bool
+)
+
+func init() {
+	RemoteCmd.AddCommand(SignImageCmd)
+	SignImageCmd.Flags().StringVarP(&argKeyName, "key", "k", "", "Name of key on remote server to use")
+	SignImageCmd.Flags().StringVar(&argImageScheme, "scheme", "tag", "How to attach the signature: tag or referrers")
+	SignImageCmd.Flags().StringArrayVarP(&argImageAnnotations, "annotation", "a", nil, "Add a KEY=VALUE annotation to the signed payload")
+	SignImageCmd.Flags().BoolVar(&argImageInsecure, "insecure-registry", false, "Talk to the registry over plain HTTP")
+}
+
+func signImageCmd(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 || argKeyName == "" {
+		return errors.New("--key and at least one image are required")
+	}
+	if argImageScheme != "tag" && argImageScheme != "referrers" {
+		return fmt.Errorf("unknown --scheme %q", argImageScheme)
+	}
+	mod := signers.ByName("cosign")
+	if mod == nil {
+		return errors.New("cosign signing is not available")
+	}
+	annotations := make(map[string]string, len(argImageAnnotations))
+	for _, a := range argImageAnnotations {
+		k, v, ok := strings.Cut(a, "=")
+		if !ok || k == "" {
+			return fmt.Errorf("annotation %q must be in KEY=VALUE form", a)
+		}
+		annotations[k] = v
+	}
+	client := oci.NewClient()
+	client.PlainHTTP = argImageInsecure
+	for _, image := range args {
+		if err := signImage(mod, client, image, annotations); err != nil {
+			return shared.Fail(fmt.Errorf("%s: %w", image, err))
+		}
+	}
+	return nil
+}
+
+func signImage(mod *signers.Signer, client *oci.Client, image string, annotations map[string]string) error {
+	ctx := context.Background()
+	ref, err := oci.ParseReference(image)
+	if err != nil {
+		return err
+	}
+	desc, err := client.Resolve(ctx, ref)
+	if err != nil {
+		return err
+	}
+	digestRef := ref.WithDigest(desc.Digest)
+	subj := cosign.Subject{Name: ref.Name(), Digest: desc.Digest}
+	if len(annotations) != 0 {
+		subj.Annotations = annotations
+	}
+	var payload []byte
+	if argImageScheme == "referrers" {
+		payload, err = cosign.NewStatement(subj)
+	} else {
+		payload, err = cosign.NewPayload(subj)
+	}
+	if err != nil {
+		return err
+	}
+	bundleJSON, err := signImagePayload(mod, nil, payload)
+	if err != nil {
+		return err
+	}
+	if argImageScheme == "referrers" {
+		err = cosign.AttachBundle(ctx, client, digestRef, desc, bundleJSON, time.Now())
+	} else {
+		var bundle *sigstore.Bundle
+		bundle, err = sigstore.Parse(bundleJSON)
+		if err == nil {
+			err = cosign.AttachSignature(ctx, client, digestRef, payload, bundle)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Signed %s\n", digestRef)
+	return nil
+}
+
+// Send the payload to the server through a temporary file, returning the
+// signature it produces
+func signImagePayload(mod *signers.Signer, flags *signers.FlagValues, payload []byte) ([]byte, error) {
+	tmp, err := ioutil.TempFile("", "relic-image-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer os.Remove(tmp.Name() + ".bundle")
+	_, err = tmp.Write(payload)
+	tmp.Close()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := signFile(mod, flags, argKeyName, tmp.Name(), tmp.Name()+".bundle"); err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(tmp.Name() + ".bundle")
+}
@@ -0,0 +1,210 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package remotecmd
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sassoftware/relic/v7/cmdline/shared"
+	"github.com/sassoftware/relic/v7/lib/atomicfile"
+	"github.com/sassoftware/relic/v7/signers"
+)
+
+var SignMavenCmd = &cobra.Command{
+	Use:   "sign-maven-repo",
+	Short: "Sign every artifact in a Maven repository layout using a remote signing server",
+	Long: `Walk a Maven repository layout, such as the output of "mvn deploy
+-DaltDeploymentRepository=local::file:staging", and write a detached armored
+PGP signature <artifact>.asc plus .md5, .sha1, .sha256 and .sha512 checksums
+for every artifact and maven-metadata.xml, as required for Maven Central
+staging.
+
+Artifacts whose checksums are unchanged and whose .asc is newer than the
+artifact are skipped, so the command can be re-run after adding artifacts to
+the repository. Use --force to re-sign everything.`,
+	RunE: signMavenCmd,
+}
+
+var (
+	argMavenRepo  string
+	argMavenForce bool
+)
+
+// suffixes of files generated for each artifact, which are not themselves
+// artifacts
+var mavenChecksums = []struct {
+	suffix string
+	hash   func() hash.Hash
+}{
+	{".md5", md5.New},
+	{".sha1", sha1.New},
+	{".sha256", sha256.New},
+	{".sha512", sha512.New},
+}
+
+func init() {
+	RemoteCmd.AddCommand(SignMavenCmd)
+	SignMavenCmd.Flags().StringVarP(&argKeyName, "key", "k", "", "Name of key on remote server to use")
+	SignMavenCmd.Flags().StringVar(&argMavenRepo, "repo", "", "Root directory of the repository")
+	SignMavenCmd.Flags().BoolVar(&argMavenForce, "force", false, "Re-sign artifacts even if their signature is up to date")
+	shared.AddDigestFlag(SignMavenCmd)
+}
+
+func signMavenCmd(cmd *cobra.Command, args []string) error {
+	if argMavenRepo == "" || argKeyName == "" {
+		return errors.New("--repo and --key are required")
+	}
+	mod := signers.ByName("pgp")
+	if mod == nil {
+		return errors.New("pgp signing is not available")
+	}
+	artifacts, err := listMavenRepo(argMavenRepo)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	if len(artifacts) == 0 {
+		return shared.Fail(fmt.Errorf("no artifacts found in %s", argMavenRepo))
+	}
+	flags := &signers.FlagValues{
+		Defs:   mod.Flags(),
+		Values: map[string]string{"armor": "true"},
+	}
+	var signed, skipped int
+	for _, fp := range artifacts {
+		changed, err := updateMavenChecksums(fp)
+		if err != nil {
+			return shared.Fail(fmt.Errorf("%s: %w", fp, err))
+		}
+		if !changed && !argMavenForce && mavenSignatureCurrent(fp) {
+			skipped++
+			continue
+		}
+		if _, err := signFile(mod, flags, argKeyName, fp, fp+".asc"); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Signed %s\n", fp)
+		signed++
+	}
+	fmt.Fprintf(os.Stderr, "Signed %d artifact(s), %d already up to date\n", signed, skipped)
+	return nil
+}
+
+// Find artifacts in the repository, skipping generated signatures and
+// checksums as well as the bookkeeping files of a local repository
+func listMavenRepo(root string) ([]string, error) {
+	var artifacts []string
+	err := filepath.Walk(root, func(fp string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name := info.Name()
+		if strings.HasPrefix(name, ".") && fp != root {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() || !isMavenArtifact(name) {
+			return nil
+		}
+		artifacts = append(artifacts, fp)
+		return nil
+	})
+	return artifacts, err
+}
+
+func isMavenArtifact(name string) bool {
+	if strings.HasSuffix(name, ".asc") || strings.HasSuffix(name, ".lastUpdated") {
+		return false
+	}
+	for _, c := range mavenChecksums {
+		if strings.HasSuffix(name, c.suffix) {
+			return false
+		}
+	}
+	switch name {
+	case "_remote.repositories", "resolver-status.properties":
+		return false
+	}
+	return !strings.HasPrefix(name, "maven-metadata-") || name == "maven-metadata.xml"
+}
+
+// Write checksum files for an artifact, returning true if any were missing or
+// out of date
+func updateMavenChecksums(fp string) (bool, error) {
+	f, err := os.Open(fp)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	hashes := make([]hash.Hash, len(mavenChecksums))
+	writers := make([]io.Writer, len(mavenChecksums))
+	for i, c := range mavenChecksums {
+		hashes[i] = c.hash()
+		writers[i] = hashes[i]
+	}
+	if _, err := io.Copy(io.MultiWriter(writers...), f); err != nil {
+		return false, err
+	}
+	var changed bool
+	for i, c := range mavenChecksums {
+		digest := []byte(hex.EncodeToString(hashes[i].Sum(nil)))
+		existing, err := ioutil.ReadFile(fp + c.suffix)
+		if err == nil {
+			// some tools append the file name after the digest
+			if fields := bytes.Fields(existing); len(fields) > 0 && bytes.EqualFold(fields[0], digest) {
+				continue
+			}
+		} else if !os.IsNotExist(err) {
+			return false, err
+		}
+		if err := atomicfile.WriteFile(fp+c.suffix, digest); err != nil {
+			return false, err
+		}
+		changed = true
+	}
+	return changed, nil
+}
+
+// Returns true if the artifact's signature exists and is newer than the
+// artifact
+func mavenSignatureCurrent(fp string) bool {
+	artifact, err := os.Stat(fp)
+	if err != nil {
+		return false
+	}
+	sig, err := os.Stat(fp + ".asc")
+	if err != nil {
+		return false
+	}
+	return !sig.ModTime().Before(artifact.ModTime())
+}
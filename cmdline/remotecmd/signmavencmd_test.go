@@ -0,0 +1,169 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package remotecmd
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sassoftware/relic/v7/cmdline/shared"
+	"github.com/sassoftware/relic/v7/config"
+	_ "github.com/sassoftware/relic/v7/signers/pgp"
+)
+
+func TestIsMavenArtifact(t *testing.T) {
+	cases := map[string]bool{
+		"foo-1.0.jar":                true,
+		"foo-1.0.pom":                true,
+		"foo-1.0-sources.jar":        true,
+		"maven-metadata.xml":         true,
+		"maven-metadata-local.xml":   false,
+		"foo-1.0.jar.asc":            false,
+		"foo-1.0.jar.md5":            false,
+		"foo-1.0.jar.sha1":           false,
+		"foo-1.0.jar.sha256":         false,
+		"foo-1.0.jar.sha512":         false,
+		"foo-1.0.jar.lastUpdated":    false,
+		"_remote.repositories":       false,
+		"resolver-status.properties": false,
+	}
+	for name, expected := range cases {
+		assert.Equal(t, expected, isMavenArtifact(name), name)
+	}
+}
+
+// fake signing server that records the query of every sign request
+type mavenServer struct {
+	*httptest.Server
+	requests []url.Values
+}
+
+func newMavenServer(t *testing.T) *mavenServer {
+	s := new(mavenServer)
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/directory":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte("{}"))
+		case "/sign":
+			_, _ = io.Copy(io.Discard, r.Body)
+			s.requests = append(s.requests, r.URL.Query())
+			_, _ = w.Write([]byte("signature of " + r.URL.Query().Get("filename")))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func setMavenArgs(t *testing.T, srv *mavenServer, repo, key string, force bool) {
+	prevConfig := shared.CurrentConfig
+	t.Cleanup(func() {
+		shared.CurrentConfig = prevConfig
+		argMavenRepo, argKeyName, argMavenForce = "", "", false
+	})
+	shared.CurrentConfig = &config.Config{Remote: &config.RemoteConfig{
+		URL:         srv.URL + "/",
+		AccessToken: "token",
+	}}
+	argMavenRepo, argKeyName, argMavenForce = repo, key, force
+}
+
+func writeMavenRepo(t *testing.T) string {
+	repo := t.TempDir()
+	dir := filepath.Join(repo, "com", "example", "foo", "1.0")
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(repo, ".cache"), 0755))
+	files := map[string]string{
+		"com/example/foo/1.0/foo-1.0.jar":          "jar contents",
+		"com/example/foo/1.0/foo-1.0.pom":          "<project/>",
+		"com/example/foo/1.0/_remote.repositories": "",
+		"com/example/foo/maven-metadata.xml":       "<metadata/>",
+		"com/example/foo/maven-metadata-local.xml": "<metadata/>",
+		".cache/ignored.jar":                       "",
+	}
+	for name, contents := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(repo, filepath.FromSlash(name)), []byte(contents), 0644))
+	}
+	return repo
+}
+
+func TestSignMavenArgs(t *testing.T) {
+	srv := newMavenServer(t)
+	repo := writeMavenRepo(t)
+	setMavenArgs(t, srv, "", "mykey", false)
+	assert.EqualError(t, signMavenCmd(SignMavenCmd, nil), "--repo and --key are required")
+	setMavenArgs(t, srv, repo, "", false)
+	assert.EqualError(t, signMavenCmd(SignMavenCmd, nil), "--repo and --key are required")
+	assert.Empty(t, srv.requests)
+}
+
+func TestSignMavenRepo(t *testing.T) {
+	srv := newMavenServer(t)
+	repo := writeMavenRepo(t)
+	setMavenArgs(t, srv, repo, "mykey", false)
+	require.NoError(t, signMavenCmd(SignMavenCmd, nil))
+
+	var names []string
+	for _, q := range srv.requests {
+		assert.Equal(t, "mykey", q.Get("key"))
+		assert.Equal(t, "pgp", q.Get("sigtype"))
+		assert.Equal(t, "true", q.Get("armor"))
+		names = append(names, q.Get("filename"))
+	}
+	sort.Strings(names)
+	assert.Equal(t, []string{"foo-1.0.jar", "foo-1.0.pom", "maven-metadata.xml"}, names)
+
+	jar := filepath.Join(repo, "com", "example", "foo", "1.0", "foo-1.0.jar")
+	sig, err := os.ReadFile(jar + ".asc")
+	require.NoError(t, err)
+	assert.Equal(t, "signature of foo-1.0.jar", string(sig))
+	sum, err := os.ReadFile(jar + ".sha1")
+	require.NoError(t, err)
+	assert.Equal(t, "1ac30d8e92c0b9ae627b823794f49f2e362b0056", string(sum))
+	for _, suffix := range []string{".md5", ".sha256", ".sha512"} {
+		assert.FileExists(t, jar+suffix)
+	}
+	assert.NoFileExists(t, filepath.Join(repo, "com", "example", "foo", "maven-metadata-local.xml.asc"))
+
+	// nothing changed, so nothing is signed again
+	srv.requests = nil
+	require.NoError(t, signMavenCmd(SignMavenCmd, nil))
+	assert.Empty(t, srv.requests)
+
+	// a changed artifact is signed again
+	require.NoError(t, os.WriteFile(jar, []byte("new jar contents"), 0644))
+	require.NoError(t, signMavenCmd(SignMavenCmd, nil))
+	require.Len(t, srv.requests, 1)
+	assert.Equal(t, "foo-1.0.jar", srv.requests[0].Get("filename"))
+
+	// --force signs everything
+	srv.requests = nil
+	argMavenForce = true
+	require.NoError(t, signMavenCmd(SignMavenCmd, nil))
+	assert.Len(t, srv.requests, 3)
+}
@@ -0,0 +1,164 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package remotecmd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sassoftware/relic/v7/cmdline/shared"
+	"github.com/sassoftware/relic/v7/lib/atomicfile"
+	"github.com/sassoftware/relic/v7/lib/pacman"
+	"github.com/sassoftware/relic/v7/signers"
+)
+
+var SignPacmanCmd = &cobra.Command{
+	Use:   "sign-pacman-repo",
+	Short: "Re-sign the packages and databases of a pacman repository using a remote signing server",
+	Long: `Sign every package in a pacman repository directory, writing a detached
+<package>.sig next to each one. The signatures embedded in the repository
+databases (<repo>.db.tar.* and <repo>.files.tar.*) are then updated and the
+databases themselves are signed, along with a <repo>.db.sig symlink matching
+the one repo-add creates.`,
+	RunE: signPacmanCmd,
+}
+
+var argPacmanRepo string
+
+func init() {
+	RemoteCmd.AddCommand(SignPacmanCmd)
+	SignPacmanCmd.Flags().StringVarP(&argKeyName, "key", "k", "", "Name of key on remote server to use")
+	SignPacmanCmd.Flags().StringVar(&argPacmanRepo, "repo", "", "Directory containing the repository")
+	shared.AddDigestFlag(SignPacmanCmd)
+}
+
+func signPacmanCmd(cmd *cobra.Command, args []string) error {
+	if argPacmanRepo == "" || argKeyName == "" {
+		return errors.New("--repo and --key are required")
+	}
+	mod := signers.ByName("pacman")
+	if mod == nil {
+		return errors.New("pacman signing is not available")
+	}
+	pkgs, dbs, err := listPacmanRepo(argPacmanRepo)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	sigs := make(map[string][]byte, len(pkgs))
+	for _, name := range pkgs {
+		fp := filepath.Join(argPacmanRepo, name)
+		if _, err := signFile(mod, nil, argKeyName, fp, fp); err != nil {
+			return err
+		}
+		sig, err := ioutil.ReadFile(fp + ".sig")
+		if err != nil {
+			return shared.Fail(err)
+		}
+		sigs[name] = sig
+		fmt.Fprintf(os.Stderr, "Signed %s\n", fp)
+	}
+	for _, name := range dbs {
+		fp := filepath.Join(argPacmanRepo, name)
+		if err := updatePacmanDB(fp, sigs); err != nil {
+			return shared.Fail(fmt.Errorf("%s: %w", fp, err))
+		}
+		if _, err := signFile(mod, nil, argKeyName, fp, fp); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Signed %s\n", fp)
+	}
+	return shared.Fail(linkPacmanSigs(argPacmanRepo))
+}
+
+// Find packages and databases in the repository directory. Symlinks and old
+// backups made by repo-add are skipped.
+func listPacmanRepo(dir string) (pkgs, dbs []string, err error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Mode().IsRegular() || strings.HasSuffix(name, ".sig") || strings.HasSuffix(name, ".old") {
+			continue
+		}
+		switch {
+		case strings.Contains(name, ".pkg.tar"):
+			pkgs = append(pkgs, name)
+		case strings.Contains(name, ".db.tar"), strings.Contains(name, ".files.tar"):
+			dbs = append(dbs, name)
+		}
+	}
+	sort.Strings(pkgs)
+	sort.Strings(dbs)
+	return pkgs, dbs, nil
+}
+
+// Replace the package signatures embedded in a repository database
+func updatePacmanDB(fp string, sigs map[string][]byte) error {
+	f, err := os.Open(fp)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	outfile, err := atomicfile.New(fp)
+	if err != nil {
+		return err
+	}
+	defer outfile.Close()
+	updated, err := pacman.UpdateSignatures(f, outfile, fp, sigs)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Updated %d package signature(s) in %s\n", updated, fp)
+	return outfile.Commit()
+}
+
+// For each <repo>.db -> <repo>.db.tar.gz symlink, add <repo>.db.sig ->
+// <repo>.db.tar.gz.sig
+func linkPacmanSigs(dir string) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.Mode()&os.ModeSymlink == 0 || !(strings.HasSuffix(name, ".db") || strings.HasSuffix(name, ".files")) {
+			continue
+		}
+		fp := filepath.Join(dir, name)
+		target, err := os.Readlink(fp)
+		if err != nil {
+			return err
+		}
+		sigPath := fp + ".sig"
+		if _, err := os.Lstat(sigPath); err == nil {
+			continue
+		}
+		if err := os.Symlink(target+".sig", sigPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package remotecmd
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sassoftware/relic/v7/cmdline/shared"
+	"github.com/sassoftware/relic/v7/lib/atomicfile"
+	"github.com/sassoftware/relic/v7/lib/authenticode"
+	"github.com/sassoftware/relic/v7/signers"
+)
+
+var SignPsModuleCmd = &cobra.Command{
+	Use:   "sign-ps-module DIR",
+	Short: "Sign a PowerShell module and its file catalog using a remote signing server",
+	Long: `Sign every script in a PowerShell module directory, then generate a file
+catalog for the module the way New-FileCatalog does, sign it, and check the
+result the way Test-FileCatalog does before publishing with Publish-Module.
+
+The catalog is written to DIR/<module>.cat unless --catalog is given. It lists
+every file in the directory, so files must not be added or changed afterwards.`,
+	RunE: signPsModuleCmd,
+}
+
+var (
+	argPsCatalog        string
+	argPsCatalogVersion int
+)
+
+func init() {
+	RemoteCmd.AddCommand(SignPsModuleCmd)
+	SignPsModuleCmd.Flags().StringVarP(&argKeyName, "key", "k", "", "Name of key on remote server to use")
+	SignPsModuleCmd.Flags().StringVar(&argPsCatalog, "catalog", "", "Path of the catalog file")
+	SignPsModuleCmd.Flags().IntVar(&argPsCatalogVersion, "catalog-version", 2, "Catalog version: 1 for SHA-1 or 2 for SHA-256")
+}
+
+func signPsModuleCmd(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 || argKeyName == "" {
+		return errors.New("--key and exactly one module directory are required")
+	}
+	dir := args[0]
+	var hash crypto.Hash
+	switch argPsCatalogVersion {
+	case 1:
+		hash = crypto.SHA1
+	case 2:
+		hash = crypto.SHA256
+	default:
+		return fmt.Errorf("unknown --catalog-version %d", argPsCatalogVersion)
+	}
+	psMod := signers.ByName("ps")
+	catMod := signers.ByName("cat")
+	if psMod == nil || catMod == nil {
+		return errors.New("powershell signing is not available")
+	}
+	catalog := argPsCatalog
+	if catalog == "" {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return shared.Fail(err)
+		}
+		catalog = filepath.Join(dir, filepath.Base(abs)+".cat")
+	}
+	files, err := authenticode.ModuleFiles(dir, catalog)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	var scripts int
+	for _, name := range files {
+		if _, ok := authenticode.GetSigStyle(name); !ok {
+			continue
+		}
+		fp := filepath.Join(dir, filepath.FromSlash(name))
+		if _, err := signFile(psMod, nil, argKeyName, fp, fp); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Signed %s\n", fp)
+		scripts++
+	}
+	if scripts == 0 {
+		return shared.Fail(fmt.Errorf("no PowerShell scripts found in %s", dir))
+	}
+	// build the catalog after signing the scripts, as the other files in
+	// the module are digested whole
+	cat, err := authenticode.NewModuleCatalog(dir, files, hash)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	cinfo, err := cat.ContentInfo()
+	if err != nil {
+		return shared.Fail(err)
+	}
+	if err := atomicfile.WriteFile(catalog, cinfo.Raw); err != nil {
+		return shared.Fail(err)
+	}
+	if _, err := signFile(catMod, nil, argKeyName, catalog, catalog); err != nil {
+		return err
+	}
+	blob, err := ioutil.ReadFile(catalog)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	if _, err := authenticode.VerifyModuleCatalog(blob, dir, files, false); err != nil {
+		return shared.Fail(fmt.Errorf("%s: %w", catalog, err))
+	}
+	fmt.Fprintf(os.Stderr, "Signed %s with %d file(s)\n", catalog, len(files))
+	return nil
+}
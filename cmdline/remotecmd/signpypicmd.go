@@ -0,0 +1,88 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package remotecmd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sassoftware/relic/v7/cmdline/shared"
+	"github.com/sassoftware/relic/v7/lib/pypi"
+	"github.com/sassoftware/relic/v7/signers"
+)
+
+var SignPypiCmd = &cobra.Command{
+	Use:   "sign-pypi-dist",
+	Short: "Sign every wheel and sdist in a directory using a remote signing server",
+	Long: `Sign every wheel and sdist in a directory, typically dist/. With the default
+--format attestation, a PEP 740 publish attestation is written to
+<dist>.publish.attestation for use with "twine upload --attestations". With
+--format asc, a detached PGP signature is written to <dist>.asc.`,
+	RunE: signPypiCmd,
+}
+
+var (
+	argPypiDist   string
+	argPypiFormat string
+)
+
+func init() {
+	RemoteCmd.AddCommand(SignPypiCmd)
+	SignPypiCmd.Flags().StringVarP(&argKeyName, "key", "k", "", "Name of key on remote server to use")
+	SignPypiCmd.Flags().StringVar(&argPypiDist, "dist", "dist", "Directory containing the distributions")
+	SignPypiCmd.Flags().StringVar(&argPypiFormat, "format", "attestation", "Signature format: attestation or asc")
+	shared.AddDigestFlag(SignPypiCmd)
+}
+
+func signPypiCmd(cmd *cobra.Command, args []string) error {
+	if argKeyName == "" {
+		return errors.New("--key is required")
+	}
+	mod := signers.ByName("pypi")
+	if mod == nil {
+		return errors.New("pypi signing is not available")
+	}
+	entries, err := ioutil.ReadDir(argPypiDist)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	flags := &signers.FlagValues{
+		Defs:   mod.Flags(),
+		Values: map[string]string{"pypi-format": argPypiFormat},
+	}
+	count := 0
+	for _, entry := range entries {
+		if !entry.Mode().IsRegular() || !pypi.IsDistribution(entry.Name()) {
+			continue
+		}
+		fp := filepath.Join(argPypiDist, entry.Name())
+		if _, err := signFile(mod, flags, argKeyName, fp, fp); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Signed %s\n", fp)
+		count++
+	}
+	if count == 0 {
+		return shared.Fail(fmt.Errorf("no wheels or sdists found in %s", argPypiDist))
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package remotecmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sassoftware/relic/v7/cmdline/shared"
+	"github.com/sassoftware/relic/v7/lib/atomicfile"
+	"github.com/sassoftware/relic/v7/lib/intoto"
+	"github.com/sassoftware/relic/v7/lib/oci"
+	"github.com/sassoftware/relic/v7/lib/sbom"
+	"github.com/sassoftware/relic/v7/lib/slsa"
+	"github.com/sassoftware/relic/v7/signers"
+)
+
+var SignSBOMCmd = &cobra.Command{
+	Use:   "sign-sbom --sbom FILE ARTIFACT",
+	Short: "Sign a software bill of materials as an attestation about an artifact",
+	Long: `Wrap a CycloneDX or SPDX JSON document in an in-toto statement about the
+artifact it describes, sign it using the remote server, and attach the DSSE
+envelope to the artifact:
+
+  sidecar  write ARTIFACT.sbom.intoto.jsonl, or --output if given (default)
+  zip      add the envelope to a zip-based ARTIFACT as --member; the statement
+           covers every other member, so this must be done before the archive
+           is signed with a format that covers the whole file, such as APK
+  oci      push the envelope as a referrer of the image named by ARTIFACT
+
+Registry credentials are read from the docker or podman configuration.`,
+	RunE: signSBOMCmd,
+}
+
+var (
+	argSBOMFile   string
+	argSBOMAttach string
+	argSBOMMember string
+)
+
+func init() {
+	RemoteCmd.AddCommand(SignSBOMCmd)
+	SignSBOMCmd.Flags().StringVarP(&argKeyName, "key", "k", "", "Name of key on remote server to use")
+	SignSBOMCmd.Flags().StringVar(&argSBOMFile, "sbom", "", "CycloneDX or SPDX JSON document")
+	SignSBOMCmd.Flags().StringVar(&argSBOMAttach, "attach", "sidecar", "Where to put the attestation: sidecar, zip or oci")
+	SignSBOMCmd.Flags().StringVarP(&argOutput, "output", "o", "", "Output file for sidecar attestations")
+	SignSBOMCmd.Flags().StringVar(&argSBOMMember, "member", sbom.DefaultMember, "Name of the attestation inside a zip archive")
+	SignSBOMCmd.Flags().BoolVar(&argImageInsecure, "insecure-registry", false, "Talk to the registry over plain HTTP")
+}
+
+func signSBOMCmd(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 || argKeyName == "" || argSBOMFile == "" {
+		return errors.New("--key, --sbom and exactly one artifact are required")
+	}
+	artifact := args[0]
+	document, err := ioutil.ReadFile(argSBOMFile)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	predicateType, err := sbom.PredicateType(document)
+	if err != nil {
+		return shared.Fail(fmt.Errorf("%s: %w", argSBOMFile, err))
+	}
+	mod := signers.ByName("intoto")
+	if mod == nil {
+		return shared.Fail(errors.New("in-toto attestations are not available"))
+	}
+	// the statement is always unsigned, so don't try to check it
+	argIfUnsigned = false
+	switch argSBOMAttach {
+	case "sidecar":
+		err = signSBOMSidecar(mod, document, artifact)
+	case "zip":
+		err = signSBOMZip(mod, document, artifact)
+	case "oci":
+		err = signSBOMImage(mod, document, predicateType, artifact)
+	default:
+		return fmt.Errorf("unknown --attach %q", argSBOMAttach)
+	}
+	if err != nil {
+		return shared.Fail(fmt.Errorf("%s: %w", artifact, err))
+	}
+	return nil
+}
+
+func signSBOMSidecar(mod *signers.Signer, document []byte, artifact string) error {
+	subject, err := slsa.FileSubject(artifact)
+	if err != nil {
+		return err
+	}
+	envelope, err := signSBOMStatement(mod, document, []intoto.Subject{subject})
+	if err != nil {
+		return err
+	}
+	output := argOutput
+	if output == "" {
+		output = artifact + sbom.SidecarSuffix
+	}
+	if err := atomicfile.WriteFile(output, envelope); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "Wrote attestation to", output)
+	return nil
+}
+
+func signSBOMZip(mod *signers.Signer, document []byte, artifact string) error {
+	f, err := os.Open(artifact)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	subjects, err := sbom.ZipSubjects(f, info.Size(), argSBOMMember)
+	if err != nil {
+		return err
+	}
+	envelope, err := signSBOMStatement(mod, document, subjects)
+	if err != nil {
+		return err
+	}
+	out, err := atomicfile.WriteAny(artifact)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if err := sbom.AddZipMember(out, f, info.Size(), argSBOMMember, envelope); err != nil {
+		return err
+	}
+	if err := out.Commit(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Added attestation to %s as %s\n", artifact, argSBOMMember)
+	return nil
+}
+
+func signSBOMImage(mod *signers.Signer, document []byte, predicateType, image string) error {
+	ctx := context.Background()
+	ref, err := oci.ParseReference(image)
+	if err != nil {
+		return err
+	}
+	client := oci.NewClient()
+	client.PlainHTTP = argImageInsecure
+	desc, err := client.Resolve(ctx, ref)
+	if err != nil {
+		return err
+	}
+	algorithm, digest, ok := strings.Cut(desc.Digest, ":")
+	if !ok {
+		return fmt.Errorf("invalid manifest digest %q", desc.Digest)
+	}
+	subject := intoto.Subject{Name: ref.Name(), Digest: map[string]string{algorithm: digest}}
+	envelope, err := signSBOMStatement(mod, document, []intoto.Subject{subject})
+	if err != nil {
+		return err
+	}
+	digestRef := ref.WithDigest(desc.Digest)
+	if err := sbom.AttachOCI(ctx, client, digestRef, desc, envelope, predicateType); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Attached attestation to %s\n", digestRef)
+	return nil
+}
+
+// Have the server sign a statement binding the SBOM to its subjects
+func signSBOMStatement(mod *signers.Signer, document []byte, subjects []intoto.Subject) ([]byte, error) {
+	stmt, err := sbom.Statement(document, subjects)
+	if err != nil {
+		return nil, err
+	}
+	return signImagePayload(mod, nil, stmt)
+}
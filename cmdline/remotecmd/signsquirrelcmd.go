@@ -0,0 +1,200 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package remotecmd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sassoftware/relic/v7/cmdline/shared"
+	"github.com/sassoftware/relic/v7/lib/atomicfile"
+	"github.com/sassoftware/relic/v7/lib/squirrel"
+	"github.com/sassoftware/relic/v7/signers"
+)
+
+var SignSquirrelCmd = &cobra.Command{
+	Use:   "sign-squirrel",
+	Short: "Sign a Squirrel.Windows or Electron release directory using a remote signing server",
+	Long: `Sign the contents of a Squirrel.Windows release directory, such as the
+output of "electron-forge make" or "Squirrel --releasify":
+
+ * Authenticode-sign the executables and DLLs inside each full .nupkg
+ * Authenticode-sign the top-level installers, such as Setup.exe
+ * Recompute the digests and sizes in the RELEASES file
+
+With --latest-yml, the sha512 digests and sizes in an electron-updater
+latest.yml are also updated.
+
+Files that already have a signature are left alone unless --force is given.
+Delta packages cannot be re-signed and must be regenerated from the signed
+full packages. Setup.exe embeds a copy of the full package that is not
+updated, so sign the release with Squirrel's own --signWithParams if the
+bundled copy must also be signed.`,
+	RunE: signSquirrelCmd,
+}
+
+var (
+	argSquirrelDir    string
+	argSquirrelForce  bool
+	argSquirrelLatest bool
+)
+
+func init() {
+	RemoteCmd.AddCommand(SignSquirrelCmd)
+	SignSquirrelCmd.Flags().StringVarP(&argKeyName, "key", "k", "", "Name of key on remote server to use")
+	SignSquirrelCmd.Flags().StringVar(&argSquirrelDir, "dir", "", "Release directory")
+	SignSquirrelCmd.Flags().BoolVar(&argSquirrelForce, "force", false, "Re-sign files that already have a signature")
+	SignSquirrelCmd.Flags().BoolVar(&argSquirrelLatest, "latest-yml", false, "Update the digests in the electron-updater latest.yml")
+	shared.AddDigestFlag(SignSquirrelCmd)
+}
+
+func signSquirrelCmd(cmd *cobra.Command, args []string) error {
+	if argSquirrelDir == "" || argKeyName == "" {
+		return errors.New("--dir and --key are required")
+	}
+	mod := signers.ByName("pe-coff")
+	if mod == nil {
+		return errors.New("pe-coff signing is not available")
+	}
+	flags := &signers.FlagValues{Defs: mod.Flags(), Values: map[string]string{}}
+	argIfUnsigned = !argSquirrelForce
+	releasesPath := filepath.Join(argSquirrelDir, squirrel.ReleasesFile)
+	releasesBlob, err := ioutil.ReadFile(releasesPath)
+	if err != nil && !(os.IsNotExist(err) && argSquirrelLatest) {
+		return shared.Fail(err)
+	}
+	releases, err := squirrel.ParseReleases(releasesBlob)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	// sign the contents of the full packages
+	for _, r := range releases {
+		fp := filepath.Join(argSquirrelDir, r.LocalName())
+		if r.IsDelta() {
+			fmt.Fprintf(os.Stderr, "warning: delta package %s must be regenerated from the signed full package\n", fp)
+			continue
+		}
+		if _, err := os.Stat(fp); os.IsNotExist(err) {
+			continue
+		}
+		if err := signSquirrelPackage(mod, flags, fp); err != nil {
+			return err
+		}
+	}
+	// sign the installers
+	installers, err := filepath.Glob(filepath.Join(argSquirrelDir, "*.[eE][xX][eE]"))
+	if err != nil {
+		return shared.Fail(err)
+	}
+	for _, fp := range installers {
+		skipped, err := signFile(mod, flags, argKeyName, fp, fp)
+		if err != nil {
+			return err
+		} else if !skipped {
+			fmt.Fprintf(os.Stderr, "Signed %s\n", fp)
+		}
+	}
+	// update the indexes
+	if releasesBlob != nil {
+		updated, changed, err := squirrel.UpdateReleases(releasesBlob, argSquirrelDir)
+		if err != nil {
+			return shared.Fail(fmt.Errorf("%s: %w", releasesPath, err))
+		}
+		if err := atomicfile.WriteFile(releasesPath, updated); err != nil {
+			return shared.Fail(err)
+		}
+		fmt.Fprintf(os.Stderr, "Updated %d package(s) in %s\n", changed, releasesPath)
+	}
+	if argSquirrelLatest {
+		latestPath := filepath.Join(argSquirrelDir, "latest.yml")
+		blob, err := ioutil.ReadFile(latestPath)
+		if err != nil {
+			return shared.Fail(err)
+		}
+		updated, changed, err := squirrel.UpdateLatestYML(blob, argSquirrelDir)
+		if err != nil {
+			return shared.Fail(fmt.Errorf("%s: %w", latestPath, err))
+		}
+		if err := atomicfile.WriteFile(latestPath, updated); err != nil {
+			return shared.Fail(err)
+		}
+		fmt.Fprintf(os.Stderr, "Updated %d file(s) in %s\n", changed, latestPath)
+	}
+	return nil
+}
+
+// Authenticode-sign the executables inside a full package and replace it
+func signSquirrelPackage(mod *signers.Signer, flags *signers.FlagValues, fp string) error {
+	f, err := os.Open(fp)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return shared.Fail(err)
+	}
+	out, err := atomicfile.New(fp)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	defer out.Close()
+	signed, err := squirrel.SignPackage(f, info.Size(), out, func(name string, contents []byte) ([]byte, error) {
+		return signSquirrelMember(mod, flags, name, contents)
+	})
+	if err != nil {
+		return shared.Fail(fmt.Errorf("%s: %w", fp, err))
+	}
+	if signed == 0 {
+		return nil
+	}
+	f.Close()
+	if err := out.Commit(); err != nil {
+		return shared.Fail(err)
+	}
+	fmt.Fprintf(os.Stderr, "Signed %d file(s) in %s\n", signed, fp)
+	return nil
+}
+
+// Sign one package member by way of a temporary file. Returns nil if it was
+// already signed.
+func signSquirrelMember(mod *signers.Signer, flags *signers.FlagValues, name string, contents []byte) ([]byte, error) {
+	tmp, err := ioutil.TempFile("", "relic-squirrel-*"+strings.ToLower(path.Ext(name)))
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(contents)
+	tmp.Close()
+	if err != nil {
+		return nil, err
+	}
+	skipped, err := signFile(mod, flags, argKeyName, tmp.Name(), tmp.Name())
+	if err != nil {
+		return nil, err
+	} else if skipped {
+		return nil, nil
+	}
+	return ioutil.ReadFile(tmp.Name())
+}
@@ -0,0 +1,113 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package remotecmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sassoftware/relic/v7/cmdline/shared"
+	"github.com/sassoftware/relic/v7/lib/yumrepo"
+	"github.com/sassoftware/relic/v7/signers"
+)
+
+var SignYumCmd = &cobra.Command{
+	Use:   "sign-yum-repo",
+	Short: "Sign the metadata of a Yum/DNF repository using a remote signing server",
+	Long: `Sign repodata/repomd.xml of a repository, writing repodata/repomd.xml.asc.
+
+With --sign-rpms, every package in the repository is signed first and the
+metadata is regenerated with createrepo. In all cases the metadata and package
+checksums are checked against repomd.xml before it is signed.`,
+	RunE: signYumCmd,
+}
+
+var (
+	argYumRepo       string
+	argYumSignRpms   bool
+	argYumCreaterepo string
+)
+
+func init() {
+	RemoteCmd.AddCommand(SignYumCmd)
+	SignYumCmd.Flags().StringVarP(&argKeyName, "key", "k", "", "Name of key on remote server to use")
+	SignYumCmd.Flags().StringVar(&argYumRepo, "repo", "", "Root directory of the repository")
+	SignYumCmd.Flags().BoolVar(&argYumSignRpms, "sign-rpms", false, "Sign all packages in the repository and regenerate the metadata")
+	SignYumCmd.Flags().StringVar(&argYumCreaterepo, "createrepo", "createrepo_c", "Command used to regenerate the metadata after signing packages")
+	shared.AddDigestFlag(SignYumCmd)
+}
+
+func signYumCmd(cmd *cobra.Command, args []string) error {
+	if argYumRepo == "" || argKeyName == "" {
+		return errors.New("--repo and --key are required")
+	}
+	repomdMod := signers.ByName("repomd")
+	if repomdMod == nil {
+		return errors.New("repomd signing is not available")
+	}
+	repomdPath := filepath.Join(argYumRepo, "repodata", "repomd.xml")
+	if argYumSignRpms {
+		if err := signYumPackages(repomdPath); err != nil {
+			return shared.Fail(err)
+		}
+	}
+	flags := &signers.FlagValues{
+		Defs:   repomdMod.Flags(),
+		Values: map[string]string{"repomd-check-packages": "true"},
+	}
+	if _, err := signFile(repomdMod, flags, argKeyName, repomdPath, repomdPath); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Signed %s\n", repomdPath)
+	return nil
+}
+
+// Sign every package listed in the metadata, then regenerate the metadata so
+// it reflects the new package checksums
+func signYumPackages(repomdPath string) error {
+	rpmMod := signers.ByName("rpm")
+	if rpmMod == nil {
+		return errors.New("RPM signing is not available")
+	}
+	repo, err := yumrepo.Open(repomdPath)
+	if err != nil {
+		return err
+	}
+	pkgs, err := repo.Packages()
+	if err != nil {
+		return err
+	}
+	for _, pkg := range pkgs {
+		fp := repo.PackagePath(pkg)
+		if _, err := signFile(rpmMod, nil, argKeyName, fp, fp); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Signed %s\n", fp)
+	}
+	proc := exec.Command(argYumCreaterepo, "--update", argYumRepo)
+	proc.Stdout = os.Stderr
+	proc.Stderr = os.Stderr
+	if err := proc.Run(); err != nil {
+		return fmt.Errorf("regenerating metadata: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package shared
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sassoftware/relic/v7/lib/intoto"
+	"github.com/sassoftware/relic/v7/lib/slsa"
+)
+
+// AttestBuildType describes provenance made for a file signed by relic
+const AttestBuildType = "https://github.com/sassoftware/relic/sign/v1"
+
+var (
+	argAttest             bool
+	argAttestOutput       string
+	argAttestBuilderID    string
+	argAttestBuildType    string
+	argAttestInvocationID string
+	argAttestMaterials    []string
+)
+
+// AddAttestFlags adds flags for emitting SLSA provenance alongside a signed
+// file
+func AddAttestFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&argAttest, "attest", false, "Also write a DSSE-signed SLSA provenance attestation for the signed file")
+	cmd.Flags().StringVar(&argAttestOutput, "attest-output", "", "Write the attestation here (default: OUTPUT.intoto.jsonl)")
+	cmd.Flags().StringVar(&argAttestBuilderID, "attest-builder-id", slsa.DefaultBuilderID, "Builder ID to record in the provenance")
+	cmd.Flags().StringVar(&argAttestBuildType, "attest-build-type", AttestBuildType, "Build type to record in the provenance")
+	cmd.Flags().StringVar(&argAttestInvocationID, "attest-invocation-id", "", "Identifier of this build run, e.g. a CI job URL")
+	cmd.Flags().StringArrayVar(&argAttestMaterials, "attest-material", nil, "Record a build input as URI=ALGORITHM:HEX, a bare URI, or a local file to hash")
+}
+
+// Attestation collects provenance for one signing operation
+type Attestation struct {
+	started   time.Time
+	materials []slsa.ResourceDescriptor
+}
+
+// StartAttestation returns nil if --attest was not given. Otherwise it
+// records the start time and the digests of the build inputs, including the
+// unsigned input file, which must be called before the input is signed in
+// place.
+func StartAttestation(input, output string) (*Attestation, error) {
+	if !argAttest {
+		return nil, nil
+	}
+	if input == "-" || output == "-" {
+		return nil, errors.New("can't attest a file read from or written to standard input or output")
+	}
+	a := &Attestation{started: time.Now()}
+	for _, m := range argAttestMaterials {
+		rd, err := slsa.ParseMaterial(m)
+		if err != nil {
+			return nil, err
+		}
+		a.materials = append(a.materials, rd)
+	}
+	digest, err := slsa.FileDigest(input)
+	if err != nil {
+		return nil, err
+	}
+	a.materials = append(a.materials, slsa.ResourceDescriptor{URI: input, Digest: digest})
+	return a, nil
+}
+
+// Statement returns the provenance for the signed output file
+func (a *Attestation) Statement(output string, params map[string]interface{}) ([]byte, error) {
+	subj, err := slsa.FileSubject(output)
+	if err != nil {
+		return nil, err
+	}
+	stmt, err := slsa.Statement([]intoto.Subject{subj}, slsa.BuildInfo{
+		BuildType:          argAttestBuildType,
+		BuilderID:          argAttestBuilderID,
+		InvocationID:       argAttestInvocationID,
+		ExternalParameters: params,
+		Materials:          a.materials,
+		StartedOn:          a.started,
+		FinishedOn:         time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(stmt)
+}
+
+// Path returns where to write the attestation for the signed output file
+func (a *Attestation) Path(output string) string {
+	if argAttestOutput != "" {
+		return argAttestOutput
+	}
+	return output + ".intoto.jsonl"
+}
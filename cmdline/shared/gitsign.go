@@ -0,0 +1,332 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package shared
+
+// Implementation for the "relic sign-git" and "relic remote sign-git"
+// commands, which accept the arguments git passes to gpg.program,
+// gpg.x509.program and gpg.ssh.program. Signing is turned into an ordinary
+// sign command with a pgp, pkcs7 or sshsig signature type, while verification
+// is handed off to the real gpg, gpgsm or ssh-keygen since it needs the user's
+// trust settings.
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
+	"golang.org/x/crypto/openpgp/s2k"
+
+	"github.com/sassoftware/relic/v7/lib/pkcs7"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+)
+
+// GitKeyIsX509 reports whether the named key should make gpgsm-style X.509
+// signatures instead of PGP ones
+type GitKeyIsX509 func(keyName string) (bool, error)
+
+const gitX509Armor = "SIGNED MESSAGE"
+
+var (
+	argGitUser        string
+	argGitStatusFD    int
+	argGitKeyIDFormat string
+	argGitVerify      bool
+
+	// ssh-keygen -Y
+	argGitSSHOp        string
+	argGitSSHNamespace string
+	argGitSSHKey       string
+)
+
+func AddGitSignFlags(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	flags.StringVarP(&argGitUser, "local-user", "u", "", "Specify keyname or cfgfile:keyname")
+	flags.IntVar(&argGitStatusFD, "status-fd", -1, "Write gpg status lines to this file descriptor")
+	flags.StringVar(&argGitKeyIDFormat, "keyid-format", "", "Key ID format passed through when verifying")
+	flags.BoolVar(&argGitVerify, "verify", false, "Verify a signature using gpg or gpgsm")
+
+	flags.BoolP("detach-sign", "b", false, "(ignored)")
+	flags.BoolP("sign", "s", false, "(ignored)")
+	flags.BoolP("armor", "a", false, "(ignored)")
+
+	flags.StringVarP(&argGitSSHOp, "ssh-op", "Y", "", "Operation when invoked as ssh-keygen. Only sign is handled, others are passed to ssh-keygen")
+	flags.StringVarP(&argGitSSHNamespace, "ssh-namespace", "n", "", "Signature namespace when invoked as ssh-keygen")
+	flags.StringVarP(&argGitSSHKey, "ssh-key", "f", "", "Specify keyname or cfgfile:keyname when invoked as ssh-keygen")
+	flags.BoolP("ssh-agent", "U", false, "(ignored)")
+	flags.StringP("ssh-principal", "I", "", "(ignored)")
+	flags.StringArrayP("ssh-option", "O", nil, "(ignored)")
+	cmd.FParseErrWhitelist.UnknownFlags = true
+	// git shows stderr to the user, so keep it to the error itself
+	cmd.SilenceErrors = true
+	cmd.SilenceUsage = true
+}
+
+func CallGitSign(dest *cobra.Command, args []string, isX509 GitKeyIsX509) error {
+	if argGitSSHOp != "" {
+		return gitSSH(dest, args)
+	} else if argGitVerify {
+		return gitVerify(args)
+	}
+	if argGitUser == "" {
+		return errors.New("-u must be set to a keyname or cfgpath:keyname; check git's user.signingkey setting")
+	} else if len(args) != 0 {
+		return errors.New("data to sign must be provided on standard input")
+	}
+	keyName, err := gitKeyName(argGitUser)
+	if err != nil {
+		return err
+	}
+	useX509, err := isX509(keyName)
+	if err != nil {
+		return Fail(err)
+	}
+	// copy stdin to a file so the sign command can treat it like any other
+	// input
+	infile, err := ioutil.TempFile("", "relic-git-")
+	if err != nil {
+		return Fail(err)
+	}
+	defer os.Remove(infile.Name())
+	_, err = io.Copy(infile, os.Stdin)
+	infile.Close()
+	if err != nil {
+		return Fail(err)
+	}
+	outpath := infile.Name() + ".sig"
+	defer os.Remove(outpath)
+	flags := []gitFlag{
+		{"key", keyName},
+		{"file", infile.Name()},
+		{"output", outpath},
+	}
+	if useX509 {
+		flags = append(flags, gitFlag{"sig-type", "pkcs7"})
+	} else {
+		flags = append(flags, gitFlag{"sig-type", "pgp"}, gitFlag{"armor", "true"})
+	}
+	if err := setGitFlags(dest.Flags(), flags); err != nil {
+		return err
+	}
+	if err := dest.RunE(dest, []string{}); err != nil {
+		return err
+	}
+	sig, err := ioutil.ReadFile(outpath)
+	if err != nil {
+		return Fail(err)
+	}
+	var status string
+	if useX509 {
+		content, err := ioutil.ReadFile(infile.Name())
+		if err != nil {
+			return Fail(err)
+		}
+		status, err = gitX509Status(sig, content)
+		if err != nil {
+			return Fail(err)
+		}
+		sig = pem.EncodeToMemory(&pem.Block{Type: gitX509Armor, Bytes: sig})
+	} else {
+		status, err = gitPgpStatus(sig)
+		if err != nil {
+			return Fail(err)
+		}
+	}
+	if _, err := os.Stdout.Write(sig); err != nil {
+		return Fail(err)
+	}
+	// git looks for SIG_CREATED at the start of a line to know that signing
+	// succeeded
+	if argGitStatusFD >= 0 {
+		f := os.NewFile(uintptr(argGitStatusFD), "status")
+		if f == nil {
+			return Fail(fmt.Errorf("invalid status-fd %d", argGitStatusFD))
+		}
+		if _, err := fmt.Fprintf(f, "\n[GNUPG:] BEGIN_SIGNING\n[GNUPG:] %s\n", status); err != nil {
+			return Fail(err)
+		}
+	}
+	return nil
+}
+
+func gitPgpStatus(sig []byte) (string, error) {
+	block, err := armor.Decode(bytes.NewReader(sig))
+	if err != nil {
+		return "", err
+	}
+	p, err := packet.Read(block.Body)
+	if err != nil {
+		return "", err
+	}
+	psig, ok := p.(*packet.Signature)
+	if !ok {
+		return "", errors.New("expected a PGP signature packet")
+	}
+	hashID, _ := s2k.HashToHashId(psig.Hash)
+	var keyID string
+	if psig.IssuerKeyId != nil {
+		keyID = fmt.Sprintf("%016X", *psig.IssuerKeyId)
+	}
+	return fmt.Sprintf("SIG_CREATED D %d %d %02x %d %s", psig.PubKeyAlgo, hashID, byte(psig.SigType), psig.CreationTime.Unix(), keyID), nil
+}
+
+func gitX509Status(sig, content []byte) (string, error) {
+	psd, err := pkcs7.Unmarshal(sig)
+	if err != nil {
+		return "", err
+	}
+	vsig, err := psd.Content.Verify(content, false)
+	if err != nil {
+		return "", err
+	}
+	hash, _ := x509tools.PkixDigestToHash(vsig.SignerInfo.DigestAlgorithm)
+	hashID, _ := s2k.HashToHashId(hash)
+	var pkAlgo packet.PublicKeyAlgorithm
+	switch vsig.Certificate.PublicKeyAlgorithm {
+	case x509.RSA:
+		pkAlgo = packet.PubKeyAlgoRSA
+	case x509.ECDSA:
+		pkAlgo = packet.PubKeyAlgoECDSA
+	case x509.Ed25519:
+		pkAlgo = 22 // EdDSA
+	}
+	sigTime, err := vsig.SignerInfo.SigningTime()
+	if err != nil {
+		sigTime = time.Now()
+	}
+	return fmt.Sprintf("SIG_CREATED D %d %d 00 %d %X", pkAlgo, hashID, sigTime.Unix(), sha1.Sum(vsig.Certificate.Raw)), nil
+}
+
+// hand verification off to gpg or gpgsm, depending on what kind of signature
+// it is
+func gitVerify(args []string) error {
+	if len(args) == 0 {
+		return errors.New("--verify requires a signature file")
+	}
+	program := "gpg"
+	if sig, err := ioutil.ReadFile(args[0]); err == nil && bytes.Contains(sig, []byte("-----BEGIN "+gitX509Armor+"-----")) {
+		program = "gpgsm"
+	}
+	var vargs []string
+	var extra []*os.File
+	switch {
+	case argGitStatusFD > 2:
+		// only stdio is inherited by default, so pass it as the first extra
+		// file
+		extra = append(extra, os.NewFile(uintptr(argGitStatusFD), "status"))
+		vargs = append(vargs, "--status-fd=3")
+	case argGitStatusFD >= 0:
+		vargs = append(vargs, "--status-fd="+strconv.Itoa(argGitStatusFD))
+	}
+	if argGitKeyIDFormat != "" {
+		vargs = append(vargs, "--keyid-format="+argGitKeyIDFormat)
+	}
+	vargs = append(vargs, "--verify")
+	vargs = append(vargs, args...)
+	return gitPassthrough(program, vargs, extra)
+}
+
+// sign a file the way "ssh-keygen -Y sign" does, writing the signature next
+// to it
+func gitSSH(dest *cobra.Command, args []string) error {
+	if argGitSSHOp != "sign" {
+		// verification uses options that were not parsed, so pass along
+		// exactly what git provided
+		var raw []string
+		for i, arg := range os.Args {
+			if arg == "sign-git" {
+				raw = os.Args[i+1:]
+				break
+			}
+		}
+		return gitPassthrough("ssh-keygen", raw, nil)
+	}
+	if argGitSSHKey == "" || argGitSSHNamespace == "" {
+		return errors.New("-f and -n are required; check git's user.signingkey setting")
+	} else if len(args) != 1 {
+		return errors.New("expected one file to sign")
+	}
+	keyName, err := gitKeyName(argGitSSHKey)
+	if err != nil {
+		return err
+	}
+	if err := setGitFlags(dest.Flags(), []gitFlag{
+		{"key", keyName},
+		{"file", args[0]},
+		{"output", args[0] + ".sig"},
+		{"sig-type", "sshsig"},
+		{"sshsig-namespace", argGitSSHNamespace},
+	}); err != nil {
+		return err
+	}
+	return dest.RunE(dest, []string{})
+}
+
+// split a cfgfile:keyname key spec, loading the named configuration
+func gitKeyName(spec string) (string, error) {
+	if idx := strings.LastIndex(spec, ":"); idx > 0 {
+		if err := setGitFlags(RootCmd.PersistentFlags(), []gitFlag{{"config", spec[:idx]}}); err != nil {
+			return "", err
+		}
+		return spec[idx+1:], nil
+	}
+	return spec, nil
+}
+
+func gitPassthrough(program string, args []string, extra []*os.File) error {
+	cmd := exec.Command(program, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = extra
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			// the program already reported why, so just pass on its status
+			return ExitError{Code: exitErr.ExitCode()}
+		}
+		return fmt.Errorf("running %s: %w", program, err)
+	}
+	return nil
+}
+
+type gitFlag struct {
+	name, value string
+}
+
+// set flags on the command that does the actual signing
+func setGitFlags(flags *pflag.FlagSet, values []gitFlag) error {
+	for _, f := range values {
+		if err := flags.Set(f.name, f.value); err != nil {
+			return fmt.Errorf("setting --%s: %w", f.name, err)
+		}
+	}
+	return nil
+}
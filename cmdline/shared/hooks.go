@@ -0,0 +1,57 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package shared
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/sassoftware/relic/v7/signers"
+)
+
+// PostSignHook processes a file on the client after it has been signed
+type PostSignHook func(ctx context.Context, path string) error
+
+var postSignHooks = make(map[string]PostSignHook)
+
+// AddPostSignHook registers a hook to run on signed files when the boolean
+// signer flag with the given name is set
+func AddPostSignHook(flag string, hook PostSignHook) {
+	postSignHooks[flag] = hook
+}
+
+// RunPostSignHooks runs the hooks enabled by the signer flags used to sign a file
+func RunPostSignHooks(ctx context.Context, flags *signers.FlagValues, path string) error {
+	if flags == nil {
+		return nil
+	}
+	names := make([]string, 0, len(postSignHooks))
+	for name := range postSignHooks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if flags.Defs.Lookup(name) == nil || !flags.GetBool(name) {
+			continue
+		}
+		if err := postSignHooks[name](ctx, path); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
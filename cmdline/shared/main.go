@@ -71,7 +71,21 @@ func Main() {
 		f()
 	}
 	if err := RootCmd.Execute(); err != nil {
+		var exitErr ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.Code)
+		}
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 }
+
+// ExitError causes the command to exit with the given status without printing
+// anything further, such as when passing through the status of a child process
+type ExitError struct {
+	Code int
+}
+
+func (e ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
@@ -0,0 +1,130 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package token
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sassoftware/relic/v7/cmdline/shared"
+	"github.com/sassoftware/relic/v7/config"
+	"github.com/sassoftware/relic/v7/internal/signinit"
+	"github.com/sassoftware/relic/v7/lib/atomicfile"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+	"github.com/sassoftware/relic/v7/signers/apk"
+)
+
+var ApkLineageCmd = &cobra.Command{
+	Use:   "apk-lineage",
+	Short: "Add a key to an APK signing certificate lineage",
+	Long: `Rotate the APK signing key by adding the certificate of --key to the lineage
+of --from, signed with the --from key. The lineage starts with the --from
+certificate if that key does not have one yet.
+
+The result is written to the key's apklineage path, or next to the
+configuration file if none is set, and the key's "apklineage" option is
+updated to point to it. Packages signed with --apk-v3 or --apk-v31 then
+carry the lineage.`,
+	RunE: apkLineageCmd,
+}
+
+var argLineageFrom string
+
+func init() {
+	TokenCmd.AddCommand(ApkLineageCmd)
+	addKeyFlags(ApkLineageCmd)
+	ApkLineageCmd.Flags().StringVar(&argLineageFrom, "from", "", "Name of the key being rotated away from")
+	shared.AddDigestFlag(ApkLineageCmd)
+}
+
+func apkLineageCmd(cmd *cobra.Command, args []string) error {
+	if argKeyName == "" || argLineageFrom == "" {
+		return errors.New("--key and --from are required")
+	}
+	hash, err := shared.GetDigest()
+	if err != nil {
+		return shared.Fail(err)
+	}
+	ctx := context.Background()
+	oldTok, err := openTokenByKey(argLineageFrom)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	oldCert, oldConf, err := signinit.InitKey(ctx, oldTok, argLineageFrom)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	newTok, err := openTokenByKey(argKeyName)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	newCert, newConf, err := signinit.InitKey(ctx, newTok, argKeyName)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	if oldCert.Leaf == nil || newCert.Leaf == nil {
+		return shared.Fail(errors.New("both keys need an X.509 certificate"))
+	}
+	var lineage *apk.Lineage
+	if len(oldCert.ApkLineage) != 0 {
+		lineage, err = apk.ParseLineage(oldCert.ApkLineage)
+		if err != nil {
+			return shared.Fail(fmt.Errorf("key %q: %w", oldConf.Name(), err))
+		}
+		if !bytes.Equal(lineage.Latest().Raw, oldCert.Leaf.Raw) {
+			return shared.Fail(fmt.Errorf("key %q: lineage does not end with the key's certificate", oldConf.Name()))
+		}
+	} else {
+		lineage, err = apk.NewLineage(oldCert.Leaf)
+		if err != nil {
+			return shared.Fail(err)
+		}
+	}
+	if err := lineage.Extend(oldCert.Signer(), newCert.Leaf, hash); err != nil {
+		return shared.Fail(err)
+	}
+	blob, err := lineage.Marshal()
+	if err != nil {
+		return shared.Fail(err)
+	}
+	savePath := newConf.ApkLineage
+	if savePath == "" {
+		savePath = filepath.Join(filepath.Dir(shared.CurrentConfig.Path()), newConf.Name()+".lineage")
+	}
+	if savePath, err = filepath.Abs(savePath); err != nil {
+		return shared.Fail(err)
+	}
+	if err := atomicfile.WriteFile(savePath, blob); err != nil {
+		return shared.Fail(err)
+	}
+	fmt.Fprintln(os.Stderr, "Wrote lineage to", savePath)
+	if savePath != newConf.ApkLineage {
+		if err := config.SetKeyOption(shared.CurrentConfig.Path(), newConf.Name(), "apklineage", savePath); err != nil {
+			return shared.Fail(fmt.Errorf("updating configuration: %w", err))
+		}
+	}
+	for i, cert := range lineage.Certificates() {
+		fmt.Printf("%d. %s\n", i+1, x509tools.FormatSubject(cert))
+	}
+	return nil
+}
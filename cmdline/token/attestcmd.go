@@ -0,0 +1,155 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package token
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sassoftware/relic/v7/cmdline/shared"
+	"github.com/sassoftware/relic/v7/config"
+	"github.com/sassoftware/relic/v7/lib/atomicfile"
+	"github.com/sassoftware/relic/v7/lib/attestation"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/token"
+)
+
+var AttestCmd = &cobra.Command{
+	Use:   "attest",
+	Short: "Verify a key's hardware attestation",
+	Long: `Verify a key's hardware attestation against the key's attestationroots.
+
+If the key has a stored attestation file, it is verified. Otherwise, or if
+--refresh is given, the attestation is fetched from the token, verified, and
+saved next to the configuration file, and the key's "attestation" option is
+updated to point to it.`,
+	RunE: attestCmd,
+}
+
+var (
+	argAttestRefresh bool
+	argAttestOutput  string
+)
+
+func init() {
+	TokenCmd.AddCommand(AttestCmd)
+	addKeyFlags(AttestCmd)
+	AttestCmd.Flags().BoolVar(&argAttestRefresh, "refresh", false, "Fetch a new attestation from the token even if one is stored")
+	AttestCmd.Flags().StringVarP(&argAttestOutput, "output", "o", "", "Save a fetched attestation to this path")
+}
+
+func attestCmd(cmd *cobra.Command, args []string) error {
+	key, err := openKey(argKeyName)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	kconf := key.Config()
+	var att *attestation.Attestation
+	if kconf.Attestation != "" && !argAttestRefresh {
+		blob, err := os.ReadFile(kconf.Attestation)
+		if err != nil {
+			return shared.Fail(err)
+		}
+		att, err = verifyAttestation(blob, kconf, key)
+		if err != nil {
+			return shared.Fail(err)
+		}
+	} else {
+		att, err = fetchAttestation(key, argAttestOutput)
+		if err != nil {
+			return shared.Fail(err)
+		}
+	}
+	fmt.Printf("format:      %s\n", att.Format)
+	fmt.Printf("device:      %s\n", att)
+	fmt.Printf("generated:   %t\n", att.Generated)
+	fmt.Printf("exportable:  %t\n", att.Exportable)
+	if att.HardwareBacked() {
+		fmt.Println("OK: key is hardware backed")
+	} else {
+		fmt.Println("WARNING: key is not hardware backed")
+	}
+	return nil
+}
+
+// fetchAttestation asks the token for the key's attestation, verifies it, and
+// stores it alongside the configuration
+func fetchAttestation(key token.Key, savePath string) (*attestation.Attestation, error) {
+	kconf := key.Config()
+	attester, ok := key.(token.Attester)
+	if !ok {
+		return nil, token.NotImplementedError{Op: "attest", Type: shared.CurrentConfig.Tokens[kconf.Token].Type}
+	}
+	blob, err := attester.Attest(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	att, err := verifyAttestation(blob, kconf, key)
+	if err != nil {
+		return nil, err
+	}
+	if savePath == "" {
+		savePath = kconf.Attestation
+	}
+	if savePath == "" {
+		savePath = filepath.Join(filepath.Dir(shared.CurrentConfig.Path()), kconf.Name()+".attestation.pem")
+	}
+	if savePath, err = filepath.Abs(savePath); err != nil {
+		return nil, err
+	}
+	if err := atomicfile.WriteFile(savePath, blob); err != nil {
+		return nil, err
+	}
+	fmt.Fprintln(os.Stderr, "Wrote attestation to", savePath)
+	if savePath != kconf.Attestation {
+		if err := config.SetKeyOption(shared.CurrentConfig.Path(), kconf.Name(), "attestation", savePath); err != nil {
+			return nil, fmt.Errorf("updating configuration: %w", err)
+		}
+		kconf.Attestation = savePath
+	}
+	return att, nil
+}
+
+func verifyAttestation(blob []byte, kconf *config.KeyConfig, key token.Key) (*attestation.Attestation, error) {
+	if kconf.AttestationRoots == "" {
+		return nil, fmt.Errorf("key %q: attestationroots must be set to verify an attestation", kconf.Name())
+	}
+	rootBlob, err := os.ReadFile(kconf.AttestationRoots)
+	if err != nil {
+		return nil, err
+	}
+	roots, err := certloader.ParseX509Certificates(rootBlob)
+	if err != nil {
+		return nil, fmt.Errorf("attestationroots: %w", err)
+	}
+	return attestation.Verify(blob, roots, key.Public())
+}
+
+// attestGenerated saves an attestation for a newly generated key, if the token
+// can produce one and the key has roots to check it against
+func attestGenerated(key token.Key) {
+	if _, ok := key.(token.Attester); !ok || key.Config().AttestationRoots == "" {
+		return
+	}
+	if _, err := fetchAttestation(key, ""); err != nil {
+		fmt.Fprintln(os.Stderr, "warning: attesting new key:", err)
+	}
+}
@@ -0,0 +1,229 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package token
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sassoftware/relic/v7/cmdline/shared"
+	"github.com/sassoftware/relic/v7/token"
+)
+
+var BenchmarkCmd = &cobra.Command{
+	Use:   "benchmark",
+	Short: "Measure signing throughput and latency of a token key",
+	Long: `Sign random digests with a token key at increasing levels of concurrency and
+report operations per second and latency percentiles for each level.
+
+The suggested concurrency is the lowest level that reaches 95% of the best
+throughput. Use it to size the token's maxsessions and the server's
+numworkers; beyond it, requests only wait longer.`,
+	RunE: benchmarkCmd,
+}
+
+var (
+	argBenchDuration    time.Duration
+	argBenchConcurrency string
+)
+
+func init() {
+	TokenCmd.AddCommand(BenchmarkCmd)
+	addKeyFlags(BenchmarkCmd)
+	shared.AddDigestFlag(BenchmarkCmd)
+	BenchmarkCmd.Flags().DurationVar(&argBenchDuration, "duration", 10*time.Second, "How long to sign at each level of concurrency")
+	BenchmarkCmd.Flags().StringVar(&argBenchConcurrency, "concurrency", "1,2,4,8,16", "Comma-separated levels of concurrency to test")
+}
+
+type benchResult struct {
+	concurrency int
+	ops, errs   int
+	elapsed     time.Duration
+	latencies   []time.Duration
+	firstErr    error
+}
+
+func (r *benchResult) rate() float64 {
+	return float64(r.ops) / r.elapsed.Seconds()
+}
+
+// percentile of the sorted latencies
+func (r *benchResult) percentile(p float64) time.Duration {
+	if len(r.latencies) == 0 {
+		return 0
+	}
+	i := int(p / 100 * float64(len(r.latencies)-1))
+	return r.latencies[i]
+}
+
+func benchmarkCmd(cmd *cobra.Command, args []string) error {
+	if argKeyName == "" {
+		return shared.Fail(errors.New("--key is a required parameter"))
+	}
+	levels, err := parseConcurrency(argBenchConcurrency)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	hash, err := shared.GetDigest()
+	if err != nil {
+		return shared.Fail(err)
+	}
+	key, err := openKey(argKeyName)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	sign, err := benchSigner(key, hash)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	var results []*benchResult
+	for _, n := range levels {
+		fmt.Fprintf(os.Stderr, "Signing with concurrency %d for %s...\n", n, argBenchDuration)
+		result := runBenchmark(sign, n, argBenchDuration)
+		results = append(results, result)
+		if result.ops == 0 {
+			return shared.Fail(fmt.Errorf("no signatures succeeded: %w", result.firstErr))
+		}
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "concurrency\tops/s\tp50\tp90\tp99\terrors\t")
+	var best float64
+	for _, r := range results {
+		fmt.Fprintf(w, "%d\t%.1f\t%s\t%s\t%s\t%d\t\n", r.concurrency, r.rate(),
+			fmtLatency(r.percentile(50)), fmtLatency(r.percentile(90)), fmtLatency(r.percentile(99)), r.errs)
+		if r.rate() > best {
+			best = r.rate()
+		}
+	}
+	w.Flush()
+	for _, r := range results {
+		if r.rate() >= 0.95*best {
+			fmt.Printf("\nSuggested concurrency: %d (%.1f ops/s)\n", r.concurrency, r.rate())
+			break
+		}
+	}
+	for _, r := range results {
+		if r.firstErr != nil {
+			fmt.Fprintf(os.Stderr, "warning: %d signatures failed at concurrency %d, first error: %s\n", r.errs, r.concurrency, r.firstErr)
+		}
+	}
+	return nil
+}
+
+// parse a list of concurrency levels, returning them sorted with duplicates
+// removed
+func parseConcurrency(value string) ([]int, error) {
+	var levels []int
+	seen := make(map[int]bool)
+	for _, word := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(word))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid concurrency %q", word)
+		}
+		if !seen[n] {
+			seen[n] = true
+			levels = append(levels, n)
+		}
+	}
+	sort.Ints(levels)
+	return levels, nil
+}
+
+// benchSigner returns a function that makes one signature with the key. Keys
+// that can only sign complete messages are given a message instead of a
+// digest.
+func benchSigner(key token.Key, hash crypto.Hash) (func(context.Context) error, error) {
+	var opts crypto.SignerOpts = hash
+	if _, ok := key.Public().(ed25519.PublicKey); ok {
+		opts = crypto.Hash(0)
+	}
+	buf := make([]byte, hash.Size())
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	sign := func(ctx context.Context) error {
+		_, err := key.SignContext(ctx, buf, opts)
+		return err
+	}
+	// try it once, both to warm up and to pick the method that works
+	if err := sign(context.Background()); err != nil {
+		ds, ok := key.(token.DataSigner)
+		var usageErr token.KeyUsageError
+		if !ok || !errors.As(err, &usageErr) {
+			return nil, err
+		}
+		sign = func(ctx context.Context) error {
+			_, err := ds.SignData(ctx, buf, opts)
+			return err
+		}
+		if err := sign(context.Background()); err != nil {
+			return nil, err
+		}
+	}
+	return sign, nil
+}
+
+func runBenchmark(sign func(context.Context) error, concurrency int, duration time.Duration) *benchResult {
+	result := &benchResult{concurrency: concurrency}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	start := time.Now()
+	deadline := start.Add(duration)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for time.Now().Before(deadline) {
+				t := time.Now()
+				err := sign(context.Background())
+				elapsed := time.Since(t)
+				mu.Lock()
+				if err != nil {
+					result.errs++
+					if result.firstErr == nil {
+						result.firstErr = err
+					}
+				} else {
+					result.ops++
+					result.latencies = append(result.latencies, elapsed)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	result.elapsed = time.Since(start)
+	sort.Slice(result.latencies, func(i, j int) bool { return result.latencies[i] < result.latencies[j] })
+	return result
+}
+
+func fmtLatency(d time.Duration) string {
+	return fmt.Sprintf("%.1fms", float64(d)/float64(time.Millisecond))
+}
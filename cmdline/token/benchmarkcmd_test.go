@@ -0,0 +1,73 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package token
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sassoftware/relic/v7/internal/testcert"
+	"github.com/sassoftware/relic/v7/token"
+)
+
+// fakeKey can only sign whole messages, like a key that hashes in the token
+type fakeKey struct {
+	token.Key
+	pub   crypto.PublicKey
+	calls int32
+}
+
+func (k *fakeKey) Public() crypto.PublicKey { return k.pub }
+
+func (k *fakeKey) SignContext(context.Context, []byte, crypto.SignerOpts) ([]byte, error) {
+	return nil, token.KeyUsageError{Key: "fake", Err: errors.New("digest signing not supported")}
+}
+
+func (k *fakeKey) SignData(ctx context.Context, data []byte, opts crypto.SignerOpts) ([]byte, error) {
+	atomic.AddInt32(&k.calls, 1)
+	return []byte("signature"), nil
+}
+
+func TestParseConcurrency(t *testing.T) {
+	levels, err := parseConcurrency("8, 1,4,1,8")
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 4, 8}, levels)
+	for _, value := range []string{"0", "1,x", ""} {
+		_, err := parseConcurrency(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestBenchmark(t *testing.T) {
+	key := &fakeKey{pub: testcert.ECDSAKey(t).Public()}
+	sign, err := benchSigner(key, crypto.SHA256)
+	require.NoError(t, err)
+	result := runBenchmark(sign, 2, 20*time.Millisecond)
+	assert.Equal(t, 2, result.concurrency)
+	assert.Positive(t, result.ops)
+	assert.Zero(t, result.errs)
+	// one call to pick the method, then one per operation
+	assert.Equal(t, int32(result.ops+1), atomic.LoadInt32(&key.calls))
+	assert.LessOrEqual(t, result.percentile(50), result.percentile(99))
+}
@@ -41,6 +41,8 @@ var (
 	argLabel     string
 	argRsaBits   uint
 	argEcdsaBits uint
+	argCurve     string
+	argEd25519   bool
 )
 
 var tokenMap map[string]token.Token
@@ -55,6 +57,8 @@ func addSelectOrGenerateFlags(cmd *cobra.Command) {
 	cmd.Flags().StringVarP(&argLabel, "label", "l", "", "Label to attach to generated key")
 	cmd.Flags().UintVar(&argRsaBits, "generate-rsa", 0, "Generate a RSA key of the specified bit size, if needed")
 	cmd.Flags().UintVar(&argEcdsaBits, "generate-ecdsa", 0, "Generate an ECDSA key of the specified curve size, if needed")
+	cmd.Flags().StringVar(&argCurve, "generate-curve", "", "Generate a key on the named curve (e.g. P-256, or ed25519 where supported), if needed")
+	cmd.Flags().BoolVar(&argEd25519, "generate-ed25519", false, "Generate an Ed25519 key, if needed")
 }
 
 // Update key config with values from --token and --label
@@ -91,6 +95,9 @@ func newKeyConfig() (*config.KeyConfig, error) {
 }
 
 func selectOrGenerate() (key token.Key, err error) {
+	// keys made up from --token and --label aren't in the config file, so
+	// there's nowhere to record an attestation for them
+	inConfig := argKeyName != ""
 	keyConf, err := newKeyConfig()
 	if err != nil {
 		return nil, err
@@ -108,12 +115,24 @@ func selectOrGenerate() (key token.Key, err error) {
 	}
 	fmt.Fprintln(os.Stderr, "Generating a new key in token")
 	if argRsaBits != 0 {
-		return tok.Generate(argKeyName, token.KeyTypeRsa, argRsaBits)
+		key, err = tok.Generate(argKeyName, token.KeyTypeRsa, argRsaBits)
 	} else if argEcdsaBits != 0 {
-		return tok.Generate(argKeyName, token.KeyTypeEcdsa, argEcdsaBits)
+		key, err = tok.Generate(argKeyName, token.KeyTypeEcdsa, argEcdsaBits)
+	} else if argCurve != "" {
+		gen, ok := tok.(token.CurveGenerator)
+		if !ok {
+			return nil, token.NotImplementedError{Op: "generate-curve", Type: tok.Config().Type}
+		}
+		key, err = gen.GenerateCurve(argKeyName, argCurve)
+	} else if argEd25519 {
+		key, err = tok.Generate(argKeyName, token.KeyTypeEd25519, 0)
 	} else {
-		return nil, errors.New("No matching key exists, specify --generate-rsa or --generate-ecdsa to generate one")
+		return nil, errors.New("No matching key exists, specify --generate-rsa, --generate-ecdsa, --generate-curve or --generate-ed25519 to generate one")
+	}
+	if err == nil && inConfig {
+		attestGenerated(key)
 	}
+	return key, err
 }
 
 func openToken(tokenName string) (token.Token, error) {
@@ -0,0 +1,111 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package token
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sassoftware/relic/v7/cmdline/shared"
+	"github.com/sassoftware/relic/v7/config"
+	"github.com/sassoftware/relic/v7/lib/atomicfile"
+	"github.com/sassoftware/relic/v7/lib/certissue"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+)
+
+var EnrollCmd = &cobra.Command{
+	Use:   "enroll",
+	Short: "Enroll a key with a CA and store the issued certificate",
+	Long: `Submit a certificate signing request for a token key to the CA configured
+in the key's "enroll" section, generating the key first if needed.
+
+The issued certificate and chain are written to the key's x509certificate
+path, or next to the configuration file if none is set, and the key's
+"x509certificate" option is updated to point to it.`,
+	RunE: enrollCmd,
+}
+
+var argEnrollOutput string
+
+func init() {
+	TokenCmd.AddCommand(EnrollCmd)
+	addSelectOrGenerateFlags(EnrollCmd)
+	EnrollCmd.Flags().StringVarP(&argEnrollOutput, "output", "o", "", "Save the issued certificate chain to this path")
+}
+
+func enrollCmd(cmd *cobra.Command, args []string) error {
+	if argKeyName == "" {
+		return shared.Fail(errors.New("--key is a required parameter"))
+	}
+	key, err := selectOrGenerate()
+	if err != nil {
+		return shared.Fail(err)
+	}
+	kconf := key.Config()
+	if kconf.Enroll == nil {
+		return shared.Fail(fmt.Errorf("key %q: no enroll section is configured", kconf.Name()))
+	}
+	issuer, err := certissue.New(kconf.Enroll)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	csr, err := certissue.CreateRequest(kconf.Enroll, key, kconf.Name())
+	if err != nil {
+		return shared.Fail(err)
+	}
+	certs, err := issuer.Issue(context.Background(), csr)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	if len(certs) == 0 {
+		return shared.Fail(errors.New("CA did not return a certificate"))
+	}
+	if !x509tools.SameKey(certs[0].PublicKey, key.Public()) {
+		return shared.Fail(errors.New("issued certificate does not match the key"))
+	}
+	var chain []byte
+	for _, cert := range certs {
+		chain = append(chain, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+	savePath := argEnrollOutput
+	if savePath == "" {
+		savePath = kconf.X509Certificate
+	}
+	if savePath == "" {
+		savePath = filepath.Join(filepath.Dir(shared.CurrentConfig.Path()), kconf.Name()+".crt")
+	}
+	if savePath, err = filepath.Abs(savePath); err != nil {
+		return shared.Fail(err)
+	}
+	if err := atomicfile.WriteFile(savePath, chain); err != nil {
+		return shared.Fail(err)
+	}
+	fmt.Fprintln(os.Stderr, "Wrote certificate chain to", savePath)
+	if savePath != kconf.X509Certificate {
+		if err := config.SetKeyOption(shared.CurrentConfig.Path(), kconf.Name(), "x509certificate", savePath); err != nil {
+			return shared.Fail(fmt.Errorf("updating configuration: %w", err))
+		}
+	}
+	fmt.Printf("Issued certificate for %s, expires %s\n", x509tools.FormatSubject(certs[0]), certs[0].NotAfter)
+	return nil
+}
@@ -0,0 +1,62 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package token
+
+import (
+	"os"
+
+	"github.com/sassoftware/relic/v7/cmdline/shared"
+	"github.com/sassoftware/relic/v7/config"
+	"github.com/sassoftware/relic/v7/lib/certissue"
+	"github.com/sassoftware/relic/v7/lib/rekor"
+)
+
+const keylessName = "keyless"
+
+// setupKeyless selects the key to use for --keyless signing. If the
+// configuration doesn't define the key, one is added that uses the public
+// Sigstore instance, so no configuration file is needed in CI.
+func setupKeyless() error {
+	explicit := shared.ArgConfig != ""
+	if err := shared.InitConfig(); err != nil {
+		if _, statErr := os.Stat(shared.ArgConfig); explicit || !os.IsNotExist(statErr) {
+			return err
+		}
+		shared.CurrentConfig = new(config.Config)
+	}
+	if argKeyName == "" {
+		argKeyName = keylessName
+	}
+	cfg := shared.CurrentConfig
+	if _, err := cfg.GetKey(argKeyName); err == nil {
+		return nil
+	}
+	tconf, err := cfg.GetToken(keylessName)
+	if err != nil {
+		tconf = cfg.NewToken(keylessName)
+		tconf.Type = keylessName
+	}
+	kconf := cfg.NewKey(argKeyName)
+	kconf.SetToken(tconf)
+	kconf.Issuer = &config.IssuerConfig{
+		Type:    "fulcio",
+		URL:     certissue.SigstoreFulcioURL,
+		Timeout: 60,
+	}
+	kconf.TransparencyLog = rekor.PublicURL
+	return nil
+}
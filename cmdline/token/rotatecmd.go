@@ -0,0 +1,108 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package token
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sassoftware/relic/v7/cmdline/shared"
+	"github.com/sassoftware/relic/v7/config"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+)
+
+var RotateCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "Make a key the newest version of a logical key",
+	Long: `Make a key the newest version of a logical key. New signatures use the newest
+version, while 'relic verify --key' and 'relic remote get-key --all-versions'
+still accept the older ones. The configuration file is updated in place; the
+server picks up the change when it is restarted.`,
+	RunE: rotateCmd,
+}
+
+var argRotateTo string
+
+func init() {
+	TokenCmd.AddCommand(RotateCmd)
+	addKeyFlags(RotateCmd)
+	RotateCmd.Flags().StringVar(&argRotateTo, "to", "", "Name of the key section holding the new version")
+}
+
+func rotateCmd(cmd *cobra.Command, args []string) error {
+	if argKeyName == "" || argRotateTo == "" {
+		return errors.New("--key and --to are required")
+	}
+	if err := shared.InitConfig(); err != nil {
+		return err
+	}
+	current, err := shared.CurrentConfig.GetKey(argKeyName)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	// make sure the new version is usable before promoting it
+	key, err := openKey(argRotateTo)
+	if err != nil {
+		return shared.Fail(fmt.Errorf("new version: %w", err))
+	}
+	newConf := key.Config()
+	if newConf.X509Certificate != "" {
+		certs, err := os.ReadFile(newConf.X509Certificate)
+		if err != nil {
+			return shared.Fail(err)
+		}
+		if err := checkCertMatches(certs, key.Public()); err != nil {
+			return shared.Fail(fmt.Errorf("new version: %w", err))
+		}
+	}
+	if !sameRoles(current.Roles, newConf.Roles) {
+		fmt.Fprintf(os.Stderr, "warning: roles of %s (%s) differ from the current version (%s)\n",
+			argRotateTo, strings.Join(newConf.Roles, ", "), strings.Join(current.Roles, ", "))
+	}
+	if err := config.RotateKey(shared.CurrentConfig.Path(), argKeyName, argRotateTo); err != nil {
+		return shared.Fail(err)
+	}
+	fmt.Fprintf(os.Stderr, "%s now signs with %s\n", argKeyName, argRotateTo)
+	return nil
+}
+
+func checkCertMatches(blob []byte, pub interface{}) error {
+	certs, err := certloader.ParseX509Certificates(blob)
+	if err != nil {
+		return err
+	}
+	for _, cert := range certs {
+		if x509tools.SameKey(cert.PublicKey, pub) {
+			return nil
+		}
+	}
+	return errors.New("certificate does not match key in token")
+}
+
+func sameRoles(a, b []string) bool {
+	a = append([]string(nil), a...)
+	b = append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	return strings.Join(a, "\x00") == strings.Join(b, "\x00")
+}
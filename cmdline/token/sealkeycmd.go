@@ -0,0 +1,162 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package token
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sassoftware/relic/v7/cmdline/shared"
+	"github.com/sassoftware/relic/v7/config"
+	"github.com/sassoftware/relic/v7/lib/atomicfile"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/passprompt"
+	"github.com/sassoftware/relic/v7/lib/sealedkey"
+)
+
+var SealKeyCmd = &cobra.Command{
+	Use:   "seal-key",
+	Short: "Re-encrypt a file token's key with a modern KDF or split it into shares",
+	Long: `Re-encrypt the private key of a "file" token key with AES-256-GCM under a
+passphrase-derived key (argon2id or scrypt), or under a random key split into
+Shamir shares held by separate custodians.
+
+The sealed key is written next to the original key file, the key's "keyfile"
+option is updated to point to it, and the original is left in place to be
+removed once the new key is confirmed to work. Shares are written as
+KEYFILE.share-N; move them to their custodians and list their new locations
+in the key's "keyshares" option.`,
+	RunE: sealKeyCmd,
+}
+
+var (
+	argSealKDF       string
+	argSealOutput    string
+	argSealShares    int
+	argSealThreshold int
+)
+
+func init() {
+	TokenCmd.AddCommand(SealKeyCmd)
+	addKeyFlags(SealKeyCmd)
+	SealKeyCmd.Flags().StringVar(&argSealKDF, "kdf", sealedkey.KDFArgon2id, "Key derivation function for passphrases: argon2id or scrypt")
+	SealKeyCmd.Flags().StringVarP(&argSealOutput, "output", "o", "", "Path to write the sealed key to (default KEYFILE.sealed)")
+	SealKeyCmd.Flags().IntVar(&argSealShares, "shares", 0, "Split the key into this many shares instead of using a passphrase")
+	SealKeyCmd.Flags().IntVar(&argSealThreshold, "threshold", 0, "Number of shares required to unlock the key")
+}
+
+func sealKeyCmd(cmd *cobra.Command, args []string) error {
+	if argKeyName == "" {
+		return errors.New("--key is required")
+	}
+	if (argSealShares == 0) != (argSealThreshold == 0) {
+		return errors.New("--shares and --threshold must be used together")
+	}
+	if err := shared.InitConfig(); err != nil {
+		return err
+	}
+	keyConf, err := shared.CurrentConfig.GetKey(argKeyName)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	if tconf, err := shared.CurrentConfig.GetToken(keyConf.Token); err != nil {
+		return shared.Fail(err)
+	} else if tconf.Type != "file" {
+		return shared.Fail(fmt.Errorf("key %q is not in a file token", keyConf.Name()))
+	}
+	if keyConf.IsPkcs12 {
+		return shared.Fail(errors.New("PKCS#12 key files can't be sealed; extract the certificate chain to x509certificate and the key to a PEM file first"))
+	}
+	blob, err := os.ReadFile(keyConf.KeyFile)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	if sealedkey.IsSealed(blob) {
+		return shared.Fail(errors.New("key is already sealed"))
+	}
+	prompt := new(passprompt.PasswordPrompt)
+	privKey, err := certloader.ParseAnyPrivateKey(blob, prompt)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(privKey)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	output := argSealOutput
+	if output == "" {
+		output = keyConf.KeyFile + ".sealed"
+	}
+	var sealed []byte
+	var shares [][]byte
+	if argSealShares != 0 {
+		sealed, shares, err = sealedkey.SealShared(der, argSealShares, argSealThreshold, argSealKDF, func(index int) (string, error) {
+			return newPassphrase(prompt, fmt.Sprintf("share %d (empty to store it unencrypted)", index), true)
+		})
+	} else {
+		var passphrase string
+		passphrase, err = newPassphrase(prompt, "key "+keyConf.Name(), false)
+		if err == nil {
+			sealed, err = sealedkey.Seal(der, passphrase, argSealKDF)
+		}
+	}
+	if err != nil {
+		return shared.Fail(err)
+	}
+	for i, share := range shares {
+		path := fmt.Sprintf("%s.share-%d", output, i+1)
+		// unencrypted shares are as sensitive as the key itself
+		if err := atomicfile.WriteFileMode(path, share, 0600); err != nil {
+			return shared.Fail(err)
+		}
+		fmt.Fprintln(os.Stderr, "Wrote key share to", path)
+	}
+	if err := atomicfile.WriteFileMode(output, sealed, 0600); err != nil {
+		return shared.Fail(err)
+	}
+	fmt.Fprintln(os.Stderr, "Wrote sealed key to", output)
+	if err := config.SetKeyOption(shared.CurrentConfig.Path(), keyConf.Name(), "keyfile", output); err != nil {
+		return shared.Fail(fmt.Errorf("updating configuration: %w", err))
+	}
+	fmt.Fprintf(os.Stderr, "Key %s now uses the sealed key. Remove %s once it is confirmed to work.\n", keyConf.Name(), keyConf.KeyFile)
+	return nil
+}
+
+func newPassphrase(prompt passprompt.PasswordGetter, what string, allowEmpty bool) (string, error) {
+	for {
+		passphrase, err := prompt.GetPasswd(fmt.Sprintf("New passphrase for %s: ", what))
+		if err != nil {
+			return "", err
+		} else if passphrase == "" {
+			if allowEmpty {
+				return "", nil
+			}
+			return "", errors.New("aborted")
+		}
+		again, err := prompt.GetPasswd("Repeat passphrase: ")
+		if err != nil {
+			return "", err
+		} else if again == passphrase {
+			return passphrase, nil
+		}
+		fmt.Fprintln(os.Stderr, "Passphrases do not match")
+	}
+}
@@ -19,15 +19,19 @@ package token
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"github.com/spf13/cobra"
 
 	"github.com/sassoftware/relic/v7/cmdline/shared"
 	"github.com/sassoftware/relic/v7/internal/signinit"
+	"github.com/sassoftware/relic/v7/lib/atomicfile"
 	"github.com/sassoftware/relic/v7/signers"
+	"github.com/sassoftware/relic/v7/signers/intoto"
 )
 
 var SignCmd = &cobra.Command{
@@ -40,6 +44,8 @@ var (
 	argIfUnsigned bool
 	argSigType    string
 	argOutput     string
+	argKeyless    bool
+	argTlogEntry  string
 )
 
 func init() {
@@ -49,13 +55,21 @@ func init() {
 	SignCmd.Flags().StringVarP(&argOutput, "output", "o", "", "Output file")
 	SignCmd.Flags().StringVarP(&argSigType, "sig-type", "T", "", "Specify signature type (default: auto-detect)")
 	SignCmd.Flags().BoolVar(&argIfUnsigned, "if-unsigned", false, "Skip signing if the file already has a signature")
+	SignCmd.Flags().BoolVar(&argKeyless, "keyless", false, "Sign with an ephemeral key certified for the CI job's OIDC identity, and record it in a transparency log")
 	shared.AddDigestFlag(SignCmd)
+	SignCmd.Flags().StringVar(&argTlogEntry, "tlog-entry", "", "Save the transparency log entry and its inclusion proof here, for offline verification with 'relic verify --tlog-entry'")
+	shared.AddAttestFlags(SignCmd)
 	shared.AddLateHook(func() {
 		signers.MergeFlags(SignCmd)
 	})
 }
 
 func signCmd(cmd *cobra.Command, args []string) error {
+	if argKeyless {
+		if err := setupKeyless(); err != nil {
+			return shared.Fail(err)
+		}
+	}
 	if argFile == "" || argKeyName == "" {
 		return errors.New("--file and --key are required")
 	}
@@ -85,7 +99,21 @@ func signCmd(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return shared.Fail(err)
 	}
+	kconf, err := shared.CurrentConfig.GetKey(argKeyName)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	if argTlogEntry != "" && kconf.TransparencyLog == "" {
+		return shared.Fail(fmt.Errorf("key %q has no transparencylog configured", argKeyName))
+	}
+	if kconf.TransparencyLog != "" && argOutput == "-" {
+		return shared.Fail(errors.New("can't record a signature written to standard output in a transparency log"))
+	}
 	opts.Path = argFile
+	attest, err := shared.StartAttestation(argFile, argOutput)
+	if err != nil {
+		return shared.Fail(err)
+	}
 	infile, err := shared.OpenForPatching(argFile, argOutput)
 	if err != nil {
 		return shared.Fail(err)
@@ -138,9 +166,47 @@ func signCmd(cmd *cobra.Command, args []string) error {
 			return shared.Fail(err)
 		}
 	}
+	if kconf.TransparencyLog != "" {
+		f, err := os.Open(argOutput)
+		if err != nil {
+			return shared.Fail(err)
+		}
+		entry, err := signinit.RecordTransparency(context.Background(), cert, kconf, filepath.Base(argOutput), f, opts.Audit)
+		f.Close()
+		if err != nil {
+			return shared.Fail(err)
+		}
+		fmt.Fprintf(os.Stderr, "Recorded in transparency log %s at index %d\n", kconf.TransparencyLog, entry.LogIndex)
+		if argTlogEntry != "" {
+			blob, err := json.MarshalIndent(entry, "", "  ")
+			if err != nil {
+				return shared.Fail(err)
+			}
+			if err := atomicfile.WriteFile(argTlogEntry, blob); err != nil {
+				return shared.Fail(err)
+			}
+		}
+	}
 	if err := signinit.PublishAudit(opts.Audit); err != nil {
 		return err
 	}
+	if err := shared.RunPostSignHooks(context.Background(), flags, argOutput); err != nil {
+		return shared.Fail(err)
+	}
+	if attest != nil {
+		stmt, err := attest.Statement(argOutput, map[string]interface{}{"sigType": mod.Name, "key": argKeyName})
+		if err != nil {
+			return shared.Fail(err)
+		}
+		env, err := intoto.SignStatement(cert, *opts, stmt)
+		if err != nil {
+			return shared.Fail(err)
+		}
+		if err := atomicfile.WriteFile(attest.Path(argOutput), env); err != nil {
+			return shared.Fail(err)
+		}
+		fmt.Fprintln(os.Stderr, "Wrote attestation to", attest.Path(argOutput))
+	}
 	fmt.Fprintln(os.Stderr, "Signed", argFile)
 	return nil
 }
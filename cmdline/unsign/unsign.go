@@ -0,0 +1,98 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package unsign
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sassoftware/relic/v7/cmdline/shared"
+	"github.com/sassoftware/relic/v7/signers"
+)
+
+var RemoveSignatureCmd = &cobra.Command{
+	Use:   "remove-signature FILE...",
+	Short: "Remove all signatures from a package or executable",
+	Long: `Remove the existing signatures from PE executables, MSI and CAB files, JAR
+and APK archives, RPM and DEB packages, and PowerShell scripts, so that they
+can be signed again from scratch or inspected as they were before signing.
+Checksums, sizes and offsets that the signature affected are updated.`,
+	RunE: removeSignatureCmd,
+}
+
+var (
+	argSigType string
+	argOutput  string
+)
+
+func init() {
+	shared.RootCmd.AddCommand(RemoveSignatureCmd)
+	RemoveSignatureCmd.Flags().StringVarP(&argSigType, "sig-type", "T", "", "Specify signature type (default: auto-detect)")
+	RemoveSignatureCmd.Flags().StringVarP(&argOutput, "output", "o", "", "Output file. Defaults to overwriting the input file. Only one input file may be given.")
+}
+
+func removeSignatureCmd(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		return errors.New("expected 1 or more files")
+	} else if argOutput != "" && len(args) != 1 {
+		return errors.New("--output can only be used with one input file")
+	}
+	for _, path := range args {
+		output := argOutput
+		if output == "" {
+			output = path
+		}
+		if err := removeSignature(path, output); err != nil {
+			return shared.Fail(fmt.Errorf("%s: %w", path, err))
+		}
+		fmt.Fprintf(os.Stderr, "Removed signatures from %s\n", path)
+	}
+	return nil
+}
+
+func removeSignature(path, output string) error {
+	if path == "-" {
+		return errors.New("reading from standard input is not supported")
+	}
+	mod, err := signers.ByFile(path, argSigType)
+	if err != nil {
+		return err
+	}
+	if mod.RemoveSignature == nil {
+		return fmt.Errorf("can't remove signatures from files of type: %s", mod.Name)
+	}
+	infile, err := shared.OpenForPatching(path, output)
+	if err != nil {
+		return err
+	}
+	defer infile.Close()
+	if err := mod.RemoveSignature(infile, output); err != nil {
+		return err
+	}
+	if mod.Fixup != nil {
+		f, err := os.OpenFile(output, os.O_RDWR, 0)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return mod.Fixup(f)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package verify
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/sassoftware/relic/v7/lib/rekor"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+	"github.com/sassoftware/relic/v7/signers"
+)
+
+var (
+	argTlogEntry string
+	argTlogKey   string
+
+	tlogKey crypto.PublicKey
+)
+
+func init() {
+	VerifyCmd.Flags().StringVar(&argTlogEntry, "tlog-entry", "", "Check a transparency log entry saved by 'relic sign --tlog-entry' against the file, offline")
+	VerifyCmd.Flags().StringVar(&argTlogKey, "tlog-key", "", "Public key of the transparency log, for --tlog-entry")
+}
+
+func loadTlogKey(nfiles int) error {
+	if argTlogEntry == "" {
+		return nil
+	} else if argTlogKey == "" {
+		return errors.New("--tlog-entry requires --tlog-key")
+	} else if nfiles != 1 {
+		return errors.New("--tlog-entry can only be used with a single file")
+	}
+	var err error
+	tlogKey, err = loadPublicKey(argTlogKey)
+	if err != nil {
+		return fmt.Errorf("%s: %w", argTlogKey, err)
+	}
+	return nil
+}
+
+// checkTlogEntry verifies that the saved transparency log entry records a
+// signature over the file by one of the file's verified signers, and was
+// included in the log
+func checkTlogEntry(path string, sigs []*signers.Signature) error {
+	if argTlogEntry == "" {
+		return nil
+	}
+	blob, err := os.ReadFile(argTlogEntry)
+	if err != nil {
+		return err
+	}
+	entry := new(rekor.Entry)
+	if err := json.Unmarshal(blob, entry); err != nil {
+		return fmt.Errorf("%s: %w", argTlogEntry, err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	d := sha256.New()
+	if _, err := io.Copy(d, f); err != nil {
+		return err
+	}
+	v, err := entry.Verify(d.Sum(nil), tlogKey)
+	if err != nil {
+		return fmt.Errorf("transparency log: %w", err)
+	}
+	if !tlogSignerMatches(v, sigs) {
+		return errors.New("transparency log: entry was not signed by the file's signer")
+	}
+	signer := "public key"
+	if v.Certificate != nil {
+		signer = "`" + x509tools.FormatSubject(v.Certificate) + "`"
+	}
+	how := "promised"
+	if v.Included {
+		how = "included"
+	}
+	fmt.Printf("%s(tlog): OK - %s %s entry %d signed by %s [%s]\n", path, how, entry.Kind, entry.LogIndex, signer, entry.IntegratedTime)
+	return nil
+}
+
+// an entry from any key would show that someone logged the file, so it has to
+// have been made with the key that signed the file itself
+func tlogSignerMatches(v *rekor.Verified, sigs []*signers.Signature) bool {
+	for _, sig := range sigs {
+		if sig.X509Signature != nil && x509tools.SameKey(v.PublicKey, sig.X509Signature.Certificate.PublicKey) {
+			return true
+		}
+	}
+	return false
+}
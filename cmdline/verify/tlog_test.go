@@ -0,0 +1,125 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package verify
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sassoftware/relic/v7/internal/testcert"
+	"github.com/sassoftware/relic/v7/lib/pkcs7"
+	"github.com/sassoftware/relic/v7/lib/pkcs9"
+	"github.com/sassoftware/relic/v7/lib/rekor"
+	"github.com/sassoftware/relic/v7/signers"
+)
+
+// makeEntry returns a hashedrekord entry for digest signed by key, with a
+// signed entry timestamp from logKey
+func makeEntry(t *testing.T, logKey, key *ecdsa.PrivateKey, cert *x509.Certificate, digest []byte) *rekor.Entry {
+	sig, err := ecdsa.SignASN1(rand.Reader, key, digest)
+	require.NoError(t, err)
+	var body struct {
+		APIVersion string `json:"apiVersion"`
+		Kind       string `json:"kind"`
+		Spec       struct {
+			Signature struct {
+				Content   []byte `json:"content"`
+				PublicKey struct {
+					Content []byte `json:"content"`
+				} `json:"publicKey"`
+			} `json:"signature"`
+			Data struct {
+				Hash struct {
+					Algorithm string `json:"algorithm"`
+					Value     string `json:"value"`
+				} `json:"hash"`
+			} `json:"data"`
+		} `json:"spec"`
+	}
+	body.APIVersion = "0.0.1"
+	body.Kind = rekor.KindHashedRekord
+	body.Spec.Signature.Content = sig
+	body.Spec.Signature.PublicKey.Content = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	body.Spec.Data.Hash.Algorithm = "sha256"
+	body.Spec.Data.Hash.Value = hex.EncodeToString(digest)
+	bodyJSON, err := json.Marshal(body)
+	require.NoError(t, err)
+	leaf := sha256.Sum256(append([]byte{0}, bodyJSON...))
+	entry := &rekor.Entry{
+		UUID:           hex.EncodeToString(leaf[:]),
+		LogIndex:       1,
+		IntegratedTime: time.Unix(time.Now().Unix(), 0),
+		LogID:          "test",
+		Kind:           rekor.KindHashedRekord,
+		Body:           bodyJSON,
+	}
+	payload, err := json.Marshal(map[string]interface{}{
+		"body":           base64.StdEncoding.EncodeToString(bodyJSON),
+		"integratedTime": entry.IntegratedTime.Unix(),
+		"logID":          entry.LogID,
+		"logIndex":       entry.LogIndex,
+	})
+	require.NoError(t, err)
+	d := sha256.Sum256(payload)
+	set, err := ecdsa.SignASN1(rand.Reader, logKey, d[:])
+	require.NoError(t, err)
+	entry.SignedEntryTimestamp = base64.StdEncoding.EncodeToString(set)
+	return entry
+}
+
+func TestTlogSigner(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "artifact.txt")
+	require.NoError(t, os.WriteFile(path, []byte("hello world"), 0644))
+	digest := sha256.Sum256([]byte("hello world"))
+
+	logKey := testcert.ECDSAKey(t)
+	key := testcert.ECDSAKey(t)
+	cert := testcert.SelfSigned(t, "signer", key)
+	otherKey := testcert.ECDSAKey(t)
+	otherCert := testcert.SelfSigned(t, "other", otherKey)
+	sigs := []*signers.Signature{{
+		X509Signature: &pkcs9.TimestampedSignature{Signature: pkcs7.Signature{Certificate: cert}},
+	}}
+
+	defer func() { argTlogEntry, tlogKey = "", nil }()
+	argTlogEntry = filepath.Join(dir, "entry.json")
+	tlogKey = logKey.Public()
+	check := func(entry *rekor.Entry) error {
+		blob, err := json.Marshal(entry)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(argTlogEntry, blob, 0644))
+		return checkTlogEntry(path, sigs)
+	}
+	assert.NoError(t, check(makeEntry(t, logKey, key, cert, digest[:])))
+	// a valid entry for the same file, but from another key
+	err := check(makeEntry(t, logKey, otherKey, otherCert, digest[:]))
+	assert.ErrorContains(t, err, "not signed by the file's signer")
+}
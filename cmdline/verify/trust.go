@@ -0,0 +1,221 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package verify
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sassoftware/relic/v7/cmdline/shared"
+	"github.com/sassoftware/relic/v7/config"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/truststore"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+)
+
+var TrustCmd = &cobra.Command{
+	Use:   "trust",
+	Short: "Manage the certificates trusted by 'relic verify'",
+}
+
+var TrustListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List trusted certificates",
+	RunE:  trustListCmd,
+}
+
+var TrustAddCmd = &cobra.Command{
+	Use:   "add FILE...",
+	Short: "Add trusted root or intermediate certificates",
+	RunE:  trustAddCmd,
+}
+
+var TrustRemoveCmd = &cobra.Command{
+	Use:   "remove FINGERPRINT...",
+	Short: "Remove certificates by SHA-256 fingerprint or a unique prefix of it",
+	RunE:  trustRemoveCmd,
+}
+
+var TrustPinCmd = &cobra.Command{
+	Use:   "pin FINGERPRINT...",
+	Short: "Require signatures in the certificate's scope to chain through it",
+	RunE:  func(cmd *cobra.Command, args []string) error { return trustPin(args, true) },
+}
+
+var TrustUnpinCmd = &cobra.Command{
+	Use:   "unpin FINGERPRINT...",
+	Short: "Remove a pin",
+	RunE:  func(cmd *cobra.Command, args []string) error { return trustPin(args, false) },
+}
+
+var (
+	argStore        string
+	argScope        string
+	argIntermediate bool
+	argPin          bool
+)
+
+func init() {
+	shared.RootCmd.AddCommand(TrustCmd)
+	TrustCmd.PersistentFlags().StringVar(&argStore, "store", "", "Path to trust store directory or .pem bundle (default: "+defaultTrustStore()+")")
+	TrustCmd.PersistentFlags().StringVar(&argScope, "scope", "", "Signature type (e.g. jar, pe-coff) or family (authenticode, apple) the certificates apply to. Default is all types")
+
+	TrustCmd.AddCommand(TrustListCmd)
+	TrustCmd.AddCommand(TrustAddCmd)
+	TrustAddCmd.Flags().BoolVar(&argIntermediate, "intermediate", false, "Use the certificates to build chains but not as trust anchors")
+	TrustAddCmd.Flags().BoolVar(&argPin, "pin", false, "Also pin the certificates")
+	TrustCmd.AddCommand(TrustRemoveCmd)
+	TrustCmd.AddCommand(TrustPinCmd)
+	TrustCmd.AddCommand(TrustUnpinCmd)
+}
+
+// The trust store lives next to the client configuration by default
+func defaultTrustStore() string {
+	cfg := config.DefaultConfig()
+	if cfg == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(cfg), "trust")
+}
+
+func openTrustStore() (*truststore.Store, error) {
+	path := argStore
+	if path == "" {
+		path = defaultTrustStore()
+		if path == "" {
+			return nil, errors.New("--store must be set")
+		}
+	}
+	return truststore.Open(path)
+}
+
+func trustListCmd(cmd *cobra.Command, args []string) error {
+	store, err := openTrustStore()
+	if err != nil {
+		return err
+	}
+	for _, entry := range store.Entries {
+		if argScope != "" && entry.Scope != argScope {
+			continue
+		}
+		var flags []string
+		if entry.Intermediate {
+			flags = append(flags, "intermediate")
+		} else {
+			flags = append(flags, "root")
+		}
+		if entry.Pinned {
+			flags = append(flags, "pinned")
+		}
+		cert := entry.Certificate
+		fmt.Printf("%s %s [%s] `%s` expires %s\n", entry.Fingerprint(), entry.Scope, strings.Join(flags, ","), x509tools.FormatSubject(cert), cert.NotAfter.Format("2006-01-02"))
+	}
+	return nil
+}
+
+func trustAddCmd(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		return errors.New("expected 1 or more certificate files")
+	}
+	store, err := openTrustStore()
+	if err != nil {
+		return err
+	}
+	for _, path := range args {
+		blob, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		certs, err := certloader.ParseX509Certificates(blob)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		for _, cert := range certs {
+			entry := store.Add(cert, argScope, argIntermediate)
+			if argPin {
+				entry.Pinned = true
+			}
+			fmt.Fprintf(os.Stderr, "Added %s `%s`\n", entry.Fingerprint(), x509tools.FormatSubject(cert))
+		}
+	}
+	return store.Save()
+}
+
+// Find exactly one entry per argument
+func findEntries(store *truststore.Store, args []string) ([]*truststore.Entry, error) {
+	if len(args) == 0 {
+		return nil, errors.New("expected 1 or more fingerprints")
+	}
+	var entries []*truststore.Entry
+	for _, fp := range args {
+		found := store.Find(fp, argScope)
+		switch {
+		case len(found) == 0:
+			return nil, fmt.Errorf("no certificate matches %s", fp)
+		case len(found) > 1 && !sameCert(found):
+			return nil, fmt.Errorf("%s matches more than one certificate", fp)
+		}
+		entries = append(entries, found...)
+	}
+	return entries, nil
+}
+
+// true if all entries are the same certificate in different scopes
+func sameCert(entries []*truststore.Entry) bool {
+	for _, entry := range entries[1:] {
+		if !entry.Certificate.Equal(entries[0].Certificate) {
+			return false
+		}
+	}
+	return true
+}
+
+func trustRemoveCmd(cmd *cobra.Command, args []string) error {
+	store, err := openTrustStore()
+	if err != nil {
+		return err
+	}
+	entries, err := findEntries(store, args)
+	if err != nil {
+		return err
+	}
+	store.Remove(entries)
+	for _, entry := range entries {
+		fmt.Fprintf(os.Stderr, "Removed %s `%s` from %s\n", entry.Fingerprint(), x509tools.FormatSubject(entry.Certificate), entry.Scope)
+	}
+	return store.Save()
+}
+
+func trustPin(args []string, pinned bool) error {
+	store, err := openTrustStore()
+	if err != nil {
+		return err
+	}
+	entries, err := findEntries(store, args)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		entry.Pinned = pinned
+	}
+	return store.Save()
+}
@@ -17,11 +17,14 @@
 package verify
 
 import (
+	"context"
 	"crypto/x509"
 	"encoding/pem"
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/spf13/cobra"
 
@@ -29,6 +32,8 @@ import (
 	"github.com/sassoftware/relic/v7/lib/certloader"
 	"github.com/sassoftware/relic/v7/lib/magic"
 	"github.com/sassoftware/relic/v7/lib/pgptools"
+	"github.com/sassoftware/relic/v7/lib/pkcs9"
+	"github.com/sassoftware/relic/v7/lib/truststore"
 	"github.com/sassoftware/relic/v7/lib/x509tools"
 	"github.com/sassoftware/relic/v7/signers"
 )
@@ -46,6 +51,19 @@ var (
 	argShowCerts        bool
 	argContent          string
 	argTrustedCerts     []string
+	argOCSP             string
+	argCRL              string
+	argCRLCache         string
+	argCTLogs           string
+	argRequireSCT       int
+	argTrustStore       string
+	argKeys             []string
+	argAllowedSigners   string
+
+	ocspPolicy x509tools.RevocationPolicy
+	crlChecker x509tools.RevocationChecker
+	ctLogs     x509tools.CTLogList
+	trustStore *truststore.Store
 )
 
 func init() {
@@ -56,6 +74,14 @@ func init() {
 	VerifyCmd.Flags().BoolVar(&argShowCerts, "show-certs", false, "Dump certificate chain from signature")
 	VerifyCmd.Flags().StringVar(&argContent, "content", "", "Specify file containing contents for detached signatures")
 	VerifyCmd.Flags().StringArrayVar(&argTrustedCerts, "cert", nil, "Add a trusted root certificate (PEM, DER, PKCS#7, or PGP)")
+	VerifyCmd.Flags().StringVar(&argOCSP, "ocsp", "", "Check revocation status of signing certificates via OCSP. Policy is one of: soft hard")
+	VerifyCmd.Flags().StringVar(&argCRL, "crl", "", "Check revocation status of signing and timestamping certificates via CRL. Policy is one of: soft hard")
+	VerifyCmd.Flags().StringVar(&argCRLCache, "crl-cache", "", "Directory to cache downloaded CRLs in (default: user cache directory)")
+	VerifyCmd.Flags().StringVar(&argCTLogs, "ct-logs", "", "Verify Certificate Transparency SCTs embedded in signing certificates using this log list (log_list.json)")
+	VerifyCmd.Flags().IntVar(&argRequireSCT, "require-sct", 0, "Fail unless the signing certificate has at least N valid SCTs from distinct log operators")
+	VerifyCmd.Flags().StringArrayVar(&argKeys, "key", nil, "Trust the certificates of every version of this key from the configuration file")
+	VerifyCmd.Flags().StringVar(&argAllowedSigners, "allowed-signers", "", "Trust SSH signatures made by the keys in this ssh-keygen allowed_signers file")
+	VerifyCmd.Flags().StringVar(&argTrustStore, "trust-store", "", "Use the trusted certificates in this store, managed with 'relic trust' (default: the user's store, if it exists)")
 }
 
 func verifyCmd(cmd *cobra.Command, args []string) error {
@@ -66,6 +92,9 @@ func verifyCmd(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
+	if err := loadTlogKey(len(args)); err != nil {
+		return err
+	}
 	rc := 0
 	for _, path := range args {
 		if err := verifyOne(path, opts); err != nil {
@@ -92,15 +121,22 @@ func verifyOne(path string, opts signers.VerifyOpts) error {
 	if _, err := f.Seek(0, 0); err != nil {
 		return err
 	}
-	mod := signers.ByMagic(fileType)
-	if mod == nil {
-		mod = signers.ByFileName(path)
-	}
+	mod := signers.ByFileType(fileType, path)
 	if mod == nil {
 		return errors.New("unknown filetype")
 	}
+	var trust *truststore.Trust
+	if trustStore != nil {
+		trust = trustStore.ForSigner(mod.Name)
+		opts, err = applyTrust(opts, trust)
+		if err != nil {
+			return err
+		}
+	}
 	var sigs []*signers.Signature
-	if mod.VerifyStream != nil {
+	if mod.Verify == nil && mod.VerifyStream == nil {
+		return fmt.Errorf("can't verify files of type: %s", mod.Name)
+	} else if mod.VerifyStream != nil {
 		r, err2 := magic.Decompress(f, opts.Compression)
 		if err2 != nil {
 			return err
@@ -134,12 +170,31 @@ func verifyOne(path string, opts signers.VerifyOpts) error {
 			}
 		}
 		if sig.X509Signature != nil && !opts.NoChain {
-			if err := sig.X509Signature.VerifyChain(opts.TrustedPool, nil, x509.ExtKeyUsageAny); err != nil {
+			var extraCerts []*x509.Certificate
+			if trust != nil {
+				extraCerts = trust.Intermediates
+			}
+			if err := sig.X509Signature.VerifyChainRevocation(opts.TrustedPool, extraCerts, x509.ExtKeyUsageAny, crlChecker); err != nil {
 				if e := new(x509.UnknownAuthorityError); errors.As(err, e) {
 					fmt.Printf("While validating certificate:\n Subject: %s\n Issuer:  %s\n Serial:  %X\n", x509tools.FormatSubject(e.Cert), x509tools.FormatIssuer(e.Cert), e.Cert.SerialNumber)
 				}
 				return err
 			}
+			if trust != nil {
+				at := time.Now()
+				if cs := sig.X509Signature.CounterSignature; cs != nil {
+					at = cs.SigningTime
+				}
+				if err := trust.CheckPinned(sig.X509Signature.Certificate, sig.X509Signature.Intermediates, opts.TrustedPool, at); err != nil {
+					return err
+				}
+			}
+			if err := checkRevocation(sig.X509Signature, opts); err != nil {
+				return err
+			}
+			if err := checkSCTs(path, sig.X509Signature, opts); err != nil {
+				return err
+			}
 		}
 		if sig.X509Signature != nil && sig.X509Signature.CounterSignature != nil {
 			fmt.Printf("%s: OK -%s %s%s\n", path, si, pkg, sig.SignerName())
@@ -151,19 +206,71 @@ func verifyOne(path string, opts signers.VerifyOpts) error {
 			fmt.Printf("%s: OK -%s %s%s%s\n", path, si, pkg, sig.SignerName(), ts)
 		}
 	}
-	return nil
+	return checkTlogEntry(path, sigs)
 }
 
 func loadCerts() (signers.VerifyOpts, error) {
 	opts := signers.VerifyOpts{
-		NoChain:   argNoChain,
-		NoDigests: argNoIntegrityCheck,
-		Content:   argContent,
+		NoChain:        argNoChain,
+		NoDigests:      argNoIntegrityCheck,
+		Content:        argContent,
+		AllowedSigners: argAllowedSigners,
 	}
-	trusted, err := certloader.LoadAnyCerts(argTrustedCerts)
+	var err error
+	ocspPolicy, err = x509tools.ParseRevocationPolicy(argOCSP)
 	if err != nil {
 		return opts, err
 	}
+	crlPolicy, err := x509tools.ParseRevocationPolicy(argCRL)
+	if err != nil {
+		return opts, err
+	}
+	if crlPolicy != x509tools.RevocationNone {
+		cacheDir := argCRLCache
+		if cacheDir == "" {
+			if userCache, err := os.UserCacheDir(); err == nil {
+				cacheDir = filepath.Join(userCache, "relic", "crl")
+			}
+		}
+		crlChecker = &x509tools.CRLChecker{
+			Cache:  &x509tools.CRLCache{Dir: cacheDir},
+			Policy: crlPolicy,
+		}
+	}
+	if argCTLogs != "" {
+		blob, err := os.ReadFile(argCTLogs)
+		if err != nil {
+			return opts, err
+		}
+		ctLogs, err = x509tools.ParseCTLogList(blob)
+		if err != nil {
+			return opts, err
+		}
+	} else if argRequireSCT > 0 {
+		return opts, errors.New("--require-sct needs a log list specified with --ct-logs")
+	}
+	certPaths, err := keyCertPaths(argKeys)
+	if err != nil {
+		return opts, err
+	}
+	trusted, err := certloader.LoadAnyCerts(append(certPaths, argTrustedCerts...))
+	if err != nil {
+		return opts, err
+	}
+	storePath := argTrustStore
+	if storePath == "" {
+		if path := defaultTrustStore(); path != "" {
+			if _, err := os.Stat(path); err == nil {
+				storePath = path
+			}
+		}
+	}
+	if storePath != "" {
+		trustStore, err = truststore.Open(storePath)
+		if err != nil {
+			return opts, err
+		}
+	}
 	opts.TrustedX509 = trusted.X509Certs
 	opts.TrustedPgp = trusted.PGPCerts
 	if len(opts.TrustedX509) > 0 {
@@ -183,6 +290,105 @@ func loadCerts() (signers.VerifyOpts, error) {
 	return opts, nil
 }
 
+// Get the certificate files of all versions of the named keys, so signatures
+// made before a key was rotated still verify
+func keyCertPaths(keyNames []string) ([]string, error) {
+	if len(keyNames) == 0 {
+		return nil, nil
+	}
+	if err := shared.InitConfig(); err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, keyName := range keyNames {
+		versions, err := shared.CurrentConfig.KeyVersions(keyName)
+		if err != nil {
+			return nil, err
+		}
+		for _, vconf := range versions {
+			if vconf.X509Certificate != "" {
+				paths = append(paths, vconf.X509Certificate)
+			}
+			if vconf.PgpCertificate != "" {
+				paths = append(paths, vconf.PgpCertificate)
+			}
+		}
+	}
+	if len(paths) == 0 {
+		return nil, errors.New("none of the keys given with --key have certificates configured")
+	}
+	return paths, nil
+}
+
+// Add the trust store's roots for one signer type to the trusted certificates
+func applyTrust(opts signers.VerifyOpts, trust *truststore.Trust) (signers.VerifyOpts, error) {
+	if len(trust.Roots) == 0 {
+		return opts, nil
+	}
+	pool := x509.NewCertPool()
+	if argAlsoSystem {
+		var err error
+		pool, err = x509.SystemCertPool()
+		if err != nil {
+			return opts, err
+		}
+	}
+	trusted := append([]*x509.Certificate{}, opts.TrustedX509...)
+	trusted = append(trusted, trust.Roots...)
+	for _, cert := range trusted {
+		pool.AddCert(cert)
+	}
+	opts.TrustedX509 = trusted
+	opts.TrustedPool = pool
+	return opts, nil
+}
+
+// Check the OCSP status of the signer's chain. A signature that was timestamped
+// before the certificate was revoked is still considered valid.
+func checkRevocation(sig *pkcs9.TimestampedSignature, opts signers.VerifyOpts) error {
+	if ocspPolicy == x509tools.RevocationNone {
+		return nil
+	}
+	certs := append([]*x509.Certificate{}, sig.Intermediates...)
+	certs = append(certs, opts.TrustedX509...)
+	_, err := x509tools.CheckOCSP(context.Background(), sig.Certificate, certs, ocspPolicy)
+	var revoked x509tools.RevokedError
+	if errors.As(err, &revoked) && sig.CounterSignature != nil && sig.CounterSignature.SigningTime.Before(revoked.RevokedAt) {
+		return nil
+	}
+	return err
+}
+
+// Validate the SCTs embedded in the signing certificate and report which logs
+// they came from
+func checkSCTs(path string, sig *pkcs9.TimestampedSignature, opts signers.VerifyOpts) error {
+	if ctLogs == nil {
+		return nil
+	}
+	certs := append([]*x509.Certificate{}, sig.Intermediates...)
+	certs = append(certs, opts.TrustedX509...)
+	results, err := x509tools.VerifyEmbeddedSCTs(sig.Certificate, certs, ctLogs)
+	if err != nil {
+		return err
+	}
+	operators := make(map[string]bool)
+	for _, result := range results {
+		if result.Err != nil {
+			fmt.Printf("%s(ct): WARNING - %s\n", path, result.Err)
+			continue
+		}
+		operators[result.Log.Operator] = true
+		fmt.Printf("%s(ct): OK - logged in %s [%s]\n", path, result.Log.Description, result.SCT.Timestamp)
+	}
+	if len(results) == 0 {
+		fmt.Printf("%s(ct): no embedded SCTs\n", path)
+	}
+	if len(operators) < argRequireSCT {
+		return fmt.Errorf("signing certificate has valid SCTs from %d log operators, but %d are required", len(operators), argRequireSCT)
+	}
+	return nil
+}
+
 func showCert(blob []byte, seen map[string]bool) {
 	if seen[string(blob)] {
 		return
@@ -0,0 +1,202 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package verify
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sassoftware/relic/v7/cmdline/shared"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/cosign"
+	"github.com/sassoftware/relic/v7/lib/oci"
+	"github.com/sassoftware/relic/v7/lib/pkcs7"
+	"github.com/sassoftware/relic/v7/lib/pkcs9"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+	"github.com/sassoftware/relic/v7/signers"
+)
+
+var VerifyImageCmd = &cobra.Command{
+	Use:   "verify-image IMAGE...",
+	Short: "Verify cosign signatures attached to container images in a registry",
+	Long: `Verify the cosign signatures attached to container images, in either the
+.sig tag scheme or as OCI referrers. Signatures are checked against the
+public keys given with --public-key or, for certificate-based and keyless
+signatures, against the roots given with --cert or the trust store. Keyless
+signatures can be further restricted with --certificate-identity and
+--certificate-oidc-issuer.`,
+	RunE: verifyImageCmd,
+}
+
+var (
+	argPublicKeys       []string
+	argCertIdentity     string
+	argCertIssuer       string
+	argInsecureRegistry bool
+)
+
+func init() {
+	shared.RootCmd.AddCommand(VerifyImageCmd)
+	VerifyImageCmd.Flags().StringArrayVar(&argPublicKeys, "public-key", nil, "Accept signatures made by this PEM public key or certificate")
+	VerifyImageCmd.Flags().StringVar(&argCertIdentity, "certificate-identity", "", "Require the signing certificate to have this email or URI identity")
+	VerifyImageCmd.Flags().StringVar(&argCertIssuer, "certificate-oidc-issuer", "", "Require the signing certificate to have been issued for this OIDC issuer")
+	VerifyImageCmd.Flags().BoolVar(&argInsecureRegistry, "insecure-registry", false, "Talk to the registry over plain HTTP")
+	VerifyImageCmd.Flags().BoolVar(&argNoChain, "no-trust-chain", false, "Do not test whether the signing certificate is trusted")
+	VerifyImageCmd.Flags().BoolVar(&argAlsoSystem, "system-store", false, "When --cert is used, append rather than replace the system trust store")
+	VerifyImageCmd.Flags().StringArrayVar(&argTrustedCerts, "cert", nil, "Add a trusted root certificate (PEM, DER, PKCS#7, or PGP)")
+	VerifyImageCmd.Flags().StringVar(&argTrustStore, "trust-store", "", "Use the trusted certificates in this store, managed with 'relic trust' (default: the user's store, if it exists)")
+}
+
+func verifyImageCmd(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		return errors.New("Expected 1 or more images")
+	}
+	var keys []crypto.PublicKey
+	for _, path := range argPublicKeys {
+		key, err := loadPublicKey(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		keys = append(keys, key)
+	}
+	client := oci.NewClient()
+	client.PlainHTTP = argInsecureRegistry
+	rc := 0
+	for _, image := range args {
+		if err := verifyImage(client, image, keys); err != nil {
+			fmt.Printf("%s ERROR: %s\n", image, err)
+			rc = 1
+		}
+	}
+	if rc != 0 {
+		fmt.Fprintln(os.Stderr, "ERROR: 1 or more images did not validate")
+	}
+	os.Exit(rc)
+	return nil
+}
+
+func loadPublicKey(path string) (crypto.PublicKey, error) {
+	blob, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if certs, err := certloader.ParseX509Certificates(blob); err == nil && len(certs) != 0 {
+		return certs[0].PublicKey, nil
+	}
+	block, _ := pem.Decode(blob)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, errors.New("expected a PEM public key or certificate")
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+func verifyImage(client *oci.Client, name string, keys []crypto.PublicKey) error {
+	ctx := context.Background()
+	ref, err := oci.ParseReference(name)
+	if err != nil {
+		return err
+	}
+	if ref.Digest == "" {
+		desc, err := client.Resolve(ctx, ref)
+		if err != nil {
+			return err
+		}
+		ref = ref.WithDigest(desc.Digest)
+	}
+	sigs, err := cosign.FetchSignatures(ctx, client, ref)
+	if err != nil {
+		return err
+	}
+	if len(sigs) == 0 {
+		return errors.New("no signatures found")
+	}
+	var opts signers.VerifyOpts
+	if len(keys) == 0 {
+		if opts, err = loadCerts(); err != nil {
+			return err
+		}
+		if trustStore != nil {
+			if opts, err = applyTrust(opts, trustStore.ForSigner("cosign")); err != nil {
+				return err
+			}
+		}
+	}
+	var verified int
+	var lastErr error
+	for _, sig := range sigs {
+		var v *cosign.Verified
+		if len(keys) != 0 {
+			for _, key := range keys {
+				if v, err = sig.Verify(ref.Digest, key); err == nil {
+					break
+				}
+			}
+		} else {
+			v, err = sig.Verify(ref.Digest, nil)
+			if err == nil {
+				err = checkImageCert(v, opts)
+			}
+		}
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		verified++
+		signer := "public key"
+		if v.Certificate != nil {
+			signer = "`" + x509tools.FormatSubject(v.Certificate) + "`"
+		}
+		fmt.Printf("%s: OK - %s signed by %s\n", name, ref.Digest, signer)
+		if cs := v.CounterSignature; cs != nil {
+			fmt.Printf("%s(timestamp): OK - `%s` [%s]\n", name, x509tools.FormatSubject(cs.Certificate), cs.SigningTime)
+		}
+	}
+	if verified == 0 {
+		return fmt.Errorf("none of %d signature(s) could be verified: %w", len(sigs), lastErr)
+	}
+	return nil
+}
+
+// Check a certificate-based signature's chain and keyless identity
+func checkImageCert(v *cosign.Verified, opts signers.VerifyOpts) error {
+	if err := cosign.CheckIdentity(v.Certificate, argCertIdentity, argCertIssuer); err != nil {
+		return err
+	}
+	if opts.NoChain {
+		return nil
+	}
+	if opts.TrustedPool == nil {
+		return errors.New("no trusted roots; use --cert, --public-key or --no-trust-chain")
+	}
+	sig := pkcs9.TimestampedSignature{
+		Signature: pkcs7.Signature{
+			Certificate:   v.Certificate,
+			Intermediates: v.Chain,
+		},
+		CounterSignature: v.CounterSignature,
+	}
+	// keyless certificates only live for minutes, so without a timestamp
+	// they can't be validated
+	return sig.VerifyChain(opts.TrustedPool, nil, x509.ExtKeyUsageAny)
+}
@@ -0,0 +1,139 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package verify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sassoftware/relic/v7/cmdline/shared"
+	"github.com/sassoftware/relic/v7/lib/notation"
+	"github.com/sassoftware/relic/v7/lib/oci"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+)
+
+var VerifyNotationCmd = &cobra.Command{
+	Use:   "verify-notation IMAGE...",
+	Short: "Verify Notary Project signatures attached to OCI artifacts in a registry",
+	Long: `Verify the Notary Project signatures attached to OCI artifacts as referrers,
+using a notation trust policy and trust store. By default these are read from
+the notation configuration directory, e.g. ~/.config/notation/trustpolicy.json
+and ~/.config/notation/truststore. An artifact passes if any of its signatures
+passes the trust policy that applies to its repository.`,
+	RunE: verifyNotationCmd,
+}
+
+var (
+	argTrustPolicy   string
+	argTrustStoreDir string
+)
+
+func init() {
+	shared.RootCmd.AddCommand(VerifyNotationCmd)
+	VerifyNotationCmd.Flags().StringVar(&argTrustPolicy, "trust-policy", "", "Path to notation trustpolicy.json")
+	VerifyNotationCmd.Flags().StringVar(&argTrustStoreDir, "trust-store-dir", "", "Path to notation trust store directory")
+	VerifyNotationCmd.Flags().BoolVar(&argInsecureRegistry, "insecure-registry", false, "Talk to the registry over plain HTTP")
+}
+
+func verifyNotationCmd(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		return errors.New("Expected 1 or more images")
+	}
+	if argTrustPolicy == "" || argTrustStoreDir == "" {
+		configDir, err := os.UserConfigDir()
+		if err != nil {
+			return err
+		}
+		if argTrustPolicy == "" {
+			argTrustPolicy = filepath.Join(configDir, "notation", "trustpolicy.json")
+		}
+		if argTrustStoreDir == "" {
+			argTrustStoreDir = filepath.Join(configDir, "notation", "truststore")
+		}
+	}
+	doc, err := notation.LoadPolicy(argTrustPolicy)
+	if err != nil {
+		return err
+	}
+	client := oci.NewClient()
+	client.PlainHTTP = argInsecureRegistry
+	rc := 0
+	for _, image := range args {
+		if err := verifyNotation(client, doc, image); err != nil {
+			fmt.Printf("%s ERROR: %s\n", image, err)
+			rc = 1
+		}
+	}
+	if rc != 0 {
+		fmt.Fprintln(os.Stderr, "ERROR: 1 or more images did not validate")
+	}
+	os.Exit(rc)
+	return nil
+}
+
+func verifyNotation(client *oci.Client, doc *notation.TrustPolicyDocument, name string) error {
+	ctx := context.Background()
+	ref, err := oci.ParseReference(name)
+	if err != nil {
+		return err
+	}
+	policy, err := doc.PolicyFor(ref)
+	if err != nil {
+		return err
+	}
+	if policy.Skipped() {
+		fmt.Printf("%s: SKIPPED - trust policy %q skips verification\n", name, policy.Name)
+		return nil
+	}
+	if ref.Digest == "" {
+		desc, err := client.Resolve(ctx, ref)
+		if err != nil {
+			return err
+		}
+		ref = ref.WithDigest(desc.Digest)
+	}
+	envelopes, err := notation.Fetch(ctx, client, ref)
+	if err != nil {
+		return err
+	}
+	if len(envelopes) == 0 {
+		return errors.New("no signatures found")
+	}
+	var lastErr error
+	for _, env := range envelopes {
+		result, err := policy.Verify(env, ref.Digest, argTrustStoreDir, time.Now())
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		fmt.Printf("%s: OK - %s signed by `%s` [%s]\n", name, ref.Digest, x509tools.FormatSubject(env.Certificates[0]), env.SigningTime)
+		if cs := result.Verified.CounterSignature; cs != nil {
+			fmt.Printf("%s(timestamp): OK - `%s` [%s]\n", name, x509tools.FormatSubject(cs.Certificate), cs.SigningTime)
+		}
+		for _, warning := range result.Warnings {
+			fmt.Printf("%s: WARNING - %s\n", name, warning)
+		}
+		return nil
+	}
+	return fmt.Errorf("none of %d signature(s) passed trust policy %q: %w", len(envelopes), policy.Name, lastErr)
+}
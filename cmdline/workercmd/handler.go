@@ -160,6 +160,15 @@ func (h *handler) handle(rw http.ResponseWriter, req *http.Request) (resp worker
 	switch req.URL.Path {
 	case workerrpc.Ping:
 		return resp, h.token.Ping(ctx)
+	case workerrpc.Health:
+		health, err := h.token.Health(ctx)
+		if err != nil {
+			return resp, err
+		}
+		if health != nil {
+			resp.Value, err = json.Marshal(health)
+		}
+		return resp, err
 	case workerrpc.GetKey:
 		key, err := h.token.GetKey(ctx, rr.KeyName)
 		if err != nil {
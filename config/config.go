@@ -18,14 +18,18 @@ package config
 
 import (
 	"crypto/x509"
+	"encoding/asn1"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"regexp"
 	"strings"
 
 	"gopkg.in/yaml.v3"
 
 	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/sshca"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
 )
 
 const (
@@ -52,26 +56,125 @@ type TokenConfig struct {
 	User       *uint   // User argument for PKCS#11 login (optional)
 	UseKeyring bool    // Read PIN from system keyring
 
+	MaxSessions int    // (pkcs11) Maximum number of sessions to sign with concurrently (default 8)
+	Quirks      string // (pkcs11) Vendor workarounds to apply: cloudhsm, luna, ncipher or none (default is detected from the module)
+
+	// Cloud and network token settings
+	Region   string // (awskms) Region, instead of the SDK default
+	Endpoint string // (awskms, gcpkms) Alternate service endpoint; (azurekv) URL of the vault; (vault, relic, kmip) Server address; (ssh-agent) Socket path
+	Profile  string // (awskms) Shared config profile to use
+	Role     string // (awskms) IAM role ARN to assume; (gcpkms) Service account to impersonate; (vault) AppRole role ID or JWT role
+
+	// Vault settings
+	Namespace  string // (vault) Enterprise namespace
+	AuthMethod string // (vault) token (default), approle or jwt
+	AuthMount  string // (vault) Path the auth method is mounted at, if not the default
+	Mount      string // (vault) Path the transit engine is mounted at (default transit)
+	CaCert     string // (vault, relic, kmip) Path to CA certificates for the server
+	CertFile   string // (relic, kmip) Path to TLS client certificate
+	KeyFile    string // (relic, kmip) Path to TLS client key
+
+	KMIPVersion string // (kmip) Protocol version to speak (default 1.4)
+
+	SRK string // (tpm2) Persistent handle of the storage key new keys are created under (default 0x81000001)
+
+	ManagementKey string // (piv) Management key in hex, needed to generate keys and import certificates
+
 	name string
 }
 
 type KeyConfig struct {
-	Token           string   // Token section to use for this key (linux)
-	Alias           string   // This is an alias for another key
-	Label           string   // Select a key by label
-	ID              string   // Select a key by ID (hex notation)
-	PgpCertificate  string   // Path to PGP certificate associated with this key
-	X509Certificate string   // Path to X.509 certificate associated with this key
-	KeyFile         string   // For "file" tokens, path to the private key
-	IsPkcs12        bool     // If true, key file contains PKCS#12 key and certificate chain
-	Roles           []string // List of user roles that can use this key
-	Timestamp       bool     // If true, attach a timestamped countersignature when possible
-	Hide            bool     // If true, then omit this key from 'remote list-keys'
+	Token            string   // Token section to use for this key (linux)
+	Alias            string   // This is an alias for another key
+	Versions         []string // Keys that are successive versions of this logical key, oldest first. Signing uses the newest.
+	Label            string   // Select a key by label
+	ID               string   // Select a key by ID (hex notation)
+	PgpCertificate   string   // Path to PGP certificate associated with this key
+	X509Certificate  string   // Path to X.509 certificate associated with this key
+	X509Roots        string   // Path to trusted root certificates used to select the X.509 certificate chain
+	CrossCertificate string   // Path to a cross-certificate to embed in Authenticode signatures
+	ApkLineage       string   // Path to an APK signing certificate lineage ending with this key's certificate, for v3 signatures
+	KeyFile          string   // For "file" tokens, path to the private key
+	IsPkcs12         bool     // If true, key file contains PKCS#12 key and certificate chain
+	KeyShares        []string // For "file" tokens, paths to the shares of a sealed key split among custodians (default KEYFILE.share-*)
+	Roles            []string // List of user roles that can use this key
+	Timestamp        bool     // If true, attach a timestamped countersignature when possible
+	OCSP             string   // Check revocation status of the certificate chain via OCSP before signing: soft or hard
+	OCSPStaple       bool     // If true, embed OCSP responses into the signature when possible
+	Hide             bool     // If true, then omit this key from 'remote list-keys'
+	Attestation      string   // Path to a hardware attestation certificate for the key, followed by any intermediates
+	AttestationRoots string   // Path to the device vendor's attestation root certificates
+	PCRs             []int    // (tpm2) Bind use of the key to the current values of these SHA-256 PCRs
+	PINPolicy        string   // (piv) PIN policy for generated keys: never, once or always
+	TouchPolicy      string   // (piv) Touch policy for generated keys: never, cached or always
+	Mechanism        string   // (pkcs11) Signing mechanism to use instead of the default, by name (e.g. CKM_RSA_PKCS_PSS) or number
+	MGF              string   // (pkcs11) Mask generation function for RSA-PSS, if the token requires one that doesn't match the digest
+	Signer           string   // (threshold) Key that produces the signature once approved
+	Approvers        []string // (threshold) Keys whose holders approve each signature
+	Threshold        int      // (threshold) Number of approvals required (default all)
+
+	Policy *KeyPolicyConfig // Optional checks on the certificate, applied before signing
+	Issuer *IssuerConfig    // Optional CA to request a short-lived certificate from at signing time
+	Enroll *IssuerConfig    // Optional CA to enroll the key's stored certificate with via "relic token enroll"
+	SSHCA  *sshca.Policy    // Allows the key to issue SSH certificates within these limits
+
+	TransparencyLog     string // Optional Rekor URL to record signatures made with "relic sign" in
+	TransparencyLogKind string // Rekor entry kind to record: hashedrekord (default), dsse or intoto
 
 	name  string
 	token *TokenConfig
 }
 
+// KeyPolicyConfig describes requirements that the signing certificate must
+// meet. Signing is refused if any of them are not met.
+type KeyPolicyConfig struct {
+	RequireEKU         []string // Extended key usages the certificate must have, by name (e.g. codeSigning) or OID
+	SubjectPattern     string   // Regular expression that the certificate subject must match
+	MinRSABits         int      // Minimum RSA key size
+	MinECBits          int      // Minimum elliptic curve size
+	RequireHardwareKey bool     // Key must have a verified attestation showing it was generated in hardware and cannot be exported
+
+	subject    *regexp.Regexp
+	requireEKU []asn1.ObjectIdentifier
+}
+
+// IssuerConfig describes a CA that issues short-lived certificates for a key
+// at signing time, instead of using a certificate stored on disk
+type IssuerConfig struct {
+	Type        string   // "http" (default), "est", "ejbca", "keyfactor" or "fulcio"
+	URL         string   // CA endpoint, or the EST base URL
+	CommonName  string   // Subject common name to request, default is the key name
+	DNSNames    []string // Optional DNS subject alternative names to request
+	Lifetime    int      // Requested certificate lifetime in seconds (http only)
+	RenewBefore int      // Request a new certificate when fewer than N seconds remain, default is half its lifetime
+	Timeout     int      // Request timeout in seconds
+	CaCert      string   // Path to CA certificate for the issuer's TLS
+	CertFile    string   // Optional TLS client certificate
+	KeyFile     string   // Optional TLS client key
+	Username    string   // Optional HTTP basic auth
+	Password    string
+	BearerToken string // Optional bearer token, if no username is set
+
+	CAName           string // (ejbca, keyfactor) Name of the issuing CA
+	Profile          string // (ejbca) Certificate profile name, (keyfactor) template name
+	EndEntityProfile string // (ejbca) End entity profile name
+	EndEntity        string // (ejbca) End entity username, default is the common name
+	EnrollmentCode   string // (ejbca) End entity enrollment code
+
+	IdentityToken string // (fulcio) Source of the OIDC identity token: github, gitlab, env:NAME or a file path (default detects the CI system)
+	Audience      string // (fulcio) Audience to request for the identity token (default sigstore)
+}
+
+// SubjectRegexp returns the compiled SubjectPattern, or nil if none is set
+func (p *KeyPolicyConfig) SubjectRegexp() *regexp.Regexp {
+	return p.subject
+}
+
+// RequiredEKUs returns the parsed RequireEKU OIDs
+func (p *KeyPolicyConfig) RequiredEKUs() []asn1.ObjectIdentifier {
+	return p.requireEKU
+}
+
 type ServerConfig struct {
 	Listen     string // Port to listen for TLS connections
 	ListenHTTP string // Port to listen for plaintext connections
@@ -91,6 +194,16 @@ type ServerConfig struct {
 	TokenCheckTimeout  int
 	TokenCacheSeconds  int
 
+	// Seconds between checks for a replaced TLS certificate or key. Negative
+	// disables reloading.
+	CertReloadInterval int
+
+	// Certificates expiring within these many days are reported as a
+	// warning or critical by the /expiry endpoint and in the log
+	ExpiryWarningDays   int
+	ExpiryCriticalDays  int
+	ExpiryCheckInterval int // Seconds between logging expiry checks. Negative disables.
+
 	ReadHeaderTimeout int
 	ReadTimeout       int
 	WriteTimeout      int
@@ -103,6 +216,10 @@ type ServerConfig struct {
 	// IP networks of trusted reverse proxies that can front this service
 	TrustedProxies []string
 
+	// Serve raw signing operations over gRPC so that other relic servers can
+	// use keys on this one with a "relic" token
+	TokenRPC bool
+
 	AzureAD *ServerAzureConfig
 }
 
@@ -151,6 +268,14 @@ type AmqpConfig struct {
 	SigsXchg string // Name of exchange to send to (default relic.signatures)
 }
 
+type NotaryConfig struct {
+	KeyID        string // App Store Connect API key ID
+	IssuerID     string // App Store Connect issuer ID
+	KeyFile      string // Path to the API private key (AuthKey_XXXX.p8)
+	Timeout      int    // Give up waiting for a submission after this many seconds
+	PollInterval int    // Seconds between submission status checks
+}
+
 type Config struct {
 	Tokens    map[string]*TokenConfig  `yaml:",omitempty"`
 	Keys      map[string]*KeyConfig    `yaml:",omitempty"`
@@ -159,6 +284,7 @@ type Config struct {
 	Remote    *RemoteConfig            `yaml:",omitempty"`
 	Timestamp *TimestampConfig         `yaml:",omitempty"`
 	Amqp      *AmqpConfig              `yaml:",omitempty"`
+	Notary    *NotaryConfig            `yaml:",omitempty"`
 
 	PinFile string `yaml:",omitempty"` // Optional YAML file with additional token PINs
 
@@ -226,6 +352,48 @@ func (config *Config) Normalize(path string) error {
 		if keyConf.Token != "" {
 			keyConf.token = config.Tokens[keyConf.Token]
 		}
+		for _, version := range keyConf.Versions {
+			if keyConf.Token != "" || keyConf.Alias != "" {
+				return fmt.Errorf("key %s: a key with versions can't also set token or alias", keyName)
+			}
+			vconf := config.Keys[version]
+			if vconf == nil {
+				return fmt.Errorf("key %s: version %s is not defined", keyName, version)
+			} else if vconf.Alias != "" || len(vconf.Versions) != 0 {
+				return fmt.Errorf("key %s: version %s must be a plain key, not an alias or versioned key", keyName, version)
+			}
+		}
+		for _, iss := range []struct {
+			name string
+			conf *IssuerConfig
+		}{{"issuer", keyConf.Issuer}, {"enroll", keyConf.Enroll}} {
+			if iss.conf == nil {
+				continue
+			}
+			if iss.conf.URL == "" {
+				return fmt.Errorf("key %s: %s.url must be set", keyName, iss.name)
+			}
+			if iss.conf.Timeout == 0 {
+				iss.conf.Timeout = 60
+			}
+		}
+		if p := keyConf.Policy; p != nil {
+			if p.SubjectPattern != "" {
+				re, err := regexp.Compile(p.SubjectPattern)
+				if err != nil {
+					return fmt.Errorf("key %s: invalid subjectpattern: %w", keyName, err)
+				}
+				p.subject = re
+			}
+			p.requireEKU = nil
+			for _, name := range p.RequireEKU {
+				oid, err := x509tools.ParseExtKeyUsage(name)
+				if err != nil {
+					return fmt.Errorf("key %s: invalid requireeku: %w", keyName, err)
+				}
+				p.requireEKU = append(p.requireEKU, oid)
+			}
+		}
 	}
 	if s := config.Server; s != nil {
 		if s.TokenCheckInterval == 0 {
@@ -240,6 +408,18 @@ func (config *Config) Normalize(path string) error {
 		if s.TokenCacheSeconds == 0 {
 			s.TokenCacheSeconds = 600
 		}
+		if s.ExpiryWarningDays == 0 {
+			s.ExpiryWarningDays = 30
+		}
+		if s.ExpiryCriticalDays == 0 {
+			s.ExpiryCriticalDays = 7
+		}
+		if s.ExpiryCheckInterval == 0 {
+			s.ExpiryCheckInterval = 3600
+		}
+		if s.CertReloadInterval == 0 {
+			s.CertReloadInterval = 60
+		}
 		if s.ReadHeaderTimeout == 0 {
 			s.ReadHeaderTimeout = 10
 		}
@@ -291,12 +471,45 @@ func (config *Config) GetKey(keyName string) (*KeyConfig, error) {
 			return nil, fmt.Errorf("Alias \"%s\" points to undefined key \"%s\"", keyName, keyConf.Alias)
 		}
 	}
+	if n := len(keyConf.Versions); n != 0 {
+		newest := keyConf.Versions[n-1]
+		keyConf, ok = config.Keys[newest]
+		if !ok {
+			return nil, fmt.Errorf("Key \"%s\" has undefined version \"%s\"", keyName, newest)
+		}
+	}
 	if keyConf.Token == "" {
 		return nil, fmt.Errorf("Key \"%s\" does not specify required value 'token'", keyName)
 	}
 	return keyConf, nil
 }
 
+// KeyVersions returns every version of a logical key, oldest first. A key
+// without versions is its own only version.
+func (config *Config) KeyVersions(keyName string) ([]*KeyConfig, error) {
+	keyConf, ok := config.Keys[keyName]
+	if !ok {
+		return nil, fmt.Errorf("Key \"%s\" not found in configuration", keyName)
+	} else if keyConf.Alias != "" {
+		keyName = keyConf.Alias
+		keyConf, ok = config.Keys[keyName]
+		if !ok {
+			return nil, fmt.Errorf("Alias points to undefined key \"%s\"", keyName)
+		}
+	}
+	if len(keyConf.Versions) == 0 {
+		return []*KeyConfig{keyConf}, nil
+	}
+	versions := make([]*KeyConfig, len(keyConf.Versions))
+	for i, name := range keyConf.Versions {
+		versions[i], ok = config.Keys[name]
+		if !ok {
+			return nil, fmt.Errorf("Key \"%s\" has undefined version \"%s\"", keyName, name)
+		}
+	}
+	return versions, nil
+}
+
 func (config *Config) NewKey(name string) *KeyConfig {
 	if config.Keys == nil {
 		config.Keys = make(map[string]*KeyConfig)
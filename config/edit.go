@@ -0,0 +1,114 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/sassoftware/relic/v7/lib/atomicfile"
+)
+
+// SetKeyOption sets a single option of a key by editing the configuration
+// file in place, preserving comments
+func SetKeyOption(path, keyName, option, value string) error {
+	doc, _, key, err := loadForEdit(path, keyName)
+	if err != nil {
+		return err
+	}
+	if node := mapValue(key, option); node != nil {
+		*node = *scalarNode(value)
+	} else {
+		key.Content = append(key.Content, scalarNode(option), scalarNode(value))
+	}
+	return writeEdited(path, doc, keyName)
+}
+
+// load the configuration as a node tree and find the named key
+func loadForEdit(path, keyName string) (doc, keys, key *yaml.Node, err error) {
+	blob, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	doc = new(yaml.Node)
+	if err := yaml.Unmarshal(blob, doc); err != nil {
+		return nil, nil, nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil, nil, errors.New("configuration is empty")
+	}
+	keys = mapValue(doc.Content[0], "keys")
+	if keys == nil {
+		return nil, nil, nil, errors.New("configuration has no keys section")
+	}
+	key = mapValue(keys, keyName)
+	if key == nil || key.Kind != yaml.MappingNode {
+		return nil, nil, nil, fmt.Errorf("key %q not found in configuration", keyName)
+	}
+	return doc, keys, key, nil
+}
+
+// write an edited configuration back, but only if it still loads
+func writeEdited(path string, doc *yaml.Node, keyName string) error {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	// make sure the result still loads before replacing the file
+	check := new(Config)
+	if err := yaml.Unmarshal(buf.Bytes(), check); err != nil {
+		return err
+	}
+	if err := check.Normalize(path); err != nil {
+		return err
+	}
+	if _, err := check.GetKey(keyName); err != nil {
+		return err
+	}
+	// the configuration holds PINs and credentials, so keep its permissions
+	mode := os.FileMode(0600)
+	if st, err := os.Stat(path); err == nil {
+		mode = st.Mode().Perm()
+	}
+	return atomicfile.WriteFileMode(path, buf.Bytes(), mode)
+}
+
+// find the value for a key in a mapping node
+func mapValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func scalarNode(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+}
@@ -45,5 +45,12 @@ func FromEnvironment() (*Config, error) {
 			CaCert:       os.Getenv("RELIC_CACERT"),
 		},
 	}
+	if keyID := os.Getenv("RELIC_NOTARY_KEY_ID"); keyID != "" {
+		cfg.Notary = &NotaryConfig{
+			KeyID:    keyID,
+			IssuerID: os.Getenv("RELIC_NOTARY_ISSUER_ID"),
+			KeyFile:  os.Getenv("RELIC_NOTARY_KEY"),
+		}
+	}
 	return cfg, cfg.Normalize("<env>")
 }
@@ -0,0 +1,64 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package config
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RotateKey makes newVersion the newest version of a logical key by editing
+// the configuration file in place, preserving comments. A plain key is first
+// converted to a versioned key, with its current settings moved to a key named
+// NAME-v1. The file is only replaced if the result is a valid configuration.
+func RotateKey(path, keyName, newVersion string) error {
+	doc, keys, key, err := loadForEdit(path, keyName)
+	if err != nil {
+		return err
+	}
+	if mapValue(keys, newVersion) == nil {
+		return fmt.Errorf("key %q not found in configuration", newVersion)
+	}
+	if versions := mapValue(key, "versions"); versions != nil {
+		for _, node := range versions.Content {
+			if node.Value == newVersion {
+				return fmt.Errorf("%q is already a version of key %q", newVersion, keyName)
+			}
+		}
+		versions.Content = append(versions.Content, scalarNode(newVersion))
+		versions.Style = 0
+	} else {
+		if mapValue(key, "alias") != nil {
+			return fmt.Errorf("key %q is an alias and can't be rotated", keyName)
+		}
+		oldVersion := keyName + "-v1"
+		for n := 2; mapValue(keys, oldVersion) != nil; n++ {
+			oldVersion = fmt.Sprintf("%s-v%d", keyName, n)
+		}
+		moved := *key
+		keys.Content = append(keys.Content, scalarNode(oldVersion), &moved)
+		*key = yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Content: []*yaml.Node{
+			scalarNode("versions"),
+			{Kind: yaml.SequenceNode, Tag: "!!seq", Content: []*yaml.Node{
+				scalarNode(oldVersion),
+				scalarNode(newVersion),
+			}},
+		}}
+	}
+	return writeEdited(path, doc, keyName)
+}
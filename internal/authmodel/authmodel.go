@@ -23,6 +23,9 @@ type UserInfo interface {
 	// AuditContext amends an audit record with the authenticated user's name
 	// and other relevant details
 	AuditContext(info *audit.Info)
+	// Caller returns the user's name and roles, for signers whose policy
+	// depends on who is asking
+	Caller() (name string, roles []string)
 }
 
 // New creates an authenticator based on the provided server configuration
@@ -62,7 +65,13 @@ func Middleware(a Authenticator) func(http.Handler) http.Handler {
 
 // RequestInfo returns information about the calling user
 func RequestInfo(req *http.Request) UserInfo {
-	info, ok := req.Context().Value(ctxKeyUserInfo).(UserInfo)
+	return ContextInfo(req.Context())
+}
+
+// ContextInfo returns information about the calling user from a request
+// context
+func ContextInfo(ctx context.Context) UserInfo {
+	info, ok := ctx.Value(ctxKeyUserInfo).(UserInfo)
 	if !ok {
 		// middleware should guarantee this is always present, otherwise
 		// something is seriously wrong
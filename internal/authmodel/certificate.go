@@ -67,6 +67,7 @@ func (a *CertificateAuth) Authenticate(req *http.Request) (UserInfo, error) {
 	}
 	if useDN {
 		user.Subject = formatSubject(cert)
+		user.CommonName = cert.Subject.CommonName
 	}
 	// amend access log with user info
 	zhttp.AppendAccessLog(req, func(e *zerolog.Event) {
@@ -79,9 +80,10 @@ func (a *CertificateAuth) Authenticate(req *http.Request) (UserInfo, error) {
 }
 
 type CertificateInfo struct {
-	Name    string
-	Subject string
-	Roles   []string
+	Name       string
+	Subject    string
+	CommonName string
+	Roles      []string
 }
 
 func (c *CertificateInfo) AuditContext(info *audit.Info) {
@@ -91,6 +93,16 @@ func (c *CertificateInfo) AuditContext(info *audit.Info) {
 	}
 }
 
+// Caller returns the client's nickname, or for clients authenticated by a CA
+// the common name of its certificate, since the nickname is shared by all of
+// them
+func (c *CertificateInfo) Caller() (string, []string) {
+	if c.CommonName != "" {
+		return c.CommonName, c.Roles
+	}
+	return c.Name, c.Roles
+}
+
 func (c *CertificateInfo) Allowed(keyConf *config.KeyConfig) bool {
 	for _, keyRole := range keyConf.Roles {
 		for _, clientRole := range c.Roles {
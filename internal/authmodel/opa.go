@@ -150,6 +150,11 @@ func (i *PolicyInfo) AuditContext(info *audit.Info) {
 	}
 }
 
+// Caller returns the token subject and the roles granted by the policy
+func (i *PolicyInfo) Caller() (string, []string) {
+	return i.Subject, i.Roles
+}
+
 type policyRequest struct {
 	Input policyInput `json:"input"`
 }
@@ -0,0 +1,181 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package signinit
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/sassoftware/relic/v7/config"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+)
+
+var (
+	chainsMu sync.Mutex
+	chains   = make(map[string]orderedChain)
+)
+
+// orderedChain remembers the path chosen for a key's certificate bundle. It is
+// reused until the bundle or the roots file changes, or until one of the
+// certificates becomes valid or expires.
+type orderedChain struct {
+	bundle   [sha256.Size]byte
+	rootsMod time.Time
+	until    time.Time
+	certs    []*x509.Certificate
+}
+
+// Arrange the certificate chain into a path to one of the key's configured
+// roots, or the best available path if none are configured
+func orderChain(cert *certloader.Certificate, kconf *config.KeyConfig) error {
+	if cert.Leaf == nil {
+		return nil
+	}
+	now := time.Now()
+	var rootsMod time.Time
+	if kconf.X509Roots != "" {
+		st, err := os.Stat(kconf.X509Roots)
+		if err != nil {
+			return err
+		}
+		rootsMod = st.ModTime()
+	}
+	d := sha256.New()
+	for _, c := range cert.Certificates {
+		d.Write(c.Raw)
+	}
+	var bundle [sha256.Size]byte
+	copy(bundle[:], d.Sum(nil))
+	chainsMu.Lock()
+	cached, ok := chains[kconf.Name()]
+	chainsMu.Unlock()
+	if ok && cached.bundle == bundle && cached.rootsMod.Equal(rootsMod) && now.Before(cached.until) {
+		cert.Certificates = append([]*x509.Certificate(nil), cached.certs...)
+		return nil
+	}
+
+	var roots []*x509.Certificate
+	if kconf.X509Roots != "" {
+		blob, err := os.ReadFile(kconf.X509Roots)
+		if err != nil {
+			return err
+		}
+		roots, err = certloader.ParseX509Certificates(blob)
+		if err != nil {
+			return fmt.Errorf("key %q: loading roots: %w", kconf.Name(), err)
+		}
+	}
+	until := nextValidityChange(cert.Certificates, now)
+	expired, err := cert.OrderChain(roots)
+	if err != nil {
+		return fmt.Errorf("key %q: %w", kconf.Name(), err)
+	}
+	for _, c := range expired {
+		log.Warn().Str("key", kconf.Name()).
+			Str("certificate", x509tools.FormatSubject(c)).
+			Time("not_after", c.NotAfter).
+			Msg("certificate chain includes a certificate that is not currently valid")
+	}
+	chainsMu.Lock()
+	chains[kconf.Name()] = orderedChain{
+		bundle:   bundle,
+		rootsMod: rootsMod,
+		until:    until,
+		certs:    append([]*x509.Certificate(nil), cert.Certificates...),
+	}
+	chainsMu.Unlock()
+	return nil
+}
+
+// KeyChain returns the certificate chain that a key signs with, leaf first,
+// without opening its token or requesting a certificate from its issuer. The
+// configured certificate file is read if there is one, otherwise the last
+// certificate issued for the key or the chain from the last time the key was
+// used. Nil is returned if none of these are available yet.
+func KeyChain(kconf *config.KeyConfig) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	switch {
+	case kconf.Issuer != nil:
+		issuedMu.Lock()
+		certs = issued[kconf.Name()]
+		issuedMu.Unlock()
+	case kconf.X509Certificate != "":
+		blob, err := os.ReadFile(kconf.X509Certificate)
+		if err != nil {
+			return nil, err
+		}
+		certs, err = certloader.ParseX509Certificates(blob)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", kconf.Name(), err)
+		}
+		if len(certs) != 0 {
+			return x509tools.BuildChain(bundleLeaf(certs), certs), nil
+		}
+	default:
+		chainsMu.Lock()
+		certs = chains[kconf.Name()].certs
+		chainsMu.Unlock()
+	}
+	if len(certs) == 0 {
+		return nil, nil
+	}
+	return x509tools.BuildChain(certs[0], certs), nil
+}
+
+// Without the key to match against, the leaf is the certificate that didn't
+// issue any of the others
+func bundleLeaf(certs []*x509.Certificate) *x509.Certificate {
+	for _, cert := range certs {
+		issuer := false
+		for _, other := range certs {
+			if other != cert && bytes.Equal(other.RawIssuer, cert.RawSubject) {
+				issuer = true
+				break
+			}
+		}
+		if !issuer {
+			return cert
+		}
+	}
+	return certs[0]
+}
+
+// Find the next time that any certificate in the bundle becomes valid or
+// expires, which might change the preferred path
+func nextValidityChange(certs []*x509.Certificate, now time.Time) time.Time {
+	var next time.Time
+	for _, cert := range certs {
+		for _, t := range []time.Time{cert.NotBefore, cert.NotAfter} {
+			if t.After(now) && (next.IsZero() || t.Before(next)) {
+				next = t
+			}
+		}
+	}
+	if next.IsZero() {
+		// everything has already expired
+		next = now.Add(time.Hour)
+	}
+	return next
+}
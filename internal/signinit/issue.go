@@ -0,0 +1,126 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package signinit
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"github.com/sassoftware/relic/v7/config"
+	"github.com/sassoftware/relic/v7/lib/certissue"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+	"github.com/sassoftware/relic/v7/token"
+)
+
+var (
+	issuedMu sync.Mutex
+	issued   = make(map[string][]*x509.Certificate)
+	issuers  = make(map[*config.IssuerConfig]certissue.Issuer)
+	// concurrent signing requests for the same key share one issuance
+	issuing singleflight.Group
+)
+
+// Get a certificate chain for the key from its configured issuer. A
+// previously issued certificate is reused until it is due for renewal.
+func issueCertificate(ctx context.Context, key token.Key, kconf *config.KeyConfig) ([]byte, error) {
+	certs := cachedIssued(key, kconf, time.Now())
+	if certs == nil {
+		v, err, _ := issuing.Do(kconf.Name(), func() (interface{}, error) {
+			// another request may have finished issuing in the meantime
+			if certs := cachedIssued(key, kconf, time.Now()); certs != nil {
+				return certs, nil
+			}
+			return requestCertificate(ctx, key, kconf)
+		})
+		if err != nil {
+			return nil, err
+		}
+		certs = v.([]*x509.Certificate)
+	}
+	var der []byte
+	for _, cert := range certs {
+		der = append(der, cert.Raw...)
+	}
+	return der, nil
+}
+
+// Return the previously issued chain for the key, or nil if there is none or
+// it needs to be renewed
+func cachedIssued(key token.Key, kconf *config.KeyConfig, now time.Time) []*x509.Certificate {
+	issuedMu.Lock()
+	certs := issued[kconf.Name()]
+	issuedMu.Unlock()
+	if len(certs) == 0 || !x509tools.SameKey(certs[0].PublicKey, key) || needsRenewal(certs[0], kconf.Issuer, now) {
+		return nil
+	}
+	return certs
+}
+
+func requestCertificate(ctx context.Context, key token.Key, kconf *config.KeyConfig) ([]*x509.Certificate, error) {
+	issuer, err := getIssuer(kconf.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("key %q: %w", kconf.Name(), err)
+	}
+	csr, err := certissue.CreateRequest(kconf.Issuer, key, kconf.Name())
+	if err != nil {
+		return nil, fmt.Errorf("key %q: creating certificate request: %w", kconf.Name(), err)
+	}
+	certs, err := issuer.Issue(ctx, csr)
+	if err != nil {
+		return nil, fmt.Errorf("key %q: %w", kconf.Name(), err)
+	}
+	if len(certs) == 0 || !x509tools.SameKey(certs[0].PublicKey, key) {
+		return nil, fmt.Errorf("key %q: issued certificate does not match the key", kconf.Name())
+	}
+	now := time.Now()
+	if now.Before(certs[0].NotBefore) || now.After(certs[0].NotAfter) {
+		return nil, fmt.Errorf("key %q: issued certificate is not currently valid", kconf.Name())
+	}
+	issuedMu.Lock()
+	issued[kconf.Name()] = certs
+	issuedMu.Unlock()
+	return certs, nil
+}
+
+// Get the issuer for a configuration, reusing its HTTP client and connections
+// across issuances
+func getIssuer(conf *config.IssuerConfig) (certissue.Issuer, error) {
+	issuedMu.Lock()
+	defer issuedMu.Unlock()
+	if issuer := issuers[conf]; issuer != nil {
+		return issuer, nil
+	}
+	issuer, err := certissue.New(conf)
+	if err != nil {
+		return nil, err
+	}
+	issuers[conf] = issuer
+	return issuer, nil
+}
+
+func needsRenewal(leaf *x509.Certificate, conf *config.IssuerConfig, now time.Time) bool {
+	renewBefore := time.Duration(conf.RenewBefore) * time.Second
+	if renewBefore <= 0 {
+		renewBefore = leaf.NotAfter.Sub(leaf.NotBefore) / 2
+	}
+	return now.Add(renewBefore).After(leaf.NotAfter)
+}
@@ -0,0 +1,184 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package signinit
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sassoftware/relic/v7/config"
+	"github.com/sassoftware/relic/v7/lib/attestation"
+	"github.com/sassoftware/relic/v7/lib/audit"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+	"github.com/sassoftware/relic/v7/token"
+)
+
+// Check the signing certificate against the key's policy so that signing is
+// refused up front rather than producing a signature that verifiers reject
+func checkPolicy(cert *certloader.Certificate, kconf *config.KeyConfig, now time.Time) error {
+	policy := kconf.Policy
+	if policy == nil || cert.Leaf == nil {
+		return nil
+	}
+	if err := policyViolation(cert, policy, now); err != nil {
+		return token.KeyUsageError{
+			Key: kconf.Name(),
+			Err: fmt.Errorf("certificate does not meet key policy: %w", err),
+		}
+	}
+	return nil
+}
+
+// CheckKey applies the key's policy, attestation and revocation checks to a use
+// of the key that doesn't go through Init, such as signing a raw digest for
+// another server. Without a certificate the policy can't be checked, so keys
+// with a policy are refused.
+func CheckKey(ctx context.Context, key token.Key, auditInfo *audit.Info) error {
+	kconf := key.Config()
+	cert, _, err := keyCertificates(ctx, key, kconf.Name())
+	if err != nil {
+		return err
+	}
+	if cert.Leaf != nil {
+		auditInfo.SetX509Cert(cert.Leaf)
+	} else if kconf.Policy != nil {
+		return token.KeyUsageError{
+			Key: kconf.Name(),
+			Err: errors.New("key policy can't be checked without a certificate"),
+		}
+	}
+	if err := checkPolicy(cert, kconf, time.Now().UTC()); err != nil {
+		return err
+	}
+	if err := checkAttestation(ctx, cert, kconf, auditInfo); err != nil {
+		return err
+	}
+	return checkRevocation(ctx, cert, kconf)
+}
+
+func policyViolation(cert *certloader.Certificate, policy *config.KeyPolicyConfig, now time.Time) error {
+	leaf := cert.Leaf
+	if now.Before(leaf.NotBefore) {
+		return fmt.Errorf("certificate is not valid until %s", leaf.NotBefore)
+	} else if now.After(leaf.NotAfter) {
+		return fmt.Errorf("certificate expired at %s", leaf.NotAfter)
+	}
+	if required := policy.RequiredEKUs(); len(required) != 0 {
+		ekus, err := x509tools.CertificateEKUs(leaf)
+		if err != nil {
+			return err
+		}
+		for i, oid := range required {
+			found := false
+			for _, eku := range ekus {
+				if eku.Equal(oid) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("extended key usage %s is missing", policy.RequireEKU[i])
+			}
+		}
+	}
+	if re := policy.SubjectRegexp(); re != nil {
+		subject := x509tools.FormatSubject(leaf)
+		if !re.MatchString(subject) {
+			return fmt.Errorf("subject %q does not match pattern %q", subject, policy.SubjectPattern)
+		}
+	}
+	switch pub := leaf.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if bits := pub.N.BitLen(); bits < policy.MinRSABits {
+			return fmt.Errorf("RSA key size %d is smaller than the minimum of %d", bits, policy.MinRSABits)
+		}
+	case *ecdsa.PublicKey:
+		if bits := pub.Curve.Params().BitSize; bits < policy.MinECBits {
+			return fmt.Errorf("elliptic curve size %d is smaller than the minimum of %d", bits, policy.MinECBits)
+		}
+	case nil:
+		return errors.New("certificate has no public key")
+	}
+	return nil
+}
+
+// Verify the key's hardware attestation, if one is configured, and record the
+// result in the audit log
+func checkAttestation(ctx context.Context, cert *certloader.Certificate, kconf *config.KeyConfig, auditInfo *audit.Info) error {
+	requireHW := kconf.Policy != nil && kconf.Policy.RequireHardwareKey
+	// only ask the device when there are roots to verify its answer against
+	_, canAttest := cert.PrivateKey.(token.Attester)
+	canAttest = canAttest && kconf.AttestationRoots != ""
+	if kconf.Attestation == "" && !canAttest {
+		if requireHW {
+			return token.KeyUsageError{
+				Key: kconf.Name(),
+				Err: errors.New("key policy requires a hardware attestation but none is configured"),
+			}
+		}
+		return nil
+	}
+	att, err := loadAttestation(ctx, cert, kconf)
+	if err != nil {
+		return token.KeyUsageError{Key: kconf.Name(), Err: err}
+	}
+	if requireHW && !att.HardwareBacked() {
+		return token.KeyUsageError{
+			Key: kconf.Name(),
+			Err: fmt.Errorf("key policy requires a hardware key but %s reports it is generated=%t exportable=%t", att, att.Generated, att.Exportable),
+		}
+	}
+	auditInfo.SetAttestation(att)
+	return nil
+}
+
+func loadAttestation(ctx context.Context, cert *certloader.Certificate, kconf *config.KeyConfig) (*attestation.Attestation, error) {
+	signer := cert.Signer()
+	if signer == nil {
+		return nil, errors.New("no key to attest")
+	}
+	var blob []byte
+	var err error
+	if kconf.Attestation != "" {
+		blob, err = os.ReadFile(kconf.Attestation)
+	} else {
+		// ask the device
+		blob, err = signer.(token.Attester).Attest(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var roots []*x509.Certificate
+	if kconf.AttestationRoots != "" {
+		rootBlob, err := os.ReadFile(kconf.AttestationRoots)
+		if err != nil {
+			return nil, err
+		}
+		roots, err = certloader.ParseX509Certificates(rootBlob)
+		if err != nil {
+			return nil, fmt.Errorf("attestationroots: %w", err)
+		}
+	}
+	return attestation.Verify(blob, roots, signer.Public())
+}
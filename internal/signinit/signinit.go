@@ -20,12 +20,14 @@ import (
 	"context"
 	"crypto"
 	"fmt"
+	"os"
 	"time"
 
 	"github.com/sassoftware/relic/v7/cmdline/shared"
 	"github.com/sassoftware/relic/v7/config"
 	"github.com/sassoftware/relic/v7/lib/audit"
 	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
 	"github.com/sassoftware/relic/v7/signers"
 	"github.com/sassoftware/relic/v7/signers/sigerrors"
 	"github.com/sassoftware/relic/v7/token"
@@ -37,13 +39,46 @@ func InitKey(ctx context.Context, tok token.Token, keyName string) (*certloader.
 	if err != nil {
 		return nil, nil, err
 	}
+	return keyCertificates(ctx, key, keyName)
+}
+
+func keyCertificates(ctx context.Context, key token.Key, keyName string) (*certloader.Certificate, *config.KeyConfig, error) {
+	var err error
 	kconf := key.Config()
+	x509cert, x509contents := kconf.X509Certificate, key.Certificate()
+	if kconf.Issuer != nil {
+		// get a fresh certificate from the CA instead
+		x509cert = ""
+		x509contents, err = issueCertificate(ctx, key, kconf)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
 	// parse certificates
-	cert, err := certloader.LoadTokenCertificates(key, kconf.X509Certificate, kconf.PgpCertificate, key.Certificate())
+	cert, err := certloader.LoadTokenCertificates(key, x509cert, kconf.PgpCertificate, x509contents)
 	if err != nil {
 		return nil, nil, err
 	}
 	cert.KeyName = keyName
+	if err := orderChain(cert, kconf); err != nil {
+		return nil, nil, err
+	}
+	if kconf.CrossCertificate != "" {
+		blob, err := os.ReadFile(kconf.CrossCertificate)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := cert.SetCrossCertificate(blob); err != nil {
+			return nil, nil, fmt.Errorf("key %q: %w", kconf.Name(), err)
+		}
+	}
+	cert.SSHCAPolicy = kconf.SSHCA
+	if kconf.ApkLineage != "" {
+		cert.ApkLineage, err = os.ReadFile(kconf.ApkLineage)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
 	return cert, kconf, nil
 }
 
@@ -68,6 +103,15 @@ func Init(ctx context.Context, mod *signers.Signer, tok token.Token, keyName str
 	} else if mod.CertTypes&signers.CertTypePgp != 0 {
 		return nil, nil, sigerrors.ErrNoCertificate{Type: "pgp"}
 	}
+	if err := checkPolicy(cert, kconf, now); err != nil {
+		return nil, nil, err
+	}
+	if err := checkAttestation(ctx, cert, kconf, auditInfo); err != nil {
+		return nil, nil, err
+	}
+	if err := checkRevocation(ctx, cert, kconf); err != nil {
+		return nil, nil, err
+	}
 	if kconf.Timestamp {
 		cert.Timestamper, err = GetTimestamper()
 		if err != nil {
@@ -93,3 +137,28 @@ func PublishAudit(info *audit.Info) error {
 	}
 	return nil
 }
+
+// OCSP responses for signing certificates, reused until they expire
+var ocspCache = new(x509tools.OCSPCache)
+
+// Check the revocation status of the signing certificate chain according to
+// the key's configured policy, saving the responses for embedding if desired
+func checkRevocation(ctx context.Context, cert *certloader.Certificate, kconf *config.KeyConfig) error {
+	policy, err := x509tools.ParseRevocationPolicy(kconf.OCSP)
+	if err != nil {
+		return fmt.Errorf("key %q: %w", kconf.Name(), err)
+	}
+	if policy == x509tools.RevocationNone || cert.Leaf == nil {
+		return nil
+	}
+	results, err := ocspCache.Check(ctx, cert.Leaf, cert.Certificates, policy)
+	if err != nil {
+		return fmt.Errorf("key %q: %w", kconf.Name(), err)
+	}
+	if kconf.OCSPStaple {
+		for _, result := range results {
+			cert.OCSPResponses = append(cert.OCSPResponses, result.Raw)
+		}
+	}
+	return nil
+}
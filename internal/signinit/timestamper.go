@@ -14,18 +14,30 @@
 package signinit
 
 import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
 	"sync"
+	"time"
 
 	"github.com/sassoftware/relic/v7/cmdline/shared"
 	"github.com/sassoftware/relic/v7/lib/pkcs9"
 	"github.com/sassoftware/relic/v7/lib/pkcs9/tsclient"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
 )
 
 var (
 	mu sync.Mutex
 	ts pkcs9.Timestamper
+
+	tsChain   []*x509.Certificate
+	tsChainAt time.Time
 )
 
+// how long to remember the timestamper's certificate chain
+const tsChainTTL = time.Hour
+
 func GetTimestamper() (pkcs9.Timestamper, error) {
 	mu.Lock()
 	defer mu.Unlock()
@@ -47,3 +59,37 @@ func newTimestamper() (timestamper pkcs9.Timestamper, err error) {
 	}
 	return timestamper, nil
 }
+
+// TimestampChain returns the certificate chain of the timestamp server, for
+// monitoring its expiry. The chain is discovered by timestamping a random
+// value and is cached for an hour.
+func TimestampChain(ctx context.Context) ([]*x509.Certificate, error) {
+	mu.Lock()
+	if tsChain != nil && time.Since(tsChainAt) < tsChainTTL {
+		defer mu.Unlock()
+		return tsChain, nil
+	}
+	mu.Unlock()
+	timestamper, err := GetTimestamper()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	token, err := timestamper.Timestamp(ctx, &pkcs9.Request{EncryptedDigest: nonce, Hash: crypto.SHA256})
+	if err != nil {
+		return nil, err
+	}
+	sig, err := token.Content.Verify(nil, false)
+	if err != nil {
+		return nil, err
+	}
+	chain := x509tools.BuildChain(sig.Certificate, sig.Intermediates)
+	mu.Lock()
+	defer mu.Unlock()
+	tsChain = chain
+	tsChainAt = time.Now()
+	return chain, nil
+}
@@ -0,0 +1,91 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package signinit
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/sassoftware/relic/v7/cmdline/shared"
+	"github.com/sassoftware/relic/v7/config"
+	"github.com/sassoftware/relic/v7/lib/audit"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/intoto"
+	"github.com/sassoftware/relic/v7/lib/rekor"
+	"github.com/sassoftware/relic/v7/lib/slsa"
+)
+
+// RecordTransparency records a signature over the finished artifact in the
+// key's transparency log, if one is configured, and notes the entry in the
+// audit record. The signature is made with the same key and certificate as
+// the artifact's own signature, so the log entry ties the artifact to the
+// signing identity. For dsse and intoto entries the signature is over an
+// in-toto statement naming the artifact.
+func RecordTransparency(ctx context.Context, cert *certloader.Certificate, kconf *config.KeyConfig, name string, artifact io.Reader, auditInfo *audit.Info) (*rekor.Entry, error) {
+	if kconf.TransparencyLog == "" {
+		return nil, nil
+	}
+	signer, ok := cert.PrivateKey.(crypto.Signer)
+	if !ok || cert.Leaf == nil {
+		return nil, errors.New("transparency log: key has no X.509 certificate")
+	}
+	client := rekor.New(kconf.TransparencyLog)
+	var entry *rekor.Entry
+	var err error
+	switch kconf.TransparencyLogKind {
+	case "", rekor.KindHashedRekord:
+		entry, err = client.SignAndUpload(ctx, signer, cert.Leaf, artifact)
+	case rekor.KindDSSE, rekor.KindIntoto:
+		var stmt []byte
+		stmt, err = artifactStatement(kconf, name, artifact)
+		if err == nil {
+			entry, err = client.SignAndUploadDSSE(ctx, kconf.TransparencyLogKind, signer, cert.Leaf, stmt)
+		}
+	default:
+		err = fmt.Errorf("transparency log: unsupported entry kind %q", kconf.TransparencyLogKind)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("key %q: %w", kconf.Name(), err)
+	}
+	auditInfo.SetTransparencyLog(kconf.TransparencyLog, entry)
+	return entry, nil
+}
+
+// artifactStatement returns SLSA provenance naming the artifact as its subject
+func artifactStatement(kconf *config.KeyConfig, name string, artifact io.Reader) ([]byte, error) {
+	d := sha256.New()
+	if _, err := io.Copy(d, artifact); err != nil {
+		return nil, err
+	}
+	stmt, err := slsa.Statement([]intoto.Subject{{
+		Name:   name,
+		Digest: map[string]string{"sha256": hex.EncodeToString(d.Sum(nil))},
+	}}, slsa.BuildInfo{
+		BuildType:          shared.AttestBuildType,
+		ExternalParameters: map[string]interface{}{"key": kconf.Name()},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(stmt)
+}
@@ -0,0 +1,98 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package testcert creates throwaway keys and certificates for unit tests
+package testcert
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sassoftware/relic/v7/lib/certloader"
+)
+
+// ECDSAKey generates a P-256 key
+func ECDSAKey(t testing.TB) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return key
+}
+
+// RSAKey generates a 2048-bit RSA key
+func RSAKey(t testing.TB) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return key
+}
+
+// Issue creates a certificate for key from tmpl, signed by parent. If parent is
+// nil then the certificate is self-signed. A random serial number and a
+// validity period of an hour either side of now are used if tmpl doesn't set
+// them.
+func Issue(t testing.TB, tmpl *x509.Certificate, key crypto.Signer, parent *x509.Certificate, parentKey crypto.Signer) *x509.Certificate {
+	c := *tmpl
+	if c.SerialNumber == nil {
+		serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 63))
+		require.NoError(t, err)
+		c.SerialNumber = serial
+	}
+	if c.NotBefore.IsZero() {
+		c.NotBefore = time.Now().Add(-time.Hour)
+	}
+	if c.NotAfter.IsZero() {
+		c.NotAfter = time.Now().Add(time.Hour)
+	}
+	if parent == nil {
+		parent, parentKey = &c, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &c, parent, key.Public(), parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert
+}
+
+// SelfSigned creates a self-signed certificate for key with the given common name
+func SelfSigned(t testing.TB, commonName string, key crypto.Signer) *x509.Certificate {
+	return Issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}, key, nil, nil)
+}
+
+// CA creates a self-signed CA certificate that can issue certificates and CRLs
+func CA(t testing.TB, commonName string, key crypto.Signer) *x509.Certificate {
+	return Issue(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: commonName},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}, key, nil, nil)
+}
+
+// Signer creates a self-signed certificate for key from tmpl and returns it
+// with the key in the form that signers use
+func Signer(t testing.TB, tmpl *x509.Certificate, key crypto.Signer) *certloader.Certificate {
+	leaf := Issue(t, tmpl, key, nil, nil)
+	return &certloader.Certificate{Leaf: leaf, Certificates: []*x509.Certificate{leaf}, PrivateKey: key}
+}
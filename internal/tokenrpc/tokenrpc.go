@@ -0,0 +1,102 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package tokenrpc defines the gRPC service through which one relic server
+// offers raw signing operations to another. The messages are the same ones
+// used between the server and its token workers, and are encoded as JSON so
+// that no generated code is needed.
+package tokenrpc
+
+import (
+	"context"
+	"encoding/json"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+
+	"github.com/sassoftware/relic/v7/internal/workerrpc"
+)
+
+const (
+	ServiceName = "relic.Token"
+
+	MethodPing   = "/" + ServiceName + "/Ping"
+	MethodGetKey = "/" + ServiceName + "/GetKey"
+	MethodSign   = "/" + ServiceName + "/Sign"
+
+	// CodecName is the content subtype clients must request
+	CodecName = "json"
+)
+
+// Server is implemented by the relic server to serve token operations
+type Server interface {
+	Ping(context.Context, *workerrpc.Request) (*workerrpc.Response, error)
+	GetKey(context.Context, *workerrpc.Request) (*workerrpc.Response, error)
+	Sign(context.Context, *workerrpc.Request) (*workerrpc.Response, error)
+}
+
+// Register adds the token service to a gRPC server
+func Register(s *grpc.Server, srv Server) {
+	s.RegisterService(&serviceDesc, srv)
+}
+
+// Invoke calls a token service method on a connection
+func Invoke(ctx context.Context, cc *grpc.ClientConn, method string, req *workerrpc.Request) (*workerrpc.Response, error) {
+	resp := new(workerrpc.Response)
+	if err := cc.Invoke(ctx, method, req, resp, grpc.CallContentSubtype(CodecName)); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*Server)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Ping", Handler: unaryHandler(MethodPing, Server.Ping)},
+		{MethodName: "GetKey", Handler: unaryHandler(MethodGetKey, Server.GetKey)},
+		{MethodName: "Sign", Handler: unaryHandler(MethodSign, Server.Sign)},
+	},
+	Metadata: "relic/token",
+}
+
+type methodFunc func(Server, context.Context, *workerrpc.Request) (*workerrpc.Response, error)
+
+func unaryHandler(fullMethod string, method methodFunc) func(interface{}, context.Context, func(interface{}) error, grpc.UnaryServerInterceptor) (interface{}, error) {
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		req := new(workerrpc.Request)
+		if err := dec(req); err != nil {
+			return nil, err
+		}
+		if interceptor == nil {
+			return method(srv.(Server), ctx, req)
+		}
+		info := &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod}
+		return interceptor(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return method(srv.(Server), ctx, req.(*workerrpc.Request))
+		})
+	}
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+func (jsonCodec) Name() string                               { return CodecName }
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
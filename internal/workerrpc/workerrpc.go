@@ -18,6 +18,7 @@ package workerrpc
 
 const (
 	Ping   = "/ping"
+	Health = "/health"
 	GetKey = "/getKey"
 	Sign   = "/sign"
 )
@@ -0,0 +1,144 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package alpine implements signing of Alpine Linux packages and repository
+// indexes in the same format as abuild-sign. A signature is a gzipped tar
+// segment, without the end-of-archive marker, prepended to the file and
+// covering the gzip stream that follows it.
+package alpine
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/sassoftware/relic/v7/lib/binpatch"
+)
+
+const sigPrefix = ".SIGN."
+
+var sigTypes = map[crypto.Hash]string{
+	crypto.SHA1:   "RSA",
+	crypto.SHA256: "RSA256",
+}
+
+// memberLen returns the size of the first gzip stream in blob, and the name of
+// the first file in the tar segment inside it
+func memberLen(blob []byte) (int, string, error) {
+	r := bytes.NewReader(blob)
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return 0, "", err
+	}
+	zr.Multistream(false)
+	var name string
+	if hdr, err := tar.NewReader(zr).Next(); err == nil {
+		name = hdr.Name
+	}
+	if _, err := io.Copy(ioutil.Discard, zr); err != nil {
+		return 0, "", err
+	}
+	return len(blob) - r.Len(), name, nil
+}
+
+// Split a package or index into its existing signature segments, if any, and
+// the gzip stream covered by the signature
+func Split(blob []byte) (sigLen int, signed []byte, err error) {
+	for {
+		n, name, err := memberLen(blob[sigLen:])
+		if err != nil {
+			return 0, nil, fmt.Errorf("reading gzip stream: %w", err)
+		}
+		if !strings.HasPrefix(name, sigPrefix) {
+			return sigLen, blob[sigLen : sigLen+n], nil
+		}
+		sigLen += n
+	}
+}
+
+// Sign a package or APKINDEX.tar.gz, returning a patch that replaces any
+// existing signature. keyName is the file name of the public key as installed
+// in /etc/apk/keys.
+func Sign(blob []byte, signer crypto.Signer, hash crypto.Hash, keyName string, mtime time.Time) (*binpatch.PatchSet, error) {
+	sigType, ok := sigTypes[hash]
+	if !ok {
+		return nil, fmt.Errorf("alpine: unsupported hash %s", hash)
+	}
+	if _, ok := signer.Public().(*rsa.PublicKey); !ok {
+		return nil, errors.New("alpine: signing key must be RSA")
+	}
+	sigLen, signed, err := Split(blob)
+	if err != nil {
+		return nil, err
+	}
+	d := hash.New()
+	d.Write(signed)
+	sig, err := signer.Sign(rand.Reader, d.Sum(nil), hash)
+	if err != nil {
+		return nil, err
+	}
+	segment, err := signatureSegment(sigPrefix+sigType+"."+keyName, sig, mtime)
+	if err != nil {
+		return nil, err
+	}
+	patch := binpatch.New()
+	patch.Add(0, int64(sigLen), segment)
+	return patch, nil
+}
+
+func signatureSegment(name string, sig []byte, mtime time.Time) ([]byte, error) {
+	var tbuf bytes.Buffer
+	tw := tar.NewWriter(&tbuf)
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(sig)),
+		ModTime: mtime.Truncate(time.Second),
+		Uname:   "root",
+		Gname:   "root",
+		Format:  tar.FormatUSTAR,
+	}); err != nil {
+		return nil, err
+	}
+	if _, err := tw.Write(sig); err != nil {
+		return nil, err
+	}
+	// flush the padding but leave off the end-of-archive blocks
+	if err := tw.Flush(); err != nil {
+		return nil, err
+	}
+	var zbuf bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&zbuf, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := zw.Write(tbuf.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return zbuf.Bytes(), nil
+}
@@ -0,0 +1,86 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package alpine_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sassoftware/relic/v7/lib/alpine"
+)
+
+func segment(t *testing.T, name string, contents []byte) []byte {
+	var tbuf bytes.Buffer
+	tw := tar.NewWriter(&tbuf)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(contents))}))
+	_, err := tw.Write(contents)
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	var zbuf bytes.Buffer
+	zw := gzip.NewWriter(&zbuf)
+	_, _ = zw.Write(tbuf.Bytes())
+	require.NoError(t, zw.Close())
+	return zbuf.Bytes()
+}
+
+func TestSign(t *testing.T) {
+	t.Parallel()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	control := segment(t, ".PKGINFO", []byte("pkgname = foo\n"))
+	data := segment(t, "usr/bin/foo", []byte("hello"))
+	pkg := append(append([]byte{}, control...), data...)
+
+	sign := func(pkg []byte) []byte {
+		patch, err := alpine.Sign(pkg, key, crypto.SHA256, "test.rsa.pub", time.Now())
+		require.NoError(t, err)
+		require.Len(t, patch.Blobs, 1)
+		return append(append([]byte{}, patch.Blobs[0]...), pkg[patch.Patches[0].OldSize:]...)
+	}
+	signed := sign(pkg)
+	sigLen, covered, err := alpine.Split(signed)
+	require.NoError(t, err)
+	assert.Equal(t, control, covered)
+	// check the signature segment
+	zr, err := gzip.NewReader(bytes.NewReader(signed[:sigLen]))
+	require.NoError(t, err)
+	tr := tar.NewReader(zr)
+	hdr, err := tr.Next()
+	require.NoError(t, err)
+	assert.Equal(t, ".SIGN.RSA256.test.rsa.pub", hdr.Name)
+	sig, err := ioutil.ReadAll(tr)
+	require.NoError(t, err)
+	digest := sha256.Sum256(control)
+	assert.NoError(t, rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], sig))
+	// re-signing replaces the old signature
+	resigned := sign(signed)
+	sigLen2, covered, err := alpine.Split(resigned)
+	require.NoError(t, err)
+	assert.Equal(t, control, covered)
+	assert.Equal(t, data, resigned[sigLen2+len(control):])
+}
@@ -0,0 +1,179 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package appimage implements the signatures embedded in type 2 AppImages by
+// appimagetool. The SHA-256 digest of the image, computed with the signature
+// sections zeroed, is signed as a hex string with an armored detached PGP
+// signature, which is stored in the .sha256_sig section along with the
+// armored public key in .sig_key.
+package appimage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"debug/elf"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
+
+	"github.com/sassoftware/relic/v7/lib/binpatch"
+	"github.com/sassoftware/relic/v7/lib/pgptools"
+	"github.com/sassoftware/relic/v7/signers/sigerrors"
+)
+
+const (
+	SignatureSection = ".sha256_sig"
+	KeySection       = ".sig_key"
+)
+
+// Magic identifies a type 2 AppImage, at offset 8 in the ELF header
+var Magic = []byte{'A', 'I', 2}
+
+type region struct {
+	Offset, Size int64
+}
+
+type Image struct {
+	blob     []byte
+	sig, key region
+}
+
+// Parse a type 2 AppImage and locate its signature sections
+func Parse(blob []byte) (*Image, error) {
+	if len(blob) < 11 || !bytes.Equal(blob[8:11], Magic) {
+		return nil, errors.New("not a type 2 AppImage")
+	}
+	f, err := elf.NewFile(bytes.NewReader(blob))
+	if err != nil {
+		return nil, fmt.Errorf("appimage: %w", err)
+	}
+	img := &Image{blob: blob}
+	for name, r := range map[string]*region{SignatureSection: &img.sig, KeySection: &img.key} {
+		sec := f.Section(name)
+		if sec == nil || sec.Type == elf.SHT_NOBITS {
+			return nil, fmt.Errorf("appimage: missing %s section; rebuild with a current appimagetool", name)
+		}
+		if sec.Offset+sec.Size > uint64(len(blob)) {
+			return nil, fmt.Errorf("appimage: section %s is out of bounds", name)
+		}
+		r.Offset, r.Size = int64(sec.Offset), int64(sec.Size)
+	}
+	if img.sig.Offset < img.key.Offset+img.key.Size && img.key.Offset < img.sig.Offset+img.sig.Size {
+		return nil, errors.New("appimage: signature sections overlap")
+	}
+	return img, nil
+}
+
+// Digest returns the hex SHA-256 digest of the image with the contents of the
+// signature and key sections treated as zeroes
+func (i *Image) Digest() string {
+	d := sha256.New()
+	regions := []region{i.sig, i.key}
+	sort.Slice(regions, func(j, k int) bool { return regions[j].Offset < regions[k].Offset })
+	var pos int64
+	for _, r := range regions {
+		d.Write(i.blob[pos:r.Offset])
+		d.Write(make([]byte, r.Size))
+		pos = r.Offset + r.Size
+	}
+	d.Write(i.blob[pos:])
+	return hex.EncodeToString(d.Sum(nil))
+}
+
+func (i *Image) section(r region) []byte {
+	return bytes.TrimRight(i.blob[r.Offset:r.Offset+r.Size], "\x00")
+}
+
+// Signature returns the embedded armored signature, if any
+func (i *Image) Signature() []byte {
+	return i.section(i.sig)
+}
+
+// Key returns the embedded armored public key, if any
+func (i *Image) Key() []byte {
+	return i.section(i.key)
+}
+
+// Sign the image and return a patch that fills in the signature and key
+// sections
+func (i *Image) Sign(signer *openpgp.Entity, config *packet.Config) (*binpatch.PatchSet, error) {
+	var sig bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&sig, signer, strings.NewReader(i.Digest()), config); err != nil {
+		return nil, err
+	}
+	sig.WriteByte('\n')
+	var key bytes.Buffer
+	w, err := armor.Encode(&key, openpgp.PublicKeyType, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := signer.Serialize(w); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	key.WriteByte('\n')
+	return i.patch(sig.Bytes(), key.Bytes())
+}
+
+func (i *Image) patch(sig, key []byte) (*binpatch.PatchSet, error) {
+	type fill struct {
+		r    region
+		name string
+		blob []byte
+	}
+	fills := []fill{{i.sig, SignatureSection, sig}, {i.key, KeySection, key}}
+	sort.Slice(fills, func(j, k int) bool { return fills[j].r.Offset < fills[k].r.Offset })
+	patch := binpatch.New()
+	for _, f := range fills {
+		if int64(len(f.blob)) > f.r.Size {
+			return nil, fmt.Errorf("appimage: %d byte %s section is too small for %d bytes", f.r.Size, f.name, len(f.blob))
+		}
+		padded := make([]byte, f.r.Size)
+		copy(padded, f.blob)
+		patch.Add(f.r.Offset, f.r.Size, padded)
+	}
+	return patch, nil
+}
+
+// Verify the embedded signature against the given keyring. The embedded key
+// is not trusted, but is returned so the caller can report it.
+func (i *Image) Verify(keyring openpgp.EntityList) (*pgptools.PgpSignature, openpgp.EntityList, error) {
+	armored := i.Signature()
+	if len(armored) == 0 {
+		return nil, nil, sigerrors.NotSignedError{Type: "AppImage"}
+	}
+	block, err := armor.Decode(bytes.NewReader(armored))
+	if err != nil {
+		return nil, nil, fmt.Errorf("appimage: %w", err)
+	}
+	var embedded openpgp.EntityList
+	if key := i.Key(); len(key) != 0 {
+		embedded, err = openpgp.ReadArmoredKeyRing(bytes.NewReader(key))
+		if err != nil {
+			return nil, nil, fmt.Errorf("appimage: embedded key: %w", err)
+		}
+	}
+	sig, err := pgptools.VerifyDetached(block.Body, strings.NewReader(i.Digest()), keyring)
+	return sig, embedded, err
+}
@@ -0,0 +1,131 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package appimage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+
+	"github.com/sassoftware/relic/v7/signers/sigerrors"
+)
+
+// build a skeleton ELF64 file with the AppImage magic and empty signature
+// sections, followed by a payload standing in for the squashfs image
+func testImage(sigSize, keySize int) []byte {
+	shstrtab := []byte("\x00.shstrtab\x00" + SignatureSection + "\x00" + KeySection + "\x00")
+	var data bytes.Buffer
+	data.Write(make([]byte, 64))
+	strOff := data.Len()
+	data.Write(shstrtab)
+	sigOff := data.Len()
+	data.Write(make([]byte, sigSize))
+	keyOff := data.Len()
+	data.Write(make([]byte, keySize))
+	shoff := data.Len()
+	type shdr struct {
+		Name, Type                uint32
+		Flags, Addr, Offset, Size uint64
+		Link, Info                uint32
+		Addralign, Entsize        uint64
+	}
+	sections := []shdr{
+		{},
+		{Name: 1, Type: uint32(3), Offset: uint64(strOff), Size: uint64(len(shstrtab)), Addralign: 1},
+		{Name: 11, Type: uint32(1), Offset: uint64(sigOff), Size: uint64(sigSize), Addralign: 1},
+		{Name: uint32(12 + len(SignatureSection)), Type: uint32(1), Offset: uint64(keyOff), Size: uint64(keySize), Addralign: 1},
+	}
+	for _, s := range sections {
+		_ = binary.Write(&data, binary.LittleEndian, s)
+	}
+	data.WriteString("hsqs payload")
+	blob := data.Bytes()
+	copy(blob, []byte{0x7f, 'E', 'L', 'F', 2, 1, 1, 0})
+	copy(blob[8:], Magic)
+	hdr := blob[16:]
+	binary.LittleEndian.PutUint16(hdr[0:], 2)  // e_type
+	binary.LittleEndian.PutUint16(hdr[2:], 62) // e_machine
+	binary.LittleEndian.PutUint32(hdr[4:], 1)  // e_version
+	binary.LittleEndian.PutUint64(hdr[24:], uint64(shoff))
+	binary.LittleEndian.PutUint16(hdr[36:], 64) // e_ehsize
+	binary.LittleEndian.PutUint16(hdr[38:], 56) // e_phentsize
+	binary.LittleEndian.PutUint16(hdr[42:], 64) // e_shentsize
+	binary.LittleEndian.PutUint16(hdr[44:], uint16(len(sections)))
+	binary.LittleEndian.PutUint16(hdr[46:], 1) // e_shstrndx
+	return blob
+}
+
+func TestSignVerify(t *testing.T) {
+	entity, err := openpgp.NewEntity("test", "", "test@example.com", &packet.Config{RSABits: 1024})
+	require.NoError(t, err)
+	blob := testImage(1024, 8192)
+	img, err := Parse(blob)
+	require.NoError(t, err)
+	_, _, err = img.Verify(openpgp.EntityList{entity})
+	assert.Equal(t, sigerrors.NotSignedError{Type: "AppImage"}, err)
+	digest := img.Digest()
+
+	patch, err := img.Sign(entity, nil)
+	require.NoError(t, err)
+	fp := filepath.Join(t.TempDir(), "test.AppImage")
+	require.NoError(t, os.WriteFile(fp, blob, 0644))
+	f, err := os.OpenFile(fp, os.O_RDWR, 0)
+	require.NoError(t, err)
+	defer f.Close()
+	require.NoError(t, patch.Apply(f, fp))
+	signed, err := os.ReadFile(fp)
+	require.NoError(t, err)
+	require.Len(t, signed, len(blob))
+
+	img, err = Parse(signed)
+	require.NoError(t, err)
+	assert.Equal(t, digest, img.Digest(), "digest should not cover the signature sections")
+	assert.Contains(t, string(img.Signature()), "BEGIN PGP SIGNATURE")
+	sig, embedded, err := img.Verify(openpgp.EntityList{entity})
+	require.NoError(t, err)
+	assert.Equal(t, entity.PrimaryKey.KeyId, sig.Key.PublicKey.KeyId)
+	require.Len(t, embedded, 1)
+	assert.Equal(t, entity.PrimaryKey.KeyId, embedded[0].PrimaryKey.KeyId)
+
+	// the embedded key is not trusted by itself
+	_, _, err = img.Verify(nil)
+	assert.Error(t, err)
+
+	signed[len(signed)-1] ^= 1
+	img, err = Parse(signed)
+	require.NoError(t, err)
+	_, _, err = img.Verify(openpgp.EntityList{entity})
+	assert.Error(t, err)
+}
+
+func TestSectionTooSmall(t *testing.T) {
+	entity, err := openpgp.NewEntity("test", "", "test@example.com", &packet.Config{RSABits: 1024})
+	require.NoError(t, err)
+	img, err := Parse(testImage(16, 8192))
+	require.NoError(t, err)
+	_, err = img.Sign(entity, nil)
+	assert.Error(t, err)
+	_, err = Parse([]byte("\x7fELF not an appimage"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,172 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package appmanifest
+
+import (
+	"crypto"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/beevik/etree"
+
+	"github.com/sassoftware/relic/v7/lib/xmldsig"
+)
+
+const hashTransformIdentity = "urn:schemas-microsoft-com:HashTransforms.Identity"
+
+// FileOpener returns the contents of a file referenced by a manifest. The
+// codebase is relative to the manifest and uses forward slashes.
+type FileOpener func(codebase string) ([]byte, error)
+
+// Deployment describes the parts of a deployment (.application) manifest
+// needed to locate the rest of a ClickOnce publish folder
+type Deployment struct {
+	// Codebase of the application manifest, relative to the deployment manifest
+	ManifestCodebase string
+	// If true then application files have a .deploy suffix appended
+	MapFileExtensions bool
+}
+
+// ParseDeployment reads a deployment manifest and returns the location of its
+// application manifest
+func ParseDeployment(manifest []byte) (*Deployment, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(string(manifest)); err != nil {
+		return nil, err
+	}
+	root := doc.Root()
+	d := new(Deployment)
+	if dep := root.SelectElement("deployment"); dep != nil {
+		d.MapFileExtensions = dep.SelectAttrValue("mapFileExtensions", "") == "true"
+	}
+	for _, dep := range root.SelectElements("dependency") {
+		da := dep.SelectElement("dependentAssembly")
+		if da == nil || da.SelectAttrValue("dependencyType", "") != "install" {
+			continue
+		}
+		if codebase := da.SelectAttrValue("codebase", ""); codebase != "" {
+			d.ManifestCodebase = normalizeCodebase(codebase)
+			return d, nil
+		}
+	}
+	return nil, errors.New("deployment manifest does not reference an application manifest")
+}
+
+// UpdateHashes recomputes the size and digest of every file and dependent
+// assembly referenced by a manifest. Any existing signature is left in place
+// and must be replaced by signing the result.
+func UpdateHashes(manifest []byte, hash crypto.Hash, open FileOpener) ([]byte, error) {
+	method := digestMethod(hash)
+	if method == "" {
+		return nil, fmt.Errorf("unsupported hash %s for manifest dependencies", hash)
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(string(manifest)); err != nil {
+		return nil, err
+	}
+	root := doc.Root()
+	if root.SelectAttr("xmlns:dsig") == nil {
+		root.CreateAttr("xmlns:dsig", xmldsig.NsXMLDsig)
+	}
+	for _, dep := range root.SelectElements("dependency") {
+		da := dep.SelectElement("dependentAssembly")
+		if da == nil {
+			continue
+		}
+		codebase := da.SelectAttrValue("codebase", "")
+		if codebase == "" {
+			// prerequisites are installed separately
+			continue
+		}
+		blob, err := open(normalizeCodebase(codebase))
+		if err != nil {
+			return nil, err
+		}
+		setHash(da, blob, hash, method)
+		if strings.HasSuffix(strings.ToLower(codebase), ".manifest") {
+			if err := copyPublicKeyToken(da, blob); err != nil {
+				return nil, fmt.Errorf("%s: %w", codebase, err)
+			}
+		}
+	}
+	for _, file := range root.SelectElements("file") {
+		name := file.SelectAttrValue("name", "")
+		if name == "" {
+			continue
+		}
+		blob, err := open(normalizeCodebase(name))
+		if err != nil {
+			return nil, err
+		}
+		setHash(file, blob, hash, method)
+	}
+	return doc.WriteToBytes()
+}
+
+// replace the size attribute and hash element of a file reference
+func setHash(elem *etree.Element, blob []byte, hash crypto.Hash, method string) {
+	elem.CreateAttr("size", strconv.Itoa(len(blob)))
+	d := hash.New()
+	d.Write(blob)
+	h := elem.SelectElement("hash")
+	if h == nil {
+		h = elem.CreateElement("hash")
+	}
+	h.Child = nil
+	h.CreateElement("dsig:Transforms").CreateElement("dsig:Transform").CreateAttr("Algorithm", hashTransformIdentity)
+	h.CreateElement("dsig:DigestMethod").CreateAttr("Algorithm", method)
+	h.CreateElement("dsig:DigestValue").SetText(base64.StdEncoding.EncodeToString(d.Sum(nil)))
+}
+
+// a reference to a manifest also names the key it was signed with
+func copyPublicKeyToken(da *etree.Element, manifest []byte) error {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(string(manifest)); err != nil {
+		return err
+	}
+	asi := doc.Root().SelectElement("assemblyIdentity")
+	if asi == nil {
+		return errors.New("manifest has no top-level assemblyIdentity element")
+	}
+	token := asi.SelectAttrValue("publicKeyToken", "")
+	if ref := da.SelectElement("assemblyIdentity"); ref != nil && token != "" {
+		ref.CreateAttr("publicKeyToken", token)
+	}
+	return nil
+}
+
+// ClickOnce always uses the original xmldsig namespace for digest names
+func digestMethod(hash crypto.Hash) string {
+	switch hash {
+	case crypto.SHA1:
+		return xmldsig.NsXMLDsig + "sha1"
+	case crypto.SHA256:
+		return xmldsig.NsXMLDsig + "sha256"
+	case crypto.SHA384:
+		return xmldsig.NsXMLDsig + "sha384"
+	case crypto.SHA512:
+		return xmldsig.NsXMLDsig + "sha512"
+	}
+	return ""
+}
+
+func normalizeCodebase(codebase string) string {
+	return strings.ReplaceAll(codebase, "\\", "/")
+}
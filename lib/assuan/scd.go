@@ -21,7 +21,11 @@ package assuan
 import (
 	"bytes"
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rsa"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"math/big"
@@ -44,6 +48,7 @@ type ScdKey struct {
 	KeyId       string
 
 	conn *ScdConn
+	pub  crypto.PublicKey
 }
 
 func DialScd(path string) (*ScdConn, error) {
@@ -131,6 +136,9 @@ func (s *ScdConn) CheckPin(pin string) error {
 
 // Get the public key from the token
 func (k *ScdKey) Public() (crypto.PublicKey, error) {
+	if k.pub != nil {
+		return k.pub, nil
+	}
 	res, err := k.conn.Transact("READKEY "+k.KeyId, nil)
 	if err != nil {
 		return nil, err
@@ -153,9 +161,10 @@ func (k *ScdKey) Public() (crypto.PublicKey, error) {
 	keyType := string(exp.Items[0].Value)
 	values := make(map[string][]byte)
 	for _, item := range exp.Items[1:] {
-		if len(item.Items) != 2 {
+		if len(item.Items) < 2 {
 			return nil, errors.New("invalid public key in token")
 		}
+		// only the first value of a list such as (flags eddsa) is kept
 		name := string(item.Items[0].Value)
 		value := item.Items[1].Value
 		values[name] = value
@@ -167,32 +176,92 @@ func (k *ScdKey) Public() (crypto.PublicKey, error) {
 		if n == nil || e == nil {
 			return nil, errors.New("invalid RSA public key in token")
 		}
-		return &rsa.PublicKey{
+		k.pub = &rsa.PublicKey{
 			N: new(big.Int).SetBytes(n),
 			E: int(new(big.Int).SetBytes(e).Int64()),
-		}, nil
+		}
+	case "ecc", "ecdsa", "eddsa":
+		k.pub, err = parseECC(string(values["curve"]), values["q"])
+		if err != nil {
+			return nil, err
+		}
 	default:
 		return nil, fmt.Errorf("unsupported public key of type %s in token", keyType)
 	}
+	return k.pub, nil
+}
+
+// parse an ECC public key given the curve name used by libgcrypt and the
+// public point
+func parseECC(curveName string, q []byte) (crypto.PublicKey, error) {
+	if curveName == "" || len(q) == 0 {
+		return nil, errors.New("invalid ECC public key in token")
+	}
+	switch strings.ToLower(curveName) {
+	case "ed25519", "1.3.6.1.4.1.11591.15.1", "1.3.101.112":
+		// EdDSA points may carry a 0x40 prefix to mark the native encoding
+		if len(q) == ed25519.PublicKeySize+1 && q[0] == 0x40 {
+			q = q[1:]
+		}
+		if len(q) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 public key in token")
+		}
+		return ed25519.PublicKey(q), nil
+	}
+	name := strings.TrimPrefix(curveName, "NIST ")
+	if strings.HasPrefix(name, "nistp") {
+		name = "P-" + name[5:]
+	}
+	def, err := x509tools.CurveByName(name)
+	if err != nil {
+		def, err = x509tools.CurveByOidString(curveName)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unsupported ECC curve %q in token", curveName)
+	}
+	x, y := elliptic.Unmarshal(def.Curve, q)
+	if x == nil {
+		return nil, errors.New("invalid ECDSA public key in token")
+	}
+	return &ecdsa.PublicKey{Curve: def.Curve, X: x, Y: y}, nil
 }
 
-// Create a signature over the given (unpadded) digest.
+// Create a signature over the given (unpadded) digest. For Ed25519 keys the
+// message is signed as-is and opts must not specify a hash.
 func (k *ScdKey) Sign(hashValue []byte, opts crypto.SignerOpts, pin string) ([]byte, error) {
-	if opts == nil || opts.HashFunc() == 0 {
+	pub, err := k.Public()
+	if err != nil {
+		return nil, err
+	}
+	if opts == nil {
 		return nil, errors.New("Signer options are required")
-	} else if _, ok := opts.(*rsa.PSSOptions); ok {
-		return nil, errors.New("RSA-PSS not implemented")
 	}
-	hashName := x509tools.HashNames[opts.HashFunc()]
-	if hashName == "" {
-		return nil, errors.New("unsupported hash algorithm")
+	var hashArg string
+	switch pk := pub.(type) {
+	case ed25519.PublicKey:
+		if opts.HashFunc() != 0 {
+			return nil, errors.New("ed25519 keys can't sign a prehashed digest")
+		}
+	case *ecdsa.PublicKey:
+		// the card signs whatever it is given, so truncate the digest to the
+		// size of the curve as ECDSA requires
+		if size := (pk.Curve.Params().N.BitLen() + 7) / 8; len(hashValue) > size {
+			hashValue = hashValue[:size]
+		}
+		hashArg, err = scdHashName(opts)
+	default:
+		if _, ok := opts.(*rsa.PSSOptions); ok {
+			return nil, errors.New("RSA-PSS not implemented")
+		}
+		hashArg, err = scdHashName(opts)
 	}
-	hashName = strings.ToLower(strings.ReplaceAll(hashName, "-", ""))
-	res, err := k.conn.Transact(fmt.Sprintf("SETDATA %X", hashValue), nil)
 	if err != nil {
 		return nil, err
 	}
-	res, err = k.conn.Transact(fmt.Sprintf("PKSIGN --hash=%s %s\n", hashName, k.KeyId),
+	if err := k.setData(hashValue); err != nil {
+		return nil, err
+	}
+	res, err := k.conn.Transact(fmt.Sprintf("PKSIGN%s %s\n", hashArg, k.KeyId),
 		func(inquiry string, lines []string) (string, error) {
 			if strings.HasPrefix(inquiry, "NEEDPIN") {
 				return pin + "\x00", nil
@@ -205,5 +274,46 @@ func (k *ScdKey) Sign(hashValue []byte, opts crypto.SignerOpts, pin string) ([]b
 	} else if err != nil {
 		return nil, fmt.Errorf("failed to sign: %w", err)
 	}
+	if _, ok := pub.(*ecdsa.PublicKey); ok {
+		// the card returns r and s concatenated
+		sig, err := x509tools.UnpackEcdsaSignature(res.Blob)
+		if err != nil {
+			return nil, err
+		}
+		return sig.Marshal(), nil
+	}
 	return res.Blob, nil
 }
+
+func scdHashName(opts crypto.SignerOpts) (string, error) {
+	if opts.HashFunc() == 0 {
+		return "", errors.New("Signer options are required")
+	}
+	hashName := x509tools.HashNames[opts.HashFunc()]
+	if hashName == "" {
+		return "", errors.New("unsupported hash algorithm")
+	}
+	return " --hash=" + strings.ToLower(strings.ReplaceAll(hashName, "-", "")), nil
+}
+
+// maximum bytes of data per SETDATA line, keeping within the assuan line limit
+const setDataChunk = 480
+
+// Send the data to be signed, in several lines if it is long
+func (k *ScdKey) setData(data []byte) error {
+	cmd := "SETDATA "
+	for {
+		chunk := data
+		if len(chunk) > setDataChunk {
+			chunk = chunk[:setDataChunk]
+		}
+		data = data[len(chunk):]
+		if _, err := k.conn.Transact(cmd+strings.ToUpper(hex.EncodeToString(chunk)), nil); err != nil {
+			return err
+		}
+		if len(data) == 0 {
+			return nil
+		}
+		cmd = "SETDATA --append "
+	}
+}
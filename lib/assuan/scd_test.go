@@ -0,0 +1,51 @@
+package assuan
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+
+	"github.com/sassoftware/relic/v7/internal/testcert"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+)
+
+func TestParseECC(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := elliptic.Marshal(elliptic.P256(), priv.X, priv.Y)
+	for _, name := range []string{"NIST P-256", "nistp256", "1.2.840.10045.3.1.7"} {
+		pub, err := parseECC(name, q)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if !priv.PublicKey.Equal(pub) {
+			t.Errorf("%s: wrong public key", name)
+		}
+	}
+	edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := parseECC("Ed25519", append([]byte{0x40}, edPub...))
+	if err != nil {
+		t.Fatal(err)
+	} else if !edPub.Equal(pub) {
+		t.Error("wrong Ed25519 public key")
+	}
+	// the card's certificate is picked out of a bundle by its key
+	other := testcert.SelfSigned(t, "other", priv)
+	leaf := testcert.SelfSigned(t, "card", edPriv)
+	cert, err := certloader.LoadTokenCertificates(pub, "", "", append(other.Raw, leaf.Raw...))
+	if err != nil {
+		t.Fatal(err)
+	} else if !cert.Leaf.Equal(leaf) {
+		t.Error("wrong certificate for Ed25519 key")
+	}
+	if _, err := parseECC("Curve25519", edPub); err == nil {
+		t.Error("expected error for encryption-only curve")
+	}
+}
@@ -51,16 +51,23 @@ type AtomicFile interface {
 type atomicFile struct {
 	*os.File
 	name string
+	mode os.FileMode
 }
 
 // Open a temporary file for reading and writing which will ultimately be
 // renamed to the given name when Commit() is called.
 func New(name string) (AtomicFile, error) {
+	return NewMode(name, 0644)
+}
+
+// NewMode is like New but the file is given the specified permissions when
+// committed. Until then it is only readable by the owner.
+func NewMode(name string, mode os.FileMode) (AtomicFile, error) {
 	tempfile, err := ioutil.TempFile(filepath.Dir(name), filepath.Base(name)+".tmp")
 	if err != nil {
 		return nil, err
 	}
-	f := &atomicFile{tempfile, name}
+	f := &atomicFile{tempfile, name, mode}
 	runtime.SetFinalizer(f, (*atomicFile).Close)
 	return f, nil
 }
@@ -84,7 +91,7 @@ func (f *atomicFile) Commit() error {
 	if f.File == nil {
 		return errors.New("file is closed")
 	}
-	_ = f.File.Chmod(0644)
+	_ = f.File.Chmod(f.mode)
 	if err := f.File.Close(); err != nil {
 		return err
 	}
@@ -49,6 +49,10 @@ func isSpecial(path string) bool {
 // Pick the best strategy for writing to the given path. Pipes and devices will
 // be written to directly, otherwise write-rename.
 func WriteAny(path string) (AtomicFile, error) {
+	return writeAny(path, 0644)
+}
+
+func writeAny(path string, mode os.FileMode) (AtomicFile, error) {
 	if path == "-" {
 		return nopAtomic{os.Stdout, false}, nil
 	}
@@ -56,7 +60,7 @@ func WriteAny(path string) (AtomicFile, error) {
 		f, err := os.Create(path)
 		return nopAtomic{f, true}, err
 	}
-	return New(path)
+	return NewMode(path, mode)
 }
 
 // If src and dest are the same, use src for reading and writing. If they are
@@ -85,7 +89,13 @@ func WriteInPlace(src *os.File, dest string) (AtomicFile, error) {
 
 // Write bytes to a file, using write-rename when appropriate
 func WriteFile(path string, data []byte) error {
-	f, err := WriteAny(path)
+	return WriteFileMode(path, data, 0644)
+}
+
+// WriteFileMode is like WriteFile but a regular file is given the specified
+// permissions
+func WriteFileMode(path string, data []byte, mode os.FileMode) error {
+	f, err := writeAny(path, mode)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,283 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package attestation parses and verifies hardware key attestation
+// certificates, which are issued by a device to prove that a key was
+// generated inside it and cannot be extracted.
+//
+// Supported formats are YubiKey PIV attestations (produced by
+// "yubico-piv-tool -a attest" or "ykman piv keys attest") and YubiHSM 2
+// attestations (produced by "yubihsm-shell -a sign-attestation-certificate",
+// also used for keys accessed via the YubiHSM PKCS#11 module), as well as
+// key attestations from cloud HSMs built on Marvell LiquidSecurity adapters.
+package attestation
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+)
+
+const (
+	FormatYubiKeyPIV = "yubikey-piv"
+	FormatYubiHSM    = "yubihsm"
+)
+
+var (
+	oidYubicoPIV = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 41482, 3}
+	oidYubicoHSM = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 41482, 4}
+)
+
+// maximum number of certificates between the attestation and a root
+const maxChainDepth = 5
+
+// Attestation describes a key as reported by the device that holds it
+type Attestation struct {
+	Format string
+	// Device serial number
+	Serial *big.Int
+	// Device firmware version
+	Firmware string
+	// True if the key was generated inside the device
+	Generated bool
+	// True if the device allows the key to be exported, e.g. under wrap
+	Exportable bool
+	// YubiKey PIV only: PIN and touch policy for the key, and the device form factor
+	PINPolicy   string
+	TouchPolicy string
+	FormFactor  string
+	// YubiHSM only: object ID and label of the key
+	ObjectID int
+	Label    string
+	// The attestation certificate
+	Certificate *x509.Certificate
+}
+
+// HardwareBacked returns true if the key was generated in the device and
+// cannot leave it
+func (a *Attestation) HardwareBacked() bool {
+	return a.Generated && !a.Exportable
+}
+
+func (a *Attestation) String() string {
+	if a.Serial == nil && a.Certificate != nil {
+		return fmt.Sprintf("%s device `%s`", a.Format, x509tools.FormatSubject(a.Certificate))
+	}
+	return fmt.Sprintf("%s serial %s firmware %s", a.Format, a.Serial, a.Firmware)
+}
+
+// Verify parses an attestation certificate and any intermediate certificates
+// following it in blob, checks that it chains to one of roots and that it
+// attests to the given public key, and returns the attested properties.
+//
+// Attestation certificates often carry meaningless validity periods copied
+// from the device certificate, so only signatures are checked.
+//
+// blob may instead be a bundle of cloud HSM attestation records produced by
+// MarshalHSM.
+func Verify(blob []byte, roots []*x509.Certificate, pub crypto.PublicKey) (*Attestation, error) {
+	if isHSMBundle(blob) {
+		return verifyHSM(blob, roots, pub)
+	}
+	certs, err := certloader.ParseX509Certificates(blob)
+	if err != nil {
+		return nil, fmt.Errorf("attestation: %w", err)
+	}
+	leaf := certs[0]
+	if pub != nil && !x509tools.SameKey(leaf.PublicKey, pub) {
+		return nil, errors.New("attestation: certificate does not attest to the signing key")
+	}
+	if err := verifyChain(leaf, certs[1:], roots); err != nil {
+		return nil, err
+	}
+	return Parse(leaf)
+}
+
+// Parse reads the attested properties from an attestation certificate
+// without verifying it
+func Parse(cert *x509.Certificate) (*Attestation, error) {
+	var a *Attestation
+	var err error
+	for _, ext := range cert.Extensions {
+		id := ext.Id
+		if len(id) != len(oidYubicoPIV)+1 {
+			continue
+		}
+		switch {
+		case id[:len(id)-1].Equal(oidYubicoPIV):
+			if a == nil {
+				a = &Attestation{Format: FormatYubiKeyPIV}
+			}
+			err = parsePIVExtension(a, id[len(id)-1], ext.Value)
+		case id[:len(id)-1].Equal(oidYubicoHSM):
+			if a == nil {
+				a = &Attestation{Format: FormatYubiHSM}
+			}
+			err = parseHSMExtension(a, id[len(id)-1], ext.Value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("attestation: parsing extension %s: %w", id, err)
+		}
+	}
+	if a == nil {
+		return nil, errors.New("attestation: not a recognized attestation certificate")
+	}
+	if a.Format == FormatYubiKeyPIV {
+		// PIV attestations can only be produced for keys generated on the
+		// device, and PIV keys can never be exported
+		a.Generated = true
+	}
+	a.Certificate = cert
+	return a, nil
+}
+
+// YubiKey PIV extension values are raw bytes, except the serial number
+func parsePIVExtension(a *Attestation, field int, value []byte) error {
+	switch field {
+	case 3:
+		if len(value) != 3 {
+			return errors.New("invalid firmware version")
+		}
+		a.Firmware = fmt.Sprintf("%d.%d.%d", value[0], value[1], value[2])
+	case 7:
+		a.Serial = new(big.Int)
+		return unmarshalExact(value, &a.Serial)
+	case 8:
+		if len(value) != 2 {
+			return errors.New("invalid usage policy")
+		}
+		a.PINPolicy = lookup(pivPINPolicies, value[0])
+		a.TouchPolicy = lookup(pivTouchPolicies, value[1])
+	case 9:
+		if len(value) != 1 {
+			return errors.New("invalid form factor")
+		}
+		a.FormFactor = lookup(pivFormFactors, value[0]&0x7f)
+	}
+	return nil
+}
+
+const (
+	hsmOriginGenerated   = 0x01
+	hsmOriginImported    = 0x02
+	hsmOriginWrapped     = 0x10
+	hsmCapExportableWrap = 1 << 16
+)
+
+// YubiHSM extension values are DER-encoded
+func parseHSMExtension(a *Attestation, field int, value []byte) error {
+	switch field {
+	case 1:
+		var version []byte
+		if err := unmarshalExact(value, &version); err != nil {
+			return err
+		} else if len(version) != 3 {
+			return errors.New("invalid firmware version")
+		}
+		a.Firmware = fmt.Sprintf("%d.%d.%d", version[0], version[1], version[2])
+	case 2:
+		a.Serial = new(big.Int)
+		return unmarshalExact(value, &a.Serial)
+	case 3:
+		var origin asn1.BitString
+		if err := unmarshalExact(value, &origin); err != nil {
+			return err
+		} else if len(origin.Bytes) != 1 {
+			return errors.New("invalid origin")
+		}
+		a.Generated = origin.Bytes[0]&hsmOriginGenerated != 0
+	case 5:
+		var caps asn1.BitString
+		if err := unmarshalExact(value, &caps); err != nil {
+			return err
+		} else if len(caps.Bytes) != 8 {
+			return errors.New("invalid capabilities")
+		}
+		var bits uint64
+		for _, b := range caps.Bytes {
+			bits = bits<<8 | uint64(b)
+		}
+		a.Exportable = bits&hsmCapExportableWrap != 0
+	case 6:
+		return unmarshalExact(value, &a.ObjectID)
+	case 9:
+		return unmarshalExact(value, &a.Label)
+	}
+	return nil
+}
+
+var (
+	pivPINPolicies   = map[byte]string{1: "never", 2: "once", 3: "always"}
+	pivTouchPolicies = map[byte]string{1: "never", 2: "always", 3: "cached"}
+	pivFormFactors   = map[byte]string{1: "usb-a-keychain", 2: "usb-a-nano", 3: "usb-c-keychain", 4: "usb-c-nano", 5: "usb-c-lightning", 6: "usb-a-bio", 7: "usb-c-bio"}
+)
+
+func lookup(names map[byte]string, v byte) string {
+	if name := names[v]; name != "" {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", v)
+}
+
+func unmarshalExact(der []byte, v interface{}) error {
+	rest, err := asn1.Unmarshal(der, v)
+	if err != nil {
+		return err
+	} else if len(rest) != 0 {
+		return errors.New("trailing garbage after value")
+	}
+	return nil
+}
+
+// Walk from the attestation certificate up to a root. Device attestation
+// certificates are usually not marked as CAs, so signatures are checked
+// directly instead of using x509.Verify.
+func verifyChain(leaf *x509.Certificate, intermediates, roots []*x509.Certificate) error {
+	if len(roots) == 0 {
+		return errors.New("attestation: no attestation roots configured")
+	}
+	cert := leaf
+	for depth := 0; depth < maxChainDepth; depth++ {
+		for _, root := range roots {
+			if bytes.Equal(cert.RawIssuer, root.RawSubject) && checkSignature(cert, root) == nil {
+				return nil
+			}
+		}
+		var next *x509.Certificate
+		for _, candidate := range intermediates {
+			if candidate != cert && bytes.Equal(cert.RawIssuer, candidate.RawSubject) && checkSignature(cert, candidate) == nil {
+				next = candidate
+				break
+			}
+		}
+		if next == nil {
+			break
+		}
+		cert = next
+	}
+	return fmt.Errorf("attestation: certificate `%s` does not chain to a trusted attestation root", x509tools.FormatSubject(leaf))
+}
+
+func checkSignature(cert, issuer *x509.Certificate) error {
+	return issuer.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature)
+}
@@ -0,0 +1,219 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package attestation
+
+// Cloud HSM services built on Marvell (formerly Cavium) LiquidSecurity
+// adapters, including Google Cloud HSM and Azure Managed HSM, attest keys by
+// having the adapter sign a dump of the key object's PKCS#11 attributes. Each
+// record is followed by a 2048-bit RSA PKCS#1 v1.5 signature over SHA-256 of
+// the preceding bytes, made with the adapter's attestation key. The adapter
+// certificate chains to the Marvell root and, for Google, also to a Google
+// root.
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+const (
+	FormatMarvell = "marvell-liquidsecurity"
+
+	// PEM block type used to store attestation records alongside the
+	// adapter's certificate chain
+	PEMTypeHSMAttestation = "HSM ATTESTATION"
+
+	hsmSignatureSize = 256
+)
+
+// PKCS#11 attributes of interest in an attested key object
+const (
+	ckaClass            = 0x000
+	ckaExtractable      = 0x162
+	ckaLocal            = 0x163
+	ckaNeverExtractable = 0x164
+
+	ckoPrivateKey = 3
+)
+
+// MarshalHSM encodes attestation records and the adapter's certificate chain
+// as a PEM bundle suitable for storing in a key's attestation file
+func MarshalHSM(records [][]byte, certs []*x509.Certificate) []byte {
+	var buf bytes.Buffer
+	for _, record := range records {
+		_ = pem.Encode(&buf, &pem.Block{Type: PEMTypeHSMAttestation, Bytes: record})
+	}
+	for _, cert := range certs {
+		_ = pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	}
+	return buf.Bytes()
+}
+
+func isHSMBundle(blob []byte) bool {
+	return bytes.Contains(blob, []byte("-----BEGIN "+PEMTypeHSMAttestation+"-----"))
+}
+
+// verifyHSM checks each record's signature against a certificate in the
+// bundle that chains to one of roots, then reads the private key's attributes
+func verifyHSM(blob []byte, roots []*x509.Certificate, pub crypto.PublicKey) (*Attestation, error) {
+	var records [][]byte
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, blob = pem.Decode(blob)
+		if block == nil {
+			break
+		}
+		switch block.Type {
+		case PEMTypeHSMAttestation:
+			records = append(records, block.Bytes)
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("attestation: %w", err)
+			}
+			certs = append(certs, cert)
+		}
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("attestation: no adapter certificate found in HSM attestation")
+	}
+	var a *Attestation
+	for _, record := range records {
+		signer, err := checkRecord(record, certs)
+		if err != nil {
+			return nil, err
+		}
+		if err := verifyChain(signer, certs, roots); err != nil {
+			return nil, err
+		}
+		body := record[:len(record)-hsmSignatureSize]
+		for _, attrs := range findAttributes(body) {
+			if attrInt(attrs[ckaClass]) != ckoPrivateKey {
+				continue
+			}
+			if pub != nil && !containsPublic(body, pub) {
+				return nil, errors.New("attestation: HSM attestation does not attest to the signing key")
+			}
+			a = &Attestation{
+				Format:      FormatMarvell,
+				Generated:   attrInt(attrs[ckaLocal]) != 0,
+				Exportable:  attrInt(attrs[ckaExtractable]) != 0 || attrInt(attrs[ckaNeverExtractable]) == 0,
+				Certificate: signer,
+			}
+		}
+	}
+	if a == nil {
+		return nil, errors.New("attestation: HSM attestation does not include a private key")
+	}
+	return a, nil
+}
+
+// checkRecord finds the certificate whose key signed the record
+func checkRecord(record []byte, certs []*x509.Certificate) (*x509.Certificate, error) {
+	if len(record) <= hsmSignatureSize {
+		return nil, errors.New("attestation: HSM attestation record is truncated")
+	}
+	split := len(record) - hsmSignatureSize
+	digest := sha256.Sum256(record[:split])
+	for _, cert := range certs {
+		key, ok := cert.PublicKey.(*rsa.PublicKey)
+		if !ok {
+			continue
+		}
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], record[split:]) == nil {
+			return cert, nil
+		}
+	}
+	return nil, errors.New("attestation: HSM attestation record is not signed by any of the included certificates")
+}
+
+// findAttributes locates PKCS#11 attribute lists in a record. The layout of
+// the headers around them differs between adapter firmware versions, so look
+// for runs of well-formed big-endian type-length-value entries instead of
+// relying on fixed offsets.
+func findAttributes(body []byte) []map[uint32][]byte {
+	var lists []map[uint32][]byte
+	for start := 0; start+8 <= len(body); {
+		attrs, end := readAttributes(body[start:])
+		if len(attrs) >= 4 {
+			if _, ok := attrs[ckaClass]; ok {
+				lists = append(lists, attrs)
+				start += end
+				continue
+			}
+		}
+		start++
+	}
+	return lists
+}
+
+func readAttributes(d []byte) (map[uint32][]byte, int) {
+	attrs := make(map[uint32][]byte)
+	pos := 0
+	for pos+8 <= len(d) {
+		typ := binary.BigEndian.Uint32(d[pos:])
+		size := int(binary.BigEndian.Uint32(d[pos+4:]))
+		if typ > 0x1000 && typ&0x80000000 == 0 {
+			// neither a standard nor a vendor-defined attribute
+			break
+		}
+		if size > len(d)-pos-8 || size > 4096 {
+			break
+		}
+		if _, dup := attrs[typ]; dup {
+			break
+		}
+		attrs[typ] = d[pos+8 : pos+8+size]
+		pos += 8 + size
+	}
+	return attrs, pos
+}
+
+func attrInt(v []byte) uint64 {
+	var n uint64
+	for _, b := range v {
+		n = n<<8 | uint64(b)
+	}
+	return n
+}
+
+// containsPublic checks that the public key material appears in the attested
+// attributes
+func containsPublic(body []byte, pub crypto.PublicKey) bool {
+	var raw []byte
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		raw = pub.N.Bytes()
+	case *ecdsa.PublicKey:
+		raw = elliptic.Marshal(pub.Curve, pub.X, pub.Y)
+	case ed25519.PublicKey:
+		raw = pub
+	default:
+		return false
+	}
+	return len(raw) != 0 && bytes.Contains(body, raw)
+}
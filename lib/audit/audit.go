@@ -30,8 +30,10 @@ import (
 	"golang.org/x/crypto/openpgp"
 
 	"github.com/rs/zerolog"
+	"github.com/sassoftware/relic/v7/lib/attestation"
 	"github.com/sassoftware/relic/v7/lib/pgptools"
 	"github.com/sassoftware/relic/v7/lib/pkcs9"
+	"github.com/sassoftware/relic/v7/lib/rekor"
 	"github.com/sassoftware/relic/v7/lib/x509tools"
 )
 
@@ -70,6 +72,28 @@ func (info *Info) SetX509Cert(cert *x509.Certificate) {
 	info.Attributes["sig.x509.fingerprint"] = fmt.Sprintf("%x", d.Sum(nil))
 }
 
+// Record the verified hardware attestation of the signing key
+func (info *Info) SetAttestation(a *attestation.Attestation) {
+	info.Attributes["sig.attest.format"] = a.Format
+	if a.Serial != nil {
+		info.Attributes["sig.attest.serial"] = a.Serial.String()
+	}
+	info.Attributes["sig.attest.firmware"] = a.Firmware
+	info.Attributes["sig.attest.hardware"] = a.HardwareBacked()
+}
+
+// Record the transparency log entry for the signature
+func (info *Info) SetTransparencyLog(url string, e *rekor.Entry) {
+	info.Attributes["sig.tlog.url"] = url
+	info.Attributes["sig.tlog.uuid"] = e.UUID
+	info.Attributes["sig.tlog.index"] = e.LogIndex
+	info.Attributes["sig.tlog.time"] = e.IntegratedTime
+	info.Attributes["sig.tlog.kind"] = e.Kind
+	if e.InclusionProof != nil {
+		info.Attributes["sig.tlog.proof"] = e.InclusionProof
+	}
+}
+
 // Override the default timestamp for this audit record
 func (info *Info) SetTimestamp(t time.Time) {
 	info.Attributes["sig.timestamp"] = t.UTC()
@@ -42,7 +42,7 @@ func makePeIndirect(imprint []byte, hash crypto.Hash, oid asn1.ObjectIdentifier)
 }
 
 func signIndirect(ctx context.Context, indirect interface{}, hash crypto.Hash, cert *certloader.Certificate) (*pkcs9.TimestampedSignature, error) {
-	sig := pkcs7.NewBuilder(cert.Signer(), cert.Chain(), hash)
+	sig := pkcs7.NewBuilder(cert.Signer(), cert.AuthenticodeChain(), hash)
 	if err := sig.SetContent(OidSpcIndirectDataContent, indirect); err != nil {
 		return nil, err
 	}
@@ -53,6 +53,9 @@ func signIndirect(ctx context.Context, indirect interface{}, hash crypto.Hash, c
 	if err != nil {
 		return nil, err
 	}
+	if err := cert.AttachRevocationInfo(psd); err != nil {
+		return nil, err
+	}
 	return pkcs9.TimestampAndMarshal(ctx, psd, cert.Timestamper, true)
 }
 
@@ -67,14 +70,22 @@ func addOpusAttrs(sig *pkcs7.SignatureBuilder) error {
 }
 
 func SignSip(ctx context.Context, imprint []byte, hash crypto.Hash, sipInfo SpcSipInfo, cert *certloader.Certificate) (*pkcs9.TimestampedSignature, error) {
+	indirect, err := makeSipIndirect(imprint, hash, sipInfo)
+	if err != nil {
+		return nil, err
+	}
+	return signIndirect(ctx, indirect, hash, cert)
+}
+
+func makeSipIndirect(imprint []byte, hash crypto.Hash, sipInfo SpcSipInfo) (indirect SpcIndirectDataContentMsi, err error) {
 	alg, ok := x509tools.PkixDigestAlgorithm(hash)
 	if !ok {
-		return nil, errors.New("unsupported digest algorithm")
+		err = errors.New("unsupported digest algorithm")
+		return
 	}
-	var indirect SpcIndirectDataContentMsi
 	indirect.Data.Type = OidSpcSipInfo
 	indirect.Data.Value = sipInfo
 	indirect.MessageDigest.Digest = imprint
 	indirect.MessageDigest.DigestAlgorithm = alg
-	return signIndirect(ctx, indirect, hash, cert)
+	return
 }
@@ -17,6 +17,7 @@
 package authenticode
 
 import (
+	"bytes"
 	"context"
 	"crypto"
 	"crypto/x509/pkix"
@@ -24,6 +25,7 @@ import (
 	"encoding/binary"
 	"encoding/hex"
 	"errors"
+	"io"
 	"time"
 	"unicode/utf16"
 
@@ -39,8 +41,12 @@ type Catalog struct {
 	Version                  int
 	Hash                     crypto.Hash
 	Sha1Entries, Sha2Entries []CertTrustEntry
+	Attributes               []CertTrustValue
 }
 
+// Flags used by MakeCat for name-value attributes
+const catalogAttrFlags = 0x10010001
+
 func NewCatalog(hash crypto.Hash) *Catalog {
 	if hash == crypto.SHA1 {
 		return &Catalog{Version: 1, Hash: hash}
@@ -60,7 +66,23 @@ func (cat *Catalog) makeCatalog() CertTrustList {
 		EffectiveDate:    time.Now().UTC(),
 		SubjectAlgorithm: pkix.AlgorithmIdentifier{Algorithm: memberOid, Parameters: asn1.NullRawValue},
 		Entries:          append(cat.Sha2Entries, cat.Sha1Entries...),
+		Attributes:       cat.Attributes,
+	}
+}
+
+// ContentInfo returns the unsigned catalog
+func (cat *Catalog) ContentInfo() (pkcs7.ContentInfo, error) {
+	return pkcs7.NewContentInfo(OidCertTrustList, cat.makeCatalog())
+}
+
+// SetAttribute adds a catalog-wide attribute such as OSAttr
+func (cat *Catalog) SetAttribute(name, value string) error {
+	attr, err := nameValue(name, value)
+	if err != nil {
+		return err
 	}
+	cat.Attributes = append(cat.Attributes, attr)
+	return nil
 }
 
 func (cat *Catalog) Marshal() ([]byte, error) {
@@ -68,7 +90,7 @@ func (cat *Catalog) Marshal() ([]byte, error) {
 }
 
 func (cat *Catalog) Sign(ctx context.Context, cert *certloader.Certificate) (*pkcs9.TimestampedSignature, error) {
-	sig := pkcs7.NewBuilder(cert.Signer(), cert.Chain(), cat.Hash)
+	sig := pkcs7.NewBuilder(cert.Signer(), cert.AuthenticodeChain(), cat.Hash)
 	if err := sig.SetContent(OidCertTrustList, cat.makeCatalog()); err != nil {
 		return nil, err
 	}
@@ -79,23 +101,63 @@ func (cat *Catalog) Sign(ctx context.Context, cert *certloader.Certificate) (*pk
 	if err != nil {
 		return nil, err
 	}
+	if err := cert.AttachRevocationInfo(psd); err != nil {
+		return nil, err
+	}
 	return pkcs9.TimestampAndMarshal(ctx, psd, cert.Timestamper, true)
 }
 
 func (cat *Catalog) Add(indirect SpcIndirectDataContentPe) error {
-	sha2 := !indirect.MessageDigest.DigestAlgorithm.Algorithm.Equal(x509tools.OidDigestSHA1)
-	if sha2 && cat.Version == 1 {
-		return errors.New("can't add SHA2 digest to v1 catalog")
+	return cat.add(indirect, nil)
+}
+
+// AddFile adds a member with a File attribute naming it. A member with the
+// same digest as an existing one is skipped.
+func (cat *Catalog) AddFile(name string, indirect SpcIndirectDataContentPe) error {
+	tag := indirect.MessageDigest.Digest
+	if cat.Version == 1 {
+		tag = tagV1(tag)
+	}
+	for _, entry := range append(cat.Sha2Entries, cat.Sha1Entries...) {
+		if bytes.Equal(entry.Tag, tag) {
+			return nil
+		}
+	}
+	attr, err := nameValue("File", name)
+	if err != nil {
+		return err
 	}
+	return cat.add(indirect, []CertTrustValue{attr})
+}
+
+func (cat *Catalog) add(indirect SpcIndirectDataContentPe, attrs []CertTrustValue) error {
 	indirectBytes, err := asn1.Marshal(indirect)
 	if err != nil {
 		return err
 	}
+	return cat.addIndirect(indirectBytes, indirect.MessageDigest, indirect.Data.Type, attrs)
+}
+
+// addIndirect adds a member given its marshalled indirect data, which may be
+// for a PE image, a flat file or a SIP
+func (cat *Catalog) addIndirect(indirectBytes []byte, digest DigestInfo, dataType asn1.ObjectIdentifier, attrs []CertTrustValue) error {
+	sha2 := !digest.DigestAlgorithm.Algorithm.Equal(x509tools.OidDigestSHA1)
+	if sha2 && cat.Version == 1 {
+		return errors.New("can't add SHA2 digest to v1 catalog")
+	}
 	indirectEntry := CertTrustValue{Attribute: OidSpcIndirectDataContent, Value: makeSet(indirectBytes)}
-	value := indirect.MessageDigest.Digest
+	value := digest.Digest
 	if cat.Version == 1 {
+		classID := CryptSipFlatFile
+		switch {
+		case dataType.Equal(OidSpcPeImageData):
+			classID = CryptSipCreateIndirectData
+		case dataType.Equal(OidSpcSipInfo):
+			// PowerShell scripts are the only SIP members
+			classID = CryptSipPowershell
+		}
 		memberInfo := CertTrustMemberInfoV1{
-			ClassID:  x509tools.ToBMPString(CryptSipCreateIndirectData),
+			ClassID:  x509tools.ToBMPString(classID),
 			Unknown1: 512,
 		}
 		memberInfoEnc, err := asn1.Marshal(memberInfo)
@@ -105,7 +167,7 @@ func (cat *Catalog) Add(indirect SpcIndirectDataContentPe) error {
 		catValue := CertTrustValue{Attribute: OidCatalogMemberInfo, Value: makeSet(memberInfoEnc)}
 		cat.Sha1Entries = append(cat.Sha1Entries, CertTrustEntry{
 			Tag:    tagV1(value),
-			Values: []CertTrustValue{indirectEntry, catValue},
+			Values: append([]CertTrustValue{indirectEntry, catValue}, attrs...),
 		})
 	} else {
 		// this supposed to always be empty?
@@ -114,18 +176,52 @@ func (cat *Catalog) Add(indirect SpcIndirectDataContentPe) error {
 		if sha2 {
 			cat.Sha2Entries = append(cat.Sha2Entries, CertTrustEntry{
 				Tag:    value,
-				Values: []CertTrustValue{catValue, indirectEntry},
+				Values: append([]CertTrustValue{catValue, indirectEntry}, attrs...),
 			})
 		} else {
 			cat.Sha1Entries = append(cat.Sha1Entries, CertTrustEntry{
 				Tag:    value,
-				Values: []CertTrustValue{catValue},
+				Values: append([]CertTrustValue{catValue}, attrs...),
 			})
 		}
 	}
 	return nil
 }
 
+// DigestCatalogMember computes the indirect data for a catalog member. PE
+// files are digested with Authenticode and anything else as a flat file.
+func DigestCatalogMember(r io.ReadSeeker, hash crypto.Hash) (SpcIndirectDataContentPe, error) {
+	if digest, err := DigestPE(r, hash, false); err == nil {
+		return digest.GetIndirect()
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return SpcIndirectDataContentPe{}, err
+	}
+	d := hash.New()
+	if _, err := io.Copy(d, r); err != nil {
+		return SpcIndirectDataContentPe{}, err
+	}
+	return makePeIndirect(d.Sum(nil), hash, OidSpcCabImageData)
+}
+
+func nameValue(name, value string) (CertTrustValue, error) {
+	// the value is NUL-terminated UTF-16-LE
+	runes := utf16.Encode([]rune(value + "\x00"))
+	encoded := make([]byte, 2*len(runes))
+	for i, r := range runes {
+		binary.LittleEndian.PutUint16(encoded[i*2:], r)
+	}
+	nv, err := asn1.Marshal(CatalogNameValue{
+		Name:  x509tools.ToBMPString(name),
+		Flags: catalogAttrFlags,
+		Value: encoded,
+	})
+	if err != nil {
+		return CertTrustValue{}, err
+	}
+	return CertTrustValue{Attribute: OidCatalogNameValue, Value: makeSet(nv)}, nil
+}
+
 func tagV1(value []byte) []byte {
 	// The tag is a UTF-16-LE encoding of the hex of the imprint
 	runes := utf16.Encode([]rune(hex.EncodeToString(value)))
@@ -0,0 +1,240 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package authenticode
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/sassoftware/relic/v7/lib/pkcs7"
+	"github.com/sassoftware/relic/v7/lib/pkcs9"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+)
+
+// PowerShell module catalogs, as made by New-FileCatalog and checked by
+// Test-FileCatalog, name each member with a FilePath attribute holding its
+// path relative to the module directory. Every file in the module except the
+// catalog itself must be listed.
+const moduleFilePathAttr = "FilePath"
+
+// ModuleFiles lists the files in a PowerShell module directory as
+// slash-separated paths relative to it, leaving out the catalog
+func ModuleFiles(dir, catalog string) ([]string, error) {
+	catalog, err := filepath.Abs(catalog)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	err = filepath.Walk(dir, func(fp string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		if abs, err := filepath.Abs(fp); err != nil {
+			return err
+		} else if abs == catalog {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, fp)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+// NewModuleCatalog builds an unsigned catalog of the given files in a
+// PowerShell module directory. Scripts are digested the same way as when they
+// are signed, so signing them doesn't change their catalog entry.
+func NewModuleCatalog(dir string, files []string, hash crypto.Hash) (*Catalog, error) {
+	cat := NewCatalog(hash)
+	for _, name := range files {
+		indirect, digest, dataType, err := digestModuleFile(filepath.Join(dir, filepath.FromSlash(name)), hash)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		attr, err := nameValue(moduleFilePathAttr, modulePath(name))
+		if err != nil {
+			return nil, err
+		}
+		// unlike AddFile, identical files each get an entry so that every
+		// path is listed
+		if err := cat.addIndirect(indirect, digest, dataType, []CertTrustValue{attr}); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return cat, nil
+}
+
+func digestModuleFile(fp string, hash crypto.Hash) ([]byte, DigestInfo, asn1.ObjectIdentifier, error) {
+	f, err := os.Open(fp)
+	if err != nil {
+		return nil, DigestInfo{}, nil, err
+	}
+	defer f.Close()
+	if style, ok := GetSigStyle(fp); ok {
+		pd, err := DigestPowershell(f, style, hash)
+		if err != nil {
+			return nil, DigestInfo{}, nil, err
+		}
+		indirect, err := makeSipIndirect(pd.Imprint, hash, psSipInfo)
+		if err != nil {
+			return nil, DigestInfo{}, nil, err
+		}
+		blob, err := asn1.Marshal(indirect)
+		return blob, indirect.MessageDigest, indirect.Data.Type, err
+	}
+	indirect, err := DigestCatalogMember(f, hash)
+	if err != nil {
+		return nil, DigestInfo{}, nil, err
+	}
+	blob, err := asn1.Marshal(indirect)
+	return blob, indirect.MessageDigest, indirect.Data.Type, err
+}
+
+// VerifyModuleCatalog checks the signature on a PowerShell module catalog and
+// then checks it against the module files the way Test-FileCatalog does:
+// every file must be listed with a matching digest, and every listed file
+// must exist.
+func VerifyModuleCatalog(blob []byte, dir string, files []string, skipDigests bool) (*pkcs9.TimestampedSignature, error) {
+	psd, err := pkcs7.Unmarshal(blob)
+	if err != nil {
+		return nil, err
+	}
+	if !psd.Content.ContentInfo.ContentType.Equal(OidCertTrustList) {
+		return nil, errors.New("not a security catalog")
+	}
+	sig, err := psd.Content.Verify(nil, skipDigests)
+	if err != nil {
+		return nil, err
+	}
+	ts, err := pkcs9.VerifyOptionalTimestamp(sig)
+	if err != nil {
+		return nil, err
+	}
+	if skipDigests {
+		return &ts, nil
+	}
+	var ctl CertTrustList
+	if err := psd.Content.ContentInfo.Unmarshal(&ctl); err != nil {
+		return nil, fmt.Errorf("security catalog: %w", err)
+	}
+	listed, err := moduleCatalogMembers(ctl)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range files {
+		digest, ok := listed[modulePath(name)]
+		if !ok {
+			return nil, fmt.Errorf("%s: file is not in the catalog", name)
+		}
+		delete(listed, modulePath(name))
+		hash, ok := x509tools.PkixDigestToHash(digest.DigestAlgorithm)
+		if !ok {
+			return nil, fmt.Errorf("%s: unsupported digest algorithm", name)
+		}
+		_, actual, _, err := digestModuleFile(filepath.Join(dir, filepath.FromSlash(name)), hash)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if !bytes.Equal(actual.Digest, digest.Digest) {
+			return nil, fmt.Errorf("%s: digest mismatch", name)
+		}
+	}
+	if len(listed) != 0 {
+		var missing []string
+		for name := range listed {
+			missing = append(missing, name)
+		}
+		sort.Strings(missing)
+		return nil, fmt.Errorf("catalog lists files that are missing: %s", strings.Join(missing, ", "))
+	}
+	return &ts, nil
+}
+
+// map each FilePath in a catalog to the digest of that member
+func moduleCatalogMembers(ctl CertTrustList) (map[string]DigestInfo, error) {
+	listed := make(map[string]DigestInfo)
+	for _, entry := range ctl.Entries {
+		var path string
+		var digest *DigestInfo
+		for _, value := range entry.Values {
+			switch {
+			case value.Attribute.Equal(OidSpcIndirectDataContent):
+				var indirect struct {
+					Data          asn1.RawValue
+					MessageDigest DigestInfo
+				}
+				if _, err := asn1.Unmarshal(value.Value.Bytes, &indirect); err != nil {
+					return nil, fmt.Errorf("security catalog: %w", err)
+				}
+				digest = &indirect.MessageDigest
+			case value.Attribute.Equal(OidCatalogNameValue):
+				var nv CatalogNameValue
+				if _, err := asn1.Unmarshal(value.Value.Bytes, &nv); err != nil {
+					return nil, fmt.Errorf("security catalog: %w", err)
+				}
+				if fromBMP(nv.Name.Bytes) == moduleFilePathAttr {
+					path = fromUtf16LE(nv.Value)
+				}
+			}
+		}
+		if path == "" {
+			continue
+		}
+		if digest == nil {
+			return nil, fmt.Errorf("security catalog: %s has no digest", path)
+		}
+		listed[path] = *digest
+	}
+	return listed, nil
+}
+
+// catalogs use Windows path separators
+func modulePath(name string) string {
+	return strings.ReplaceAll(name, "/", `\`)
+}
+
+func fromBMP(b []byte) string {
+	runes := make([]uint16, len(b)/2)
+	for i := range runes {
+		runes[i] = binary.BigEndian.Uint16(b[i*2:])
+	}
+	return string(utf16.Decode(runes))
+}
+
+func fromUtf16LE(b []byte) string {
+	runes := make([]uint16, len(b)/2)
+	for i := range runes {
+		runes[i] = binary.LittleEndian.Uint16(b[i*2:])
+	}
+	return strings.TrimRight(string(utf16.Decode(runes)), "\x00")
+}
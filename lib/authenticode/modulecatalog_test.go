@@ -0,0 +1,103 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package authenticode_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sassoftware/relic/v7/internal/testcert"
+	"github.com/sassoftware/relic/v7/lib/authenticode"
+)
+
+func writeModule(t *testing.T) string {
+	dir := t.TempDir()
+	for name, contents := range map[string]string{
+		"Demo.psd1":            "@{ RootModule = 'Demo.psm1' }\r\n",
+		"Demo.psm1":            "function Get-Demo { 'demo' }\r\n",
+		"en-US/about_Demo.txt": "about\r\n",
+		"lib/empty.txt":        "",
+		"lib/also-empty.txt":   "",
+	} {
+		fp := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(fp), 0755))
+		require.NoError(t, os.WriteFile(fp, []byte(contents), 0644))
+	}
+	return dir
+}
+
+func TestModuleCatalog(t *testing.T) {
+	dir := writeModule(t)
+	catalog := filepath.Join(dir, "Demo.cat")
+	require.NoError(t, os.WriteFile(catalog, []byte("old catalog"), 0644))
+	files, err := authenticode.ModuleFiles(dir, catalog)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Demo.psd1", "Demo.psm1", "en-US/about_Demo.txt", "lib/also-empty.txt", "lib/empty.txt"}, files)
+
+	cat, err := authenticode.NewModuleCatalog(dir, files, crypto.SHA256)
+	require.NoError(t, err)
+	// identical files are listed separately
+	assert.Len(t, cat.Sha2Entries, len(files))
+
+	// signing a script afterwards doesn't change its digest
+	script := filepath.Join(dir, "Demo.psm1")
+	f, err := os.OpenFile(script, os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.WriteString("\r\n# SIG # Begin signature block\r\n# AAAA\r\n# SIG # End signature block\r\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	cert := testcert.Signer(t, &x509.Certificate{Subject: pkix.Name{CommonName: "module signer"}}, testcert.ECDSAKey(t))
+	ts, err := cat.Sign(context.Background(), cert)
+	require.NoError(t, err)
+	_, err = authenticode.VerifyModuleCatalog(ts.Raw, dir, files, false)
+	require.NoError(t, err)
+
+	// changed, added and removed files are all caught
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "lib", "empty.txt"), []byte("changed"), 0644))
+	_, err = authenticode.VerifyModuleCatalog(ts.Raw, dir, files, false)
+	assert.EqualError(t, err, "lib/empty.txt: digest mismatch")
+	_, err = authenticode.VerifyModuleCatalog(ts.Raw, dir, append(files, "extra.ps1"), false)
+	assert.EqualError(t, err, "lib/empty.txt: digest mismatch")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "lib", "empty.txt"), nil, 0644))
+	_, err = authenticode.VerifyModuleCatalog(ts.Raw, dir, append(files, "extra.ps1"), false)
+	assert.EqualError(t, err, "extra.ps1: file is not in the catalog")
+	_, err = authenticode.VerifyModuleCatalog(ts.Raw, dir, files[1:], false)
+	assert.EqualError(t, err, `catalog lists files that are missing: Demo.psd1`)
+}
+
+func TestModuleCatalogV1(t *testing.T) {
+	dir := writeModule(t)
+	files, err := authenticode.ModuleFiles(dir, filepath.Join(dir, "Demo.cat"))
+	require.NoError(t, err)
+	cat, err := authenticode.NewModuleCatalog(dir, files, crypto.SHA1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, cat.Version)
+	cert := testcert.Signer(t, &x509.Certificate{Subject: pkix.Name{CommonName: "module signer"}}, testcert.ECDSAKey(t))
+	ts, err := cat.Sign(context.Background(), cert)
+	require.NoError(t, err)
+	_, err = authenticode.VerifyModuleCatalog(ts.Raw, dir, files, false)
+	require.NoError(t, err)
+}
@@ -0,0 +1,183 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package authenticode
+
+// Installer packages, patches (.msp) and transforms (.mst) are all compound
+// documents that are digested and signed the same way. They are told apart by
+// the CLSID of the root storage, and describe what they apply to in the
+// summary information stream.
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"strings"
+
+	"github.com/sassoftware/relic/v7/lib/comdoc"
+)
+
+// Kind of Windows Installer database
+type MSIKind int
+
+const (
+	MSIKindUnknown MSIKind = iota
+	MSIKindPackage
+	MSIKindPatch
+	MSIKindTransform
+)
+
+const (
+	msiSummaryInfo = "\x05SummaryInformation"
+
+	// summary information property IDs
+	pidTitle          = 2
+	pidSubject        = 3
+	pidTemplate       = 7
+	pidRevisionNumber = 9
+
+	vtLPSTR = 0x1e
+)
+
+// root storage CLSIDs, {000C10xx-0000-0000-C000-000000000046}
+var msiKindCLSIDs = map[MSIKind][]byte{
+	MSIKindPackage:   {0x84, 0x10, 0x0c, 0x00, 0x00, 0x00, 0x00, 0x00, 0xc0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x46},
+	MSIKindPatch:     {0x86, 0x10, 0x0c, 0x00, 0x00, 0x00, 0x00, 0x00, 0xc0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x46},
+	MSIKindTransform: {0x82, 0x10, 0x0c, 0x00, 0x00, 0x00, 0x00, 0x00, 0xc0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x46},
+}
+
+func (k MSIKind) String() string {
+	switch k {
+	case MSIKindPackage:
+		return "msi"
+	case MSIKindPatch:
+		return "msp"
+	case MSIKindTransform:
+		return "mst"
+	}
+	return "unknown"
+}
+
+func msiKindByCLSID(clsid []byte) MSIKind {
+	for kind, value := range msiKindCLSIDs {
+		if bytes.Equal(clsid, value) {
+			return kind
+		}
+	}
+	return MSIKindUnknown
+}
+
+// MSIInfo describes a Windows Installer database from its root storage and
+// summary information
+type MSIInfo struct {
+	Kind     MSIKind
+	Title    string
+	Subject  string
+	Template string
+	// For patches, the patch code followed by the codes of obsoleted patches.
+	// For transforms, the product codes and versions of the target and upgrade.
+	RevisionNumber string
+}
+
+// PatchCode returns the GUID identifying a patch
+func (i *MSIInfo) PatchCode() string {
+	if i.Kind != MSIKindPatch || len(i.RevisionNumber) < 38 {
+		return ""
+	}
+	return i.RevisionNumber[:38]
+}
+
+// Targets returns the product codes a patch applies to, or the platform and
+// languages a transform applies to
+func (i *MSIInfo) Targets() []string {
+	switch i.Kind {
+	case MSIKindPatch:
+		return strings.Split(i.Template, ";")
+	case MSIKindTransform:
+		return []string{i.Template}
+	}
+	return nil
+}
+
+// ReadMSIInfo identifies a Windows Installer database and reads its summary
+// information
+func ReadMSIInfo(cdf *comdoc.ComDoc) (*MSIInfo, error) {
+	root := cdf.RootStorage()
+	info := &MSIInfo{Kind: msiKindByCLSID(root.UID[:])}
+	files, err := cdf.ListDir(nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range files {
+		if item.Type != comdoc.DirStream || item.Name() != msiSummaryInfo {
+			continue
+		}
+		r, err := cdf.ReadStream(item)
+		if err != nil {
+			return nil, err
+		}
+		blob, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		// a malformed summary doesn't affect the signature
+		_ = info.parseSummary(blob)
+	}
+	return info, nil
+}
+
+// Parse the string properties of a summary information property set
+func (i *MSIInfo) parseSummary(blob []byte) error {
+	// PropertySetStream header followed by the FMTID and offset of the first
+	// property set
+	if len(blob) < 48 || binary.LittleEndian.Uint16(blob) != 0xfffe {
+		return errors.New("invalid summary information stream")
+	}
+	start := int(binary.LittleEndian.Uint32(blob[44:]))
+	if start+8 > len(blob) {
+		return errors.New("invalid summary information stream")
+	}
+	set := blob[start:]
+	count := int(binary.LittleEndian.Uint32(set[4:]))
+	if 8+count*8 > len(set) {
+		return errors.New("invalid summary information property set")
+	}
+	for n := 0; n < count; n++ {
+		entry := set[8+n*8:]
+		pid := binary.LittleEndian.Uint32(entry)
+		offset := int(binary.LittleEndian.Uint32(entry[4:]))
+		if offset+8 > len(set) || binary.LittleEndian.Uint16(set[offset:]) != vtLPSTR {
+			continue
+		}
+		size := int(binary.LittleEndian.Uint32(set[offset+4:]))
+		if offset+8+size > len(set) {
+			return errors.New("invalid summary information property")
+		}
+		value := string(bytes.TrimRight(set[offset+8:offset+8+size], "\x00"))
+		switch pid {
+		case pidTitle:
+			i.Title = value
+		case pidSubject:
+			i.Subject = value
+		case pidTemplate:
+			i.Template = value
+		case pidRevisionNumber:
+			i.RevisionNumber = value
+		}
+	}
+	return nil
+}
@@ -44,3 +44,14 @@ func InsertMSISignature(cdf *comdoc.ComDoc, pkcs, exsig []byte) error {
 	}
 	return cdf.AddFile(msiDigitalSignature, pkcs)
 }
+
+// Remove the signature and extended signature blobs from an open MSI file
+func RemoveMSISignature(cdf *comdoc.ComDoc) error {
+	if _, _, err := ReadMSISignature(cdf); err != nil {
+		return err
+	}
+	if err := cdf.DeleteFile(msiDigitalSignatureEx); err != nil {
+		return err
+	}
+	return cdf.DeleteFile(msiDigitalSignature)
+}
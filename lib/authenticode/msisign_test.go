@@ -0,0 +1,84 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package authenticode_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sassoftware/relic/v7/internal/testcert"
+	"github.com/sassoftware/relic/v7/lib/authenticode"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/comdoc"
+	"github.com/sassoftware/relic/v7/signers/sigerrors"
+)
+
+// sign an MSI in place, nesting the signature in the existing one if there is
+// one
+func signMSI(t *testing.T, path string, hash crypto.Hash, cert *certloader.Certificate) {
+	cdf, err := comdoc.WritePath(path)
+	require.NoError(t, err)
+	primary, exsig, err := authenticode.ReadMSISignature(cdf)
+	if !errors.As(err, new(sigerrors.NotSignedError)) {
+		require.NoError(t, err)
+	}
+	imprint, prehash, err := authenticode.DigestMSI(cdf, hash, primary == nil || exsig != nil)
+	require.NoError(t, err)
+	if primary != nil {
+		// the existing MsiDigitalSignatureEx stream is kept
+		prehash = exsig
+	}
+	ts, err := authenticode.SignMSIImprint(context.Background(), imprint, hash, cert)
+	require.NoError(t, err)
+	sig := ts.Raw
+	if primary != nil {
+		sig, err = authenticode.AppendSignature(primary, sig)
+		require.NoError(t, err)
+	}
+	require.NoError(t, authenticode.InsertMSISignature(cdf, sig, prehash))
+	require.NoError(t, cdf.Close())
+}
+
+func TestMSIAppendSignature(t *testing.T) {
+	orig, err := os.ReadFile("../../functest/packages/dummy.msi")
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "dummy.msi")
+	require.NoError(t, os.WriteFile(path, orig, 0644))
+	first := testcert.Signer(t, &x509.Certificate{Subject: pkix.Name{CommonName: "first"}}, testcert.ECDSAKey(t))
+	second := testcert.Signer(t, &x509.Certificate{Subject: pkix.Name{CommonName: "second"}}, testcert.ECDSAKey(t))
+
+	signMSI(t, path, crypto.SHA256, first)
+	signMSI(t, path, crypto.SHA256, second)
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	sig, err := authenticode.VerifyMSI(f, false)
+	require.NoError(t, err)
+	assert.Equal(t, "first", sig.Certificate.Subject.CommonName)
+	require.Len(t, sig.Nested, 1)
+	assert.Equal(t, "second", sig.Nested[0].Certificate.Subject.CommonName)
+	assert.Equal(t, crypto.SHA256, sig.Nested[0].HashFunc)
+}
@@ -51,37 +51,55 @@ func MsiToTar(cdf *comdoc.ComDoc, w io.Writer) error {
 	return tw.Close()
 }
 
-// Digset a tarball produced by MsiToTar
-func DigestMsiTar(r io.Reader, hash crypto.Hash, extended bool) ([]byte, error) {
+// Digset a tarball produced by MsiToTar. The kind and summary information of
+// the database are collected along the way.
+func DigestMsiTar(r io.Reader, hash crypto.Hash, extended bool) ([]byte, *MSIInfo, error) {
 	tr := tar.NewReader(r)
 	d := hash.New()
+	info := new(MSIInfo)
 	for {
 		hdr, err := tr.Next()
 		if err == io.EOF {
 			break
 		} else if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
-		if hdr.Name == msiTarExMeta {
+		switch hdr.Name {
+		case msiTarExMeta:
 			if !extended {
 				continue
 			}
 			exmeta, err := ioutil.ReadAll(tr)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 			d2 := hash.New()
 			d2.Write(exmeta)
 			prehash := d2.Sum(nil)
 			d.Write(prehash)
-		} else if hdr.Name == msiDigitalSignature || hdr.Name == msiDigitalSignatureEx {
+			continue
+		case msiDigitalSignature, msiDigitalSignatureEx:
+			continue
+		case msiTarStorageUID, msiSummaryInfo:
+			// root storage only
+			blob, err := ioutil.ReadAll(tr)
+			if err != nil {
+				return nil, nil, err
+			}
+			if hdr.Name == msiTarStorageUID {
+				info.Kind = msiKindByCLSID(blob)
+			} else {
+				// only used for auditing, so don't let it stop signing
+				_ = info.parseSummary(blob)
+			}
+			d.Write(blob)
 			continue
 		}
 		if _, err := io.Copy(d, tr); err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 	}
-	return d.Sum(nil), nil
+	return d.Sum(nil), info, nil
 }
 
 // Add a file with contents blob to an open tar.Writer
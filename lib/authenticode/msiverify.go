@@ -38,19 +38,36 @@ type MSISignature struct {
 	pkcs9.TimestampedSignature
 	Indirect *SpcIndirectDataContentMsi
 	HashFunc crypto.Hash
+	Info     *MSIInfo
+	// signatures nested inside this one
+	Nested []*MSISignature
 }
 
-// Extract and verify the signature of a MSI file. Does not check X509 chains.
+// Extract and verify the signature of a MSI, MSP or MST file. Does not check
+// X509 chains.
 func VerifyMSI(f io.ReaderAt, skipDigests bool) (*MSISignature, error) {
 	cdf, err := comdoc.ReadFile(f)
 	if err != nil {
 		return nil, err
 	}
-	var sig, exsig []byte
-	files, err := cdf.ListDir(nil)
+	sig, exsig, err := ReadMSISignature(cdf)
 	if err != nil {
 		return nil, err
 	}
+	info, err := ReadMSIInfo(cdf)
+	if err != nil {
+		return nil, err
+	}
+	return checkMSISignature(cdf, sig, exsig, info, skipDigests)
+}
+
+// ReadMSISignature returns the contents of the DigitalSignature and
+// MsiDigitalSignatureEx streams. exsig is nil if the latter is absent.
+func ReadMSISignature(cdf *comdoc.ComDoc) (sig, exsig []byte, err error) {
+	files, err := cdf.ListDir(nil)
+	if err != nil {
+		return nil, nil, err
+	}
 	for _, item := range files {
 		name := item.Name()
 		if name == msiDigitalSignature {
@@ -59,7 +76,7 @@ func VerifyMSI(f io.ReaderAt, skipDigests bool) (*MSISignature, error) {
 				sig, err = ioutil.ReadAll(r)
 			}
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 		} else if name == msiDigitalSignatureEx {
 			r, err := cdf.ReadStream(item)
@@ -67,13 +84,20 @@ func VerifyMSI(f io.ReaderAt, skipDigests bool) (*MSISignature, error) {
 				exsig, err = ioutil.ReadAll(r)
 			}
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 		}
 	}
 	if len(sig) == 0 {
-		return nil, sigerrors.NotSignedError{Type: "MSI"}
+		return nil, nil, sigerrors.NotSignedError{Type: "MSI"}
 	}
+	return sig, exsig, nil
+}
+
+// verify one signature and any signatures nested inside it. There is only one
+// MsiDigitalSignatureEx stream, so nested signatures can only include it if
+// they use the same digest algorithm as the primary signature.
+func checkMSISignature(cdf *comdoc.ComDoc, sig, exsig []byte, info *MSIInfo, skipDigests bool) (*MSISignature, error) {
 	psd, err := pkcs7.Unmarshal(sig)
 	if err != nil {
 		return nil, err
@@ -101,6 +125,7 @@ func VerifyMSI(f io.ReaderAt, skipDigests bool) (*MSISignature, error) {
 		TimestampedSignature: ts,
 		Indirect:             indirect,
 		HashFunc:             hash,
+		Info:                 info,
 	}
 	if !skipDigests {
 		imprint, prehash, err := DigestMSI(cdf, hash, exsig != nil)
@@ -114,6 +139,17 @@ func VerifyMSI(f io.ReaderAt, skipDigests bool) (*MSISignature, error) {
 			return nil, fmt.Errorf("MSI digest mismatch: %x != %x", imprint, indirect.MessageDigest.Digest)
 		}
 	}
+	nested, err := nestedSignatures(psd)
+	if err != nil {
+		return nil, err
+	}
+	for _, der := range nested {
+		nestedSig, err := checkMSISignature(cdf, der, exsig, info, skipDigests)
+		if err != nil {
+			return nil, fmt.Errorf("nested signature: %w", err)
+		}
+		msisig.Nested = append(msisig.Nested, nestedSig)
+	}
 	return msisig, nil
 }
 
@@ -0,0 +1,63 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package authenticode
+
+import (
+	"encoding/asn1"
+	"errors"
+	"fmt"
+
+	"github.com/sassoftware/relic/v7/lib/pkcs7"
+)
+
+// AppendSignature nests a signature inside an existing one, the way signtool
+// /as does. The nested signature goes in an unauthenticated attribute of the
+// primary signer, so the primary signature and its timestamp stay valid.
+func AppendSignature(primary, nested []byte) ([]byte, error) {
+	psd, err := pkcs7.Unmarshal(primary)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshaling existing signature: %w", err)
+	}
+	if len(psd.Content.SignerInfos) != 1 {
+		return nil, errors.New("existing signature must have exactly one signer")
+	}
+	si := &psd.Content.SignerInfos[0]
+	if err := si.UnauthenticatedAttributes.Add(OidSpcNestedSignature, asn1.RawValue{FullBytes: nested}); err != nil {
+		return nil, err
+	}
+	// don't reuse the original encoding of the signer info
+	si.RawContent = nil
+	return psd.Marshal()
+}
+
+// nestedSignatures returns the raw signatures nested inside a signature
+func nestedSignatures(psd *pkcs7.ContentInfoSignedData) ([][]byte, error) {
+	var ret [][]byte
+	for _, si := range psd.Content.SignerInfos {
+		var values []asn1.RawValue
+		if err := si.UnauthenticatedAttributes.GetAll(OidSpcNestedSignature, &values); err != nil {
+			if _, ok := err.(pkcs7.ErrNoAttribute); ok {
+				continue
+			}
+			return nil, fmt.Errorf("unmarshaling nested signatures: %w", err)
+		}
+		for _, value := range values {
+			ret = append(ret, value.FullBytes)
+		}
+	}
+	return ret, nil
+}
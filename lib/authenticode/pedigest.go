@@ -38,6 +38,8 @@ type PEDigest struct {
 	PageHashes []byte
 	Hash       crypto.Hash
 	markers    *peHeaderValues
+	// existing certificate table, if the image is already signed
+	certTable []byte
 }
 
 const dosHeaderSize = 64
@@ -46,6 +48,10 @@ const dosHeaderSize = 64
 // that can be used to sign the imprint and produce a binary patch to apply the
 // signature.
 func DigestPE(r io.Reader, hash crypto.Hash, doPageHash bool) (*PEDigest, error) {
+	if doPageHash && hash != crypto.SHA1 && hash != crypto.SHA256 {
+		// SPC_PE_IMAGE_PAGE_HASHES_V1 and V2 respectively
+		return nil, errors.New("page hashes require a SHA-1 or SHA-256 digest")
+	}
 	// Read and buffer all the headers
 	buf := bytes.NewBuffer(make([]byte, 0, 4096))
 	peStart, err := readDosHeader(r, buf)
@@ -67,7 +73,10 @@ func DigestPE(r io.Reader, hash crypto.Hash, doPageHash bool) (*PEDigest, error)
 	if err != nil {
 		return nil, err
 	}
-	digester := setupDigester(hash, buf.Bytes(), hvals, sections, doPageHash)
+	digester, err := setupDigester(hash, buf.Bytes(), hvals, sections, doPageHash)
+	if err != nil {
+		return nil, err
+	}
 	// Hash sections
 	nextSection := hvals.sizeOfHdr
 	for _, sh := range sections {
@@ -83,7 +92,7 @@ func DigestPE(r io.Reader, hash crypto.Hash, doPageHash bool) (*PEDigest, error)
 		nextSection += int64(sh.SizeOfRawData)
 	}
 	// Hash trailer after the sections and cert table
-	origSize, err := readTrailer(r, digester.imageDigest, nextSection, hvals.certStart, hvals.certSize)
+	origSize, certTable, err := readTrailer(r, digester.imageDigest, nextSection, hvals.certStart, hvals.certSize)
 	if err != nil {
 		return nil, err
 	}
@@ -98,7 +107,7 @@ func DigestPE(r io.Reader, hash crypto.Hash, doPageHash bool) (*PEDigest, error)
 	if err != nil {
 		return nil, err
 	}
-	return &PEDigest{origSize, certStart, imprint, pagehashes, hash, hvals}, nil
+	return &PEDigest{origSize, certStart, imprint, pagehashes, hash, hvals, certTable}, nil
 }
 
 type imageHasher struct {
@@ -111,11 +120,16 @@ type imageHasher struct {
 	lastPage    uint32
 }
 
-func setupDigester(hash crypto.Hash, header []byte, hvals *peHeaderValues, sections []pe.SectionHeader32, doPageHash bool) *imageHasher {
+func setupDigester(hash crypto.Hash, header []byte, hvals *peHeaderValues, sections []pe.SectionHeader32, doPageHash bool) (*imageHasher, error) {
 	imageDigest := hash.New()
 	imageDigest.Write(header)
 	h := &imageHasher{hashFunc: hash, imageDigest: imageDigest, doPageHash: doPageHash}
 	if doPageHash {
+		// pages are the size of the section alignment, and the headers
+		// must fit in the first one
+		if hvals.sectionAlign <= 0 || hvals.sizeOfHdr > int64(hvals.sectionAlign) {
+			return nil, fmt.Errorf("can't compute page hashes: headers of 0x%x bytes don't fit in a 0x%x byte page", hvals.sizeOfHdr, hvals.sectionAlign)
+		}
 		h.zeroPage = make([]byte, hvals.sectionAlign) // full page of zeroes, for padding
 		h.pageBuf = make([]byte, hvals.sectionAlign)  // scratch space
 		// make space for all the page hashes
@@ -133,7 +147,7 @@ func setupDigester(hash crypto.Hash, header []byte, hvals *peHeaderValues, secti
 		removed := int(hvals.sizeOfHdr) - len(header)
 		h.addPageHash(0, header, removed)
 	}
-	return h
+	return h, nil
 }
 
 func (h *imageHasher) section(r io.Reader, sh pe.SectionHeader32) error {
@@ -300,24 +314,25 @@ func readSections(r io.Reader, d io.Writer, fh *pe.FileHeader, hvals *peHeaderVa
 	return sections, nil
 }
 
-func readTrailer(r io.Reader, d io.Writer, lastSection, certStart, certSize int64) (int64, error) {
+func readTrailer(r io.Reader, d io.Writer, lastSection, certStart, certSize int64) (int64, []byte, error) {
 	if certSize == 0 {
 		n, err := io.Copy(d, r)
-		return lastSection + n, err
+		return lastSection + n, nil, err
 	}
 	if certStart < lastSection {
-		return 0, errors.New("existing signature overlaps with PE sections")
+		return 0, nil, errors.New("existing signature overlaps with PE sections")
 	}
 	if _, err := io.CopyN(d, r, certStart-lastSection); err != nil {
-		return 0, err
+		return 0, nil, err
 	}
-	if _, err := io.CopyN(ioutil.Discard, r, certSize); err != nil {
-		return 0, err
+	var certTable bytes.Buffer
+	if _, err := io.CopyN(&certTable, r, certSize); err != nil {
+		return 0, nil, err
 	}
 	if n, _ := io.Copy(ioutil.Discard, r); n > 0 {
-		return 0, errors.New("trailing garbage after existing certificate")
+		return 0, nil, errors.New("trailing garbage after existing certificate")
 	}
-	return certStart, nil
+	return certStart, certTable.Bytes(), nil
 }
 
 type peHeaderValues struct {
@@ -0,0 +1,217 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package authenticode_test
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"debug/pe"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sassoftware/relic/v7/internal/testcert"
+	"github.com/sassoftware/relic/v7/lib/authenticode"
+)
+
+// build a PE32+ image with 0x400 bytes of headers and one section of 0x1200
+// bytes, so the section spans two pages
+func testImage(sectionAlign uint32) []byte {
+	var b bytes.Buffer
+	dos := make([]byte, 64)
+	copy(dos, "MZ")
+	binary.LittleEndian.PutUint32(dos[0x3c:], 64)
+	b.Write(dos)
+	b.WriteString("PE\x00\x00")
+	_ = binary.Write(&b, binary.LittleEndian, pe.FileHeader{
+		Machine:              pe.IMAGE_FILE_MACHINE_AMD64,
+		NumberOfSections:     1,
+		SizeOfOptionalHeader: 240,
+		Characteristics:      0x22,
+	})
+	_ = binary.Write(&b, binary.LittleEndian, pe.OptionalHeader64{
+		Magic:               0x20b,
+		SectionAlignment:    sectionAlign,
+		FileAlignment:       0x200,
+		SizeOfImage:         0x3000,
+		SizeOfHeaders:       0x400,
+		NumberOfRvaAndSizes: 16,
+	})
+	var text pe.SectionHeader32
+	copy(text.Name[:], ".text")
+	text.VirtualSize = 0x1200
+	text.VirtualAddress = 0x1000
+	text.SizeOfRawData = 0x1200
+	text.PointerToRawData = 0x400
+	_ = binary.Write(&b, binary.LittleEndian, text)
+	b.Write(make([]byte, 0x400-b.Len()))
+	for i := 0; i < 0x1200; i++ {
+		b.WriteByte(byte(i))
+	}
+	return b.Bytes()
+}
+
+func TestPageHashes(t *testing.T) {
+	image := testImage(0x1000)
+	digest, err := authenticode.DigestPE(bytes.NewReader(image), crypto.SHA256, true)
+	require.NoError(t, err)
+	// headers, two pages of the section, and the end of the image
+	entry := 4 + crypto.SHA256.Size()
+	require.Len(t, digest.PageHashes, 4*entry)
+	for i, offset := range []uint32{0, 0x400, 0x1400, 0x1600} {
+		assert.Equal(t, offset, binary.LittleEndian.Uint32(digest.PageHashes[i*entry:]))
+	}
+	assert.Equal(t, make([]byte, crypto.SHA256.Size()), digest.PageHashes[3*entry+4:])
+	// the imprint doesn't depend on page hashes
+	plain, err := authenticode.DigestPE(bytes.NewReader(image), crypto.SHA256, false)
+	require.NoError(t, err)
+	assert.Equal(t, plain.Imprint, digest.Imprint)
+
+	cert := testcert.Signer(t, &x509.Certificate{Subject: pkix.Name{CommonName: "pe signer"}}, testcert.ECDSAKey(t))
+	signed, _, err := authenticode.SignPEBytes(context.Background(), image, crypto.SHA256, true, cert)
+	require.NoError(t, err)
+	sigs, err := authenticode.VerifyPE(bytes.NewReader(signed), false)
+	require.NoError(t, err)
+	require.Len(t, sigs, 1)
+	assert.Equal(t, crypto.SHA256, sigs[0].PageHashFunc)
+	assert.Equal(t, digest.PageHashes, sigs[0].PageHashes)
+
+	// page hashes that don't match the image are caught even though the
+	// imprint does
+	digest.PageHashes[entry+4] ^= 1
+	patch, _, err := digest.Sign(context.Background(), cert)
+	require.NoError(t, err)
+	bad, err := patch.ApplyBytes(image)
+	require.NoError(t, err)
+	_, err = authenticode.VerifyPE(bytes.NewReader(bad), false)
+	assert.EqualError(t, err, "page hash mismatch")
+}
+
+func TestPageHashLimits(t *testing.T) {
+	_, err := authenticode.DigestPE(bytes.NewReader(testImage(0x1000)), crypto.SHA384, true)
+	assert.EqualError(t, err, "page hashes require a SHA-1 or SHA-256 digest")
+	_, err = authenticode.DigestPE(bytes.NewReader(testImage(0x200)), crypto.SHA256, true)
+	assert.EqualError(t, err, "can't compute page hashes: headers of 0x400 bytes don't fit in a 0x200 byte page")
+	// only page hashes care about the alignment
+	_, err = authenticode.DigestPE(bytes.NewReader(testImage(0x200)), crypto.SHA256, false)
+	assert.NoError(t, err)
+}
+
+func TestAppendSignature(t *testing.T) {
+	image := testImage(0x1000)
+	cert := testcert.Signer(t, &x509.Certificate{Subject: pkix.Name{CommonName: "pe signer"}}, testcert.ECDSAKey(t))
+	digest, err := authenticode.DigestPE(bytes.NewReader(image), crypto.SHA256, false)
+	require.NoError(t, err)
+	_, _, err = digest.SignAppend(context.Background(), cert)
+	assert.EqualError(t, err, "PECOFF contains no signatures")
+
+	signed, _, err := authenticode.SignPEBytes(context.Background(), image, crypto.SHA1, false, cert)
+	require.NoError(t, err)
+	digest, err = authenticode.DigestPE(bytes.NewReader(signed), crypto.SHA256, true)
+	require.NoError(t, err)
+	patch, _, err := digest.SignAppend(context.Background(), cert)
+	require.NoError(t, err)
+	appended, err := patch.ApplyBytes(signed)
+	require.NoError(t, err)
+	sigs, err := authenticode.VerifyPE(bytes.NewReader(appended), false)
+	require.NoError(t, err)
+	require.Len(t, sigs, 2)
+	assert.Equal(t, crypto.SHA1, sigs[0].ImageHashFunc)
+	assert.Equal(t, crypto.SHA256, sigs[1].ImageHashFunc)
+	assert.Equal(t, crypto.SHA256, sigs[1].PageHashFunc)
+
+	// a third signature goes in the same attribute as the second
+	digest, err = authenticode.DigestPE(bytes.NewReader(appended), crypto.SHA384, false)
+	require.NoError(t, err)
+	patch, _, err = digest.SignAppend(context.Background(), cert)
+	require.NoError(t, err)
+	appended, err = patch.ApplyBytes(appended)
+	require.NoError(t, err)
+	sigs, err = authenticode.VerifyPE(bytes.NewReader(appended), false)
+	require.NoError(t, err)
+	require.Len(t, sigs, 3)
+	assert.Equal(t, crypto.SHA384, sigs[2].ImageHashFunc)
+
+	// all the signatures are checked against the image
+	appended[0x500] ^= 1
+	_, err = authenticode.VerifyPE(bytes.NewReader(appended), false)
+	assert.Error(t, err)
+}
+
+func TestAppendKeepsEntries(t *testing.T) {
+	image := testImage(0x1000)
+	cert := testcert.Signer(t, &x509.Certificate{Subject: pkix.Name{CommonName: "pe signer"}}, testcert.ECDSAKey(t))
+	signed, _, err := authenticode.SignPEBytes(context.Background(), image, crypto.SHA1, false, cert)
+	require.NoError(t, err)
+	// add a second WIN_CERTIFICATE entry holding a separate signature
+	digest, err := authenticode.DigestPE(bytes.NewReader(image), crypto.SHA256, false)
+	require.NoError(t, err)
+	_, ts, err := digest.Sign(context.Background(), cert)
+	require.NoError(t, err)
+	padded := (len(ts.Raw) + 7) / 8 * 8
+	entry := make([]byte, 8+padded)
+	binary.LittleEndian.PutUint32(entry, uint32(8+len(ts.Raw)))
+	binary.LittleEndian.PutUint16(entry[4:], 0x0200)
+	binary.LittleEndian.PutUint16(entry[6:], 0x0002)
+	copy(entry[8:], ts.Raw)
+	signed = append(signed, entry...)
+	// size of the certificate table data directory
+	const ddCertSize = 64 + 4 + 20 + 112 + 4*8 + 4
+	binary.LittleEndian.PutUint32(signed[ddCertSize:], binary.LittleEndian.Uint32(signed[ddCertSize:])+uint32(len(entry)))
+	sigs, err := authenticode.VerifyPE(bytes.NewReader(signed), false)
+	require.NoError(t, err)
+	require.Len(t, sigs, 2)
+
+	// the new signature nests in the first entry and the second one stays
+	digest, err = authenticode.DigestPE(bytes.NewReader(signed), crypto.SHA384, false)
+	require.NoError(t, err)
+	patch, _, err := digest.SignAppend(context.Background(), cert)
+	require.NoError(t, err)
+	appended, err := patch.ApplyBytes(signed)
+	require.NoError(t, err)
+	sigs, err = authenticode.VerifyPE(bytes.NewReader(appended), false)
+	require.NoError(t, err)
+	require.Len(t, sigs, 3)
+	assert.Equal(t, crypto.SHA1, sigs[0].ImageHashFunc)
+	assert.Equal(t, crypto.SHA384, sigs[1].ImageHashFunc)
+	assert.Equal(t, crypto.SHA256, sigs[2].ImageHashFunc)
+}
+
+func TestRemovePESignature(t *testing.T) {
+	image := testImage(0x1000)
+	_, err := authenticode.RemovePESignature(bytes.NewReader(image))
+	assert.EqualError(t, err, "PECOFF contains no signatures")
+
+	cert := testcert.Signer(t, &x509.Certificate{Subject: pkix.Name{CommonName: "pe signer"}}, testcert.ECDSAKey(t))
+	signed, _, err := authenticode.SignPEBytes(context.Background(), image, crypto.SHA256, true, cert)
+	require.NoError(t, err)
+	patch, err := authenticode.RemovePESignature(bytes.NewReader(signed))
+	require.NoError(t, err)
+	unsigned, err := patch.ApplyBytes(signed)
+	require.NoError(t, err)
+	// only the checksum is left to fix up
+	peStart := binary.LittleEndian.Uint32(image[0x3c:])
+	copy(unsigned[peStart+88:peStart+92], make([]byte, 4))
+	assert.Equal(t, image, unsigned)
+	_, err = authenticode.VerifyPE(bytes.NewReader(unsigned), false)
+	assert.EqualError(t, err, "PECOFF contains no signatures")
+}
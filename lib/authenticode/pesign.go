@@ -24,10 +24,12 @@ import (
 	"encoding/asn1"
 	"encoding/binary"
 	"errors"
+	"io"
 
 	"github.com/sassoftware/relic/v7/lib/binpatch"
 	"github.com/sassoftware/relic/v7/lib/certloader"
 	"github.com/sassoftware/relic/v7/lib/pkcs9"
+	"github.com/sassoftware/relic/v7/signers/sigerrors"
 )
 
 // Sign the digest and return an Authenticode structure
@@ -47,6 +49,38 @@ func (pd *PEDigest) Sign(ctx context.Context, cert *certloader.Certificate) (*bi
 	return patch, ts, nil
 }
 
+// SignAppend signs the digest and nests the new signature inside the image's
+// existing one, keeping the existing signature and its timestamp. Any other
+// entries in the certificate table are kept after it.
+func (pd *PEDigest) SignAppend(ctx context.Context, cert *certloader.Certificate) (*binpatch.PatchSet, *pkcs9.TimestampedSignature, error) {
+	certs, err := splitCertTable(pd.certTable)
+	if err != nil {
+		return nil, nil, err
+	} else if len(certs) == 0 {
+		return nil, nil, sigerrors.NotSignedError{Type: "PECOFF"}
+	}
+	indirect, err := pd.GetIndirect()
+	if err != nil {
+		return nil, nil, err
+	}
+	ts, err := signIndirect(ctx, indirect, pd.Hash, cert)
+	if err != nil {
+		return nil, nil, err
+	}
+	combined, err := AppendSignature(certs[0], ts.Raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	// splitCertTable already checked that the first entry fits
+	firstLen := binary.LittleEndian.Uint32(pd.certTable[:4])
+	rest := pd.certTable[(int(firstLen)+7)/8*8:]
+	patch, err := pd.makePatch(combined, rest)
+	if err != nil {
+		return nil, nil, err
+	}
+	return patch, ts, nil
+}
+
 func (pd *PEDigest) GetIndirect() (indirect SpcIndirectDataContentPe, err error) {
 	indirect, err = makePeIndirect(pd.Imprint, pd.Hash, OidSpcPeImageData)
 	if err != nil {
@@ -90,6 +124,12 @@ func (pd *PEDigest) imprintPageHashes(indirect *SpcIndirectDataContentPe) error
 // Create a patchset that will add or replace the signature from a previously
 // digested image with a new one
 func (pd *PEDigest) MakePatch(sig []byte) (*binpatch.PatchSet, error) {
+	return pd.makePatch(sig, nil)
+}
+
+// make a certificate table with sig in the first entry, followed by the
+// already padded entries in rest
+func (pd *PEDigest) makePatch(sig, rest []byte) (*binpatch.PatchSet, error) {
 	// pack new cert table
 	padded := (len(sig) + 7) / 8 * 8
 	info := certInfo{
@@ -105,6 +145,7 @@ func (pd *PEDigest) MakePatch(sig []byte) (*binpatch.PatchSet, error) {
 	_ = binary.Write(&buf, binary.LittleEndian, info)
 	_, _ = buf.Write(sig)
 	_, _ = buf.Write(make([]byte, padded-len(sig)))
+	_, _ = buf.Write(rest)
 	// pack data directory
 	certTbl := buf.Bytes()
 	var dd pe.DataDirectory
@@ -122,8 +163,56 @@ func (pd *PEDigest) MakePatch(sig []byte) (*binpatch.PatchSet, error) {
 	return patch, nil
 }
 
+// RemovePESignature returns a patch that truncates the certificate table from
+// a signed image and clears the data directory entry pointing to it. The
+// checksum must be updated afterwards.
+func RemovePESignature(r io.ReadSeeker) (*binpatch.PatchSet, error) {
+	hvals, err := findSignatures(r)
+	if err != nil {
+		return nil, err
+	} else if hvals.certSize == 0 {
+		return nil, sigerrors.NotSignedError{Type: "PECOFF"}
+	}
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if hvals.certStart+hvals.certSize != size {
+		return nil, errors.New("certificate table is not at the end of the image")
+	}
+	var dd pe.DataDirectory
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, binary.LittleEndian, dd)
+	patch := binpatch.New()
+	patch.Add(hvals.posDDCert, 8, buf.Bytes())
+	patch.Add(hvals.certStart, hvals.certSize, nil)
+	return patch, nil
+}
+
 type certInfo struct {
 	Length          uint32
 	Revision        uint16
 	CertificateType uint16
 }
+
+// SignPEBytes signs an in-memory PE image and returns the signed image with
+// its checksum updated
+func SignPEBytes(ctx context.Context, blob []byte, hash crypto.Hash, doPageHash bool, cert *certloader.Certificate) ([]byte, *pkcs9.TimestampedSignature, error) {
+	digest, err := DigestPE(bytes.NewReader(blob), hash, doPageHash)
+	if err != nil {
+		return nil, nil, err
+	}
+	patch, ts, err := digest.Sign(ctx, cert)
+	if err != nil {
+		return nil, nil, err
+	}
+	signed, err := patch.ApplyBytes(blob)
+	if err != nil {
+		return nil, nil, err
+	}
+	peStart := int(binary.LittleEndian.Uint32(signed[0x3c:]))
+	ck := NewPEChecksum(peStart)
+	_, _ = ck.Write(signed)
+	copy(signed[peStart+88:], ck.Sum(nil))
+	return signed, ts, nil
+}
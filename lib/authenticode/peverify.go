@@ -85,35 +85,32 @@ func findSignatures(r io.ReadSeeker) (*peHeaderValues, error) {
 
 func checkSignatures(blob []byte, image io.ReadSeeker) ([]PESignature, error) {
 	values := make(map[crypto.Hash][]byte)
-	phvalues := make(map[crypto.Hash][]byte)
+	phvalues := make(map[crypto.Hash][][]byte)
 	allhashes := make(map[crypto.Hash]bool)
 	sigs := make([]PESignature, 0, 1)
-	for len(blob) != 0 {
-		wLen := binary.LittleEndian.Uint32(blob[:4])
-		end := (int(wLen) + 7) / 8 * 8
-		size := int(wLen) - 8
-		if end > len(blob) || size < 0 {
-			return nil, errors.New("invalid certificate table")
-		}
-		cert := blob[8 : 8+size]
-		blob = blob[end:]
-
-		sig, err := checkSignature(cert)
+	certs, err := splitCertTable(blob)
+	if err != nil {
+		return nil, err
+	}
+	for _, cert := range certs {
+		found, err := checkSignature(cert)
 		if err != nil {
 			return nil, err
 		}
-		allhashes[sig.ImageHashFunc] = true
-		if len(sig.PageHashes) > 0 {
-			phvalues[sig.PageHashFunc] = sig.PageHashes
-			allhashes[sig.PageHashFunc] = true
-		}
-		sigs = append(sigs, *sig)
-		imageDigest := sig.Indirect.MessageDigest.Digest
-		if existing := values[sig.ImageHashFunc]; existing == nil {
-			values[sig.ImageHashFunc] = imageDigest
-		} else if !hmac.Equal(imageDigest, existing) {
-			// they can't both be right...
-			return nil, fmt.Errorf("digest mismatch: %x != %x", imageDigest, existing)
+		for _, sig := range found {
+			allhashes[sig.ImageHashFunc] = true
+			if len(sig.PageHashes) > 0 {
+				phvalues[sig.PageHashFunc] = append(phvalues[sig.PageHashFunc], sig.PageHashes)
+				allhashes[sig.PageHashFunc] = true
+			}
+			sigs = append(sigs, *sig)
+			imageDigest := sig.Indirect.MessageDigest.Digest
+			if existing := values[sig.ImageHashFunc]; existing == nil {
+				values[sig.ImageHashFunc] = imageDigest
+			} else if !hmac.Equal(imageDigest, existing) {
+				// they can't both be right...
+				return nil, fmt.Errorf("digest mismatch: %x != %x", imageDigest, existing)
+			}
 		}
 	}
 	if image == nil {
@@ -133,14 +130,37 @@ func checkSignatures(blob []byte, image io.ReadSeeker) ([]PESignature, error) {
 		if imagehash != nil && !hmac.Equal(digest.Imprint, imagehash) {
 			return sigs, fmt.Errorf("digest mismatch: %x != %x", digest.Imprint, imagehash)
 		}
-		if pagehashes != nil && !hmac.Equal(digest.PageHashes, pagehashes) {
-			return sigs, fmt.Errorf("page hash mismatch")
+		// each signature's page hashes are checked, not just one of them
+		for _, ph := range pagehashes {
+			if !hmac.Equal(digest.PageHashes, ph) {
+				return sigs, fmt.Errorf("page hash mismatch")
+			}
 		}
 	}
 	return sigs, nil
 }
 
-func checkSignature(der []byte) (*PESignature, error) {
+// split a certificate table into the signatures in each WIN_CERTIFICATE entry
+func splitCertTable(blob []byte) ([][]byte, error) {
+	var certs [][]byte
+	for len(blob) != 0 {
+		if len(blob) < 8 {
+			return nil, errors.New("invalid certificate table")
+		}
+		wLen := binary.LittleEndian.Uint32(blob[:4])
+		end := (int(wLen) + 7) / 8 * 8
+		size := int(wLen) - 8
+		if end > len(blob) || size < 0 {
+			return nil, errors.New("invalid certificate table")
+		}
+		certs = append(certs, blob[8:8+size])
+		blob = blob[end:]
+	}
+	return certs, nil
+}
+
+// check a signature and any signatures nested inside it
+func checkSignature(der []byte) ([]*PESignature, error) {
 	psd, err := pkcs7.Unmarshal(der)
 	if err != nil {
 		return nil, fmt.Errorf("unmarshaling authenticode signature: %w", err)
@@ -172,7 +192,19 @@ func checkSignature(der []byte) (*PESignature, error) {
 	if err := readPageHashes(pesig); err != nil {
 		return nil, err
 	}
-	return pesig, nil
+	sigs := []*PESignature{pesig}
+	nested, err := nestedSignatures(psd)
+	if err != nil {
+		return nil, err
+	}
+	for _, der := range nested {
+		more, err := checkSignature(der)
+		if err != nil {
+			return nil, fmt.Errorf("nested signature: %w", err)
+		}
+		sigs = append(sigs, more...)
+	}
+	return sigs, nil
 }
 
 func readPageHashes(sig *PESignature) error {
@@ -283,6 +283,21 @@ func (pd *PsDigest) MakePatch(sig []byte) (*binpatch.PatchSet, error) {
 	return patch, nil
 }
 
+// RemovePowershellSignature returns a patch that removes the signature block
+// from a script, along with the line break that was added before it
+func RemovePowershellSignature(r io.Reader, style PsSigStyle) (*binpatch.PatchSet, error) {
+	// the hash doesn't matter, only where the signature is
+	digest, err := DigestPowershell(r, style, crypto.SHA256)
+	if err != nil {
+		return nil, err
+	} else if digest.SigSize == 0 {
+		return nil, sigerrors.NotSignedError{Type: "powershell document"}
+	}
+	patch := binpatch.New()
+	patch.Add(digest.TextSize, digest.SigSize, nil)
+	return patch, nil
+}
+
 func readLine(br *bufio.Reader, isUtf16 bool) (string, error) {
 	line, err := br.ReadString('\n')
 	if isUtf16 && err == nil {
@@ -32,6 +32,7 @@ var (
 	OidSpcSipInfo             = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 1, 30}
 	OidSpcPageHashV1          = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 3, 1}
 	OidSpcPageHashV2          = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 3, 2}
+	OidSpcNestedSignature     = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 4, 1}
 	OidSpcCabPageHash         = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 5, 1}
 	OidCertTrustList          = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 10, 1}
 	OidCatalogList            = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 12, 1, 1}
@@ -53,8 +54,10 @@ var (
 	SpcUUIDSipInfoMsi = []byte{0xf1, 0x10, 0x0c, 0x00, 0x00, 0x00, 0x00, 0x00, 0xc0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x46}
 	SpcUUIDSipInfoPs  = []byte{0x1f, 0xcc, 0x3b, 0x60, 0x59, 0x4b, 0x08, 0x4e, 0xb7, 0x24, 0xd2, 0xc6, 0x29, 0x7e, 0xf3, 0x51}
 
-	// This one is used in V1 security catalogs
+	// These are used in V1 security catalogs
 	CryptSipCreateIndirectData = "{C689AAB8-8E78-11D0-8C47-00C04FC295EE}"
+	CryptSipFlatFile           = "{DE351A42-8E59-11D0-8C47-00C04FC295EE}"
+	CryptSipPowershell         = "{603BCC1F-4B59-4E08-B724-D2C6297EF351}"
 
 	// Filenames for MSI streams holding signature data
 	msiDigitalSignature   = "\x05DigitalSignature"
@@ -136,7 +139,7 @@ type CertTrustList struct {
 	EffectiveDate    time.Time
 	SubjectAlgorithm pkix.AlgorithmIdentifier
 	Entries          []CertTrustEntry
-	Attributes       *CertTrustAttributes `asn1:"optional,explicit,tag:0"`
+	Attributes       []CertTrustValue `asn1:"optional,explicit,tag:0"`
 }
 
 type CertTrustEntry struct {
@@ -154,6 +157,9 @@ type CertTrustMemberInfoV1 struct {
 	Unknown1 int
 }
 
-type CertTrustAttributes struct {
-	// TODO
+// CatalogNameValue is a named attribute of a catalog or one of its members
+type CatalogNameValue struct {
+	Name  asn1.RawValue
+	Flags int
+	Value []byte
 }
@@ -0,0 +1,322 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package authenticode
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/pkcs7"
+	"github.com/sassoftware/relic/v7/lib/pkcs9"
+	"github.com/sassoftware/relic/v7/lib/vba"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+)
+
+// Kind of VBA project signature
+type VBASigKind int
+
+const (
+	// MD5 hash of the source code, stored in \x05DigitalSignature
+	VBASigLegacy VBASigKind = iota + 1
+	// Also covers designers, stored in \x05DigitalSignatureAgile
+	VBASigAgile
+	// Covers all project metadata, stored in \x05DigitalSignatureExt
+	VBASigV3
+)
+
+var (
+	OidSpcStructuredStorageData = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 1, 29}
+	OidSpcSigDataV1             = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 1, 31}
+)
+
+const (
+	digSigBlobHeader  = 8
+	digSigInfoSize    = 36
+	certStoreFileType = 0x54524543 // CERT
+	certStoreCertID   = 0x20
+)
+
+// Stream name holding a kind of VBA signature
+func (k VBASigKind) StreamName() string {
+	switch k {
+	case VBASigLegacy:
+		return vba.StreamSignature
+	case VBASigAgile:
+		return vba.StreamSignatureAgile
+	case VBASigV3:
+		return vba.StreamSignatureV3
+	}
+	return ""
+}
+
+func (k VBASigKind) String() string {
+	switch k {
+	case VBASigLegacy:
+		return "legacy"
+	case VBASigAgile:
+		return "agile"
+	case VBASigV3:
+		return "v3"
+	}
+	return fmt.Sprintf("VBASigKind(%d)", int(k))
+}
+
+type SpcIndirectDataContentVBA struct {
+	Data          SpcAttributeVBA
+	MessageDigest DigestInfo
+}
+
+type SpcAttributeVBA struct {
+	Type  asn1.ObjectIdentifier
+	Value asn1.RawValue `asn1:"optional"`
+}
+
+// header of the SigDataV1Serialized structure used by agile and V3 signatures
+type sigDataV1Header struct {
+	AlgorithmIDSize    uint32
+	CompiledHashSize   uint32
+	SourceHashSize     uint32
+	AlgorithmIDOffset  uint32
+	CompiledHashOffset uint32
+	SourceHashOffset   uint32
+}
+
+// header of the DigSigInfoSerialized structure inside of a DigSigBlob
+type digSigInfo struct {
+	SignatureSize      uint32
+	SignatureOffset    uint32
+	CertStoreSize      uint32
+	CertStoreOffset    uint32
+	ProjectNameSize    uint32
+	ProjectNameOffset  uint32
+	Timestamp          uint32
+	TimestampURLSize   uint32
+	TimestampURLOffset uint32
+}
+
+type VBASignature struct {
+	pkcs9.TimestampedSignature
+	Kind     VBASigKind
+	HashFunc crypto.Hash
+}
+
+// Calculate the digest of a VBA project for the given kind of signature
+func DigestVBA(project *vba.Project, kind VBASigKind, hash crypto.Hash) ([]byte, error) {
+	switch kind {
+	case VBASigLegacy:
+		return project.ContentHash(), nil
+	case VBASigAgile:
+		return project.AgileContentHash(hash)
+	case VBASigV3:
+		return project.V3ContentHash(hash)
+	}
+	return nil, errors.New("invalid VBA signature kind")
+}
+
+// Sign a VBA project and return the contents of the signature stream
+func SignVBA(ctx context.Context, project *vba.Project, kind VBASigKind, hash crypto.Hash, cert *certloader.Certificate) ([]byte, *pkcs9.TimestampedSignature, error) {
+	indirect, err := makeVBAIndirect(project, kind, hash)
+	if err != nil {
+		return nil, nil, err
+	}
+	ts, err := signIndirect(ctx, indirect, hash, cert)
+	if err != nil {
+		return nil, nil, err
+	}
+	return marshalDigSigBlob(ts.Raw, cert.Leaf.Raw), ts, nil
+}
+
+func makeVBAIndirect(project *vba.Project, kind VBASigKind, hash crypto.Hash) (*SpcIndirectDataContentVBA, error) {
+	indirect := new(SpcIndirectDataContentVBA)
+	if kind == VBASigLegacy {
+		// legacy signatures are always MD5 regardless of the signature hash
+		hash = crypto.MD5
+	}
+	digest, err := DigestVBA(project, kind, hash)
+	if err != nil {
+		return nil, err
+	}
+	alg, ok := x509tools.PkixDigestAlgorithm(hash)
+	if !ok {
+		return nil, errors.New("unsupported digest algorithm")
+	}
+	indirect.MessageDigest.DigestAlgorithm = alg
+	indirect.MessageDigest.Digest = digest
+	if kind == VBASigLegacy {
+		indirect.Data.Type = OidSpcStructuredStorageData
+		indirect.Data.Value = asn1.NullRawValue
+		return indirect, nil
+	}
+	sigData, err := marshalSigDataV1(alg.Algorithm.String(), digest)
+	if err != nil {
+		return nil, err
+	}
+	indirect.Data.Type = OidSpcSigDataV1
+	indirect.Data.Value = asn1.RawValue{FullBytes: sigData}
+	return indirect, nil
+}
+
+func marshalSigDataV1(algorithm string, sourceHash []byte) ([]byte, error) {
+	algID := append([]byte(algorithm), 0)
+	hdr := sigDataV1Header{
+		AlgorithmIDSize:   uint32(len(algID)),
+		SourceHashSize:    uint32(len(sourceHash)),
+		AlgorithmIDOffset: 24,
+	}
+	hdr.CompiledHashOffset = hdr.AlgorithmIDOffset + hdr.AlgorithmIDSize
+	hdr.SourceHashOffset = hdr.CompiledHashOffset
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, binary.LittleEndian, hdr)
+	buf.Write(algID)
+	buf.Write(sourceHash)
+	// wrap in a DER OCTET STRING like the rest of the structure
+	return asn1.Marshal(buf.Bytes())
+}
+
+func parseSigDataV1(raw asn1.RawValue) (algorithm string, sourceHash []byte, err error) {
+	var blob []byte
+	if _, err := asn1.Unmarshal(raw.FullBytes, &blob); err != nil {
+		return "", nil, err
+	}
+	var hdr sigDataV1Header
+	if err := binaryReadBytes(blob, &hdr); err != nil {
+		return "", nil, err
+	}
+	algEnd := uint64(hdr.AlgorithmIDOffset) + uint64(hdr.AlgorithmIDSize)
+	hashEnd := uint64(hdr.SourceHashOffset) + uint64(hdr.SourceHashSize)
+	if algEnd > uint64(len(blob)) || hashEnd > uint64(len(blob)) || hdr.AlgorithmIDSize == 0 {
+		return "", nil, errors.New("invalid SigDataV1Serialized")
+	}
+	algorithm = string(blob[hdr.AlgorithmIDOffset : algEnd-1])
+	return algorithm, blob[hdr.SourceHashOffset:hashEnd], nil
+}
+
+// Pack a signature and signing certificate into a DigSigBlob
+func marshalDigSigBlob(sig, cert []byte) []byte {
+	// serialized certificate store holding just the signer
+	var store bytes.Buffer
+	_ = binary.Write(&store, binary.LittleEndian, []uint32{0, certStoreFileType, certStoreCertID, 1, uint32(len(cert))})
+	store.Write(cert)
+	store.Write(make([]byte, 12))
+
+	info := digSigInfo{
+		SignatureSize:   uint32(len(sig)),
+		SignatureOffset: digSigBlobHeader + digSigInfoSize,
+		CertStoreSize:   uint32(store.Len()),
+	}
+	info.CertStoreOffset = info.SignatureOffset + info.SignatureSize
+	info.ProjectNameOffset = info.CertStoreOffset + info.CertStoreSize
+	info.TimestampURLOffset = info.ProjectNameOffset + 2
+	infoSize := digSigInfoSize + len(sig) + store.Len() + 4
+
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, binary.LittleEndian, []uint32{uint32(infoSize), digSigBlobHeader})
+	_ = binary.Write(&buf, binary.LittleEndian, info)
+	buf.Write(sig)
+	buf.Write(store.Bytes())
+	// empty project name and timestamp URL
+	buf.Write(make([]byte, 4))
+	if pad := buf.Len() % 4; pad != 0 {
+		buf.Write(make([]byte, 4-pad))
+	}
+	return buf.Bytes()
+}
+
+// Extract the PKCS#7 signature from a DigSigBlob
+func parseDigSigBlob(blob []byte) ([]byte, error) {
+	if len(blob) < digSigBlobHeader+digSigInfoSize {
+		return nil, errors.New("VBA signature is too short")
+	}
+	if binary.LittleEndian.Uint32(blob[4:]) != digSigBlobHeader {
+		return nil, errors.New("invalid VBA signature header")
+	}
+	var info digSigInfo
+	if err := binaryReadBytes(blob[digSigBlobHeader:], &info); err != nil {
+		return nil, err
+	}
+	end := uint64(info.SignatureOffset) + uint64(info.SignatureSize)
+	if end > uint64(len(blob)) {
+		return nil, errors.New("invalid VBA signature offset")
+	}
+	return blob[info.SignatureOffset:end], nil
+}
+
+// Extract and verify a VBA project signature. If project is nil then digests
+// are not checked. Does not check X509 chains.
+func VerifyVBA(blob []byte, kind VBASigKind, project *vba.Project) (*VBASignature, error) {
+	der, err := parseDigSigBlob(blob)
+	if err != nil {
+		return nil, err
+	}
+	psd, err := pkcs7.Unmarshal(der)
+	if err != nil {
+		return nil, err
+	}
+	if !psd.Content.ContentInfo.ContentType.Equal(OidSpcIndirectDataContent) {
+		return nil, errors.New("not an authenticode signature")
+	}
+	pksig, err := psd.Content.Verify(nil, false)
+	if err != nil {
+		return nil, err
+	}
+	ts, err := pkcs9.VerifyOptionalTimestamp(pksig)
+	if err != nil {
+		return nil, err
+	}
+	indirect := new(SpcIndirectDataContentVBA)
+	if err := psd.Content.ContentInfo.Unmarshal(indirect); err != nil {
+		return nil, err
+	}
+	hash, err := x509tools.PkixDigestToHashE(indirect.MessageDigest.DigestAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	digest := indirect.MessageDigest.Digest
+	if kind != VBASigLegacy {
+		if !indirect.Data.Type.Equal(OidSpcSigDataV1) {
+			return nil, errors.New("VBA signature has the wrong content type")
+		}
+		algorithm, sourceHash, err := parseSigDataV1(indirect.Data.Value)
+		if err != nil {
+			return nil, err
+		}
+		if algorithm != indirect.MessageDigest.DigestAlgorithm.Algorithm.String() || !hmac.Equal(sourceHash, digest) {
+			return nil, errors.New("VBA signature digest is inconsistent")
+		}
+	}
+	if project != nil {
+		calc, err := DigestVBA(project, kind, hash)
+		if err != nil {
+			return nil, err
+		}
+		if !hmac.Equal(calc, digest) {
+			return nil, fmt.Errorf("VBA %s digest mismatch: %x != %x", kind, calc, digest)
+		}
+	}
+	return &VBASignature{
+		TimestampedSignature: ts,
+		Kind:                 kind,
+		HashFunc:             hash,
+	}, nil
+}
@@ -0,0 +1,178 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package avb
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeaderSize(t *testing.T) {
+	assert.Equal(t, headerSize, binary.Size(header{}))
+	assert.Equal(t, 132-16, binary.Size(hashHeader{}))
+	assert.Equal(t, 180-16, binary.Size(hashtreeHeader{}))
+	assert.Equal(t, 92-16, binary.Size(chainHeader{}))
+	assert.Equal(t, FooterSize-28, len(footerMagic)+binary.Size(Footer{}))
+}
+
+func TestPublicKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	blob, err := EncodePublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	assert.Len(t, blob, 8+2*256)
+	// n0inv * n == -1 mod 2^32
+	n0inv := binary.BigEndian.Uint32(blob[4:])
+	n0 := uint32(new(big.Int).Mod(key.N, big.NewInt(1<<32)).Uint64())
+	assert.Equal(t, uint32(0xffffffff), n0inv*n0)
+	pub, err := DecodePublicKey(blob)
+	require.NoError(t, err)
+	assert.True(t, key.PublicKey.Equal(pub))
+}
+
+func TestSignVerify(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	otherPub, err := EncodePublicKey(&other.PublicKey)
+	require.NoError(t, err)
+	image := bytes.Repeat([]byte("boot"), 3000)
+	hashDesc, err := NewHashDescriptor(bytes.NewReader(image), "boot", int64(len(image)), crypto.SHA256, []byte("salt"))
+	require.NoError(t, err)
+	v := &VBMeta{RollbackIndex: 5, RollbackIndexLocation: 1, ReleaseString: "test"}
+	v.SetDescriptor(hashDesc.Descriptor())
+	v.SetDescriptor((&PropertyDescriptor{Key: "com.example.key", Value: "value"}).Descriptor())
+	v.SetDescriptor((&KernelCmdlineDescriptor{Cmdline: "quiet"}).Descriptor())
+	v.SetDescriptor((&ChainPartitionDescriptor{RollbackIndexLocation: 2, PartitionName: "vbmeta_system", PublicKey: otherPub}).Descriptor())
+	// replaces the existing property
+	v.SetDescriptor((&PropertyDescriptor{Key: "com.example.key", Value: "other"}).Descriptor())
+	blob, err := v.Sign(key, crypto.SHA256)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(blob)%blockAlign)
+
+	parsed, err := Parse(blob)
+	require.NoError(t, err)
+	assert.Equal(t, AlgorithmSHA256RSA2048, parsed.Algorithm)
+	assert.Equal(t, uint64(5), parsed.RollbackIndex)
+	assert.Equal(t, uint32(2), parsed.requiredMinor)
+	assert.Equal(t, "test", parsed.ReleaseString)
+	pub, err := parsed.Verify()
+	require.NoError(t, err)
+	assert.True(t, key.PublicKey.Equal(pub))
+	require.Len(t, parsed.Descriptors, 4)
+	decoded, err := parsed.Descriptors[0].Decode()
+	require.NoError(t, err)
+	require.IsType(t, &HashDescriptor{}, decoded)
+	assert.Equal(t, hashDesc, decoded)
+	assert.NoError(t, decoded.(*HashDescriptor).Check(bytes.NewReader(image)))
+	image[0] ^= 1
+	assert.Error(t, decoded.(*HashDescriptor).Check(bytes.NewReader(image)))
+	decoded, err = parsed.Descriptors[1].Decode()
+	require.NoError(t, err)
+	assert.Equal(t, &PropertyDescriptor{Key: "com.example.key", Value: "other"}, decoded)
+	decoded, err = parsed.Descriptors[2].Decode()
+	require.NoError(t, err)
+	assert.Equal(t, &KernelCmdlineDescriptor{Cmdline: "quiet"}, decoded)
+	decoded, err = parsed.Descriptors[3].Decode()
+	require.NoError(t, err)
+	assert.Equal(t, "vbmeta_system", decoded.(*ChainPartitionDescriptor).PartitionName)
+	assert.Equal(t, otherPub, decoded.(*ChainPartitionDescriptor).PublicKey)
+
+	// re-signing with SHA-512 reproduces the same descriptors
+	blob2, err := parsed.Sign(key, crypto.SHA512)
+	require.NoError(t, err)
+	parsed2, err := Parse(blob2)
+	require.NoError(t, err)
+	assert.Equal(t, AlgorithmSHA512RSA2048, parsed2.Algorithm)
+	_, err = parsed2.Verify()
+	require.NoError(t, err)
+	assert.Equal(t, parsed.Descriptors, parsed2.Descriptors)
+
+	// tampering with the descriptors breaks the hash
+	tampered := append([]byte(nil), blob...)
+	tampered[len(tampered)-blockAlign-1] ^= 1
+	parsed, err = Parse(tampered)
+	if err == nil {
+		_, err = parsed.Verify()
+	}
+	assert.Error(t, err)
+}
+
+func TestFooter(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	image := make([]byte, 5000)
+	desc, err := NewHashDescriptor(bytes.NewReader(image), "boot", int64(len(image)), crypto.SHA256, nil)
+	require.NoError(t, err)
+	v := &VBMeta{Descriptors: []Descriptor{desc.Descriptor()}}
+	vbmeta, err := v.Sign(key, crypto.SHA256)
+	require.NoError(t, err)
+	_, err = AppendFooter(int64(len(image)), 8192, vbmeta)
+	assert.Error(t, err)
+	tail, err := AppendFooter(int64(len(image)), 64*1024, vbmeta)
+	require.NoError(t, err)
+	partition := append(image, tail...)
+	assert.Len(t, partition, 64*1024)
+	footer, err := ParseFooter(partition[len(partition)-FooterSize:])
+	require.NoError(t, err)
+	require.NotNil(t, footer)
+	assert.Equal(t, uint64(len(image)), footer.OriginalImageSize)
+	assert.Equal(t, uint64(8192), footer.VBMetaOffset)
+	parsed, err := Parse(partition[footer.VBMetaOffset : footer.VBMetaOffset+footer.VBMetaSize])
+	require.NoError(t, err)
+	_, err = parsed.Verify()
+	assert.NoError(t, err)
+	footer, err = ParseFooter(image[:FooterSize])
+	assert.NoError(t, err)
+	assert.Nil(t, footer)
+}
+
+func TestHashtree(t *testing.T) {
+	image := make([]byte, 2*4096)
+	image[5000] = 1
+	salt := []byte("salt")
+	hashBlock := func(b []byte) []byte {
+		d := sha256.New()
+		d.Write(salt)
+		d.Write(b)
+		return d.Sum(nil)
+	}
+	level := append(hashBlock(image[:4096]), hashBlock(image[4096:])...)
+	level = append(level, make([]byte, 4096-len(level))...)
+	desc := &HashtreeDescriptor{
+		ImageSize:     uint64(len(image)),
+		DataBlockSize: 4096,
+		HashBlockSize: 4096,
+		HashAlgorithm: "sha256",
+		PartitionName: "system",
+		Salt:          salt,
+		RootDigest:    hashBlock(level),
+	}
+	assert.NoError(t, desc.Check(bytes.NewReader(image)))
+	image[0] = 1
+	assert.Error(t, desc.Check(bytes.NewReader(image)))
+}
@@ -0,0 +1,365 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package avb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// Descriptor tags
+const (
+	TagProperty       = 0
+	TagHashtree       = 1
+	TagHash           = 2
+	TagKernelCmdline  = 3
+	TagChainPartition = 4
+)
+
+// Descriptor is a raw vbmeta descriptor. Data includes any trailing padding.
+type Descriptor struct {
+	Tag  uint64
+	Data []byte
+}
+
+func parseDescriptors(blob []byte) ([]Descriptor, error) {
+	var descs []Descriptor
+	for len(blob) > 0 {
+		if len(blob) < 16 {
+			return nil, errors.New("avb: truncated descriptor")
+		}
+		tag := binary.BigEndian.Uint64(blob)
+		size := binary.BigEndian.Uint64(blob[8:])
+		if size%8 != 0 || size > uint64(len(blob)-16) {
+			return nil, errors.New("avb: invalid descriptor size")
+		}
+		descs = append(descs, Descriptor{Tag: tag, Data: blob[16 : 16+size]})
+		blob = blob[16+size:]
+	}
+	return descs, nil
+}
+
+func (d Descriptor) marshal() []byte {
+	size := roundUp(uint64(len(d.Data)), 8)
+	blob := make([]byte, 16+size)
+	binary.BigEndian.PutUint64(blob, d.Tag)
+	binary.BigEndian.PutUint64(blob[8:], size)
+	copy(blob[16:], d.Data)
+	return blob
+}
+
+// Decode returns the typed form of a descriptor, or the raw descriptor if
+// the tag is not known
+func (d Descriptor) Decode() (interface{}, error) {
+	switch d.Tag {
+	case TagProperty:
+		return parseProperty(d.Data)
+	case TagHashtree:
+		return parseHashtree(d.Data)
+	case TagHash:
+		return parseHash(d.Data)
+	case TagKernelCmdline:
+		return parseKernelCmdline(d.Data)
+	case TagChainPartition:
+		return parseChainPartition(d.Data)
+	default:
+		return d, nil
+	}
+}
+
+// take variable-length fields from the end of a descriptor
+func splitFields(data []byte, sizes ...uint32) ([][]byte, error) {
+	fields := make([][]byte, len(sizes))
+	for i, size := range sizes {
+		if uint64(size) > uint64(len(data)) {
+			return nil, errors.New("avb: descriptor field is out of bounds")
+		}
+		fields[i] = data[:size]
+		data = data[size:]
+	}
+	return fields, nil
+}
+
+// PropertyDescriptor is a key-value pair
+type PropertyDescriptor struct {
+	Key   string
+	Value string
+}
+
+func parseProperty(data []byte) (*PropertyDescriptor, error) {
+	if len(data) < 16 {
+		return nil, errors.New("avb: truncated property descriptor")
+	}
+	keyLen := binary.BigEndian.Uint64(data)
+	valueLen := binary.BigEndian.Uint64(data[8:])
+	data = data[16:]
+	if keyLen >= uint64(len(data)) || valueLen >= uint64(len(data))-keyLen-1 {
+		return nil, errors.New("avb: property descriptor field is out of bounds")
+	}
+	return &PropertyDescriptor{
+		Key:   string(data[:keyLen]),
+		Value: string(data[keyLen+1 : keyLen+1+valueLen]),
+	}, nil
+}
+
+func (p *PropertyDescriptor) Descriptor() Descriptor {
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, binary.BigEndian, [2]uint64{uint64(len(p.Key)), uint64(len(p.Value))})
+	buf.WriteString(p.Key)
+	buf.WriteByte(0)
+	buf.WriteString(p.Value)
+	buf.WriteByte(0)
+	return Descriptor{Tag: TagProperty, Data: buf.Bytes()}
+}
+
+// HashDescriptor holds the digest of a whole partition image
+type HashDescriptor struct {
+	ImageSize     uint64
+	HashAlgorithm string
+	PartitionName string
+	Salt          []byte
+	Digest        []byte
+	Flags         uint32
+}
+
+type hashHeader struct {
+	ImageSize        uint64
+	HashAlgorithm    [32]byte
+	PartitionNameLen uint32
+	SaltLen          uint32
+	DigestLen        uint32
+	Flags            uint32
+	Reserved         [60]byte
+}
+
+func parseHash(data []byte) (*HashDescriptor, error) {
+	var hdr hashHeader
+	if err := binary.Read(bytes.NewReader(data), binary.BigEndian, &hdr); err != nil {
+		return nil, errors.New("avb: truncated hash descriptor")
+	}
+	fields, err := splitFields(data[binary.Size(hdr):], hdr.PartitionNameLen, hdr.SaltLen, hdr.DigestLen)
+	if err != nil {
+		return nil, err
+	}
+	return &HashDescriptor{
+		ImageSize:     hdr.ImageSize,
+		HashAlgorithm: cString(hdr.HashAlgorithm[:]),
+		PartitionName: string(fields[0]),
+		Salt:          fields[1],
+		Digest:        fields[2],
+		Flags:         hdr.Flags,
+	}, nil
+}
+
+func (h *HashDescriptor) Descriptor() Descriptor {
+	hdr := hashHeader{
+		ImageSize:        h.ImageSize,
+		PartitionNameLen: uint32(len(h.PartitionName)),
+		SaltLen:          uint32(len(h.Salt)),
+		DigestLen:        uint32(len(h.Digest)),
+		Flags:            h.Flags,
+	}
+	copy(hdr.HashAlgorithm[:], h.HashAlgorithm)
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, binary.BigEndian, hdr)
+	buf.WriteString(h.PartitionName)
+	buf.Write(h.Salt)
+	buf.Write(h.Digest)
+	return Descriptor{Tag: TagHash, Data: buf.Bytes()}
+}
+
+// HashtreeDescriptor holds the root of a dm-verity hash tree
+type HashtreeDescriptor struct {
+	DMVerityVersion uint32
+	ImageSize       uint64
+	TreeOffset      uint64
+	TreeSize        uint64
+	DataBlockSize   uint32
+	HashBlockSize   uint32
+	FECNumRoots     uint32
+	FECOffset       uint64
+	FECSize         uint64
+	HashAlgorithm   string
+	PartitionName   string
+	Salt            []byte
+	RootDigest      []byte
+	Flags           uint32
+}
+
+type hashtreeHeader struct {
+	DMVerityVersion  uint32
+	ImageSize        uint64
+	TreeOffset       uint64
+	TreeSize         uint64
+	DataBlockSize    uint32
+	HashBlockSize    uint32
+	FECNumRoots      uint32
+	FECOffset        uint64
+	FECSize          uint64
+	HashAlgorithm    [32]byte
+	PartitionNameLen uint32
+	SaltLen          uint32
+	RootDigestLen    uint32
+	Flags            uint32
+	Reserved         [60]byte
+}
+
+func parseHashtree(data []byte) (*HashtreeDescriptor, error) {
+	var hdr hashtreeHeader
+	if err := binary.Read(bytes.NewReader(data), binary.BigEndian, &hdr); err != nil {
+		return nil, errors.New("avb: truncated hashtree descriptor")
+	}
+	fields, err := splitFields(data[binary.Size(hdr):], hdr.PartitionNameLen, hdr.SaltLen, hdr.RootDigestLen)
+	if err != nil {
+		return nil, err
+	}
+	return &HashtreeDescriptor{
+		DMVerityVersion: hdr.DMVerityVersion,
+		ImageSize:       hdr.ImageSize,
+		TreeOffset:      hdr.TreeOffset,
+		TreeSize:        hdr.TreeSize,
+		DataBlockSize:   hdr.DataBlockSize,
+		HashBlockSize:   hdr.HashBlockSize,
+		FECNumRoots:     hdr.FECNumRoots,
+		FECOffset:       hdr.FECOffset,
+		FECSize:         hdr.FECSize,
+		HashAlgorithm:   cString(hdr.HashAlgorithm[:]),
+		PartitionName:   string(fields[0]),
+		Salt:            fields[1],
+		RootDigest:      fields[2],
+		Flags:           hdr.Flags,
+	}, nil
+}
+
+// KernelCmdlineDescriptor holds a fragment of the kernel command line
+type KernelCmdlineDescriptor struct {
+	Flags   uint32
+	Cmdline string
+}
+
+func parseKernelCmdline(data []byte) (*KernelCmdlineDescriptor, error) {
+	if len(data) < 8 {
+		return nil, errors.New("avb: truncated kernel cmdline descriptor")
+	}
+	fields, err := splitFields(data[8:], binary.BigEndian.Uint32(data[4:]))
+	if err != nil {
+		return nil, err
+	}
+	return &KernelCmdlineDescriptor{
+		Flags:   binary.BigEndian.Uint32(data),
+		Cmdline: string(fields[0]),
+	}, nil
+}
+
+func (k *KernelCmdlineDescriptor) Descriptor() Descriptor {
+	data := make([]byte, 8+len(k.Cmdline))
+	binary.BigEndian.PutUint32(data, k.Flags)
+	binary.BigEndian.PutUint32(data[4:], uint32(len(k.Cmdline)))
+	copy(data[8:], k.Cmdline)
+	return Descriptor{Tag: TagKernelCmdline, Data: data}
+}
+
+// ChainPartitionDescriptor delegates verification of a partition to the
+// vbmeta in that partition, signed by the given key
+type ChainPartitionDescriptor struct {
+	RollbackIndexLocation uint32
+	PartitionName         string
+	PublicKey             []byte
+	Flags                 uint32
+}
+
+type chainHeader struct {
+	RollbackIndexLocation uint32
+	PartitionNameLen      uint32
+	PublicKeyLen          uint32
+	Flags                 uint32
+	Reserved              [60]byte
+}
+
+func parseChainPartition(data []byte) (*ChainPartitionDescriptor, error) {
+	var hdr chainHeader
+	if err := binary.Read(bytes.NewReader(data), binary.BigEndian, &hdr); err != nil {
+		return nil, errors.New("avb: truncated chain partition descriptor")
+	}
+	fields, err := splitFields(data[binary.Size(hdr):], hdr.PartitionNameLen, hdr.PublicKeyLen)
+	if err != nil {
+		return nil, err
+	}
+	return &ChainPartitionDescriptor{
+		RollbackIndexLocation: hdr.RollbackIndexLocation,
+		PartitionName:         string(fields[0]),
+		PublicKey:             fields[1],
+		Flags:                 hdr.Flags,
+	}, nil
+}
+
+func (c *ChainPartitionDescriptor) Descriptor() Descriptor {
+	hdr := chainHeader{
+		RollbackIndexLocation: c.RollbackIndexLocation,
+		PartitionNameLen:      uint32(len(c.PartitionName)),
+		PublicKeyLen:          uint32(len(c.PublicKey)),
+		Flags:                 c.Flags,
+	}
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, binary.BigEndian, hdr)
+	buf.WriteString(c.PartitionName)
+	buf.Write(c.PublicKey)
+	return Descriptor{Tag: TagChainPartition, Data: buf.Bytes()}
+}
+
+// SetDescriptor adds a descriptor, replacing any existing one of the same
+// type for the same partition or property
+func (v *VBMeta) SetDescriptor(d Descriptor) {
+	key := d.key()
+	if key != "" {
+		for i, existing := range v.Descriptors {
+			if existing.Tag == d.Tag && existing.key() == key {
+				v.Descriptors[i] = d
+				return
+			}
+		}
+	}
+	v.Descriptors = append(v.Descriptors, d)
+}
+
+// key returns the partition name or property key that identifies a
+// descriptor, if any
+func (d Descriptor) key() string {
+	decoded, err := d.Decode()
+	if err != nil {
+		return ""
+	}
+	switch v := decoded.(type) {
+	case *PropertyDescriptor:
+		return v.Key
+	case *HashDescriptor:
+		return v.PartitionName
+	case *HashtreeDescriptor:
+		return v.PartitionName
+	case *ChainPartitionDescriptor:
+		return v.PartitionName
+	}
+	return ""
+}
+
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
@@ -0,0 +1,265 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package avb
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	// for hashtree algorithms
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+const (
+	// FooterSize is the size of the footer at the end of a partition
+	FooterSize = 64
+	// BlockSize is the alignment of the vbmeta image and footer within a
+	// partition
+	BlockSize = 4096
+)
+
+var footerMagic = []byte("AVBf")
+
+// Footer locates the vbmeta image within a partition. It occupies the last
+// 64 bytes of the partition.
+type Footer struct {
+	VersionMajor      uint32
+	VersionMinor      uint32
+	OriginalImageSize uint64
+	VBMetaOffset      uint64
+	VBMetaSize        uint64
+}
+
+// ParseFooter parses the last 64 bytes of a partition, returning nil if
+// there is no footer
+func ParseFooter(blob []byte) (*Footer, error) {
+	if len(blob) != FooterSize || !bytes.HasPrefix(blob, footerMagic) {
+		return nil, nil
+	}
+	f := new(Footer)
+	_ = binary.Read(bytes.NewReader(blob[4:]), binary.BigEndian, f)
+	if f.VersionMajor != 1 {
+		return nil, fmt.Errorf("avb: unsupported footer version %d.%d", f.VersionMajor, f.VersionMinor)
+	}
+	if f.VBMetaOffset < f.OriginalImageSize {
+		return nil, errors.New("avb: vbmeta overlaps the partition image")
+	}
+	return f, nil
+}
+
+// Marshal the footer
+func (f *Footer) Marshal() []byte {
+	var buf bytes.Buffer
+	buf.Write(footerMagic)
+	_ = binary.Write(&buf, binary.BigEndian, f)
+	buf.Write(make([]byte, FooterSize-buf.Len()))
+	return buf.Bytes()
+}
+
+// hash algorithms that may be named in hash and hashtree descriptors
+func descriptorHash(name string) (crypto.Hash, error) {
+	switch name {
+	case "sha1":
+		return crypto.SHA1, nil
+	case "sha256":
+		return crypto.SHA256, nil
+	case "sha512":
+		return crypto.SHA512, nil
+	}
+	return 0, fmt.Errorf("avb: unsupported hash algorithm %q", name)
+}
+
+// NewHashDescriptor digests a partition image, like "avbtool add_hash_footer"
+func NewHashDescriptor(r io.Reader, partitionName string, size int64, hash crypto.Hash, salt []byte) (*HashDescriptor, error) {
+	desc := &HashDescriptor{
+		ImageSize:     uint64(size),
+		PartitionName: partitionName,
+		Salt:          salt,
+	}
+	for _, name := range []string{"sha1", "sha256", "sha512"} {
+		if h, _ := descriptorHash(name); h == hash {
+			desc.HashAlgorithm = name
+		}
+	}
+	if desc.HashAlgorithm == "" {
+		return nil, fmt.Errorf("avb: unsupported hash algorithm %s", hash)
+	}
+	d := hash.New()
+	d.Write(salt)
+	if _, err := io.CopyN(d, r, size); err != nil {
+		return nil, err
+	}
+	desc.Digest = d.Sum(nil)
+	return desc, nil
+}
+
+// Check the digest against a partition image
+func (h *HashDescriptor) Check(r io.ReaderAt) error {
+	hash, err := descriptorHash(h.HashAlgorithm)
+	if err != nil {
+		return err
+	}
+	d := hash.New()
+	d.Write(h.Salt)
+	if _, err := io.Copy(d, io.NewSectionReader(r, 0, int64(h.ImageSize))); err != nil {
+		return err
+	}
+	if !bytes.Equal(d.Sum(nil), h.Digest) {
+		return fmt.Errorf("avb: digest mismatch for partition %s", h.PartitionName)
+	}
+	return nil
+}
+
+// Check the root digest against a partition image by recomputing the
+// dm-verity hash tree
+func (h *HashtreeDescriptor) Check(r io.ReaderAt) error {
+	hash, err := descriptorHash(h.HashAlgorithm)
+	if err != nil {
+		return err
+	}
+	blockSize := int(h.DataBlockSize)
+	if blockSize == 0 || h.HashBlockSize != h.DataBlockSize {
+		return errors.New("avb: unsupported hashtree block size")
+	}
+	if h.ImageSize <= uint64(blockSize) {
+		return errors.New("avb: hashtree image is too small")
+	}
+	// each digest is padded to a power of two
+	digestSize := hash.Size()
+	paddedSize := 1
+	for paddedSize < digestSize {
+		paddedSize <<= 1
+	}
+	hashBlock := func(block []byte) []byte {
+		d := hash.New()
+		d.Write(h.Salt)
+		d.Write(block)
+		if len(block) < blockSize {
+			d.Write(make([]byte, blockSize-len(block)))
+		}
+		return d.Sum(nil)
+	}
+	appendDigest := func(level, digest []byte) []byte {
+		level = append(level, digest...)
+		return append(level, make([]byte, paddedSize-digestSize)...)
+	}
+	// level 0 hashes the image data
+	var level []byte
+	block := make([]byte, blockSize)
+	for off := uint64(0); off < h.ImageSize; off += uint64(blockSize) {
+		n := blockSize
+		if remaining := h.ImageSize - off; remaining < uint64(n) {
+			n = int(remaining)
+		}
+		if _, err := r.ReadAt(block[:n], int64(off)); err != nil {
+			return err
+		}
+		level = appendDigest(level, hashBlock(block[:n]))
+	}
+	level = padTo(level, blockSize)
+	// each following level hashes the one below until it fits in one block
+	for len(level) > blockSize {
+		var next []byte
+		for off := 0; off < len(level); off += blockSize {
+			next = appendDigest(next, hashBlock(level[off:off+blockSize]))
+		}
+		level = padTo(next, blockSize)
+	}
+	d := hash.New()
+	d.Write(h.Salt)
+	d.Write(level)
+	if !bytes.Equal(d.Sum(nil), h.RootDigest) {
+		return fmt.Errorf("avb: hashtree root digest mismatch for partition %s", h.PartitionName)
+	}
+	return nil
+}
+
+func padTo(b []byte, align int) []byte {
+	if rem := len(b) % align; rem != 0 {
+		b = append(b, make([]byte, align-rem)...)
+	}
+	return b
+}
+
+// AppendFooter returns the data to append to a partition image of imageSize
+// bytes so that it holds the vbmeta image and a footer. If partitionSize is
+// 0 then the partition is made just large enough.
+func AppendFooter(imageSize, partitionSize int64, vbmeta []byte) ([]byte, error) {
+	vbmetaOffset := int64(roundUp(uint64(imageSize), BlockSize))
+	vbmetaEnd := vbmetaOffset + int64(len(vbmeta))
+	if partitionSize == 0 {
+		partitionSize = int64(roundUp(uint64(vbmetaEnd), BlockSize)) + BlockSize
+	} else if partitionSize%BlockSize != 0 {
+		return nil, fmt.Errorf("avb: partition size must be a multiple of %d", BlockSize)
+	} else if vbmetaEnd > partitionSize-FooterSize {
+		return nil, fmt.Errorf("avb: partition image of %d bytes is too large for a %d byte partition", imageSize, partitionSize)
+	}
+	tail := make([]byte, partitionSize-imageSize)
+	copy(tail[vbmetaOffset-imageSize:], vbmeta)
+	footer := &Footer{
+		VersionMajor:      1,
+		OriginalImageSize: uint64(imageSize),
+		VBMetaOffset:      uint64(vbmetaOffset),
+		VBMetaSize:        uint64(len(vbmeta)),
+	}
+	copy(tail[len(tail)-FooterSize:], footer.Marshal())
+	return tail, nil
+}
+
+// maximum size of a vbmeta image, as in libavb
+const maxVBMetaSize = 64 * 1024
+
+// ReadVBMeta reads the vbmeta image from either a standalone vbmeta image or
+// a partition image with a footer. The footer is nil for a standalone image.
+func ReadVBMeta(r io.ReaderAt, size int64) ([]byte, *Footer, error) {
+	var footer *Footer
+	offset, vbmetaSize := int64(0), size
+	if size >= FooterSize {
+		footerBytes := make([]byte, FooterSize)
+		if _, err := r.ReadAt(footerBytes, size-FooterSize); err != nil {
+			return nil, nil, err
+		}
+		var err error
+		footer, err = ParseFooter(footerBytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		if footer != nil {
+			if footer.VBMetaOffset > uint64(size) || footer.VBMetaSize > uint64(size)-footer.VBMetaOffset {
+				return nil, nil, errors.New("avb: footer points outside of the partition")
+			}
+			offset, vbmetaSize = int64(footer.VBMetaOffset), int64(footer.VBMetaSize)
+		}
+	}
+	if vbmetaSize > maxVBMetaSize {
+		vbmetaSize = maxVBMetaSize
+	}
+	blob := make([]byte, vbmetaSize)
+	if _, err := r.ReadAt(blob, offset); err != nil {
+		return nil, nil, err
+	}
+	if !IsVBMeta(blob) {
+		return nil, nil, errors.New("avb: not a vbmeta image or partition with an AVB footer")
+	}
+	return blob, footer, nil
+}
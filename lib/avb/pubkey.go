@@ -0,0 +1,67 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package avb
+
+import (
+	"crypto/rsa"
+	"encoding/binary"
+	"errors"
+	"math/big"
+)
+
+// EncodePublicKey marshals an RSA public key in the format used by libavb,
+// which includes precomputed Montgomery parameters
+func EncodePublicKey(pub *rsa.PublicKey) ([]byte, error) {
+	if pub.E != 65537 {
+		return nil, errors.New("avb: RSA public exponent must be 65537")
+	}
+	bits := pub.N.BitLen()
+	if bits%32 != 0 {
+		return nil, errors.New("avb: RSA key size must be a multiple of 32 bits")
+	}
+	b := new(big.Int).Lsh(big.NewInt(1), 32)
+	n0inv := new(big.Int).ModInverse(pub.N, b)
+	if n0inv == nil {
+		return nil, errors.New("avb: invalid RSA modulus")
+	}
+	n0inv.Sub(b, n0inv)
+	rr := new(big.Int).Lsh(big.NewInt(1), uint(2*bits))
+	rr.Mod(rr, pub.N)
+	size := bits / 8
+	blob := make([]byte, 8+2*size)
+	binary.BigEndian.PutUint32(blob, uint32(bits))
+	binary.BigEndian.PutUint32(blob[4:], uint32(n0inv.Uint64()))
+	pub.N.FillBytes(blob[8 : 8+size])
+	rr.FillBytes(blob[8+size:])
+	return blob, nil
+}
+
+// DecodePublicKey parses an RSA public key in libavb format
+func DecodePublicKey(blob []byte) (*rsa.PublicKey, error) {
+	if len(blob) < 8 {
+		return nil, errors.New("avb: invalid public key")
+	}
+	bits := binary.BigEndian.Uint32(blob)
+	size := int(bits / 8)
+	if bits%32 != 0 || bits > 16384 || len(blob) != 8+2*size {
+		return nil, errors.New("avb: invalid public key")
+	}
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(blob[8 : 8+size]),
+		E: 65537,
+	}, nil
+}
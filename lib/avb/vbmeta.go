@@ -0,0 +1,337 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package avb implements Android Verified Boot 2.0 vbmeta images and
+// footers, compatible with avbtool.
+package avb
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	headerSize = 256
+	blockAlign = 64
+
+	// libavb version implemented by this package
+	versionMajor = 1
+	versionMinor = 0
+	// minor version needed to use rollback_index_location
+	versionMinorRollbackLocation = 2
+)
+
+var (
+	vbmetaMagic = []byte("AVB0")
+
+	ErrNotSigned = errors.New("vbmeta image is not signed")
+)
+
+// Algorithm is the signature algorithm of a vbmeta image
+type Algorithm uint32
+
+const (
+	AlgorithmNone Algorithm = iota
+	AlgorithmSHA256RSA2048
+	AlgorithmSHA256RSA4096
+	AlgorithmSHA256RSA8192
+	AlgorithmSHA512RSA2048
+	AlgorithmSHA512RSA4096
+	AlgorithmSHA512RSA8192
+)
+
+var algorithmNames = []string{"NONE", "SHA256_RSA2048", "SHA256_RSA4096", "SHA256_RSA8192", "SHA512_RSA2048", "SHA512_RSA4096", "SHA512_RSA8192"}
+
+func (a Algorithm) String() string {
+	if int(a) < len(algorithmNames) {
+		return algorithmNames[a]
+	}
+	return fmt.Sprintf("Algorithm(%d)", a)
+}
+
+// Hash returns the digest algorithm
+func (a Algorithm) Hash() crypto.Hash {
+	switch a {
+	case AlgorithmSHA256RSA2048, AlgorithmSHA256RSA4096, AlgorithmSHA256RSA8192:
+		return crypto.SHA256
+	case AlgorithmSHA512RSA2048, AlgorithmSHA512RSA4096, AlgorithmSHA512RSA8192:
+		return crypto.SHA512
+	}
+	return 0
+}
+
+// KeyBits returns the RSA key size
+func (a Algorithm) KeyBits() int {
+	switch a {
+	case AlgorithmSHA256RSA2048, AlgorithmSHA512RSA2048:
+		return 2048
+	case AlgorithmSHA256RSA4096, AlgorithmSHA512RSA4096:
+		return 4096
+	case AlgorithmSHA256RSA8192, AlgorithmSHA512RSA8192:
+		return 8192
+	}
+	return 0
+}
+
+// AlgorithmFor returns the algorithm that uses the given key and digest
+func AlgorithmFor(pub crypto.PublicKey, hash crypto.Hash) (Algorithm, error) {
+	key, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return 0, fmt.Errorf("avb: unsupported key type %T, only RSA is supported", pub)
+	}
+	for alg := AlgorithmSHA256RSA2048; alg <= AlgorithmSHA512RSA8192; alg++ {
+		if alg.Hash() == hash && alg.KeyBits() == key.N.BitLen() {
+			return alg, nil
+		}
+	}
+	return 0, fmt.Errorf("avb: unsupported combination of %d-bit RSA key and %s", key.N.BitLen(), hash)
+}
+
+type header struct {
+	Magic                       [4]byte
+	RequiredLibavbVersionMajor  uint32
+	RequiredLibavbVersionMinor  uint32
+	AuthenticationDataBlockSize uint64
+	AuxiliaryDataBlockSize      uint64
+	AlgorithmType               Algorithm
+	HashOffset                  uint64
+	HashSize                    uint64
+	SignatureOffset             uint64
+	SignatureSize               uint64
+	PublicKeyOffset             uint64
+	PublicKeySize               uint64
+	PublicKeyMetadataOffset     uint64
+	PublicKeyMetadataSize       uint64
+	DescriptorsOffset           uint64
+	DescriptorsSize             uint64
+	RollbackIndex               uint64
+	Flags                       uint32
+	RollbackIndexLocation       uint32
+	ReleaseString               [48]byte
+	Reserved                    [80]byte
+}
+
+// VBMeta is a parsed vbmeta image
+type VBMeta struct {
+	Algorithm             Algorithm
+	RollbackIndex         uint64
+	RollbackIndexLocation uint32
+	Flags                 uint32
+	ReleaseString         string
+	Descriptors           []Descriptor
+	// PublicKey in AVB format, as written by "avbtool extract_public_key"
+	PublicKey         []byte
+	PublicKeyMetadata []byte
+
+	requiredMinor uint32
+	signed        []byte
+	hash          []byte
+	signature     []byte
+}
+
+// IsVBMeta returns true if the blob starts with a vbmeta header
+func IsVBMeta(blob []byte) bool {
+	return bytes.HasPrefix(blob, vbmetaMagic)
+}
+
+// Parse a vbmeta image. Any trailing data is ignored.
+func Parse(blob []byte) (*VBMeta, error) {
+	var hdr header
+	if len(blob) < headerSize || !IsVBMeta(blob) {
+		return nil, errors.New("avb: not a vbmeta image")
+	}
+	_ = binary.Read(bytes.NewReader(blob), binary.BigEndian, &hdr)
+	if hdr.RequiredLibavbVersionMajor != versionMajor {
+		return nil, fmt.Errorf("avb: unsupported libavb version %d.%d", hdr.RequiredLibavbVersionMajor, hdr.RequiredLibavbVersionMinor)
+	}
+	authSize := hdr.AuthenticationDataBlockSize
+	auxSize := hdr.AuxiliaryDataBlockSize
+	if authSize%blockAlign != 0 || auxSize%blockAlign != 0 || authSize+auxSize > uint64(len(blob)-headerSize) {
+		return nil, errors.New("avb: invalid vbmeta block sizes")
+	}
+	auth := blob[headerSize : headerSize+authSize]
+	aux := blob[headerSize+authSize : headerSize+authSize+auxSize]
+	slice := func(block []byte, off, size uint64) ([]byte, error) {
+		if off > uint64(len(block)) || size > uint64(len(block))-off {
+			return nil, errors.New("avb: vbmeta field is out of bounds")
+		}
+		return block[off : off+size], nil
+	}
+	v := &VBMeta{
+		Algorithm:             hdr.AlgorithmType,
+		RollbackIndex:         hdr.RollbackIndex,
+		RollbackIndexLocation: hdr.RollbackIndexLocation,
+		Flags:                 hdr.Flags,
+		ReleaseString:         string(bytes.TrimRight(hdr.ReleaseString[:], "\x00")),
+		requiredMinor:         hdr.RequiredLibavbVersionMinor,
+		signed:                blob[:headerSize+authSize+auxSize],
+	}
+	var err error
+	if v.hash, err = slice(auth, hdr.HashOffset, hdr.HashSize); err != nil {
+		return nil, err
+	}
+	if v.signature, err = slice(auth, hdr.SignatureOffset, hdr.SignatureSize); err != nil {
+		return nil, err
+	}
+	if v.PublicKey, err = slice(aux, hdr.PublicKeyOffset, hdr.PublicKeySize); err != nil {
+		return nil, err
+	}
+	if v.PublicKeyMetadata, err = slice(aux, hdr.PublicKeyMetadataOffset, hdr.PublicKeyMetadataSize); err != nil {
+		return nil, err
+	}
+	descriptors, err := slice(aux, hdr.DescriptorsOffset, hdr.DescriptorsSize)
+	if err != nil {
+		return nil, err
+	}
+	if v.Descriptors, err = parseDescriptors(descriptors); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Size of the vbmeta image as it was parsed
+func (v *VBMeta) Size() int {
+	return len(v.signed)
+}
+
+// Sign the image with an RSA key, returning the marshalled result. The
+// algorithm, public key and release string are updated to match.
+func (v *VBMeta) Sign(signer crypto.Signer, hash crypto.Hash) ([]byte, error) {
+	alg, err := AlgorithmFor(signer.Public(), hash)
+	if err != nil {
+		return nil, err
+	}
+	v.Algorithm = alg
+	v.PublicKey, err = EncodePublicKey(signer.Public().(*rsa.PublicKey))
+	if err != nil {
+		return nil, err
+	}
+	// lay out the auxiliary block: descriptors, public key, metadata
+	var aux bytes.Buffer
+	for _, desc := range v.Descriptors {
+		aux.Write(desc.marshal())
+	}
+	descSize := aux.Len()
+	aux.Write(v.PublicKey)
+	aux.Write(v.PublicKeyMetadata)
+	padBlock(&aux)
+	sigSize := alg.KeyBits() / 8
+	hdr := header{
+		RequiredLibavbVersionMajor:  versionMajor,
+		RequiredLibavbVersionMinor:  v.minorVersion(),
+		AuthenticationDataBlockSize: roundUp(uint64(hash.Size()+sigSize), blockAlign),
+		AuxiliaryDataBlockSize:      uint64(aux.Len()),
+		AlgorithmType:               alg,
+		HashOffset:                  0,
+		HashSize:                    uint64(hash.Size()),
+		SignatureOffset:             uint64(hash.Size()),
+		SignatureSize:               uint64(sigSize),
+		PublicKeyOffset:             uint64(descSize),
+		PublicKeySize:               uint64(len(v.PublicKey)),
+		PublicKeyMetadataOffset:     uint64(descSize + len(v.PublicKey)),
+		PublicKeyMetadataSize:       uint64(len(v.PublicKeyMetadata)),
+		DescriptorsOffset:           0,
+		DescriptorsSize:             uint64(descSize),
+		RollbackIndex:               v.RollbackIndex,
+		Flags:                       v.Flags,
+		RollbackIndexLocation:       v.RollbackIndexLocation,
+	}
+	copy(hdr.Magic[:], vbmetaMagic)
+	if len(v.ReleaseString) >= len(hdr.ReleaseString) {
+		return nil, errors.New("avb: release string is too long")
+	}
+	copy(hdr.ReleaseString[:], v.ReleaseString)
+	var hdrBuf bytes.Buffer
+	_ = binary.Write(&hdrBuf, binary.BigEndian, hdr)
+	d := hash.New()
+	d.Write(hdrBuf.Bytes())
+	d.Write(aux.Bytes())
+	digest := d.Sum(nil)
+	sig, err := signer.Sign(rand.Reader, digest, hash)
+	if err != nil {
+		return nil, err
+	}
+	if len(sig) != sigSize {
+		return nil, errors.New("avb: signature is the wrong size")
+	}
+	auth := make([]byte, hdr.AuthenticationDataBlockSize)
+	copy(auth, digest)
+	copy(auth[len(digest):], sig)
+	blob := append(hdrBuf.Bytes(), auth...)
+	blob = append(blob, aux.Bytes()...)
+	v.requiredMinor = hdr.RequiredLibavbVersionMinor
+	v.signed = blob
+	v.hash = digest
+	v.signature = sig
+	return blob, nil
+}
+
+// the oldest libavb that can verify the image
+func (v *VBMeta) minorVersion() uint32 {
+	minor := uint32(versionMinor)
+	if v.RollbackIndexLocation != 0 {
+		minor = versionMinorRollbackLocation
+	}
+	if v.requiredMinor > minor {
+		minor = v.requiredMinor
+	}
+	return minor
+}
+
+// Verify the image's hash and signature, returning the embedded public key
+// that produced it. The caller must decide whether the key is trusted.
+func (v *VBMeta) Verify() (*rsa.PublicKey, error) {
+	hash := v.Algorithm.Hash()
+	if v.Algorithm == AlgorithmNone {
+		return nil, ErrNotSigned
+	} else if hash == 0 {
+		return nil, fmt.Errorf("avb: unsupported algorithm %s", v.Algorithm)
+	}
+	pub, err := DecodePublicKey(v.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if pub.N.BitLen() != v.Algorithm.KeyBits() {
+		return nil, errors.New("avb: public key does not match the algorithm")
+	}
+	var hdr header
+	_ = binary.Read(bytes.NewReader(v.signed), binary.BigEndian, &hdr)
+	authEnd := headerSize + hdr.AuthenticationDataBlockSize
+	d := hash.New()
+	d.Write(v.signed[:headerSize])
+	d.Write(v.signed[authEnd:])
+	digest := d.Sum(nil)
+	if !bytes.Equal(digest, v.hash) {
+		return nil, errors.New("avb: vbmeta hash mismatch")
+	}
+	if err := rsa.VerifyPKCS1v15(pub, hash, digest, v.signature); err != nil {
+		return nil, fmt.Errorf("avb: vbmeta signature verification failed: %w", err)
+	}
+	return pub, nil
+}
+
+func roundUp(n, align uint64) uint64 {
+	return (n + align - 1) / align * align
+}
+
+func padBlock(buf *bytes.Buffer) {
+	buf.Write(make([]byte, int(roundUp(uint64(buf.Len()), blockAlign))-buf.Len()))
+}
@@ -234,3 +234,20 @@ func canOverwrite(ininfo, outinfo os.FileInfo) bool {
 	}
 	return true
 }
+
+// ApplyBytes applies a PatchSet to an in-memory copy of a file and returns
+// the result
+func (p *PatchSet) ApplyBytes(blob []byte) ([]byte, error) {
+	sort.Sort(sorter{p})
+	out := make([]byte, 0, len(blob))
+	var pos int64
+	for i, patch := range p.Patches {
+		if patch.Offset < pos || patch.Offset+int64(patch.OldSize) > int64(len(blob)) {
+			return nil, errors.New("patch is out of range")
+		}
+		out = append(out, blob[pos:patch.Offset]...)
+		out = append(out, p.Blobs[i]...)
+		pos = patch.Offset + int64(patch.OldSize)
+	}
+	return append(out, blob[pos:]...), nil
+}
@@ -0,0 +1,220 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package bpfsig signs eBPF object files. The signature is a detached PKCS#7
+// signature appended to the ELF object along with a descriptor and a magic
+// trailer, laid out the same way as a kernel module signature so that a
+// loader can find it with the same code. ELF readers, including libbpf, ignore
+// data after the last section so the object still loads unchanged.
+//
+// Only the parts of the object that determine what is loaded into the kernel
+// are signed: program code, maps and global data, the license and version,
+// BTF, the symbol table, and the relocations that apply to signed sections.
+// Each of those sections contributes its name, type, size and contents to the
+// signed data, in section header order. Debug information is not signed, but
+// removing it also rewrites the symbol table, so objects should be stripped
+// before they are signed.
+package bpfsig
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"debug/elf"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/pkcs7"
+	"github.com/sassoftware/relic/v7/lib/pkcs9"
+	"github.com/sassoftware/relic/v7/signers/sigerrors"
+)
+
+// Magic is the trailer at the very end of a signed object
+const Magic = "~BPF signature appended~\n"
+
+// pkeyIDPKCS7 identifies the signature as PKCS#7. All other fields of the
+// descriptor are unused for this type.
+const pkeyIDPKCS7 = 2
+
+// same layout as struct module_signature
+type bpfSignature struct {
+	Algo      uint8
+	Hash      uint8
+	IDType    uint8
+	SignerLen uint8
+	KeyIDLen  uint8
+	Pad       [3]byte
+	SigLen    uint32 // big-endian
+}
+
+const descriptorSize = 12
+
+// Split an object into its unsigned contents and its signature, if it has one
+func Split(blob []byte) (contents, sig []byte, err error) {
+	if !bytes.HasSuffix(blob, []byte(Magic)) {
+		return blob, nil, nil
+	}
+	rest := blob[:len(blob)-len(Magic)]
+	if len(rest) < descriptorSize {
+		return nil, nil, errors.New("bpf: truncated signature descriptor")
+	}
+	var desc bpfSignature
+	_ = binary.Read(bytes.NewReader(rest[len(rest)-descriptorSize:]), binary.BigEndian, &desc)
+	rest = rest[:len(rest)-descriptorSize]
+	if desc.IDType != pkeyIDPKCS7 {
+		return nil, nil, fmt.Errorf("bpf: unsupported signature type %d", desc.IDType)
+	}
+	if int64(desc.SigLen) > int64(len(rest)) {
+		return nil, nil, errors.New("bpf: invalid signature length")
+	}
+	split := len(rest) - int(desc.SigLen)
+	return rest[:split], rest[split:], nil
+}
+
+// SignedContent returns the data covered by the signature of an unsigned
+// object
+func SignedContent(contents []byte) ([]byte, error) {
+	f, err := elf.NewFile(bytes.NewReader(contents))
+	if err != nil {
+		return nil, fmt.Errorf("bpf: %w", err)
+	}
+	if f.Machine != elf.EM_BPF {
+		return nil, fmt.Errorf("bpf: not an eBPF object (machine is %s)", f.Machine)
+	}
+	signed := make([]bool, len(f.Sections))
+	for i, sect := range f.Sections {
+		signed[i] = isLoaded(sect)
+	}
+	// relocations matter if they apply to something that is loaded, and
+	// the symbol table because they refer to it
+	for i, sect := range f.Sections {
+		if (sect.Type == elf.SHT_REL || sect.Type == elf.SHT_RELA) && int(sect.Info) < len(signed) && signed[sect.Info] {
+			signed[i] = true
+		}
+		if sect.Type == elf.SHT_SYMTAB {
+			signed[i] = true
+			if int(sect.Link) < len(signed) {
+				signed[sect.Link] = true
+			}
+		}
+	}
+	var b bytes.Buffer
+	for i, sect := range f.Sections {
+		if !signed[i] {
+			continue
+		}
+		b.WriteString(sect.Name)
+		b.WriteByte(0)
+		_ = binary.Write(&b, binary.BigEndian, uint32(sect.Type))
+		_ = binary.Write(&b, binary.BigEndian, sect.Size)
+		if sect.Type == elf.SHT_NOBITS {
+			continue
+		}
+		if _, err := io.Copy(&b, sect.Open()); err != nil {
+			return nil, fmt.Errorf("bpf: reading section %s: %w", sect.Name, err)
+		}
+	}
+	return b.Bytes(), nil
+}
+
+// check if a section is loaded into the kernel
+func isLoaded(sect *elf.Section) bool {
+	if sect.Type == elf.SHT_PROGBITS && sect.Flags&elf.SHF_EXECINSTR != 0 {
+		return true
+	}
+	switch sect.Name {
+	case "maps", ".maps", "license", "version", ".BTF", ".BTF.ext", ".kconfig", ".ksyms":
+		return true
+	}
+	for _, prefix := range []string{".data", ".rodata", ".bss"} {
+		if sect.Name == prefix || strings.HasPrefix(sect.Name, prefix+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Sign the object contents and return the signature block to append to it,
+// including the descriptor and trailer. As with kernel modules the signature
+// has no authenticated attributes and no embedded certificates, and the
+// verifier finds the key by issuer and serial number.
+func Sign(contents []byte, cert *certloader.Certificate, hash crypto.Hash) ([]byte, *pkcs9.TimestampedSignature, error) {
+	signed, err := SignedContent(contents)
+	if err != nil {
+		return nil, nil, err
+	}
+	d := hash.New()
+	d.Write(signed)
+	builder := pkcs7.NewBuilder(cert.Signer(), cert.Chain(), hash)
+	if err := builder.SetDetachedContent(pkcs7.OidData, d.Sum(nil)); err != nil {
+		return nil, nil, err
+	}
+	psd, err := builder.Sign()
+	if err != nil {
+		return nil, nil, err
+	}
+	sig, err := psd.Content.Verify(signed, false)
+	if err != nil {
+		return nil, nil, fmt.Errorf("pkcs7: failed signature self-check: %w", err)
+	}
+	psd.Content.Certificates = nil
+	der, err := psd.Marshal()
+	if err != nil {
+		return nil, nil, err
+	}
+	var b bytes.Buffer
+	b.Write(der)
+	_ = binary.Write(&b, binary.BigEndian, bpfSignature{
+		IDType: pkeyIDPKCS7,
+		SigLen: uint32(len(der)),
+	})
+	b.WriteString(Magic)
+	return b.Bytes(), &pkcs9.TimestampedSignature{Signature: sig, Raw: der}, nil
+}
+
+// Verify the signature on an object. Signatures don't carry the signer
+// certificate so it must be found among the given keyring certificates.
+func Verify(blob []byte, keyring []*x509.Certificate, skipDigests bool) (*pkcs9.TimestampedSignature, error) {
+	contents, der, err := Split(blob)
+	if err != nil {
+		return nil, err
+	} else if der == nil {
+		return nil, sigerrors.NotSignedError{Type: "eBPF object"}
+	}
+	signed, err := SignedContent(contents)
+	if err != nil {
+		return nil, err
+	}
+	psd, err := pkcs7.Unmarshal(der)
+	if err != nil {
+		return nil, fmt.Errorf("bpf: %w", err)
+	}
+	for _, cert := range keyring {
+		psd.Content.Certificates = append(psd.Content.Certificates, asn1.RawValue{FullBytes: cert.Raw})
+	}
+	sig, err := psd.Content.Verify(signed, skipDigests)
+	if errors.As(err, &pkcs7.MissingCertificateError{}) {
+		return nil, fmt.Errorf("bpf: signer is not in the keyring: %w", err)
+	} else if err != nil {
+		return nil, err
+	}
+	return &pkcs9.TimestampedSignature{Signature: sig, Raw: der}, nil
+}
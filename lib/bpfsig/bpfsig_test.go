@@ -0,0 +1,160 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package bpfsig_test
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"debug/elf"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sassoftware/relic/v7/internal/testcert"
+	"github.com/sassoftware/relic/v7/lib/bpfsig"
+)
+
+type testSection struct {
+	name  string
+	typ   elf.SectionType
+	flags elf.SectionFlag
+	link  uint32
+	info  uint32
+	data  []byte
+}
+
+// build a little-endian ELF64 relocatable object
+func buildObject(machine elf.Machine, sections []testSection) []byte {
+	// section 0 is null and the last is the section name table
+	var names bytes.Buffer
+	names.WriteByte(0)
+	nameOffsets := make([]uint32, len(sections)+1)
+	for i, s := range sections {
+		nameOffsets[i] = uint32(names.Len())
+		names.WriteString(s.name)
+		names.WriteByte(0)
+	}
+	nameOffsets[len(sections)] = uint32(names.Len())
+	names.WriteString(".shstrtab\x00")
+	sections = append(sections, testSection{typ: elf.SHT_STRTAB, data: names.Bytes()})
+
+	var body bytes.Buffer
+	body.Write(make([]byte, 64))
+	headers := []elf.Section64{{}}
+	for i, s := range sections {
+		off := body.Len()
+		if s.typ != elf.SHT_NOBITS {
+			body.Write(s.data)
+		}
+		headers = append(headers, elf.Section64{
+			Name:      nameOffsets[i],
+			Type:      uint32(s.typ),
+			Flags:     uint64(s.flags),
+			Off:       uint64(off),
+			Size:      uint64(len(s.data)),
+			Link:      s.link,
+			Info:      s.info,
+			Addralign: 1,
+		})
+	}
+	for body.Len()%8 != 0 {
+		body.WriteByte(0)
+	}
+	shoff := body.Len()
+	_ = binary.Write(&body, binary.LittleEndian, headers)
+	hdr := elf.Header64{
+		Type:      uint16(elf.ET_REL),
+		Machine:   uint16(machine),
+		Version:   uint32(elf.EV_CURRENT),
+		Shoff:     uint64(shoff),
+		Ehsize:    64,
+		Shentsize: 64,
+		Shnum:     uint16(len(headers)),
+		Shstrndx:  uint16(len(headers) - 1),
+	}
+	copy(hdr.Ident[:], elf.ELFMAG)
+	hdr.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	hdr.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	hdr.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+	blob := body.Bytes()
+	var h bytes.Buffer
+	_ = binary.Write(&h, binary.LittleEndian, hdr)
+	copy(blob, h.Bytes())
+	return blob
+}
+
+func testObject(debugInfo string) []byte {
+	return buildObject(elf.EM_BPF, []testSection{
+		{name: "xdp", typ: elf.SHT_PROGBITS, flags: elf.SHF_ALLOC | elf.SHF_EXECINSTR, data: []byte("\x95\x00\x00\x00\x00\x00\x00\x00")},
+		{name: ".relxdp", typ: elf.SHT_REL, link: 5, info: 1, data: make([]byte, 16)},
+		{name: ".maps", typ: elf.SHT_PROGBITS, flags: elf.SHF_ALLOC | elf.SHF_WRITE, data: make([]byte, 32)},
+		{name: "license", typ: elf.SHT_PROGBITS, flags: elf.SHF_ALLOC | elf.SHF_WRITE, data: []byte("GPL\x00")},
+		{name: ".symtab", typ: elf.SHT_SYMTAB, link: 6, data: make([]byte, 48)},
+		{name: ".strtab", typ: elf.SHT_STRTAB, data: []byte("\x00prog\x00")},
+		{name: ".debug_info", typ: elf.SHT_PROGBITS, data: []byte(debugInfo)},
+	})
+}
+
+func TestSignedContent(t *testing.T) {
+	a, err := bpfsig.SignedContent(testObject("debug"))
+	require.NoError(t, err)
+	b, err := bpfsig.SignedContent(testObject("different debug info"))
+	require.NoError(t, err)
+	assert.Equal(t, a, b)
+	for _, name := range []string{"xdp", ".relxdp", ".maps", "license", ".symtab", ".strtab"} {
+		assert.Contains(t, string(a), name+"\x00")
+	}
+	assert.NotContains(t, string(a), ".debug_info")
+
+	_, err = bpfsig.SignedContent(buildObject(elf.EM_X86_64, nil))
+	assert.EqualError(t, err, "bpf: not an eBPF object (machine is EM_X86_64)")
+}
+
+func TestSign(t *testing.T) {
+	key := testcert.ECDSAKey(t)
+	cert := testcert.Signer(t, &x509.Certificate{Subject: pkix.Name{CommonName: "bpf signer"}}, key)
+	obj := testObject("debug")
+	sigblock, _, err := bpfsig.Sign(obj, cert, crypto.SHA256)
+	require.NoError(t, err)
+	signed := append(append([]byte(nil), obj...), sigblock...)
+	assert.True(t, bytes.HasSuffix(signed, []byte(bpfsig.Magic)))
+	// still a valid ELF object
+	_, err = elf.NewFile(bytes.NewReader(signed))
+	require.NoError(t, err)
+
+	contents, sig, err := bpfsig.Split(signed)
+	require.NoError(t, err)
+	assert.Equal(t, obj, contents)
+	assert.NotEmpty(t, sig)
+
+	ts, err := bpfsig.Verify(signed, []*x509.Certificate{cert.Leaf}, false)
+	require.NoError(t, err)
+	assert.Equal(t, cert.Leaf, ts.Certificate)
+	_, err = bpfsig.Verify(signed, nil, false)
+	assert.ErrorContains(t, err, "signer is not in the keyring")
+	_, err = bpfsig.Verify(obj, nil, false)
+	assert.EqualError(t, err, "eBPF object contains no signatures")
+
+	// changing the program invalidates the signature
+	tampered := bytes.Replace(signed, []byte("GPL\x00"), []byte("MIT\x00"), 1)
+	_, err = bpfsig.Verify(tampered, []*x509.Certificate{cert.Leaf}, false)
+	assert.Error(t, err)
+}
@@ -0,0 +1,375 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cabfile
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Folder compression types
+const (
+	CompressNone  = 0
+	CompressMSZIP = 1
+	compressMask  = 0x0f
+
+	maxBlockSize = 32768
+	headerSize   = 36
+	folderSize   = 8
+)
+
+var mszipMagic = []byte("CK")
+
+// Archive is a fully parsed single-part cabinet whose members can be replaced.
+// Folders without any replaced members are copied verbatim when the archive
+// is rebuilt, and any signature is discarded.
+type Archive struct {
+	Header  Header
+	Folders []*Folder
+	Files   []*File
+}
+
+type Folder struct {
+	Compression uint16
+	blocks      []dataBlock
+	contents    []byte
+	dirty       bool
+}
+
+type dataBlock struct {
+	Checksum     uint32
+	Data         []byte
+	Uncompressed uint16
+}
+
+type File struct {
+	Name       string
+	Folder     int
+	Date, Time uint16
+	Attributes uint16
+	offset     uint32
+	size       uint32
+	data       []byte
+}
+
+type fileHeader struct {
+	Size       uint32
+	Offset     uint32
+	Folder     uint16
+	Date, Time uint16
+	Attributes uint16
+}
+
+type dataHeader struct {
+	Checksum     uint32
+	Size         uint16
+	Uncompressed uint16
+}
+
+// ReadArchive parses a cabinet and all of its data blocks
+func ReadArchive(blob []byte) (*Archive, error) {
+	a := new(Archive)
+	r := bytes.NewReader(blob)
+	if err := binary.Read(r, binary.LittleEndian, &a.Header); err != nil {
+		return nil, err
+	}
+	if a.Header.Magic != Magic {
+		return nil, errors.New("not a cab file")
+	}
+	if a.Header.Flags&(FlagPrevCabinet|FlagNextCabinet) != 0 {
+		return nil, errors.New("multipart cab files are not supported")
+	}
+	var reserve ReserveHeader
+	if a.Header.Flags&FlagReservePresent != 0 {
+		if err := binary.Read(r, binary.LittleEndian, &reserve); err != nil {
+			return nil, err
+		}
+		if _, err := r.Seek(int64(reserve.HeaderSize), io.SeekCurrent); err != nil {
+			return nil, err
+		}
+	}
+	folders := make([]FolderHeader, a.Header.NumFolders)
+	for i := range folders {
+		if err := binary.Read(r, binary.LittleEndian, &folders[i]); err != nil {
+			return nil, err
+		}
+		if _, err := r.Seek(int64(reserve.FolderSize), io.SeekCurrent); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := r.Seek(int64(a.Header.OffsetFiles), io.SeekStart); err != nil {
+		return nil, err
+	}
+	for i := 0; i < int(a.Header.NumFiles); i++ {
+		var fh fileHeader
+		if err := binary.Read(r, binary.LittleEndian, &fh); err != nil {
+			return nil, err
+		}
+		name, err := readCString(r)
+		if err != nil {
+			return nil, err
+		}
+		if int(fh.Folder) >= len(folders) {
+			return nil, fmt.Errorf("file %q is in a continued or missing folder", name)
+		}
+		a.Files = append(a.Files, &File{
+			Name:       name,
+			Folder:     int(fh.Folder),
+			Date:       fh.Date,
+			Time:       fh.Time,
+			Attributes: fh.Attributes,
+			offset:     fh.Offset,
+			size:       fh.Size,
+		})
+	}
+	for _, fh := range folders {
+		folder := &Folder{Compression: fh.Compression}
+		if _, err := r.Seek(int64(fh.Offset), io.SeekStart); err != nil {
+			return nil, err
+		}
+		for j := 0; j < int(fh.NumData); j++ {
+			var dh dataHeader
+			if err := binary.Read(r, binary.LittleEndian, &dh); err != nil {
+				return nil, err
+			}
+			if _, err := r.Seek(int64(reserve.DataSize), io.SeekCurrent); err != nil {
+				return nil, err
+			}
+			data := make([]byte, dh.Size)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return nil, err
+			}
+			folder.blocks = append(folder.blocks, dataBlock{dh.Checksum, data, dh.Uncompressed})
+		}
+		a.Folders = append(a.Folders, folder)
+	}
+	return a, nil
+}
+
+func readCString(r *bytes.Reader) (string, error) {
+	var name []byte
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		} else if c == 0 {
+			return string(name), nil
+		}
+		name = append(name, c)
+	}
+}
+
+// decompress a folder into its contents
+func (f *Folder) decompress() ([]byte, error) {
+	if f.contents != nil {
+		return f.contents, nil
+	}
+	var out []byte
+	switch f.Compression & compressMask {
+	case CompressNone:
+		for _, block := range f.blocks {
+			out = append(out, block.Data...)
+		}
+	case CompressMSZIP:
+		var dict []byte
+		for _, block := range f.blocks {
+			if !bytes.HasPrefix(block.Data, mszipMagic) {
+				return nil, errors.New("invalid MSZIP block")
+			}
+			// each block may refer back to the previous one
+			zr := flate.NewReaderDict(bytes.NewReader(block.Data[2:]), dict)
+			chunk := make([]byte, block.Uncompressed)
+			if _, err := io.ReadFull(zr, chunk); err != nil {
+				return nil, fmt.Errorf("decompressing MSZIP block: %w", err)
+			}
+			out = append(out, chunk...)
+			dict = chunk
+		}
+	default:
+		return nil, fmt.Errorf("unsupported cabinet compression type %#x", f.Compression)
+	}
+	f.contents = out
+	return out, nil
+}
+
+// Contents returns the uncompressed contents of a member
+func (a *Archive) Contents(file *File) ([]byte, error) {
+	if file.data != nil {
+		return file.data, nil
+	}
+	contents, err := a.Folders[file.Folder].decompress()
+	if err != nil {
+		return nil, err
+	}
+	end := uint64(file.offset) + uint64(file.size)
+	if end > uint64(len(contents)) {
+		return nil, fmt.Errorf("file %q extends past the end of its folder", file.Name)
+	}
+	return contents[file.offset:end], nil
+}
+
+// Replace the contents of a member. Its folder will be recompressed when the
+// archive is marshalled.
+func (a *Archive) Replace(file *File, data []byte) error {
+	// make sure the rest of the folder can be read before changing anything
+	for _, other := range a.Files {
+		if other.Folder == file.Folder && other.data == nil {
+			contents, err := a.Contents(other)
+			if err != nil {
+				return err
+			}
+			other.data = contents
+		}
+	}
+	file.data = data
+	a.Folders[file.Folder].dirty = true
+	return nil
+}
+
+// Marshal the archive into a new cabinet without a signature
+func (a *Archive) Marshal() ([]byte, error) {
+	// rebuild modified folders
+	for i, folder := range a.Folders {
+		if !folder.dirty {
+			continue
+		}
+		var contents []byte
+		for _, file := range a.Files {
+			if file.Folder == i {
+				file.offset = uint32(len(contents))
+				file.size = uint32(len(file.data))
+				contents = append(contents, file.data...)
+			}
+		}
+		blocks, err := compressFolder(contents, folder.Compression)
+		if err != nil {
+			return nil, err
+		}
+		folder.blocks = blocks
+		folder.contents = contents
+		folder.dirty = false
+	}
+	// lay out the header, folders, files and data
+	var files bytes.Buffer
+	for _, file := range a.Files {
+		_ = binary.Write(&files, binary.LittleEndian, fileHeader{
+			Size:       file.size,
+			Offset:     file.offset,
+			Folder:     uint16(file.Folder),
+			Date:       file.Date,
+			Time:       file.Time,
+			Attributes: file.Attributes,
+		})
+		files.WriteString(file.Name)
+		files.WriteByte(0)
+	}
+	offsetFiles := headerSize + folderSize*len(a.Folders)
+	dataOffset := offsetFiles + files.Len()
+	var folders, data bytes.Buffer
+	for _, folder := range a.Folders {
+		if len(folder.blocks) > 0xffff {
+			return nil, errors.New("too many data blocks in folder")
+		}
+		_ = binary.Write(&folders, binary.LittleEndian, FolderHeader{
+			Offset:      uint32(dataOffset + data.Len()),
+			NumData:     uint16(len(folder.blocks)),
+			Compression: folder.Compression,
+		})
+		for _, block := range folder.blocks {
+			_ = binary.Write(&data, binary.LittleEndian, dataHeader{block.Checksum, uint16(len(block.Data)), block.Uncompressed})
+			data.Write(block.Data)
+		}
+	}
+	total := dataOffset + data.Len()
+	if int64(total) > 0x7fffffff {
+		return nil, errors.New("cabinet is too large")
+	}
+	hdr := a.Header
+	hdr.TotalSize = uint32(total)
+	hdr.OffsetFiles = uint32(offsetFiles)
+	hdr.NumFolders = uint16(len(a.Folders))
+	hdr.NumFiles = uint16(len(a.Files))
+	hdr.Flags &^= FlagReservePresent
+	out := bytes.NewBuffer(make([]byte, 0, total))
+	_ = binary.Write(out, binary.LittleEndian, hdr)
+	out.Write(folders.Bytes())
+	out.Write(files.Bytes())
+	out.Write(data.Bytes())
+	return out.Bytes(), nil
+}
+
+// split folder contents into data blocks and compress each one
+func compressFolder(contents []byte, compression uint16) ([]dataBlock, error) {
+	var blocks []dataBlock
+	for len(contents) > 0 {
+		n := len(contents)
+		if n > maxBlockSize {
+			n = maxBlockSize
+		}
+		chunk := contents[:n]
+		contents = contents[n:]
+		var data []byte
+		switch compression & compressMask {
+		case CompressNone:
+			data = chunk
+		case CompressMSZIP:
+			// blocks are compressed independently, which is allowed even
+			// though the decompressor keeps the previous block as history
+			buf := bytes.NewBuffer(append([]byte(nil), mszipMagic...))
+			zw, _ := flate.NewWriter(buf, flate.DefaultCompression)
+			_, _ = zw.Write(chunk)
+			if err := zw.Close(); err != nil {
+				return nil, err
+			}
+			data = buf.Bytes()
+			if len(data) > maxBlockSize+12 {
+				return nil, errors.New("MSZIP block is too large")
+			}
+		default:
+			return nil, fmt.Errorf("unsupported cabinet compression type %#x", compression)
+		}
+		block := dataBlock{Data: data, Uncompressed: uint16(n)}
+		var sizes [4]byte
+		binary.LittleEndian.PutUint16(sizes[:], uint16(len(data)))
+		binary.LittleEndian.PutUint16(sizes[2:], uint16(n))
+		block.Checksum = checksum(sizes[:], checksum(data, 0))
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
+
+// checksum used by CFDATA blocks
+func checksum(data []byte, sum uint32) uint32 {
+	for len(data) >= 4 {
+		sum ^= binary.LittleEndian.Uint32(data)
+		data = data[4:]
+	}
+	var tail uint32
+	switch len(data) {
+	case 3:
+		tail = uint32(data[0])<<16 | uint32(data[1])<<8 | uint32(data[2])
+	case 2:
+		tail = uint32(data[0])<<8 | uint32(data[1])
+	case 1:
+		tail = uint32(data[0])
+	}
+	return sum ^ tail
+}
@@ -0,0 +1,111 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cabfile
+
+import (
+	"bytes"
+	"crypto"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestArchive(t *testing.T, compression uint16) []byte {
+	a := &Archive{
+		Header:  Header{Magic: Magic, Version: 0x0103},
+		Folders: []*Folder{{Compression: compression, dirty: true}},
+	}
+	big := make([]byte, 100000)
+	rand.New(rand.NewSource(1)).Read(big[:50000])
+	for _, f := range []struct {
+		name string
+		data []byte
+	}{
+		{"one.txt", []byte("hello world")},
+		{"big.bin", big},
+		{"three.txt", []byte("goodbye")},
+	} {
+		a.Files = append(a.Files, &File{Name: f.name, data: f.data})
+	}
+	blob, err := a.Marshal()
+	require.NoError(t, err)
+	return blob
+}
+
+func TestArchive(t *testing.T) {
+	for _, compression := range []uint16{CompressNone, CompressMSZIP} {
+		blob := newTestArchive(t, compression)
+		// digesting walks the same structures that other tools do
+		_, err := Digest(bytes.NewReader(blob), crypto.SHA256)
+		require.NoError(t, err)
+		a, err := ReadArchive(blob)
+		require.NoError(t, err)
+		require.Len(t, a.Files, 3)
+		assert.Equal(t, "big.bin", a.Files[1].Name)
+		for _, folder := range a.Folders {
+			for _, block := range folder.blocks {
+				var sizes [4]byte
+				sizes[0], sizes[1] = byte(len(block.Data)), byte(len(block.Data)>>8)
+				sizes[2], sizes[3] = byte(block.Uncompressed), byte(block.Uncompressed>>8)
+				assert.Equal(t, block.Checksum, checksum(sizes[:], checksum(block.Data, 0)))
+			}
+		}
+		contents, err := a.Contents(a.Files[0])
+		require.NoError(t, err)
+		assert.Equal(t, "hello world", string(contents))
+		// unchanged archives are reproduced exactly
+		same, err := a.Marshal()
+		require.NoError(t, err)
+		assert.Equal(t, blob, same)
+		// replace a member and read it back
+		require.NoError(t, a.Replace(a.Files[0], []byte("replaced")))
+		blob, err = a.Marshal()
+		require.NoError(t, err)
+		a, err = ReadArchive(blob)
+		require.NoError(t, err)
+		contents, err = a.Contents(a.Files[0])
+		require.NoError(t, err)
+		assert.Equal(t, "replaced", string(contents))
+		contents, err = a.Contents(a.Files[2])
+		require.NoError(t, err)
+		assert.Equal(t, "goodbye", string(contents))
+		contents, err = a.Contents(a.Files[1])
+		require.NoError(t, err)
+		assert.Len(t, contents, 100000)
+	}
+}
+
+func TestRemoveSignature(t *testing.T) {
+	blob := newTestArchive(t, CompressMSZIP)
+	digest, err := Digest(bytes.NewReader(blob), crypto.SHA256)
+	require.NoError(t, err)
+	_, err = digest.MakeRemovePatch()
+	assert.EqualError(t, err, "CAB contains no signatures")
+	signed, err := digest.MakePatch([]byte("signature")).ApplyBytes(blob)
+	require.NoError(t, err)
+	assert.NotEqual(t, blob, signed)
+
+	digest, err = Digest(bytes.NewReader(signed), crypto.SHA256)
+	require.NoError(t, err)
+	patch, err := digest.MakeRemovePatch()
+	require.NoError(t, err)
+	unsigned, err := patch.ApplyBytes(signed)
+	require.NoError(t, err)
+	assert.Equal(t, blob, unsigned)
+}
@@ -26,6 +26,7 @@ import (
 	"io/ioutil"
 
 	"github.com/sassoftware/relic/v7/lib/binpatch"
+	"github.com/sassoftware/relic/v7/signers/sigerrors"
 )
 
 // Calculate the digest (imprint) of a CAB file for signing purposes
@@ -160,3 +161,34 @@ func (d *CabinetDigest) MakePatch(pkcs []byte) *binpatch.PatchSet {
 	p.Add(int64(d.Cabinet.Header.TotalSize), int64(d.Cabinet.SignatureHeader.Size()), padded)
 	return p
 }
+
+// Create a patchset that will remove the signature from a previously digested
+// cabinet file, along with the reserved header that locates it
+func (d *CabinetDigest) MakeRemovePatch() (*binpatch.PatchSet, error) {
+	cab := d.Cabinet
+	if cab.SignatureHeader == nil {
+		return nil, sigerrors.NotSignedError{Type: "CAB"}
+	}
+	// reserve header plus signature header
+	const removed = 24
+	hdr := cab.Header
+	hdr.TotalSize -= removed
+	hdr.OffsetFiles -= removed
+	hdr.Flags &^= FlagReservePresent
+	out := bytes.NewBuffer(make([]byte, 0, hdr.OffsetFiles))
+	_ = binary.Write(out, binary.LittleEndian, hdr)
+	// the folder headers follow the signature header
+	r := bytes.NewReader(d.Patched[binary.Size(hdr)+removed:])
+	var fh FolderHeader
+	for i := 0; i < int(hdr.NumFolders); i++ {
+		if err := binary.Read(r, binary.LittleEndian, &fh); err != nil {
+			return nil, err
+		}
+		fh.Offset -= removed
+		_ = binary.Write(out, binary.LittleEndian, fh)
+	}
+	p := binpatch.New()
+	p.Add(0, int64(cab.Header.OffsetFiles), out.Bytes())
+	p.Add(int64(cab.Header.TotalSize), int64(cab.SignatureHeader.Size()), nil)
+	return p, nil
+}
@@ -0,0 +1,325 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package cbor encodes and decodes the subset of CBOR (RFC 8949) needed for
+// COSE. Maps are encoded with deterministically sorted keys.
+package cbor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+const (
+	majorUint   = 0
+	majorNegint = 1
+	majorBytes  = 2
+	majorText   = 3
+	majorArray  = 4
+	majorMap    = 5
+	majorTag    = 6
+	majorSimple = 7
+
+	maxDepth = 32
+)
+
+// Tag is a tagged data item
+type Tag struct {
+	Number  uint64
+	Content interface{}
+}
+
+// RawMessage is an already encoded data item
+type RawMessage []byte
+
+// Marshal encodes a value. Supported types are integers, []byte, string,
+// bool, nil, []interface{}, map[interface{}]interface{},
+// map[string]interface{}, Tag and RawMessage.
+func Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encode(&buf, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeHead(buf *bytes.Buffer, major byte, n uint64) {
+	m := major << 5
+	switch {
+	case n < 24:
+		buf.WriteByte(m | byte(n))
+	case n <= math.MaxUint8:
+		buf.WriteByte(m | 24)
+		buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(m | 25)
+		var b [2]byte
+		binary.BigEndian.PutUint16(b[:], uint16(n))
+		buf.Write(b[:])
+	case n <= math.MaxUint32:
+		buf.WriteByte(m | 26)
+		var b [4]byte
+		binary.BigEndian.PutUint32(b[:], uint32(n))
+		buf.Write(b[:])
+	default:
+		buf.WriteByte(m | 27)
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], n)
+		buf.Write(b[:])
+	}
+}
+
+func writeInt(buf *bytes.Buffer, n int64) {
+	if n < 0 {
+		writeHead(buf, majorNegint, uint64(-1-n))
+	} else {
+		writeHead(buf, majorUint, uint64(n))
+	}
+}
+
+func encode(buf *bytes.Buffer, v interface{}) error {
+	switch x := v.(type) {
+	case nil:
+		buf.WriteByte(0xf6)
+	case bool:
+		if x {
+			buf.WriteByte(0xf5)
+		} else {
+			buf.WriteByte(0xf4)
+		}
+	case int:
+		writeInt(buf, int64(x))
+	case int64:
+		writeInt(buf, x)
+	case uint64:
+		writeHead(buf, majorUint, x)
+	case []byte:
+		writeHead(buf, majorBytes, uint64(len(x)))
+		buf.Write(x)
+	case string:
+		writeHead(buf, majorText, uint64(len(x)))
+		buf.WriteString(x)
+	case RawMessage:
+		buf.Write(x)
+	case Tag:
+		writeHead(buf, majorTag, x.Number)
+		return encode(buf, x.Content)
+	case []interface{}:
+		writeHead(buf, majorArray, uint64(len(x)))
+		for _, item := range x {
+			if err := encode(buf, item); err != nil {
+				return err
+			}
+		}
+	case [][]byte:
+		writeHead(buf, majorArray, uint64(len(x)))
+		for _, item := range x {
+			writeHead(buf, majorBytes, uint64(len(item)))
+			buf.Write(item)
+		}
+	case map[string]interface{}:
+		m := make(map[interface{}]interface{}, len(x))
+		for k, v := range x {
+			m[k] = v
+		}
+		return encodeMap(buf, m)
+	case map[interface{}]interface{}:
+		return encodeMap(buf, x)
+	default:
+		return fmt.Errorf("cbor: unsupported type %T", v)
+	}
+	return nil
+}
+
+// encodeMap writes a map with keys sorted by their encoding, per the core
+// deterministic encoding requirements
+func encodeMap(buf *bytes.Buffer, m map[interface{}]interface{}) error {
+	type pair struct {
+		key   []byte
+		value interface{}
+	}
+	pairs := make([]pair, 0, len(m))
+	for k, v := range m {
+		kb, err := Marshal(k)
+		if err != nil {
+			return err
+		}
+		pairs = append(pairs, pair{kb, v})
+	}
+	sort.Slice(pairs, func(i, j int) bool { return bytes.Compare(pairs[i].key, pairs[j].key) < 0 })
+	writeHead(buf, majorMap, uint64(len(pairs)))
+	for _, p := range pairs {
+		buf.Write(p.key)
+		if err := encode(buf, p.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Unmarshal decodes a single data item, which must span the whole input.
+// Integers decode as int64 (or uint64 if too large), byte strings as []byte,
+// text as string, arrays as []interface{}, maps as
+// map[interface{}]interface{} and tags as Tag.
+func Unmarshal(blob []byte) (interface{}, error) {
+	d := &decoder{buf: blob}
+	v, err := d.decode(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != len(d.buf) {
+		return nil, errors.New("cbor: trailing data")
+	}
+	return v, nil
+}
+
+// Split decodes the first data item in blob and returns it along with its
+// encoding and the remaining bytes
+func Split(blob []byte) (v interface{}, raw RawMessage, rest []byte, err error) {
+	d := &decoder{buf: blob}
+	v, err = d.decode(0)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return v, RawMessage(blob[:d.pos]), blob[d.pos:], nil
+}
+
+var errShort = errors.New("cbor: unexpected end of data")
+
+type decoder struct {
+	buf []byte
+	pos int
+}
+
+func (d *decoder) head() (major byte, info byte, n uint64, err error) {
+	if d.pos >= len(d.buf) {
+		return 0, 0, 0, errShort
+	}
+	b := d.buf[d.pos]
+	d.pos++
+	major, info = b>>5, b&0x1f
+	var size int
+	switch {
+	case info < 24:
+		return major, info, uint64(info), nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	default:
+		return 0, 0, 0, fmt.Errorf("cbor: unsupported additional info %d", info)
+	}
+	if len(d.buf)-d.pos < size {
+		return 0, 0, 0, errShort
+	}
+	for _, c := range d.buf[d.pos : d.pos+size] {
+		n = n<<8 | uint64(c)
+	}
+	d.pos += size
+	return major, info, n, nil
+}
+
+func (d *decoder) decode(depth int) (interface{}, error) {
+	if depth > maxDepth {
+		return nil, errors.New("cbor: nesting too deep")
+	}
+	major, info, n, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case majorUint:
+		if n > math.MaxInt64 {
+			return n, nil
+		}
+		return int64(n), nil
+	case majorNegint:
+		if n > math.MaxInt64 {
+			return nil, errors.New("cbor: integer overflow")
+		}
+		return -1 - int64(n), nil
+	case majorBytes, majorText:
+		if n > uint64(len(d.buf)-d.pos) {
+			return nil, errShort
+		}
+		b := d.buf[d.pos : d.pos+int(n)]
+		d.pos += int(n)
+		if major == majorText {
+			return string(b), nil
+		}
+		return append([]byte{}, b...), nil
+	case majorArray:
+		if n > uint64(len(d.buf)-d.pos) {
+			return nil, errShort
+		}
+		arr := make([]interface{}, n)
+		for i := range arr {
+			if arr[i], err = d.decode(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return arr, nil
+	case majorMap:
+		if n > uint64(len(d.buf)-d.pos) {
+			return nil, errShort
+		}
+		m := make(map[interface{}]interface{}, n)
+		for i := uint64(0); i < n; i++ {
+			k, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch k.(type) {
+			case int64, uint64, string:
+			default:
+				return nil, fmt.Errorf("cbor: unsupported map key type %T", k)
+			}
+			v, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			if _, dup := m[k]; dup {
+				return nil, fmt.Errorf("cbor: duplicate map key %v", k)
+			}
+			m[k] = v
+		}
+		return m, nil
+	case majorTag:
+		content, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return Tag{Number: n, Content: content}, nil
+	default:
+		switch info {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22, 23:
+			return nil, nil
+		}
+		return nil, fmt.Errorf("cbor: unsupported simple value %d", info)
+	}
+}
@@ -0,0 +1,76 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cbor
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// examples from RFC 8949 appendix A
+var vectors = []struct {
+	value interface{}
+	hex   string
+}{
+	{int64(0), "00"},
+	{int64(23), "17"},
+	{int64(24), "1818"},
+	{int64(1000000), "1a000f4240"},
+	{int64(1000000000000), "1b000000e8d4a51000"},
+	{uint64(18446744073709551615), "1bffffffffffffffff"},
+	{int64(-1), "20"},
+	{int64(-1000), "3903e7"},
+	{false, "f4"},
+	{true, "f5"},
+	{nil, "f6"},
+	{[]byte{1, 2, 3, 4}, "4401020304"},
+	{"IETF", "6449455446"},
+	{"ü", "62c3bc"},
+	{[]interface{}{int64(1), []interface{}{int64(2), int64(3)}}, "8201820203"},
+	{map[interface{}]interface{}{int64(1): int64(2), int64(3): int64(4)}, "a201020304"},
+	{map[interface{}]interface{}{"a": int64(1), "b": []interface{}{int64(2), int64(3)}}, "a26161016162820203"},
+	{Tag{Number: 1, Content: int64(1363896240)}, "c11a514b67b0"},
+}
+
+func TestVectors(t *testing.T) {
+	for _, v := range vectors {
+		blob, err := Marshal(v.value)
+		require.NoError(t, err)
+		assert.Equal(t, v.hex, hex.EncodeToString(blob))
+		decoded, err := Unmarshal(blob)
+		require.NoError(t, err)
+		assert.Equal(t, v.value, decoded)
+	}
+}
+
+func TestDeterministicMap(t *testing.T) {
+	// shorter keys sort first, and integers before text
+	blob, err := Marshal(map[interface{}]interface{}{"aa": int64(1), "b": int64(2), int64(-1): int64(3), int64(10): int64(4)})
+	require.NoError(t, err)
+	assert.Equal(t, "a40a04200361620262616101", hex.EncodeToString(blob))
+}
+
+func TestMalformed(t *testing.T) {
+	for _, h := range []string{"", "18", "5a00000010", "9a7fffffff", "a20102", "0000", "a2010201ff", "f97e00"} {
+		blob, _ := hex.DecodeString(h)
+		_, err := Unmarshal(blob)
+		assert.Error(t, err, h)
+	}
+}
@@ -0,0 +1,114 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package certissue
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ejbcaIssuer enrolls through the pkcs10enroll operation of the EJBCA REST
+// API. The URL is the server base, e.g. https://ejbca.example.com, and the
+// client normally authenticates with a TLS client certificate.
+type ejbcaIssuer struct {
+	client
+}
+
+type ejbcaEnrollRequest struct {
+	CSR              string `json:"certificate_request"`
+	Profile          string `json:"certificate_profile_name"`
+	EndEntityProfile string `json:"end_entity_profile_name"`
+	CA               string `json:"certificate_authority_name"`
+	Username         string `json:"username"`
+	Password         string `json:"password"`
+	IncludeChain     bool   `json:"include_chain"`
+}
+
+type ejbcaEnrollResponse struct {
+	Certificate      string   `json:"certificate"`
+	CertificateChain []string `json:"certificate_chain"`
+	ResponseFormat   string   `json:"response_format"`
+}
+
+func (i ejbcaIssuer) Issue(ctx context.Context, csr []byte) ([]*x509.Certificate, error) {
+	if i.conf.CAName == "" || i.conf.Profile == "" || i.conf.EndEntityProfile == "" {
+		return nil, errors.New("certificate issuer: ejbca requires caname, profile and endentityprofile")
+	}
+	username := i.conf.EndEntity
+	if username == "" {
+		username = i.conf.CommonName
+	}
+	body, err := json.Marshal(ejbcaEnrollRequest{
+		CSR:              string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr})),
+		Profile:          i.conf.Profile,
+		EndEntityProfile: i.conf.EndEntityProfile,
+		CA:               i.conf.CAName,
+		Username:         username,
+		Password:         i.conf.EnrollmentCode,
+		IncludeChain:     true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	base := strings.TrimSuffix(i.conf.URL, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, base+"/ejbca/ejbca-rest-api/v1/certificate/pkcs10enroll", strings.NewReader(string(body)))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	blob, err := i.do(req, http.StatusOK, http.StatusCreated)
+	if err != nil {
+		return nil, err
+	}
+	var resp ejbcaEnrollResponse
+	if err := json.Unmarshal(blob, &resp); err != nil {
+		return nil, fmt.Errorf("certificate issuer: parsing enrollment response: %w", err)
+	}
+	var certs []*x509.Certificate
+	for _, encoded := range append([]string{resp.Certificate}, resp.CertificateChain...) {
+		cert, err := parseEJBCACert(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("certificate issuer: parsing enrollment response: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+// certificates are base64 DER, or PEM if the CA is configured to return it
+func parseEJBCACert(encoded string) (*x509.Certificate, error) {
+	if strings.HasPrefix(encoded, "-----BEGIN") {
+		block, _ := pem.Decode([]byte(encoded))
+		if block == nil {
+			return nil, errors.New("invalid PEM certificate")
+		}
+		return x509.ParseCertificate(block.Bytes)
+	}
+	der, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
@@ -0,0 +1,105 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package certissue
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/sassoftware/relic/v7/lib/certloader"
+)
+
+// SigstoreFulcioURL is the public Sigstore instance of Fulcio
+const SigstoreFulcioURL = "https://fulcio.sigstore.dev"
+
+// fulcioIssuer exchanges an OIDC identity token for a short-lived certificate
+// bound to that identity, using the Fulcio v2 API. The URL is the server
+// base.
+type fulcioIssuer struct {
+	client
+}
+
+type fulcioRequest struct {
+	Credentials struct {
+		OIDCIdentityToken string `json:"oidcIdentityToken"`
+	} `json:"credentials"`
+	// PEM, which encoding/json base64-encodes as the protobuf bytes field
+	CSR []byte `json:"certificateSigningRequest"`
+}
+
+type fulcioChain struct {
+	Chain struct {
+		Certificates []string `json:"certificates"`
+	} `json:"chain"`
+}
+
+type fulcioResponse struct {
+	Embedded *fulcioChain `json:"signedCertificateEmbeddedSct"`
+	Detached *fulcioChain `json:"signedCertificateDetachedSct"`
+}
+
+func (i fulcioIssuer) Issue(ctx context.Context, csr []byte) ([]*x509.Certificate, error) {
+	idToken, err := IdentityToken(ctx, i.conf.IdentityToken, i.conf.Audience, i.client.client)
+	if err != nil {
+		return nil, fmt.Errorf("certificate issuer: %w", err)
+	}
+	var request fulcioRequest
+	request.Credentials.OIDCIdentityToken = idToken
+	request.CSR = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr})
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	base := strings.TrimSuffix(i.conf.URL, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, base+"/api/v2/signingCert", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	blob, err := i.do(req, http.StatusOK, http.StatusCreated)
+	if err != nil {
+		return nil, err
+	}
+	var resp fulcioResponse
+	if err := json.Unmarshal(blob, &resp); err != nil {
+		return nil, fmt.Errorf("certificate issuer: parsing response: %w", err)
+	}
+	chain := resp.Embedded
+	if chain == nil {
+		chain = resp.Detached
+	}
+	if chain == nil || len(chain.Chain.Certificates) == 0 {
+		return nil, errors.New("certificate issuer: response did not include a certificate")
+	}
+	var certs []*x509.Certificate
+	for _, certPEM := range chain.Chain.Certificates {
+		parsed, err := certloader.ParseX509Certificates([]byte(certPEM))
+		if err != nil {
+			return nil, fmt.Errorf("certificate issuer: parsing response: %w", err)
+		}
+		certs = append(certs, parsed...)
+	}
+	return certs, nil
+}
@@ -0,0 +1,237 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package certissue requests certificates from a CA, either short-lived
+// signing certificates at signing time or long-lived certificates when a key
+// is enrolled.
+package certissue
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sassoftware/relic/v7/config"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+)
+
+const maxResponse = 1 << 20
+
+// Issuer obtains a certificate for a certificate signing request
+type Issuer interface {
+	// Issue submits a DER-encoded CSR and returns the issued certificate
+	// followed by any chain certificates the CA provided
+	Issue(ctx context.Context, csr []byte) ([]*x509.Certificate, error)
+}
+
+type client struct {
+	conf   *config.IssuerConfig
+	client *http.Client
+}
+
+// New returns an Issuer for the given configuration
+func New(conf *config.IssuerConfig) (Issuer, error) {
+	tconf := &tls.Config{}
+	if err := x509tools.LoadCertPool(conf.CaCert, tconf); err != nil {
+		return nil, err
+	}
+	if conf.CertFile != "" {
+		cert, err := certloader.LoadX509KeyPair(conf.CertFile, conf.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tconf.Certificates = []tls.Certificate{cert.TLS()}
+	}
+	x509tools.SetKeyLogFile(tconf)
+	c := client{
+		conf: conf,
+		client: &http.Client{
+			Timeout:   time.Second * time.Duration(conf.Timeout),
+			Transport: &http.Transport{TLSClientConfig: tconf},
+		},
+	}
+	switch strings.ToLower(conf.Type) {
+	case "", "http":
+		return httpIssuer{c}, nil
+	case "est":
+		return estIssuer{c}, nil
+	case "ejbca":
+		return ejbcaIssuer{c}, nil
+	case "keyfactor":
+		return keyfactorIssuer{c}, nil
+	case "fulcio":
+		return fulcioIssuer{c}, nil
+	default:
+		return nil, fmt.Errorf("unsupported issuer type %q", conf.Type)
+	}
+}
+
+// CreateRequest makes a CSR for the signer using the configured subject
+func CreateRequest(conf *config.IssuerConfig, signer crypto.Signer, defaultName string) ([]byte, error) {
+	name := conf.CommonName
+	if name == "" {
+		name = defaultName
+	}
+	template := &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: name},
+		DNSNames: conf.DNSNames,
+	}
+	return x509.CreateCertificateRequest(rand.Reader, template, signer)
+}
+
+func (c client) post(ctx context.Context, url, contentType string, body []byte, encoding string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if encoding != "" {
+		req.Header.Set("Content-Transfer-Encoding", encoding)
+	}
+	return c.do(req)
+}
+
+// do sends the request and returns the response body. Any status other than
+// those listed in accept, or 200 if none are given, is an error.
+func (c client) do(req *http.Request, accept ...int) ([]byte, error) {
+	if c.conf.Username != "" {
+		req.SetBasicAuth(c.conf.Username, c.conf.Password)
+	} else if c.conf.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.conf.BearerToken)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("certificate issuer: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponse))
+	if err != nil {
+		return nil, fmt.Errorf("certificate issuer: %w", err)
+	}
+	if len(accept) == 0 {
+		accept = []int{http.StatusOK}
+	}
+	accepted := false
+	for _, status := range accept {
+		accepted = accepted || resp.StatusCode == status
+	}
+	if !accepted {
+		msg := strings.TrimSpace(string(body))
+		if len(msg) > 200 {
+			msg = msg[:200]
+		}
+		return nil, fmt.Errorf("certificate issuer: HTTP error from %s: %s: %s", req.URL, resp.Status, msg)
+	}
+	return body, nil
+}
+
+// httpIssuer implements a minimal CA API: the PEM-encoded CSR is POSTed to
+// the configured URL and the response is the certificate chain, leaf first,
+// in PEM, DER or PKCS#7 form.
+type httpIssuer struct {
+	client
+}
+
+func (i httpIssuer) Issue(ctx context.Context, csr []byte) ([]*x509.Certificate, error) {
+	target := i.conf.URL
+	if i.conf.Lifetime > 0 {
+		u, err := url.Parse(target)
+		if err != nil {
+			return nil, err
+		}
+		q := u.Query()
+		q.Set("lifetime", strconv.Itoa(i.conf.Lifetime))
+		u.RawQuery = q.Encode()
+		target = u.String()
+	}
+	body := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr})
+	blob, err := i.post(ctx, target, "application/x-pem-file", body, "")
+	if err != nil {
+		return nil, err
+	}
+	certs, err := certloader.ParseX509Certificates(blob)
+	if err != nil {
+		return nil, fmt.Errorf("certificate issuer: parsing response: %w", err)
+	}
+	return certs, nil
+}
+
+// estIssuer enrolls using the simpleenroll operation of Enrollment over
+// Secure Transport (RFC 7030). The URL is the EST base, e.g.
+// https://ca.example.com/.well-known/est or a labeled path below it.
+type estIssuer struct {
+	client
+}
+
+func (i estIssuer) Issue(ctx context.Context, csr []byte) ([]*x509.Certificate, error) {
+	base := strings.TrimSuffix(i.conf.URL, "/")
+	body := []byte(base64.StdEncoding.EncodeToString(csr))
+	blob, err := i.post(ctx, base+"/simpleenroll", "application/pkcs10", body, "base64")
+	if err != nil {
+		return nil, err
+	}
+	certs, err := parseESTCerts(blob)
+	if err != nil {
+		return nil, fmt.Errorf("certificate issuer: parsing enrollment response: %w", err)
+	}
+	// the enrollment response normally only has the new certificate, so
+	// fetch the CA certificates to complete the chain
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+"/cacerts", nil)
+	if err != nil {
+		return nil, err
+	}
+	blob, err = i.do(req)
+	if err != nil {
+		return nil, err
+	}
+	cacerts, err := parseESTCerts(blob)
+	if err != nil {
+		return nil, fmt.Errorf("certificate issuer: parsing CA certificates: %w", err)
+	}
+	for _, cert := range cacerts {
+		if !cert.Equal(certs[0]) {
+			certs = append(certs, cert)
+		}
+	}
+	return certs, nil
+}
+
+// EST responses are base64-encoded PKCS#7 certs-only messages
+func parseESTCerts(blob []byte) ([]*x509.Certificate, error) {
+	der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(blob)), ""))
+	if err != nil {
+		return nil, err
+	}
+	if len(der) == 0 {
+		return nil, errors.New("empty response")
+	}
+	return certloader.ParseX509Certificates(der)
+}
@@ -0,0 +1,109 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package certissue
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sassoftware/relic/v7/lib/certloader"
+)
+
+// keyfactorIssuer enrolls through the CSR enrollment operation of the
+// Keyfactor Command API. The URL is the API base, e.g.
+// https://keyfactor.example.com/KeyfactorAPI, and the client authenticates
+// with a username (DOMAIN\user) and password or a bearer token.
+type keyfactorIssuer struct {
+	client
+}
+
+type keyfactorEnrollRequest struct {
+	CSR                  string
+	CertificateAuthority string
+	Template             string
+	IncludeChain         bool
+	Timestamp            string
+	Metadata             map[string]string
+}
+
+type keyfactorEnrollResponse struct {
+	CertificateInformation struct {
+		SerialNumber       string
+		Certificates       []string
+		RequestDisposition string
+		DispositionMessage string
+	}
+}
+
+func (i keyfactorIssuer) Issue(ctx context.Context, csr []byte) ([]*x509.Certificate, error) {
+	if i.conf.CAName == "" || i.conf.Profile == "" {
+		return nil, errors.New("certificate issuer: keyfactor requires caname and profile")
+	}
+	body, err := json.Marshal(keyfactorEnrollRequest{
+		CSR:                  string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr})),
+		CertificateAuthority: i.conf.CAName,
+		Template:             i.conf.Profile,
+		IncludeChain:         true,
+		Timestamp:            time.Now().UTC().Format(time.RFC3339),
+		Metadata:             map[string]string{},
+	})
+	if err != nil {
+		return nil, err
+	}
+	base := strings.TrimSuffix(i.conf.URL, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, base+"/Enrollment/CSR", strings.NewReader(string(body)))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("X-Keyfactor-Requested-With", "APIClient")
+	req.Header.Set("X-Keyfactor-API-Version", "1")
+	req.Header.Set("X-CertificateFormat", "PEM")
+	blob, err := i.do(req, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	var resp keyfactorEnrollResponse
+	if err := json.Unmarshal(blob, &resp); err != nil {
+		return nil, fmt.Errorf("certificate issuer: parsing enrollment response: %w", err)
+	}
+	info := resp.CertificateInformation
+	if !strings.EqualFold(info.RequestDisposition, "issued") {
+		// e.g. the template requires manager approval
+		return nil, fmt.Errorf("certificate issuer: request was not issued: %s %s", info.RequestDisposition, info.DispositionMessage)
+	}
+	var certs []*x509.Certificate
+	for _, certPEM := range info.Certificates {
+		parsed, err := certloader.ParseX509Certificates([]byte(certPEM))
+		if err != nil {
+			return nil, fmt.Errorf("certificate issuer: parsing enrollment response: %w", err)
+		}
+		certs = append(certs, parsed...)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("certificate issuer: enrollment response did not include a certificate")
+	}
+	return certs, nil
+}
@@ -0,0 +1,111 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package certissue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// DefaultAudience is the audience Sigstore services expect in identity tokens
+const DefaultAudience = "sigstore"
+
+// IdentityToken gets an OIDC identity token for the CI job relic is running
+// in. The source is one of:
+//
+//	""            detect GitHub Actions, otherwise use $SIGSTORE_ID_TOKEN
+//	"github"      request a token from GitHub Actions (needs id-token: write)
+//	"gitlab"      use $SIGSTORE_ID_TOKEN, as set by an id_tokens job section
+//	"env:NAME"    use the named environment variable
+//	anything else is the path to a file holding the token
+func IdentityToken(ctx context.Context, source, audience string, client *http.Client) (string, error) {
+	if audience == "" {
+		audience = DefaultAudience
+	}
+	switch {
+	case source == "":
+		if os.Getenv("ACTIONS_ID_TOKEN_REQUEST_URL") != "" {
+			return githubToken(ctx, audience, client)
+		}
+		return envToken("SIGSTORE_ID_TOKEN")
+	case source == "github":
+		return githubToken(ctx, audience, client)
+	case source == "gitlab":
+		return envToken("SIGSTORE_ID_TOKEN")
+	case strings.HasPrefix(source, "env:"):
+		return envToken(source[4:])
+	}
+	blob, err := os.ReadFile(source)
+	if err != nil {
+		return "", fmt.Errorf("reading identity token: %w", err)
+	}
+	return strings.TrimSpace(string(blob)), nil
+}
+
+func envToken(name string) (string, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return "", fmt.Errorf("no identity token found: $%s is not set", name)
+	}
+	return value, nil
+}
+
+// request a token for the current workflow run from GitHub Actions
+func githubToken(ctx context.Context, audience string, client *http.Client) (string, error) {
+	reqURL := os.Getenv("ACTIONS_ID_TOKEN_REQUEST_URL")
+	reqToken := os.Getenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN")
+	if reqURL == "" || reqToken == "" {
+		return "", errors.New("no identity token found: the workflow needs the id-token: write permission")
+	}
+	u, err := url.Parse(reqURL)
+	if err != nil {
+		return "", fmt.Errorf("ACTIONS_ID_TOKEN_REQUEST_URL: %w", err)
+	}
+	q := u.Query()
+	q.Set("audience", audience)
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "bearer "+reqToken)
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("requesting identity token: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponse))
+	if err != nil {
+		return "", fmt.Errorf("requesting identity token: %w", err)
+	} else if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("requesting identity token: %s", resp.Status)
+	}
+	var result struct {
+		Value string `json:"value"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil || result.Value == "" {
+		return "", errors.New("requesting identity token: invalid response")
+	}
+	return result.Value, nil
+}
@@ -34,8 +34,8 @@ import (
 	"github.com/sassoftware/relic/v7/lib/passprompt"
 )
 
-// Parse and decrypt a private key. It can be a RSA or ECDA key in PKCS#1 or
-// PKCS#8 format and DER or PEM encoding, or it can be a PGP private key. If
+// Parse and decrypt a private key. It can be a RSA, ECDSA or Ed25519 key in
+// PKCS#1 or PKCS#8 format and DER or PEM encoding, or it can be a PGP private key. If
 // the private key is encrypted then the given prompter will be invoked to ask
 // for the passphrase, if provided.
 func ParseAnyPrivateKey(blob []byte, prompt passprompt.PasswordGetter) (crypto.PrivateKey, error) {
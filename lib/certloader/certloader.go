@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
 	"crypto/tls"
 	"crypto/x509"
@@ -33,6 +34,7 @@ import (
 
 	"github.com/sassoftware/relic/v7/lib/pkcs7"
 	"github.com/sassoftware/relic/v7/lib/pkcs9"
+	"github.com/sassoftware/relic/v7/lib/sshca"
 	"github.com/sassoftware/relic/v7/lib/x509tools"
 )
 
@@ -47,6 +49,17 @@ type Certificate struct {
 	PrivateKey   crypto.PrivateKey
 	Timestamper  pkcs9.Timestamper
 	KeyName      string
+	// DER-encoded OCSP responses for the chain, to be embedded in signatures
+	OCSPResponses [][]byte
+	// Cross-certificate linking the chain's root to another root, to be
+	// embedded in Authenticode signatures
+	CrossCertificate *x509.Certificate
+	// Proof-of-rotation lineage ending with the leaf, to be embedded in APK
+	// v3 signatures
+	ApkLineage []byte
+	// Limits on the SSH certificates the key may issue. If nil, it can't act
+	// as an SSH CA.
+	SSHCAPolicy *sshca.Policy
 }
 
 // Return the X509 certificates in the chain up to, but not including, the root CA certificate
@@ -69,6 +82,43 @@ func (s *Certificate) Chain() []*x509.Certificate {
 	return chain
 }
 
+// Return the certificates to embed in an Authenticode signature, which is the
+// chain plus the cross-certificate if there is one
+func (s *Certificate) AuthenticodeChain() []*x509.Certificate {
+	chain := s.Chain()
+	if s.CrossCertificate != nil {
+		chain = append(chain, s.CrossCertificate)
+	}
+	return chain
+}
+
+// SetCrossCertificate parses a cross-certificate and checks that it certifies
+// one of the CAs in the chain, either by having the same subject and key as
+// the CA or by having issued it
+func (s *Certificate) SetCrossCertificate(blob []byte) error {
+	certs, err := ParseX509Certificates(blob)
+	if err != nil {
+		return fmt.Errorf("cross-certificate: %w", err)
+	} else if len(certs) != 1 {
+		return errors.New("cross-certificate file must contain exactly one certificate")
+	}
+	cross := certs[0]
+	for _, cert := range s.Certificates {
+		if cert == s.Leaf {
+			continue
+		}
+		if bytes.Equal(cert.RawSubject, cross.RawSubject) && x509tools.SameKey(cert.PublicKey, cross.PublicKey) {
+			s.CrossCertificate = cross
+			return nil
+		}
+		if bytes.Equal(cert.RawIssuer, cross.RawSubject) && cert.CheckSignatureFrom(cross) == nil {
+			s.CrossCertificate = cross
+			return nil
+		}
+	}
+	return fmt.Errorf("cross-certificate `%s` does not certify any CA in the certificate chain", x509tools.FormatSubject(cross))
+}
+
 // Return the certificate that issued the leaf certificate
 func (s *Certificate) Issuer() *x509.Certificate {
 	if s.Leaf == nil {
@@ -82,6 +132,15 @@ func (s *Certificate) Issuer() *x509.Certificate {
 	return nil
 }
 
+// AttachRevocationInfo embeds any revocation data that was gathered for the
+// certificate chain into the first SignerInfo of psd
+func (s *Certificate) AttachRevocationInfo(psd *pkcs7.ContentInfoSignedData) error {
+	if len(psd.Content.SignerInfos) == 0 {
+		return nil
+	}
+	return pkcs9.AddRevocationValues(&psd.Content.SignerInfos[0], s.OCSPResponses, nil)
+}
+
 // Return the private key in the form of a crypto.Signer
 func (s *Certificate) Signer() crypto.Signer {
 	if s.PrivateKey == nil {
@@ -108,7 +167,7 @@ func parsePrivateKey(der []byte) (crypto.PrivateKey, error) {
 	}
 	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
 		switch key := key.(type) {
-		case *rsa.PrivateKey, *ecdsa.PrivateKey:
+		case *rsa.PrivateKey, *ecdsa.PrivateKey, ed25519.PrivateKey:
 			return key, nil
 		default:
 			return nil, errors.New("tls: found unknown private key type in PKCS#8 wrapping")
@@ -191,6 +250,10 @@ func LoadX509KeyPair(certFile, keyFile string) (*Certificate, error) {
 	if err != nil {
 		return nil, err
 	}
+	return parseKeyPair(certblob, keyblob)
+}
+
+func parseKeyPair(certblob, keyblob []byte) (*Certificate, error) {
 	key, err := ParseAnyPrivateKey(keyblob, nil)
 	if err != nil {
 		return nil, err
@@ -225,7 +288,16 @@ func LoadTokenCertificates(key crypto.PrivateKey, x509cert, pgpcert string, x509
 		if err != nil {
 			return nil, err
 		}
-		if !x509tools.SameKey(key, cert.Leaf.PublicKey) {
+		// the leaf isn't necessarily first in the file, so pick the one that
+		// matches the key
+		cert.Leaf = nil
+		for _, candidate := range cert.Certificates {
+			if x509tools.SameKey(key, candidate.PublicKey) {
+				cert.Leaf = candidate
+				break
+			}
+		}
+		if cert.Leaf == nil {
 			return nil, errors.New("certificate does not match key in token")
 		}
 		cert.PrivateKey = key
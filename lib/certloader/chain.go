@@ -0,0 +1,130 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package certloader
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"time"
+)
+
+// refuse to explore absurdly long or looping paths
+const maxChainDepth = 10
+
+// OrderChain replaces Certificates with the best path from the leaf to a root,
+// dropping any certificates that are not part of that path. When the bundle
+// contains cross-signed CAs there may be several candidate paths. If roots is
+// not empty then only a path that leads to one of those roots is acceptable;
+// otherwise a path ending in a self-signed certificate is preferred. Paths
+// without expired certificates are preferred over those with. Any certificates
+// on the chosen path that are not currently valid are returned so that the
+// caller can warn about them.
+func (s *Certificate) OrderChain(roots []*x509.Certificate) (expired []*x509.Certificate, err error) {
+	if s.Leaf == nil {
+		return nil, nil
+	}
+	now := time.Now()
+	var best []*x509.Certificate
+	bestScore := -1
+	for _, path := range buildPaths([]*x509.Certificate{s.Leaf}, s.Certificates) {
+		path, trusted := trimToRoot(path, roots)
+		score := 0
+		if trusted {
+			score += 4
+		}
+		if isSelfSigned(path[len(path)-1]) {
+			score += 2
+		}
+		if len(expiredCerts(path, now)) == 0 {
+			score++
+		}
+		if score > bestScore || (score == bestScore && len(path) < len(best)) {
+			best = path
+			bestScore = score
+		}
+	}
+	if len(roots) != 0 && bestScore < 4 {
+		return nil, errors.New("certificate chain does not lead to any of the configured roots")
+	}
+	s.Certificates = best
+	return expiredCerts(best, now), nil
+}
+
+// Recursively find every path from the last certificate in path upwards using
+// issuers from pool
+func buildPaths(path, pool []*x509.Certificate) [][]*x509.Certificate {
+	cert := path[len(path)-1]
+	if isSelfSigned(cert) || len(path) >= maxChainDepth {
+		return [][]*x509.Certificate{path}
+	}
+	var paths [][]*x509.Certificate
+	for _, candidate := range pool {
+		if !bytes.Equal(candidate.RawSubject, cert.RawIssuer) || inPath(path, candidate) {
+			continue
+		}
+		if cert.CheckSignatureFrom(candidate) != nil {
+			continue
+		}
+		next := append(path[:len(path):len(path)], candidate)
+		paths = append(paths, buildPaths(next, pool)...)
+	}
+	if len(paths) == 0 {
+		// incomplete chain, but it's the best this bundle can do
+		return [][]*x509.Certificate{path}
+	}
+	return paths
+}
+
+// Truncate path at the first certificate that either is one of roots or was
+// issued by one of them, and report whether such a certificate was found
+func trimToRoot(path, roots []*x509.Certificate) ([]*x509.Certificate, bool) {
+	for i, cert := range path {
+		for _, root := range roots {
+			if bytes.Equal(cert.Raw, root.Raw) {
+				return path[:i+1], true
+			} else if bytes.Equal(cert.RawIssuer, root.RawSubject) && cert.CheckSignatureFrom(root) == nil {
+				return path[:i+1], true
+			}
+		}
+	}
+	return path, false
+}
+
+// Return any certificates in path after the leaf that are not currently valid
+func expiredCerts(path []*x509.Certificate, now time.Time) []*x509.Certificate {
+	var expired []*x509.Certificate
+	for _, cert := range path[1:] {
+		if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+			expired = append(expired, cert)
+		}
+	}
+	return expired
+}
+
+func inPath(path []*x509.Certificate, cert *x509.Certificate) bool {
+	for _, c := range path {
+		if bytes.Equal(c.Raw, cert.Raw) {
+			return true
+		}
+	}
+	return false
+}
+
+func isSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject)
+}
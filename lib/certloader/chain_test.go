@@ -0,0 +1,135 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package certloader_test
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sassoftware/relic/v7/internal/testcert"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+)
+
+type testPKI struct {
+	rootA, rootB    *x509.Certificate
+	interA, interB  *x509.Certificate // same CA, issued by rootA and rootB
+	interExpired    *x509.Certificate // same CA, issued by rootA but expired
+	leaf, unrelated *x509.Certificate
+}
+
+func newTestPKI(t *testing.T) testPKI {
+	var p testPKI
+	rootKeyA := testcert.ECDSAKey(t)
+	rootKeyB := testcert.ECDSAKey(t)
+	interKey := testcert.ECDSAKey(t)
+	p.rootA = testcert.CA(t, "Root A", rootKeyA)
+	p.rootB = testcert.CA(t, "Root B", rootKeyB)
+	interTmpl := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Intermediate"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	p.interA = testcert.Issue(t, interTmpl, interKey, p.rootA, rootKeyA)
+	p.interB = testcert.Issue(t, interTmpl, interKey, p.rootB, rootKeyB)
+	expiredTmpl := *interTmpl
+	expiredTmpl.NotBefore = time.Now().Add(-48 * time.Hour)
+	expiredTmpl.NotAfter = time.Now().Add(-24 * time.Hour)
+	p.interExpired = testcert.Issue(t, &expiredTmpl, interKey, p.rootA, rootKeyA)
+	p.leaf = testcert.Issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "leaf"}}, testcert.ECDSAKey(t), p.interA, interKey)
+	p.unrelated = testcert.SelfSigned(t, "unrelated", testcert.ECDSAKey(t))
+	return p
+}
+
+func TestOrderChain(t *testing.T) {
+	p := newTestPKI(t)
+	cases := []struct {
+		name    string
+		bundle  []*x509.Certificate
+		roots   []*x509.Certificate
+		expect  []*x509.Certificate
+		expired []*x509.Certificate
+		err     string
+	}{
+		{
+			name:   "in order",
+			bundle: []*x509.Certificate{p.leaf, p.interA, p.rootA},
+			expect: []*x509.Certificate{p.leaf, p.interA, p.rootA},
+		},
+		{
+			name:   "out of order",
+			bundle: []*x509.Certificate{p.rootA, p.unrelated, p.interA, p.leaf},
+			expect: []*x509.Certificate{p.leaf, p.interA, p.rootA},
+		},
+		{
+			name:   "missing intermediate",
+			bundle: []*x509.Certificate{p.rootA, p.leaf},
+			expect: []*x509.Certificate{p.leaf},
+		},
+		{
+			name:   "missing root",
+			bundle: []*x509.Certificate{p.interA, p.leaf},
+			expect: []*x509.Certificate{p.leaf, p.interA},
+		},
+		{
+			name:   "prefer complete path",
+			bundle: []*x509.Certificate{p.leaf, p.interB, p.interA, p.rootA},
+			expect: []*x509.Certificate{p.leaf, p.interA, p.rootA},
+		},
+		{
+			name:   "cross-signed to configured root",
+			bundle: []*x509.Certificate{p.leaf, p.interA, p.rootA, p.interB},
+			roots:  []*x509.Certificate{p.rootB},
+			expect: []*x509.Certificate{p.leaf, p.interB},
+		},
+		{
+			name:   "configured root not reachable",
+			bundle: []*x509.Certificate{p.leaf, p.interA, p.rootA},
+			roots:  []*x509.Certificate{p.rootB},
+			err:    "certificate chain does not lead to any of the configured roots",
+		},
+		{
+			name:   "prefer unexpired",
+			bundle: []*x509.Certificate{p.leaf, p.interExpired, p.interA, p.rootA},
+			expect: []*x509.Certificate{p.leaf, p.interA, p.rootA},
+		},
+		{
+			name:    "only expired",
+			bundle:  []*x509.Certificate{p.leaf, p.interExpired, p.rootA},
+			expect:  []*x509.Certificate{p.leaf, p.interExpired, p.rootA},
+			expired: []*x509.Certificate{p.interExpired},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cert := &certloader.Certificate{Leaf: p.leaf, Certificates: c.bundle}
+			expired, err := cert.OrderChain(c.roots)
+			if c.err != "" {
+				assert.EqualError(t, err, c.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, c.expect, cert.Certificates)
+			assert.Equal(t, c.expired, expired)
+		})
+	}
+}
@@ -0,0 +1,184 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package certloader
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+)
+
+// Watcher holds a certificate and private key loaded from files and reloads
+// them when the files change, so that rotated certificates are picked up by a
+// long-running process. The files are polled rather than watched via inotify
+// so that replacements by rename, symlink swaps and network filesystems all
+// behave the same.
+type Watcher struct {
+	CertFile string
+	KeyFile  string
+	// Called after a successful reload
+	OnReload func(*Certificate)
+	// Called when a changed file could not be loaded. The previous
+	// certificate remains in use.
+	OnError func(error)
+
+	mu      sync.RWMutex
+	cert    *Certificate
+	tlsCert *tls.Certificate
+	digest  [sha256.Size]byte
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// WatchX509KeyPair loads a certificate and key. Call Start to begin checking
+// the files for changes.
+func WatchX509KeyPair(certFile, keyFile string) (*Watcher, error) {
+	w := &Watcher{CertFile: certFile, KeyFile: keyFile}
+	if _, err := w.Reload(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Start checking the files for changes at the given interval
+func (w *Watcher) Start(interval time.Duration) {
+	if w.stop != nil || interval <= 0 {
+		return
+	}
+	w.stop = make(chan struct{})
+	w.done = make(chan struct{})
+	go w.loop(interval)
+}
+
+// Certificate returns the most recently loaded certificate
+func (w *Watcher) Certificate() *Certificate {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.cert
+}
+
+// GetCertificate can be used as the GetCertificate callback of a tls.Config
+func (w *Watcher) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.tlsCert, nil
+}
+
+// Reload reads the files and, if their contents changed and the new
+// certificate is valid, replaces the current certificate. Returns true if the
+// certificate was replaced.
+func (w *Watcher) Reload() (bool, error) {
+	certblob, err := os.ReadFile(w.CertFile)
+	if err != nil {
+		return false, err
+	}
+	keyblob, err := os.ReadFile(w.KeyFile)
+	if err != nil {
+		return false, err
+	}
+	d := sha256.New()
+	d.Write(certblob)
+	d.Write(keyblob)
+	var digest [sha256.Size]byte
+	copy(digest[:], d.Sum(nil))
+	w.mu.RLock()
+	unchanged := w.cert != nil && bytes.Equal(digest[:], w.digest[:])
+	w.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+	cert, err := parseKeyPair(certblob, keyblob)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", w.CertFile, err)
+	}
+	if err := validateReloaded(cert, time.Now()); err != nil {
+		return false, fmt.Errorf("%s: %w", w.CertFile, err)
+	}
+	tlsCert := cert.TLS()
+	w.mu.Lock()
+	w.cert = cert
+	w.tlsCert = &tlsCert
+	w.digest = digest
+	w.mu.Unlock()
+	return true, nil
+}
+
+// Close stops watching for changes
+func (w *Watcher) Close() {
+	if w.stop == nil {
+		return
+	}
+	close(w.stop)
+	<-w.done
+	w.stop = nil
+}
+
+func (w *Watcher) loop(interval time.Duration) {
+	defer close(w.done)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-t.C:
+		}
+		changed, err := w.Reload()
+		if err != nil {
+			if w.OnError != nil {
+				w.OnError(err)
+			}
+		} else if changed && w.OnReload != nil {
+			w.OnReload(w.Certificate())
+		}
+	}
+}
+
+// Check that a freshly loaded certificate can be put into service. Files are
+// often replaced one at a time, so a key that does not match is an expected
+// transient state and the next poll will pick up the completed pair.
+func validateReloaded(cert *Certificate, now time.Time) error {
+	if cert.Leaf == nil {
+		return ErrNoCerts
+	}
+	if now.Before(cert.Leaf.NotBefore) {
+		return fmt.Errorf("certificate `%s` is not valid until %s", x509tools.FormatSubject(cert.Leaf), cert.Leaf.NotBefore)
+	}
+	if now.After(cert.Leaf.NotAfter) {
+		return fmt.Errorf("certificate `%s` expired at %s", x509tools.FormatSubject(cert.Leaf), cert.Leaf.NotAfter)
+	}
+	if len(cert.Certificates) > 1 {
+		for _, other := range cert.Certificates[1:] {
+			if bytes.Equal(cert.Leaf.RawIssuer, other.RawSubject) {
+				if err := cert.Leaf.CheckSignatureFrom(other); err != nil {
+					return fmt.Errorf("certificate `%s` was not issued by the next certificate in the chain: %w", x509tools.FormatSubject(cert.Leaf), err)
+				}
+				return nil
+			}
+		}
+		return errors.New("certificate chain does not include the leaf's issuer")
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cose_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sassoftware/relic/v7/internal/testcert"
+	"github.com/sassoftware/relic/v7/lib/cbor"
+	"github.com/sassoftware/relic/v7/lib/cose"
+	"github.com/sassoftware/relic/v7/lib/jose"
+)
+
+func TestSignVerify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	payload := []byte{0xa1, 0x01, 0x02}
+	cases := []struct {
+		key crypto.Signer
+		pss bool
+		alg jose.Algorithm
+	}{
+		{rsaKey, true, jose.PS256},
+		{ecKey, false, jose.ES256},
+		{edKey, false, jose.EdDSA},
+	}
+	for _, c := range cases {
+		t.Run(string(c.alg), func(t *testing.T) {
+			cert := testcert.SelfSigned(t, "manifest signer", c.key)
+			m, err := cose.Sign(payload, c.key, cose.SignOptions{
+				Hash:         crypto.SHA256,
+				PSS:          c.pss,
+				ContentType:  "application/cbor",
+				KeyID:        []byte("k1"),
+				Certificates: []*x509.Certificate{cert},
+			})
+			require.NoError(t, err)
+			blob, err := m.Marshal(false)
+			require.NoError(t, err)
+			parsed, err := cose.Parse(blob)
+			require.NoError(t, err)
+			assert.Equal(t, c.alg, parsed.Algorithm())
+			assert.Equal(t, payload, parsed.Payload)
+			assert.Equal(t, "application/cbor", parsed.Protected[cose.HeaderCty])
+			assert.Equal(t, []byte("k1"), parsed.Unprotected[cose.HeaderKid])
+			signer, err := parsed.Verify(nil)
+			require.NoError(t, err)
+			assert.Equal(t, cert, signer)
+
+			parsed.Payload = []byte{0xa0}
+			_, err = parsed.Verify(nil)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestDetached(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+	cert := testcert.SelfSigned(t, "manifest signer", key)
+	payload := []byte("firmware manifest")
+	aad := []byte("context")
+	m, err := cose.Sign(payload, key, cose.SignOptions{ExternalAAD: aad})
+	require.NoError(t, err)
+	blob, err := m.Marshal(true)
+	require.NoError(t, err)
+	// strip the tag to check that untagged messages are accepted too
+	v, err := cbor.Unmarshal(blob)
+	require.NoError(t, err)
+	untagged, err := cbor.Marshal(v.(cbor.Tag).Content)
+	require.NoError(t, err)
+
+	parsed, err := cose.Parse(untagged)
+	require.NoError(t, err)
+	assert.Equal(t, jose.ES384, parsed.Algorithm())
+	assert.Nil(t, parsed.Payload)
+	_, err = parsed.Verify([]*x509.Certificate{cert})
+	assert.Error(t, err)
+	parsed.Payload = payload
+	_, err = parsed.Verify([]*x509.Certificate{cert})
+	assert.Error(t, err, "external AAD is missing")
+	parsed.ExternalAAD = aad
+	_, err = parsed.Verify(nil)
+	assert.Error(t, err, "key is not trusted")
+	signer, err := parsed.Verify([]*x509.Certificate{cert})
+	require.NoError(t, err)
+	assert.Equal(t, cert, signer)
+}
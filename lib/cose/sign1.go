@@ -0,0 +1,293 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package cose implements COSE_Sign1 messages (RFC 9052) with X.509
+// certificate chains in the x5chain header (RFC 9360).
+package cose
+
+import (
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	"github.com/sassoftware/relic/v7/lib/cbor"
+	"github.com/sassoftware/relic/v7/lib/jose"
+	"github.com/sassoftware/relic/v7/signers/sigerrors"
+)
+
+// Header labels
+const (
+	HeaderAlg     = int64(1)
+	HeaderCrit    = int64(2)
+	HeaderCty     = int64(3)
+	HeaderKid     = int64(4)
+	HeaderX5Chain = int64(33)
+
+	TagSign1 = 18
+)
+
+// COSE algorithm identifiers and the equivalent JOSE algorithms, which have
+// the same semantics
+var algorithms = map[int64]jose.Algorithm{
+	-7:   jose.ES256,
+	-35:  jose.ES384,
+	-36:  jose.ES512,
+	-8:   jose.EdDSA,
+	-37:  jose.PS256,
+	-38:  jose.PS384,
+	-39:  jose.PS512,
+	-257: jose.RS256,
+	-258: jose.RS384,
+	-259: jose.RS512,
+}
+
+// AlgorithmFor picks the algorithm identifier for a key, with the same rules
+// as jose.AlgorithmFor
+func AlgorithmFor(pub crypto.PublicKey, hash crypto.Hash, pss bool) (int64, jose.Algorithm, error) {
+	alg, err := jose.AlgorithmFor(pub, hash, pss)
+	if err != nil {
+		return 0, "", err
+	}
+	for id, a := range algorithms {
+		if a == alg {
+			return id, alg, nil
+		}
+	}
+	return 0, "", fmt.Errorf("no COSE algorithm for %s", alg)
+}
+
+// SignOptions control the headers of a new message
+type SignOptions struct {
+	// Hash for RSA keys, ignored for other key types
+	Hash crypto.Hash
+	// Use PSS padding for RSA keys
+	PSS bool
+	// Content type of the payload, either a media type string or a CoAP
+	// content format number
+	ContentType interface{}
+	KeyID       []byte
+	// Certificate chain to put in the protected x5chain header, starting
+	// with the leaf
+	Certificates []*x509.Certificate
+	// Extra protected headers
+	Protected map[interface{}]interface{}
+	// Additional data that is signed but not part of the message
+	ExternalAAD []byte
+}
+
+// Sign1 is a COSE_Sign1 message
+type Sign1 struct {
+	Protected   map[interface{}]interface{}
+	Unprotected map[interface{}]interface{}
+	// Payload is nil if it was detached and not supplied
+	Payload   []byte
+	Signature []byte
+	// Additional data that is signed but not part of the message. Must be
+	// set before calling Verify if it was used when signing.
+	ExternalAAD []byte
+
+	protected []byte
+	alg       jose.Algorithm
+}
+
+// Sign a payload
+func Sign(payload []byte, signer crypto.Signer, opts SignOptions) (*Sign1, error) {
+	id, alg, err := AlgorithmFor(signer.Public(), opts.Hash, opts.PSS)
+	if err != nil {
+		return nil, err
+	}
+	m := &Sign1{
+		Protected:   make(map[interface{}]interface{}),
+		Unprotected: make(map[interface{}]interface{}),
+		Payload:     payload,
+		ExternalAAD: opts.ExternalAAD,
+		alg:         alg,
+	}
+	for k, v := range opts.Protected {
+		m.Protected[k] = v
+	}
+	m.Protected[HeaderAlg] = id
+	if opts.ContentType != nil {
+		m.Protected[HeaderCty] = opts.ContentType
+	}
+	if len(opts.Certificates) == 1 {
+		m.Protected[HeaderX5Chain] = opts.Certificates[0].Raw
+	} else if len(opts.Certificates) > 1 {
+		chain := make([]interface{}, len(opts.Certificates))
+		for i, cert := range opts.Certificates {
+			chain[i] = cert.Raw
+		}
+		m.Protected[HeaderX5Chain] = chain
+	}
+	if opts.KeyID != nil {
+		m.Unprotected[HeaderKid] = opts.KeyID
+	}
+	m.protected, err = cbor.Marshal(m.Protected)
+	if err != nil {
+		return nil, err
+	}
+	tbs, err := m.sigStructure()
+	if err != nil {
+		return nil, err
+	}
+	m.Signature, err = alg.Sign(signer, tbs)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// the Sig_structure that is signed
+func (m *Sign1) sigStructure() ([]byte, error) {
+	aad := m.ExternalAAD
+	if aad == nil {
+		aad = []byte{}
+	}
+	return cbor.Marshal([]interface{}{"Signature1", m.protected, aad, m.Payload})
+}
+
+// Marshal the tagged message. If detached is true then the payload is
+// replaced with nil.
+func (m *Sign1) Marshal(detached bool) ([]byte, error) {
+	var payload interface{}
+	if !detached {
+		payload = m.Payload
+	}
+	return cbor.Marshal(cbor.Tag{Number: TagSign1, Content: []interface{}{
+		m.protected, m.Unprotected, payload, m.Signature,
+	}})
+}
+
+// Parse a COSE_Sign1 message, tagged or untagged
+func Parse(blob []byte) (*Sign1, error) {
+	if len(blob) == 0 {
+		return nil, sigerrors.NotSignedError{Type: "COSE"}
+	}
+	v, err := cbor.Unmarshal(blob)
+	if err != nil {
+		return nil, fmt.Errorf("parsing COSE_Sign1: %w", err)
+	}
+	if tag, ok := v.(cbor.Tag); ok {
+		if tag.Number != TagSign1 {
+			return nil, fmt.Errorf("parsing COSE_Sign1: unexpected tag %d", tag.Number)
+		}
+		v = tag.Content
+	}
+	msg, ok := v.([]interface{})
+	if !ok || len(msg) != 4 {
+		return nil, errors.New("parsing COSE_Sign1: not a COSE_Sign1 message")
+	}
+	m := new(Sign1)
+	var ok1, ok2, ok3 bool
+	m.protected, ok1 = msg[0].([]byte)
+	m.Unprotected, ok2 = msg[1].(map[interface{}]interface{})
+	m.Signature, ok3 = msg[3].([]byte)
+	if !ok1 || !ok2 || !ok3 {
+		return nil, errors.New("parsing COSE_Sign1: malformed message")
+	}
+	switch p := msg[2].(type) {
+	case nil:
+	case []byte:
+		m.Payload = p
+	default:
+		return nil, errors.New("parsing COSE_Sign1: malformed payload")
+	}
+	m.Protected = make(map[interface{}]interface{})
+	if len(m.protected) != 0 {
+		pv, err := cbor.Unmarshal(m.protected)
+		if err != nil {
+			return nil, fmt.Errorf("parsing COSE protected header: %w", err)
+		}
+		if m.Protected, ok = pv.(map[interface{}]interface{}); !ok {
+			return nil, errors.New("parsing COSE protected header: not a map")
+		}
+	}
+	if _, ok := m.Protected[HeaderCrit]; ok {
+		return nil, errors.New("parsing COSE protected header: critical headers are not supported")
+	}
+	id, _ := m.Protected[HeaderAlg].(int64)
+	if m.alg, ok = algorithms[id]; !ok {
+		return nil, fmt.Errorf("unsupported COSE algorithm %d", id)
+	}
+	return m, nil
+}
+
+// Algorithm returns the signature algorithm
+func (m *Sign1) Algorithm() jose.Algorithm {
+	return m.alg
+}
+
+// Certificates parses the x5chain header, which may be protected or not
+func (m *Sign1) Certificates() ([]*x509.Certificate, error) {
+	x5 := m.Protected[HeaderX5Chain]
+	if x5 == nil {
+		x5 = m.Unprotected[HeaderX5Chain]
+	}
+	var chain []interface{}
+	switch v := x5.(type) {
+	case nil:
+	case []byte:
+		chain = []interface{}{v}
+	case []interface{}:
+		chain = v
+	default:
+		return nil, errors.New("parsing COSE x5chain: malformed header")
+	}
+	var certs []*x509.Certificate
+	for _, item := range chain {
+		der, ok := item.([]byte)
+		if !ok {
+			return nil, errors.New("parsing COSE x5chain: malformed certificate")
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("parsing COSE x5chain: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+// Verify the signature. If there is a x5chain then the first certificate
+// must have signed it, otherwise one of the trusted certificates must have.
+// The certificate chain is not checked. Returns the certificate that made
+// the signature.
+func (m *Sign1) Verify(trusted []*x509.Certificate) (*x509.Certificate, error) {
+	if m.Payload == nil {
+		return nil, errors.New("COSE payload is detached and was not provided")
+	}
+	certs, err := m.Certificates()
+	if err != nil {
+		return nil, err
+	}
+	tbs, err := m.sigStructure()
+	if err != nil {
+		return nil, err
+	}
+	if len(certs) != 0 {
+		if err := m.alg.Verify(certs[0].PublicKey, tbs, m.Signature); err != nil {
+			return nil, fmt.Errorf("COSE verification failed: %w", err)
+		}
+		return certs[0], nil
+	}
+	for _, cert := range trusted {
+		if m.alg.Verify(cert.PublicKey, tbs, m.Signature) == nil {
+			return cert, nil
+		}
+	}
+	return nil, errors.New("COSE message has no x5chain and was not signed by a trusted key")
+}
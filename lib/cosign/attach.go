@@ -0,0 +1,171 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cosign
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"time"
+
+	"github.com/sassoftware/relic/v7/lib/oci"
+	"github.com/sassoftware/relic/v7/lib/sigstore"
+)
+
+// SignatureTag returns the tag that holds tag scheme signatures for an image
+// digest, e.g. sha256-abcd....sig
+func SignatureTag(digest string) (string, error) {
+	tag, err := oci.DigestTag(digest)
+	if err != nil {
+		return "", err
+	}
+	return tag + ".sig", nil
+}
+
+// AttachSignature adds a signed simple signing payload to the image's .sig
+// tag, keeping any signatures already there. The bundle must hold a message
+// signature made over the payload.
+func AttachSignature(ctx context.Context, client *oci.Client, image oci.Reference, payload []byte, bundle *sigstore.Bundle) error {
+	if bundle.MessageSignature == nil {
+		return errors.New("bundle does not hold a message signature")
+	}
+	layer := oci.NewDescriptor(SimpleSigningMediaType, payload)
+	layer.Annotations = map[string]string{
+		AnnotationSignature: base64.StdEncoding.EncodeToString(bundle.MessageSignature.Signature),
+	}
+	certs, err := bundle.Certificates()
+	if err != nil {
+		return err
+	}
+	layer.Annotations[AnnotationCertificate] = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certs[0].Raw}))
+	if len(certs) > 1 {
+		var chain bytes.Buffer
+		for _, cert := range certs[1:] {
+			_ = pem.Encode(&chain, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+		}
+		layer.Annotations[AnnotationChain] = chain.String()
+	}
+	if tvd := bundle.VerificationMaterial.TimestampVerificationData; tvd != nil && len(tvd.RFC3161Timestamps) != 0 {
+		ts, err := json.Marshal(map[string][]byte{"SignedRFC3161Timestamp": tvd.RFC3161Timestamps[0].SignedTimestamp})
+		if err != nil {
+			return err
+		}
+		layer.Annotations[AnnotationTimestamp] = string(ts)
+	}
+
+	tag, err := SignatureTag(image.Digest)
+	if err != nil {
+		return err
+	}
+	sigRef := image.WithTag(tag)
+	manifest := oci.Manifest{SchemaVersion: 2, MediaType: oci.MediaTypeImageManifest}
+	existing, _, _, err := client.GetManifest(ctx, sigRef)
+	if err == nil {
+		if err := json.Unmarshal(existing, &manifest); err != nil {
+			return err
+		}
+	} else if err != oci.ErrNotFound {
+		return err
+	}
+	for _, l := range manifest.Layers {
+		if l.Digest == layer.Digest && l.Annotations[AnnotationSignature] == layer.Annotations[AnnotationSignature] {
+			// already attached
+			return nil
+		}
+	}
+	manifest.Layers = append(manifest.Layers, layer)
+	if _, err := client.PutBlob(ctx, image, payload); err != nil {
+		return err
+	}
+	config, err := signatureConfig(manifest.Layers)
+	if err != nil {
+		return err
+	}
+	if _, err := client.PutBlob(ctx, image, config); err != nil {
+		return err
+	}
+	manifest.Config = oci.NewDescriptor(oci.MediaTypeImageConfig, config)
+	blob, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	_, _, err = client.PutManifest(ctx, sigRef, oci.MediaTypeImageManifest, blob)
+	return err
+}
+
+// signatureConfig returns the image config cosign writes for a signature
+// manifest, which lists each payload as a layer
+func signatureConfig(layers []oci.Descriptor) ([]byte, error) {
+	diffIDs := make([]string, len(layers))
+	for i, l := range layers {
+		diffIDs[i] = l.Digest
+	}
+	created := time.Time{}.Format(time.RFC3339)
+	return json.Marshal(map[string]interface{}{
+		"architecture": "",
+		"created":      created,
+		"history":      []map[string]string{{"created": created}},
+		"os":           "",
+		"rootfs":       map[string]interface{}{"type": "layers", "diff_ids": diffIDs},
+		"config":       map[string]interface{}{},
+	})
+}
+
+// AttachBundle pushes a Sigstore bundle as a referrer of the image
+func AttachBundle(ctx context.Context, client *oci.Client, image oci.Reference, subject oci.Descriptor, bundle []byte, created time.Time) error {
+	if _, err := client.PutBlob(ctx, image, oci.EmptyJSON); err != nil {
+		return err
+	}
+	if _, err := client.PutBlob(ctx, image, bundle); err != nil {
+		return err
+	}
+	manifest := oci.Manifest{
+		SchemaVersion: 2,
+		MediaType:     oci.MediaTypeImageManifest,
+		ArtifactType:  sigstore.MediaType,
+		Config:        oci.NewDescriptor(oci.MediaTypeEmpty, oci.EmptyJSON),
+		Layers:        []oci.Descriptor{oci.NewDescriptor(sigstore.MediaType, bundle)},
+		Subject:       &subject,
+		Annotations: map[string]string{
+			"dev.sigstore.bundle.content":       "dsse-envelope",
+			"dev.sigstore.bundle.predicateType": SignPredicate,
+			"org.opencontainers.image.created":  created.UTC().Format(time.RFC3339),
+		},
+	}
+	blob, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	digest, subjectSupported, err := client.PutManifest(ctx, image.WithDigest(oci.Digest(blob)), oci.MediaTypeImageManifest, blob)
+	if err != nil {
+		return err
+	}
+	if subjectSupported {
+		return nil
+	}
+	desc := oci.Descriptor{
+		MediaType:    oci.MediaTypeImageManifest,
+		Digest:       digest,
+		Size:         int64(len(blob)),
+		ArtifactType: manifest.ArtifactType,
+		Annotations:  manifest.Annotations,
+	}
+	return client.AddReferrer(ctx, image, subject.Digest, desc)
+}
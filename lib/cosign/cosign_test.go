@@ -0,0 +1,196 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cosign
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sassoftware/relic/v7/internal/testcert"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/intoto"
+	"github.com/sassoftware/relic/v7/lib/oci"
+	"github.com/sassoftware/relic/v7/lib/sigstore"
+)
+
+// fakeRegistry is just enough of the distribution API for the tests. It does
+// not implement the referrers API so the tag schema fallback is exercised.
+type fakeRegistry struct {
+	mu        sync.Mutex
+	blobs     map[string][]byte
+	manifests map[string][]byte
+	types     map[string]string
+	uploads   int
+}
+
+func newFakeRegistry() *fakeRegistry {
+	return &fakeRegistry{
+		blobs:     make(map[string][]byte),
+		manifests: make(map[string][]byte),
+		types:     make(map[string]string),
+	}
+}
+
+func (f *fakeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	path := strings.TrimPrefix(r.URL.Path, "/v2/")
+	switch {
+	case strings.Contains(path, "/manifests/"):
+		i := strings.Index(path, "/manifests/")
+		repo, id := path[:i], path[i+11:]
+		switch r.Method {
+		case "GET":
+			blob, ok := f.manifests[repo+"@"+id]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", f.types[repo+"@"+id])
+			w.Write(blob)
+		case "PUT":
+			blob, _ := io.ReadAll(r.Body)
+			digest := oci.Digest(blob)
+			for _, key := range []string{repo + "@" + id, repo + "@" + digest} {
+				f.manifests[key] = blob
+				f.types[key] = r.Header.Get("Content-Type")
+			}
+			w.WriteHeader(http.StatusCreated)
+		}
+	case strings.Contains(path, "/blobs/uploads/"):
+		repo := path[:strings.Index(path, "/blobs/uploads/")]
+		if r.Method == "POST" {
+			f.uploads++
+			w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/uploads/%d?state=x", repo, f.uploads))
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		blob, _ := io.ReadAll(r.Body)
+		if oci.Digest(blob) != r.URL.Query().Get("digest") || r.URL.Query().Get("state") != "x" {
+			http.Error(w, "bad digest", http.StatusBadRequest)
+			return
+		}
+		f.blobs[repo+"@"+oci.Digest(blob)] = blob
+		w.WriteHeader(http.StatusCreated)
+	case strings.Contains(path, "/blobs/"):
+		i := strings.Index(path, "/blobs/")
+		blob, ok := f.blobs[path[:i]+"@"+path[i+7:]]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(blob)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func mkCert(t *testing.T, email string) *certloader.Certificate {
+	issuer, err := asn1.MarshalWithParams("https://issuer.example.com", "utf8")
+	require.NoError(t, err)
+	return testcert.Signer(t, &x509.Certificate{
+		Subject:         pkix.Name{CommonName: "signer"},
+		EmailAddresses:  []string{email},
+		ExtraExtensions: []pkix.Extension{{Id: oidIssuerV2, Value: issuer}},
+	}, testcert.ECDSAKey(t))
+}
+
+func TestSignImage(t *testing.T) {
+	srv := httptest.NewServer(newFakeRegistry())
+	defer srv.Close()
+	ctx := context.Background()
+	client := &oci.Client{HTTPClient: srv.Client(), PlainHTTP: true}
+	ref, err := oci.ParseReference(strings.TrimPrefix(srv.URL, "http://") + "/team/app:1.0")
+	require.NoError(t, err)
+	manifest := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{},"layers":[]}`)
+	_, _, err = client.PutManifest(ctx, ref, oci.MediaTypeImageManifest, manifest)
+	require.NoError(t, err)
+	desc, err := client.Resolve(ctx, ref)
+	require.NoError(t, err)
+	image := ref.WithDigest(desc.Digest)
+	subj := Subject{Name: ref.Name(), Digest: desc.Digest, Annotations: map[string]string{"build": "42"}}
+
+	// tag scheme, twice with the same key and once with another
+	cert1 := mkCert(t, "one@example.com")
+	payload, err := NewPayload(subj)
+	require.NoError(t, err)
+	digest := sha256.Sum256(payload)
+	bundle, err := sigstore.SignMessage(ctx, cert1, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+	require.NoError(t, AttachSignature(ctx, client, image, payload, bundle))
+	require.NoError(t, AttachSignature(ctx, client, image, payload, bundle))
+	cert2 := mkCert(t, "two@example.com")
+	bundle, err = sigstore.SignMessage(ctx, cert2, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+	require.NoError(t, AttachSignature(ctx, client, image, payload, bundle))
+
+	// referrers
+	stmt, err := NewStatement(subj)
+	require.NoError(t, err)
+	bundle, err = sigstore.SignDSSE(ctx, cert1, intoto.PayloadType, stmt)
+	require.NoError(t, err)
+	bundleJSON, err := json.Marshal(bundle)
+	require.NoError(t, err)
+	require.NoError(t, AttachBundle(ctx, client, image, desc, bundleJSON, time.Now()))
+
+	sigs, err := FetchSignatures(ctx, client, image)
+	require.NoError(t, err)
+	require.Len(t, sigs, 3)
+	var emails []string
+	for _, sig := range sigs {
+		v, err := sig.Verify(desc.Digest, nil)
+		require.NoError(t, err)
+		assert.Equal(t, ref.Name(), v.Subject.Name)
+		assert.Equal(t, "42", v.Subject.Annotations["build"])
+		emails = append(emails, v.Certificate.EmailAddresses[0])
+		_, err = sig.Verify("sha256:"+strings.Repeat("0", 64), nil)
+		assert.Error(t, err)
+	}
+	assert.Equal(t, []string{"one@example.com", "two@example.com", "one@example.com"}, emails)
+	assert.Nil(t, sigs[2].Payload)
+
+	// verify against a public key instead of the embedded certificate
+	_, err = sigs[0].Verify(desc.Digest, cert1.Leaf.PublicKey)
+	assert.NoError(t, err)
+	_, err = sigs[0].Verify(desc.Digest, cert2.Leaf.PublicKey)
+	assert.Error(t, err)
+}
+
+func TestCheckIdentity(t *testing.T) {
+	cert := mkCert(t, "one@example.com").Leaf
+	assert.Equal(t, "https://issuer.example.com", CertificateIssuer(cert))
+	assert.NoError(t, CheckIdentity(cert, "one@example.com", "https://issuer.example.com"))
+	assert.NoError(t, CheckIdentity(cert, "", ""))
+	assert.Error(t, CheckIdentity(cert, "two@example.com", ""))
+	assert.Error(t, CheckIdentity(cert, "", "https://other.example.com"))
+}
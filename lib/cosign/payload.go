@@ -0,0 +1,173 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package cosign signs container images in the formats understood by
+// Sigstore cosign: simple signing payloads attached under a .sig tag, or
+// Sigstore bundles attached as OCI 1.1 referrers.
+package cosign
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/sassoftware/relic/v7/lib/intoto"
+)
+
+const (
+	// SimpleSigningMediaType is the media type of a simple signing payload
+	SimpleSigningMediaType = "application/vnd.dev.cosign.simplesigning.v1+json"
+	// SimpleSigningType is the critical.type of a simple signing payload
+	SimpleSigningType = "cosign container image signature"
+	// SignPredicate is the predicate type of an image signature made in
+	// bundle format
+	SignPredicate = "https://sigstore.dev/cosign/sign/v1"
+
+	AnnotationSignature   = "dev.cosignproject.cosign/signature"
+	AnnotationCertificate = "dev.sigstore.cosign/certificate"
+	AnnotationChain       = "dev.sigstore.cosign/chain"
+	AnnotationTimestamp   = "dev.sigstore.cosign/rfc3161timestamp"
+)
+
+// Payload is a simple signing payload, the thing that gets signed in the
+// tag scheme
+type Payload struct {
+	Critical Critical          `json:"critical"`
+	Optional map[string]string `json:"optional"`
+}
+
+// Critical identifies the signed image
+type Critical struct {
+	Identity struct {
+		DockerReference string `json:"docker-reference"`
+	} `json:"identity"`
+	Image struct {
+		DockerManifestDigest string `json:"docker-manifest-digest"`
+	} `json:"image"`
+	Type string `json:"type"`
+}
+
+// Subject is what an image signature claims, whatever its format
+type Subject struct {
+	// Name is the repository the image was signed in, without tag or digest
+	Name        string
+	Digest      string
+	Annotations map[string]string
+}
+
+// NewPayload returns a simple signing payload for an image
+func NewPayload(subj Subject) ([]byte, error) {
+	var p Payload
+	p.Critical.Identity.DockerReference = subj.Name
+	p.Critical.Image.DockerManifestDigest = subj.Digest
+	p.Critical.Type = SimpleSigningType
+	p.Optional = subj.Annotations
+	return json.Marshal(p)
+}
+
+// NewStatement returns an in-toto statement for an image, which is what gets
+// signed in the bundle format
+func NewStatement(subj Subject) ([]byte, error) {
+	alg, digest, ok := strings.Cut(subj.Digest, ":")
+	if !ok {
+		return nil, errors.New("invalid image digest")
+	}
+	if _, err := hex.DecodeString(digest); err != nil {
+		return nil, errors.New("invalid image digest")
+	}
+	var pred interface{}
+	if len(subj.Annotations) != 0 {
+		pred = map[string]interface{}{"annotations": subj.Annotations}
+	}
+	stmt := &intoto.Statement{
+		Type:          intoto.StatementType,
+		Subject:       []intoto.Subject{{Name: subj.Name, Digest: map[string]string{alg: digest}}},
+		PredicateType: SignPredicate,
+	}
+	if pred != nil {
+		blob, err := json.Marshal(pred)
+		if err != nil {
+			return nil, err
+		}
+		stmt.Predicate = blob
+	}
+	return json.Marshal(stmt)
+}
+
+// ParsePayload parses either a simple signing payload or an in-toto statement
+// made by NewStatement
+func ParsePayload(blob []byte) (*Subject, error) {
+	if IsStatement(blob) {
+		return parseStatement(blob)
+	}
+	var p Payload
+	if err := json.Unmarshal(blob, &p); err != nil {
+		return nil, fmt.Errorf("parsing image signature payload: %w", err)
+	}
+	if p.Critical.Type != SimpleSigningType {
+		return nil, fmt.Errorf("unexpected payload type %q", p.Critical.Type)
+	}
+	if p.Critical.Image.DockerManifestDigest == "" {
+		return nil, errors.New("payload has no image digest")
+	}
+	return &Subject{
+		Name:        p.Critical.Identity.DockerReference,
+		Digest:      p.Critical.Image.DockerManifestDigest,
+		Annotations: p.Optional,
+	}, nil
+}
+
+// IsStatement returns true if the payload is an in-toto statement rather than
+// a simple signing payload
+func IsStatement(blob []byte) bool {
+	var probe struct {
+		Type string `json:"_type"`
+	}
+	return json.Unmarshal(blob, &probe) == nil && probe.Type != ""
+}
+
+func parseStatement(blob []byte) (*Subject, error) {
+	stmt, err := intoto.Parse(blob)
+	if err != nil {
+		return nil, err
+	}
+	if stmt.PredicateType != SignPredicate {
+		return nil, fmt.Errorf("unexpected predicate type %q", stmt.PredicateType)
+	}
+	if len(stmt.Subject) != 1 {
+		return nil, errors.New("image statement must have exactly one subject")
+	}
+	subj := &Subject{Name: stmt.Subject[0].Name}
+	if d := stmt.Subject[0].Digest["sha256"]; d != "" {
+		subj.Digest = "sha256:" + d
+	} else if d := stmt.Subject[0].Digest["sha512"]; d != "" {
+		subj.Digest = "sha512:" + d
+	} else {
+		return nil, errors.New("image statement has no supported digest")
+	}
+	if len(stmt.Predicate) != 0 {
+		var pred struct {
+			Annotations map[string]string `json:"annotations"`
+		}
+		if err := json.Unmarshal(stmt.Predicate, &pred); err != nil {
+			return nil, fmt.Errorf("parsing image statement predicate: %w", err)
+		}
+		subj.Annotations = pred.Annotations
+	}
+	return subj, nil
+}
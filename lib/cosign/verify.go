@@ -0,0 +1,253 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cosign
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/intoto"
+	"github.com/sassoftware/relic/v7/lib/oci"
+	"github.com/sassoftware/relic/v7/lib/pkcs7"
+	"github.com/sassoftware/relic/v7/lib/pkcs9"
+	"github.com/sassoftware/relic/v7/lib/sigstore"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+)
+
+const maxPayload = 1 << 20
+
+// Signature is an image signature fetched from a registry, in either scheme
+type Signature struct {
+	// Payload and Signature are set for tag scheme signatures
+	Payload   []byte
+	Signature []byte
+	// Bundle is set for referrers
+	Bundle *sigstore.Bundle
+	// Certificates is the signing certificate followed by its chain, if any
+	Certificates []*x509.Certificate
+	Timestamp    []byte
+}
+
+// Verified is the result of verifying an image signature
+type Verified struct {
+	Subject          *Subject
+	Certificate      *x509.Certificate
+	Chain            []*x509.Certificate
+	CounterSignature *pkcs9.CounterSignature
+}
+
+// FetchSignatures returns all signatures attached to an image by digest,
+// using both the tag scheme and referrers
+func FetchSignatures(ctx context.Context, client *oci.Client, image oci.Reference) ([]*Signature, error) {
+	tag, err := SignatureTag(image.Digest)
+	if err != nil {
+		return nil, err
+	}
+	var sigs []*Signature
+	blob, _, _, err := client.GetManifest(ctx, image.WithTag(tag))
+	if err == nil {
+		var manifest oci.Manifest
+		if err := json.Unmarshal(blob, &manifest); err != nil {
+			return nil, fmt.Errorf("parsing signature manifest: %w", err)
+		}
+		for _, layer := range manifest.Layers {
+			if layer.MediaType != SimpleSigningMediaType {
+				continue
+			}
+			sig, err := parseLayer(ctx, client, image, layer)
+			if err != nil {
+				return nil, err
+			}
+			sigs = append(sigs, sig)
+		}
+	} else if err != oci.ErrNotFound {
+		return nil, err
+	}
+	referrers, err := client.Referrers(ctx, image, image.Digest, sigstore.MediaType)
+	if err != nil {
+		return nil, err
+	}
+	for _, desc := range referrers {
+		blob, _, _, err := client.GetManifest(ctx, image.WithDigest(desc.Digest))
+		if err != nil {
+			return nil, err
+		}
+		var manifest oci.Manifest
+		if err := json.Unmarshal(blob, &manifest); err != nil {
+			return nil, fmt.Errorf("parsing referrer manifest: %w", err)
+		}
+		if len(manifest.Layers) != 1 {
+			continue
+		}
+		blob, err = client.GetBlob(ctx, image, manifest.Layers[0].Digest, maxPayload)
+		if err != nil {
+			return nil, err
+		}
+		bundle, err := sigstore.Parse(blob)
+		if err != nil {
+			return nil, err
+		}
+		sigs = append(sigs, &Signature{Bundle: bundle})
+	}
+	return sigs, nil
+}
+
+func parseLayer(ctx context.Context, client *oci.Client, image oci.Reference, layer oci.Descriptor) (*Signature, error) {
+	payload, err := client.GetBlob(ctx, image, layer.Digest, maxPayload)
+	if err != nil {
+		return nil, err
+	}
+	sig := &Signature{Payload: payload}
+	sig.Signature, err = base64.StdEncoding.DecodeString(layer.Annotations[AnnotationSignature])
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature annotation: %w", err)
+	}
+	if certPEM := layer.Annotations[AnnotationCertificate]; certPEM != "" {
+		sig.Certificates, err = certloader.ParseX509Certificates([]byte(certPEM + layer.Annotations[AnnotationChain]))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if ts := layer.Annotations[AnnotationTimestamp]; ts != "" {
+		var parsed struct {
+			SignedRFC3161Timestamp []byte
+		}
+		if err := json.Unmarshal([]byte(ts), &parsed); err != nil {
+			return nil, fmt.Errorf("invalid timestamp annotation: %w", err)
+		}
+		sig.Timestamp = parsed.SignedRFC3161Timestamp
+	}
+	return sig, nil
+}
+
+// Verify the signature and that it is for the given image digest. If pub is
+// nil then the signature's own certificate is used. The certificate chain is
+// not checked.
+func (s *Signature) Verify(digest string, pub crypto.PublicKey) (*Verified, error) {
+	v := new(Verified)
+	var payload, rawSig, timestamp []byte
+	if s.Bundle != nil {
+		certs, err := s.Bundle.Certificates()
+		if err != nil && pub == nil {
+			return nil, err
+		}
+		if len(certs) != 0 {
+			v.Certificate, v.Chain = certs[0], certs[1:]
+		}
+		env := s.Bundle.DSSEEnvelope
+		if env == nil || env.PayloadType != intoto.PayloadType || len(env.Signatures) == 0 {
+			return nil, errors.New("image signature bundle does not hold an in-toto statement")
+		}
+		if pub == nil {
+			pub = v.Certificate.PublicKey
+		}
+		if err := env.Verify(pub, sigstore.HashForKey(pub)); err != nil {
+			return nil, err
+		}
+		payload, rawSig = env.Payload, env.Signatures[0].Sig
+		if tvd := s.Bundle.VerificationMaterial.TimestampVerificationData; tvd != nil && len(tvd.RFC3161Timestamps) != 0 {
+			timestamp = tvd.RFC3161Timestamps[0].SignedTimestamp
+		}
+	} else {
+		if len(s.Certificates) != 0 {
+			v.Certificate, v.Chain = s.Certificates[0], s.Certificates[1:]
+		}
+		if pub == nil {
+			if v.Certificate == nil {
+				return nil, errors.New("signature has no certificate and no public key was given")
+			}
+			pub = v.Certificate.PublicKey
+		}
+		hash := sigstore.HashForKey(pub)
+		d := hash.New()
+		d.Write(s.Payload)
+		if err := x509tools.Verify(pub, hash, d.Sum(nil), s.Signature); err != nil {
+			return nil, err
+		}
+		payload, rawSig, timestamp = s.Payload, s.Signature, s.Timestamp
+	}
+	subj, err := ParsePayload(payload)
+	if err != nil {
+		return nil, err
+	}
+	if subj.Digest != digest {
+		return nil, fmt.Errorf("signature is for %s, not %s", subj.Digest, digest)
+	}
+	v.Subject = subj
+	if timestamp != nil {
+		tst, err := pkcs7.Unmarshal(timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("parsing signature timestamp: %w", err)
+		}
+		v.CounterSignature, err = pkcs9.Verify(tst, rawSig, nil)
+		if err != nil {
+			return nil, fmt.Errorf("verifying signature timestamp: %w", err)
+		}
+	}
+	return v, nil
+}
+
+var (
+	oidIssuerV1 = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 1}
+	oidIssuerV2 = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 8}
+)
+
+// CheckIdentity checks a keyless signing certificate's subject alternative
+// name and OIDC issuer. Empty values are not checked.
+func CheckIdentity(cert *x509.Certificate, identity, issuer string) error {
+	if identity != "" {
+		var found bool
+		for _, email := range cert.EmailAddresses {
+			found = found || email == identity
+		}
+		for _, uri := range cert.URIs {
+			found = found || uri.String() == identity
+		}
+		if !found {
+			return fmt.Errorf("certificate identity does not match %q", identity)
+		}
+	}
+	if issuer != "" {
+		if got := CertificateIssuer(cert); got != issuer {
+			return fmt.Errorf("certificate OIDC issuer %q does not match %q", got, issuer)
+		}
+	}
+	return nil
+}
+
+// CertificateIssuer returns the OIDC issuer recorded in a Fulcio certificate
+func CertificateIssuer(cert *x509.Certificate) string {
+	for _, ext := range cert.Extensions {
+		switch {
+		case ext.Id.Equal(oidIssuerV2):
+			var s string
+			if _, err := asn1.UnmarshalWithParams(ext.Value, &s, "utf8"); err == nil {
+				return s
+			}
+		case ext.Id.Equal(oidIssuerV1):
+			return string(ext.Value)
+		}
+	}
+	return ""
+}
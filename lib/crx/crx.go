@@ -0,0 +1,252 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package crx implements the CRX3 format used to package Chrome extensions: a
+// protobuf header holding one or more signatures over the zipped extension,
+// which is appended to it unchanged.
+package crx
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// Magic is the first 4 bytes of every CRX file
+	Magic   = "Cr24"
+	version = 3
+	// signature context prefixed to the signed message
+	signContext = "CRX3 SignedData\x00"
+
+	// CrxFileHeader fields
+	fieldRSA        = 2
+	fieldECDSA      = 3
+	fieldSignedData = 10000
+	// SignedData fields
+	fieldCrxID = 1
+	// AsymmetricKeyProof fields
+	fieldPublicKey = 1
+	fieldSignature = 2
+
+	maxHeaderSize = 1 << 20
+)
+
+// ErrNotSigned is returned when verifying a plain zip archive
+var ErrNotSigned = errors.New("file is not a CRX package")
+
+// Proof is a signature by one key over the header and archive
+type Proof struct {
+	// PublicKey is a DER-encoded SubjectPublicKeyInfo
+	PublicKey []byte
+	Signature []byte
+	ECDSA     bool
+}
+
+type Package struct {
+	Proofs     []Proof
+	SignedData []byte
+	// HeaderSize is the size of everything before the archive, or 0 if the
+	// package is just a zip archive
+	HeaderSize int64
+	Archive    []byte
+}
+
+// Parse a CRX3 package, or a bare zip archive to be signed
+func Parse(blob []byte) (*Package, error) {
+	if bytes.HasPrefix(blob, []byte("PK\x03\x04")) {
+		return &Package{Archive: blob}, nil
+	} else if !bytes.HasPrefix(blob, []byte(Magic)) {
+		return nil, errors.New("crx: not a CRX package or zip archive")
+	} else if len(blob) < 12 {
+		return nil, errTruncated
+	}
+	if v := binary.LittleEndian.Uint32(blob[4:]); v != version {
+		return nil, fmt.Errorf("crx: unsupported version %d", v)
+	}
+	size := binary.LittleEndian.Uint32(blob[8:])
+	if size > maxHeaderSize || int64(size) > int64(len(blob)-12) {
+		return nil, errTruncated
+	}
+	p := &Package{HeaderSize: 12 + int64(size), Archive: blob[12+size:]}
+	fields, err := parseFields(blob[12 : 12+size])
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range fields {
+		switch f.num {
+		case fieldRSA, fieldECDSA:
+			proof, err := parseProof(f.value)
+			if err != nil {
+				return nil, err
+			}
+			proof.ECDSA = f.num == fieldECDSA
+			p.Proofs = append(p.Proofs, proof)
+		case fieldSignedData:
+			p.SignedData = f.value
+		}
+	}
+	return p, nil
+}
+
+func parseProof(b []byte) (Proof, error) {
+	fields, err := parseFields(b)
+	if err != nil {
+		return Proof{}, err
+	}
+	var proof Proof
+	for _, f := range fields {
+		switch f.num {
+		case fieldPublicKey:
+			proof.PublicKey = f.value
+		case fieldSignature:
+			proof.Signature = f.value
+		}
+	}
+	return proof, nil
+}
+
+// CrxID returns the binary CRX ID corresponding to a public key
+func CrxID(spki []byte) []byte {
+	sum := sha256.Sum256(spki)
+	return sum[:16]
+}
+
+// ExtensionID formats a CRX ID as an extension ID, which is hex with the
+// digits mapped to the letters a-p
+func ExtensionID(crxID []byte) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' {
+			return r - 'a' + 'k'
+		}
+		return r - '0' + 'a'
+	}, hex.EncodeToString(crxID))
+}
+
+// message covered by each proof
+func signedMessage(signedData, archive []byte) []byte {
+	msg := make([]byte, 0, len(signContext)+4+len(signedData)+len(archive))
+	msg = append(msg, signContext...)
+	var size [4]byte
+	binary.LittleEndian.PutUint32(size[:], uint32(len(signedData)))
+	msg = append(msg, size[:]...)
+	msg = append(msg, signedData...)
+	return append(msg, archive...)
+}
+
+// Sign the archive and return a new header to replace the existing one, if
+// any. The CRX ID, and thus the extension ID, is derived from the signing key.
+func (p *Package) Sign(signer crypto.Signer) ([]byte, error) {
+	spki, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	var field uint64
+	switch pub := signer.Public().(type) {
+	case *rsa.PublicKey:
+		field = fieldRSA
+	case *ecdsa.PublicKey:
+		if pub.Curve.Params().BitSize != 256 {
+			return nil, errors.New("crx: ECDSA keys must use P-256")
+		}
+		field = fieldECDSA
+	default:
+		return nil, fmt.Errorf("crx: unsupported key type %T", pub)
+	}
+	signedData := appendBytesField(nil, fieldCrxID, CrxID(spki))
+	digest := sha256.Sum256(signedMessage(signedData, p.Archive))
+	sig, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	proof := appendBytesField(nil, fieldPublicKey, spki)
+	proof = appendBytesField(proof, fieldSignature, sig)
+	header := appendBytesField(nil, field, proof)
+	header = appendBytesField(header, fieldSignedData, signedData)
+	prefix := append([]byte(Magic), 0, 0, 0, 0, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(prefix[4:], version)
+	binary.LittleEndian.PutUint32(prefix[8:], uint32(len(header)))
+	return append(prefix, header...), nil
+}
+
+// Verify checks every proof in the package and that one of them was made by
+// the key the CRX ID was derived from. Returns the extension ID and the
+// signing keys, with the key matching the ID first.
+func (p *Package) Verify() (string, []crypto.PublicKey, error) {
+	if p.HeaderSize == 0 {
+		return "", nil, ErrNotSigned
+	}
+	var crxID []byte
+	fields, err := parseFields(p.SignedData)
+	if err != nil {
+		return "", nil, err
+	}
+	for _, f := range fields {
+		if f.num == fieldCrxID {
+			crxID = f.value
+		}
+	}
+	if len(crxID) != 16 {
+		return "", nil, errors.New("crx: missing CRX ID")
+	}
+	digest := sha256.Sum256(signedMessage(p.SignedData, p.Archive))
+	var keys []crypto.PublicKey
+	var found bool
+	for _, proof := range p.Proofs {
+		pub, err := x509.ParsePKIXPublicKey(proof.PublicKey)
+		if err != nil {
+			return "", nil, fmt.Errorf("crx: %w", err)
+		}
+		switch k := pub.(type) {
+		case *rsa.PublicKey:
+			if proof.ECDSA {
+				return "", nil, errors.New("crx: RSA key in ECDSA proof")
+			}
+			err = rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], proof.Signature)
+		case *ecdsa.PublicKey:
+			if !proof.ECDSA {
+				return "", nil, errors.New("crx: ECDSA key in RSA proof")
+			}
+			if !ecdsa.VerifyASN1(k, digest[:], proof.Signature) {
+				err = errors.New("crx: ECDSA signature is invalid")
+			}
+		default:
+			err = fmt.Errorf("crx: unsupported key type %T", pub)
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		if !found && bytes.Equal(CrxID(proof.PublicKey), crxID) {
+			found = true
+			keys = append([]crypto.PublicKey{pub}, keys...)
+		} else {
+			keys = append(keys, pub)
+		}
+	}
+	if !found {
+		return "", nil, errors.New("crx: no signature from the key matching the CRX ID")
+	}
+	return ExtensionID(crxID), keys, nil
+}
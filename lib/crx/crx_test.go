@@ -0,0 +1,90 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package crx
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testArchive(t *testing.T) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	f, err := w.Create("manifest.json")
+	require.NoError(t, err)
+	_, err = f.Write([]byte(`{"manifest_version": 3, "name": "test", "version": "1.0"}`))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestSignVerify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	for _, key := range []crypto.Signer{rsaKey, ecKey} {
+		archive := testArchive(t)
+		p, err := Parse(archive)
+		require.NoError(t, err)
+		_, _, err = p.Verify()
+		assert.ErrorIs(t, err, ErrNotSigned)
+
+		header, err := p.Sign(key)
+		require.NoError(t, err)
+		signed := append(header, archive...)
+		p, err = Parse(signed)
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(header)), p.HeaderSize)
+		assert.Equal(t, archive, p.Archive)
+		id, keys, err := p.Verify()
+		require.NoError(t, err)
+		assert.Len(t, id, 32)
+		assert.Regexp(t, "^[a-p]+$", id)
+		require.Len(t, keys, 1)
+		assert.True(t, key.Public().(interface{ Equal(crypto.PublicKey) bool }).Equal(keys[0]))
+
+		// re-signing a CRX replaces its header
+		header2, err := p.Sign(key)
+		require.NoError(t, err)
+		p, err = Parse(append(header2, p.Archive...))
+		require.NoError(t, err)
+		id2, _, err := p.Verify()
+		require.NoError(t, err)
+		assert.Equal(t, id, id2)
+
+		signed[len(signed)-1] ^= 1
+		p, err = Parse(signed)
+		require.NoError(t, err)
+		_, _, err = p.Verify()
+		assert.Error(t, err)
+	}
+}
+
+func TestExtensionID(t *testing.T) {
+	assert.Equal(t, "abcdefghijklmnopabcdefghijklmnop", ExtensionID([]byte{
+		0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef, 0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef}))
+}
@@ -0,0 +1,84 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package crx
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Just enough of the protobuf wire format to handle the CRX3 header, which
+// only has length-delimited fields
+
+const wireBytes = 2
+
+var errTruncated = errors.New("crx: truncated header")
+
+type field struct {
+	num   uint64
+	value []byte
+}
+
+func appendBytesField(b []byte, num uint64, value []byte) []byte {
+	b = appendUvarint(b, num<<3|wireBytes)
+	b = appendUvarint(b, uint64(len(value)))
+	return append(b, value...)
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	return append(b, buf[:n]...)
+}
+
+// parse a message into its fields, skipping any varint or fixed-size fields
+func parseFields(b []byte) ([]field, error) {
+	var fields []field
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, errTruncated
+		}
+		b = b[n:]
+		switch tag & 7 {
+		case 0:
+			if _, n = binary.Uvarint(b); n <= 0 {
+				return nil, errTruncated
+			}
+			b = b[n:]
+		case 1, 5:
+			size := 8
+			if tag&7 == 5 {
+				size = 4
+			}
+			if len(b) < size {
+				return nil, errTruncated
+			}
+			b = b[size:]
+		case wireBytes:
+			size, n := binary.Uvarint(b)
+			if n <= 0 || size > uint64(len(b)-n) {
+				return nil, errTruncated
+			}
+			fields = append(fields, field{num: tag >> 3, value: b[n : n+int(size)]})
+			b = b[n+int(size):]
+		default:
+			return nil, errors.New("crx: unsupported protobuf wire type")
+		}
+	}
+	return fields, nil
+}
@@ -0,0 +1,102 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package dsse implements Dead Simple Signing Envelopes, the signature
+// wrapper used by in-toto attestations and Sigstore.
+package dsse
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+)
+
+// Envelope holds a payload and its signatures
+type Envelope struct {
+	PayloadType string      `json:"payloadType"`
+	Payload     []byte      `json:"payload"`
+	Signatures  []Signature `json:"signatures"`
+}
+
+// Signature is one signature over the envelope's payload
+type Signature struct {
+	KeyID string `json:"keyid,omitempty"`
+	Sig   []byte `json:"sig"`
+}
+
+// PAE returns the pre-authentication encoding of a payload, which is what
+// actually gets signed
+func PAE(payloadType string, payload []byte) []byte {
+	return []byte(fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload))
+}
+
+// SignPAE signs the pre-authentication encoding of a payload. Ed25519 keys
+// sign it directly, other keys sign a digest of it.
+func SignPAE(signer crypto.Signer, hash crypto.Hash, payloadType string, payload []byte) ([]byte, error) {
+	msg := PAE(payloadType, payload)
+	if _, ok := signer.Public().(ed25519.PublicKey); ok {
+		return signer.Sign(rand.Reader, msg, crypto.Hash(0))
+	}
+	d := hash.New()
+	d.Write(msg)
+	return signer.Sign(rand.Reader, d.Sum(nil), hash)
+}
+
+// VerifyPAE checks a signature made by SignPAE
+func VerifyPAE(pub crypto.PublicKey, hash crypto.Hash, payloadType string, payload, sig []byte) error {
+	msg := PAE(payloadType, payload)
+	if key, ok := pub.(ed25519.PublicKey); ok {
+		if !ed25519.Verify(key, msg, sig) {
+			return errors.New("ED25519 verification failed")
+		}
+		return nil
+	}
+	d := hash.New()
+	d.Write(msg)
+	return x509tools.Verify(pub, hash, d.Sum(nil), sig)
+}
+
+// Sign creates an envelope with a single signature
+func Sign(signer crypto.Signer, hash crypto.Hash, payloadType string, payload []byte, keyID string) (*Envelope, error) {
+	sig, err := SignPAE(signer, hash, payloadType, payload)
+	if err != nil {
+		return nil, err
+	}
+	return &Envelope{
+		PayloadType: payloadType,
+		Payload:     payload,
+		Signatures:  []Signature{{KeyID: keyID, Sig: sig}},
+	}, nil
+}
+
+// Verify that at least one of the envelope's signatures was made by the given
+// key
+func (e *Envelope) Verify(pub crypto.PublicKey, hash crypto.Hash) error {
+	if len(e.Signatures) == 0 {
+		return errors.New("envelope is not signed")
+	}
+	var err error
+	for _, sig := range e.Signatures {
+		if err = VerifyPAE(pub, hash, e.PayloadType, e.Payload, sig.Sig); err == nil {
+			return nil
+		}
+	}
+	return err
+}
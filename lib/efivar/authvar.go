@@ -0,0 +1,244 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package efivar implements signing of UEFI time-based authenticated
+// variables, as used to update the Secure Boot PK, KEK, db and dbx variables.
+package efivar
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf16"
+
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/pkcs7"
+	"github.com/sassoftware/relic/v7/lib/pkcs9"
+	"github.com/sassoftware/relic/v7/signers/sigerrors"
+)
+
+// Variable attributes
+const (
+	NonVolatile                       = 0x01
+	BootserviceAccess                 = 0x02
+	RuntimeAccess                     = 0x04
+	TimeBasedAuthenticatedWriteAccess = 0x20
+	AppendWrite                       = 0x40
+
+	// DefaultAttributes are used when writing the Secure Boot key variables
+	DefaultAttributes = NonVolatile | BootserviceAccess | RuntimeAccess | TimeBasedAuthenticatedWriteAccess
+)
+
+const (
+	winCertRevision = 0x0200
+	winCertTypeGUID = 0x0ef1
+	efiTimeSize     = 16
+	winCertHdrSize  = 8 + 16
+)
+
+// KnownVariables maps the Secure Boot variable names to their vendor GUIDs
+var KnownVariables = map[string]GUID{
+	"PK":  GlobalVariable,
+	"KEK": GlobalVariable,
+	"db":  ImageSecurityDatabase,
+	"dbx": ImageSecurityDatabase,
+	"dbt": ImageSecurityDatabase,
+	"dbr": ImageSecurityDatabase,
+}
+
+// AuthenticatedVariable is an update to a time-based authenticated variable.
+// The marshalled form is an EFI_VARIABLE_AUTHENTICATION_2 descriptor followed
+// by the new variable contents, suitable for passing to SetVariable().
+type AuthenticatedVariable struct {
+	Name       string
+	Vendor     GUID
+	Attributes uint32
+	Time       time.Time
+	Data       []byte
+	// DER-encoded PKCS#7 SignedData, without a ContentInfo wrapper
+	Signature []byte
+}
+
+type efiTime struct {
+	Year       uint16
+	Month      uint8
+	Day        uint8
+	Hour       uint8
+	Minute     uint8
+	Second     uint8
+	Pad1       uint8
+	Nanosecond uint32
+	TimeZone   int16
+	Daylight   uint8
+	Pad2       uint8
+}
+
+type winCertHeader struct {
+	Length   uint32
+	Revision uint16
+	CertType uint16
+	Type     GUID
+}
+
+func (v *AuthenticatedVariable) efiTime() efiTime {
+	// only the date and time fields are used, everything else must be zero
+	t := v.Time.UTC()
+	return efiTime{
+		Year:   uint16(t.Year()),
+		Month:  uint8(t.Month()),
+		Day:    uint8(t.Day()),
+		Hour:   uint8(t.Hour()),
+		Minute: uint8(t.Minute()),
+		Second: uint8(t.Second()),
+	}
+}
+
+// SignedBytes returns the serialized data covered by the signature
+func (v *AuthenticatedVariable) SignedBytes() []byte {
+	var b bytes.Buffer
+	for _, c := range utf16.Encode([]rune(v.Name)) {
+		_ = binary.Write(&b, binary.LittleEndian, c)
+	}
+	b.Write(v.Vendor[:])
+	_ = binary.Write(&b, binary.LittleEndian, v.Attributes)
+	_ = binary.Write(&b, binary.LittleEndian, v.efiTime())
+	b.Write(v.Data)
+	return b.Bytes()
+}
+
+// Sign the variable update and store the resulting signature. Firmware only
+// accepts SHA-256 so that is always used.
+func (v *AuthenticatedVariable) Sign(cert *certloader.Certificate) (*pkcs9.TimestampedSignature, error) {
+	if v.Name == "" {
+		return nil, errors.New("variable name is required")
+	}
+	if v.Attributes&TimeBasedAuthenticatedWriteAccess == 0 {
+		return nil, errors.New("variable attributes must include time-based authenticated write access")
+	}
+	builder := pkcs7.NewBuilder(cert.Signer(), cert.Chain(), crypto.SHA256)
+	if err := builder.SetContentData(v.SignedBytes()); err != nil {
+		return nil, err
+	}
+	psd, err := builder.Sign()
+	if err != nil {
+		return nil, err
+	}
+	// firmware has no use for a timestamp since the variable carries its own
+	sig, err := psd.Content.Verify(nil, false)
+	if err != nil {
+		return nil, fmt.Errorf("pkcs7: failed signature self-check: %w", err)
+	}
+	if _, err := psd.Detach(); err != nil {
+		return nil, err
+	}
+	v.Signature, err = asn1.Marshal(psd.Content)
+	if err != nil {
+		return nil, err
+	}
+	return &pkcs9.TimestampedSignature{Signature: sig, Raw: v.Signature}, nil
+}
+
+// Bytes marshals the authentication descriptor followed by the variable data
+func (v *AuthenticatedVariable) Bytes() []byte {
+	var b bytes.Buffer
+	_ = binary.Write(&b, binary.LittleEndian, v.efiTime())
+	_ = binary.Write(&b, binary.LittleEndian, winCertHeader{
+		Length:   uint32(winCertHdrSize + len(v.Signature)),
+		Revision: winCertRevision,
+		CertType: winCertTypeGUID,
+		Type:     CertTypePKCS7,
+	})
+	b.Write(v.Signature)
+	b.Write(v.Data)
+	return b.Bytes()
+}
+
+// Parse an authenticated variable update. The name, vendor and attributes are
+// not part of the serialized form; they are filled in by Verify.
+func Parse(blob []byte) (*AuthenticatedVariable, error) {
+	if len(blob) < efiTimeSize+winCertHdrSize {
+		return nil, sigerrors.NotSignedError{Type: "UEFI authenticated variable"}
+	}
+	var et efiTime
+	var hdr winCertHeader
+	r := bytes.NewReader(blob)
+	_ = binary.Read(r, binary.LittleEndian, &et)
+	_ = binary.Read(r, binary.LittleEndian, &hdr)
+	if hdr.Revision != winCertRevision || hdr.CertType != winCertTypeGUID || hdr.Type != CertTypePKCS7 {
+		return nil, sigerrors.NotSignedError{Type: "UEFI authenticated variable"}
+	}
+	end := int64(efiTimeSize) + int64(hdr.Length)
+	if hdr.Length < winCertHdrSize || end > int64(len(blob)) {
+		return nil, errors.New("invalid authentication descriptor length")
+	}
+	if et.Month < 1 || et.Month > 12 {
+		return nil, errors.New("invalid authentication descriptor timestamp")
+	}
+	return &AuthenticatedVariable{
+		Time: time.Date(int(et.Year), time.Month(et.Month), int(et.Day),
+			int(et.Hour), int(et.Minute), int(et.Second), 0, time.UTC),
+		Signature: blob[efiTimeSize+winCertHdrSize : end],
+		Data:      blob[end:],
+	}, nil
+}
+
+func (v *AuthenticatedVariable) signedData() (*pkcs7.SignedData, error) {
+	// the spec calls for a bare SignedData but some tools include the
+	// ContentInfo wrapper, and firmware accepts both
+	if psd, err := pkcs7.Unmarshal(v.Signature); err == nil && psd.ContentType.Equal(pkcs7.OidSignedData) {
+		return &psd.Content, nil
+	}
+	sd := new(pkcs7.SignedData)
+	if _, err := asn1.Unmarshal(v.Signature, sd); err != nil {
+		return nil, fmt.Errorf("parsing variable signature: %w", err)
+	}
+	return sd, nil
+}
+
+// Verify the signature on the variable update. If Name is not set, then the
+// well-known Secure Boot variables are tried and the matching name, vendor
+// and attributes are filled in.
+func (v *AuthenticatedVariable) Verify(skipDigests bool) (*pkcs9.TimestampedSignature, error) {
+	sd, err := v.signedData()
+	if err != nil {
+		return nil, err
+	}
+	if skipDigests || v.Name != "" {
+		sig, err := sd.Verify(v.SignedBytes(), skipDigests)
+		if err != nil {
+			return nil, err
+		}
+		return &pkcs9.TimestampedSignature{Signature: sig}, nil
+	}
+	for name, vendor := range KnownVariables {
+		for _, attrs := range []uint32{DefaultAttributes, DefaultAttributes | AppendWrite} {
+			candidate := *v
+			candidate.Name = name
+			candidate.Vendor = vendor
+			candidate.Attributes = attrs
+			sig, err := sd.Verify(candidate.SignedBytes(), false)
+			if err == nil {
+				*v = candidate
+				return &pkcs9.TimestampedSignature{Signature: sig}, nil
+			}
+		}
+	}
+	return nil, errors.New("signature does not match any known Secure Boot variable")
+}
@@ -0,0 +1,97 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package efivar_test
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sassoftware/relic/v7/internal/testcert"
+	"github.com/sassoftware/relic/v7/lib/efivar"
+)
+
+func TestGUID(t *testing.T) {
+	t.Parallel()
+	const s = "8be4df61-93ca-11d2-aa0d-00e098032b8c"
+	g, err := efivar.ParseGUID("{" + s + "}")
+	require.NoError(t, err)
+	assert.Equal(t, efivar.GlobalVariable, g)
+	assert.Equal(t, byte(0x61), g[0])
+	assert.Equal(t, s, g.String())
+	_, err = efivar.ParseGUID("8be4df61-93ca-11d2-aa0d")
+	assert.Error(t, err)
+}
+
+func TestSignatureList(t *testing.T) {
+	t.Parallel()
+	owner := efivar.MustParseGUID("77fa9abd-0359-4d32-bd60-28f4e78f784b")
+	list := &efivar.SignatureList{
+		Type: efivar.CertSHA256,
+		Signatures: []efivar.SignatureData{
+			{Owner: owner, Data: make([]byte, 32)},
+			{Owner: owner, Data: make([]byte, 32)},
+		},
+	}
+	blob, err := list.Bytes()
+	require.NoError(t, err)
+	assert.Len(t, blob, 28+2*48)
+	lists, err := efivar.ParseSignatureLists(append(blob, blob...))
+	require.NoError(t, err)
+	require.Len(t, lists, 2)
+	assert.Equal(t, list.Type, lists[1].Type)
+	assert.Len(t, lists[1].Signatures, 2)
+	_, err = efivar.ParseSignatureLists(blob[:40])
+	assert.Error(t, err)
+}
+
+func TestSignVerify(t *testing.T) {
+	t.Parallel()
+	cert := testcert.Signer(t, &x509.Certificate{Subject: pkix.Name{CommonName: "test KEK"}}, testcert.ECDSAKey(t))
+
+	data, err := efivar.X509SignatureList(efivar.GUID{}, cert.Leaf.Raw).Bytes()
+	require.NoError(t, err)
+	v := &efivar.AuthenticatedVariable{
+		Name:       "db",
+		Vendor:     efivar.ImageSecurityDatabase,
+		Attributes: efivar.DefaultAttributes | efivar.AppendWrite,
+		Time:       time.Date(2024, 5, 6, 7, 8, 9, 10, time.UTC),
+		Data:       data,
+	}
+	_, err = v.Sign(cert)
+	require.NoError(t, err)
+
+	parsed, err := efivar.Parse(v.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, data, parsed.Data)
+	sig, err := parsed.Verify(false)
+	require.NoError(t, err)
+	assert.Equal(t, cert.Leaf, sig.Certificate)
+	assert.Equal(t, "db", parsed.Name)
+	assert.Equal(t, v.Attributes, parsed.Attributes)
+	assert.True(t, v.Time.Truncate(time.Second).Equal(parsed.Time))
+
+	parsed.Data = append([]byte(nil), parsed.Data...)
+	parsed.Data[len(parsed.Data)-1] ^= 1
+	parsed.Name = ""
+	_, err = parsed.Verify(false)
+	assert.Error(t, err)
+}
@@ -0,0 +1,115 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package efivar
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// SignatureList is one EFI_SIGNATURE_LIST, holding signatures of a single type
+type SignatureList struct {
+	Type       GUID
+	Header     []byte
+	Signatures []SignatureData
+}
+
+// SignatureData is one EFI_SIGNATURE_DATA entry
+type SignatureData struct {
+	Owner GUID
+	Data  []byte
+}
+
+type sigListHeader struct {
+	Type          GUID
+	ListSize      uint32
+	HeaderSize    uint32
+	SignatureSize uint32
+}
+
+const sigListHeaderSize = 28
+
+// ParseSignatureLists parses a concatenated series of EFI_SIGNATURE_LIST
+// structures, as found in the KEK, db and dbx variables
+func ParseSignatureLists(blob []byte) ([]*SignatureList, error) {
+	var lists []*SignatureList
+	for len(blob) > 0 {
+		var hdr sigListHeader
+		if len(blob) < sigListHeaderSize {
+			return nil, errors.New("truncated signature list")
+		}
+		_ = binary.Read(bytes.NewReader(blob), binary.LittleEndian, &hdr)
+		if hdr.ListSize < sigListHeaderSize || int64(hdr.ListSize) > int64(len(blob)) {
+			return nil, fmt.Errorf("invalid signature list size %d", hdr.ListSize)
+		}
+		body := blob[sigListHeaderSize:hdr.ListSize]
+		blob = blob[hdr.ListSize:]
+		if int64(hdr.HeaderSize) > int64(len(body)) {
+			return nil, errors.New("invalid signature list header size")
+		}
+		list := &SignatureList{Type: hdr.Type, Header: body[:hdr.HeaderSize]}
+		body = body[hdr.HeaderSize:]
+		if hdr.SignatureSize < 16 || len(body)%int(hdr.SignatureSize) != 0 {
+			return nil, fmt.Errorf("invalid signature size %d", hdr.SignatureSize)
+		}
+		for len(body) > 0 {
+			owner, _ := guidFromBytes(body)
+			list.Signatures = append(list.Signatures, SignatureData{
+				Owner: owner,
+				Data:  body[16:hdr.SignatureSize],
+			})
+			body = body[hdr.SignatureSize:]
+		}
+		lists = append(lists, list)
+	}
+	return lists, nil
+}
+
+// Bytes marshals the signature list. All entries must have the same size.
+func (l *SignatureList) Bytes() ([]byte, error) {
+	if len(l.Signatures) == 0 {
+		return nil, errors.New("signature list is empty")
+	}
+	sigSize := 16 + len(l.Signatures[0].Data)
+	hdr := sigListHeader{
+		Type:          l.Type,
+		ListSize:      uint32(sigListHeaderSize + len(l.Header) + sigSize*len(l.Signatures)),
+		HeaderSize:    uint32(len(l.Header)),
+		SignatureSize: uint32(sigSize),
+	}
+	var b bytes.Buffer
+	_ = binary.Write(&b, binary.LittleEndian, hdr)
+	b.Write(l.Header)
+	for _, sig := range l.Signatures {
+		if 16+len(sig.Data) != sigSize {
+			return nil, errors.New("signature list entries must all be the same size")
+		}
+		b.Write(sig.Owner[:])
+		b.Write(sig.Data)
+	}
+	return b.Bytes(), nil
+}
+
+// X509SignatureList returns a signature list holding a single DER certificate
+func X509SignatureList(owner GUID, der []byte) *SignatureList {
+	return &SignatureList{
+		Type:       CertX509,
+		Signatures: []SignatureData{{Owner: owner, Data: der}},
+	}
+}
@@ -0,0 +1,445 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package fdt reads and writes flattened device tree (DTB) blobs, as used by
+// U-Boot FIT images.
+package fdt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	Magic = 0xd00dfeed
+
+	tokenBeginNode = 1
+	tokenEndNode   = 2
+	tokenProp      = 3
+	tokenNop       = 4
+	tokenEnd       = 9
+
+	headerSize     = 40
+	version        = 17
+	lastCompatible = 16
+	maxDepth       = 64
+)
+
+type header struct {
+	Magic           uint32
+	TotalSize       uint32
+	OffStruct       uint32
+	OffStrings      uint32
+	OffMemRsvmap    uint32
+	Version         uint32
+	LastCompVersion uint32
+	BootCPUIDPhys   uint32
+	SizeStrings     uint32
+	SizeStruct      uint32
+}
+
+// Tree is a parsed device tree
+type Tree struct {
+	Root *Node
+	// TotalSize of the blob that was parsed, which may include padding
+	TotalSize int
+
+	bootCPU uint32
+	rsvmap  []byte
+	strings []byte
+}
+
+type Node struct {
+	Name     string
+	Props    []*Prop
+	Children []*Node
+}
+
+type Prop struct {
+	Name  string
+	Value []byte
+}
+
+// Parse a device tree blob. Trailing data beyond the tree's total size is
+// ignored.
+func Parse(blob []byte) (*Tree, error) {
+	var hdr header
+	if len(blob) < headerSize {
+		return nil, errors.New("fdt: truncated header")
+	}
+	if err := binary.Read(bytes.NewReader(blob), binary.BigEndian, &hdr); err != nil {
+		return nil, err
+	}
+	if hdr.Magic != Magic {
+		return nil, errors.New("fdt: bad magic")
+	} else if hdr.LastCompVersion > version {
+		return nil, fmt.Errorf("fdt: unsupported version %d", hdr.Version)
+	} else if int64(hdr.TotalSize) > int64(len(blob)) {
+		return nil, errors.New("fdt: truncated blob")
+	}
+	blob = blob[:hdr.TotalSize]
+	structBlock, err := section(blob, hdr.OffStruct, hdr.SizeStruct)
+	if err != nil {
+		return nil, err
+	}
+	stringsBlock, err := section(blob, hdr.OffStrings, hdr.SizeStrings)
+	if err != nil {
+		return nil, err
+	}
+	// the reservation map is terminated by an all-zero entry
+	var rsvmap []byte
+	for off := int(hdr.OffMemRsvmap); ; off += 16 {
+		if off+16 > len(blob) {
+			return nil, errors.New("fdt: truncated memory reservation map")
+		}
+		entry := blob[off : off+16]
+		rsvmap = append(rsvmap, entry...)
+		if bytes.Equal(entry, make([]byte, 16)) {
+			break
+		}
+	}
+	t := &Tree{
+		TotalSize: int(hdr.TotalSize),
+		bootCPU:   hdr.BootCPUIDPhys,
+		rsvmap:    rsvmap,
+		strings:   append([]byte(nil), stringsBlock...),
+	}
+	p := &parser{data: structBlock, strings: stringsBlock}
+	tok, err := p.token()
+	if err != nil {
+		return nil, err
+	} else if tok != tokenBeginNode {
+		return nil, errors.New("fdt: structure block does not start with a node")
+	}
+	t.Root, err = p.node(0)
+	if err != nil {
+		return nil, err
+	}
+	if tok, err := p.token(); err != nil {
+		return nil, err
+	} else if tok != tokenEnd {
+		return nil, errors.New("fdt: data after root node")
+	}
+	return t, nil
+}
+
+func section(blob []byte, off, size uint32) ([]byte, error) {
+	end := int64(off) + int64(size)
+	if end > int64(len(blob)) {
+		return nil, errors.New("fdt: section extends past end of blob")
+	}
+	return blob[off:end], nil
+}
+
+type parser struct {
+	data, strings []byte
+	pos           int
+}
+
+func (p *parser) u32() (uint32, error) {
+	if p.pos+4 > len(p.data) {
+		return 0, errors.New("fdt: truncated structure block")
+	}
+	v := binary.BigEndian.Uint32(p.data[p.pos:])
+	p.pos += 4
+	return v, nil
+}
+
+// return the next token, skipping NOPs
+func (p *parser) token() (uint32, error) {
+	for {
+		tok, err := p.u32()
+		if err != nil || tok != tokenNop {
+			return tok, err
+		}
+	}
+}
+
+func (p *parser) align() {
+	p.pos = (p.pos + 3) &^ 3
+}
+
+func (p *parser) node(depth int) (*Node, error) {
+	if depth > maxDepth {
+		return nil, errors.New("fdt: tree is too deep")
+	}
+	end := bytes.IndexByte(p.data[p.pos:], 0)
+	if end < 0 {
+		return nil, errors.New("fdt: unterminated node name")
+	}
+	node := &Node{Name: string(p.data[p.pos : p.pos+end])}
+	p.pos += end + 1
+	p.align()
+	for {
+		tok, err := p.token()
+		if err != nil {
+			return nil, err
+		}
+		switch tok {
+		case tokenProp:
+			size, err := p.u32()
+			if err != nil {
+				return nil, err
+			}
+			nameoff, err := p.u32()
+			if err != nil {
+				return nil, err
+			}
+			if int64(p.pos)+int64(size) > int64(len(p.data)) {
+				return nil, errors.New("fdt: truncated property")
+			}
+			if int(nameoff) >= len(p.strings) {
+				return nil, errors.New("fdt: property name out of bounds")
+			}
+			name := p.strings[nameoff:]
+			if i := bytes.IndexByte(name, 0); i >= 0 {
+				name = name[:i]
+			} else {
+				return nil, errors.New("fdt: unterminated property name")
+			}
+			value := append([]byte(nil), p.data[p.pos:p.pos+int(size)]...)
+			p.pos += int(size)
+			p.align()
+			node.Props = append(node.Props, &Prop{Name: string(name), Value: value})
+		case tokenBeginNode:
+			child, err := p.node(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			node.Children = append(node.Children, child)
+		case tokenEndNode:
+			return node, nil
+		default:
+			return nil, fmt.Errorf("fdt: unexpected token %d", tok)
+		}
+	}
+}
+
+// Marshal the tree into a blob
+func (t *Tree) Marshal() []byte {
+	strtab := t.StringTable()
+	var structBlock bytes.Buffer
+	t.writeNode(&structBlock, strtab, t.Root)
+	putU32(&structBlock, tokenEnd)
+	rsvmap := t.rsvmap
+	if len(rsvmap) == 0 {
+		rsvmap = make([]byte, 16)
+	}
+	offRsvmap := headerSize + 8 - headerSize%8
+	offStruct := offRsvmap + len(rsvmap)
+	offStrings := offStruct + structBlock.Len()
+	total := offStrings + len(strtab)
+	hdr := header{
+		Magic:           Magic,
+		TotalSize:       uint32(total),
+		OffStruct:       uint32(offStruct),
+		OffStrings:      uint32(offStrings),
+		OffMemRsvmap:    uint32(offRsvmap),
+		Version:         version,
+		LastCompVersion: lastCompatible,
+		BootCPUIDPhys:   t.bootCPU,
+		SizeStrings:     uint32(len(strtab)),
+		SizeStruct:      uint32(structBlock.Len()),
+	}
+	var buf bytes.Buffer
+	buf.Grow(total)
+	_ = binary.Write(&buf, binary.BigEndian, hdr)
+	buf.Write(make([]byte, offRsvmap-headerSize))
+	buf.Write(rsvmap)
+	buf.Write(structBlock.Bytes())
+	buf.Write(strtab)
+	return buf.Bytes()
+}
+
+// StringTable returns the strings block that Marshal will write. The
+// original table is kept as-is and names of new properties are appended.
+func (t *Tree) StringTable() []byte {
+	strtab := t.strings
+	var walk func(*Node)
+	walk = func(node *Node) {
+		for _, prop := range node.Props {
+			if findString(strtab, prop.Name) < 0 {
+				strtab = append(strtab[:len(strtab):len(strtab)], prop.Name...)
+				strtab = append(strtab, 0)
+			}
+		}
+		for _, child := range node.Children {
+			walk(child)
+		}
+	}
+	walk(t.Root)
+	return strtab
+}
+
+// find a NUL-terminated string anywhere in the table, including as the
+// suffix of another string, like libfdt does
+func findString(strtab []byte, name string) int {
+	return bytes.Index(strtab, append([]byte(name), 0))
+}
+
+func (t *Tree) writeNode(w *bytes.Buffer, strtab []byte, node *Node) {
+	writeBegin(w, node)
+	for _, prop := range node.Props {
+		writeProp(w, strtab, prop)
+	}
+	for _, child := range node.Children {
+		t.writeNode(w, strtab, child)
+	}
+	putU32(w, tokenEndNode)
+}
+
+func writeBegin(w *bytes.Buffer, node *Node) {
+	putU32(w, tokenBeginNode)
+	w.WriteString(node.Name)
+	w.WriteByte(0)
+	pad(w)
+}
+
+func writeProp(w *bytes.Buffer, strtab []byte, prop *Prop) {
+	putU32(w, tokenProp)
+	putU32(w, uint32(len(prop.Value)))
+	putU32(w, uint32(findString(strtab, prop.Name)))
+	w.Write(prop.Value)
+	pad(w)
+}
+
+func joinPath(parent, name string) string {
+	switch parent {
+	case "":
+		return "/"
+	case "/":
+		return "/" + name
+	default:
+		return parent + "/" + name
+	}
+}
+
+func putU32(w *bytes.Buffer, v uint32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	w.Write(b[:])
+}
+
+func pad(w *bytes.Buffer) {
+	for w.Len()%4 != 0 {
+		w.WriteByte(0)
+	}
+}
+
+// Lookup returns the node at the given absolute path, or nil
+func (t *Tree) Lookup(path string) *Node {
+	node := t.Root
+	for _, name := range strings.Split(strings.Trim(path, "/"), "/") {
+		if name == "" {
+			continue
+		}
+		node = node.Child(name)
+		if node == nil {
+			return nil
+		}
+	}
+	return node
+}
+
+// Child returns the named child node, or nil
+func (n *Node) Child(name string) *Node {
+	for _, child := range n.Children {
+		if child.Name == name {
+			return child
+		}
+	}
+	return nil
+}
+
+// AddChild appends a new, empty child node
+func (n *Node) AddChild(name string) *Node {
+	child := &Node{Name: name}
+	n.Children = append(n.Children, child)
+	return child
+}
+
+// Prop returns the named property, or nil
+func (n *Node) Prop(name string) *Prop {
+	for _, prop := range n.Props {
+		if prop.Name == name {
+			return prop
+		}
+	}
+	return nil
+}
+
+// Set a property, replacing its value if it already exists
+func (n *Node) Set(name string, value []byte) {
+	if prop := n.Prop(name); prop != nil {
+		prop.Value = value
+		return
+	}
+	n.Props = append(n.Props, &Prop{Name: name, Value: value})
+}
+
+// SetString sets a property to a NUL-terminated string
+func (n *Node) SetString(name, value string) {
+	n.Set(name, append([]byte(value), 0))
+}
+
+// SetStrings sets a property to a list of NUL-terminated strings
+func (n *Node) SetStrings(name string, values []string) {
+	var v []byte
+	for _, s := range values {
+		v = append(v, s...)
+		v = append(v, 0)
+	}
+	n.Set(name, v)
+}
+
+// SetU32 sets a property to a list of big-endian 32-bit cells
+func (n *Node) SetU32(name string, values ...uint32) {
+	v := make([]byte, 4*len(values))
+	for i, x := range values {
+		binary.BigEndian.PutUint32(v[4*i:], x)
+	}
+	n.Set(name, v)
+}
+
+// String returns the first string in the named property
+func (n *Node) String(name string) string {
+	strs := n.Strings(name)
+	if len(strs) == 0 {
+		return ""
+	}
+	return strs[0]
+}
+
+// Strings returns the list of strings in the named property
+func (n *Node) Strings(name string) []string {
+	prop := n.Prop(name)
+	if prop == nil || len(prop.Value) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(string(prop.Value), "\x00"), "\x00")
+}
+
+// U32 returns the first cell of the named property
+func (n *Node) U32(name string) (uint32, bool) {
+	prop := n.Prop(name)
+	if prop == nil || len(prop.Value) < 4 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint32(prop.Value), true
+}
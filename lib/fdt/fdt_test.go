@@ -0,0 +1,110 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package fdt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testTree() *Tree {
+	root := &Node{}
+	root.SetString("description", "test")
+	root.SetU32("#address-cells", 1)
+	images := root.AddChild("images")
+	kernel := images.AddChild("kernel-1")
+	kernel.Set("data", []byte("hello"))
+	kernel.SetU32("data-size", 5)
+	hash := kernel.AddChild("hash-1")
+	hash.SetString("algo", "sha256")
+	configs := root.AddChild("configurations")
+	conf := configs.AddChild("conf-1")
+	conf.SetStrings("compatible", []string{"a,b", "c"})
+	return &Tree{Root: root}
+}
+
+func TestRoundTrip(t *testing.T) {
+	blob := testTree().Marshal()
+	assert.Equal(t, uint32(Magic), binary.BigEndian.Uint32(blob))
+	assert.Equal(t, uint32(len(blob)), binary.BigEndian.Uint32(blob[4:]))
+	tree, err := Parse(append(blob, "trailing"...))
+	require.NoError(t, err)
+	assert.Equal(t, len(blob), tree.TotalSize)
+	assert.Equal(t, "test", tree.Root.String("description"))
+	conf := tree.Lookup("/configurations/conf-1")
+	require.NotNil(t, conf)
+	assert.Equal(t, []string{"a,b", "c"}, conf.Strings("compatible"))
+	kernel := tree.Lookup("/images/kernel-1")
+	require.NotNil(t, kernel)
+	size, ok := kernel.U32("data-size")
+	assert.True(t, ok)
+	assert.Equal(t, uint32(5), size)
+	assert.Nil(t, tree.Lookup("/images/missing"))
+	assert.Equal(t, blob, tree.Marshal())
+}
+
+func TestStringTable(t *testing.T) {
+	tree, err := Parse(testTree().Marshal())
+	require.NoError(t, err)
+	orig := tree.StringTable()
+	// a suffix of an existing name is reused
+	tree.Root.SetString("size", "x")
+	assert.Equal(t, orig, tree.StringTable())
+	tree.Root.SetString("new-prop", "x")
+	strtab := tree.StringTable()
+	assert.Equal(t, orig, strtab[:len(orig)])
+	assert.Equal(t, "new-prop\x00", string(strtab[len(orig):]))
+}
+
+func TestParseInvalid(t *testing.T) {
+	blob := testTree().Marshal()
+	_, err := Parse(blob[:20])
+	assert.Error(t, err)
+	bad := append([]byte(nil), blob...)
+	bad[0] = 0
+	_, err = Parse(bad)
+	assert.Error(t, err)
+	_, err = Parse(blob[:len(blob)-4])
+	assert.Error(t, err)
+}
+
+func TestRegions(t *testing.T) {
+	tree := testTree()
+	blob := tree.Marshal()
+	structOff := binary.BigEndian.Uint32(blob[8:])
+	structSize := binary.BigEndian.Uint32(blob[36:])
+	// including every node yields the whole struct block
+	all := tree.Regions([]string{"/", "/images", "/images/kernel-1", "/images/kernel-1/hash-1", "/configurations", "/configurations/conf-1"}, nil)
+	assert.Equal(t, blob[structOff:structOff+structSize], all)
+	// direct children of an included node keep only their structure, and
+	// excluded properties are left out
+	regions := tree.Regions([]string{"/", "/images/kernel-1"}, []string{"data"})
+	root := &Node{Props: tree.Root.Props}
+	images := root.AddChild("images")
+	kernel := images.AddChild("kernel-1")
+	kernel.Props = []*Prop{tree.Lookup("/images/kernel-1").Prop("data-size")}
+	kernel.AddChild("hash-1")
+	root.AddChild("configurations")
+	var want bytes.Buffer
+	tree.writeNode(&want, tree.StringTable(), root)
+	putU32(&want, tokenEnd)
+	assert.Equal(t, want.Bytes(), regions)
+}
@@ -0,0 +1,69 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package fdt
+
+import (
+	"bytes"
+)
+
+// Regions returns the parts of the marshalled structure block that are
+// covered by a U-Boot FIT configuration signature, concatenated, in the same
+// way as libfdt's fdt_find_regions(). Nodes whose
+// paths are listed in include are covered along with their properties,
+// except those named in excludeProps. Their direct children contribute only
+// their names and structure, and the begin and end of each node above an
+// included node are covered so the paths can't be rearranged.
+func (t *Tree) Regions(include, excludeProps []string) []byte {
+	incSet := make(map[string]bool, len(include))
+	for _, path := range include {
+		incSet[path] = true
+	}
+	exclude := make(map[string]bool, len(excludeProps))
+	for _, name := range excludeProps {
+		exclude[name] = true
+	}
+	strtab := t.StringTable()
+	var buf bytes.Buffer
+	var walk func(node *Node, parent string, want int)
+	walk = func(node *Node, parent string, want int) {
+		path := joinPath(parent, node.Name)
+		if incSet[path] {
+			want = 2
+		} else if want > 0 {
+			want--
+		}
+		if want > 0 {
+			writeBegin(&buf, node)
+		}
+		if want >= 2 {
+			for _, prop := range node.Props {
+				if !exclude[prop.Name] {
+					writeProp(&buf, strtab, prop)
+				}
+			}
+		}
+		for _, child := range node.Children {
+			walk(child, path, want)
+		}
+		if want > 0 {
+			putU32(&buf, tokenEndNode)
+		}
+	}
+	walk(t.Root, "", 0)
+	putU32(&buf, tokenEnd)
+	return buf.Bytes()
+}
@@ -0,0 +1,264 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package fit signs and verifies U-Boot FIT (flattened image tree) images, in
+// the same way as "mkimage -k" and U-Boot's verified boot.
+package fit
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/md5"
+	"crypto/rsa"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math/big"
+	"strings"
+
+	"github.com/sassoftware/relic/v7/lib/fdt"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+)
+
+const (
+	imagesPath  = "/images"
+	configsPath = "/configurations"
+)
+
+// properties that hold image data, which configuration signatures cover
+// through the images' hashes instead
+var dataProps = []string{"data", "data-size", "data-position", "data-offset"}
+
+// image types that a configuration signature covers by default
+var defaultSignImages = []string{"kernel", "fdt", "ramdisk", "fpga", "loadables", "firmware", "setup", "standalone"}
+
+var hashNames = map[string]crypto.Hash{
+	"sha1":   crypto.SHA1,
+	"sha256": crypto.SHA256,
+	"sha384": crypto.SHA384,
+	"sha512": crypto.SHA512,
+}
+
+// Image is a parsed FIT image, including any data stored after the tree
+type Image struct {
+	Tree *fdt.Tree
+	blob []byte
+}
+
+func Parse(blob []byte) (*Image, error) {
+	tree, err := fdt.Parse(blob)
+	if err != nil {
+		return nil, err
+	}
+	if tree.Lookup(imagesPath) == nil {
+		return nil, errors.New("fit: missing /images node")
+	}
+	return &Image{Tree: tree, blob: blob}, nil
+}
+
+// externalBase is where data stored outside the tree begins
+func (i *Image) externalBase() int {
+	return (i.Tree.TotalSize + 3) &^ 3
+}
+
+// return the contents of an image, which is either in its data property or
+// stored after the tree
+func (i *Image) imageData(node *fdt.Node) ([]byte, error) {
+	if prop := node.Prop("data"); prop != nil {
+		return prop.Value, nil
+	}
+	size, ok := node.U32("data-size")
+	if !ok {
+		return nil, fmt.Errorf("fit: image %s has no data", node.Name)
+	}
+	var start int64
+	if off, ok := node.U32("data-offset"); ok {
+		start = int64(i.externalBase()) + int64(off)
+	} else if pos, ok := node.U32("data-position"); ok {
+		start = int64(pos)
+	} else {
+		return nil, fmt.Errorf("fit: image %s has no data", node.Name)
+	}
+	if start+int64(size) > int64(len(i.blob)) {
+		return nil, fmt.Errorf("fit: data for image %s extends past end of file", node.Name)
+	}
+	return i.blob[start : start+int64(size)], nil
+}
+
+// compute the value of an image hash node
+func hashValue(algo string, data []byte) ([]byte, error) {
+	switch algo {
+	case "crc32":
+		var v [4]byte
+		binary.BigEndian.PutUint32(v[:], crc32.ChecksumIEEE(data))
+		return v[:], nil
+	case "md5":
+		d := md5.Sum(data)
+		return d[:], nil
+	case "sha1":
+		d := sha1.Sum(data)
+		return d[:], nil
+	}
+	hash := hashNames[algo]
+	if hash == 0 {
+		return nil, fmt.Errorf("fit: unsupported hash algorithm %q", algo)
+	}
+	d := hash.New()
+	d.Write(data)
+	return d.Sum(nil), nil
+}
+
+// cryptoName returns the U-Boot name for the key type, e.g. rsa2048
+func cryptoName(pub crypto.PublicKey) (string, error) {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		switch bits := k.N.BitLen(); bits {
+		case 2048, 3072, 4096:
+			return fmt.Sprintf("rsa%d", bits), nil
+		default:
+			return "", fmt.Errorf("fit: unsupported RSA key size %d", bits)
+		}
+	case *ecdsa.PublicKey:
+		switch bits := k.Curve.Params().BitSize; bits {
+		case 256, 384:
+			return fmt.Sprintf("ecdsa%d", bits), nil
+		default:
+			return "", fmt.Errorf("fit: unsupported ECDSA curve %s", k.Curve.Params().Name)
+		}
+	default:
+		return "", fmt.Errorf("fit: unsupported key type %T", pub)
+	}
+}
+
+// split an algo property like "sha256,rsa2048"
+func parseAlgo(algo string) (crypto.Hash, string, error) {
+	hashName, cryptoName, ok := strings.Cut(algo, ",")
+	hash := hashNames[hashName]
+	if !ok || hash == 0 {
+		return 0, "", fmt.Errorf("fit: unsupported signature algorithm %q", algo)
+	}
+	return hash, cryptoName, nil
+}
+
+func hashName(hash crypto.Hash) string {
+	for name, h := range hashNames {
+		if h == hash {
+			return name
+		}
+	}
+	return ""
+}
+
+// ECDSA signatures are stored as r and s, each padded to the size of the
+// curve
+func packECDSA(pub *ecdsa.PublicKey, der []byte) ([]byte, error) {
+	sig, err := x509tools.UnmarshalEcdsaSignature(der)
+	if err != nil {
+		return nil, err
+	}
+	size := (pub.Curve.Params().BitSize + 7) / 8
+	packed := make([]byte, 2*size)
+	sig.R.FillBytes(packed[:size])
+	sig.S.FillBytes(packed[size:])
+	return packed, nil
+}
+
+func verifyValue(pub crypto.PublicKey, hash crypto.Hash, pss bool, digest, value []byte) error {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		if pss {
+			return rsa.VerifyPSS(k, hash, digest, value, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto})
+		}
+		return rsa.VerifyPKCS1v15(k, hash, digest, value)
+	case *ecdsa.PublicKey:
+		if len(value)%2 != 0 {
+			return errors.New("fit: invalid ECDSA signature")
+		}
+		r := new(big.Int).SetBytes(value[:len(value)/2])
+		s := new(big.Int).SetBytes(value[len(value)/2:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return errors.New("fit: ECDSA signature verification failed")
+		}
+		return nil
+	default:
+		return fmt.Errorf("fit: unsupported key type %T", pub)
+	}
+}
+
+// return the subnodes whose names start with prefix, e.g. hash or signature
+func subnodes(node *fdt.Node, prefix string) []*fdt.Node {
+	var nodes []*fdt.Node
+	for _, child := range node.Children {
+		if strings.HasPrefix(child.Name, prefix) {
+			nodes = append(nodes, child)
+		}
+	}
+	return nodes
+}
+
+// hashedNodes returns the paths covered by a configuration signature: the
+// configuration itself, and each image it names in sign-images along with
+// the image's hashes
+func (i *Image) hashedNodes(conf, sig *fdt.Node) ([]string, error) {
+	paths := []string{"/", configsPath, configsPath + "/" + conf.Name}
+	images := i.Tree.Lookup(imagesPath)
+	signImages := sig.Strings("sign-images")
+	if len(signImages) == 0 {
+		return nil, fmt.Errorf("fit: signature %s of configuration %s has no sign-images", sig.Name, conf.Name)
+	}
+	for _, prop := range signImages {
+		names := conf.Strings(prop)
+		if len(names) == 0 {
+			return nil, fmt.Errorf("fit: configuration %s has no %s image to sign", conf.Name, prop)
+		}
+		for _, name := range names {
+			image := images.Child(name)
+			if image == nil {
+				return nil, fmt.Errorf("fit: configuration %s refers to missing image %s", conf.Name, name)
+			}
+			path := imagesPath + "/" + name
+			paths = append(paths, path)
+			hashes := 0
+			for _, child := range image.Children {
+				if strings.HasPrefix(child.Name, "hash") {
+					hashes++
+					paths = append(paths, path+"/"+child.Name)
+				} else if strings.HasPrefix(child.Name, "cipher") {
+					paths = append(paths, path+"/"+child.Name)
+				}
+			}
+			if hashes == 0 {
+				return nil, fmt.Errorf("fit: image %s has no hash node, so configuration %s can't cover it", name, conf.Name)
+			}
+		}
+	}
+	return paths, nil
+}
+
+// configDigest hashes the regions of the tree covered by a configuration
+// signature, with the first strLen bytes of the string table
+func (i *Image) configDigest(hash crypto.Hash, hashedNodes []string, strLen int) ([]byte, error) {
+	strtab := i.Tree.StringTable()
+	if strLen > len(strtab) {
+		return nil, errors.New("fit: hashed-strings is larger than the string table")
+	}
+	d := hash.New()
+	d.Write(i.Tree.Regions(hashedNodes, dataProps))
+	d.Write(strtab[:strLen])
+	return d.Sum(nil), nil
+}
@@ -0,0 +1,165 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package fit
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sassoftware/relic/v7/lib/fdt"
+)
+
+// build a FIT with an embedded kernel and an external device tree
+func testImage(t *testing.T) []byte {
+	root := &fdt.Node{}
+	root.SetString("description", "test image")
+	images := root.AddChild("images")
+	kernel := images.AddChild("kernel-1")
+	kernel.SetString("type", "kernel")
+	kernel.Set("data", []byte("kernel contents"))
+	hash := kernel.AddChild("hash-1")
+	hash.SetString("algo", "crc32")
+	dtb := images.AddChild("fdt-1")
+	dtb.SetString("type", "flat_dt")
+	dtb.SetU32("data-offset", 0)
+	dtb.SetU32("data-size", 12)
+	configs := root.AddChild("configurations")
+	configs.SetString("default", "conf-1")
+	conf := configs.AddChild("conf-1")
+	conf.SetString("kernel", "kernel-1")
+	conf.SetString("fdt", "fdt-1")
+	blob := (&fdt.Tree{Root: root}).Marshal()
+	for len(blob)%4 != 0 {
+		blob = append(blob, 0)
+	}
+	return append(blob, "dtb contents"...)
+}
+
+func signImage(t *testing.T, blob []byte, key crypto.Signer, opts SignOptions) []byte {
+	img, err := Parse(blob)
+	require.NoError(t, err)
+	tree, signed, err := img.Sign(key, opts)
+	require.NoError(t, err)
+	require.NotEmpty(t, signed)
+	return append(tree, blob[img.DataOffset():]...)
+}
+
+func TestSignRSA(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	now := time.Unix(1700000000, 0)
+	signed := signImage(t, testImage(t), key, SignOptions{KeyName: "dev", Time: now, PSS: true})
+	img, err := Parse(signed)
+	require.NoError(t, err)
+	require.NoError(t, img.CheckHashes())
+	sig := img.Tree.Lookup("/configurations/conf-1/signature-dev")
+	require.NotNil(t, sig)
+	assert.Equal(t, "sha256,rsa2048", sig.String("algo"))
+	assert.Equal(t, "pss", sig.String("padding"))
+	assert.Equal(t, []string{"kernel", "fdt"}, sig.Strings("sign-images"))
+	assert.Equal(t, []string{"/", "/configurations", "/configurations/conf-1",
+		"/images/kernel-1", "/images/kernel-1/hash-1",
+		"/images/fdt-1", "/images/fdt-1/hash-1"}, sig.Strings("hashed-nodes"))
+	sigs, err := img.Verify([]crypto.PublicKey{key.Public()})
+	require.NoError(t, err)
+	require.Len(t, sigs, 1)
+	assert.Equal(t, "/configurations/conf-1/signature-dev", sigs[0].Path)
+	assert.Equal(t, now, sigs[0].Timestamp)
+	// re-signing replaces the existing signature
+	resigned := signImage(t, signed, key, SignOptions{KeyName: "dev", Time: now})
+	img, err = Parse(resigned)
+	require.NoError(t, err)
+	sigs, err = img.Verify([]crypto.PublicKey{key.Public()})
+	require.NoError(t, err)
+	assert.Len(t, sigs, 1)
+	// untrusted key
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	_, err = img.Verify([]crypto.PublicKey{other.Public()})
+	assert.Error(t, err)
+}
+
+func TestSignECDSA(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+	// an existing image signature node selects the algorithm
+	img, err := Parse(testImage(t))
+	require.NoError(t, err)
+	kernelSig := img.Tree.Lookup("/images/kernel-1").AddChild("signature-1")
+	kernelSig.SetString("algo", "sha384,ecdsa384")
+	kernelSig.SetString("key-name-hint", "dev")
+	blob := img.Tree.Marshal()
+	for len(blob)%4 != 0 {
+		blob = append(blob, 0)
+	}
+	blob = append(blob, "dtb contents"...)
+	signed := signImage(t, blob, key, SignOptions{KeyName: "dev", Time: time.Now()})
+	img, err = Parse(signed)
+	require.NoError(t, err)
+	assert.Nil(t, img.Tree.Lookup("/configurations/conf-1/signature-dev"))
+	value := img.Tree.Lookup("/images/kernel-1/signature-1").Prop("value")
+	require.NotNil(t, value)
+	assert.Len(t, value.Value, 96)
+	sigs, err := img.Verify([]crypto.PublicKey{key.Public()})
+	require.NoError(t, err)
+	require.Len(t, sigs, 1)
+	assert.Equal(t, crypto.SHA384, sigs[0].Hash)
+	// mismatched key type
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	img, err = Parse(blob)
+	require.NoError(t, err)
+	_, _, err = img.Sign(rsaKey, SignOptions{KeyName: "dev"})
+	assert.Error(t, err)
+}
+
+func TestTamper(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signed := signImage(t, testImage(t), key, SignOptions{KeyName: "dev", Time: time.Now()})
+	keys := []crypto.PublicKey{key.Public()}
+	// external data is covered by its hash
+	modified := append([]byte(nil), signed...)
+	modified[len(modified)-1] ^= 1
+	img, err := Parse(modified)
+	require.NoError(t, err)
+	assert.Error(t, img.CheckHashes())
+	// configuration properties are covered by the signature
+	img, err = Parse(signed)
+	require.NoError(t, err)
+	img.Tree.Lookup("/configurations/conf-1").SetString("description", "changed")
+	img, err = Parse(img.Tree.Marshal())
+	require.NoError(t, err)
+	_, err = img.Verify(keys)
+	assert.Error(t, err)
+	// changing an image's hash breaks the signature
+	img, err = Parse(signed)
+	require.NoError(t, err)
+	img.Tree.Lookup("/images/kernel-1/hash-1").Set("value", []byte{1, 2, 3, 4})
+	img, err = Parse(img.Tree.Marshal())
+	require.NoError(t, err)
+	_, err = img.Verify(keys)
+	assert.Error(t, err)
+}
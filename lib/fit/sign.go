@@ -0,0 +1,299 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package fit
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sassoftware/relic/v7/config"
+	"github.com/sassoftware/relic/v7/lib/fdt"
+)
+
+// SignOptions control how signature nodes are created and filled in
+type SignOptions struct {
+	// KeyName selects signature nodes by their key-name-hint, and is used
+	// to name new ones
+	KeyName string
+	// Hash is the digest algorithm for new signature nodes. Existing nodes
+	// keep the one in their algo property.
+	Hash crypto.Hash
+	// PSS selects RSASSA-PSS padding for new signature nodes
+	PSS bool
+	// Time is stored in each signature's timestamp
+	Time time.Time
+}
+
+// Signed describes one signature that was written to the tree
+type Signed struct {
+	Path string
+	Algo string
+}
+
+// Sign every signature node in the tree whose key-name-hint matches the key.
+// If there are none, a signature is added to each configuration covering
+// all of its images. Returns the new tree blob, which replaces the first
+// DataOffset() bytes of the original file.
+func (i *Image) Sign(signer crypto.Signer, opts SignOptions) ([]byte, []Signed, error) {
+	if opts.KeyName == "" {
+		return nil, nil, errors.New("fit: a key name is required")
+	}
+	keyCrypto, err := cryptoName(signer.Public())
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := i.checkExternal(); err != nil {
+		return nil, nil, err
+	}
+	imageSigs, confSigs := i.signatures(opts.KeyName)
+	if len(imageSigs) == 0 && len(confSigs) == 0 {
+		confSigs, err = i.addConfigSignatures(opts)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	// fill in every property before computing anything, so that the
+	// string table doesn't change after the configurations are hashed
+	var signed []Signed
+	hashes := make(map[*fdt.Node]crypto.Hash)
+	for _, sig := range append(imageSigs, confSigs...) {
+		hash, err := i.prepareSignature(sig.node, keyCrypto, opts)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", sig.path, err)
+		}
+		hashes[sig.node] = hash
+		signed = append(signed, Signed{Path: sig.path, Algo: sig.node.String("algo")})
+	}
+	for _, sig := range confSigs {
+		nodes, err := i.hashedNodes(sig.parent, sig.node)
+		if err != nil {
+			return nil, nil, err
+		}
+		sig.node.SetStrings("hashed-nodes", nodes)
+		sig.node.SetU32("hashed-strings", 0, 0)
+	}
+	if err := i.updateHashes(); err != nil {
+		return nil, nil, err
+	}
+	for _, sig := range imageSigs {
+		data, err := i.imageData(sig.parent)
+		if err != nil {
+			return nil, nil, err
+		}
+		d := hashes[sig.node].New()
+		d.Write(data)
+		if err := signValue(signer, sig.node, hashes[sig.node], d.Sum(nil)); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", sig.path, err)
+		}
+	}
+	strLen := len(i.Tree.StringTable())
+	for _, sig := range confSigs {
+		sig.node.SetU32("hashed-strings", 0, uint32(strLen))
+	}
+	for _, sig := range confSigs {
+		digest, err := i.configDigest(hashes[sig.node], sig.node.Strings("hashed-nodes"), strLen)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := signValue(signer, sig.node, hashes[sig.node], digest); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", sig.path, err)
+		}
+	}
+	blob := i.Tree.Marshal()
+	for len(blob)%4 != 0 {
+		blob = append(blob, 0)
+	}
+	return blob, signed, nil
+}
+
+// DataOffset returns the size of the original tree, including the padding
+// before any external data
+func (i *Image) DataOffset() int {
+	if base := i.externalBase(); base < len(i.blob) {
+		return base
+	}
+	return len(i.blob)
+}
+
+// data-position holds an absolute offset that would be invalidated by
+// resizing the tree
+func (i *Image) checkExternal() error {
+	for _, image := range i.Tree.Lookup(imagesPath).Children {
+		if image.Prop("data-position") != nil {
+			return fmt.Errorf("fit: image %s uses data-position, which is not supported for signing", image.Name)
+		}
+	}
+	return nil
+}
+
+type sigNode struct {
+	path   string
+	parent *fdt.Node
+	node   *fdt.Node
+}
+
+// find signature nodes under images and configurations with a matching key
+// name, or all of them if keyName is empty
+func (i *Image) signatures(keyName string) (imageSigs, confSigs []sigNode) {
+	find := func(base string) []sigNode {
+		var found []sigNode
+		parent := i.Tree.Lookup(base)
+		if parent == nil {
+			return nil
+		}
+		for _, child := range parent.Children {
+			for _, sig := range subnodes(child, "signature") {
+				if keyName == "" || sig.String("key-name-hint") == keyName {
+					found = append(found, sigNode{
+						path:   base + "/" + child.Name + "/" + sig.Name,
+						parent: child,
+						node:   sig,
+					})
+				}
+			}
+		}
+		return found
+	}
+	return find(imagesPath), find(configsPath)
+}
+
+// add a signature node to each configuration covering all of its images
+func (i *Image) addConfigSignatures(opts SignOptions) ([]sigNode, error) {
+	configs := i.Tree.Lookup(configsPath)
+	if configs == nil || len(configs.Children) == 0 {
+		return nil, errors.New("fit: image has no configurations to sign")
+	}
+	images := i.Tree.Lookup(imagesPath)
+	name := "signature-" + opts.KeyName
+	var sigs []sigNode
+	for _, conf := range configs.Children {
+		if conf.Child(name) != nil {
+			return nil, fmt.Errorf("fit: configuration %s already has a %s node with a different key-name-hint", conf.Name, name)
+		}
+		var signImages []string
+		for _, prop := range defaultSignImages {
+			names := conf.Strings(prop)
+			if len(names) == 0 {
+				continue
+			}
+			signImages = append(signImages, prop)
+			for _, imageName := range names {
+				image := images.Child(imageName)
+				if image != nil && len(subnodes(image, "hash")) == 0 {
+					hash := image.AddChild("hash-1")
+					hash.SetString("algo", hashName(opts.hash()))
+				}
+			}
+		}
+		if len(signImages) == 0 {
+			return nil, fmt.Errorf("fit: configuration %s has no images to sign", conf.Name)
+		}
+		sig := conf.AddChild(name)
+		sig.SetString("key-name-hint", opts.KeyName)
+		sig.SetStrings("sign-images", signImages)
+		sigs = append(sigs, sigNode{
+			path:   configsPath + "/" + conf.Name + "/" + name,
+			parent: conf,
+			node:   sig,
+		})
+	}
+	return sigs, nil
+}
+
+func (opts SignOptions) hash() crypto.Hash {
+	if opts.Hash == 0 {
+		return crypto.SHA256
+	}
+	return opts.Hash
+}
+
+// set the properties describing a signature, with a placeholder value of the
+// final size
+func (i *Image) prepareSignature(sig *fdt.Node, keyCrypto string, opts SignOptions) (crypto.Hash, error) {
+	hash := opts.hash()
+	if algo := sig.String("algo"); algo != "" {
+		var sigCrypto string
+		var err error
+		hash, sigCrypto, err = parseAlgo(algo)
+		if err != nil {
+			return 0, err
+		}
+		if sigCrypto != keyCrypto {
+			return 0, fmt.Errorf("fit: signature algorithm %s does not match %s key", algo, keyCrypto)
+		}
+	}
+	name := hashName(hash)
+	if name == "" {
+		return 0, fmt.Errorf("fit: unsupported digest %s", hash)
+	}
+	if opts.PSS && strings.HasPrefix(keyCrypto, "rsa") && sig.Prop("padding") == nil {
+		sig.SetString("padding", "pss")
+	}
+	sig.SetString("algo", name+","+keyCrypto)
+	sig.Set("value", nil)
+	sig.SetString("signer-name", "relic")
+	sig.SetString("signer-version", config.Version)
+	sig.SetU32("timestamp", uint32(opts.Time.Unix()))
+	return hash, nil
+}
+
+// recompute the value of every hash node under an image
+func (i *Image) updateHashes() error {
+	for _, image := range i.Tree.Lookup(imagesPath).Children {
+		hashNodes := subnodes(image, "hash")
+		if len(hashNodes) == 0 {
+			continue
+		}
+		data, err := i.imageData(image)
+		if err != nil {
+			return err
+		}
+		for _, node := range hashNodes {
+			value, err := hashValue(node.String("algo"), data)
+			if err != nil {
+				return fmt.Errorf("%s/%s/%s: %w", imagesPath, image.Name, node.Name, err)
+			}
+			node.Set("value", value)
+		}
+	}
+	return nil
+}
+
+func signValue(signer crypto.Signer, sig *fdt.Node, hash crypto.Hash, digest []byte) error {
+	var sopts crypto.SignerOpts = hash
+	if sig.String("padding") == "pss" {
+		sopts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: hash}
+	}
+	value, err := signer.Sign(rand.Reader, digest, sopts)
+	if err != nil {
+		return err
+	}
+	if pub, ok := signer.Public().(*ecdsa.PublicKey); ok {
+		value, err = packECDSA(pub, value)
+		if err != nil {
+			return err
+		}
+	}
+	sig.Set("value", value)
+	return nil
+}
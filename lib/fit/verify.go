@@ -0,0 +1,155 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package fit
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Signature is a verified signature node
+type Signature struct {
+	Path      string
+	Algo      string
+	KeyName   string
+	Hash      crypto.Hash
+	Timestamp time.Time
+	// Key is the trusted public key that validated the signature
+	Key crypto.PublicKey
+}
+
+// CheckHashes verifies the value of every image hash node
+func (i *Image) CheckHashes() error {
+	for _, image := range i.Tree.Lookup(imagesPath).Children {
+		hashNodes := subnodes(image, "hash")
+		if len(hashNodes) == 0 {
+			continue
+		}
+		data, err := i.imageData(image)
+		if err != nil {
+			return err
+		}
+		for _, node := range hashNodes {
+			expected, err := hashValue(node.String("algo"), data)
+			if err != nil {
+				return fmt.Errorf("%s/%s/%s: %w", imagesPath, image.Name, node.Name, err)
+			}
+			if prop := node.Prop("value"); prop == nil || !bytes.Equal(prop.Value, expected) {
+				return fmt.Errorf("fit: hash mismatch in %s/%s/%s", imagesPath, image.Name, node.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// Verify every signature node against a set of trusted keys. Signatures
+// that don't validate with any of the keys are an error.
+func (i *Image) Verify(keys []crypto.PublicKey) ([]Signature, error) {
+	imageSigs, confSigs := i.signatures("")
+	if len(imageSigs) == 0 && len(confSigs) == 0 {
+		return nil, errors.New("fit: image is not signed")
+	}
+	var sigs []Signature
+	for _, sig := range imageSigs {
+		data, err := i.imageData(sig.parent)
+		if err != nil {
+			return nil, err
+		}
+		verified, err := i.verifySignature(sig, keys, func(hash crypto.Hash) ([]byte, error) {
+			d := hash.New()
+			d.Write(data)
+			return d.Sum(nil), nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		sigs = append(sigs, verified)
+	}
+	for _, sig := range confSigs {
+		expected, err := i.hashedNodes(sig.parent, sig.node)
+		if err != nil {
+			return nil, err
+		}
+		nodes := sig.node.Strings("hashed-nodes")
+		if !equalStrings(nodes, expected) {
+			return nil, fmt.Errorf("fit: %s does not cover the images in sign-images", sig.path)
+		}
+		hashedStrings := sig.node.Prop("hashed-strings")
+		if hashedStrings == nil || len(hashedStrings.Value) != 8 {
+			return nil, fmt.Errorf("fit: %s has invalid hashed-strings", sig.path)
+		}
+		strLen := binary.BigEndian.Uint32(hashedStrings.Value[4:])
+		verified, err := i.verifySignature(sig, keys, func(hash crypto.Hash) ([]byte, error) {
+			return i.configDigest(hash, nodes, int(strLen))
+		})
+		if err != nil {
+			return nil, err
+		}
+		sigs = append(sigs, verified)
+	}
+	return sigs, nil
+}
+
+func (i *Image) verifySignature(sig sigNode, keys []crypto.PublicKey, digestFunc func(crypto.Hash) ([]byte, error)) (Signature, error) {
+	algo := sig.node.String("algo")
+	hash, sigCrypto, err := parseAlgo(algo)
+	if err != nil {
+		return Signature{}, fmt.Errorf("%s: %w", sig.path, err)
+	}
+	value := sig.node.Prop("value")
+	if value == nil || len(value.Value) == 0 {
+		return Signature{}, fmt.Errorf("fit: %s has no signature value", sig.path)
+	}
+	digest, err := digestFunc(hash)
+	if err != nil {
+		return Signature{}, err
+	}
+	pss := sig.node.String("padding") == "pss"
+	for _, key := range keys {
+		if name, _ := cryptoName(key); name != sigCrypto {
+			continue
+		}
+		if verifyValue(key, hash, pss, digest, value.Value) == nil {
+			ts, _ := sig.node.U32("timestamp")
+			return Signature{
+				Path:      sig.path,
+				Algo:      algo,
+				KeyName:   sig.node.String("key-name-hint"),
+				Hash:      hash,
+				Timestamp: time.Unix(int64(ts), 0),
+				Key:       key,
+			}, nil
+		}
+	}
+	return Signature{}, fmt.Errorf("fit: %s was not signed by a trusted key", sig.path)
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
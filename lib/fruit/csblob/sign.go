@@ -36,9 +36,18 @@ type SignatureParams struct {
 	ExecSegmentBase  int64
 	ExecSegmentLimit int64
 	ExecSegmentFlags int64
+
+	// also include a SHA-1 code directory, for macOS before 10.11.4 and iOS
+	// before 11
+	LegacySHA1 bool
 }
 
 func (p *SignatureParams) hashFuncs() []crypto.Hash {
+	if p.LegacySHA1 && p.HashFunc != crypto.SHA1 {
+		// older systems only understand the primary slot, so SHA-1 goes
+		// there and the stronger hash is the alternate
+		return []crypto.Hash{crypto.SHA1, p.HashFunc}
+	}
 	return []crypto.Hash{p.HashFunc}
 }
 
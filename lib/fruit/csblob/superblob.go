@@ -71,6 +71,7 @@ func parseSuper(blob []byte) (magic csMagic, items []superItem, err error) {
 	}
 	indexes, blob := blob[:8*count], blob[8*count:]
 	dataOffset := origLen - len(blob)
+	blobEnd := int(length) - dataOffset
 	for i := 0; i < count; i++ {
 		itype := binary.BigEndian.Uint32(indexes[8*i:])
 		offset := int(binary.BigEndian.Uint32(indexes[4+8*i:]))
@@ -79,7 +80,11 @@ func parseSuper(blob []byte) (magic csMagic, items []superItem, err error) {
 			return 0, nil, errShort
 		}
 		length := int(binary.BigEndian.Uint32(blob[offset+4:]))
-		if offset+length > len(blob) {
+		if itype == cdTicketSlot {
+			// notarization tickets are stored raw, after all the other items
+			length = blobEnd - offset
+		}
+		if length < 0 || offset+length > len(blob) {
 			return 0, nil, errShort
 		}
 		items = append(items, superItem{
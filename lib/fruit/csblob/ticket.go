@@ -0,0 +1,42 @@
+package csblob
+
+import (
+	"errors"
+	"fmt"
+)
+
+// CDHash returns the hash type and truncated digest of the strongest code
+// directory in a signature, which is how Apple's notary service identifies it
+func CDHash(blob []byte) (HashType, []byte, error) {
+	sig, err := parseSignature(blob)
+	if err != nil {
+		return 0, nil, err
+	}
+	dir := sig.bestDir()
+	if dir == nil {
+		return 0, nil, errors.New("signature has no code directory")
+	}
+	h := dir.HashFunc.New()
+	h.Write(dir.Raw)
+	return dir.Header.HashType, h.Sum(nil)[:20], nil
+}
+
+// AddTicket returns a copy of the signature blob with a notarization ticket
+// embedded, replacing any ticket it already had
+func AddTicket(blob, ticket []byte) ([]byte, error) {
+	magic, items, err := parseSuper(blob)
+	if err != nil {
+		return nil, err
+	}
+	if magic != csEmbeddedSignature && magic != csDetachedSignature {
+		return nil, fmt.Errorf("expected embedded signature but got %08x", magic)
+	}
+	newItems := make([]superItem, 0, len(items)+1)
+	for _, item := range items {
+		if item.itype != cdTicketSlot {
+			newItems = append(newItems, item)
+		}
+	}
+	newItems = append(newItems, superItem{itype: cdTicketSlot, data: ticket})
+	return marshalSuperBlob(magic, newItems), nil
+}
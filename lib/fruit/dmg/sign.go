@@ -20,6 +20,7 @@ type SignatureParams struct {
 	Requirements    []byte // requirements to embed in signature
 	SigningIdentity string
 	TeamIdentifier  string
+	LegacySHA1      bool // also include a SHA-1 code directory
 }
 
 func Sign(ctx context.Context, rsfBytes []byte, r io.Reader, cert *certloader.Certificate, params *SignatureParams) (*binpatch.PatchSet, *pkcs9.TimestampedSignature, error) {
@@ -39,6 +40,7 @@ func Sign(ctx context.Context, rsfBytes []byte, r io.Reader, cert *certloader.Ce
 		TeamIdentifier:  params.TeamIdentifier,
 		Pages:           io.LimitReader(nr, bundleSize),
 		RepSpecific:     rsf.ForHashing(),
+		LegacySHA1:      params.LegacySHA1,
 	}
 	if oldOffset != 0 {
 		// provide old signature to copy requirements and flags
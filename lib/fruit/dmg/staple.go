@@ -0,0 +1,43 @@
+package dmg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+
+	"github.com/sassoftware/relic/v7/lib/binpatch"
+	"github.com/sassoftware/relic/v7/lib/fruit/csblob"
+	"github.com/sassoftware/relic/v7/signers/sigerrors"
+)
+
+// CDHash returns the hash type and truncated code directory hash of the
+// image's signature
+func (d *DMG) CDHash() (csblob.HashType, []byte, error) {
+	if len(d.sigBlob) == 0 {
+		return 0, nil, sigerrors.NotSignedError{Type: "dmg"}
+	}
+	return csblob.CDHash(d.sigBlob)
+}
+
+// Staple returns a patch that embeds a notarization ticket into the image's
+// signature
+func (d *DMG) Staple(ticket []byte) (*binpatch.PatchSet, error) {
+	if len(d.sigBlob) == 0 {
+		return nil, sigerrors.NotSignedError{Type: "dmg"}
+	}
+	if d.rsf.SignatureOffset+d.rsf.SignatureLength != d.udifOffset {
+		return nil, errors.New("signature is not at the end of the image")
+	}
+	blob, err := csblob.AddTicket(d.sigBlob, ticket)
+	if err != nil {
+		return nil, err
+	}
+	rsf := d.rsf
+	rsf.SignatureLength = int64(len(blob))
+	var b bytes.Buffer
+	_, _ = b.Write(blob)
+	_ = binary.Write(&b, binary.BigEndian, rsf)
+	patch := binpatch.New()
+	patch.Add(rsf.SignatureOffset, d.udifOffset+512-rsf.SignatureOffset, b.Bytes())
+	return patch, nil
+}
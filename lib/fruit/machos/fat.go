@@ -0,0 +1,105 @@
+package machos
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/sassoftware/relic/v7/lib/binpatch"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/fruit/csblob"
+	"github.com/sassoftware/relic/v7/lib/pkcs9"
+)
+
+const fatMagic = 0xcafebabe
+
+type fatArch struct {
+	CPUType    uint32
+	CPUSubtype uint32
+	Offset     uint32
+	Size       uint32
+	Align      uint32
+}
+
+// SignFat signs each architecture of a universal binary and returns a patch
+// for the whole file. Signing may grow each slice, so later slices are moved
+// to keep their alignment and the fat header is updated to match.
+func SignFat(ctx context.Context, r io.Reader, cert *certloader.Certificate, params *csblob.SignatureParams) (*binpatch.PatchSet, *pkcs9.TimestampedSignature, error) {
+	var hdr struct {
+		Magic    uint32
+		NumArchs uint32
+	}
+	if err := binary.Read(r, binary.BigEndian, &hdr); err != nil {
+		return nil, nil, err
+	}
+	if hdr.Magic != fatMagic {
+		return nil, nil, errors.New("not a universal binary")
+	}
+	if hdr.NumArchs == 0 || hdr.NumArchs > 64 {
+		return nil, nil, fmt.Errorf("invalid architecture count %d", hdr.NumArchs)
+	}
+	arches := make([]fatArch, hdr.NumArchs)
+	if err := binary.Read(r, binary.BigEndian, arches); err != nil {
+		return nil, nil, err
+	}
+	headerSize := int64(8 + 20*len(arches))
+	body := binpatch.New()
+	oldPos, newPos := headerSize, headerSize
+	var tsig *pkcs9.TimestampedSignature
+	for i := range arches {
+		arch := &arches[i]
+		if int64(arch.Offset) < oldPos || arch.Align > 30 {
+			return nil, nil, errors.New("universal binary slices are overlapping or out of order")
+		}
+		// skip to the start of the slice and work out where it goes now
+		gap := int64(arch.Offset) - oldPos
+		if _, err := io.CopyN(ioutil.Discard, r, gap); err != nil {
+			return nil, nil, err
+		}
+		align := int64(1) << arch.Align
+		newOffset := (newPos + align - 1) / align * align
+		if newGap := newOffset - newPos; newGap != gap {
+			body.Add(oldPos, gap, make([]byte, newGap))
+		}
+		// sign the slice with its own copy of the parameters, since they are
+		// filled in from each slice's old signature
+		archParams := *params
+		patch, ts, err := Sign(ctx, io.LimitReader(r, int64(arch.Size)), cert, &archParams)
+		if err != nil {
+			return nil, nil, fmt.Errorf("slice %d: %w", i, err)
+		}
+		tsig = ts
+		newSize := int64(arch.Size)
+		for j, p := range patch.Patches {
+			body.Add(int64(arch.Offset)+p.Offset, int64(p.OldSize), patch.Blobs[j])
+			newSize += int64(p.NewSize) - int64(p.OldSize)
+		}
+		if newOffset > 0xffffffff || newSize > 0xffffffff {
+			return nil, nil, errors.New("universal binary is too large")
+		}
+		oldPos = int64(arch.Offset) + int64(arch.Size)
+		newPos = newOffset + newSize
+		arch.Offset = uint32(newOffset)
+		arch.Size = uint32(newSize)
+		// reuse the identity picked for the first slice
+		params.SigningIdentity = archParams.SigningIdentity
+		params.TeamIdentifier = archParams.TeamIdentifier
+	}
+	// discard anything trailing
+	if _, err := io.Copy(ioutil.Discard, r); err != nil {
+		return nil, nil, err
+	}
+	var newHeader bytes.Buffer
+	_ = binary.Write(&newHeader, binary.BigEndian, hdr)
+	_ = binary.Write(&newHeader, binary.BigEndian, arches)
+	result := binpatch.New()
+	result.Add(0, headerSize, newHeader.Bytes())
+	for i, p := range body.Patches {
+		result.Add(p.Offset, int64(p.OldSize), body.Blobs[i])
+	}
+	return result, tsig, nil
+}
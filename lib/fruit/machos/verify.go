@@ -77,3 +77,23 @@ func readPlist(hdr *macho.File) ([]byte, error) {
 	}
 	return nil, nil
 }
+
+// CDHash returns the hash type and truncated code directory hash of a signed
+// Mach-O binary. For universal binaries the first slice is used.
+func CDHash(r io.ReaderAt) (csblob.HashType, []byte, error) {
+	if fat, err := macho.NewFatFile(r); err == nil {
+		arch := fat.Arches[0]
+		r = io.NewSectionReader(r, int64(arch.Offset), int64(arch.Size))
+	} else if err != macho.ErrNotFat {
+		return 0, nil, err
+	}
+	hdr, err := macho.NewFile(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	buf, err := readSigBlob(r, hdr)
+	if err != nil {
+		return 0, nil, err
+	}
+	return csblob.CDHash(buf)
+}
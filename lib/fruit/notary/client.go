@@ -0,0 +1,238 @@
+// Package notary submits signed software to Apple's notary service and
+// staples the resulting tickets.
+package notary
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sassoftware/relic/v7/config"
+)
+
+const (
+	DefaultURL = "https://appstoreconnect.apple.com/notary/v2"
+
+	StatusInProgress = "In Progress"
+	StatusAccepted   = "Accepted"
+	StatusInvalid    = "Invalid"
+	StatusRejected   = "Rejected"
+)
+
+// Client talks to the Notary API using an App Store Connect API key
+type Client struct {
+	KeyID    string
+	IssuerID string
+	Key      crypto.Signer // ECDSA P-256 key downloaded from App Store Connect
+	URL      string        // defaults to DefaultURL
+
+	HTTPClient *http.Client
+}
+
+// Submission describes the state of a notarization request
+type Submission struct {
+	ID          string
+	Name        string
+	Status      string
+	CreatedDate string
+}
+
+type submissionResponse struct {
+	Data struct {
+		ID         string `json:"id"`
+		Attributes struct {
+			Name        string `json:"name"`
+			Status      string `json:"status"`
+			CreatedDate string `json:"createdDate"`
+			// new submissions only
+			AccessKeyID     string `json:"awsAccessKeyId"`
+			SecretAccessKey string `json:"awsSecretAccessKey"`
+			SessionToken    string `json:"awsSessionToken"`
+			Bucket          string `json:"bucket"`
+			Object          string `json:"object"`
+			// logs only
+			DeveloperLogURL string `json:"developerLogUrl"`
+		} `json:"attributes"`
+	} `json:"data"`
+}
+
+func (r *submissionResponse) submission() *Submission {
+	return &Submission{
+		ID:          r.Data.ID,
+		Name:        r.Data.Attributes.Name,
+		Status:      r.Data.Attributes.Status,
+		CreatedDate: r.Data.Attributes.CreatedDate,
+	}
+}
+
+// Submit uploads a signed .pkg, .dmg or .zip file for notarization and
+// returns the submission ID
+func (c *Client) Submit(ctx context.Context, f *os.File) (string, error) {
+	if _, err := f.Seek(0, 0); err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+	digest := h.Sum(nil)
+	body, err := json.Marshal(map[string]string{
+		"submissionName": filepath.Base(f.Name()),
+		"sha256":         hex.EncodeToString(digest),
+	})
+	if err != nil {
+		return "", err
+	}
+	var resp submissionResponse
+	if err := c.call(ctx, "POST", "/submissions", body, &resp); err != nil {
+		return "", err
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		return "", err
+	}
+	if err := upload(ctx, c.httpClient(), &resp, f, size, digest); err != nil {
+		return "", fmt.Errorf("uploading submission %s: %w", resp.Data.ID, err)
+	}
+	return resp.Data.ID, nil
+}
+
+// Status returns the current state of a submission
+func (c *Client) Status(ctx context.Context, id string) (*Submission, error) {
+	var resp submissionResponse
+	if err := c.call(ctx, "GET", "/submissions/"+id, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.submission(), nil
+}
+
+// Wait polls until a submission is no longer in progress
+func (c *Client) Wait(ctx context.Context, id string, interval time.Duration) (*Submission, error) {
+	for {
+		sub, err := c.Status(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if sub.Status != StatusInProgress {
+			return sub, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Log fetches the developer log of a finished submission
+func (c *Client) Log(ctx context.Context, id string) ([]byte, error) {
+	var resp submissionResponse
+	if err := c.call(ctx, "GET", "/submissions/"+id+"/logs", nil, &resp); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", resp.Data.Attributes.DeveloperLogURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", config.UserAgent)
+	return doRequest(c.httpClient(), req)
+}
+
+func (c *Client) call(ctx context.Context, method, path string, body []byte, result interface{}) error {
+	token, err := c.token()
+	if err != nil {
+		return err
+	}
+	base := c.URL
+	if base == "" {
+		base = DefaultURL
+	}
+	req, err := http.NewRequestWithContext(ctx, method, base+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("User-Agent", config.UserAgent)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	blob, err := doRequest(c.httpClient(), req)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(blob, result)
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+func doRequest(client *http.Client, req *http.Request) ([]byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	blob, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("%s %s: %s: %s", req.Method, req.URL, resp.Status, bytes.TrimSpace(blob))
+	}
+	return blob, nil
+}
+
+// token creates a short-lived ES256 JWT for the App Store Connect API
+func (c *Client) token() (string, error) {
+	if _, ok := c.Key.Public().(*ecdsa.PublicKey); !ok {
+		return "", errors.New("notary API key must be an ECDSA key")
+	}
+	hdr, err := json.Marshal(map[string]string{"alg": "ES256", "kid": c.KeyID, "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss": c.IssuerID,
+		"iat": now.Unix(),
+		"exp": now.Add(15 * time.Minute).Unix(),
+		"aud": "appstoreconnect-v1",
+	})
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(hdr) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	der, err := c.Key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return "", err
+	}
+	// JWS wants the raw r || s form
+	var esig struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(der, &esig); err != nil {
+		return "", err
+	}
+	sig := make([]byte, 64)
+	esig.R.FillBytes(sig[:32])
+	esig.S.FillBytes(sig[32:])
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
@@ -0,0 +1,187 @@
+package notary
+
+import (
+	"archive/zip"
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"howett.net/plist"
+
+	"github.com/sassoftware/relic/v7/lib/atomicfile"
+	"github.com/sassoftware/relic/v7/lib/fruit/csblob"
+	"github.com/sassoftware/relic/v7/lib/fruit/dmg"
+	"github.com/sassoftware/relic/v7/lib/fruit/machos"
+	"github.com/sassoftware/relic/v7/lib/fruit/xar"
+	"github.com/sassoftware/relic/v7/lib/magic"
+)
+
+// Staple fetches the published ticket for a notarized installer package, disk
+// image, or zipped app bundle and embeds it into the file
+func Staple(ctx context.Context, client *http.Client, fp string) error {
+	f, err := os.OpenFile(fp, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		return err
+	}
+	switch magic.Detect(f) {
+	case magic.FileTypeXAR:
+		return stapleXAR(ctx, client, f, size)
+	case magic.FileTypeIPA:
+		return stapleZip(ctx, client, f, size)
+	}
+	d, err := dmg.Open(f)
+	if err != nil {
+		return errors.New("stapling is only supported for .pkg, .dmg and zipped .app files")
+	}
+	hashType, cdhash, err := d.CDHash()
+	if err != nil {
+		return err
+	}
+	ticket, err := FetchTicket(ctx, client, RecordName(hashType, cdhash))
+	if err != nil {
+		return err
+	}
+	patch, err := d.Staple(ticket)
+	if err != nil {
+		return err
+	}
+	return patch.Apply(f, fp)
+}
+
+func stapleXAR(ctx context.Context, client *http.Client, f *os.File, size int64) error {
+	x, err := xar.Open(f, size)
+	if err != nil {
+		return err
+	}
+	var hashType csblob.HashType
+	switch x.HashFunc {
+	case crypto.SHA1:
+		hashType = csblob.HashSHA1
+	case crypto.SHA256:
+		hashType = csblob.HashSHA256
+	default:
+		return fmt.Errorf("can't staple packages with a %s checksum", x.HashFunc)
+	}
+	ticket, err := FetchTicket(ctx, client, RecordName(hashType, x.TOCHash))
+	if err != nil {
+		return err
+	}
+	return x.Staple(ticket).Apply(f, f.Name())
+}
+
+// app bundles get the ticket as a file next to Info.plist
+func stapleZip(ctx context.Context, client *http.Client, f *os.File, size int64) error {
+	zr, err := zip.NewReader(f, size)
+	if err != nil {
+		return err
+	}
+	var plistFile *zip.File
+	for _, zf := range zr.File {
+		parts := strings.Split(path.Clean(zf.Name), "/")
+		if len(parts) == 3 && strings.HasSuffix(parts[0], ".app") && parts[1] == "Contents" && parts[2] == "Info.plist" {
+			plistFile = zf
+			break
+		}
+	}
+	if plistFile == nil {
+		return errors.New("zip does not contain a macOS app bundle")
+	}
+	contents := path.Dir(plistFile.Name)
+	plistBytes, err := readZipFile(plistFile)
+	if err != nil {
+		return err
+	}
+	var bundle struct {
+		Executable string `plist:"CFBundleExecutable"`
+	}
+	if _, err := plist.Unmarshal(plistBytes, &bundle); err != nil {
+		return fmt.Errorf("%s: %w", plistFile.Name, err)
+	}
+	if bundle.Executable == "" {
+		return errors.New("plist: CFBundleExecutable is missing")
+	}
+	// extract the main executable to find its code directory hash
+	exePath := path.Join(contents, "MacOS", bundle.Executable)
+	var exeFile *zip.File
+	for _, zf := range zr.File {
+		if zf.Name == exePath {
+			exeFile = zf
+		}
+	}
+	if exeFile == nil {
+		return fmt.Errorf("%s: %w", exePath, os.ErrNotExist)
+	}
+	exe, err := os.CreateTemp("", "")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(exe.Name())
+	defer exe.Close()
+	r, err := exeFile.Open()
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(exe, r)
+	r.Close()
+	if err != nil {
+		return err
+	}
+	hashType, cdhash, err := machos.CDHash(exe)
+	if err != nil {
+		return fmt.Errorf("%s: %w", exePath, err)
+	}
+	ticket, err := FetchTicket(ctx, client, RecordName(hashType, cdhash))
+	if err != nil {
+		return err
+	}
+	// rewrite the zip with the ticket added
+	ticketPath := path.Join(contents, "CodeResources")
+	out, err := atomicfile.New(f.Name())
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	zw := zip.NewWriter(out.GetFile())
+	for _, zf := range zr.File {
+		if zf.Name == ticketPath {
+			continue
+		}
+		if err := zw.Copy(zf); err != nil {
+			return err
+		}
+	}
+	w, err := zw.Create(ticketPath)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(ticket); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return out.Commit()
+}
+
+func readZipFile(zf *zip.File) ([]byte, error) {
+	r, err := zf.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
@@ -0,0 +1,83 @@
+package notary
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/sassoftware/relic/v7/config"
+	"github.com/sassoftware/relic/v7/lib/fruit/csblob"
+)
+
+// TicketURL is the public CloudKit database that notarization tickets are published to
+const TicketURL = "https://api.apple-cloudkit.com/database/1/com.apple.gk.ticket-delivery/production/public/records/lookup"
+
+// RecordName returns the name a ticket is published under for the given
+// code directory hash or package checksum
+func RecordName(hashType csblob.HashType, digest []byte) string {
+	return fmt.Sprintf("2/%d/%s", hashType, hex.EncodeToString(digest))
+}
+
+type ticketLookup struct {
+	Records []struct {
+		RecordName string `json:"recordName"`
+	} `json:"records"`
+}
+
+type ticketRecords struct {
+	Records []struct {
+		RecordName      string `json:"recordName"`
+		ServerErrorCode string `json:"serverErrorCode"`
+		Reason          string `json:"reason"`
+		Fields          struct {
+			SignedTicket struct {
+				Value string `json:"value"`
+			} `json:"signedTicket"`
+		} `json:"fields"`
+	} `json:"records"`
+}
+
+// FetchTicket downloads the notarization ticket published under a record name
+func FetchTicket(ctx context.Context, client *http.Client, recordName string) ([]byte, error) {
+	var lookup ticketLookup
+	lookup.Records = append(lookup.Records, struct {
+		RecordName string `json:"recordName"`
+	}{recordName})
+	body, err := json.Marshal(lookup)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", TicketURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", config.UserAgent)
+	if client == nil {
+		client = http.DefaultClient
+	}
+	blob, err := doRequest(client, req)
+	if err != nil {
+		return nil, err
+	}
+	var records ticketRecords
+	if err := json.Unmarshal(blob, &records); err != nil {
+		return nil, err
+	}
+	if len(records.Records) != 1 {
+		return nil, fmt.Errorf("ticket %s: expected 1 record but got %d", recordName, len(records.Records))
+	}
+	rec := records.Records[0]
+	if rec.ServerErrorCode != "" {
+		return nil, fmt.Errorf("ticket %s: %s: %s", recordName, rec.ServerErrorCode, rec.Reason)
+	}
+	ticket, err := base64.StdEncoding.DecodeString(rec.Fields.SignedTicket.Value)
+	if err != nil {
+		return nil, fmt.Errorf("ticket %s: %w", recordName, err)
+	}
+	return ticket, nil
+}
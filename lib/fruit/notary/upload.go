@@ -0,0 +1,39 @@
+package notary
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+const uploadRegion = "us-west-2"
+
+// upload the file to the S3 bucket named in a new submission, using the
+// temporary credentials that came with it
+func upload(ctx context.Context, client *http.Client, sub *submissionResponse, r io.Reader, size int64, digest []byte) error {
+	attrs := sub.Data.Attributes
+	url := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", attrs.Bucket, uploadRegion, attrs.Object)
+	req, err := http.NewRequestWithContext(ctx, "PUT", url, io.NopCloser(r))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	payloadHash := hex.EncodeToString(digest)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	creds := aws.Credentials{
+		AccessKeyID:     attrs.AccessKeyID,
+		SecretAccessKey: attrs.SecretAccessKey,
+		SessionToken:    attrs.SessionToken,
+	}
+	if err := v4.NewSigner().SignHTTP(ctx, creds, req, payloadHash, "s3", uploadRegion, time.Now()); err != nil {
+		return err
+	}
+	_, err = doRequest(client, req)
+	return err
+}
@@ -45,32 +45,66 @@ func Sign(ctx context.Context, r io.Reader, cert *certloader.Certificate, hashTy
 		return nil, nil, errors.New("missing xar/toc element")
 	}
 	origSigSize := removeSigs(toc)
-	// reserve space for new signatures and insert elements into TOC
-	newSigSize := reserveSignatures(toc, hashType, cert.Chain())
 	// verify and discard remaining input files
 	heap := &streamReaderAt{r: r}
 	if err := checkFiles(toc, heap); err != nil {
 		return nil, nil, err
 	}
-	// move offsets of files in accordance with the change in signature size
-	adjustOffsets(doc, newSigSize-origSigSize)
-	// encode TOC
-	ztocBytes, uncompSize, err := compress(doc)
-	if err != nil {
-		return nil, nil, err
+	// leave room for the timestamp token and the TSA's certificates
+	var extraCMS int64
+	if cert.Timestamper != nil {
+		extraCMS = timestampReserve
 	}
-	// write new header and TOC
-	newByteLen := 28 + len(ztocBytes) + int(newSigSize)
-	newBytes := bytes.NewBuffer(make([]byte, 0, newByteLen))
-	tssig, err := appendSignatures(ctx, newBytes, ztocBytes, uncompSize, newSigSize, cert, hashType)
-	if err != nil {
-		return nil, nil, err
+	prevSigSize := origSigSize
+	for attempt := 0; ; attempt++ {
+		// reserve space for new signatures and insert elements into TOC
+		newSigSize := reserveSignatures(toc, hashType, cert.Chain(), extraCMS)
+		// move offsets of files in accordance with the change in signature size
+		adjustOffsets(doc, newSigSize-prevSigSize)
+		// encode TOC
+		ztocBytes, uncompSize, err := compress(doc)
+		if err != nil {
+			return nil, nil, err
+		}
+		// write new header and TOC
+		newByteLen := 28 + len(ztocBytes) + int(newSigSize)
+		newBytes := bytes.NewBuffer(make([]byte, 0, newByteLen))
+		tssig, err := appendSignatures(ctx, newBytes, ztocBytes, uncompSize, newSigSize, cert, hashType)
+		var overflow sigOverflowError
+		if errors.As(err, &overflow) && attempt == 0 {
+			// the reserved size is recorded in the TOC, which the signature
+			// covers, so the TOC has to be signed again. Size the new
+			// reservation from what the first signature and timestamp token
+			// actually used so that one more attempt is always enough.
+			removeSigs(toc)
+			extraCMS += overflow.need - overflow.have + reserveSlack
+			prevSigSize = newSigSize
+			continue
+		} else if err != nil {
+			return nil, nil, err
+		}
+		// patch signature into result
+		origTotal := 28 + hdr.CompressedSize + origSigSize
+		p := binpatch.New()
+		p.Add(0, origTotal, newBytes.Bytes())
+		return p, tssig, nil
 	}
-	// patch signature into result
-	origTotal := 28 + hdr.CompressedSize + origSigSize
-	p := binpatch.New()
-	p.Add(0, origTotal, newBytes.Bytes())
-	return p, tssig, nil
+}
+
+const (
+	// space to reserve for a RFC 3161 timestamp in the CMS signature
+	timestampReserve = 8192
+	// allowance for the encoded length of a signature or timestamp token
+	// changing between attempts, e.g. ECDSA values or serial numbers
+	reserveSlack = 64
+)
+
+type sigOverflowError struct {
+	have, need int64
+}
+
+func (e sigOverflowError) Error() string {
+	return fmt.Sprintf("signature overflows reserved space: have %d bytes, need %d", e.have, e.need)
 }
 
 func tocEtree(r io.Reader, compressedSize int64) (*etree.Document, error) {
@@ -101,7 +135,7 @@ func removeSigs(toc *etree.Element) (size int64) {
 }
 
 // add space for new signatures and return the heap space required for them
-func reserveSignatures(toc *etree.Element, hashType crypto.Hash, certs []*x509.Certificate) (newSigSize int64) {
+func reserveSignatures(toc *etree.Element, hashType crypto.Hash, certs []*x509.Certificate, extraCMS int64) (newSigSize int64) {
 	hashName := strings.ReplaceAll(strings.ToLower(hashType.String()), "-", "")
 	// encode cert chain
 	var b strings.Builder
@@ -133,7 +167,7 @@ func reserveSignatures(toc *etree.Element, hashType crypto.Hash, certs []*x509.C
 		added++
 	}
 	// reserve space for CMS
-	cmsSize := int64(6144)
+	cmsSize := 6144 + extraCMS
 	for _, cert := range certs {
 		cmsSize += int64(len(cert.Raw))
 	}
@@ -252,7 +286,7 @@ func appendSignatures(ctx context.Context, out *bytes.Buffer, ztoc []byte, uncom
 	out.Write(tssig.Raw)
 	usedSigSize += int64(len(tssig.Raw))
 	if usedSigSize > reservedSigSize {
-		return nil, fmt.Errorf("signature overflows reserved space: have %d bytes, need %d", reservedSigSize, usedSigSize)
+		return nil, sigOverflowError{have: reservedSigSize, need: usedSigSize}
 	} else {
 		// pad out remaining space
 		out.Write(make([]byte, reservedSigSize-usedSigSize))
@@ -0,0 +1,145 @@
+package xar
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sassoftware/relic/v7/internal/testcert"
+	"github.com/sassoftware/relic/v7/lib/pkcs7"
+	"github.com/sassoftware/relic/v7/lib/pkcs9"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+)
+
+// build an unsigned archive holding one file
+func makeXar(t *testing.T, contents []byte) []byte {
+	doc := etree.NewDocument()
+	require.NoError(t, doc.ReadFromString(fmt.Sprintf(`<xar><toc><creation-time>2020-01-01T00:00:00</creation-time>
+<file id="1"><name>payload</name><type>file</type><data>
+<offset>0</offset><length>%d</length><size>%d</size>
+<encoding style="application/octet-stream"/>
+<archived-checksum style="sha1">%x</archived-checksum>
+<extracted-checksum style="sha1">%x</extracted-checksum>
+</data></file></toc></xar>`, len(contents), len(contents), sha1.Sum(contents), sha1.Sum(contents))))
+	ztoc, uncompSize, err := compress(doc)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, binary.Write(&buf, binary.BigEndian, fileHeader{
+		Magic:            xarMagic,
+		HeaderSize:       28,
+		Version:          1,
+		CompressedSize:   int64(len(ztoc)),
+		UncompressedSize: uncompSize,
+		HashType:         hashSHA1,
+	}))
+	buf.Write(ztoc)
+	buf.Write(contents)
+	return buf.Bytes()
+}
+
+// fakeTSA issues timestamp tokens padded with a certificate of the given size,
+// plus grow bytes more on each call after the first
+type fakeTSA struct {
+	t          *testing.T
+	key        *ecdsa.PrivateKey
+	cert       *x509.Certificate
+	size, grow int
+	calls      int
+}
+
+func (tsa *fakeTSA) Timestamp(ctx context.Context, req *pkcs9.Request) (*pkcs7.ContentInfoSignedData, error) {
+	d := req.Hash.New()
+	d.Write(req.EncryptedDigest)
+	alg, _ := x509tools.PkixDigestAlgorithm(req.Hash)
+	genTime, err := asn1.MarshalWithParams(time.Now().UTC(), "generalized")
+	require.NoError(tsa.t, err)
+	info := pkcs9.TSTInfo{
+		Version:        1,
+		Policy:         asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 3, 2, 1},
+		MessageImprint: pkcs9.MessageImprint{HashAlgorithm: alg, HashedMessage: d.Sum(nil)},
+		SerialNumber:   big.NewInt(int64(tsa.calls + 1)),
+		GenTime:        asn1.RawValue{FullBytes: genTime},
+	}
+	padding := testcert.Issue(tsa.t, &x509.Certificate{
+		Subject:         pkix.Name{CommonName: "padding"},
+		ExtraExtensions: []pkix.Extension{{Id: asn1.ObjectIdentifier{1, 2, 3, 4}, Value: make([]byte, tsa.size+tsa.calls*tsa.grow)}},
+	}, tsa.key, nil, nil)
+	tsa.calls++
+	der, err := asn1.Marshal(info)
+	require.NoError(tsa.t, err)
+	builder := pkcs7.NewBuilder(tsa.key, []*x509.Certificate{tsa.cert, padding}, crypto.SHA256)
+	if err := builder.SetContent(pkcs9.OidTSTInfo, der); err != nil {
+		return nil, err
+	}
+	return builder.Sign()
+}
+
+func newTSA(t *testing.T, size, grow int) *fakeTSA {
+	key := testcert.ECDSAKey(t)
+	return &fakeTSA{
+		t:    t,
+		key:  key,
+		cert: testcert.Issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "tsa"}, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping}}, key, nil, nil),
+		size: size,
+		grow: grow,
+	}
+}
+
+func signXar(t *testing.T, orig []byte, tsa pkcs9.Timestamper) ([]byte, error) {
+	key := testcert.ECDSAKey(t)
+	cert := testcert.Signer(t, &x509.Certificate{Subject: pkix.Name{CommonName: "signer"}}, key)
+	cert.Timestamper = tsa
+	patch, _, err := Sign(context.Background(), bytes.NewReader(orig), cert, crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	return patch.ApplyBytes(orig)
+}
+
+func TestSignTimestamp(t *testing.T) {
+	contents := []byte("hello, world\n")
+	tsa := newTSA(t, 100, 0)
+	signed, err := signXar(t, makeXar(t, contents), tsa)
+	require.NoError(t, err)
+	assert.Equal(t, 1, tsa.calls)
+	x, err := Open(bytes.NewReader(signed), int64(len(signed)))
+	require.NoError(t, err)
+	sig, err := x.Verify(false)
+	require.NoError(t, err)
+	assert.NotNil(t, sig.Signature.CounterSignature)
+}
+
+func TestSignOverflow(t *testing.T) {
+	contents := []byte("hello, world\n")
+	// a token bigger than the usual reservation needs one more attempt
+	tsa := newTSA(t, 2*timestampReserve, 0)
+	signed, err := signXar(t, makeXar(t, contents), tsa)
+	require.NoError(t, err)
+	assert.Equal(t, 2, tsa.calls)
+	x, err := Open(bytes.NewReader(signed), int64(len(signed)))
+	require.NoError(t, err)
+	sig, err := x.Verify(false)
+	require.NoError(t, err)
+	assert.NotNil(t, sig.Signature.CounterSignature)
+
+	// if the second token is bigger still, give up instead of looping
+	tsa = newTSA(t, 2*timestampReserve, 4*reserveSlack)
+	_, err = signXar(t, makeXar(t, contents), tsa)
+	var overflow sigOverflowError
+	assert.ErrorAs(t, err, &overflow)
+	assert.Equal(t, 2, tsa.calls)
+}
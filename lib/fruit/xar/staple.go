@@ -0,0 +1,46 @@
+package xar
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/sassoftware/relic/v7/lib/binpatch"
+)
+
+// stapled tickets are followed by a trailer pointing back to the start of the ticket
+type ticketTrailer struct {
+	Magic   [4]byte
+	Version uint16
+	Type    uint16
+	Length  uint32
+}
+
+var ticketMagic = [4]byte{'t', '8', 'l', 'r'}
+
+// Staple returns a patch that appends a notarization ticket to the archive,
+// replacing any ticket it already had
+func (s *XAR) Staple(ticket []byte) *binpatch.PatchSet {
+	var b bytes.Buffer
+	b.Write(ticket)
+	_ = binary.Write(&b, binary.LittleEndian, ticketTrailer{
+		Magic:   ticketMagic,
+		Version: 1,
+		Type:    1,
+		Length:  uint32(len(ticket)),
+	})
+	patch := binpatch.New()
+	patch.Add(s.dataEnd, s.size-s.dataEnd, b.Bytes())
+	return patch
+}
+
+func stripTicketTrailer(blob []byte) []byte {
+	if len(blob) < 12 {
+		return blob
+	}
+	var trailer ticketTrailer
+	_ = binary.Read(bytes.NewReader(blob[len(blob)-12:]), binary.LittleEndian, &trailer)
+	if trailer.Magic != ticketMagic || int(trailer.Length) != len(blob)-12 {
+		return blob
+	}
+	return blob[:trailer.Length]
+}
@@ -21,8 +21,10 @@ type XAR struct {
 	CMSSignature     []byte
 	NotaryTicket     []byte
 
-	toc  *tocToc
-	heap io.ReaderAt
+	toc     *tocToc
+	heap    io.ReaderAt
+	dataEnd int64
+	size    int64
 }
 
 func Open(r io.ReaderAt, size int64) (*XAR, error) {
@@ -69,12 +71,13 @@ func Open(r io.ReaderAt, size int64) (*XAR, error) {
 		}
 	}
 	lo := lastOffset(toc.Files) + base
+	s.dataEnd, s.size = lo, size
 	if trailer := size - lo; trailer > 0 && trailer < 1e6 {
 		ticket := make([]byte, trailer)
 		if _, err := r.ReadAt(ticket, lo); err != nil {
 			return nil, fmt.Errorf("reading trailer: %w", err)
 		}
-		s.NotaryTicket = ticket
+		s.NotaryTicket = stripTicketTrailer(ticket)
 	}
 	return s, nil
 }
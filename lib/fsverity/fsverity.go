@@ -0,0 +1,204 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package fsverity computes fs-verity file digests and the built-in PKCS#7
+// signatures accepted by FS_IOC_ENABLE_VERITY.
+package fsverity
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/pkcs7"
+	"github.com/sassoftware/relic/v7/lib/pkcs9"
+)
+
+// DefaultBlockSize is the Merkle tree block size used by default, which
+// matches the page size on most systems
+const DefaultBlockSize = 4096
+
+var hashAlgorithms = map[crypto.Hash]uint8{
+	crypto.SHA256: 1,
+	crypto.SHA512: 2,
+}
+
+// struct fsverity_descriptor
+type descriptor struct {
+	Version       uint8
+	HashAlgorithm uint8
+	LogBlockSize  uint8
+	SaltSize      uint8
+	SigSize       uint32
+	DataSize      uint64
+	RootHash      [64]byte
+	Salt          [32]byte
+	Reserved      [144]byte
+}
+
+// Params selects the Merkle tree parameters, which must match those used when
+// enabling verity on the file
+type Params struct {
+	Hash      crypto.Hash
+	BlockSize int
+	Salt      []byte
+}
+
+func (p Params) check() error {
+	if _, ok := hashAlgorithms[p.Hash]; !ok {
+		return fmt.Errorf("fsverity: unsupported hash %s", p.Hash)
+	}
+	if p.BlockSize < 1024 || p.BlockSize&(p.BlockSize-1) != 0 || p.BlockSize < 2*p.Hash.Size() {
+		return fmt.Errorf("fsverity: invalid block size %d", p.BlockSize)
+	}
+	if len(p.Salt) > 32 {
+		return errors.New("fsverity: salt is too long")
+	}
+	return nil
+}
+
+func (p Params) hashBlock(block []byte) []byte {
+	// the salt is padded to a multiple of the hash's block size
+	d := p.Hash.New()
+	if len(p.Salt) != 0 {
+		salt := make([]byte, (len(p.Salt)+d.BlockSize()-1)/d.BlockSize()*d.BlockSize())
+		copy(salt, p.Salt)
+		d.Write(salt)
+	}
+	d.Write(block)
+	return d.Sum(nil)
+}
+
+// MerkleTree computes the fs-verity Merkle tree of a file. Levels are
+// returned nearest the root first, each padded to a whole block. An empty
+// file has no tree and a root hash of all zeroes.
+func MerkleTree(r io.Reader, p Params) (tree, rootHash []byte, size int64, err error) {
+	if err := p.check(); err != nil {
+		return nil, nil, 0, err
+	}
+	// hash the data blocks
+	var level []byte
+	block := make([]byte, p.BlockSize)
+	for {
+		n, err := io.ReadFull(r, block)
+		if n == 0 && (err == io.EOF || err == io.ErrUnexpectedEOF) {
+			break
+		} else if err != nil && err != io.ErrUnexpectedEOF {
+			return nil, nil, 0, err
+		}
+		size += int64(n)
+		for i := n; i < len(block); i++ {
+			block[i] = 0
+		}
+		level = append(level, p.hashBlock(block)...)
+		if n < len(block) {
+			break
+		}
+	}
+	if size == 0 {
+		return nil, make([]byte, p.Hash.Size()), 0, nil
+	}
+	// hash each level until it fits in a single block
+	var levels [][]byte
+	for {
+		level = padBlock(level, p.BlockSize)
+		levels = append(levels, level)
+		if len(level) == p.BlockSize {
+			break
+		}
+		var next []byte
+		for i := 0; i < len(level); i += p.BlockSize {
+			next = append(next, p.hashBlock(level[i:i+p.BlockSize])...)
+		}
+		level = next
+	}
+	for i := len(levels) - 1; i >= 0; i-- {
+		tree = append(tree, levels[i]...)
+	}
+	return tree, p.hashBlock(levels[len(levels)-1]), size, nil
+}
+
+func padBlock(d []byte, blockSize int) []byte {
+	if rem := len(d) % blockSize; rem != 0 {
+		d = append(d, make([]byte, blockSize-rem)...)
+	}
+	return d
+}
+
+// Digest computes the fs-verity file digest, as reported by
+// FS_IOC_MEASURE_VERITY
+func Digest(r io.Reader, p Params) ([]byte, error) {
+	_, rootHash, size, err := MerkleTree(r, p)
+	if err != nil {
+		return nil, err
+	}
+	desc := descriptor{
+		Version:       1,
+		HashAlgorithm: hashAlgorithms[p.Hash],
+		SaltSize:      uint8(len(p.Salt)),
+		DataSize:      uint64(size),
+	}
+	for p.BlockSize>>desc.LogBlockSize > 1 {
+		desc.LogBlockSize++
+	}
+	copy(desc.RootHash[:], rootHash)
+	copy(desc.Salt[:], p.Salt)
+	d := p.Hash.New()
+	_ = binary.Write(d, binary.LittleEndian, desc)
+	return d.Sum(nil), nil
+}
+
+// FormattedDigest returns the message that built-in signatures are made over
+func FormattedDigest(hash crypto.Hash, digest []byte) []byte {
+	var b bytes.Buffer
+	b.WriteString("FSVerity")
+	_ = binary.Write(&b, binary.LittleEndian, uint16(hashAlgorithms[hash]))
+	_ = binary.Write(&b, binary.LittleEndian, uint16(len(digest)))
+	b.Write(digest)
+	return b.Bytes()
+}
+
+// Sign a file digest, returning a DER PKCS#7 signature for
+// FS_IOC_ENABLE_VERITY. Like fsverity-utils, the signature has no
+// authenticated attributes or embedded certificates since the kernel finds the
+// certificate in the .fs-verity keyring.
+func Sign(cert *certloader.Certificate, hash crypto.Hash, digest []byte) (*pkcs9.TimestampedSignature, error) {
+	builder := pkcs7.NewBuilder(cert.Signer(), cert.Chain(), hash)
+	if err := builder.SetContentData(FormattedDigest(hash, digest)); err != nil {
+		return nil, err
+	}
+	psd, err := builder.Sign()
+	if err != nil {
+		return nil, err
+	}
+	sig, err := psd.Content.Verify(nil, false)
+	if err != nil {
+		return nil, fmt.Errorf("pkcs7: failed signature self-check: %w", err)
+	}
+	if _, err := psd.Detach(); err != nil {
+		return nil, err
+	}
+	psd.Content.Certificates = nil
+	der, err := psd.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return &pkcs9.TimestampedSignature{Signature: sig, Raw: der}, nil
+}
@@ -0,0 +1,65 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package fsverity_test
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sassoftware/relic/v7/lib/fsverity"
+)
+
+func TestMerkleTree(t *testing.T) {
+	t.Parallel()
+	p := fsverity.Params{Hash: crypto.SHA256, BlockSize: 4096}
+	// single block: the root is the hash of one block holding the data hash
+	data := []byte("hello")
+	tree, root, size, err := fsverity.MerkleTree(bytes.NewReader(data), p)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), size)
+	block := make([]byte, 4096)
+	copy(block, data)
+	leaf := sha256.Sum256(block)
+	level := make([]byte, 4096)
+	copy(level, leaf[:])
+	expected := sha256.Sum256(level)
+	assert.Equal(t, expected[:], root)
+	assert.Equal(t, level, tree)
+	// 129 blocks need a second level
+	tree, _, _, err = fsverity.MerkleTree(bytes.NewReader(make([]byte, 129*4096)), p)
+	require.NoError(t, err)
+	assert.Len(t, tree, 3*4096)
+	// empty files have no tree
+	tree, root, _, err = fsverity.MerkleTree(bytes.NewReader(nil), p)
+	require.NoError(t, err)
+	assert.Nil(t, tree)
+	assert.Equal(t, make([]byte, 32), root)
+	_, _, _, err = fsverity.MerkleTree(bytes.NewReader(nil), fsverity.Params{Hash: crypto.SHA256, BlockSize: 1000})
+	assert.Error(t, err)
+}
+
+func TestFormattedDigest(t *testing.T) {
+	t.Parallel()
+	digest := make([]byte, 32)
+	msg := fsverity.FormattedDigest(crypto.SHA256, digest)
+	assert.Equal(t, append([]byte("FSVerity\x01\x00\x20\x00"), digest...), msg)
+}
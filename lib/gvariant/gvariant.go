@@ -0,0 +1,346 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package gvariant implements the GVariant serialization format used by
+// OSTree and Flatpak.
+//
+// Values are decoded according to their type string as follows: y as uint8, b
+// as bool, n/q/i/u/x/t as the same-sized Go integer, d as float64, s/o/g as
+// string, v as Variant, ay as []byte, other arrays as []interface{}, tuples
+// and dict entries as []interface{}. Maybe types are not supported. Multi-byte
+// values are little-endian.
+package gvariant
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Variant is a value along with its type
+type Variant struct {
+	Type  string
+	Value interface{}
+}
+
+// DictEntry looks up a key in a decoded dictionary (a{..}) value
+func DictEntry(dict []interface{}, key interface{}) (interface{}, bool) {
+	for _, item := range dict {
+		entry, ok := item.([]interface{})
+		if ok && len(entry) == 2 && entry[0] == key {
+			return entry[1], true
+		}
+	}
+	return nil, false
+}
+
+// SetDictEntry replaces or appends an entry in a decoded dictionary value
+func SetDictEntry(dict []interface{}, key, value interface{}) []interface{} {
+	for i, item := range dict {
+		entry, ok := item.([]interface{})
+		if ok && len(entry) == 2 && entry[0] == key {
+			dict[i] = []interface{}{key, value}
+			return dict
+		}
+	}
+	return append(dict, []interface{}{key, value})
+}
+
+type typeInfo struct {
+	str       string
+	kind      byte
+	align     int
+	fixedSize int // 0 if variable size
+	elems     []*typeInfo
+}
+
+// Parse a type string into type info
+func parseType(s string) (*typeInfo, error) {
+	t, rest, err := parseOne(s)
+	if err != nil {
+		return nil, err
+	} else if rest != "" {
+		return nil, fmt.Errorf("gvariant: trailing garbage in type %q", s)
+	}
+	return t, nil
+}
+
+func parseOne(s string) (*typeInfo, string, error) {
+	if s == "" {
+		return nil, "", errors.New("gvariant: incomplete type")
+	}
+	t := &typeInfo{kind: s[0]}
+	rest := s[1:]
+	switch t.kind {
+	case 'y', 'b':
+		t.align, t.fixedSize = 1, 1
+	case 'n', 'q':
+		t.align, t.fixedSize = 2, 2
+	case 'i', 'u', 'h':
+		t.align, t.fixedSize = 4, 4
+	case 'x', 't', 'd':
+		t.align, t.fixedSize = 8, 8
+	case 's', 'o', 'g':
+		t.align = 1
+	case 'v':
+		t.align = 8
+	case 'a':
+		elem, r, err := parseOne(rest)
+		if err != nil {
+			return nil, "", err
+		}
+		rest = r
+		t.elems = []*typeInfo{elem}
+		t.align = elem.align
+	case '(', '{':
+		end := byte(')')
+		if t.kind == '{' {
+			end = '}'
+		}
+		t.align = 1
+		fixed := true
+		offset := 0
+		for {
+			if rest == "" {
+				return nil, "", errors.New("gvariant: unterminated tuple type")
+			}
+			if rest[0] == end {
+				rest = rest[1:]
+				break
+			}
+			elem, r, err := parseOne(rest)
+			if err != nil {
+				return nil, "", err
+			}
+			rest = r
+			t.elems = append(t.elems, elem)
+			if elem.align > t.align {
+				t.align = elem.align
+			}
+			if elem.fixedSize == 0 {
+				fixed = false
+			} else {
+				offset = alignUp(offset, elem.align) + elem.fixedSize
+			}
+		}
+		if t.kind == '{' && len(t.elems) != 2 {
+			return nil, "", errors.New("gvariant: dict entry must have 2 members")
+		}
+		if fixed {
+			if len(t.elems) == 0 {
+				t.fixedSize = 1
+			} else {
+				t.fixedSize = alignUp(offset, t.align)
+			}
+		}
+	default:
+		return nil, "", fmt.Errorf("gvariant: unsupported type %q", s)
+	}
+	t.str = s[:len(s)-len(rest)]
+	return t, rest, nil
+}
+
+func alignUp(n, align int) int {
+	return (n + align - 1) &^ (align - 1)
+}
+
+// Size of framing offsets for a container of the given size
+func offsetSize(size int) int {
+	switch {
+	case size == 0:
+		return 0
+	case size <= math.MaxUint8:
+		return 1
+	case size <= math.MaxUint16:
+		return 2
+	case size <= math.MaxUint32:
+		return 4
+	default:
+		return 8
+	}
+}
+
+// Read a framing offset of the given size from the start of b
+func readOffset(b []byte, size int) (int, error) {
+	if size == 0 || len(b) < size {
+		return 0, errShort
+	}
+	var v uint64
+	switch size {
+	case 1:
+		v = uint64(b[0])
+	case 2:
+		v = uint64(binary.LittleEndian.Uint16(b))
+	case 4:
+		v = uint64(binary.LittleEndian.Uint32(b))
+	default:
+		v = binary.LittleEndian.Uint64(b)
+	}
+	if v > math.MaxInt32 {
+		return 0, errors.New("gvariant: framing offset out of range")
+	}
+	return int(v), nil
+}
+
+// Unmarshal decodes a serialized value of the given type
+func Unmarshal(typeStr string, data []byte) (interface{}, error) {
+	t, err := parseType(typeStr)
+	if err != nil {
+		return nil, err
+	}
+	return decode(t, data)
+}
+
+var errShort = errors.New("gvariant: truncated value")
+
+func decode(t *typeInfo, data []byte) (interface{}, error) {
+	if t.fixedSize != 0 && len(data) != t.fixedSize {
+		return nil, fmt.Errorf("gvariant: wrong size %d for type %s", len(data), t.str)
+	}
+	// the size of fixed-size values was checked above
+	switch t.kind {
+	case 'y':
+		return data[0], nil
+	case 'b':
+		return data[0] != 0, nil
+	case 'n':
+		return int16(binary.LittleEndian.Uint16(data)), nil
+	case 'q':
+		return binary.LittleEndian.Uint16(data), nil
+	case 'i', 'h':
+		return int32(binary.LittleEndian.Uint32(data)), nil
+	case 'u':
+		return binary.LittleEndian.Uint32(data), nil
+	case 'x':
+		return int64(binary.LittleEndian.Uint64(data)), nil
+	case 't':
+		return binary.LittleEndian.Uint64(data), nil
+	case 'd':
+		return math.Float64frombits(binary.LittleEndian.Uint64(data)), nil
+	case 's', 'o', 'g':
+		if len(data) == 0 || data[len(data)-1] != 0 {
+			return nil, errors.New("gvariant: string is not nul-terminated")
+		}
+		return string(data[:len(data)-1]), nil
+	case 'v':
+		idx := -1
+		for i := len(data) - 1; i >= 0; i-- {
+			if data[i] == 0 {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			return nil, errors.New("gvariant: malformed variant")
+		}
+		childType := string(data[idx+1:])
+		child, err := Unmarshal(childType, data[:idx])
+		if err != nil {
+			return nil, err
+		}
+		return Variant{Type: childType, Value: child}, nil
+	case 'a':
+		return decodeArray(t.elems[0], data)
+	default:
+		return decodeTuple(t, data)
+	}
+}
+
+func decodeArray(elem *typeInfo, data []byte) (interface{}, error) {
+	if elem.kind == 'y' {
+		return append([]byte{}, data...), nil
+	}
+	var items [][]byte
+	if elem.fixedSize != 0 {
+		if len(data)%elem.fixedSize != 0 {
+			return nil, errors.New("gvariant: array size is not a multiple of the element size")
+		}
+		for i := 0; i < len(data); i += elem.fixedSize {
+			items = append(items, data[i:i+elem.fixedSize])
+		}
+	} else if len(data) != 0 {
+		osize := offsetSize(len(data))
+		offsetsStart, err := readOffset(data[len(data)-osize:], osize)
+		if err != nil {
+			return nil, err
+		}
+		if offsetsStart > len(data) || (len(data)-offsetsStart)%osize != 0 {
+			return nil, errors.New("gvariant: malformed array framing")
+		}
+		start := 0
+		for pos := offsetsStart; pos < len(data); pos += osize {
+			end, err := readOffset(data[pos:], osize)
+			if err != nil {
+				return nil, err
+			}
+			start = alignUp(start, elem.align)
+			if end < start || end > offsetsStart {
+				return nil, errors.New("gvariant: malformed array framing")
+			}
+			items = append(items, data[start:end])
+			start = end
+		}
+	}
+	ret := make([]interface{}, len(items))
+	for i, item := range items {
+		v, err := decode(elem, item)
+		if err != nil {
+			return nil, err
+		}
+		ret[i] = v
+	}
+	return ret, nil
+}
+
+func decodeTuple(t *typeInfo, data []byte) (interface{}, error) {
+	osize := offsetSize(len(data))
+	frameEnd := len(data)
+	pos := 0
+	ret := make([]interface{}, len(t.elems))
+	for i, elem := range t.elems {
+		pos = alignUp(pos, elem.align)
+		var end int
+		switch {
+		case elem.fixedSize != 0:
+			end = pos + elem.fixedSize
+		case i == len(t.elems)-1:
+			end = frameEnd
+		default:
+			// an empty tuple has no framing offsets, so this also catches
+			// variable-sized members with no room for one
+			if osize == 0 || frameEnd-osize < pos {
+				return nil, errShort
+			}
+			frameEnd -= osize
+			var err error
+			end, err = readOffset(data[frameEnd:], osize)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if pos > end || end > frameEnd {
+			return nil, errShort
+		}
+		v, err := decode(elem, data[pos:end])
+		if err != nil {
+			return nil, err
+		}
+		ret[i] = v
+		pos = end
+	}
+	return ret, nil
+}
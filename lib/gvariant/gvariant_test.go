@@ -0,0 +1,110 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package gvariant
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVectors(t *testing.T) {
+	vectors := []struct {
+		typeStr string
+		value   interface{}
+		encoded string
+	}{
+		{"(ss)", []interface{}{"hello", "world"}, "hello\x00world\x00\x06"},
+		{"as", []interface{}{"i", "can", "has", "strings?"}, "i\x00can\x00has\x00strings?\x00\x02\x06\x0a\x13"},
+		{"{si}", []interface{}{"a key", int32(514)}, "a key\x00\x00\x00\x02\x02\x00\x00\x06"},
+		{"ai", []interface{}{int32(4), int32(258)}, "\x04\x00\x00\x00\x02\x01\x00\x00"},
+		{"v", Variant{Type: "s", Value: "x"}, "x\x00\x00s"},
+		{"(yy)", []interface{}{uint8(1), uint8(2)}, "\x01\x02"},
+		{"ay", []byte("abc"), "abc"},
+	}
+	for _, v := range vectors {
+		encoded, err := Marshal(v.typeStr, v.value)
+		require.NoError(t, err, v.typeStr)
+		assert.Equal(t, v.encoded, string(encoded), v.typeStr)
+		decoded, err := Unmarshal(v.typeStr, encoded)
+		require.NoError(t, err, v.typeStr)
+		assert.Equal(t, v.value, decoded, v.typeStr)
+	}
+}
+
+func TestRoundTripDict(t *testing.T) {
+	dict := []interface{}{
+		[]interface{}{"ostree.ref-binding", Variant{Type: "as", Value: []interface{}{"stable"}}},
+		[]interface{}{"ostree.sign.ed25519", Variant{Type: "aay", Value: []interface{}{make([]byte, 64), []byte{1, 2, 3}}}},
+	}
+	value := []interface{}{dict, uint64(1700000000), []byte{}, []interface{}{}}
+	encoded, err := Marshal("(a{sv}tayaay)", value)
+	require.NoError(t, err)
+	decoded, err := Unmarshal("(a{sv}tayaay)", encoded)
+	require.NoError(t, err)
+	assert.Equal(t, value, decoded)
+	v, ok := DictEntry(decoded.([]interface{})[0].([]interface{}), "ostree.sign.ed25519")
+	require.True(t, ok)
+	assert.Equal(t, "aay", v.(Variant).Type)
+}
+
+func TestTruncated(t *testing.T) {
+	vectors := []struct {
+		typeStr string
+		encoded string
+	}{
+		{"a{sv}", "\x00"},
+		{"(ss)", ""},
+		{"(ss)", "\x00"},
+		{"(ss)", "a\x00b\x00\x09"},
+		{"(sv)", "a\x00\x00"},
+		{"as", "\x00\x05"},
+		{"as", "a\x00\x05"},
+		{"(is)", "\x01\x00"},
+		{"y", ""},
+		{"t", "\x01\x02"},
+		{"v", "\x00"},
+		{"v", "x\x00\x00(ss)"},
+	}
+	for _, v := range vectors {
+		_, err := Unmarshal(v.typeStr, []byte(v.encoded))
+		assert.Error(t, err, "%s %q", v.typeStr, v.encoded)
+	}
+}
+
+func FuzzUnmarshal(f *testing.F) {
+	seeds := []struct {
+		typeStr string
+		value   interface{}
+	}{
+		{"a{sv}", []interface{}{[]interface{}{"key", Variant{Type: "as", Value: []interface{}{"a", "bc"}}}}},
+		{"(a{sv}tayaay)", []interface{}{[]interface{}{}, uint64(1), []byte{1}, []interface{}{[]byte{2}}}},
+	}
+	for _, seed := range seeds {
+		encoded, err := Marshal(seed.typeStr, seed.value)
+		require.NoError(f, err)
+		f.Add(seed.typeStr, encoded)
+		for i := range encoded {
+			f.Add(seed.typeStr, encoded[:i])
+		}
+	}
+	f.Fuzz(func(t *testing.T, typeStr string, data []byte) {
+		// only needs to not panic
+		_, _ = Unmarshal(typeStr, data)
+	})
+}
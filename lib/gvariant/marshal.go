@@ -0,0 +1,193 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package gvariant
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Marshal encodes a value of the given type in normal form
+func Marshal(typeStr string, value interface{}) ([]byte, error) {
+	t, err := parseType(typeStr)
+	if err != nil {
+		return nil, err
+	}
+	return encode(t, value)
+}
+
+func typeError(t *typeInfo, value interface{}) error {
+	return fmt.Errorf("gvariant: can't encode %T as %s", value, t.str)
+}
+
+func encode(t *typeInfo, value interface{}) ([]byte, error) {
+	var buf []byte
+	ok := true
+	switch t.kind {
+	case 'y':
+		var v uint8
+		v, ok = value.(uint8)
+		buf = []byte{v}
+	case 'b':
+		var v bool
+		v, ok = value.(bool)
+		buf = []byte{0}
+		if v {
+			buf[0] = 1
+		}
+	case 'n':
+		var v int16
+		v, ok = value.(int16)
+		buf = appendUint(nil, 2, uint64(uint16(v)))
+	case 'q':
+		var v uint16
+		v, ok = value.(uint16)
+		buf = appendUint(nil, 2, uint64(v))
+	case 'i', 'h':
+		var v int32
+		v, ok = value.(int32)
+		buf = appendUint(nil, 4, uint64(uint32(v)))
+	case 'u':
+		var v uint32
+		v, ok = value.(uint32)
+		buf = appendUint(nil, 4, uint64(v))
+	case 'x':
+		var v int64
+		v, ok = value.(int64)
+		buf = appendUint(nil, 8, uint64(v))
+	case 't':
+		var v uint64
+		v, ok = value.(uint64)
+		buf = appendUint(nil, 8, v)
+	case 'd':
+		var v float64
+		v, ok = value.(float64)
+		buf = appendUint(nil, 8, math.Float64bits(v))
+	case 's', 'o', 'g':
+		var v string
+		v, ok = value.(string)
+		buf = append([]byte(v), 0)
+	case 'v':
+		var v Variant
+		v, ok = value.(Variant)
+		if ok {
+			child, err := Marshal(v.Type, v.Value)
+			if err != nil {
+				return nil, err
+			}
+			buf = append(child, 0)
+			buf = append(buf, v.Type...)
+		}
+	case 'a':
+		return encodeArray(t, value)
+	default:
+		return encodeTuple(t, value)
+	}
+	if !ok {
+		return nil, typeError(t, value)
+	}
+	return buf, nil
+}
+
+func encodeArray(t *typeInfo, value interface{}) ([]byte, error) {
+	elem := t.elems[0]
+	if elem.kind == 'y' {
+		if b, ok := value.([]byte); ok {
+			return append([]byte{}, b...), nil
+		}
+	}
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil, typeError(t, value)
+	}
+	var buf []byte
+	var ends []int
+	for _, item := range items {
+		for len(buf)%elem.align != 0 {
+			buf = append(buf, 0)
+		}
+		child, err := encode(elem, item)
+		if err != nil {
+			return nil, err
+		}
+		buf = append(buf, child...)
+		ends = append(ends, len(buf))
+	}
+	if elem.fixedSize != 0 {
+		return buf, nil
+	}
+	return appendOffsets(buf, ends), nil
+}
+
+func encodeTuple(t *typeInfo, value interface{}) ([]byte, error) {
+	items, ok := value.([]interface{})
+	if !ok || len(items) != len(t.elems) {
+		return nil, typeError(t, value)
+	}
+	if len(items) == 0 {
+		return []byte{0}, nil
+	}
+	var buf []byte
+	var ends []int
+	for i, elem := range t.elems {
+		for len(buf)%elem.align != 0 {
+			buf = append(buf, 0)
+		}
+		child, err := encode(elem, items[i])
+		if err != nil {
+			return nil, err
+		}
+		buf = append(buf, child...)
+		if elem.fixedSize == 0 && i != len(t.elems)-1 {
+			ends = append(ends, len(buf))
+		}
+	}
+	if t.fixedSize != 0 {
+		for len(buf) < t.fixedSize {
+			buf = append(buf, 0)
+		}
+		return buf, nil
+	}
+	// tuple offsets are stored in reverse order
+	for i, j := 0, len(ends)-1; i < j; i, j = i+1, j-1 {
+		ends[i], ends[j] = ends[j], ends[i]
+	}
+	return appendOffsets(buf, ends), nil
+}
+
+// Append framing offsets using the smallest offset size that can address the
+// whole container
+func appendOffsets(buf []byte, ends []int) []byte {
+	if len(ends) == 0 {
+		return buf
+	}
+	osize := 1
+	for offsetSize(len(buf)+len(ends)*osize) != osize {
+		osize *= 2
+	}
+	for _, end := range ends {
+		buf = appendUint(buf, osize, uint64(end))
+	}
+	return buf
+}
+
+func appendUint(buf []byte, size int, v uint64) []byte {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+	return append(buf, b[:size]...)
+}
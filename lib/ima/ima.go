@@ -0,0 +1,140 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package ima implements digital signatures for the Linux Integrity
+// Measurement Architecture, stored in the security.ima extended attribute.
+package ima
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+)
+
+// XattrName is the extended attribute holding the file signature
+const XattrName = "security.ima"
+
+const (
+	xattrDigsig = 3
+	sigVersion2 = 2
+)
+
+// kernel's enum hash_algo
+var hashAlgos = map[crypto.Hash]uint8{
+	crypto.SHA1:   2,
+	crypto.SHA256: 4,
+	crypto.SHA384: 5,
+	crypto.SHA512: 6,
+	crypto.SHA224: 7,
+}
+
+// struct signature_v2_hdr from the kernel, including the leading xattr type
+type sigHeader struct {
+	Type     uint8
+	Version  uint8
+	HashAlgo uint8
+	KeyID    uint32
+	SigSize  uint16
+}
+
+const sigHeaderSize = 9
+
+// KeyID returns the identifier the kernel uses to find the key in the .ima
+// keyring, which is the last 4 bytes of the certificate's subject key ID
+func KeyID(cert *x509.Certificate) (uint32, error) {
+	skid := cert.SubjectKeyId
+	if len(skid) < 4 {
+		var err error
+		skid, err = x509tools.SubjectKeyID(cert.PublicKey)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return binary.BigEndian.Uint32(skid[len(skid)-4:]), nil
+}
+
+// Sign a file digest and return the xattr value
+func Sign(signer crypto.Signer, keyID uint32, hash crypto.Hash, digest []byte) ([]byte, error) {
+	algo, ok := hashAlgos[hash]
+	if !ok {
+		return nil, fmt.Errorf("ima: unsupported hash %s", hash)
+	}
+	sig, err := signer.Sign(rand.Reader, digest, hash)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	_ = binary.Write(&b, binary.BigEndian, sigHeader{
+		Type:     xattrDigsig,
+		Version:  sigVersion2,
+		HashAlgo: algo,
+		KeyID:    keyID,
+		SigSize:  uint16(len(sig)),
+	})
+	b.Write(sig)
+	return b.Bytes(), nil
+}
+
+// SignReader digests a file and returns the xattr value
+func SignReader(r io.Reader, signer crypto.Signer, keyID uint32, hash crypto.Hash) ([]byte, error) {
+	d := hash.New()
+	if _, err := io.Copy(d, r); err != nil {
+		return nil, err
+	}
+	return Sign(signer, keyID, hash, d.Sum(nil))
+}
+
+// Verify a xattr value against the file contents and a certificate
+func Verify(xattr []byte, r io.Reader, cert *x509.Certificate) error {
+	var hdr sigHeader
+	if len(xattr) < sigHeaderSize {
+		return errors.New("ima: signature is truncated")
+	}
+	_ = binary.Read(bytes.NewReader(xattr), binary.BigEndian, &hdr)
+	if hdr.Type != xattrDigsig || hdr.Version != sigVersion2 {
+		return fmt.Errorf("ima: unsupported signature type %d version %d", hdr.Type, hdr.Version)
+	}
+	sig := xattr[sigHeaderSize:]
+	if int(hdr.SigSize) != len(sig) {
+		return errors.New("ima: signature size mismatch")
+	}
+	var hash crypto.Hash
+	for h, algo := range hashAlgos {
+		if algo == hdr.HashAlgo {
+			hash = h
+		}
+	}
+	if hash == 0 {
+		return fmt.Errorf("ima: unsupported hash algorithm %d", hdr.HashAlgo)
+	}
+	if keyID, err := KeyID(cert); err != nil {
+		return err
+	} else if keyID != hdr.KeyID {
+		return fmt.Errorf("ima: signature key ID %08x does not match certificate", hdr.KeyID)
+	}
+	d := hash.New()
+	if _, err := io.Copy(d, r); err != nil {
+		return err
+	}
+	return x509tools.Verify(cert.PublicKey, hash, d.Sum(nil), sig)
+}
@@ -0,0 +1,66 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package ima_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sassoftware/relic/v7/internal/testcert"
+	"github.com/sassoftware/relic/v7/lib/ima"
+)
+
+func TestSignTree(t *testing.T) {
+	t.Parallel()
+	key := testcert.ECDSAKey(t)
+	cert := testcert.Issue(t, &x509.Certificate{
+		Subject:      pkix.Name{CommonName: "ima"},
+		SubjectKeyId: []byte{1, 2, 3, 4, 5, 6, 7, 8},
+	}, key, nil, nil)
+	keyID, err := ima.KeyID(cert)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(0x05060708), keyID)
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "./usr/bin", Typeflag: tar.TypeDir, Mode: 0755}))
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "./usr/bin/hello", Typeflag: tar.TypeReg, Mode: 0755, Size: 5}))
+	_, err = tw.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+
+	sigs := make(map[string][]byte)
+	err = ima.SignTree(&buf, key, keyID, crypto.SHA256, func(name string, xattr []byte) error {
+		sigs[name] = xattr
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, sigs, 1)
+	xattr := sigs["/usr/bin/hello"]
+	require.NotNil(t, xattr)
+	assert.Equal(t, []byte{3, 2, 4}, xattr[:3])
+	assert.NoError(t, ima.Verify(xattr, strings.NewReader("hello"), cert))
+	assert.Error(t, ima.Verify(xattr, strings.NewReader("hellO"), cert))
+}
@@ -0,0 +1,60 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package ima
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"crypto"
+	"io"
+	"path"
+)
+
+// SignTree signs every regular file in a tar archive, optionally gzipped,
+// calling emit with the cleaned path and xattr value of each one
+func SignTree(r io.Reader, signer crypto.Signer, keyID uint32, hash crypto.Hash, emit func(name string, xattr []byte) error) error {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return err
+		}
+		r = zr
+	} else {
+		r = br
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		xattr, err := SignReader(tr, signer, keyID, hash)
+		if err != nil {
+			return err
+		}
+		if err := emit(path.Clean("/"+hdr.Name), xattr); err != nil {
+			return err
+		}
+	}
+}
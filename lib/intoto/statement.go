@@ -0,0 +1,97 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package intoto builds in-toto attestation statements.
+package intoto
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+const (
+	// PayloadType is the DSSE payload type of an in-toto statement
+	PayloadType = "application/vnd.in-toto+json"
+	// StatementType is the type of an in-toto v1 statement
+	StatementType = "https://in-toto.io/Statement/v1"
+)
+
+// Statement binds a predicate to one or more artifacts
+type Statement struct {
+	Type          string          `json:"_type"`
+	Subject       []Subject       `json:"subject"`
+	PredicateType string          `json:"predicateType"`
+	Predicate     json.RawMessage `json:"predicate,omitempty"`
+}
+
+// Subject identifies an artifact by name and digest
+type Subject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// NewStatement returns a statement about a single artifact with a SHA-256
+// digest
+func NewStatement(name string, sha256 []byte, predicateType string, predicate interface{}) (*Statement, error) {
+	s := &Statement{
+		Type:          StatementType,
+		Subject:       []Subject{{Name: name, Digest: map[string]string{"sha256": hex.EncodeToString(sha256)}}},
+		PredicateType: predicateType,
+	}
+	if predicate != nil {
+		blob, err := json.Marshal(predicate)
+		if err != nil {
+			return nil, err
+		}
+		s.Predicate = blob
+	}
+	return s, nil
+}
+
+// Parse a statement
+func Parse(blob []byte) (*Statement, error) {
+	s := new(Statement)
+	if err := json.Unmarshal(blob, s); err != nil {
+		return nil, fmt.Errorf("parsing in-toto statement: %w", err)
+	}
+	if s.Type != StatementType && s.Type != "https://in-toto.io/Statement/v0.1" {
+		return nil, fmt.Errorf("unsupported in-toto statement type %q", s.Type)
+	}
+	return s, nil
+}
+
+// CheckSubject returns an error unless the statement has a subject with the
+// given name and SHA-256 digest. An empty name matches any subject name.
+func (s *Statement) CheckSubject(name string, sha256 []byte) error {
+	return s.CheckSubjectDigest(name, "sha256", sha256)
+}
+
+// CheckSubjectDigest is like CheckSubject but for any digest algorithm, named
+// as in the statement's digest set
+func (s *Statement) CheckSubjectDigest(name, algorithm string, digest []byte) error {
+	want := hex.EncodeToString(digest)
+	for _, subj := range s.Subject {
+		if (name == "" || subj.Name == name) && subj.Digest[algorithm] == want {
+			return nil
+		}
+	}
+	if name == "" {
+		return errors.New("in-toto statement does not match the artifact digest")
+	}
+	return fmt.Errorf("in-toto statement has no subject matching %s", name)
+}
@@ -0,0 +1,221 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package isoimage signs ISO 9660 images. The signature covers the whole
+// image, read as a stream, with two regions normalized first:
+//
+// The Application Use field of the primary volume descriptor is treated as
+// spaces, the same as isomd5sum does, so that a checksum can be implanted with
+// implantisomd5 after signing without invalidating the signature.
+//
+// The last 8 KiB of the system area (the 16 sectors before the first volume
+// descriptor) can hold an embedded signature. When it does, it is treated as
+// zeroes. Hybrid images keep their MBR, GPT and Apple partition map in the
+// first part of the system area, so the slot is only used if it is empty.
+package isoimage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sassoftware/relic/v7/lib/binpatch"
+)
+
+const (
+	SectorSize = 2048
+	// The volume descriptors start after the 16 sector system area
+	firstDescriptor = 16
+	// Don't look through more descriptors than this for the primary one
+	maxDescriptors = 32
+
+	// SignatureOffset and SignatureSize locate the slot in the system area
+	// that holds an embedded signature
+	SignatureOffset = 12 * SectorSize
+	SignatureSize   = 4 * SectorSize
+
+	// Application Use field of the primary volume descriptor, where
+	// implantisomd5 stores its checksum
+	appUseOffset = 883
+	appUseSize   = 512
+)
+
+// SignatureMagic starts the header of an embedded signature
+var SignatureMagic = [8]byte{'R', 'E', 'L', 'I', 'C', 'I', 'S', 'O'}
+
+// SignatureType identifies the format of an embedded signature
+type SignatureType uint32
+
+const (
+	// SignatureCMS is a detached CMS SignedData structure
+	SignatureCMS SignatureType = 1
+	// SignaturePGP is a binary detached OpenPGP signature
+	SignaturePGP SignatureType = 2
+)
+
+func (t SignatureType) String() string {
+	switch t {
+	case SignatureCMS:
+		return "cms"
+	case SignaturePGP:
+		return "pgp"
+	default:
+		return fmt.Sprintf("type-%d", uint32(t))
+	}
+}
+
+type sigHeader struct {
+	Magic  [8]byte
+	Type   SignatureType
+	Length uint32
+}
+
+const sigHeaderSize = 16
+
+// Image is an ISO 9660 image that is being read as a stream. The system area
+// and volume descriptors are read up front, the rest is read through Reader.
+type Image struct {
+	// VolumeID is the volume identifier from the primary volume descriptor
+	VolumeID string
+	// VolumeSize is the size of the volume in bytes according to the primary
+	// volume descriptor
+	VolumeSize int64
+
+	head     []byte
+	canon    []byte
+	rest     io.Reader
+	consumed bool
+	sigType  SignatureType
+	sig      []byte
+}
+
+// Read the system area and volume descriptors of an ISO 9660 image
+func Read(r io.Reader) (*Image, error) {
+	head := make([]byte, (firstDescriptor+1)*SectorSize)
+	if _, err := io.ReadFull(r, head); err != nil {
+		if err == io.ErrUnexpectedEOF || err == io.EOF {
+			return nil, errors.New("iso: image is too small")
+		}
+		return nil, err
+	}
+	// find the primary volume descriptor
+	pvd := -1
+	for i := 0; i < maxDescriptors; i++ {
+		desc := head[len(head)-SectorSize:]
+		if string(desc[1:6]) != "CD001" {
+			return nil, errors.New("iso: not an ISO 9660 image")
+		} else if desc[0] == 1 {
+			pvd = len(head) - SectorSize
+			break
+		} else if desc[0] == 255 {
+			// set terminator
+			break
+		}
+		next := make([]byte, SectorSize)
+		if _, err := io.ReadFull(r, next); err != nil {
+			return nil, fmt.Errorf("iso: reading volume descriptors: %w", err)
+		}
+		head = append(head, next...)
+	}
+	if pvd < 0 {
+		return nil, errors.New("iso: primary volume descriptor not found")
+	}
+	desc := head[pvd : pvd+SectorSize]
+	blockSize := int64(binary.LittleEndian.Uint16(desc[128:130]))
+	img := &Image{
+		VolumeID:   strings.TrimRight(string(desc[40:72]), " \x00"),
+		VolumeSize: int64(binary.LittleEndian.Uint32(desc[80:84])) * blockSize,
+		head:       head,
+		rest:       r,
+	}
+	if err := img.readEmbedded(); err != nil {
+		return nil, err
+	}
+	// normalize the regions that are not signed
+	img.canon = append([]byte(nil), head...)
+	copy(img.canon[pvd+appUseOffset:pvd+appUseOffset+appUseSize], bytes.Repeat([]byte{' '}, appUseSize))
+	if img.sig != nil {
+		copy(img.canon[SignatureOffset:SignatureOffset+SignatureSize], make([]byte, SignatureSize))
+	}
+	return img, nil
+}
+
+// parse the embedded signature, if any
+func (i *Image) readEmbedded() error {
+	slot := i.head[SignatureOffset : SignatureOffset+SignatureSize]
+	if !bytes.HasPrefix(slot, SignatureMagic[:]) {
+		return nil
+	}
+	var hdr sigHeader
+	_ = binary.Read(bytes.NewReader(slot), binary.BigEndian, &hdr)
+	end := sigHeaderSize + int(hdr.Length)
+	if hdr.Length == 0 || end > len(slot) {
+		return errors.New("iso: invalid embedded signature length")
+	}
+	// nothing else may be hidden in the slot, since it isn't signed
+	for _, b := range slot[end:] {
+		if b != 0 {
+			return errors.New("iso: unexpected data after embedded signature")
+		}
+	}
+	i.sigType = hdr.Type
+	i.sig = slot[sigHeaderSize:end]
+	return nil
+}
+
+// Embedded returns the signature embedded in the system area, if any
+func (i *Image) Embedded() (SignatureType, []byte) {
+	return i.sigType, i.sig
+}
+
+// Reader returns the normalized image stream that is signed. It can only be
+// read once.
+func (i *Image) Reader() (io.Reader, error) {
+	if i.consumed {
+		return nil, errors.New("iso: image was already read")
+	}
+	i.consumed = true
+	return io.MultiReader(bytes.NewReader(i.canon), i.rest), nil
+}
+
+// EmbedPatch returns a patch that writes the given signature into the system
+// area of the image
+func (i *Image) EmbedPatch(sigType SignatureType, sig []byte) (*binpatch.PatchSet, error) {
+	if i.sig == nil {
+		for _, b := range i.head[SignatureOffset : SignatureOffset+SignatureSize] {
+			if b != 0 {
+				return nil, errors.New("iso: the end of the system area is in use, so the signature can't be embedded")
+			}
+		}
+	}
+	if len(sig) > SignatureSize-sigHeaderSize {
+		return nil, fmt.Errorf("iso: signature is %d bytes but only %d fit in the system area", len(sig), SignatureSize-sigHeaderSize)
+	}
+	var b bytes.Buffer
+	_ = binary.Write(&b, binary.BigEndian, sigHeader{
+		Magic:  SignatureMagic,
+		Type:   sigType,
+		Length: uint32(len(sig)),
+	})
+	b.Write(sig)
+	b.Write(make([]byte, SignatureSize-b.Len()))
+	patch := binpatch.New()
+	patch.Add(SignatureOffset, SignatureSize, b.Bytes())
+	return patch, nil
+}
@@ -0,0 +1,164 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package isoimage_test
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+
+	"github.com/sassoftware/relic/v7/internal/testcert"
+	"github.com/sassoftware/relic/v7/lib/isoimage"
+)
+
+// build a minimal image with a primary volume descriptor, a boot record, a
+// terminator and some data sectors
+func testImage() []byte {
+	img := make([]byte, 24*isoimage.SectorSize)
+	desc := func(sector int, typ byte) []byte {
+		d := img[sector*isoimage.SectorSize : (sector+1)*isoimage.SectorSize]
+		d[0] = typ
+		copy(d[1:], "CD001\x01")
+		return d
+	}
+	pvd := desc(16, 1)
+	copy(pvd[40:72], bytes.Repeat([]byte{' '}, 32))
+	copy(pvd[40:], "TEST_VOLUME")
+	binary.LittleEndian.PutUint32(pvd[80:], 24)
+	binary.BigEndian.PutUint32(pvd[84:], 24)
+	binary.LittleEndian.PutUint16(pvd[128:], isoimage.SectorSize)
+	desc(17, 0)
+	desc(18, 255)
+	// stand-ins for a MBR and the image contents
+	copy(img, "boot code")
+	copy(img[20*isoimage.SectorSize:], "file contents")
+	return img
+}
+
+// implant a checksum the way implantisomd5 does
+func implant(img []byte, text string) {
+	appUse := img[16*isoimage.SectorSize+883 : 16*isoimage.SectorSize+883+512]
+	copy(appUse, bytes.Repeat([]byte{' '}, 512))
+	copy(appUse, text)
+}
+
+func TestRead(t *testing.T) {
+	img, err := isoimage.Read(bytes.NewReader(testImage()))
+	require.NoError(t, err)
+	assert.Equal(t, "TEST_VOLUME", img.VolumeID)
+	assert.Equal(t, int64(24*isoimage.SectorSize), img.VolumeSize)
+	_, sig := img.Embedded()
+	assert.Nil(t, sig)
+
+	_, err = isoimage.Read(bytes.NewReader(make([]byte, 100)))
+	assert.EqualError(t, err, "iso: image is too small")
+	_, err = isoimage.Read(bytes.NewReader(make([]byte, 24*isoimage.SectorSize)))
+	assert.EqualError(t, err, "iso: not an ISO 9660 image")
+}
+
+func TestCMS(t *testing.T) {
+	key := testcert.ECDSAKey(t)
+	cert := testcert.Signer(t, &x509.Certificate{Subject: pkix.Name{CommonName: "iso signer"}}, key)
+	img, err := isoimage.Read(bytes.NewReader(testImage()))
+	require.NoError(t, err)
+	ts, err := img.SignCMS(context.Background(), cert, crypto.SHA256, time.Now())
+	require.NoError(t, err)
+
+	// still valid after implanting a checksum
+	blob := testImage()
+	implant(blob, "ISO MD5SUM = 0123456789abcdef0123456789abcdef;SKIPSECTORS = 15;")
+	img, err = isoimage.Read(bytes.NewReader(blob))
+	require.NoError(t, err)
+	verified, err := img.VerifyCMS(ts.Raw, false)
+	require.NoError(t, err)
+	assert.Equal(t, cert.Leaf, verified.Certificate)
+
+	// but not after changing the contents
+	blob[20*isoimage.SectorSize] = 'F'
+	img, err = isoimage.Read(bytes.NewReader(blob))
+	require.NoError(t, err)
+	_, err = img.VerifyCMS(ts.Raw, false)
+	assert.EqualError(t, err, "iso: image digest does not match signature")
+	// or the system area outside of the signature slot
+	blob = testImage()
+	blob[0] = 'B'
+	img, err = isoimage.Read(bytes.NewReader(blob))
+	require.NoError(t, err)
+	_, err = img.VerifyCMS(ts.Raw, false)
+	assert.Error(t, err)
+}
+
+func TestEmbedded(t *testing.T) {
+	entity, err := openpgp.NewEntity("test", "", "test@example.com", &packet.Config{RSABits: 1024})
+	require.NoError(t, err)
+	blob := testImage()
+	img, err := isoimage.Read(bytes.NewReader(blob))
+	require.NoError(t, err)
+	sig, err := img.SignPGP(entity, nil)
+	require.NoError(t, err)
+	_, err = img.SignPGP(entity, nil)
+	assert.EqualError(t, err, "iso: image was already read")
+	patch, err := img.EmbedPatch(isoimage.SignaturePGP, sig)
+	require.NoError(t, err)
+	signed, err := patch.ApplyBytes(blob)
+	require.NoError(t, err)
+	assert.Len(t, signed, len(blob))
+
+	img, err = isoimage.Read(bytes.NewReader(signed))
+	require.NoError(t, err)
+	sigType, embedded := img.Embedded()
+	assert.Equal(t, isoimage.SignaturePGP, sigType)
+	assert.Equal(t, sig, embedded)
+	_, err = img.VerifyPGP(embedded, openpgp.EntityList{entity})
+	require.NoError(t, err)
+
+	// re-signing replaces the embedded signature
+	img, err = isoimage.Read(bytes.NewReader(signed))
+	require.NoError(t, err)
+	sig2, err := img.SignPGP(entity, nil)
+	require.NoError(t, err)
+	_, err = img.EmbedPatch(isoimage.SignaturePGP, sig2)
+	require.NoError(t, err)
+
+	// data hidden after the signature is rejected
+	signed[isoimage.SignatureOffset+isoimage.SignatureSize-1] = 1
+	_, err = isoimage.Read(bytes.NewReader(signed))
+	assert.EqualError(t, err, "iso: unexpected data after embedded signature")
+}
+
+func TestEmbedInUse(t *testing.T) {
+	blob := testImage()
+	blob[isoimage.SignatureOffset+100] = 1
+	img, err := isoimage.Read(bytes.NewReader(blob))
+	require.NoError(t, err)
+	_, err = img.EmbedPatch(isoimage.SignatureCMS, []byte("sig"))
+	assert.EqualError(t, err, "iso: the end of the system area is in use, so the signature can't be embedded")
+	img, err = isoimage.Read(bytes.NewReader(testImage()))
+	require.NoError(t, err)
+	_, err = img.EmbedPatch(isoimage.SignatureCMS, make([]byte, isoimage.SignatureSize))
+	assert.Error(t, err)
+}
@@ -0,0 +1,131 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package isoimage
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"errors"
+	"io"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/pgptools"
+	"github.com/sassoftware/relic/v7/lib/pkcs7"
+	"github.com/sassoftware/relic/v7/lib/pkcs9"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+)
+
+func (i *Image) digest(hash crypto.Hash) ([]byte, error) {
+	r, err := i.Reader()
+	if err != nil {
+		return nil, err
+	}
+	d := hash.New()
+	if _, err := io.Copy(d, r); err != nil {
+		return nil, err
+	}
+	return d.Sum(nil), nil
+}
+
+// SignCMS reads the rest of the image and returns a detached CMS signature
+// over it. Images can be much larger than memory, so the signature is built
+// from the digest of the content.
+func (i *Image) SignCMS(ctx context.Context, cert *certloader.Certificate, hash crypto.Hash, signingTime time.Time) (*pkcs9.TimestampedSignature, error) {
+	digest, err := i.digest(hash)
+	if err != nil {
+		return nil, err
+	}
+	builder := pkcs7.NewBuilder(cert.Signer(), cert.Chain(), hash)
+	if err := builder.SetDetachedContent(pkcs7.OidData, digest); err != nil {
+		return nil, err
+	}
+	if err := builder.AddAuthenticatedAttribute(pkcs7.OidAttributeSigningTime, signingTime.UTC()); err != nil {
+		return nil, err
+	}
+	psd, err := builder.Sign()
+	if err != nil {
+		return nil, err
+	}
+	return pkcs9.TimestampAndMarshal(ctx, psd, cert.Timestamper, false)
+}
+
+// VerifyCMS reads the rest of the image and checks a detached CMS signature
+// over it. X509 chains are not validated.
+func (i *Image) VerifyCMS(der []byte, skipDigests bool) (*pkcs9.TimestampedSignature, error) {
+	psd, err := pkcs7.Unmarshal(der)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := psd.Content.Verify(nil, true)
+	if err != nil {
+		return nil, err
+	}
+	if len(sig.SignerInfo.AuthenticatedAttributes) == 0 {
+		return nil, errors.New("iso: CMS signature has no message digest")
+	}
+	if !skipDigests {
+		hash, err := x509tools.PkixDigestToHashE(sig.SignerInfo.DigestAlgorithm)
+		if err != nil {
+			return nil, err
+		}
+		var expected []byte
+		if err := sig.SignerInfo.AuthenticatedAttributes.GetOne(pkcs7.OidAttributeMessageDigest, &expected); err != nil {
+			return nil, err
+		}
+		digest, err := i.digest(hash)
+		if err != nil {
+			return nil, err
+		} else if !hmac.Equal(digest, expected) {
+			return nil, errors.New("iso: image digest does not match signature")
+		}
+	}
+	ts, err := pkcs9.VerifyOptionalTimestamp(sig)
+	if err != nil {
+		return nil, err
+	}
+	return &ts, nil
+}
+
+// SignPGP reads the rest of the image and returns a binary detached OpenPGP
+// signature over it
+func (i *Image) SignPGP(signer *openpgp.Entity, config *packet.Config) ([]byte, error) {
+	r, err := i.Reader()
+	if err != nil {
+		return nil, err
+	}
+	var sig bytes.Buffer
+	if err := openpgp.DetachSign(&sig, signer, r, config); err != nil {
+		return nil, err
+	}
+	return sig.Bytes(), nil
+}
+
+// VerifyPGP reads the rest of the image and checks a binary detached OpenPGP
+// signature over it
+func (i *Image) VerifyPGP(sig []byte, keyring openpgp.EntityList) (*pgptools.PgpSignature, error) {
+	r, err := i.Reader()
+	if err != nil {
+		return nil, err
+	}
+	return pgptools.VerifyDetached(bytes.NewReader(sig), r, keyring)
+}
@@ -0,0 +1,170 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jose
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+)
+
+// Algorithm is a JWS signature algorithm from RFC 7518 or RFC 8037
+type Algorithm string
+
+const (
+	RS256 Algorithm = "RS256"
+	RS384 Algorithm = "RS384"
+	RS512 Algorithm = "RS512"
+	PS256 Algorithm = "PS256"
+	PS384 Algorithm = "PS384"
+	PS512 Algorithm = "PS512"
+	ES256 Algorithm = "ES256"
+	ES384 Algorithm = "ES384"
+	ES512 Algorithm = "ES512"
+	EdDSA Algorithm = "EdDSA"
+)
+
+var algHashes = map[Algorithm]crypto.Hash{
+	RS256: crypto.SHA256, RS384: crypto.SHA384, RS512: crypto.SHA512,
+	PS256: crypto.SHA256, PS384: crypto.SHA384, PS512: crypto.SHA512,
+	ES256: crypto.SHA256, ES384: crypto.SHA384, ES512: crypto.SHA512,
+}
+
+// Hash returns the digest algorithm, which is 0 for EdDSA
+func (a Algorithm) Hash() crypto.Hash {
+	return algHashes[a]
+}
+
+// AlgorithmFor picks the algorithm for a key. RSA keys use the given hash
+// and either PKCS#1 v1.5 or PSS padding, while ECDSA keys use the hash that
+// JWS pairs with their curve.
+func AlgorithmFor(pub crypto.PublicKey, hash crypto.Hash, pss bool) (Algorithm, error) {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		prefix := "RS"
+		if pss {
+			prefix = "PS"
+		}
+		switch hash {
+		case crypto.SHA256:
+			return Algorithm(prefix + "256"), nil
+		case crypto.SHA384:
+			return Algorithm(prefix + "384"), nil
+		case crypto.SHA512:
+			return Algorithm(prefix + "512"), nil
+		}
+		return "", fmt.Errorf("unsupported hash %s for JWS", x509tools.HashNames[hash])
+	case *ecdsa.PublicKey:
+		switch k.Curve.Params().BitSize {
+		case 256:
+			return ES256, nil
+		case 384:
+			return ES384, nil
+		case 521:
+			return ES512, nil
+		}
+		return "", errors.New("unsupported ECDSA curve for JWS")
+	case ed25519.PublicKey:
+		return EdDSA, nil
+	}
+	return "", fmt.Errorf("unsupported key type %T for JWS", pub)
+}
+
+// Sign a message, returning ECDSA signatures as fixed size r || s
+func (a Algorithm) Sign(signer crypto.Signer, msg []byte) ([]byte, error) {
+	if a == EdDSA {
+		return signer.Sign(rand.Reader, msg, crypto.Hash(0))
+	}
+	hash := a.Hash()
+	if hash == 0 {
+		return nil, fmt.Errorf("unsupported signature algorithm %q", a)
+	}
+	d := hash.New()
+	d.Write(msg)
+	switch a[0] {
+	case 'P':
+		return signer.Sign(rand.Reader, d.Sum(nil), &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: hash})
+	case 'R':
+		return signer.Sign(rand.Reader, d.Sum(nil), hash)
+	}
+	der, err := signer.Sign(rand.Reader, d.Sum(nil), hash)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := x509tools.UnmarshalEcdsaSignature(der)
+	if err != nil {
+		return nil, err
+	}
+	size := (signer.Public().(*ecdsa.PublicKey).Curve.Params().BitSize + 7) / 8
+	packed := make([]byte, 2*size)
+	sig.R.FillBytes(packed[:size])
+	sig.S.FillBytes(packed[size:])
+	return packed, nil
+}
+
+// Verify a signature made by Sign
+func (a Algorithm) Verify(pub crypto.PublicKey, msg, sig []byte) error {
+	if a == EdDSA {
+		k, ok := pub.(ed25519.PublicKey)
+		if !ok {
+			return fmt.Errorf("signature algorithm %s does not match the signing key", a)
+		}
+		if !ed25519.Verify(k, msg, sig) {
+			return errors.New("ed25519 verification failed")
+		}
+		return nil
+	}
+	hash := a.Hash()
+	if hash == 0 {
+		return fmt.Errorf("unsupported signature algorithm %q", a)
+	}
+	d := hash.New()
+	d.Write(msg)
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		switch a[0] {
+		case 'P':
+			return rsa.VerifyPSS(k, hash, d.Sum(nil), sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: hash})
+		case 'R':
+			return rsa.VerifyPKCS1v15(k, hash, d.Sum(nil), sig)
+		}
+	case *ecdsa.PublicKey:
+		if expected, err := AlgorithmFor(k, 0, false); err != nil {
+			return err
+		} else if expected != a {
+			break
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return errors.New("ECDSA signature is the wrong size")
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(k, d.Sum(nil), r, s) {
+			return errors.New("ECDSA verification failed")
+		}
+		return nil
+	}
+	return fmt.Errorf("signature algorithm %s does not match the signing key", a)
+}
@@ -0,0 +1,115 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jose_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sassoftware/relic/v7/internal/testcert"
+	"github.com/sassoftware/relic/v7/lib/jose"
+)
+
+func TestSignVerify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	payload := []byte(`{"sub":"1234567890","iat":1516239022}`)
+	cases := []struct {
+		key crypto.Signer
+		pss bool
+		alg jose.Algorithm
+	}{
+		{rsaKey, false, jose.RS256},
+		{rsaKey, true, jose.PS256},
+		{ecKey, false, jose.ES384},
+		{edKey, false, jose.EdDSA},
+	}
+	for _, c := range cases {
+		t.Run(string(c.alg), func(t *testing.T) {
+			cert := testcert.SelfSigned(t, "token signer", c.key)
+			j, err := jose.Sign(payload, c.key, jose.SignOptions{Hash: crypto.SHA256, PSS: c.pss, Type: "JWT", Certificates: []*x509.Certificate{cert}})
+			require.NoError(t, err)
+			assert.Equal(t, c.alg, j.Header.Alg)
+			jsonSig, err := j.JSON(false)
+			require.NoError(t, err)
+			for _, blob := range [][]byte{j.Compact(false), jsonSig} {
+				parsed, err := jose.Parse(blob)
+				require.NoError(t, err)
+				assert.Equal(t, payload, parsed.Payload)
+				assert.Equal(t, "JWT", parsed.Header.Typ)
+				signer, err := parsed.Verify(nil)
+				require.NoError(t, err)
+				assert.Equal(t, cert, signer)
+			}
+		})
+	}
+}
+
+func TestDetached(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	cert := testcert.SelfSigned(t, "token signer", key)
+	payload := []byte("manifest contents")
+	j, err := jose.Sign(payload, key, jose.SignOptions{KeyID: "k1"})
+	require.NoError(t, err)
+	compact := j.Compact(true)
+	assert.Contains(t, string(compact), "..")
+
+	parsed, err := jose.Parse(compact)
+	require.NoError(t, err)
+	assert.Nil(t, parsed.Payload)
+	_, err = parsed.Verify([]*x509.Certificate{cert})
+	assert.Error(t, err)
+	parsed.Payload = payload
+	// no x5c, so the key must be trusted
+	_, err = parsed.Verify(nil)
+	assert.Error(t, err)
+	signer, err := parsed.Verify([]*x509.Certificate{cert})
+	require.NoError(t, err)
+	assert.Equal(t, cert, signer)
+	parsed.Payload = []byte("tampered")
+	_, err = parsed.Verify([]*x509.Certificate{cert})
+	assert.Error(t, err)
+}
+
+func TestParseGeneral(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	cert := testcert.SelfSigned(t, "token signer", key)
+	j, err := jose.Sign([]byte("hello"), key, jose.SignOptions{})
+	require.NoError(t, err)
+	parts := strings.Split(string(j.Compact(false)), ".")
+	general := `{"payload":"` + parts[1] + `","signatures":[{"protected":"` + parts[0] + `","signature":"` + parts[2] + `"}]}`
+	parsed, err := jose.Parse([]byte(general))
+	require.NoError(t, err)
+	_, err = parsed.Verify([]*x509.Certificate{cert})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,234 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package jose implements JSON Web Signatures (RFC 7515) in the compact and
+// flattened JSON serializations.
+package jose
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/sassoftware/relic/v7/signers/sigerrors"
+)
+
+var b64 = base64.RawURLEncoding
+
+// Header is the protected header of a JWS
+type Header struct {
+	Alg Algorithm `json:"alg"`
+	Typ string    `json:"typ,omitempty"`
+	Cty string    `json:"cty,omitempty"`
+	Kid string    `json:"kid,omitempty"`
+	// certificate chain as standard (not URL-safe) base64 DER
+	X5c  [][]byte `json:"x5c,omitempty"`
+	Crit []string `json:"crit,omitempty"`
+}
+
+// SignOptions control the protected header of a new signature
+type SignOptions struct {
+	// Hash for RSA keys, ignored for other key types
+	Hash crypto.Hash
+	// Use PSS padding for RSA keys
+	PSS bool
+	// Media type of the complete JWS, e.g. "JWT"
+	Type string
+	// Media type of the payload
+	ContentType string
+	KeyID       string
+	// Certificate chain to embed as x5c, starting with the leaf
+	Certificates []*x509.Certificate
+}
+
+// JWS is a single signature over a payload
+type JWS struct {
+	Header Header
+	// Payload is nil if the payload was detached and not supplied
+	Payload   []byte
+	Signature []byte
+	// encoded protected header, exactly as signed
+	protected string
+}
+
+type flattened struct {
+	Protected  string            `json:"protected"`
+	Payload    *string           `json:"payload,omitempty"`
+	Signature  string            `json:"signature,omitempty"`
+	Signatures []json.RawMessage `json:"signatures,omitempty"`
+}
+
+// Sign a payload
+func Sign(payload []byte, signer crypto.Signer, opts SignOptions) (*JWS, error) {
+	alg, err := AlgorithmFor(signer.Public(), opts.Hash, opts.PSS)
+	if err != nil {
+		return nil, err
+	}
+	j := &JWS{
+		Header: Header{
+			Alg: alg,
+			Typ: opts.Type,
+			Cty: opts.ContentType,
+			Kid: opts.KeyID,
+		},
+		Payload: payload,
+	}
+	for _, cert := range opts.Certificates {
+		j.Header.X5c = append(j.Header.X5c, cert.Raw)
+	}
+	hdrJSON, err := json.Marshal(j.Header)
+	if err != nil {
+		return nil, err
+	}
+	j.protected = b64.EncodeToString(hdrJSON)
+	j.Signature, err = alg.Sign(signer, j.signingInput())
+	if err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+func (j *JWS) signingInput() []byte {
+	return []byte(j.protected + "." + b64.EncodeToString(j.Payload))
+}
+
+// Compact returns the compact serialization. If detached is true then the
+// payload is left out.
+func (j *JWS) Compact(detached bool) []byte {
+	var payload string
+	if !detached {
+		payload = b64.EncodeToString(j.Payload)
+	}
+	return []byte(j.protected + "." + payload + "." + b64.EncodeToString(j.Signature))
+}
+
+// JSON returns the flattened JSON serialization. If detached is true then
+// the payload is left out.
+func (j *JWS) JSON(detached bool) ([]byte, error) {
+	f := flattened{
+		Protected: j.protected,
+		Signature: b64.EncodeToString(j.Signature),
+	}
+	if !detached {
+		payload := b64.EncodeToString(j.Payload)
+		f.Payload = &payload
+	}
+	return json.Marshal(f)
+}
+
+// Parse a JWS in compact, flattened JSON or general JSON serialization. The
+// general serialization must have exactly one signature.
+func Parse(blob []byte) (*JWS, error) {
+	blob = bytes.TrimSpace(blob)
+	if len(blob) == 0 {
+		return nil, sigerrors.NotSignedError{Type: "JWS"}
+	}
+	var protected, signature string
+	var payload *string
+	if blob[0] == '{' {
+		var f flattened
+		if err := json.Unmarshal(blob, &f); err != nil {
+			return nil, fmt.Errorf("parsing JWS: %w", err)
+		}
+		if len(f.Signatures) != 0 {
+			if len(f.Signatures) > 1 {
+				return nil, errors.New("JWS with multiple signatures is not supported")
+			}
+			var sig flattened
+			if err := json.Unmarshal(f.Signatures[0], &sig); err != nil {
+				return nil, fmt.Errorf("parsing JWS: %w", err)
+			}
+			f.Protected, f.Signature = sig.Protected, sig.Signature
+		}
+		protected, payload, signature = f.Protected, f.Payload, f.Signature
+	} else {
+		parts := bytes.Split(blob, []byte("."))
+		if len(parts) != 3 {
+			return nil, errors.New("malformed compact JWS")
+		}
+		protected, signature = string(parts[0]), string(parts[2])
+		if len(parts[1]) != 0 {
+			p := string(parts[1])
+			payload = &p
+		}
+	}
+	if protected == "" || signature == "" {
+		return nil, sigerrors.NotSignedError{Type: "JWS"}
+	}
+	j := &JWS{protected: protected}
+	hdrJSON, err := b64.DecodeString(protected)
+	if err != nil {
+		return nil, fmt.Errorf("parsing JWS header: %w", err)
+	}
+	if err := json.Unmarshal(hdrJSON, &j.Header); err != nil {
+		return nil, fmt.Errorf("parsing JWS header: %w", err)
+	}
+	if len(j.Header.Crit) != 0 {
+		return nil, fmt.Errorf("unsupported critical header %q", j.Header.Crit[0])
+	}
+	if payload != nil {
+		if j.Payload, err = b64.DecodeString(*payload); err != nil {
+			return nil, fmt.Errorf("parsing JWS payload: %w", err)
+		}
+	}
+	if j.Signature, err = b64.DecodeString(signature); err != nil {
+		return nil, fmt.Errorf("parsing JWS signature: %w", err)
+	}
+	return j, nil
+}
+
+// Certificates parses the x5c chain from the header
+func (j *JWS) Certificates() ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for _, der := range j.Header.X5c {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("parsing JWS certificate chain: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+// Verify the signature. If the header has a x5c chain then the first
+// certificate must have signed it, otherwise one of the trusted certificates
+// must have. The certificate chain is not checked. Returns the certificate
+// that made the signature.
+func (j *JWS) Verify(trusted []*x509.Certificate) (*x509.Certificate, error) {
+	if j.Payload == nil {
+		return nil, errors.New("JWS payload is detached and was not provided")
+	}
+	certs, err := j.Certificates()
+	if err != nil {
+		return nil, err
+	}
+	if len(certs) != 0 {
+		if err := j.Header.Alg.Verify(certs[0].PublicKey, j.signingInput(), j.Signature); err != nil {
+			return nil, fmt.Errorf("JWS verification failed: %w", err)
+		}
+		return certs[0], nil
+	}
+	for _, cert := range trusted {
+		if j.Header.Alg.Verify(cert.PublicKey, j.signingInput(), j.Signature) == nil {
+			return cert, nil
+		}
+	}
+	return nil, errors.New("JWS has no x5c chain and was not signed by a trusted key")
+}
@@ -0,0 +1,199 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package kmip
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Client holds a TLS connection to a KMIP server. Requests are serialized
+// over a single connection which is reopened if it fails.
+type Client struct {
+	Address   string
+	TLSConfig *tls.Config
+	// Protocol version to send in request headers, e.g. 1.4 or 2.0
+	Major, Minor int32
+	Timeout      time.Duration
+
+	mu   sync.Mutex
+	conn *tls.Conn
+}
+
+// Operation is one batch item in a request
+type Operation struct {
+	Operation int32
+	Payload   []*Item
+}
+
+// Result is the response to one batch item
+type Result struct {
+	Operation int32
+	Payload   *Item
+}
+
+// Error is returned when the server reports a failed operation
+type Error struct {
+	Operation int32
+	Status    int32
+	Reason    int32
+	Message   string
+}
+
+func (e Error) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = fmt.Sprintf("result reason %d", e.Reason)
+	}
+	return fmt.Sprintf("kmip: operation %d failed: %s", e.Operation, msg)
+}
+
+// Result reasons
+const (
+	ReasonItemNotFound     = 0x01
+	ReasonPermissionDenied = 0x0A
+)
+
+// V2 returns true if the client speaks KMIP 2.x
+func (c *Client) V2() bool {
+	return c.Major >= 2
+}
+
+// Do sends one or more operations in a single request message and returns the
+// results in the same order. If any batch item fails then an Error is returned
+// for the first failure.
+func (c *Client) Do(ctx context.Context, ops ...Operation) ([]Result, error) {
+	if len(ops) == 0 {
+		return nil, errors.New("kmip: no operations")
+	}
+	major, minor := c.Major, c.Minor
+	if major == 0 {
+		major, minor = 1, 4
+	}
+	items := []*Item{
+		Struct(TagRequestHeader,
+			Struct(TagProtocolVersion,
+				Integer(TagProtocolVersionMajor, major),
+				Integer(TagProtocolVersionMinor, minor),
+			),
+			Integer(TagBatchCount, int32(len(ops))),
+		),
+	}
+	for _, op := range ops {
+		items = append(items, Struct(TagBatchItem,
+			Enum(TagOperation, op.Operation),
+			Struct(TagRequestPayload, op.Payload...),
+		))
+	}
+	blob, err := Struct(TagRequestMessage, items...).Marshal()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.roundTrip(ctx, blob)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Tag != TagResponseMessage {
+		return nil, fmt.Errorf("kmip: unexpected response tag %06x", resp.Tag)
+	}
+	batch := resp.FindAll(TagBatchItem)
+	if len(batch) != len(ops) {
+		return nil, fmt.Errorf("kmip: expected %d batch items in response but got %d", len(ops), len(batch))
+	}
+	results := make([]Result, len(batch))
+	for i, item := range batch {
+		results[i] = Result{
+			Operation: item.Find(TagOperation).Int(),
+			Payload:   item.Find(TagResponsePayload),
+		}
+		if results[i].Operation == 0 {
+			results[i].Operation = ops[i].Operation
+		}
+		if status := item.Find(TagResultStatus).Int(); status != resultSuccess {
+			return nil, Error{
+				Operation: results[i].Operation,
+				Status:    status,
+				Reason:    item.Find(TagResultReason).Int(),
+				Message:   item.Find(TagResultMessage).String(),
+			}
+		}
+	}
+	return results, nil
+}
+
+func (c *Client) roundTrip(ctx context.Context, blob []byte) (*Item, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// retry once if a previously opened connection went stale
+	for attempt := 0; ; attempt++ {
+		fresh := c.conn == nil
+		if fresh {
+			if err := c.dial(ctx); err != nil {
+				return nil, err
+			}
+		}
+		resp, err := c.exchange(ctx, blob)
+		if err == nil {
+			return resp, nil
+		}
+		c.conn.Close()
+		c.conn = nil
+		if fresh || attempt > 0 || ctx.Err() != nil {
+			return nil, err
+		}
+	}
+}
+
+func (c *Client) dial(ctx context.Context) error {
+	dialer := &tls.Dialer{Config: c.TLSConfig}
+	conn, err := dialer.DialContext(ctx, "tcp", c.Address)
+	if err != nil {
+		return err
+	}
+	c.conn = conn.(*tls.Conn)
+	return nil
+}
+
+func (c *Client) exchange(ctx context.Context, blob []byte) (*Item, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok && c.Timeout > 0 {
+		deadline = time.Now().Add(c.Timeout)
+	}
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	if _, err := c.conn.Write(blob); err != nil {
+		return nil, err
+	}
+	return ReadItem(c.conn)
+}
+
+// Close the connection to the server
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
@@ -0,0 +1,213 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package kmip
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+)
+
+// LocateOp builds a Locate operation that finds objects of the given type,
+// optionally by name. If the next operation in the same batch omits its unique
+// identifier, the server substitutes the located object.
+func (c *Client) LocateOp(name string, objectType int32) Operation {
+	var nameValue *Item
+	if c.V2() {
+		if name != "" {
+			nameValue = Struct(TagName,
+				Text(TagNameValue, name),
+				Enum(TagNameType, nameTypeText),
+			)
+		}
+		return Operation{Operation: OpLocate, Payload: []*Item{
+			Struct(TagAttributes, Enum(TagObjectType, objectType), nameValue),
+		}}
+	}
+	payload := []*Item{
+		Struct(TagAttribute,
+			Text(TagAttributeName, "Object Type"),
+			Enum(TagAttributeValue, objectType),
+		),
+	}
+	if name != "" {
+		payload = append(payload, Struct(TagAttribute,
+			Text(TagAttributeName, "Name"),
+			Struct(TagAttributeValue,
+				Text(TagNameValue, name),
+				Enum(TagNameType, nameTypeText),
+			),
+		))
+	}
+	return Operation{Operation: OpLocate, Payload: payload}
+}
+
+// AttributesOp builds a Get Attributes operation that returns all attributes
+// of an object. If id is empty then the ID placeholder from a previous batch
+// item is used.
+func AttributesOp(id string) Operation {
+	var payload []*Item
+	if id != "" {
+		payload = append(payload, Text(TagUniqueIdentifier, id))
+	}
+	return Operation{Operation: OpGetAttributes, Payload: payload}
+}
+
+// Located returns the unique identifiers from a Locate result
+func Located(result Result) []string {
+	var ids []string
+	for _, item := range result.Payload.FindAll(TagUniqueIdentifier) {
+		ids = append(ids, item.String())
+	}
+	return ids
+}
+
+// attributes returns the values of the named attribute from a Get Attributes
+// result. 1.x wraps each attribute in a name-value structure, 2.x does not.
+func attributes(result Result, name string, tag Tag) []*Item {
+	values := result.Payload.Find(TagAttributes).FindAll(tag)
+	for _, attr := range result.Payload.FindAll(TagAttribute) {
+		if attr.Find(TagAttributeName).String() == name {
+			values = append(values, attr.Find(TagAttributeValue))
+		}
+	}
+	return values
+}
+
+// LinkedPublicKey returns the unique identifier of the public key linked from
+// a Get Attributes result, or "" if there is no such link
+func LinkedPublicKey(result Result) string {
+	for _, link := range attributes(result, "Link", TagLink) {
+		if link.Find(TagLinkType).Int() == linkPublicKey {
+			return link.Find(TagLinkedObjectIdentifier).String()
+		}
+	}
+	return ""
+}
+
+// ObjectNames returns the names from a Get Attributes result
+func ObjectNames(result Result) []string {
+	var names []string
+	for _, name := range attributes(result, "Name", TagName) {
+		names = append(names, name.Find(TagNameValue).String())
+	}
+	return names
+}
+
+// FindPrivateKey locates a private key by name and returns its unique
+// identifier along with that of its linked public key, if any
+func (c *Client) FindPrivateKey(ctx context.Context, name string) (privID, pubID string, err error) {
+	results, err := c.Do(ctx, c.LocateOp(name, ObjectPrivateKey), AttributesOp(""))
+	if err != nil {
+		var kerr Error
+		if errors.As(err, &kerr) && kerr.Operation == OpGetAttributes && kerr.Reason == ReasonItemNotFound {
+			// placeholder was not set because nothing matched
+			return "", "", ErrNotFound
+		}
+		return "", "", err
+	}
+	ids := Located(results[0])
+	switch len(ids) {
+	case 0:
+		return "", "", ErrNotFound
+	case 1:
+	default:
+		return "", "", fmt.Errorf("kmip: found %d private keys named %q", len(ids), name)
+	}
+	return ids[0], LinkedPublicKey(results[1]), nil
+}
+
+// PublicKeyLink returns the unique identifier of the public key linked to a
+// private key, or "" if there is no such link
+func (c *Client) PublicKeyLink(ctx context.Context, privID string) (string, error) {
+	results, err := c.Do(ctx, AttributesOp(privID))
+	if err != nil {
+		return "", err
+	}
+	return LinkedPublicKey(results[0]), nil
+}
+
+// GetPublicKey fetches a public key object in SubjectPublicKeyInfo form
+func (c *Client) GetPublicKey(ctx context.Context, id string) (interface{}, error) {
+	results, err := c.Do(ctx, Operation{Operation: OpGet, Payload: []*Item{
+		Text(TagUniqueIdentifier, id),
+		Enum(TagKeyFormatType, KeyFormatX509),
+	}})
+	if err != nil {
+		return nil, err
+	}
+	block := results[0].Payload.Find(TagPublicKey).Find(TagKeyBlock)
+	if block == nil {
+		return nil, fmt.Errorf("kmip: object %s is not a public key", id)
+	}
+	if format := block.Find(TagKeyFormatType).Int(); format != KeyFormatX509 {
+		return nil, fmt.Errorf("kmip: server returned public key in unsupported format %d", format)
+	}
+	value := block.Find(TagKeyValue)
+	der := value.Bytes()
+	if der == nil {
+		der = value.Find(TagKeyMaterial).Bytes()
+	}
+	return x509.ParsePKIXPublicKey(der)
+}
+
+// SignParameters describe how to sign a digest
+type SignParameters struct {
+	Algorithm  int32
+	Hash       int32
+	Padding    int32
+	SaltLength int32
+}
+
+// Sign a precomputed digest with the private key identified by id
+func (c *Client) Sign(ctx context.Context, id string, params SignParameters, digest []byte) ([]byte, error) {
+	cparams := []*Item{
+		Enum(TagCryptographicAlgorithm, params.Algorithm),
+		Enum(TagHashingAlgorithm, params.Hash),
+	}
+	if params.Padding != 0 {
+		cparams = append(cparams, Enum(TagPaddingMethod, params.Padding))
+	}
+	if params.Padding == PaddingPSS {
+		cparams = append(cparams, Integer(TagSaltLength, params.SaltLength))
+	}
+	results, err := c.Do(ctx, Operation{Operation: OpSign, Payload: []*Item{
+		Text(TagUniqueIdentifier, id),
+		Struct(TagCryptographicParameters, cparams...),
+		ByteString(TagDigestedData, digest),
+	}})
+	if err != nil {
+		return nil, err
+	}
+	sig := results[0].Payload.Find(TagSignatureData).Bytes()
+	if len(sig) == 0 {
+		return nil, errors.New("kmip: server returned an empty signature")
+	}
+	return sig, nil
+}
+
+// Query checks that the server is responsive
+func (c *Client) Query(ctx context.Context) error {
+	_, err := c.Do(ctx, Operation{Operation: OpQuery, Payload: []*Item{
+		Enum(TagQueryFunction, queryOperations),
+	}})
+	return err
+}
+
+// ErrNotFound is returned when a named object does not exist
+var ErrNotFound = errors.New("kmip: object not found")
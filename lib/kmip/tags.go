@@ -0,0 +1,117 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package kmip
+
+// Tags, from KMIP 1.4 section 9.1.3.1
+const (
+	TagAttribute                 Tag = 0x420008
+	TagAttributeName             Tag = 0x42000A
+	TagAttributeValue            Tag = 0x42000B
+	TagBatchCount                Tag = 0x42000D
+	TagBatchItem                 Tag = 0x42000F
+	TagCryptographicAlgorithm    Tag = 0x420028
+	TagCryptographicLength       Tag = 0x42002A
+	TagCryptographicParameters   Tag = 0x42002B
+	TagHashingAlgorithm          Tag = 0x420038
+	TagKeyBlock                  Tag = 0x420040
+	TagKeyFormatType             Tag = 0x420042
+	TagKeyMaterial               Tag = 0x420043
+	TagKeyValue                  Tag = 0x420045
+	TagLink                      Tag = 0x42004A
+	TagLinkType                  Tag = 0x42004B
+	TagLinkedObjectIdentifier    Tag = 0x42004C
+	TagMaximumItems              Tag = 0x42004F
+	TagName                      Tag = 0x420053
+	TagNameType                  Tag = 0x420054
+	TagNameValue                 Tag = 0x420055
+	TagObjectType                Tag = 0x420057
+	TagOperation                 Tag = 0x42005C
+	TagPaddingMethod             Tag = 0x42005F
+	TagProtocolVersion           Tag = 0x420069
+	TagProtocolVersionMajor      Tag = 0x42006A
+	TagProtocolVersionMinor      Tag = 0x42006B
+	TagPublicKey                 Tag = 0x42006D
+	TagQueryFunction             Tag = 0x420074
+	TagRequestHeader             Tag = 0x420077
+	TagRequestMessage            Tag = 0x420078
+	TagRequestPayload            Tag = 0x420079
+	TagResponseHeader            Tag = 0x42007A
+	TagResponseMessage           Tag = 0x42007B
+	TagResponsePayload           Tag = 0x42007C
+	TagResultMessage             Tag = 0x42007D
+	TagResultReason              Tag = 0x42007E
+	TagResultStatus              Tag = 0x42007F
+	TagUniqueBatchItemID         Tag = 0x420093
+	TagUniqueIdentifier          Tag = 0x420094
+	TagDigitalSignatureAlgorithm Tag = 0x4200AE
+	TagSignatureData             Tag = 0x4200C3
+	TagSaltLength                Tag = 0x420100
+	TagDigestedData              Tag = 0x420107
+
+	// KMIP 2.0 replaces Attribute structures in requests with a single
+	// Attributes structure holding the attributes directly
+	TagAttributes Tag = 0x420125
+)
+
+// Operations
+const (
+	OpLocate        = 0x08
+	OpGet           = 0x0A
+	OpGetAttributes = 0x0B
+	OpQuery         = 0x18
+	OpSign          = 0x21
+)
+
+// Object types
+const (
+	ObjectCertificate = 0x01
+	ObjectPublicKey   = 0x03
+	ObjectPrivateKey  = 0x04
+)
+
+// Key format types
+const (
+	KeyFormatX509 = 0x05
+)
+
+// Cryptographic algorithms
+const (
+	AlgorithmRSA   = 0x04
+	AlgorithmECDSA = 0x06
+)
+
+// Hashing algorithms
+const (
+	HashSHA1   = 0x04
+	HashSHA224 = 0x05
+	HashSHA256 = 0x06
+	HashSHA384 = 0x07
+	HashSHA512 = 0x08
+)
+
+// Padding methods
+const (
+	PaddingPKCS1v15 = 0x08
+	PaddingPSS      = 0x0A
+)
+
+const (
+	nameTypeText    = 0x01
+	linkPublicKey   = 0x0103
+	queryOperations = 0x01
+	resultSuccess   = 0x00
+)
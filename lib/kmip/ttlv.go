@@ -0,0 +1,260 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package kmip implements enough of the OASIS Key Management Interoperability
+// Protocol to locate asymmetric keys on a key manager and sign with them.
+package kmip
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"time"
+)
+
+// Tag identifies a TTLV item
+type Tag uint32
+
+// Item types
+const (
+	TypeStructure   byte = 0x01
+	TypeInteger     byte = 0x02
+	TypeLongInteger byte = 0x03
+	TypeBigInteger  byte = 0x04
+	TypeEnumeration byte = 0x05
+	TypeBoolean     byte = 0x06
+	TypeTextString  byte = 0x07
+	TypeByteString  byte = 0x08
+	TypeDateTime    byte = 0x09
+	TypeInterval    byte = 0x0A
+)
+
+const maxMessage = 16 << 20
+
+// Item is a single tag-type-length-value item. Value holds []*Item for
+// structures, int32 for integers, enumerations and intervals, int64 for long
+// integers, *big.Int, bool, string, []byte or time.Time.
+type Item struct {
+	Tag   Tag
+	Type  byte
+	Value interface{}
+}
+
+func Struct(tag Tag, items ...*Item) *Item {
+	var children []*Item
+	for _, item := range items {
+		if item != nil {
+			children = append(children, item)
+		}
+	}
+	return &Item{Tag: tag, Type: TypeStructure, Value: children}
+}
+
+func Integer(tag Tag, v int32) *Item     { return &Item{Tag: tag, Type: TypeInteger, Value: v} }
+func Enum(tag Tag, v int32) *Item        { return &Item{Tag: tag, Type: TypeEnumeration, Value: v} }
+func Bool(tag Tag, v bool) *Item         { return &Item{Tag: tag, Type: TypeBoolean, Value: v} }
+func Text(tag Tag, v string) *Item       { return &Item{Tag: tag, Type: TypeTextString, Value: v} }
+func ByteString(tag Tag, v []byte) *Item { return &Item{Tag: tag, Type: TypeByteString, Value: v} }
+
+// Children returns the items in a structure
+func (i *Item) Children() []*Item {
+	children, _ := i.Value.([]*Item)
+	return children
+}
+
+// Find returns the first child with the given tag, or nil
+func (i *Item) Find(tag Tag) *Item {
+	if i == nil {
+		return nil
+	}
+	for _, child := range i.Children() {
+		if child.Tag == tag {
+			return child
+		}
+	}
+	return nil
+}
+
+// FindAll returns all children with the given tag
+func (i *Item) FindAll(tag Tag) []*Item {
+	if i == nil {
+		return nil
+	}
+	var found []*Item
+	for _, child := range i.Children() {
+		if child.Tag == tag {
+			found = append(found, child)
+		}
+	}
+	return found
+}
+
+// Int returns the value of an integer or enumeration, or 0
+func (i *Item) Int() int32 {
+	if i == nil {
+		return 0
+	}
+	v, _ := i.Value.(int32)
+	return v
+}
+
+// String returns the value of a text string, or ""
+func (i *Item) String() string {
+	if i == nil {
+		return ""
+	}
+	v, _ := i.Value.(string)
+	return v
+}
+
+// Bytes returns the value of a byte string, or nil
+func (i *Item) Bytes() []byte {
+	if i == nil {
+		return nil
+	}
+	v, _ := i.Value.([]byte)
+	return v
+}
+
+// Marshal encodes an item in TTLV form
+func (i *Item) Marshal() ([]byte, error) {
+	var value []byte
+	switch i.Type {
+	case TypeStructure:
+		for _, child := range i.Children() {
+			blob, err := child.Marshal()
+			if err != nil {
+				return nil, err
+			}
+			value = append(value, blob...)
+		}
+	case TypeInteger, TypeEnumeration, TypeInterval:
+		value = make([]byte, 4)
+		binary.BigEndian.PutUint32(value, uint32(i.Value.(int32)))
+	case TypeLongInteger:
+		value = make([]byte, 8)
+		binary.BigEndian.PutUint64(value, uint64(i.Value.(int64)))
+	case TypeBoolean:
+		value = make([]byte, 8)
+		if i.Value.(bool) {
+			value[7] = 1
+		}
+	case TypeDateTime:
+		value = make([]byte, 8)
+		binary.BigEndian.PutUint64(value, uint64(i.Value.(time.Time).Unix()))
+	case TypeTextString:
+		value = []byte(i.Value.(string))
+	case TypeByteString:
+		value = i.Value.([]byte)
+	case TypeBigInteger:
+		n := i.Value.(*big.Int)
+		if n.Sign() < 0 {
+			return nil, errors.New("kmip: negative big integers are not supported")
+		}
+		// big integers are padded to a multiple of 8 bytes
+		raw := n.Bytes()
+		value = make([]byte, (len(raw)+8)/8*8)
+		copy(value[len(value)-len(raw):], raw)
+	default:
+		return nil, fmt.Errorf("kmip: unsupported item type %d", i.Type)
+	}
+	out := make([]byte, 8, 8+len(value)+7)
+	binary.BigEndian.PutUint32(out, uint32(i.Tag)<<8|uint32(i.Type))
+	binary.BigEndian.PutUint32(out[4:], uint32(len(value)))
+	out = append(out, value...)
+	if pad := len(value) % 8; pad != 0 {
+		out = append(out, make([]byte, 8-pad)...)
+	}
+	return out, nil
+}
+
+// Unmarshal decodes a single TTLV item and returns any remaining bytes
+func Unmarshal(blob []byte) (*Item, []byte, error) {
+	if len(blob) < 8 {
+		return nil, nil, io.ErrUnexpectedEOF
+	}
+	tt := binary.BigEndian.Uint32(blob)
+	length := int(binary.BigEndian.Uint32(blob[4:]))
+	blob = blob[8:]
+	padded := (length + 7) / 8 * 8
+	if length < 0 || padded > len(blob) {
+		return nil, nil, io.ErrUnexpectedEOF
+	}
+	value, rest := blob[:length], blob[padded:]
+	item := &Item{Tag: Tag(tt >> 8), Type: byte(tt)}
+	switch item.Type {
+	case TypeStructure:
+		var children []*Item
+		for len(value) > 0 {
+			var child *Item
+			var err error
+			child, value, err = Unmarshal(value)
+			if err != nil {
+				return nil, nil, err
+			}
+			children = append(children, child)
+		}
+		item.Value = children
+	case TypeInteger, TypeEnumeration, TypeInterval:
+		if length != 4 {
+			return nil, nil, fmt.Errorf("kmip: invalid length %d for tag %06x", length, item.Tag)
+		}
+		item.Value = int32(binary.BigEndian.Uint32(value))
+	case TypeLongInteger, TypeBoolean, TypeDateTime:
+		if length != 8 {
+			return nil, nil, fmt.Errorf("kmip: invalid length %d for tag %06x", length, item.Tag)
+		}
+		v := binary.BigEndian.Uint64(value)
+		switch item.Type {
+		case TypeLongInteger:
+			item.Value = int64(v)
+		case TypeBoolean:
+			item.Value = v != 0
+		default:
+			item.Value = time.Unix(int64(v), 0)
+		}
+	case TypeBigInteger:
+		item.Value = new(big.Int).SetBytes(value)
+	case TypeTextString:
+		item.Value = string(value)
+	case TypeByteString:
+		item.Value = append([]byte(nil), value...)
+	default:
+		return nil, nil, fmt.Errorf("kmip: unsupported item type %d for tag %06x", item.Type, item.Tag)
+	}
+	return item, rest, nil
+}
+
+// ReadItem reads one complete TTLV item from a stream
+func ReadItem(r io.Reader) (*Item, error) {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(header[4:])
+	if length > maxMessage {
+		return nil, errors.New("kmip: message too large")
+	}
+	blob := make([]byte, 8+(int(length)+7)/8*8)
+	copy(blob, header)
+	if _, err := io.ReadFull(r, blob[8:]); err != nil {
+		return nil, err
+	}
+	item, _, err := Unmarshal(blob)
+	return item, err
+}
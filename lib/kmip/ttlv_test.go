@@ -0,0 +1,40 @@
+package kmip
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTTLV(t *testing.T) {
+	// examples from the KMIP 1.4 specification, section 9.1.2
+	blob, err := Integer(0x420020, 8).Marshal()
+	require.NoError(t, err)
+	assert.Equal(t, "42002002000000040000000800000000", hex.EncodeToString(blob))
+	blob, err = Text(0x420020, "Hello World").Marshal()
+	require.NoError(t, err)
+	assert.Equal(t, "420020070000000b48656c6c6f20576f726c640000000000", hex.EncodeToString(blob))
+
+	msg := Struct(TagRequestMessage,
+		Struct(TagRequestHeader, Integer(TagBatchCount, 1)),
+		Struct(TagBatchItem,
+			Enum(TagOperation, OpSign),
+			Struct(TagRequestPayload,
+				Text(TagUniqueIdentifier, "key1"),
+				ByteString(TagDigestedData, []byte{1, 2, 3}),
+				Bool(0x420020, true),
+			),
+		),
+	)
+	blob, err = msg.Marshal()
+	require.NoError(t, err)
+	parsed, err := ReadItem(bytes.NewReader(blob))
+	require.NoError(t, err)
+	assert.Equal(t, msg, parsed)
+	payload := parsed.Find(TagBatchItem).Find(TagRequestPayload)
+	assert.Equal(t, "key1", payload.Find(TagUniqueIdentifier).String())
+	assert.Equal(t, []byte{1, 2, 3}, payload.Find(TagDigestedData).Bytes())
+}
@@ -0,0 +1,138 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package kmod implements Linux kernel module signatures, which are a
+// detached PKCS#7 signature appended to the module along with a small
+// descriptor and a magic trailer.
+package kmod
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/pkcs7"
+	"github.com/sassoftware/relic/v7/lib/pkcs9"
+	"github.com/sassoftware/relic/v7/signers/sigerrors"
+)
+
+// Magic is the trailer at the very end of a signed module
+const Magic = "~Module signature appended~\n"
+
+// pkeyIDPKCS7 identifies the signature as PKCS#7. All other fields of the
+// descriptor are unused for this type.
+const pkeyIDPKCS7 = 2
+
+// struct module_signature from include/linux/module_signature.h
+type moduleSignature struct {
+	Algo      uint8
+	Hash      uint8
+	IDType    uint8
+	SignerLen uint8
+	KeyIDLen  uint8
+	Pad       [3]byte
+	SigLen    uint32 // big-endian
+}
+
+const descriptorSize = 12
+
+// Split a module into its unsigned contents and its signature, if it has one
+func Split(blob []byte) (contents, sig []byte, err error) {
+	if !bytes.HasSuffix(blob, []byte(Magic)) {
+		return blob, nil, nil
+	}
+	rest := blob[:len(blob)-len(Magic)]
+	if len(rest) < descriptorSize {
+		return nil, nil, errors.New("kmod: truncated signature descriptor")
+	}
+	var desc moduleSignature
+	_ = binary.Read(bytes.NewReader(rest[len(rest)-descriptorSize:]), binary.BigEndian, &desc)
+	rest = rest[:len(rest)-descriptorSize]
+	if desc.IDType != pkeyIDPKCS7 {
+		return nil, nil, fmt.Errorf("kmod: unsupported signature type %d", desc.IDType)
+	}
+	if int64(desc.SigLen) > int64(len(rest)) {
+		return nil, nil, errors.New("kmod: invalid signature length")
+	}
+	split := len(rest) - int(desc.SigLen)
+	return rest[:split], rest[split:], nil
+}
+
+// Sign the module contents and return the signature block to append to it,
+// including the descriptor and trailer. Like the kernel's sign-file, the
+// signature has no authenticated attributes and no embedded certificates;
+// the kernel finds the key in its keyring by issuer and serial number.
+func Sign(contents []byte, cert *certloader.Certificate, hash crypto.Hash) ([]byte, *pkcs9.TimestampedSignature, error) {
+	builder := pkcs7.NewBuilder(cert.Signer(), cert.Chain(), hash)
+	if err := builder.SetContentData(contents); err != nil {
+		return nil, nil, err
+	}
+	psd, err := builder.Sign()
+	if err != nil {
+		return nil, nil, err
+	}
+	sig, err := psd.Content.Verify(nil, false)
+	if err != nil {
+		return nil, nil, fmt.Errorf("pkcs7: failed signature self-check: %w", err)
+	}
+	if _, err := psd.Detach(); err != nil {
+		return nil, nil, err
+	}
+	psd.Content.Certificates = nil
+	der, err := psd.Marshal()
+	if err != nil {
+		return nil, nil, err
+	}
+	var b bytes.Buffer
+	b.Write(der)
+	_ = binary.Write(&b, binary.BigEndian, moduleSignature{
+		IDType: pkeyIDPKCS7,
+		SigLen: uint32(len(der)),
+	})
+	b.WriteString(Magic)
+	return b.Bytes(), &pkcs9.TimestampedSignature{Signature: sig, Raw: der}, nil
+}
+
+// Verify the signature on a module. Signatures normally don't carry the
+// signer certificate so it must be found among the given keyring
+// certificates.
+func Verify(blob []byte, keyring []*x509.Certificate, skipDigests bool) (*pkcs9.TimestampedSignature, error) {
+	contents, der, err := Split(blob)
+	if err != nil {
+		return nil, err
+	} else if der == nil {
+		return nil, sigerrors.NotSignedError{Type: "kernel module"}
+	}
+	psd, err := pkcs7.Unmarshal(der)
+	if err != nil {
+		return nil, fmt.Errorf("kmod: %w", err)
+	}
+	for _, cert := range keyring {
+		psd.Content.Certificates = append(psd.Content.Certificates, asn1.RawValue{FullBytes: cert.Raw})
+	}
+	sig, err := psd.Content.Verify(contents, skipDigests)
+	if errors.As(err, &pkcs7.MissingCertificateError{}) {
+		return nil, fmt.Errorf("kmod: signer is not in the kernel keyring: %w", err)
+	} else if err != nil {
+		return nil, err
+	}
+	return &pkcs9.TimestampedSignature{Signature: sig, Raw: der}, nil
+}
@@ -54,6 +54,8 @@ const (
 	FileTypeMachOFat
 	FileTypeIPA
 	FileTypeXAR
+	FileTypeAAB
+	FileTypeSSHSIG
 )
 
 const (
@@ -94,6 +96,8 @@ func Detect(r io.Reader) FileType {
 		return FileTypeDEB
 	case hasPrefix(br, []byte("-----BEGIN PGP")):
 		return FileTypePGP
+	case hasPrefix(br, []byte("-----BEGIN SSH SIGNATURE-----")), hasPrefix(br, []byte("SSHSIG")):
+		return FileTypeSSHSIG
 	case contains(br, []byte{0x06, 0x09, 0x2B, 0x06, 0x01, 0x04, 0x01, 0x82, 0x37, 0x0A, 0x01}, 256):
 		// OID certTrustList
 		return FileTypeCAT
@@ -198,6 +202,8 @@ func detectZip(f *os.File) FileType {
 		switch name {
 		case "AndroidManifest.xml":
 			return FileTypeAPK
+		case "BundleConfig.pb":
+			return FileTypeAAB
 		case "AppManifest.xaml":
 			return FileTypeXAP
 		case "AppxManifest.xml", "AppxMetadata/AppxBundleManifest.xml":
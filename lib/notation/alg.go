@@ -0,0 +1,146 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package notation
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+)
+
+// algorithm is a signature algorithm allowed by the Notary Project
+// specification, with its JWS and COSE identifiers
+type algorithm struct {
+	jws  string
+	cose int64
+	hash crypto.Hash
+}
+
+var algorithms = []algorithm{
+	{"PS256", -37, crypto.SHA256},
+	{"PS384", -38, crypto.SHA384},
+	{"PS512", -39, crypto.SHA512},
+	{"ES256", -7, crypto.SHA256},
+	{"ES384", -35, crypto.SHA384},
+	{"ES512", -36, crypto.SHA512},
+}
+
+func (a algorithm) ecdsa() bool { return a.jws[0] == 'E' }
+
+// algorithmFor picks the algorithm for a key. RSA keys always use PSS.
+func algorithmFor(pub crypto.PublicKey) (algorithm, error) {
+	var name string
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		switch k.N.BitLen() {
+		case 2048:
+			name = "PS256"
+		case 3072:
+			name = "PS384"
+		case 4096:
+			name = "PS512"
+		}
+	case *ecdsa.PublicKey:
+		switch k.Curve.Params().BitSize {
+		case 256:
+			name = "ES256"
+		case 384:
+			name = "ES384"
+		case 521:
+			name = "ES512"
+		}
+	}
+	for _, a := range algorithms {
+		if a.jws == name {
+			return a, nil
+		}
+	}
+	return algorithm{}, errors.New("notation signatures require a RSA 2048/3072/4096 or ECDSA P-256/384/521 key")
+}
+
+func algorithmByJWS(name string) (algorithm, error) {
+	for _, a := range algorithms {
+		if a.jws == name {
+			return a, nil
+		}
+	}
+	return algorithm{}, fmt.Errorf("unsupported signature algorithm %q", name)
+}
+
+func algorithmByCOSE(id int64) (algorithm, error) {
+	for _, a := range algorithms {
+		if a.cose == id {
+			return a, nil
+		}
+	}
+	return algorithm{}, fmt.Errorf("unsupported signature algorithm %d", id)
+}
+
+// sign a message, returning ECDSA signatures as fixed size r || s as both
+// JWS and COSE require
+func (a algorithm) sign(signer crypto.Signer, msg []byte) ([]byte, error) {
+	d := a.hash.New()
+	d.Write(msg)
+	if !a.ecdsa() {
+		return signer.Sign(rand.Reader, d.Sum(nil), &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: a.hash})
+	}
+	der, err := signer.Sign(rand.Reader, d.Sum(nil), a.hash)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := x509tools.UnmarshalEcdsaSignature(der)
+	if err != nil {
+		return nil, err
+	}
+	size := (signer.Public().(*ecdsa.PublicKey).Curve.Params().BitSize + 7) / 8
+	packed := make([]byte, 2*size)
+	sig.R.FillBytes(packed[:size])
+	sig.S.FillBytes(packed[size:])
+	return packed, nil
+}
+
+func (a algorithm) verify(pub crypto.PublicKey, msg, sig []byte) error {
+	if expected, err := algorithmFor(pub); err != nil {
+		return err
+	} else if expected != a {
+		return fmt.Errorf("signature algorithm %s does not match the signing key", a.jws)
+	}
+	d := a.hash.New()
+	d.Write(msg)
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPSS(k, a.hash, d.Sum(nil), sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: a.hash})
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return errors.New("ECDSA signature is the wrong size")
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(k, d.Sum(nil), r, s) {
+			return errors.New("ECDSA verification failed")
+		}
+		return nil
+	}
+	return errors.New("unsupported public key algorithm")
+}
@@ -0,0 +1,83 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package notation
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/sassoftware/relic/v7/lib/oci"
+)
+
+const maxEnvelope = 4 << 20
+
+// Attach pushes a signature envelope as a referrer of the image
+func Attach(ctx context.Context, client *oci.Client, image oci.Reference, subject oci.Descriptor, mediaType string, envelope []byte, certs []*x509.Certificate, created time.Time) error {
+	thumbprints := make([]string, len(certs))
+	for i, cert := range certs {
+		d := sha256.Sum256(cert.Raw)
+		thumbprints[i] = hex.EncodeToString(d[:])
+	}
+	thumbJSON, err := json.Marshal(thumbprints)
+	if err != nil {
+		return err
+	}
+	_, err = client.PushReferrer(ctx, image, subject, ArtifactType, mediaType, envelope, map[string]string{
+		AnnotationThumbprints:              string(thumbJSON),
+		"org.opencontainers.image.created": created.UTC().Format(time.RFC3339),
+	})
+	return err
+}
+
+// Fetch returns all notation signature envelopes attached to the image. The
+// image reference must include a digest.
+func Fetch(ctx context.Context, client *oci.Client, image oci.Reference) ([]*Envelope, error) {
+	referrers, err := client.Referrers(ctx, image, image.Digest, ArtifactType)
+	if err != nil {
+		return nil, err
+	}
+	var envelopes []*Envelope
+	for _, desc := range referrers {
+		blob, _, _, err := client.GetManifest(ctx, image.WithDigest(desc.Digest))
+		if err != nil {
+			return nil, err
+		}
+		var manifest oci.Manifest
+		if err := json.Unmarshal(blob, &manifest); err != nil {
+			return nil, fmt.Errorf("parsing signature manifest: %w", err)
+		}
+		if len(manifest.Layers) != 1 {
+			continue
+		}
+		layer := manifest.Layers[0]
+		blob, err = client.GetBlob(ctx, image, layer.Digest, maxEnvelope)
+		if err != nil {
+			return nil, err
+		}
+		env, err := Parse(layer.MediaType, blob)
+		if err != nil {
+			return nil, fmt.Errorf("signature %s: %w", desc.Digest, err)
+		}
+		envelopes = append(envelopes, env)
+	}
+	return envelopes, nil
+}
@@ -0,0 +1,193 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package notation
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sassoftware/relic/v7/lib/cbor"
+)
+
+const (
+	coseTagSign1 = 18
+	coseAlg      = int64(1)
+	coseCrit     = int64(2)
+	coseCty      = int64(3)
+	coseX5Chain  = int64(33)
+
+	cborTagEpoch = 1
+)
+
+func signCOSE(ctx context.Context, alg algorithm, req SignRequest) ([]byte, error) {
+	crit := []interface{}{headerSigningScheme}
+	protected := map[interface{}]interface{}{
+		coseAlg:             alg.cose,
+		coseCty:             MediaTypePayload,
+		headerSigningScheme: SigningScheme,
+		headerSigningTime:   cbor.Tag{Number: cborTagEpoch, Content: req.SigningTime.Unix()},
+	}
+	if !req.Expiry.IsZero() {
+		protected[headerExpiry] = cbor.Tag{Number: cborTagEpoch, Content: req.Expiry.Unix()}
+		crit = append(crit, headerExpiry)
+	}
+	protected[coseCrit] = crit
+	protectedBytes, err := cbor.Marshal(protected)
+	if err != nil {
+		return nil, err
+	}
+	tbs, err := coseSigStructure(protectedBytes, req.Payload)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := alg.sign(req.Signer, tbs)
+	if err != nil {
+		return nil, err
+	}
+	chain := make([]interface{}, len(req.Certificates))
+	for i, cert := range req.Certificates {
+		chain[i] = cert.Raw
+	}
+	unprotected := map[interface{}]interface{}{coseX5Chain: chain}
+	if req.SigningAgent != "" {
+		unprotected[headerSigningAgent] = req.SigningAgent
+	}
+	tst, err := req.timestamp(ctx, alg, sig)
+	if err != nil {
+		return nil, err
+	} else if tst != nil {
+		unprotected[headerTimestamp] = tst
+	}
+	return cbor.Marshal(cbor.Tag{Number: coseTagSign1, Content: []interface{}{
+		protectedBytes, unprotected, req.Payload, sig,
+	}})
+}
+
+// coseSigStructure returns the Sig_structure that is signed for a COSE_Sign1
+// message with no external data
+func coseSigStructure(protected, payload []byte) ([]byte, error) {
+	return cbor.Marshal([]interface{}{"Signature1", protected, []byte{}, payload})
+}
+
+func parseCOSE(blob []byte) (*Envelope, error) {
+	v, err := cbor.Unmarshal(blob)
+	if err != nil {
+		return nil, fmt.Errorf("parsing COSE envelope: %w", err)
+	}
+	if tag, ok := v.(cbor.Tag); ok {
+		if tag.Number != coseTagSign1 {
+			return nil, fmt.Errorf("parsing COSE envelope: unexpected tag %d", tag.Number)
+		}
+		v = tag.Content
+	}
+	msg, ok := v.([]interface{})
+	if !ok || len(msg) != 4 {
+		return nil, errors.New("parsing COSE envelope: not a COSE_Sign1 message")
+	}
+	protectedBytes, ok1 := msg[0].([]byte)
+	unprotected, ok2 := msg[1].(map[interface{}]interface{})
+	payload, ok3 := msg[2].([]byte)
+	sig, ok4 := msg[3].([]byte)
+	if !ok1 || !ok2 || !ok3 || !ok4 {
+		return nil, errors.New("parsing COSE envelope: malformed COSE_Sign1 message")
+	}
+	pv, err := cbor.Unmarshal(protectedBytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing COSE protected header: %w", err)
+	}
+	protected, ok := pv.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("parsing COSE protected header: not a map")
+	}
+	if cty, _ := protected[coseCty].(string); cty != MediaTypePayload {
+		return nil, fmt.Errorf("unexpected payload type %q", cty)
+	}
+	if scheme, _ := protected[headerSigningScheme].(string); scheme != SigningScheme {
+		return nil, fmt.Errorf("unsupported signing scheme %q", scheme)
+	}
+	critItems, _ := protected[coseCrit].([]interface{})
+	crit := make([]string, 0, len(critItems))
+	for _, item := range critItems {
+		name, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("unsupported critical header %v", item)
+		}
+		crit = append(crit, name)
+	}
+	if err := checkCritical(crit, func(name string) bool { _, ok := protected[name]; return ok }); err != nil {
+		return nil, err
+	}
+	algID, _ := protected[coseAlg].(int64)
+	e := &Envelope{
+		MediaType: MediaTypeCOSE,
+		Payload:   payload,
+		Signature: sig,
+	}
+	if e.alg, err = algorithmByCOSE(algID); err != nil {
+		return nil, err
+	}
+	if e.SigningTime, err = coseTime(protected[headerSigningTime]); err != nil {
+		return nil, fmt.Errorf("parsing COSE signing time: %w", err)
+	}
+	if expiry, ok := protected[headerExpiry]; ok {
+		if e.Expiry, err = coseTime(expiry); err != nil {
+			return nil, fmt.Errorf("parsing COSE expiry: %w", err)
+		}
+	}
+	if e.signingInput, err = coseSigStructure(protectedBytes, payload); err != nil {
+		return nil, err
+	}
+	e.SigningAgent, _ = unprotected[headerSigningAgent].(string)
+	if tst, ok := unprotected[headerTimestamp]; ok {
+		if e.Timestamp, ok = tst.([]byte); !ok {
+			return nil, errors.New("parsing COSE envelope: malformed timestamp")
+		}
+	}
+	var chain []interface{}
+	switch x5 := unprotected[coseX5Chain].(type) {
+	case []byte:
+		chain = []interface{}{x5}
+	case []interface{}:
+		chain = x5
+	}
+	for _, item := range chain {
+		der, ok := item.([]byte)
+		if !ok {
+			return nil, errors.New("parsing COSE certificate chain: malformed certificate")
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("parsing COSE certificate chain: %w", err)
+		}
+		e.Certificates = append(e.Certificates, cert)
+	}
+	return e, nil
+}
+
+func coseTime(v interface{}) (time.Time, error) {
+	if tag, ok := v.(cbor.Tag); ok && tag.Number == cborTagEpoch {
+		v = tag.Content
+	}
+	secs, ok := v.(int64)
+	if !ok {
+		return time.Time{}, errors.New("expected a numeric date")
+	}
+	return time.Unix(secs, 0).UTC(), nil
+}
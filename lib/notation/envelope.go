@@ -0,0 +1,187 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package notation creates and verifies Notary Project signatures for OCI
+// artifacts, as used by the notation CLI.
+package notation
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sassoftware/relic/v7/lib/oci"
+	"github.com/sassoftware/relic/v7/lib/pkcs7"
+	"github.com/sassoftware/relic/v7/lib/pkcs9"
+)
+
+const (
+	// MediaTypePayload is the content type of the signed payload
+	MediaTypePayload = "application/vnd.cncf.notary.payload.v1+json"
+	// ArtifactType is the artifact type of a signature manifest
+	ArtifactType = "application/vnd.cncf.notary.signature"
+	// MediaTypeJWS and MediaTypeCOSE are the envelope formats
+	MediaTypeJWS  = "application/jose+json"
+	MediaTypeCOSE = "application/cose"
+	// SigningScheme is the only supported scheme, where signing time is
+	// asserted by the signer and optionally backed by a timestamp
+	SigningScheme = "notary.x509"
+	// AnnotationThumbprints lists the SHA-256 thumbprints of the signing
+	// chain on the signature manifest
+	AnnotationThumbprints = "io.cncf.notary.x509chain.thumbprint#S256"
+
+	headerSigningScheme = "io.cncf.notary.signingScheme"
+	headerSigningTime   = "io.cncf.notary.signingTime"
+	headerExpiry        = "io.cncf.notary.expiry"
+	headerSigningAgent  = "io.cncf.notary.signingAgent"
+	headerTimestamp     = "io.cncf.notary.timestamp"
+)
+
+// Payload is what gets signed
+type Payload struct {
+	TargetArtifact oci.Descriptor `json:"targetArtifact"`
+}
+
+// SignRequest holds the parameters for creating an envelope
+type SignRequest struct {
+	Payload []byte
+	Signer  crypto.Signer
+	// Certificates is the signing chain, leaf first
+	Certificates []*x509.Certificate
+	SigningTime  time.Time
+	// Expiry is optional
+	Expiry       time.Time
+	SigningAgent string
+	// Timestamper is optional
+	Timestamper pkcs9.Timestamper
+}
+
+// Envelope is a parsed signature envelope
+type Envelope struct {
+	MediaType    string
+	Payload      []byte
+	Certificates []*x509.Certificate
+	SigningTime  time.Time
+	Expiry       time.Time
+	SigningAgent string
+	Signature    []byte
+	Timestamp    []byte
+
+	alg          algorithm
+	signingInput []byte
+}
+
+// Verified is the result of checking an envelope's integrity
+type Verified struct {
+	Payload          *Payload
+	CounterSignature *pkcs9.CounterSignature
+}
+
+// NewPayload returns the payload for signing an artifact
+func NewPayload(target oci.Descriptor) ([]byte, error) {
+	return json.Marshal(Payload{TargetArtifact: oci.Descriptor{
+		MediaType:   target.MediaType,
+		Digest:      target.Digest,
+		Size:        target.Size,
+		Annotations: target.Annotations,
+	}})
+}
+
+// ParsePayload parses a signed payload
+func ParsePayload(blob []byte) (*Payload, error) {
+	p := new(Payload)
+	if err := json.Unmarshal(blob, p); err != nil {
+		return nil, fmt.Errorf("parsing notation payload: %w", err)
+	}
+	if p.TargetArtifact.Digest == "" || p.TargetArtifact.MediaType == "" {
+		return nil, errors.New("notation payload is missing the target artifact")
+	}
+	return p, nil
+}
+
+// Sign creates an envelope of the given media type
+func Sign(ctx context.Context, mediaType string, req SignRequest) ([]byte, error) {
+	if len(req.Certificates) == 0 {
+		return nil, errors.New("notation signatures require a X.509 certificate")
+	}
+	alg, err := algorithmFor(req.Certificates[0].PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	switch mediaType {
+	case MediaTypeJWS:
+		return signJWS(ctx, alg, req)
+	case MediaTypeCOSE:
+		return signCOSE(ctx, alg, req)
+	default:
+		return nil, fmt.Errorf("unsupported envelope type %q", mediaType)
+	}
+}
+
+// timestamp the signature value, if a timestamper was provided
+func (req SignRequest) timestamp(ctx context.Context, alg algorithm, sig []byte) ([]byte, error) {
+	if req.Timestamper == nil {
+		return nil, nil
+	}
+	tst, err := req.Timestamper.Timestamp(ctx, &pkcs9.Request{EncryptedDigest: sig, Hash: alg.hash})
+	if err != nil {
+		return nil, err
+	}
+	return tst.Marshal()
+}
+
+// Parse an envelope of the given media type
+func Parse(mediaType string, blob []byte) (*Envelope, error) {
+	switch mediaType {
+	case MediaTypeJWS:
+		return parseJWS(blob)
+	case MediaTypeCOSE:
+		return parseCOSE(blob)
+	default:
+		return nil, fmt.Errorf("unsupported envelope type %q", mediaType)
+	}
+}
+
+// Verify the envelope's signature and timestamp and parse its payload. The
+// certificate chain, expiry and signer identity are not checked.
+func (e *Envelope) Verify() (*Verified, error) {
+	if len(e.Certificates) == 0 {
+		return nil, errors.New("envelope has no certificates")
+	}
+	if err := e.alg.verify(e.Certificates[0].PublicKey, e.signingInput, e.Signature); err != nil {
+		return nil, err
+	}
+	payload, err := ParsePayload(e.Payload)
+	if err != nil {
+		return nil, err
+	}
+	v := &Verified{Payload: payload}
+	if e.Timestamp != nil {
+		tst, err := pkcs7.Unmarshal(e.Timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("parsing timestamp: %w", err)
+		}
+		v.CounterSignature, err = pkcs9.Verify(tst, e.Signature, nil)
+		if err != nil {
+			return nil, fmt.Errorf("verifying timestamp: %w", err)
+		}
+	}
+	return v, nil
+}
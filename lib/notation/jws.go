@@ -0,0 +1,172 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package notation
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type jwsEnvelope struct {
+	Payload   string      `json:"payload"`
+	Protected string      `json:"protected"`
+	Header    jwsUnsigned `json:"header"`
+	Signature string      `json:"signature"`
+}
+
+type jwsUnsigned struct {
+	Timestamp    []byte   `json:"io.cncf.notary.timestamp,omitempty"`
+	CertChain    [][]byte `json:"x5c"`
+	SigningAgent string   `json:"io.cncf.notary.signingAgent,omitempty"`
+}
+
+type jwsProtected struct {
+	Alg           string     `json:"alg"`
+	Crit          []string   `json:"crit"`
+	Cty           string     `json:"cty"`
+	SigningScheme string     `json:"io.cncf.notary.signingScheme"`
+	SigningTime   *time.Time `json:"io.cncf.notary.signingTime,omitempty"`
+	Expiry        *time.Time `json:"io.cncf.notary.expiry,omitempty"`
+}
+
+var b64 = base64.RawURLEncoding
+
+func signJWS(ctx context.Context, alg algorithm, req SignRequest) ([]byte, error) {
+	signingTime := req.SigningTime.UTC().Truncate(time.Second)
+	hdr := jwsProtected{
+		Alg:           alg.jws,
+		Crit:          []string{headerSigningScheme},
+		Cty:           MediaTypePayload,
+		SigningScheme: SigningScheme,
+		SigningTime:   &signingTime,
+	}
+	if !req.Expiry.IsZero() {
+		expiry := req.Expiry.UTC().Truncate(time.Second)
+		hdr.Expiry = &expiry
+		hdr.Crit = append(hdr.Crit, headerExpiry)
+	}
+	hdrJSON, err := json.Marshal(hdr)
+	if err != nil {
+		return nil, err
+	}
+	env := jwsEnvelope{
+		Payload:   b64.EncodeToString(req.Payload),
+		Protected: b64.EncodeToString(hdrJSON),
+	}
+	sig, err := alg.sign(req.Signer, []byte(env.Protected+"."+env.Payload))
+	if err != nil {
+		return nil, err
+	}
+	env.Signature = b64.EncodeToString(sig)
+	env.Header.SigningAgent = req.SigningAgent
+	for _, cert := range req.Certificates {
+		env.Header.CertChain = append(env.Header.CertChain, cert.Raw)
+	}
+	env.Header.Timestamp, err = req.timestamp(ctx, alg, sig)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(env)
+}
+
+func parseJWS(blob []byte) (*Envelope, error) {
+	var env jwsEnvelope
+	if err := json.Unmarshal(blob, &env); err != nil {
+		return nil, fmt.Errorf("parsing JWS envelope: %w", err)
+	}
+	hdrJSON, err := b64.DecodeString(env.Protected)
+	if err != nil {
+		return nil, fmt.Errorf("parsing JWS envelope: %w", err)
+	}
+	var raw map[string]json.RawMessage
+	var hdr jwsProtected
+	if err := json.Unmarshal(hdrJSON, &raw); err != nil {
+		return nil, fmt.Errorf("parsing JWS protected header: %w", err)
+	}
+	if err := json.Unmarshal(hdrJSON, &hdr); err != nil {
+		return nil, fmt.Errorf("parsing JWS protected header: %w", err)
+	}
+	if hdr.Cty != MediaTypePayload {
+		return nil, fmt.Errorf("unexpected payload type %q", hdr.Cty)
+	}
+	if hdr.SigningScheme != SigningScheme {
+		return nil, fmt.Errorf("unsupported signing scheme %q", hdr.SigningScheme)
+	}
+	if hdr.SigningTime == nil {
+		return nil, errors.New("JWS envelope has no signing time")
+	}
+	if err := checkCritical(hdr.Crit, func(name string) bool { _, ok := raw[name]; return ok }); err != nil {
+		return nil, err
+	}
+	e := &Envelope{
+		MediaType:    MediaTypeJWS,
+		SigningTime:  *hdr.SigningTime,
+		SigningAgent: env.Header.SigningAgent,
+		Timestamp:    env.Header.Timestamp,
+		signingInput: []byte(env.Protected + "." + env.Payload),
+	}
+	if hdr.Expiry != nil {
+		e.Expiry = *hdr.Expiry
+	}
+	if e.alg, err = algorithmByJWS(hdr.Alg); err != nil {
+		return nil, err
+	}
+	if e.Payload, err = b64.DecodeString(env.Payload); err != nil {
+		return nil, fmt.Errorf("parsing JWS payload: %w", err)
+	}
+	if e.Signature, err = b64.DecodeString(env.Signature); err != nil {
+		return nil, fmt.Errorf("parsing JWS signature: %w", err)
+	}
+	for _, der := range env.Header.CertChain {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("parsing JWS certificate chain: %w", err)
+		}
+		e.Certificates = append(e.Certificates, cert)
+	}
+	return e, nil
+}
+
+// checkCritical ensures that the signing scheme is marked critical, that
+// every critical header is one we understand, and that optional extension
+// headers that are present are marked critical
+func checkCritical(crit []string, present func(string) bool) error {
+	marked := make(map[string]bool, len(crit))
+	for _, name := range crit {
+		switch name {
+		case headerSigningScheme, headerExpiry:
+		default:
+			return fmt.Errorf("unsupported critical header %q", name)
+		}
+		if !present(name) {
+			return fmt.Errorf("critical header %q is missing", name)
+		}
+		marked[name] = true
+	}
+	if !marked[headerSigningScheme] {
+		return errors.New("signing scheme header must be critical")
+	}
+	if present(headerExpiry) && !marked[headerExpiry] {
+		return errors.New("expiry header must be critical")
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package notation
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sassoftware/relic/v7/internal/testcert"
+	"github.com/sassoftware/relic/v7/lib/oci"
+)
+
+type testPKI struct {
+	root     *x509.Certificate
+	leaf     *x509.Certificate
+	key      crypto.Signer
+	trustDir string
+}
+
+func mkPKI(t *testing.T, key crypto.Signer) testPKI {
+	rootKey := testcert.ECDSAKey(t)
+	root := testcert.CA(t, "Test Root", rootKey)
+	leaf := testcert.Issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "signer", Organization: []string{"Acme"}, Country: []string{"US"}},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}, key, root, rootKey)
+	trustDir := t.TempDir()
+	storeDir := filepath.Join(trustDir, "x509", "ca", "acme")
+	require.NoError(t, os.MkdirAll(storeDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(storeDir, "root.crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw}), 0644))
+	return testPKI{root: root, leaf: leaf, key: key, trustDir: trustDir}
+}
+
+const testDigest = "sha256:0000000000000000000000000000000000000000000000000000000000000000"
+
+func signTest(t *testing.T, pki testPKI, mediaType string, expiry time.Time) *Envelope {
+	payload, err := NewPayload(oci.Descriptor{MediaType: oci.MediaTypeImageManifest, Digest: testDigest, Size: 123})
+	require.NoError(t, err)
+	blob, err := Sign(context.Background(), mediaType, SignRequest{
+		Payload:      payload,
+		Signer:       pki.key,
+		Certificates: []*x509.Certificate{pki.leaf},
+		SigningTime:  time.Now(),
+		Expiry:       expiry,
+		SigningAgent: "relic/test",
+	})
+	require.NoError(t, err)
+	env, err := Parse(mediaType, blob)
+	require.NoError(t, err)
+	return env
+}
+
+func testPolicy(level string, identities ...string) *TrustPolicy {
+	return &TrustPolicy{
+		Name:                  "test",
+		RegistryScopes:        []string{"*"},
+		SignatureVerification: SignatureVerification{Level: level},
+		TrustStores:           []string{"ca:acme"},
+		TrustedIdentities:     identities,
+	}
+}
+
+func TestEnvelopes(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+	for _, key := range []crypto.Signer{rsaKey, ecKey} {
+		pki := mkPKI(t, key)
+		for _, mediaType := range []string{MediaTypeJWS, MediaTypeCOSE} {
+			env := signTest(t, pki, mediaType, time.Now().Add(time.Hour))
+			assert.Equal(t, "relic/test", env.SigningAgent)
+			assert.False(t, env.Expiry.IsZero())
+			result, err := testPolicy(LevelStrict, "x509.subject: CN=signer, O=Acme").Verify(env, testDigest, pki.trustDir, time.Now())
+			require.NoError(t, err, mediaType)
+			assert.Empty(t, result.Warnings)
+			assert.Equal(t, int64(123), result.Verified.Payload.TargetArtifact.Size)
+
+			_, err = testPolicy(LevelStrict).Verify(env, "sha256:1111", pki.trustDir, time.Now())
+			assert.Error(t, err)
+			_, err = testPolicy(LevelStrict, "x509.subject: CN=other").Verify(env, testDigest, pki.trustDir, time.Now())
+			assert.Error(t, err)
+			result, err = testPolicy(LevelAudit, "x509.subject: CN=other").Verify(env, testDigest, pki.trustDir, time.Now())
+			require.NoError(t, err)
+			assert.Len(t, result.Warnings, 1)
+
+			env.Signature[len(env.Signature)-1] ^= 1
+			_, err = testPolicy(LevelSkip).Verify(env, testDigest, pki.trustDir, time.Now())
+			assert.NoError(t, err)
+			_, err = testPolicy(LevelAudit, "*").Verify(env, testDigest, pki.trustDir, time.Now())
+			assert.Error(t, err)
+		}
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	pki := mkPKI(t, key)
+	env := signTest(t, pki, MediaTypeCOSE, time.Now().Add(time.Minute))
+	later := time.Now().Add(2 * time.Minute)
+	_, err = testPolicy(LevelStrict, "*").Verify(env, testDigest, pki.trustDir, later)
+	assert.Error(t, err)
+	result, err := testPolicy(LevelPermissive, "*").Verify(env, testDigest, pki.trustDir, later)
+	require.NoError(t, err)
+	assert.Len(t, result.Warnings, 1)
+	policy := testPolicy(LevelStrict, "*")
+	policy.SignatureVerification.Override = map[string]string{CheckExpiry: ActionSkip}
+	result, err = policy.Verify(env, testDigest, pki.trustDir, later)
+	require.NoError(t, err)
+	assert.Empty(t, result.Warnings)
+}
+
+func TestParsePolicy(t *testing.T) {
+	doc, err := ParsePolicy([]byte(`{
+		"version": "1.0",
+		"trustPolicies": [
+			{"name": "default", "registryScopes": ["*"], "signatureVerification": {"level": "audit"}, "trustStores": ["ca:acme"], "trustedIdentities": ["*"]},
+			{"name": "app", "registryScopes": ["example.com/team/app"], "signatureVerification": {"level": "strict", "override": {"expiry": "log"}}, "trustStores": ["ca:acme", "tsa:ts"], "trustedIdentities": ["x509.subject: CN=signer"]}
+		]}`))
+	require.NoError(t, err)
+	ref, err := oci.ParseReference("example.com/team/app:1.0")
+	require.NoError(t, err)
+	p, err := doc.PolicyFor(ref)
+	require.NoError(t, err)
+	assert.Equal(t, "app", p.Name)
+	ref, err = oci.ParseReference("example.com/team/other:1.0")
+	require.NoError(t, err)
+	p, err = doc.PolicyFor(ref)
+	require.NoError(t, err)
+	assert.Equal(t, "default", p.Name)
+
+	for _, bad := range []string{
+		`{"version": "2.0", "trustPolicies": []}`,
+		`{"version": "1.0", "trustPolicies": [{"name": "a", "registryScopes": ["*", "x/y"], "signatureVerification": {"level": "strict"}}]}`,
+		`{"version": "1.0", "trustPolicies": [{"name": "a", "registryScopes": ["*"], "signatureVerification": {"level": "lax"}}]}`,
+		`{"version": "1.0", "trustPolicies": [{"name": "a", "registryScopes": ["*"], "signatureVerification": {"level": "strict", "override": {"integrity": "log"}}}]}`,
+		`{"version": "1.0", "trustPolicies": [{"name": "a", "registryScopes": ["*"], "signatureVerification": {"level": "strict"}, "trustStores": ["ca:../x"]}]}`,
+		`{"version": "1.0", "trustPolicies": [{"name": "a", "registryScopes": ["*"], "signatureVerification": {"level": "strict"}, "trustedIdentities": ["email: x"]}]}`,
+	} {
+		_, err := ParsePolicy([]byte(bad))
+		assert.Error(t, err, bad)
+	}
+}
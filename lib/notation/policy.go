@@ -0,0 +1,468 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package notation
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/oci"
+)
+
+// Verification levels
+const (
+	LevelStrict     = "strict"
+	LevelPermissive = "permissive"
+	LevelAudit      = "audit"
+	LevelSkip       = "skip"
+)
+
+// Verification checks that can be overridden
+const (
+	CheckIntegrity          = "integrity"
+	CheckAuthenticity       = "authenticity"
+	CheckAuthenticTimestamp = "authenticTimestamp"
+	CheckExpiry             = "expiry"
+	CheckRevocation         = "revocation"
+)
+
+// Actions taken when a check fails
+const (
+	ActionEnforce = "enforce"
+	ActionLog     = "log"
+	ActionSkip    = "skip"
+)
+
+// Trust store types
+const (
+	StoreCA               = "ca"
+	StoreSigningAuthority = "signingAuthority"
+	StoreTSA              = "tsa"
+)
+
+var levelActions = map[string]map[string]string{
+	LevelStrict: {
+		CheckIntegrity:          ActionEnforce,
+		CheckAuthenticity:       ActionEnforce,
+		CheckAuthenticTimestamp: ActionEnforce,
+		CheckExpiry:             ActionEnforce,
+		CheckRevocation:         ActionEnforce,
+	},
+	LevelPermissive: {
+		CheckIntegrity:          ActionEnforce,
+		CheckAuthenticity:       ActionEnforce,
+		CheckAuthenticTimestamp: ActionLog,
+		CheckExpiry:             ActionLog,
+		CheckRevocation:         ActionLog,
+	},
+	LevelAudit: {
+		CheckIntegrity:          ActionEnforce,
+		CheckAuthenticity:       ActionLog,
+		CheckAuthenticTimestamp: ActionLog,
+		CheckExpiry:             ActionLog,
+		CheckRevocation:         ActionLog,
+	},
+	LevelSkip: {
+		CheckIntegrity:          ActionSkip,
+		CheckAuthenticity:       ActionSkip,
+		CheckAuthenticTimestamp: ActionSkip,
+		CheckExpiry:             ActionSkip,
+		CheckRevocation:         ActionSkip,
+	},
+}
+
+// TrustPolicyDocument is a notation trustpolicy.json
+type TrustPolicyDocument struct {
+	Version       string        `json:"version"`
+	TrustPolicies []TrustPolicy `json:"trustPolicies"`
+}
+
+// TrustPolicy selects how signatures on a set of repositories are verified
+type TrustPolicy struct {
+	Name                  string                `json:"name"`
+	RegistryScopes        []string              `json:"registryScopes"`
+	SignatureVerification SignatureVerification `json:"signatureVerification"`
+	TrustStores           []string              `json:"trustStores,omitempty"`
+	TrustedIdentities     []string              `json:"trustedIdentities,omitempty"`
+}
+
+// SignatureVerification sets the verification level and per-check overrides
+type SignatureVerification struct {
+	Level    string            `json:"level"`
+	Override map[string]string `json:"override,omitempty"`
+}
+
+// Result of verifying an envelope against a trust policy
+type Result struct {
+	Verified *Verified
+	// Warnings lists checks that failed but were only logged
+	Warnings []string
+}
+
+// LoadPolicy reads and validates a trust policy document
+func LoadPolicy(path string) (*TrustPolicyDocument, error) {
+	blob, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := ParsePolicy(blob)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return doc, nil
+}
+
+// ParsePolicy parses and validates a trust policy document
+func ParsePolicy(blob []byte) (*TrustPolicyDocument, error) {
+	doc := new(TrustPolicyDocument)
+	if err := json.Unmarshal(blob, doc); err != nil {
+		return nil, fmt.Errorf("parsing trust policy: %w", err)
+	}
+	if doc.Version != "1.0" {
+		return nil, fmt.Errorf("unsupported trust policy version %q", doc.Version)
+	}
+	names := make(map[string]bool)
+	scopes := make(map[string]string)
+	for _, p := range doc.TrustPolicies {
+		if p.Name == "" {
+			return nil, errors.New("trust policy is missing a name")
+		} else if names[p.Name] {
+			return nil, fmt.Errorf("duplicate trust policy %q", p.Name)
+		}
+		names[p.Name] = true
+		if len(p.RegistryScopes) == 0 {
+			return nil, fmt.Errorf("trust policy %q has no registry scopes", p.Name)
+		}
+		for _, scope := range p.RegistryScopes {
+			if scope == "*" && len(p.RegistryScopes) != 1 {
+				return nil, fmt.Errorf("trust policy %q: wildcard scope must be the only scope", p.Name)
+			}
+			if other := scopes[scope]; other != "" {
+				return nil, fmt.Errorf("registry scope %q is used by both %q and %q", scope, other, p.Name)
+			}
+			scopes[scope] = p.Name
+		}
+		if _, err := p.actions(); err != nil {
+			return nil, fmt.Errorf("trust policy %q: %w", p.Name, err)
+		}
+		for _, store := range p.TrustStores {
+			storeType, name, _ := strings.Cut(store, ":")
+			switch storeType {
+			case StoreCA, StoreSigningAuthority, StoreTSA:
+			default:
+				return nil, fmt.Errorf("trust policy %q: unsupported trust store type %q", p.Name, storeType)
+			}
+			if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+				return nil, fmt.Errorf("trust policy %q: invalid trust store name %q", p.Name, name)
+			}
+		}
+		for _, identity := range p.TrustedIdentities {
+			if identity == "*" {
+				continue
+			}
+			if _, err := parseIdentity(identity); err != nil {
+				return nil, fmt.Errorf("trust policy %q: %w", p.Name, err)
+			}
+		}
+	}
+	return doc, nil
+}
+
+// PolicyFor returns the policy that applies to an image. A scope naming the
+// image's repository takes priority over the wildcard scope.
+func (d *TrustPolicyDocument) PolicyFor(image oci.Reference) (*TrustPolicy, error) {
+	name := image.Name()
+	var wildcard *TrustPolicy
+	for i, p := range d.TrustPolicies {
+		for _, scope := range p.RegistryScopes {
+			if scope == name {
+				return &d.TrustPolicies[i], nil
+			} else if scope == "*" {
+				wildcard = &d.TrustPolicies[i]
+			}
+		}
+	}
+	if wildcard == nil {
+		return nil, fmt.Errorf("no trust policy applies to %s", name)
+	}
+	return wildcard, nil
+}
+
+// actions returns the action to take for each check after applying overrides
+func (p *TrustPolicy) actions() (map[string]string, error) {
+	base := levelActions[p.SignatureVerification.Level]
+	if base == nil {
+		return nil, fmt.Errorf("unsupported verification level %q", p.SignatureVerification.Level)
+	}
+	actions := make(map[string]string, len(base))
+	for check, action := range base {
+		actions[check] = action
+	}
+	for check, action := range p.SignatureVerification.Override {
+		if _, ok := base[check]; !ok || check == CheckIntegrity {
+			return nil, fmt.Errorf("check %q cannot be overridden", check)
+		}
+		switch action {
+		case ActionEnforce, ActionLog, ActionSkip:
+		default:
+			return nil, fmt.Errorf("unsupported action %q for %s", action, check)
+		}
+		if p.SignatureVerification.Level == LevelSkip {
+			return nil, errors.New("overrides cannot be used with the skip level")
+		}
+		actions[check] = action
+	}
+	return actions, nil
+}
+
+// Skipped returns true if the policy doesn't verify signatures at all
+func (p *TrustPolicy) Skipped() bool {
+	return p.SignatureVerification.Level == LevelSkip
+}
+
+// Verify an envelope against the policy. digest is the digest of the
+// artifact the signature was found on. trustDir is the notation trust store
+// directory holding x509/<type>/<name>/ subdirectories. An error is returned
+// if an enforced check fails.
+func (p *TrustPolicy) Verify(env *Envelope, digest, trustDir string, now time.Time) (*Result, error) {
+	actions, err := p.actions()
+	if err != nil {
+		return nil, err
+	}
+	result := new(Result)
+	if p.Skipped() {
+		return result, nil
+	}
+	check := func(name string, err error) error {
+		if err == nil {
+			return nil
+		}
+		switch actions[name] {
+		case ActionEnforce:
+			return err
+		case ActionLog:
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%s: %s", name, err))
+		}
+		return nil
+	}
+	// integrity
+	result.Verified, err = env.Verify()
+	if err != nil {
+		return nil, err
+	}
+	if result.Verified.Payload.TargetArtifact.Digest != digest {
+		return nil, fmt.Errorf("signature is for %s, not %s", result.Verified.Payload.TargetArtifact.Digest, digest)
+	}
+	// authenticity
+	if actions[CheckAuthenticity] != ActionSkip {
+		if err := check(CheckAuthenticity, p.checkAuthenticity(env, trustDir)); err != nil {
+			return nil, err
+		}
+	}
+	// authentic timestamp
+	if actions[CheckAuthenticTimestamp] != ActionSkip {
+		if err := check(CheckAuthenticTimestamp, p.checkTimestamp(env, result.Verified, trustDir, now)); err != nil {
+			return nil, err
+		}
+	}
+	// expiry
+	if actions[CheckExpiry] != ActionSkip && !env.Expiry.IsZero() && now.After(env.Expiry) {
+		if err := check(CheckExpiry, fmt.Errorf("signature expired at %s", env.Expiry)); err != nil {
+			return nil, err
+		}
+	}
+	// revocation checking is not implemented, so it is never reported as failed
+	return result, nil
+}
+
+// checkAuthenticity verifies that the signing chain leads to a trusted CA and
+// that the signer is one of the trusted identities
+func (p *TrustPolicy) checkAuthenticity(env *Envelope, trustDir string) error {
+	roots, err := p.loadStores(trustDir, StoreCA, StoreSigningAuthority)
+	if err != nil {
+		return err
+	}
+	pool := x509.NewCertPool()
+	for _, cert := range env.Certificates[1:] {
+		pool.AddCert(cert)
+	}
+	leaf := env.Certificates[0]
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: pool,
+		CurrentTime:   env.SigningTime,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}); err != nil {
+		return err
+	}
+	for _, identity := range p.TrustedIdentities {
+		if identity == "*" {
+			return nil
+		}
+		want, err := parseIdentity(identity)
+		if err != nil {
+			return err
+		}
+		if subjectMatches(leaf, want) {
+			return nil
+		}
+	}
+	return fmt.Errorf("signing certificate %q is not a trusted identity", leaf.Subject)
+}
+
+// checkTimestamp verifies that the signing chain was valid when the
+// signature was made. If the signature has a timestamp then it must be from a
+// trusted TSA, otherwise the chain must be valid now.
+func (p *TrustPolicy) checkTimestamp(env *Envelope, verified *Verified, trustDir string, now time.Time) error {
+	at := now
+	if cs := verified.CounterSignature; cs != nil {
+		roots, err := p.loadStores(trustDir, StoreTSA)
+		if err != nil {
+			return err
+		}
+		if err := cs.VerifyChain(roots, nil); err != nil {
+			return fmt.Errorf("timestamp: %w", err)
+		}
+		at = cs.SigningTime
+	}
+	for _, cert := range env.Certificates {
+		if at.Before(cert.NotBefore) || at.After(cert.NotAfter) {
+			return fmt.Errorf("certificate %q is not valid at %s", cert.Subject, at.UTC().Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+// loadStores returns the certificates from all of the policy's trust stores
+// with one of the given types
+func (p *TrustPolicy) loadStores(trustDir string, types ...string) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	var found bool
+	for _, store := range p.TrustStores {
+		storeType, name, _ := strings.Cut(store, ":")
+		var match bool
+		for _, t := range types {
+			match = match || t == storeType
+		}
+		if !match {
+			continue
+		}
+		certs, err := LoadTrustStore(trustDir, storeType, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, cert := range certs {
+			pool.AddCert(cert)
+			found = true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("no %s trust store configured in policy %q", strings.Join(types, " or "), p.Name)
+	}
+	return pool, nil
+}
+
+// LoadTrustStore reads all of the certificates in a named trust store
+func LoadTrustStore(trustDir, storeType, name string) ([]*x509.Certificate, error) {
+	dir := filepath.Join(trustDir, "x509", storeType, name)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading trust store: %w", err)
+	}
+	var certs []*x509.Certificate
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		fp := filepath.Join(dir, entry.Name())
+		blob, err := os.ReadFile(fp)
+		if err != nil {
+			return nil, err
+		}
+		c, err := certloader.ParseX509Certificates(blob)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fp, err)
+		}
+		certs = append(certs, c...)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("trust store %s:%s has no certificates", storeType, name)
+	}
+	return certs, nil
+}
+
+type identityAttr struct {
+	name, value string
+}
+
+// parseIdentity parses a trusted identity of the form "x509.subject: DN"
+func parseIdentity(identity string) ([]identityAttr, error) {
+	prefix, dn, ok := strings.Cut(identity, ":")
+	if !ok || strings.TrimSpace(prefix) != "x509.subject" {
+		return nil, fmt.Errorf("unsupported trusted identity %q", identity)
+	}
+	var attrs []identityAttr
+	for _, rdn := range strings.Split(dn, ",") {
+		name, value, ok := strings.Cut(rdn, "=")
+		name = strings.ToUpper(strings.TrimSpace(name))
+		if !ok || name == "" {
+			return nil, fmt.Errorf("malformed trusted identity %q", identity)
+		}
+		attrs = append(attrs, identityAttr{name: name, value: strings.TrimSpace(value)})
+	}
+	return attrs, nil
+}
+
+var attrNames = map[string]string{
+	"2.5.4.3":  "CN",
+	"2.5.4.5":  "SERIALNUMBER",
+	"2.5.4.6":  "C",
+	"2.5.4.7":  "L",
+	"2.5.4.8":  "ST",
+	"2.5.4.10": "O",
+	"2.5.4.11": "OU",
+}
+
+// subjectMatches returns true if every attribute in the identity is present
+// in the certificate's subject
+func subjectMatches(cert *x509.Certificate, want []identityAttr) bool {
+	have := make(map[identityAttr]bool)
+	for _, name := range cert.Subject.Names {
+		value, ok := name.Value.(string)
+		if !ok {
+			continue
+		}
+		attrName := name.Type.String()
+		if short := attrNames[attrName]; short != "" {
+			attrName = short
+		}
+		have[identityAttr{name: attrName, value: value}] = true
+	}
+	for _, attr := range want {
+		if !have[attr] {
+			return false
+		}
+	}
+	return true
+}
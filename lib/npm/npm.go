@@ -0,0 +1,98 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package npm builds provenance attestations and registry signatures for
+// packed npm tarballs.
+package npm
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+)
+
+// Package identifies a packed npm tarball
+type Package struct {
+	Name    string
+	Version string
+	// SHA-512 digest of the tarball
+	SHA512 []byte
+}
+
+// ReadPackage reads a packed tarball, returning its name and version from
+// package.json and the digest of the whole file
+func ReadPackage(r io.Reader) (*Package, error) {
+	d := sha512.New()
+	gz, err := gzip.NewReader(io.TeeReader(r, d))
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(gz)
+	var pkg *Package
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		// npm pack puts everything under package/, but other tools pick
+		// their own top-level directory
+		dir, base := path.Split(strings.TrimPrefix(hdr.Name, "./"))
+		if base != "package.json" || strings.Count(dir, "/") != 1 || pkg != nil {
+			continue
+		}
+		var manifest struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		}
+		if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+			return nil, fmt.Errorf("parsing package.json: %w", err)
+		}
+		if manifest.Name == "" || manifest.Version == "" {
+			return nil, errors.New("package.json is missing name or version")
+		}
+		pkg = &Package{Name: manifest.Name, Version: manifest.Version}
+	}
+	if pkg == nil {
+		return nil, errors.New("package.json not found in tarball")
+	}
+	// digest the whole file, not just the compressed stream
+	if _, err := io.Copy(ioutil.Discard, io.TeeReader(r, d)); err != nil {
+		return nil, err
+	}
+	pkg.SHA512 = d.Sum(nil)
+	return pkg, nil
+}
+
+// Integrity returns the subresource integrity string the registry records
+// for the tarball
+func (p *Package) Integrity() string {
+	return "sha512-" + base64.StdEncoding.EncodeToString(p.SHA512)
+}
+
+// PURL returns the package URL used as the subject of provenance statements
+func (p *Package) PURL() string {
+	return "pkg:npm/" + strings.Replace(p.Name, "@", "%40", 1) + "@" + p.Version
+}
@@ -0,0 +1,115 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package npm
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sassoftware/relic/v7/internal/testcert"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/intoto"
+	"github.com/sassoftware/relic/v7/lib/sigstore"
+)
+
+func mkTarball(t *testing.T, manifest string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, f := range []struct{ name, contents string }{
+		{"package/index.js", "module.exports = 1\n"},
+		{"package/package.json", manifest},
+		{"package/lib/package.json", `{"name": "nested", "version": "0.0.0"}`},
+	} {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.contents))}))
+		_, err := tw.Write([]byte(f.contents))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func mkCert(t *testing.T) *certloader.Certificate {
+	return testcert.Signer(t, &x509.Certificate{Subject: pkix.Name{CommonName: "publisher"}}, testcert.ECDSAKey(t))
+}
+
+func TestReadPackage(t *testing.T) {
+	blob := mkTarball(t, `{"name": "@acme/widget", "version": "1.2.3"}`)
+	pkg, err := ReadPackage(bytes.NewReader(blob))
+	require.NoError(t, err)
+	assert.Equal(t, "@acme/widget", pkg.Name)
+	assert.Equal(t, "1.2.3", pkg.Version)
+	d := sha512.Sum512(blob)
+	assert.Equal(t, d[:], pkg.SHA512)
+	assert.Equal(t, "pkg:npm/%40acme/widget@1.2.3", pkg.PURL())
+
+	_, err = ReadPackage(bytes.NewReader(mkTarball(t, `{"name": "widget"}`)))
+	assert.Error(t, err)
+}
+
+func TestProvenance(t *testing.T) {
+	cert := mkCert(t)
+	pkg, err := ReadPackage(bytes.NewReader(mkTarball(t, `{"name": "widget", "version": "1.0.0"}`)))
+	require.NoError(t, err)
+	stmt, err := ProvenanceStatement(pkg, BuildInfo{
+		SourceURI:    "git+https://example.com/widget@refs/heads/main",
+		SourceCommit: "0123456789abcdef0123456789abcdef01234567",
+	})
+	require.NoError(t, err)
+	payload, err := json.Marshal(stmt)
+	require.NoError(t, err)
+	bundle, err := sigstore.SignDSSE(context.Background(), cert, intoto.PayloadType, payload)
+	require.NoError(t, err)
+	blob, err := json.Marshal(bundle)
+	require.NoError(t, err)
+	bundle, err = sigstore.Parse(blob)
+	require.NoError(t, err)
+
+	v, prov, err := VerifyProvenance(bundle, pkg)
+	require.NoError(t, err)
+	assert.Equal(t, cert.Leaf.Raw, v.Certificate.Raw)
+	assert.Equal(t, DefaultBuilderID, prov.RunDetails.Builder.ID)
+	require.Len(t, prov.BuildDefinition.ResolvedDependencies, 1)
+	assert.Equal(t, "0123456789abcdef0123456789abcdef01234567", prov.BuildDefinition.ResolvedDependencies[0].Digest["gitCommit"])
+
+	other := *pkg
+	other.Version = "1.0.1"
+	_, _, err = VerifyProvenance(bundle, &other)
+	assert.Error(t, err)
+}
+
+func TestRegistrySignature(t *testing.T) {
+	cert := mkCert(t)
+	pkg := &Package{Name: "widget", Version: "1.0.0", SHA512: make([]byte, 64)}
+	sig, err := SignRegistry(cert.Signer(), pkg)
+	require.NoError(t, err)
+	assert.Regexp(t, `^SHA256:[A-Za-z0-9+/]{43}$`, sig.KeyID)
+	require.NoError(t, sig.Verify(cert.Leaf.PublicKey, pkg))
+	pkg.SHA512[0] = 1
+	assert.Error(t, sig.Verify(cert.Leaf.PublicKey, pkg))
+}
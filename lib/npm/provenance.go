@@ -0,0 +1,102 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package npm
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/sassoftware/relic/v7/lib/intoto"
+	"github.com/sassoftware/relic/v7/lib/sigstore"
+	"github.com/sassoftware/relic/v7/lib/slsa"
+)
+
+const (
+	// ProvenancePredicate is the SLSA v1 provenance predicate type
+	ProvenancePredicate = slsa.PredicateType
+	// DefaultBuildType describes builds whose provenance was signed by relic
+	DefaultBuildType = "https://github.com/sassoftware/relic/npm-publish/v1"
+	// DefaultBuilderID is used when the caller doesn't identify the builder
+	DefaultBuilderID = slsa.DefaultBuilderID
+)
+
+// BuildInfo describes how the package was built
+type BuildInfo struct {
+	BuildType    string
+	BuilderID    string
+	InvocationID string
+	// SourceURI is a git URI of the source the package was built from, e.g.
+	// git+https://example.com/repo@refs/heads/main
+	SourceURI    string
+	SourceCommit string
+}
+
+// ProvenanceStatement returns an in-toto statement holding SLSA provenance
+// for the package
+func ProvenanceStatement(pkg *Package, info BuildInfo) (*intoto.Statement, error) {
+	build := slsa.BuildInfo{
+		BuildType:    info.BuildType,
+		BuilderID:    info.BuilderID,
+		InvocationID: info.InvocationID,
+		ExternalParameters: map[string]interface{}{
+			"package": map[string]string{"name": pkg.Name, "version": pkg.Version},
+		},
+	}
+	if build.BuildType == "" {
+		build.BuildType = DefaultBuildType
+	}
+	if info.SourceURI != "" {
+		dep := slsa.ResourceDescriptor{URI: info.SourceURI}
+		if info.SourceCommit != "" {
+			dep.Digest = map[string]string{"gitCommit": info.SourceCommit}
+		}
+		build.Materials = []slsa.ResourceDescriptor{dep}
+		build.ExternalParameters["source"] = info.SourceURI
+	}
+	return slsa.Statement([]intoto.Subject{{
+		Name:   pkg.PURL(),
+		Digest: map[string]string{"sha512": hex.EncodeToString(pkg.SHA512)},
+	}}, build)
+}
+
+// VerifyProvenance checks a provenance bundle against the package it
+// describes
+func VerifyProvenance(bundle *sigstore.Bundle, pkg *Package) (*sigstore.Verified, *slsa.Provenance, error) {
+	if bundle.DSSEEnvelope == nil {
+		return nil, nil, errors.New("provenance bundle has no DSSE envelope")
+	}
+	if bundle.DSSEEnvelope.PayloadType != intoto.PayloadType {
+		return nil, nil, fmt.Errorf("unexpected provenance payload type %q", bundle.DSSEEnvelope.PayloadType)
+	}
+	v, err := bundle.Verify(nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	stmt, err := intoto.Parse(v.Payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	prov, err := slsa.Parse(stmt)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := stmt.CheckSubjectDigest(pkg.PURL(), "sha512", pkg.SHA512); err != nil {
+		return nil, nil, err
+	}
+	return v, prov, nil
+}
@@ -0,0 +1,77 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package npm
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+)
+
+// RegistrySignature is an entry in the dist.signatures list of a registry's
+// package metadata, as checked by "npm audit signatures"
+type RegistrySignature struct {
+	KeyID string `json:"keyid"`
+	Sig   []byte `json:"sig"`
+}
+
+// KeyID returns the registry key ID of a public key
+func KeyID(pub crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	d := sha256.Sum256(der)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(d[:]), nil
+}
+
+func registryMessage(pkg *Package) []byte {
+	return []byte(pkg.Name + "@" + pkg.Version + ":" + pkg.Integrity())
+}
+
+// SignRegistry signs the package's name, version and integrity the way a
+// registry does when serving it
+func SignRegistry(signer crypto.Signer, pkg *Package) (*RegistrySignature, error) {
+	keyID, err := KeyID(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	d := sha256.Sum256(registryMessage(pkg))
+	sig, err := signer.Sign(rand.Reader, d[:], crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	return &RegistrySignature{KeyID: keyID, Sig: sig}, nil
+}
+
+// Verify a registry signature over the package
+func (s *RegistrySignature) Verify(pub crypto.PublicKey, pkg *Package) error {
+	keyID, err := KeyID(pub)
+	if err != nil {
+		return err
+	}
+	if keyID != s.KeyID {
+		return errors.New("registry signature was made by a different key")
+	}
+	d := sha256.Sum256(registryMessage(pkg))
+	return x509tools.Verify(pub, crypto.SHA256, d[:], s.Sig)
+}
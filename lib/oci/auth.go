@@ -0,0 +1,186 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package oci
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sassoftware/relic/v7/config"
+)
+
+func scope(ref Reference, push bool) string {
+	s := "repository:" + ref.Repository + ":pull"
+	if push {
+		s += ",push"
+	}
+	return s
+}
+
+func (c *Client) authorize(req *http.Request, ref Reference, push bool) {
+	c.mu.Lock()
+	token := c.tokens[ref.Registry+" "+scope(ref, push)]
+	c.mu.Unlock()
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+}
+
+// login answers an authentication challenge, caching the resulting
+// authorization header for the repository
+func (c *Client) login(ctx context.Context, ref Reference, challenge string, push bool) error {
+	var user, pass string
+	if c.Credentials != nil {
+		user, pass = c.Credentials(ref.Registry)
+	}
+	scheme, params := parseChallenge(challenge)
+	var token string
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if user == "" {
+			return fmt.Errorf("registry %s requires credentials", ref.Registry)
+		}
+		token = "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+pass))
+	case "bearer":
+		realm, err := url.Parse(params["realm"])
+		if err != nil || realm.Host == "" {
+			return fmt.Errorf("registry %s sent an invalid auth realm", ref.Registry)
+		}
+		q := realm.Query()
+		if params["service"] != "" {
+			q.Set("service", params["service"])
+		}
+		q.Set("scope", scope(ref, push))
+		realm.RawQuery = q.Encode()
+		req, err := http.NewRequestWithContext(ctx, "GET", realm.String(), nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("User-Agent", config.UserAgent)
+		if user != "" {
+			req.SetBasicAuth(user, pass)
+		}
+		resp, err := c.HTTPClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			blob, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+			return fmt.Errorf("registry token request failed: HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(blob)))
+		}
+		var body struct {
+			Token       string `json:"token"`
+			AccessToken string `json:"access_token"`
+		}
+		if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+			return fmt.Errorf("parsing registry token: %w", err)
+		}
+		if body.Token == "" {
+			body.Token = body.AccessToken
+		}
+		if body.Token == "" {
+			return errors.New("registry returned an empty token")
+		}
+		token = "Bearer " + body.Token
+	default:
+		return fmt.Errorf("registry %s requested unsupported authentication %q", ref.Registry, scheme)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.tokens == nil {
+		c.tokens = make(map[string]string)
+	}
+	c.tokens[ref.Registry+" "+scope(ref, push)] = token
+	return nil
+}
+
+// parseChallenge splits a WWW-Authenticate header into its scheme and
+// parameters
+func parseChallenge(challenge string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(challenge), " ")
+	params := make(map[string]string)
+	for rest != "" {
+		var key, value string
+		key, rest, _ = strings.Cut(strings.TrimLeft(rest, " ,"), "=")
+		if strings.HasPrefix(rest, `"`) {
+			value, rest, _ = strings.Cut(rest[1:], `"`)
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		params[strings.ToLower(strings.TrimSpace(key))] = value
+	}
+	return scheme, params
+}
+
+// DockerCredentials looks up credentials stored by "docker login" or "podman
+// login". Credential helpers are not supported.
+func DockerCredentials(host string) (username, password string) {
+	var paths []string
+	if p := os.Getenv("REGISTRY_AUTH_FILE"); p != "" {
+		paths = append(paths, p)
+	}
+	if d := os.Getenv("XDG_RUNTIME_DIR"); d != "" {
+		paths = append(paths, filepath.Join(d, "containers", "auth.json"))
+	}
+	if d := os.Getenv("DOCKER_CONFIG"); d != "" {
+		paths = append(paths, filepath.Join(d, "config.json"))
+	} else if home, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, filepath.Join(home, ".docker", "config.json"))
+	}
+	candidates := []string{host, "https://" + host, "https://" + host + "/v1/"}
+	if host == DockerHub {
+		candidates = append(candidates, "docker.io", "https://index.docker.io/v1/")
+	}
+	for _, p := range paths {
+		blob, err := os.ReadFile(p)
+		if err != nil {
+			continue
+		}
+		var cfg struct {
+			Auths map[string]struct {
+				Auth string `json:"auth"`
+			} `json:"auths"`
+		}
+		if json.Unmarshal(blob, &cfg) != nil {
+			continue
+		}
+		for _, name := range candidates {
+			entry, ok := cfg.Auths[name]
+			if !ok {
+				continue
+			}
+			decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+			if err != nil {
+				continue
+			}
+			if user, pass, ok := strings.Cut(string(decoded), ":"); ok {
+				return user, pass
+			}
+		}
+	}
+	return "", ""
+}
@@ -0,0 +1,362 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package oci
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sassoftware/relic/v7/config"
+)
+
+const maxManifest = 4 << 20
+
+var manifestAccept = strings.Join([]string{
+	MediaTypeImageManifest,
+	MediaTypeImageIndex,
+	MediaTypeDockerManifest,
+	MediaTypeDockerList,
+}, ", ")
+
+// ErrNotFound is returned when a manifest or blob does not exist
+var ErrNotFound = errors.New("not found in registry")
+
+// Client talks to OCI registries
+type Client struct {
+	HTTPClient *http.Client
+	// Credentials returns the username and password for a registry host, or
+	// empty strings for anonymous access
+	Credentials func(host string) (username, password string)
+	// PlainHTTP talks to registries without TLS
+	PlainHTTP bool
+
+	mu     sync.Mutex
+	tokens map[string]string
+}
+
+// NewClient returns a client that reads credentials from the docker or
+// podman configuration
+func NewClient() *Client {
+	return &Client{
+		HTTPClient:  &http.Client{Timeout: 5 * time.Minute},
+		Credentials: DockerCredentials,
+	}
+}
+
+// HTTPError is a non-success response from a registry
+type HTTPError struct {
+	Method, URL string
+	StatusCode  int
+	Body        string
+}
+
+func (e HTTPError) Error() string {
+	return fmt.Sprintf("%s %s: HTTP %d: %s", e.Method, e.URL, e.StatusCode, e.Body)
+}
+
+func (c *Client) baseURL(ref Reference) string {
+	scheme := "https"
+	if c.PlainHTTP {
+		scheme = "http"
+	}
+	return scheme + "://" + ref.Registry + "/v2/" + ref.Repository + "/"
+}
+
+// do sends a request, authenticating and retrying if the registry asks for
+// it
+func (c *Client) do(ctx context.Context, ref Reference, method, target string, header http.Header, body []byte, push bool) (*http.Response, error) {
+	if !strings.Contains(target, "://") {
+		target = c.baseURL(ref) + target
+	}
+	var challenged bool
+	for {
+		req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		req.Header.Set("User-Agent", config.UserAgent)
+		c.authorize(req, ref, push)
+		resp, err := c.HTTPClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusUnauthorized || challenged {
+			return resp, nil
+		}
+		challenge := resp.Header.Get("Www-Authenticate")
+		resp.Body.Close()
+		if err := c.login(ctx, ref, challenge, push); err != nil {
+			return nil, err
+		}
+		challenged = true
+	}
+}
+
+// check returns an error for unexpected status codes, consuming the body
+func check(resp *http.Response, ok ...int) error {
+	for _, code := range ok {
+		if resp.StatusCode == code {
+			return nil
+		}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	blob, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return HTTPError{
+		Method:     resp.Request.Method,
+		URL:        resp.Request.URL.String(),
+		StatusCode: resp.StatusCode,
+		Body:       strings.TrimSpace(string(blob)),
+	}
+}
+
+// GetManifest fetches a manifest or index by tag or digest, returning its
+// contents, media type and digest
+func (c *Client) GetManifest(ctx context.Context, ref Reference) (blob []byte, mediaType, digest string, err error) {
+	resp, err := c.do(ctx, ref, "GET", "manifests/"+ref.Identifier(), http.Header{"Accept": {manifestAccept}}, nil, false)
+	if err != nil {
+		return nil, "", "", err
+	}
+	if err := check(resp, http.StatusOK); err != nil {
+		return nil, "", "", err
+	}
+	defer resp.Body.Close()
+	blob, err = io.ReadAll(io.LimitReader(resp.Body, maxManifest))
+	if err != nil {
+		return nil, "", "", err
+	}
+	digest = Digest(blob)
+	if ref.Digest != "" && ref.Digest != digest {
+		return nil, "", "", fmt.Errorf("manifest digest mismatch: expected %s, got %s", ref.Digest, digest)
+	}
+	return blob, resp.Header.Get("Content-Type"), digest, nil
+}
+
+// Resolve returns the descriptor of the manifest a reference points to
+func (c *Client) Resolve(ctx context.Context, ref Reference) (Descriptor, error) {
+	blob, mediaType, digest, err := c.GetManifest(ctx, ref)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	return Descriptor{MediaType: mediaType, Digest: digest, Size: int64(len(blob))}, nil
+}
+
+// PutManifest uploads a manifest under a tag or its digest. The returned
+// subjectSupported is true if the registry processed the manifest's subject
+// field, i.e. it implements the referrers API.
+func (c *Client) PutManifest(ctx context.Context, ref Reference, mediaType string, blob []byte) (digest string, subjectSupported bool, err error) {
+	digest = Digest(blob)
+	target := ref.Tag
+	if target == "" {
+		target = digest
+	}
+	resp, err := c.do(ctx, ref, "PUT", "manifests/"+target, http.Header{"Content-Type": {mediaType}}, blob, true)
+	if err != nil {
+		return "", false, err
+	}
+	if err := check(resp, http.StatusCreated, http.StatusOK); err != nil {
+		return "", false, err
+	}
+	resp.Body.Close()
+	return digest, resp.Header.Get("OCI-Subject") != "", nil
+}
+
+// GetBlob fetches a blob, up to a limit
+func (c *Client) GetBlob(ctx context.Context, ref Reference, digest string, limit int64) ([]byte, error) {
+	resp, err := c.do(ctx, ref, "GET", "blobs/"+digest, nil, nil, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := check(resp, http.StatusOK); err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	blob, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	} else if int64(len(blob)) > limit {
+		return nil, fmt.Errorf("blob %s is too large", digest)
+	}
+	if Digest(blob) != digest {
+		return nil, fmt.Errorf("blob digest mismatch for %s", digest)
+	}
+	return blob, nil
+}
+
+// PutBlob uploads a blob unless the registry already has it
+func (c *Client) PutBlob(ctx context.Context, ref Reference, blob []byte) (string, error) {
+	digest := Digest(blob)
+	resp, err := c.do(ctx, ref, "HEAD", "blobs/"+digest, nil, nil, true)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return digest, nil
+	}
+	resp, err = c.do(ctx, ref, "POST", "blobs/uploads/", nil, nil, true)
+	if err != nil {
+		return "", err
+	}
+	if err := check(resp, http.StatusAccepted); err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	loc, err := resp.Request.URL.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return "", fmt.Errorf("invalid upload location: %w", err)
+	}
+	q := loc.Query()
+	q.Set("digest", digest)
+	loc.RawQuery = q.Encode()
+	resp, err = c.do(ctx, ref, "PUT", loc.String(), http.Header{"Content-Type": {"application/octet-stream"}}, blob, true)
+	if err != nil {
+		return "", err
+	}
+	if err := check(resp, http.StatusCreated); err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return digest, nil
+}
+
+// Referrers lists manifests whose subject is the given digest, optionally
+// filtered by artifact type. Registries without the referrers API are
+// queried using the referrers tag schema.
+func (c *Client) Referrers(ctx context.Context, ref Reference, digest, artifactType string) ([]Descriptor, error) {
+	target := "referrers/" + digest
+	if artifactType != "" {
+		target += "?artifactType=" + url.QueryEscape(artifactType)
+	}
+	resp, err := c.do(ctx, ref, "GET", target, http.Header{"Accept": {MediaTypeImageIndex}}, nil, false)
+	if err != nil {
+		return nil, err
+	}
+	var index Index
+	if err := check(resp, http.StatusOK); err == ErrNotFound {
+		index, err = c.referrersTag(ctx, ref, digest)
+		if err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	} else {
+		defer resp.Body.Close()
+		if err := json.NewDecoder(io.LimitReader(resp.Body, maxManifest)).Decode(&index); err != nil {
+			return nil, fmt.Errorf("parsing referrers: %w", err)
+		}
+	}
+	var ret []Descriptor
+	for _, desc := range index.Manifests {
+		if artifactType == "" || desc.ArtifactType == artifactType {
+			ret = append(ret, desc)
+		}
+	}
+	return ret, nil
+}
+
+func (c *Client) referrersTag(ctx context.Context, ref Reference, digest string) (Index, error) {
+	var index Index
+	tag, err := DigestTag(digest)
+	if err != nil {
+		return index, err
+	}
+	blob, _, _, err := c.GetManifest(ctx, ref.WithTag(tag))
+	if err == ErrNotFound {
+		return Index{SchemaVersion: 2, MediaType: MediaTypeImageIndex}, nil
+	} else if err != nil {
+		return index, err
+	}
+	if err := json.Unmarshal(blob, &index); err != nil {
+		return index, fmt.Errorf("parsing referrers tag: %w", err)
+	}
+	return index, nil
+}
+
+// AddReferrer records a manifest in the referrers tag schema index of its
+// subject. It's only needed when PutManifest reports that the registry didn't
+// process the subject.
+func (c *Client) AddReferrer(ctx context.Context, ref Reference, subject string, desc Descriptor) error {
+	index, err := c.referrersTag(ctx, ref, subject)
+	if err != nil {
+		return err
+	}
+	for _, existing := range index.Manifests {
+		if existing.Digest == desc.Digest {
+			return nil
+		}
+	}
+	index.Manifests = append(index.Manifests, desc)
+	blob, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	tag, _ := DigestTag(subject)
+	_, _, err = c.PutManifest(ctx, ref.WithTag(tag), MediaTypeImageIndex, blob)
+	return err
+}
+
+// PushReferrer pushes a blob as the single layer of an artifact manifest
+// whose subject is the given manifest, and records it in the referrers tag
+// schema if the registry didn't process the subject
+func (c *Client) PushReferrer(ctx context.Context, ref Reference, subject Descriptor, artifactType, mediaType string, blob []byte, annotations map[string]string) (string, error) {
+	if _, err := c.PutBlob(ctx, ref, EmptyJSON); err != nil {
+		return "", err
+	}
+	if _, err := c.PutBlob(ctx, ref, blob); err != nil {
+		return "", err
+	}
+	manifest := Manifest{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeImageManifest,
+		ArtifactType:  artifactType,
+		Config:        NewDescriptor(MediaTypeEmpty, EmptyJSON),
+		Layers:        []Descriptor{NewDescriptor(mediaType, blob)},
+		Subject:       &subject,
+		Annotations:   annotations,
+	}
+	mblob, err := json.Marshal(manifest)
+	if err != nil {
+		return "", err
+	}
+	digest, subjectSupported, err := c.PutManifest(ctx, ref.WithDigest(Digest(mblob)), MediaTypeImageManifest, mblob)
+	if err != nil || subjectSupported {
+		return digest, err
+	}
+	desc := Descriptor{
+		MediaType:    MediaTypeImageManifest,
+		Digest:       digest,
+		Size:         int64(len(mblob)),
+		ArtifactType: artifactType,
+		Annotations:  annotations,
+	}
+	return digest, c.AddReferrer(ctx, ref, subject.Digest, desc)
+}
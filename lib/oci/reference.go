@@ -0,0 +1,122 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package oci is a small client for OCI distribution registries, covering
+// what is needed to attach signatures to images.
+package oci
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DockerHub is the registry used for references without a registry name
+const DockerHub = "index.docker.io"
+
+var digestRe = regexp.MustCompile(`^[a-z0-9]+(?:[.+_-][a-z0-9]+)*:[a-zA-Z0-9=_-]+$`)
+
+// Reference names an image in a registry by tag and/or digest
+type Reference struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// ParseReference parses an image reference such as
+// registry.example.com/team/app:1.0 or app@sha256:...
+func ParseReference(s string) (Reference, error) {
+	var ref Reference
+	name := s
+	if i := strings.IndexByte(name, '@'); i >= 0 {
+		ref.Digest = name[i+1:]
+		name = name[:i]
+		if !digestRe.MatchString(ref.Digest) {
+			return ref, fmt.Errorf("invalid digest in image reference %q", s)
+		}
+	}
+	if i := strings.LastIndexByte(name, ':'); i >= 0 && !strings.Contains(name[i:], "/") {
+		ref.Tag = name[i+1:]
+		name = name[:i]
+	}
+	if first, rest, ok := strings.Cut(name, "/"); ok && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		ref.Registry = first
+		ref.Repository = rest
+	} else {
+		ref.Registry = DockerHub
+		ref.Repository = name
+	}
+	if ref.Registry == "docker.io" {
+		ref.Registry = DockerHub
+	}
+	if ref.Registry == DockerHub && !strings.Contains(ref.Repository, "/") {
+		ref.Repository = "library/" + ref.Repository
+	}
+	if ref.Repository == "" || ref.Repository != strings.ToLower(ref.Repository) {
+		return ref, fmt.Errorf("invalid repository in image reference %q", s)
+	}
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = "latest"
+	}
+	return ref, nil
+}
+
+// Name returns the registry and repository without a tag or digest
+func (r Reference) Name() string {
+	return r.Registry + "/" + r.Repository
+}
+
+// String returns the full reference
+func (r Reference) String() string {
+	s := r.Name()
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
+
+// Identifier returns the digest if there is one, otherwise the tag
+func (r Reference) Identifier() string {
+	if r.Digest != "" {
+		return r.Digest
+	}
+	return r.Tag
+}
+
+// WithDigest returns a reference to the same repository by digest only
+func (r Reference) WithDigest(digest string) Reference {
+	return Reference{Registry: r.Registry, Repository: r.Repository, Digest: digest}
+}
+
+// WithTag returns a reference to the same repository by tag only
+func (r Reference) WithTag(tag string) Reference {
+	return Reference{Registry: r.Registry, Repository: r.Repository, Tag: tag}
+}
+
+// DigestTag returns a tag derived from a digest, as used by the referrers
+// tag schema and cosign, e.g. sha256-abcd...
+func DigestTag(digest string) (string, error) {
+	alg, hex, ok := strings.Cut(digest, ":")
+	if !ok {
+		return "", errors.New("invalid digest")
+	}
+	return alg + "-" + hex, nil
+}
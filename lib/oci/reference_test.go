@@ -0,0 +1,50 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package oci
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseReference(t *testing.T) {
+	digest := "sha256:" + "ab01234567890123456789012345678901234567890123456789012345678901"[:64]
+	cases := []struct {
+		in   string
+		want Reference
+	}{
+		{"ubuntu", Reference{Registry: DockerHub, Repository: "library/ubuntu", Tag: "latest"}},
+		{"docker.io/acme/app:1.0", Reference{Registry: DockerHub, Repository: "acme/app", Tag: "1.0"}},
+		{"localhost:5000/app", Reference{Registry: "localhost:5000", Repository: "app", Tag: "latest"}},
+		{"ghcr.io/acme/tools/app:v2@" + digest, Reference{Registry: "ghcr.io", Repository: "acme/tools/app", Tag: "v2", Digest: digest}},
+		{"registry.example.com:8443/app@" + digest, Reference{Registry: "registry.example.com:8443", Repository: "app", Digest: digest}},
+	}
+	for _, c := range cases {
+		ref, err := ParseReference(c.in)
+		require.NoError(t, err, c.in)
+		assert.Equal(t, c.want, ref, c.in)
+	}
+	for _, bad := range []string{"Upper/case", "app@sha256", "ghcr.io/"} {
+		_, err := ParseReference(bad)
+		assert.Error(t, err, bad)
+	}
+	tag, err := DigestTag(digest)
+	require.NoError(t, err)
+	assert.Equal(t, "sha256-"+digest[7:], tag)
+}
@@ -0,0 +1,105 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package ostree
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/sassoftware/relic/v7/lib/gvariant"
+)
+
+const (
+	// BundleType is the GVariant type of a Flatpak single-file bundle, which
+	// is an OSTree static delta superblock
+	BundleType = "(a{sv}tayay" + CommitType + "aya(uayttay)a(yaytt))"
+	// CommitMetaKey holds the commit's detached metadata in the bundle
+	// metadata
+	CommitMetaKey = "ostree.commitmeta"
+)
+
+// Bundle is a parsed Flatpak single-file bundle
+type Bundle struct {
+	fields []interface{}
+	commit []byte
+}
+
+// ParseBundle parses a Flatpak bundle and checks that the embedded commit
+// matches the checksum in the bundle header
+func ParseBundle(blob []byte) (*Bundle, error) {
+	v, err := gvariant.Unmarshal(BundleType, blob)
+	if err != nil {
+		return nil, fmt.Errorf("parsing flatpak bundle: %w", err)
+	}
+	b := &Bundle{fields: v.([]interface{})}
+	b.commit, err = gvariant.Marshal(CommitType, b.fields[4])
+	if err != nil {
+		return nil, err
+	}
+	if Checksum(b.commit) != hex.EncodeToString(b.fields[3].([]byte)) {
+		return nil, errors.New("flatpak bundle commit does not match its checksum")
+	}
+	return b, nil
+}
+
+// Commit returns the serialized commit object
+func (b *Bundle) Commit() []byte {
+	return b.commit
+}
+
+// Ref returns the ref the bundle installs, if known
+func (b *Bundle) Ref() string {
+	v, ok := gvariant.DictEntry(b.fields[0].([]interface{}), "ref")
+	if variant, isVariant := v.(gvariant.Variant); ok && isVariant {
+		ref, _ := variant.Value.(string)
+		return ref
+	}
+	return ""
+}
+
+// DetachedMetadata returns the serialized detached metadata of the commit,
+// or nil if there is none
+func (b *Bundle) DetachedMetadata() ([]byte, error) {
+	v, ok := gvariant.DictEntry(b.fields[0].([]interface{}), CommitMetaKey)
+	if !ok {
+		return nil, nil
+	}
+	variant, ok := v.(gvariant.Variant)
+	if !ok || variant.Type != MetaType {
+		return nil, errors.New("flatpak bundle has malformed detached metadata")
+	}
+	return gvariant.Marshal(MetaType, variant.Value)
+}
+
+// SetDetachedMetadata replaces the detached metadata of the commit
+func (b *Bundle) SetDetachedMetadata(meta []byte) error {
+	dict, err := parseMeta(meta)
+	if err != nil {
+		return err
+	}
+	if dict == nil {
+		dict = []interface{}{}
+	}
+	b.fields[0] = gvariant.SetDictEntry(b.fields[0].([]interface{}), CommitMetaKey, gvariant.Variant{Type: MetaType, Value: dict})
+	return nil
+}
+
+// Marshal serializes the bundle
+func (b *Bundle) Marshal() ([]byte, error) {
+	return gvariant.Marshal(BundleType, b.fields)
+}
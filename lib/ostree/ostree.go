@@ -0,0 +1,138 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package ostree signs OSTree commits using the ed25519 "ostree.sign" format,
+// either as detached commit metadata or inside a Flatpak single-file bundle.
+package ostree
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/sassoftware/relic/v7/lib/gvariant"
+)
+
+const (
+	// CommitType is the GVariant type of a commit object
+	CommitType = "(a{sv}aya(say)sstayay)"
+	// MetaType is the GVariant type of detached commit metadata
+	MetaType = "a{sv}"
+	// SignKey holds ed25519 signatures in detached commit metadata
+	SignKey = "ostree.sign.ed25519"
+
+	sigsType = "aay"
+)
+
+// Checksum returns the object name of a commit
+func Checksum(commit []byte) string {
+	d := sha256.Sum256(commit)
+	return hex.EncodeToString(d[:])
+}
+
+// Subject returns the subject line of a commit
+func Subject(commit []byte) (string, error) {
+	v, err := gvariant.Unmarshal(CommitType, commit)
+	if err != nil {
+		return "", fmt.Errorf("parsing commit: %w", err)
+	}
+	subject, _ := v.([]interface{})[3].(string)
+	return subject, nil
+}
+
+// Sign a commit object
+func Sign(commit []byte, signer crypto.Signer) ([]byte, error) {
+	if _, ok := signer.Public().(ed25519.PublicKey); !ok {
+		return nil, errors.New("ostree signatures require an ed25519 key")
+	}
+	if _, err := gvariant.Unmarshal(CommitType, commit); err != nil {
+		return nil, fmt.Errorf("parsing commit: %w", err)
+	}
+	return signer.Sign(rand.Reader, commit, crypto.Hash(0))
+}
+
+// AddSignature adds a signature to serialized detached metadata, which may be
+// empty. If replace is true then any existing signatures are dropped.
+func AddSignature(meta, sig []byte, replace bool) ([]byte, error) {
+	dict, err := parseMeta(meta)
+	if err != nil {
+		return nil, err
+	}
+	var sigs []interface{}
+	if !replace {
+		sigs = signatures(dict)
+	}
+	found := false
+	for _, existing := range sigs {
+		if bytes.Equal(existing.([]byte), sig) {
+			found = true
+		}
+	}
+	if !found {
+		sigs = append(sigs, sig)
+	}
+	dict = gvariant.SetDictEntry(dict, SignKey, gvariant.Variant{Type: sigsType, Value: sigs})
+	return gvariant.Marshal(MetaType, dict)
+}
+
+// Verify that the detached metadata contains a valid signature of the commit
+// from one of the given keys, returning the key that matched
+func Verify(commit, meta []byte, keys []ed25519.PublicKey) (ed25519.PublicKey, error) {
+	dict, err := parseMeta(meta)
+	if err != nil {
+		return nil, err
+	}
+	sigs := signatures(dict)
+	if len(sigs) == 0 {
+		return nil, errors.New("commit is not signed")
+	}
+	for _, sig := range sigs {
+		for _, key := range keys {
+			if ed25519.Verify(key, commit, sig.([]byte)) {
+				return key, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("none of %d signatures matched a trusted key", len(sigs))
+}
+
+func parseMeta(meta []byte) ([]interface{}, error) {
+	if len(meta) == 0 {
+		return nil, nil
+	}
+	v, err := gvariant.Unmarshal(MetaType, meta)
+	if err != nil {
+		return nil, fmt.Errorf("parsing detached metadata: %w", err)
+	}
+	return v.([]interface{}), nil
+}
+
+func signatures(dict []interface{}) []interface{} {
+	v, ok := gvariant.DictEntry(dict, SignKey)
+	if !ok {
+		return nil
+	}
+	variant, ok := v.(gvariant.Variant)
+	if !ok || variant.Type != sigsType {
+		return nil
+	}
+	return variant.Value.([]interface{})
+}
@@ -0,0 +1,111 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package ostree
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sassoftware/relic/v7/lib/gvariant"
+)
+
+func testCommit(t *testing.T) []byte {
+	commit, err := gvariant.Marshal(CommitType, []interface{}{
+		[]interface{}{},
+		[]byte{},
+		[]interface{}{},
+		"Release 1.0",
+		"",
+		uint64(1700000000),
+		make([]byte, 32),
+		make([]byte, 32),
+	})
+	require.NoError(t, err)
+	return commit
+}
+
+func TestSignCommit(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	commit := testCommit(t)
+	sig, err := Sign(commit, priv)
+	require.NoError(t, err)
+	meta, err := AddSignature(nil, sig, false)
+	require.NoError(t, err)
+	// adding the same signature again is a no-op
+	meta2, err := AddSignature(meta, sig, false)
+	require.NoError(t, err)
+	assert.Equal(t, meta, meta2)
+	key, err := Verify(commit, meta, []ed25519.PublicKey{pub})
+	require.NoError(t, err)
+	assert.Equal(t, pub, key)
+
+	otherPub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	_, err = Verify(commit, meta, []ed25519.PublicKey{otherPub})
+	assert.Error(t, err)
+	subject, err := Subject(commit)
+	require.NoError(t, err)
+	assert.Equal(t, "Release 1.0", subject)
+}
+
+func TestBundle(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	commit := testCommit(t)
+	commitValue, err := gvariant.Unmarshal(CommitType, commit)
+	require.NoError(t, err)
+	sum := sha256.Sum256(commit)
+	blob, err := gvariant.Marshal(BundleType, []interface{}{
+		[]interface{}{[]interface{}{"ref", gvariant.Variant{Type: "s", Value: "app/org.example.App/x86_64/stable"}}},
+		uint64(0),
+		[]byte{},
+		sum[:],
+		commitValue,
+		[]byte{},
+		[]interface{}{},
+		[]interface{}{},
+	})
+	require.NoError(t, err)
+	bundle, err := ParseBundle(blob)
+	require.NoError(t, err)
+	assert.Equal(t, commit, bundle.Commit())
+	assert.Equal(t, "app/org.example.App/x86_64/stable", bundle.Ref())
+	meta, err := bundle.DetachedMetadata()
+	require.NoError(t, err)
+	assert.Nil(t, meta)
+
+	sig, err := Sign(bundle.Commit(), priv)
+	require.NoError(t, err)
+	meta, err = AddSignature(meta, sig, false)
+	require.NoError(t, err)
+	require.NoError(t, bundle.SetDetachedMetadata(meta))
+	signed, err := bundle.Marshal()
+	require.NoError(t, err)
+	bundle, err = ParseBundle(signed)
+	require.NoError(t, err)
+	meta2, err := bundle.DetachedMetadata()
+	require.NoError(t, err)
+	assert.Equal(t, meta, meta2)
+	_, err = Verify(bundle.Commit(), meta2, []ed25519.PublicKey{priv.Public().(ed25519.PublicKey)})
+	assert.NoError(t, err)
+}
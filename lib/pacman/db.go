@@ -0,0 +1,147 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package pacman maintains the package signatures embedded in Arch Linux
+// repository databases.
+package pacman
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// UpdateSignatures copies a repository database from r to w, replacing the
+// %PGPSIG% field of each package whose file name is in sigs. The compression
+// is chosen by the database's file name. It returns the number of packages
+// that were updated.
+func UpdateSignatures(r io.Reader, w io.Writer, name string, sigs map[string][]byte) (int, error) {
+	zr, zw, err := compressors(r, w, name)
+	if err != nil {
+		return 0, err
+	}
+	tr := tar.NewReader(zr)
+	tw := tar.NewWriter(zw)
+	updated := 0
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return 0, err
+		}
+		contents, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return 0, err
+		}
+		if path.Base(hdr.Name) == "desc" {
+			var changed bool
+			contents, changed = updateDesc(contents, sigs)
+			if changed {
+				hdr.Size = int64(len(contents))
+				updated++
+			}
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return 0, err
+		}
+		if _, err := tw.Write(contents); err != nil {
+			return 0, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return 0, err
+	}
+	return updated, zw.Close()
+}
+
+// Replace the %PGPSIG% section of a desc file if its %FILENAME% has a new
+// signature
+func updateDesc(desc []byte, sigs map[string][]byte) ([]byte, bool) {
+	sections := strings.Split(strings.TrimRight(string(desc), "\n"), "\n\n")
+	var filename string
+	for _, section := range sections {
+		if strings.HasPrefix(section, "%FILENAME%\n") {
+			filename = strings.TrimPrefix(section, "%FILENAME%\n")
+		}
+	}
+	sig, ok := sigs[filename]
+	if !ok {
+		return desc, false
+	}
+	sigSection := "%PGPSIG%\n" + base64.StdEncoding.EncodeToString(sig)
+	found := false
+	for i, section := range sections {
+		if strings.HasPrefix(section, "%PGPSIG%\n") {
+			sections[i] = sigSection
+			found = true
+		}
+	}
+	if !found {
+		sections = append(sections, sigSection)
+	}
+	return []byte(strings.Join(sections, "\n\n") + "\n\n"), true
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+func compressors(r io.Reader, w io.Writer, name string) (io.Reader, io.WriteCloser, error) {
+	switch path.Ext(name) {
+	case ".gz":
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		return zr, gzip.NewWriter(w), nil
+	case ".zst":
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		zw, err := zstd.NewWriter(w)
+		if err != nil {
+			return nil, nil, err
+		}
+		return zr, zw, nil
+	case ".tar":
+		return r, nopWriteCloser{w}, nil
+	case ".xz", ".bz2":
+		return nil, nil, errors.New("rewriting xz and bzip2 databases is not supported; use gzip or zstd")
+	default:
+		// repo-add sniffs the contents in this case, so do the same
+		var buf bytes.Buffer
+		if _, err := io.Copy(&buf, r); err != nil {
+			return nil, nil, err
+		}
+		if bytes.HasPrefix(buf.Bytes(), []byte{0x1f, 0x8b}) {
+			return compressors(&buf, w, name+".gz")
+		} else if bytes.HasPrefix(buf.Bytes(), []byte{0x28, 0xb5, 0x2f, 0xfd}) {
+			return compressors(&buf, w, name+".zst")
+		}
+		return nil, nil, fmt.Errorf("unrecognized database compression: %s", name)
+	}
+}
@@ -0,0 +1,67 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pacman_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sassoftware/relic/v7/lib/pacman"
+)
+
+const testDesc = "%FILENAME%\nfoo-1.0-1-x86_64.pkg.tar.zst\n\n%NAME%\nfoo\n\n%PGPSIG%\nb2xk\n\n"
+
+func TestUpdateSignatures(t *testing.T) {
+	var src bytes.Buffer
+	zw := gzip.NewWriter(&src)
+	tw := tar.NewWriter(zw)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "foo-1.0-1/", Typeflag: tar.TypeDir, Mode: 0755}))
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "foo-1.0-1/desc", Mode: 0644, Size: int64(len(testDesc))}))
+	_, err := tw.Write([]byte(testDesc))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	require.NoError(t, zw.Close())
+
+	var dest bytes.Buffer
+	sigs := map[string][]byte{"foo-1.0-1-x86_64.pkg.tar.zst": []byte("new")}
+	n, err := pacman.UpdateSignatures(&src, &dest, "core.db.tar.gz", sigs)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	zr, err := gzip.NewReader(&dest)
+	require.NoError(t, err)
+	tr := tar.NewReader(zr)
+	_, err = tr.Next()
+	require.NoError(t, err)
+	hdr, err := tr.Next()
+	require.NoError(t, err)
+	assert.Equal(t, "foo-1.0-1/desc", hdr.Name)
+	desc, err := ioutil.ReadAll(tr)
+	require.NoError(t, err)
+	assert.Equal(t, "%FILENAME%\nfoo-1.0-1-x86_64.pkg.tar.zst\n\n%NAME%\nfoo\n\n%PGPSIG%\nbmV3\n\n", string(desc))
+}
+
+func TestUpdateSignaturesUnsupported(t *testing.T) {
+	_, err := pacman.UpdateSignatures(bytes.NewReader(nil), ioutil.Discard, "core.db.tar.xz", nil)
+	assert.Error(t, err)
+}
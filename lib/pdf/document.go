@@ -0,0 +1,534 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+type xrefEntry struct {
+	// offset in the file, or the object stream holding the object
+	offset int64
+	gen    int
+	stream int
+	index  int
+}
+
+// Document is a parsed PDF file
+type Document struct {
+	data    []byte
+	xref    map[int]xrefEntry
+	Trailer Dict
+	// startxref of the last revision
+	startxref int64
+	// true if the last revision used a cross-reference stream
+	xrefStream bool
+	cache      map[int]Object
+}
+
+// Open parses the cross-reference sections of a PDF file
+func Open(data []byte) (*Document, error) {
+	head := data
+	if len(head) > 1024 {
+		head = head[:1024]
+	}
+	if !bytes.Contains(head, []byte("%PDF-")) {
+		return nil, errors.New("pdf: not a PDF file")
+	}
+	tail := data
+	if len(tail) > 1024 {
+		tail = tail[len(tail)-1024:]
+	}
+	i := bytes.LastIndex(tail, []byte("startxref"))
+	if i < 0 {
+		return nil, errors.New("pdf: startxref not found")
+	}
+	p := &parser{buf: tail, pos: i + len("startxref")}
+	startxref, ok := p.integer()
+	if !ok || startxref < 0 || startxref >= int64(len(data)) {
+		return nil, errors.New("pdf: invalid startxref")
+	}
+	d := &Document{
+		data:      data,
+		xref:      make(map[int]xrefEntry),
+		startxref: startxref,
+		cache:     make(map[int]Object),
+	}
+	seen := make(map[int64]bool)
+	offset := startxref
+	for first := true; ; first = false {
+		if seen[offset] {
+			return nil, errors.New("pdf: loop in cross-reference sections")
+		}
+		seen[offset] = true
+		trailer, isStream, err := d.readXref(offset)
+		if err != nil {
+			return nil, err
+		}
+		if first {
+			d.Trailer = trailer
+			d.xrefStream = isStream
+		}
+		// hybrid files have a cross-reference stream for newer readers
+		if stm, ok := trailer["XRefStm"].(int64); ok && !isStream {
+			if _, _, err := d.readXref(stm); err != nil {
+				return nil, err
+			}
+		}
+		prev, ok := trailer["Prev"].(int64)
+		if !ok {
+			break
+		}
+		offset = prev
+	}
+	if d.Trailer.Get("Encrypt") != nil {
+		return nil, errors.New("pdf: encrypted documents are not supported")
+	}
+	if _, ok := d.Trailer["Root"].(Ref); !ok {
+		return nil, errors.New("pdf: trailer has no Root")
+	}
+	return d, nil
+}
+
+// Size returns the length of the original file
+func (d *Document) Size() int64 {
+	return int64(len(d.data))
+}
+
+// add an entry unless a newer section already defined it
+func (d *Document) addEntry(num int, e xrefEntry) {
+	if _, ok := d.xref[num]; !ok {
+		d.xref[num] = e
+	}
+}
+
+func (d *Document) readXref(offset int64) (Dict, bool, error) {
+	if offset < 0 || offset >= int64(len(d.data)) {
+		return nil, false, errors.New("pdf: invalid cross-reference offset")
+	}
+	p := &parser{buf: d.data, pos: int(offset), length: d.streamLength}
+	save := p.pos
+	if p.keyword() != "xref" {
+		p.pos = save
+		return d.readXrefStream(p)
+	}
+	for {
+		start, ok1 := p.integer()
+		count, ok2 := p.integer()
+		if !ok1 || !ok2 {
+			break
+		}
+		for i := int64(0); i < count; i++ {
+			off, ok1 := p.integer()
+			gen, ok2 := p.integer()
+			kind := p.keyword()
+			if !ok1 || !ok2 || (kind != "n" && kind != "f") {
+				return nil, false, p.errorf("malformed cross-reference table")
+			}
+			num := int(start + i)
+			if kind == "n" {
+				d.addEntry(num, xrefEntry{offset: off, gen: int(gen), stream: -1})
+			} else {
+				d.addEntry(num, xrefEntry{offset: -1, stream: -1})
+			}
+		}
+	}
+	if err := p.expect("trailer"); err != nil {
+		return nil, false, err
+	}
+	obj, err := p.object(0)
+	if err != nil {
+		return nil, false, err
+	}
+	trailer, ok := obj.(Dict)
+	if !ok {
+		return nil, false, p.errorf("trailer is not a dictionary")
+	}
+	return trailer, false, nil
+}
+
+func (d *Document) readXrefStream(p *parser) (Dict, bool, error) {
+	_, obj, err := p.indirect()
+	if err != nil {
+		return nil, false, err
+	}
+	stream, ok := obj.(*Stream)
+	if !ok || stream.Dict.Name("Type") != "XRef" {
+		return nil, false, errors.New("pdf: cross-reference section not found")
+	}
+	data, err := d.Decode(stream)
+	if err != nil {
+		return nil, false, err
+	}
+	var widths [3]int
+	w, _ := stream.Dict["W"].(Array)
+	if len(w) != 3 {
+		return nil, false, errors.New("pdf: malformed cross-reference stream")
+	}
+	rowSize := 0
+	for i, v := range w {
+		n, ok := v.(int64)
+		if !ok || n < 0 || n > 8 {
+			return nil, false, errors.New("pdf: malformed cross-reference stream")
+		}
+		widths[i] = int(n)
+		rowSize += int(n)
+	}
+	index, _ := stream.Dict["Index"].(Array)
+	if index == nil {
+		size, _ := stream.Dict["Size"].(int64)
+		index = Array{int64(0), size}
+	}
+	for i := 0; i+1 < len(index); i += 2 {
+		start, ok1 := index[i].(int64)
+		count, ok2 := index[i+1].(int64)
+		if !ok1 || !ok2 || count < 0 || count > int64(len(data)/max(rowSize, 1)) {
+			return nil, false, errors.New("pdf: malformed cross-reference stream")
+		}
+		for j := int64(0); j < count; j++ {
+			if len(data) < rowSize {
+				return nil, false, errors.New("pdf: truncated cross-reference stream")
+			}
+			var fields [3]int64
+			for k, width := range widths {
+				for _, c := range data[:width] {
+					fields[k] = fields[k]<<8 | int64(c)
+				}
+				data = data[width:]
+			}
+			if widths[0] == 0 {
+				fields[0] = 1
+			}
+			num := int(start + j)
+			switch fields[0] {
+			case 0:
+				d.addEntry(num, xrefEntry{offset: -1, stream: -1})
+			case 1:
+				d.addEntry(num, xrefEntry{offset: fields[1], gen: int(fields[2]), stream: -1})
+			case 2:
+				d.addEntry(num, xrefEntry{stream: int(fields[1]), index: int(fields[2])})
+			}
+		}
+	}
+	return stream.Dict, true, nil
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func (d *Document) streamLength(ref Ref) (int64, error) {
+	obj, err := d.Resolve(ref)
+	if err != nil {
+		return 0, err
+	}
+	n, ok := obj.(int64)
+	if !ok {
+		return 0, errors.New("pdf: stream length is not an integer")
+	}
+	return n, nil
+}
+
+// Resolve follows an indirect reference, returning other objects unchanged
+func (d *Document) Resolve(obj Object) (Object, error) {
+	for depth := 0; depth < maxDepth; depth++ {
+		ref, ok := obj.(Ref)
+		if !ok {
+			return obj, nil
+		}
+		var err error
+		obj, err = d.load(ref)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nil, errors.New("pdf: too many levels of indirection")
+}
+
+// ResolveDict resolves an object that is expected to be a dictionary.
+// Returns nil if the object is null.
+func (d *Document) ResolveDict(obj Object) (Dict, error) {
+	obj, err := d.Resolve(obj)
+	if err != nil {
+		return nil, err
+	}
+	switch v := obj.(type) {
+	case nil:
+		return nil, nil
+	case Dict:
+		return v, nil
+	case *Stream:
+		return v.Dict, nil
+	}
+	return nil, fmt.Errorf("pdf: expected a dictionary but found %T", obj)
+}
+
+func (d *Document) load(ref Ref) (Object, error) {
+	if obj, ok := d.cache[ref.Num]; ok {
+		return obj, nil
+	}
+	e, ok := d.xref[ref.Num]
+	if !ok || (e.stream < 0 && e.offset < 0) {
+		// missing objects are null
+		return nil, nil
+	}
+	var obj Object
+	if e.stream >= 0 {
+		var err error
+		obj, err = d.loadCompressed(e.stream, e.index, ref.Num)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		if e.offset >= int64(len(d.data)) {
+			return nil, fmt.Errorf("pdf: object %d is out of bounds", ref.Num)
+		}
+		// mark it while loading to stop cycles through stream lengths
+		d.cache[ref.Num] = nil
+		p := &parser{buf: d.data, pos: int(e.offset), length: d.streamLength}
+		got, o, err := p.indirect()
+		if err != nil {
+			delete(d.cache, ref.Num)
+			return nil, err
+		} else if got.Num != ref.Num {
+			delete(d.cache, ref.Num)
+			return nil, fmt.Errorf("pdf: expected object %d at offset %d but found %d", ref.Num, e.offset, got.Num)
+		}
+		obj = o
+	}
+	d.cache[ref.Num] = obj
+	return obj, nil
+}
+
+func (d *Document) loadCompressed(streamNum, index, num int) (Object, error) {
+	obj, err := d.Resolve(Ref{Num: streamNum})
+	if err != nil {
+		return nil, err
+	}
+	stream, ok := obj.(*Stream)
+	if !ok || stream.Dict.Name("Type") != "ObjStm" {
+		return nil, fmt.Errorf("pdf: object %d is not an object stream", streamNum)
+	}
+	data, err := d.Decode(stream)
+	if err != nil {
+		return nil, err
+	}
+	n, _ := stream.Dict["N"].(int64)
+	first, _ := stream.Dict["First"].(int64)
+	if index < 0 || int64(index) >= n || first < 0 || first > int64(len(data)) {
+		return nil, fmt.Errorf("pdf: object %d not found in object stream %d", num, streamNum)
+	}
+	p := &parser{buf: data}
+	var offset int64 = -1
+	for i := 0; i <= index; i++ {
+		objNum, ok1 := p.integer()
+		off, ok2 := p.integer()
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("pdf: malformed object stream %d", streamNum)
+		}
+		if i == index {
+			if int(objNum) != num {
+				return nil, fmt.Errorf("pdf: object stream %d does not contain object %d", streamNum, num)
+			}
+			offset = off
+		}
+	}
+	if offset < 0 || first+offset >= int64(len(data)) {
+		return nil, fmt.Errorf("pdf: malformed object stream %d", streamNum)
+	}
+	p.pos = int(first + offset)
+	return p.object(0)
+}
+
+// Decode returns the decoded data of a stream. Only FlateDecode is supported,
+// with or without PNG predictors.
+func (d *Document) Decode(s *Stream) ([]byte, error) {
+	filter, err := d.Resolve(s.Dict["Filter"])
+	if err != nil {
+		return nil, err
+	}
+	parms, err := d.Resolve(s.Dict["DecodeParms"])
+	if err != nil {
+		return nil, err
+	}
+	if arr, ok := filter.(Array); ok {
+		if len(arr) > 1 {
+			return nil, errors.New("pdf: multiple stream filters are not supported")
+		} else if len(arr) == 1 {
+			filter = arr[0]
+		} else {
+			filter = nil
+		}
+		if parr, ok := parms.(Array); ok && len(parr) == 1 {
+			parms = parr[0]
+		}
+	}
+	switch filter {
+	case nil:
+		return s.Data, nil
+	case Name("FlateDecode"):
+	default:
+		return nil, fmt.Errorf("pdf: unsupported stream filter %v", filter)
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(s.Data))
+	if err != nil {
+		return nil, fmt.Errorf("pdf: %w", err)
+	}
+	data, err := ioutil.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("pdf: %w", err)
+	}
+	p, _ := d.ResolveDict(parms)
+	predictor, _ := p.Get("Predictor").(int64)
+	if predictor < 10 {
+		if predictor > 1 {
+			return nil, errors.New("pdf: TIFF predictors are not supported")
+		}
+		return data, nil
+	}
+	columns, ok := p.Get("Columns").(int64)
+	if !ok {
+		columns = 1
+	}
+	return unpredictPNG(data, int(columns))
+}
+
+// reverse PNG row filters, assuming one byte per pixel
+func unpredictPNG(data []byte, columns int) ([]byte, error) {
+	if columns <= 0 {
+		return nil, errors.New("pdf: invalid predictor columns")
+	}
+	rowSize := columns + 1
+	if len(data)%rowSize != 0 {
+		return nil, errors.New("pdf: predicted data is not a whole number of rows")
+	}
+	out := make([]byte, 0, len(data)/rowSize*columns)
+	prev := make([]byte, columns)
+	for len(data) > 0 {
+		filter, row := data[0], append([]byte{}, data[1:rowSize]...)
+		data = data[rowSize:]
+		for i := range row {
+			var left, upLeft byte
+			if i > 0 {
+				left = row[i-1]
+				upLeft = prev[i-1]
+			}
+			up := prev[i]
+			switch filter {
+			case 0:
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += up
+			case 3:
+				row[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				row[i] += paeth(left, up, upLeft)
+			default:
+				return nil, fmt.Errorf("pdf: unknown PNG filter %d", filter)
+			}
+		}
+		out = append(out, row...)
+		prev = row
+	}
+	return out, nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	if pa <= pb && pa <= pc {
+		return a
+	} else if pb <= pc {
+		return b
+	}
+	return c
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// Catalog returns the document catalog and its reference
+func (d *Document) Catalog() (Ref, Dict, error) {
+	ref := d.Trailer["Root"].(Ref)
+	cat, err := d.ResolveDict(ref)
+	if err != nil {
+		return ref, nil, err
+	} else if cat == nil {
+		return ref, nil, errors.New("pdf: document catalog is missing")
+	}
+	return ref, cat, nil
+}
+
+// Page returns the nth page (starting at 1) of the document
+func (d *Document) Page(n int) (Ref, Dict, error) {
+	_, cat, err := d.Catalog()
+	if err != nil {
+		return Ref{}, nil, err
+	}
+	node := cat["Pages"]
+	for depth := 0; depth < maxDepth; depth++ {
+		dict, err := d.ResolveDict(node)
+		if err != nil {
+			return Ref{}, nil, err
+		}
+		if dict.Name("Type") == "Page" || dict["Kids"] == nil {
+			ref, ok := node.(Ref)
+			if !ok || n != 1 {
+				break
+			}
+			return ref, dict, nil
+		}
+		kids, err := d.Resolve(dict["Kids"])
+		if err != nil {
+			return Ref{}, nil, err
+		}
+		karr, _ := kids.(Array)
+		found := false
+		for _, kid := range karr {
+			kd, err := d.ResolveDict(kid)
+			if err != nil {
+				return Ref{}, nil, err
+			}
+			count := int64(1)
+			if kd.Name("Type") != "Page" && kd["Kids"] != nil {
+				count, _ = kd["Count"].(int64)
+			}
+			if int64(n) <= count {
+				node = kid
+				found = true
+				break
+			}
+			n -= int(count)
+		}
+		if !found {
+			break
+		}
+	}
+	return Ref{}, nil, errors.New("pdf: page not found")
+}
@@ -0,0 +1,186 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package pdf implements just enough of PDF to add and verify PAdES
+// signatures using incremental updates: reading the cross-reference tables
+// and objects of an existing file, and appending new revisions of objects
+// without rewriting the original.
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// PDF objects are represented as nil, bool, int64, float64 and the following
+// types
+type (
+	Name   string
+	String []byte
+	Array  []Object
+	Dict   map[Name]Object
+	Object interface{}
+)
+
+// Ref is an indirect reference
+type Ref struct {
+	Num, Gen int
+}
+
+// Stream is a stream object. Data is still encoded.
+type Stream struct {
+	Dict Dict
+	Data []byte
+}
+
+// Raw is written to the output as-is
+type Raw []byte
+
+func (r Ref) String() string {
+	return fmt.Sprintf("%d %d R", r.Num, r.Gen)
+}
+
+// Get a value from a dict, returning nil if it's missing
+func (d Dict) Get(key Name) Object {
+	if d == nil {
+		return nil
+	}
+	return d[key]
+}
+
+// Name returns a name value, or "" if it's missing or not a name
+func (d Dict) Name(key Name) Name {
+	n, _ := d.Get(key).(Name)
+	return n
+}
+
+// Copy returns a shallow copy of a dict
+func (d Dict) Copy() Dict {
+	c := make(Dict, len(d))
+	for k, v := range d {
+		c[k] = v
+	}
+	return c
+}
+
+// Marshal serializes an object
+func Marshal(obj Object) []byte {
+	var buf bytes.Buffer
+	writeObject(&buf, obj)
+	return buf.Bytes()
+}
+
+func writeObject(buf *bytes.Buffer, obj Object) {
+	switch v := obj.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case int:
+		buf.WriteString(strconv.Itoa(v))
+	case int64:
+		buf.WriteString(strconv.FormatInt(v, 10))
+	case float64:
+		buf.WriteString(strconv.FormatFloat(v, 'f', -1, 64))
+	case Name:
+		writeName(buf, v)
+	case String:
+		writeString(buf, v)
+	case Array:
+		buf.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			writeObject(buf, item)
+		}
+		buf.WriteByte(']')
+	case Dict:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, string(k))
+		}
+		sort.Strings(keys)
+		buf.WriteString("<<")
+		for _, k := range keys {
+			writeName(buf, Name(k))
+			buf.WriteByte(' ')
+			writeObject(buf, v[Name(k)])
+		}
+		buf.WriteString(">>")
+	case Ref:
+		buf.WriteString(v.String())
+	case *Stream:
+		d := v.Dict.Copy()
+		d["Length"] = int64(len(v.Data))
+		writeObject(buf, d)
+		buf.WriteString("\nstream\n")
+		buf.Write(v.Data)
+		buf.WriteString("\nendstream")
+	case Raw:
+		buf.Write(v)
+	default:
+		panic(fmt.Sprintf("pdf: can't marshal %T", obj))
+	}
+}
+
+func writeName(buf *bytes.Buffer, n Name) {
+	buf.WriteByte('/')
+	for i := 0; i < len(n); i++ {
+		c := n[i]
+		if c < '!' || c > '~' || c == '#' || isDelimiter(c) {
+			fmt.Fprintf(buf, "#%02X", c)
+		} else {
+			buf.WriteByte(c)
+		}
+	}
+}
+
+func writeString(buf *bytes.Buffer, s String) {
+	buf.WriteByte('(')
+	for _, c := range s {
+		switch c {
+		case '(', ')', '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\n':
+			buf.WriteString(`\n`)
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	buf.WriteByte(')')
+}
+
+func isWhitespace(c byte) bool {
+	switch c {
+	case 0, '\t', '\n', '\f', '\r', ' ':
+		return true
+	}
+	return false
+}
+
+func isDelimiter(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
@@ -0,0 +1,339 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+const maxDepth = 64
+
+type parser struct {
+	buf []byte
+	pos int
+	// resolve indirect stream lengths, may be nil
+	length func(Ref) (int64, error)
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("pdf: offset %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.buf) {
+		c := p.buf[p.pos]
+		if c == '%' {
+			for p.pos < len(p.buf) && p.buf[p.pos] != '\r' && p.buf[p.pos] != '\n' {
+				p.pos++
+			}
+		} else if isWhitespace(c) {
+			p.pos++
+		} else {
+			return
+		}
+	}
+}
+
+// read a run of regular characters
+func (p *parser) keyword() string {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.buf) && !isWhitespace(p.buf[p.pos]) && !isDelimiter(p.buf[p.pos]) {
+		p.pos++
+	}
+	return string(p.buf[start:p.pos])
+}
+
+func (p *parser) expect(kw string) error {
+	if got := p.keyword(); got != kw {
+		return p.errorf("expected %q but found %q", kw, got)
+	}
+	return nil
+}
+
+// parse an integer, without consuming anything if there isn't one
+func (p *parser) integer() (int64, bool) {
+	save := p.pos
+	kw := p.keyword()
+	n, err := strconv.ParseInt(kw, 10, 64)
+	if err != nil {
+		p.pos = save
+		return 0, false
+	}
+	return n, true
+}
+
+func (p *parser) object(depth int) (Object, error) {
+	if depth > maxDepth {
+		return nil, p.errorf("nesting too deep")
+	}
+	p.skipSpace()
+	if p.pos >= len(p.buf) {
+		return nil, p.errorf("unexpected end of data")
+	}
+	switch c := p.buf[p.pos]; c {
+	case '/':
+		p.pos++
+		return p.name()
+	case '(':
+		p.pos++
+		return p.literalString()
+	case '<':
+		if p.pos+1 < len(p.buf) && p.buf[p.pos+1] == '<' {
+			p.pos += 2
+			return p.dict(depth)
+		}
+		p.pos++
+		return p.hexString()
+	case '[':
+		p.pos++
+		arr := Array{}
+		for {
+			p.skipSpace()
+			if p.pos >= len(p.buf) {
+				return nil, p.errorf("unterminated array")
+			} else if p.buf[p.pos] == ']' {
+				p.pos++
+				return arr, nil
+			}
+			item, err := p.object(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, item)
+		}
+	}
+	kw := p.keyword()
+	switch kw {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	case "":
+		return nil, p.errorf("unexpected character %q", p.buf[p.pos])
+	}
+	n, err := strconv.ParseInt(kw, 10, 64)
+	if err != nil {
+		f, err := strconv.ParseFloat(kw, 64)
+		if err != nil {
+			return nil, p.errorf("unexpected keyword %q", kw)
+		}
+		return f, nil
+	}
+	// check for an indirect reference
+	save := p.pos
+	if gen, ok := p.integer(); ok && n >= 0 && gen >= 0 {
+		if p.keyword() == "R" {
+			return Ref{Num: int(n), Gen: int(gen)}, nil
+		}
+	}
+	p.pos = save
+	return n, nil
+}
+
+func (p *parser) name() (Name, error) {
+	var name []byte
+	for p.pos < len(p.buf) && !isWhitespace(p.buf[p.pos]) && !isDelimiter(p.buf[p.pos]) {
+		c := p.buf[p.pos]
+		if c == '#' && p.pos+2 < len(p.buf) {
+			if v, err := strconv.ParseUint(string(p.buf[p.pos+1:p.pos+3]), 16, 8); err == nil {
+				c = byte(v)
+				p.pos += 2
+			}
+		}
+		name = append(name, c)
+		p.pos++
+	}
+	return Name(name), nil
+}
+
+func (p *parser) literalString() (String, error) {
+	var s []byte
+	depth := 1
+	for p.pos < len(p.buf) {
+		c := p.buf[p.pos]
+		p.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return String(s), nil
+			}
+		case '\\':
+			if p.pos >= len(p.buf) {
+				break
+			}
+			c = p.buf[p.pos]
+			p.pos++
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if p.pos < len(p.buf) && p.buf[p.pos] == '\n' {
+					p.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if c >= '0' && c <= '7' {
+					v := int(c - '0')
+					for i := 0; i < 2 && p.pos < len(p.buf) && p.buf[p.pos] >= '0' && p.buf[p.pos] <= '7'; i++ {
+						v = v*8 + int(p.buf[p.pos]-'0')
+						p.pos++
+					}
+					c = byte(v)
+				}
+			}
+		}
+		s = append(s, c)
+	}
+	return nil, p.errorf("unterminated string")
+}
+
+func (p *parser) hexString() (String, error) {
+	end := bytes.IndexByte(p.buf[p.pos:], '>')
+	if end < 0 {
+		return nil, p.errorf("unterminated hex string")
+	}
+	var digits []byte
+	for _, c := range p.buf[p.pos : p.pos+end] {
+		if !isWhitespace(c) {
+			digits = append(digits, c)
+		}
+	}
+	p.pos += end + 1
+	if len(digits)%2 != 0 {
+		digits = append(digits, '0')
+	}
+	s := make([]byte, len(digits)/2)
+	for i := range s {
+		v, err := strconv.ParseUint(string(digits[2*i:2*i+2]), 16, 8)
+		if err != nil {
+			return nil, p.errorf("invalid hex string")
+		}
+		s[i] = byte(v)
+	}
+	return String(s), nil
+}
+
+func (p *parser) dict(depth int) (Dict, error) {
+	d := make(Dict)
+	for {
+		p.skipSpace()
+		if p.pos+1 < len(p.buf) && p.buf[p.pos] == '>' && p.buf[p.pos+1] == '>' {
+			p.pos += 2
+			return d, nil
+		} else if p.pos >= len(p.buf) || p.buf[p.pos] != '/' {
+			return nil, p.errorf("expected name in dictionary")
+		}
+		p.pos++
+		key, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		value, err := p.object(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		d[key] = value
+	}
+}
+
+// parse "num gen obj ... endobj" at the current position
+func (p *parser) indirect() (Ref, Object, error) {
+	num, ok1 := p.integer()
+	gen, ok2 := p.integer()
+	if !ok1 || !ok2 {
+		return Ref{}, nil, p.errorf("expected object header")
+	}
+	ref := Ref{Num: int(num), Gen: int(gen)}
+	if err := p.expect("obj"); err != nil {
+		return ref, nil, err
+	}
+	obj, err := p.object(0)
+	if err != nil {
+		return ref, nil, err
+	}
+	save := p.pos
+	if d, ok := obj.(Dict); ok && p.keyword() == "stream" {
+		data, err := p.streamData(d)
+		if err != nil {
+			return ref, nil, err
+		}
+		obj = &Stream{Dict: d, Data: data}
+	} else {
+		p.pos = save
+	}
+	// tolerate a missing endobj
+	return ref, obj, nil
+}
+
+func (p *parser) streamData(d Dict) ([]byte, error) {
+	// the keyword is followed by CRLF or LF
+	if p.pos < len(p.buf) && p.buf[p.pos] == '\r' {
+		p.pos++
+	}
+	if p.pos < len(p.buf) && p.buf[p.pos] == '\n' {
+		p.pos++
+	}
+	start := p.pos
+	length := int64(-1)
+	switch v := d["Length"].(type) {
+	case int64:
+		length = v
+	case Ref:
+		if p.length != nil {
+			if n, err := p.length(v); err == nil {
+				length = n
+			}
+		}
+	}
+	if length >= 0 && length <= int64(len(p.buf)-start) {
+		p.pos = start + int(length)
+		save := p.pos
+		if p.keyword() == "endstream" {
+			return p.buf[start : start+int(length)], nil
+		}
+		p.pos = save
+	}
+	// bad or missing length, so look for the end instead
+	end := bytes.Index(p.buf[start:], []byte("endstream"))
+	if end < 0 {
+		return nil, errors.New("pdf: unterminated stream")
+	}
+	p.pos = start + end + len("endstream")
+	data := p.buf[start : start+end]
+	data = bytes.TrimSuffix(data, []byte("\n"))
+	data = bytes.TrimSuffix(data, []byte("\r"))
+	return data, nil
+}
@@ -0,0 +1,216 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pdf_test
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sassoftware/relic/v7/internal/testcert"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/pdf"
+	"github.com/sassoftware/relic/v7/signers/sigerrors"
+)
+
+func testCert(t *testing.T) *certloader.Certificate {
+	return testcert.Signer(t, &x509.Certificate{Subject: pkix.Name{CommonName: "document signer"}}, testcert.ECDSAKey(t))
+}
+
+var testObjects = []string{
+	"<< /Type /Catalog /Pages 2 0 R >>",
+	"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+	"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 4 0 R >>",
+}
+
+const testContent = "BT /F1 12 Tf 72 712 Td (Hello) Tj ET"
+
+// build a document with a classic cross-reference table
+func classicPDF() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	objects := append(testObjects, fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(testContent), testContent))
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f\r\n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n\r\n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+func deflate(data []byte) []byte {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	w.Write(data)
+	w.Close()
+	return buf.Bytes()
+}
+
+// build a document with a compressed object stream and a cross-reference
+// stream using the PNG Up predictor
+func streamPDF() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.5\n")
+	// objects 1-3 go into object stream 5
+	var header, body bytes.Buffer
+	for i, obj := range testObjects {
+		fmt.Fprintf(&header, "%d %d ", i+1, body.Len())
+		body.WriteString(obj + "\n")
+	}
+	objstm := deflate(append(header.Bytes(), body.Bytes()...))
+	off4 := buf.Len()
+	fmt.Fprintf(&buf, "4 0 obj\n<< /Length 5 0 R >>\nstream\n%s\nendstream\nendobj\n", testContent)
+	off5 := buf.Len()
+	fmt.Fprintf(&buf, "5 0 obj\n<< /Type /ObjStm /N 3 /First %d /Filter /FlateDecode /Length %d >>\nstream\n", header.Len(), len(objstm))
+	buf.Write(objstm)
+	buf.WriteString("\nendstream\nendobj\n")
+	off6 := buf.Len()
+	rows := [][5]byte{{0, 0, 0, 0xff}, {2, 0, 0, 5, 0}, {2, 0, 0, 5, 1}, {2, 0, 0, 5, 2}}
+	for _, off := range []int{off4, off5, off6} {
+		var row [5]byte
+		row[0] = 1
+		var b [4]byte
+		binary.BigEndian.PutUint32(b[:], uint32(off))
+		copy(row[1:4], b[1:])
+		rows = append(rows, row)
+	}
+	// apply the Up filter to each row
+	var raw []byte
+	var prev [5]byte
+	for _, row := range rows {
+		raw = append(raw, 2)
+		for i := range row {
+			raw = append(raw, row[i]-prev[i])
+		}
+		prev = row
+	}
+	xref := deflate(raw)
+	fmt.Fprintf(&buf, "6 0 obj\n<< /Type /XRef /Size 7 /W [1 3 1] /Root 1 0 R /Filter /FlateDecode /DecodeParms << /Predictor 12 /Columns 5 >> /Length %d >>\nstream\n", len(xref))
+	buf.Write(xref)
+	fmt.Fprintf(&buf, "\nendstream\nendobj\nstartxref\n%d\n%%%%EOF\n", off6)
+	// object 5 is the length of object 4, which lives outside the object
+	// stream so a real file would have it as a direct object instead.
+	return bytes.Replace(buf.Bytes(), []byte("/Length 5 0 R"), []byte(fmt.Sprintf("/Length %d    ", len(testContent))), 1)
+}
+
+func sign(t *testing.T, blob []byte, cert *certloader.Certificate, opts pdf.SignOptions) []byte {
+	doc, err := pdf.Open(blob)
+	require.NoError(t, err)
+	update, ts, err := pdf.Sign(context.Background(), doc, cert, crypto.SHA256, opts)
+	require.NoError(t, err)
+	require.NotNil(t, ts)
+	return append(append([]byte{}, blob...), update...)
+}
+
+func verify(t *testing.T, blob []byte) []*pdf.PDFSignature {
+	doc, err := pdf.Open(blob)
+	require.NoError(t, err)
+	sigs, err := pdf.Verify(doc, false)
+	require.NoError(t, err)
+	return sigs
+}
+
+func TestSignVerify(t *testing.T) {
+	cert := testCert(t)
+	for name, blob := range map[string][]byte{"classic": classicPDF(), "stream": streamPDF()} {
+		t.Run(name, func(t *testing.T) {
+			doc, err := pdf.Open(blob)
+			require.NoError(t, err)
+			_, err = pdf.Verify(doc, false)
+			assert.ErrorAs(t, err, &sigerrors.NotSignedError{})
+			_, page, err := doc.Page(1)
+			require.NoError(t, err)
+			assert.Equal(t, pdf.Name("Page"), page.Name("Type"))
+
+			signed := sign(t, blob, cert, pdf.SignOptions{Reason: "testing"})
+			assert.Equal(t, blob, signed[:len(blob)], "original must not be rewritten")
+			sigs := verify(t, signed)
+			require.Len(t, sigs, 1)
+			assert.Equal(t, "Signature1", sigs[0].Field)
+			assert.Equal(t, "testing", sigs[0].Reason)
+			assert.Equal(t, pdf.Name("ETSI.CAdES.detached"), sigs[0].SubFilter)
+			assert.True(t, sigs[0].CoversDocument)
+			assert.Equal(t, cert.Leaf, sigs[0].Signature.Certificate)
+
+			// a second signature leaves the first one intact
+			signed2 := sign(t, signed, cert, pdf.SignOptions{Rect: [4]float64{72, 72, 272, 122}})
+			sigs = verify(t, signed2)
+			require.Len(t, sigs, 2)
+			assert.Equal(t, "Signature1", sigs[0].Field)
+			assert.False(t, sigs[0].CoversDocument)
+			assert.Equal(t, "Signature2", sigs[1].Field)
+			assert.True(t, sigs[1].CoversDocument)
+		})
+	}
+}
+
+func TestTamper(t *testing.T) {
+	signed := sign(t, classicPDF(), testCert(t), pdf.SignOptions{})
+	i := bytes.Index(signed, []byte("(Hello)"))
+	require.True(t, i > 0)
+	signed[i+1] = 'J'
+	doc, err := pdf.Open(signed)
+	require.NoError(t, err)
+	_, err = pdf.Verify(doc, false)
+	assert.Error(t, err)
+	_, err = pdf.Verify(doc, true)
+	assert.NoError(t, err)
+}
+
+func TestDocMDP(t *testing.T) {
+	cert := testCert(t)
+	signed := sign(t, classicPDF(), cert, pdf.SignOptions{DocMDP: 1, Field: "Certification"})
+	sigs := verify(t, signed)
+	require.Len(t, sigs, 1)
+	assert.Equal(t, "Certification", sigs[0].Field)
+	assert.Equal(t, 1, sigs[0].DocMDP)
+	// no more signatures are allowed
+	doc, err := pdf.Open(signed)
+	require.NoError(t, err)
+	_, _, err = pdf.Sign(context.Background(), doc, cert, crypto.SHA256, pdf.SignOptions{})
+	assert.Error(t, err)
+	// nor is any other change
+	modified := append(append([]byte{}, signed...), "\n% comment\n"...)
+	doc, err = pdf.Open(modified)
+	require.NoError(t, err)
+	_, err = pdf.Verify(doc, false)
+	assert.Error(t, err)
+
+	// P=2 permits further signatures, but a certification must come first
+	signed = sign(t, classicPDF(), cert, pdf.SignOptions{DocMDP: 2})
+	signed = sign(t, signed, cert, pdf.SignOptions{})
+	assert.Len(t, verify(t, signed), 2)
+	doc, err = pdf.Open(signed)
+	require.NoError(t, err)
+	_, _, err = pdf.Sign(context.Background(), doc, cert, crypto.SHA256, pdf.SignOptions{DocMDP: 2})
+	assert.Error(t, err)
+}
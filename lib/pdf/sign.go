@@ -0,0 +1,401 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pdf
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/pkcs7"
+	"github.com/sassoftware/relic/v7/lib/pkcs9"
+)
+
+const (
+	// sigFlags: SignaturesExist | AppendOnly
+	sigFlags = 3
+	// annotation flags: Print | Locked
+	widgetFlags = 132
+	// placeholder that is overwritten with the real byte range
+	byteRangePlaceholder = "[0 0000000000 0000000000 0000000000]"
+	// room for the signature without the certificates or timestamp
+	contentsSize  = 8192
+	timestampSize = 8192
+)
+
+// SignOptions control the appearance and permissions of a new signature
+type SignOptions struct {
+	// Name of the new signature field. By default a unique one is chosen.
+	Field       string
+	Reason      string
+	Location    string
+	ContactInfo string
+	// Page to place the signature widget on, starting at 1
+	Page int
+	// Rect is the location of a visible signature on the page, in points. If
+	// it is empty then the signature is invisible.
+	Rect [4]float64
+	// DocMDP makes this a certification signature that allows only the given
+	// kind of changes: 1 for none, 2 for form filling and signing, 3 for
+	// form filling, signing and annotations
+	DocMDP int
+	// SigTime is the signing time. Defaults to now.
+	SigTime time.Time
+}
+
+// Sign a PDF document, returning the incremental update that must be appended
+// to it
+func Sign(ctx context.Context, doc *Document, cert *certloader.Certificate, hash crypto.Hash, opts SignOptions) ([]byte, *pkcs9.TimestampedSignature, error) {
+	if opts.DocMDP < 0 || opts.DocMDP > 3 {
+		return nil, nil, errors.New("pdf: DocMDP permission must be between 1 and 3")
+	}
+	if opts.Page == 0 {
+		opts.Page = 1
+	}
+	if opts.SigTime.IsZero() {
+		opts.SigTime = time.Now()
+	}
+	u := doc.NewUpdate()
+	catRef, cat, err := doc.Catalog()
+	if err != nil {
+		return nil, nil, err
+	}
+	pageRef, page, err := doc.Page(opts.Page)
+	if err != nil {
+		return nil, nil, err
+	}
+	form, fields, names, err := readForm(doc, cat)
+	if err != nil {
+		return nil, nil, err
+	}
+	existing, err := findSignatures(doc, fields)
+	if err != nil {
+		return nil, nil, err
+	}
+	if p, err := docMDP(doc, cat); err != nil {
+		return nil, nil, err
+	} else if p == 1 {
+		return nil, nil, errors.New("pdf: document is certified and does not permit changes")
+	}
+	if opts.DocMDP != 0 && len(existing) != 0 {
+		return nil, nil, errors.New("pdf: a certification signature must be the first signature in the document")
+	}
+	// signature dictionary
+	sig := Dict{
+		"Type":      Name("Sig"),
+		"Filter":    Name("Adobe.PPKLite"),
+		"SubFilter": Name("ETSI.CAdES.detached"),
+		"M":         String(opts.SigTime.UTC().Format("D:20060102150405Z")),
+		"Name":      String(cert.Leaf.Subject.CommonName),
+		"ByteRange": Raw(byteRangePlaceholder),
+	}
+	for key, value := range map[Name]string{"Reason": opts.Reason, "Location": opts.Location, "ContactInfo": opts.ContactInfo} {
+		if value != "" {
+			sig[key] = String(value)
+		}
+	}
+	size := contentsSize
+	for _, c := range cert.Chain() {
+		size += len(c.Raw)
+	}
+	if cert.Timestamper != nil {
+		size += timestampSize
+	}
+	sig["Contents"] = Raw("<" + string(bytes.Repeat([]byte{'0'}, 2*size)) + ">")
+	if opts.DocMDP != 0 {
+		sig["Reference"] = Array{Dict{
+			"Type":            Name("SigRef"),
+			"TransformMethod": Name("DocMDP"),
+			"TransformParams": Dict{
+				"Type": Name("TransformParams"),
+				"P":    int64(opts.DocMDP),
+				"V":    Name("1.2"),
+			},
+		}}
+	}
+	sigRef := u.Add(sig)
+	// signature field and its widget annotation
+	name := opts.Field
+	if name == "" {
+		for i := 1; name == "" || names[name]; i++ {
+			name = "Signature" + strconv.Itoa(i)
+		}
+	} else if names[name] {
+		return nil, nil, fmt.Errorf("pdf: field %q already exists", name)
+	}
+	rect := Array{opts.Rect[0], opts.Rect[1], opts.Rect[2], opts.Rect[3]}
+	widget := Dict{
+		"Type":    Name("Annot"),
+		"Subtype": Name("Widget"),
+		"FT":      Name("Sig"),
+		"T":       String(name),
+		"V":       sigRef,
+		"P":       pageRef,
+		"Rect":    rect,
+		"F":       int64(widgetFlags),
+	}
+	widget["AP"] = Dict{"N": u.Add(appearance(opts, cert.Leaf.Subject.CommonName))}
+	widgetRef := u.Add(widget)
+	// add the widget to the page
+	page = page.Copy()
+	annots, err := doc.Resolve(page["Annots"])
+	if err != nil {
+		return nil, nil, err
+	}
+	annotArr, _ := annots.(Array)
+	page["Annots"] = append(append(Array{}, annotArr...), widgetRef)
+	u.Set(pageRef, page)
+	// add the field to the form
+	form["Fields"] = append(fields, widgetRef)
+	form["SigFlags"] = int64(sigFlags)
+	cat = cat.Copy()
+	if formRef, ok := cat["AcroForm"].(Ref); ok {
+		u.Set(formRef, form)
+	} else {
+		cat["AcroForm"] = form
+	}
+	if opts.DocMDP != 0 {
+		cat["Perms"] = Dict{"DocMDP": sigRef}
+	}
+	u.Set(catRef, cat)
+	// serialize, then fill in the byte range and signature
+	update := u.Bytes()
+	base := doc.Size()
+	sigStart := int(u.Offsets[sigRef.Num] - base)
+	brPos := bytes.Index(update[sigStart:], []byte(byteRangePlaceholder))
+	contentsPos := bytes.Index(update[sigStart:], []byte("/Contents <"))
+	if brPos < 0 || contentsPos < 0 {
+		return nil, nil, errors.New("pdf: signature placeholder not found")
+	}
+	brPos += sigStart
+	contentsPos += sigStart + len("/Contents ")
+	contentsEnd := contentsPos + 2*size + 2
+	total := base + int64(len(update))
+	byteRange := fmt.Sprintf("[0 %d %d %d]", base+int64(contentsPos), base+int64(contentsEnd), total-base-int64(contentsEnd))
+	if len(byteRange) > len(byteRangePlaceholder) {
+		return nil, nil, errors.New("pdf: document is too large")
+	}
+	copy(update[brPos:], byteRange+string(bytes.Repeat([]byte{' '}, len(byteRangePlaceholder)-len(byteRange))))
+	signed := make([]byte, 0, int(total)-2*size-2)
+	signed = append(signed, doc.data...)
+	signed = append(signed, update[:contentsPos]...)
+	signed = append(signed, update[contentsEnd:]...)
+	builder := pkcs7.NewBuilder(cert.Signer(), cert.Chain(), hash)
+	if err := builder.SetContentData(signed); err != nil {
+		return nil, nil, err
+	}
+	// PAdES forbids the signing-time attribute, the time is in the M entry instead
+	if err := builder.AddAuthenticatedAttribute(pkcs9.OidAttributeSigningCertificateV2, pkcs9.NewSigningCertificateV2(cert.Leaf)); err != nil {
+		return nil, nil, err
+	}
+	psd, err := builder.Sign()
+	if err != nil {
+		return nil, nil, err
+	}
+	ts, err := pkcs9.TimestampAndMarshal(ctx, psd, cert.Timestamper, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	// the content is attached for the self-check, but the signature is detached
+	if _, err := psd.Detach(); err != nil {
+		return nil, nil, err
+	}
+	ts.Raw, err = psd.Marshal()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(ts.Raw) > size {
+		return nil, nil, fmt.Errorf("pdf: signature is %d bytes but only %d were reserved", len(ts.Raw), size)
+	}
+	hex.Encode(update[contentsPos+1:], ts.Raw)
+	return update, ts, nil
+}
+
+// build the appearance stream for the signature widget
+func appearance(opts SignOptions, signer string) *Stream {
+	width := opts.Rect[2] - opts.Rect[0]
+	height := opts.Rect[3] - opts.Rect[1]
+	xobj := Dict{
+		"Type":    Name("XObject"),
+		"Subtype": Name("Form"),
+		"BBox":    Array{float64(0), float64(0), width, height},
+	}
+	if width <= 0 || height <= 0 {
+		return &Stream{Dict: xobj}
+	}
+	xobj["Resources"] = Dict{"Font": Dict{"F1": Dict{
+		"Type":     Name("Font"),
+		"Subtype":  Name("Type1"),
+		"BaseFont": Name("Helvetica"),
+	}}}
+	lines := []string{"Digitally signed by " + signer, "Date: " + opts.SigTime.UTC().Format("2006-01-02 15:04:05Z")}
+	if opts.Reason != "" {
+		lines = append(lines, "Reason: "+opts.Reason)
+	}
+	if opts.Location != "" {
+		lines = append(lines, "Location: "+opts.Location)
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "q BT /F1 8 Tf 10 TL 2 %s Td\n", strconv.FormatFloat(height-10, 'f', -1, 64))
+	for _, line := range lines {
+		writeString(&buf, String(line))
+		buf.WriteString(" Tj T*\n")
+	}
+	buf.WriteString("ET Q")
+	return &Stream{Dict: xobj, Data: buf.Bytes()}
+}
+
+// readForm returns a copy of the interactive form dictionary, its fields and
+// the names of all fields already in use
+func readForm(doc *Document, cat Dict) (Dict, Array, map[string]bool, error) {
+	form, err := doc.ResolveDict(cat["AcroForm"])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if form == nil {
+		form = Dict{}
+	} else {
+		form = form.Copy()
+	}
+	obj, err := doc.Resolve(form["Fields"])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	fields, _ := obj.(Array)
+	fields = append(Array{}, fields...)
+	names := make(map[string]bool)
+	err = walkFields(doc, fields, "", func(name string, field Dict) error {
+		names[name] = true
+		return nil
+	})
+	return form, fields, names, err
+}
+
+// walkFields calls fn for each terminal field with its fully qualified name
+func walkFields(doc *Document, fields Array, prefix string, fn func(string, Dict) error) error {
+	return walkFieldsDepth(doc, fields, prefix, nil, 0, fn)
+}
+
+func walkFieldsDepth(doc *Document, fields Array, prefix string, ft Object, depth int, fn func(string, Dict) error) error {
+	if depth > maxDepth {
+		return errors.New("pdf: form fields are nested too deeply")
+	}
+	for _, f := range fields {
+		field, err := doc.ResolveDict(f)
+		if err != nil {
+			return err
+		} else if field == nil {
+			continue
+		}
+		name := prefix
+		if t, ok := field["T"].(String); ok {
+			if name != "" {
+				name += "."
+			}
+			name += string(t)
+		}
+		fieldType := ft
+		if v := field["FT"]; v != nil {
+			fieldType = v
+		}
+		kids, err := doc.Resolve(field["Kids"])
+		if err != nil {
+			return err
+		}
+		if karr, ok := kids.(Array); ok && len(karr) != 0 {
+			if err := walkFieldsDepth(doc, karr, name, fieldType, depth+1, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		if ft != nil && field["FT"] == nil {
+			field = field.Copy()
+			field["FT"] = ft
+		}
+		if err := fn(name, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findSignatures returns the signature dictionaries of all signed fields,
+// keyed by field name
+func findSignatures(doc *Document, fields Array) (map[string]Dict, error) {
+	sigs := make(map[string]Dict)
+	err := walkFields(doc, fields, "", func(name string, field Dict) error {
+		if field.Name("FT") != "Sig" {
+			return nil
+		}
+		sig, err := doc.ResolveDict(field["V"])
+		if err != nil {
+			return err
+		} else if sig != nil {
+			sigs[name] = sig
+		}
+		return nil
+	})
+	return sigs, err
+}
+
+// docMDP returns the permissions of the certification signature, if any
+func docMDP(doc *Document, cat Dict) (int, error) {
+	perms, err := doc.ResolveDict(cat["Perms"])
+	if err != nil {
+		return 0, err
+	}
+	sig, err := doc.ResolveDict(perms.Get("DocMDP"))
+	if err != nil || sig == nil {
+		return 0, err
+	}
+	return sigDocMDP(doc, sig)
+}
+
+// sigDocMDP returns the DocMDP permissions declared in a signature dictionary
+func sigDocMDP(doc *Document, sig Dict) (int, error) {
+	obj, err := doc.Resolve(sig["Reference"])
+	if err != nil {
+		return 0, err
+	}
+	refs, _ := obj.(Array)
+	for _, r := range refs {
+		ref, err := doc.ResolveDict(r)
+		if err != nil {
+			return 0, err
+		}
+		if ref.Name("TransformMethod") != "DocMDP" {
+			continue
+		}
+		params, err := doc.ResolveDict(ref["TransformParams"])
+		if err != nil {
+			return 0, err
+		}
+		p, ok := params.Get("P").(int64)
+		if !ok {
+			// default is form filling and signing
+			p = 2
+		}
+		return int(p), nil
+	}
+	return 0, nil
+}
@@ -0,0 +1,153 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pdf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// Update is an incremental update that is appended to the original document
+type Update struct {
+	doc     *Document
+	objects map[int]Object
+	next    int
+	// Offsets of each object in the complete file, after calling Bytes()
+	Offsets map[int]int64
+}
+
+// NewUpdate starts a new incremental update of the document
+func (d *Document) NewUpdate() *Update {
+	next, _ := d.Trailer["Size"].(int64)
+	for num := range d.xref {
+		if int64(num) >= next {
+			next = int64(num) + 1
+		}
+	}
+	return &Update{
+		doc:     d,
+		objects: make(map[int]Object),
+		next:    int(next),
+	}
+}
+
+// Add a new object, returning a reference to it
+func (u *Update) Add(obj Object) Ref {
+	ref := Ref{Num: u.next}
+	u.next++
+	u.objects[ref.Num] = obj
+	return ref
+}
+
+// Set replaces an existing object
+func (u *Update) Set(ref Ref, obj Object) {
+	u.objects[ref.Num] = obj
+}
+
+// Get returns a modified object from the update, or from the original
+// document if it was not modified
+func (u *Update) Get(ref Ref) (Object, error) {
+	if obj, ok := u.objects[ref.Num]; ok {
+		return obj, nil
+	}
+	return u.doc.Resolve(ref)
+}
+
+// Bytes serializes the update. The result is appended to the original
+// document.
+func (u *Update) Bytes() []byte {
+	var buf bytes.Buffer
+	base := u.doc.Size()
+	if len(u.doc.data) > 0 {
+		if last := u.doc.data[len(u.doc.data)-1]; last != '\n' && last != '\r' {
+			buf.WriteByte('\n')
+		}
+	}
+	nums := make([]int, 0, len(u.objects)+1)
+	for num := range u.objects {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+	u.Offsets = make(map[int]int64, len(nums)+1)
+	for _, num := range nums {
+		u.Offsets[num] = base + int64(buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n", num)
+		writeObject(&buf, u.objects[num])
+		buf.WriteString("\nendobj\n")
+	}
+	trailer := Dict{
+		"Size": int64(u.next),
+		"Prev": u.doc.startxref,
+	}
+	for _, key := range []Name{"Root", "Info", "ID"} {
+		if v := u.doc.Trailer[key]; v != nil {
+			trailer[key] = v
+		}
+	}
+	xrefOffset := base + int64(buf.Len())
+	if u.doc.xrefStream {
+		// the cross-reference stream describes itself too
+		xrefNum := u.next
+		trailer["Size"] = int64(xrefNum + 1)
+		nums = append(nums, xrefNum)
+		u.Offsets[xrefNum] = xrefOffset
+		var data []byte
+		for _, num := range nums {
+			var row [7]byte
+			row[0] = 1
+			binary.BigEndian.PutUint32(row[1:], uint32(u.Offsets[num]))
+			data = append(data, row[:]...)
+		}
+		trailer["Type"] = Name("XRef")
+		trailer["W"] = Array{int64(1), int64(4), int64(2)}
+		trailer["Index"] = xrefIndex(nums)
+		fmt.Fprintf(&buf, "%d 0 obj\n", xrefNum)
+		writeObject(&buf, &Stream{Dict: trailer, Data: data})
+		buf.WriteString("\nendobj\n")
+	} else {
+		buf.WriteString("xref\n")
+		index := xrefIndex(nums)
+		for i := 0; i < len(index); i += 2 {
+			start, count := index[i].(int64), index[i+1].(int64)
+			fmt.Fprintf(&buf, "%d %d\n", start, count)
+			for num := start; num < start+count; num++ {
+				fmt.Fprintf(&buf, "%010d 00000 n\r\n", u.Offsets[int(num)])
+			}
+		}
+		buf.WriteString("trailer\n")
+		writeObject(&buf, trailer)
+		buf.WriteString("\n")
+	}
+	fmt.Fprintf(&buf, "startxref\n%d\n%%%%EOF\n", xrefOffset)
+	return buf.Bytes()
+}
+
+// build the Index array for a sorted list of object numbers
+func xrefIndex(nums []int) Array {
+	var index Array
+	for i := 0; i < len(nums); {
+		j := i + 1
+		for j < len(nums) && nums[j] == nums[j-1]+1 {
+			j++
+		}
+		index = append(index, int64(nums[i]), int64(j-i))
+		i = j
+	}
+	return index
+}
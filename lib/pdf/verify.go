@@ -0,0 +1,156 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pdf
+
+import (
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/sassoftware/relic/v7/lib/pkcs7"
+	"github.com/sassoftware/relic/v7/lib/pkcs9"
+	"github.com/sassoftware/relic/v7/signers/sigerrors"
+)
+
+// PDFSignature describes a verified signature
+type PDFSignature struct {
+	Field     string
+	SubFilter Name
+	Reason    string
+	Location  string
+	ByteRange [4]int64
+	// CoversDocument is true if nothing was appended after the signature
+	CoversDocument bool
+	// DocMDP is nonzero for certification signatures
+	DocMDP    int
+	Signature *pkcs9.TimestampedSignature
+}
+
+// Verify all signatures in the document. The certificate chains are not
+// checked.
+func Verify(doc *Document, skipDigests bool) ([]*PDFSignature, error) {
+	_, cat, err := doc.Catalog()
+	if err != nil {
+		return nil, err
+	}
+	_, fields, _, err := readForm(doc, cat)
+	if err != nil {
+		return nil, err
+	}
+	sigs, err := findSignatures(doc, fields)
+	if err != nil {
+		return nil, err
+	}
+	if len(sigs) == 0 {
+		return nil, sigerrors.NotSignedError{Type: "pdf"}
+	}
+	var ret []*PDFSignature
+	for name, sig := range sigs {
+		s, err := verifySig(doc, name, sig, skipDigests)
+		if err != nil {
+			return nil, fmt.Errorf("signature %q: %w", name, err)
+		}
+		ret = append(ret, s)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].ByteRange[2] < ret[j].ByteRange[2] })
+	for _, s := range ret {
+		if s.DocMDP == 1 && !s.CoversDocument {
+			return nil, fmt.Errorf("signature %q: document was modified after a certification signature that does not permit changes", s.Field)
+		}
+	}
+	return ret, nil
+}
+
+func verifySig(doc *Document, name string, sig Dict, skipDigests bool) (*PDFSignature, error) {
+	s := &PDFSignature{Field: name, SubFilter: sig.Name("SubFilter")}
+	switch s.SubFilter {
+	case "ETSI.CAdES.detached", "adbe.pkcs7.detached":
+	default:
+		return nil, fmt.Errorf("unsupported signature type %q", s.SubFilter)
+	}
+	if v, ok := sig["Reason"].(String); ok {
+		s.Reason = string(v)
+	}
+	if v, ok := sig["Location"].(String); ok {
+		s.Location = string(v)
+	}
+	br, _ := sig["ByteRange"].(Array)
+	if len(br) != 4 {
+		return nil, errors.New("malformed ByteRange")
+	}
+	for i, v := range br {
+		n, ok := v.(int64)
+		if !ok || n < 0 {
+			return nil, errors.New("malformed ByteRange")
+		}
+		s.ByteRange[i] = n
+	}
+	start, end := s.ByteRange[1], s.ByteRange[2]
+	size := doc.Size()
+	if s.ByteRange[0] != 0 || start >= end || end+s.ByteRange[3] > size {
+		return nil, errors.New("ByteRange is out of bounds")
+	}
+	// the gap must be exactly the hex string holding the signature
+	if doc.data[start] != '<' || doc.data[end-1] != '>' {
+		return nil, errors.New("ByteRange does not exclude just the signature")
+	}
+	for _, c := range doc.data[start+1 : end-1] {
+		if !isHex(c) {
+			return nil, errors.New("ByteRange does not exclude just the signature")
+		}
+	}
+	s.CoversDocument = end+s.ByteRange[3] == size
+	contents, _ := sig["Contents"].(String)
+	psd, err := pkcs7.Unmarshal(contents)
+	if err != nil {
+		return nil, err
+	}
+	signed := make([]byte, 0, start+s.ByteRange[3])
+	signed = append(signed, doc.data[:start]...)
+	signed = append(signed, doc.data[end:end+s.ByteRange[3]]...)
+	if skipDigests {
+		signed = nil
+	}
+	psig, err := psd.Content.Verify(signed, skipDigests)
+	if err != nil {
+		return nil, err
+	}
+	ts, err := pkcs9.VerifyOptionalTimestamp(psig)
+	if err != nil {
+		return nil, err
+	}
+	s.Signature = &ts
+	if s.SubFilter == "ETSI.CAdES.detached" {
+		var raw asn1.RawValue
+		if err := psig.SignerInfo.AuthenticatedAttributes.GetOne(pkcs9.OidAttributeSigningCertificateV2, &raw); err != nil {
+			return nil, err
+		}
+		if err := pkcs9.CheckSigningCertificateV2(raw.FullBytes, psig.Certificate); err != nil {
+			return nil, err
+		}
+	}
+	s.DocMDP, err = sigDocMDP(doc, sig)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func isHex(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
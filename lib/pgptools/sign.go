@@ -0,0 +1,133 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pgptools
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"encoding/asn1"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"math/big"
+	"math/bits"
+	"time"
+
+	"golang.org/x/crypto/openpgp/packet"
+	"golang.org/x/crypto/openpgp/s2k"
+)
+
+// OpenPGP signature subpacket types
+const (
+	subpacketCreationTime      = 2
+	subpacketIssuer            = 16
+	subpacketIssuerFingerprint = 33
+)
+
+// DetachSignHash finishes a binary detached signature over the document
+// already written to h, which must be a new hash of type hashType. The
+// result is a version 4 signature packet whose hashed area holds the creation
+// time, issuer fingerprint and issuer key ID, which is what Sequoia-based
+// verifiers such as rpm-sequoia expect of a modern signature.
+func DetachSignHash(h hash.Hash, key *packet.PrivateKey, hashType crypto.Hash, creationTime time.Time) ([]byte, error) {
+	hashID, ok := s2k.HashToHashId(hashType)
+	if !ok {
+		return nil, fmt.Errorf("unsupported digest %s", hashType)
+	}
+	signer, ok := key.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key.PrivateKey)
+	}
+	var hashed bytes.Buffer
+	created := make([]byte, 4)
+	binary.BigEndian.PutUint32(created, uint32(creationTime.Unix()))
+	writeSubpacket(&hashed, subpacketCreationTime, created)
+	writeSubpacket(&hashed, subpacketIssuerFingerprint, append([]byte{4}, key.Fingerprint[:]...))
+	keyID := make([]byte, 8)
+	binary.BigEndian.PutUint64(keyID, key.KeyId)
+	writeSubpacket(&hashed, subpacketIssuer, keyID)
+
+	var body bytes.Buffer
+	body.Write([]byte{4, byte(packet.SigTypeBinary), byte(key.PubKeyAlgo), hashID})
+	_ = binary.Write(&body, binary.BigEndian, uint16(hashed.Len()))
+	body.Write(hashed.Bytes())
+	// the hashed part of the packet is followed by a trailer with its length
+	trailer := []byte{4, 0xff, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(trailer[2:], uint32(body.Len()))
+	h.Write(body.Bytes())
+	h.Write(trailer)
+	digest := h.Sum(nil)
+
+	raw, err := signer.Sign(rand.Reader, digest, hashType)
+	if err != nil {
+		return nil, err
+	}
+	var mpis [][]byte
+	switch key.PubKeyAlgo {
+	case packet.PubKeyAlgoRSA, packet.PubKeyAlgoRSASignOnly:
+		mpis = [][]byte{raw}
+	case packet.PubKeyAlgoECDSA:
+		var esig struct{ R, S *big.Int }
+		if _, err := asn1.Unmarshal(raw, &esig); err != nil {
+			return nil, err
+		}
+		mpis = [][]byte{esig.R.Bytes(), esig.S.Bytes()}
+	default:
+		return nil, fmt.Errorf("unsupported public key algorithm %d", key.PubKeyAlgo)
+	}
+	// no unhashed subpackets
+	body.Write([]byte{0, 0})
+	body.Write(digest[:2])
+	for _, mpi := range mpis {
+		writeMPI(&body, mpi)
+	}
+	// new format packet header
+	var pkt bytes.Buffer
+	pkt.WriteByte(0xc0 | packetTypeSignature)
+	switch n := body.Len(); {
+	case n < 192:
+		pkt.WriteByte(byte(n))
+	case n < 8384:
+		pkt.Write([]byte{byte((n-192)>>8) + 192, byte(n - 192)})
+	default:
+		pkt.WriteByte(0xff)
+		_ = binary.Write(&pkt, binary.BigEndian, uint32(n))
+	}
+	pkt.Write(body.Bytes())
+	return pkt.Bytes(), nil
+}
+
+const packetTypeSignature = 2
+
+func writeSubpacket(w *bytes.Buffer, typ byte, contents []byte) {
+	// every subpacket used here is shorter than 191 bytes, so the length is
+	// always one octet
+	w.WriteByte(byte(len(contents) + 1))
+	w.WriteByte(typ)
+	w.Write(contents)
+}
+
+func writeMPI(w *bytes.Buffer, value []byte) {
+	value = bytes.TrimLeft(value, "\x00")
+	n := 0
+	if len(value) > 0 {
+		n = 8*(len(value)-1) + bits.Len8(value[0])
+	}
+	_ = binary.Write(w, binary.BigEndian, uint16(n))
+	w.Write(value)
+}
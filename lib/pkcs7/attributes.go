@@ -96,7 +96,12 @@ func (l *AttributeList) Add(oid asn1.ObjectIdentifier, obj interface{}) error {
 func appendAttr(attrList AttributeList, oid asn1.ObjectIdentifier, value []byte) AttributeList {
 	for i, attr := range attrList {
 		if attr.Type.Equal(oid) {
-			attr.Values.Bytes = append(attr.Values.Bytes, value...)
+			// a parsed attribute's values point into the original encoding, so
+			// copy them rather than write past the end, and drop FullBytes so
+			// the new value gets marshaled
+			values := attr.Values.Bytes
+			attr.Values.Bytes = append(values[:len(values):len(values)], value...)
+			attr.Values.FullBytes = nil
 			attrList[i] = attr
 			return attrList
 		}
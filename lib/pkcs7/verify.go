@@ -167,6 +167,13 @@ func (si *SignerInfo) Verify(content []byte, skipDigests bool, certs []*x509.Cer
 // PKCS#9 trusted timestamp was found, pass that timestamp in currentTime to
 // validate the chain as of the time of the signature.
 func (info Signature) VerifyChain(roots *x509.CertPool, extraCerts []*x509.Certificate, usage x509.ExtKeyUsage, currentTime time.Time) error {
+	return info.VerifyChainRevocation(roots, extraCerts, usage, currentTime, nil)
+}
+
+// VerifyChainRevocation is like VerifyChain, but additionally uses checker to
+// test whether any certificate in the validated chain was revoked as of
+// currentTime. If checker is nil then revocation is not checked.
+func (info Signature) VerifyChainRevocation(roots *x509.CertPool, extraCerts []*x509.Certificate, usage x509.ExtKeyUsage, currentTime time.Time, checker x509tools.RevocationChecker) error {
 	pool := x509.NewCertPool()
 	for _, cert := range extraCerts {
 		pool.AddCert(cert)
@@ -180,8 +187,11 @@ func (info Signature) VerifyChain(roots *x509.CertPool, extraCerts []*x509.Certi
 		CurrentTime:   currentTime,
 		KeyUsages:     []x509.ExtKeyUsage{usage},
 	}
-	_, err := info.Certificate.Verify(opts)
+	chains, err := info.Certificate.Verify(opts)
 	if err == nil {
+		if checker != nil && len(chains) != 0 {
+			return checker.CheckRevocation(chains[0], currentTime)
+		}
 		return nil
 	}
 	if e := new(x509.UnknownAuthorityError); errors.As(err, e) && info.CertError != nil {
@@ -0,0 +1,93 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pkcs9
+
+// The ESS signing-certificate-v2 attribute (RFC 5035) binds the signer's
+// certificate to the signature. CAdES, and formats built on it such as PAdES
+// and NuGet, require it.
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+)
+
+var OidAttributeSigningCertificateV2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}
+
+type SigningCertificateV2 struct {
+	Certs []ESSCertIDv2
+}
+
+// HashAlgorithm defaults to SHA-256
+type ESSCertIDv2 struct {
+	HashAlgorithm pkix.AlgorithmIdentifier `asn1:"optional"`
+	CertHash      []byte
+	IssuerSerial  ESSIssuerSerial `asn1:"optional"`
+}
+
+type ESSIssuerSerial struct {
+	Issuer       []asn1.RawValue
+	SerialNumber *big.Int
+}
+
+// NewSigningCertificateV2 builds a signing-certificate-v2 attribute value
+// identifying cert by its SHA-256 digest
+func NewSigningCertificateV2(cert *x509.Certificate) SigningCertificateV2 {
+	d := sha256.Sum256(cert.Raw)
+	return SigningCertificateV2{Certs: []ESSCertIDv2{{
+		CertHash: d[:],
+		IssuerSerial: ESSIssuerSerial{
+			Issuer:       []asn1.RawValue{{Class: asn1.ClassContextSpecific, Tag: 4, IsCompound: true, Bytes: cert.RawIssuer}},
+			SerialNumber: cert.SerialNumber,
+		},
+	}}}
+}
+
+// CheckSigningCertificateV2 checks that an encoded signing-certificate-v2
+// attribute value identifies cert
+func CheckSigningCertificateV2(raw []byte, cert *x509.Certificate) error {
+	var sc SigningCertificateV2
+	if rest, err := asn1.Unmarshal(raw, &sc); err != nil {
+		return fmt.Errorf("malformed signing-certificate-v2 attribute: %w", err)
+	} else if len(rest) != 0 {
+		return errors.New("malformed signing-certificate-v2 attribute: trailing garbage")
+	}
+	if len(sc.Certs) == 0 {
+		return errors.New("signing-certificate-v2 attribute is empty")
+	}
+	hash := crypto.SHA256
+	if alg := sc.Certs[0].HashAlgorithm; len(alg.Algorithm) != 0 {
+		var err error
+		if hash, err = x509tools.PkixDigestToHashE(alg); err != nil {
+			return err
+		}
+	}
+	d := hash.New()
+	d.Write(cert.Raw)
+	if !bytes.Equal(sc.Certs[0].CertHash, d.Sum(nil)) {
+		return errors.New("signing-certificate-v2 attribute does not match the signer certificate")
+	}
+	return nil
+}
@@ -49,7 +49,13 @@ func TimestampAndMarshal(ctx context.Context, psd *pkcs7.ContentInfoSignedData,
 			return nil, err
 		}
 	}
-	verified, err := psd.Content.Verify(nil, false)
+	// a signature over the digest of detached content can only have its
+	// authenticated attributes checked
+	content, err := psd.Content.ContentInfo.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	verified, err := psd.Content.Verify(nil, content == nil)
 	if err != nil {
 		return nil, fmt.Errorf("pkcs7: failed signature self-check: %w", err)
 	}
@@ -138,7 +144,13 @@ func VerifyOptionalTimestamp(sig pkcs7.Signature) (TimestampedSignature, error)
 
 // Verify that the timestamp token has a valid certificate chain
 func (cs CounterSignature) VerifyChain(roots *x509.CertPool, extraCerts []*x509.Certificate) error {
-	return cs.Signature.VerifyChain(roots, extraCerts, x509.ExtKeyUsageTimeStamping, cs.SigningTime)
+	return cs.VerifyChainRevocation(roots, extraCerts, nil)
+}
+
+// VerifyChainRevocation is like VerifyChain, but also checks that the
+// timestamping certificate chain was not revoked at the time of the timestamp
+func (cs CounterSignature) VerifyChainRevocation(roots *x509.CertPool, extraCerts []*x509.Certificate, checker x509tools.RevocationChecker) error {
+	return cs.Signature.VerifyChainRevocation(roots, extraCerts, x509.ExtKeyUsageTimeStamping, cs.SigningTime, checker)
 }
 
 // Verify the certificate chain of a PKCS#7 signature. If the signature has a
@@ -146,14 +158,21 @@ func (cs CounterSignature) VerifyChain(roots *x509.CertPool, extraCerts []*x509.
 // the primary signature's chain, making the signature valid after the
 // certificates have expired.
 func (sig TimestampedSignature) VerifyChain(roots *x509.CertPool, extraCerts []*x509.Certificate, usage x509.ExtKeyUsage) error {
+	return sig.VerifyChainRevocation(roots, extraCerts, usage, nil)
+}
+
+// VerifyChainRevocation is like VerifyChain, but also uses checker to test
+// whether the signer or timestamper certificates have been revoked. If the
+// signature is timestamped, then revocations after the timestamp are ignored.
+func (sig TimestampedSignature) VerifyChainRevocation(roots *x509.CertPool, extraCerts []*x509.Certificate, usage x509.ExtKeyUsage, checker x509tools.RevocationChecker) error {
 	var signingTime time.Time
 	if sig.CounterSignature != nil {
-		if err := sig.CounterSignature.VerifyChain(roots, extraCerts); err != nil {
+		if err := sig.CounterSignature.VerifyChainRevocation(roots, extraCerts, checker); err != nil {
 			return fmt.Errorf("validating timestamp: %w", err)
 		}
 		signingTime = sig.CounterSignature.SigningTime
 	}
-	return sig.Signature.VerifyChain(roots, extraCerts, usage, signingTime)
+	return sig.Signature.VerifyChainRevocation(roots, extraCerts, usage, signingTime, checker)
 }
 
 // Verify a non-RFC-3161 timestamp token against the given encrypted digest
@@ -0,0 +1,99 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pkcs9
+
+// CAdES revocation values (RFC 5126 section 6.3.4) allow a signer to archive
+// the OCSP responses and CRLs that were used to validate their certificate
+// chain at signing time.
+
+import (
+	"encoding/asn1"
+	"errors"
+	"fmt"
+
+	"github.com/sassoftware/relic/v7/lib/pkcs7"
+)
+
+var (
+	OidAttributeRevocationValues = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 24}
+	OidOCSPBasic                 = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 1}
+)
+
+type RevocationValues struct {
+	CRLVals  []asn1.RawValue `asn1:"optional,explicit,tag:0"`
+	OCSPVals []asn1.RawValue `asn1:"optional,explicit,tag:1"`
+}
+
+type ocspResponse struct {
+	Status        asn1.Enumerated
+	ResponseBytes ocspResponseBytes `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspResponseBytes struct {
+	ResponseType asn1.ObjectIdentifier
+	Response     []byte
+}
+
+// AddRevocationValues attaches OCSP responses and CRLs to a SignerInfo as an
+// unauthenticated attribute. ocspResponses holds complete DER-encoded
+// OCSPResponse structures, and crls holds DER-encoded CertificateLists.
+func AddRevocationValues(signerInfo *pkcs7.SignerInfo, ocspResponses, crls [][]byte) error {
+	if len(ocspResponses) == 0 && len(crls) == 0 {
+		return nil
+	}
+	var values RevocationValues
+	for _, crl := range crls {
+		values.CRLVals = append(values.CRLVals, asn1.RawValue{FullBytes: crl})
+	}
+	for _, raw := range ocspResponses {
+		basic, err := basicOCSPResponse(raw)
+		if err != nil {
+			return err
+		}
+		values.OCSPVals = append(values.OCSPVals, asn1.RawValue{FullBytes: basic})
+	}
+	return signerInfo.UnauthenticatedAttributes.Add(OidAttributeRevocationValues, values)
+}
+
+// GetRevocationValues returns the archived revocation values from a
+// SignerInfo, if any
+func GetRevocationValues(signerInfo *pkcs7.SignerInfo) (*RevocationValues, error) {
+	values := new(RevocationValues)
+	if err := signerInfo.UnauthenticatedAttributes.GetOne(OidAttributeRevocationValues, values); err != nil {
+		if _, ok := err.(pkcs7.ErrNoAttribute); ok {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return values, nil
+}
+
+// Extract the BasicOCSPResponse from a complete OCSPResponse
+func basicOCSPResponse(der []byte) ([]byte, error) {
+	var resp ocspResponse
+	if rest, err := asn1.Unmarshal(der, &resp); err != nil {
+		return nil, fmt.Errorf("parsing OCSP response: %w", err)
+	} else if len(rest) != 0 {
+		return nil, errors.New("trailing garbage after OCSP response")
+	}
+	if resp.Status != 0 {
+		return nil, fmt.Errorf("OCSP response has unsuccessful status %d", resp.Status)
+	} else if !resp.ResponseBytes.ResponseType.Equal(OidOCSPBasic) {
+		return nil, fmt.Errorf("unsupported OCSP response type %s", resp.ResponseBytes.ResponseType)
+	}
+	return resp.ResponseBytes.Response, nil
+}
@@ -0,0 +1,109 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pkcs9_test
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/sassoftware/relic/v7/internal/testcert"
+	"github.com/sassoftware/relic/v7/lib/pkcs7"
+	"github.com/sassoftware/relic/v7/lib/pkcs9"
+)
+
+func TestRevocationValues(t *testing.T) {
+	key := testcert.ECDSAKey(t)
+	ca := testcert.CA(t, "Test CA", key)
+	cases := []struct {
+		name   string
+		status int
+	}{
+		{"good", ocsp.Good},
+		{"revoked", ocsp.Revoked},
+		{"unknown", ocsp.Unknown},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			resp, err := ocsp.CreateResponse(ca, ca, ocsp.Response{
+				Status:       c.status,
+				SerialNumber: big.NewInt(10),
+				ThisUpdate:   time.Now().Add(-time.Hour),
+				NextUpdate:   time.Now().Add(time.Hour),
+				RevokedAt:    time.Now().Add(-time.Minute),
+			}, key)
+			require.NoError(t, err)
+			crl, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+				Number:     big.NewInt(1),
+				ThisUpdate: time.Now().Add(-time.Hour),
+				NextUpdate: time.Now().Add(time.Hour),
+			}, ca, key)
+			require.NoError(t, err)
+
+			signerInfo := new(pkcs7.SignerInfo)
+			require.NoError(t, pkcs9.AddRevocationValues(signerInfo, [][]byte{resp}, [][]byte{crl}))
+			values, err := pkcs9.GetRevocationValues(signerInfo)
+			require.NoError(t, err)
+			require.Len(t, values.CRLVals, 1)
+			assert.Equal(t, crl, values.CRLVals[0].FullBytes)
+			require.Len(t, values.OCSPVals, 1)
+			// the archived value is the BasicOCSPResponse, which must still
+			// carry the original status
+			parsed, err := ocsp.ParseResponse(wrapBasic(t, values.OCSPVals[0].FullBytes), ca)
+			require.NoError(t, err)
+			assert.Equal(t, c.status, parsed.Status)
+		})
+	}
+}
+
+func TestRevocationValuesEmpty(t *testing.T) {
+	signerInfo := new(pkcs7.SignerInfo)
+	require.NoError(t, pkcs9.AddRevocationValues(signerInfo, nil, nil))
+	values, err := pkcs9.GetRevocationValues(signerInfo)
+	require.NoError(t, err)
+	assert.Nil(t, values)
+}
+
+func TestRevocationValuesUnsuccessful(t *testing.T) {
+	signerInfo := new(pkcs7.SignerInfo)
+	err := pkcs9.AddRevocationValues(signerInfo, [][]byte{ocsp.TryLaterErrorResponse}, nil)
+	assert.EqualError(t, err, "OCSP response has unsuccessful status 3")
+	err = pkcs9.AddRevocationValues(signerInfo, [][]byte{append(ocsp.MalformedRequestErrorResponse, 0)}, nil)
+	assert.EqualError(t, err, "trailing garbage after OCSP response")
+}
+
+// Wrap a BasicOCSPResponse back up into a successful OCSPResponse
+func wrapBasic(t *testing.T, basic []byte) []byte {
+	type responseBytes struct {
+		ResponseType asn1.ObjectIdentifier
+		Response     []byte
+	}
+	type response struct {
+		Status        asn1.Enumerated
+		ResponseBytes responseBytes `asn1:"explicit,tag:0"`
+	}
+	blob, err := asn1.Marshal(response{ResponseBytes: responseBytes{pkcs9.OidOCSPBasic, basic}})
+	require.NoError(t, err)
+	return blob
+}
@@ -0,0 +1,132 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package pypi creates and verifies PEP 740 attestations for Python
+// distributions.
+package pypi
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/sassoftware/relic/v7/lib/dsse"
+	"github.com/sassoftware/relic/v7/lib/intoto"
+	"github.com/sassoftware/relic/v7/lib/sigstore"
+)
+
+const (
+	// PublishPredicate is the predicate type of a PyPI publish attestation
+	PublishPredicate = "https://docs.pypi.org/attestations/publish/v1"
+	// AttestationSuffix is appended to the distribution's file name
+	AttestationSuffix = ".publish.attestation"
+)
+
+var sdistName = regexp.MustCompile(`^[A-Za-z0-9_.]+-[^-/]+\.tar\.gz$`)
+
+// IsDistribution returns true if the file name is that of a wheel or sdist
+func IsDistribution(name string) bool {
+	return strings.HasSuffix(name, ".whl") || sdistName.MatchString(name)
+}
+
+// Attestation is a PEP 740 attestation object
+type Attestation struct {
+	Version              int                  `json:"version"`
+	VerificationMaterial VerificationMaterial `json:"verification_material"`
+	Envelope             Envelope             `json:"envelope"`
+}
+
+// VerificationMaterial holds the signing certificate and optionally the
+// transparency log entries for the signature
+type VerificationMaterial struct {
+	// DER X.509 certificate
+	Certificate         []byte            `json:"certificate"`
+	TransparencyEntries []json.RawMessage `json:"transparency_entries"`
+}
+
+// Envelope is a DSSE envelope with a single signature, flattened
+type Envelope struct {
+	Statement []byte `json:"statement"`
+	Signature []byte `json:"signature"`
+}
+
+// Attest signs a publish attestation for a distribution with the given
+// SHA-256 digest
+func Attest(name string, sha256 []byte, signer crypto.Signer, cert *x509.Certificate) (*Attestation, error) {
+	if !IsDistribution(name) {
+		return nil, fmt.Errorf("%s is not a wheel or sdist file name", name)
+	}
+	stmt, err := intoto.NewStatement(name, sha256, PublishPredicate, nil)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(stmt)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := dsse.SignPAE(signer, sigstore.HashForKey(cert.PublicKey), intoto.PayloadType, payload)
+	if err != nil {
+		return nil, err
+	}
+	return &Attestation{
+		Version: 1,
+		VerificationMaterial: VerificationMaterial{
+			Certificate:         cert.Raw,
+			TransparencyEntries: []json.RawMessage{},
+		},
+		Envelope: Envelope{Statement: payload, Signature: sig},
+	}, nil
+}
+
+// Parse an attestation
+func Parse(blob []byte) (*Attestation, error) {
+	a := new(Attestation)
+	if err := json.Unmarshal(blob, a); err != nil {
+		return nil, fmt.Errorf("parsing attestation: %w", err)
+	}
+	if a.Version != 1 {
+		return nil, fmt.Errorf("unsupported attestation version %d", a.Version)
+	}
+	return a, nil
+}
+
+// Verify the attestation's signature and that it describes the given
+// distribution, returning the signing certificate. The certificate chain is
+// not checked.
+func (a *Attestation) Verify(name string, sha256 []byte) (*x509.Certificate, error) {
+	cert, err := x509.ParseCertificate(a.VerificationMaterial.Certificate)
+	if err != nil {
+		return nil, fmt.Errorf("parsing attestation certificate: %w", err)
+	}
+	if err := dsse.VerifyPAE(cert.PublicKey, sigstore.HashForKey(cert.PublicKey), intoto.PayloadType, a.Envelope.Statement, a.Envelope.Signature); err != nil {
+		return nil, err
+	}
+	stmt, err := intoto.Parse(a.Envelope.Statement)
+	if err != nil {
+		return nil, err
+	}
+	if stmt.PredicateType != PublishPredicate {
+		return nil, errors.New("attestation is not a PyPI publish attestation")
+	}
+	if err := stmt.CheckSubject(name, sha256); err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
@@ -0,0 +1,58 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pypi
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sassoftware/relic/v7/internal/testcert"
+)
+
+func TestIsDistribution(t *testing.T) {
+	assert.True(t, IsDistribution("sampleproject-4.0.0-py3-none-any.whl"))
+	assert.True(t, IsDistribution("sampleproject-4.0.0.tar.gz"))
+	assert.False(t, IsDistribution("APKINDEX.tar.gz"))
+	assert.False(t, IsDistribution("sampleproject-4.0.0.zip"))
+}
+
+func TestAttest(t *testing.T) {
+	key := testcert.ECDSAKey(t)
+	cert := testcert.SelfSigned(t, "publisher", key)
+
+	name := "sampleproject-4.0.0-py3-none-any.whl"
+	digest := sha256.Sum256([]byte("wheel contents"))
+	att, err := Attest(name, digest[:], key, cert)
+	require.NoError(t, err)
+	blob, err := json.Marshal(att)
+	require.NoError(t, err)
+	att, err = Parse(blob)
+	require.NoError(t, err)
+	signer, err := att.Verify(name, digest[:])
+	require.NoError(t, err)
+	assert.Equal(t, cert.Raw, signer.Raw)
+
+	_, err = att.Verify("other-1.0-py3-none-any.whl", digest[:])
+	assert.Error(t, err)
+	other := sha256.Sum256([]byte("tampered"))
+	_, err = att.Verify(name, other[:])
+	assert.Error(t, err)
+}
@@ -0,0 +1,304 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package rekor records signatures in a Rekor transparency log, so that
+// anyone can audit what was signed with a key or identity.
+package rekor
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sassoftware/relic/v7/config"
+	"github.com/sassoftware/relic/v7/lib/dsse"
+	"github.com/sassoftware/relic/v7/lib/intoto"
+)
+
+// PublicURL is the public Sigstore instance of Rekor
+const PublicURL = "https://rekor.sigstore.dev"
+
+const maxResponse = 1 << 20
+
+// Client talks to a Rekor server
+type Client struct {
+	URL        string
+	HTTPClient *http.Client
+}
+
+// Entry kinds
+const (
+	KindHashedRekord = "hashedrekord"
+	KindDSSE         = "dsse"
+	KindIntoto       = "intoto"
+)
+
+// Entry describes a record that was added to the log. It can be saved as
+// JSON and later checked offline with Verify.
+type Entry struct {
+	UUID           string    `json:"uuid"`
+	LogIndex       int64     `json:"logIndex"`
+	IntegratedTime time.Time `json:"integratedTime"`
+	LogID          string    `json:"logID"`
+	// base64 signed entry timestamp, the log's promise to include the entry
+	SignedEntryTimestamp string `json:"signedEntryTimestamp,omitempty"`
+
+	Kind string `json:"kind"`
+	// Body is the canonicalized entry as recorded by the log
+	Body           []byte          `json:"body"`
+	InclusionProof *InclusionProof `json:"inclusionProof,omitempty"`
+	// Envelope is the DSSE envelope of a dsse or intoto entry, which the log
+	// only records by hash
+	Envelope *dsse.Envelope `json:"envelope,omitempty"`
+}
+
+// InclusionProof proves that an entry is part of the log's Merkle tree
+type InclusionProof struct {
+	LogIndex   int64    `json:"logIndex"`
+	RootHash   string   `json:"rootHash"`
+	TreeSize   int64    `json:"treeSize"`
+	Hashes     []string `json:"hashes"`
+	Checkpoint string   `json:"checkpoint,omitempty"`
+}
+
+// New returns a client for the given server
+func New(url string) *Client {
+	return &Client{
+		URL:        strings.TrimSuffix(url, "/"),
+		HTTPClient: &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+type hashedRekord struct {
+	APIVersion string           `json:"apiVersion"`
+	Kind       string           `json:"kind"`
+	Spec       hashedRekordSpec `json:"spec"`
+}
+
+type hashedRekordSpec struct {
+	Signature struct {
+		Content   []byte `json:"content"`
+		PublicKey struct {
+			Content []byte `json:"content"`
+		} `json:"publicKey"`
+	} `json:"signature"`
+	Data struct {
+		Hash struct {
+			Algorithm string `json:"algorithm"`
+			Value     string `json:"value"`
+		} `json:"hash"`
+	} `json:"data"`
+}
+
+type dsseProposal struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Spec       struct {
+		ProposedContent struct {
+			Envelope  string   `json:"envelope"`
+			Verifiers [][]byte `json:"verifiers"`
+		} `json:"proposedContent"`
+	} `json:"spec"`
+}
+
+// intoto v0.0.2 entries carry the payload and signatures base64 encoded
+// twice
+type intotoProposal struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Spec       struct {
+		Content struct {
+			Envelope struct {
+				PayloadType string            `json:"payloadType"`
+				Payload     []byte            `json:"payload"`
+				Signatures  []intotoSignature `json:"signatures"`
+			} `json:"envelope"`
+		} `json:"content"`
+	} `json:"spec"`
+}
+
+type intotoSignature struct {
+	Sig       []byte `json:"sig"`
+	PublicKey []byte `json:"publicKey"`
+}
+
+type logEntry struct {
+	Body           string `json:"body"`
+	IntegratedTime int64  `json:"integratedTime"`
+	LogID          string `json:"logID"`
+	LogIndex       int64  `json:"logIndex"`
+	Verification   struct {
+		SignedEntryTimestamp string          `json:"signedEntryTimestamp"`
+		InclusionProof       *InclusionProof `json:"inclusionProof"`
+	} `json:"verification"`
+}
+
+// SignAndUpload signs the SHA-256 digest of an artifact and records the
+// signature and certificate as a hashedrekord entry. Ed25519 keys can't be
+// used because they can't sign a digest.
+func (c *Client) SignAndUpload(ctx context.Context, signer crypto.Signer, cert *x509.Certificate, artifact io.Reader) (*Entry, error) {
+	switch signer.Public().(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+	default:
+		return nil, errors.New("transparency log: only RSA and ECDSA keys are supported")
+	}
+	d := crypto.SHA256.New()
+	if _, err := io.Copy(d, artifact); err != nil {
+		return nil, err
+	}
+	digest := d.Sum(nil)
+	sig, err := signer.Sign(rand.Reader, digest, crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("transparency log: signing artifact digest: %w", err)
+	}
+	return c.UploadHashedRekord(ctx, digest, sig, cert)
+}
+
+// UploadHashedRekord records a signature over a SHA-256 digest
+func (c *Client) UploadHashedRekord(ctx context.Context, digest, sig []byte, cert *x509.Certificate) (*Entry, error) {
+	rec := hashedRekord{APIVersion: "0.0.1", Kind: "hashedrekord"}
+	rec.Spec.Signature.Content = sig
+	rec.Spec.Signature.PublicKey.Content = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	rec.Spec.Data.Hash.Algorithm = "sha256"
+	rec.Spec.Data.Hash.Value = hex.EncodeToString(digest)
+	return c.upload(ctx, rec)
+}
+
+// SignAndUploadDSSE signs an in-toto statement into a DSSE envelope and
+// records it as an entry of the given kind, either dsse or intoto
+func (c *Client) SignAndUploadDSSE(ctx context.Context, kind string, signer crypto.Signer, cert *x509.Certificate, statement []byte) (*Entry, error) {
+	env, err := dsse.Sign(signer, crypto.SHA256, intoto.PayloadType, statement, "")
+	if err != nil {
+		return nil, fmt.Errorf("transparency log: signing statement: %w", err)
+	}
+	switch kind {
+	case KindDSSE:
+		return c.UploadDSSE(ctx, env, cert)
+	case KindIntoto:
+		return c.UploadIntoto(ctx, env, cert)
+	default:
+		return nil, fmt.Errorf("transparency log: unsupported entry kind %q", kind)
+	}
+}
+
+// UploadDSSE records a DSSE envelope as a dsse entry
+func (c *Client) UploadDSSE(ctx context.Context, env *dsse.Envelope, cert *x509.Certificate) (*Entry, error) {
+	envJSON, err := json.Marshal(env)
+	if err != nil {
+		return nil, err
+	}
+	rec := dsseProposal{APIVersion: "0.0.1", Kind: KindDSSE}
+	rec.Spec.ProposedContent.Envelope = string(envJSON)
+	rec.Spec.ProposedContent.Verifiers = [][]byte{pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})}
+	entry, err := c.upload(ctx, rec)
+	if err != nil {
+		return nil, err
+	}
+	entry.Envelope = env
+	return entry, nil
+}
+
+// UploadIntoto records a DSSE envelope as an intoto entry
+func (c *Client) UploadIntoto(ctx context.Context, env *dsse.Envelope, cert *x509.Certificate) (*Entry, error) {
+	rec := intotoProposal{APIVersion: "0.0.2", Kind: KindIntoto}
+	rec.Spec.Content.Envelope.PayloadType = env.PayloadType
+	rec.Spec.Content.Envelope.Payload = []byte(base64.StdEncoding.EncodeToString(env.Payload))
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	for _, sig := range env.Signatures {
+		rec.Spec.Content.Envelope.Signatures = append(rec.Spec.Content.Envelope.Signatures, intotoSignature{
+			Sig:       []byte(base64.StdEncoding.EncodeToString(sig.Sig)),
+			PublicKey: certPEM,
+		})
+	}
+	entry, err := c.upload(ctx, rec)
+	if err != nil {
+		return nil, err
+	}
+	entry.Envelope = env
+	return entry, nil
+}
+
+func (c *Client) upload(ctx context.Context, proposed interface{}) (*Entry, error) {
+	body, err := json.Marshal(proposed)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL+"/api/v1/log/entries", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", config.UserAgent)
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("transparency log: %w", err)
+	}
+	defer resp.Body.Close()
+	blob, err := io.ReadAll(io.LimitReader(resp.Body, maxResponse))
+	if err != nil {
+		return nil, fmt.Errorf("transparency log: %w", err)
+	}
+	if resp.StatusCode != http.StatusCreated {
+		msg := strings.TrimSpace(string(blob))
+		if len(msg) > 200 {
+			msg = msg[:200]
+		}
+		return nil, fmt.Errorf("transparency log: HTTP error from %s: %s: %s", req.URL, resp.Status, msg)
+	}
+	// the response is an object with the entry UUID as its only key
+	var entries map[string]logEntry
+	if err := json.Unmarshal(blob, &entries); err != nil {
+		return nil, fmt.Errorf("transparency log: parsing response: %w", err)
+	}
+	for uuid, e := range entries {
+		body, err := base64.StdEncoding.DecodeString(e.Body)
+		if err != nil {
+			return nil, fmt.Errorf("transparency log: parsing response: %w", err)
+		}
+		var kind struct {
+			Kind string `json:"kind"`
+		}
+		if err := json.Unmarshal(body, &kind); err != nil {
+			return nil, fmt.Errorf("transparency log: parsing entry body: %w", err)
+		}
+		return &Entry{
+			UUID:                 uuid,
+			LogIndex:             e.LogIndex,
+			IntegratedTime:       time.Unix(e.IntegratedTime, 0).UTC(),
+			LogID:                e.LogID,
+			SignedEntryTimestamp: e.Verification.SignedEntryTimestamp,
+			Kind:                 kind.Kind,
+			Body:                 body,
+			InclusionProof:       e.Verification.InclusionProof,
+		}, nil
+	}
+	return nil, errors.New("transparency log: response did not include an entry")
+}
@@ -0,0 +1,268 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package rekor
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sassoftware/relic/v7/internal/testcert"
+	"github.com/sassoftware/relic/v7/lib/intoto"
+)
+
+// fakeLog records each proposed entry as-is among some filler leaves, and
+// answers with a signed entry timestamp and an inclusion proof
+type fakeLog struct {
+	key    *ecdsa.PrivateKey
+	leaves [][]byte
+}
+
+func (l *fakeLog) sign(msg []byte) []byte {
+	d := sha256.Sum256(msg)
+	sig, err := l.key.Sign(rand.Reader, d[:], crypto.SHA256)
+	if err != nil {
+		panic(err)
+	}
+	return sig
+}
+
+// canonicalize converts a proposed entry to what Rekor records, which for
+// DSSE-based kinds keeps only hashes of the envelope and payload
+func canonicalize(proposed []byte) []byte {
+	var kind struct {
+		Kind string `json:"kind"`
+	}
+	_ = json.Unmarshal(proposed, &kind)
+	sum := func(b []byte) hashValue {
+		d := sha256.Sum256(b)
+		return hashValue{Algorithm: "sha256", Value: hex.EncodeToString(d[:])}
+	}
+	var body interface{}
+	switch kind.Kind {
+	case KindDSSE:
+		var p dsseProposal
+		_ = json.Unmarshal(proposed, &p)
+		var env struct {
+			Payload    []byte `json:"payload"`
+			Signatures []struct {
+				Sig []byte `json:"sig"`
+			} `json:"signatures"`
+		}
+		_ = json.Unmarshal([]byte(p.Spec.ProposedContent.Envelope), &env)
+		body = map[string]interface{}{
+			"apiVersion": p.APIVersion,
+			"kind":       p.Kind,
+			"spec": map[string]interface{}{
+				"envelopeHash": sum([]byte(p.Spec.ProposedContent.Envelope)),
+				"payloadHash":  sum(env.Payload),
+				"signatures": []map[string]interface{}{{
+					"signature": base64.StdEncoding.EncodeToString(env.Signatures[0].Sig),
+					"verifier":  p.Spec.ProposedContent.Verifiers[0],
+				}},
+			},
+		}
+	case KindIntoto:
+		var p intotoProposal
+		_ = json.Unmarshal(proposed, &p)
+		payload, _ := base64.StdEncoding.DecodeString(string(p.Spec.Content.Envelope.Payload))
+		body = map[string]interface{}{
+			"apiVersion": p.APIVersion,
+			"kind":       p.Kind,
+			"spec": map[string]interface{}{
+				"content": map[string]interface{}{
+					"envelope": map[string]interface{}{
+						"payloadType": p.Spec.Content.Envelope.PayloadType,
+						"signatures":  p.Spec.Content.Envelope.Signatures,
+					},
+					"payloadHash": sum(payload),
+				},
+			},
+		}
+	default:
+		return proposed
+	}
+	blob, _ := json.Marshal(body)
+	return blob
+}
+
+func (l *fakeLog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	proposed, _ := io.ReadAll(r.Body)
+	body := canonicalize(proposed)
+	l.leaves = append(l.leaves, leafHash([]byte("filler 1")), leafHash([]byte("filler 2")))
+	index := int64(len(l.leaves))
+	l.leaves = append(l.leaves, leafHash(body), leafHash([]byte("filler 3")), leafHash([]byte("filler 4")))
+	size := int64(len(l.leaves))
+	root := treeHash(l.leaves)
+	var hashes []string
+	for _, h := range auditPath(index, l.leaves) {
+		hashes = append(hashes, hex.EncodeToString(h))
+	}
+	entry := Entry{Body: body, IntegratedTime: time.Now(), LogID: "abcd", LogIndex: index}
+	set, _ := json.Marshal(struct {
+		Body           string `json:"body"`
+		IntegratedTime int64  `json:"integratedTime"`
+		LogID          string `json:"logID"`
+		LogIndex       int64  `json:"logIndex"`
+	}{base64.StdEncoding.EncodeToString(body), entry.IntegratedTime.Unix(), entry.LogID, index})
+	note := fmt.Sprintf("fake.example.com - 1\n%d\n%s\n", size, base64.StdEncoding.EncodeToString(root))
+	noteSig := append([]byte{1, 2, 3, 4}, l.sign([]byte(note))...)
+	resp := map[string]interface{}{
+		hex.EncodeToString(leafHash(body)): map[string]interface{}{
+			"body":           base64.StdEncoding.EncodeToString(body),
+			"integratedTime": entry.IntegratedTime.Unix(),
+			"logID":          entry.LogID,
+			"logIndex":       index,
+			"verification": map[string]interface{}{
+				"signedEntryTimestamp": base64.StdEncoding.EncodeToString(l.sign(set)),
+				"inclusionProof": InclusionProof{
+					LogIndex:   index,
+					RootHash:   hex.EncodeToString(root),
+					TreeSize:   size,
+					Hashes:     hashes,
+					Checkpoint: note + "\n— fake.example.com " + base64.StdEncoding.EncodeToString(noteSig) + "\n",
+				},
+			},
+		},
+	}
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// treeHash and auditPath implement RFC 6962 section 2.1
+func treeHash(leaves [][]byte) []byte {
+	if len(leaves) == 1 {
+		return leaves[0]
+	}
+	k := splitPoint(len(leaves))
+	return nodeHash(treeHash(leaves[:k]), treeHash(leaves[k:]))
+}
+
+func auditPath(m int64, leaves [][]byte) [][]byte {
+	if len(leaves) == 1 {
+		return nil
+	}
+	k := int64(splitPoint(len(leaves)))
+	if m < k {
+		return append(auditPath(m, leaves[:k]), treeHash(leaves[k:]))
+	}
+	return append(auditPath(m-k, leaves[k:]), treeHash(leaves[:k]))
+}
+
+func splitPoint(n int) int {
+	k := 1
+	for k*2 < n {
+		k *= 2
+	}
+	return k
+}
+
+func TestInclusionProof(t *testing.T) {
+	var leaves [][]byte
+	for n := 1; n <= 9; n++ {
+		leaves = append(leaves, leafHash([]byte{byte(n)}))
+		root := treeHash(leaves)
+		for m := 0; m < n; m++ {
+			computed, err := rootFromInclusionProof(int64(m), int64(n), leaves[m], auditPath(int64(m), leaves))
+			require.NoError(t, err)
+			assert.Equal(t, root, computed, "leaf %d of %d", m, n)
+		}
+	}
+	_, err := rootFromInclusionProof(3, 3, leaves[0], nil)
+	assert.Error(t, err)
+}
+
+func TestUploadAndVerify(t *testing.T) {
+	logKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	srv := httptest.NewServer(&fakeLog{key: logKey})
+	defer srv.Close()
+	client := New(srv.URL)
+	ctx := context.Background()
+
+	key := testcert.ECDSAKey(t)
+	cert := testcert.SelfSigned(t, "signer", key)
+	artifact := "hello world"
+	digest := sha256.Sum256([]byte(artifact))
+	stmt, err := intoto.NewStatement("hello.txt", digest[:], "https://example.com/predicate", nil)
+	require.NoError(t, err)
+	stmtJSON, err := json.Marshal(stmt)
+	require.NoError(t, err)
+
+	var entries []*Entry
+	entry, err := client.SignAndUpload(ctx, key, cert, strings.NewReader(artifact))
+	require.NoError(t, err)
+	entries = append(entries, entry)
+	for _, kind := range []string{KindDSSE, KindIntoto} {
+		entry, err := client.SignAndUploadDSSE(ctx, kind, key, cert, stmtJSON)
+		require.NoError(t, err)
+		entries = append(entries, entry)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	wrongDigest := sha256.Sum256([]byte("something else"))
+	for i, kind := range []string{KindHashedRekord, KindDSSE, KindIntoto} {
+		// round trip through the saved form
+		blob, err := json.Marshal(entries[i])
+		require.NoError(t, err)
+		entry := new(Entry)
+		require.NoError(t, json.Unmarshal(blob, entry))
+		assert.Equal(t, kind, entry.Kind)
+
+		v, err := entry.Verify(digest[:], logKey.Public())
+		require.NoError(t, err, kind)
+		assert.True(t, v.Included)
+		assert.Equal(t, cert.Raw, v.Certificate.Raw)
+		_, err = entry.Verify(wrongDigest[:], logKey.Public())
+		assert.Error(t, err, kind)
+		_, err = entry.Verify(digest[:], otherKey.Public())
+		assert.Error(t, err, kind)
+
+		// a proof that doesn't verify is an error even though the signed
+		// entry timestamp is still good
+		proof := *entry.InclusionProof
+		entry.InclusionProof.RootHash = strings.Repeat("00", sha256.Size)
+		_, err = entry.Verify(digest[:], logKey.Public())
+		assert.ErrorContains(t, err, "inclusion proof", kind)
+		entry.InclusionProof = &proof
+
+		// fall back to the signed entry timestamp
+		entry.InclusionProof = nil
+		v, err = entry.Verify(digest[:], logKey.Public())
+		require.NoError(t, err, kind)
+		assert.False(t, v.Included)
+		entry.LogIndex++
+		_, err = entry.Verify(digest[:], logKey.Public())
+		assert.Error(t, err, kind)
+	}
+}
@@ -0,0 +1,353 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package rekor
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sassoftware/relic/v7/lib/intoto"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+)
+
+// Verified is the result of checking a saved entry
+type Verified struct {
+	// Certificate or public key that signed the artifact
+	Certificate *x509.Certificate
+	PublicKey   crypto.PublicKey
+	// Included is true if the entry's inclusion in the log was proven,
+	// otherwise only the log's promise to include it was checked
+	Included bool
+}
+
+type entryBody struct {
+	Kind string `json:"kind"`
+	Spec struct {
+		// hashedrekord
+		Signature *struct {
+			Content   []byte `json:"content"`
+			PublicKey struct {
+				Content []byte `json:"content"`
+			} `json:"publicKey"`
+		} `json:"signature"`
+		Data *struct {
+			Hash struct {
+				Algorithm string `json:"algorithm"`
+				Value     string `json:"value"`
+			} `json:"hash"`
+		} `json:"data"`
+		// dsse
+		PayloadHash *hashValue `json:"payloadHash"`
+		Signatures  []struct {
+			Verifier []byte `json:"verifier"`
+		} `json:"signatures"`
+		// intoto
+		Content *struct {
+			PayloadHash *hashValue `json:"payloadHash"`
+			Envelope    struct {
+				Signatures []struct {
+					PublicKey []byte `json:"publicKey"`
+				} `json:"signatures"`
+			} `json:"envelope"`
+		} `json:"content"`
+	} `json:"spec"`
+}
+
+type hashValue struct {
+	Algorithm string `json:"algorithm"`
+	Value     string `json:"value"`
+}
+
+// Verify a saved entry without contacting the log. The entry must record a
+// signature over an artifact with the given SHA-256 digest, either directly or
+// as the subject of an in-toto statement. If the entry has an inclusion proof
+// then it and its signed checkpoint must verify with logKey, otherwise the
+// log's signed entry timestamp must.
+func (e *Entry) Verify(digest []byte, logKey crypto.PublicKey) (*Verified, error) {
+	leaf := leafHash(e.Body)
+	if uuid := strings.ToLower(e.UUID); len(uuid) < 64 || uuid[len(uuid)-64:] != hex.EncodeToString(leaf) {
+		return nil, errors.New("transparency log entry UUID does not match its body")
+	}
+	v, err := e.checkBody(digest)
+	if err != nil {
+		return nil, err
+	}
+	if e.InclusionProof != nil && e.InclusionProof.Checkpoint != "" {
+		// a proof that is present but wrong means the entry was altered, so
+		// don't settle for the log's promise instead
+		if err := e.InclusionProof.verify(leaf, logKey); err != nil {
+			return nil, err
+		}
+		v.Included = true
+		return v, nil
+	}
+	if e.SignedEntryTimestamp != "" {
+		if err := e.verifySET(logKey); err != nil {
+			return nil, err
+		}
+		return v, nil
+	}
+	return nil, errors.New("transparency log entry has neither an inclusion proof nor a signed entry timestamp")
+}
+
+// checkBody verifies that the entry records a valid signature over the artifact
+func (e *Entry) checkBody(digest []byte) (*Verified, error) {
+	var body entryBody
+	if err := json.Unmarshal(e.Body, &body); err != nil {
+		return nil, fmt.Errorf("parsing transparency log entry: %w", err)
+	}
+	switch body.Kind {
+	case KindHashedRekord:
+		if body.Spec.Signature == nil || body.Spec.Data == nil {
+			return nil, errors.New("malformed hashedrekord entry")
+		}
+		if body.Spec.Data.Hash.Algorithm != "sha256" || body.Spec.Data.Hash.Value != hex.EncodeToString(digest) {
+			return nil, errors.New("transparency log entry is for a different artifact")
+		}
+		v, err := parseVerifier(body.Spec.Signature.PublicKey.Content)
+		if err != nil {
+			return nil, err
+		}
+		if err := x509tools.Verify(v.PublicKey, crypto.SHA256, digest, body.Spec.Signature.Content); err != nil {
+			return nil, fmt.Errorf("transparency log entry signature: %w", err)
+		}
+		return v, nil
+	case KindDSSE, KindIntoto:
+		payloadHash := body.Spec.PayloadHash
+		var verifiers [][]byte
+		for _, sig := range body.Spec.Signatures {
+			verifiers = append(verifiers, sig.Verifier)
+		}
+		if body.Spec.Content != nil {
+			payloadHash = body.Spec.Content.PayloadHash
+			for _, sig := range body.Spec.Content.Envelope.Signatures {
+				verifiers = append(verifiers, sig.PublicKey)
+			}
+		}
+		if e.Envelope == nil {
+			return nil, fmt.Errorf("%s entry was saved without its envelope", body.Kind)
+		}
+		d := sha256.Sum256(e.Envelope.Payload)
+		if payloadHash == nil || payloadHash.Algorithm != "sha256" || payloadHash.Value != hex.EncodeToString(d[:]) {
+			return nil, errors.New("transparency log entry does not match the saved envelope")
+		}
+		if e.Envelope.PayloadType != intoto.PayloadType {
+			return nil, fmt.Errorf("unexpected payload type %q", e.Envelope.PayloadType)
+		}
+		stmt, err := intoto.Parse(e.Envelope.Payload)
+		if err != nil {
+			return nil, err
+		}
+		if err := stmt.CheckSubject("", digest); err != nil {
+			return nil, err
+		}
+		for _, blob := range verifiers {
+			v, err := parseVerifier(blob)
+			if err != nil {
+				return nil, err
+			}
+			if err := e.Envelope.Verify(v.PublicKey, crypto.SHA256); err == nil {
+				return v, nil
+			}
+		}
+		return nil, errors.New("transparency log entry envelope signature did not verify")
+	default:
+		return nil, fmt.Errorf("unsupported transparency log entry kind %q", body.Kind)
+	}
+}
+
+// parseVerifier parses a PEM certificate or public key
+func parseVerifier(blob []byte) (*Verified, error) {
+	block, _ := pem.Decode(blob)
+	if block == nil {
+		return nil, errors.New("transparency log entry has no public key")
+	}
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return &Verified{Certificate: cert, PublicKey: cert.PublicKey}, nil
+	case "PUBLIC KEY":
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return &Verified{PublicKey: pub}, nil
+	default:
+		return nil, fmt.Errorf("unexpected PEM type %q in transparency log entry", block.Type)
+	}
+}
+
+// verifySET checks the log's signature over the entry's metadata
+func (e *Entry) verifySET(logKey crypto.PublicKey) error {
+	sig, err := base64.StdEncoding.DecodeString(e.SignedEntryTimestamp)
+	if err != nil {
+		return fmt.Errorf("parsing signed entry timestamp: %w", err)
+	}
+	// fields are in sorted order, which makes this the canonical encoding
+	payload, err := json.Marshal(struct {
+		Body           string `json:"body"`
+		IntegratedTime int64  `json:"integratedTime"`
+		LogID          string `json:"logID"`
+		LogIndex       int64  `json:"logIndex"`
+	}{
+		Body:           base64.StdEncoding.EncodeToString(e.Body),
+		IntegratedTime: e.IntegratedTime.Unix(),
+		LogID:          e.LogID,
+		LogIndex:       e.LogIndex,
+	})
+	if err != nil {
+		return err
+	}
+	if err := verifyLogSignature(logKey, payload, sig); err != nil {
+		return fmt.Errorf("signed entry timestamp: %w", err)
+	}
+	return nil
+}
+
+func verifyLogSignature(pub crypto.PublicKey, msg, sig []byte) error {
+	if key, ok := pub.(ed25519.PublicKey); ok {
+		if !ed25519.Verify(key, msg, sig) {
+			return errors.New("ED25519 verification failed")
+		}
+		return nil
+	}
+	d := sha256.Sum256(msg)
+	return x509tools.Verify(pub, crypto.SHA256, d[:], sig)
+}
+
+func leafHash(body []byte) []byte {
+	d := sha256.New()
+	d.Write([]byte{0})
+	d.Write(body)
+	return d.Sum(nil)
+}
+
+func nodeHash(left, right []byte) []byte {
+	d := sha256.New()
+	d.Write([]byte{1})
+	d.Write(left)
+	d.Write(right)
+	return d.Sum(nil)
+}
+
+// rootFromInclusionProof computes the tree root implied by an inclusion
+// proof, as described in RFC 9162 section 2.1.3.2
+func rootFromInclusionProof(index, size int64, leaf []byte, proof [][]byte) ([]byte, error) {
+	if index < 0 || index >= size {
+		return nil, errors.New("inclusion proof index is outside the tree")
+	}
+	fn, sn := index, size-1
+	r := leaf
+	for _, p := range proof {
+		if sn == 0 {
+			return nil, errors.New("inclusion proof is too long")
+		}
+		if fn&1 == 1 || fn == sn {
+			r = nodeHash(p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = nodeHash(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 {
+		return nil, errors.New("inclusion proof is too short")
+	}
+	return r, nil
+}
+
+// verify that the leaf is included in the tree described by the proof's
+// checkpoint, and that the checkpoint was signed by the log
+func (p *InclusionProof) verify(leaf []byte, logKey crypto.PublicKey) error {
+	proof := make([][]byte, len(p.Hashes))
+	for i, h := range p.Hashes {
+		var err error
+		if proof[i], err = hex.DecodeString(h); err != nil {
+			return fmt.Errorf("parsing inclusion proof: %w", err)
+		}
+	}
+	root, err := rootFromInclusionProof(p.LogIndex, p.TreeSize, leaf, proof)
+	if err != nil {
+		return err
+	}
+	if hex.EncodeToString(root) != strings.ToLower(p.RootHash) {
+		return errors.New("inclusion proof does not match the tree root")
+	}
+	size, cpRoot, err := verifyCheckpoint(p.Checkpoint, logKey)
+	if err != nil {
+		return err
+	}
+	if size != p.TreeSize || !bytes.Equal(cpRoot, root) {
+		return errors.New("checkpoint does not match the inclusion proof")
+	}
+	return nil
+}
+
+// verifyCheckpoint checks a signed note holding the log's tree size and root
+// hash, returning them
+func verifyCheckpoint(note string, logKey crypto.PublicKey) (int64, []byte, error) {
+	i := strings.Index(note, "\n\n")
+	if i < 0 {
+		return 0, nil, errors.New("malformed checkpoint")
+	}
+	text, sigs := note[:i+1], note[i+2:]
+	lines := strings.Split(text, "\n")
+	if len(lines) < 4 {
+		return 0, nil, errors.New("malformed checkpoint")
+	}
+	size, err := strconv.ParseInt(lines[1], 10, 64)
+	if err != nil {
+		return 0, nil, fmt.Errorf("malformed checkpoint: %w", err)
+	}
+	root, err := base64.StdEncoding.DecodeString(lines[2])
+	if err != nil {
+		return 0, nil, fmt.Errorf("malformed checkpoint: %w", err)
+	}
+	for _, line := range strings.Split(sigs, "\n") {
+		if !strings.HasPrefix(line, "— ") {
+			continue
+		}
+		fields := strings.Fields(line)
+		sig, err := base64.StdEncoding.DecodeString(fields[len(fields)-1])
+		if err != nil || len(sig) < 5 {
+			continue
+		}
+		// the first 4 bytes identify the key
+		if verifyLogSignature(logKey, []byte(text), sig[4:]) == nil {
+			return size, root, nil
+		}
+	}
+	return 0, nil, errors.New("checkpoint is not signed by the transparency log key")
+}
@@ -0,0 +1,310 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package rpmpayload checks the payload of a RPM package against the digests
+// and sizes recorded in its headers. Modern rpm records the digest of the
+// compressed payload in PAYLOADDIGEST and of the uncompressed payload in
+// PAYLOADDIGESTALT, and packages over 4 GiB have 64-bit sizes in the
+// signature header. The package is read as a stream so that it never has to
+// fit in memory.
+package rpmpayload
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"crypto"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz/lzma"
+	"github.com/xi2/xz"
+)
+
+// Tags used from the signature header
+const (
+	SigTagLongSize        = 270
+	SigTagLongArchiveSize = 271
+	SigTagSize            = 1000
+	SigTagPayloadSize     = 1007
+)
+
+// Tags used from the general header
+const (
+	TagPayloadFormat     = 1124
+	TagPayloadCompressor = 1125
+	TagPayloadDigest     = 5092
+	TagPayloadDigestAlgo = 5093
+	TagPayloadDigestAlt  = 5097
+)
+
+const (
+	typeInt32       = 4
+	typeInt64       = 5
+	typeString      = 6
+	typeStringArray = 8
+
+	leadSize = 96
+	// refuse headers bigger than rpm itself would read
+	maxHeaderData = 256 << 20
+)
+
+var (
+	leadMagic   = []byte{0xed, 0xab, 0xee, 0xdb}
+	headerMagic = []byte{0x8e, 0xad, 0xe8, 0x01}
+)
+
+// OpenPGP hash algorithm IDs used by PAYLOADDIGESTALGO
+var digestAlgos = map[uint32]crypto.Hash{
+	1:  crypto.MD5,
+	2:  crypto.SHA1,
+	8:  crypto.SHA256,
+	9:  crypto.SHA384,
+	10: crypto.SHA512,
+	11: crypto.SHA224,
+}
+
+// Payload describes what was found while checking a package
+type Payload struct {
+	// Compressor is the compression of the payload, e.g. gzip, xz or zstd
+	Compressor string
+	// Hash is the digest algorithm of PAYLOADDIGEST and PAYLOADDIGESTALT, or
+	// 0 if the package has neither
+	Hash crypto.Hash
+	// Digest and DigestAlt are the hex digests of the compressed and the
+	// uncompressed payload. DigestAlt is only computed if the package has
+	// PAYLOADDIGESTALT.
+	Digest, DigestAlt string
+	// Size is the size of the general header plus the compressed payload,
+	// and ArchiveSize is the size of the uncompressed payload
+	Size, ArchiveSize int64
+}
+
+type header struct {
+	entries map[uint32]entry
+	data    []byte
+	raw     int64
+}
+
+type entry struct {
+	Tag, Type, Offset, Count uint32
+}
+
+// read a header structure, and if pad is set the padding that aligns the
+// next one
+func readHeader(r io.Reader, pad bool) (*header, error) {
+	var intro [16]byte
+	if _, err := io.ReadFull(r, intro[:]); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(intro[:4], headerMagic) {
+		return nil, errors.New("rpm: bad header magic")
+	}
+	nindex := binary.BigEndian.Uint32(intro[8:])
+	hsize := binary.BigEndian.Uint32(intro[12:])
+	if uint64(nindex)*16+uint64(hsize) > maxHeaderData {
+		return nil, errors.New("rpm: header is too big")
+	}
+	h := &header{
+		entries: make(map[uint32]entry, nindex),
+		raw:     16 + int64(nindex)*16 + int64(hsize),
+	}
+	index := make([]entry, nindex)
+	if err := binary.Read(r, binary.BigEndian, index); err != nil {
+		return nil, err
+	}
+	h.data = make([]byte, hsize)
+	if _, err := io.ReadFull(r, h.data); err != nil {
+		return nil, err
+	}
+	for _, e := range index {
+		if e.Offset >= hsize {
+			return nil, fmt.Errorf("rpm: tag %d is out of bounds", e.Tag)
+		}
+		h.entries[e.Tag] = e
+	}
+	if pad {
+		if n := h.raw % 8; n != 0 {
+			if _, err := io.ReadFull(r, make([]byte, 8-n)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return h, nil
+}
+
+// get the first value of a string or string array tag
+func (h *header) getString(tag uint32) (string, bool) {
+	e, ok := h.entries[tag]
+	if !ok || (e.Type != typeString && e.Type != typeStringArray) || e.Count == 0 {
+		return "", false
+	}
+	value := h.data[e.Offset:]
+	if i := bytes.IndexByte(value, 0); i >= 0 {
+		value = value[:i]
+	}
+	return string(value), true
+}
+
+// get the first value of an integer tag, or -1 if it is missing
+func (h *header) getInt(tag uint32) int64 {
+	e, ok := h.entries[tag]
+	if !ok || e.Count == 0 {
+		return -1
+	}
+	value := h.data[e.Offset:]
+	switch {
+	case e.Type == typeInt32 && len(value) >= 4:
+		return int64(binary.BigEndian.Uint32(value))
+	case e.Type == typeInt64 && len(value) >= 8:
+		return int64(binary.BigEndian.Uint64(value))
+	}
+	return -1
+}
+
+type countingWriter struct{ n int64 }
+
+func (w *countingWriter) Write(d []byte) (int, error) {
+	w.n += int64(len(d))
+	return len(d), nil
+}
+
+// Check reads a RPM package from r and checks its payload against the
+// digests and sizes recorded in the headers
+func Check(r io.Reader) (*Payload, error) {
+	lead := make([]byte, leadSize)
+	if _, err := io.ReadFull(r, lead); err != nil {
+		return nil, fmt.Errorf("rpm: reading lead: %w", err)
+	} else if !bytes.Equal(lead[:4], leadMagic) {
+		return nil, errors.New("rpm: not a RPM package")
+	}
+	sigHeader, err := readHeader(r, true)
+	if err != nil {
+		return nil, fmt.Errorf("rpm: reading signature header: %w", err)
+	}
+	genHeader, err := readHeader(r, false)
+	if err != nil {
+		return nil, fmt.Errorf("rpm: reading general header: %w", err)
+	}
+	p := &Payload{Compressor: "gzip"}
+	if c, ok := genHeader.getString(TagPayloadCompressor); ok {
+		p.Compressor = c
+	}
+	digest, hasDigest := genHeader.getString(TagPayloadDigest)
+	digestAlt, hasDigestAlt := genHeader.getString(TagPayloadDigestAlt)
+	var compressed, uncompressed hash.Hash
+	if hasDigest || hasDigestAlt {
+		algo := genHeader.getInt(TagPayloadDigestAlgo)
+		p.Hash = digestAlgos[uint32(algo)]
+		if p.Hash == 0 || !p.Hash.Available() {
+			return nil, fmt.Errorf("rpm: unsupported payload digest algorithm %d", algo)
+		}
+		compressed = p.Hash.New()
+		uncompressed = p.Hash.New()
+	}
+	// the uncompressed payload only has to be read if there is something to
+	// check it against
+	size := sigHeader.getInt(SigTagLongSize)
+	if size < 0 {
+		size = sigHeader.getInt(SigTagSize)
+	}
+	archiveSize := sigHeader.getInt(SigTagLongArchiveSize)
+	if archiveSize < 0 {
+		archiveSize = sigHeader.getInt(SigTagPayloadSize)
+	}
+	format, _ := genHeader.getString(TagPayloadFormat)
+	decompress := hasDigestAlt || archiveSize >= 0
+	if format != "" && format != "cpio" {
+		// not something rpm itself can unpack, so leave it alone
+		decompress = false
+	}
+	var counter countingWriter
+	sinks := []io.Writer{&counter}
+	if compressed != nil {
+		sinks = append(sinks, compressed)
+	}
+	payload := io.TeeReader(r, io.MultiWriter(sinks...))
+	if decompress {
+		zr, err := newDecompressor(p.Compressor, payload)
+		if err != nil {
+			return nil, err
+		}
+		var archive countingWriter
+		sinks := []io.Writer{&archive}
+		if uncompressed != nil {
+			sinks = append(sinks, uncompressed)
+		}
+		if _, err := io.Copy(io.MultiWriter(sinks...), zr); err != nil {
+			return nil, fmt.Errorf("rpm: decompressing %s payload: %w", p.Compressor, err)
+		}
+		if c, ok := zr.(io.Closer); ok {
+			c.Close()
+		}
+		p.ArchiveSize = archive.n
+	}
+	// anything after the compressed stream is still part of the payload
+	if _, err := io.Copy(io.Discard, payload); err != nil {
+		return nil, err
+	}
+	p.Size = genHeader.raw + counter.n
+	if compressed != nil {
+		p.Digest = hex.EncodeToString(compressed.Sum(nil))
+		if hasDigest && p.Digest != digest {
+			return nil, fmt.Errorf("rpm: payload %s digest mismatch", p.Hash)
+		}
+	}
+	if hasDigestAlt && decompress {
+		p.DigestAlt = hex.EncodeToString(uncompressed.Sum(nil))
+		if p.DigestAlt != digestAlt {
+			return nil, fmt.Errorf("rpm: uncompressed payload %s digest mismatch", p.Hash)
+		}
+	}
+	if size >= 0 && size != p.Size {
+		return nil, fmt.Errorf("rpm: package size is %d bytes but the signature header says %d", p.Size, size)
+	}
+	if decompress && archiveSize >= 0 && archiveSize != p.ArchiveSize {
+		return nil, fmt.Errorf("rpm: uncompressed payload is %d bytes but the signature header says %d", p.ArchiveSize, archiveSize)
+	}
+	return p, nil
+}
+
+func newDecompressor(compressor string, r io.Reader) (io.Reader, error) {
+	switch compressor {
+	case "gzip":
+		return gzip.NewReader(r)
+	case "bzip2":
+		return bzip2.NewReader(r), nil
+	case "xz":
+		return xz.NewReader(r, 0)
+	case "lzma":
+		return lzma.NewReader(r)
+	case "zstd":
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	case "identity", "uncompressed":
+		return r, nil
+	default:
+		return nil, fmt.Errorf("rpm: unsupported payload compressor %q", compressor)
+	}
+}
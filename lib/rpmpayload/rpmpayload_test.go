@@ -0,0 +1,205 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package rpmpayload
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ulikunitz/xz"
+)
+
+type testTag struct {
+	tag   uint32
+	value interface{}
+}
+
+// serialize a header structure with string, int32 and int64 tags
+func buildHeader(tags []testTag) []byte {
+	var index, data bytes.Buffer
+	for _, t := range tags {
+		var typ, align uint32
+		switch t.value.(type) {
+		case string:
+			typ, align = typeString, 1
+		case uint32:
+			typ, align = typeInt32, 4
+		case uint64:
+			typ, align = typeInt64, 8
+		}
+		for uint32(data.Len())%align != 0 {
+			data.WriteByte(0)
+		}
+		_ = binary.Write(&index, binary.BigEndian, entry{t.tag, typ, uint32(data.Len()), 1})
+		if s, ok := t.value.(string); ok {
+			data.WriteString(s)
+			data.WriteByte(0)
+		} else {
+			_ = binary.Write(&data, binary.BigEndian, t.value)
+		}
+	}
+	var b bytes.Buffer
+	b.Write(headerMagic)
+	b.Write(make([]byte, 4))
+	_ = binary.Write(&b, binary.BigEndian, uint32(len(tags)))
+	_ = binary.Write(&b, binary.BigEndian, uint32(data.Len()))
+	b.Write(index.Bytes())
+	b.Write(data.Bytes())
+	return b.Bytes()
+}
+
+func compress(t *testing.T, compressor string, archive []byte) []byte {
+	var b bytes.Buffer
+	switch compressor {
+	case "gzip":
+		w := gzip.NewWriter(&b)
+		_, _ = w.Write(archive)
+		require.NoError(t, w.Close())
+	case "xz":
+		w, err := xz.NewWriter(&b)
+		require.NoError(t, err)
+		_, _ = w.Write(archive)
+		require.NoError(t, w.Close())
+	case "zstd":
+		w, err := zstd.NewWriter(&b)
+		require.NoError(t, err)
+		_, _ = w.Write(archive)
+		require.NoError(t, w.Close())
+	default:
+		t.Fatalf("unknown compressor %s", compressor)
+	}
+	return b.Bytes()
+}
+
+func sha256hex(d []byte) string {
+	sum := sha256.Sum256(d)
+	return hex.EncodeToString(sum[:])
+}
+
+// assemble a package from a general header and payload, with the sizes in the
+// signature header
+func buildPackage(genTags []testTag, payload []byte, sigTags []testTag) []byte {
+	lead := make([]byte, leadSize)
+	copy(lead, leadMagic)
+	sig := buildHeader(sigTags)
+	for len(sig)%8 != 0 {
+		sig = append(sig, 0)
+	}
+	var b bytes.Buffer
+	b.Write(lead)
+	b.Write(sig)
+	b.Write(buildHeader(genTags))
+	b.Write(payload)
+	return b.Bytes()
+}
+
+func TestCheck(t *testing.T) {
+	archive := bytes.Repeat([]byte("070701 cpio archive contents "), 1000)
+	for _, compressor := range []string{"gzip", "xz", "zstd"} {
+		t.Run(compressor, func(t *testing.T) {
+			payload := compress(t, compressor, archive)
+			genTags := []testTag{
+				{TagPayloadFormat, "cpio"},
+				{TagPayloadCompressor, compressor},
+				{TagPayloadDigest, sha256hex(payload)},
+				{TagPayloadDigestAlgo, uint32(8)},
+				{TagPayloadDigestAlt, sha256hex(archive)},
+			}
+			size := uint64(len(buildHeader(genTags)) + len(payload))
+			sigTags := []testTag{
+				{SigTagLongSize, size},
+				{SigTagLongArchiveSize, uint64(len(archive))},
+			}
+			p, err := Check(bytes.NewReader(buildPackage(genTags, payload, sigTags)))
+			require.NoError(t, err)
+			assert.Equal(t, compressor, p.Compressor)
+			assert.Equal(t, crypto.SHA256, p.Hash)
+			assert.Equal(t, sha256hex(payload), p.Digest)
+			assert.Equal(t, sha256hex(archive), p.DigestAlt)
+			assert.Equal(t, int64(size), p.Size)
+			assert.Equal(t, int64(len(archive)), p.ArchiveSize)
+
+			// damage the compressed payload but keep it decodable by
+			// replacing it with a different archive
+			other := compress(t, compressor, append([]byte("x"), archive...))
+			_, err = Check(bytes.NewReader(buildPackage(genTags, other, nil)))
+			assert.EqualError(t, err, "rpm: payload SHA-256 digest mismatch")
+		})
+	}
+}
+
+func TestCheckDigestAlt(t *testing.T) {
+	archive := []byte("070701 cpio archive contents")
+	payload := compress(t, "zstd", archive)
+	genTags := []testTag{
+		{TagPayloadCompressor, "zstd"},
+		{TagPayloadDigest, sha256hex(payload)},
+		{TagPayloadDigestAlgo, uint32(8)},
+		{TagPayloadDigestAlt, sha256hex([]byte("something else"))},
+	}
+	_, err := Check(bytes.NewReader(buildPackage(genTags, payload, nil)))
+	assert.EqualError(t, err, "rpm: uncompressed payload SHA-256 digest mismatch")
+}
+
+func TestCheckSizes(t *testing.T) {
+	archive := []byte("070701 cpio archive contents")
+	payload := compress(t, "gzip", archive)
+	genTags := []testTag{{TagPayloadCompressor, "gzip"}}
+	size := uint32(len(buildHeader(genTags)) + len(payload))
+	// 32-bit sizes from older packages
+	p, err := Check(bytes.NewReader(buildPackage(genTags, payload, []testTag{
+		{SigTagSize, size},
+		{SigTagPayloadSize, uint32(len(archive))},
+	})))
+	require.NoError(t, err)
+	assert.Equal(t, crypto.Hash(0), p.Hash)
+	assert.Equal(t, int64(len(archive)), p.ArchiveSize)
+
+	_, err = Check(bytes.NewReader(buildPackage(genTags, payload, []testTag{{SigTagLongSize, uint64(size) + 1<<32}})))
+	assert.EqualError(t, err, fmt.Sprintf("rpm: package size is %d bytes but the signature header says %d", size, uint64(size)+1<<32))
+	_, err = Check(bytes.NewReader(buildPackage(genTags, payload, []testTag{{SigTagPayloadSize, uint32(1)}})))
+	assert.EqualError(t, err, fmt.Sprintf("rpm: uncompressed payload is %d bytes but the signature header says 1", len(archive)))
+}
+
+func TestCheckUnsupported(t *testing.T) {
+	genTags := []testTag{
+		{TagPayloadCompressor, "lzip"},
+		{TagPayloadDigestAlt, sha256hex(nil)},
+		{TagPayloadDigestAlgo, uint32(8)},
+	}
+	_, err := Check(bytes.NewReader(buildPackage(genTags, nil, nil)))
+	assert.EqualError(t, err, `rpm: unsupported payload compressor "lzip"`)
+
+	genTags = []testTag{
+		{TagPayloadDigest, sha256hex(nil)},
+		{TagPayloadDigestAlgo, uint32(99)},
+	}
+	_, err = Check(bytes.NewReader(buildPackage(genTags, nil, nil)))
+	assert.EqualError(t, err, "rpm: unsupported payload digest algorithm 99")
+
+	_, err = Check(bytes.NewReader(make([]byte, leadSize)))
+	assert.EqualError(t, err, "rpm: not a RPM package")
+}
@@ -0,0 +1,254 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package rpmsig
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Header data types
+const (
+	TypeNull        = 0
+	TypeChar        = 1
+	TypeInt8        = 2
+	TypeInt16       = 3
+	TypeInt32       = 4
+	TypeInt64       = 5
+	TypeString      = 6
+	TypeBin         = 7
+	TypeStringArray = 8
+	TypeI18NString  = 9
+)
+
+const (
+	leadSize = 96
+	// region tags mark the immutable part of a header and are regenerated
+	// when it is written
+	tagHeaderSignatures = 62
+	tagHeaderRegions    = 64
+	// refuse headers bigger than rpm itself would read
+	maxHeaderData = 256 << 20
+)
+
+var (
+	leadMagic   = []byte{0xed, 0xab, 0xee, 0xdb}
+	headerMagic = []byte{0x8e, 0xad, 0xe8, 0x01}
+)
+
+var typeSizes = map[uint32]int{
+	TypeChar:  1,
+	TypeInt8:  1,
+	TypeInt16: 2,
+	TypeInt32: 4,
+	TypeInt64: 8,
+	TypeBin:   1,
+}
+
+// Entry is the value of one tag in a header
+type Entry struct {
+	Type  uint32
+	Count uint32
+	Data  []byte
+}
+
+// Header is a parsed RPM header structure
+type Header struct {
+	Entries map[uint32]Entry
+	// Raw is the header as it was read, not including the padding after a
+	// signature header
+	Raw []byte
+}
+
+type indexEntry struct {
+	Tag, Type, Offset, Count uint32
+}
+
+// ReadHeader reads a header structure from r. If pad is set then the padding
+// that aligns the header after it is also consumed.
+func ReadHeader(r io.Reader, pad bool) (*Header, error) {
+	intro := make([]byte, 16)
+	if _, err := io.ReadFull(r, intro); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(intro[:4], headerMagic) {
+		return nil, errors.New("rpm: bad header magic")
+	}
+	nindex := binary.BigEndian.Uint32(intro[8:])
+	hsize := binary.BigEndian.Uint32(intro[12:])
+	if uint64(nindex)*16+uint64(hsize) > maxHeaderData {
+		return nil, errors.New("rpm: header is too big")
+	}
+	raw := make([]byte, 16+int(nindex)*16+int(hsize))
+	copy(raw, intro)
+	if _, err := io.ReadFull(r, raw[16:]); err != nil {
+		return nil, err
+	}
+	if pad {
+		if n := len(raw) % 8; n != 0 {
+			if _, err := io.ReadFull(r, make([]byte, 8-n)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	index := make([]indexEntry, nindex)
+	if err := binary.Read(bytes.NewReader(raw[16:]), binary.BigEndian, index); err != nil {
+		return nil, err
+	}
+	data := raw[16+int(nindex)*16:]
+	h := &Header{Entries: make(map[uint32]Entry, nindex), Raw: raw}
+	for _, e := range index {
+		if e.Offset > hsize {
+			return nil, fmt.Errorf("rpm: tag %d is out of bounds", e.Tag)
+		}
+		value := data[e.Offset:]
+		size, err := entrySize(e.Type, e.Count, value)
+		if err != nil {
+			return nil, fmt.Errorf("rpm: tag %d: %w", e.Tag, err)
+		}
+		h.Entries[e.Tag] = Entry{Type: e.Type, Count: e.Count, Data: value[:size]}
+	}
+	return h, nil
+}
+
+// work out how many bytes of data a tag has
+func entrySize(typ, count uint32, value []byte) (int, error) {
+	switch typ {
+	case TypeNull:
+		return 0, nil
+	case TypeString, TypeStringArray, TypeI18NString:
+		size := 0
+		for i := uint32(0); i < count; i++ {
+			n := bytes.IndexByte(value[size:], 0)
+			if n < 0 {
+				return 0, errors.New("unterminated string")
+			}
+			size += n + 1
+		}
+		return size, nil
+	}
+	elem, ok := typeSizes[typ]
+	if !ok {
+		return 0, fmt.Errorf("unknown data type %d", typ)
+	}
+	size := uint64(count) * uint64(elem)
+	if size > uint64(len(value)) {
+		return 0, errors.New("data is out of bounds")
+	}
+	return int(size), nil
+}
+
+// GetString returns the first value of a string or string array tag
+func (h *Header) GetString(tag uint32) (string, bool) {
+	e, ok := h.Entries[tag]
+	if !ok || e.Count == 0 {
+		return "", false
+	}
+	switch e.Type {
+	case TypeString, TypeStringArray, TypeI18NString:
+		return string(e.Data[:bytes.IndexByte(e.Data, 0)]), true
+	}
+	return "", false
+}
+
+// GetStrings returns all values of a string or string array tag
+func (h *Header) GetStrings(tag uint32) []string {
+	e, ok := h.Entries[tag]
+	if !ok || (e.Type != TypeString && e.Type != TypeStringArray && e.Type != TypeI18NString) {
+		return nil
+	}
+	values := make([]string, 0, e.Count)
+	for _, v := range bytes.SplitAfter(e.Data, []byte{0}) {
+		if len(v) != 0 {
+			values = append(values, string(v[:len(v)-1]))
+		}
+	}
+	return values
+}
+
+// GetInt returns the first value of an integer tag
+func (h *Header) GetInt(tag uint32) (int64, bool) {
+	e, ok := h.Entries[tag]
+	if !ok || e.Count == 0 {
+		return 0, false
+	}
+	switch e.Type {
+	case TypeInt32:
+		return int64(binary.BigEndian.Uint32(e.Data)), true
+	case TypeInt64:
+		return int64(binary.BigEndian.Uint64(e.Data)), true
+	}
+	return 0, false
+}
+
+// SetBin sets a tag to a binary value
+func (h *Header) SetBin(tag uint32, value []byte) {
+	h.Entries[tag] = Entry{Type: TypeBin, Count: uint32(len(value)), Data: value}
+}
+
+// SetStrings sets a tag to a string array
+func (h *Header) SetStrings(tag uint32, values []string) {
+	var b bytes.Buffer
+	for _, v := range values {
+		b.WriteString(v)
+		b.WriteByte(0)
+	}
+	h.Entries[tag] = Entry{Type: TypeStringArray, Count: uint32(len(values)), Data: b.Bytes()}
+}
+
+// Bytes serializes the header as a signature header, with a region covering
+// all tags and padding to align what follows
+func (h *Header) Bytes() []byte {
+	var tags []uint32
+	for tag := range h.Entries {
+		if tag >= tagHeaderRegions {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i] < tags[j] })
+	var index, data bytes.Buffer
+	for _, tag := range tags {
+		e := h.Entries[tag]
+		if align := typeSizes[e.Type]; align > 1 {
+			for data.Len()%align != 0 {
+				data.WriteByte(0)
+			}
+		}
+		_ = binary.Write(&index, binary.BigEndian, indexEntry{tag, e.Type, uint32(data.Len()), e.Count})
+		data.Write(e.Data)
+	}
+	// the region trailer is stored like an index entry, with an offset that
+	// points back to the first entry in the region
+	regionOffset := uint32(data.Len())
+	_ = binary.Write(&data, binary.BigEndian, indexEntry{tagHeaderSignatures, TypeBin, uint32(-16 * int32(len(tags)+1)), 16})
+	var b bytes.Buffer
+	b.Write(headerMagic)
+	b.Write(make([]byte, 4))
+	_ = binary.Write(&b, binary.BigEndian, uint32(len(tags)+1))
+	_ = binary.Write(&b, binary.BigEndian, uint32(data.Len()))
+	_ = binary.Write(&b, binary.BigEndian, indexEntry{tagHeaderSignatures, TypeBin, regionOffset, 16})
+	b.Write(index.Bytes())
+	b.Write(data.Bytes())
+	if n := b.Len() % 8; n != 0 {
+		b.Write(make([]byte, 8-n))
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,329 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package rpmsig signs RPM packages the way rpm 6 does, and in a form that
+// rpm builds using the Sequoia OpenPGP backend accept. Only the header is
+// signed, since it carries the payload digest, and the signature goes in the
+// OPENPGP tag of the signature header, optionally also in the tag that older
+// versions of rpm read.
+//
+// rpm 6 can also verify OpenPGP version 6 signatures, but those must be made
+// by version 6 keys, which can't be loaded yet. The signatures made here are
+// version 4 packets with the hashed subpackets that Sequoia expects.
+package rpmsig
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+
+	"github.com/sassoftware/relic/v7/lib/pgptools"
+	"github.com/sassoftware/relic/v7/signers/sigerrors"
+)
+
+// Tags used from the signature header
+const (
+	SigTagDSA           = 267
+	SigTagRSA           = 268
+	SigTagSHA1          = 269
+	SigTagSHA256        = 273
+	SigTagOpenPGP       = 278
+	SigTagPGP           = 1002
+	SigTagGPG           = 1005
+	SigTagReservedSpace = 1008
+)
+
+// every tag that holds a signature, as opposed to a digest
+var signatureTags = []uint32{SigTagDSA, SigTagRSA, SigTagOpenPGP, SigTagPGP, SigTagGPG}
+
+// Tags used from the general header
+const (
+	TagName    = 1000
+	TagVersion = 1001
+	TagRelease = 1002
+	TagEpoch   = 1003
+	TagArch    = 1022
+)
+
+// Options for signing a package
+type Options struct {
+	Hash         crypto.Hash
+	CreationTime time.Time
+	// Legacy also stores the signature in the header-only signature tag read
+	// by rpm 4, so that older versions of rpm can verify the package
+	Legacy bool
+}
+
+// Result of signing a package
+type Result struct {
+	// SignatureHeader is the lead and the new signature header. It replaces
+	// the first OriginalSize bytes of the package, and is the same size if
+	// the reserved space allows it.
+	SignatureHeader []byte
+	OriginalSize    int64
+	// NEVRA identifies the package
+	NEVRA string
+	// HeaderSHA256 is the hex digest of the general header
+	HeaderSHA256 string
+}
+
+// Signature is a signature found when verifying a package
+type Signature struct {
+	KeyID        uint64
+	CreationTime time.Time
+	Hash         crypto.Hash
+	// Signer is the entity that made the signature, or nil if it is not in
+	// the keyring
+	Signer *openpgp.Entity
+}
+
+// CheckPolicy checks that a key and digest are acceptable to the Sequoia
+// standard policy that rpm enforces
+func CheckPolicy(key *packet.PublicKey, hash crypto.Hash) error {
+	switch hash {
+	case crypto.SHA256, crypto.SHA384, crypto.SHA512:
+	default:
+		return fmt.Errorf("rpm signatures must use SHA-256 or better, not %s", hash)
+	}
+	switch key.PubKeyAlgo {
+	case packet.PubKeyAlgoRSA, packet.PubKeyAlgoRSASignOnly:
+		if bits, _ := key.BitLength(); bits < 2048 {
+			return fmt.Errorf("rpm signatures require a RSA key of at least 2048 bits, not %d", bits)
+		}
+	case packet.PubKeyAlgoECDSA:
+	default:
+		return fmt.Errorf("rpm signatures do not support public key algorithm %d", key.PubKeyAlgo)
+	}
+	return nil
+}
+
+type sigPackage struct {
+	lead      []byte
+	sigHeader *Header
+	genHeader *Header
+	// size of the lead and signature header, including padding
+	sigSize int64
+}
+
+// read the lead and headers, leaving r at the start of the payload
+func readPackage(r io.Reader) (*sigPackage, error) {
+	lead := make([]byte, leadSize)
+	if _, err := io.ReadFull(r, lead); err != nil {
+		return nil, fmt.Errorf("rpm: reading lead: %w", err)
+	} else if !bytes.Equal(lead[:4], leadMagic) {
+		return nil, errors.New("rpm: not a RPM package")
+	}
+	sigHeader, err := ReadHeader(r, true)
+	if err != nil {
+		return nil, fmt.Errorf("rpm: reading signature header: %w", err)
+	}
+	genHeader, err := ReadHeader(r, false)
+	if err != nil {
+		return nil, fmt.Errorf("rpm: reading general header: %w", err)
+	}
+	sigSize := int64(leadSize + len(sigHeader.Raw))
+	if n := len(sigHeader.Raw) % 8; n != 0 {
+		sigSize += int64(8 - n)
+	}
+	p := &sigPackage{lead: lead, sigHeader: sigHeader, genHeader: genHeader, sigSize: sigSize}
+	return p, p.checkHeaderDigest()
+}
+
+// check the general header against the digests in the signature header, so
+// that a damaged header is never signed
+func (p *sigPackage) checkHeaderDigest() error {
+	var expected string
+	var d []byte
+	if v, ok := p.sigHeader.GetString(SigTagSHA256); ok {
+		expected = v
+		sum := sha256.Sum256(p.genHeader.Raw)
+		d = sum[:]
+	} else if v, ok := p.sigHeader.GetString(SigTagSHA1); ok {
+		expected = v
+		sum := sha1.Sum(p.genHeader.Raw)
+		d = sum[:]
+	} else {
+		return nil
+	}
+	if !hmac.Equal([]byte(hex.EncodeToString(d)), []byte(strings.ToLower(expected))) {
+		return errors.New("rpm: header digest mismatch")
+	}
+	return nil
+}
+
+// nevra formats the name, epoch, version, release and architecture of a
+// package as name-[epoch:]version-release.arch
+func (p *sigPackage) nevra() string {
+	name, _ := p.genHeader.GetString(TagName)
+	version, _ := p.genHeader.GetString(TagVersion)
+	release, _ := p.genHeader.GetString(TagRelease)
+	arch, _ := p.genHeader.GetString(TagArch)
+	// lead type 1 is a source package
+	if p.lead[7] == 1 {
+		arch = "src"
+	}
+	if epoch, ok := p.genHeader.GetInt(TagEpoch); ok && epoch != 0 {
+		version = fmt.Sprintf("%d:%s", epoch, version)
+	}
+	return fmt.Sprintf("%s-%s-%s.%s", name, version, release, arch)
+}
+
+// Sign reads the lead and headers of a package from r and returns a new
+// signature header. Nothing after the general header is read, so the payload
+// is left in r.
+func Sign(r io.Reader, key *packet.PrivateKey, opts Options) (*Result, error) {
+	if err := CheckPolicy(&key.PublicKey, opts.Hash); err != nil {
+		return nil, err
+	}
+	p, err := readPackage(r)
+	if err != nil {
+		return nil, err
+	}
+	d := opts.Hash.New()
+	d.Write(p.genHeader.Raw)
+	sig, err := pgptools.DetachSignHash(d, key, opts.Hash, opts.CreationTime)
+	if err != nil {
+		return nil, err
+	}
+	// replace any previous signatures
+	sigh := p.sigHeader
+	for _, tag := range signatureTags {
+		delete(sigh.Entries, tag)
+	}
+	delete(sigh.Entries, SigTagReservedSpace)
+	sigh.SetStrings(SigTagOpenPGP, []string{base64.StdEncoding.EncodeToString(sig)})
+	if opts.Legacy {
+		if key.PubKeyAlgo == packet.PubKeyAlgoRSA || key.PubKeyAlgo == packet.PubKeyAlgoRSASignOnly {
+			sigh.SetBin(SigTagRSA, sig)
+		} else {
+			// rpm keeps signatures from all other algorithms in the DSA tag
+			sigh.SetBin(SigTagDSA, sig)
+		}
+	}
+	sum := sha256.Sum256(p.genHeader.Raw)
+	return &Result{
+		SignatureHeader: append(p.lead, fillReserved(sigh, p.sigSize-leadSize)...),
+		OriginalSize:    p.sigSize,
+		NEVRA:           p.nevra(),
+		HeaderSHA256:    hex.EncodeToString(sum[:]),
+	}, nil
+}
+
+// Unsign reads the lead and headers of a package from r and returns a new
+// signature header with every signature removed. The header and payload
+// digests are kept, and the space freed is reserved for signing again.
+func Unsign(r io.Reader) (*Result, error) {
+	p, err := readPackage(r)
+	if err != nil {
+		return nil, err
+	}
+	sigh := p.sigHeader
+	var found bool
+	for _, tag := range signatureTags {
+		if _, ok := sigh.Entries[tag]; ok {
+			delete(sigh.Entries, tag)
+			found = true
+		}
+	}
+	if !found {
+		return nil, sigerrors.NotSignedError{Type: "RPM"}
+	}
+	delete(sigh.Entries, SigTagReservedSpace)
+	sum := sha256.Sum256(p.genHeader.Raw)
+	return &Result{
+		SignatureHeader: append(p.lead, fillReserved(sigh, p.sigSize-leadSize)...),
+		OriginalSize:    p.sigSize,
+		NEVRA:           p.nevra(),
+		HeaderSHA256:    hex.EncodeToString(sum[:]),
+	}, nil
+}
+
+// serialize the signature header, adding reserved space so that it stays
+// the same size if possible
+func fillReserved(sigh *Header, available int64) []byte {
+	blob := sigh.Bytes()
+	// the reserved space tag adds an index entry, and its data may shift the
+	// alignment of tags after it
+	base := available - int64(len(blob)) - 16
+	for fill := base; fill >= 0 && fill > base-8; fill-- {
+		sigh.SetBin(SigTagReservedSpace, make([]byte, fill))
+		if b := sigh.Bytes(); int64(len(b)) == available {
+			return b
+		}
+	}
+	delete(sigh.Entries, SigTagReservedSpace)
+	return blob
+}
+
+// Verify reads the lead and headers of a package from r and checks the
+// signatures in its OPENPGP tag. Signatures from keys that are not in the
+// keyring are returned with no Signer.
+func Verify(r io.Reader, keyring openpgp.EntityList) ([]*Signature, error) {
+	p, err := readPackage(r)
+	if err != nil {
+		return nil, err
+	}
+	var sigs []*Signature
+	for _, encoded := range p.sigHeader.GetStrings(SigTagOpenPGP) {
+		raw, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("rpm: invalid OPENPGP tag: %w", err)
+		}
+		psig, err := pgptools.VerifyDetached(bytes.NewReader(raw), bytes.NewReader(p.genHeader.Raw), keyring)
+		var noKey pgptools.ErrNoKey
+		if errors.As(err, &noKey) {
+			sigs = append(sigs, &Signature{KeyID: uint64(noKey), CreationTime: creationTime(raw)})
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("rpm: bad signature: %w", err)
+		}
+		sigs = append(sigs, &Signature{
+			KeyID:        psig.Key.PublicKey.KeyId,
+			CreationTime: psig.CreationTime,
+			Hash:         psig.Hash,
+			Signer:       psig.Key.Entity,
+		})
+	}
+	return sigs, nil
+}
+
+// creationTime reads the creation time of a signature that can't be checked,
+// so that it can still be told apart from others by the same key
+func creationTime(raw []byte) time.Time {
+	pkt, err := packet.Read(bytes.NewReader(raw))
+	if err != nil {
+		return time.Time{}
+	}
+	switch sig := pkt.(type) {
+	case *packet.Signature:
+		return sig.CreationTime
+	case *packet.SignatureV3:
+		return sig.CreationTime
+	}
+	return time.Time{}
+}
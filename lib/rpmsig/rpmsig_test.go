@@ -0,0 +1,188 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package rpmsig_test
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+
+	"github.com/sassoftware/relic/v7/lib/pgptools"
+	"github.com/sassoftware/relic/v7/lib/rpmsig"
+)
+
+var payload = []byte("compressed payload")
+
+// build a package whose signature header has a digest of the general header
+// and room for signatures
+func testPackage(t *testing.T) ([]byte, []byte) {
+	gen := &rpmsig.Header{Entries: make(map[uint32]rpmsig.Entry)}
+	gen.SetStrings(rpmsig.TagName, []string{"hello"})
+	gen.SetStrings(rpmsig.TagVersion, []string{"1.0"})
+	gen.SetStrings(rpmsig.TagRelease, []string{"1"})
+	gen.SetStrings(rpmsig.TagArch, []string{"x86_64"})
+	// the general header isn't padded
+	parsed, err := rpmsig.ReadHeader(bytes.NewReader(gen.Bytes()), false)
+	require.NoError(t, err)
+	genBlob := parsed.Raw
+	sum := sha256.Sum256(genBlob)
+	sigh := &rpmsig.Header{Entries: make(map[uint32]rpmsig.Entry)}
+	sigh.SetStrings(rpmsig.SigTagSHA256, []string{hex.EncodeToString(sum[:])})
+	sigh.SetBin(rpmsig.SigTagReservedSpace, make([]byte, 4096))
+	lead := make([]byte, 96)
+	copy(lead, []byte{0xed, 0xab, 0xee, 0xdb})
+	var b bytes.Buffer
+	b.Write(lead)
+	b.Write(sigh.Bytes())
+	b.Write(genBlob)
+	b.Write(payload)
+	return b.Bytes(), genBlob
+}
+
+func sign(t *testing.T, pkg []byte, key *packet.PrivateKey, legacy bool) []byte {
+	r := bytes.NewReader(pkg)
+	result, err := rpmsig.Sign(r, key, rpmsig.Options{
+		Hash:         crypto.SHA256,
+		CreationTime: time.Now(),
+		Legacy:       legacy,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "hello-1.0-1.x86_64", result.NEVRA)
+	assert.Equal(t, int(result.OriginalSize), len(result.SignatureHeader), "signature header changed size")
+	rest := pkg[result.OriginalSize:]
+	return append(result.SignatureHeader, rest...)
+}
+
+func TestSign(t *testing.T) {
+	entity, err := openpgp.NewEntity("test", "", "test@example.com", &packet.Config{RSABits: 2048})
+	require.NoError(t, err)
+	pkg, genBlob := testPackage(t)
+	signed := sign(t, pkg, entity.PrivateKey, false)
+	assert.True(t, bytes.HasSuffix(signed, append(genBlob, payload...)))
+
+	h, err := rpmsig.ReadHeader(bytes.NewReader(signed[96:]), true)
+	require.NoError(t, err)
+	assert.NotContains(t, h.Entries, uint32(rpmsig.SigTagRSA))
+	encoded := h.GetStrings(rpmsig.SigTagOpenPGP)
+	require.Len(t, encoded, 1)
+	raw, err := base64.StdEncoding.DecodeString(encoded[0])
+	require.NoError(t, err)
+	pkt, err := packet.Read(bytes.NewReader(raw))
+	require.NoError(t, err)
+	sig := pkt.(*packet.Signature)
+	assert.Equal(t, crypto.SHA256, sig.Hash)
+	assert.Equal(t, entity.PrimaryKey.KeyId, *sig.IssuerKeyId)
+	// hashed issuer fingerprint subpacket
+	assert.Contains(t, string(sig.HashSuffix), string(append([]byte{22, 33, 4}, entity.PrimaryKey.Fingerprint[:]...)))
+
+	sigs, err := rpmsig.Verify(bytes.NewReader(signed), openpgp.EntityList{entity})
+	require.NoError(t, err)
+	require.Len(t, sigs, 1)
+	assert.Equal(t, entity, sigs[0].Signer)
+	assert.Equal(t, crypto.SHA256, sigs[0].Hash)
+	// unknown keys are reported without a signer
+	sigs, err = rpmsig.Verify(bytes.NewReader(signed), nil)
+	require.NoError(t, err)
+	require.Len(t, sigs, 1)
+	assert.Nil(t, sigs[0].Signer)
+	assert.Equal(t, entity.PrimaryKey.KeyId, sigs[0].KeyID)
+	assert.Equal(t, sig.CreationTime.Unix(), sigs[0].CreationTime.Unix())
+
+	// signing again replaces the signature
+	resigned := sign(t, signed, entity.PrivateKey, false)
+	h, err = rpmsig.ReadHeader(bytes.NewReader(resigned[96:]), true)
+	require.NoError(t, err)
+	assert.Len(t, h.GetStrings(rpmsig.SigTagOpenPGP), 1)
+}
+
+func TestSignLegacy(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	priv := packet.NewECDSAPrivateKey(time.Now(), ecKey)
+	entity := &openpgp.Entity{PrimaryKey: &priv.PublicKey, PrivateKey: priv}
+	pkg, genBlob := testPackage(t)
+	signed := sign(t, pkg, priv, true)
+
+	// old versions of rpm find the same signature in the DSA tag
+	h, err := rpmsig.ReadHeader(bytes.NewReader(signed[96:]), true)
+	require.NoError(t, err)
+	sig := h.Entries[rpmsig.SigTagDSA].Data
+	require.NotEmpty(t, sig)
+	assert.Equal(t, base64.StdEncoding.EncodeToString(sig), h.GetStrings(rpmsig.SigTagOpenPGP)[0])
+	psig, err := pgptools.VerifyDetached(bytes.NewReader(sig), bytes.NewReader(genBlob), openpgp.EntityList{entity})
+	require.NoError(t, err)
+	assert.Equal(t, crypto.SHA256, psig.Hash)
+}
+
+func TestSignDamaged(t *testing.T) {
+	entity, err := openpgp.NewEntity("test", "", "test@example.com", &packet.Config{RSABits: 2048})
+	require.NoError(t, err)
+	pkg, _ := testPackage(t)
+	damaged := bytes.Replace(pkg, []byte("hello"), []byte("jello"), 1)
+	_, err = rpmsig.Sign(bytes.NewReader(damaged), entity.PrivateKey, rpmsig.Options{Hash: crypto.SHA256})
+	assert.EqualError(t, err, "rpm: header digest mismatch")
+
+	// a header changed after signing fails verification
+	signed := sign(t, pkg, entity.PrivateKey, false)
+	signed = bytes.Replace(signed, []byte("hello"), []byte("jello"), 1)
+	_, err = rpmsig.Verify(bytes.NewReader(signed), openpgp.EntityList{entity})
+	assert.Error(t, err)
+}
+
+func TestPolicy(t *testing.T) {
+	entity, err := openpgp.NewEntity("test", "", "test@example.com", &packet.Config{RSABits: 1024})
+	require.NoError(t, err)
+	assert.EqualError(t, rpmsig.CheckPolicy(entity.PrimaryKey, crypto.SHA256), "rpm signatures require a RSA key of at least 2048 bits, not 1024")
+	pkg, _ := testPackage(t)
+	_, err = rpmsig.Sign(bytes.NewReader(pkg), entity.PrivateKey, rpmsig.Options{Hash: crypto.SHA1})
+	assert.EqualError(t, err, "rpm signatures must use SHA-256 or better, not SHA-1")
+}
+
+func TestUnsign(t *testing.T) {
+	entity, err := openpgp.NewEntity("test", "", "test@example.com", &packet.Config{RSABits: 2048})
+	require.NoError(t, err)
+	pkg, genBlob := testPackage(t)
+	_, err = rpmsig.Unsign(bytes.NewReader(pkg))
+	assert.EqualError(t, err, "RPM contains no signatures")
+
+	signed := sign(t, pkg, entity.PrivateKey, true)
+	result, err := rpmsig.Unsign(bytes.NewReader(signed))
+	require.NoError(t, err)
+	assert.Equal(t, int(result.OriginalSize), len(result.SignatureHeader), "signature header changed size")
+	unsigned := append(result.SignatureHeader, signed[result.OriginalSize:]...)
+	assert.True(t, bytes.HasSuffix(unsigned, append(genBlob, payload...)))
+	h, err := rpmsig.ReadHeader(bytes.NewReader(unsigned[96:]), true)
+	require.NoError(t, err)
+	assert.NotContains(t, h.Entries, uint32(rpmsig.SigTagOpenPGP))
+	assert.NotContains(t, h.Entries, uint32(rpmsig.SigTagRSA))
+	assert.Contains(t, h.Entries, uint32(rpmsig.SigTagSHA256))
+	sigs, err := rpmsig.Verify(bytes.NewReader(unsigned), nil)
+	require.NoError(t, err)
+	assert.Empty(t, sigs)
+}
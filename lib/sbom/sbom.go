@@ -0,0 +1,169 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package sbom wraps software bills of materials in in-toto attestations
+// about the artifacts they describe, and attaches the signed attestation to
+// the artifact: next to it as a file, inside it as a zip member, or in a
+// registry as an OCI referrer.
+package sbom
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sassoftware/relic/v7/lib/intoto"
+	"github.com/sassoftware/relic/v7/lib/oci"
+)
+
+// in-toto predicate types of SBOMs, as used by cosign and the in-toto
+// attestation framework
+const (
+	PredicateCycloneDX = "https://cyclonedx.org/bom"
+	PredicateSPDX      = "https://spdx.dev/Document"
+)
+
+const (
+	// SidecarSuffix is appended to the artifact name to get the name of a
+	// detached attestation
+	SidecarSuffix = ".sbom.intoto.jsonl"
+	// DefaultMember is the name of the attestation inside a zip archive
+	DefaultMember = "META-INF/sbom.intoto.jsonl"
+	// MediaTypeDSSE is the media type of a DSSE envelope pushed to a registry
+	MediaTypeDSSE = "application/vnd.dsse.envelope.v1+json"
+	// AnnotationPredicateType records the predicate type on a referrer
+	AnnotationPredicateType = "in-toto.io/predicate-type"
+)
+
+// PredicateType identifies a JSON CycloneDX or SPDX document
+func PredicateType(sbom []byte) (string, error) {
+	var doc struct {
+		BOMFormat   string `json:"bomFormat"`
+		SPDXVersion string `json:"spdxVersion"`
+	}
+	if err := json.Unmarshal(sbom, &doc); err != nil {
+		return "", fmt.Errorf("SBOM must be a CycloneDX or SPDX JSON document: %w", err)
+	}
+	switch {
+	case doc.BOMFormat == "CycloneDX":
+		return PredicateCycloneDX, nil
+	case strings.HasPrefix(doc.SPDXVersion, "SPDX-"):
+		return PredicateSPDX, nil
+	}
+	return "", errors.New("SBOM must be a CycloneDX or SPDX JSON document")
+}
+
+// Statement returns an in-toto statement with the SBOM as its predicate
+func Statement(sbom []byte, subjects []intoto.Subject) ([]byte, error) {
+	predicateType, err := PredicateType(sbom)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(intoto.Statement{
+		Type:          intoto.StatementType,
+		Subject:       subjects,
+		PredicateType: predicateType,
+		Predicate:     json.RawMessage(sbom),
+	})
+}
+
+// ZipSubjects returns a subject for each file in a zip archive, other than
+// the member named skip. The attestation can then be added to the archive
+// without changing what it is about.
+func ZipSubjects(r io.ReaderAt, size int64, skip string) ([]intoto.Subject, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	var subjects []intoto.Subject
+	for _, f := range zr.File {
+		if f.Name == skip || strings.HasSuffix(f.Name, "/") {
+			continue
+		}
+		fr, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		d := sha256.New()
+		_, err = io.Copy(d, fr)
+		fr.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		subjects = append(subjects, intoto.Subject{
+			Name:   f.Name,
+			Digest: map[string]string{"sha256": hex.EncodeToString(d.Sum(nil))},
+		})
+	}
+	if len(subjects) == 0 {
+		return nil, errors.New("zip archive has no files")
+	}
+	return subjects, nil
+}
+
+// AddZipMember copies a zip archive to w with a member added at the end,
+// replacing any existing member of the same name. The other members are
+// copied without recompressing them.
+func AddZipMember(w io.Writer, r io.ReaderAt, size int64, name string, contents []byte) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	zw := zip.NewWriter(w)
+	zw.SetComment(zr.Comment)
+	for _, f := range zr.File {
+		if f.Name == name {
+			continue
+		}
+		raw, err := f.OpenRaw()
+		if err != nil {
+			return err
+		}
+		fw, err := zw.CreateRaw(&f.FileHeader)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(fw, raw); err != nil {
+			return err
+		}
+	}
+	fw, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate})
+	if err != nil {
+		return err
+	}
+	if _, err := fw.Write(contents); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// AttachOCI pushes a signed attestation to a registry as a referrer of the
+// image manifest
+func AttachOCI(ctx context.Context, client *oci.Client, image oci.Reference, subject oci.Descriptor, envelope []byte, predicateType string) error {
+	// store the envelope itself, not a line of JSON
+	envelope = bytes.TrimSpace(envelope)
+	_, err := client.PushReferrer(ctx, image, subject, MediaTypeDSSE, MediaTypeDSSE, envelope, map[string]string{
+		AnnotationPredicateType: predicateType,
+	})
+	return err
+}
@@ -0,0 +1,116 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package sbom_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sassoftware/relic/v7/lib/intoto"
+	"github.com/sassoftware/relic/v7/lib/sbom"
+)
+
+const (
+	cycloneDX = `{"bomFormat":"CycloneDX","specVersion":"1.5","components":[]}`
+	spdx      = `{"spdxVersion":"SPDX-2.3","SPDXID":"SPDXRef-DOCUMENT","packages":[]}`
+)
+
+func TestPredicateType(t *testing.T) {
+	pt, err := sbom.PredicateType([]byte(cycloneDX))
+	require.NoError(t, err)
+	assert.Equal(t, sbom.PredicateCycloneDX, pt)
+	pt, err = sbom.PredicateType([]byte(spdx))
+	require.NoError(t, err)
+	assert.Equal(t, sbom.PredicateSPDX, pt)
+	_, err = sbom.PredicateType([]byte(`{"name":"something else"}`))
+	assert.EqualError(t, err, "SBOM must be a CycloneDX or SPDX JSON document")
+	_, err = sbom.PredicateType([]byte("SPDXVersion: SPDX-2.3"))
+	assert.Error(t, err)
+}
+
+func TestStatement(t *testing.T) {
+	subjects := []intoto.Subject{{Name: "app.jar", Digest: map[string]string{"sha256": "00"}}}
+	blob, err := sbom.Statement([]byte(cycloneDX), subjects)
+	require.NoError(t, err)
+	var stmt intoto.Statement
+	require.NoError(t, json.Unmarshal(blob, &stmt))
+	assert.Equal(t, intoto.StatementType, stmt.Type)
+	assert.Equal(t, sbom.PredicateCycloneDX, stmt.PredicateType)
+	assert.Equal(t, subjects, stmt.Subject)
+	assert.JSONEq(t, cycloneDX, string(stmt.Predicate))
+}
+
+func buildZip(t *testing.T, files map[string]string) []byte {
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	for _, name := range []string{"META-INF/", "META-INF/MANIFEST.MF", "classes.dex"} {
+		contents, ok := files[name]
+		if !ok {
+			continue
+		}
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(contents))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	return b.Bytes()
+}
+
+func TestZip(t *testing.T) {
+	blob := buildZip(t, map[string]string{
+		"META-INF/":            "",
+		"META-INF/MANIFEST.MF": "Manifest-Version: 1.0\r\n",
+		"classes.dex":          "dex\n035\x00",
+	})
+	subjects, err := sbom.ZipSubjects(bytes.NewReader(blob), int64(len(blob)), sbom.DefaultMember)
+	require.NoError(t, err)
+	require.Len(t, subjects, 2)
+	assert.Equal(t, "META-INF/MANIFEST.MF", subjects[0].Name)
+	assert.Equal(t, "classes.dex", subjects[1].Name)
+	assert.Len(t, subjects[1].Digest["sha256"], 64)
+
+	var out bytes.Buffer
+	require.NoError(t, sbom.AddZipMember(&out, bytes.NewReader(blob), int64(len(blob)), sbom.DefaultMember, []byte("first\n")))
+	// adding again replaces the attestation
+	once := out.Bytes()
+	out = bytes.Buffer{}
+	require.NoError(t, sbom.AddZipMember(&out, bytes.NewReader(once), int64(len(once)), sbom.DefaultMember, []byte("second\n")))
+	zr, err := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	require.NoError(t, err)
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	assert.Equal(t, []string{"META-INF/", "META-INF/MANIFEST.MF", "classes.dex", sbom.DefaultMember}, names)
+	r, err := zr.File[3].Open()
+	require.NoError(t, err)
+	contents, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "second\n", string(contents))
+
+	// the attestation doesn't change the subjects
+	after, err := sbom.ZipSubjects(bytes.NewReader(out.Bytes()), int64(out.Len()), sbom.DefaultMember)
+	require.NoError(t, err)
+	assert.Equal(t, subjects, after)
+}
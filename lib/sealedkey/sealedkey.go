@@ -0,0 +1,381 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package sealedkey stores private keys encrypted with AES-256-GCM under a key
+// derived from a passphrase with a memory-hard KDF (argon2id or scrypt).
+// Alternatively the encryption key can be split into Shamir shares, each
+// stored in its own file and optionally sealed with its custodian's
+// passphrase, so that a threshold of custodians must be present to use the
+// key.
+//
+// Both files are PEM, with the KDF and its parameters in the PEM headers. The
+// headers are authenticated along with the key, so they can't be altered to
+// weaken the KDF.
+package sealedkey
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+
+	"github.com/sassoftware/relic/v7/lib/shamir"
+)
+
+const (
+	PEMType      = "RELIC SEALED PRIVATE KEY"
+	SharePEMType = "RELIC SEALED KEY SHARE"
+
+	KDFArgon2id = "argon2id"
+	KDFScrypt   = "scrypt"
+	// the encryption key is split into shares rather than derived
+	KDFShamir = "shamir"
+	// a share that is stored without a passphrase
+	KDFNone = "none"
+
+	keySize  = 32
+	saltSize = 16
+)
+
+// default KDF parameters
+const (
+	argonTime    = 3
+	argonMemory  = 64 * 1024 // KiB
+	argonThreads = 4
+	scryptLogN   = 17
+	scryptR      = 8
+	scryptP      = 1
+)
+
+// ErrIncorrectPassphrase is returned when the key or share can't be decrypted
+var ErrIncorrectPassphrase = errors.New("incorrect passphrase")
+
+// IsSealed returns true if blob holds a sealed private key
+func IsSealed(blob []byte) bool {
+	return bytes.Contains(blob, []byte("-----BEGIN "+PEMType+"-----"))
+}
+
+// Seal encrypts a PKCS#8 private key under a passphrase. kdf is KDFArgon2id
+// or KDFScrypt, or empty for the default.
+func Seal(der []byte, passphrase, kdf string) ([]byte, error) {
+	if passphrase == "" {
+		return nil, errors.New("passphrase is required")
+	}
+	headers, key, err := newKDF(kdf, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return seal(PEMType, headers, key, der)
+}
+
+// SealShared encrypts a PKCS#8 private key under a random key, which is split
+// into n shares any threshold of which can unlock it. sharePassphrase is
+// called for each share and may return an empty string to leave that share
+// unencrypted. Returns the sealed key followed by the sealed shares.
+func SealShared(der []byte, n, threshold int, kdf string, sharePassphrase func(index int) (string, error)) ([]byte, [][]byte, error) {
+	key := make([]byte, keySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, nil, err
+	}
+	keyID := make([]byte, 8)
+	if _, err := io.ReadFull(rand.Reader, keyID); err != nil {
+		return nil, nil, err
+	}
+	headers := map[string]string{
+		"KDF":       KDFShamir,
+		"Key-ID":    hex.EncodeToString(keyID),
+		"Shares":    strconv.Itoa(n),
+		"Threshold": strconv.Itoa(threshold),
+	}
+	sealed, err := seal(PEMType, headers, key, der)
+	if err != nil {
+		return nil, nil, err
+	}
+	secrets, err := shamir.Split(key, n, threshold)
+	if err != nil {
+		return nil, nil, err
+	}
+	shares := make([][]byte, n)
+	for i, secret := range secrets {
+		passphrase, err := sharePassphrase(i + 1)
+		if err != nil {
+			return nil, nil, err
+		}
+		shareHeaders := map[string]string{"KDF": KDFNone}
+		var shareKey []byte
+		if passphrase != "" {
+			shareHeaders, shareKey, err = newKDF(kdf, passphrase)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		shareHeaders["Key-ID"] = headers["Key-ID"]
+		shareHeaders["Index"] = strconv.Itoa(i + 1)
+		shareHeaders["Threshold"] = headers["Threshold"]
+		if shareKey == nil {
+			shares[i] = pem.EncodeToMemory(&pem.Block{Type: SharePEMType, Headers: shareHeaders, Bytes: secret})
+		} else {
+			shares[i], err = seal(SharePEMType, shareHeaders, shareKey, secret)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	return sealed, shares, nil
+}
+
+// Share is a key share read from a file but not yet unlocked
+type Share struct {
+	Index     int
+	Encrypted bool
+	block     *pem.Block
+}
+
+// Info describes a sealed key
+type Info struct {
+	KDF       string
+	KeyID     string
+	Shares    int
+	Threshold int
+	block     *pem.Block
+}
+
+// Parse reads the headers of a sealed key
+func Parse(blob []byte) (*Info, error) {
+	block, err := decode(blob, PEMType)
+	if err != nil {
+		return nil, err
+	}
+	info := &Info{KDF: block.Headers["KDF"], KeyID: block.Headers["Key-ID"], block: block}
+	if info.KDF == KDFShamir {
+		info.Shares, _ = strconv.Atoi(block.Headers["Shares"])
+		info.Threshold, _ = strconv.Atoi(block.Headers["Threshold"])
+		if info.Threshold < 2 || info.Shares < info.Threshold {
+			return nil, errors.New("sealed key: invalid share count")
+		}
+	}
+	return info, nil
+}
+
+// Open decrypts a key sealed with a passphrase and returns the PKCS#8 private
+// key
+func (info *Info) Open(passphrase string) ([]byte, error) {
+	if info.KDF == KDFShamir {
+		return nil, errors.New("sealed key is protected by shares, not a passphrase")
+	}
+	key, err := deriveKey(info.block.Headers, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return open(info.block, key)
+}
+
+// ParseShare reads a key share and checks that it belongs to this key
+func (info *Info) ParseShare(blob []byte) (*Share, error) {
+	block, err := decode(blob, SharePEMType)
+	if err != nil {
+		return nil, err
+	}
+	if block.Headers["Key-ID"] != info.KeyID {
+		return nil, errors.New("key share belongs to a different key")
+	}
+	index, err := strconv.Atoi(block.Headers["Index"])
+	if err != nil || index < 1 || index > info.Shares {
+		return nil, errors.New("key share has an invalid index")
+	}
+	return &Share{
+		Index:     index,
+		Encrypted: block.Headers["KDF"] != KDFNone,
+		block:     block,
+	}, nil
+}
+
+// Unlock decrypts a share. passphrase is ignored for unencrypted shares.
+func (s *Share) Unlock(passphrase string) ([]byte, error) {
+	if !s.Encrypted {
+		return s.block.Bytes, nil
+	}
+	key, err := deriveKey(s.block.Headers, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return open(s.block, key)
+}
+
+// OpenShared combines unlocked shares and decrypts the key
+func (info *Info) OpenShared(secrets [][]byte) ([]byte, error) {
+	if info.KDF != KDFShamir {
+		return nil, errors.New("sealed key is not protected by shares")
+	}
+	if len(secrets) < info.Threshold {
+		return nil, fmt.Errorf("%d of %d key shares are required", info.Threshold, info.Shares)
+	}
+	key, err := shamir.Combine(secrets)
+	if err != nil {
+		return nil, err
+	}
+	der, err := open(info.block, key)
+	if err == ErrIncorrectPassphrase {
+		return nil, errors.New("key shares did not unlock the key")
+	}
+	return der, err
+}
+
+func decode(blob []byte, pemType string) (*pem.Block, error) {
+	for {
+		var block *pem.Block
+		block, blob = pem.Decode(blob)
+		if block == nil {
+			return nil, fmt.Errorf("no %s found", pemType)
+		} else if block.Type == pemType {
+			return block, nil
+		}
+	}
+}
+
+// newKDF picks a random salt and derives a key from the passphrase, returning
+// the headers needed to derive it again
+func newKDF(kdf, passphrase string) (map[string]string, []byte, error) {
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, nil, err
+	}
+	headers := map[string]string{"Salt": base64.StdEncoding.EncodeToString(salt)}
+	switch kdf {
+	case "", KDFArgon2id:
+		headers["KDF"] = KDFArgon2id
+		headers["KDF-Params"] = fmt.Sprintf("t=%d,m=%d,p=%d", argonTime, argonMemory, argonThreads)
+	case KDFScrypt:
+		headers["KDF"] = KDFScrypt
+		headers["KDF-Params"] = fmt.Sprintf("logN=%d,r=%d,p=%d", scryptLogN, scryptR, scryptP)
+	default:
+		return nil, nil, fmt.Errorf("unsupported KDF %q, expected %s or %s", kdf, KDFArgon2id, KDFScrypt)
+	}
+	key, err := deriveKey(headers, passphrase)
+	if err != nil {
+		return nil, nil, err
+	}
+	return headers, key, nil
+}
+
+// parameters are bounded so that a crafted file can't exhaust memory
+func deriveKey(headers map[string]string, passphrase string) ([]byte, error) {
+	salt, err := base64.StdEncoding.DecodeString(headers["Salt"])
+	if err != nil || len(salt) < 8 {
+		return nil, errors.New("sealed key: invalid salt")
+	}
+	params, err := parseParams(headers["KDF-Params"])
+	if err != nil {
+		return nil, err
+	}
+	switch headers["KDF"] {
+	case KDFArgon2id:
+		t, m, p := params["t"], params["m"], params["p"]
+		if t < 1 || t > 16 || m < 8*1024 || m > 4*1024*1024 || p < 1 || p > 64 {
+			return nil, errors.New("sealed key: argon2id parameters out of range")
+		}
+		return argon2.IDKey([]byte(passphrase), salt, uint32(t), uint32(m), uint8(p), keySize), nil
+	case KDFScrypt:
+		logN, r, p := params["logN"], params["r"], params["p"]
+		if logN < 10 || logN > 22 || r < 1 || r > 32 || p < 1 || p > 16 {
+			return nil, errors.New("sealed key: scrypt parameters out of range")
+		}
+		return scrypt.Key([]byte(passphrase), salt, 1<<logN, r, p, keySize)
+	default:
+		return nil, fmt.Errorf("sealed key: unsupported KDF %q", headers["KDF"])
+	}
+}
+
+func parseParams(v string) (map[string]int, error) {
+	params := make(map[string]int)
+	for _, param := range strings.Split(v, ",") {
+		name, value, ok := strings.Cut(param, "=")
+		if !ok {
+			return nil, errors.New("sealed key: invalid KDF parameters")
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, errors.New("sealed key: invalid KDF parameters")
+		}
+		params[name] = n
+	}
+	return params, nil
+}
+
+// the PEM type and headers are authenticated as additional data
+func additionalData(pemType string, headers map[string]string) []byte {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var buf bytes.Buffer
+	buf.WriteString(pemType)
+	buf.WriteByte('\n')
+	for _, name := range names {
+		fmt.Fprintf(&buf, "%s: %s\n", name, headers[name])
+	}
+	return buf.Bytes()
+}
+
+func seal(pemType string, headers map[string]string, key, plaintext []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	sealed := aead.Seal(nonce, nonce, plaintext, additionalData(pemType, headers))
+	return pem.EncodeToMemory(&pem.Block{Type: pemType, Headers: headers, Bytes: sealed}), nil
+}
+
+func open(block *pem.Block, key []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(block.Bytes) < aead.NonceSize()+aead.Overhead() {
+		return nil, errors.New("sealed key is truncated")
+	}
+	nonce := block.Bytes[:aead.NonceSize()]
+	plaintext, err := aead.Open(nil, nonce, block.Bytes[aead.NonceSize():], additionalData(block.Type, block.Headers))
+	if err != nil {
+		return nil, ErrIncorrectPassphrase
+	}
+	return plaintext, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	c, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(c)
+}
@@ -0,0 +1,81 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package sealedkey
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testDER = []byte("not really a PKCS#8 key")
+
+func TestPassphrase(t *testing.T) {
+	for _, kdf := range []string{KDFArgon2id, KDFScrypt} {
+		sealed, err := Seal(testDER, "hunter2", kdf)
+		require.NoError(t, err)
+		assert.True(t, IsSealed(sealed))
+		info, err := Parse(sealed)
+		require.NoError(t, err)
+		assert.Equal(t, kdf, info.KDF)
+		_, err = info.Open("hunter3")
+		assert.Equal(t, ErrIncorrectPassphrase, err)
+		der, err := info.Open("hunter2")
+		require.NoError(t, err)
+		assert.Equal(t, testDER, der)
+	}
+}
+
+func TestTamperedHeaders(t *testing.T) {
+	sealed, err := Seal(testDER, "hunter2", KDFScrypt)
+	require.NoError(t, err)
+	sealed = bytes.Replace(sealed, []byte("r=8"), []byte("r=9"), 1)
+	info, err := Parse(sealed)
+	require.NoError(t, err)
+	_, err = info.Open("hunter2")
+	assert.Error(t, err)
+}
+
+func TestShares(t *testing.T) {
+	sealed, shares, err := SealShared(testDER, 3, 2, KDFScrypt, func(index int) (string, error) {
+		if index == 2 {
+			return "", nil
+		}
+		return "share" + strconv.Itoa(index), nil
+	})
+	require.NoError(t, err)
+	require.Len(t, shares, 3)
+	info, err := Parse(sealed)
+	require.NoError(t, err)
+	assert.Equal(t, KDFShamir, info.KDF)
+	var secrets [][]byte
+	for _, blob := range shares[1:] {
+		share, err := info.ParseShare(blob)
+		require.NoError(t, err)
+		secret, err := share.Unlock("share" + strconv.Itoa(share.Index))
+		require.NoError(t, err)
+		secrets = append(secrets, secret)
+	}
+	_, err = info.OpenShared(secrets[:1])
+	assert.Error(t, err)
+	der, err := info.OpenShared(secrets)
+	require.NoError(t, err)
+	assert.Equal(t, testDER, der)
+}
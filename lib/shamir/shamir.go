@@ -0,0 +1,156 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package shamir splits a secret into shares using Shamir's secret sharing
+// over GF(2^8), so that any threshold number of shares recovers the secret and
+// fewer reveal nothing about it.
+//
+// Each share is the same length as the secret plus one trailing byte holding
+// the share's x coordinate.
+package shamir
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const maxShares = 255
+
+var expTable, logTable [256]byte
+
+func init() {
+	// generator 3 over the AES polynomial x^8 + x^4 + x^3 + x + 1
+	var x byte = 1
+	for i := 0; i < 255; i++ {
+		expTable[i] = x
+		logTable[x] = byte(i)
+		x ^= xtime(x)
+	}
+	expTable[255] = expTable[0]
+}
+
+func xtime(x byte) byte {
+	if x&0x80 != 0 {
+		return x<<1 ^ 0x1b
+	}
+	return x << 1
+}
+
+func mul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return expTable[(int(logTable[a])+int(logTable[b]))%255]
+}
+
+func div(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return expTable[(int(logTable[a])-int(logTable[b])+255)%255]
+}
+
+// Split divides secret into n shares, any threshold of which can be combined
+// to recover it
+func Split(secret []byte, n, threshold int) ([][]byte, error) {
+	return split(rand.Reader, secret, n, threshold)
+}
+
+func split(r io.Reader, secret []byte, n, threshold int) ([][]byte, error) {
+	switch {
+	case len(secret) == 0:
+		return nil, errors.New("shamir: secret is empty")
+	case threshold < 2:
+		return nil, errors.New("shamir: threshold must be at least 2")
+	case n < threshold:
+		return nil, errors.New("shamir: number of shares must be at least the threshold")
+	case n > maxShares:
+		return nil, fmt.Errorf("shamir: at most %d shares are supported", maxShares)
+	}
+	shares := make([][]byte, n)
+	for i := range shares {
+		shares[i] = make([]byte, len(secret)+1)
+		shares[i][len(secret)] = byte(i + 1)
+	}
+	// one random polynomial of degree threshold-1 per byte of the secret,
+	// with the secret byte as the constant term
+	coeffs := make([]byte, threshold)
+	for j, s := range secret {
+		coeffs[0] = s
+		if _, err := io.ReadFull(r, coeffs[1:]); err != nil {
+			return nil, err
+		}
+		for i := range shares {
+			x := byte(i + 1)
+			var y byte
+			for k := threshold - 1; k >= 0; k-- {
+				y = mul(y, x) ^ coeffs[k]
+			}
+			shares[i][j] = y
+		}
+	}
+	for i := range coeffs {
+		coeffs[i] = 0
+	}
+	return shares, nil
+}
+
+// Combine recovers the secret from at least threshold shares. Combining too
+// few shares yields garbage rather than an error, so callers should
+// authenticate the result.
+func Combine(shares [][]byte) ([]byte, error) {
+	if len(shares) < 2 {
+		return nil, errors.New("shamir: at least 2 shares are required")
+	}
+	size := len(shares[0])
+	if size < 2 {
+		return nil, errors.New("shamir: share is too short")
+	}
+	xs := make([]byte, len(shares))
+	for i, share := range shares {
+		if len(share) != size {
+			return nil, errors.New("shamir: shares are not all the same length")
+		}
+		xs[i] = share[size-1]
+		if xs[i] == 0 {
+			return nil, errors.New("shamir: invalid share")
+		}
+		for _, prev := range xs[:i] {
+			if prev == xs[i] {
+				return nil, errors.New("shamir: duplicate share")
+			}
+		}
+	}
+	// Lagrange interpolation at x=0
+	secret := make([]byte, size-1)
+	for i, share := range shares {
+		var num, den byte = 1, 1
+		for k, xk := range xs {
+			if k == i {
+				continue
+			}
+			num = mul(num, xk)
+			den = mul(den, xk^xs[i])
+		}
+		basis := div(num, den)
+		for j := range secret {
+			secret[j] ^= mul(share[j], basis)
+		}
+	}
+	return secret, nil
+}
@@ -0,0 +1,55 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package shamir
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitCombine(t *testing.T) {
+	secret := []byte("correct horse battery staple")
+	shares, err := Split(secret, 5, 3)
+	require.NoError(t, err)
+	require.Len(t, shares, 5)
+	for _, subset := range [][]int{{0, 1, 2}, {4, 2, 0}, {1, 3, 4}, {0, 1, 2, 3, 4}} {
+		var picked [][]byte
+		for _, i := range subset {
+			picked = append(picked, shares[i])
+		}
+		recovered, err := Combine(picked)
+		require.NoError(t, err)
+		assert.Equal(t, secret, recovered, "shares %v", subset)
+	}
+	recovered, err := Combine(shares[:2])
+	require.NoError(t, err)
+	assert.False(t, bytes.Equal(secret, recovered), "too few shares recovered the secret")
+}
+
+func TestCombineErrors(t *testing.T) {
+	shares, err := Split([]byte{1, 2, 3}, 3, 2)
+	require.NoError(t, err)
+	_, err = Combine([][]byte{shares[0], shares[0]})
+	assert.Error(t, err)
+	_, err = Combine([][]byte{shares[0], shares[1][:2]})
+	assert.Error(t, err)
+	_, err = Split([]byte{1}, 2, 3)
+	assert.Error(t, err)
+}
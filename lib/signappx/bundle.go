@@ -21,7 +21,6 @@ import (
 	"bytes"
 	"crypto/x509"
 	"encoding/xml"
-	"errors"
 	"fmt"
 	"io"
 	"strings"
@@ -69,11 +68,11 @@ func verifyBundle(r io.ReaderAt, files zipFiles, sig *AppxSignature, skipDigests
 		return fmt.Errorf("bundle manifest: publisher identity mismatch:\nexpected: %s\nactual: %s", publisher, bundle.Identity.Publisher)
 	}
 	for _, zf := range files {
-		if !strings.HasSuffix(zf.Name, ".appx") {
+		if !isNestedPackage(zf.Name) {
 			continue
 		}
 		if zf.Method != zip.Store {
-			return errors.New("bundle manifest: contains compressed appx")
+			return fmt.Errorf("bundle manifest: contains compressed package %s", zf.Name)
 		}
 		dosname := strings.ReplaceAll(zf.Name, "/", "\\")
 		pkgIndex, ok := packages[dosname]
@@ -28,6 +28,7 @@ var defaultExtensions = map[string]string{
 	"png":  "image/png",
 	"xml":  "application/vnd.ms-appx.manifest+xml",
 	"appx": "application/vnd.ms-appx",
+	"msix": "application/vnd.ms-appx",
 }
 
 var defaultOverrides = map[string]string{
@@ -116,7 +117,7 @@ func (c *ContentTypes) Find(name string) string {
 		return ctype
 	}
 	ext := path.Ext(path.Base(name))
-	if ext[0] == '.' {
+	if ext != "" {
 		if ctype := c.ByExt[ext[1:]]; ctype != "" {
 			return ctype
 		}
@@ -0,0 +1,147 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package signappx
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/zipslicer"
+)
+
+// IsBundle returns true if the package is a bundle of other packages
+func IsBundle(inz *zipslicer.Directory) bool {
+	for _, f := range inz.File {
+		if f.Name == bundleManifestFile {
+			return true
+		}
+	}
+	return false
+}
+
+// SignNested signs each of the packages inside a bundle and writes a copy of
+// the bundle containing the signed packages to w, with the offsets and sizes
+// in the bundle manifest updated to match. The bundle itself still needs to be
+// signed afterwards. Returns the offset of the first rewritten file, before
+// which the copy is identical to the original.
+func SignNested(ctx context.Context, inz *zipslicer.Directory, w io.Writer, cert *certloader.Certificate, hash crypto.Hash) (int64, error) {
+	var bundle *bundleManifest
+	for _, f := range inz.File {
+		if f.Name == bundleManifestFile {
+			blob, err := readSlicerFile(f)
+			if err != nil {
+				return 0, err
+			}
+			bundle, err = parseBundle(blob)
+			if err != nil {
+				return 0, fmt.Errorf("bundle manifest: %w", err)
+			}
+		}
+	}
+	if bundle == nil {
+		return 0, errors.New("missing bundle manifest")
+	}
+	outz := &zipslicer.Directory{}
+	firstChanged := int64(-1)
+	for _, f := range inz.File {
+		switch {
+		case isNestedPackage(f.Name):
+			if firstChanged < 0 {
+				firstChanged = int64(f.Offset)
+			}
+			signed, err := signNestedPackage(ctx, f, cert, hash)
+			if err != nil {
+				return 0, fmt.Errorf("bundled file %s: %w", f.Name, err)
+			}
+			nf, err := outz.NewFile(f.Name, nil, signed, w, f.ModTime(), false, false)
+			if err != nil {
+				return 0, err
+			}
+			lfh, err := nf.GetLocalHeader()
+			if err != nil {
+				return 0, err
+			}
+			dataOffset := int64(nf.Offset) + int64(len(lfh))
+			if err := bundle.setPackageLocation(zipToDos(f.Name), dataOffset, len(signed)); err != nil {
+				return 0, err
+			}
+		case f.Name == bundleManifestFile:
+			// packages always come before the bundle manifest
+			if firstChanged < 0 {
+				firstChanged = int64(f.Offset)
+			}
+			blob, err := bundle.Marshal()
+			if err != nil {
+				return 0, err
+			}
+			if _, err := outz.NewFile(f.Name, nil, blob, w, f.ModTime(), false, false); err != nil {
+				return 0, err
+			}
+		default:
+			if _, err := f.Dump(w); err != nil {
+				return 0, err
+			}
+			if _, err := outz.AddFile(f); err != nil {
+				return 0, err
+			}
+		}
+	}
+	if err := outz.WriteDirectory(w, w, false); err != nil {
+		return 0, err
+	}
+	return firstChanged, nil
+}
+
+// sign a package inside a bundle and return the signed copy
+func signNestedPackage(ctx context.Context, f *zipslicer.File, cert *certloader.Certificate, hash crypto.Hash) ([]byte, error) {
+	blob, err := readSlicerFile(f)
+	if err != nil {
+		return nil, err
+	}
+	nestedz, err := zipslicer.Read(bytes.NewReader(blob), int64(len(blob)))
+	if err != nil {
+		return nil, err
+	}
+	digest, err := DigestAppx(nestedz, hash, false)
+	if err != nil {
+		return nil, err
+	}
+	_, _, _, err = digest.Sign(ctx, cert)
+	if err != nil {
+		return nil, err
+	}
+	// the patch replaces everything from the first signature-related file onwards
+	signed := append(blob[:digest.patchStart:digest.patchStart], digest.patchBuf.Bytes()...)
+	return signed, nil
+}
+
+func (m *bundleManifest) setPackageLocation(fileName string, offset int64, size int) error {
+	for _, el := range m.Etree.FindElements("Bundle/Packages/Package") {
+		if el.SelectAttrValue("FileName", "") == fileName {
+			el.CreateAttr("Offset", strconv.FormatInt(offset, 10))
+			el.CreateAttr("Size", strconv.Itoa(size))
+			return nil
+		}
+	}
+	return fmt.Errorf("bundle manifest: missing file %s", fileName)
+}
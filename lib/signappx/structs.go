@@ -19,6 +19,8 @@ package signappx
 import (
 	"archive/zip"
 	"crypto"
+	"path"
+	"strings"
 
 	"github.com/sassoftware/relic/v7/lib/pkcs9"
 )
@@ -44,3 +46,21 @@ type AppxSignature struct {
 }
 
 type zipFiles map[string]*zip.File
+
+// isNestedPackage returns true if a file in a bundle is one of its packages
+func isNestedPackage(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".appx", ".msix":
+		return true
+	}
+	return false
+}
+
+// isPE returns true if a file needs an entry in the CodeIntegrity catalog
+func isPE(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".exe", ".dll", ".winmd", ".sys":
+		return true
+	}
+	return false
+}
@@ -24,7 +24,6 @@ import (
 	"hash"
 	"io"
 	"io/ioutil"
-	"strings"
 	"time"
 
 	"github.com/sassoftware/relic/v7/lib/authenticode"
@@ -48,6 +47,23 @@ type AppxDigest struct {
 }
 
 func DigestAppxTar(r io.Reader, hash crypto.Hash, doPageHash bool) (*AppxDigest, error) {
+	inz, err := zipslicer.ReadZipTar(r)
+	if err != nil {
+		return nil, err
+	}
+	info, err := DigestAppx(inz, hash, doPageHash)
+	if err != nil {
+		return nil, err
+	}
+	// drain the input to ensure the request is completely read before the response goes out
+	if _, err := io.Copy(ioutil.Discard, r); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// DigestAppx digests an appx or msix package that has already been read
+func DigestAppx(inz *zipslicer.Directory, hash crypto.Hash, doPageHash bool) (*AppxDigest, error) {
 	info := &AppxDigest{
 		Hash:         hash,
 		axpc:         hash.New(),
@@ -57,10 +73,6 @@ func DigestAppxTar(r io.Reader, hash crypto.Hash, doPageHash bool) (*AppxDigest,
 	if err := info.blockMap.SetHash(hash); err != nil {
 		return nil, err
 	}
-	inz, err := zipslicer.ReadZipTar(r)
-	if err != nil {
-		return nil, err
-	}
 	// digest non-signature-related files
 copyf:
 	for _, f := range inz.File {
@@ -117,10 +129,6 @@ copyf:
 	if info.manifest == nil && info.bundle == nil {
 		return nil, errors.New("missing manifest")
 	}
-	// drain the input to ensure the request is completely read before the response goes out
-	if _, err := io.Copy(ioutil.Discard, r); err != nil {
-		return nil, err
-	}
 	return info, nil
 }
 
@@ -144,7 +152,7 @@ func (i *AppxDigest) digestFile(f *zipslicer.File, doPageHash bool) error {
 	var peWriters []io.WriteCloser
 	var peResults []<-chan peDigestResult
 	var sink io.Writer
-	if strings.HasSuffix(f.Name, ".exe") || strings.HasSuffix(f.Name, ".dll") {
+	if isPE(f.Name) {
 		// DigestPE wants a Reader so make a pipe for each one and sink data into the pipes
 		peWriters, peResults = setupPeDigests(f.Name, i.Hash, doPageHash)
 		defer func() {
@@ -74,16 +74,7 @@ func parseControl(r io.Reader, ext string) (*PackageInfo, error) {
 		return nil, err
 	}
 	info := new(PackageInfo)
-	scanner := bufio.NewScanner(bytes.NewReader(blob))
-	for scanner.Scan() {
-		line := scanner.Text()
-		i := strings.IndexAny(line, " \t\r\n")
-		j := strings.Index(line, ":")
-		if j < 0 || i < j {
-			continue
-		}
-		key := line[:j]
-		value := strings.Trim(line[j+1:], " \t\r\n")
+	err = scanFields(blob, func(key, value string) {
 		switch strings.ToLower(key) {
 		case "package":
 			info.Package = value
@@ -92,12 +83,28 @@ func parseControl(r io.Reader, ext string) (*PackageInfo, error) {
 		case "architecture":
 			info.Arch = value
 		}
-	}
-	if scanner.Err() != nil {
-		return nil, scanner.Err()
+	})
+	if err != nil {
+		return nil, err
 	}
 	if info.Package == "" || info.Version == "" {
 		return nil, errors.New("control file is missing package and/or version fields")
 	}
 	return info, nil
 }
+
+// Call fn with the key and value of each field in a control file. Folded
+// continuation lines are skipped.
+func scanFields(blob []byte, fn func(key, value string)) error {
+	scanner := bufio.NewScanner(bytes.NewReader(blob))
+	for scanner.Scan() {
+		line := scanner.Text()
+		i := strings.IndexAny(line, " \t\r\n")
+		j := strings.Index(line, ":")
+		if j < 0 || i < j {
+			continue
+		}
+		fn(line[:j], strings.Trim(line[j+1:], " \t\r\n"))
+	}
+	return scanner.Err()
+}
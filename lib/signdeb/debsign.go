@@ -30,6 +30,7 @@ import (
 	"github.com/sassoftware/relic/v7/lib/binpatch"
 	"github.com/sassoftware/relic/v7/lib/pgptools"
 	"github.com/sassoftware/relic/v7/lib/readercounter"
+	"github.com/sassoftware/relic/v7/signers/sigerrors"
 
 	"github.com/qur/ar"
 	"golang.org/x/crypto/openpgp"
@@ -146,3 +147,28 @@ func Sign(r io.Reader, signer *openpgp.Entity, opts crypto.SignerOpts, role stri
 	patch.Add(patchOffset, patchLength, pbuf.Bytes())
 	return &DebSignature{*info, now, patch}, nil
 }
+
+// RemoveSignatures returns a PatchSet that deletes the signature of every role
+// from a .deb file
+func RemoveSignatures(r io.Reader) (*binpatch.PatchSet, error) {
+	counter := readercounter.New(r)
+	reader := ar.NewReader(counter)
+	patch := binpatch.New()
+	var found bool
+	for {
+		hdr, err := reader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(path.Clean(hdr.Name), "_gpg") {
+			patch.Add(counter.N-60, int64(60+((hdr.Size+1)/2)*2), nil)
+			found = true
+		}
+	}
+	if !found {
+		return nil, sigerrors.NotSignedError{Type: "DEB"}
+	}
+	return patch, nil
+}
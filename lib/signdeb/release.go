@@ -0,0 +1,155 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package signdeb
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ReleaseFile is one index file listed in an APT repository's Release file
+type ReleaseFile struct {
+	Path   string
+	Size   int64
+	SHA256 string
+	SHA512 string
+}
+
+// ParseRelease returns the index files listed in a Release file and whether
+// the repository declares by-hash support
+func ParseRelease(blob []byte) (files []*ReleaseFile, byHash bool, err error) {
+	byPath := make(map[string]*ReleaseFile)
+	var section string
+	scanner := bufio.NewScanner(bytes.NewReader(blob))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" {
+			continue
+		}
+		if line[0] != ' ' && line[0] != '\t' {
+			j := strings.Index(line, ":")
+			if j < 0 {
+				return nil, false, fmt.Errorf("malformed Release line: %q", line)
+			}
+			section = strings.ToLower(line[:j])
+			if section == "acquire-by-hash" {
+				byHash = strings.EqualFold(strings.TrimSpace(line[j+1:]), "yes")
+			}
+			continue
+		}
+		if section != "sha256" && section != "sha512" {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, false, fmt.Errorf("malformed Release checksum line: %q", line)
+		}
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, false, fmt.Errorf("malformed Release checksum line: %q", line)
+		}
+		f := byPath[fields[2]]
+		if f == nil {
+			f = &ReleaseFile{Path: fields[2], Size: size}
+			byPath[f.Path] = f
+			files = append(files, f)
+		} else if f.Size != size {
+			return nil, false, fmt.Errorf("conflicting sizes for %s in Release", f.Path)
+		}
+		if section == "sha256" {
+			f.SHA256 = strings.ToLower(fields[0])
+		} else {
+			f.SHA512 = strings.ToLower(fields[0])
+		}
+	}
+	if scanner.Err() != nil {
+		return nil, false, scanner.Err()
+	}
+	return files, byHash, nil
+}
+
+// ValidateRelease checks that the index files in suiteDir match the sizes and
+// checksums listed in its Release file. Listed files that don't exist are
+// skipped, as APT allows. If checkByHash is set and the repository declares
+// by-hash support, then the by-hash copy of each file must also be present.
+func ValidateRelease(suiteDir string, release []byte, checkByHash bool) error {
+	files, byHash, err := ParseRelease(release)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return errors.New("Release file does not list any SHA256 or SHA512 checksums")
+	}
+	for _, f := range files {
+		fp := filepath.Join(suiteDir, filepath.FromSlash(path.Clean("/"+f.Path)))
+		if err := checkReleaseFile(fp, f); os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if !checkByHash || !byHash {
+			continue
+		}
+		// APT fetches by the strongest hash listed
+		alg, sum := "SHA512", f.SHA512
+		if sum == "" {
+			alg, sum = "SHA256", f.SHA256
+		}
+		hp := filepath.Join(filepath.Dir(fp), "by-hash", alg, sum)
+		if err := checkReleaseFile(hp, f); os.IsNotExist(err) {
+			return fmt.Errorf("%s: missing by-hash file %s", f.Path, hp)
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkReleaseFile(fp string, f *ReleaseFile) error {
+	fd, err := os.Open(fp)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	var h256, h512 hash.Hash = sha256.New(), sha512.New()
+	n, err := io.Copy(io.MultiWriter(h256, h512), fd)
+	if err != nil {
+		return err
+	}
+	if n != f.Size {
+		return fmt.Errorf("%s: size is %d but Release says %d", fp, n, f.Size)
+	}
+	if f.SHA256 != "" && hex.EncodeToString(h256.Sum(nil)) != f.SHA256 {
+		return fmt.Errorf("%s: SHA256 checksum does not match Release", fp)
+	}
+	if f.SHA512 != "" && hex.EncodeToString(h512.Sum(nil)) != f.SHA512 {
+		return fmt.Errorf("%s: SHA512 checksum does not match Release", fp)
+	}
+	return nil
+}
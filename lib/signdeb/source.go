@@ -0,0 +1,84 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package signdeb
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/openpgp/clearsign"
+
+	"github.com/sassoftware/relic/v7/lib/pgptools"
+)
+
+var clearSignHeader = []byte("-----BEGIN PGP SIGNED MESSAGE-----")
+
+// SourceInfo holds basic identifying fields from a .dsc, .changes or
+// .buildinfo file
+type SourceInfo struct {
+	Source, Version, Arch string
+}
+
+// StripClearSign returns the document inside a clearsigned control file, or
+// the file as-is if it isn't signed
+func StripClearSign(blob []byte) ([]byte, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(blob, "\r\n"), clearSignHeader) {
+		return blob, nil
+	}
+	block, _ := clearsign.Decode(blob)
+	if block == nil {
+		return nil, errors.New("malformed clearsigned document")
+	}
+	return block.Plaintext, nil
+}
+
+// ParseSourceInfo reads identifying fields from an unsigned .dsc, .changes
+// or .buildinfo file
+func ParseSourceInfo(blob []byte) (*SourceInfo, error) {
+	info := new(SourceInfo)
+	err := scanFields(blob, func(key, value string) {
+		switch strings.ToLower(key) {
+		case "source":
+			info.Source = value
+		case "version":
+			info.Version = value
+		case "architecture":
+			info.Arch = value
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if info.Source == "" || info.Version == "" {
+		return nil, errors.New("control file is missing source and/or version fields")
+	}
+	return info, nil
+}
+
+// MergeClearSign combines an unsigned control file with a signature block
+// from pgptools.DetachClearSign, using Unix line endings as Debian tools
+// expect
+func MergeClearSign(w io.Writer, sig []byte, document []byte) error {
+	var buf bytes.Buffer
+	if err := pgptools.MergeClearSign(&buf, sig, bytes.NewReader(document)); err != nil {
+		return err
+	}
+	_, err := w.Write(bytes.ReplaceAll(buf.Bytes(), []byte("\r\n"), []byte("\n")))
+	return err
+}
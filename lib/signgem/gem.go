@@ -0,0 +1,324 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package signgem signs and verifies RubyGems packages the way "gem build"
+// does when a signing key and cert_chain are configured.
+package signgem
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sassoftware/relic/v7/lib/readercounter"
+)
+
+const (
+	metadataName  = "metadata.gz"
+	dataName      = "data.tar.gz"
+	checksumsName = "checksums.yaml.gz"
+	sigSuffix     = ".sig"
+)
+
+// signedNames are the gem members that get signatures, in archive order
+var signedNames = []string{metadataName, dataName, checksumsName}
+
+// GemInfo identifies a gem and its signer
+type GemInfo struct {
+	Name    string
+	Version string
+	// Certificates from the gemspec's cert_chain, leaf first
+	Certificates []*x509.Certificate
+}
+
+type entry struct {
+	name       string
+	start, end int64
+	contents   []byte
+	sha256     []byte
+	sha512     []byte
+}
+
+// readGem walks the outer tar of a gem, digesting each member and keeping the
+// contents of everything except the data tarball
+func readGem(r io.Reader) ([]*entry, error) {
+	counter := readercounter.New(r)
+	tr := tar.NewReader(counter)
+	var entries []*entry
+	var pos int64
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		e := &entry{
+			name:  hdr.Name,
+			start: pos,
+			end:   counter.N + (hdr.Size+511)/512*512,
+		}
+		pos = e.end
+		d256 := sha256.New()
+		d512 := sha512.New()
+		w := io.MultiWriter(d256, d512)
+		var buf bytes.Buffer
+		if e.name != dataName {
+			w = io.MultiWriter(w, &buf)
+		}
+		if _, err := io.Copy(w, tr); err != nil {
+			return nil, err
+		}
+		e.contents = buf.Bytes()
+		e.sha256 = d256.Sum(nil)
+		e.sha512 = d512.Sum(nil)
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func findEntry(entries []*entry, name string) *entry {
+	for _, e := range entries {
+		if e.name == name {
+			return e
+		}
+	}
+	return nil
+}
+
+// tarEntry formats a single member the way Gem::Package::TarWriter does,
+// without the end-of-archive marker
+func tarEntry(name string, contents []byte, mtime time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0444,
+		Size:     int64(len(contents)),
+		ModTime:  mtime,
+		Uname:    "wheel",
+		Gname:    "wheel",
+		Format:   tar.FormatUSTAR,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return nil, err
+	}
+	if _, err := tw.Write(contents); err != nil {
+		return nil, err
+	}
+	if err := tw.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func gunzip(blob []byte) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(blob))
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(gz)
+}
+
+func gzipBytes(blob []byte, mtime time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.ModTime = mtime
+	if _, err := gz.Write(blob); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// specField returns the value of a top-level scalar in the gemspec YAML, or of
+// the first nested scalar if the top-level value is a tagged object
+func specField(spec []byte, name string) string {
+	scanner := bufio.NewScanner(bytes.NewReader(spec))
+	var nested bool
+	for scanner.Scan() {
+		line := scanner.Text()
+		if nested {
+			if k, v, ok := strings.Cut(strings.TrimSpace(line), ":"); ok && k == name {
+				return unquote(v)
+			}
+			return ""
+		}
+		k, v, ok := strings.Cut(line, ":")
+		if !ok || k != name {
+			continue
+		}
+		v = strings.TrimSpace(v)
+		if strings.HasPrefix(v, "!") {
+			nested = true
+			continue
+		}
+		return unquote(v)
+	}
+	return ""
+}
+
+func unquote(v string) string {
+	return strings.Trim(strings.TrimSpace(v), `"'`)
+}
+
+// certChainBlock returns the byte range of the cert_chain key in the gemspec
+func certChainBlock(spec []byte) (start, end int, ok bool) {
+	lines := bytes.SplitAfter(spec, []byte("\n"))
+	pos := 0
+	for _, line := range lines {
+		if !ok {
+			if bytes.HasPrefix(line, []byte("cert_chain:")) {
+				start, ok = pos, true
+			}
+		} else if len(line) > 0 && line[0] != ' ' && line[0] != '-' {
+			return start, pos, true
+		}
+		pos += len(line)
+	}
+	return start, pos, ok
+}
+
+// setCertChain replaces the gemspec's cert_chain with the given certificates,
+// root first as RubyGems expects
+func setCertChain(spec []byte, certs []*x509.Certificate) []byte {
+	var block bytes.Buffer
+	block.WriteString("cert_chain:\n")
+	for i := len(certs) - 1; i >= 0; i-- {
+		block.WriteString("- |\n")
+		p := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certs[i].Raw})
+		for _, line := range strings.SplitAfter(string(p), "\n") {
+			if line != "" {
+				block.WriteString("  " + line)
+			}
+		}
+	}
+	start, end, ok := certChainBlock(spec)
+	if !ok {
+		start, end = len(spec), len(spec)
+	}
+	var out bytes.Buffer
+	out.Write(spec[:start])
+	out.Write(block.Bytes())
+	out.Write(spec[end:])
+	return out.Bytes()
+}
+
+// getCertChain parses the gemspec's cert_chain, returning it leaf first
+func getCertChain(spec []byte) ([]*x509.Certificate, error) {
+	start, end, ok := certChainBlock(spec)
+	if !ok {
+		return nil, nil
+	}
+	var unindented bytes.Buffer
+	for _, line := range strings.Split(string(spec[start:end]), "\n") {
+		unindented.WriteString(strings.TrimSpace(line) + "\n")
+	}
+	var certs []*x509.Certificate
+	rest := unindented.Bytes()
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parsing gem cert_chain: %w", err)
+		}
+		certs = append([]*x509.Certificate{cert}, certs...)
+	}
+	return certs, nil
+}
+
+// formatChecksums produces checksums.yaml for the given members
+func formatChecksums(members map[string]*entry) []byte {
+	names := make([]string, 0, len(members))
+	for name := range members {
+		names = append(names, name)
+	}
+	// RubyGems lists metadata.gz before data.tar.gz
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	var buf bytes.Buffer
+	buf.WriteString("---\n")
+	for _, alg := range []string{"SHA256", "SHA512"} {
+		buf.WriteString(alg + ":\n")
+		for _, name := range names {
+			d := members[name].sha256
+			if alg == "SHA512" {
+				d = members[name].sha512
+			}
+			fmt.Fprintf(&buf, "  %s: %s\n", name, hex.EncodeToString(d))
+		}
+	}
+	return buf.Bytes()
+}
+
+// checkChecksums compares checksums.yaml against the members' digests
+func checkChecksums(checksums []byte, members []*entry) error {
+	var alg string
+	var checked int
+	for _, line := range strings.Split(string(checksums), "\n") {
+		if line == "---" || strings.TrimSpace(line) == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, " ") {
+			alg = strings.TrimSuffix(strings.TrimSpace(line), ":")
+			continue
+		}
+		name, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok {
+			continue
+		}
+		e := findEntry(members, name)
+		if e == nil {
+			return fmt.Errorf("checksums.yaml lists missing member %s", name)
+		}
+		var d []byte
+		switch alg {
+		case "SHA256":
+			d = e.sha256
+		case "SHA512":
+			d = e.sha512
+		default:
+			continue
+		}
+		if unquote(value) != hex.EncodeToString(d) {
+			return fmt.Errorf("%s checksum mismatch for %s", alg, name)
+		}
+		checked++
+	}
+	if checked == 0 {
+		return errors.New("checksums.yaml has no usable checksums")
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package signgem
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/rsa"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sassoftware/relic/v7/internal/testcert"
+)
+
+const testSpec = `--- !ruby/object:Gem::Specification
+name: example
+version: !ruby/object:Gem::Version
+  version: 1.2.3
+platform: ruby
+authors:
+- Example Author
+bindir: bin
+cert_chain: []
+date: 2024-01-01 00:00:00.000000000 Z
+dependencies: []
+files:
+- lib/example.rb
+require_paths:
+- lib
+rubygems_version: 3.5.3
+specification_version: 4
+summary: An example
+test_files: []
+`
+
+func mkGem(t *testing.T, fp string) {
+	now := time.Now()
+	meta, err := gzipBytes([]byte(testSpec), now)
+	require.NoError(t, err)
+	data, err := gzipBytes([]byte("pretend this is a tarball"), now)
+	require.NoError(t, err)
+	sums, err := gzipBytes([]byte("---\nSHA256:\n  metadata.gz: 00\n"), now)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, m := range []struct {
+		name     string
+		contents []byte
+	}{{metadataName, meta}, {dataName, data}, {checksumsName, sums}} {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: m.name, Mode: 0444, Size: int64(len(m.contents))}))
+		_, err := tw.Write(m.contents)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, os.WriteFile(fp, buf.Bytes(), 0644))
+}
+
+func mkCerts(t *testing.T) (*rsa.PrivateKey, []*x509.Certificate) {
+	key := testcert.RSAKey(t)
+	return key, []*x509.Certificate{testcert.SelfSigned(t, "gem signer", key)}
+}
+
+func signFile(t *testing.T, fp string, key *rsa.PrivateKey, certs []*x509.Certificate) *GemSignature {
+	f, err := os.OpenFile(fp, os.O_RDWR, 0)
+	require.NoError(t, err)
+	defer f.Close()
+	sig, err := Sign(f, key, certs, time.Now())
+	require.NoError(t, err)
+	require.NoError(t, sig.PatchSet.Apply(f, fp))
+	return sig
+}
+
+func verifyFile(fp string) (*GemInfo, error) {
+	f, err := os.Open(fp)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Verify(f)
+}
+
+func TestSignGem(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), "example-1.2.3.gem")
+	mkGem(t, fp)
+	info, err := verifyFile(fp)
+	require.NoError(t, err)
+	assert.Nil(t, info)
+
+	key, certs := mkCerts(t)
+	sig := signFile(t, fp, key, certs)
+	assert.Equal(t, "example", sig.Name)
+	assert.Equal(t, "1.2.3", sig.Version)
+	info, err = verifyFile(fp)
+	require.NoError(t, err)
+	assert.Equal(t, "1.2.3", info.Version)
+	require.Len(t, info.Certificates, 1)
+	assert.Equal(t, certs[0].Raw, info.Certificates[0].Raw)
+
+	// re-signing replaces the old signatures and chain
+	key2, certs2 := mkCerts(t)
+	signFile(t, fp, key2, certs2)
+	info, err = verifyFile(fp)
+	require.NoError(t, err)
+	require.Len(t, info.Certificates, 1)
+	assert.Equal(t, certs2[0].Raw, info.Certificates[0].Raw)
+	f, err := os.Open(fp)
+	require.NoError(t, err)
+	defer f.Close()
+	entries, err := readGem(f)
+	require.NoError(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.name)
+	}
+	assert.Equal(t, []string{"metadata.gz", "metadata.gz.sig", "data.tar.gz", "data.tar.gz.sig", "checksums.yaml.gz", "checksums.yaml.gz.sig"}, names)
+}
+
+func TestCertChain(t *testing.T) {
+	_, certs := mkCerts(t)
+	_, root := mkCerts(t)
+	chain := []*x509.Certificate{certs[0], root[0]}
+	spec := setCertChain([]byte(testSpec), chain)
+	assert.Contains(t, string(spec), "\ncert_chain:\n- |\n  -----BEGIN CERTIFICATE-----\n")
+	assert.Contains(t, string(spec), "-----END CERTIFICATE-----\ndate: ")
+	parsed, err := getCertChain(spec)
+	require.NoError(t, err)
+	require.Len(t, parsed, 2)
+	assert.Equal(t, certs[0].Raw, parsed[0].Raw)
+	assert.Equal(t, root[0].Raw, parsed[1].Raw)
+}
@@ -0,0 +1,130 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package signgem
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/sassoftware/relic/v7/lib/binpatch"
+)
+
+// GemSignature holds a patch that adds or replaces a gem's signatures
+type GemSignature struct {
+	GemInfo
+	PatchSet *binpatch.PatchSet
+}
+
+// Sign a gem. The certificate chain, leaf first, is recorded in the gemspec
+// which means metadata.gz and checksums.yaml.gz are rewritten before
+// everything is signed.
+func Sign(r io.Reader, signer crypto.Signer, certs []*x509.Certificate, buildTime time.Time) (*GemSignature, error) {
+	if len(certs) == 0 {
+		return nil, errors.New("signing a gem requires a X.509 certificate")
+	}
+	entries, err := readGem(r)
+	if err != nil {
+		return nil, err
+	}
+	meta := findEntry(entries, metadataName)
+	data := findEntry(entries, dataName)
+	if meta == nil || data == nil {
+		return nil, errors.New("not a gem: metadata.gz or data.tar.gz is missing")
+	}
+	spec, err := gunzip(meta.contents)
+	if err != nil {
+		return nil, fmt.Errorf("reading gem metadata: %w", err)
+	}
+	info := GemInfo{
+		Name:         specField(spec, "name"),
+		Version:      specField(spec, "version"),
+		Certificates: certs,
+	}
+	newMeta, err := gzipBytes(setCertChain(spec, certs), buildTime)
+	if err != nil {
+		return nil, err
+	}
+	metaDigest := sha256.Sum256(newMeta)
+	metaDigest512 := sha512.Sum512(newMeta)
+	newChecksums, err := gzipBytes(formatChecksums(map[string]*entry{
+		metadataName: {sha256: metaDigest[:], sha512: metaDigest512[:]},
+		dataName:     data,
+	}), buildTime)
+	if err != nil {
+		return nil, err
+	}
+	// each signed member is followed by its signature
+	metaBlob, err := signedEntry(signer, metadataName, newMeta, metaDigest[:], buildTime)
+	if err != nil {
+		return nil, err
+	}
+	dataBlob, err := signedEntry(signer, dataName, nil, data.sha256, buildTime)
+	if err != nil {
+		return nil, err
+	}
+	checksumsDigest := sha256.Sum256(newChecksums)
+	checksumsBlob, err := signedEntry(signer, checksumsName, newChecksums, checksumsDigest[:], buildTime)
+	if err != nil {
+		return nil, err
+	}
+	if findEntry(entries, checksumsName) == nil {
+		// gems predating checksums.yaml get one after the data
+		dataBlob = append(dataBlob, checksumsBlob...)
+	}
+	patch := binpatch.New()
+	for _, e := range entries {
+		switch e.name {
+		case metadataName:
+			patch.Add(e.start, e.end-e.start, metaBlob)
+		case dataName:
+			patch.Add(e.end, 0, dataBlob)
+		case checksumsName:
+			patch.Add(e.start, e.end-e.start, checksumsBlob)
+		case metadataName + sigSuffix, dataName + sigSuffix, checksumsName + sigSuffix:
+			patch.Add(e.start, e.end-e.start, nil)
+		}
+	}
+	return &GemSignature{GemInfo: info, PatchSet: patch}, nil
+}
+
+// signedEntry returns tar members for a file and its signature. If contents
+// is nil then only the signature is returned.
+func signedEntry(signer crypto.Signer, name string, contents, digest []byte, buildTime time.Time) ([]byte, error) {
+	sig, err := signer.Sign(rand.Reader, digest, crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	var blob []byte
+	if contents != nil {
+		blob, err = tarEntry(name, contents, buildTime)
+		if err != nil {
+			return nil, err
+		}
+	}
+	sigEntry, err := tarEntry(name+sigSuffix, sig, buildTime)
+	if err != nil {
+		return nil, err
+	}
+	return append(blob, sigEntry...), nil
+}
@@ -0,0 +1,79 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package signgem
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+)
+
+// Verify the signatures and checksums of a gem. The certificate chain is not
+// checked. Returns nil if the gem is not signed.
+func Verify(r io.Reader) (*GemInfo, error) {
+	entries, err := readGem(r)
+	if err != nil {
+		return nil, err
+	}
+	meta := findEntry(entries, metadataName)
+	if meta == nil || findEntry(entries, dataName) == nil {
+		return nil, errors.New("not a gem: metadata.gz or data.tar.gz is missing")
+	}
+	spec, err := gunzip(meta.contents)
+	if err != nil {
+		return nil, fmt.Errorf("reading gem metadata: %w", err)
+	}
+	certs, err := getCertChain(spec)
+	if err != nil {
+		return nil, err
+	}
+	if len(certs) == 0 {
+		return nil, nil
+	}
+	for _, name := range signedNames {
+		e := findEntry(entries, name)
+		sig := findEntry(entries, name+sigSuffix)
+		if e == nil {
+			if name == checksumsName {
+				continue
+			}
+			return nil, fmt.Errorf("gem is missing %s", name)
+		} else if sig == nil {
+			return nil, fmt.Errorf("gem is missing signature for %s", name)
+		}
+		if err := x509tools.Verify(certs[0].PublicKey, crypto.SHA256, e.sha256, sig.contents); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	if checksums := findEntry(entries, checksumsName); checksums != nil {
+		yaml, err := gunzip(checksums.contents)
+		if err != nil {
+			return nil, fmt.Errorf("reading gem checksums: %w", err)
+		}
+		if err := checkChecksums(yaml, entries); err != nil {
+			return nil, err
+		}
+	}
+	return &GemInfo{
+		Name:         specField(spec, "name"),
+		Version:      specField(spec, "version"),
+		Certificates: certs,
+	}, nil
+}
@@ -39,6 +39,12 @@ type JarDigest struct {
 	Manifest []byte
 	Hash     crypto.Hash
 	inz      *zipslicer.Directory
+	added    []addedFile
+}
+
+type addedFile struct {
+	name     string
+	contents []byte
 }
 
 func DigestJarStream(r io.Reader, hash crypto.Hash) (*JarDigest, error) {
@@ -46,7 +52,56 @@ func DigestJarStream(r io.Reader, hash crypto.Hash) (*JarDigest, error) {
 	if err != nil {
 		return nil, err
 	}
-	return updateManifest(inz, hash)
+	return updateManifest(inz, hash, false)
+}
+
+// DigestJar digests a JAR that has already been opened, such as one read from
+// a temporary file with zipslicer.Read
+func DigestJar(inz *zipslicer.Directory, hash crypto.Hash) (*JarDigest, error) {
+	return updateManifest(inz, hash, false)
+}
+
+// DigestZip is like DigestJar, but starts a new manifest if the archive does
+// not have one. It is used for zip-based formats such as Android App Bundles
+// that are signed like JARs but aren't built with a manifest.
+func DigestZip(inz *zipslicer.Directory, hash crypto.Hash) (*JarDigest, error) {
+	return updateManifest(inz, hash, true)
+}
+
+// AddFile adds a new file to the archive when it is signed, replacing any
+// existing file of the same name. Its digest is added to the manifest.
+func (jd *JarDigest) AddFile(name string, contents []byte) error {
+	files, err := ParseManifest(jd.Manifest)
+	if err != nil {
+		return err
+	}
+	hashName := x509tools.HashNames[jd.Hash]
+	if hashName == "" {
+		return errors.New("unsupported hash type")
+	}
+	d := jd.Hash.New()
+	d.Write(contents)
+	calculated := base64.StdEncoding.EncodeToString(d.Sum(nil))
+	if files.Files[name] == nil {
+		files.Order = append(files.Order, name)
+	}
+	files.Files[name] = http.Header{
+		"Name":               []string{name},
+		hashName + "-Digest": []string{calculated},
+	}
+	jd.Manifest = files.Dump()
+	jd.Digests[name] = calculated
+	jd.added = append(jd.added, addedFile{name: name, contents: contents})
+	return nil
+}
+
+func (jd *JarDigest) isReplaced(name string) bool {
+	for _, f := range jd.added {
+		if f.name == name {
+			return true
+		}
+	}
+	return false
 }
 
 // Digest all of the files in the JAR
@@ -93,12 +148,15 @@ func digestFiles(jar *zipslicer.Directory, hash crypto.Hash) (*JarDigest, error)
 }
 
 // Check JAR contents against its manifest and adds digests if necessary
-func updateManifest(jar *zipslicer.Directory, hash crypto.Hash) (*JarDigest, error) {
+func updateManifest(jar *zipslicer.Directory, hash crypto.Hash, create bool) (*JarDigest, error) {
 	jd, err := digestFiles(jar, hash)
 	if err != nil {
 		return nil, err
 	} else if jd.Manifest == nil {
-		return nil, errors.New("JAR did not contain a manifest")
+		if !create {
+			return nil, errors.New("JAR did not contain a manifest")
+		}
+		jd.Manifest = []byte("Manifest-Version: 1.0\r\nCreated-By: relic\r\n\r\n")
 	}
 	files, err := ParseManifest(jd.Manifest)
 	if err != nil {
@@ -52,6 +52,9 @@ func (jd *JarDigest) Sign(ctx context.Context, cert *certloader.Certificate, ali
 	if err != nil {
 		return nil, nil, err
 	}
+	if err := cert.AttachRevocationInfo(psd); err != nil {
+		return nil, nil, err
+	}
 	ts, err := pkcs9.TimestampAndMarshal(ctx, psd, cert.Timestamper, false)
 	if err != nil {
 		return nil, nil, err
@@ -93,11 +96,16 @@ func (jd *JarDigest) insertSignature(cert *x509.Certificate, alias string, sf, s
 	if _, err := outz.NewFile(metaInf+pkcsname, nil, sig, &zipcon, mtime, deflate, false); err != nil {
 		return nil, err
 	}
+	for _, f := range jd.added {
+		if _, err := outz.NewFile(f.name, nil, f.contents, &zipcon, mtime, true, false); err != nil {
+			return nil, err
+		}
+	}
 	// Patch out old files
 	patch := binpatch.New()
 	patch.Add(0, 0, zipcon.Bytes())
 	for _, f := range jd.inz.File {
-		if keepFile(f.Name) {
+		if keepFile(f.Name) && !jd.isReplaced(f.Name) {
 			// Add existing file to the new zip directory. Its offset will be changed.
 			if _, err := outz.AddFile(f); err != nil {
 				return nil, err
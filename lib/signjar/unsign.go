@@ -0,0 +1,52 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package signjar
+
+import (
+	"github.com/sassoftware/relic/v7/lib/binpatch"
+	"github.com/sassoftware/relic/v7/lib/zipslicer"
+	"github.com/sassoftware/relic/v7/signers/sigerrors"
+)
+
+// RemoveSignatures returns a patch that deletes the signature files from
+// META-INF/, along with any APK signing block before the central directory.
+// The manifest is kept, since signing again brings it up to date.
+func RemoveSignatures(inz *zipslicer.Directory) (*binpatch.PatchSet, error) {
+	var signed bool
+	m, err := inz.Mangle(func(f *zipslicer.MangleFile) error {
+		if f.Name != metaInf && f.Name != manifestName && !keepFile(f.Name) {
+			f.Delete()
+			signed = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	trailer, err := inz.GetTrailer()
+	if err != nil {
+		return nil, err
+	}
+	if len(trailer) != 0 {
+		m.DropTrailer()
+		signed = true
+	}
+	if !signed {
+		return nil, sigerrors.NotSignedError{Type: "JAR"}
+	}
+	return m.MakePatch(false)
+}
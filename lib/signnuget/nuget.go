@@ -0,0 +1,100 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package signnuget implements the NuGet package signature format. The
+// signature is a CMS SignedData stored uncompressed as the last file in the
+// package, and signs a hash of the package with the signature file removed.
+package signnuget
+
+import (
+	"crypto"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/sassoftware/relic/v7/lib/pkcs9"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+)
+
+// SigPath is the name of the signature file in the package
+const SigPath = ".signature.p7s"
+
+const (
+	TypeAuthor     = "author"
+	TypeRepository = "repository"
+)
+
+var (
+	OidCommitmentTypeIndication = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 16}
+	OidProofOfOrigin            = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 6, 1}
+	OidProofOfReceipt           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 6, 2}
+	OidSigningCertificateV2     = pkcs9.OidAttributeSigningCertificateV2
+	OidNugetV3ServiceIndexURL   = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 84, 2, 1, 1, 1}
+	OidNugetPackageOwners       = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 84, 2, 1, 1, 2}
+)
+
+type commitmentTypeIndication struct {
+	CommitmentTypeID asn1.ObjectIdentifier
+}
+
+// Content builds the signed content, which holds the package hash
+func Content(hash crypto.Hash, digest []byte) ([]byte, error) {
+	alg, ok := x509tools.PkixDigestAlgorithm(hash)
+	if !ok {
+		return nil, fmt.Errorf("unsupported hash %s", hash)
+	}
+	switch hash {
+	case crypto.SHA256, crypto.SHA384, crypto.SHA512:
+	default:
+		return nil, fmt.Errorf("NuGet signatures require SHA-256, SHA-384 or SHA-512, not %s", hash)
+	}
+	return []byte(fmt.Sprintf("Version:1\r\n\r\n%s-Hash:%s\r\n\r\n", alg.Algorithm, base64.StdEncoding.EncodeToString(digest))), nil
+}
+
+// ParseContent returns the package hash from the signed content
+func ParseContent(blob []byte) (crypto.Hash, []byte, error) {
+	sections := strings.Split(strings.TrimRight(string(blob), "\r\n"), "\r\n\r\n")
+	if len(sections) < 2 || sections[0] != "Version:1" {
+		return 0, nil, errors.New("unsupported NuGet signature content version")
+	}
+	for _, line := range strings.Split(sections[1], "\r\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok || !strings.HasSuffix(key, "-Hash") {
+			continue
+		}
+		var oid asn1.ObjectIdentifier
+		for _, part := range strings.Split(strings.TrimSuffix(key, "-Hash"), ".") {
+			var n int
+			if _, err := fmt.Sscan(part, &n); err != nil {
+				return 0, nil, fmt.Errorf("malformed hash algorithm %q", key)
+			}
+			oid = append(oid, n)
+		}
+		hash, err := x509tools.PkixDigestToHashE(pkix.AlgorithmIdentifier{Algorithm: oid})
+		if err != nil {
+			return 0, nil, err
+		}
+		digest, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return 0, nil, fmt.Errorf("malformed package hash: %w", err)
+		}
+		return hash, digest, nil
+	}
+	return 0, nil, errors.New("package hash not found in NuGet signature")
+}
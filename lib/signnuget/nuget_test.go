@@ -0,0 +1,130 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package signnuget_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sassoftware/relic/v7/internal/testcert"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/signnuget"
+	"github.com/sassoftware/relic/v7/lib/zipslicer"
+)
+
+func testCert(t *testing.T) *certloader.Certificate {
+	return testcert.Signer(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "package author"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}, testcert.RSAKey(t))
+}
+
+func writePackage(t *testing.T) string {
+	fp := filepath.Join(t.TempDir(), "Example.1.0.0.nupkg")
+	f, err := os.Create(fp)
+	require.NoError(t, err)
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for name, contents := range map[string]string{
+		"Example.nuspec":      "<package/>",
+		"lib/net8.0/Ex.dll":   "MZ",
+		"[Content_Types].xml": "<Types/>",
+	} {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+		require.NoError(t, err)
+		_, err = io.WriteString(w, contents)
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	return fp
+}
+
+func signPackage(t *testing.T, fp string, cert *certloader.Certificate, params signnuget.Params) {
+	f, err := os.OpenFile(fp, os.O_RDWR, 0)
+	require.NoError(t, err)
+	defer f.Close()
+	var stream bytes.Buffer
+	require.NoError(t, zipslicer.ZipToTar(f, &stream))
+	patch, _, err := signnuget.Sign(context.Background(), &stream, cert, crypto.SHA256, time.Now(), params)
+	require.NoError(t, err)
+	require.NoError(t, patch.Apply(f, fp))
+}
+
+func verifyPackage(t *testing.T, fp string) (*signnuget.PackageSignature, error) {
+	blob, err := os.ReadFile(fp)
+	require.NoError(t, err)
+	return signnuget.Verify(bytes.NewReader(blob), int64(len(blob)), false)
+}
+
+func TestSignVerify(t *testing.T) {
+	cert := testCert(t)
+	fp := writePackage(t)
+	signPackage(t, fp, cert, signnuget.Params{Type: signnuget.TypeAuthor})
+	sig, err := verifyPackage(t, fp)
+	require.NoError(t, err)
+	assert.Equal(t, signnuget.TypeAuthor, sig.Type)
+	assert.Equal(t, crypto.SHA256, sig.Hash)
+	assert.Equal(t, cert.Leaf.Raw, sig.Signature.Certificate.Raw)
+
+	// re-signing replaces the old signature
+	signPackage(t, fp, cert, signnuget.Params{Type: signnuget.TypeRepository, ServiceIndex: "https://api.example.com/v3/index.json", Owners: []string{"alice", "bob"}})
+	sig, err = verifyPackage(t, fp)
+	require.NoError(t, err)
+	assert.Equal(t, signnuget.TypeRepository, sig.Type)
+	assert.Equal(t, "https://api.example.com/v3/index.json", sig.ServiceIndex)
+	assert.Equal(t, []string{"alice", "bob"}, sig.Owners)
+	zr, err := zip.OpenReader(fp)
+	require.NoError(t, err)
+	defer zr.Close()
+	assert.Len(t, zr.File, 4)
+	assert.Equal(t, signnuget.SigPath, zr.File[3].Name)
+	assert.Equal(t, zip.Store, zr.File[3].Method)
+
+	// tamper with a file
+	blob, err := os.ReadFile(fp)
+	require.NoError(t, err)
+	idx := bytes.Index(blob, []byte("<package/>"))
+	require.True(t, idx >= 0)
+	blob[idx+1] = 'q'
+	require.NoError(t, os.WriteFile(fp, blob, 0644))
+	_, err = verifyPackage(t, fp)
+	assert.Error(t, err)
+}
+
+func TestContent(t *testing.T) {
+	content, err := signnuget.Content(crypto.SHA256, make([]byte, 32))
+	require.NoError(t, err)
+	assert.Equal(t, "Version:1\r\n\r\n2.16.840.1.101.3.4.2.1-Hash:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=\r\n\r\n", string(content))
+	hash, digest, err := signnuget.ParseContent(content)
+	require.NoError(t, err)
+	assert.Equal(t, crypto.SHA256, hash)
+	assert.Equal(t, make([]byte, 32), digest)
+	_, err = signnuget.Content(crypto.SHA1, make([]byte, 20))
+	assert.Error(t, err)
+}
@@ -0,0 +1,135 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package signnuget
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/sassoftware/relic/v7/lib/binpatch"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/pkcs7"
+	"github.com/sassoftware/relic/v7/lib/pkcs9"
+	"github.com/sassoftware/relic/v7/lib/zipslicer"
+)
+
+// Params control the kind of primary signature to create
+type Params struct {
+	// TypeAuthor or TypeRepository
+	Type string
+	// Repository signatures only
+	ServiceIndex string
+	Owners       []string
+}
+
+// Sign a package read from a zip-tar stream, returning a binary patch that
+// replaces any existing signature with the new one
+func Sign(ctx context.Context, r io.Reader, cert *certloader.Certificate, hash crypto.Hash, sigTime time.Time, params Params) (*binpatch.PatchSet, *pkcs9.TimestampedSignature, error) {
+	if _, ok := cert.Leaf.PublicKey.(*rsa.PublicKey); !ok {
+		return nil, nil, errors.New("NuGet signatures require a RSA key")
+	}
+	inz, err := zipslicer.ReadZipTar(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	// the package hash covers everything that will be in the signed package
+	// except the signature file itself
+	d := hash.New()
+	m, err := inz.Mangle(func(f *zipslicer.MangleFile) error {
+		if f.Name == SigPath {
+			f.Delete()
+			return nil
+		}
+		_, err := f.Dump(d)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := m.WriteDirectory(d, false); err != nil {
+		return nil, nil, err
+	}
+	content, err := Content(hash, d.Sum(nil))
+	if err != nil {
+		return nil, nil, err
+	}
+	builder := pkcs7.NewBuilder(cert.Signer(), cert.Chain(), hash)
+	if err := builder.SetContentData(content); err != nil {
+		return nil, nil, err
+	}
+	if err := addAttributes(builder, cert, sigTime, params); err != nil {
+		return nil, nil, err
+	}
+	psd, err := builder.Sign()
+	if err != nil {
+		return nil, nil, err
+	}
+	ts, err := pkcs9.TimestampAndMarshal(ctx, psd, cert.Timestamper, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := m.NewStoredFile(SigPath, ts.Raw, sigTime); err != nil {
+		return nil, nil, err
+	}
+	patch, err := m.MakePatch(false)
+	if err != nil {
+		return nil, nil, err
+	}
+	return patch, ts, nil
+}
+
+func addAttributes(builder *pkcs7.SignatureBuilder, cert *certloader.Certificate, sigTime time.Time, params Params) error {
+	if err := builder.AddAuthenticatedAttribute(pkcs7.OidAttributeSigningTime, sigTime.UTC()); err != nil {
+		return err
+	}
+	if err := builder.AddAuthenticatedAttribute(OidSigningCertificateV2, pkcs9.NewSigningCertificateV2(cert.Leaf)); err != nil {
+		return err
+	}
+	commitment := OidProofOfOrigin
+	switch params.Type {
+	case TypeAuthor, "":
+		if params.ServiceIndex != "" || len(params.Owners) != 0 {
+			return errors.New("service index and owners are only valid for repository signatures")
+		}
+	case TypeRepository:
+		commitment = OidProofOfReceipt
+		if params.ServiceIndex == "" {
+			return errors.New("repository signatures require a service index URL")
+		}
+		if err := builder.AddAuthenticatedAttribute(OidNugetV3ServiceIndexURL, asn1.RawValue{Tag: asn1.TagIA5String, Bytes: []byte(params.ServiceIndex)}); err != nil {
+			return err
+		}
+		if len(params.Owners) != 0 {
+			owners := make([]asn1.RawValue, len(params.Owners))
+			for i, owner := range params.Owners {
+				owners[i] = asn1.RawValue{Tag: asn1.TagUTF8String, Bytes: []byte(owner)}
+			}
+			if err := builder.AddAuthenticatedAttribute(OidNugetPackageOwners, owners); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unknown NuGet signature type %q", params.Type)
+	}
+	return builder.AddAuthenticatedAttribute(OidCommitmentTypeIndication, commitmentTypeIndication{CommitmentTypeID: commitment})
+}
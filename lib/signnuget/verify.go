@@ -0,0 +1,159 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package signnuget
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/sassoftware/relic/v7/lib/pkcs7"
+	"github.com/sassoftware/relic/v7/lib/pkcs9"
+	"github.com/sassoftware/relic/v7/lib/zipslicer"
+)
+
+// PackageSignature describes a verified primary signature
+type PackageSignature struct {
+	Type         string
+	ServiceIndex string
+	Owners       []string
+	Hash         crypto.Hash
+	Signature    *pkcs9.TimestampedSignature
+}
+
+// Verify the primary signature of a package. The certificate chain is not
+// checked.
+func Verify(r io.ReaderAt, size int64, skipDigests bool) (*PackageSignature, error) {
+	dir, err := zipslicer.Read(r, size)
+	if err != nil {
+		return nil, err
+	}
+	idx := -1
+	for i, f := range dir.File {
+		if f.Name == SigPath {
+			idx = i
+		}
+	}
+	if idx < 0 {
+		return nil, errors.New("package is not signed")
+	}
+	sigFile := dir.File[idx]
+	if idx != len(dir.File)-1 {
+		return nil, errors.New("signature file is not the last entry in the central directory")
+	}
+	for _, f := range dir.File[:idx] {
+		if f.Offset > sigFile.Offset {
+			return nil, errors.New("signature file is not the last entry in the package")
+		}
+	}
+	if sigFile.Method != 0 {
+		return nil, errors.New("signature file must not be compressed")
+	}
+	fr, err := sigFile.Open()
+	if err != nil {
+		return nil, err
+	}
+	blob, err := ioutil.ReadAll(fr)
+	if err != nil {
+		return nil, err
+	}
+	psd, err := pkcs7.Unmarshal(blob)
+	if err != nil {
+		return nil, err
+	}
+	if len(psd.Content.SignerInfos) != 1 {
+		return nil, errors.New("expected exactly one primary signature")
+	}
+	sig, err := psd.Content.Verify(nil, false)
+	if err != nil {
+		return nil, err
+	}
+	ts, err := pkcs9.VerifyOptionalTimestamp(sig)
+	if err != nil {
+		return nil, err
+	}
+	content, err := psd.Content.ContentInfo.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	hash, digest, err := ParseContent(content)
+	if err != nil {
+		return nil, err
+	}
+	if !skipDigests {
+		d := hash.New()
+		if err := dir.Truncate(idx, d, d); err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(d.Sum(nil), digest) {
+			return nil, errors.New("package hash mismatch")
+		}
+	}
+	ret := &PackageSignature{Hash: hash, Signature: &ts}
+	if err := ret.parseAttributes(&psd.Content.SignerInfos[0], sig.Certificate); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (s *PackageSignature) parseAttributes(si *pkcs7.SignerInfo, cert *x509.Certificate) error {
+	var raw asn1.RawValue
+	if err := si.AuthenticatedAttributes.GetOne(OidSigningCertificateV2, &raw); err != nil {
+		return err
+	}
+	if err := pkcs9.CheckSigningCertificateV2(raw.FullBytes, cert); err != nil {
+		return err
+	}
+	var cti commitmentTypeIndication
+	if err := si.AuthenticatedAttributes.GetOne(OidCommitmentTypeIndication, &cti); err != nil {
+		return err
+	}
+	switch {
+	case cti.CommitmentTypeID.Equal(OidProofOfOrigin):
+		s.Type = TypeAuthor
+		if !hasCodeSigning(cert) {
+			return errors.New("author certificate is not valid for code signing")
+		}
+	case cti.CommitmentTypeID.Equal(OidProofOfReceipt):
+		s.Type = TypeRepository
+		if err := si.AuthenticatedAttributes.GetOne(OidNugetV3ServiceIndexURL, &s.ServiceIndex); err != nil {
+			return err
+		}
+		if err := si.AuthenticatedAttributes.GetOne(OidNugetPackageOwners, &s.Owners); err != nil {
+			if _, ok := err.(pkcs7.ErrNoAttribute); !ok {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unknown commitment type %s", cti.CommitmentTypeID)
+	}
+	return nil
+}
+
+func hasCodeSigning(cert *x509.Certificate) bool {
+	for _, usage := range cert.ExtKeyUsage {
+		if usage == x509.ExtKeyUsageCodeSigning || usage == x509.ExtKeyUsageAny {
+			return true
+		}
+	}
+	return false
+}
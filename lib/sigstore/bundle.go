@@ -0,0 +1,309 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package sigstore reads and writes Sigstore bundles, the self-contained
+// signature format consumed by cosign, npm and other Sigstore clients.
+package sigstore
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/dsse"
+	"github.com/sassoftware/relic/v7/lib/pkcs7"
+	"github.com/sassoftware/relic/v7/lib/pkcs9"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+)
+
+const (
+	// MediaType is the media type of a v0.3 bundle
+	MediaType = "application/vnd.dev.sigstore.bundle.v0.3+json"
+	// MediaTypeV02 is the media type of an older bundle, still accepted when
+	// reading
+	MediaTypeV02 = "application/vnd.dev.sigstore.bundle+json;version=0.2"
+)
+
+// Bundle holds a signature along with everything needed to verify it
+// offline. Exactly one of DSSEEnvelope and MessageSignature is set.
+type Bundle struct {
+	MediaType            string               `json:"mediaType"`
+	VerificationMaterial VerificationMaterial `json:"verificationMaterial"`
+	DSSEEnvelope         *dsse.Envelope       `json:"dsseEnvelope,omitempty"`
+	MessageSignature     *MessageSignature    `json:"messageSignature,omitempty"`
+}
+
+// VerificationMaterial identifies the signer and optionally proves when the
+// signature was made
+type VerificationMaterial struct {
+	Certificate               *RawBytes                  `json:"certificate,omitempty"`
+	X509CertificateChain      *CertificateChain          `json:"x509CertificateChain,omitempty"`
+	TlogEntries               []json.RawMessage          `json:"tlogEntries,omitempty"`
+	TimestampVerificationData *TimestampVerificationData `json:"timestampVerificationData,omitempty"`
+}
+
+// RawBytes wraps a DER blob
+type RawBytes struct {
+	RawBytes []byte `json:"rawBytes"`
+}
+
+// CertificateChain is the pre-v0.3 way of attaching certificates, leaf first
+type CertificateChain struct {
+	Certificates []RawBytes `json:"certificates"`
+}
+
+// TimestampVerificationData holds RFC 3161 timestamps over the signature
+type TimestampVerificationData struct {
+	RFC3161Timestamps []SignedTimestamp `json:"rfc3161Timestamps"`
+}
+
+// SignedTimestamp is a DER timestamp token
+type SignedTimestamp struct {
+	SignedTimestamp []byte `json:"signedTimestamp"`
+}
+
+// MessageSignature is a plain signature over a digest of an artifact
+type MessageSignature struct {
+	MessageDigest *MessageDigest `json:"messageDigest,omitempty"`
+	Signature     []byte         `json:"signature"`
+}
+
+// MessageDigest names the artifact digest that was signed
+type MessageDigest struct {
+	Algorithm string `json:"algorithm"`
+	Digest    []byte `json:"digest"`
+}
+
+// Verified is the result of verifying a bundle
+type Verified struct {
+	Certificate *x509.Certificate
+	Chain       []*x509.Certificate
+	// Payload is the DSSE payload, if the bundle has an envelope
+	Payload          []byte
+	CounterSignature *pkcs9.CounterSignature
+}
+
+// SignDSSE signs a payload into a DSSE envelope and wraps it in a bundle. If
+// the certificate has a timestamper then the signature is timestamped.
+func SignDSSE(ctx context.Context, cert *certloader.Certificate, payloadType string, payload []byte) (*Bundle, error) {
+	if cert.Leaf == nil {
+		return nil, errors.New("sigstore bundles require a X509 certificate")
+	}
+	env, err := dsse.Sign(cert.Signer(), HashForKey(cert.Leaf.PublicKey), payloadType, payload, "")
+	if err != nil {
+		return nil, err
+	}
+	b := newBundle(cert)
+	b.DSSEEnvelope = env
+	if err := b.timestamp(ctx, cert, env.Signatures[0].Sig); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// SignMessage signs a digest of an artifact and wraps it in a bundle
+func SignMessage(ctx context.Context, cert *certloader.Certificate, hash crypto.Hash, digest []byte) (*Bundle, error) {
+	if cert.Leaf == nil {
+		return nil, errors.New("sigstore bundles require a X509 certificate")
+	}
+	algName, ok := hashNames[hash]
+	if !ok {
+		return nil, fmt.Errorf("unsupported digest algorithm %s", hash)
+	}
+	sig, err := cert.Signer().Sign(rand.Reader, digest, hash)
+	if err != nil {
+		return nil, err
+	}
+	b := newBundle(cert)
+	b.MessageSignature = &MessageSignature{
+		MessageDigest: &MessageDigest{Algorithm: algName, Digest: digest},
+		Signature:     sig,
+	}
+	if err := b.timestamp(ctx, cert, sig); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// newBundle attaches the signing certificate. v0.3 bundles can only hold the
+// leaf, so if there are intermediates then a v0.2 bundle is used instead.
+func newBundle(cert *certloader.Certificate) *Bundle {
+	chain := cert.Chain()
+	if len(chain) < 2 {
+		return &Bundle{
+			MediaType:            MediaType,
+			VerificationMaterial: VerificationMaterial{Certificate: &RawBytes{RawBytes: cert.Leaf.Raw}},
+		}
+	}
+	certs := make([]RawBytes, len(chain))
+	for i, c := range chain {
+		certs[i] = RawBytes{RawBytes: c.Raw}
+	}
+	return &Bundle{
+		MediaType:            MediaTypeV02,
+		VerificationMaterial: VerificationMaterial{X509CertificateChain: &CertificateChain{Certificates: certs}},
+	}
+}
+
+func (b *Bundle) timestamp(ctx context.Context, cert *certloader.Certificate, sig []byte) error {
+	if cert.Timestamper == nil {
+		return nil
+	}
+	tst, err := cert.Timestamper.Timestamp(ctx, &pkcs9.Request{EncryptedDigest: sig, Hash: crypto.SHA256})
+	if err != nil {
+		return err
+	}
+	blob, err := tst.Marshal()
+	if err != nil {
+		return err
+	}
+	b.VerificationMaterial.TimestampVerificationData = &TimestampVerificationData{
+		RFC3161Timestamps: []SignedTimestamp{{SignedTimestamp: blob}},
+	}
+	return nil
+}
+
+// Parse a JSON bundle
+func Parse(blob []byte) (*Bundle, error) {
+	b := new(Bundle)
+	if err := json.Unmarshal(blob, b); err != nil {
+		return nil, fmt.Errorf("parsing sigstore bundle: %w", err)
+	}
+	switch b.MediaType {
+	case MediaType, MediaTypeV02, "application/vnd.dev.sigstore.bundle+json;version=0.3":
+	default:
+		return nil, fmt.Errorf("unsupported sigstore bundle type %q", b.MediaType)
+	}
+	if (b.DSSEEnvelope == nil) == (b.MessageSignature == nil) {
+		return nil, errors.New("sigstore bundle must have exactly one of dsseEnvelope or messageSignature")
+	}
+	return b, nil
+}
+
+// Certificates returns the signing certificate followed by any chain
+// certificates included in the bundle
+func (b *Bundle) Certificates() ([]*x509.Certificate, error) {
+	var ders [][]byte
+	vm := b.VerificationMaterial
+	if vm.Certificate != nil {
+		ders = append(ders, vm.Certificate.RawBytes)
+	} else if vm.X509CertificateChain != nil {
+		for _, c := range vm.X509CertificateChain.Certificates {
+			ders = append(ders, c.RawBytes)
+		}
+	}
+	if len(ders) == 0 {
+		return nil, errors.New("sigstore bundle has no certificate")
+	}
+	certs := make([]*x509.Certificate, len(ders))
+	for i, der := range ders {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("parsing bundle certificate: %w", err)
+		}
+		certs[i] = cert
+	}
+	return certs, nil
+}
+
+// Verify the bundle's signature and timestamp. For message signatures the
+// digest of the artifact must be provided. The certificate chain is not
+// checked.
+func (b *Bundle) Verify(digest []byte) (*Verified, error) {
+	certs, err := b.Certificates()
+	if err != nil {
+		return nil, err
+	}
+	leaf := certs[0]
+	v := &Verified{Certificate: leaf, Chain: certs[1:]}
+	var sig []byte
+	if b.DSSEEnvelope != nil {
+		if err := b.DSSEEnvelope.Verify(leaf.PublicKey, HashForKey(leaf.PublicKey)); err != nil {
+			return nil, err
+		}
+		v.Payload = b.DSSEEnvelope.Payload
+		sig = b.DSSEEnvelope.Signatures[0].Sig
+	} else {
+		ms := b.MessageSignature
+		hash := HashForKey(leaf.PublicKey)
+		if ms.MessageDigest != nil {
+			h, ok := hashByName(ms.MessageDigest.Algorithm)
+			if !ok {
+				return nil, fmt.Errorf("unsupported digest algorithm %q", ms.MessageDigest.Algorithm)
+			}
+			hash = h
+			if digest == nil {
+				digest = ms.MessageDigest.Digest
+			} else if string(digest) != string(ms.MessageDigest.Digest) {
+				return nil, errors.New("sigstore bundle digest does not match the artifact")
+			}
+		}
+		if len(digest) != hash.Size() {
+			return nil, errors.New("artifact digest is missing or the wrong size")
+		}
+		if err := x509tools.Verify(leaf.PublicKey, hash, digest, ms.Signature); err != nil {
+			return nil, err
+		}
+		sig = ms.Signature
+	}
+	if tvd := b.VerificationMaterial.TimestampVerificationData; tvd != nil && len(tvd.RFC3161Timestamps) != 0 {
+		tst, err := pkcs7.Unmarshal(tvd.RFC3161Timestamps[0].SignedTimestamp)
+		if err != nil {
+			return nil, fmt.Errorf("parsing bundle timestamp: %w", err)
+		}
+		cs, err := pkcs9.Verify(tst, sig, nil)
+		if err != nil {
+			return nil, fmt.Errorf("verifying bundle timestamp: %w", err)
+		}
+		v.CounterSignature = cs
+	}
+	return v, nil
+}
+
+// HashForKey returns the digest algorithm Sigstore pairs with a key, since
+// bundles and DSSE signatures don't name one
+func HashForKey(pub crypto.PublicKey) crypto.Hash {
+	if key, ok := pub.(*ecdsa.PublicKey); ok {
+		switch key.Curve.Params().BitSize {
+		case 384:
+			return crypto.SHA384
+		case 521:
+			return crypto.SHA512
+		}
+	}
+	return crypto.SHA256
+}
+
+var hashNames = map[crypto.Hash]string{
+	crypto.SHA256: "SHA2_256",
+	crypto.SHA384: "SHA2_384",
+	crypto.SHA512: "SHA2_512",
+}
+
+func hashByName(name string) (crypto.Hash, bool) {
+	for h, n := range hashNames {
+		if n == name {
+			return h, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,56 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package sigstore
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sassoftware/relic/v7/internal/testcert"
+)
+
+func TestMessageSignature(t *testing.T) {
+	cert := testcert.Signer(t, &x509.Certificate{Subject: pkix.Name{CommonName: "signer"}}, testcert.ECDSAKey(t))
+
+	digest := sha256.Sum256([]byte("artifact"))
+	b, err := SignMessage(context.Background(), cert, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+	blob, err := json.Marshal(b)
+	require.NoError(t, err)
+	assert.Contains(t, string(blob), `"algorithm":"SHA2_256"`)
+	b, err = Parse(blob)
+	require.NoError(t, err)
+	v, err := b.Verify(digest[:])
+	require.NoError(t, err)
+	assert.Equal(t, cert.Leaf.Raw, v.Certificate.Raw)
+	assert.Nil(t, v.CounterSignature)
+
+	other := sha256.Sum256([]byte("tampered"))
+	_, err = b.Verify(other[:])
+	assert.Error(t, err)
+	b.MessageSignature.Signature[8] ^= 1
+	_, err = b.Verify(nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,193 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package slsa builds SLSA v1 provenance predicates for in-toto statements.
+package slsa
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sassoftware/relic/v7/lib/intoto"
+)
+
+const (
+	// PredicateType is the SLSA v1 provenance predicate type
+	PredicateType = "https://slsa.dev/provenance/v1"
+	// DefaultBuilderID is used when the caller doesn't identify the builder
+	DefaultBuilderID = "https://github.com/sassoftware/relic"
+)
+
+// Provenance is a SLSA v1 provenance predicate
+type Provenance struct {
+	BuildDefinition BuildDefinition `json:"buildDefinition"`
+	RunDetails      RunDetails      `json:"runDetails"`
+}
+
+// BuildDefinition is the part of the provenance describing the inputs
+type BuildDefinition struct {
+	BuildType            string                 `json:"buildType"`
+	ExternalParameters   map[string]interface{} `json:"externalParameters"`
+	ResolvedDependencies []ResourceDescriptor   `json:"resolvedDependencies,omitempty"`
+}
+
+// ResourceDescriptor identifies a build input
+type ResourceDescriptor struct {
+	URI    string            `json:"uri"`
+	Digest map[string]string `json:"digest,omitempty"`
+}
+
+// RunDetails is the part of the provenance describing the builder
+type RunDetails struct {
+	Builder  Builder        `json:"builder"`
+	Metadata *BuildMetadata `json:"metadata,omitempty"`
+}
+
+// Builder identifies the build platform
+type Builder struct {
+	ID string `json:"id"`
+}
+
+// BuildMetadata identifies one run of the builder
+type BuildMetadata struct {
+	InvocationID string     `json:"invocationId,omitempty"`
+	StartedOn    *time.Time `json:"startedOn,omitempty"`
+	FinishedOn   *time.Time `json:"finishedOn,omitempty"`
+}
+
+// BuildInfo describes how an artifact was built
+type BuildInfo struct {
+	BuildType          string
+	BuilderID          string
+	InvocationID       string
+	ExternalParameters map[string]interface{}
+	Materials          []ResourceDescriptor
+	StartedOn          time.Time
+	FinishedOn         time.Time
+}
+
+// NewProvenance returns a provenance predicate. BuildType is required and
+// BuilderID defaults to DefaultBuilderID.
+func NewProvenance(info BuildInfo) *Provenance {
+	pred := &Provenance{
+		BuildDefinition: BuildDefinition{
+			BuildType:            info.BuildType,
+			ExternalParameters:   info.ExternalParameters,
+			ResolvedDependencies: info.Materials,
+		},
+		RunDetails: RunDetails{Builder: Builder{ID: info.BuilderID}},
+	}
+	if pred.BuildDefinition.ExternalParameters == nil {
+		pred.BuildDefinition.ExternalParameters = make(map[string]interface{})
+	}
+	if pred.RunDetails.Builder.ID == "" {
+		pred.RunDetails.Builder.ID = DefaultBuilderID
+	}
+	meta := &BuildMetadata{InvocationID: info.InvocationID}
+	if !info.StartedOn.IsZero() {
+		t := info.StartedOn.UTC().Truncate(time.Second)
+		meta.StartedOn = &t
+	}
+	if !info.FinishedOn.IsZero() {
+		t := info.FinishedOn.UTC().Truncate(time.Second)
+		meta.FinishedOn = &t
+	}
+	if *meta != (BuildMetadata{}) {
+		pred.RunDetails.Metadata = meta
+	}
+	return pred
+}
+
+// Statement returns an in-toto statement holding SLSA provenance for the
+// given subjects
+func Statement(subjects []intoto.Subject, info BuildInfo) (*intoto.Statement, error) {
+	blob, err := json.Marshal(NewProvenance(info))
+	if err != nil {
+		return nil, err
+	}
+	return &intoto.Statement{
+		Type:          intoto.StatementType,
+		Subject:       subjects,
+		PredicateType: PredicateType,
+		Predicate:     blob,
+	}, nil
+}
+
+// Parse the provenance predicate from a statement
+func Parse(stmt *intoto.Statement) (*Provenance, error) {
+	if stmt.PredicateType != PredicateType {
+		return nil, fmt.Errorf("unexpected provenance predicate type %q", stmt.PredicateType)
+	}
+	prov := new(Provenance)
+	if err := json.Unmarshal(stmt.Predicate, prov); err != nil {
+		return nil, fmt.Errorf("parsing provenance: %w", err)
+	}
+	return prov, nil
+}
+
+// FileDigest returns the SHA-256 digest set of a file
+func FileDigest(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	d := sha256.New()
+	if _, err := io.Copy(d, f); err != nil {
+		return nil, err
+	}
+	return map[string]string{"sha256": hex.EncodeToString(d.Sum(nil))}, nil
+}
+
+// FileSubject returns a statement subject for a file, named by its base name
+func FileSubject(path string) (intoto.Subject, error) {
+	digest, err := FileDigest(path)
+	if err != nil {
+		return intoto.Subject{}, err
+	}
+	return intoto.Subject{Name: filepath.Base(path), Digest: digest}, nil
+}
+
+var materialDigest = regexp.MustCompile(`^([a-zA-Z0-9]+):([0-9a-fA-F]+)$`)
+
+// ParseMaterial parses a build input given as URI=ALGORITHM:HEX, a bare URI,
+// or the path of a local file which is then hashed
+func ParseMaterial(s string) (ResourceDescriptor, error) {
+	if i := strings.LastIndexByte(s, '='); i > 0 {
+		if m := materialDigest.FindStringSubmatch(s[i+1:]); m != nil {
+			return ResourceDescriptor{URI: s[:i], Digest: map[string]string{m[1]: strings.ToLower(m[2])}}, nil
+		}
+	}
+	if !strings.Contains(s, ":") {
+		if st, err := os.Stat(s); err == nil && st.Mode().IsRegular() {
+			digest, err := FileDigest(s)
+			if err != nil {
+				return ResourceDescriptor{}, err
+			}
+			return ResourceDescriptor{URI: filepath.ToSlash(s), Digest: digest}, nil
+		}
+		return ResourceDescriptor{}, fmt.Errorf("material %q is neither a URI nor a file", s)
+	}
+	return ResourceDescriptor{URI: s}, nil
+}
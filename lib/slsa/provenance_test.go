@@ -0,0 +1,89 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package slsa
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sassoftware/relic/v7/lib/intoto"
+)
+
+func TestStatement(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), "hello.txt")
+	require.NoError(t, os.WriteFile(fp, []byte("hello\n"), 0644))
+	subj, err := FileSubject(fp)
+	require.NoError(t, err)
+	assert.Equal(t, "hello.txt", subj.Name)
+	assert.Equal(t, "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03", subj.Digest["sha256"])
+
+	started := time.Date(2024, 1, 2, 3, 4, 5, 600, time.UTC)
+	stmt, err := Statement([]intoto.Subject{subj}, BuildInfo{
+		BuildType:    "https://example.com/build/v1",
+		InvocationID: "job-1",
+		Materials:    []ResourceDescriptor{{URI: "git+https://example.com/repo", Digest: map[string]string{"gitCommit": "abc"}}},
+		StartedOn:    started,
+	})
+	require.NoError(t, err)
+	blob, err := json.Marshal(stmt)
+	require.NoError(t, err)
+	parsed, err := intoto.Parse(blob)
+	require.NoError(t, err)
+	digest, err := hex.DecodeString(subj.Digest["sha256"])
+	require.NoError(t, err)
+	assert.NoError(t, parsed.CheckSubjectDigest("hello.txt", "sha256", digest))
+	prov, err := Parse(parsed)
+	require.NoError(t, err)
+	assert.Equal(t, DefaultBuilderID, prov.RunDetails.Builder.ID)
+	assert.Equal(t, "job-1", prov.RunDetails.Metadata.InvocationID)
+	assert.Equal(t, started.Truncate(time.Second), *prov.RunDetails.Metadata.StartedOn)
+	assert.Nil(t, prov.RunDetails.Metadata.FinishedOn)
+	assert.Equal(t, "abc", prov.BuildDefinition.ResolvedDependencies[0].Digest["gitCommit"])
+	assert.NotNil(t, prov.BuildDefinition.ExternalParameters)
+
+	parsed.PredicateType = "https://example.com/other"
+	_, err = Parse(parsed)
+	assert.Error(t, err)
+}
+
+func TestParseMaterial(t *testing.T) {
+	rd, err := ParseMaterial("git+https://example.com/repo@refs/heads/main=gitCommit:ABCDEF")
+	require.NoError(t, err)
+	assert.Equal(t, "git+https://example.com/repo@refs/heads/main", rd.URI)
+	assert.Equal(t, map[string]string{"gitCommit": "abcdef"}, rd.Digest)
+
+	rd, err = ParseMaterial("https://example.com/dl?x=1")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/dl?x=1", rd.URI)
+	assert.Nil(t, rd.Digest)
+
+	fp := filepath.Join(t.TempDir(), "input.bin")
+	require.NoError(t, os.WriteFile(fp, []byte("hello\n"), 0644))
+	rd, err = ParseMaterial(fp)
+	require.NoError(t, err)
+	assert.Equal(t, "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03", rd.Digest["sha256"])
+
+	_, err = ParseMaterial("no-such-file")
+	assert.Error(t, err)
+}
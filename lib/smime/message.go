@@ -0,0 +1,178 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package smime signs and verifies RFC 822 messages using S/MIME (RFC 8551)
+// in either the multipart/signed or the opaque application/pkcs7-mime form.
+package smime
+
+import (
+	"bytes"
+	"mime"
+	"mime/quotedprintable"
+	"strings"
+)
+
+var crlf = []byte("\r\n")
+
+// message is a RFC 822 message split into its header fields and body
+type message struct {
+	// raw header fields, each with continuation lines but without the final
+	// line ending
+	headers []string
+	body    []byte
+}
+
+// parseMessage splits a message into headers and body. Line endings are
+// normalized to CRLF. Input that doesn't start with a header field is all
+// body.
+func parseMessage(blob []byte) *message {
+	blob = canonicalize(blob)
+	m := new(message)
+	if !startsWithHeader(blob) {
+		m.body = blob
+		return m
+	}
+	for len(blob) > 0 {
+		var line []byte
+		if i := bytes.Index(blob, crlf); i >= 0 {
+			line, blob = blob[:i], blob[i+2:]
+		} else {
+			line, blob = blob, nil
+		}
+		if len(line) == 0 {
+			break
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(m.headers) > 0 {
+			m.headers[len(m.headers)-1] += "\r\n" + string(line)
+		} else {
+			m.headers = append(m.headers, string(line))
+		}
+	}
+	m.body = blob
+	return m
+}
+
+func startsWithHeader(blob []byte) bool {
+	i := bytes.IndexByte(blob, ':')
+	if i <= 0 {
+		return false
+	}
+	for _, c := range blob[:i] {
+		if c <= ' ' || c >= 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// canonicalize converts line endings to CRLF
+func canonicalize(blob []byte) []byte {
+	blob = bytes.ReplaceAll(blob, crlf, []byte("\n"))
+	return bytes.ReplaceAll(blob, []byte("\n"), crlf)
+}
+
+func headerName(field string) string {
+	name, _, _ := strings.Cut(field, ":")
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+func headerValue(field string) string {
+	_, value, _ := strings.Cut(field, ":")
+	// unfold
+	value = strings.ReplaceAll(value, "\r\n", "")
+	return strings.TrimSpace(value)
+}
+
+// get returns the first header with the given name
+func (m *message) get(name string) string {
+	name = strings.ToLower(name)
+	for _, field := range m.headers {
+		if headerName(field) == name {
+			return headerValue(field)
+		}
+	}
+	return ""
+}
+
+// isContentHeader is true for headers that describe the MIME entity, as
+// opposed to the message as a whole
+func isContentHeader(field string) bool {
+	return strings.HasPrefix(headerName(field), "content-")
+}
+
+// split separates the message headers from the MIME entity, which is
+// returned in canonical form. Bodies without a transfer encoding that
+// aren't 7-bit clean are quoted-printable encoded so they survive transport
+// unchanged.
+func (m *message) split() (outer []string, entity []byte) {
+	var inner []string
+	for _, field := range m.headers {
+		if isContentHeader(field) {
+			inner = append(inner, field)
+		} else if headerName(field) != "mime-version" {
+			outer = append(outer, field)
+		}
+	}
+	body := m.body
+	if m.get("Content-Type") == "" {
+		inner = append(inner, "Content-Type: text/plain; charset=utf-8")
+	}
+	if m.get("Content-Transfer-Encoding") == "" && !is7bit(body) {
+		inner = append(inner, "Content-Transfer-Encoding: quoted-printable")
+		body = encodeQP(body)
+	}
+	var buf bytes.Buffer
+	for _, field := range inner {
+		buf.WriteString(field)
+		buf.Write(crlf)
+	}
+	buf.Write(crlf)
+	buf.Write(body)
+	return outer, buf.Bytes()
+}
+
+// is7bit checks for 8-bit characters and lines that are too long
+func is7bit(body []byte) bool {
+	for _, line := range bytes.Split(body, crlf) {
+		if len(line) > 998 {
+			return false
+		}
+		for _, c := range line {
+			if c == 0 || c >= 0x80 || c == '\r' || c == '\n' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func encodeQP(body []byte) []byte {
+	var buf bytes.Buffer
+	w := quotedprintable.NewWriter(&buf)
+	_, _ = w.Write(body)
+	_ = w.Close()
+	return canonicalize(buf.Bytes())
+}
+
+// mediaType parses a Content-Type header, returning the lowercased media
+// type and its parameters
+func mediaType(value string) (string, map[string]string) {
+	mt, params, err := mime.ParseMediaType(value)
+	if err != nil {
+		return strings.ToLower(value), nil
+	}
+	return mt, params
+}
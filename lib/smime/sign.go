@@ -0,0 +1,133 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package smime
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/pkcs7"
+	"github.com/sassoftware/relic/v7/lib/pkcs9"
+)
+
+// micalg parameter values from RFC 5751
+var micalgs = map[crypto.Hash]string{
+	crypto.SHA1:   "sha-1",
+	crypto.SHA224: "sha-224",
+	crypto.SHA256: "sha-256",
+	crypto.SHA384: "sha-384",
+	crypto.SHA512: "sha-512",
+}
+
+// Sign a RFC 822 message. If opaque is true then the result is an
+// application/pkcs7-mime message with the content inside the signature,
+// otherwise it is multipart/signed with a detached signature.
+func Sign(ctx context.Context, blob []byte, cert *certloader.Certificate, hash crypto.Hash, sigTime time.Time, opaque bool) ([]byte, *pkcs9.TimestampedSignature, error) {
+	micalg := micalgs[hash]
+	if micalg == "" {
+		return nil, nil, errors.New("unsupported hash for S/MIME")
+	}
+	m := parseMessage(blob)
+	if mt, _ := mediaType(m.get("Content-Type")); mt == "multipart/signed" || mt == "application/pkcs7-mime" {
+		return nil, nil, errors.New("message is already signed")
+	}
+	outer, entity := m.split()
+	builder := pkcs7.NewBuilder(cert.Signer(), cert.Chain(), hash)
+	if err := builder.SetContentData(entity); err != nil {
+		return nil, nil, err
+	}
+	if err := builder.AddAuthenticatedAttribute(pkcs7.OidAttributeSigningTime, sigTime.UTC()); err != nil {
+		return nil, nil, err
+	}
+	psd, err := builder.Sign()
+	if err != nil {
+		return nil, nil, err
+	}
+	ts, err := pkcs9.TimestampAndMarshal(ctx, psd, cert.Timestamper, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	var buf bytes.Buffer
+	for _, field := range outer {
+		buf.WriteString(field)
+		buf.Write(crlf)
+	}
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	if opaque {
+		buf.WriteString("Content-Type: application/pkcs7-mime; smime-type=signed-data; name=\"smime.p7m\"\r\n")
+		buf.WriteString("Content-Transfer-Encoding: base64\r\n")
+		buf.WriteString("Content-Disposition: attachment; filename=\"smime.p7m\"\r\n\r\n")
+		writeBase64(&buf, ts.Raw)
+		return buf.Bytes(), ts, nil
+	}
+	if _, err := psd.Detach(); err != nil {
+		return nil, nil, err
+	}
+	detached, err := psd.Marshal()
+	if err != nil {
+		return nil, nil, err
+	}
+	ts.Raw = detached
+	boundary, err := newBoundary(entity)
+	if err != nil {
+		return nil, nil, err
+	}
+	fmt.Fprintf(&buf, "Content-Type: multipart/signed; protocol=\"application/pkcs7-signature\"; micalg=%s;\r\n\tboundary=\"%s\"\r\n\r\n", micalg, boundary)
+	buf.WriteString("This is an S/MIME signed message\r\n\r\n")
+	fmt.Fprintf(&buf, "--%s\r\n", boundary)
+	buf.Write(entity)
+	fmt.Fprintf(&buf, "\r\n--%s\r\n", boundary)
+	buf.WriteString("Content-Type: application/pkcs7-signature; name=\"smime.p7s\"\r\n")
+	buf.WriteString("Content-Transfer-Encoding: base64\r\n")
+	buf.WriteString("Content-Disposition: attachment; filename=\"smime.p7s\"\r\n\r\n")
+	writeBase64(&buf, detached)
+	fmt.Fprintf(&buf, "\r\n--%s--\r\n", boundary)
+	return buf.Bytes(), ts, nil
+}
+
+// newBoundary makes a random boundary that doesn't occur in the entity
+func newBoundary(entity []byte) (string, error) {
+	for {
+		var b [16]byte
+		if _, err := rand.Read(b[:]); err != nil {
+			return "", err
+		}
+		boundary := "----=_smime_" + hex.EncodeToString(b[:])
+		if !bytes.Contains(entity, []byte(boundary)) {
+			return boundary, nil
+		}
+	}
+}
+
+func writeBase64(buf *bytes.Buffer, blob []byte) {
+	encoded := base64.StdEncoding.EncodeToString(blob)
+	for len(encoded) > 76 {
+		buf.WriteString(encoded[:76])
+		buf.Write(crlf)
+		encoded = encoded[76:]
+	}
+	buf.WriteString(encoded)
+	buf.Write(crlf)
+}
@@ -0,0 +1,88 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package smime_test
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sassoftware/relic/v7/internal/testcert"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/smime"
+	"github.com/sassoftware/relic/v7/signers/sigerrors"
+)
+
+const testMessage = "From: releases@example.com\n" +
+	"To: announce@example.com\n" +
+	"Subject: Release 1.0\n" +
+	"\n" +
+	"Version 1.0 is now available. Größere Änderungen folgen.\n"
+
+func testCert(t *testing.T) *certloader.Certificate {
+	return testcert.Signer(t, &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "release signer"},
+		EmailAddresses: []string{"releases@example.com"},
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection},
+	}, testcert.RSAKey(t))
+}
+
+func TestSignVerify(t *testing.T) {
+	cert := testCert(t)
+	_, err := smime.Verify([]byte(testMessage), false)
+	assert.ErrorAs(t, err, &sigerrors.NotSignedError{})
+	for _, opaque := range []bool{false, true} {
+		signed, ts, err := smime.Sign(context.Background(), []byte(testMessage), cert, crypto.SHA256, time.Now(), opaque)
+		require.NoError(t, err)
+		assert.NotNil(t, ts)
+		assert.True(t, bytes.HasPrefix(signed, []byte("From: releases@example.com\r\n")))
+		assert.Contains(t, string(signed), "Subject: Release 1.0\r\n")
+		sig, err := smime.Verify(signed, false)
+		require.NoError(t, err)
+		assert.Equal(t, opaque, sig.Opaque)
+		assert.Equal(t, cert.Leaf, sig.Signature.Certificate)
+		assert.Contains(t, string(sig.Content), "Content-Transfer-Encoding: quoted-printable\r\n")
+		assert.Contains(t, string(sig.Content), "Version 1.0 is now available.")
+
+		// line endings converted in transit don't matter
+		lf := bytes.ReplaceAll(signed, []byte("\r\n"), []byte("\n"))
+		_, err = smime.Verify(lf, false)
+		assert.NoError(t, err)
+
+		_, _, err = smime.Sign(context.Background(), signed, cert, crypto.SHA256, time.Now(), opaque)
+		assert.Error(t, err, "already signed")
+	}
+}
+
+func TestTamper(t *testing.T) {
+	signed, _, err := smime.Sign(context.Background(), []byte(testMessage), testCert(t), crypto.SHA256, time.Now(), false)
+	require.NoError(t, err)
+	tampered := bytes.Replace(signed, []byte("Version 1.0"), []byte("Version 6.6"), 1)
+	_, err = smime.Verify(tampered, false)
+	assert.Error(t, err)
+	// headers outside the signed entity are not covered
+	retitled := bytes.Replace(signed, []byte("Subject: Release 1.0"), []byte("Subject: Fwd: Release 1.0"), 1)
+	_, err = smime.Verify(retitled, false)
+	assert.NoError(t, err)
+}
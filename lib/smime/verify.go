@@ -0,0 +1,157 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package smime
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/sassoftware/relic/v7/lib/pkcs7"
+	"github.com/sassoftware/relic/v7/lib/pkcs9"
+	"github.com/sassoftware/relic/v7/signers/sigerrors"
+)
+
+// Signature describes a verified S/MIME message
+type Signature struct {
+	Opaque bool
+	// Content is the signed MIME entity, in canonical form
+	Content   []byte
+	Signature *pkcs9.TimestampedSignature
+}
+
+// Verify a signed message. The certificate chain is not checked.
+func Verify(blob []byte, skipDigests bool) (*Signature, error) {
+	m := parseMessage(blob)
+	mt, params := mediaType(m.get("Content-Type"))
+	var content, der []byte
+	var err error
+	ret := new(Signature)
+	switch mt {
+	case "multipart/signed":
+		switch protocol := strings.ToLower(params["protocol"]); protocol {
+		case "application/pkcs7-signature", "application/x-pkcs7-signature":
+		default:
+			return nil, fmt.Errorf("unsupported multipart/signed protocol %q", protocol)
+		}
+		content, der, err = splitSigned(m.body, params["boundary"])
+		if err != nil {
+			return nil, err
+		}
+	case "application/pkcs7-mime", "application/x-pkcs7-mime":
+		if smimeType := strings.ToLower(params["smime-type"]); smimeType != "" && smimeType != "signed-data" {
+			return nil, fmt.Errorf("unsupported smime-type %q", smimeType)
+		}
+		der, err = decodeBody(m)
+		if err != nil {
+			return nil, err
+		}
+		ret.Opaque = true
+	default:
+		return nil, sigerrors.NotSignedError{Type: "S/MIME"}
+	}
+	psd, err := pkcs7.Unmarshal(der)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := psd.Content.Verify(content, skipDigests)
+	if err != nil {
+		return nil, err
+	}
+	ts, err := pkcs9.VerifyOptionalTimestamp(sig)
+	if err != nil {
+		return nil, err
+	}
+	if ret.Opaque {
+		content, err = psd.Content.ContentInfo.Bytes()
+		if err != nil {
+			return nil, err
+		}
+	}
+	ret.Content = content
+	ret.Signature = &ts
+	return ret, nil
+}
+
+// splitSigned returns the signed entity and the decoded signature from the
+// body of a multipart/signed message
+func splitSigned(body []byte, boundary string) ([]byte, []byte, error) {
+	if boundary == "" {
+		return nil, nil, errors.New("multipart/signed message has no boundary")
+	}
+	delim := []byte("\r\n--" + boundary)
+	// the first delimiter may be at the very start of the body
+	body = append(append([]byte{}, crlf...), body...)
+	i := bytes.Index(body, delim)
+	if i < 0 {
+		return nil, nil, errors.New("multipart/signed message has no parts")
+	}
+	body = body[i+len(delim):]
+	var parts [][]byte
+	for !bytes.HasPrefix(body, []byte("--")) {
+		// skip transport padding and the line ending after the delimiter
+		eol := bytes.Index(body, crlf)
+		if eol < 0 {
+			return nil, nil, errors.New("multipart/signed message is truncated")
+		}
+		body = body[eol+2:]
+		i := bytes.Index(body, delim)
+		if i < 0 {
+			return nil, nil, errors.New("multipart/signed message is truncated")
+		}
+		parts = append(parts, body[:i])
+		body = body[i+len(delim):]
+	}
+	if len(parts) != 2 {
+		return nil, nil, errors.New("multipart/signed message must have exactly two parts")
+	}
+	content := parts[0]
+	sigPart := parseMessage(parts[1])
+	switch mt, _ := mediaType(sigPart.get("Content-Type")); mt {
+	case "application/pkcs7-signature", "application/x-pkcs7-signature":
+	default:
+		return nil, nil, fmt.Errorf("unexpected signature type %q", mt)
+	}
+	der, err := decodeBody(sigPart)
+	if err != nil {
+		return nil, nil, err
+	}
+	return content, der, nil
+}
+
+func decodeBody(m *message) ([]byte, error) {
+	switch cte := strings.ToLower(m.get("Content-Transfer-Encoding")); cte {
+	case "base64":
+		stripped := bytes.Map(func(r rune) rune {
+			if r == '\r' || r == '\n' || r == ' ' || r == '\t' {
+				return -1
+			}
+			return r
+		}, m.body)
+		der, err := base64.StdEncoding.DecodeString(string(stripped))
+		if err != nil {
+			return nil, fmt.Errorf("decoding signature: %w", err)
+		}
+		return der, nil
+	case "binary", "":
+		return m.body, nil
+	default:
+		return nil, fmt.Errorf("unsupported transfer encoding %q for signature", cte)
+	}
+}
@@ -0,0 +1,273 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package snapassert assembles, signs and verifies snapd assertions such as
+// account-key, snap-build and snap-revision.
+package snapassert
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+	"golang.org/x/crypto/sha3"
+
+	"github.com/sassoftware/relic/v7/lib/pgptools"
+)
+
+// snapd only accepts SHA-512 signatures from RSA keys
+const Hash = crypto.SHA512
+
+var v1Header = []byte{0x1}
+
+// Headers that come before the others, in this order, for each assertion type
+var primaryKeys = map[string][]string{
+	"account":          {"account-id"},
+	"account-key":      {"public-key-sha3-384"},
+	"model":            {"series", "brand-id", "model"},
+	"snap-build":       {"snap-sha3-384"},
+	"snap-declaration": {"series", "snap-id"},
+	"snap-revision":    {"snap-sha3-384"},
+}
+
+// KeyID returns the sign-key-sha3-384 identifier snapd uses for a public key
+func KeyID(pub *packet.PublicKey) (string, error) {
+	h := sha3.New384()
+	h.Write(v1Header)
+	if err := pub.Serialize(h); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+// EncodePublicKey returns a public key in the form used in the body of an
+// account-key assertion
+func EncodePublicKey(pub *packet.PublicKey) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(v1Header)
+	if err := pub.Serialize(&buf); err != nil {
+		return nil, err
+	}
+	return encodeFormatAndData(buf.Bytes()), nil
+}
+
+func encodeFormatAndData(data []byte) []byte {
+	return []byte("openpgp " + base64.StdEncoding.EncodeToString(data))
+}
+
+// Assemble the signed portion of an assertion. Header values may be strings,
+// lists or maps, nested in the same way.
+func Assemble(headers map[string]interface{}, body []byte, keyID string) ([]byte, error) {
+	assertType, _ := headers["type"].(string)
+	if assertType == "" {
+		return nil, errors.New("assertion type header is missing")
+	}
+	if s, _ := headers["authority-id"].(string); s == "" {
+		return nil, errors.New("authority-id header is missing")
+	}
+	for _, name := range []string{"body-length", "sign-key-sha3-384"} {
+		if _, ok := headers[name]; ok {
+			return nil, fmt.Errorf("header %s is set automatically", name)
+		}
+	}
+	var buf bytes.Buffer
+	buf.WriteString("type: ")
+	buf.WriteString(assertType)
+	written := map[string]bool{"type": true}
+	order := []string{"format", "authority-id", "revision"}
+	order = append(order, primaryKeys[assertType]...)
+	var rest []string
+	for name := range headers {
+		rest = append(rest, name)
+	}
+	sort.Strings(rest)
+	for _, name := range append(order, rest...) {
+		value, ok := headers[name]
+		if !ok || written[name] {
+			continue
+		}
+		written[name] = true
+		if err := appendEntry(&buf, name+":", value, 0); err != nil {
+			return nil, fmt.Errorf("header %s: %w", name, err)
+		}
+	}
+	if len(body) != 0 {
+		fmt.Fprintf(&buf, "\nbody-length: %d", len(body))
+	}
+	buf.WriteString("\nsign-key-sha3-384: ")
+	buf.WriteString(keyID)
+	if len(body) != 0 {
+		buf.WriteString("\n\n")
+		buf.Write(body)
+	}
+	return buf.Bytes(), nil
+}
+
+func appendEntry(buf *bytes.Buffer, intro string, v interface{}, indent int) error {
+	switch x := v.(type) {
+	case nil:
+	case float64:
+		return appendEntry(buf, intro, strconv.FormatFloat(x, 'f', -1, 64), indent)
+	case string:
+		buf.WriteByte('\n')
+		buf.WriteString(intro)
+		if strings.Contains(x, "\n") {
+			pfx := strings.Repeat(" ", indent) + "    "
+			buf.WriteByte('\n')
+			buf.WriteString(pfx)
+			x = strings.ReplaceAll(x, "\n", "\n"+pfx)
+		} else {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(x)
+	case []interface{}:
+		if len(x) == 0 {
+			return nil
+		}
+		buf.WriteByte('\n')
+		buf.WriteString(intro)
+		pfx := strings.Repeat(" ", indent) + "  -"
+		for _, elem := range x {
+			if err := appendEntry(buf, pfx, elem, indent+2); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		if len(x) == 0 {
+			return nil
+		}
+		buf.WriteByte('\n')
+		buf.WriteString(intro)
+		keys := make([]string, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		pfx := strings.Repeat(" ", indent) + "  "
+		for _, k := range keys {
+			if err := appendEntry(buf, pfx+k+":", x[k], indent+2); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported value of type %T", v)
+	}
+	return nil
+}
+
+// Sign assembles and signs an assertion, returning it in the form accepted by
+// "snap ack"
+func Sign(headers map[string]interface{}, body []byte, key *packet.PrivateKey, sigTime time.Time) ([]byte, error) {
+	if key.PubKeyAlgo != packet.PubKeyAlgoRSA && key.PubKeyAlgo != packet.PubKeyAlgoRSASignOnly {
+		return nil, errors.New("snap assertions must be signed with a RSA key")
+	}
+	keyID, err := KeyID(&key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	content, err := Assemble(headers, body, keyID)
+	if err != nil {
+		return nil, err
+	}
+	sig := &packet.Signature{
+		SigType:      packet.SigTypeBinary,
+		PubKeyAlgo:   key.PubKeyAlgo,
+		Hash:         Hash,
+		CreationTime: sigTime,
+		IssuerKeyId:  &key.KeyId,
+	}
+	h := Hash.New()
+	h.Write(content)
+	if err := sig.Sign(h, key, &packet.Config{DefaultHash: Hash}); err != nil {
+		return nil, err
+	}
+	var sigBuf bytes.Buffer
+	if err := sig.Serialize(&sigBuf); err != nil {
+		return nil, err
+	}
+	content = append(content, "\n\n"...)
+	content = append(content, encodeFormatAndData(sigBuf.Bytes())...)
+	content = append(content, '\n')
+	return content, nil
+}
+
+// Assertion is a parsed and verified assertion
+type Assertion struct {
+	Type      string
+	Headers   map[string]string
+	Body      []byte
+	Signature *pgptools.PgpSignature
+}
+
+// Verify the signature of an assertion. Nested header values are not parsed
+// and are omitted from Headers.
+func Verify(blob []byte, keyring openpgp.EntityList) (*Assertion, error) {
+	blob = bytes.TrimRight(blob, "\n")
+	idx := bytes.LastIndex(blob, []byte("\n\n"))
+	if idx < 0 {
+		return nil, errors.New("malformed assertion: signature not found")
+	}
+	content, encodedSig := blob[:idx], string(blob[idx+2:])
+	if !strings.HasPrefix(encodedSig, "openpgp ") {
+		return nil, errors.New("malformed assertion: unsupported signature format")
+	}
+	rawSig, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(encodedSig, "openpgp "))
+	if err != nil {
+		return nil, fmt.Errorf("malformed assertion: %w", err)
+	}
+	a := &Assertion{Headers: make(map[string]string)}
+	head := content
+	if idx := bytes.Index(content, []byte("\n\n")); idx >= 0 {
+		head, a.Body = content[:idx], content[idx+2:]
+	}
+	for _, line := range strings.Split(string(head), "\n") {
+		if strings.HasPrefix(line, " ") {
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("malformed assertion header: %q", line)
+		}
+		if value = strings.TrimPrefix(value, " "); value != "" {
+			a.Headers[name] = value
+		}
+	}
+	a.Type = a.Headers["type"]
+	if n, _ := strconv.Atoi(a.Headers["body-length"]); n != len(a.Body) {
+		return nil, errors.New("malformed assertion: body length mismatch")
+	}
+	sig, err := pgptools.VerifyDetached(bytes.NewReader(rawSig), bytes.NewReader(content), keyring)
+	if err != nil {
+		return nil, err
+	}
+	keyID, err := KeyID(sig.Key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if keyID != a.Headers["sign-key-sha3-384"] {
+		return nil, errors.New("sign-key-sha3-384 does not match the signing key")
+	}
+	a.Signature = sig
+	return a, nil
+}
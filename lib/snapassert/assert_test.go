@@ -0,0 +1,89 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package snapassert_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+
+	"github.com/sassoftware/relic/v7/lib/snapassert"
+)
+
+func TestAssemble(t *testing.T) {
+	headers := map[string]interface{}{
+		"type":          "snap-revision",
+		"authority-id":  "canonical",
+		"snap-sha3-384": "abc",
+		"snap-id":       "xyz",
+		"snap-revision": float64(3),
+		"refs":          []interface{}{"a", map[string]interface{}{"y": "1", "x": "2"}},
+		"note":          "line1\nline2",
+	}
+	content, err := snapassert.Assemble(headers, []byte("body"), "KEY")
+	require.NoError(t, err)
+	expected := `type: snap-revision
+authority-id: canonical
+snap-sha3-384: abc
+note:
+    line1
+    line2
+refs:
+  - a
+  -
+    x: 2
+    y: 1
+snap-id: xyz
+snap-revision: 3
+body-length: 4
+sign-key-sha3-384: KEY
+
+body`
+	assert.Equal(t, expected, string(content))
+
+	_, err = snapassert.Assemble(map[string]interface{}{"type": "account"}, nil, "KEY")
+	assert.Error(t, err)
+}
+
+func TestSignVerify(t *testing.T) {
+	entity, err := openpgp.NewEntity("test", "", "test@example.com", &packet.Config{RSABits: 1024})
+	require.NoError(t, err)
+	headers := map[string]interface{}{
+		"type":          "snap-build",
+		"authority-id":  "dev",
+		"snap-sha3-384": "abc",
+		"grade":         "stable",
+		"timestamp":     "2026-01-01T00:00:00Z",
+	}
+	signed, err := snapassert.Sign(headers, nil, entity.PrivateKey, time.Now())
+	require.NoError(t, err)
+	a, err := snapassert.Verify(signed, openpgp.EntityList{entity})
+	require.NoError(t, err)
+	assert.Equal(t, "snap-build", a.Type)
+	assert.Equal(t, "stable", a.Headers["grade"])
+	keyID, err := snapassert.KeyID(entity.PrimaryKey)
+	require.NoError(t, err)
+	assert.Equal(t, keyID, a.Headers["sign-key-sha3-384"])
+
+	tampered := []byte(string(signed[:len("type: snap-build\nauthority-id: ")]) + "eve" + string(signed[len("type: snap-build\nauthority-id: dev"):]))
+	_, err = snapassert.Verify(tampered, openpgp.EntityList{entity})
+	assert.Error(t, err)
+}
@@ -0,0 +1,130 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package squirrel
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// UpdateLatestYML recomputes the sha512 and size of every file referenced by
+// an electron-updater latest.yml that is present in dir. The older hex "sha2"
+// digest is also updated if it is present. Returns the new contents and the
+// number of files that changed.
+func UpdateLatestYML(blob []byte, dir string) ([]byte, int, error) {
+	doc := new(yaml.Node)
+	if err := yaml.Unmarshal(blob, doc); err != nil {
+		return nil, 0, err
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, 0, errors.New("latest.yml is not a mapping")
+	}
+	root := doc.Content[0]
+	var changed int
+	update := func(node *yaml.Node, nameKey string) error {
+		name := mapValue(node, nameKey)
+		if name == nil || name.Value == "" {
+			return nil
+		}
+		localName := name.Value
+		if u, err := url.Parse(localName); err == nil && u.Scheme != "" {
+			localName = path.Base(u.Path)
+		}
+		sha512sum, sha256sum, size, err := fileDigests(filepath.Join(dir, localName))
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		fields := map[string]string{
+			"sha512": base64.StdEncoding.EncodeToString(sha512sum),
+			"sha2":   hex.EncodeToString(sha256sum),
+			"size":   strconv.FormatInt(size, 10),
+		}
+		var modified bool
+		for key, value := range fields {
+			if v := mapValue(node, key); v != nil && v.Value != value {
+				v.Value = value
+				modified = true
+			}
+		}
+		if modified {
+			changed++
+		}
+		return nil
+	}
+	if files := mapValue(root, "files"); files != nil && files.Kind == yaml.SequenceNode {
+		for _, file := range files.Content {
+			if err := update(file, "url"); err != nil {
+				return nil, 0, err
+			}
+		}
+	}
+	if err := update(root, "path"); err != nil {
+		return nil, 0, err
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return nil, 0, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, 0, err
+	}
+	return buf.Bytes(), changed, nil
+}
+
+func fileDigests(fp string) (sha512sum, sha256sum []byte, size int64, err error) {
+	f, err := os.Open(fp)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	defer f.Close()
+	d512 := sha512.New()
+	d256 := sha256.New()
+	size, err = io.Copy(io.MultiWriter(d512, d256), f)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	return d512.Sum(nil), d256.Sum(nil), size, nil
+}
+
+// find the value for a key in a mapping node
+func mapValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
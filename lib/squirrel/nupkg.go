@@ -0,0 +1,94 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package squirrel
+
+import (
+	"archive/zip"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+)
+
+// SignFunc is called with the name and contents of each executable in a
+// package. It returns the signed contents, or nil to leave the file as it is.
+type SignFunc func(name string, contents []byte) ([]byte, error)
+
+// IsExecutable returns true if a package member is a PE file that Squirrel
+// would sign
+func IsExecutable(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".exe", ".dll":
+		return true
+	}
+	return false
+}
+
+// SignPackage copies a nupkg from r to w, replacing the executables in it with
+// the result of calling sign. Returns the number of files that were replaced.
+func SignPackage(r io.ReaderAt, size int64, w io.Writer, sign SignFunc) (int, error) {
+	inz, err := zip.NewReader(r, size)
+	if err != nil {
+		return 0, err
+	}
+	outz := zip.NewWriter(w)
+	var signed int
+	for _, f := range inz.File {
+		var contents []byte
+		if IsExecutable(f.Name) && !f.FileInfo().IsDir() {
+			contents, err = readMember(f)
+			if err != nil {
+				return 0, err
+			}
+			contents, err = sign(f.Name, contents)
+			if err != nil {
+				return 0, err
+			}
+		}
+		if contents == nil {
+			if err := outz.Copy(f); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		hdr := &zip.FileHeader{
+			Name:     f.Name,
+			Comment:  f.Comment,
+			Method:   zip.Deflate,
+			Modified: f.Modified,
+		}
+		hdr.SetMode(f.Mode())
+		mw, err := outz.CreateHeader(hdr)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := mw.Write(contents); err != nil {
+			return 0, err
+		}
+		signed++
+	}
+	return signed, outz.Close()
+}
+
+func readMember(f *zip.File) ([]byte, error) {
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
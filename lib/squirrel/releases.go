@@ -0,0 +1,136 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package squirrel updates the metadata of Squirrel.Windows and
+// electron-updater release directories after the files in them are signed.
+package squirrel
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ReleasesFile is the name of the Squirrel.Windows release index
+const ReleasesFile = "RELEASES"
+
+// Squirrel writes RELEASES with a UTF-8 byte order mark
+const bom = "\ufeff"
+
+// Release is one line of a RELEASES file: the SHA-1 digest, name and size of
+// a full or delta package
+type Release struct {
+	SHA1     string
+	Filename string
+	Size     int64
+}
+
+// ParseReleases parses the contents of a RELEASES file
+func ParseReleases(blob []byte) ([]Release, error) {
+	var releases []Release
+	for i, line := range strings.Split(string(blob), "\n") {
+		line = strings.TrimSpace(strings.TrimPrefix(line, bom))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%s line %d: expected 3 fields", ReleasesFile, i+1)
+		}
+		size, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: invalid size: %w", ReleasesFile, i+1, err)
+		}
+		releases = append(releases, Release{SHA1: fields[0], Filename: fields[1], Size: size})
+	}
+	return releases, nil
+}
+
+// LocalName returns the name of the package within the release directory.
+// The filename can also be a URL, in which case the last path element is
+// used.
+func (r Release) LocalName() string {
+	if u, err := url.Parse(r.Filename); err == nil && u.Scheme != "" {
+		return path.Base(u.Path)
+	}
+	return r.Filename
+}
+
+// IsDelta returns true if the release is a delta package
+func (r Release) IsDelta() bool {
+	return strings.HasSuffix(strings.ToLower(r.LocalName()), "-delta.nupkg")
+}
+
+// UpdateReleases recomputes the digest and size of every package in a
+// RELEASES file that is present in dir, preserving the order of the lines and
+// the line endings. Returns the new contents and the number of lines that
+// changed.
+func UpdateReleases(blob []byte, dir string) ([]byte, int, error) {
+	if _, err := ParseReleases(blob); err != nil {
+		return nil, 0, err
+	}
+	var out bytes.Buffer
+	var changed int
+	for _, line := range bytes.SplitAfter(blob, []byte("\n")) {
+		content := bytes.TrimRight(line, "\r\n")
+		ending := line[len(content):]
+		releases, _ := ParseReleases(content)
+		if len(releases) == 0 {
+			out.Write(line)
+			continue
+		}
+		r := releases[0]
+		sum, size, err := fileSHA1(filepath.Join(dir, r.LocalName()))
+		if os.IsNotExist(err) {
+			out.Write(line)
+			continue
+		} else if err != nil {
+			return nil, 0, err
+		}
+		if !strings.EqualFold(sum, r.SHA1) || size != r.Size {
+			changed++
+		}
+		// keep a byte order mark if there was one
+		if bytes.HasPrefix(content, []byte(bom)) {
+			out.WriteString(bom)
+		}
+		fmt.Fprintf(&out, "%s %s %d", strings.ToUpper(sum), r.Filename, size)
+		out.Write(ending)
+	}
+	return out.Bytes(), changed, nil
+}
+
+func fileSHA1(fp string) (string, int64, error) {
+	f, err := os.Open(fp)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	d := sha1.New()
+	size, err := io.Copy(d, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(d.Sum(nil)), size, nil
+}
@@ -0,0 +1,138 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package squirrel
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestUpdateReleases(t *testing.T) {
+	dir := t.TempDir()
+	full := []byte("full package")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "App-1.0.0-full.nupkg"), full, 0644))
+	releases := bom + "0000000000000000000000000000000000000000 App-0.9.0-full.nupkg 10\r\n" +
+		"1111111111111111111111111111111111111111 https://example.com/dl/App-1.0.0-full.nupkg?x=1 5\r\n"
+	updated, changed, err := UpdateReleases([]byte(releases), dir)
+	require.NoError(t, err)
+	assert.Equal(t, 1, changed)
+	sum := sha1.Sum(full)
+	expected := bom + "0000000000000000000000000000000000000000 App-0.9.0-full.nupkg 10\r\n" +
+		fmt.Sprintf("%s https://example.com/dl/App-1.0.0-full.nupkg?x=1 %d\r\n", strings.ToUpper(hex.EncodeToString(sum[:])), len(full))
+	assert.Equal(t, expected, string(updated))
+
+	parsed, err := ParseReleases(updated)
+	require.NoError(t, err)
+	require.Len(t, parsed, 2)
+	assert.Equal(t, "App-1.0.0-full.nupkg", parsed[1].LocalName())
+	assert.False(t, parsed[1].IsDelta())
+
+	_, _, err = UpdateReleases([]byte("garbage\n"), dir)
+	assert.Error(t, err)
+}
+
+func TestUpdateLatestYML(t *testing.T) {
+	dir := t.TempDir()
+	setup := []byte("signed setup")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "App Setup 1.0.0.exe"), setup, 0644))
+	latest := `version: 1.0.0
+files:
+  - url: App-Setup-1.0.0.exe
+    sha512: old
+    size: 1
+  - url: App Setup 1.0.0.exe
+    sha512: old
+    size: 1
+path: App Setup 1.0.0.exe
+sha512: old
+releaseDate: '2024-01-01T00:00:00.000Z'
+`
+	updated, changed, err := UpdateLatestYML([]byte(latest), dir)
+	require.NoError(t, err)
+	assert.Equal(t, 2, changed)
+	var doc struct {
+		Version string
+		Files   []struct {
+			URL    string
+			SHA512 string
+			Size   int
+		}
+		Path        string
+		SHA512      string
+		ReleaseDate string `yaml:"releaseDate"`
+	}
+	require.NoError(t, yaml.Unmarshal(updated, &doc))
+	sum := sha512.Sum512(setup)
+	expected := base64.StdEncoding.EncodeToString(sum[:])
+	assert.Equal(t, "old", doc.Files[0].SHA512)
+	assert.Equal(t, expected, doc.Files[1].SHA512)
+	assert.Equal(t, len(setup), doc.Files[1].Size)
+	assert.Equal(t, expected, doc.SHA512)
+	assert.Equal(t, "2024-01-01T00:00:00.000Z", doc.ReleaseDate)
+}
+
+func TestSignPackage(t *testing.T) {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, name := range []string{"App.nuspec", "lib/net45/App.exe", "lib/net45/ffmpeg.dll", "lib/net45/resources/app.asar"} {
+		f, err := w.Create(name)
+		require.NoError(t, err)
+		_, err = f.Write([]byte("contents of " + name))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+
+	var out bytes.Buffer
+	var seen []string
+	signed, err := SignPackage(bytes.NewReader(buf.Bytes()), int64(buf.Len()), &out, func(name string, contents []byte) ([]byte, error) {
+		seen = append(seen, name)
+		if strings.HasSuffix(name, ".dll") {
+			// already signed
+			return nil, nil
+		}
+		return append(contents, " signed"...), nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, signed)
+	assert.Equal(t, []string{"lib/net45/App.exe", "lib/net45/ffmpeg.dll"}, seen)
+
+	r, err := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	require.NoError(t, err)
+	require.Len(t, r.File, 4)
+	for _, f := range r.File {
+		contents, err := readMember(f)
+		require.NoError(t, err)
+		expected := "contents of " + f.Name
+		if f.Name == "lib/net45/App.exe" {
+			expected += " signed"
+		}
+		assert.Equal(t, expected, string(contents))
+	}
+}
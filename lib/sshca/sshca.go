@@ -0,0 +1,227 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package sshca issues OpenSSH user and host certificates, subject to a
+// policy limiting the principals, lifetime and permissions they carry.
+package sshca
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// DefaultUserExtensions are granted to user certificates when the request
+// doesn't specify any, matching "ssh-keygen -s"
+var DefaultUserExtensions = []string{
+	"permit-X11-forwarding",
+	"permit-agent-forwarding",
+	"permit-port-forwarding",
+	"permit-pty",
+	"permit-user-rc",
+}
+
+// Allow certificates to be used slightly before they were issued in case of
+// clock skew
+const backdate = 5 * time.Minute
+
+const defaultMaxValidity = 86400
+
+type Request struct {
+	PublicKey       ssh.PublicKey
+	Host            bool
+	KeyID           string
+	Principals      []string
+	Validity        time.Duration
+	CriticalOptions map[string]string
+	Extensions      map[string]string
+	// Caller and CallerRoles identify the client asking for the certificate
+	Caller      string
+	CallerRoles []string
+}
+
+// Policy limits the certificates that a CA key may issue. It is part of the
+// key's configuration.
+type Policy struct {
+	UserPrincipals  []string // Patterns of principals allowed in user certificates. If empty, no user certificates can be issued.
+	HostPrincipals  []string // Patterns of host names allowed in host certificates. If empty, no host certificates can be issued.
+	MaxValidity     int      // Longest certificate lifetime in seconds (default 86400)
+	CriticalOptions []string // Critical options that may be requested, e.g. force-command or source-address
+	Extensions      []string // Extensions that may be requested for user certificates (default the ssh-keygen set)
+	// Patterns of principals each caller may request, keyed by "user:NAME" or
+	// "role:NAME". If set, every principal must also be allowed for the caller,
+	// so that one client can't obtain a certificate for another's principals.
+	CallerPrincipals map[string][]string
+}
+
+// MaxValidityDuration returns the longest certificate lifetime the policy
+// allows
+func (p *Policy) MaxValidityDuration() time.Duration {
+	if p.MaxValidity > 0 {
+		return time.Duration(p.MaxValidity) * time.Second
+	}
+	return defaultMaxValidity * time.Second
+}
+
+// Check that the request is permitted by the policy
+func (p *Policy) Check(req *Request) error {
+	patterns, kind := p.UserPrincipals, "user"
+	if req.Host {
+		patterns, kind = p.HostPrincipals, "host"
+	}
+	if len(patterns) == 0 {
+		return fmt.Errorf("policy does not allow %s certificates", kind)
+	}
+	if len(req.Principals) == 0 {
+		// an empty list would be valid for any principal
+		return errors.New("at least one principal is required")
+	}
+	var callerPatterns []string
+	if len(p.CallerPrincipals) != 0 {
+		if req.Caller == "" {
+			return errors.New("policy requires an authenticated caller")
+		}
+		callerPatterns = p.callerPatterns(req)
+	}
+	for _, principal := range req.Principals {
+		if !matchAny(patterns, principal) {
+			return fmt.Errorf("policy does not allow %s principal %q", kind, principal)
+		} else if len(p.CallerPrincipals) != 0 && !matchAny(callerPatterns, principal) {
+			return fmt.Errorf("policy does not allow caller %q to request %s principal %q", req.Caller, kind, principal)
+		}
+	}
+	if req.Validity <= 0 {
+		return errors.New("validity must be positive")
+	} else if max := p.MaxValidityDuration(); req.Validity > max {
+		return fmt.Errorf("validity of %s exceeds the policy limit of %s", req.Validity, max)
+	}
+	for _, name := range sortedKeys(req.CriticalOptions) {
+		if !contains(p.CriticalOptions, name) {
+			return fmt.Errorf("policy does not allow critical option %q", name)
+		}
+	}
+	allowedExt := p.Extensions
+	if len(allowedExt) == 0 {
+		allowedExt = DefaultUserExtensions
+	}
+	for _, name := range sortedKeys(req.extensions()) {
+		if req.Host {
+			return errors.New("host certificates can't have extensions")
+		} else if !contains(allowedExt, name) {
+			return fmt.Errorf("policy does not allow extension %q", name)
+		}
+	}
+	return nil
+}
+
+// callerPatterns returns the principal patterns allowed for the caller's name
+// and each of its roles
+func (p *Policy) callerPatterns(req *Request) []string {
+	patterns := append([]string(nil), p.CallerPrincipals["user:"+req.Caller]...)
+	for _, role := range req.CallerRoles {
+		patterns = append(patterns, p.CallerPrincipals["role:"+role]...)
+	}
+	return patterns
+}
+
+// Issue a certificate for the request, signed by the CA key
+func Issue(req *Request, signer crypto.Signer, now time.Time) (*ssh.Certificate, error) {
+	if _, ok := req.PublicKey.(*ssh.Certificate); ok {
+		return nil, errors.New("public key is already a certificate")
+	}
+	caSigner, err := ssh.NewSignerFromSigner(signer)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(caSigner.PublicKey().Marshal(), req.PublicKey.Marshal()) {
+		return nil, errors.New("refusing to certify the CA's own key")
+	}
+	var serial [8]byte
+	if _, err := rand.Read(serial[:]); err != nil {
+		return nil, err
+	}
+	cert := &ssh.Certificate{
+		Key:             req.PublicKey,
+		Serial:          binary.BigEndian.Uint64(serial[:]),
+		CertType:        ssh.UserCert,
+		KeyId:           req.KeyID,
+		ValidPrincipals: req.Principals,
+		ValidAfter:      uint64(now.Add(-backdate).Unix()),
+		ValidBefore:     uint64(now.Add(req.Validity).Unix()),
+		Permissions: ssh.Permissions{
+			CriticalOptions: req.CriticalOptions,
+			Extensions:      req.extensions(),
+		},
+	}
+	if req.Host {
+		cert.CertType = ssh.HostCert
+	}
+	// RSA CAs sign with SHA-512
+	if err := cert.SignCert(rand.Reader, caSigner); err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+// extensions returns the requested extensions, or the defaults for a user
+// certificate if none were requested
+func (req *Request) extensions() map[string]string {
+	if req.Extensions != nil || req.Host {
+		return req.Extensions
+	}
+	ext := make(map[string]string, len(DefaultUserExtensions))
+	for _, name := range DefaultUserExtensions {
+		ext[name] = ""
+	}
+	return ext
+}
+
+// sortedKeys returns the names in a map in order, so the first one refused is
+// always the same
+func sortedKeys(m map[string]string) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, name string) bool {
+	for _, item := range list {
+		if item == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package sshca
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func newKey(t *testing.T) ssh.PublicKey {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	pub, err := ssh.NewPublicKey(priv.Public())
+	require.NoError(t, err)
+	return pub
+}
+
+func TestIssue(t *testing.T) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caPub, err := ssh.NewPublicKey(caKey.Public())
+	require.NoError(t, err)
+	now := time.Now()
+	req := &Request{
+		PublicKey:       newKey(t),
+		KeyID:           "alice",
+		Principals:      []string{"alice"},
+		Validity:        time.Hour,
+		CriticalOptions: map[string]string{"source-address": "10.0.0.0/8"},
+	}
+	cert, err := Issue(req, caKey, now)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(ssh.UserCert), cert.CertType)
+	assert.Contains(t, cert.Extensions, "permit-pty")
+	assert.Equal(t, "10.0.0.0/8", cert.CriticalOptions["source-address"])
+	checker := &ssh.CertChecker{
+		IsUserAuthority:          func(auth ssh.PublicKey) bool { return bytes.Equal(auth.Marshal(), caPub.Marshal()) },
+		SupportedCriticalOptions: []string{"source-address"},
+	}
+	assert.NoError(t, checker.CheckCert("alice", cert))
+	assert.Error(t, checker.CheckCert("bob", cert))
+	checker.Clock = func() time.Time { return now.Add(2 * time.Hour) }
+	assert.Error(t, checker.CheckCert("alice", cert))
+
+	req = &Request{PublicKey: newKey(t), Host: true, Principals: []string{"web01.example.com"}, Validity: time.Hour}
+	cert, err = Issue(req, caKey, now)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(ssh.HostCert), cert.CertType)
+	assert.Empty(t, cert.Extensions)
+
+	req.PublicKey = caPub
+	_, err = Issue(req, caKey, now)
+	assert.Error(t, err)
+}
+
+func TestPolicy(t *testing.T) {
+	policy := &Policy{
+		UserPrincipals:  []string{"alice", "deploy-*"},
+		MaxValidity:     3600,
+		CriticalOptions: []string{"force-command"},
+		Extensions:      []string{"permit-pty"},
+	}
+	req := &Request{
+		Principals: []string{"alice", "deploy-web"},
+		Validity:   time.Hour,
+		Extensions: map[string]string{"permit-pty": ""},
+	}
+	assert.NoError(t, policy.Check(req))
+	req.CriticalOptions = map[string]string{"force-command": "/bin/true"}
+	assert.NoError(t, policy.Check(req))
+
+	bad := *req
+	bad.Principals = []string{"root"}
+	assert.EqualError(t, policy.Check(&bad), `policy does not allow user principal "root"`)
+	bad = *req
+	bad.Principals = nil
+	assert.Error(t, policy.Check(&bad))
+	bad = *req
+	bad.Validity = 2 * time.Hour
+	assert.Error(t, policy.Check(&bad))
+	bad = *req
+	bad.CriticalOptions = map[string]string{"source-address": "0.0.0.0/0"}
+	assert.Error(t, policy.Check(&bad))
+	bad = *req
+	// default extensions are also subject to the policy
+	bad.Extensions = nil
+	assert.EqualError(t, policy.Check(&bad), `policy does not allow extension "permit-X11-forwarding"`)
+	bad = *req
+	bad.Host = true
+	assert.EqualError(t, policy.Check(&bad), "policy does not allow host certificates")
+	assert.Equal(t, 24*time.Hour, (&Policy{}).MaxValidityDuration())
+}
+
+func TestCallerPrincipals(t *testing.T) {
+	policy := &Policy{
+		UserPrincipals: []string{"*"},
+		CallerPrincipals: map[string][]string{
+			"user:alice":    {"alice"},
+			"user:bob":      {"bob"},
+			"role:deployer": {"deploy-*"},
+		},
+	}
+	req := &Request{Principals: []string{"alice"}, Validity: time.Hour, Caller: "alice"}
+	assert.NoError(t, policy.Check(req))
+	// a caller can't mint another caller's principal
+	bad := *req
+	bad.Caller = "bob"
+	assert.EqualError(t, policy.Check(&bad), `policy does not allow caller "bob" to request user principal "alice"`)
+	bad = *req
+	bad.Principals = []string{"alice", "bob"}
+	assert.Error(t, policy.Check(&bad))
+	// roles add to what the caller's own entry allows
+	req.Principals = []string{"alice", "deploy-web"}
+	assert.Error(t, policy.Check(req))
+	req.CallerRoles = []string{"deployer"}
+	assert.NoError(t, policy.Check(req))
+	bad = *req
+	bad.Caller = "carol"
+	assert.Error(t, policy.Check(&bad))
+	bad.Principals = []string{"deploy-web"}
+	assert.NoError(t, policy.Check(&bad))
+	// with no client to bind to, nothing can be issued
+	bad = *req
+	bad.Caller = ""
+	assert.EqualError(t, policy.Check(&bad), "policy requires an authenticated caller")
+}
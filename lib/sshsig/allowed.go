@@ -0,0 +1,185 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package sshsig
+
+// Parse and check ssh-keygen allowed_signers files. Each line lists one or
+// more principals, some options, and a public key:
+//
+//   user@example.com,*@example.net namespaces="git,file" ssh-ed25519 AAAA...
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+type AllowedSigner struct {
+	Principals    []string
+	Namespaces    []string
+	CertAuthority bool
+	ValidAfter    time.Time
+	ValidBefore   time.Time
+	PublicKey     ssh.PublicKey
+}
+
+// ParseAllowedSigners parses the contents of an allowed_signers file
+func ParseAllowedSigners(blob []byte) ([]*AllowedSigner, error) {
+	var signers []*AllowedSigner
+	scanner := bufio.NewScanner(bytes.NewReader(blob))
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		signer, err := parseAllowedSigner(line)
+		if err != nil {
+			return nil, fmt.Errorf("allowed signers line %d: %w", lineNum, err)
+		}
+		signers = append(signers, signer)
+	}
+	return signers, scanner.Err()
+}
+
+func parseAllowedSigner(line string) (*AllowedSigner, error) {
+	var principals, rest string
+	if line[0] == '"' {
+		end := strings.IndexByte(line[1:], '"')
+		if end < 0 {
+			return nil, errors.New("unterminated quoted principals")
+		}
+		principals, rest = line[1:end+1], line[end+2:]
+	} else if idx := strings.IndexAny(line, " \t"); idx > 0 {
+		principals, rest = line[:idx], line[idx:]
+	} else {
+		return nil, errors.New("missing public key")
+	}
+	// the remainder is the same as an authorized_keys line
+	pub, _, options, _, err := ssh.ParseAuthorizedKey([]byte(strings.TrimSpace(rest)))
+	if err != nil {
+		return nil, err
+	}
+	signer := &AllowedSigner{
+		Principals: strings.Split(principals, ","),
+		PublicKey:  pub,
+	}
+	for _, option := range options {
+		name, value, _ := strings.Cut(option, "=")
+		value = strings.Trim(value, "\"")
+		switch strings.ToLower(name) {
+		case "cert-authority":
+			signer.CertAuthority = true
+		case "namespaces":
+			signer.Namespaces = strings.Split(value, ",")
+		case "valid-after":
+			signer.ValidAfter, err = parseValidity(value)
+		case "valid-before":
+			signer.ValidBefore, err = parseValidity(value)
+		default:
+			return nil, fmt.Errorf("unknown option %q", name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("option %s: %w", name, err)
+		}
+	}
+	return signer, nil
+}
+
+// parse YYYYMMDD[HHMM[SS]] with an optional Z suffix for UTC
+func parseValidity(value string) (time.Time, error) {
+	loc := time.Local
+	if strings.HasSuffix(value, "Z") {
+		value = value[:len(value)-1]
+		loc = time.UTC
+	}
+	for _, layout := range []string{"20060102", "200601021504", "20060102150405"} {
+		if len(value) == len(layout) {
+			return time.ParseInLocation(layout, value, loc)
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", value)
+}
+
+// Principals returns the principals that are allowed to make the signature,
+// considering the signing key, namespace, and the signing time. Keys that are
+// SSH certificates match cert-authority lines for their issuer and are only
+// allowed for the principals named in the certificate.
+func (s *Signature) Principals(signers []*AllowedSigner, at time.Time) []string {
+	cert, _ := s.PublicKey.(*ssh.Certificate)
+	pubBlob := s.PublicKey.Marshal()
+	var found []string
+	for _, signer := range signers {
+		if !signer.allows(s.Namespace, at) {
+			continue
+		}
+		if !signer.CertAuthority {
+			if bytes.Equal(signer.PublicKey.Marshal(), pubBlob) {
+				found = append(found, signer.Principals...)
+			}
+			continue
+		}
+		if cert == nil || !bytes.Equal(signer.PublicKey.Marshal(), cert.SignatureKey.Marshal()) {
+			continue
+		}
+		if cert.CertType != ssh.UserCert {
+			continue
+		}
+		checker := &ssh.CertChecker{Clock: func() time.Time { return at }}
+		for _, principal := range cert.ValidPrincipals {
+			// CheckCert also verifies the CA's signature and validity period
+			if signer.MatchPrincipal(principal) && checker.CheckCert(principal, cert) == nil {
+				found = append(found, principal)
+			}
+		}
+	}
+	return found
+}
+
+func (a *AllowedSigner) allows(namespace string, at time.Time) bool {
+	if !a.ValidAfter.IsZero() && at.Before(a.ValidAfter) {
+		return false
+	}
+	if !a.ValidBefore.IsZero() && at.After(a.ValidBefore) {
+		return false
+	}
+	if len(a.Namespaces) == 0 {
+		return true
+	}
+	for _, pattern := range a.Namespaces {
+		if ok, _ := path.Match(pattern, namespace); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchPrincipal reports whether the principal matches one of the line's patterns
+func (a *AllowedSigner) MatchPrincipal(principal string) bool {
+	for _, pattern := range a.Principals {
+		if ok, _ := path.Match(pattern, principal); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,216 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package sshsig implements the SSH signature format described in OpenSSH's
+// PROTOCOL.sshsig, as created and checked by "ssh-keygen -Y".
+package sshsig
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	magicPreamble = "SSHSIG"
+	sigVersion    = 1
+	armorBegin    = "-----BEGIN SSH SIGNATURE-----"
+	armorEnd      = "-----END SSH SIGNATURE-----"
+	armorWidth    = 70
+)
+
+var hashNames = map[crypto.Hash]string{
+	crypto.SHA256: "sha256",
+	crypto.SHA512: "sha512",
+}
+
+type Signature struct {
+	PublicKey     ssh.PublicKey
+	Namespace     string
+	HashAlgorithm string
+	Signature     *ssh.Signature
+}
+
+type wireSignature struct {
+	Magic         [6]byte
+	Version       uint32
+	PublicKey     []byte
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Signature     []byte
+}
+
+type wireSignedData struct {
+	Magic         [6]byte
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Digest        []byte
+}
+
+// Sign the contents of r using the given namespace, which identifies the
+// purpose of the signature so it can't be reused in another context
+func Sign(r io.Reader, signer crypto.Signer, hash crypto.Hash, namespace string) (*Signature, error) {
+	if namespace == "" {
+		return nil, errors.New("sshsig: namespace is required")
+	}
+	hashName := hashNames[hash]
+	if hashName == "" {
+		return nil, fmt.Errorf("sshsig: unsupported digest %s, use SHA-256 or SHA-512", hash)
+	}
+	d := hash.New()
+	if _, err := io.Copy(d, r); err != nil {
+		return nil, err
+	}
+	ssigner, err := ssh.NewSignerFromSigner(signer)
+	if err != nil {
+		return nil, err
+	}
+	data := signedData(namespace, hashName, d.Sum(nil))
+	var sig *ssh.Signature
+	if ssigner.PublicKey().Type() == ssh.KeyAlgoRSA {
+		// SHA-1 RSA signatures are not accepted by ssh-keygen
+		sig, err = ssigner.(ssh.AlgorithmSigner).SignWithAlgorithm(rand.Reader, data, ssh.KeyAlgoRSASHA512)
+	} else {
+		sig, err = ssigner.Sign(rand.Reader, data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Signature{
+		PublicKey:     ssigner.PublicKey(),
+		Namespace:     namespace,
+		HashAlgorithm: hashName,
+		Signature:     sig,
+	}, nil
+}
+
+func signedData(namespace, hashName string, digest []byte) []byte {
+	msg := wireSignedData{
+		Namespace:     namespace,
+		HashAlgorithm: hashName,
+		Digest:        digest,
+	}
+	copy(msg.Magic[:], magicPreamble)
+	return ssh.Marshal(msg)
+}
+
+// Marshal returns the binary form of the signature
+func (s *Signature) Marshal() []byte {
+	msg := wireSignature{
+		Version:       sigVersion,
+		PublicKey:     s.PublicKey.Marshal(),
+		Namespace:     s.Namespace,
+		HashAlgorithm: s.HashAlgorithm,
+		Signature:     ssh.Marshal(s.Signature),
+	}
+	copy(msg.Magic[:], magicPreamble)
+	return ssh.Marshal(msg)
+}
+
+// Armor returns the signature in the armored form written by ssh-keygen
+func (s *Signature) Armor() []byte {
+	enc := base64.StdEncoding.EncodeToString(s.Marshal())
+	var buf bytes.Buffer
+	buf.WriteString(armorBegin + "\n")
+	for len(enc) > armorWidth {
+		buf.WriteString(enc[:armorWidth] + "\n")
+		enc = enc[armorWidth:]
+	}
+	buf.WriteString(enc + "\n")
+	buf.WriteString(armorEnd + "\n")
+	return buf.Bytes()
+}
+
+// Parse an armored or binary SSH signature
+func Parse(blob []byte) (*Signature, error) {
+	if trimmed := bytes.TrimSpace(blob); bytes.HasPrefix(trimmed, []byte(armorBegin)) {
+		end := bytes.Index(trimmed, []byte(armorEnd))
+		if end < 0 {
+			return nil, errors.New("sshsig: missing armor end line")
+		}
+		body := bytes.Join(bytes.Fields(trimmed[len(armorBegin):end]), nil)
+		blob = make([]byte, base64.StdEncoding.DecodedLen(len(body)))
+		n, err := base64.StdEncoding.Decode(blob, body)
+		if err != nil {
+			return nil, fmt.Errorf("sshsig: %w", err)
+		}
+		blob = blob[:n]
+	}
+	var msg wireSignature
+	if err := ssh.Unmarshal(blob, &msg); err != nil {
+		return nil, fmt.Errorf("sshsig: %w", err)
+	}
+	if string(msg.Magic[:]) != magicPreamble {
+		return nil, errors.New("sshsig: not an SSH signature")
+	} else if msg.Version != sigVersion {
+		return nil, fmt.Errorf("sshsig: unsupported signature version %d", msg.Version)
+	}
+	pub, err := ssh.ParsePublicKey(msg.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("sshsig: %w", err)
+	}
+	sig := new(ssh.Signature)
+	if err := ssh.Unmarshal(msg.Signature, sig); err != nil {
+		return nil, fmt.Errorf("sshsig: %w", err)
+	}
+	return &Signature{
+		PublicKey:     pub,
+		Namespace:     msg.Namespace,
+		HashAlgorithm: msg.HashAlgorithm,
+		Signature:     sig,
+	}, nil
+}
+
+// Hash returns the digest algorithm used to hash the signed message
+func (s *Signature) Hash() crypto.Hash {
+	for hash, name := range hashNames {
+		if name == s.HashAlgorithm {
+			return hash
+		}
+	}
+	return 0
+}
+
+// Verify that the signature is valid for the contents of r. If namespace is
+// not empty then the signature must have been made for that namespace.
+func (s *Signature) Verify(r io.Reader, namespace string) error {
+	if namespace != "" && s.Namespace != namespace {
+		return fmt.Errorf("sshsig: signature namespace is %q, expected %q", s.Namespace, namespace)
+	}
+	hash := s.Hash()
+	if hash == 0 {
+		return fmt.Errorf("sshsig: unsupported hash algorithm %q", s.HashAlgorithm)
+	}
+	if s.Signature.Format == ssh.KeyAlgoRSA {
+		return errors.New("sshsig: RSA signatures using SHA-1 are not allowed")
+	}
+	d := hash.New()
+	if _, err := io.Copy(d, r); err != nil {
+		return err
+	}
+	if err := s.PublicKey.Verify(signedData(s.Namespace, s.HashAlgorithm, d.Sum(nil)), s.Signature); err != nil {
+		return fmt.Errorf("sshsig: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package sshsig
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSignVerify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	msg := []byte("hello world\n")
+	for _, key := range []crypto.Signer{rsaKey, ecKey, edKey} {
+		for _, hash := range []crypto.Hash{crypto.SHA256, crypto.SHA512} {
+			sig, err := Sign(bytes.NewReader(msg), key, hash, "file")
+			require.NoError(t, err)
+			armored := sig.Armor()
+			assert.True(t, bytes.HasPrefix(armored, []byte(armorBegin+"\n")))
+			parsed, err := Parse(armored)
+			require.NoError(t, err)
+			assert.Equal(t, sig.PublicKey.Marshal(), parsed.PublicKey.Marshal())
+			assert.Equal(t, hash, parsed.Hash())
+			assert.NoError(t, parsed.Verify(bytes.NewReader(msg), "file"))
+			assert.Error(t, parsed.Verify(bytes.NewReader(msg), "git"))
+			assert.Error(t, parsed.Verify(strings.NewReader("goodbye world\n"), ""))
+		}
+	}
+	sig, err := Sign(bytes.NewReader(msg), rsaKey, crypto.SHA256, "file")
+	require.NoError(t, err)
+	assert.Equal(t, ssh.KeyAlgoRSASHA512, sig.Signature.Format)
+	_, err = Sign(bytes.NewReader(msg), rsaKey, crypto.SHA1, "file")
+	assert.Error(t, err)
+	_, err = Parse([]byte("not a signature"))
+	assert.Error(t, err)
+}
+
+func TestAllowedSigners(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, other, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	pub, err := ssh.NewPublicKey(key.Public())
+	require.NoError(t, err)
+	otherPub, err := ssh.NewPublicKey(other.Public())
+	require.NoError(t, err)
+	authorized := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pub)))
+	otherAuthorized := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(otherPub)))
+	blob := fmt.Sprintf(`# comment
+alice@example.com,bob@example.com namespaces="git" %s
+carol@example.com valid-before="20000101" %s
+"dave@example.com" %s
+eve@example.com %s
+`, authorized, authorized, authorized, otherAuthorized)
+	signers, err := ParseAllowedSigners([]byte(blob))
+	require.NoError(t, err)
+	require.Len(t, signers, 4)
+	assert.Equal(t, []string{"git"}, signers[0].Namespaces)
+	assert.Equal(t, []string{"dave@example.com"}, signers[2].Principals)
+
+	sig, err := Sign(strings.NewReader("commit"), key, crypto.SHA512, "git")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alice@example.com", "bob@example.com", "dave@example.com"}, sig.Principals(signers, time.Now()))
+	sig, err = Sign(strings.NewReader("file"), key, crypto.SHA512, "file")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dave@example.com"}, sig.Principals(signers, time.Now()))
+
+	_, err = ParseAllowedSigners([]byte("alice@example.com bogus=1 " + authorized))
+	assert.Error(t, err)
+}
+
+func TestCertAuthority(t *testing.T) {
+	_, caKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	caSigner, err := ssh.NewSignerFromSigner(caKey)
+	require.NoError(t, err)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	pub, err := ssh.NewPublicKey(key.Public())
+	require.NoError(t, err)
+	cert := &ssh.Certificate{
+		Key:             pub,
+		CertType:        ssh.UserCert,
+		ValidPrincipals: []string{"alice@example.com", "root"},
+		ValidBefore:     ssh.CertTimeInfinity,
+	}
+	require.NoError(t, cert.SignCert(rand.Reader, caSigner))
+	blob := "*@example.com cert-authority " + string(ssh.MarshalAuthorizedKey(caSigner.PublicKey()))
+	signers, err := ParseAllowedSigners([]byte(blob))
+	require.NoError(t, err)
+
+	sig, err := Sign(strings.NewReader("commit"), key, crypto.SHA256, "git")
+	require.NoError(t, err)
+	// a bare key doesn't match the CA
+	assert.Empty(t, sig.Principals(signers, time.Now()))
+	sig.PublicKey = cert
+	parsed, err := Parse(sig.Armor())
+	require.NoError(t, err)
+	assert.NoError(t, parsed.Verify(strings.NewReader("commit"), "git"))
+	assert.Equal(t, []string{"alice@example.com"}, parsed.Principals(signers, time.Now()))
+}
@@ -0,0 +1,275 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package tarmanifest signs tar archives by way of a manifest listing the
+// digest of every member. The signed manifest is either appended to the
+// archive as trailing members or kept alongside it.
+package tarmanifest
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Names of the trailing members of a signed archive
+const (
+	ManifestName     = ".relic-manifest.json"
+	CMSSignatureName = ".relic-manifest.p7s"
+	PGPSignatureName = ".relic-manifest.asc"
+)
+
+// Member digests are always SHA-256 so that an archive can be checked in a
+// single pass, before the manifest at its end has been read
+const manifestHash = "sha256"
+
+type Compression int
+
+const (
+	CompressedNone Compression = iota
+	CompressedGzip
+	CompressedZstd
+)
+
+// Manifest lists the members of a tar archive in order
+type Manifest struct {
+	Version int      `json:"version"`
+	Hash    string   `json:"hash"`
+	Members []Member `json:"members"`
+}
+
+// Member describes a single tar member. Only the name, type, mode, link target
+// and contents are covered; ownership and timestamps are not.
+type Member struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Mode     int64  `json:"mode"`
+	Size     int64  `json:"size,omitempty"`
+	Digest   string `json:"digest,omitempty"`
+	Linkname string `json:"linkname,omitempty"`
+}
+
+// Archive is the result of reading a tar archive
+type Archive struct {
+	Manifest *Manifest
+	// The manifest and signature stored in the archive, if it was signed with
+	// them attached
+	StoredManifest []byte
+	Signature      []byte
+	SignatureName  string
+}
+
+// Decompress identifies the compression of a tar archive and returns a reader
+// for the uncompressed stream
+func Decompress(r io.Reader) (io.Reader, Compression, error) {
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(4)
+	switch {
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		zr, err := gzip.NewReader(br)
+		return zr, CompressedGzip, err
+	case bytes.HasPrefix(head, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		zr, err := zstd.NewReader(br)
+		return zr, CompressedZstd, err
+	case bytes.HasPrefix(head, []byte("\xfd7zX")):
+		return nil, 0, errors.New("xz compressed archives are not supported; use gzip or zstd")
+	}
+	return br, CompressedNone, nil
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// NewWriter returns a writer that compresses to w the same way
+func (c Compression) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	switch c {
+	case CompressedNone:
+		return nopWriteCloser{w}, nil
+	case CompressedGzip:
+		return gzip.NewWriter(w), nil
+	case CompressedZstd:
+		return zstd.NewWriter(w)
+	default:
+		return nil, errors.New("invalid compression type")
+	}
+}
+
+// Read an uncompressed tar archive in a single pass and build a manifest of
+// its members. If tw is not nil then each member is also copied to it, except
+// for an existing manifest and signature, so that a new signature can be
+// appended.
+func Read(r io.Reader, tw *tar.Writer) (*Archive, error) {
+	archive := &Archive{
+		Manifest: &Manifest{Version: 1, Hash: manifestHash},
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		switch hdr.Name {
+		case ManifestName:
+			if archive.StoredManifest != nil {
+				return nil, errors.New("archive contains more than one manifest")
+			}
+			archive.StoredManifest, err = ioutil.ReadAll(tr)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		case CMSSignatureName, PGPSignatureName:
+			if archive.StoredManifest == nil || archive.Signature != nil {
+				return nil, fmt.Errorf("archive member %s is out of place", hdr.Name)
+			}
+			archive.Signature, err = ioutil.ReadAll(tr)
+			if err != nil {
+				return nil, err
+			}
+			archive.SignatureName = hdr.Name
+			continue
+		}
+		if archive.StoredManifest != nil {
+			return nil, fmt.Errorf("archive member %s follows the manifest", hdr.Name)
+		}
+		member := Member{
+			Name:     hdr.Name,
+			Type:     typeName(hdr.Typeflag),
+			Mode:     hdr.Mode & 07777,
+			Linkname: hdr.Linkname,
+		}
+		if tw != nil {
+			if err := tw.WriteHeader(hdr); err != nil {
+				return nil, err
+			}
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			d := sha256.New()
+			var w io.Writer = d
+			if tw != nil {
+				w = io.MultiWriter(d, tw)
+			}
+			member.Size, err = io.Copy(w, tr)
+			if err != nil {
+				return nil, err
+			}
+			member.Digest = hex.EncodeToString(d.Sum(nil))
+		}
+		archive.Manifest.Members = append(archive.Manifest.Members, member)
+	}
+	if archive.StoredManifest != nil && archive.Signature == nil {
+		return nil, errors.New("archive has a manifest but no signature")
+	}
+	return archive, nil
+}
+
+func typeName(flag byte) string {
+	switch flag {
+	case tar.TypeReg:
+		return "file"
+	case tar.TypeDir:
+		return "dir"
+	case tar.TypeSymlink:
+		return "symlink"
+	case tar.TypeLink:
+		return "hardlink"
+	case tar.TypeChar:
+		return "char"
+	case tar.TypeBlock:
+		return "block"
+	case tar.TypeFifo:
+		return "fifo"
+	}
+	return fmt.Sprintf("type-%c", flag)
+}
+
+// Marshal the manifest to the canonical form that is signed
+func (m *Manifest) Marshal() ([]byte, error) {
+	blob, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return append(blob, '\n'), nil
+}
+
+// Check that a stored manifest describes the archive that was read
+func (a *Archive) Check(stored []byte) error {
+	computed, err := a.Manifest.Marshal()
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(computed, stored) {
+		return nil
+	}
+	var other Manifest
+	if err := json.Unmarshal(stored, &other); err != nil {
+		return fmt.Errorf("parsing manifest: %w", err)
+	} else if other.Version != a.Manifest.Version || other.Hash != a.Manifest.Hash {
+		return fmt.Errorf("unsupported manifest version %d hash %q", other.Version, other.Hash)
+	}
+	expected := make(map[string]Member, len(other.Members))
+	for _, member := range other.Members {
+		expected[member.Name] = member
+	}
+	for _, member := range a.Manifest.Members {
+		exp, ok := expected[member.Name]
+		if !ok {
+			return fmt.Errorf("archive member %s is not in the manifest", member.Name)
+		} else if exp != member {
+			return fmt.Errorf("archive member %s does not match the manifest", member.Name)
+		}
+		delete(expected, member.Name)
+	}
+	for name := range expected {
+		return fmt.Errorf("archive member %s is missing", name)
+	}
+	return errors.New("archive members are not in manifest order")
+}
+
+// WriteSignature appends the manifest and its signature to a tar archive
+func WriteSignature(tw *tar.Writer, manifest []byte, sigName string, sig []byte, mtime time.Time) error {
+	for _, member := range []struct {
+		name     string
+		contents []byte
+	}{{ManifestName, manifest}, {sigName, sig}} {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:    member.name,
+			Mode:    0644,
+			Size:    int64(len(member.contents)),
+			ModTime: mtime,
+		}); err != nil {
+			return err
+		}
+		if _, err := tw.Write(member.contents); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package tarmanifest
+
+import (
+	"archive/tar"
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func makeTar(t *testing.T, compression Compression, contents string) []byte {
+	var buf bytes.Buffer
+	zw, err := compression.NewWriter(&buf)
+	require.NoError(t, err)
+	tw := tar.NewWriter(zw)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0755}))
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "dir/file", Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(contents))}))
+	_, err = tw.Write([]byte(contents))
+	require.NoError(t, err)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "dir/link", Typeflag: tar.TypeSymlink, Linkname: "file"}))
+	require.NoError(t, tw.Close())
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+// sign an archive with a placeholder signature
+func signTar(t *testing.T, blob []byte) []byte {
+	r, compression, err := Decompress(bytes.NewReader(blob))
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	zw, err := compression.NewWriter(&buf)
+	require.NoError(t, err)
+	tw := tar.NewWriter(zw)
+	archive, err := Read(r, tw)
+	require.NoError(t, err)
+	manifest, err := archive.Manifest.Marshal()
+	require.NoError(t, err)
+	require.NoError(t, WriteSignature(tw, manifest, CMSSignatureName, []byte("signature"), time.Now()))
+	require.NoError(t, tw.Close())
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func readTar(t *testing.T, blob []byte) *Archive {
+	r, _, err := Decompress(bytes.NewReader(blob))
+	require.NoError(t, err)
+	archive, err := Read(r, nil)
+	require.NoError(t, err)
+	return archive
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, compression := range []Compression{CompressedNone, CompressedGzip, CompressedZstd} {
+		signed := signTar(t, makeTar(t, compression, "hello"))
+		_, detected, err := Decompress(bytes.NewReader(signed))
+		require.NoError(t, err)
+		assert.Equal(t, compression, detected)
+		archive := readTar(t, signed)
+		require.Len(t, archive.Manifest.Members, 3)
+		assert.Equal(t, "symlink", archive.Manifest.Members[2].Type)
+		assert.Equal(t, CMSSignatureName, archive.SignatureName)
+		assert.Equal(t, []byte("signature"), archive.Signature)
+		assert.NoError(t, archive.Check(archive.StoredManifest))
+
+		// re-signing replaces the old signature
+		resigned := readTar(t, signTar(t, signed))
+		assert.Len(t, resigned.Manifest.Members, 3)
+		assert.Equal(t, archive.StoredManifest, resigned.StoredManifest)
+	}
+}
+
+func TestTampered(t *testing.T) {
+	signed := readTar(t, signTar(t, makeTar(t, CompressedNone, "hello")))
+	modified := readTar(t, makeTar(t, CompressedNone, "HELLO"))
+	assert.EqualError(t, modified.Check(signed.StoredManifest), "archive member dir/file does not match the manifest")
+}
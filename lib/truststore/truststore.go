@@ -0,0 +1,325 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package truststore manages a set of trusted root and intermediate
+// certificates for verifying signatures. A store is either a directory with
+// one PEM file per certificate, or a single PEM bundle. Each certificate
+// carries PEM headers recording which signature formats it is trusted for and
+// whether it is pinned.
+package truststore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sassoftware/relic/v7/lib/atomicfile"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+)
+
+// ScopeAll is the scope of certificates trusted for every format
+const ScopeAll = "all"
+
+const (
+	headerScope        = "Relic-Scope"
+	headerIntermediate = "Relic-Intermediate"
+	headerPinned       = "Relic-Pinned"
+)
+
+// scope names that cover a family of signer types. New signers that chain to
+// the same roots must be added here.
+var families = map[string][]string{
+	"authenticode": {"appmanifest", "appx", "cab", "cat", "hlkx", "msi", "ooxml", "pe-coff", "ps", "vba", "vsix", "xap"},
+	"apple":        {"dmg", "ipa", "mach-o", "mach-o-fat", "xar"},
+}
+
+// Entry is a certificate in the store
+type Entry struct {
+	Certificate *x509.Certificate
+	// Format or family of formats this certificate is trusted for, or ScopeAll
+	Scope string
+	// If true, the certificate is only used to build chains and is not a trust anchor
+	Intermediate bool
+	// If any certificates in a scope are pinned, signatures in that scope must
+	// chain through one of them
+	Pinned bool
+}
+
+// Fingerprint returns the hex SHA-256 digest of the certificate
+func (e *Entry) Fingerprint() string {
+	return Fingerprint(e.Certificate)
+}
+
+// Fingerprint returns the hex SHA-256 digest of a certificate
+func Fingerprint(cert *x509.Certificate) string {
+	d := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(d[:])
+}
+
+// Store is a set of trusted certificates loaded from a directory or bundle
+type Store struct {
+	Path    string
+	Entries []*Entry
+	isDir   bool
+}
+
+// Open loads a trust store. If path does not exist, an empty store is
+// returned which will be created as a directory on Save, unless path ends in
+// ".pem" in which case it will be a bundle.
+func Open(path string) (*Store, error) {
+	s := &Store{Path: path}
+	st, err := os.Stat(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		s.isDir = !strings.EqualFold(filepath.Ext(path), ".pem")
+		return s, nil
+	case err != nil:
+		return nil, err
+	case st.IsDir():
+		s.isDir = true
+		names, err := filepath.Glob(filepath.Join(path, "*.pem"))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if err := s.load(name); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		if err := s.load(path); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *Store) load(name string) error {
+	blob, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	for {
+		var block *pem.Block
+		block, blob = pem.Decode(blob)
+		if block == nil {
+			break
+		} else if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		entry := &Entry{
+			Certificate:  cert,
+			Scope:        block.Headers[headerScope],
+			Intermediate: block.Headers[headerIntermediate] == "yes",
+			Pinned:       block.Headers[headerPinned] == "yes",
+		}
+		if entry.Scope == "" {
+			entry.Scope = ScopeAll
+		}
+		s.Entries = append(s.Entries, entry)
+	}
+	return nil
+}
+
+// Add a certificate to the store. If it is already present with the same
+// scope, the existing entry is updated and returned.
+func (s *Store) Add(cert *x509.Certificate, scope string, intermediate bool) *Entry {
+	if scope == "" {
+		scope = ScopeAll
+	}
+	for _, entry := range s.Entries {
+		if entry.Scope == scope && entry.Certificate.Equal(cert) {
+			entry.Intermediate = intermediate
+			return entry
+		}
+	}
+	entry := &Entry{Certificate: cert, Scope: scope, Intermediate: intermediate}
+	s.Entries = append(s.Entries, entry)
+	return entry
+}
+
+// Find returns the entries whose fingerprint starts with the given hex prefix
+// and whose scope matches, or any scope if scope is empty
+func (s *Store) Find(fingerprint, scope string) []*Entry {
+	fingerprint = strings.ToLower(strings.ReplaceAll(fingerprint, ":", ""))
+	var found []*Entry
+	for _, entry := range s.Entries {
+		if (scope == "" || entry.Scope == scope) && strings.HasPrefix(entry.Fingerprint(), fingerprint) {
+			found = append(found, entry)
+		}
+	}
+	return found
+}
+
+// Remove deletes the given entries from the store
+func (s *Store) Remove(entries []*Entry) {
+	remove := make(map[*Entry]bool, len(entries))
+	for _, entry := range entries {
+		remove[entry] = true
+	}
+	kept := s.Entries[:0]
+	for _, entry := range s.Entries {
+		if !remove[entry] {
+			kept = append(kept, entry)
+		}
+	}
+	s.Entries = kept
+}
+
+// Save writes the store back to disk
+func (s *Store) Save() error {
+	if !s.isDir {
+		var buf bytes.Buffer
+		for _, entry := range s.Entries {
+			if err := pem.Encode(&buf, entry.block()); err != nil {
+				return err
+			}
+		}
+		return atomicfile.WriteFile(s.Path, buf.Bytes())
+	}
+	if err := os.MkdirAll(s.Path, 0755); err != nil {
+		return err
+	}
+	// group by certificate so that a cert trusted for several scopes is one file
+	files := make(map[string]*bytes.Buffer)
+	for _, entry := range s.Entries {
+		name := entry.Fingerprint()[:32] + ".pem"
+		if files[name] == nil {
+			files[name] = new(bytes.Buffer)
+		}
+		if err := pem.Encode(files[name], entry.block()); err != nil {
+			return err
+		}
+	}
+	for name, buf := range files {
+		if err := atomicfile.WriteFile(filepath.Join(s.Path, name), buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	existing, err := filepath.Glob(filepath.Join(s.Path, "*.pem"))
+	if err != nil {
+		return err
+	}
+	for _, path := range existing {
+		if files[filepath.Base(path)] == nil {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (e *Entry) block() *pem.Block {
+	headers := map[string]string{headerScope: e.Scope}
+	if e.Intermediate {
+		headers[headerIntermediate] = "yes"
+	}
+	if e.Pinned {
+		headers[headerPinned] = "yes"
+	}
+	return &pem.Block{Type: "CERTIFICATE", Headers: headers, Bytes: e.Certificate.Raw}
+}
+
+// Scopes returns the scopes that apply to a signer type: ScopeAll, the family
+// it belongs to if any, and the signer type itself
+func Scopes(signerName string) []string {
+	scopes := []string{ScopeAll}
+	for family, members := range families {
+		for _, member := range members {
+			if member == signerName {
+				scopes = append(scopes, family)
+			}
+		}
+	}
+	return append(scopes, signerName)
+}
+
+// Trust is the subset of a store that applies to one signer type
+type Trust struct {
+	Roots         []*x509.Certificate
+	Intermediates []*x509.Certificate
+	Pinned        []*x509.Certificate
+}
+
+// ForSigner returns the roots, intermediates and pins that apply to a signer type
+func (s *Store) ForSigner(signerName string) *Trust {
+	t := new(Trust)
+	for _, scope := range Scopes(signerName) {
+		for _, entry := range s.Entries {
+			if entry.Scope != scope {
+				continue
+			}
+			if entry.Intermediate {
+				t.Intermediates = append(t.Intermediates, entry.Certificate)
+			} else {
+				t.Roots = append(t.Roots, entry.Certificate)
+			}
+			if entry.Pinned {
+				t.Pinned = append(t.Pinned, entry.Certificate)
+			}
+		}
+	}
+	return t
+}
+
+// CheckPinned verifies that the leaf chains to one of roots through at least
+// one pinned certificate. If nothing is pinned then it always succeeds.
+func (t *Trust) CheckPinned(leaf *x509.Certificate, intermediates []*x509.Certificate, roots *x509.CertPool, at time.Time) error {
+	if len(t.Pinned) == 0 {
+		return nil
+	}
+	pool := x509.NewCertPool()
+	for _, cert := range intermediates {
+		pool.AddCert(cert)
+	}
+	for _, cert := range t.Intermediates {
+		pool.AddCert(cert)
+	}
+	chains, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: pool,
+		CurrentTime:   at,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return err
+	}
+	for _, chain := range chains {
+		for _, cert := range chain {
+			for _, pinned := range t.Pinned {
+				if cert.Equal(pinned) {
+					return nil
+				}
+			}
+		}
+	}
+	return fmt.Errorf("certificate `%s` does not chain through a pinned certificate", x509tools.FormatSubject(leaf))
+}
@@ -0,0 +1,138 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package truststore_test
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sassoftware/relic/v7/internal/testcert"
+	"github.com/sassoftware/relic/v7/lib/truststore"
+)
+
+func TestOpenSave(t *testing.T) {
+	root := testcert.CA(t, "root", testcert.ECDSAKey(t))
+	inter := testcert.CA(t, "intermediate", testcert.ECDSAKey(t))
+	for _, name := range []string{"store", "bundle.pem"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			s, err := truststore.Open(path)
+			require.NoError(t, err)
+			assert.Empty(t, s.Entries)
+			s.Add(root, "", false)
+			s.Add(root, "authenticode", false)
+			entry := s.Add(inter, "pe-coff", true)
+			entry.Pinned = true
+			// adding again updates the existing entry
+			assert.Same(t, entry, s.Add(inter, "pe-coff", true))
+			require.NoError(t, s.Save())
+			st, err := os.Stat(path)
+			require.NoError(t, err)
+			assert.Equal(t, name == "store", st.IsDir())
+
+			s, err = truststore.Open(path)
+			require.NoError(t, err)
+			require.Len(t, s.Entries, 3)
+			found := s.Find(truststore.Fingerprint(inter)[:8], "")
+			require.Len(t, found, 1)
+			assert.True(t, found[0].Certificate.Equal(inter))
+			assert.True(t, found[0].Intermediate)
+			assert.True(t, found[0].Pinned)
+			assert.Len(t, s.Find(truststore.Fingerprint(root), truststore.ScopeAll), 1)
+
+			s.Remove(s.Find(truststore.Fingerprint(root), ""))
+			require.NoError(t, s.Save())
+			s, err = truststore.Open(path)
+			require.NoError(t, err)
+			assert.Len(t, s.Entries, 1)
+		})
+	}
+}
+
+func TestScopes(t *testing.T) {
+	assert.Equal(t, []string{"all", "authenticode", "pe-coff"}, truststore.Scopes("pe-coff"))
+	assert.Equal(t, []string{"all", "apple", "dmg"}, truststore.Scopes("dmg"))
+	assert.Equal(t, []string{"all", "rpm"}, truststore.Scopes("rpm"))
+	for _, name := range []string{"appmanifest", "hlkx", "ooxml", "vba", "xap"} {
+		assert.Contains(t, truststore.Scopes(name), "authenticode", name)
+	}
+}
+
+func TestForSigner(t *testing.T) {
+	all := testcert.CA(t, "all", testcert.ECDSAKey(t))
+	family := testcert.CA(t, "family", testcert.ECDSAKey(t))
+	msi := testcert.CA(t, "msi", testcert.ECDSAKey(t))
+	inter := testcert.CA(t, "intermediate", testcert.ECDSAKey(t))
+	s, err := truststore.Open(filepath.Join(t.TempDir(), "store"))
+	require.NoError(t, err)
+	s.Add(all, "", false)
+	s.Add(family, "authenticode", false)
+	s.Add(msi, "msi", false)
+	s.Add(inter, "authenticode", true).Pinned = true
+
+	trust := s.ForSigner("vba")
+	assert.Equal(t, []*x509.Certificate{all, family}, trust.Roots)
+	assert.Equal(t, []*x509.Certificate{inter}, trust.Intermediates)
+	assert.Equal(t, []*x509.Certificate{inter}, trust.Pinned)
+	trust = s.ForSigner("msi")
+	assert.Equal(t, []*x509.Certificate{all, family, msi}, trust.Roots)
+	trust = s.ForSigner("rpm")
+	assert.Equal(t, []*x509.Certificate{all}, trust.Roots)
+	assert.Empty(t, trust.Pinned)
+}
+
+func TestCheckPinned(t *testing.T) {
+	rootKey := testcert.ECDSAKey(t)
+	root := testcert.CA(t, "root", rootKey)
+	issueCA := func(name string) (*x509.Certificate, *x509.Certificate) {
+		key := testcert.ECDSAKey(t)
+		ca := testcert.Issue(t, &x509.Certificate{
+			Subject:               pkix.Name{CommonName: name},
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageCertSign,
+		}, key, root, rootKey)
+		leaf := testcert.Issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: name + " leaf"}}, testcert.ECDSAKey(t), ca, key)
+		return ca, leaf
+	}
+	pinnedCA, pinnedLeaf := issueCA("pinned")
+	otherCA, otherLeaf := issueCA("other")
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	now := time.Now()
+
+	// nothing pinned allows anything
+	trust := &truststore.Trust{Roots: []*x509.Certificate{root}}
+	assert.NoError(t, trust.CheckPinned(otherLeaf, []*x509.Certificate{otherCA}, roots, now))
+
+	trust.Pinned = []*x509.Certificate{pinnedCA}
+	assert.NoError(t, trust.CheckPinned(pinnedLeaf, []*x509.Certificate{pinnedCA}, roots, now))
+	assert.EqualError(t, trust.CheckPinned(otherLeaf, []*x509.Certificate{otherCA}, roots, now),
+		"certificate `CN=other leaf` does not chain through a pinned certificate")
+	// intermediates from the store complete the chain
+	trust.Intermediates = []*x509.Certificate{pinnedCA}
+	assert.NoError(t, trust.CheckPinned(pinnedLeaf, nil, roots, now))
+	// and the chain must still be valid
+	assert.Error(t, trust.CheckPinned(pinnedLeaf, nil, x509.NewCertPool(), now))
+}
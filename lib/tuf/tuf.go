@@ -0,0 +1,366 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package tuf signs The Update Framework metadata. A signature covers the
+// canonical JSON encoding of the "signed" object, so signing never changes
+// what was signed and the holders of a threshold of keys can each add their
+// signature to the same file in turn.
+package tuf
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Key types and signature schemes
+const (
+	KeyTypeRSA     = "rsa"
+	KeyTypeECDSA   = "ecdsa"
+	KeyTypeEd25519 = "ed25519"
+
+	SchemeRSAPSS    = "rsassa-pss-sha256"
+	SchemeECDSAP256 = "ecdsa-sha2-nistp256"
+	SchemeECDSAP384 = "ecdsa-sha2-nistp384"
+	SchemeEd25519   = "ed25519"
+)
+
+// Metadata is a signed TUF metadata file
+type Metadata struct {
+	Signatures []Signature     `json:"signatures"`
+	Signed     json.RawMessage `json:"signed"`
+}
+
+// Signature is one signature over the canonical form of the signed object
+type Signature struct {
+	KeyID string `json:"keyid"`
+	Sig   string `json:"sig"`
+}
+
+// Key is a public key as listed in root or delegating targets metadata
+type Key struct {
+	KeyType string `json:"keytype"`
+	Scheme  string `json:"scheme"`
+	KeyVal  KeyVal `json:"keyval"`
+}
+
+// KeyVal holds the public part of a key, PEM-encoded for RSA and ECDSA and
+// hex-encoded for Ed25519
+type KeyVal struct {
+	Public string `json:"public"`
+}
+
+// Role lists the keys trusted to sign a role and how many of them must
+type Role struct {
+	KeyIDs    []string `json:"keyids"`
+	Threshold int      `json:"threshold"`
+}
+
+// DelegatedRole is a role delegated by targets metadata
+type DelegatedRole struct {
+	Role
+	Name string `json:"name"`
+}
+
+// Header holds the fields of the signed object that relic looks at
+type Header struct {
+	Type    string          `json:"_type"`
+	Version int64           `json:"version"`
+	Expires time.Time       `json:"expires"`
+	Keys    map[string]*Key `json:"keys"`
+	Roles   map[string]Role `json:"roles"`
+
+	Delegations *struct {
+		Keys  map[string]*Key `json:"keys"`
+		Roles []DelegatedRole `json:"roles"`
+	} `json:"delegations"`
+}
+
+// Parse a metadata file
+func Parse(blob []byte) (*Metadata, *Header, error) {
+	m := new(Metadata)
+	if err := json.Unmarshal(blob, m); err != nil {
+		return nil, nil, fmt.Errorf("tuf: %w", err)
+	}
+	if len(m.Signed) == 0 {
+		return nil, nil, errors.New("tuf: metadata has no signed object")
+	}
+	h := new(Header)
+	if err := json.Unmarshal(m.Signed, h); err != nil {
+		return nil, nil, fmt.Errorf("tuf: %w", err)
+	}
+	switch h.Type {
+	case "root", "targets", "snapshot", "timestamp":
+	default:
+		return nil, nil, fmt.Errorf("tuf: unknown metadata type %q", h.Type)
+	}
+	return m, h, nil
+}
+
+// Marshal the metadata, leaving the signed object as it is
+func (m *Metadata) Marshal() ([]byte, error) {
+	if m.Signatures == nil {
+		m.Signatures = []Signature{}
+	}
+	blob, err := json.MarshalIndent(m, "", " ")
+	if err != nil {
+		return nil, err
+	}
+	return append(blob, '\n'), nil
+}
+
+// PublicKey describes a public key the way TUF metadata lists it
+func PublicKey(pub crypto.PublicKey) (*Key, error) {
+	switch k := pub.(type) {
+	case ed25519.PublicKey:
+		return &Key{KeyType: KeyTypeEd25519, Scheme: SchemeEd25519, KeyVal: KeyVal{Public: hex.EncodeToString(k)}}, nil
+	}
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	key := &Key{KeyVal: KeyVal{Public: string(bytes.TrimSpace(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})))}}
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		key.KeyType, key.Scheme = KeyTypeRSA, SchemeRSAPSS
+	case *ecdsa.PublicKey:
+		key.KeyType = KeyTypeECDSA
+		switch k.Curve.Params().BitSize {
+		case 256:
+			key.Scheme = SchemeECDSAP256
+		case 384:
+			key.Scheme = SchemeECDSAP384
+		default:
+			return nil, errors.New("tuf: unsupported ECDSA curve")
+		}
+	default:
+		return nil, fmt.Errorf("tuf: unsupported key type %T", pub)
+	}
+	return key, nil
+}
+
+// ID returns the default key ID, the SHA-256 digest of the key's canonical
+// JSON
+func (k *Key) ID() (string, error) {
+	blob, err := json.Marshal(k)
+	if err != nil {
+		return "", err
+	}
+	blob, err = Canonical(blob)
+	if err != nil {
+		return "", err
+	}
+	d := sha256.Sum256(blob)
+	return hex.EncodeToString(d[:]), nil
+}
+
+// Public parses the public key
+func (k *Key) Public() (crypto.PublicKey, error) {
+	if k.KeyType == KeyTypeEd25519 {
+		pub, err := hex.DecodeString(k.KeyVal.Public)
+		if err != nil || len(pub) != ed25519.PublicKeySize {
+			return nil, errors.New("tuf: invalid ed25519 key")
+		}
+		return ed25519.PublicKey(pub), nil
+	}
+	block, _ := pem.Decode([]byte(k.KeyVal.Public))
+	if block == nil {
+		return nil, fmt.Errorf("tuf: invalid %s key", k.KeyType)
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+// FindKey returns the ID under which a public key is listed
+func FindKey(keys map[string]*Key, pub crypto.PublicKey) (string, bool) {
+	want, err := PublicKey(pub)
+	if err != nil {
+		return "", false
+	}
+	for keyID, key := range keys {
+		if key.KeyType != want.KeyType {
+			continue
+		}
+		if listed, err := key.Public(); err == nil && publicKeyEqual(listed, pub) {
+			return keyID, true
+		}
+	}
+	return "", false
+}
+
+func publicKeyEqual(a, b crypto.PublicKey) bool {
+	k, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && k.Equal(b)
+}
+
+// Sign the metadata, replacing any earlier signature with the same key ID and
+// keeping all others
+func (m *Metadata) Sign(signer crypto.Signer, keyID string) error {
+	msg, err := Canonical(m.Signed)
+	if err != nil {
+		return fmt.Errorf("tuf: %w", err)
+	}
+	key, err := PublicKey(signer.Public())
+	if err != nil {
+		return err
+	}
+	var sig []byte
+	switch key.Scheme {
+	case SchemeEd25519:
+		sig, err = signer.Sign(rand.Reader, msg, crypto.Hash(0))
+	case SchemeRSAPSS:
+		d := sha256.Sum256(msg)
+		sig, err = signer.Sign(rand.Reader, d[:], &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256})
+	default:
+		hash := schemeHash(key.Scheme)
+		d := hash.New()
+		d.Write(msg)
+		sig, err = signer.Sign(rand.Reader, d.Sum(nil), hash)
+	}
+	if err != nil {
+		return err
+	}
+	newSig := Signature{KeyID: keyID, Sig: hex.EncodeToString(sig)}
+	for i, s := range m.Signatures {
+		if s.KeyID == keyID {
+			m.Signatures[i] = newSig
+			return nil
+		}
+	}
+	m.Signatures = append(m.Signatures, newSig)
+	return nil
+}
+
+func schemeHash(scheme string) crypto.Hash {
+	switch scheme {
+	case SchemeRSAPSS, SchemeECDSAP256:
+		return crypto.SHA256
+	case SchemeECDSAP384:
+		return crypto.SHA384
+	}
+	return 0
+}
+
+// VerifySignature checks one signature against a key
+func (m *Metadata) VerifySignature(sig Signature, key *Key) error {
+	pub, err := key.Public()
+	if err != nil {
+		return err
+	}
+	raw, err := hex.DecodeString(sig.Sig)
+	if err != nil {
+		return errors.New("tuf: signature is not hex-encoded")
+	}
+	msg, err := Canonical(m.Signed)
+	if err != nil {
+		return fmt.Errorf("tuf: %w", err)
+	}
+	switch k := pub.(type) {
+	case ed25519.PublicKey:
+		if key.Scheme == SchemeEd25519 && ed25519.Verify(k, msg, raw) {
+			return nil
+		}
+	case *rsa.PublicKey:
+		if key.Scheme != SchemeRSAPSS {
+			break
+		}
+		d := sha256.Sum256(msg)
+		if rsa.VerifyPSS(k, crypto.SHA256, d[:], raw, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto}) == nil {
+			return nil
+		}
+	case *ecdsa.PublicKey:
+		hash := schemeHash(key.Scheme)
+		if hash == 0 {
+			break
+		}
+		d := hash.New()
+		d.Write(msg)
+		if ecdsa.VerifyASN1(k, d.Sum(nil), raw) {
+			return nil
+		}
+	}
+	return fmt.Errorf("tuf: bad signature from key %s", sig.KeyID)
+}
+
+// Verify the signatures made by the keys of a role, returning the IDs of the
+// keys with valid signatures. Invalid signatures and signatures by other keys
+// don't count. An error is returned if there are fewer than the threshold,
+// along with the valid key IDs.
+func (m *Metadata) Verify(keys map[string]*Key, role Role) ([]string, error) {
+	if role.Threshold < 1 {
+		return nil, errors.New("tuf: role threshold must be at least 1")
+	}
+	trusted := make(map[string]bool, len(role.KeyIDs))
+	for _, keyID := range role.KeyIDs {
+		trusted[keyID] = true
+	}
+	var valid []string
+	seen := make(map[string]bool)
+	for _, sig := range m.Signatures {
+		key := keys[sig.KeyID]
+		if !trusted[sig.KeyID] || seen[sig.KeyID] || key == nil {
+			continue
+		}
+		if err := m.VerifySignature(sig, key); err != nil {
+			continue
+		}
+		seen[sig.KeyID] = true
+		valid = append(valid, sig.KeyID)
+	}
+	if len(valid) < role.Threshold {
+		return valid, ThresholdError{Valid: len(valid), Threshold: role.Threshold}
+	}
+	return valid, nil
+}
+
+// ThresholdError is returned when too few of a role's keys have signed
+type ThresholdError struct {
+	Valid, Threshold int
+}
+
+func (e ThresholdError) Error() string {
+	return fmt.Sprintf("tuf: %d of %d required signatures", e.Valid, e.Threshold)
+}
+
+// Delegation finds the keys and role for metadata of the given role in the
+// root or targets metadata that delegates to it
+func (h *Header) Delegation(role string) (map[string]*Key, Role, error) {
+	switch h.Type {
+	case "root":
+		if r, ok := h.Roles[role]; ok {
+			return h.Keys, r, nil
+		}
+	case "targets":
+		if h.Delegations != nil {
+			for _, r := range h.Delegations.Roles {
+				if r.Name == role {
+					return h.Delegations.Keys, r.Role, nil
+				}
+			}
+		}
+	}
+	return nil, Role{}, fmt.Errorf("tuf: %s metadata does not delegate to %s", h.Type, role)
+}
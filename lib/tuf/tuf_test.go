@@ -0,0 +1,146 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package tuf_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sassoftware/relic/v7/lib/tuf"
+)
+
+func TestCanonical(t *testing.T) {
+	out, err := tuf.Canonical([]byte(`{ "b": [1, true, null], "a": "quote \" backslash \\ newline \n é", "c": {} }`))
+	require.NoError(t, err)
+	assert.Equal(t, "{\"a\":\"quote \\\" backslash \\\\ newline \n é\",\"b\":[1,true,null],\"c\":{}}", string(out))
+	_, err = tuf.Canonical([]byte(`{"a": 1.5}`))
+	assert.EqualError(t, err, "canonical JSON can't encode number 1.5")
+}
+
+func testKeys(t *testing.T) []crypto.Signer {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	return []crypto.Signer{rsaKey, ecKey, edKey}
+}
+
+// build root metadata trusting each key for the root role
+func testRoot(t *testing.T, signers []crypto.Signer, threshold int) ([]byte, []string) {
+	keys := make(map[string]*tuf.Key)
+	var keyIDs []string
+	for _, signer := range signers {
+		key, err := tuf.PublicKey(signer.Public())
+		require.NoError(t, err)
+		keyID, err := key.ID()
+		require.NoError(t, err)
+		keys[keyID] = key
+		keyIDs = append(keyIDs, keyID)
+	}
+	signed, err := json.Marshal(map[string]interface{}{
+		"_type":        "root",
+		"spec_version": "1.0.31",
+		"version":      1,
+		"expires":      "2099-01-01T00:00:00Z",
+		"keys":         keys,
+		"roles": map[string]tuf.Role{
+			"root":    {KeyIDs: keyIDs, Threshold: threshold},
+			"targets": {KeyIDs: keyIDs[:1], Threshold: 1},
+		},
+	})
+	require.NoError(t, err)
+	return []byte(fmt.Sprintf(`{"signed": %s, "signatures": []}`, signed)), keyIDs
+}
+
+func TestThresholdSigning(t *testing.T) {
+	signers := testKeys(t)
+	blob, keyIDs := testRoot(t, signers, 2)
+	for i, signer := range signers {
+		m, h, err := tuf.Parse(blob)
+		require.NoError(t, err)
+		keyID, ok := tuf.FindKey(h.Keys, signer.Public())
+		require.True(t, ok)
+		assert.Equal(t, keyIDs[i], keyID)
+		require.NoError(t, m.Sign(signer, keyID))
+		blob, err = m.Marshal()
+		require.NoError(t, err)
+
+		keys, role, err := h.Delegation("root")
+		require.NoError(t, err)
+		valid, err := m.Verify(keys, role)
+		assert.Equal(t, keyIDs[:i+1], valid)
+		if i == 0 {
+			assert.EqualError(t, err, "tuf: 1 of 2 required signatures")
+		} else {
+			assert.NoError(t, err)
+		}
+	}
+
+	// signing again replaces the signature
+	m, h, err := tuf.Parse(blob)
+	require.NoError(t, err)
+	require.NoError(t, m.Sign(signers[0], keyIDs[0]))
+	assert.Len(t, m.Signatures, 3)
+
+	// a changed signed object invalidates all of them
+	var signed map[string]interface{}
+	require.NoError(t, json.Unmarshal(m.Signed, &signed))
+	signed["version"] = 2
+	m.Signed, err = json.Marshal(signed)
+	require.NoError(t, err)
+	keys, role, err := h.Delegation("root")
+	require.NoError(t, err)
+	_, err = m.Verify(keys, role)
+	assert.EqualError(t, err, "tuf: 0 of 2 required signatures")
+}
+
+func TestDelegation(t *testing.T) {
+	signers := testKeys(t)
+	blob, _ := testRoot(t, signers, 1)
+	_, root, err := tuf.Parse(blob)
+	require.NoError(t, err)
+	keys, role, err := root.Delegation("targets")
+	require.NoError(t, err)
+	assert.Equal(t, 1, role.Threshold)
+
+	targets := []byte(`{"signed": {"_type": "targets", "version": 3, "expires": "2099-01-01T00:00:00Z", "targets": {}}, "signatures": []}`)
+	m, _, err := tuf.Parse(targets)
+	require.NoError(t, err)
+	// only the key trusted for the role counts
+	require.NoError(t, m.Sign(signers[1], role.KeyIDs[0]+"x"))
+	_, err = m.Verify(keys, role)
+	assert.EqualError(t, err, "tuf: 0 of 1 required signatures")
+	require.NoError(t, m.Sign(signers[0], role.KeyIDs[0]))
+	valid, err := m.Verify(keys, role)
+	require.NoError(t, err)
+	assert.Equal(t, role.KeyIDs, valid)
+
+	_, _, err = root.Delegation("snapshot")
+	assert.EqualError(t, err, "tuf: root metadata does not delegate to snapshot")
+}
@@ -0,0 +1,254 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package uki
+
+// Predict the value of PCR 11 after systemd-stub measures the image and
+// systemd-pcrphase measures each boot phase, and sign TPM2 policies for those
+// values the same way systemd-measure does.
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Well-known UKI sections
+const (
+	SectionLinux   = ".linux"
+	SectionOSRel   = ".osrel"
+	SectionCmdline = ".cmdline"
+	SectionInitrd  = ".initrd"
+	SectionPCRSig  = ".pcrsig"
+	SectionPCRPKey = ".pcrpkey"
+)
+
+const (
+	pcrKernelBoot  = 11
+	tpmAlgSHA256   = 0x000b
+	tpmCCPolicyPCR = 0x0000017f
+)
+
+// sections measured by systemd-stub, in the order they are measured
+var measuredSections = []string{
+	SectionLinux, SectionOSRel, SectionCmdline, SectionInitrd, ".ucode",
+	".splash", ".dtb", ".uname", ".sbat", SectionPCRPKey,
+}
+
+// DefaultPhases are the boot phase paths systemd-measure signs by default
+var DefaultPhases = []string{
+	"enter-initrd",
+	"enter-initrd:leave-initrd",
+	"enter-initrd:leave-initrd:sysinit",
+	"enter-initrd:leave-initrd:sysinit:ready",
+}
+
+// PCRSignature is one entry of the .pcrsig section
+type PCRSignature struct {
+	PCRs        []int  `json:"pcrs"`
+	Fingerprint string `json:"pkfp"`
+	Policy      string `json:"pol"`
+	Signature   string `json:"sig"`
+}
+
+type pcrSigSection struct {
+	SHA256 []PCRSignature `json:"sha256"`
+}
+
+// Validate checks that the image has a kernel and that the text sections are
+// well-formed
+func (img *Image) Validate() error {
+	linux := img.Section(SectionLinux)
+	if linux == nil {
+		return errors.New("UKI has no .linux section")
+	} else if !bytes.HasPrefix(linux.Data, []byte("MZ")) {
+		return errors.New("UKI .linux section is not an EFI kernel image")
+	}
+	for _, name := range []string{SectionCmdline, SectionOSRel} {
+		if s := img.Section(name); s != nil {
+			text := s.Contents()
+			if i := bytes.IndexByte(text, 0); i >= 0 && len(bytes.Trim(text[i:], "\x00")) != 0 {
+				return fmt.Errorf("UKI %s section contains a NUL", name)
+			} else if !utf8.Valid(bytes.TrimRight(text, "\x00")) {
+				return fmt.Errorf("UKI %s section is not valid UTF-8", name)
+			}
+		}
+	}
+	return nil
+}
+
+// MeasureSections returns the SHA-256 PCR 11 value systemd-stub produces when
+// booting the image
+func (img *Image) MeasureSections() []byte {
+	pcr := make([]byte, sha256.Size)
+	for _, name := range measuredSections {
+		s := img.Section(name)
+		if s == nil {
+			continue
+		}
+		pcr = extend(pcr, append([]byte(name), 0))
+		pcr = extend(pcr, s.Contents())
+	}
+	return pcr
+}
+
+// MeasurePhase extends a PCR value with each phase in a colon-separated boot
+// phase path, as systemd-pcrphase does
+func MeasurePhase(pcr []byte, phase string) []byte {
+	for _, word := range strings.Split(phase, ":") {
+		if word != "" {
+			pcr = extend(pcr, []byte(word))
+		}
+	}
+	return pcr
+}
+
+func extend(pcr, data []byte) []byte {
+	event := sha256.Sum256(data)
+	d := sha256.New()
+	d.Write(pcr)
+	d.Write(event[:])
+	return d.Sum(nil)
+}
+
+// PolicyDigest returns the TPM2_PolicyPCR digest for PCR 11 having the given
+// value
+func PolicyDigest(pcr []byte) []byte {
+	var buf bytes.Buffer
+	buf.Write(make([]byte, sha256.Size))
+	_ = binary.Write(&buf, binary.BigEndian, uint32(tpmCCPolicyPCR))
+	// TPML_PCR_SELECTION with just PCR 11 in the SHA-256 bank
+	_ = binary.Write(&buf, binary.BigEndian, uint32(1))
+	_ = binary.Write(&buf, binary.BigEndian, uint16(tpmAlgSHA256))
+	buf.Write([]byte{3, 0, 1 << (pcrKernelBoot - 8), 0})
+	pcrDigest := sha256.Sum256(pcr)
+	buf.Write(pcrDigest[:])
+	sum := sha256.Sum256(buf.Bytes())
+	return sum[:]
+}
+
+// PublicKeyPEM formats a public key for the .pcrpkey section and returns it
+// along with its fingerprint
+func PublicKeyPEM(pub crypto.PublicKey) ([]byte, string, error) {
+	if _, ok := pub.(*rsa.PublicKey); !ok {
+		return nil, "", errors.New("PCR signatures require an RSA key")
+	}
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, "", err
+	}
+	fp := sha256.Sum256(der)
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), hex.EncodeToString(fp[:]), nil
+}
+
+// SignPCRPolicies signs the PCR 11 policy for each boot phase path and returns
+// the contents of the .pcrsig section. The .pcrpkey section must already hold
+// the signer's public key since it is measured too.
+func SignPCRPolicies(img *Image, signer crypto.Signer, phases []string) ([]byte, error) {
+	_, fp, err := PublicKeyPEM(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	if img.Section(SectionPCRPKey) == nil {
+		return nil, errors.New("UKI has no .pcrpkey section")
+	}
+	base := img.MeasureSections()
+	var section pcrSigSection
+	for _, phase := range phases {
+		policy := PolicyDigest(MeasurePhase(base, phase))
+		d := sha256.Sum256(policy)
+		sig, err := signer.Sign(rand.Reader, d[:], crypto.SHA256)
+		if err != nil {
+			return nil, err
+		}
+		section.SHA256 = append(section.SHA256, PCRSignature{
+			PCRs:        []int{pcrKernelBoot},
+			Fingerprint: fp,
+			Policy:      hex.EncodeToString(policy),
+			Signature:   base64.StdEncoding.EncodeToString(sig),
+		})
+	}
+	return json.Marshal(section)
+}
+
+// VerifyPCRSignatures checks each entry of the .pcrsig section against the key
+// in .pcrpkey. If phases is not empty then every one of those boot phase paths
+// must have a signature over the policy predicted from the image.
+func VerifyPCRSignatures(img *Image, phases []string) ([]PCRSignature, error) {
+	sigSection := img.Section(SectionPCRSig)
+	keySection := img.Section(SectionPCRPKey)
+	if sigSection == nil {
+		return nil, nil
+	} else if keySection == nil {
+		return nil, errors.New("UKI has a .pcrsig section but no .pcrpkey")
+	}
+	block, _ := pem.Decode(keySection.Contents())
+	if block == nil {
+		return nil, errors.New("UKI .pcrpkey section is not a PEM public key")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("UKI .pcrpkey section: %w", err)
+	}
+	rsaPub, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("PCR signatures require an RSA key")
+	}
+	fp := sha256.Sum256(block.Bytes)
+	var section pcrSigSection
+	if err := json.Unmarshal(bytes.TrimRight(sigSection.Contents(), "\x00"), &section); err != nil {
+		return nil, fmt.Errorf("UKI .pcrsig section: %w", err)
+	}
+	expected := make(map[string]string, len(phases))
+	base := img.MeasureSections()
+	for _, phase := range phases {
+		expected[hex.EncodeToString(PolicyDigest(MeasurePhase(base, phase)))] = phase
+	}
+	for _, entry := range section.SHA256 {
+		if entry.Fingerprint != hex.EncodeToString(fp[:]) {
+			continue
+		}
+		policy, err := hex.DecodeString(entry.Policy)
+		if err != nil {
+			return nil, fmt.Errorf("UKI .pcrsig section: %w", err)
+		}
+		sig, err := base64.StdEncoding.DecodeString(entry.Signature)
+		if err != nil {
+			return nil, fmt.Errorf("UKI .pcrsig section: %w", err)
+		}
+		d := sha256.Sum256(policy)
+		if err := rsa.VerifyPKCS1v15(rsaPub, crypto.SHA256, d[:], sig); err != nil {
+			return nil, fmt.Errorf("PCR policy signature for %s: %w", entry.Policy, err)
+		}
+		delete(expected, strings.ToLower(entry.Policy))
+	}
+	for _, phase := range expected {
+		return nil, fmt.Errorf("UKI has no PCR policy signature for boot phase %s", phase)
+	}
+	return section.SHA256, nil
+}
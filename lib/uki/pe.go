@@ -0,0 +1,256 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package uki
+
+// Read and rewrite the sections of a systemd-stub unified kernel image.
+// Reference: https://uapi-group.org/specifications/specs/unified_kernel_image/
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	sectionHeaderSize = 40
+	// IMAGE_SCN_CNT_INITIALIZED_DATA | IMAGE_SCN_MEM_READ
+	dataCharacteristics = 0x40000040
+
+	// offsets into the optional header, which are the same for PE32 and PE32+
+	optSectionAlignment = 32
+	optFileAlignment    = 36
+	optSizeOfImage      = 56
+	optSizeOfHeaders    = 60
+	optCheckSum         = 64
+)
+
+// Image is a PE image whose sections can be replaced
+type Image struct {
+	Sections []*Section
+
+	header    []byte
+	peStart   int
+	secTable  int
+	certDir   int
+	fileAlign uint32
+	sectAlign uint32
+}
+
+// Section is a single PE section and its raw data
+type Section struct {
+	Header pe.SectionHeader32
+	Data   []byte
+}
+
+// Parse a PE image. Any existing Authenticode signature is dropped.
+func Parse(blob []byte) (*Image, error) {
+	if len(blob) < 0x40 || !bytes.HasPrefix(blob, []byte("MZ")) {
+		return nil, errors.New("not a PE image")
+	}
+	img := &Image{peStart: int(binary.LittleEndian.Uint32(blob[0x3c:]))}
+	if img.peStart+24 > len(blob) || !bytes.Equal(blob[img.peStart:img.peStart+4], []byte("PE\x00\x00")) {
+		return nil, errors.New("not a PE image")
+	}
+	var fh pe.FileHeader
+	if err := binary.Read(bytes.NewReader(blob[img.peStart+4:]), binary.LittleEndian, &fh); err != nil {
+		return nil, err
+	}
+	optStart := img.peStart + 24
+	if optStart+int(fh.SizeOfOptionalHeader) > len(blob) || fh.SizeOfOptionalHeader < optCheckSum+4 {
+		return nil, errors.New("truncated PE optional header")
+	}
+	opt := blob[optStart : optStart+int(fh.SizeOfOptionalHeader)]
+	switch binary.LittleEndian.Uint16(opt) {
+	case 0x10b:
+		img.certDir = optStart + 128
+	case 0x20b:
+		img.certDir = optStart + 144
+	default:
+		return nil, errors.New("unrecognized optional header magic")
+	}
+	if img.certDir+8 > optStart+len(opt) {
+		return nil, errors.New("PE header did not leave room for signature")
+	}
+	img.sectAlign = binary.LittleEndian.Uint32(opt[optSectionAlignment:])
+	img.fileAlign = binary.LittleEndian.Uint32(opt[optFileAlignment:])
+	if img.fileAlign == 0 || img.sectAlign == 0 {
+		return nil, errors.New("invalid PE alignment")
+	}
+	sizeOfHeaders := int(binary.LittleEndian.Uint32(opt[optSizeOfHeaders:]))
+	img.secTable = optStart + len(opt)
+	if sizeOfHeaders > len(blob) || img.secTable+int(fh.NumberOfSections)*sectionHeaderSize > sizeOfHeaders {
+		return nil, errors.New("truncated PE section table")
+	}
+	img.header = append([]byte(nil), blob[:sizeOfHeaders]...)
+	headers := make([]pe.SectionHeader32, fh.NumberOfSections)
+	if err := binary.Read(bytes.NewReader(blob[img.secTable:]), binary.LittleEndian, headers); err != nil {
+		return nil, err
+	}
+	certStart := int64(binary.LittleEndian.Uint32(blob[img.certDir:]))
+	end := int64(sizeOfHeaders)
+	for _, sh := range headers {
+		start := int64(sh.PointerToRawData)
+		stop := start + int64(sh.SizeOfRawData)
+		if stop > int64(len(blob)) {
+			return nil, fmt.Errorf("PE section %s is truncated", sectionName(sh))
+		}
+		if stop > end {
+			end = stop
+		}
+		img.Sections = append(img.Sections, &Section{Header: sh, Data: blob[start:stop]})
+	}
+	if end < int64(len(blob)) && (certStart == 0 || certStart < end) {
+		return nil, errors.New("trailing data after PE sections is not supported")
+	}
+	return img, nil
+}
+
+func sectionName(sh pe.SectionHeader32) string {
+	return strings.TrimRight(string(sh.Name[:]), "\x00")
+}
+
+// Name of the section
+func (s *Section) Name() string {
+	return sectionName(s.Header)
+}
+
+// Contents returns the section as it appears in memory, which is VirtualSize
+// bytes long
+func (s *Section) Contents() []byte {
+	size := int(s.Header.VirtualSize)
+	if size == 0 || size == len(s.Data) {
+		return s.Data
+	} else if size < len(s.Data) {
+		return s.Data[:size]
+	}
+	ret := make([]byte, size)
+	copy(ret, s.Data)
+	return ret
+}
+
+// Section returns the named section, or nil if it is not present
+func (img *Image) Section(name string) *Section {
+	for _, s := range img.Sections {
+		if s.Name() == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// RemoveSection removes the named section if it is present
+func (img *Image) RemoveSection(name string) {
+	kept := img.Sections[:0]
+	for _, s := range img.Sections {
+		if s.Name() != name {
+			kept = append(kept, s)
+		}
+	}
+	img.Sections = kept
+}
+
+// SetSection replaces the contents of the named section, or adds it if it is
+// missing. The section is placed at the end of the image but ahead of .linux,
+// which stays last so the kernel can grow into the space after it.
+func (img *Image) SetSection(name string, data []byte) error {
+	if len(name) > 8 {
+		return fmt.Errorf("PE section name %q is too long", name)
+	}
+	img.RemoveSection(name)
+	var linux *Section
+	if n := len(img.Sections); n > 0 && img.Sections[n-1].Name() == SectionLinux {
+		linux = img.Sections[n-1]
+		img.Sections = img.Sections[:n-1]
+	}
+	s := &Section{Data: data}
+	copy(s.Header.Name[:], name)
+	s.Header.VirtualSize = uint32(len(data))
+	s.Header.VirtualAddress = img.nextAddress()
+	s.Header.Characteristics = dataCharacteristics
+	img.Sections = append(img.Sections, s)
+	if linux != nil {
+		linux.Header.VirtualAddress = img.nextAddress()
+		img.Sections = append(img.Sections, linux)
+	}
+	return nil
+}
+
+// first free virtual address after all sections
+func (img *Image) nextAddress() uint32 {
+	var end uint32
+	for _, s := range img.Sections {
+		size := s.Header.VirtualSize
+		if size < s.Header.SizeOfRawData {
+			size = s.Header.SizeOfRawData
+		}
+		if e := s.Header.VirtualAddress + size; e > end {
+			end = e
+		}
+	}
+	if end == 0 {
+		end = uint32(len(img.header))
+	}
+	return align(end, img.sectAlign)
+}
+
+// Bytes lays out the sections and returns the unsigned image
+func (img *Image) Bytes() ([]byte, error) {
+	tableEnd := img.secTable + len(img.Sections)*sectionHeaderSize
+	if tableEnd > len(img.header) {
+		return nil, errors.New("no room in PE header for another section")
+	}
+	var buf bytes.Buffer
+	buf.Write(img.header)
+	buf.Write(make([]byte, int(align(uint32(buf.Len()), img.fileAlign))-buf.Len()))
+	table := new(bytes.Buffer)
+	for _, s := range img.Sections {
+		sh := s.Header
+		if len(s.Data) == 0 {
+			sh.PointerToRawData = 0
+			sh.SizeOfRawData = 0
+		} else {
+			sh.PointerToRawData = uint32(buf.Len())
+			sh.SizeOfRawData = align(uint32(len(s.Data)), img.fileAlign)
+			buf.Write(s.Data)
+			buf.Write(make([]byte, int(sh.SizeOfRawData)-len(s.Data)))
+		}
+		_ = binary.Write(table, binary.LittleEndian, sh)
+	}
+	out := buf.Bytes()
+	// clear the old section table before writing the new one
+	oldEnd := img.secTable + int(binary.LittleEndian.Uint16(img.header[img.peStart+6:]))*sectionHeaderSize
+	if oldEnd > len(img.header) {
+		oldEnd = len(img.header)
+	}
+	for i := img.secTable; i < oldEnd; i++ {
+		out[i] = 0
+	}
+	copy(out[img.secTable:], table.Bytes())
+	binary.LittleEndian.PutUint16(out[img.peStart+6:], uint16(len(img.Sections)))
+	optStart := img.peStart + 24
+	binary.LittleEndian.PutUint32(out[optStart+optSizeOfImage:], img.nextAddress())
+	binary.LittleEndian.PutUint32(out[optStart+optCheckSum:], 0)
+	copy(out[img.certDir:img.certDir+8], make([]byte, 8))
+	return out, nil
+}
+
+func align(v, n uint32) uint32 {
+	return (v + n - 1) / n * n
+}
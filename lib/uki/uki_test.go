@@ -0,0 +1,107 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package uki
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"debug/pe"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// build a minimal PE32+ image holding just a .linux section
+func testImage(t *testing.T) []byte {
+	var buf bytes.Buffer
+	dos := make([]byte, 0x40)
+	copy(dos, "MZ")
+	binary.LittleEndian.PutUint32(dos[0x3c:], 0x40)
+	buf.Write(dos)
+	buf.WriteString("PE\x00\x00")
+	require.NoError(t, binary.Write(&buf, binary.LittleEndian, pe.FileHeader{
+		Machine:              pe.IMAGE_FILE_MACHINE_AMD64,
+		NumberOfSections:     1,
+		SizeOfOptionalHeader: 240,
+	}))
+	require.NoError(t, binary.Write(&buf, binary.LittleEndian, pe.OptionalHeader64{
+		Magic:               0x20b,
+		SectionAlignment:    0x1000,
+		FileAlignment:       0x200,
+		SizeOfImage:         0x2000,
+		SizeOfHeaders:       0x200,
+		NumberOfRvaAndSizes: 16,
+	}))
+	sh := pe.SectionHeader32{
+		VirtualSize:      12,
+		VirtualAddress:   0x1000,
+		SizeOfRawData:    0x200,
+		PointerToRawData: 0x200,
+	}
+	copy(sh.Name[:], SectionLinux)
+	require.NoError(t, binary.Write(&buf, binary.LittleEndian, sh))
+	buf.Write(make([]byte, 0x200-buf.Len()))
+	kernel := make([]byte, 0x200)
+	copy(kernel, "MZ kernel...")
+	buf.Write(kernel)
+	return buf.Bytes()
+}
+
+func TestSetSection(t *testing.T) {
+	img, err := Parse(testImage(t))
+	require.NoError(t, err)
+	require.NoError(t, img.Validate())
+	require.NoError(t, img.SetSection(SectionCmdline, []byte("console=ttyS0")))
+	blob, err := img.Bytes()
+	require.NoError(t, err)
+
+	img, err = Parse(blob)
+	require.NoError(t, err)
+	require.Len(t, img.Sections, 2)
+	assert.Equal(t, SectionCmdline, img.Sections[0].Name())
+	assert.Equal(t, SectionLinux, img.Sections[1].Name(), ".linux stays last")
+	assert.Equal(t, []byte("console=ttyS0"), img.Section(SectionCmdline).Contents())
+	assert.Equal(t, []byte("MZ kernel..."), img.Section(SectionLinux).Contents())
+	assert.Greater(t, img.Sections[1].Header.VirtualAddress, img.Sections[0].Header.VirtualAddress)
+
+	require.NoError(t, img.SetSection(SectionCmdline, []byte("bad\x00cmdline")))
+	assert.Error(t, img.Validate())
+}
+
+func TestPCRSignatures(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	img, err := Parse(testImage(t))
+	require.NoError(t, err)
+	pkey, _, err := PublicKeyPEM(key.Public())
+	require.NoError(t, err)
+	require.NoError(t, img.SetSection(SectionPCRPKey, pkey))
+	pcrsig, err := SignPCRPolicies(img, key, DefaultPhases)
+	require.NoError(t, err)
+	require.NoError(t, img.SetSection(SectionPCRSig, pcrsig))
+
+	sigs, err := VerifyPCRSignatures(img, DefaultPhases)
+	require.NoError(t, err)
+	assert.Len(t, sigs, len(DefaultPhases))
+	// .pcrsig isn't measured but everything else is
+	require.NoError(t, img.SetSection(SectionCmdline, []byte("init=/bin/sh")))
+	_, err = VerifyPCRSignatures(img, DefaultPhases)
+	assert.ErrorContains(t, err, "no PCR policy signature")
+}
@@ -0,0 +1,106 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package vba
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	chunkSize       = 4096
+	containerMarker = 0x01
+	chunkSignature  = 0x3000
+	chunkFlag       = 0x8000
+	chunkSizeMask   = 0x0fff
+)
+
+// Decompress a CompressedContainer as used by the dir and module streams
+func Decompress(data []byte) ([]byte, error) {
+	if len(data) == 0 || data[0] != containerMarker {
+		return nil, errors.New("invalid compressed container")
+	}
+	data = data[1:]
+	var out []byte
+	for len(data) > 0 {
+		if len(data) < 2 {
+			return nil, errors.New("truncated compressed chunk")
+		}
+		header := binary.LittleEndian.Uint16(data)
+		if header&0x7000 != chunkSignature {
+			return nil, errors.New("invalid compressed chunk signature")
+		}
+		size := int(header&chunkSizeMask) + 3
+		if size > len(data) {
+			size = len(data)
+		}
+		chunk := data[2:size]
+		data = data[size:]
+		if header&chunkFlag == 0 {
+			// raw chunk
+			if len(chunk) != chunkSize {
+				return nil, errors.New("invalid raw chunk size")
+			}
+			out = append(out, chunk...)
+			continue
+		}
+		var err error
+		out, err = decompressChunk(out, chunk)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func decompressChunk(out, chunk []byte) ([]byte, error) {
+	start := len(out)
+	for len(chunk) > 0 {
+		flags := chunk[0]
+		chunk = chunk[1:]
+		for i := 0; i < 8 && len(chunk) > 0; i++ {
+			if flags&(1<<i) == 0 {
+				// literal
+				out = append(out, chunk[0])
+				chunk = chunk[1:]
+				continue
+			}
+			if len(chunk) < 2 {
+				return nil, errors.New("truncated copy token")
+			}
+			token := binary.LittleEndian.Uint16(chunk)
+			chunk = chunk[2:]
+			// the split between offset and length depends on how far into
+			// the chunk the decompressed data is
+			bitCount := 4
+			for (1 << bitCount) < len(out)-start {
+				bitCount++
+			}
+			lengthMask := uint16(0xffff) >> bitCount
+			length := int(token&lengthMask) + 3
+			offset := int(token>>(16-bitCount)) + 1
+			if offset > len(out)-start {
+				return nil, errors.New("invalid copy token")
+			}
+			src := len(out) - offset
+			for j := 0; j < length; j++ {
+				out = append(out, out[src+j])
+			}
+		}
+	}
+	return out, nil
+}
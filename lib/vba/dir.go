@@ -0,0 +1,147 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package vba
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Record IDs found in the dir stream
+const (
+	recSysKind           = 0x0001
+	recLcid              = 0x0002
+	recCodePage          = 0x0003
+	recName              = 0x0004
+	recDocString         = 0x0005
+	recHelpFilePath      = 0x0006
+	recHelpContext       = 0x0007
+	recLibFlags          = 0x0008
+	recVersion           = 0x0009
+	recConstants         = 0x000c
+	recReferenceRegd     = 0x000d
+	recReferenceProject  = 0x000e
+	recModules           = 0x000f
+	recTerminator        = 0x0010
+	recCookie            = 0x0013
+	recLcidInvoke        = 0x0014
+	recReferenceName     = 0x0016
+	recModuleName        = 0x0019
+	recModuleStreamName  = 0x001a
+	recModuleDocString   = 0x001c
+	recModuleHelpContext = 0x001e
+	recModuleProcedural  = 0x0021
+	recModuleDocument    = 0x0022
+	recModuleReadOnly    = 0x0025
+	recModulePrivate     = 0x0028
+	recModuleTerminator  = 0x002b
+	recModuleCookie      = 0x002c
+	recReferenceControl  = 0x002f
+	recControlExtended   = 0x0030
+	recModuleOffset      = 0x0031
+	recReferenceOriginal = 0x0033
+	recModuleNameUnicode = 0x0047
+)
+
+type record struct {
+	ID   uint16
+	Size uint32
+	Data []byte
+}
+
+// Module is a single code module listed in the dir stream
+type Module struct {
+	Name       string
+	StreamName string
+	TextOffset uint32
+	// records describing this module, starting with its name and ending with
+	// its terminator
+	records []record
+}
+
+// split a decompressed dir stream into records
+func parseDir(blob []byte) ([]record, error) {
+	var records []record
+	for len(blob) > 0 {
+		if len(blob) < 6 {
+			return nil, errors.New("truncated dir stream")
+		}
+		rec := record{
+			ID:   binary.LittleEndian.Uint16(blob),
+			Size: binary.LittleEndian.Uint32(blob[2:]),
+		}
+		blob = blob[6:]
+		size := int(rec.Size)
+		if rec.ID == recVersion {
+			// the size field is reserved and doesn't cover the version
+			size = 6
+		}
+		if size > len(blob) {
+			return nil, fmt.Errorf("truncated dir record %#x", rec.ID)
+		}
+		rec.Data = blob[:size]
+		blob = blob[size:]
+		records = append(records, rec)
+		if rec.ID == recTerminator {
+			break
+		}
+	}
+	return records, nil
+}
+
+// collect the modules listed in a dir stream
+func dirModules(records []record) ([]*Module, error) {
+	var modules []*Module
+	var cur *Module
+	for _, rec := range records {
+		switch rec.ID {
+		case recModuleName:
+			cur = &Module{Name: string(rec.Data)}
+			modules = append(modules, cur)
+		case recModuleStreamName:
+			if cur != nil {
+				cur.StreamName = string(rec.Data)
+			}
+		case recModuleOffset:
+			if cur != nil && len(rec.Data) == 4 {
+				cur.TextOffset = binary.LittleEndian.Uint32(rec.Data)
+			}
+		}
+		if cur != nil {
+			cur.records = append(cur.records, rec)
+			if rec.ID == recModuleTerminator {
+				cur = nil
+			}
+		}
+	}
+	for _, module := range modules {
+		if module.StreamName == "" {
+			return nil, fmt.Errorf("module %q has no stream name", module.Name)
+		}
+	}
+	return modules, nil
+}
+
+func findRecord(records []record, id uint16) []byte {
+	for _, rec := range records {
+		if rec.ID == id {
+			return rec.Data
+		}
+	}
+	return nil
+}
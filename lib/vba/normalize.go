@@ -0,0 +1,269 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package vba
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/binary"
+	"io"
+	"strings"
+
+	"github.com/sassoftware/relic/v7/lib/comdoc"
+)
+
+// designer storages are normalized in blocks of this size
+const designerBlockSize = 1023
+
+// attributes that VBA adds to every module and that are therefore left out of
+// the V3 hash
+var defaultAttributes = []string{
+	"attribute vb_base = \"0{00020820-0000-0000-c000-000000000046}\"",
+	"attribute vb_globalnamespace = false",
+	"attribute vb_creatable = false",
+	"attribute vb_predeclaredid = true",
+	"attribute vb_exposed = true",
+	"attribute vb_templatederived = false",
+	"attribute vb_customizable = true",
+}
+
+// dir records whose values change without the project changing, so only their
+// ID and size are part of the V3 hash
+var volatileRecords = map[uint16]bool{
+	recCookie:            true,
+	recModuleCookie:      true,
+	recModuleOffset:      true,
+	recLcidInvoke:        true,
+	recCodePage:          true,
+	recHelpContext:       true,
+	recModuleHelpContext: true,
+}
+
+// ContentHash returns the MD5 digest used by legacy signatures
+func (p *Project) ContentHash() []byte {
+	d := crypto.MD5.New()
+	p.contentNormalized(d)
+	return d.Sum(nil)
+}
+
+// AgileContentHash returns the digest used by agile signatures, which also
+// covers the contents of any designers (forms)
+func (p *Project) AgileContentHash(hash crypto.Hash) ([]byte, error) {
+	d := hash.New()
+	p.contentNormalized(d)
+	if err := p.formsNormalized(d); err != nil {
+		return nil, err
+	}
+	return d.Sum(nil), nil
+}
+
+// V3ContentHash returns the digest used by V3 signatures, which covers all of
+// the project's metadata as well as its source and designers
+func (p *Project) V3ContentHash(hash crypto.Hash) ([]byte, error) {
+	d := hash.New()
+	p.v3ContentNormalized(d)
+	if err := p.projectNormalized(d); err != nil {
+		return nil, err
+	}
+	return d.Sum(nil), nil
+}
+
+// ContentNormalizedData: the project name and constants, references, and
+// module source without attributes or line endings
+func (p *Project) contentNormalized(w io.Writer) {
+	_, _ = w.Write(findRecord(p.dir, recName))
+	_, _ = w.Write(findRecord(p.dir, recConstants))
+	for _, rec := range p.dir {
+		switch rec.ID {
+		case recReferenceRegd, recReferenceControl, recReferenceOriginal:
+			writeUint16(w, rec.ID)
+			_, _ = w.Write(rec.Data)
+		case recControlExtended:
+			_, _ = w.Write(rec.Data)
+		case recReferenceProject:
+			// everything up to the first NUL, which is usually inside of
+			// the first size field
+			data := rec.Data
+			if i := bytes.IndexByte(data, 0); i >= 0 {
+				data = data[:i]
+			}
+			_, _ = w.Write(data)
+		}
+	}
+	for _, module := range p.Modules {
+		for _, line := range splitLines(p.sources[module.Name]) {
+			if !hasPrefixFold(line, "attribute") {
+				_, _ = w.Write(line)
+			}
+		}
+	}
+}
+
+// V3ContentNormalizedData: every dir record, with volatile values left out,
+// and each module's source with line endings normalized
+func (p *Project) v3ContentNormalized(w io.Writer) {
+	modules := make(map[string]*Module, len(p.Modules))
+	for _, module := range p.Modules {
+		modules[module.Name] = module
+	}
+	var cur *Module
+	for _, rec := range p.dir {
+		if rec.ID == recModuleName {
+			cur = modules[string(rec.Data)]
+		}
+		writeUint16(w, rec.ID)
+		writeUint32(w, rec.Size)
+		if !volatileRecords[rec.ID] {
+			_, _ = w.Write(rec.Data)
+		}
+		if rec.ID == recModuleTerminator && cur != nil {
+			p.v3ModuleNormalized(w, cur)
+			cur = nil
+		}
+	}
+}
+
+func (p *Project) v3ModuleNormalized(w io.Writer, module *Module) {
+	wrote := false
+	for _, line := range splitLines(p.sources[module.Name]) {
+		if hasPrefixFold(line, "attribute vb_name = ") || isDefaultAttribute(line) {
+			continue
+		}
+		_, _ = w.Write(line)
+		_, _ = w.Write([]byte{'\n'})
+		wrote = true
+	}
+	if !wrote {
+		_, _ = io.WriteString(w, module.Name+"\n")
+	}
+}
+
+// ProjectNormalizedData: project properties other than those that change on
+// every save, and the contents of designers
+func (p *Project) projectNormalized(w io.Writer) error {
+	for _, line := range p.properties {
+		name, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(name) {
+		case "id", "document", "cmg", "dpb", "gc":
+			continue
+		case "baseclass":
+			if err := p.designerNormalized(w, value); err != nil {
+				return err
+			}
+		}
+		_, _ = io.WriteString(w, name)
+		_, _ = io.WriteString(w, value)
+	}
+	return nil
+}
+
+// FormsNormalizedData: the contents of each designer storage
+func (p *Project) formsNormalized(w io.Writer) error {
+	for _, line := range p.properties {
+		name, value, ok := strings.Cut(line, "=")
+		if ok && strings.EqualFold(name, "baseclass") {
+			if err := p.designerNormalized(w, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (p *Project) designerNormalized(w io.Writer, name string) error {
+	root, err := listDir(p.cdf, nil)
+	if err != nil {
+		return err
+	}
+	storage := findEntry(root, strings.Trim(name, "\""))
+	if storage == nil {
+		// designers without a storage have no content of their own
+		return nil
+	}
+	return p.storageNormalized(w, storage)
+}
+
+func (p *Project) storageNormalized(w io.Writer, storage *comdoc.DirEnt) error {
+	files, err := listDir(p.cdf, storage)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		switch f.Type {
+		case comdoc.DirStorage:
+			if err := p.storageNormalized(w, f); err != nil {
+				return err
+			}
+		case comdoc.DirStream:
+			blob, err := readEntry(p.cdf, f)
+			if err != nil {
+				return err
+			}
+			_, _ = w.Write(blob)
+			if pad := len(blob) % designerBlockSize; pad != 0 {
+				_, _ = w.Write(make([]byte, designerBlockSize-pad))
+			}
+		}
+	}
+	return nil
+}
+
+// split source code on CR, LF or CRLF
+func splitLines(source []byte) [][]byte {
+	var lines [][]byte
+	for len(source) > 0 {
+		i := bytes.IndexAny(source, "\r\n")
+		if i < 0 {
+			lines = append(lines, source)
+			break
+		}
+		lines = append(lines, source[:i])
+		if source[i] == '\r' && i+1 < len(source) && source[i+1] == '\n' {
+			i++
+		}
+		source = source[i+1:]
+	}
+	return lines
+}
+
+func hasPrefixFold(line []byte, prefix string) bool {
+	return len(line) >= len(prefix) && strings.EqualFold(string(line[:len(prefix)]), prefix)
+}
+
+func isDefaultAttribute(line []byte) bool {
+	for _, attr := range defaultAttributes {
+		if strings.EqualFold(string(line), attr) {
+			return true
+		}
+	}
+	return false
+}
+
+func writeUint16(w io.Writer, v uint16) {
+	var b [2]byte
+	binary.LittleEndian.PutUint16(b[:], v)
+	_, _ = w.Write(b[:])
+}
+
+func writeUint32(w io.Writer, v uint32) {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], v)
+	_, _ = w.Write(b[:])
+}
@@ -0,0 +1,156 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package vba
+
+// Read the VBA project storage of an Office document.
+// Reference: [MS-OVBA] Office VBA File Format Structure
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/sassoftware/relic/v7/lib/comdoc"
+)
+
+// Names of the root streams holding each kind of signature
+const (
+	StreamSignature      = "\x05DigitalSignature"
+	StreamSignatureAgile = "\x05DigitalSignatureAgile"
+	StreamSignatureV3    = "\x05DigitalSignatureExt"
+)
+
+// Project is a parsed VBA project
+type Project struct {
+	Name    string
+	Modules []*Module
+
+	cdf        *comdoc.ComDoc
+	dir        []record
+	properties []string
+	sources    map[string][]byte
+}
+
+// Open the VBA project held in a compound document such as vbaProject.bin
+func Open(cdf *comdoc.ComDoc) (*Project, error) {
+	p := &Project{cdf: cdf, sources: make(map[string][]byte)}
+	root, err := listDir(cdf, nil)
+	if err != nil {
+		return nil, err
+	}
+	vbaDir := findEntry(root, "VBA")
+	if vbaDir == nil || vbaDir.Type != comdoc.DirStorage {
+		return nil, errors.New("VBA storage not found")
+	}
+	vbaFiles, err := listDir(cdf, vbaDir)
+	if err != nil {
+		return nil, err
+	}
+	compressed, err := readEntry(cdf, findEntry(vbaFiles, "dir"))
+	if err != nil {
+		return nil, fmt.Errorf("reading dir stream: %w", err)
+	}
+	dir, err := Decompress(compressed)
+	if err != nil {
+		return nil, fmt.Errorf("reading dir stream: %w", err)
+	}
+	p.dir, err = parseDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	p.Name = string(findRecord(p.dir, recName))
+	p.Modules, err = dirModules(p.dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, module := range p.Modules {
+		stream, err := readEntry(cdf, findEntry(vbaFiles, module.StreamName))
+		if err != nil {
+			return nil, fmt.Errorf("module %s: %w", module.Name, err)
+		}
+		if int(module.TextOffset) > len(stream) {
+			return nil, fmt.Errorf("module %s: invalid text offset", module.Name)
+		}
+		source, err := Decompress(stream[module.TextOffset:])
+		if err != nil {
+			return nil, fmt.Errorf("module %s: %w", module.Name, err)
+		}
+		p.sources[module.Name] = source
+	}
+	project, err := readEntry(cdf, findEntry(root, "PROJECT"))
+	if err != nil {
+		return nil, fmt.Errorf("reading PROJECT stream: %w", err)
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(project))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.HasPrefix(line, "[") {
+			// host extender and workspace sections aren't part of the project
+			break
+		}
+		p.properties = append(p.properties, line)
+	}
+	return p, scanner.Err()
+}
+
+// Source returns the decompressed source code of a module
+func (p *Project) Source(module *Module) []byte {
+	return p.sources[module.Name]
+}
+
+// list a storage, sorted in the same order as the compound document's tree
+func listDir(cdf *comdoc.ComDoc, parent *comdoc.DirEnt) ([]*comdoc.DirEnt, error) {
+	if parent != nil && parent.StorageRoot < 0 {
+		return nil, nil
+	}
+	files, err := cdf.ListDir(parent)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(files, func(i, j int) bool {
+		a, b := files[i].Name(), files[j].Name()
+		if len(a) != len(b) {
+			return len(a) < len(b)
+		}
+		return strings.ToUpper(a) < strings.ToUpper(b)
+	})
+	return files, nil
+}
+
+func findEntry(files []*comdoc.DirEnt, name string) *comdoc.DirEnt {
+	for _, f := range files {
+		if strings.EqualFold(f.Name(), name) {
+			return f
+		}
+	}
+	return nil
+}
+
+func readEntry(cdf *comdoc.ComDoc, entry *comdoc.DirEnt) ([]byte, error) {
+	if entry == nil {
+		return nil, errors.New("stream not found")
+	}
+	r, err := cdf.ReadStream(entry)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(r)
+}
@@ -0,0 +1,174 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package wasm signs WebAssembly modules with an embedded signature section,
+// following the wasmsign2 specification.
+package wasm
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+)
+
+const (
+	// SignatureSection is the custom section holding signatures. It must be
+	// the first section of the module.
+	SignatureSection = "signature"
+	// DelimiterSection is a custom section that ends a separately hashed
+	// region of the module, allowing signatures to be checked for a subset
+	// of the sections
+	DelimiterSection = "signature_delimiter"
+
+	headerSize   = 8
+	customID     = 0
+	delimiterLen = 16
+)
+
+var header = []byte{0, 'a', 's', 'm', 1, 0, 0, 0}
+
+// Section is one section of a module
+type Section struct {
+	ID byte
+	// Name of a custom section
+	Name string
+	// Payload is the section's contents after the name of a custom section
+	Payload []byte
+	// Raw is the complete encoded section
+	Raw []byte
+	// Offset of the section in the module
+	Offset int64
+}
+
+// Module is a parsed WebAssembly module
+type Module struct {
+	Sections []*Section
+}
+
+// Parse a module
+func Parse(blob []byte) (*Module, error) {
+	if len(blob) < headerSize || !bytes.Equal(blob[:headerSize], header) {
+		return nil, errors.New("not a WebAssembly module")
+	}
+	m := new(Module)
+	pos := headerSize
+	for pos < len(blob) {
+		start := pos
+		id := blob[pos]
+		pos++
+		size, n := binary.Uvarint(blob[pos:])
+		if n <= 0 || size > uint64(len(blob)-pos-n) {
+			return nil, fmt.Errorf("wasm: malformed section at offset %d", start)
+		}
+		pos += n
+		payload := blob[pos : pos+int(size)]
+		pos += int(size)
+		s := &Section{ID: id, Payload: payload, Raw: blob[start:pos], Offset: int64(start)}
+		if id == customID {
+			nameLen, n := binary.Uvarint(payload)
+			if n <= 0 || nameLen > uint64(len(payload)-n) {
+				return nil, fmt.Errorf("wasm: malformed custom section at offset %d", start)
+			}
+			s.Name = string(payload[n : n+int(nameLen)])
+			s.Payload = payload[n+int(nameLen):]
+		}
+		m.Sections = append(m.Sections, s)
+	}
+	return m, nil
+}
+
+// SignatureSection returns the module's signature section, or nil if it
+// isn't signed
+func (m *Module) SignatureSection() *Section {
+	if len(m.Sections) != 0 && m.Sections[0].ID == customID && m.Sections[0].Name == SignatureSection {
+		return m.Sections[0]
+	}
+	return nil
+}
+
+// region is a run of sections that are hashed together
+type region struct {
+	hash     []byte
+	sections []*Section
+}
+
+// regions splits the module after each delimiter section and hashes each
+// part. The module header is part of the first region and the signature
+// section is not part of any.
+func (m *Module) regions() []region {
+	var regions []region
+	var d hash.Hash
+	var cur []*Section
+	start := func() {
+		d = sha256.New()
+		if len(regions) == 0 {
+			d.Write(header)
+		}
+		cur = nil
+	}
+	start()
+	sigSection := m.SignatureSection()
+	for _, s := range m.Sections {
+		if s == sigSection {
+			continue
+		}
+		d.Write(s.Raw)
+		cur = append(cur, s)
+		if s.ID == customID && s.Name == DelimiterSection {
+			regions = append(regions, region{hash: d.Sum(nil), sections: cur})
+			start()
+		}
+	}
+	if len(cur) != 0 || len(regions) == 0 {
+		regions = append(regions, region{hash: d.Sum(nil), sections: cur})
+	}
+	return regions
+}
+
+// Hashes returns the hash of each region of the module
+func (m *Module) Hashes() [][]byte {
+	regions := m.regions()
+	hashes := make([][]byte, len(regions))
+	for i, r := range regions {
+		hashes[i] = r.hash
+	}
+	return hashes
+}
+
+// customSection encodes a custom section
+func customSection(name string, payload []byte) []byte {
+	var body []byte
+	body = appendUvarint(body, uint64(len(name)))
+	body = append(body, name...)
+	body = append(body, payload...)
+	out := []byte{customID}
+	out = appendUvarint(out, uint64(len(body)))
+	return append(out, body...)
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	return append(b, buf[:n]...)
+}
+
+func appendBytes(b, v []byte) []byte {
+	b = appendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
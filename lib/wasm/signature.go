@@ -0,0 +1,315 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package wasm
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/sassoftware/relic/v7/lib/binpatch"
+)
+
+const (
+	specVersion = 1
+	contentType = 1 // a WebAssembly module
+	hashSHA256  = 1
+	algEd25519  = 1
+
+	domain = "wasmsig"
+)
+
+// SignatureData is the contents of the signature section
+type SignatureData struct {
+	SignedHashes []SignedHashes
+}
+
+// SignedHashes is a set of region hashes and the signatures over them
+type SignedHashes struct {
+	Hashes     [][]byte
+	Signatures []Signature
+}
+
+// Signature is one signature over a set of hashes
+type Signature struct {
+	KeyID     []byte
+	Algorithm uint64
+	Signature []byte
+}
+
+// SignOptions control how a module is signed
+type SignOptions struct {
+	// KeyID optionally identifies the signing key
+	KeyID []byte
+	// Replace existing signatures instead of adding to them
+	Replace bool
+	// Split inserts delimiters around custom sections, so that they can be
+	// changed or stripped without invalidating the signature of the rest of
+	// the module. Modules that already have delimiters are not split again.
+	Split bool
+}
+
+type reader struct {
+	buf []byte
+	err error
+}
+
+func (r *reader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.buf)
+	if n <= 0 {
+		r.err = errors.New("wasm: malformed signature section")
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *reader) bytes(n uint64) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n > uint64(len(r.buf)) {
+		r.err = errors.New("wasm: malformed signature section")
+		return nil
+	}
+	v := r.buf[:n]
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *reader) prefixed() *reader {
+	return &reader{buf: r.bytes(r.uvarint()), err: r.err}
+}
+
+// ParseSignatureData parses the payload of a signature section
+func ParseSignatureData(payload []byte) (*SignatureData, error) {
+	r := &reader{buf: payload}
+	if v, c, h := r.uvarint(), r.uvarint(), r.uvarint(); r.err == nil && (v != specVersion || c != contentType || h != hashSHA256) {
+		return nil, fmt.Errorf("wasm: unsupported signature version %d, content type %d or hash %d", v, c, h)
+	}
+	d := new(SignatureData)
+	for i := r.uvarint(); i > 0 && r.err == nil; i-- {
+		sr := r.prefixed()
+		var sh SignedHashes
+		for j := sr.uvarint(); j > 0 && sr.err == nil; j-- {
+			sh.Hashes = append(sh.Hashes, append([]byte{}, sr.bytes(32)...))
+		}
+		for j := sr.uvarint(); j > 0 && sr.err == nil; j-- {
+			gr := sr.prefixed()
+			var sig Signature
+			sig.KeyID = append([]byte{}, gr.bytes(gr.uvarint())...)
+			sig.Algorithm = gr.uvarint()
+			sig.Signature = append([]byte{}, gr.bytes(gr.uvarint())...)
+			if gr.err != nil {
+				return nil, gr.err
+			}
+			sh.Signatures = append(sh.Signatures, sig)
+		}
+		if sr.err != nil {
+			return nil, sr.err
+		}
+		d.SignedHashes = append(d.SignedHashes, sh)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return d, nil
+}
+
+// Marshal encodes the payload of a signature section
+func (d *SignatureData) Marshal() []byte {
+	out := []byte{specVersion, contentType, hashSHA256}
+	out = appendUvarint(out, uint64(len(d.SignedHashes)))
+	for _, sh := range d.SignedHashes {
+		var shb []byte
+		shb = appendUvarint(shb, uint64(len(sh.Hashes)))
+		for _, h := range sh.Hashes {
+			shb = append(shb, h...)
+		}
+		shb = appendUvarint(shb, uint64(len(sh.Signatures)))
+		for _, sig := range sh.Signatures {
+			var sb []byte
+			sb = appendBytes(sb, sig.KeyID)
+			sb = appendUvarint(sb, sig.Algorithm)
+			sb = appendBytes(sb, sig.Signature)
+			shb = appendBytes(shb, sb)
+		}
+		out = appendBytes(out, shb)
+	}
+	return out
+}
+
+// Signatures returns the module's parsed signature section, or nil if it
+// isn't signed
+func (m *Module) Signatures() (*SignatureData, error) {
+	s := m.SignatureSection()
+	if s == nil {
+		return nil, nil
+	}
+	return ParseSignatureData(s.Payload)
+}
+
+func signedMessage(hashes [][]byte) []byte {
+	msg := append([]byte(domain), specVersion, contentType, hashSHA256)
+	for _, h := range hashes {
+		msg = append(msg, h...)
+	}
+	return msg
+}
+
+// Sign a module with an Ed25519 key, returning a patch that adds or updates
+// its signature section
+func Sign(blob []byte, signer crypto.Signer, opts SignOptions) (*binpatch.PatchSet, error) {
+	if _, ok := signer.Public().(ed25519.PublicKey); !ok {
+		return nil, errors.New("wasm signatures require an Ed25519 key")
+	}
+	m, err := Parse(blob)
+	if err != nil {
+		return nil, err
+	}
+	patch := binpatch.New()
+	var oldSigSize int64
+	if s := m.SignatureSection(); s != nil {
+		oldSigSize = int64(len(s.Raw))
+	}
+	// insert delimiters, then reparse to hash the new layout
+	var inserts map[int64][]byte
+	if opts.Split {
+		if inserts, err = m.delimiters(); err != nil {
+			return nil, err
+		}
+		if len(inserts) != 0 {
+			var split []byte
+			split = append(split, header...)
+			for _, s := range m.Sections {
+				split = append(split, s.Raw...)
+				if d := inserts[s.Offset+int64(len(s.Raw))]; d != nil {
+					split = append(split, d...)
+				}
+			}
+			if m, err = Parse(split); err != nil {
+				return nil, err
+			}
+		}
+	}
+	hashes := m.Hashes()
+	sig, err := signer.Sign(rand.Reader, signedMessage(hashes), crypto.Hash(0))
+	if err != nil {
+		return nil, err
+	}
+	newSig := Signature{KeyID: opts.KeyID, Algorithm: algEd25519, Signature: sig}
+	data := new(SignatureData)
+	if !opts.Replace {
+		if old, err := m.Signatures(); err != nil {
+			return nil, err
+		} else if old != nil {
+			data = old
+		}
+	}
+	// keep signatures over hashes that still match, and add the new one
+	current := make(map[string]bool, len(hashes))
+	for _, h := range hashes {
+		current[string(h)] = true
+	}
+	var kept []SignedHashes
+	added := false
+	for _, sh := range data.SignedHashes {
+		stale := false
+		for _, h := range sh.Hashes {
+			stale = stale || !current[string(h)]
+		}
+		if stale {
+			continue
+		}
+		if !added && sameHashes(sh.Hashes, hashes) {
+			added = true
+			if !hasSignature(sh.Signatures, newSig) {
+				sh.Signatures = append(sh.Signatures, newSig)
+			}
+		}
+		kept = append(kept, sh)
+	}
+	if !added {
+		kept = append(kept, SignedHashes{Hashes: hashes, Signatures: []Signature{newSig}})
+	}
+	data.SignedHashes = kept
+	patch.Add(headerSize, oldSigSize, customSection(SignatureSection, data.Marshal()))
+	offsets := make([]int64, 0, len(inserts))
+	for offset := range inserts {
+		offsets = append(offsets, offset)
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	for _, offset := range offsets {
+		patch.Add(offset, 0, inserts[offset])
+	}
+	return patch, nil
+}
+
+// delimiters returns new delimiter sections to insert around each custom
+// section, keyed by the offset to insert them at
+func (m *Module) delimiters() (map[int64][]byte, error) {
+	var sections []*Section
+	for _, s := range m.Sections {
+		if s.ID == customID && s.Name == DelimiterSection {
+			// already split
+			return nil, nil
+		} else if s != m.SignatureSection() {
+			sections = append(sections, s)
+		}
+	}
+	inserts := make(map[int64][]byte)
+	for i := 0; i < len(sections)-1; i++ {
+		if sections[i].ID != customID && sections[i+1].ID != customID {
+			continue
+		}
+		nonce := make([]byte, delimiterLen)
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, err
+		}
+		inserts[sections[i].Offset+int64(len(sections[i].Raw))] = customSection(DelimiterSection, nonce)
+	}
+	return inserts, nil
+}
+
+func sameHashes(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasSignature(sigs []Signature, sig Signature) bool {
+	for _, s := range sigs {
+		if s.Algorithm == sig.Algorithm && bytes.Equal(s.Signature, sig.Signature) {
+			return true
+		}
+	}
+	return false
+}
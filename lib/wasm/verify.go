@@ -0,0 +1,88 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package wasm
+
+import (
+	"crypto/ed25519"
+	"errors"
+)
+
+// ErrNotSigned is returned when verifying a module with no signature section
+var ErrNotSigned = errors.New("module is not signed")
+
+// Verify the module's signatures against a list of trusted keys, returning
+// the indexes of the keys that signed it. If include is not nil then only the
+// regions holding a section it selects need to be covered by a signature,
+// otherwise the whole module must be.
+func (m *Module) Verify(keys []ed25519.PublicKey, include func(*Section) bool) ([]int, error) {
+	data, err := m.Signatures()
+	if err != nil {
+		return nil, err
+	} else if data == nil {
+		return nil, ErrNotSigned
+	}
+	regions := m.regions()
+	var required [][]byte
+	for _, r := range regions {
+		needed := include == nil
+		for _, s := range r.sections {
+			needed = needed || include(s)
+		}
+		if needed {
+			required = append(required, r.hash)
+		}
+	}
+	var signers []int
+	seen := make(map[int]bool)
+	for _, sh := range data.SignedHashes {
+		if include == nil && !sameHashes(sh.Hashes, required) {
+			continue
+		}
+		if !coversAll(sh.Hashes, required) {
+			continue
+		}
+		msg := signedMessage(sh.Hashes)
+		for _, sig := range sh.Signatures {
+			if sig.Algorithm != algEd25519 {
+				continue
+			}
+			for i, key := range keys {
+				if !seen[i] && ed25519.Verify(key, msg, sig.Signature) {
+					seen[i] = true
+					signers = append(signers, i)
+				}
+			}
+		}
+	}
+	if len(signers) == 0 {
+		return nil, errors.New("no valid signature from a trusted key")
+	}
+	return signers, nil
+}
+
+func coversAll(have, want [][]byte) bool {
+	set := make(map[string]bool, len(have))
+	for _, h := range have {
+		set[string(h)] = true
+	}
+	for _, h := range want {
+		if !set[string(h)] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,145 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package wasm
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sassoftware/relic/v7/lib/binpatch"
+)
+
+func testModule() []byte {
+	m := append([]byte{}, header...)
+	m = append(m, 1, 4, 1, 0x60, 0, 0) // type section
+	m = append(m, 3, 2, 1, 0)          // function section
+	m = append(m, customSection("name", []byte("debug names"))...)
+	m = append(m, 10, 4, 1, 2, 0, 0x0b) // code section
+	return m
+}
+
+func applyPatch(blob []byte, p *binpatch.PatchSet) []byte {
+	var out []byte
+	var pos int64
+	for i, h := range p.Patches {
+		out = append(out, blob[pos:h.Offset]...)
+		out = append(out, p.Blobs[i]...)
+		pos = h.Offset + int64(h.OldSize)
+	}
+	return append(out, blob[pos:]...)
+}
+
+func signTest(t *testing.T, blob []byte, key ed25519.PrivateKey, opts SignOptions) []byte {
+	patch, err := Sign(blob, key, opts)
+	require.NoError(t, err)
+	return applyPatch(blob, patch)
+}
+
+func verifyTest(t *testing.T, blob []byte, keys []ed25519.PublicKey, include func(*Section) bool) ([]int, error) {
+	m, err := Parse(blob)
+	require.NoError(t, err)
+	return m.Verify(keys, include)
+}
+
+func TestSignVerify(t *testing.T) {
+	pub1, key1, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	pub2, key2, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	keys := []ed25519.PublicKey{pub1, pub2}
+	orig := testModule()
+
+	_, err = verifyTest(t, orig, keys, nil)
+	assert.ErrorIs(t, err, ErrNotSigned)
+
+	signed := signTest(t, orig, key1, SignOptions{KeyID: []byte("one")})
+	m, err := Parse(signed)
+	require.NoError(t, err)
+	require.NotNil(t, m.SignatureSection())
+	assert.Len(t, m.Sections, 5)
+	signers, err := m.Verify(keys, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []int{0}, signers)
+
+	// add a second signature, and re-signing with the same key is a no-op
+	signed = signTest(t, signed, key2, SignOptions{})
+	signed = signTest(t, signed, key2, SignOptions{})
+	m, err = Parse(signed)
+	require.NoError(t, err)
+	data, err := m.Signatures()
+	require.NoError(t, err)
+	require.Len(t, data.SignedHashes, 1)
+	require.Len(t, data.SignedHashes[0].Signatures, 2)
+	assert.Equal(t, []byte("one"), data.SignedHashes[0].Signatures[0].KeyID)
+	signers, err = m.Verify(keys, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []int{0, 1}, signers)
+
+	replaced := signTest(t, signed, key2, SignOptions{Replace: true})
+	signers, err = verifyTest(t, replaced, keys, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []int{1}, signers)
+
+	// changing the module invalidates the signatures
+	signed[len(signed)-2] ^= 1
+	_, err = verifyTest(t, signed, keys, nil)
+	assert.Error(t, err)
+
+	_, ecKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	_, err = Sign([]byte("not wasm"), ecKey, SignOptions{})
+	assert.Error(t, err)
+}
+
+func TestPartial(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	keys := []ed25519.PublicKey{pub}
+	signed := signTest(t, testModule(), key, SignOptions{Split: true})
+	m, err := Parse(signed)
+	require.NoError(t, err)
+	var names []string
+	for _, s := range m.Sections {
+		names = append(names, s.Name)
+	}
+	assert.Equal(t, []string{SignatureSection, "", "", DelimiterSection, "name", DelimiterSection, ""}, names)
+	assert.Len(t, m.Hashes(), 3)
+	_, err = m.Verify(keys, nil)
+	require.NoError(t, err)
+
+	// signing again doesn't split again
+	resigned := signTest(t, signed, key, SignOptions{Split: true})
+	m, err = Parse(resigned)
+	require.NoError(t, err)
+	assert.Len(t, m.Sections, 7)
+
+	// strip the custom section and its delimiter
+	name := m.Sections[4]
+	delim := m.Sections[5]
+	stripped := append([]byte{}, resigned[:name.Offset]...)
+	stripped = append(stripped, resigned[delim.Offset+int64(len(delim.Raw)):]...)
+	_, err = verifyTest(t, stripped, keys, nil)
+	assert.Error(t, err)
+	codeOnly := func(s *Section) bool { return s.ID != customID }
+	signers, err := verifyTest(t, stripped, keys, codeOnly)
+	require.NoError(t, err)
+	assert.Equal(t, []int{0}, signers)
+}
@@ -0,0 +1,274 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package x509tools
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sassoftware/relic/v7/lib/atomicfile"
+)
+
+var (
+	oidExtKeyUsageServerAuth      = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 1}
+	oidExtKeyUsageClientAuth      = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 2}
+	oidExtKeyUsageCodeSigning     = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 3}
+	oidExtKeyUsageEmailProtection = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 4}
+	oidExtKeyUsageTimeStamping    = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 8}
+	oidExtKeyUsageOCSPSigning     = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 9}
+	// Microsoft: signatures expire along with the certificate even if timestamped
+	oidExtKeyUsageLifetimeSigning = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 10, 3, 13}
+)
+
+var extKeyUsagesByName = map[string]asn1.ObjectIdentifier{
+	"serverauth":      oidExtKeyUsageServerAuth,
+	"clientauth":      oidExtKeyUsageClientAuth,
+	"codesigning":     oidExtKeyUsageCodeSigning,
+	"emailprotection": oidExtKeyUsageEmailProtection,
+	"timestamping":    oidExtKeyUsageTimeStamping,
+	"ocspsigning":     oidExtKeyUsageOCSPSigning,
+	"lifetimesigning": oidExtKeyUsageLifetimeSigning,
+}
+
+// ParseExtKeyUsage returns the OID for an extended key usage given by name,
+// such as codeSigning, or in dotted notation
+func ParseExtKeyUsage(name string) (asn1.ObjectIdentifier, error) {
+	if oid := extKeyUsagesByName[strings.ToLower(name)]; oid != nil {
+		return oid, nil
+	}
+	oid, ok := parseOID(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown extended key usage %q", name)
+	}
+	return oid, nil
+}
+
+// CertificateEKUs returns the OIDs in a certificate's extended key usage
+// extension, or nil if it has none
+func CertificateEKUs(cert *x509.Certificate) ([]asn1.ObjectIdentifier, error) {
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oidExtensionExtendedKeyUsage) {
+			var ekus []asn1.ObjectIdentifier
+			if _, err := asn1.Unmarshal(ext.Value, &ekus); err != nil {
+				return nil, fmt.Errorf("parsing extended key usage: %w", err)
+			}
+			return ekus, nil
+		}
+	}
+	return nil, nil
+}
+
+// Set both basic and extended key usage from a list of usage names. If
+// timeStamping is among them then the EKU extension is marked critical as
+// required by RFC 3161.
+func setUsage(template *x509.Certificate) error {
+	names := splitAndTrim(ArgKeyUsage)
+	if len(names) == 0 {
+		return nil
+	}
+	usage := x509.KeyUsageDigitalSignature
+	var ekus []asn1.ObjectIdentifier
+	critical := false
+	for _, name := range names {
+		switch strings.ToLower(name) {
+		case "serverauth":
+			usage |= x509.KeyUsageKeyEncipherment | x509.KeyUsageKeyAgreement
+			ekus = append(ekus, oidExtKeyUsageServerAuth)
+		case "clientauth":
+			usage |= x509.KeyUsageKeyEncipherment | x509.KeyUsageKeyAgreement
+			ekus = append(ekus, oidExtKeyUsageClientAuth)
+		case "codesigning":
+			ekus = append(ekus, oidExtKeyUsageCodeSigning)
+		case "lifetimesigning":
+			ekus = append(ekus, oidExtKeyUsageLifetimeSigning)
+		case "timestamping":
+			usage |= x509.KeyUsageContentCommitment
+			ekus = append(ekus, oidExtKeyUsageTimeStamping)
+			critical = true
+		case "ocspsigning":
+			ekus = append(ekus, oidExtKeyUsageOCSPSigning)
+		case "emailprotection":
+			usage |= x509.KeyUsageContentCommitment | x509.KeyUsageKeyEncipherment | x509.KeyUsageKeyAgreement
+			ekus = append(ekus, oidExtKeyUsageEmailProtection)
+		case "keycertsign":
+			usage |= x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+		default:
+			return fmt.Errorf("invalid key-usage %q", name)
+		}
+	}
+	template.KeyUsage = usage
+	template.ExtKeyUsage = nil
+	template.UnknownExtKeyUsage = nil
+	if len(ekus) != 0 {
+		value, err := asn1.Marshal(ekus)
+		if err != nil {
+			return err
+		}
+		// replace any EKU that came from a CSR or existing cert
+		exts := template.ExtraExtensions[:0]
+		for _, ext := range template.ExtraExtensions {
+			if !ext.Id.Equal(oidExtensionExtendedKeyUsage) {
+				exts = append(exts, ext)
+			}
+		}
+		template.ExtraExtensions = append(exts, pkix.Extension{
+			Id:       oidExtensionExtendedKeyUsage,
+			Critical: critical,
+			Value:    value,
+		})
+	}
+	return nil
+}
+
+// Set the validity period from --not-before, --not-after and --expire-days
+func setValidity(template *x509.Certificate) error {
+	template.NotBefore = time.Now().Add(time.Hour * -24)
+	if ArgNotBefore != "" {
+		t, err := time.Parse(time.RFC3339, ArgNotBefore)
+		if err != nil {
+			return fmt.Errorf("invalid --not-before: %w", err)
+		}
+		template.NotBefore = t
+	}
+	template.NotAfter = time.Now().Add(time.Hour * 24 * time.Duration(ArgExpireDays))
+	if ArgNotAfter != "" {
+		t, err := time.Parse(time.RFC3339, ArgNotAfter)
+		if err != nil {
+			return fmt.Errorf("invalid --not-after: %w", err)
+		}
+		template.NotAfter = t
+	}
+	if !template.NotAfter.After(template.NotBefore) {
+		return errors.New("certificate would expire before it becomes valid")
+	}
+	return nil
+}
+
+// Set the basic constraints path length from --path-length
+func setPathLen(template *x509.Certificate) error {
+	if ArgPathLength < 0 {
+		return nil
+	} else if !template.IsCA {
+		return errors.New("--path-length requires --cert-authority")
+	}
+	template.MaxPathLen = ArgPathLength
+	template.MaxPathLenZero = ArgPathLength == 0
+	return nil
+}
+
+// Set name constraints from --permit and --exclude, which take values of the
+// form dns:example.com, email:example.com, uri:.example.com or ip:10.0.0.0/8
+func setNameConstraints(template *x509.Certificate) error {
+	if len(ArgPermitNames) == 0 && len(ArgExcludeNames) == 0 {
+		return nil
+	} else if !template.IsCA {
+		return errors.New("name constraints require --cert-authority")
+	}
+	for _, arg := range ArgPermitNames {
+		if err := addNameConstraint(arg, &template.PermittedDNSDomains, &template.PermittedEmailAddresses, &template.PermittedURIDomains, &template.PermittedIPRanges); err != nil {
+			return err
+		}
+	}
+	for _, arg := range ArgExcludeNames {
+		if err := addNameConstraint(arg, &template.ExcludedDNSDomains, &template.ExcludedEmailAddresses, &template.ExcludedURIDomains, &template.ExcludedIPRanges); err != nil {
+			return err
+		}
+	}
+	template.PermittedDNSDomainsCritical = true
+	return nil
+}
+
+func addNameConstraint(arg string, dns, email, uri *[]string, ips *[]*net.IPNet) error {
+	kind, value, ok := strings.Cut(arg, ":")
+	if !ok || value == "" {
+		return fmt.Errorf("invalid name constraint %q: expected TYPE:VALUE", arg)
+	}
+	switch strings.ToLower(kind) {
+	case "dns":
+		*dns = append(*dns, value)
+	case "email":
+		*email = append(*email, value)
+	case "uri":
+		*uri = append(*uri, value)
+	case "ip":
+		_, ipnet, err := net.ParseCIDR(value)
+		if err != nil {
+			return fmt.Errorf("invalid name constraint %q: %w", arg, err)
+		}
+		*ips = append(*ips, ipnet)
+	default:
+		return fmt.Errorf("invalid name constraint %q: type must be one of: dns email uri ip", arg)
+	}
+	return nil
+}
+
+// Choose a serial number according to --serial or --serial-strategy
+func makeSerialNumber() (*big.Int, error) {
+	if ArgSerial != "" {
+		serial, ok := new(big.Int).SetString(ArgSerial, 0)
+		if !ok {
+			return nil, errors.New("invalid serial number, must be decimal or hexadecimal format")
+		}
+		return serial, nil
+	}
+	switch strings.ToLower(ArgSerialStrategy) {
+	case "", "random":
+		serial := MakeSerial()
+		if serial == nil {
+			return nil, errors.New("Failed to generate a serial number")
+		}
+		return serial, nil
+	case "timestamp":
+		return big.NewInt(time.Now().UnixNano()), nil
+	case "sequential":
+		return nextSerial(ArgSerialFile)
+	default:
+		return nil, fmt.Errorf("invalid serial strategy %q, expected one of: random timestamp sequential", ArgSerialStrategy)
+	}
+}
+
+// Increment and return the serial number stored in path, starting from 1 if
+// the file does not exist yet
+func nextSerial(path string) (*big.Int, error) {
+	if path == "" {
+		return nil, errors.New("the sequential serial strategy requires --serial-file")
+	}
+	serial := big.NewInt(0)
+	blob, err := os.ReadFile(path)
+	if err == nil {
+		var ok bool
+		serial, ok = serial.SetString(strings.TrimSpace(string(blob)), 0)
+		if !ok {
+			return nil, fmt.Errorf("serial file %s does not contain a valid number", path)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	serial.Add(serial, big.NewInt(1))
+	if err := atomicfile.WriteFile(path, []byte(fmt.Sprintf("%#x\n", serial))); err != nil {
+		return nil, err
+	}
+	return serial, nil
+}
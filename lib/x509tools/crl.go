@@ -0,0 +1,422 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package x509tools
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"github.com/sassoftware/relic/v7/lib/atomicfile"
+)
+
+var (
+	oidExtensionCRLNumber         = asn1.ObjectIdentifier{2, 5, 29, 20}
+	oidExtensionReasonCode        = asn1.ObjectIdentifier{2, 5, 29, 21}
+	oidExtensionDeltaCRLIndicator = asn1.ObjectIdentifier{2, 5, 29, 27}
+	oidExtensionFreshestCRL       = asn1.ObjectIdentifier{2, 5, 29, 46}
+)
+
+const (
+	maxCRLSize = 64 << 20
+	// CRL reason code used in delta CRLs to unrevoke a certificate on hold
+	reasonRemoveFromCRL = 8
+)
+
+// RevocationChecker checks whether any certificate in a validated chain was
+// revoked as of the given time. The chain is ordered from leaf to root.
+type RevocationChecker interface {
+	CheckRevocation(chain []*x509.Certificate, at time.Time) error
+}
+
+// CRL is a parsed and validated certificate revocation list
+type CRL struct {
+	List *pkix.CertificateList
+	Raw  []byte
+	// CRL number, if present
+	Number *big.Int
+	// For delta CRLs, the number of the base CRL that this delta applies to
+	BaseNumber *big.Int
+	// URLs where delta CRLs for this CRL can be found
+	FreshestURLs []string
+}
+
+// IsDelta returns true if this is a delta CRL
+func (c *CRL) IsDelta() bool {
+	return c.BaseNumber != nil
+}
+
+// Find returns the revocation entry for a certificate, if it is listed
+func (c *CRL) Find(cert *x509.Certificate) *pkix.RevokedCertificate {
+	for i, entry := range c.List.TBSCertList.RevokedCertificates {
+		if entry.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+			return &c.List.TBSCertList.RevokedCertificates[i]
+		}
+	}
+	return nil
+}
+
+// ParseCRL parses a CRL in DER or PEM format and validates its signature
+// against the given issuer
+func ParseCRL(blob []byte, issuer *x509.Certificate) (*CRL, error) {
+	if len(blob) > 0 && blob[0] != 0x30 {
+		der, err := parseMaybePEM(blob, "X509 CRL")
+		if err != nil {
+			return nil, err
+		}
+		blob = der
+	}
+	list := new(pkix.CertificateList)
+	if rest, err := asn1.Unmarshal(blob, list); err != nil {
+		return nil, fmt.Errorf("parsing CRL: %w", err)
+	} else if len(rest) != 0 {
+		return nil, errors.New("trailing garbage after CRL")
+	}
+	if issuer != nil {
+		if err := issuer.CheckCRLSignature(list); err != nil {
+			return nil, fmt.Errorf("validating CRL signature: %w", err)
+		}
+	}
+	crl := &CRL{List: list, Raw: blob}
+	for _, ext := range list.TBSCertList.Extensions {
+		var err error
+		switch {
+		case ext.Id.Equal(oidExtensionCRLNumber):
+			_, err = asn1.Unmarshal(ext.Value, &crl.Number)
+		case ext.Id.Equal(oidExtensionDeltaCRLIndicator):
+			_, err = asn1.Unmarshal(ext.Value, &crl.BaseNumber)
+		case ext.Id.Equal(oidExtensionFreshestCRL):
+			crl.FreshestURLs, err = parseDistributionPoints(ext.Value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parsing CRL extension %s: %w", ext.Id, err)
+		}
+	}
+	return crl, nil
+}
+
+// CRLCache downloads CRLs and keeps them in memory and optionally on disk
+// until they expire
+type CRLCache struct {
+	// Directory to store downloaded CRLs. If empty then CRLs are only cached in memory.
+	Dir string
+	// HTTP client to use for downloads. If nil then the default client is used.
+	Client *http.Client
+	// How long to keep a CRL that has no nextUpdate time. If zero then
+	// DefaultCRLMaxAge is used.
+	MaxAge time.Duration
+
+	mu    sync.Mutex
+	mem   map[string]cachedCRL
+	fetch singleflight.Group
+}
+
+// DefaultCRLMaxAge is how long a CRL with no nextUpdate time is cached
+const DefaultCRLMaxAge = 24 * time.Hour
+
+type cachedCRL struct {
+	crl     *CRL
+	fetched time.Time
+}
+
+// Fetch returns the CRL at url, downloading it if no unexpired copy is cached.
+// Cached copies are kept separately for each issuer, so a CRL validated
+// against one issuer is never returned for another.
+func (c *CRLCache) Fetch(ctx context.Context, url string, issuer *x509.Certificate) (*CRL, error) {
+	key := crlCacheKey(url, issuer)
+	c.mu.Lock()
+	cached, ok := c.mem[key]
+	c.mu.Unlock()
+	if ok && !c.stale(cached, time.Now()) {
+		return cached.crl, nil
+	}
+	// don't hold the lock during I/O, but only fetch each URL once at a time
+	v, err, _ := c.fetch.Do(key, func() (interface{}, error) {
+		return c.load(ctx, key, url, issuer)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*CRL), nil
+}
+
+// crlCacheKey identifies a CRL by where it came from and who signed it
+func crlCacheKey(url string, issuer *x509.Certificate) string {
+	if issuer == nil {
+		return url
+	}
+	digest := sha256.Sum256(issuer.Raw)
+	return hex.EncodeToString(digest[:]) + " " + url
+}
+
+// load a CRL from the disk cache or by downloading it, and save it in memory
+func (c *CRLCache) load(ctx context.Context, key, url string, issuer *x509.Certificate) (*CRL, error) {
+	now := time.Now()
+	var cachePath string
+	var cached cachedCRL
+	if c.Dir != "" {
+		digest := sha256.Sum256([]byte(key))
+		cachePath = filepath.Join(c.Dir, hex.EncodeToString(digest[:])+".crl")
+		if st, err := os.Stat(cachePath); err == nil {
+			if blob, err := os.ReadFile(cachePath); err == nil {
+				if crl, err := ParseCRL(blob, issuer); err == nil {
+					cached = cachedCRL{crl: crl, fetched: st.ModTime()}
+				}
+			}
+		}
+	}
+	if cached.crl == nil || c.stale(cached, now) {
+		blob, err := c.download(ctx, url)
+		if err != nil {
+			return nil, err
+		}
+		crl, err := ParseCRL(blob, issuer)
+		if err != nil {
+			return nil, fmt.Errorf("CRL from %s: %w", url, err)
+		}
+		if crlExpired(crl, now) {
+			return nil, fmt.Errorf("CRL from %s expired at %s", url, crl.List.TBSCertList.NextUpdate)
+		}
+		cached = cachedCRL{crl: crl, fetched: now}
+		if cachePath != "" {
+			if err := os.MkdirAll(c.Dir, 0755); err != nil {
+				return nil, err
+			}
+			if err := atomicfile.WriteFile(cachePath, crl.Raw); err != nil {
+				return nil, err
+			}
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.mem == nil {
+		c.mem = make(map[string]cachedCRL)
+	}
+	c.mem[key] = cached
+	return cached.crl, nil
+}
+
+// stale returns true if a cached CRL has expired, or if it has no expiry and
+// was fetched more than MaxAge ago
+func (c *CRLCache) stale(cached cachedCRL, now time.Time) bool {
+	if cached.crl.List.TBSCertList.NextUpdate.IsZero() {
+		maxAge := c.MaxAge
+		if maxAge == 0 {
+			maxAge = DefaultCRLMaxAge
+		}
+		return now.Sub(cached.fetched) > maxAge
+	}
+	return crlExpired(cached.crl, now)
+}
+
+func (c *CRLCache) download(ctx context.Context, url string) ([]byte, error) {
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return nil, fmt.Errorf("unsupported CRL distribution point %q", url)
+	}
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching CRL: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching CRL from %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxCRLSize))
+}
+
+func crlExpired(crl *CRL, now time.Time) bool {
+	next := crl.List.TBSCertList.NextUpdate
+	return !next.IsZero() && now.After(next)
+}
+
+// CRLChecker implements RevocationChecker by fetching the CRLs named in each
+// certificate's distribution points, including delta CRLs
+type CRLChecker struct {
+	Cache   *CRLCache
+	Policy  RevocationPolicy
+	Timeout time.Duration
+}
+
+// CheckRevocation checks each certificate in the chain against its issuer's
+// CRL. A certificate revoked after the given time is not considered revoked.
+func (c *CRLChecker) CheckRevocation(chain []*x509.Certificate, at time.Time) error {
+	if c.Policy == RevocationNone {
+		return nil
+	}
+	if at.IsZero() {
+		at = time.Now()
+	}
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = time.Minute
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	for i := 0; i+1 < len(chain); i++ {
+		if err := c.checkOne(ctx, chain[i], chain[i+1], at); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *CRLChecker) checkOne(ctx context.Context, cert, issuer *x509.Certificate, at time.Time) error {
+	if len(cert.CRLDistributionPoints) == 0 {
+		if c.Policy == RevocationHardFail {
+			return fmt.Errorf("certificate `%s` has no CRL distribution point", FormatSubject(cert))
+		}
+		return nil
+	}
+	var base *CRL
+	var err error
+	for _, url := range cert.CRLDistributionPoints {
+		base, err = c.Cache.Fetch(ctx, url, issuer)
+		if err == nil {
+			break
+		}
+	}
+	if base == nil {
+		if c.Policy == RevocationHardFail {
+			return fmt.Errorf("checking revocation of `%s`: %w", FormatSubject(cert), err)
+		}
+		return nil
+	}
+	entry := base.Find(cert)
+	// apply a delta CRL on top of the base, if one is published
+	deltaURLs := base.FreshestURLs
+	if urls, _ := freshestCRLURLs(cert); len(urls) != 0 {
+		deltaURLs = urls
+	}
+	if len(deltaURLs) != 0 {
+		delta, err := c.fetchDelta(ctx, deltaURLs, issuer, base)
+		if err != nil && c.Policy == RevocationHardFail {
+			return fmt.Errorf("checking revocation of `%s`: %w", FormatSubject(cert), err)
+		} else if delta != nil {
+			if dentry := delta.Find(cert); dentry != nil {
+				if crlReason(dentry) == reasonRemoveFromCRL {
+					entry = nil
+				} else {
+					entry = dentry
+				}
+			}
+		}
+	}
+	if entry != nil && !entry.RevocationTime.After(at) {
+		return RevokedError{
+			Cert:      cert,
+			RevokedAt: entry.RevocationTime,
+			Reason:    crlReason(entry),
+		}
+	}
+	return nil
+}
+
+func (c *CRLChecker) fetchDelta(ctx context.Context, urls []string, issuer *x509.Certificate, base *CRL) (*CRL, error) {
+	var lastErr error
+	for _, url := range urls {
+		delta, err := c.Cache.Fetch(ctx, url, issuer)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if !delta.IsDelta() {
+			lastErr = fmt.Errorf("CRL from %s is not a delta CRL", url)
+			continue
+		}
+		if base.Number != nil && delta.BaseNumber.Cmp(base.Number) > 0 {
+			lastErr = fmt.Errorf("delta CRL from %s requires a newer base CRL", url)
+			continue
+		}
+		return delta, nil
+	}
+	return nil, lastErr
+}
+
+func crlReason(entry *pkix.RevokedCertificate) int {
+	for _, ext := range entry.Extensions {
+		if ext.Id.Equal(oidExtensionReasonCode) {
+			var reason asn1.Enumerated
+			if _, err := asn1.Unmarshal(ext.Value, &reason); err == nil {
+				return int(reason)
+			}
+		}
+	}
+	return 0
+}
+
+// Get the delta CRL locations from a certificate's FreshestCRL extension
+func freshestCRLURLs(cert *x509.Certificate) ([]string, error) {
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oidExtensionFreshestCRL) {
+			return parseDistributionPoints(ext.Value)
+		}
+	}
+	return nil, nil
+}
+
+// See RFC 5280 section 4.2.1.13
+type distributionPoint struct {
+	DistributionPoint distributionPointName `asn1:"optional,tag:0"`
+	Reason            asn1.BitString        `asn1:"optional,tag:1"`
+	CRLIssuer         asn1.RawValue         `asn1:"optional,tag:2"`
+}
+
+type distributionPointName struct {
+	FullName     []asn1.RawValue  `asn1:"optional,tag:0"`
+	RelativeName pkix.RDNSequence `asn1:"optional,tag:1"`
+}
+
+// Extract URIs from a CRLDistributionPoints or FreshestCRL extension
+func parseDistributionPoints(der []byte) ([]string, error) {
+	var points []distributionPoint
+	if _, err := asn1.Unmarshal(der, &points); err != nil {
+		return nil, err
+	}
+	var urls []string
+	for _, point := range points {
+		for _, name := range point.DistributionPoint.FullName {
+			// uniformResourceIdentifier [6] IA5String
+			if name.Class == asn1.ClassContextSpecific && name.Tag == 6 {
+				urls = append(urls, string(name.Bytes))
+			}
+		}
+	}
+	return urls, nil
+}
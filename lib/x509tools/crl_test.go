@@ -0,0 +1,379 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package x509tools_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sassoftware/relic/v7/internal/testcert"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+)
+
+// crlServer serves CRLs by path and counts how often each one is downloaded
+type crlServer struct {
+	*httptest.Server
+	mu    sync.Mutex
+	blobs map[string][]byte
+	hits  map[string]int
+}
+
+func newCRLServer(t *testing.T) *crlServer {
+	s := &crlServer{blobs: make(map[string][]byte), hits: make(map[string]int)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		blob, ok := s.blobs[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		s.hits[r.URL.Path]++
+		w.Write(blob)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *crlServer) put(path string, blob []byte) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blobs[path] = blob
+	return s.URL + path
+}
+
+func (s *crlServer) count(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hits[path]
+}
+
+type testCA struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+}
+
+func newTestCA(t *testing.T) testCA {
+	key := testcert.ECDSAKey(t)
+	return testCA{cert: testcert.CA(t, "Test CA", key), key: key}
+}
+
+func (ca testCA) issue(t *testing.T, serial int64, crlURL string) *x509.Certificate {
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "leaf"},
+	}
+	if crlURL != "" {
+		tmpl.CRLDistributionPoints = []string{crlURL}
+	}
+	return testcert.Issue(t, tmpl, testcert.ECDSAKey(t), ca.cert, ca.key)
+}
+
+type crlOpts struct {
+	number     int64
+	baseNumber int64 // if set, this is a delta CRL
+	nextUpdate time.Time
+	freshest   string
+	revoked    []pkix.RevokedCertificate
+}
+
+func (ca testCA) crl(t *testing.T, opts crlOpts) []byte {
+	var exts []pkix.Extension
+	if opts.baseNumber != 0 {
+		value, err := asn1.Marshal(big.NewInt(opts.baseNumber))
+		require.NoError(t, err)
+		exts = append(exts, pkix.Extension{Id: asn1.ObjectIdentifier{2, 5, 29, 27}, Critical: true, Value: value})
+	}
+	if opts.freshest != "" {
+		exts = append(exts, pkix.Extension{Id: asn1.ObjectIdentifier{2, 5, 29, 46}, Value: distributionPoints(t, opts.freshest)})
+	}
+	nextUpdate := opts.nextUpdate
+	if nextUpdate.IsZero() {
+		nextUpdate = time.Now().Add(time.Hour)
+	}
+	blob, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:              big.NewInt(opts.number),
+		ThisUpdate:          time.Now().Add(-time.Hour),
+		NextUpdate:          nextUpdate,
+		RevokedCertificates: opts.revoked,
+		ExtraExtensions:     exts,
+	}, ca.cert, ca.key)
+	require.NoError(t, err)
+	return blob
+}
+
+// CreateRevocationList requires a nextUpdate, so strip it and re-sign
+func (ca testCA) crlWithoutNextUpdate(t *testing.T, number int64) []byte {
+	list := new(pkix.CertificateList)
+	_, err := asn1.Unmarshal(ca.crl(t, crlOpts{number: number}), list)
+	require.NoError(t, err)
+	list.TBSCertList.Raw = nil
+	list.TBSCertList.NextUpdate = time.Time{}
+	tbs, err := asn1.Marshal(list.TBSCertList)
+	require.NoError(t, err)
+	digest := sha256.Sum256(tbs)
+	sig, err := ca.key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	require.NoError(t, err)
+	blob, err := asn1.Marshal(struct {
+		TBS                asn1.RawValue
+		SignatureAlgorithm pkix.AlgorithmIdentifier
+		SignatureValue     asn1.BitString
+	}{asn1.RawValue{FullBytes: tbs}, list.SignatureAlgorithm, asn1.BitString{Bytes: sig, BitLength: 8 * len(sig)}})
+	require.NoError(t, err)
+	return blob
+}
+
+func distributionPoints(t *testing.T, url string) []byte {
+	type name struct {
+		FullName []asn1.RawValue `asn1:"optional,tag:0"`
+	}
+	type point struct {
+		DistributionPoint name `asn1:"optional,tag:0"`
+	}
+	value, err := asn1.Marshal([]point{{name{[]asn1.RawValue{{Class: asn1.ClassContextSpecific, Tag: 6, Bytes: []byte(url)}}}}})
+	require.NoError(t, err)
+	return value
+}
+
+func revoked(t *testing.T, serial int64, at time.Time, reason int) pkix.RevokedCertificate {
+	entry := pkix.RevokedCertificate{SerialNumber: big.NewInt(serial), RevocationTime: at}
+	if reason != 0 {
+		value, err := asn1.Marshal(asn1.Enumerated(reason))
+		require.NoError(t, err)
+		entry.Extensions = []pkix.Extension{{Id: asn1.ObjectIdentifier{2, 5, 29, 21}, Value: value}}
+	}
+	return entry
+}
+
+func TestCRLCache(t *testing.T) {
+	ca := newTestCA(t)
+	srv := newCRLServer(t)
+	ctx := context.Background()
+	cases := []struct {
+		name      string
+		blob      []byte
+		maxAge    time.Duration
+		downloads int
+		err       string
+	}{
+		{name: "unexpired", blob: ca.crl(t, crlOpts{number: 1}), downloads: 1},
+		{name: "expired", blob: ca.crl(t, crlOpts{number: 1, nextUpdate: time.Now().Add(-time.Minute)}), err: "expired"},
+		{name: "no nextUpdate", blob: ca.crlWithoutNextUpdate(t, 1), downloads: 1},
+		{name: "no nextUpdate past max age", blob: ca.crlWithoutNextUpdate(t, 1), maxAge: time.Nanosecond, downloads: 2},
+		{name: "garbage", blob: []byte("not a CRL"), err: "expected a x509 crl"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			path := "/" + t.Name() + ".crl"
+			url := srv.put(path, c.blob)
+			cache := &x509tools.CRLCache{MaxAge: c.maxAge}
+			for i := 0; i < 2; i++ {
+				crl, err := cache.Fetch(ctx, url, ca.cert)
+				if c.err != "" {
+					require.ErrorContains(t, err, c.err)
+					return
+				}
+				require.NoError(t, err)
+				assert.Equal(t, int64(1), crl.Number.Int64())
+			}
+			assert.Equal(t, c.downloads, srv.count(path))
+		})
+	}
+}
+
+func TestCRLCacheDir(t *testing.T) {
+	ca := newTestCA(t)
+	srv := newCRLServer(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	url := srv.put("/ca.crl", ca.crl(t, crlOpts{number: 1}))
+	_, err := (&x509tools.CRLCache{Dir: dir}).Fetch(ctx, url, ca.cert)
+	require.NoError(t, err)
+	// a new cache loads it from disk
+	crl, err := (&x509tools.CRLCache{Dir: dir}).Fetch(ctx, url, ca.cert)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), crl.Number.Int64())
+	assert.Equal(t, 1, srv.count("/ca.crl"))
+	// but not if it was signed by someone else
+	_, err = (&x509tools.CRLCache{Dir: dir}).Fetch(ctx, url, newTestCA(t).cert)
+	assert.ErrorContains(t, err, "validating CRL signature")
+	assert.Equal(t, 2, srv.count("/ca.crl"))
+}
+
+// A CRL validated against one issuer must not be trusted for another issuer
+// that names the same distribution point
+func TestCRLCacheIssuer(t *testing.T) {
+	ca := newTestCA(t)
+	srv := newCRLServer(t)
+	ctx := context.Background()
+	url := srv.put("/ca.crl", ca.crl(t, crlOpts{number: 1}))
+	cache := &x509tools.CRLCache{}
+	_, err := cache.Fetch(ctx, url, ca.cert)
+	require.NoError(t, err)
+	_, err = cache.Fetch(ctx, url, newTestCA(t).cert)
+	assert.ErrorContains(t, err, "validating CRL signature")
+	// the original issuer's copy is still cached
+	_, err = cache.Fetch(ctx, url, ca.cert)
+	require.NoError(t, err)
+	assert.Equal(t, 2, srv.count("/ca.crl"))
+}
+
+// A slow download must not block fetches of other CRLs
+func TestCRLCacheSlowDownload(t *testing.T) {
+	ca := newTestCA(t)
+	srv := newCRLServer(t)
+	fastURL := srv.put("/fast.crl", ca.crl(t, crlOpts{number: 1}))
+	started := make(chan struct{})
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		http.NotFound(w, r)
+	}))
+	defer slow.Close()
+	defer close(release)
+	cache := &x509tools.CRLCache{}
+	go cache.Fetch(context.Background(), slow.URL+"/slow.crl", ca.cert)
+	<-started
+	done := make(chan error, 1)
+	go func() {
+		_, err := cache.Fetch(context.Background(), fastURL, ca.cert)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("fetch blocked behind another download")
+	}
+}
+
+func TestCRLDelta(t *testing.T) {
+	ca := newTestCA(t)
+	srv := newCRLServer(t)
+	revokedAt := time.Now().Add(-time.Hour)
+	const (
+		reasonKeyCompromise   = 1
+		reasonCertificateHold = 6
+		reasonRemoveFromCRL   = 8
+	)
+	deltaURL := srv.put("/delta.crl", ca.crl(t, crlOpts{
+		number:     6,
+		baseNumber: 5,
+		revoked: []pkix.RevokedCertificate{
+			revoked(t, 20, revokedAt, reasonKeyCompromise),
+			revoked(t, 30, revokedAt, reasonRemoveFromCRL),
+		},
+	}))
+	baseURL := srv.put("/base.crl", ca.crl(t, crlOpts{
+		number:   5,
+		freshest: deltaURL,
+		revoked: []pkix.RevokedCertificate{
+			revoked(t, 10, revokedAt, reasonKeyCompromise),
+			revoked(t, 30, revokedAt, reasonCertificateHold),
+		},
+	}))
+	cases := []struct {
+		name    string
+		serial  int64
+		at      time.Time
+		revoked bool
+		reason  int
+	}{
+		{name: "in base", serial: 10, revoked: true, reason: reasonKeyCompromise},
+		{name: "in base before revocation", serial: 10, at: revokedAt.Add(-time.Minute)},
+		{name: "in delta", serial: 20, revoked: true, reason: reasonKeyCompromise},
+		{name: "hold removed by delta", serial: 30},
+		{name: "not listed", serial: 40},
+	}
+	checker := &x509tools.CRLChecker{Cache: &x509tools.CRLCache{}, Policy: x509tools.RevocationHardFail}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			leaf := ca.issue(t, c.serial, baseURL)
+			err := checker.CheckRevocation([]*x509.Certificate{leaf, ca.cert}, c.at)
+			if !c.revoked {
+				assert.NoError(t, err)
+				return
+			}
+			var revErr x509tools.RevokedError
+			require.ErrorAs(t, err, &revErr)
+			assert.Equal(t, c.reason, revErr.Reason)
+			assert.Equal(t, leaf, revErr.Cert)
+		})
+	}
+}
+
+func TestCRLDeltaWrongBase(t *testing.T) {
+	ca := newTestCA(t)
+	srv := newCRLServer(t)
+	deltaURL := srv.put("/delta.crl", ca.crl(t, crlOpts{number: 8, baseNumber: 7}))
+	baseURL := srv.put("/base.crl", ca.crl(t, crlOpts{number: 5, freshest: deltaURL}))
+	leaf := ca.issue(t, 10, baseURL)
+	chain := []*x509.Certificate{leaf, ca.cert}
+	hard := &x509tools.CRLChecker{Cache: &x509tools.CRLCache{}, Policy: x509tools.RevocationHardFail}
+	assert.ErrorContains(t, hard.CheckRevocation(chain, time.Time{}), "requires a newer base CRL")
+	soft := &x509tools.CRLChecker{Cache: &x509tools.CRLCache{}, Policy: x509tools.RevocationSoftFail}
+	assert.NoError(t, soft.CheckRevocation(chain, time.Time{}))
+}
+
+func TestCRLPolicy(t *testing.T) {
+	ca := newTestCA(t)
+	srv := newCRLServer(t)
+	revokedURL := srv.put("/revoked.crl", ca.crl(t, crlOpts{
+		number:  1,
+		revoked: []pkix.RevokedCertificate{revoked(t, 10, time.Now().Add(-time.Hour), 0)},
+	}))
+	cases := []struct {
+		name   string
+		url    string
+		policy x509tools.RevocationPolicy
+		err    string
+	}{
+		{"revoked none", revokedURL, x509tools.RevocationNone, ""},
+		{"revoked soft", revokedURL, x509tools.RevocationSoftFail, "was revoked"},
+		{"revoked hard", revokedURL, x509tools.RevocationHardFail, "was revoked"},
+		{"unreachable soft", srv.URL + "/missing.crl", x509tools.RevocationSoftFail, ""},
+		{"unreachable hard", srv.URL + "/missing.crl", x509tools.RevocationHardFail, "404 Not Found"},
+		{"no distribution point soft", "", x509tools.RevocationSoftFail, ""},
+		{"no distribution point hard", "", x509tools.RevocationHardFail, "has no CRL distribution point"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			checker := &x509tools.CRLChecker{Cache: &x509tools.CRLCache{}, Policy: c.policy}
+			err := checker.CheckRevocation([]*x509.Certificate{ca.issue(t, 10, c.url), ca.cert}, time.Time{})
+			if c.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, c.err)
+			}
+		})
+	}
+}
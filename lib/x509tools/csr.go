@@ -0,0 +1,207 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package x509tools
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// RFC 2985
+var oidChallengePassword = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 7}
+
+type certificationRequest struct {
+	TBS                tbsCertificationRequest
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+}
+
+type tbsCertificationRequest struct {
+	Raw        asn1.RawContent
+	Version    int
+	Subject    asn1.RawValue
+	PublicKey  asn1.RawValue
+	Attributes []asn1.RawValue `asn1:"tag:0"`
+}
+
+type csrAttribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+// Parse a list of URIs from a space- and/or comma-separated string
+func parseURIs(s string) ([]*url.URL, error) {
+	var uris []*url.URL
+	for _, name := range splitAndTrim(s) {
+		u, err := url.Parse(name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid URI %q: %w", name, err)
+		} else if u.Scheme == "" {
+			return nil, fmt.Errorf("invalid URI %q: missing scheme", name)
+		}
+		uris = append(uris, u)
+	}
+	return uris, nil
+}
+
+// Build extensions from the --extension and --critical-extension arguments
+func parseExtensionArgs() ([]pkix.Extension, error) {
+	var exts []pkix.Extension
+	for _, arg := range ArgExtensions {
+		ext, err := ParseExtension(arg, false)
+		if err != nil {
+			return nil, err
+		}
+		exts = append(exts, ext)
+	}
+	for _, arg := range ArgCriticalExtensions {
+		ext, err := ParseExtension(arg, true)
+		if err != nil {
+			return nil, err
+		}
+		exts = append(exts, ext)
+	}
+	return exts, nil
+}
+
+// ParseExtension parses an extension given as OID=DER, where DER is the
+// hex-encoded value of the extension
+func ParseExtension(arg string, critical bool) (pkix.Extension, error) {
+	oidStr, value, ok := strings.Cut(arg, "=")
+	if !ok {
+		return pkix.Extension{}, fmt.Errorf("invalid extension %q: expected OID=DER", arg)
+	}
+	oid, ok := parseOID(strings.TrimSpace(oidStr))
+	if !ok {
+		return pkix.Extension{}, fmt.Errorf("invalid extension %q: malformed OID", arg)
+	}
+	der, err := hex.DecodeString(strings.ReplaceAll(strings.TrimSpace(value), ":", ""))
+	if err != nil {
+		return pkix.Extension{}, fmt.Errorf("invalid extension %q: %w", arg, err)
+	}
+	var raw asn1.RawValue
+	if rest, err := asn1.Unmarshal(der, &raw); err != nil {
+		return pkix.Extension{}, fmt.Errorf("invalid extension %q: value is not DER: %w", arg, err)
+	} else if len(rest) != 0 {
+		return pkix.Extension{}, fmt.Errorf("invalid extension %q: trailing garbage after DER value", arg)
+	}
+	return pkix.Extension{Id: oid, Critical: critical, Value: der}, nil
+}
+
+// Parse an OID in dotted decimal notation
+func parseOID(s string) (asn1.ObjectIdentifier, bool) {
+	var oid asn1.ObjectIdentifier
+	for _, part := range strings.Split(s, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, false
+		}
+		oid = append(oid, n)
+	}
+	return oid, len(oid) >= 2
+}
+
+func checkSignatureDigest() error {
+	if ArgSignatureDigest == "" {
+		return nil
+	}
+	switch HashByName(ArgSignatureDigest) {
+	case crypto.SHA256, crypto.SHA384, crypto.SHA512:
+		return nil
+	default:
+		return fmt.Errorf("unsupported signature digest %q", ArgSignatureDigest)
+	}
+}
+
+// Add a challengePassword attribute to a CSR and sign it again. The standard
+// library can't encode this attribute correctly.
+func addChallengePassword(csrDer []byte, rand io.Reader, key crypto.Signer, password string) ([]byte, error) {
+	parsed, err := x509.ParseCertificateRequest(csrDer)
+	if err != nil {
+		return nil, err
+	}
+	var csr certificationRequest
+	if rest, err := asn1.Unmarshal(csrDer, &csr); err != nil {
+		return nil, err
+	} else if len(rest) != 0 {
+		return nil, errors.New("trailing garbage after CSR")
+	}
+	// a PrintableString is used if possible, otherwise a UTF8String
+	value, err := asn1.Marshal(password)
+	if err != nil {
+		return nil, err
+	}
+	attr, err := asn1.Marshal(csrAttribute{
+		Type:   oidChallengePassword,
+		Values: []asn1.RawValue{{FullBytes: value}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	csr.TBS.Raw = nil
+	csr.TBS.Attributes = append(csr.TBS.Attributes, asn1.RawValue{FullBytes: attr})
+	tbs, err := asn1.Marshal(csr.TBS)
+	if err != nil {
+		return nil, err
+	}
+	var opts crypto.SignerOpts
+	switch parsed.SignatureAlgorithm {
+	case x509.PureEd25519:
+		sig, err := key.Sign(rand, tbs, crypto.Hash(0))
+		if err != nil {
+			return nil, err
+		}
+		return finishCSR(csr, tbs, sig)
+	case x509.SHA256WithRSA, x509.ECDSAWithSHA256:
+		opts = crypto.SHA256
+	case x509.SHA384WithRSA, x509.ECDSAWithSHA384:
+		opts = crypto.SHA384
+	case x509.SHA512WithRSA, x509.ECDSAWithSHA512:
+		opts = crypto.SHA512
+	case x509.SHA256WithRSAPSS:
+		opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256}
+	case x509.SHA384WithRSAPSS:
+		opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA384}
+	case x509.SHA512WithRSAPSS:
+		opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA512}
+	default:
+		return nil, fmt.Errorf("unsupported signature algorithm %s", parsed.SignatureAlgorithm)
+	}
+	h := opts.HashFunc().New()
+	h.Write(tbs)
+	sig, err := key.Sign(rand, h.Sum(nil), opts)
+	if err != nil {
+		return nil, err
+	}
+	return finishCSR(csr, tbs, sig)
+}
+
+func finishCSR(csr certificationRequest, tbs, sig []byte) ([]byte, error) {
+	csr.TBS.Raw = tbs
+	csr.Signature = asn1.BitString{Bytes: sig, BitLength: 8 * len(sig)}
+	return asn1.Marshal(csr)
+}
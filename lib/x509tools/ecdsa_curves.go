@@ -32,12 +32,23 @@ type CurveDefinition struct {
 	Bits  uint
 	Curve elliptic.Curve
 	Oid   asn1.ObjectIdentifier
+	Name  string
 }
 
 var DefinedCurves = []CurveDefinition{
-	{256, elliptic.P256(), asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}},
-	{384, elliptic.P384(), asn1.ObjectIdentifier{1, 3, 132, 0, 34}},
-	{521, elliptic.P521(), asn1.ObjectIdentifier{1, 3, 132, 0, 35}},
+	{256, elliptic.P256(), asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}, "P-256"},
+	{384, elliptic.P384(), asn1.ObjectIdentifier{1, 3, 132, 0, 34}, "P-384"},
+	{521, elliptic.P521(), asn1.ObjectIdentifier{1, 3, 132, 0, 35}, "P-521"},
+}
+
+// VerifyOnlyCurves can only be used to check signatures made by a public key
+// that is given directly, such as an XML-DSIG ECKeyValue. crypto/x509 can't
+// parse or create certificates for keys on these curves, and their arithmetic
+// is not constant time, so they are never used for keys that sign.
+var VerifyOnlyCurves = []CurveDefinition{
+	{256, BrainpoolP256r1(), asn1.ObjectIdentifier{1, 3, 36, 3, 3, 2, 8, 1, 1, 7}, "brainpoolP256r1"},
+	{384, BrainpoolP384r1(), asn1.ObjectIdentifier{1, 3, 36, 3, 3, 2, 8, 1, 1, 11}, "brainpoolP384r1"},
+	{256, Secp256k1(), asn1.ObjectIdentifier{1, 3, 132, 0, 10}, "secp256k1"},
 }
 
 // Return the DER encoding of the ASN.1 OID of this named curve
@@ -70,14 +81,24 @@ func CurveByOid(oid asn1.ObjectIdentifier) (*CurveDefinition, error) {
 
 // Get a curve by a dotted decimal OID string
 func CurveByOidString(oidstr string) (*CurveDefinition, error) {
-	parts := strings.Split(oidstr, ".")
-	oid := make(asn1.ObjectIdentifier, 0, len(parts))
-	for _, n := range parts {
-		v, err := strconv.Atoi(n)
-		if err != nil {
-			return nil, errors.New("invalid OID")
+	oid, ok := parseOID(oidstr)
+	if !ok {
+		return nil, errors.New("invalid OID")
+	}
+	return CurveByOid(oid)
+}
+
+// Get a curve for checking a signature by a dotted decimal OID string,
+// including the verify-only curves
+func VerifyCurveByOidString(oidstr string) (*CurveDefinition, error) {
+	oid, ok := parseOID(oidstr)
+	if !ok {
+		return nil, errors.New("invalid OID")
+	}
+	for _, def := range VerifyOnlyCurves {
+		if oid.Equal(def.Oid) {
+			return &def, nil
 		}
-		oid = append(oid, v)
 	}
 	return CurveByOid(oid)
 }
@@ -112,6 +133,20 @@ func CurveByBits(bits uint) (*CurveDefinition, error) {
 	return nil, fmt.Errorf("Unsupported ECDSA curve: %v\nSupported curves: %s", bits, SupportedCurves())
 }
 
+// Get a curve by name, e.g. P-256. Case and dashes are ignored.
+func CurveByName(name string) (*CurveDefinition, error) {
+	normalize := func(s string) string {
+		return strings.ToLower(strings.ReplaceAll(s, "-", ""))
+	}
+	want := normalize(name)
+	for _, def := range DefinedCurves {
+		if want == normalize(def.Name) {
+			return &def, nil
+		}
+	}
+	return nil, fmt.Errorf("Unsupported ECDSA curve: %s\nSupported curves: %s", name, SupportedCurves())
+}
+
 // Decode an ECDSA public key from its DER encoding. Both octet and bitstring
 // encodings are supported.
 func DerToPoint(curve elliptic.Curve, der []byte) (*big.Int, *big.Int) {
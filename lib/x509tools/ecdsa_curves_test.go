@@ -42,3 +42,30 @@ func TestMarshal(t *testing.T) {
 	sig.R, sig.S = sig.S, sig.R
 	assert.Equal(t, []byte{0, 255, 2, 0}, sig.Pack())
 }
+
+func TestExtraCurves(t *testing.T) {
+	for _, def := range VerifyOnlyCurves {
+		name := def.Name
+		params := def.Curve.Params()
+		assert.True(t, def.Curve.IsOnCurve(params.Gx, params.Gy), name)
+		// n*G is the point at infinity
+		x, y := def.Curve.ScalarBaseMult(params.N.Bytes())
+		assert.Zero(t, x.Sign(), name)
+		assert.Zero(t, y.Sign(), name)
+		byOid, err := VerifyCurveByOidString(def.Oid.String())
+		require.NoError(t, err)
+		assert.Equal(t, name, byOid.Name)
+		// not usable for keys that sign
+		_, err = CurveByName(name)
+		assert.Error(t, err, name)
+		_, err = CurveByOid(def.Oid)
+		assert.Error(t, err, name)
+	}
+	// 3G on secp256k1
+	x, _ := Secp256k1().ScalarBaseMult([]byte{3})
+	assert.Equal(t, "f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f9", x.Text(16))
+	// sizes still select the NIST curves
+	def, err := CurveByBits(256)
+	require.NoError(t, err)
+	assert.Equal(t, "P-256", def.Name)
+}
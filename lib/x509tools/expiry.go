@@ -0,0 +1,117 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package x509tools
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"time"
+)
+
+// ExpiryStatus classifies how close a certificate is to expiring
+type ExpiryStatus string
+
+const (
+	ExpiryOK       ExpiryStatus = "ok"
+	ExpiryWarning  ExpiryStatus = "warning"
+	ExpiryCritical ExpiryStatus = "critical"
+	ExpiryExpired  ExpiryStatus = "expired"
+)
+
+// ExpiryThresholds sets how long before expiry a certificate is reported as
+// a warning or as critical
+type ExpiryThresholds struct {
+	Warning  time.Duration
+	Critical time.Duration
+}
+
+// CertExpiry reports the remaining lifetime of one certificate in a chain
+type CertExpiry struct {
+	Role     string       `json:"role"` // leaf, intermediate or root
+	Subject  string       `json:"subject"`
+	Serial   string       `json:"serial"`
+	NotAfter time.Time    `json:"not_after"`
+	DaysLeft int          `json:"days_left"`
+	Status   ExpiryStatus `json:"status"`
+}
+
+func (e CertExpiry) String() string {
+	return fmt.Sprintf("%s certificate `%s` expires %s (%d days, %s)", e.Role, e.Subject, e.NotAfter.Format(time.RFC3339), e.DaysLeft, e.Status)
+}
+
+// ChainExpiry reports on each certificate in a chain, ordered from leaf to root
+func ChainExpiry(chain []*x509.Certificate, thresholds ExpiryThresholds, now time.Time) []CertExpiry {
+	results := make([]CertExpiry, len(chain))
+	for i, cert := range chain {
+		role := "intermediate"
+		if i == 0 {
+			role = "leaf"
+		} else if bytes.Equal(cert.RawSubject, cert.RawIssuer) {
+			role = "root"
+		}
+		left := cert.NotAfter.Sub(now)
+		status := ExpiryOK
+		switch {
+		case left <= 0:
+			status = ExpiryExpired
+		case left <= thresholds.Critical:
+			status = ExpiryCritical
+		case left <= thresholds.Warning:
+			status = ExpiryWarning
+		}
+		results[i] = CertExpiry{
+			Role:     role,
+			Subject:  FormatSubject(cert),
+			Serial:   fmt.Sprintf("%X", cert.SerialNumber),
+			NotAfter: cert.NotAfter,
+			DaysLeft: int(left.Hours() / 24),
+			Status:   status,
+		}
+	}
+	return results
+}
+
+// WorstExpiry returns the most severe status among the results
+func WorstExpiry(results []CertExpiry) ExpiryStatus {
+	rank := map[ExpiryStatus]int{ExpiryOK: 0, ExpiryWarning: 1, ExpiryCritical: 2, ExpiryExpired: 3}
+	worst := ExpiryOK
+	for _, result := range results {
+		if rank[result.Status] > rank[worst] {
+			worst = result.Status
+		}
+	}
+	return worst
+}
+
+// BuildChain orders certificates from leaf up to the last issuer that can be
+// found in certs
+func BuildChain(leaf *x509.Certificate, certs []*x509.Certificate) []*x509.Certificate {
+	chain := []*x509.Certificate{leaf}
+	for cert := leaf; len(chain) <= len(certs); {
+		if bytes.Equal(cert.RawSubject, cert.RawIssuer) {
+			break
+		}
+		issuer := findIssuer(cert, certs)
+		if issuer == nil {
+			break
+		}
+		chain = append(chain, issuer)
+		cert = issuer
+	}
+	return chain
+}
@@ -0,0 +1,64 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package x509tools_test
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+)
+
+func TestChainExpiry(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	mk := func(cn, issuer string, days int) *x509.Certificate {
+		return &x509.Certificate{
+			Subject:      pkix.Name{CommonName: cn},
+			RawSubject:   []byte(cn),
+			RawIssuer:    []byte(issuer),
+			SerialNumber: big.NewInt(1),
+			NotAfter:     now.Add(time.Duration(days) * 24 * time.Hour),
+		}
+	}
+	chain := []*x509.Certificate{
+		mk("leaf", "inter", 3),
+		mk("inter", "root", 20),
+		mk("root", "root", 3650),
+	}
+	results := x509tools.ChainExpiry(chain, x509tools.ExpiryThresholds{
+		Warning:  30 * 24 * time.Hour,
+		Critical: 7 * 24 * time.Hour,
+	}, now)
+	assert.Len(t, results, 3)
+	assert.Equal(t, "leaf", results[0].Role)
+	assert.Equal(t, 3, results[0].DaysLeft)
+	assert.Equal(t, x509tools.ExpiryCritical, results[0].Status)
+	assert.Equal(t, "intermediate", results[1].Role)
+	assert.Equal(t, x509tools.ExpiryWarning, results[1].Status)
+	assert.Equal(t, "root", results[2].Role)
+	assert.Equal(t, x509tools.ExpiryOK, results[2].Status)
+	assert.Equal(t, x509tools.ExpiryCritical, x509tools.WorstExpiry(results))
+
+	results = x509tools.ChainExpiry(chain[:1], x509tools.ExpiryThresholds{}, now.Add(4*24*time.Hour))
+	assert.Equal(t, x509tools.ExpiryExpired, results[0].Status)
+}
@@ -0,0 +1,255 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package x509tools
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+	"golang.org/x/sync/singleflight"
+)
+
+// RevocationPolicy controls what happens when the revocation status of a
+// certificate cannot be determined
+type RevocationPolicy int
+
+const (
+	// Do not check revocation status
+	RevocationNone RevocationPolicy = iota
+	// Fail only if a certificate is positively known to be revoked
+	RevocationSoftFail
+	// Fail unless every certificate is positively known to be good
+	RevocationHardFail
+)
+
+const maxOCSPResponse = 1 << 20
+
+// ParseRevocationPolicy parses a policy name as used in configuration files
+// and command-line flags
+func ParseRevocationPolicy(name string) (RevocationPolicy, error) {
+	switch strings.ToLower(name) {
+	case "", "none", "off":
+		return RevocationNone, nil
+	case "soft", "soft-fail":
+		return RevocationSoftFail, nil
+	case "hard", "hard-fail":
+		return RevocationHardFail, nil
+	default:
+		return RevocationNone, fmt.Errorf("invalid revocation policy %q, expected one of: none soft hard", name)
+	}
+}
+
+// RevokedError is returned when a certificate in the chain has been revoked
+type RevokedError struct {
+	Cert      *x509.Certificate
+	RevokedAt time.Time
+	Reason    int
+}
+
+func (e RevokedError) Error() string {
+	return fmt.Sprintf("certificate `%s` (serial %X) was revoked at %s (reason %d)", FormatSubject(e.Cert), e.Cert.SerialNumber, e.RevokedAt, e.Reason)
+}
+
+// OCSPResult holds a validated OCSP response for a single certificate
+type OCSPResult struct {
+	Cert     *x509.Certificate
+	Response *ocsp.Response
+	// DER encoding of the complete OCSPResponse
+	Raw []byte
+}
+
+// FetchOCSP queries the OCSP responder named in cert and returns a validated
+// response. The response signature is checked against issuer, but revocation
+// status is not interpreted.
+func FetchOCSP(ctx context.Context, client *http.Client, cert, issuer *x509.Certificate) (*OCSPResult, error) {
+	if len(cert.OCSPServer) == 0 {
+		return nil, errors.New("certificate does not specify an OCSP responder")
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	reqBytes, err := ocsp.CreateRequest(cert, issuer, &ocsp.RequestOptions{Hash: crypto.SHA1})
+	if err != nil {
+		return nil, fmt.Errorf("ocsp: creating request: %w", err)
+	}
+	var lastErr error
+	for _, url := range cert.OCSPServer {
+		raw, err := postOCSP(ctx, client, url, reqBytes)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		resp, err := ocsp.ParseResponseForCert(raw, cert, issuer)
+		if err != nil {
+			lastErr = fmt.Errorf("ocsp: parsing response from %s: %w", url, err)
+			continue
+		}
+		now := time.Now()
+		if !resp.NextUpdate.IsZero() && now.After(resp.NextUpdate) {
+			lastErr = fmt.Errorf("ocsp: response from %s is stale", url)
+			continue
+		}
+		return &OCSPResult{Cert: cert, Response: resp, Raw: raw}, nil
+	}
+	return nil, lastErr
+}
+
+func postOCSP(ctx context.Context, client *http.Client, url string, reqBytes []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(reqBytes))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/ocsp-request")
+	req.Header.Set("Accept", "application/ocsp-response")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("ocsp: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ocsp: HTTP error from %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxOCSPResponse))
+}
+
+// CheckOCSP validates the revocation status of leaf and each intermediate
+// certificate that can be found in certs, walking up the chain until an
+// issuer can't be found or a self-signed root is reached. The raw responses
+// are returned so they can be embedded into a signature.
+//
+// With RevocationSoftFail, certificates whose status can't be determined are
+// skipped. With RevocationHardFail, any certificate without a good status
+// causes an error. A revoked certificate always results in a RevokedError.
+func CheckOCSP(ctx context.Context, leaf *x509.Certificate, certs []*x509.Certificate, policy RevocationPolicy) ([]*OCSPResult, error) {
+	return new(OCSPCache).Check(ctx, leaf, certs, policy)
+}
+
+// OCSPCache keeps validated OCSP responses in memory until their nextUpdate
+// time, so that signing many files doesn't query the responder every time.
+// Responses without a nextUpdate time are not cached.
+type OCSPCache struct {
+	// HTTP client to use for queries. If nil then the default client is used.
+	Client *http.Client
+
+	mu    sync.Mutex
+	mem   map[string]*OCSPResult
+	fetch singleflight.Group
+}
+
+// Fetch returns a validated response for cert, querying the responder if no
+// unexpired response is cached
+func (c *OCSPCache) Fetch(ctx context.Context, cert, issuer *x509.Certificate) (*OCSPResult, error) {
+	// responses are only valid for the issuer that signed them, so key on
+	// the complete issuer certificate as well as the serial
+	digest := sha256.Sum256(issuer.Raw)
+	key := hex.EncodeToString(digest[:]) + "/" + cert.SerialNumber.Text(16)
+	c.mu.Lock()
+	cached := c.mem[key]
+	c.mu.Unlock()
+	if cached != nil && time.Now().Before(cached.Response.NextUpdate) {
+		return &OCSPResult{Cert: cert, Response: cached.Response, Raw: cached.Raw}, nil
+	}
+	v, err, _ := c.fetch.Do(key, func() (interface{}, error) {
+		result, err := FetchOCSP(ctx, c.Client, cert, issuer)
+		if err != nil {
+			return nil, err
+		}
+		if !result.Response.NextUpdate.IsZero() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			if c.mem == nil {
+				c.mem = make(map[string]*OCSPResult)
+			}
+			c.mem[key] = result
+		}
+		return result, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := v.(*OCSPResult)
+	return &OCSPResult{Cert: cert, Response: result.Response, Raw: result.Raw}, nil
+}
+
+// Check is like CheckOCSP but uses cached responses where possible
+func (c *OCSPCache) Check(ctx context.Context, leaf *x509.Certificate, certs []*x509.Certificate, policy RevocationPolicy) ([]*OCSPResult, error) {
+	if policy == RevocationNone || leaf == nil {
+		return nil, nil
+	}
+	var results []*OCSPResult
+	seen := make(map[*x509.Certificate]bool)
+	for cert := leaf; cert != nil && !seen[cert]; {
+		seen[cert] = true
+		if bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+			// self-signed root
+			break
+		}
+		issuer := findIssuer(cert, certs)
+		if issuer == nil {
+			if policy == RevocationHardFail && cert == leaf {
+				return nil, fmt.Errorf("ocsp: issuer of `%s` not found", FormatSubject(cert))
+			}
+			break
+		}
+		result, err := c.Fetch(ctx, cert, issuer)
+		switch {
+		case err != nil:
+			if policy == RevocationHardFail {
+				return nil, fmt.Errorf("checking revocation of `%s`: %w", FormatSubject(cert), err)
+			}
+		case result.Response.Status == ocsp.Revoked:
+			return nil, RevokedError{
+				Cert:      cert,
+				RevokedAt: result.Response.RevokedAt,
+				Reason:    result.Response.RevocationReason,
+			}
+		case result.Response.Status != ocsp.Good:
+			if policy == RevocationHardFail {
+				return nil, fmt.Errorf("ocsp: status of `%s` is unknown", FormatSubject(cert))
+			}
+		default:
+			results = append(results, result)
+		}
+		cert = issuer
+	}
+	return results, nil
+}
+
+// Find the certificate that issued cert and has a valid signature over it
+func findIssuer(cert *x509.Certificate, certs []*x509.Certificate) *x509.Certificate {
+	for _, candidate := range certs {
+		if candidate == cert || !bytes.Equal(candidate.RawSubject, cert.RawIssuer) {
+			continue
+		}
+		if cert.CheckSignatureFrom(candidate) == nil {
+			return candidate
+		}
+	}
+	return nil
+}
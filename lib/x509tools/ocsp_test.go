@@ -0,0 +1,202 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package x509tools_test
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/sassoftware/relic/v7/internal/testcert"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+)
+
+// Serial numbers that the test responder answers for
+const (
+	ocspGood    = 1
+	ocspRevoked = 2
+	ocspUnknown = 3
+	ocspStale   = 4
+)
+
+func newOCSPResponder(t *testing.T, ca testCA) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		req, err := ocsp.ParseRequest(body)
+		require.NoError(t, err)
+		tmpl := ocsp.Response{
+			SerialNumber: req.SerialNumber,
+			ThisUpdate:   time.Now().Add(-time.Hour),
+			NextUpdate:   time.Now().Add(time.Hour),
+		}
+		switch req.SerialNumber.Int64() {
+		case ocspGood:
+			tmpl.Status = ocsp.Good
+		case ocspRevoked:
+			tmpl.Status = ocsp.Revoked
+			tmpl.RevokedAt = time.Now().Add(-time.Minute).Truncate(time.Second)
+			tmpl.RevocationReason = ocsp.KeyCompromise
+		case ocspStale:
+			tmpl.Status = ocsp.Good
+			tmpl.ThisUpdate = time.Now().Add(-2 * time.Hour)
+			tmpl.NextUpdate = time.Now().Add(-time.Hour)
+		default:
+			tmpl.Status = ocsp.Unknown
+		}
+		resp, err := ocsp.CreateResponse(ca.cert, ca.cert, tmpl, ca.key)
+		require.NoError(t, err)
+		w.Header().Set("Content-Type", "application/ocsp-response")
+		w.Write(resp)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func (ca testCA) issueOCSP(t *testing.T, serial int64, url string) *x509.Certificate {
+	return testcert.Issue(t, &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "leaf"},
+		OCSPServer:   []string{url},
+	}, testcert.ECDSAKey(t), ca.cert, ca.key)
+}
+
+func TestFetchOCSP(t *testing.T) {
+	ca := newTestCA(t)
+	srv := newOCSPResponder(t, ca)
+	cases := []struct {
+		name   string
+		serial int64
+		status int
+		err    string
+	}{
+		{"good", ocspGood, ocsp.Good, ""},
+		{"revoked", ocspRevoked, ocsp.Revoked, ""},
+		{"unknown", ocspUnknown, ocsp.Unknown, ""},
+		{"stale", ocspStale, 0, "is stale"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			leaf := ca.issueOCSP(t, c.serial, srv.URL)
+			result, err := x509tools.FetchOCSP(context.Background(), srv.Client(), leaf, ca.cert)
+			if c.err != "" {
+				assert.ErrorContains(t, err, c.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, c.status, result.Response.Status)
+			assert.Equal(t, leaf, result.Cert)
+			assert.NotEmpty(t, result.Raw)
+		})
+	}
+	// a response signed by someone else is rejected
+	leaf := ca.issueOCSP(t, ocspGood, srv.URL)
+	_, err := x509tools.FetchOCSP(context.Background(), srv.Client(), leaf, newTestCA(t).cert)
+	assert.Error(t, err)
+	// as is a certificate with no responder
+	_, err = x509tools.FetchOCSP(context.Background(), srv.Client(), ca.issue(t, ocspGood, ""), ca.cert)
+	assert.EqualError(t, err, "certificate does not specify an OCSP responder")
+}
+
+func TestCheckOCSP(t *testing.T) {
+	ca := newTestCA(t)
+	srv := newOCSPResponder(t, ca)
+	cases := []struct {
+		name    string
+		serial  int64
+		policy  x509tools.RevocationPolicy
+		results int
+		err     string
+	}{
+		{"good soft", ocspGood, x509tools.RevocationSoftFail, 1, ""},
+		{"good hard", ocspGood, x509tools.RevocationHardFail, 1, ""},
+		{"revoked none", ocspRevoked, x509tools.RevocationNone, 0, ""},
+		{"revoked soft", ocspRevoked, x509tools.RevocationSoftFail, 0, "was revoked"},
+		{"revoked hard", ocspRevoked, x509tools.RevocationHardFail, 0, "was revoked"},
+		{"unknown soft", ocspUnknown, x509tools.RevocationSoftFail, 0, ""},
+		{"unknown hard", ocspUnknown, x509tools.RevocationHardFail, 0, "is unknown"},
+		{"stale soft", ocspStale, x509tools.RevocationSoftFail, 0, ""},
+		{"stale hard", ocspStale, x509tools.RevocationHardFail, 0, "is stale"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			leaf := ca.issueOCSP(t, c.serial, srv.URL)
+			results, err := x509tools.CheckOCSP(context.Background(), leaf, []*x509.Certificate{leaf, ca.cert}, c.policy)
+			if c.err != "" {
+				assert.ErrorContains(t, err, c.err)
+				if c.serial == ocspRevoked {
+					var revErr x509tools.RevokedError
+					require.ErrorAs(t, err, &revErr)
+					assert.Equal(t, ocsp.KeyCompromise, revErr.Reason)
+				}
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, results, c.results)
+		})
+	}
+	// hard fail requires the issuer to be present
+	leaf := ca.issueOCSP(t, ocspGood, srv.URL)
+	_, err := x509tools.CheckOCSP(context.Background(), leaf, []*x509.Certificate{leaf}, x509tools.RevocationHardFail)
+	assert.ErrorContains(t, err, "issuer of `CN=leaf` not found")
+}
+
+func TestOCSPCache(t *testing.T) {
+	ca := newTestCA(t)
+	var queries int
+	responder := newOCSPResponder(t, ca)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries++
+		responder.Config.Handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	cache := &x509tools.OCSPCache{Client: srv.Client()}
+	leaf := ca.issueOCSP(t, ocspGood, srv.URL)
+	for i := 0; i < 3; i++ {
+		results, err := cache.Check(context.Background(), leaf, []*x509.Certificate{leaf, ca.cert}, x509tools.RevocationHardFail)
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		assert.Equal(t, leaf, results[0].Cert)
+	}
+	assert.Equal(t, 1, queries)
+	// a different certificate is queried separately
+	_, err := cache.Fetch(context.Background(), ca.issueOCSP(t, ocspRevoked, srv.URL), ca.cert)
+	require.NoError(t, err)
+	assert.Equal(t, 2, queries)
+	// expired responses are not reused
+	stale := ca.issueOCSP(t, ocspStale, srv.URL)
+	for i := 0; i < 2; i++ {
+		_, err = cache.Fetch(context.Background(), stale, ca.cert)
+		assert.ErrorContains(t, err, "is stale")
+	}
+	assert.Equal(t, 4, queries)
+	// nor is a response for a certificate with the same serial from another CA
+	other := newTestCA(t)
+	_, err = cache.Fetch(context.Background(), other.issueOCSP(t, ocspGood, srv.URL), other.cert)
+	assert.Error(t, err)
+	assert.Equal(t, 5, queries)
+}
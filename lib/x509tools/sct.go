@@ -0,0 +1,277 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package x509tools
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"golang.org/x/crypto/cryptobyte"
+)
+
+// RFC 6962 section 3.3
+var OidExtensionSCTList = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+
+const (
+	sctVersion1          = 0
+	sctTypeCertTimestamp = 0
+	sctEntryTypePrecert  = 1
+	sctHashSHA256        = 4
+	sctSignatureRSA      = 1
+	sctSignatureECDSA    = 3
+	ctLogIDSize          = sha256.Size
+)
+
+// CTLog describes a Certificate Transparency log that is trusted to issue SCTs
+type CTLog struct {
+	Description string
+	Operator    string
+	URL         string
+	ID          [ctLogIDSize]byte
+	Key         crypto.PublicKey
+}
+
+// CTLogList is a set of trusted Certificate Transparency logs, indexed by log ID
+type CTLogList map[[ctLogIDSize]byte]*CTLog
+
+// ParseCTLogList parses a log list in the JSON format published by Google
+// (log_list.json, schema version 3)
+func ParseCTLogList(blob []byte) (CTLogList, error) {
+	var doc struct {
+		Operators []struct {
+			Name string `json:"name"`
+			Logs []struct {
+				Description string `json:"description"`
+				Key         []byte `json:"key"`
+				URL         string `json:"url"`
+			} `json:"logs"`
+		} `json:"operators"`
+	}
+	if err := json.Unmarshal(blob, &doc); err != nil {
+		return nil, fmt.Errorf("parsing CT log list: %w", err)
+	}
+	logs := make(CTLogList)
+	for _, op := range doc.Operators {
+		for _, l := range op.Logs {
+			key, err := x509.ParsePKIXPublicKey(l.Key)
+			if err != nil {
+				return nil, fmt.Errorf("parsing CT log list: key for %q: %w", l.Description, err)
+			}
+			log := &CTLog{
+				Description: l.Description,
+				Operator:    op.Name,
+				URL:         l.URL,
+				ID:          sha256.Sum256(l.Key),
+				Key:         key,
+			}
+			logs[log.ID] = log
+		}
+	}
+	if len(logs) == 0 {
+		return nil, errors.New("CT log list is empty")
+	}
+	return logs, nil
+}
+
+// SCT is a signed certificate timestamp as embedded in a X509 certificate
+type SCT struct {
+	Version    uint8
+	LogID      [ctLogIDSize]byte
+	Timestamp  time.Time
+	Extensions []byte
+	HashAlg    uint8
+	SigAlg     uint8
+	Signature  []byte
+
+	timestamp uint64
+}
+
+// SCTResult is the outcome of validating a single embedded SCT
+type SCTResult struct {
+	SCT *SCT
+	// Log that issued the SCT, or nil if it is not in the trusted list
+	Log *CTLog
+	// Err is set if the log is unknown or the signature is not valid
+	Err error
+}
+
+// ParseEmbeddedSCTs returns the SCTs embedded in a certificate, if any
+func ParseEmbeddedSCTs(cert *x509.Certificate) ([]*SCT, error) {
+	var extValue []byte
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(OidExtensionSCTList) {
+			extValue = ext.Value
+			break
+		}
+	}
+	if extValue == nil {
+		return nil, nil
+	}
+	// the TLS-encoded list is wrapped in an additional OCTET STRING
+	var listBytes []byte
+	if rest, err := asn1.Unmarshal(extValue, &listBytes); err != nil {
+		return nil, fmt.Errorf("parsing SCT list: %w", err)
+	} else if len(rest) != 0 {
+		return nil, errors.New("parsing SCT list: trailing garbage")
+	}
+	input := cryptobyte.String(listBytes)
+	var list cryptobyte.String
+	if !input.ReadUint16LengthPrefixed(&list) || !input.Empty() {
+		return nil, errors.New("parsing SCT list: malformed list")
+	}
+	var scts []*SCT
+	for !list.Empty() {
+		var item cryptobyte.String
+		if !list.ReadUint16LengthPrefixed(&item) {
+			return nil, errors.New("parsing SCT list: malformed entry")
+		}
+		sct, err := parseSCT(item)
+		if err != nil {
+			return nil, err
+		}
+		scts = append(scts, sct)
+	}
+	return scts, nil
+}
+
+func parseSCT(item cryptobyte.String) (*SCT, error) {
+	sct := new(SCT)
+	var logID, ext, sig []byte
+	if !item.ReadUint8(&sct.Version) ||
+		!item.ReadBytes(&logID, ctLogIDSize) ||
+		!item.ReadUint64(&sct.timestamp) ||
+		!item.ReadUint16LengthPrefixed((*cryptobyte.String)(&ext)) ||
+		!item.ReadUint8(&sct.HashAlg) ||
+		!item.ReadUint8(&sct.SigAlg) ||
+		!item.ReadUint16LengthPrefixed((*cryptobyte.String)(&sig)) ||
+		!item.Empty() {
+		return nil, errors.New("parsing SCT: malformed SCT")
+	}
+	if sct.Version != sctVersion1 {
+		return nil, fmt.Errorf("parsing SCT: unsupported version %d", sct.Version)
+	}
+	copy(sct.LogID[:], logID)
+	sct.Extensions = ext
+	sct.Signature = sig
+	sct.Timestamp = time.UnixMilli(int64(sct.timestamp)).UTC()
+	return sct, nil
+}
+
+// VerifyEmbeddedSCTs checks the signature of each SCT embedded in cert against
+// the trusted logs. The issuer of cert must be present in certs. An error is
+// returned only if the SCTs can't be parsed; the status of each individual
+// SCT is reported in the results.
+func VerifyEmbeddedSCTs(cert *x509.Certificate, certs []*x509.Certificate, logs CTLogList) ([]SCTResult, error) {
+	scts, err := ParseEmbeddedSCTs(cert)
+	if err != nil || len(scts) == 0 {
+		return nil, err
+	}
+	issuer := findIssuer(cert, certs)
+	if issuer == nil {
+		return nil, fmt.Errorf("issuer of `%s` not found, can't verify SCTs", FormatSubject(cert))
+	}
+	tbs, err := precertTBS(cert)
+	if err != nil {
+		return nil, err
+	}
+	issuerKeyHash := sha256.Sum256(issuer.RawSubjectPublicKeyInfo)
+	results := make([]SCTResult, len(scts))
+	for i, sct := range scts {
+		results[i].SCT = sct
+		log := logs[sct.LogID]
+		if log == nil {
+			results[i].Err = fmt.Errorf("SCT from unknown log %x", sct.LogID)
+			continue
+		}
+		results[i].Log = log
+		results[i].Err = sct.verify(log, issuerKeyHash[:], tbs)
+	}
+	return results, nil
+}
+
+// Reconstruct the signed data and check the SCT signature against the log's key
+func (sct *SCT) verify(log *CTLog, issuerKeyHash, tbs []byte) error {
+	if sct.HashAlg != sctHashSHA256 {
+		return fmt.Errorf("SCT from %s: unsupported hash algorithm %d", log.Description, sct.HashAlg)
+	}
+	switch sct.SigAlg {
+	case sctSignatureRSA, sctSignatureECDSA:
+	default:
+		return fmt.Errorf("SCT from %s: unsupported signature algorithm %d", log.Description, sct.SigAlg)
+	}
+	var b cryptobyte.Builder
+	b.AddUint8(sct.Version)
+	b.AddUint8(sctTypeCertTimestamp)
+	b.AddUint64(sct.timestamp)
+	b.AddUint16(sctEntryTypePrecert)
+	b.AddBytes(issuerKeyHash)
+	b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes(tbs)
+	})
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes(sct.Extensions)
+	})
+	signed, err := b.Bytes()
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256(signed)
+	if err := Verify(log.Key, crypto.SHA256, digest[:], sct.Signature); err != nil {
+		return fmt.Errorf("SCT from %s: %w", log.Description, err)
+	}
+	return nil
+}
+
+type tbsCertificate struct {
+	Raw                asn1.RawContent
+	Version            int `asn1:"optional,explicit,default:0,tag:0"`
+	SerialNumber       *big.Int
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Issuer             asn1.RawValue
+	Validity           asn1.RawValue
+	Subject            asn1.RawValue
+	PublicKey          asn1.RawValue
+	UniqueID           asn1.BitString   `asn1:"optional,tag:1"`
+	SubjectUniqueID    asn1.BitString   `asn1:"optional,tag:2"`
+	Extensions         []pkix.Extension `asn1:"optional,explicit,tag:3"`
+}
+
+// Recover the precertificate TBSCertificate that the log signed by removing
+// the SCT list extension from the final certificate
+func precertTBS(cert *x509.Certificate) ([]byte, error) {
+	var tbs tbsCertificate
+	if _, err := asn1.Unmarshal(cert.RawTBSCertificate, &tbs); err != nil {
+		return nil, err
+	}
+	tbs.Raw = nil
+	exts := tbs.Extensions[:0]
+	for _, ext := range tbs.Extensions {
+		if !ext.Id.Equal(OidExtensionSCTList) {
+			exts = append(exts, ext)
+		}
+	}
+	tbs.Extensions = exts
+	return asn1.Marshal(tbs)
+}
@@ -17,8 +17,10 @@
 package x509tools
 
 import (
+	"bytes"
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
@@ -42,13 +44,34 @@ func MakeSerial() *big.Int {
 
 // Choose a X509 signature algorithm suitable for the specified public key
 func X509SignatureAlgorithm(pub crypto.PublicKey) x509.SignatureAlgorithm {
+	hash := HashByName(ArgSignatureDigest)
 	switch k := pub.(type) {
 	case *rsa.PublicKey:
+		switch hash {
+		case crypto.SHA384:
+			if ArgRSAPSS {
+				return x509.SHA384WithRSAPSS
+			}
+			return x509.SHA384WithRSA
+		case crypto.SHA512:
+			if ArgRSAPSS {
+				return x509.SHA512WithRSAPSS
+			}
+			return x509.SHA512WithRSA
+		}
 		if ArgRSAPSS {
 			return x509.SHA256WithRSAPSS
 		}
 		return x509.SHA256WithRSA
 	case *ecdsa.PublicKey:
+		switch hash {
+		case crypto.SHA256:
+			return x509.ECDSAWithSHA256
+		case crypto.SHA384:
+			return x509.ECDSAWithSHA384
+		case crypto.SHA512:
+			return x509.ECDSAWithSHA512
+		}
 		switch k.Curve {
 		case elliptic.P256():
 			return x509.ECDSAWithSHA256
@@ -99,13 +122,18 @@ func SameKey(pub1, pub2 interface{}) bool {
 		return ok && key1.E == key2.E && key1.N.Cmp(key2.N) == 0
 	case *ecdsa.PublicKey:
 		key2, ok := pub2.(*ecdsa.PublicKey)
-		return ok && key1.X.Cmp(key2.X) == 0 && key1.Y.Cmp(key2.Y) == 0
+		return ok && key1.Curve.Params().Name == key2.Curve.Params().Name &&
+			key1.X.Cmp(key2.X) == 0 && key1.Y.Cmp(key2.Y) == 0
+	case ed25519.PublicKey:
+		key2, ok := pub2.(ed25519.PublicKey)
+		return ok && bytes.Equal(key1, key2)
 	default:
 		return false
 	}
 }
 
-// Verify an RSA or ECDSA signature
+// Verify an RSA, ECDSA or Ed25519 signature. Ed25519 signs the message itself,
+// so for those keys hashed is the whole message and hash is ignored.
 func Verify(pub interface{}, hash crypto.Hash, hashed []byte, sig []byte) error {
 	switch pubk := pub.(type) {
 	case *rsa.PublicKey:
@@ -119,6 +147,11 @@ func Verify(pub interface{}, hash crypto.Hash, hashed []byte, sig []byte) error
 			return errors.New("ECDSA verification failed")
 		}
 		return nil
+	case ed25519.PublicKey:
+		if !ed25519.Verify(pubk, hashed, sig) {
+			return errors.New("Ed25519 verification failed")
+		}
+		return nil
 	}
 	return errors.New("unsupported public key algorithm")
 }
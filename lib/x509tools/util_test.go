@@ -4,12 +4,15 @@ import (
 	"crypto/ecdsa"
 	"crypto/ed25519"
 	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"testing"
 
+	"github.com/sassoftware/relic/v7/internal/testcert"
 	"github.com/sassoftware/relic/v7/lib/x509tools"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestSignatureAlgorithm(t *testing.T) {
@@ -22,6 +25,28 @@ func TestSignatureAlgorithm(t *testing.T) {
 	assert.Equal(t, x509.ECDSAWithSHA256, x509tools.X509SignatureAlgorithm(&ecdsa.PublicKey{Curve: elliptic.P256()}))
 	assert.Equal(t, x509.ECDSAWithSHA384, x509tools.X509SignatureAlgorithm(&ecdsa.PublicKey{Curve: elliptic.P384()}))
 	assert.Equal(t, x509.ECDSAWithSHA512, x509tools.X509SignatureAlgorithm(&ecdsa.PublicKey{Curve: elliptic.P521()}))
+	x509tools.ArgSignatureDigest = "sha384"
+	assert.Equal(t, x509.SHA384WithRSA, x509tools.X509SignatureAlgorithm(&rsa.PublicKey{}))
+	assert.Equal(t, x509.ECDSAWithSHA384, x509tools.X509SignatureAlgorithm(&ecdsa.PublicKey{Curve: elliptic.P256()}))
+	x509tools.ArgSignatureDigest = ""
 
 	assert.Equal(t, x509.UnknownSignatureAlgorithm, x509tools.X509SignatureAlgorithm(ed25519.PublicKey{}))
 }
+
+func TestEd25519(t *testing.T) {
+	t.Parallel()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	cert := testcert.SelfSigned(t, "ed25519", priv)
+	assert.True(t, x509tools.SameKey(priv, cert.PublicKey))
+	assert.True(t, x509tools.SameKey(pub, cert.PublicKey))
+	_, other, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	assert.False(t, x509tools.SameKey(other, cert.PublicKey))
+	assert.False(t, x509tools.SameKey(testcert.ECDSAKey(t), cert.PublicKey))
+
+	msg := []byte("message")
+	sig := ed25519.Sign(priv, msg)
+	assert.NoError(t, x509tools.Verify(cert.PublicKey, 0, msg, sig))
+	assert.Error(t, x509tools.Verify(cert.PublicKey, 0, []byte("other"), sig))
+}
@@ -0,0 +1,192 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package x509tools
+
+import (
+	"crypto/elliptic"
+	"math/big"
+)
+
+// weierstrassCurve implements elliptic.Curve for short Weierstrass curves
+// y² = x³ + ax + b with an arbitrary a. The generic implementation in
+// crypto/elliptic assumes a = -3, which does not hold for the Brainpool "r1"
+// curves or secp256k1.
+//
+// The arithmetic uses big.Int and is not constant time, so these curves are
+// only offered through VerifyOnlyCurves for checking signatures.
+type weierstrassCurve struct {
+	params *elliptic.CurveParams
+	a      *big.Int
+}
+
+func newWeierstrassCurve(name string, bits int, p, a, b, gx, gy, n string) *weierstrassCurve {
+	return &weierstrassCurve{
+		params: &elliptic.CurveParams{
+			Name:    name,
+			BitSize: bits,
+			P:       hexInt(p),
+			N:       hexInt(n),
+			B:       hexInt(b),
+			Gx:      hexInt(gx),
+			Gy:      hexInt(gy),
+		},
+		a: hexInt(a),
+	}
+}
+
+func hexInt(s string) *big.Int {
+	v, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		panic("invalid curve parameter " + s)
+	}
+	return v
+}
+
+func (c *weierstrassCurve) Params() *elliptic.CurveParams {
+	return c.params
+}
+
+func (c *weierstrassCurve) IsOnCurve(x, y *big.Int) bool {
+	p := c.params.P
+	if x.Sign() < 0 || x.Cmp(p) >= 0 || y.Sign() < 0 || y.Cmp(p) >= 0 {
+		return false
+	}
+	// y² = x³ + ax + b
+	lhs := new(big.Int).Mul(y, y)
+	lhs.Mod(lhs, p)
+	rhs := new(big.Int).Mul(x, x)
+	rhs.Add(rhs, c.a)
+	rhs.Mul(rhs, x)
+	rhs.Add(rhs, c.params.B)
+	rhs.Mod(rhs, p)
+	return lhs.Cmp(rhs) == 0
+}
+
+// The point at infinity is represented as (0, 0), as in crypto/elliptic
+func isInfinity(x, y *big.Int) bool {
+	return x.Sign() == 0 && y.Sign() == 0
+}
+
+func (c *weierstrassCurve) Add(x1, y1, x2, y2 *big.Int) (*big.Int, *big.Int) {
+	switch {
+	case isInfinity(x1, y1):
+		return new(big.Int).Set(x2), new(big.Int).Set(y2)
+	case isInfinity(x2, y2):
+		return new(big.Int).Set(x1), new(big.Int).Set(y1)
+	case x1.Cmp(x2) == 0:
+		if y1.Cmp(y2) == 0 {
+			return c.Double(x1, y1)
+		}
+		// P + (-P)
+		return new(big.Int), new(big.Int)
+	}
+	p := c.params.P
+	// λ = (y2 - y1) / (x2 - x1)
+	num := new(big.Int).Sub(y2, y1)
+	den := new(big.Int).Sub(x2, x1)
+	den.Mod(den, p)
+	den.ModInverse(den, p)
+	lambda := num.Mul(num, den)
+	lambda.Mod(lambda, p)
+	return c.finish(lambda, x1, y1, x2)
+}
+
+func (c *weierstrassCurve) Double(x1, y1 *big.Int) (*big.Int, *big.Int) {
+	if isInfinity(x1, y1) || y1.Sign() == 0 {
+		return new(big.Int), new(big.Int)
+	}
+	p := c.params.P
+	// λ = (3x² + a) / 2y
+	num := new(big.Int).Mul(x1, x1)
+	num.Mul(num, big.NewInt(3))
+	num.Add(num, c.a)
+	den := new(big.Int).Lsh(y1, 1)
+	den.Mod(den, p)
+	den.ModInverse(den, p)
+	lambda := num.Mul(num, den)
+	lambda.Mod(lambda, p)
+	return c.finish(lambda, x1, y1, x1)
+}
+
+// x3 = λ² - x1 - x2, y3 = λ(x1 - x3) - y1
+func (c *weierstrassCurve) finish(lambda, x1, y1, x2 *big.Int) (*big.Int, *big.Int) {
+	p := c.params.P
+	x3 := new(big.Int).Mul(lambda, lambda)
+	x3.Sub(x3, x1)
+	x3.Sub(x3, x2)
+	x3.Mod(x3, p)
+	y3 := new(big.Int).Sub(x1, x3)
+	y3.Mul(y3, lambda)
+	y3.Sub(y3, y1)
+	y3.Mod(y3, p)
+	return x3, y3
+}
+
+func (c *weierstrassCurve) ScalarMult(bx, by *big.Int, k []byte) (*big.Int, *big.Int) {
+	// Montgomery ladder
+	r0x, r0y := new(big.Int), new(big.Int)
+	r1x, r1y := new(big.Int).Set(bx), new(big.Int).Set(by)
+	for _, b := range k {
+		for bit := 7; bit >= 0; bit-- {
+			if (b>>uint(bit))&1 == 0 {
+				r1x, r1y = c.Add(r0x, r0y, r1x, r1y)
+				r0x, r0y = c.Double(r0x, r0y)
+			} else {
+				r0x, r0y = c.Add(r0x, r0y, r1x, r1y)
+				r1x, r1y = c.Double(r1x, r1y)
+			}
+		}
+	}
+	return r0x, r0y
+}
+
+func (c *weierstrassCurve) ScalarBaseMult(k []byte) (*big.Int, *big.Int) {
+	return c.ScalarMult(c.params.Gx, c.params.Gy, k)
+}
+
+var (
+	curveBrainpoolP256r1 = newWeierstrassCurve("brainpoolP256r1", 256,
+		"A9FB57DBA1EEA9BC3E660A909D838D726E3BF623D52620282013481D1F6E5377",
+		"7D5A0975FC2C3057EEF67530417AFFE7FB8055C126DC5C6CE94A4B44F330B5D9",
+		"26DC5C6CE94A4B44F330B5D9BBD77CBF958416295CF7E1CE6BCCDC18FF8C07B6",
+		"8BD2AEB9CB7E57CB2C4B482FFC81B7AFB9DE27E1E3BD23C23A4453BD9ACE3262",
+		"547EF835C3DAC4FD97F8461A14611DC9C27745132DED8E545C1D54C72F046997",
+		"A9FB57DBA1EEA9BC3E660A909D838D718C397AA3B561A6F7901E0E82974856A7")
+	curveBrainpoolP384r1 = newWeierstrassCurve("brainpoolP384r1", 384,
+		"8CB91E82A3386D280F5D6F7E50E641DF152F7109ED5456B412B1DA197FB71123ACD3A729901D1A71874700133107EC53",
+		"7BC382C63D8C150C3C72080ACE05AFA0C2BEA28E4FB22787139165EFBA91F90F8AA5814A503AD4EB04A8C7DD22CE2826",
+		"04A8C7DD22CE28268B39B55416F0447C2FB77DE107DCD2A62E880EA53EEB62D57CB4390295DBC9943AB78696FA504C11",
+		"1D1C64F068CF45FFA2A63A81B7C13F6B8847A3E77EF14FE3DB7FCAFE0CBD10E8E826E03436D646AAEF87B2E247D4AF1E",
+		"8ABE1D7520F9C2A45CB1EB8E95CFD55262B70B29FEEC5864E19C054FF99129280E4646217791811142820341263C5315",
+		"8CB91E82A3386D280F5D6F7E50E641DF152F7109ED5456B31F166E6CAC0425A7CF3AB6AF6B7FC3103B883202E9046565")
+	curveSecp256k1 = newWeierstrassCurve("secp256k1", 256,
+		"FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEFFFFFC2F",
+		"0",
+		"7",
+		"79BE667EF9DCBBAC55A06295CE870B07029BFCDB2DCE28D959F2815B16F81798",
+		"483ADA7726A3C4655DA4FBFC0E1108A8FD17B448A68554199C47D08FFB10D4B8",
+		"FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEBAAEDCE6AF48A03BBFD25E8CD0364141")
+)
+
+// BrainpoolP256r1 returns the brainpoolP256r1 curve from RFC 5639
+func BrainpoolP256r1() elliptic.Curve { return curveBrainpoolP256r1 }
+
+// BrainpoolP384r1 returns the brainpoolP384r1 curve from RFC 5639
+func BrainpoolP384r1() elliptic.Curve { return curveBrainpoolP384r1 }
+
+// Secp256k1 returns the secp256k1 curve from SEC 2
+func Secp256k1() elliptic.Curve { return curveSecp256k1 }
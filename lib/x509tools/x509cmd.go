@@ -29,10 +29,8 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"math/big"
 	"os"
 	"strings"
-	"time"
 
 	"github.com/spf13/cobra"
 	"golang.org/x/term"
@@ -53,10 +51,29 @@ var (
 	ArgSerial             string
 	ArgInteractive        bool
 	ArgRSAPSS             bool
+	ArgURINames           string
+	ArgExtensions         []string
+	ArgCriticalExtensions []string
+	ArgSignatureDigest    string
+	ArgChallengePassword  string
+	ArgPathLength         int
+	ArgNotBefore          string
+	ArgNotAfter           string
+	ArgSerialStrategy     string
+	ArgSerialFile         string
+	ArgPermitNames        []string
+	ArgExcludeNames       []string
 )
 
 // Add flags associated with X509 requests to the given command
 func AddRequestFlags(cmd *cobra.Command) {
+	addNameFlags(cmd)
+	cmd.Flags().StringVar(&ArgChallengePassword, "challenge-password", "", "Add a challengePassword attribute to the request")
+}
+
+// Add flags for subject names, extensions and signature options shared by
+// requests and certificates
+func addNameFlags(cmd *cobra.Command) {
 	cmd.Flags().StringVar(&ArgCountry, "countryName", "", "Subject name")
 	cmd.Flags().StringVar(&ArgProvince, "stateOrProvinceName", "", "Subject name")
 	cmd.Flags().StringVar(&ArgLocality, "localityName", "", "Subject name")
@@ -65,17 +82,28 @@ func AddRequestFlags(cmd *cobra.Command) {
 	cmd.Flags().StringVarP(&ArgCommonName, "commonName", "n", "", "Subject commonName")
 	cmd.Flags().StringVar(&ArgDNSNames, "alternate-dns", "", "DNS subject alternate name (comma or space separated)")
 	cmd.Flags().StringVar(&ArgEmailNames, "alternate-email", "", "Email subject alternate name (comma or space separated)")
+	cmd.Flags().StringVar(&ArgURINames, "alternate-uri", "", "URI subject alternate name (comma or space separated)")
+	cmd.Flags().StringArrayVar(&ArgExtensions, "extension", nil, "Add an extension given as OID=DER, with the DER value in hex")
+	cmd.Flags().StringArrayVar(&ArgCriticalExtensions, "critical-extension", nil, "Add a critical extension given as OID=DER, with the DER value in hex")
 	cmd.Flags().BoolVarP(&ArgInteractive, "interactive", "i", false, "Prompt before signing certificate")
 	cmd.Flags().BoolVar(&ArgRSAPSS, "rsa-pss", false, "Use RSA-PSS signature")
+	cmd.Flags().StringVar(&ArgSignatureDigest, "signature-digest", "", "Digest algorithm for the signature: sha256 sha384 sha512 (default depends on key type)")
 }
 
 // Add flags associated with X509 certificate creation to the given command
 func AddCertFlags(cmd *cobra.Command) {
-	AddRequestFlags(cmd)
+	addNameFlags(cmd)
 	cmd.Flags().BoolVar(&ArgCertAuthority, "cert-authority", false, "If this certificate is an authority")
-	cmd.Flags().StringVarP(&ArgKeyUsage, "key-usage", "U", "", "Key usage, one of: serverAuth clientAuth codeSigning emailProtection keyCertSign")
+	cmd.Flags().IntVar(&ArgPathLength, "path-length", -1, "Maximum number of intermediate CAs below this authority")
+	cmd.Flags().StringVarP(&ArgKeyUsage, "key-usage", "U", "", "Key usages (comma or space separated): serverAuth clientAuth codeSigning lifetimeSigning timeStamping ocspSigning emailProtection keyCertSign")
 	cmd.Flags().UintVarP(&ArgExpireDays, "expire-days", "e", 36523, "Number of days before certificate expires")
+	cmd.Flags().StringVar(&ArgNotBefore, "not-before", "", "Start of the validity period in RFC 3339 format (default: 1 day ago)")
+	cmd.Flags().StringVar(&ArgNotAfter, "not-after", "", "End of the validity period in RFC 3339 format. Overrides --expire-days")
 	cmd.Flags().StringVar(&ArgSerial, "serial", "", "Set the serial number of the certificate. Random if not specified.")
+	cmd.Flags().StringVar(&ArgSerialStrategy, "serial-strategy", "random", "How to choose serial numbers if --serial is not set: random timestamp sequential")
+	cmd.Flags().StringVar(&ArgSerialFile, "serial-file", "", "File holding the last serial number issued, for --serial-strategy=sequential")
+	cmd.Flags().StringArrayVar(&ArgPermitNames, "permit", nil, "Add a permitted name constraint, e.g. dns:example.com email:example.com uri:.example.com ip:10.0.0.0/8")
+	cmd.Flags().StringArrayVar(&ArgExcludeNames, "exclude", nil, "Add an excluded name constraint, in the same form as --permit")
 }
 
 // Split a space- and/or comma-seperated string
@@ -116,46 +144,13 @@ func subjName() (name pkix.Name) {
 	return
 }
 
-// Set both basic and extended key usage
-func setUsage(template *x509.Certificate) error {
-	usage := x509.KeyUsageDigitalSignature
-	var extended []x509.ExtKeyUsage
-	switch strings.ToLower(ArgKeyUsage) {
-	case "serverauth":
-		usage |= x509.KeyUsageKeyEncipherment | x509.KeyUsageKeyAgreement
-		extended = append(extended, x509.ExtKeyUsageServerAuth)
-	case "clientauth":
-		usage |= x509.KeyUsageKeyEncipherment | x509.KeyUsageKeyAgreement
-		extended = append(extended, x509.ExtKeyUsageClientAuth)
-	case "codesigning":
-		extended = append(extended, x509.ExtKeyUsageCodeSigning)
-	case "emailprotection":
-		usage |= x509.KeyUsageContentCommitment | x509.KeyUsageKeyEncipherment | x509.KeyUsageKeyAgreement
-		extended = append(extended, x509.ExtKeyUsageEmailProtection)
-	case "keycertsign":
-		usage |= x509.KeyUsageCertSign | x509.KeyUsageCRLSign
-	case "":
-		return nil
-	default:
-		return errors.New("invalid key-usage")
-	}
-	template.KeyUsage = usage
-	template.ExtKeyUsage = extended
-	return nil
-}
-
 func fillCertFields(template *x509.Certificate, subjectPub, issuerPub crypto.PublicKey) error {
-	if ArgSerial != "" {
-		serial, ok := new(big.Int).SetString(ArgSerial, 0)
-		if !ok {
-			return errors.New("invalid serial number, must be decimal or hexadecimal format")
+	if ArgSerial != "" || template.SerialNumber == nil {
+		serial, err := makeSerialNumber()
+		if err != nil {
+			return err
 		}
 		template.SerialNumber = serial
-	} else if template.SerialNumber == nil {
-		template.SerialNumber = MakeSerial()
-		if template.SerialNumber == nil {
-			return errors.New("Failed to generate a serial number")
-		}
 	}
 	if ArgCommonName != "" {
 		template.Subject = subjName()
@@ -166,11 +161,33 @@ func fillCertFields(template *x509.Certificate, subjectPub, issuerPub crypto.Pub
 	if ArgEmailNames != "" {
 		template.EmailAddresses = splitAndTrim(ArgEmailNames)
 	}
+	if ArgURINames != "" {
+		uris, err := parseURIs(ArgURINames)
+		if err != nil {
+			return err
+		}
+		template.URIs = uris
+	}
+	exts, err := parseExtensionArgs()
+	if err != nil {
+		return err
+	}
+	template.ExtraExtensions = append(template.ExtraExtensions, exts...)
+	if err := checkSignatureDigest(); err != nil {
+		return err
+	}
 	template.SignatureAlgorithm = X509SignatureAlgorithm(issuerPub)
-	template.NotBefore = time.Now().Add(time.Hour * -24)
-	template.NotAfter = time.Now().Add(time.Hour * 24 * time.Duration(ArgExpireDays))
+	if err := setValidity(template); err != nil {
+		return err
+	}
 	template.IsCA = ArgCertAuthority
 	template.BasicConstraintsValid = true
+	if err := setPathLen(template); err != nil {
+		return err
+	}
+	if err := setNameConstraints(template); err != nil {
+		return err
+	}
 	ski, err := SubjectKeyID(subjectPub)
 	if err != nil {
 		return err
@@ -191,11 +208,29 @@ func MakeRequest(rand io.Reader, key crypto.Signer) (string, error) {
 	template.Subject = subjName()
 	template.DNSNames = splitAndTrim(ArgDNSNames)
 	template.EmailAddresses = splitAndTrim(ArgEmailNames)
+	uris, err := parseURIs(ArgURINames)
+	if err != nil {
+		return "", err
+	}
+	template.URIs = uris
+	template.ExtraExtensions, err = parseExtensionArgs()
+	if err != nil {
+		return "", err
+	}
+	if err := checkSignatureDigest(); err != nil {
+		return "", err
+	}
 	template.SignatureAlgorithm = X509SignatureAlgorithm(key.Public())
 	csr, err := x509.CreateCertificateRequest(rand, &template, key)
 	if err != nil {
 		return "", err
 	}
+	if ArgChallengePassword != "" {
+		csr, err = addChallengePassword(csr, rand, key, ArgChallengePassword)
+		if err != nil {
+			return "", err
+		}
+	}
 	return toPemString(csr, "CERTIFICATE REQUEST"), nil
 }
 
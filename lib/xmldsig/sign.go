@@ -43,6 +43,9 @@ type SignOptions struct {
 	IncludeX509 bool
 	// Add a KeyValue element with the public key
 	IncludeKeyValue bool
+	// Reference the signed element by its ID attribute instead of the whole
+	// document
+	ReferenceID string
 }
 
 func (s SignOptions) c14nNamespace() string {
@@ -70,69 +73,123 @@ func Sign(root, parent *etree.Element, hash crypto.Hash, privKey crypto.Signer,
 	if err != nil {
 		return err
 	}
+	uri := ""
+	if opts.ReferenceID != "" {
+		if FindByID(root, opts.ReferenceID) != root {
+			return errors.New("xmldsig: reference ID does not match the signed element")
+		}
+		uri = "#" + opts.ReferenceID
+	}
 	// build a signedinfo that references the enveloping document
 	signature := parent.CreateElement("Signature")
 	signature.CreateAttr("xmlns", NsXMLDsig)
-	signedinfo := buildSignedInfo(signature, "", hashAlg, sigAlg, refDigest, opts)
+	transforms := []string{AlgDsigEnvelopedSignature, opts.c14nNamespace()}
+	signedinfo := buildSignedInfo(signature, sigAlg, opts)
+	addReference(signedinfo, uri, "", transforms, hashAlg, refDigest)
 	return finishSignature(signature, signedinfo, hash, privKey, certs, opts)
 }
 
-// Build an enveloping Signature document around the given Object element
-func SignEnveloping(object *etree.Element, hash crypto.Hash, privKey crypto.Signer, certs []*x509.Certificate, opts SignOptions) (*etree.Element, error) {
+// Build a detached Signature over external content, which is identified by
+// the given URI
+func SignDetached(content []byte, uri string, hash crypto.Hash, privKey crypto.Signer, certs []*x509.Certificate, opts SignOptions) (*etree.Element, error) {
 	pubKey := privKey.Public()
 	if len(certs) < 1 || !x509tools.SameKey(pubKey, certs[0].PublicKey) {
 		return nil, errors.New("xmldsig: first certificate must match private key")
 	}
-	// insert the object into the signature element before canonicalizing so
-	// that the namespace gets pushed down properly
+	if uri == "" || uri[0] == '#' {
+		return nil, errors.New("xmldsig: detached signature requires an external URI")
+	}
+	hashAlg, sigAlg, err := hashAlgs(hash, pubKey, opts)
+	if err != nil {
+		return nil, err
+	}
+	d := hash.New()
+	d.Write(content)
 	signature := etree.NewElement("Signature")
 	signature.CreateAttr("xmlns", NsXMLDsig)
-	signature.AddChild(object)
-	refDigest, err := hashCanon(object, hash)
-	if err != nil {
+	signedinfo := buildSignedInfo(signature, sigAlg, opts)
+	addReference(signedinfo, uri, "", nil, hashAlg, d.Sum(nil))
+	if err := finishSignature(signature, signedinfo, hash, privKey, certs, opts); err != nil {
 		return nil, err
 	}
+	return signature, nil
+}
+
+// Build an enveloping Signature document around the given Object element
+func SignEnveloping(object *etree.Element, hash crypto.Hash, privKey crypto.Signer, certs []*x509.Certificate, opts SignOptions) (*etree.Element, error) {
+	return SignEnvelopingObjects([]*etree.Element{object}, hash, privKey, certs, opts)
+}
+
+// Build an enveloping Signature document around one or more Object elements,
+// with a reference to each one in the order given
+func SignEnvelopingObjects(objects []*etree.Element, hash crypto.Hash, privKey crypto.Signer, certs []*x509.Certificate, opts SignOptions) (*etree.Element, error) {
+	pubKey := privKey.Public()
+	if len(certs) < 1 || !x509tools.SameKey(pubKey, certs[0].PublicKey) {
+		return nil, errors.New("xmldsig: first certificate must match private key")
+	}
+	if len(objects) == 0 {
+		return nil, errors.New("xmldsig: no objects to sign")
+	}
 	hashAlg, sigAlg, err := hashAlgs(hash, pubKey, opts)
 	if err != nil {
 		return nil, err
 	}
-	if object.Tag != "Object" {
-		return nil, errors.New("object must have tag \"Object\"")
+	// insert the objects into the signature element before canonicalizing so
+	// that the namespace gets pushed down properly
+	signature := etree.NewElement("Signature")
+	signature.CreateAttr("xmlns", NsXMLDsig)
+	for _, object := range objects {
+		signature.AddChild(object)
 	}
-	refId := object.SelectAttrValue("Id", "")
-	if refId == "" {
-		return nil, errors.New("object lacks an Id attribute")
+	// build a signedinfo that references each enveloped object
+	signedinfo := buildSignedInfo(signature, sigAlg, opts)
+	for _, object := range objects {
+		if object.Tag != "Object" {
+			return nil, errors.New("object must have tag \"Object\"")
+		}
+		refId := object.SelectAttrValue("Id", "")
+		if refId == "" {
+			return nil, errors.New("object lacks an Id attribute")
+		}
+		refDigest, err := hashCanon(object, hash)
+		if err != nil {
+			return nil, err
+		}
+		addReference(signedinfo, "#"+refId, NsXMLDsig+"Object", []string{opts.c14nNamespace()}, hashAlg, refDigest)
 	}
-	// build a signedinfo that references the enveloping document
-	signedinfo := buildSignedInfo(signature, refId, hashAlg, sigAlg, refDigest, opts)
 	// canonicalize the signedinfo section and sign it
 	if err := finishSignature(signature, signedinfo, hash, privKey, certs, opts); err != nil {
 		return nil, err
 	}
-	signature.RemoveChild(object)
-	signature.AddChild(object)
+	// move the objects after the signature value and key info
+	for _, object := range objects {
+		signature.RemoveChild(object)
+		signature.AddChild(object)
+	}
 	return signature, nil
 }
 
-func buildSignedInfo(signature *etree.Element, refId, hashAlg, sigAlg string, refDigest []byte, opts SignOptions) *etree.Element {
+func buildSignedInfo(signature *etree.Element, sigAlg string, opts SignOptions) *etree.Element {
 	signedinfo := signature.CreateElement("SignedInfo")
 	signedinfo.CreateElement("CanonicalizationMethod").CreateAttr("Algorithm", opts.c14nNamespace())
 	signedinfo.CreateElement("SignatureMethod").CreateAttr("Algorithm", sigAlg)
+	return signedinfo
+}
+
+func addReference(signedinfo *etree.Element, uri, refType string, transforms []string, hashAlg string, refDigest []byte) {
 	reference := signedinfo.CreateElement("Reference")
-	if refId == "" {
-		reference.CreateAttr("URI", "")
-	} else {
-		reference.CreateAttr("URI", "#"+refId)
-		reference.CreateAttr("Type", NsXMLDsig+"Object")
+	reference.CreateAttr("URI", uri)
+	if refType != "" {
+		reference.CreateAttr("Type", refType)
 	}
-	transforms := reference.CreateElement("Transforms")
-	if refId == "" {
-		transforms.CreateElement("Transform").CreateAttr("Algorithm", AlgDsigEnvelopedSignature)
+	if len(transforms) != 0 {
+		transformsEl := reference.CreateElement("Transforms")
+		for _, alg := range transforms {
+			transformsEl.CreateElement("Transform").CreateAttr("Algorithm", alg)
+		}
 	}
-	transforms.CreateElement("Transform").CreateAttr("Algorithm", opts.c14nNamespace())
 	reference.CreateElement("DigestMethod").CreateAttr("Algorithm", hashAlg)
 	reference.CreateElement("DigestValue").SetText(base64.StdEncoding.EncodeToString(refDigest))
-	return signedinfo
 }
 
 func finishSignature(signature, signedinfo *etree.Element, hash crypto.Hash, privKey crypto.Signer, certs []*x509.Certificate, opts SignOptions) error {
@@ -179,6 +236,25 @@ func hashCanon(root *etree.Element, hash crypto.Hash) ([]byte, error) {
 	return d.Sum(nil), nil
 }
 
+// Find the element with an ID attribute matching the given value. The
+// attribute may be spelled Id, ID or id.
+func FindByID(root *etree.Element, id string) *etree.Element {
+	if id == "" {
+		return nil
+	}
+	for _, key := range []string{"Id", "ID", "id"} {
+		if root.SelectAttrValue(key, "") == id {
+			return root
+		}
+	}
+	for _, child := range root.ChildElements() {
+		if elem := FindByID(child, id); elem != nil {
+			return elem
+		}
+	}
+	return nil
+}
+
 // Remove all child elements with this tag from the element
 func RemoveElements(root *etree.Element, tag string) {
 	for i := 0; i < len(root.Child); {
@@ -54,13 +54,13 @@ var HashUris = map[crypto.Hash]string{
 type signature struct {
 	XMLName xml.Name `xml:"http://www.w3.org/2000/09/xmldsig# Signature"`
 
-	CanonicalizationMethod method    `xml:"SignedInfo>CanonicalizationMethod"`
-	SignatureMethod        method    `xml:"SignedInfo>SignatureMethod"`
-	Reference              reference `xml:"SignedInfo>Reference"`
-	SignatureValue         string    `xml:"SignatureValue"`
-	KeyName                string    `xml:"KeyInfo>KeyName,omitempty"`
-	KeyValue               *keyValue `xml:"KeyInfo>KeyValue,omitempty"`
-	X509Certificates       []string  `xml:"KeyInfo>X509Data>X509Certificate,omitempty"`
+	CanonicalizationMethod method      `xml:"SignedInfo>CanonicalizationMethod"`
+	SignatureMethod        method      `xml:"SignedInfo>SignatureMethod"`
+	References             []reference `xml:"SignedInfo>Reference"`
+	SignatureValue         string      `xml:"SignatureValue"`
+	KeyName                string      `xml:"KeyInfo>KeyName,omitempty"`
+	KeyValue               *keyValue   `xml:"KeyInfo>KeyValue,omitempty"`
+	X509Certificates       []string    `xml:"KeyInfo>X509Data>X509Certificate,omitempty"`
 }
 
 type reference struct {
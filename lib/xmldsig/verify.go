@@ -40,7 +40,13 @@ type Signature struct {
 	Certificates    []*x509.Certificate
 	Hash            crypto.Hash
 	EncryptedDigest []byte
-	Reference       *etree.Element
+	// URI of the reference, which is empty for the whole document
+	URI string
+	// Reference is the signed element, or nil for a detached signature
+	Reference *etree.Element
+	// References holds every signed element in the order they were
+	// referenced, starting with Reference
+	References []*etree.Element
 }
 
 func (s Signature) Leaf() *x509.Certificate {
@@ -54,6 +60,18 @@ func (s Signature) Leaf() *x509.Certificate {
 
 // Extract and verify an enveloped signature at the given root
 func Verify(root *etree.Element, sigpath string, extraCerts []*x509.Certificate) (*Signature, error) {
+	return verify(root, sigpath, nil, extraCerts)
+}
+
+// Extract and verify a detached signature over external content
+func VerifyDetached(root *etree.Element, sigpath string, content []byte, extraCerts []*x509.Certificate) (*Signature, error) {
+	if content == nil {
+		content = []byte{}
+	}
+	return verify(root, sigpath, content, extraCerts)
+}
+
+func verify(root *etree.Element, sigpath string, content []byte, extraCerts []*x509.Certificate) (*Signature, error) {
 	root = root.Copy()
 	sigs := root.FindElements(sigpath)
 	if len(sigs) == 0 {
@@ -75,7 +93,10 @@ func Verify(root *etree.Element, sigpath string, extraCerts []*x509.Certificate)
 	if sig.CanonicalizationMethod.Algorithm != AlgXMLExcC14n && sig.CanonicalizationMethod.Algorithm != AlgXMLExcC14nRec {
 		return nil, errors.New("xmldsig: unsupported canonicalization method")
 	}
-	hash, pubtype, err := parseAlgs(sig.Reference.DigestMethod.Algorithm, sig.SignatureMethod.Algorithm)
+	if len(sig.References) == 0 {
+		return nil, errors.New("xmldsig: invalid signature")
+	}
+	hash, pubtype, err := parseAlgs(sig.References[0].DigestMethod.Algorithm, sig.SignatureMethod.Algorithm)
 	if err != nil {
 		return nil, err
 	}
@@ -141,51 +162,98 @@ func Verify(root *etree.Element, sigpath string, extraCerts []*x509.Certificate)
 	if err != nil {
 		return nil, fmt.Errorf("xmldsig: %w", err)
 	}
-	// check reference digest
-	var reference *etree.Element
-	if sig.Reference.URI == "" {
-		// enveloped signature
-		if len(sig.Reference.Transforms) != 2 ||
-			sig.Reference.Transforms[0].Algorithm != AlgDsigEnvelopedSignature ||
-			(sig.Reference.Transforms[1].Algorithm != AlgXMLExcC14n && sig.Reference.Transforms[1].Algorithm != AlgXMLExcC14nRec) {
-			return nil, errors.New("xmldsig: unsupported reference transform")
+	// check reference digests
+	references := make([]*etree.Element, len(sig.References))
+	for i, ref := range sig.References {
+		if i > 0 && (ref.URI == "" || ref.URI[0] != '#') {
+			// only the first reference can cover the document or external content
+			return nil, errors.New("xmldsig: unsupported reference URI")
 		}
-		sigEl.Parent().RemoveChild(sigEl)
-		reference = root
-	} else {
-		// enveloping signature
-		if len(sig.Reference.Transforms) != 1 ||
-			(sig.Reference.Transforms[0].Algorithm != AlgXMLExcC14n && sig.Reference.Transforms[0].Algorithm != AlgXMLExcC14nRec) {
-			return nil, errors.New("xmldsig: unsupported reference transform")
+		_, refHash := HashAlgorithm(ref.DigestMethod.Algorithm)
+		if !refHash.Available() {
+			return nil, errors.New("xmldsig: unsupported digest algorithm")
 		}
-		if sig.Reference.URI[0] != '#' {
-			return nil, errors.New("xmldsig: unsupported reference URI")
+		reference, refCalc, err := digestReference(root, sigEl, ref, refHash, content)
+		if err != nil {
+			return nil, err
 		}
-		reference = root.FindElement(fmt.Sprintf("[@Id='%s']", sig.Reference.URI[1:]))
-	}
-	if reference == nil {
-		return nil, errors.New("xmldsig: unable to locate reference")
-	}
-	refCalc, err := hashCanon(reference, hash)
-	if err != nil {
-		return nil, err
-	}
-	refGiven, err := base64.StdEncoding.DecodeString(sig.Reference.DigestValue)
-	if len(refGiven) != len(refCalc) || err != nil {
-		return nil, errors.New("xmldsig: invalid signature")
-	}
-	if !hmac.Equal(refGiven, refCalc) {
-		return nil, fmt.Errorf("xmldsig: digest mismatch: calculated %x, found %x", refCalc, refGiven)
+		refGiven, err := base64.StdEncoding.DecodeString(ref.DigestValue)
+		if len(refGiven) != len(refCalc) || err != nil {
+			return nil, errors.New("xmldsig: invalid signature")
+		}
+		if !hmac.Equal(refGiven, refCalc) {
+			return nil, fmt.Errorf("xmldsig: digest mismatch: calculated %x, found %x", refCalc, refGiven)
+		}
+		references[i] = reference
 	}
 	return &Signature{
 		PublicKey:       pubkey,
 		Certificates:    certs,
 		Hash:            hash,
 		EncryptedDigest: sigv,
-		Reference:       reference,
+		URI:             sig.References[0].URI,
+		Reference:       references[0],
+		References:      references,
 	}, nil
 }
 
+// locate the referenced element, apply transforms and digest it
+func digestReference(root, sigEl *etree.Element, ref reference, hash crypto.Hash, content []byte) (*etree.Element, []byte, error) {
+	if ref.URI != "" && ref.URI[0] != '#' {
+		// detached signature over external content
+		if content == nil {
+			return nil, nil, errors.New("xmldsig: detached signature requires external content")
+		} else if len(ref.Transforms) != 0 {
+			return nil, nil, errors.New("xmldsig: unsupported reference transform")
+		}
+		d := hash.New()
+		d.Write(content)
+		return nil, d.Sum(nil), nil
+	}
+	transforms := ref.Transforms
+	enveloped := len(transforms) != 0 && transforms[0].Algorithm == AlgDsigEnvelopedSignature
+	if enveloped {
+		transforms = transforms[1:]
+	}
+	if len(transforms) != 1 ||
+		(transforms[0].Algorithm != AlgXMLExcC14n && transforms[0].Algorithm != AlgXMLExcC14nRec) {
+		return nil, nil, errors.New("xmldsig: unsupported reference transform")
+	}
+	if !enveloped && ref.URI == "" {
+		return nil, nil, errors.New("xmldsig: unsupported reference transform")
+	}
+	var reference *etree.Element
+	if ref.URI == "" {
+		reference = root
+	} else {
+		reference = FindByID(root, ref.URI[1:])
+	}
+	if reference == nil {
+		return nil, nil, errors.New("xmldsig: unable to locate reference")
+	}
+	if enveloped {
+		if !contains(reference, sigEl) {
+			return nil, nil, errors.New("xmldsig: enveloped signature is not inside the signed element")
+		}
+		sigEl.Parent().RemoveChild(sigEl)
+	}
+	refCalc, err := hashCanon(reference, hash)
+	if err != nil {
+		return nil, nil, err
+	}
+	return reference, refCalc, nil
+}
+
+// check if elem is a descendant of ancestor
+func contains(ancestor, elem *etree.Element) bool {
+	for p := elem.Parent(); p != nil; p = p.Parent() {
+		if p == ancestor {
+			return true
+		}
+	}
+	return false
+}
+
 func HashAlgorithm(hashAlg string) (string, crypto.Hash) {
 	for _, prefix := range nsPrefixes {
 		if strings.HasPrefix(hashAlg, prefix) {
@@ -245,7 +313,7 @@ func parseKey(kv *keyValue, pubtype string) (crypto.PublicKey, error) {
 		if !strings.HasPrefix(kv.NamedCurve.URN, "urn:oid:") {
 			return nil, errors.New("xmldsig: unsupported ECDSA curve")
 		}
-		curve, err := x509tools.CurveByOidString(kv.NamedCurve.URN[8:])
+		curve, err := x509tools.VerifyCurveByOidString(kv.NamedCurve.URN[8:])
 		if err != nil {
 			return nil, fmt.Errorf("xmldsig: %w", err)
 		}
@@ -0,0 +1,157 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package xmldsig_test
+
+import (
+	"crypto"
+	"crypto/x509"
+	"testing"
+
+	"github.com/beevik/etree"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sassoftware/relic/v7/internal/testcert"
+	"github.com/sassoftware/relic/v7/lib/xmldsig"
+	"github.com/sassoftware/relic/v7/signers/sigerrors"
+)
+
+const testMetadata = `<?xml version="1.0"?>
+<md:EntitiesDescriptor xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata" Name="federation">
+  <md:EntityDescriptor entityID="https://idp.example.com" ID="idp">
+    <md:IDPSSODescriptor protocolSupportEnumeration="urn:oasis:names:tc:SAML:2.0:protocol"/>
+  </md:EntityDescriptor>
+</md:EntitiesDescriptor>
+`
+
+func testKeys(t *testing.T) map[string]crypto.Signer {
+	return map[string]crypto.Signer{"rsa": testcert.RSAKey(t), "ecdsa": testcert.ECDSAKey(t)}
+}
+
+func testChain(t *testing.T, key crypto.Signer) []*x509.Certificate {
+	return []*x509.Certificate{testcert.SelfSigned(t, "xml signer", key)}
+}
+
+// serialize and reparse, so that verification starts from the bytes
+func roundTrip(t *testing.T, doc *etree.Document) *etree.Document {
+	blob, err := doc.WriteToBytes()
+	require.NoError(t, err)
+	doc = etree.NewDocument()
+	require.NoError(t, doc.ReadFromBytes(blob))
+	return doc
+}
+
+func TestEnveloped(t *testing.T) {
+	for name, key := range testKeys(t) {
+		t.Run(name, func(t *testing.T) {
+			certs := testChain(t, key)
+			doc := etree.NewDocument()
+			require.NoError(t, doc.ReadFromString(testMetadata))
+			_, err := xmldsig.Verify(doc.Root(), "//Signature", nil)
+			assert.ErrorAs(t, err, &sigerrors.NotSignedError{})
+
+			opts := xmldsig.SignOptions{IncludeX509: true}
+			require.NoError(t, xmldsig.Sign(doc.Root(), doc.Root(), crypto.SHA256, key, certs, opts))
+			doc = roundTrip(t, doc)
+			sig, err := xmldsig.Verify(doc.Root(), "//Signature", nil)
+			require.NoError(t, err)
+			assert.Equal(t, "", sig.URI)
+			assert.Equal(t, crypto.SHA256, sig.Hash)
+			assert.Equal(t, certs[0], sig.Leaf())
+
+			doc.Root().FindElement("//EntityDescriptor").CreateAttr("entityID", "https://evil.example.com")
+			_, err = xmldsig.Verify(doc.Root(), "//Signature", nil)
+			assert.ErrorContains(t, err, "digest mismatch")
+		})
+	}
+}
+
+func TestReferenceID(t *testing.T) {
+	key := testKeys(t)["ecdsa"]
+	certs := testChain(t, key)
+	doc := etree.NewDocument()
+	require.NoError(t, doc.ReadFromString(testMetadata))
+	entity := xmldsig.FindByID(doc.Root(), "idp")
+	require.NotNil(t, entity)
+	opts := xmldsig.SignOptions{IncludeKeyValue: true, ReferenceID: "idp"}
+	require.Error(t, xmldsig.Sign(doc.Root(), doc.Root(), crypto.SHA256, key, certs, opts))
+	require.NoError(t, xmldsig.Sign(entity, entity, crypto.SHA256, key, certs, opts))
+	doc = roundTrip(t, doc)
+	sig, err := xmldsig.Verify(doc.Root(), "//Signature", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "#idp", sig.URI)
+	assert.Equal(t, "EntityDescriptor", sig.Reference.Tag)
+
+	// changes outside of the signed element are not covered
+	doc.Root().CreateAttr("Name", "other")
+	_, err = xmldsig.Verify(doc.Root(), "//Signature", nil)
+	assert.NoError(t, err)
+	doc.Root().FindElement("//IDPSSODescriptor").CreateAttr("WantAuthnRequestsSigned", "true")
+	_, err = xmldsig.Verify(doc.Root(), "//Signature", nil)
+	assert.ErrorContains(t, err, "digest mismatch")
+}
+
+func TestDetached(t *testing.T) {
+	key := testKeys(t)["rsa"]
+	certs := testChain(t, key)
+	content := []byte("firmware image contents")
+	opts := xmldsig.SignOptions{IncludeX509: true}
+	_, err := xmldsig.SignDetached(content, "", crypto.SHA256, key, certs, opts)
+	require.Error(t, err)
+	sigEl, err := xmldsig.SignDetached(content, "firmware.bin", crypto.SHA256, key, certs, opts)
+	require.NoError(t, err)
+	doc := etree.NewDocument()
+	doc.SetRoot(sigEl)
+	doc = roundTrip(t, doc)
+
+	sig, err := xmldsig.VerifyDetached(doc.Root(), ".", content, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "firmware.bin", sig.URI)
+	assert.Nil(t, sig.Reference)
+	_, err = xmldsig.Verify(doc.Root(), ".", nil)
+	assert.Error(t, err)
+	_, err = xmldsig.VerifyDetached(doc.Root(), ".", []byte("something else"), nil)
+	assert.ErrorContains(t, err, "digest mismatch")
+}
+
+func TestEnvelopingObjects(t *testing.T) {
+	key := testKeys(t)["rsa"]
+	certs := testChain(t, key)
+	first := etree.NewElement("Object")
+	first.CreateAttr("Id", "idFirst")
+	first.CreateElement("Manifest").SetText("first")
+	second := etree.NewElement("Object")
+	second.CreateAttr("Id", "idSecond")
+	second.CreateElement("Details").SetText("second")
+	opts := xmldsig.SignOptions{IncludeX509: true}
+	sigEl, err := xmldsig.SignEnvelopingObjects([]*etree.Element{first, second}, crypto.SHA256, key, certs, opts)
+	require.NoError(t, err)
+	doc := etree.NewDocument()
+	doc.SetRoot(sigEl)
+	doc = roundTrip(t, doc)
+
+	sig, err := xmldsig.Verify(doc.Root(), ".", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "#idFirst", sig.URI)
+	require.Len(t, sig.References, 2)
+	assert.Equal(t, "idSecond", sig.References[1].SelectAttrValue("Id", ""))
+
+	// every object is covered, not just the first
+	doc.Root().FindElement("Object/Details").SetText("changed")
+	_, err = xmldsig.Verify(doc.Root(), ".", nil)
+	assert.ErrorContains(t, err, "digest mismatch")
+}
@@ -0,0 +1,239 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package xpi
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/sassoftware/relic/v7/lib/cbor"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+)
+
+// The COSE signature is a COSE_Sign structure with a detached payload, which
+// is the contents of cose.manifest. The body's protected header carries the
+// intermediate certificates and each signer's protected header carries its
+// leaf certificate, both under the "kid" label.
+
+const (
+	coseTagSign = 98
+	coseAlg     = int64(1)
+	coseKid     = int64(4)
+)
+
+type coseAlgorithm struct {
+	id    int64
+	hash  crypto.Hash
+	curve int
+}
+
+// algorithms Firefox accepts for add-on signatures
+var coseAlgorithms = []coseAlgorithm{
+	{-7, crypto.SHA256, 256},
+	{-35, crypto.SHA384, 384},
+	{-36, crypto.SHA512, 521},
+	{-37, crypto.SHA256, 0},
+}
+
+func coseAlgorithmFor(pub crypto.PublicKey) (coseAlgorithm, error) {
+	var curve int
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+	case *ecdsa.PublicKey:
+		curve = k.Curve.Params().BitSize
+	default:
+		return coseAlgorithm{}, fmt.Errorf("unsupported key type %T", pub)
+	}
+	for _, alg := range coseAlgorithms {
+		if alg.curve == curve {
+			return alg, nil
+		}
+	}
+	return coseAlgorithm{}, errors.New("unsupported ECDSA curve")
+}
+
+func coseSigStructure(bodyProtected, signProtected, payload []byte) ([]byte, error) {
+	return cbor.Marshal([]interface{}{"Signature", bodyProtected, signProtected, []byte{}, payload})
+}
+
+func signCOSE(signer crypto.Signer, chain []*x509.Certificate, payload []byte) ([]byte, error) {
+	alg, err := coseAlgorithmFor(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	intermediates := []interface{}{}
+	for _, cert := range chain[1:] {
+		intermediates = append(intermediates, cert.Raw)
+	}
+	bodyProtected, err := cbor.Marshal(map[interface{}]interface{}{coseKid: intermediates})
+	if err != nil {
+		return nil, err
+	}
+	signProtected, err := cbor.Marshal(map[interface{}]interface{}{coseAlg: alg.id, coseKid: chain[0].Raw})
+	if err != nil {
+		return nil, err
+	}
+	tbs, err := coseSigStructure(bodyProtected, signProtected, payload)
+	if err != nil {
+		return nil, err
+	}
+	d := alg.hash.New()
+	d.Write(tbs)
+	var sig []byte
+	if alg.curve == 0 {
+		sig, err = signer.Sign(rand.Reader, d.Sum(nil), &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: alg.hash})
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		der, err := signer.Sign(rand.Reader, d.Sum(nil), alg.hash)
+		if err != nil {
+			return nil, err
+		}
+		esig, err := x509tools.UnmarshalEcdsaSignature(der)
+		if err != nil {
+			return nil, err
+		}
+		size := (alg.curve + 7) / 8
+		sig = make([]byte, 2*size)
+		esig.R.FillBytes(sig[:size])
+		esig.S.FillBytes(sig[size:])
+	}
+	return cbor.Marshal(cbor.Tag{Number: coseTagSign, Content: []interface{}{
+		bodyProtected,
+		map[interface{}]interface{}{},
+		nil,
+		[]interface{}{[]interface{}{signProtected, map[interface{}]interface{}{}, sig}},
+	}})
+}
+
+// COSESignature is one verified signer of a COSE signature
+type COSESignature struct {
+	Certificate   *x509.Certificate
+	Intermediates []*x509.Certificate
+}
+
+func verifyCOSE(blob, payload []byte) ([]COSESignature, error) {
+	v, err := cbor.Unmarshal(blob)
+	if err != nil {
+		return nil, err
+	}
+	tag, ok := v.(cbor.Tag)
+	if !ok || tag.Number != coseTagSign {
+		return nil, errors.New("cose.sig is not a COSE_Sign structure")
+	}
+	arr, ok := tag.Content.([]interface{})
+	if !ok || len(arr) != 4 {
+		return nil, errors.New("malformed COSE_Sign structure")
+	}
+	bodyProtected, ok1 := arr[0].([]byte)
+	signatures, ok2 := arr[3].([]interface{})
+	if !ok1 || !ok2 || arr[2] != nil {
+		return nil, errors.New("malformed COSE_Sign structure")
+	}
+	var intermediates []*x509.Certificate
+	if hdr, err := decodeHeader(bodyProtected); err != nil {
+		return nil, err
+	} else if kid, ok := hdr[coseKid].([]interface{}); ok {
+		for _, der := range kid {
+			cert, err := parseCert(der)
+			if err != nil {
+				return nil, err
+			}
+			intermediates = append(intermediates, cert)
+		}
+	}
+	if len(signatures) == 0 {
+		return nil, errors.New("COSE_Sign has no signatures")
+	}
+	var sigs []COSESignature
+	for _, s := range signatures {
+		sarr, ok := s.([]interface{})
+		if !ok || len(sarr) != 3 {
+			return nil, errors.New("malformed COSE_Signature structure")
+		}
+		signProtected, ok1 := sarr[0].([]byte)
+		sig, ok2 := sarr[2].([]byte)
+		if !ok1 || !ok2 {
+			return nil, errors.New("malformed COSE_Signature structure")
+		}
+		hdr, err := decodeHeader(signProtected)
+		if err != nil {
+			return nil, err
+		}
+		cert, err := parseCert(hdr[coseKid])
+		if err != nil {
+			return nil, err
+		}
+		algID, _ := hdr[coseAlg].(int64)
+		alg, err := coseAlgorithmFor(cert.PublicKey)
+		if err != nil {
+			return nil, err
+		} else if alg.id != algID {
+			return nil, fmt.Errorf("COSE algorithm %d does not match the signing key", algID)
+		}
+		tbs, err := coseSigStructure(bodyProtected, signProtected, payload)
+		if err != nil {
+			return nil, err
+		}
+		d := alg.hash.New()
+		d.Write(tbs)
+		switch k := cert.PublicKey.(type) {
+		case *rsa.PublicKey:
+			err = rsa.VerifyPSS(k, alg.hash, d.Sum(nil), sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: alg.hash})
+		case *ecdsa.PublicKey:
+			size := (alg.curve + 7) / 8
+			if len(sig) != 2*size || !ecdsa.Verify(k, d.Sum(nil), new(big.Int).SetBytes(sig[:size]), new(big.Int).SetBytes(sig[size:])) {
+				err = errors.New("ECDSA verification failed")
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("COSE signature: %w", err)
+		}
+		sigs = append(sigs, COSESignature{Certificate: cert, Intermediates: intermediates})
+	}
+	return sigs, nil
+}
+
+func decodeHeader(blob []byte) (map[interface{}]interface{}, error) {
+	if len(blob) == 0 {
+		return nil, nil
+	}
+	v, err := cbor.Unmarshal(blob)
+	if err != nil {
+		return nil, err
+	}
+	hdr, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("COSE header is not a map")
+	}
+	return hdr, nil
+}
+
+func parseCert(v interface{}) (*x509.Certificate, error) {
+	der, ok := v.([]byte)
+	if !ok {
+		return nil, errors.New("COSE kid is not a certificate")
+	}
+	return x509.ParseCertificate(der)
+}
@@ -0,0 +1,168 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package xpi implements the signatures Firefox requires on add-ons: a JAR
+// style PKCS#7 signature in META-INF/mozilla.rsa, and a COSE signature in
+// META-INF/cose.sig over a manifest of the same files.
+package xpi
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/sassoftware/relic/v7/lib/signjar"
+)
+
+const (
+	metaInf          = "META-INF/"
+	ManifestName     = metaInf + "manifest.mf"
+	SigFileName      = metaInf + "mozilla.sf"
+	PKCS7Name        = metaInf + "mozilla.rsa"
+	COSEManifestName = metaInf + "cose.manifest"
+	COSESigName      = metaInf + "cose.sig"
+)
+
+// IsSignatureFile returns true for files that hold a signature and so are not
+// themselves listed in a manifest
+func IsSignatureFile(name string) bool {
+	dir, base := path.Split(strings.ToLower(name))
+	if dir != strings.ToLower(metaInf) {
+		return false
+	}
+	switch base {
+	case "manifest.mf", "cose.manifest", "cose.sig":
+		return true
+	}
+	switch path.Ext(base) {
+	case ".sf", ".rsa", ".dsa", ".ec":
+		return true
+	}
+	return false
+}
+
+type fileDigest struct {
+	name         string
+	sha1, sha256 []byte
+}
+
+func digestFile(name string, r io.Reader) (fileDigest, error) {
+	d1 := sha1.New()
+	d256 := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(d1, d256), r); err != nil {
+		return fileDigest{}, err
+	}
+	return fileDigest{name: name, sha1: d1.Sum(nil), sha256: d256.Sum(nil)}, nil
+}
+
+func digestBytes(name string, contents []byte) fileDigest {
+	fd, _ := digestFile(name, bytes.NewReader(contents))
+	return fd
+}
+
+// write a manifest listing the given files. The PKCS#7 manifest lists both
+// SHA-1 and SHA-256 digests, and the COSE manifest only SHA-256.
+func writeManifest(files []fileDigest, withSHA1 bool) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("Manifest-Version: 1.0\n\n")
+	for _, f := range files {
+		fmt.Fprintf(&buf, "Name: %s\n", f.name)
+		if withSHA1 {
+			buf.WriteString("Digest-Algorithms: SHA1 SHA256\n")
+			fmt.Fprintf(&buf, "SHA1-Digest: %s\n", base64.StdEncoding.EncodeToString(f.sha1))
+		} else {
+			buf.WriteString("Digest-Algorithms: SHA256\n")
+		}
+		fmt.Fprintf(&buf, "SHA256-Digest: %s\n\n", base64.StdEncoding.EncodeToString(f.sha256))
+	}
+	return buf.Bytes()
+}
+
+// write the signature file covering the PKCS#7 manifest
+func writeSigFile(manifest []byte) []byte {
+	d1 := sha1.Sum(manifest)
+	d256 := sha256.Sum256(manifest)
+	return []byte(fmt.Sprintf("Signature-Version: 1.0\nSHA1-Digest-Manifest: %s\nSHA256-Digest-Manifest: %s\n\n",
+		base64.StdEncoding.EncodeToString(d1[:]),
+		base64.StdEncoding.EncodeToString(d256[:]),
+	))
+}
+
+// check that a manifest lists every file in the archive except for ignored
+// ones, and optionally that the digests match
+func checkManifest(inz *zip.Reader, manifest []byte, ignore func(string) bool, skipDigests bool) error {
+	parsed, err := signjar.ParseManifest(manifest)
+	if err != nil {
+		return err
+	}
+	listed := make(map[string]bool, len(parsed.Files))
+	for _, f := range inz.File {
+		if strings.HasSuffix(f.Name, "/") || ignore(f.Name) {
+			continue
+		}
+		entry := parsed.Files[f.Name]
+		if entry == nil {
+			return fmt.Errorf("file %s is not in the manifest", f.Name)
+		}
+		listed[f.Name] = true
+		if skipDigests {
+			continue
+		}
+		r, err := f.Open()
+		if err != nil {
+			return err
+		}
+		fd, err := digestFile(f.Name, r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+		var checked bool
+		for _, h := range []struct {
+			hash   crypto.Hash
+			key    string
+			digest []byte
+		}{
+			{crypto.SHA1, "SHA1-Digest", fd.sha1},
+			{crypto.SHA256, "SHA256-Digest", fd.sha256},
+		} {
+			expected := entry.Get(h.key)
+			if expected == "" {
+				continue
+			}
+			if calculated := base64.StdEncoding.EncodeToString(h.digest); calculated != expected {
+				return fmt.Errorf("file %s: %s mismatch: manifest %s != calculated %s", f.Name, h.key, expected, calculated)
+			}
+			checked = true
+		}
+		if !checked {
+			return fmt.Errorf("file %s: no recognized digests in manifest", f.Name)
+		}
+	}
+	for _, name := range parsed.Order {
+		if !listed[name] {
+			return fmt.Errorf("file %s is in the manifest but not the archive", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package xpi
+
+import (
+	"context"
+	"crypto"
+	"encoding/asn1"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/sassoftware/relic/v7/lib/binpatch"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/pkcs7"
+	"github.com/sassoftware/relic/v7/lib/pkcs9"
+	"github.com/sassoftware/relic/v7/lib/zipslicer"
+)
+
+type XPIDigest struct {
+	// ID is the add-on ID from manifest.json, if it has one
+	ID    string
+	inz   *zipslicer.Directory
+	files []fileDigest
+}
+
+// DigestStream reads an add-on in the tar-wrapped form produced by
+// zipslicer and digests every file in it
+func DigestStream(r io.Reader) (*XPIDigest, error) {
+	inz, err := zipslicer.ReadZipTar(r)
+	if err != nil {
+		return nil, err
+	}
+	return Digest(inz)
+}
+
+// Digest every file in an add-on except for existing signatures
+func Digest(inz *zipslicer.Directory) (*XPIDigest, error) {
+	d := &XPIDigest{inz: inz}
+	for _, f := range inz.File {
+		if err := d.addFile(f); err != nil {
+			return nil, err
+		}
+		// Ensure we get a copy of the zip metadata even if the file isn't
+		// digested, because if we're reading from a stream we can't go back
+		// and get it later.
+		if _, err := f.GetDataDescriptor(); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+func (d *XPIDigest) addFile(f *zipslicer.File) error {
+	if strings.HasSuffix(f.Name, "/") || IsSignatureFile(f.Name) {
+		return nil
+	}
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	var fd fileDigest
+	if f.Name == "manifest.json" {
+		var blob []byte
+		blob, err = ioutil.ReadAll(r)
+		if err == nil {
+			d.ID = addonID(blob)
+			fd = digestBytes(f.Name, blob)
+		}
+	} else {
+		fd, err = digestFile(f.Name, r)
+	}
+	r.Close()
+	if err != nil {
+		return err
+	}
+	d.files = append(d.files, fd)
+	return nil
+}
+
+// find the add-on ID in a WebExtension manifest
+func addonID(blob []byte) string {
+	var manifest struct {
+		BrowserSpecificSettings struct {
+			Gecko struct {
+				ID string `json:"id"`
+			} `json:"gecko"`
+		} `json:"browser_specific_settings"`
+		Applications struct {
+			Gecko struct {
+				ID string `json:"id"`
+			} `json:"gecko"`
+		} `json:"applications"`
+	}
+	if json.Unmarshal(blob, &manifest) != nil {
+		return ""
+	}
+	if id := manifest.BrowserSpecificSettings.Gecko.ID; id != "" {
+		return id
+	}
+	return manifest.Applications.Gecko.ID
+}
+
+// Sign the add-on with both a COSE and a PKCS#7 signature, replacing any
+// existing ones. The COSE manifest lists the contents of the add-on, and the
+// PKCS#7 manifest additionally lists the COSE signature files.
+func (d *XPIDigest) Sign(ctx context.Context, cert *certloader.Certificate, hash crypto.Hash) (*binpatch.PatchSet, *pkcs9.TimestampedSignature, error) {
+	coseManifest := writeManifest(d.files, false)
+	coseSig, err := signCOSE(cert.Signer(), cert.Chain(), coseManifest)
+	if err != nil {
+		return nil, nil, err
+	}
+	files := append(d.files[:len(d.files):len(d.files)],
+		digestBytes(COSEManifestName, coseManifest),
+		digestBytes(COSESigName, coseSig),
+	)
+	manifest := writeManifest(files, true)
+	sf := writeSigFile(manifest)
+	builder := pkcs7.NewBuilder(cert.Signer(), cert.Chain(), hash)
+	if err := builder.SetContentData(sf); err != nil {
+		return nil, nil, err
+	}
+	psd, err := builder.Sign()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := cert.AttachRevocationInfo(psd); err != nil {
+		return nil, nil, err
+	}
+	ts, err := pkcs9.TimestampAndMarshal(ctx, psd, cert.Timestamper, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := psd.Detach(); err != nil {
+		return nil, nil, err
+	}
+	pkcs, err := asn1.Marshal(*psd)
+	if err != nil {
+		return nil, nil, err
+	}
+	// replace the old signatures
+	m, err := d.inz.Mangle(func(f *zipslicer.MangleFile) error {
+		if IsSignatureFile(f.Name) {
+			f.Delete()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, f := range []struct {
+		name     string
+		contents []byte
+	}{
+		{COSEManifestName, coseManifest},
+		{COSESigName, coseSig},
+		{ManifestName, manifest},
+		{SigFileName, sf},
+		{PKCS7Name, pkcs},
+	} {
+		if err := m.NewFile(f.name, f.contents); err != nil {
+			return nil, nil, err
+		}
+	}
+	patch, err := m.MakePatch(false)
+	if err != nil {
+		return nil, nil, err
+	}
+	return patch, ts, nil
+}
@@ -0,0 +1,98 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package xpi
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/sassoftware/relic/v7/lib/signjar"
+	"github.com/sassoftware/relic/v7/signers/sigerrors"
+)
+
+type XPISignature struct {
+	PKCS7 *signjar.JarSignature
+	// COSE is empty for add-ons signed before Firefox supported COSE
+	COSE []COSESignature
+}
+
+// Verify the PKCS#7 signature and, if present, the COSE signature on an
+// add-on. Like Firefox, every file must be listed in both manifests.
+func Verify(inz *zip.Reader, skipDigests bool) (*XPISignature, error) {
+	jarSigs, err := signjar.Verify(inz, skipDigests)
+	if err != nil {
+		if _, ok := err.(sigerrors.NotSignedError); ok {
+			return nil, sigerrors.NotSignedError{Type: "XPI"}
+		}
+		return nil, err
+	} else if len(jarSigs) != 1 {
+		return nil, errors.New("add-on must have exactly one PKCS#7 signature")
+	}
+	sig := &XPISignature{PKCS7: jarSigs[0]}
+	var manifest, coseManifest, coseSig []byte
+	for _, f := range inz.File {
+		var dest *[]byte
+		switch {
+		case strings.EqualFold(f.Name, ManifestName):
+			dest = &manifest
+		case f.Name == COSEManifestName:
+			dest = &coseManifest
+		case f.Name == COSESigName:
+			dest = &coseSig
+		default:
+			continue
+		}
+		r, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		*dest, err = ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	isPKCS7File := func(name string) bool {
+		return IsSignatureFile(name) && !isCOSEFile(name)
+	}
+	if err := checkManifest(inz, manifest, isPKCS7File, true); err != nil {
+		return nil, fmt.Errorf("%s: %w", ManifestName, err)
+	}
+	if coseSig == nil {
+		if coseManifest != nil {
+			return nil, fmt.Errorf("add-on has %s but no %s", COSEManifestName, COSESigName)
+		}
+		return sig, nil
+	} else if coseManifest == nil {
+		return nil, fmt.Errorf("add-on has %s but no %s", COSESigName, COSEManifestName)
+	}
+	sig.COSE, err = verifyCOSE(coseSig, coseManifest)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkManifest(inz, coseManifest, IsSignatureFile, skipDigests); err != nil {
+		return nil, fmt.Errorf("%s: %w", COSEManifestName, err)
+	}
+	return sig, nil
+}
+
+func isCOSEFile(name string) bool {
+	return name == COSEManifestName || name == COSESigName
+}
@@ -0,0 +1,136 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package xpi_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sassoftware/relic/v7/internal/testcert"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/xpi"
+	"github.com/sassoftware/relic/v7/lib/zipslicer"
+)
+
+func testCert(t *testing.T, key crypto.Signer) *certloader.Certificate {
+	return testcert.Signer(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "test@example.com"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}, key)
+}
+
+func writeAddon(t *testing.T) string {
+	fp := filepath.Join(t.TempDir(), "addon.xpi")
+	f, err := os.Create(fp)
+	require.NoError(t, err)
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for _, file := range []struct{ name, contents string }{
+		{"manifest.json", `{"manifest_version": 2, "name": "test", "version": "1.0", "browser_specific_settings": {"gecko": {"id": "test@example.com"}}}`},
+		{"icons/", ""},
+		{"background.js", "console.log('hello')"},
+	} {
+		w, err := zw.Create(file.name)
+		require.NoError(t, err)
+		_, err = io.WriteString(w, file.contents)
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	return fp
+}
+
+func signAddon(t *testing.T, fp string, cert *certloader.Certificate) *xpi.XPIDigest {
+	f, err := os.OpenFile(fp, os.O_RDWR, 0)
+	require.NoError(t, err)
+	defer f.Close()
+	var stream bytes.Buffer
+	require.NoError(t, zipslicer.ZipToTar(f, &stream))
+	digest, err := xpi.DigestStream(&stream)
+	require.NoError(t, err)
+	patch, _, err := digest.Sign(context.Background(), cert, crypto.SHA256)
+	require.NoError(t, err)
+	require.NoError(t, patch.Apply(f, fp))
+	return digest
+}
+
+func verifyAddon(t *testing.T, fp string) (*xpi.XPISignature, error) {
+	blob, err := os.ReadFile(fp)
+	require.NoError(t, err)
+	inz, err := zip.NewReader(bytes.NewReader(blob), int64(len(blob)))
+	require.NoError(t, err)
+	return xpi.Verify(inz, false)
+}
+
+func TestSignVerify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+	for _, key := range []crypto.Signer{rsaKey, ecKey} {
+		cert := testCert(t, key)
+		fp := writeAddon(t)
+		_, err := verifyAddon(t, fp)
+		assert.Error(t, err)
+
+		digest := signAddon(t, fp, cert)
+		assert.Equal(t, "test@example.com", digest.ID)
+		sig, err := verifyAddon(t, fp)
+		require.NoError(t, err)
+		assert.Equal(t, cert.Leaf.Raw, sig.PKCS7.Certificate.Raw)
+		require.Len(t, sig.COSE, 1)
+		assert.Equal(t, cert.Leaf.Raw, sig.COSE[0].Certificate.Raw)
+
+		// re-signing replaces the old signatures
+		signAddon(t, fp, cert)
+		zr, err := zip.OpenReader(fp)
+		require.NoError(t, err)
+		var names []string
+		for _, f := range zr.File {
+			names = append(names, f.Name)
+		}
+		zr.Close()
+		assert.Equal(t, []string{"manifest.json", "icons/", "background.js",
+			xpi.COSEManifestName, xpi.COSESigName, xpi.ManifestName, xpi.SigFileName, xpi.PKCS7Name}, names)
+		_, err = verifyAddon(t, fp)
+		require.NoError(t, err)
+
+		// tamper with a file
+		blob, err := os.ReadFile(fp)
+		require.NoError(t, err)
+		idx := bytes.Index(blob, []byte("hello"))
+		require.True(t, idx >= 0)
+		blob[idx] = 'j'
+		require.NoError(t, os.WriteFile(fp, blob, 0644))
+		_, err = verifyAddon(t, fp)
+		assert.Error(t, err)
+	}
+}
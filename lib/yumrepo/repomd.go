@@ -0,0 +1,228 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package yumrepo reads Yum/DNF repository metadata so it can be checked
+// against the files in the repository before repomd.xml is signed.
+package yumrepo
+
+import (
+	"compress/bzip2"
+	"compress/gzip"
+	"crypto"
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/xi2/xz"
+)
+
+// Repo is a repository rooted at Dir, whose metadata is in Dir/repodata
+type Repo struct {
+	Dir  string
+	Data []Data
+}
+
+// Data is one metadata file listed in repomd.xml
+type Data struct {
+	Type     string   `xml:"type,attr"`
+	Checksum Checksum `xml:"checksum"`
+	Location Location `xml:"location"`
+	Size     int64    `xml:"size"`
+}
+
+type Checksum struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type Location struct {
+	Href string `xml:"href,attr"`
+}
+
+// Package is one package listed in the primary metadata
+type Package struct {
+	Name     string   `xml:"name"`
+	Checksum Checksum `xml:"checksum"`
+	Location Location `xml:"location"`
+	Size     struct {
+		Package int64 `xml:"package,attr"`
+	} `xml:"size"`
+}
+
+type repomd struct {
+	Data []Data `xml:"data"`
+}
+
+var checksumTypes = map[string]crypto.Hash{
+	"sha":    crypto.SHA1,
+	"sha1":   crypto.SHA1,
+	"sha224": crypto.SHA224,
+	"sha256": crypto.SHA256,
+	"sha384": crypto.SHA384,
+	"sha512": crypto.SHA512,
+}
+
+// Parse the contents of repomd.xml for the repository rooted at dir
+func Parse(dir string, blob []byte) (*Repo, error) {
+	var md repomd
+	if err := xml.Unmarshal(blob, &md); err != nil {
+		return nil, fmt.Errorf("parsing repomd.xml: %w", err)
+	}
+	if len(md.Data) == 0 {
+		return nil, errors.New("repomd.xml does not list any metadata")
+	}
+	return &Repo{Dir: dir, Data: md.Data}, nil
+}
+
+// Open the repository whose repomd.xml is at the given path
+func Open(repomdPath string) (*Repo, error) {
+	blob, err := os.ReadFile(repomdPath)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(filepath.Dir(filepath.Dir(repomdPath)), blob)
+}
+
+func (r *Repo) path(href string) string {
+	return filepath.Join(r.Dir, filepath.FromSlash(path.Clean("/"+href)))
+}
+
+// CheckMetadata checks that each metadata file matches the checksum and size
+// listed in repomd.xml
+func (r *Repo) CheckMetadata() error {
+	for _, d := range r.Data {
+		if err := checkFile(r.path(d.Location.Href), d.Checksum, d.Size); err != nil {
+			return fmt.Errorf("%s metadata: %w", d.Type, err)
+		}
+	}
+	return nil
+}
+
+// Packages returns the packages listed in the primary metadata
+func (r *Repo) Packages() ([]*Package, error) {
+	var primary *Data
+	for i, d := range r.Data {
+		if d.Type == "primary" {
+			primary = &r.Data[i]
+		}
+	}
+	if primary == nil {
+		return nil, errors.New("repomd.xml has no primary metadata")
+	}
+	f, err := os.Open(r.path(primary.Location.Href))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	zr, err := decompress(f, primary.Location.Href)
+	if err != nil {
+		return nil, err
+	}
+	if c, ok := zr.(io.Closer); ok {
+		defer c.Close()
+	}
+	var pkgs []*Package
+	dec := xml.NewDecoder(zr)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("parsing primary metadata: %w", err)
+		}
+		if start, ok := tok.(xml.StartElement); ok && start.Name.Local == "package" {
+			pkg := new(Package)
+			if err := dec.DecodeElement(pkg, &start); err != nil {
+				return nil, fmt.Errorf("parsing primary metadata: %w", err)
+			}
+			pkgs = append(pkgs, pkg)
+		}
+	}
+	return pkgs, nil
+}
+
+// PackagePath returns the local path to a package
+func (r *Repo) PackagePath(pkg *Package) string {
+	return r.path(pkg.Location.Href)
+}
+
+// CheckPackages checks that every package matches the checksum and size
+// listed in the primary metadata
+func (r *Repo) CheckPackages() error {
+	pkgs, err := r.Packages()
+	if err != nil {
+		return err
+	}
+	for _, pkg := range pkgs {
+		if err := checkFile(r.PackagePath(pkg), pkg.Checksum, pkg.Size.Package); err != nil {
+			return fmt.Errorf("package %s: %w", pkg.Location.Href, err)
+		}
+	}
+	return nil
+}
+
+func checkFile(fp string, sum Checksum, size int64) error {
+	hash, ok := checksumTypes[sum.Type]
+	if !ok || !hash.Available() {
+		return fmt.Errorf("unsupported checksum type %q", sum.Type)
+	}
+	f, err := os.Open(fp)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	d := hash.New()
+	n, err := io.Copy(d, f)
+	if err != nil {
+		return err
+	}
+	if size != 0 && n != size {
+		return fmt.Errorf("size is %d but metadata says %d", n, size)
+	}
+	if hex.EncodeToString(d.Sum(nil)) != strings.ToLower(strings.TrimSpace(sum.Value)) {
+		return errors.New("checksum does not match metadata")
+	}
+	return nil
+}
+
+func decompress(r io.Reader, name string) (io.Reader, error) {
+	switch path.Ext(name) {
+	case ".gz":
+		return gzip.NewReader(r)
+	case ".bz2":
+		return bzip2.NewReader(r), nil
+	case ".xz":
+		return xz.NewReader(r, 0)
+	case ".zst":
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	default:
+		return r, nil
+	}
+}
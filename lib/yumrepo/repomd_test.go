@@ -0,0 +1,71 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package yumrepo_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sassoftware/relic/v7/lib/yumrepo"
+)
+
+func TestCheckRepo(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "repodata"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "Packages"), 0755))
+	pkg := []byte("not really an rpm")
+	pkgPath := filepath.Join(dir, "Packages", "foo-1.0-1.noarch.rpm")
+	require.NoError(t, os.WriteFile(pkgPath, pkg, 0644))
+	primary := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<metadata xmlns="http://linux.duke.edu/metadata/common" packages="1">
+<package type="rpm"><name>foo</name><checksum type="sha256" pkgid="YES">%x</checksum>
+<location href="Packages/foo-1.0-1.noarch.rpm"/><size package="%d" installed="0" archive="0"/></package>
+</metadata>`, sha256.Sum256(pkg), len(pkg))
+	var zbuf bytes.Buffer
+	zw := gzip.NewWriter(&zbuf)
+	_, _ = zw.Write([]byte(primary))
+	require.NoError(t, zw.Close())
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "repodata", "primary.xml.gz"), zbuf.Bytes(), 0644))
+	repomd := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<repomd xmlns="http://linux.duke.edu/metadata/repo">
+<data type="primary"><checksum type="sha256">%x</checksum><location href="repodata/primary.xml.gz"/><size>%d</size></data>
+</repomd>`, sha256.Sum256(zbuf.Bytes()), zbuf.Len())
+	repomdPath := filepath.Join(dir, "repodata", "repomd.xml")
+	require.NoError(t, os.WriteFile(repomdPath, []byte(repomd), 0644))
+
+	repo, err := yumrepo.Open(repomdPath)
+	require.NoError(t, err)
+	assert.NoError(t, repo.CheckMetadata())
+	pkgs, err := repo.Packages()
+	require.NoError(t, err)
+	require.Len(t, pkgs, 1)
+	assert.Equal(t, "foo", pkgs[0].Name)
+	assert.Equal(t, pkgPath, repo.PackagePath(pkgs[0]))
+	assert.NoError(t, repo.CheckPackages())
+	// a re-signed package no longer matches
+	require.NoError(t, os.WriteFile(pkgPath, append(pkg, '!'), 0644))
+	assert.Error(t, repo.CheckPackages())
+}
@@ -400,3 +400,21 @@ func (d *Directory) NextFileOffset() (int64, error) {
 	}
 	return int64(lastFile.Offset) + size, nil
 }
+
+// Return the non-zip data between the last file and the central directory,
+// such as an APK signing block. When reading from a stream, all files must
+// have been read first.
+func (d *Directory) GetTrailer() ([]byte, error) {
+	start, err := d.NextFileOffset()
+	if err != nil {
+		return nil, err
+	}
+	blob := make([]byte, d.DirLoc-start)
+	if len(blob) == 0 {
+		return nil, nil
+	}
+	if _, err := d.r.ReadAt(blob, start); err != nil {
+		return nil, err
+	}
+	return blob, nil
+}
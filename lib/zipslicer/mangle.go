@@ -18,6 +18,7 @@ package zipslicer
 
 import (
 	"bytes"
+	"io"
 	"time"
 
 	"github.com/sassoftware/relic/v7/lib/binpatch"
@@ -28,6 +29,9 @@ type Mangler struct {
 	patch         *binpatch.PatchSet
 	newcontents   bytes.Buffer
 	indir, insize int64
+	// start of any non-zip data before the directory, and whether to drop it
+	trailer     int64
+	dropTrailer bool
 }
 
 type MangleFunc func(*MangleFile) error
@@ -48,11 +52,12 @@ func (d *Directory) Mangle(callback MangleFunc) (*Mangler, error) {
 		if err := callback(mf); err != nil {
 			return nil, err
 		}
+		size, err := mf.GetTotalSize()
+		if err != nil {
+			return nil, err
+		}
+		m.trailer = int64(mf.Offset) + size
 		if mf.deleted {
-			size, err := mf.GetTotalSize()
-			if err != nil {
-				return nil, err
-			}
 			m.patch.Add(int64(mf.Offset), size, nil)
 		} else {
 			if _, err := m.outz.AddFile(&mf.File); err != nil {
@@ -70,13 +75,35 @@ func (m *Mangler) NewFile(name string, contents []byte) error {
 	return err
 }
 
+// Add a new uncompressed file without a data descriptor
+func (m *Mangler) NewStoredFile(name string, contents []byte, mtime time.Time) error {
+	_, err := m.outz.NewFile(name, nil, contents, &m.newcontents, mtime, false, false)
+	return err
+}
+
+// Write the central directory and end-of-directory for the files kept or added
+// so far, as they would appear if no more files were added
+func (m *Mangler) WriteDirectory(w io.Writer, forceZip64 bool) error {
+	return m.outz.WriteDirectory(w, w, forceZip64)
+}
+
+// Discard any non-zip data between the last file and the central directory,
+// such as an APK signing block
+func (m *Mangler) DropTrailer() {
+	m.dropTrailer = true
+}
+
 // Create a binary patchset out of the operations performed in this mangler
 func (m *Mangler) MakePatch(forceZip64 bool) (*binpatch.PatchSet, error) {
 	w := &m.newcontents
 	if err := m.outz.WriteDirectory(w, w, forceZip64); err != nil {
 		return nil, err
 	}
-	m.patch.Add(m.indir, m.insize-m.indir, m.newcontents.Bytes())
+	start := m.indir
+	if m.dropTrailer {
+		start = m.trailer
+	}
+	m.patch.Add(start, m.insize-start, m.newcontents.Bytes())
 	return m.patch, nil
 }
 
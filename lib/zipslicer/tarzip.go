@@ -95,6 +95,24 @@ func ReadZipTar(r io.Reader) (*Directory, error) {
 	return ReadStream(zr, hdr.Size, zipdir)
 }
 
+// Copy the zip member of a tar stream produced by ZipToTar to a writer, such as
+// a temporary file that can then be opened with Read to access files in any
+// order.
+func CopyZipTar(r io.Reader, w io.Writer) (int64, error) {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return 0, errors.New("invalid tarzip")
+		} else if err != nil {
+			return 0, fmt.Errorf("error reading tar: %w", err)
+		}
+		if hdr.Name == TarMemberZip {
+			return io.Copy(w, tr)
+		}
+	}
+}
+
 type zipTarReader struct {
 	tr *tar.Reader
 }
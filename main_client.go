@@ -22,27 +22,67 @@ import (
 	"github.com/sassoftware/relic/v7/cmdline/shared"
 	"github.com/sassoftware/relic/v7/config"
 
+	_ "github.com/sassoftware/relic/v7/cmdline/notarize"
 	_ "github.com/sassoftware/relic/v7/cmdline/remotecmd"
+	_ "github.com/sassoftware/relic/v7/cmdline/unsign"
 	_ "github.com/sassoftware/relic/v7/cmdline/verify"
 
+	_ "github.com/sassoftware/relic/v7/signers/aab"
+	_ "github.com/sassoftware/relic/v7/signers/alpine"
 	_ "github.com/sassoftware/relic/v7/signers/apk"
+	_ "github.com/sassoftware/relic/v7/signers/appimage"
 	_ "github.com/sassoftware/relic/v7/signers/appmanifest"
 	_ "github.com/sassoftware/relic/v7/signers/appx"
+	_ "github.com/sassoftware/relic/v7/signers/aptrelease"
+	_ "github.com/sassoftware/relic/v7/signers/avb"
+	_ "github.com/sassoftware/relic/v7/signers/bpf"
 	_ "github.com/sassoftware/relic/v7/signers/cab"
 	_ "github.com/sassoftware/relic/v7/signers/cat"
+	_ "github.com/sassoftware/relic/v7/signers/cose"
+	_ "github.com/sassoftware/relic/v7/signers/cosign"
+	_ "github.com/sassoftware/relic/v7/signers/crx"
 	_ "github.com/sassoftware/relic/v7/signers/deb"
 	_ "github.com/sassoftware/relic/v7/signers/dmg"
+	_ "github.com/sassoftware/relic/v7/signers/dsc"
+	_ "github.com/sassoftware/relic/v7/signers/efivar"
+	_ "github.com/sassoftware/relic/v7/signers/fit"
+	_ "github.com/sassoftware/relic/v7/signers/fsverity"
+	_ "github.com/sassoftware/relic/v7/signers/gem"
+	_ "github.com/sassoftware/relic/v7/signers/ima"
+	_ "github.com/sassoftware/relic/v7/signers/intoto"
+	_ "github.com/sassoftware/relic/v7/signers/iso"
 	_ "github.com/sassoftware/relic/v7/signers/jar"
+	_ "github.com/sassoftware/relic/v7/signers/jose"
+	_ "github.com/sassoftware/relic/v7/signers/kmod"
 	_ "github.com/sassoftware/relic/v7/signers/macho"
 	_ "github.com/sassoftware/relic/v7/signers/msi"
+	_ "github.com/sassoftware/relic/v7/signers/notation"
+	_ "github.com/sassoftware/relic/v7/signers/npm"
+	_ "github.com/sassoftware/relic/v7/signers/nuget"
+	_ "github.com/sassoftware/relic/v7/signers/ostree"
+	_ "github.com/sassoftware/relic/v7/signers/pacman"
+	_ "github.com/sassoftware/relic/v7/signers/pdf"
 	_ "github.com/sassoftware/relic/v7/signers/pecoff"
 	_ "github.com/sassoftware/relic/v7/signers/pgp"
 	_ "github.com/sassoftware/relic/v7/signers/pkcs"
 	_ "github.com/sassoftware/relic/v7/signers/ps"
+	_ "github.com/sassoftware/relic/v7/signers/pypi"
+	_ "github.com/sassoftware/relic/v7/signers/repomd"
 	_ "github.com/sassoftware/relic/v7/signers/rpm"
+	_ "github.com/sassoftware/relic/v7/signers/smime"
+	_ "github.com/sassoftware/relic/v7/signers/snap"
+	_ "github.com/sassoftware/relic/v7/signers/sshca"
+	_ "github.com/sassoftware/relic/v7/signers/sshsig"
+	_ "github.com/sassoftware/relic/v7/signers/tarmanifest"
+	_ "github.com/sassoftware/relic/v7/signers/tuf"
+	_ "github.com/sassoftware/relic/v7/signers/uki"
+	_ "github.com/sassoftware/relic/v7/signers/vba"
 	_ "github.com/sassoftware/relic/v7/signers/vsix"
+	_ "github.com/sassoftware/relic/v7/signers/wasm"
 	_ "github.com/sassoftware/relic/v7/signers/xap"
 	_ "github.com/sassoftware/relic/v7/signers/xar"
+	_ "github.com/sassoftware/relic/v7/signers/xmldsig"
+	_ "github.com/sassoftware/relic/v7/signers/xpi"
 )
 
 var (
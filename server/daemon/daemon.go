@@ -46,14 +46,12 @@ type Daemon struct {
 	listeners  []net.Listener
 	metrics    net.Listener
 	addrs      []string
+	certs      *certloader.Watcher
 	eg         errgroup.Group
 }
 
-func makeTLSConfig(config *config.Config) (*tls.Config, error) {
-	cert, err := certloader.LoadX509KeyPair(config.Server.CertFile, config.Server.KeyFile)
-	if err != nil {
-		return nil, err
-	}
+func makeTLSConfig(config *config.Config, certs *certloader.Watcher) (*tls.Config, error) {
+	var err error
 	var keyLog io.Writer
 	if klf := os.Getenv("SSLKEYLOGFILE"); klf != "" {
 		fmt.Fprintln(os.Stderr, "WARNING: SSLKEYLOGFILE is set! TLS master secrets will be logged.")
@@ -64,7 +62,7 @@ func makeTLSConfig(config *config.Config) (*tls.Config, error) {
 	}
 
 	tconf := &tls.Config{
-		Certificates:             []tls.Certificate{cert.TLS()},
+		GetCertificate:           certs.GetCertificate,
 		PreferServerCipherSuites: true,
 		SessionTicketsDisabled:   true,
 		ClientAuth:               tls.RequestClientCert,
@@ -75,6 +73,27 @@ func makeTLSConfig(config *config.Config) (*tls.Config, error) {
 	return tconf, nil
 }
 
+// load the server certificate and reload it when the files are replaced
+func watchTLSCert(config *config.Config) (*certloader.Watcher, error) {
+	certs, err := certloader.WatchX509KeyPair(config.Server.CertFile, config.Server.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	certs.OnReload = func(cert *certloader.Certificate) {
+		log.Info().
+			Str("subject", x509tools.FormatSubject(cert.Leaf)).
+			Time("expires", cert.Leaf.NotAfter).
+			Msg("reloaded TLS certificate")
+	}
+	certs.OnError = func(err error) {
+		log.Error().Err(err).Msg("failed to reload TLS certificate, keeping the current one")
+	}
+	if config.Server.CertReloadInterval > 0 {
+		certs.Start(time.Second * time.Duration(config.Server.CertReloadInterval))
+	}
+	return certs, nil
+}
+
 func getListener(index uint, laddr string, tconf *tls.Config) (net.Listener, error) {
 	listener, err := activation.GetListener(index, "tcp", laddr)
 	if err == nil {
@@ -102,9 +121,15 @@ func New(config *config.Config, test bool) (*Daemon, error) {
 		IdleTimeout:       10 * time.Second,
 	}
 	// configure TLS listener
+	var certs *certloader.Watcher
 	if config.Server.Listen != "" {
-		tconf, err := makeTLSConfig(config)
+		certs, err = watchTLSCert(config)
+		if err != nil {
+			return nil, err
+		}
+		tconf, err := makeTLSConfig(config, certs)
 		if err != nil {
+			certs.Close()
 			return nil, err
 		}
 		httpServer.TLSConfig = tconf
@@ -114,6 +139,9 @@ func New(config *config.Config, test bool) (*Daemon, error) {
 	}
 	if test {
 		srv.Close()
+		if certs != nil {
+			certs.Close()
+		}
 		return nil, nil
 	}
 
@@ -158,6 +186,7 @@ func New(config *config.Config, test bool) (*Daemon, error) {
 		listeners:  listeners,
 		metrics:    metricsListener,
 		addrs:      addrs,
+		certs:      certs,
 	}, nil
 }
 
@@ -200,6 +229,9 @@ func (d *Daemon) Close() error {
 		defer cancel()
 		err := d.httpServer.Shutdown(ctx)
 		err2 := d.server.Close()
+		if d.certs != nil {
+			d.certs.Close()
+		}
 		if err == nil {
 			err = err2
 		}
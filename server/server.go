@@ -56,7 +56,12 @@ func (s *Server) Handler() http.Handler {
 	a.Get("/", handleFunc(s.serveHome))
 	a.Get("/list_keys", handleFunc(s.serveListKeys))
 	a.Get("/keys/{key}", handleFunc(s.serveGetKey))
+	a.Get("/expiry", handleFunc(s.serveExpiry))
+	a.Get("/health/tokens", handleFunc(s.serveTokenHealth))
 	a.Post("/sign", handleFunc(s.serveSign))
+	if tokenRPCEnabled(s.Config) {
+		return s.withTokenRPC(r)
+	}
 	return r
 }
 
@@ -98,6 +103,9 @@ func New(config *config.Config) (*Server, error) {
 	if err := s.startHealthCheck(); err != nil {
 		return nil, err
 	}
+	if s.Config.Server.ExpiryCheckInterval > 0 {
+		go s.expiryCheckLoop()
+	}
 	return s, nil
 }
 
@@ -0,0 +1,172 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sassoftware/relic/v7/config"
+	"github.com/sassoftware/relic/v7/internal/authmodel"
+	"github.com/sassoftware/relic/v7/internal/signinit"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+)
+
+var metricCertExpiry = promauto.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "certificate_expiry_timestamp_seconds",
+		Help: "Expiry time of each certificate in the chains of configured keys and the timestamp server",
+	},
+	[]string{"key", "role", "subject"},
+)
+
+type expiryReport struct {
+	Keys      map[string][]x509tools.CertExpiry `json:"keys"`
+	Timestamp []x509tools.CertExpiry            `json:"timestamp,omitempty"`
+	Errors    map[string]string                 `json:"errors,omitempty"`
+	Status    x509tools.ExpiryStatus            `json:"status"`
+}
+
+// name used in reports and metrics for the timestamp server's chain
+const timestampReportName = "timestamp"
+
+func (s *Server) serveExpiry(rw http.ResponseWriter, req *http.Request) error {
+	userInfo := authmodel.RequestInfo(req)
+	var keys []*config.KeyConfig
+	for _, keyConf := range s.expiryKeys() {
+		if !keyConf.Hide && userInfo.Allowed(keyConf) {
+			keys = append(keys, keyConf)
+		}
+	}
+	return writeJSON(rw, s.checkExpiry(req.Context(), keys))
+}
+
+// keys with a certificate chain to monitor, skipping aliases
+func (s *Server) expiryKeys() []*config.KeyConfig {
+	var keys []*config.KeyConfig
+	for _, keyConf := range s.Config.Keys {
+		if keyConf.Alias != "" || s.tokens[keyConf.Token] == nil {
+			continue
+		}
+		keys = append(keys, keyConf)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Name() < keys[j].Name() })
+	return keys
+}
+
+func (s *Server) expiryThresholds() x509tools.ExpiryThresholds {
+	return x509tools.ExpiryThresholds{
+		Warning:  time.Duration(s.Config.Server.ExpiryWarningDays) * 24 * time.Hour,
+		Critical: time.Duration(s.Config.Server.ExpiryCriticalDays) * 24 * time.Hour,
+	}
+}
+
+func (s *Server) checkExpiry(ctx context.Context, keys []*config.KeyConfig) *expiryReport {
+	report := &expiryReport{
+		Keys:   make(map[string][]x509tools.CertExpiry),
+		Errors: make(map[string]string),
+	}
+	thresholds := s.expiryThresholds()
+	now := time.Now()
+	var all []x509tools.CertExpiry
+	timestamped := false
+	for _, keyConf := range keys {
+		// only look at certificates that are already on hand, so that
+		// reporting doesn't open tokens or ask a CA to issue one
+		chain, err := signinit.KeyChain(keyConf)
+		if err != nil {
+			report.Errors[keyConf.Name()] = err.Error()
+			continue
+		}
+		if keyConf.Timestamp {
+			timestamped = true
+		}
+		if len(chain) == 0 {
+			continue
+		}
+		results := x509tools.ChainExpiry(chain, thresholds, now)
+		report.Keys[keyConf.Name()] = results
+		all = append(all, results...)
+	}
+	if timestamped {
+		chain, err := signinit.TimestampChain(ctx)
+		if err != nil {
+			report.Errors[timestampReportName] = err.Error()
+		} else {
+			report.Timestamp = x509tools.ChainExpiry(chain, thresholds, now)
+			all = append(all, report.Timestamp...)
+		}
+	}
+	report.Status = x509tools.WorstExpiry(all)
+	return report
+}
+
+func (s *Server) expiryCheckLoop() {
+	interval := time.Second * time.Duration(s.Config.Server.ExpiryCheckInterval)
+	t := time.NewTimer(0)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			s.logExpiry()
+			t.Reset(interval)
+		case <-s.Closed:
+			return
+		}
+	}
+}
+
+// Check all keys, updating metrics and logging any certificates that are
+// close to expiring
+func (s *Server) logExpiry() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*time.Duration(s.Config.Server.TokenCheckTimeout))
+	defer cancel()
+	report := s.checkExpiry(ctx, s.expiryKeys())
+	metricCertExpiry.Reset()
+	record := func(name string, results []x509tools.CertExpiry) {
+		for _, result := range results {
+			metricCertExpiry.WithLabelValues(name, result.Role, result.Subject).Set(float64(result.NotAfter.Unix()))
+			if result.Status == x509tools.ExpiryOK {
+				continue
+			}
+			ev := log.Warn()
+			if result.Status != x509tools.ExpiryWarning {
+				ev = log.Error()
+			}
+			ev.Str("key", name).
+				Str("role", result.Role).
+				Str("subject", result.Subject).
+				Time("not_after", result.NotAfter).
+				Int("days_left", result.DaysLeft).
+				Str("expiry_status", string(result.Status)).
+				Msg("certificate is close to expiring")
+		}
+	}
+	for name, results := range report.Keys {
+		record(name, results)
+	}
+	record(timestampReportName, report.Timestamp)
+	for name, msg := range report.Errors {
+		log.Error().Str("key", name).Str("error", msg).Msg("failed to check certificate expiry")
+	}
+}
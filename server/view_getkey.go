@@ -32,11 +32,15 @@ import (
 	"github.com/sassoftware/relic/v7/internal/authmodel"
 	"github.com/sassoftware/relic/v7/internal/httperror"
 	"github.com/sassoftware/relic/v7/internal/signinit"
+	"github.com/sassoftware/relic/v7/lib/certloader"
 )
 
 type keyInfo struct {
 	X509Certificate string
 	PGPCertificate  string
+	// Certificates of older versions of a versioned key, newest first, so
+	// that clients can verify signatures made before a rotation
+	PreviousVersions []keyInfo `json:",omitempty"`
 }
 
 func (s *Server) serveGetKey(rw http.ResponseWriter, req *http.Request) error {
@@ -48,6 +52,10 @@ func (s *Server) serveGetKey(rw http.ResponseWriter, req *http.Request) error {
 		if err != nil {
 			return err
 		}
+		info.PreviousVersions, err = s.previousVersions(keyName)
+		if err != nil {
+			return err
+		}
 		return writeJSON(rw, info)
 	}
 	return httperror.ErrForbidden
@@ -78,6 +86,45 @@ func (s *Server) getKeyInfo(ctx context.Context, keyConf *config.KeyConfig) (key
 	return info, nil
 }
 
+// Load the certificates of older versions from the configured files. The
+// tokens holding retired keys don't need to be available.
+func (s *Server) previousVersions(keyName string) ([]keyInfo, error) {
+	versions, err := s.Config.KeyVersions(keyName)
+	if err != nil {
+		return nil, err
+	}
+	var infos []keyInfo
+	for i := len(versions) - 2; i >= 0; i-- {
+		var info keyInfo
+		vconf := versions[i]
+		if vconf.X509Certificate != "" {
+			certs, err := certloader.LoadAnyCerts([]string{vconf.X509Certificate})
+			if err != nil {
+				return nil, err
+			}
+			info.X509Certificate, err = marshalX509Cert(certs.X509Certs)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if vconf.PgpCertificate != "" {
+			certs, err := certloader.LoadAnyCerts([]string{vconf.PgpCertificate})
+			if err != nil {
+				return nil, err
+			}
+			for _, entity := range certs.PGPCerts {
+				armored, err := marshalPGPCert(entity)
+				if err != nil {
+					return nil, err
+				}
+				info.PGPCertificate += armored
+			}
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
 // marshal entire X509 certificate chain in PEM format
 func marshalX509Cert(certs []*x509.Certificate) (string, error) {
 	var buf bytes.Buffer
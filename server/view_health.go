@@ -33,6 +33,7 @@ import (
 var (
 	healthStatus   int
 	healthLastPing time.Time
+	healthTokens   map[string]*token.Health
 	healthMu       sync.Mutex
 
 	metricTokenCheckErrors = promauto.NewGaugeVec(
@@ -42,6 +43,34 @@ var (
 		},
 		[]string{"token"},
 	)
+	metricTokenUp = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "token_up",
+			Help: "1 if the token responded to the last health check, otherwise 0",
+		},
+		[]string{"token"},
+	)
+	metricTokenCheckLatency = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "token_check_latency_seconds",
+			Help: "Time taken by the last health check of the token",
+		},
+		[]string{"token"},
+	)
+	metricTokenSessions = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "token_sessions",
+			Help: "Number of signing sessions open on the token",
+		},
+		[]string{"token"},
+	)
+	metricTokenPINRetries = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "token_pin_retries",
+			Help: "Login attempts left before the token's PIN is locked, where the token reports it",
+		},
+		[]string{"token"},
+	)
 )
 
 func (s *Server) healthCheckInterval() time.Duration {
@@ -74,9 +103,13 @@ func (s *Server) healthCheck() bool {
 	last := healthStatus
 	healthMu.Unlock()
 	var notOK []string
+	results := make(map[string]*token.Health, len(s.tokens))
 	for name, token := range s.tokens {
 		metric := metricTokenCheckErrors.WithLabelValues(name)
-		if s.pingOne(token) {
+		h := s.checkOne(token)
+		results[name] = h
+		recordHealth(name, h)
+		if h.OK {
 			metric.Set(0)
 		} else {
 			metric.Inc()
@@ -103,22 +136,41 @@ func (s *Server) healthCheck() bool {
 	defer healthMu.Unlock()
 	healthStatus = next
 	healthLastPing = time.Now()
+	healthTokens = results
 	return len(notOK) == 0
 }
 
-func (s *Server) pingOne(tok token.Token) bool {
+func (s *Server) checkOne(tok token.Token) *token.Health {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*time.Duration(s.Config.Server.TokenCheckTimeout))
 	defer cancel()
-	if err := tok.Ping(ctx); err != nil {
+	h := token.CheckHealth(ctx, tok)
+	if !h.OK {
 		ev := log.Error().Str("token", tok.Config().Name())
 		if ctx.Err() != nil {
 			ev.Msg("token health check timed out")
 		} else {
-			ev.Err(err).Msg("token health check failed")
+			ev.Str("error", h.Error).Msg("token health check failed")
 		}
-		return false
 	}
-	return true
+	for _, warning := range h.Warnings {
+		log.Warn().Str("token", tok.Config().Name()).Msg(warning)
+	}
+	return h
+}
+
+func recordHealth(name string, h *token.Health) {
+	up := 0.0
+	if h.OK {
+		up = 1
+	}
+	metricTokenUp.WithLabelValues(name).Set(up)
+	metricTokenCheckLatency.WithLabelValues(name).Set(h.Latency.Seconds())
+	if h.MaxSessions != 0 {
+		metricTokenSessions.WithLabelValues(name).Set(float64(h.Sessions))
+	}
+	if h.PINRetries != nil {
+		metricTokenPINRetries.WithLabelValues(name).Set(float64(*h.PINRetries))
+	}
 }
 
 func (s *Server) Healthy(request *http.Request) bool {
@@ -144,3 +196,20 @@ func (s *Server) serveHealth(rw http.ResponseWriter, request *http.Request) {
 		http.Error(rw, "health check failed", http.StatusServiceUnavailable)
 	}
 }
+
+// serveTokenHealth reports the result of the last health check of each token
+func (s *Server) serveTokenHealth(rw http.ResponseWriter, req *http.Request) error {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	return writeJSON(rw, tokenHealthReport{
+		OK:      healthStatus > 0,
+		Checked: healthLastPing,
+		Tokens:  healthTokens,
+	})
+}
+
+type tokenHealthReport struct {
+	OK      bool                     `json:"ok"`
+	Checked time.Time                `json:"checked"`
+	Tokens  map[string]*token.Health `json:"tokens"`
+}
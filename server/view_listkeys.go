@@ -30,9 +30,11 @@ func (s *Server) serveListKeys(rw http.ResponseWriter, req *http.Request) error
 		if keyConf.Hide {
 			continue
 		}
-		if keyConf.Alias != "" {
-			keyConf = s.Config.Keys[keyConf.Alias]
-			if keyConf == nil {
+		if keyConf.Alias != "" || len(keyConf.Versions) != 0 {
+			// resolve to the key that would actually be used
+			var err error
+			keyConf, err = s.Config.GetKey(key)
+			if err != nil {
 				continue
 			}
 		}
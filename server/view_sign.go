@@ -85,9 +85,11 @@ func (s *Server) serveSign(rw http.ResponseWriter, request *http.Request) error
 	if err != nil {
 		return err
 	}
+	opts.Path = filename
 	opts.Audit.Attributes["client.ip"] = zhttp.StripPort(request.RemoteAddr)
 	opts.Audit.Attributes["client.filename"] = filename
 	userInfo.AuditContext(opts.Audit)
+	opts.Caller, opts.CallerRoles = userInfo.Caller()
 	// sign the request stream and output a binpatch or signature blob
 	counter := readercounter.New(request.Body)
 	blob, err := mod.Sign(counter, cert, *opts)
@@ -0,0 +1,145 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package server
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/sassoftware/relic/v7/config"
+	"github.com/sassoftware/relic/v7/internal/authmodel"
+	"github.com/sassoftware/relic/v7/internal/signinit"
+	"github.com/sassoftware/relic/v7/internal/tokenrpc"
+	"github.com/sassoftware/relic/v7/internal/workerrpc"
+	"github.com/sassoftware/relic/v7/lib/audit"
+	"github.com/sassoftware/relic/v7/token"
+)
+
+// tokenService exposes raw signing with the server's keys to other relic
+// servers over gRPC
+type tokenService struct {
+	s *Server
+}
+
+// route gRPC requests to the token service and everything else to the regular
+// handler. Callers are authenticated the same way as any other request.
+func (s *Server) withTokenRPC(next http.Handler) http.Handler {
+	gs := grpc.NewServer()
+	tokenrpc.Register(gs, tokenService{s: s})
+	rpc := s.realIP(authmodel.Middleware(s.auth)(gs))
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.ProtoMajor == 2 && strings.HasPrefix(req.Header.Get("Content-Type"), "application/grpc") {
+			rpc.ServeHTTP(rw, req)
+		} else {
+			next.ServeHTTP(rw, req)
+		}
+	})
+}
+
+func (t tokenService) Ping(ctx context.Context, rr *workerrpc.Request) (*workerrpc.Response, error) {
+	return &workerrpc.Response{}, nil
+}
+
+func (t tokenService) GetKey(ctx context.Context, rr *workerrpc.Request) (*workerrpc.Response, error) {
+	key, err := t.getKey(ctx, rr)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return nil, rpcError(err)
+	}
+	return &workerrpc.Response{Value: pub, ID: key.GetID(), Cert: key.Certificate()}, nil
+}
+
+func (t tokenService) Sign(ctx context.Context, rr *workerrpc.Request) (*workerrpc.Response, error) {
+	key, err := t.getKey(ctx, rr)
+	if err != nil {
+		return nil, err
+	}
+	hash := crypto.Hash(rr.Hash)
+	// the caller is responsible for the package format, so all that can be
+	// audited here is the use of the key
+	info := audit.New(rr.KeyName, "raw", hash)
+	if err := signinit.CheckKey(ctx, key, info); err != nil {
+		log.Error().Err(err).Str("key", rr.KeyName).Msg("key refused for raw signing")
+		return nil, rpcError(err)
+	}
+	opts := crypto.SignerOpts(hash)
+	if rr.SaltLength != nil {
+		opts = &rsa.PSSOptions{SaltLength: *rr.SaltLength, Hash: hash}
+	}
+	sig, err := key.SignContext(ctx, rr.Digest, opts)
+	if err != nil {
+		return nil, rpcError(err)
+	}
+	authmodel.ContextInfo(ctx).AuditContext(info)
+	if err := signinit.PublishAudit(info); err != nil {
+		return nil, rpcError(err)
+	}
+	log.Info().Str("key", rr.KeyName).Msg("signed digest")
+	return &workerrpc.Response{Value: sig}, nil
+}
+
+func (t tokenService) getKey(ctx context.Context, rr *workerrpc.Request) (token.Key, error) {
+	keyConf, err := t.s.Config.GetKey(rr.KeyName)
+	if err != nil || !authmodel.ContextInfo(ctx).Allowed(keyConf) {
+		log.Error().Str("key", rr.KeyName).Msg("access to key denied")
+		return nil, status.Error(codes.PermissionDenied, "access to key denied")
+	}
+	tok := t.s.tokens[keyConf.Token]
+	if tok == nil {
+		return nil, status.Errorf(codes.Internal, "missing token %q for key %q", keyConf.Token, keyConf.Name())
+	}
+	if rr.KeyID != nil {
+		// make sure the same key version is used throughout
+		ctx = token.WithKeyID(ctx, rr.KeyID)
+	}
+	key, err := tok.GetKey(ctx, keyConf.Name())
+	if err != nil {
+		return nil, rpcError(err)
+	}
+	return key, nil
+}
+
+// convert token errors to a status the client can map back
+func rpcError(err error) error {
+	var usage token.KeyUsageError
+	var notImpl token.NotImplementedError
+	switch {
+	case errors.As(err, &usage):
+		return status.Error(codes.FailedPrecondition, usage.Err.Error())
+	case errors.As(err, &notImpl):
+		return status.Error(codes.Unimplemented, err.Error())
+	default:
+		return status.Error(codes.Unavailable, err.Error())
+	}
+}
+
+func tokenRPCEnabled(conf *config.Config) bool {
+	return conf.Server != nil && conf.Server.TokenRPC
+}
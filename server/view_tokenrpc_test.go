@@ -0,0 +1,97 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package server
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/sassoftware/relic/v7/cmdline/shared"
+	"github.com/sassoftware/relic/v7/config"
+	"github.com/sassoftware/relic/v7/internal/authmodel"
+	"github.com/sassoftware/relic/v7/internal/testcert"
+	"github.com/sassoftware/relic/v7/internal/workerrpc"
+	"github.com/sassoftware/relic/v7/lib/audit"
+	"github.com/sassoftware/relic/v7/token"
+	"github.com/sassoftware/relic/v7/token/filetoken"
+)
+
+type allowAll struct{}
+
+func (allowAll) Authenticate(*http.Request) (authmodel.UserInfo, error) { return allowAll{}, nil }
+func (allowAll) Allowed(*config.KeyConfig) bool                         { return true }
+func (allowAll) AuditContext(*audit.Info)                               {}
+func (allowAll) Caller() (string, []string)                             { return "test", nil }
+
+// get a request context as the authentication middleware would produce it
+func authContext() context.Context {
+	var ctx context.Context
+	handler := authmodel.Middleware(allowAll{})(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		ctx = req.Context()
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+	return ctx
+}
+
+func TestTokenRPCPolicy(t *testing.T) {
+	conf := new(config.Config)
+	conf.NewToken("file").Type = "file"
+	dir := t.TempDir()
+	for _, name := range []string{"open", "restricted"} {
+		key := testcert.ECDSAKey(t)
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		require.NoError(t, err)
+		keyPath := filepath.Join(dir, name+".key")
+		require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600))
+		cert := testcert.SelfSigned(t, name, key)
+		certPath := filepath.Join(dir, name+".crt")
+		require.NoError(t, os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0644))
+		kconf := conf.NewKey(name)
+		kconf.Token = "file"
+		kconf.KeyFile = keyPath
+		kconf.X509Certificate = certPath
+	}
+	// P-256 is too small for this key's policy
+	conf.Keys["restricted"].Policy = &config.KeyPolicyConfig{MinECBits: 384}
+	shared.CurrentConfig = conf
+	tok, err := filetoken.Open(conf, "file", nil)
+	require.NoError(t, err)
+	svc := tokenService{s: &Server{Config: conf, tokens: map[string]token.Token{"file": tok}}}
+
+	digest := sha256.Sum256([]byte("payload"))
+	ctx := authContext()
+	resp, err := svc.Sign(ctx, &workerrpc.Request{KeyName: "open", Hash: uint(crypto.SHA256), Digest: digest[:]})
+	require.NoError(t, err)
+	assert.NotEmpty(t, resp.Value)
+
+	_, err = svc.Sign(ctx, &workerrpc.Request{KeyName: "restricted", Hash: uint(crypto.SHA256), Digest: digest[:]})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	assert.ErrorContains(t, err, "elliptic curve size 256 is smaller than the minimum of 384")
+}
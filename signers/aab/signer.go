@@ -0,0 +1,122 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package aab
+
+// Sign Android App Bundles
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/magic"
+	"github.com/sassoftware/relic/v7/lib/signjar"
+	"github.com/sassoftware/relic/v7/lib/zipslicer"
+	"github.com/sassoftware/relic/v7/signers"
+	"github.com/sassoftware/relic/v7/signers/zipbased"
+)
+
+var AabSigner = &signers.Signer{
+	Name:      "aab",
+	Magic:     magic.FileTypeAAB,
+	CertTypes: signers.CertTypeX509,
+	Transform: zipbased.Transform,
+	Sign:      sign,
+	Verify:    verify,
+}
+
+func init() {
+	AabSigner.Flags().Bool("code-transparency", false, "(AAB) Add a code transparency signature over the bundle's DEX files and native libraries")
+	AabSigner.Flags().String("key-alias", "RELIC", "(JAR, APK, AAB) Alias to use for the signed manifest")
+	signers.Register(AabSigner)
+}
+
+func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	alias := opts.Flags.GetString("key-alias")
+	if alias == "" {
+		alias = "RELIC"
+	}
+	// spool to disk, since code transparency needs another pass over the
+	// bundle contents
+	tmp, err := os.CreateTemp("", "relic-aab-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	size, err := zipslicer.CopyZipTar(r, tmp)
+	if err != nil {
+		return nil, err
+	}
+	inz, err := zipslicer.Read(tmp, size)
+	if err != nil {
+		return nil, err
+	}
+	jd, err := signjar.DigestZip(inz, opts.Hash)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Flags.GetBool("code-transparency") {
+		zr, err := zip.NewReader(tmp, size)
+		if err != nil {
+			return nil, err
+		}
+		jws, err := signCodeTransparency(zr, cert)
+		if err != nil {
+			return nil, err
+		}
+		if err := jd.AddFile(codeTransparencyName, jws); err != nil {
+			return nil, err
+		}
+	}
+	patch, ts, err := jd.Sign(opts.Context(), cert, alias, false, false, false)
+	if err != nil {
+		return nil, err
+	}
+	opts.Audit.SetCounterSignature(ts.CounterSignature)
+	return opts.SetBinPatch(patch)
+}
+
+func verify(f *os.File, opts signers.VerifyOpts) ([]*signers.Signature, error) {
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	inz, err := zip.NewReader(f, size)
+	if err != nil {
+		return nil, err
+	}
+	sigs, err := signjar.Verify(inz, opts.NoDigests)
+	if err != nil {
+		return nil, err
+	}
+	var ret []*signers.Signature
+	for _, ts := range sigs {
+		ret = append(ret, &signers.Signature{
+			Hash:          ts.Hash,
+			X509Signature: &ts.TimestampedSignature,
+		})
+	}
+	ctSig, err := verifyCodeTransparency(inz, opts.NoDigests)
+	if err != nil {
+		return nil, err
+	} else if ctSig != nil {
+		ret = append(ret, ctSig)
+	}
+	return ret, nil
+}
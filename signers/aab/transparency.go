@@ -0,0 +1,222 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package aab
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/pkcs7"
+	"github.com/sassoftware/relic/v7/lib/pkcs9"
+	"github.com/sassoftware/relic/v7/signers"
+)
+
+// Code transparency is a JWS over the hashes of a bundle's DEX files and
+// native libraries, which is carried into the APKs generated from the bundle
+// so that their code can be checked against what the developer signed.
+// See https://developer.android.com/guide/app-bundle/code-transparency
+
+const codeTransparencyName = "BUNDLE-METADATA/com.android.tools.build.bundletool/code_transparency_signed.jwt"
+
+type codeTransparency struct {
+	CodeRelatedFile []codeRelatedFile `json:"codeRelatedFile"`
+	Version         int               `json:"version"`
+}
+
+type codeRelatedFile struct {
+	Type    string `json:"type"`
+	Path    string `json:"path"`
+	Sha256  string `json:"sha256"`
+	ApkPath string `json:"apkPath,omitempty"`
+}
+
+type jwsHeader struct {
+	Alg string   `json:"alg"`
+	X5C [][]byte `json:"x5c"`
+}
+
+// list the DEX files and native libraries in a bundle, with their hashes
+func codeRelatedFiles(inz *zip.Reader) ([]codeRelatedFile, error) {
+	var files []codeRelatedFile
+	for _, f := range inz.File {
+		parts := strings.Split(f.Name, "/")
+		var crf codeRelatedFile
+		switch {
+		case len(parts) == 3 && parts[1] == "dex" && path.Ext(f.Name) == ".dex":
+			crf = codeRelatedFile{Type: "DEX", Path: f.Name}
+		case len(parts) == 4 && parts[1] == "lib" && path.Ext(f.Name) == ".so":
+			crf = codeRelatedFile{Type: "NATIVE_LIBRARY", Path: f.Name, ApkPath: strings.Join(parts[1:], "/")}
+		default:
+			continue
+		}
+		r, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		d := sha256.New()
+		_, err = io.Copy(d, r)
+		r.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		crf.Sha256 = hex.EncodeToString(d.Sum(nil))
+		files = append(files, crf)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+func signCodeTransparency(inz *zip.Reader, cert *certloader.Certificate) ([]byte, error) {
+	if _, ok := cert.Leaf.PublicKey.(*rsa.PublicKey); !ok {
+		return nil, errors.New("code transparency requires an RSA key")
+	}
+	files, err := codeRelatedFiles(inz)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(codeTransparency{CodeRelatedFile: files, Version: 1})
+	if err != nil {
+		return nil, err
+	}
+	hdr := jwsHeader{Alg: "RS256"}
+	for _, c := range cert.Chain() {
+		hdr.X5C = append(hdr.X5C, c.Raw)
+	}
+	hdrJSON, err := json.Marshal(hdr)
+	if err != nil {
+		return nil, err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(hdrJSON) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	sig, err := cert.Signer().Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(signingInput + "." + base64.RawURLEncoding.EncodeToString(sig)), nil
+}
+
+// check the code transparency signature, if the bundle has one
+func verifyCodeTransparency(inz *zip.Reader, skipDigests bool) (*signers.Signature, error) {
+	var jws []byte
+	for _, f := range inz.File {
+		if f.Name != codeTransparencyName {
+			continue
+		}
+		r, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		jws, err = io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if jws == nil {
+		return nil, nil
+	}
+	parts := strings.Split(string(bytes.TrimSpace(jws)), ".")
+	if len(parts) != 3 {
+		return nil, errors.New("code transparency: malformed JWS")
+	}
+	var hdr jwsHeader
+	var ct codeTransparency
+	if err := decodeJSONPart(parts[0], &hdr); err != nil {
+		return nil, fmt.Errorf("code transparency: %w", err)
+	} else if err := decodeJSONPart(parts[1], &ct); err != nil {
+		return nil, fmt.Errorf("code transparency: %w", err)
+	}
+	if hdr.Alg != "RS256" {
+		return nil, fmt.Errorf("code transparency: unsupported algorithm %q", hdr.Alg)
+	} else if len(hdr.X5C) == 0 {
+		return nil, errors.New("code transparency: no certificate in JWS header")
+	}
+	var certs []*x509.Certificate
+	for _, der := range hdr.X5C {
+		c, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("code transparency: %w", err)
+		}
+		certs = append(certs, c)
+	}
+	pub, ok := certs[0].PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("code transparency: certificate is not RSA")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("code transparency: %w", err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig); err != nil {
+		return nil, fmt.Errorf("code transparency: %w", err)
+	}
+	if !skipDigests {
+		files, err := codeRelatedFiles(inz)
+		if err != nil {
+			return nil, err
+		}
+		expected := make(map[string]string, len(ct.CodeRelatedFile))
+		for _, crf := range ct.CodeRelatedFile {
+			expected[crf.Path] = crf.Sha256
+		}
+		for _, crf := range files {
+			if v, ok := expected[crf.Path]; !ok {
+				return nil, fmt.Errorf("code transparency: %s is not listed", crf.Path)
+			} else if v != crf.Sha256 {
+				return nil, fmt.Errorf("code transparency: digest mismatch for %s", crf.Path)
+			}
+			delete(expected, crf.Path)
+		}
+		for name := range expected {
+			return nil, fmt.Errorf("code transparency: %s is missing from the bundle", name)
+		}
+	}
+	return &signers.Signature{
+		SigInfo: "code-transparency",
+		Hash:    crypto.SHA256,
+		X509Signature: &pkcs9.TimestampedSignature{
+			Signature: pkcs7.Signature{
+				Certificate:   certs[0],
+				Intermediates: certs[1:],
+			},
+		},
+	}, nil
+}
+
+func decodeJSONPart(part string, dest interface{}) error {
+	blob, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(blob, dest)
+}
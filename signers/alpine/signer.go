@@ -0,0 +1,66 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package alpine
+
+// Sign Alpine Linux packages and APKINDEX.tar.gz repository indexes
+
+import (
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/sassoftware/relic/v7/lib/alpine"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/signers"
+)
+
+var AlpineSigner = &signers.Signer{
+	Name:      "alpine",
+	Aliases:   []string{"apkindex"},
+	CertTypes: signers.CertTypeX509,
+	TestPath:  testPath,
+	Sign:      sign,
+}
+
+func init() {
+	AlpineSigner.Flags().String("alpine-key-name", "", "(Alpine) file name of the public key in /etc/apk/keys (default: KEYNAME.rsa.pub)")
+	signers.Register(AlpineSigner)
+}
+
+func testPath(fp string) bool {
+	// Android packages are zips and are claimed by magic before this is
+	// consulted
+	return filepath.Base(fp) == "APKINDEX.tar.gz" || strings.HasSuffix(fp, ".apk")
+}
+
+func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	blob, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	keyName := opts.Flags.GetString("alpine-key-name")
+	if keyName == "" {
+		keyName = cert.KeyName + ".rsa.pub"
+	}
+	patch, err := alpine.Sign(blob, cert.Signer(), opts.Hash, keyName, opts.Time)
+	if err != nil {
+		return nil, err
+	}
+	opts.Audit.Attributes["alpine.keyname"] = keyName
+	return opts.SetBinPatch(patch)
+}
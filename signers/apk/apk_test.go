@@ -0,0 +1,238 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package apk
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sassoftware/relic/v7/internal/testcert"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/zipslicer"
+	"github.com/sassoftware/relic/v7/signers"
+)
+
+func makeApk(t *testing.T) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, file := range []struct{ name, contents string }{
+		{"META-INF/MANIFEST.MF", "Manifest-Version: 1.0\r\n\r\n"},
+		{"classes.dex", "dex\n035\x00"},
+	} {
+		f, err := w.Create(file.name)
+		require.NoError(t, err)
+		_, err = f.Write([]byte(file.contents))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func newSigner(t *testing.T, name string) (*ecdsa.PrivateKey, *certloader.Certificate) {
+	key := testcert.ECDSAKey(t)
+	return key, testcert.Signer(t, testcert.SelfSigned(t, name, key), key)
+}
+
+func signApk(t *testing.T, apk []byte, cert *certloader.Certificate, bo blockOptions) ([]byte, error) {
+	inz, err := zipslicer.Read(bytes.NewReader(apk), int64(len(apk)))
+	require.NoError(t, err)
+	digest, err := digestApk(inz, crypto.SHA256)
+	require.NoError(t, err)
+	patchset, err := digest.SignBlocks(cert, bo)
+	if err != nil {
+		return nil, err
+	}
+	return patchset.ApplyBytes(apk)
+}
+
+func verifyApk(t *testing.T, apk []byte) ([]*signers.Signature, error) {
+	fp := filepath.Join(t.TempDir(), "test.apk")
+	require.NoError(t, os.WriteFile(fp, apk, 0644))
+	f, err := os.Open(fp)
+	require.NoError(t, err)
+	defer f.Close()
+	return verify(f, signers.VerifyOpts{})
+}
+
+// get the signers in each scheme's block of a signed package
+func sigBlocks(t *testing.T, apk []byte) map[uint32][]apkV3Signer {
+	inz, err := zipslicer.Read(bytes.NewReader(apk), int64(len(apk)))
+	require.NoError(t, err)
+	trailer, err := inz.GetTrailer()
+	require.NoError(t, err)
+	pairs, err := splitSigBlock(trailer)
+	require.NoError(t, err)
+	blocks := make(map[uint32][]apkV3Signer)
+	for _, pair := range pairs {
+		var list []apkV3Signer
+		if pair.ID != sigApkV2 {
+			require.NoError(t, unmarshal(pair.Value, &list))
+		}
+		blocks[pair.ID] = list
+	}
+	return blocks
+}
+
+func sigInfos(sigs []*signers.Signature) []string {
+	var infos []string
+	for _, sig := range sigs {
+		infos = append(infos, sig.SigInfo)
+	}
+	return infos
+}
+
+func TestV3Rotation(t *testing.T) {
+	oldKey, oldCert := newSigner(t, "old")
+	_, newCert := newSigner(t, "new")
+	signed, err := signApk(t, makeApk(t), oldCert, blockOptions{v3: true})
+	require.NoError(t, err)
+	sigs, err := verifyApk(t, signed)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v2", "v3"}, sigInfos(sigs))
+
+	// rotate to the new key, keeping the v2 signature from the old one
+	lineage, err := NewLineage(oldCert.Leaf)
+	require.NoError(t, err)
+	require.NoError(t, lineage.Extend(oldKey, newCert.Leaf, crypto.SHA256))
+	newCert.ApkLineage, err = lineage.Marshal()
+	require.NoError(t, err)
+	rotated, err := signApk(t, signed, newCert, blockOptions{v3: true, lineage: newCert.ApkLineage})
+	require.NoError(t, err)
+	sigs, err = verifyApk(t, rotated)
+	require.NoError(t, err)
+	require.Equal(t, []string{"v2", "v3[lineage:2]"}, sigInfos(sigs))
+	assert.Equal(t, oldCert.Leaf.Raw, sigs[0].X509Signature.Certificate.Raw)
+	assert.Equal(t, newCert.Leaf.Raw, sigs[1].X509Signature.Certificate.Raw)
+
+	parsed, err := ParseLineage(newCert.ApkLineage)
+	require.NoError(t, err)
+	require.Len(t, parsed.Certificates(), 2)
+	assert.Equal(t, oldCert.Leaf.Raw, parsed.Certificates()[0].Raw)
+}
+
+func TestLineageRejected(t *testing.T) {
+	oldKey, oldCert := newSigner(t, "old")
+	otherKey, _ := newSigner(t, "other")
+	_, newCert := newSigner(t, "new")
+	lineage, err := NewLineage(oldCert.Leaf)
+	require.NoError(t, err)
+	// only the newest member can extend the lineage
+	assert.Error(t, lineage.Extend(otherKey, newCert.Leaf, crypto.SHA256))
+	require.NoError(t, lineage.Extend(oldKey, newCert.Leaf, crypto.SHA256))
+	good, err := lineage.Marshal()
+	require.NoError(t, err)
+
+	// break the signature over the last node
+	broken := append([]byte(nil), good...)
+	broken[len(broken)-1] ^= 1
+	_, err = ParseLineage(broken)
+	assert.Error(t, err)
+	_, err = signApk(t, makeApk(t), newCert, blockOptions{v3: true, lineage: broken})
+	assert.Error(t, err)
+
+	// a node with no signature at all
+	unsigned := &Lineage{nodes: append([]lineageNode(nil), lineage.nodes...), certs: lineage.certs}
+	unsigned.nodes[1].Signature = nil
+	unsignedBlob, err := unsigned.Marshal()
+	require.NoError(t, err)
+	_, err = ParseLineage(unsignedBlob)
+	assert.Error(t, err)
+
+	// a lineage that doesn't lead to the signing key
+	_, err = signApk(t, makeApk(t), oldCert, blockOptions{v3: true, lineage: good})
+	assert.ErrorContains(t, err, "does not end with the signing certificate")
+
+	// verifying a v3 signer whose lineage was replaced after signing
+	apk := makeApk(t)
+	inz, err := zipslicer.Read(bytes.NewReader(apk), int64(len(apk)))
+	require.NoError(t, err)
+	digest, err := digestApk(inz, crypto.SHA256)
+	require.NoError(t, err)
+	st, err := sigTypeFor(newCert.Leaf.PublicKey, crypto.SHA256, false)
+	require.NoError(t, err)
+	digests := []apkDigest{{ID: st.id, Value: digest.value}}
+	certs := [][]byte{newCert.Leaf.Raw}
+	sblob, err := digest.signV3(newCert, st, digests, certs, minSDKv3, []apkRaw{makeAttribute(attrProofOfRotation, unsignedBlob)})
+	require.NoError(t, err)
+	var list []apkV3Signer
+	require.NoError(t, unmarshal(sblob, &list))
+	_, err = list[0].Verify(nil, "v3")
+	assert.Error(t, err)
+}
+
+func TestV31SDK(t *testing.T) {
+	oldKey, oldCert := newSigner(t, "old")
+	_, newCert := newSigner(t, "new")
+	lineage, err := NewLineage(oldCert.Leaf)
+	require.NoError(t, err)
+	require.NoError(t, lineage.Extend(oldKey, newCert.Leaf, crypto.SHA256))
+	blob, err := lineage.Marshal()
+	require.NoError(t, err)
+
+	cases := []struct {
+		name           string
+		bo             blockOptions
+		v3             bool
+		minSDK         uint32
+		rotationMinSDK uint32
+	}{
+		{"v3.1 only", blockOptions{v31: true, lineage: blob}, false, minSDKv31, 0},
+		{"v3 and v3.1", blockOptions{v3: true, v31: true, lineage: blob}, true, minSDKv31, 0},
+		{"rotation min SDK", blockOptions{v3: true, v31: true, rotationMinSDK: 30, lineage: blob}, true, 30, 30},
+	}
+	for _, c := range cases {
+		signed, err := signApk(t, makeApk(t), newCert, c.bo)
+		require.NoError(t, err, c.name)
+		_, err = verifyApk(t, signed)
+		require.NoError(t, err, c.name)
+		blocks := sigBlocks(t, signed)
+		assert.Contains(t, blocks, uint32(sigApkV2), c.name)
+		if c.v3 {
+			require.Contains(t, blocks, uint32(sigApkV3), c.name)
+			v3 := blocks[sigApkV3][0]
+			assert.Equal(t, uint32(minSDKv3), v3.MinSDK, c.name)
+			assert.Equal(t, uint32(maxSDK), v3.MaxSDK, c.name)
+			var sd apkV3SignedData
+			require.NoError(t, unmarshal(v3.SignedData, &sd))
+			// the lineage goes in the v3.1 block when there is one
+			assert.Nil(t, findAttribute(sd.Attributes, attrProofOfRotation), c.name)
+			if c.rotationMinSDK != 0 {
+				assert.Equal(t, c.rotationMinSDK, binary.LittleEndian.Uint32(findAttribute(sd.Attributes, attrRotationMinSDK)), c.name)
+			} else {
+				assert.Nil(t, findAttribute(sd.Attributes, attrRotationMinSDK), c.name)
+			}
+		} else {
+			assert.NotContains(t, blocks, uint32(sigApkV3), c.name)
+		}
+		require.Contains(t, blocks, uint32(sigApkV31), c.name)
+		v31 := blocks[sigApkV31][0]
+		assert.Equal(t, c.minSDK, v31.MinSDK, c.name)
+		assert.Equal(t, uint32(maxSDK), v31.MaxSDK, c.name)
+		var sd apkV3SignedData
+		require.NoError(t, unmarshal(v31.SignedData, &sd))
+		assert.NotNil(t, findAttribute(sd.Attributes, attrProofOfRotation), c.name)
+	}
+}
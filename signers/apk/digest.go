@@ -26,7 +26,6 @@ import (
 
 	"github.com/sassoftware/relic/v7/lib/binpatch"
 	"github.com/sassoftware/relic/v7/lib/certloader"
-	"github.com/sassoftware/relic/v7/lib/x509tools"
 	"github.com/sassoftware/relic/v7/lib/zipslicer"
 )
 
@@ -35,6 +34,8 @@ type Digest struct {
 	hash   crypto.Hash
 	value  []byte
 	sigLoc int64
+	// existing signing block, if any
+	oldBlock []byte
 }
 
 func digestApkStream(r io.Reader, hash crypto.Hash) (*Digest, error) {
@@ -42,6 +43,10 @@ func digestApkStream(r io.Reader, hash crypto.Hash) (*Digest, error) {
 	if err != nil {
 		return nil, err
 	}
+	return digestApk(inz, hash)
+}
+
+func digestApk(inz *zipslicer.Directory, hash crypto.Hash) (*Digest, error) {
 	hasher := newMerkleHasher([]crypto.Hash{hash})
 	for _, f := range inz.File {
 		_, err := f.Dump(hasher)
@@ -53,6 +58,10 @@ func digestApkStream(r io.Reader, hash crypto.Hash) (*Digest, error) {
 	if err != nil {
 		return nil, err
 	}
+	oldBlock, err := inz.GetTrailer()
+	if err != nil {
+		return nil, err
+	}
 	origDirLoc := inz.DirLoc
 	inz.DirLoc = sigLoc
 	digests, err := hasher.Finish(inz, true)
@@ -61,56 +70,127 @@ func digestApkStream(r io.Reader, hash crypto.Hash) (*Digest, error) {
 	}
 	inz.DirLoc = origDirLoc
 	return &Digest{
-		inz:    inz,
-		hash:   hash,
-		value:  digests[0],
-		sigLoc: sigLoc,
+		inz:      inz,
+		hash:     hash,
+		value:    digests[0],
+		sigLoc:   sigLoc,
+		oldBlock: oldBlock,
 	}, nil
 }
 
+// Sign creates a signing block holding just a v2 signature
 func (d *Digest) Sign(cert *certloader.Certificate) (*binpatch.PatchSet, error) {
-	// select a signature type
-	alg := x509tools.GetPublicKeyAlgorithm(cert.Leaf.PublicKey)
-	var st sigType
-	for _, s := range sigTypes {
-		if s.hash == d.hash && s.alg == alg && !s.pss {
-			st = s
-			break
-		}
-		// TODO: PSS
-	}
-	if st.id == 0 {
-		return nil, errors.New("unsupported public key algorithm")
+	return d.SignBlocks(cert, blockOptions{v2: true})
+}
+
+type blockOptions struct {
+	v2, v3, v31    bool
+	pss            bool
+	rotationMinSDK uint32
+	lineage        []byte
+}
+
+// SignBlocks creates a signing block with the requested signature schemes. When
+// only v2 is requested any existing block is replaced; otherwise the other
+// schemes already present are kept, including a v2 signature made earlier
+// with an older key.
+func (d *Digest) SignBlocks(cert *certloader.Certificate, bo blockOptions) (*binpatch.PatchSet, error) {
+	st, err := sigTypeFor(cert.Leaf.PublicKey, d.hash, bo.pss)
+	if err != nil {
+		return nil, err
 	}
-	// build signed data
-	sd := apkSignedData{
-		Digests: []apkDigest{apkDigest{ID: st.id, Value: d.value}},
+	var pairs []sigPair
+	if bo.v3 || bo.v31 {
+		bo.v2 = true
+		if len(d.oldBlock) != 0 {
+			old, err := splitSigBlock(d.oldBlock)
+			if err != nil {
+				return nil, err
+			}
+			for _, pair := range old {
+				switch pair.ID {
+				case sigApkV2:
+					bo.v2 = false
+				case sigApkV3, sigApkV31:
+					continue
+				}
+				pairs = append(pairs, pair)
+			}
+		}
 	}
+	var certs [][]byte
 	for _, cert := range cert.Chain() {
-		sd.Certificates = append(sd.Certificates, cert.Raw)
-	}
-	signedData, err := marshal(sd)
-	if err != nil {
-		return nil, err
+		certs = append(certs, cert.Raw)
 	}
-	// sign
-	digest := st.hash.New()
-	digest.Write(signedData.Bytes())
-	sigv, err := cert.Signer().Sign(rand.Reader, digest.Sum(nil), st.hash)
-	if err != nil {
-		return nil, err
+	digests := []apkDigest{{ID: st.id, Value: d.value}}
+	if bo.v2 {
+		sd := apkSignedData{Digests: digests, Certificates: certs}
+		if bo.v3 {
+			// tell v3-aware verifiers not to accept this package if the v3
+			// block is stripped
+			sd.Attributes = append(sd.Attributes, makeAttribute(attrStrippingProtection, uint32Bytes(3)))
+		}
+		signedData, err := marshal(sd)
+		if err != nil {
+			return nil, err
+		}
+		sigv, err := signSignedData(cert, st, signedData)
+		if err != nil {
+			return nil, err
+		}
+		sblob, err := marshal([]apkSigner{{
+			SignedData: signedData,
+			Signatures: []apkSignature{{ID: st.id, Value: sigv}},
+			PublicKey:  cert.Leaf.RawSubjectPublicKeyInfo,
+		}})
+		if err != nil {
+			return nil, err
+		}
+		pairs = append([]sigPair{{ID: sigApkV2, Value: sblob}}, pairs...)
 	}
-	// build signer block
-	signerList := []apkSigner{apkSigner{
-		SignedData: signedData,
-		Signatures: []apkSignature{apkSignature{ID: st.id, Value: sigv}},
-		PublicKey:  cert.Leaf.RawSubjectPublicKeyInfo,
-	}}
-	sblob, err := marshal(signerList)
-	if err != nil {
-		return nil, err
+	if bo.v3 || bo.v31 {
+		var lineageAttr apkRaw
+		if len(bo.lineage) != 0 {
+			lineage, err := ParseLineage(bo.lineage)
+			if err != nil {
+				return nil, err
+			}
+			if !bytes.Equal(lineage.Latest().Raw, cert.Leaf.Raw) {
+				return nil, errors.New("APK lineage does not end with the signing certificate")
+			}
+			lineageAttr = makeAttribute(attrProofOfRotation, bo.lineage)
+		}
+		if bo.v3 {
+			var attrs []apkRaw
+			if lineageAttr != nil && !bo.v31 {
+				attrs = append(attrs, lineageAttr)
+			}
+			if bo.rotationMinSDK != 0 {
+				attrs = append(attrs, makeAttribute(attrRotationMinSDK, uint32Bytes(bo.rotationMinSDK)))
+			}
+			sblob, err := d.signV3(cert, st, digests, certs, minSDKv3, attrs)
+			if err != nil {
+				return nil, err
+			}
+			pairs = append(pairs, sigPair{ID: sigApkV3, Value: sblob})
+		}
+		if bo.v31 {
+			minSDK := bo.rotationMinSDK
+			if minSDK == 0 {
+				minSDK = minSDKv31
+			}
+			var attrs []apkRaw
+			if lineageAttr != nil {
+				attrs = append(attrs, lineageAttr)
+			}
+			sblob, err := d.signV3(cert, st, digests, certs, minSDK, attrs)
+			if err != nil {
+				return nil, err
+			}
+			pairs = append(pairs, sigPair{ID: sigApkV31, Value: sblob})
+		}
 	}
-	block := makeSigBlock(sblob)
+	block := makeSigBlock(pairs...)
 	// patch
 	patchset := binpatch.New()
 	origDirLoc := d.inz.DirLoc
@@ -124,19 +204,100 @@ func (d *Digest) Sign(cert *certloader.Certificate) (*binpatch.PatchSet, error)
 	return patchset, nil
 }
 
-func makeSigBlock(sblob []byte) []byte {
-	block := make([]byte, 8+12+len(sblob)+24)
+func (d *Digest) signV3(cert *certloader.Certificate, st sigType, digests []apkDigest, certs [][]byte, minSDK uint32, attrs []apkRaw) ([]byte, error) {
+	signedData, err := marshal(apkV3SignedData{
+		Digests:      digests,
+		Certificates: certs,
+		MinSDK:       minSDK,
+		MaxSDK:       maxSDK,
+		Attributes:   attrs,
+	})
+	if err != nil {
+		return nil, err
+	}
+	sigv, err := signSignedData(cert, st, signedData)
+	if err != nil {
+		return nil, err
+	}
+	return marshal([]apkV3Signer{{
+		SignedData: signedData,
+		MinSDK:     minSDK,
+		MaxSDK:     maxSDK,
+		Signatures: []apkSignature{{ID: st.id, Value: sigv}},
+		PublicKey:  cert.Leaf.RawSubjectPublicKeyInfo,
+	}})
+}
+
+func signSignedData(cert *certloader.Certificate, st sigType, signedData apkRaw) ([]byte, error) {
+	digest := st.hash.New()
+	digest.Write(signedData.Bytes())
+	return cert.Signer().Sign(rand.Reader, digest.Sum(nil), st.signerOpts())
+}
+
+func uint32Bytes(v uint32) []byte {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], v)
+	return b[:]
+}
+
+type sigPair struct {
+	ID    uint32
+	Value []byte
+}
+
+func makeSigBlock(pairs ...sigPair) []byte {
+	size := 8 + 24
+	for _, pair := range pairs {
+		size += 12 + len(pair.Value)
+	}
+	block := make([]byte, size)
 	// length prefix on signing block, includes the magic suffix but not itself
-	binary.LittleEndian.PutUint64(block, uint64(8+4+len(sblob)+8+16))
-	// length prefix on the inner block
-	binary.LittleEndian.PutUint64(block[8:], uint64(4+len(sblob)))
-	// block type
-	binary.LittleEndian.PutUint32(block[8+8:], sigApkV2)
-	// the block itself
-	copy(block[8+8+4:], sblob)
+	binary.LittleEndian.PutUint64(block, uint64(size-8))
+	pos := 8
+	for _, pair := range pairs {
+		// length prefix on the inner block
+		binary.LittleEndian.PutUint64(block[pos:], uint64(4+len(pair.Value)))
+		// block type
+		binary.LittleEndian.PutUint32(block[pos+8:], pair.ID)
+		// the block itself
+		copy(block[pos+12:], pair.Value)
+		pos += 12 + len(pair.Value)
+	}
 	// magic suffix
-	suffix := block[8+8+4+len(sblob):]
+	suffix := block[pos:]
 	copy(suffix, block[:8])    // length again
 	copy(suffix[8:], sigMagic) // magic
 	return block
 }
+
+// split the contents of a signing block, as returned by GetTrailer, into its
+// ID-value pairs
+func splitSigBlock(blob []byte) ([]sigPair, error) {
+	if !bytes.HasSuffix(blob, []byte(sigMagic)) || len(blob) < 32 {
+		return nil, errMalformed
+	}
+	expected := uint64(len(blob) - 8)
+	size1 := binary.LittleEndian.Uint64(blob)
+	size2 := binary.LittleEndian.Uint64(blob[len(blob)-24:])
+	if size1 != expected || size2 != expected {
+		return nil, errMalformed
+	}
+	block := blob[8 : len(blob)-24]
+	var pairs []sigPair
+	for len(block) > 0 {
+		if len(block) < 12 {
+			return nil, errTruncated
+		}
+		partSize := binary.LittleEndian.Uint64(block)
+		block = block[8:]
+		if partSize < 4 || partSize > uint64(len(block)) {
+			return nil, errTruncated
+		}
+		pairs = append(pairs, sigPair{
+			ID:    binary.LittleEndian.Uint32(block),
+			Value: block[4:partSize],
+		})
+		block = block[partSize:]
+	}
+	return pairs, nil
+}
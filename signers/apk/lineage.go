@@ -0,0 +1,184 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package apk
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// Proof-of-rotation lineage, carried in v3 signed data so that a package
+// signed with a new key is accepted as an update to one signed by an older key.
+// Each node holds a certificate signed by the key of the node before it.
+
+const (
+	lineageVersion = 1
+
+	// capabilities granted to a past signer
+	lineageInstalledData = 1 << 0
+	lineageSharedUID     = 1 << 1
+	lineagePermission    = 1 << 2
+	lineageRollback      = 1 << 3
+	lineageAuth          = 1 << 4
+
+	lineageDefaultFlags = lineageInstalledData | lineageSharedUID | lineagePermission | lineageAuth
+)
+
+type lineageNode struct {
+	SignedData   apkRaw
+	Flags        uint32
+	SigAlgorithm uint32
+	Signature    []byte
+}
+
+type lineageSignedData struct {
+	Certificate        []byte
+	ParentSigAlgorithm uint32
+}
+
+// Lineage is an ordered list of signing certificates, oldest first
+type Lineage struct {
+	nodes []lineageNode
+	certs []*x509.Certificate
+}
+
+// NewLineage starts a lineage whose oldest member is the given certificate
+func NewLineage(first *x509.Certificate) (*Lineage, error) {
+	sd, err := marshal(lineageSignedData{Certificate: first.Raw})
+	if err != nil {
+		return nil, err
+	}
+	return &Lineage{
+		nodes: []lineageNode{{SignedData: sd, Flags: lineageDefaultFlags}},
+		certs: []*x509.Certificate{first},
+	}, nil
+}
+
+// ParseLineage parses and verifies a lineage in the encoding used by the v3
+// proof-of-rotation attribute
+func ParseLineage(blob []byte) (*Lineage, error) {
+	if len(blob) < 4 {
+		return nil, errors.New("lineage is truncated")
+	}
+	if v := binary.LittleEndian.Uint32(blob); v != lineageVersion {
+		return nil, fmt.Errorf("unsupported lineage version %d", v)
+	}
+	blob = blob[4:]
+	l := new(Lineage)
+	for len(blob) > 0 {
+		var node lineageNode
+		var err error
+		blob, err = unmarshalR(blob, reflect.ValueOf(&node).Elem())
+		if err != nil {
+			return nil, fmt.Errorf("parsing lineage: %w", err)
+		}
+		var sd lineageSignedData
+		if err := unmarshal(node.SignedData, &sd); err != nil {
+			return nil, fmt.Errorf("parsing lineage: %w", err)
+		}
+		cert, err := x509.ParseCertificate(sd.Certificate)
+		if err != nil {
+			return nil, fmt.Errorf("parsing lineage: %w", err)
+		}
+		if n := len(l.nodes); n > 0 {
+			// each certificate is signed by the previous one, using the
+			// algorithm the previous node declares
+			parent := l.nodes[n-1]
+			if sd.ParentSigAlgorithm != parent.SigAlgorithm {
+				return nil, fmt.Errorf("lineage node %d: signature algorithm mismatch", n+1)
+			}
+			sig := apkSignature{ID: parent.SigAlgorithm, Value: node.Signature}
+			if _, err := sig.VerifySignature(l.certs[n-1].PublicKey, node.SignedData.Bytes()); err != nil {
+				return nil, fmt.Errorf("lineage node %d: %w", n+1, err)
+			}
+		}
+		l.nodes = append(l.nodes, node)
+		l.certs = append(l.certs, cert)
+	}
+	if len(l.nodes) == 0 {
+		return nil, errors.New("lineage is empty")
+	}
+	return l, nil
+}
+
+// Certificates returns the members of the lineage, oldest first
+func (l *Lineage) Certificates() []*x509.Certificate {
+	return l.certs
+}
+
+// Latest returns the newest certificate in the lineage
+func (l *Lineage) Latest() *x509.Certificate {
+	return l.certs[len(l.certs)-1]
+}
+
+// Extend adds a new certificate to the lineage, signed by the private key of
+// the current newest member
+func (l *Lineage) Extend(signer crypto.Signer, next *x509.Certificate, hash crypto.Hash) error {
+	last := &l.nodes[len(l.nodes)-1]
+	if !bytes.Equal(l.Latest().RawSubjectPublicKeyInfo, marshalPub(signer.Public())) {
+		return errors.New("signing key does not match the newest certificate in the lineage")
+	}
+	st, err := sigTypeFor(signer.Public(), hash, false)
+	if err != nil {
+		return err
+	}
+	// the algorithm lives outside of the signed data, so it can be filled in
+	// once the next key is known
+	last.SigAlgorithm = st.id
+	sd, err := marshal(lineageSignedData{Certificate: next.Raw, ParentSigAlgorithm: st.id})
+	if err != nil {
+		return err
+	}
+	d := st.hash.New()
+	d.Write(sd.Bytes())
+	sig, err := signer.Sign(rand.Reader, d.Sum(nil), st.hash)
+	if err != nil {
+		return err
+	}
+	l.nodes = append(l.nodes, lineageNode{
+		SignedData: sd,
+		Flags:      lineageDefaultFlags,
+		Signature:  sig,
+	})
+	l.certs = append(l.certs, next)
+	return nil
+}
+
+// Marshal encodes the lineage for storage or for use as a v3 attribute
+func (l *Lineage) Marshal() ([]byte, error) {
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(lineageVersion))
+	for _, node := range l.nodes {
+		raw, err := marshal(node)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(raw)
+	}
+	return buf.Bytes(), nil
+}
+
+func marshalPub(pub crypto.PublicKey) []byte {
+	der, _ := x509.MarshalPKIXPublicKey(pub)
+	return der
+}
@@ -18,7 +18,9 @@ package apk
 
 import (
 	"errors"
+	"fmt"
 	"io"
+	"strconv"
 
 	"github.com/sassoftware/relic/v7/lib/certloader"
 	"github.com/sassoftware/relic/v7/lib/magic"
@@ -32,14 +34,26 @@ var ApkSigner = &signers.Signer{
 	Name:      "apk",
 	Magic:     magic.FileTypeAPK,
 	CertTypes: signers.CertTypeX509,
-	Transform: zipbased.Transform,
+	Transform: transform,
 	Sign:      sign,
 	Verify:    verify,
+
+	RemoveSignature: zipbased.RemoveSignature,
 }
 
 const (
-	sigMagic = "APK Sig Block 42"
-	sigApkV2 = 0x7109871a
+	sigMagic  = "APK Sig Block 42"
+	sigApkV2  = 0x7109871a
+	sigApkV3  = 0xf05368c0
+	sigApkV31 = 0x1b93ad61
+
+	attrStrippingProtection = 0xbeeff00d
+	attrProofOfRotation     = 0x3ba06f8c
+	attrRotationMinSDK      = 0x559f8b02
+
+	minSDKv3  = 28 // Android 9
+	minSDKv31 = 33 // Android 13
+	maxSDK    = 0x7fffffff
 )
 
 var (
@@ -48,17 +62,53 @@ var (
 )
 
 func init() {
+	ApkSigner.Flags().Bool("apk-v1", false, "(APK) Also create a v1 JAR signature in the same operation")
+	ApkSigner.Flags().Bool("apk-v4", false, "(APK) Also write a v4 signature to FILE.idsig for incremental installs")
+	ApkSigner.Flags().Bool("apk-v3", false, "(APK) Add a v3 signature, keeping any existing v2 signature")
+	ApkSigner.Flags().Bool("apk-v31", false, "(APK) Add a v3.1 signature for the rotated key, keeping any existing v2 and v3 signatures")
+	ApkSigner.Flags().String("apk-rotation-min-sdk", "", "(APK) Lowest SDK version that uses the rotated key in a v3.1 signature")
+	ApkSigner.Flags().Bool("apk-pss", false, "(APK) Use RSASSA-PSS padding for RSA keys")
+	ApkSigner.Flags().String("key-alias", "RELIC", "(JAR, APK, AAB) Alias to use for the signed manifest")
 	signers.Register(ApkSigner)
 }
 
 func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	if opts.Flags.GetBool("apk-v1") || opts.Flags.GetBool("apk-v4") {
+		return signSpooled(r, cert, opts)
+	}
+	bo, err := getBlockOptions(cert, opts)
+	if err != nil {
+		return nil, err
+	}
 	digest, err := digestApkStream(r, opts.Hash)
 	if err != nil {
 		return nil, err
 	}
-	patchset, err := digest.Sign(cert)
+	patchset, err := digest.SignBlocks(cert, bo)
 	if err != nil {
 		return nil, err
 	}
 	return opts.SetBinPatch(patchset)
 }
+
+func getBlockOptions(cert *certloader.Certificate, opts signers.SignOpts) (bo blockOptions, err error) {
+	bo.v3 = opts.Flags.GetBool("apk-v3")
+	bo.v31 = opts.Flags.GetBool("apk-v31")
+	bo.v2 = !bo.v3 && !bo.v31
+	bo.pss = opts.Flags.GetBool("apk-pss")
+	// check the key before anything is signed
+	if _, err := sigTypeFor(cert.Leaf.PublicKey, opts.Hash, bo.pss); err != nil {
+		return bo, err
+	}
+	if v := opts.Flags.GetString("apk-rotation-min-sdk"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 32)
+		if err != nil || n < minSDKv3 {
+			return bo, fmt.Errorf("invalid apk-rotation-min-sdk %q", v)
+		}
+		bo.rotationMinSDK = uint32(n)
+	}
+	if bo.v3 || bo.v31 {
+		bo.lineage = cert.ApkLineage
+	}
+	return bo, nil
+}
@@ -0,0 +1,185 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package apk
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/sassoftware/relic/v7/lib/binpatch"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/signjar"
+	"github.com/sassoftware/relic/v7/lib/zipslicer"
+	"github.com/sassoftware/relic/v7/signers"
+)
+
+// Sign a copy of the package spooled to disk, for the signature types that
+// need to read it more than once or to see the result of an earlier step.
+//
+// For v1, the v2 digest covers the archive as it looks after the v1 signature
+// is inserted, so the JAR signature is applied to a scratch copy first and the
+// two patches are then merged into one that applies to the original file. For
+// v4, the .idsig covers the finished package and is returned alongside the
+// patch.
+func signSpooled(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	bo, err := getBlockOptions(cert, opts)
+	if err != nil {
+		return nil, err
+	}
+	tmpdir, err := os.MkdirTemp("", "relic-apk-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpdir)
+	orig, err := spoolZipTar(r, filepath.Join(tmpdir, "orig.apk"))
+	if err != nil {
+		return nil, err
+	}
+	defer orig.Close()
+	origSize, err := orig.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	mid := orig
+	var v1patch *binpatch.PatchSet
+	if opts.Flags.GetBool("apk-v1") {
+		mid, v1patch, err = signV1(orig, origSize, filepath.Join(tmpdir, "v1.apk"), cert, opts)
+		if err != nil {
+			return nil, err
+		}
+		defer mid.Close()
+	}
+	midSize, err := mid.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	midz, err := zipslicer.Read(mid, midSize)
+	if err != nil {
+		return nil, err
+	}
+	// v2 and later signatures over the v1-signed archive
+	digest, err := digestApk(midz, opts.Hash)
+	if err != nil {
+		return nil, err
+	}
+	sigLoc, midDirLoc := digest.sigLoc, digest.inz.DirLoc
+	v2patch, err := digest.SignBlocks(cert, bo)
+	if err != nil {
+		return nil, err
+	}
+	patch := v2patch
+	var final *os.File
+	if v1patch != nil || opts.Flags.GetBool("apk-v4") {
+		finalPath := filepath.Join(tmpdir, "final.apk")
+		if err := v2patch.Apply(mid, finalPath); err != nil {
+			return nil, err
+		}
+		final, err = os.Open(finalPath)
+		if err != nil {
+			return nil, err
+		}
+		defer final.Close()
+	}
+	if v1patch != nil {
+		patch, err = mergePatches(v1patch, final, origSize, sigLoc, midDirLoc)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !opts.Flags.GetBool("apk-v4") {
+		return opts.SetBinPatch(patch)
+	}
+	idsig, err := makeIdsig(final, digest, cert, bo.pss)
+	if err != nil {
+		return nil, err
+	}
+	opts.Audit.SetMimeType(idsigBundleType)
+	return makeBundle(patch.Dump(), idsig), nil
+}
+
+// sign the JAR manifest and write the v1-signed package to a new file
+func signV1(orig *os.File, origSize int64, midPath string, cert *certloader.Certificate, opts signers.SignOpts) (*os.File, *binpatch.PatchSet, error) {
+	alias := opts.Flags.GetString("key-alias")
+	if alias == "" {
+		alias = "RELIC"
+	}
+	inz, err := zipslicer.Read(orig, origSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	// mark the signature so that verifiers know to expect the v2 block
+	jd, err := signjar.DigestJar(inz, opts.Hash)
+	if err != nil {
+		return nil, nil, err
+	}
+	v1patch, ts, err := jd.Sign(opts.Context(), cert, alias, false, false, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	opts.Audit.SetCounterSignature(ts.CounterSignature)
+	if err := v1patch.Apply(orig, midPath); err != nil {
+		return nil, nil, err
+	}
+	mid, err := os.Open(midPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return mid, v1patch, nil
+}
+
+// Combine the v1 patch against the original file with the signing block
+// written to the v1-signed copy, giving a single patch against the original.
+func mergePatches(v1patch *binpatch.PatchSet, final *os.File, origSize, sigLoc, midDirLoc int64) (*binpatch.PatchSet, error) {
+	finalSize, err := final.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	tail := make([]byte, finalSize-sigLoc)
+	if _, err := final.ReadAt(tail, sigLoc); err != nil {
+		return nil, err
+	}
+	// The last v1 patch rewrites the central directory at the end of the
+	// file. Replace it with one that also covers any old signing block and
+	// writes the new block, directory and end record.
+	last := len(v1patch.Patches) - 1
+	if last < 0 {
+		return nil, errors.New("empty JAR signature patch")
+	}
+	start := v1patch.Patches[last].Offset - (midDirLoc - sigLoc)
+	patch := binpatch.New()
+	for i, p := range v1patch.Patches[:last] {
+		patch.Add(p.Offset, int64(p.OldSize), v1patch.Blobs[i])
+	}
+	patch.Add(start, origSize-start, tail)
+	return patch, nil
+}
+
+// copy the zip member of a ZipToTar stream to a file so it can be read more
+// than once
+func spoolZipTar(r io.Reader, name string) (*os.File, error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := zipslicer.CopyZipTar(r, f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
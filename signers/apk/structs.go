@@ -18,8 +18,12 @@ package apk
 
 import (
 	"crypto"
+	"crypto/rsa"
 	"crypto/x509"
+	"encoding/binary"
 	"fmt"
+
+	"github.com/sassoftware/relic/v7/lib/x509tools"
 )
 
 type apkSigner struct {
@@ -31,7 +35,25 @@ type apkSigner struct {
 type apkSignedData struct {
 	Digests      []apkDigest
 	Certificates [][]byte
-	Attributes   []apkAttribute
+	Attributes   []apkRaw
+}
+
+// v3 and v3.1 signers add a supported SDK range both inside and outside the
+// signed data
+type apkV3Signer struct {
+	SignedData apkRaw
+	MinSDK     uint32
+	MaxSDK     uint32
+	Signatures []apkSignature
+	PublicKey  []byte
+}
+
+type apkV3SignedData struct {
+	Digests      []apkDigest
+	Certificates [][]byte
+	MinSDK       uint32
+	MaxSDK       uint32
+	Attributes   []apkRaw
 }
 
 type apkAttribute struct {
@@ -39,6 +61,26 @@ type apkAttribute struct {
 	Value []byte
 }
 
+// Additional attributes of signed data are not length-prefixed inside, unlike
+// digests and signatures, so they are kept as raw items
+func makeAttribute(id uint32, value []byte) apkRaw {
+	raw := make([]byte, 8+len(value))
+	binary.LittleEndian.PutUint32(raw, uint32(4+len(value)))
+	binary.LittleEndian.PutUint32(raw[4:], id)
+	copy(raw[8:], value)
+	return raw
+}
+
+func findAttribute(attrs []apkRaw, id uint32) []byte {
+	for _, attr := range attrs {
+		v := attr.Bytes()
+		if len(v) >= 4 && binary.LittleEndian.Uint32(v) == id {
+			return v[4:]
+		}
+	}
+	return nil
+}
+
 type apkSignature apkAttribute
 type apkDigest apkAttribute
 
@@ -70,6 +112,29 @@ var sigTypes = []sigType{
 	sigType{0x0301, crypto.SHA256, x509.DSA, false},   // DSA with SHA2-256 digest
 }
 
+// pick the signature type for a key and digest. RSA keys use PKCS#1 v1.5
+// padding unless pss is set.
+func sigTypeFor(pub crypto.PublicKey, hash crypto.Hash, pss bool) (st sigType, err error) {
+	alg := x509tools.GetPublicKeyAlgorithm(pub)
+	if pss && alg != x509.RSA {
+		return st, fmt.Errorf("PSS padding requires a RSA key, not %s", alg)
+	}
+	for _, s := range sigTypes {
+		if s.hash == hash && s.alg == alg && s.pss == pss {
+			return s, nil
+		}
+	}
+	return st, fmt.Errorf("APK signatures do not support %s keys with digest %s", alg, hash)
+}
+
+// options for signing a digest with this signature type
+func (st sigType) signerOpts() crypto.SignerOpts {
+	if st.pss {
+		return &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: st.hash}
+	}
+	return st.hash
+}
+
 func sigTypeByID(id uint32) (st sigType, err error) {
 	for _, s := range sigTypes {
 		if s.id == id {
@@ -0,0 +1,168 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package apk
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/sassoftware/relic/v7/lib/atomicfile"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/fsverity"
+	"github.com/sassoftware/relic/v7/signers"
+	"github.com/sassoftware/relic/v7/signers/zipbased"
+)
+
+// APK Signature Scheme v4 is a detached .idsig file holding an fs-verity
+// Merkle tree of the finished package, plus a signature over its root hash and
+// the v2/v3 content digest. Android 11+ uses it for incremental installs.
+
+const (
+	idsigVersion    = 2
+	idsigHashSHA256 = 1
+	idsigLog2Block  = 12
+	idsigBlockSize  = 1 << idsigLog2Block
+	idsigFileSuffix = ".idsig"
+
+	// signing result holding both the binpatch and the .idsig, prefixed by
+	// the patch length
+	idsigBundleType  = "application/x-apk-idsig-bundle"
+	bundlePatchLenSz = 4
+)
+
+func transform(f *os.File, opts signers.SignOpts) (signers.Transformer, error) {
+	t, err := zipbased.Transform(f, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &apkTransformer{Transformer: t, f: f}, nil
+}
+
+type apkTransformer struct {
+	signers.Transformer
+	f *os.File
+}
+
+// Apply the patch and, if the result includes a v4 signature, write it next to
+// the package
+func (t *apkTransformer) Apply(dest, mimeType string, result io.Reader) error {
+	if mimeType != idsigBundleType {
+		return t.Transformer.Apply(dest, mimeType, result)
+	}
+	if dest == "-" {
+		return errors.New("can't write a v4 signature when the package is written to standard output")
+	}
+	blob, err := io.ReadAll(result)
+	if err != nil {
+		return err
+	}
+	if len(blob) < bundlePatchLenSz {
+		return errors.New("truncated APK signature bundle")
+	}
+	patchLen := int(binary.BigEndian.Uint32(blob))
+	blob = blob[bundlePatchLenSz:]
+	if patchLen > len(blob) {
+		return errors.New("truncated APK signature bundle")
+	}
+	if err := signers.ApplyBinPatch(t.f, dest, bytes.NewReader(blob[:patchLen])); err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(dest+idsigFileSuffix, blob[patchLen:])
+}
+
+func makeBundle(patch, idsig []byte) []byte {
+	bundle := make([]byte, bundlePatchLenSz, bundlePatchLenSz+len(patch)+len(idsig))
+	binary.BigEndian.PutUint32(bundle, uint32(len(patch)))
+	bundle = append(bundle, patch...)
+	return append(bundle, idsig...)
+}
+
+// Build the .idsig for a finished package
+func makeIdsig(f *os.File, d *Digest, cert *certloader.Certificate, pss bool) ([]byte, error) {
+	st, err := sigTypeFor(cert.Leaf.PublicKey, d.hash, pss)
+	if err != nil {
+		return nil, err
+	}
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	tree, rootHash, _, err := fsverity.MerkleTree(io.NewSectionReader(f, 0, size), fsverity.Params{
+		Hash:      crypto.SHA256,
+		BlockSize: idsigBlockSize,
+	})
+	if err != nil {
+		return nil, err
+	}
+	// hashing info
+	var hashingInfo bytes.Buffer
+	writeUint32(&hashingInfo, idsigHashSHA256)
+	hashingInfo.WriteByte(idsigLog2Block)
+	writeBytes(&hashingInfo, nil) // salt
+	writeBytes(&hashingInfo, rootHash)
+	// the signature covers the file size, hashing info, content digest and
+	// certificate
+	certDER := cert.Leaf.Raw
+	var signedData bytes.Buffer
+	sdSize := 4 + 8 + 4 + 1 + (4 + 0) + (4 + len(rootHash)) + (4 + len(d.value)) + (4 + len(certDER)) + (4 + 0)
+	writeUint32(&signedData, uint32(sdSize))
+	_ = binary.Write(&signedData, binary.LittleEndian, uint64(size))
+	writeUint32(&signedData, idsigHashSHA256)
+	signedData.WriteByte(idsigLog2Block)
+	writeBytes(&signedData, nil)
+	writeBytes(&signedData, rootHash)
+	writeBytes(&signedData, d.value)
+	writeBytes(&signedData, certDER)
+	writeBytes(&signedData, nil) // additional data
+	digest := st.hash.New()
+	digest.Write(signedData.Bytes())
+	sigv, err := cert.Signer().Sign(rand.Reader, digest.Sum(nil), st.signerOpts())
+	if err != nil {
+		return nil, err
+	}
+	// signing info
+	var signingInfo bytes.Buffer
+	writeBytes(&signingInfo, d.value)
+	writeBytes(&signingInfo, certDER)
+	writeBytes(&signingInfo, nil) // additional data
+	writeBytes(&signingInfo, cert.Leaf.RawSubjectPublicKeyInfo)
+	writeUint32(&signingInfo, st.id)
+	writeBytes(&signingInfo, sigv)
+	var signingInfos bytes.Buffer
+	writeBytes(&signingInfos, signingInfo.Bytes())
+	// assemble
+	var out bytes.Buffer
+	writeUint32(&out, idsigVersion)
+	writeBytes(&out, hashingInfo.Bytes())
+	writeBytes(&out, signingInfos.Bytes())
+	writeBytes(&out, tree)
+	return out.Bytes(), nil
+}
+
+func writeUint32(w *bytes.Buffer, v uint32) {
+	_ = binary.Write(w, binary.LittleEndian, v)
+}
+
+func writeBytes(w *bytes.Buffer, d []byte) {
+	writeUint32(w, uint32(len(d)))
+	w.Write(d)
+}
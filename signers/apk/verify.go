@@ -41,42 +41,64 @@ import (
 )
 
 func verify(f *os.File, opts signers.VerifyOpts) ([]*signers.Signature, error) {
-	// verify v2
+	// verify v2 and v3
 	inz, block, err := getSigBlock(f)
 	if err != nil {
 		return nil, err
 	}
-	var allSigs []*signers.Signature
-	for len(block) > 0 {
-		if len(block) < 12 {
-			return nil, errTruncated
-		}
-		partSize := binary.LittleEndian.Uint64(block)
-		block = block[8:]
-		if partSize < 4 || partSize > uint64(len(block)) {
-			return nil, errTruncated
-		}
-		partType := binary.LittleEndian.Uint32(block)
-		partBlob := block[4:partSize]
-		block = block[partSize:]
-		if partType != sigApkV2 {
-			continue
-		}
-		var signerList []apkSigner
-		if err := unmarshal(partBlob, &signerList); err != nil {
-			return nil, fmt.Errorf("parsing signature block: %w", err)
-		} else if len(signerList) == 0 {
-			return nil, errors.New("empty APK signing block")
+	var pairs []sigPair
+	if block != nil {
+		pairs, err = splitSigBlock(block)
+		if err != nil {
+			return nil, err
 		}
-		for i, signer := range signerList {
-			sig, err := signer.Verify(nil)
-			if err != nil {
-				return nil, fmt.Errorf("APK signature #%d: %w", i+1, err)
+	}
+	var allSigs []*signers.Signature
+	var v2present, v3present, v3required bool
+	for _, pair := range pairs {
+		switch pair.ID {
+		case sigApkV2:
+			var signerList []apkSigner
+			if err := unmarshal(pair.Value, &signerList); err != nil {
+				return nil, fmt.Errorf("parsing signature block: %w", err)
+			} else if len(signerList) == 0 {
+				return nil, errors.New("empty APK signing block")
+			}
+			for i, signer := range signerList {
+				sig, err := signer.Verify(nil)
+				if err != nil {
+					return nil, fmt.Errorf("APK signature #%d: %w", i+1, err)
+				}
+				if signer.strippingProtection() >= 3 {
+					v3required = true
+				}
+				allSigs = append(allSigs, sig)
+			}
+			v2present = true
+		case sigApkV3, sigApkV31:
+			version := "v3"
+			if pair.ID == sigApkV31 {
+				version = "v3.1"
+			}
+			var signerList []apkV3Signer
+			if err := unmarshal(pair.Value, &signerList); err != nil {
+				return nil, fmt.Errorf("parsing %s signature block: %w", version, err)
+			} else if len(signerList) == 0 {
+				return nil, fmt.Errorf("empty APK %s signing block", version)
 			}
-			allSigs = append(allSigs, sig)
+			for i, signer := range signerList {
+				sig, err := signer.Verify(nil, version)
+				if err != nil {
+					return nil, fmt.Errorf("APK %s signature #%d: %w", version, i+1, err)
+				}
+				allSigs = append(allSigs, sig)
+			}
+			v3present = true
 		}
 	}
-	v2present := len(allSigs) != 0
+	if v3required && !v3present {
+		return nil, errors.New("V2 signature indicates a V3 signature but none exists")
+	}
 	// verify v1
 	inzr, err := zip.NewReader(f, inz.Size)
 	if err != nil {
@@ -93,6 +115,9 @@ func verify(f *os.File, opts signers.VerifyOpts) ([]*signers.Signature, error) {
 		if strings.ContainsRune(apk, '2') && !v2present {
 			return nil, errors.New("V1 signature contains X-Android-APK-Signed header but no V2 signature exists")
 		}
+		if strings.ContainsRune(apk, '3') && !v3present {
+			return nil, errors.New("V1 signature contains X-Android-APK-Signed header but no V3 signature exists")
+		}
 		allSigs = append(allSigs, &signers.Signature{
 			SigInfo:       "v1",
 			Hash:          jarSig.Hash,
@@ -131,31 +156,78 @@ func getSigBlock(f *os.File) (*zipslicer.Directory, []byte, error) {
 	if _, err := f.ReadAt(blob, sigLoc); err != nil {
 		return nil, nil, err
 	}
-	// check magic
-	if !bytes.HasSuffix(blob, []byte(sigMagic)) {
-		return nil, nil, errMalformed
+	return inz, blob, nil
+}
+
+func (s *apkSigner) Verify(inz *zipslicer.Directory) (*signers.Signature, error) {
+	var signedData apkSignedData
+	if err := unmarshal(s.SignedData, &signedData); err != nil {
+		return nil, err
 	}
-	expected := uint64(len(blob) - 8)
-	size1 := binary.LittleEndian.Uint64(blob)
-	size2 := binary.LittleEndian.Uint64(blob[len(blob)-24:])
-	if size1 != expected || size2 != expected {
-		return nil, nil, errMalformed
+	sig, err := verifySigner(s.SignedData, s.Signatures, s.PublicKey, &signedData, inz)
+	if err != nil {
+		return nil, err
 	}
-	return inz, blob[8 : len(blob)-24], nil
+	sig.SigInfo = "v2"
+	return sig, nil
 }
 
-func (s *apkSigner) Verify(inz *zipslicer.Directory) (*signers.Signature, error) {
-	if len(s.Signatures) == 0 {
+// return the highest signature scheme version that the v2 signer claims is
+// also present, if any
+func (s *apkSigner) strippingProtection() uint32 {
+	var signedData apkSignedData
+	if err := unmarshal(s.SignedData, &signedData); err != nil {
+		return 0
+	}
+	v := findAttribute(signedData.Attributes, attrStrippingProtection)
+	if len(v) < 4 {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(v)
+}
+
+func (s *apkV3Signer) Verify(inz *zipslicer.Directory, version string) (*signers.Signature, error) {
+	var signedData apkV3SignedData
+	if err := unmarshal(s.SignedData, &signedData); err != nil {
+		return nil, err
+	}
+	if signedData.MinSDK != s.MinSDK || signedData.MaxSDK != s.MaxSDK {
+		return nil, errors.New("SDK version range does not match signed data")
+	}
+	sig, err := verifySigner(s.SignedData, s.Signatures, s.PublicKey, &apkSignedData{
+		Digests:      signedData.Digests,
+		Certificates: signedData.Certificates,
+		Attributes:   signedData.Attributes,
+	}, inz)
+	if err != nil {
+		return nil, err
+	}
+	sig.SigInfo = version
+	if blob := findAttribute(signedData.Attributes, attrProofOfRotation); blob != nil {
+		lineage, err := ParseLineage(blob)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(lineage.Latest().Raw, sig.X509Signature.Certificate.Raw) {
+			return nil, errors.New("lineage does not end with the signing certificate")
+		}
+		sig.SigInfo += fmt.Sprintf("[lineage:%d]", len(lineage.Certificates()))
+	}
+	return sig, nil
+}
+
+func verifySigner(rawSignedData apkRaw, sigs []apkSignature, pubKey []byte, signedData *apkSignedData, inz *zipslicer.Directory) (*signers.Signature, error) {
+	if len(sigs) == 0 {
 		return nil, errors.New("no signatures in APK signer block")
 	}
 	// check signatures over SignedData
-	publicKey, err := x509.ParsePKIXPublicKey(s.PublicKey)
+	publicKey, err := x509.ParsePKIXPublicKey(pubKey)
 	if err != nil {
 		return nil, err
 	}
 	var bestHash crypto.Hash
-	for _, sig := range s.Signatures {
-		hash, err := sig.VerifySignature(publicKey, s.SignedData.Bytes())
+	for _, sig := range sigs {
+		hash, err := sig.VerifySignature(publicKey, rawSignedData.Bytes())
 		if err != nil {
 			return nil, err
 		}
@@ -165,10 +237,6 @@ func (s *apkSigner) Verify(inz *zipslicer.Directory) (*signers.Signature, error)
 		}
 	}
 	// check digests
-	var signedData apkSignedData
-	if err := unmarshal(s.SignedData, &signedData); err != nil {
-		return nil, err
-	}
 	if len(signedData.Digests) == 0 {
 		return nil, errors.New("no digests in APK signed data block")
 	}
@@ -205,7 +273,7 @@ func (s *apkSigner) Verify(inz *zipslicer.Directory) (*signers.Signature, error)
 	var leaf *x509.Certificate
 	var intermediates []*x509.Certificate
 	for _, cert := range certs {
-		if bytes.Equal(cert.RawSubjectPublicKeyInfo, s.PublicKey) {
+		if bytes.Equal(cert.RawSubjectPublicKeyInfo, pubKey) {
 			leaf = cert
 		} else {
 			intermediates = append(intermediates, cert)
@@ -215,8 +283,7 @@ func (s *apkSigner) Verify(inz *zipslicer.Directory) (*signers.Signature, error)
 		return nil, errors.New("public key does not match any certificate")
 	}
 	return &signers.Signature{
-		SigInfo: "v2",
-		Hash:    bestHash,
+		Hash: bestHash,
 		X509Signature: &pkcs9.TimestampedSignature{
 			Signature: pkcs7.Signature{
 				Certificate:   leaf,
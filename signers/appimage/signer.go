@@ -0,0 +1,98 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package appimage
+
+// Sign type 2 AppImages the same way as appimagetool --sign
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"golang.org/x/crypto/openpgp/packet"
+
+	"github.com/sassoftware/relic/v7/lib/appimage"
+	"github.com/sassoftware/relic/v7/lib/audit"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/signers"
+)
+
+var AppImageSigner = &signers.Signer{
+	Name:      "appimage",
+	CertTypes: signers.CertTypePgp,
+	TestPath:  testPath,
+	FormatLog: formatLog,
+	Sign:      sign,
+	Verify:    verify,
+}
+
+func init() {
+	signers.Register(AppImageSigner)
+}
+
+func testPath(fp string) bool {
+	return strings.HasSuffix(strings.ToLower(fp), ".appimage")
+}
+
+func formatLog(attrs *audit.Info) *zerolog.Event {
+	return attrs.AttrsForLog("appimage.")
+}
+
+func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	blob, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	img, err := appimage.Parse(blob)
+	if err != nil {
+		return nil, err
+	}
+	config := &packet.Config{
+		DefaultHash: opts.Hash,
+		Time:        func() time.Time { return opts.Time },
+	}
+	patch, err := img.Sign(cert.PgpKey, config)
+	if err != nil {
+		return nil, err
+	}
+	opts.Audit.Attributes["appimage.digest"] = img.Digest()
+	return opts.SetBinPatch(patch)
+}
+
+func verify(f *os.File, opts signers.VerifyOpts) ([]*signers.Signature, error) {
+	blob, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	img, err := appimage.Parse(blob)
+	if err != nil {
+		return nil, err
+	}
+	sig, _, err := img.Verify(opts.TrustedPgp)
+	if err != nil {
+		return nil, err
+	}
+	return []*signers.Signature{{
+		Package:      img.Digest(),
+		CreationTime: sig.CreationTime,
+		Hash:         sig.Hash,
+		SignerPgp:    sig.Key.Entity,
+	}}, nil
+}
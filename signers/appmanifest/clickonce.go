@@ -0,0 +1,265 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package appmanifest
+
+// Re-sign a complete ClickOnce publish folder. The client recomputes the
+// dependency hashes in the application manifest and uploads it in a tar along
+// with the deployment manifest and bootstrapper. The server signs the
+// application manifest, updates its hash in the deployment manifest, signs
+// that, signs the bootstrapper and returns all of them in a tar.
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sassoftware/relic/v7/lib/appmanifest"
+	"github.com/sassoftware/relic/v7/lib/atomicfile"
+	"github.com/sassoftware/relic/v7/lib/authenticode"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/signers"
+)
+
+const (
+	tarDeployment = "application"
+	tarManifest   = "manifest"
+	tarSetup      = "setup.exe"
+
+	deploySuffix = ".deploy"
+)
+
+func isTar(br *bufio.Reader) bool {
+	d, _ := br.Peek(262)
+	return len(d) == 262 && string(d[257:]) == "ustar"
+}
+
+// If the input is a publish folder then prepare all of its manifests for
+// signing, otherwise sign a single manifest as-is
+func transform(f *os.File, opts signers.SignOpts) (signers.Transformer, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	} else if !info.IsDir() {
+		return signers.DefaultTransform(f), nil
+	}
+	dir := f.Name()
+	deployments, err := filepath.Glob(filepath.Join(dir, "*.application"))
+	if err != nil {
+		return nil, err
+	} else if len(deployments) != 1 {
+		return nil, fmt.Errorf("expected one deployment manifest in %s but found %d", dir, len(deployments))
+	}
+	t := &publishFolder{dir: dir, deploymentPath: deployments[0]}
+	t.deployment, err = ioutil.ReadFile(t.deploymentPath)
+	if err != nil {
+		return nil, err
+	}
+	deployment, err := appmanifest.ParseDeployment(t.deployment)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", t.deploymentPath, err)
+	}
+	t.manifestPath = filepath.Join(dir, filepath.FromSlash(deployment.ManifestCodebase))
+	manifest, err := ioutil.ReadFile(t.manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	manifestDir := filepath.Dir(t.manifestPath)
+	t.manifest, err = appmanifest.UpdateHashes(manifest, opts.Hash, func(codebase string) ([]byte, error) {
+		fp := filepath.Join(manifestDir, filepath.FromSlash(codebase))
+		if deployment.MapFileExtensions {
+			fp += deploySuffix
+		}
+		return ioutil.ReadFile(fp)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", t.manifestPath, err)
+	}
+	t.setupPath = filepath.Join(dir, tarSetup)
+	t.setup, err = ioutil.ReadFile(t.setupPath)
+	if errors.Is(err, os.ErrNotExist) {
+		t.setupPath = ""
+	} else if err != nil {
+		return nil, err
+	}
+	// the versioned folder usually holds a copy of the deployment manifest
+	t.copyPath = filepath.Join(manifestDir, filepath.Base(t.deploymentPath))
+	if _, err := os.Stat(t.copyPath); err != nil {
+		t.copyPath = ""
+	}
+	return t, nil
+}
+
+type publishFolder struct {
+	dir                                               string
+	deploymentPath, manifestPath, setupPath, copyPath string
+	deployment, manifest, setup                       []byte
+}
+
+func (t *publishFolder) GetReader() (io.Reader, error) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := writeTarFile(tw, tarManifest, t.manifest); err != nil {
+		return nil, err
+	}
+	if err := writeTarFile(tw, tarDeployment, t.deployment); err != nil {
+		return nil, err
+	}
+	if t.setupPath != "" {
+		if err := writeTarFile(tw, tarSetup, t.setup); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
+
+// write the signed files back into the publish folder
+func (t *publishFolder) Apply(dest, mimeType string, result io.Reader) error {
+	if dest != t.dir {
+		return errors.New("--output is not supported when signing a ClickOnce publish folder")
+	}
+	files, err := readTarFiles(result)
+	if err != nil {
+		return err
+	}
+	paths := map[string][]string{
+		tarManifest:   {t.manifestPath},
+		tarDeployment: {t.deploymentPath},
+		tarSetup:      {t.setupPath},
+	}
+	if t.copyPath != "" {
+		paths[tarDeployment] = append(paths[tarDeployment], t.copyPath)
+	}
+	for name, blob := range files {
+		for _, fp := range paths[name] {
+			if fp == "" {
+				return fmt.Errorf("unexpected file %q in response", name)
+			}
+			if err := writeFile(fp, blob); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func writeFile(fp string, blob []byte) error {
+	f, err := atomicfile.WriteAny(fp)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Write(blob); err != nil {
+		return err
+	}
+	return f.Commit()
+}
+
+func writeTarFile(tw *tar.Writer, name string, blob []byte) error {
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(blob))}); err != nil {
+		return err
+	}
+	_, err := tw.Write(blob)
+	return err
+}
+
+func readTarFiles(r io.Reader) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		} else if err != nil {
+			return nil, err
+		}
+		switch hdr.Name {
+		case tarManifest, tarDeployment, tarSetup:
+		default:
+			return nil, fmt.Errorf("unexpected tar file %q", hdr.Name)
+		}
+		files[hdr.Name], err = ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func signPublishFolder(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	files, err := readTarFiles(r)
+	if err != nil {
+		return nil, err
+	}
+	if files[tarManifest] == nil || files[tarDeployment] == nil {
+		return nil, errors.New("tar is missing the application or deployment manifest")
+	}
+	manifest, err := signManifest(files[tarManifest], cert, opts)
+	if err != nil {
+		return nil, fmt.Errorf("signing application manifest: %w", err)
+	}
+	deployment, err := appmanifest.ParseDeployment(files[tarDeployment])
+	if err != nil {
+		return nil, err
+	}
+	updated, err := appmanifest.UpdateHashes(files[tarDeployment], opts.Hash, func(codebase string) ([]byte, error) {
+		if !strings.EqualFold(codebase, deployment.ManifestCodebase) {
+			return nil, fmt.Errorf("deployment manifest references unknown file %q", codebase)
+		}
+		return manifest.Signed, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	signed, err := signManifest(updated, cert, opts)
+	if err != nil {
+		return nil, fmt.Errorf("signing deployment manifest: %w", err)
+	}
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := writeTarFile(tw, tarManifest, manifest.Signed); err != nil {
+		return nil, err
+	}
+	if err := writeTarFile(tw, tarDeployment, signed.Signed); err != nil {
+		return nil, err
+	}
+	if setup := files[tarSetup]; setup != nil {
+		setup, _, err = authenticode.SignPEBytes(opts.Context(), setup, opts.Hash, false, cert)
+		if err != nil {
+			return nil, fmt.Errorf("signing bootstrapper: %w", err)
+		}
+		if err := writeTarFile(tw, tarSetup, setup); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	opts.Audit.SetMimeType("application/x-tar")
+	opts.Audit.Attributes["clickonce.manifest"] = manifest.AssemblyName
+	opts.Audit.Attributes["clickonce.setup"] = files[tarSetup] != nil
+	setAudit(signed, opts)
+	return buf.Bytes(), nil
+}
@@ -21,6 +21,7 @@ package appmanifest
 // other Microsoft signatures, does not use an Authenticode PKCS#7 structure.
 
 import (
+	"bufio"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -39,6 +40,7 @@ var AppSigner = &signers.Signer{
 	Magic:        magic.FileTypeAppManifest,
 	CertTypes:    signers.CertTypeX509,
 	FormatLog:    formatLog,
+	Transform:    transform,
 	Sign:         sign,
 	VerifyStream: verify,
 }
@@ -53,10 +55,24 @@ func formatLog(info *audit.Info) *zerolog.Event {
 }
 
 func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
-	blob, err := ioutil.ReadAll(r)
+	br := bufio.NewReader(r)
+	if isTar(br) {
+		return signPublishFolder(br, cert, opts)
+	}
+	blob, err := ioutil.ReadAll(br)
 	if err != nil {
 		return nil, err
 	}
+	signed, err := signManifest(blob, cert, opts)
+	if err != nil {
+		return nil, err
+	}
+	opts.Audit.SetMimeType("application/xml")
+	setAudit(signed, opts)
+	return signed.Signed, nil
+}
+
+func signManifest(blob []byte, cert *certloader.Certificate, opts signers.SignOpts) (*appmanifest.SignedManifest, error) {
 	signed, err := appmanifest.Sign(blob, cert, opts.Hash)
 	if err != nil {
 		return nil, err
@@ -76,12 +92,14 @@ func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]b
 			return nil, err
 		}
 	}
-	opts.Audit.SetMimeType("application/xml")
+	return signed, nil
+}
+
+func setAudit(signed *appmanifest.SignedManifest, opts signers.SignOpts) {
 	opts.Audit.Attributes["assembly.name"] = signed.AssemblyName
 	opts.Audit.Attributes["assembly.version"] = signed.AssemblyVersion
 	opts.Audit.Attributes["assembly.publicKeyToken"] = signed.PublicKeyToken
 	opts.Audit.SetCounterSignature(signed.Signature.CounterSignature)
-	return signed.Signed, nil
 }
 
 func verify(r io.Reader, opts signers.VerifyOpts) ([]*signers.Signature, error) {
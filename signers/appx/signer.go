@@ -16,22 +16,26 @@
 
 package appx
 
-// Sign Windows Universal (UWP) .appx and .appxbundle
+// Sign Windows Universal (UWP) .appx, .msix and their bundles
 
 import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 
+	"github.com/sassoftware/relic/v7/lib/binpatch"
 	"github.com/sassoftware/relic/v7/lib/certloader"
 	"github.com/sassoftware/relic/v7/lib/magic"
 	"github.com/sassoftware/relic/v7/lib/signappx"
+	"github.com/sassoftware/relic/v7/lib/zipslicer"
 	"github.com/sassoftware/relic/v7/signers"
 	"github.com/sassoftware/relic/v7/signers/zipbased"
 )
 
 var AppxSigner = &signers.Signer{
 	Name:      "appx",
+	Aliases:   []string{"msix"},
 	Magic:     magic.FileTypeAPPX,
 	CertTypes: signers.CertTypeX509,
 	Transform: zipbased.Transform,
@@ -44,7 +48,29 @@ func init() {
 }
 
 func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
-	digest, err := signappx.DigestAppxTar(r, opts.Hash, false)
+	// spool to disk since bundles are read twice
+	tmpdir, err := os.MkdirTemp("", "relic-appx-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpdir)
+	orig, err := os.Create(filepath.Join(tmpdir, "orig.appx"))
+	if err != nil {
+		return nil, err
+	}
+	defer orig.Close()
+	origSize, err := zipslicer.CopyZipTar(r, orig)
+	if err != nil {
+		return nil, err
+	}
+	inz, err := zipslicer.Read(orig, origSize)
+	if err != nil {
+		return nil, err
+	}
+	if signappx.IsBundle(inz) {
+		return signBundle(inz, orig, origSize, tmpdir, cert, opts)
+	}
+	digest, err := signappx.DigestAppx(inz, opts.Hash, false)
 	if err != nil {
 		return nil, err
 	}
@@ -56,6 +82,48 @@ func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]b
 	return opts.SetBinPatch(patch)
 }
 
+// Sign each package in a bundle, then the bundle. The packages come first in
+// the bundle so the patch replaces everything from the first one onwards.
+func signBundle(inz *zipslicer.Directory, orig *os.File, origSize int64, tmpdir string, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	mid, err := os.Create(filepath.Join(tmpdir, "nested.appx"))
+	if err != nil {
+		return nil, err
+	}
+	defer mid.Close()
+	start, err := signappx.SignNested(opts.Context(), inz, mid, cert, opts.Hash)
+	if err != nil {
+		return nil, err
+	}
+	midSize, err := mid.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	midz, err := zipslicer.Read(mid, midSize)
+	if err != nil {
+		return nil, err
+	}
+	digest, err := signappx.DigestAppx(midz, opts.Hash, false)
+	if err != nil {
+		return nil, err
+	}
+	bundlePatch, priSig, _, err := digest.Sign(opts.Context(), cert)
+	if err != nil {
+		return nil, err
+	}
+	finalPath := filepath.Join(tmpdir, "final.appx")
+	if err := bundlePatch.Apply(mid, finalPath); err != nil {
+		return nil, err
+	}
+	final, err := os.ReadFile(finalPath)
+	if err != nil {
+		return nil, err
+	}
+	patch := binpatch.New()
+	patch.Add(start, origSize-start, final[start:])
+	opts.Audit.SetCounterSignature(priSig.CounterSignature)
+	return opts.SetBinPatch(patch)
+}
+
 func verify(f *os.File, opts signers.VerifyOpts) ([]*signers.Signature, error) {
 	size, err := f.Seek(0, io.SeekEnd)
 	if err != nil {
@@ -0,0 +1,159 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package aptrelease
+
+// Sign the Release file of an APT repository suite, producing both a detached
+// Release.gpg and a clearsigned InRelease alongside it.
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+
+	"github.com/sassoftware/relic/v7/lib/atomicfile"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/pgptools"
+	"github.com/sassoftware/relic/v7/lib/signdeb"
+	"github.com/sassoftware/relic/v7/signers"
+)
+
+var ReleaseSigner = &signers.Signer{
+	Name:      "apt-release",
+	Aliases:   []string{"inrelease"},
+	CertTypes: signers.CertTypePgp,
+	TestPath:  testPath,
+	Transform: transform,
+	Sign:      sign,
+}
+
+// signing result holding the detached signature followed by the clearsign
+// signature block
+const resultType = "application/x-apt-release-signatures"
+
+var sigEnd = []byte("-----END PGP SIGNATURE-----")
+
+func init() {
+	ReleaseSigner.Flags().Bool("apt-check-by-hash", false, "(APT) Check that by-hash copies of the index files are present")
+	signers.Register(ReleaseSigner)
+}
+
+func testPath(fp string) bool {
+	return filepath.Base(fp) == "Release"
+}
+
+type releaseTransformer struct {
+	f       *os.File
+	release []byte
+}
+
+// Check the suite's index files against the Release file before signing it
+func transform(f *os.File, opts signers.SignOpts) (signers.Transformer, error) {
+	release, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	if err := signdeb.ValidateRelease(filepath.Dir(f.Name()), release, opts.Flags.GetBool("apt-check-by-hash")); err != nil {
+		return nil, err
+	}
+	return &releaseTransformer{f: f, release: release}, nil
+}
+
+func (t *releaseTransformer) GetReader() (io.Reader, error) {
+	return bytes.NewReader(t.release), nil
+}
+
+func (t *releaseTransformer) Apply(dest, mimeType string, result io.Reader) error {
+	if mimeType != resultType {
+		return errors.New("unexpected result type for APT release")
+	} else if dest == "-" {
+		return errors.New("can't write APT release signatures to standard output")
+	}
+	blob, err := ioutil.ReadAll(result)
+	if err != nil {
+		return err
+	}
+	i := bytes.Index(blob, sigEnd)
+	if i < 0 {
+		return errors.New("malformed APT release signature")
+	}
+	i += len(sigEnd)
+	detached, clear := blob[:i], bytes.TrimLeft(blob[i:], "\r\n")
+	dir := filepath.Dir(dest)
+	if dest != t.f.Name() {
+		if err := writeFile(dest, func(w io.Writer) error {
+			_, err := w.Write(t.release)
+			return err
+		}); err != nil {
+			return err
+		}
+	}
+	if err := writeFile(filepath.Join(dir, "Release.gpg"), func(w io.Writer) error {
+		_, err := w.Write(append(detached, '\n'))
+		return err
+	}); err != nil {
+		return err
+	}
+	if err := writeFile(filepath.Join(dir, "InRelease"), func(w io.Writer) error {
+		return signdeb.MergeClearSign(w, clear, t.release)
+	}); err != nil {
+		return err
+	}
+	return t.f.Close()
+}
+
+func writeFile(name string, fn func(io.Writer) error) error {
+	f, err := atomicfile.WriteAny(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := fn(f); err != nil {
+		return err
+	}
+	return f.Commit()
+}
+
+func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	release, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := signdeb.ParseRelease(release); err != nil {
+		return nil, err
+	}
+	config := &packet.Config{
+		DefaultHash: opts.Hash,
+		Time:        func() time.Time { return opts.Time },
+	}
+	var buf bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&buf, cert.PgpKey, bytes.NewReader(release), config); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	if err := pgptools.DetachClearSign(&buf, cert.PgpKey, bytes.NewReader(release), config); err != nil {
+		return nil, err
+	}
+	opts.Audit.SetMimeType(resultType)
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,307 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package avb
+
+// Sign Android Verified Boot vbmeta images, either standalone or embedded in
+// a partition image with a footer, like avbtool
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sassoftware/relic/v7/config"
+	"github.com/sassoftware/relic/v7/lib/avb"
+	"github.com/sassoftware/relic/v7/lib/binpatch"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+	"github.com/sassoftware/relic/v7/signers"
+	"github.com/sassoftware/relic/v7/signers/sigerrors"
+)
+
+var AvbSigner = &signers.Signer{
+	Name:      "avb",
+	Aliases:   []string{"vbmeta"},
+	TestPath:  testPath,
+	Transform: transform,
+	Sign:      sign,
+	Verify:    verify,
+}
+
+func init() {
+	AvbSigner.Flags().String("avb-partition-name", "", "(AVB) Add a hash footer for this partition to an image that doesn't have one")
+	AvbSigner.Flags().String("avb-partition-size", "", "(AVB) Size of the partition when adding a hash footer (default: as small as possible)")
+	AvbSigner.Flags().String("avb-salt", "", "(AVB) Salt in hex when adding a hash footer (default: random)")
+	AvbSigner.Flags().String("avb-rollback-index", "", "(AVB) Set the rollback index")
+	AvbSigner.Flags().String("avb-rollback-index-location", "", "(AVB) Set the rollback index location")
+	AvbSigner.Flags().String("avb-flags", "", "(AVB) Set the vbmeta flags, e.g. 2 to disable verification")
+	AvbSigner.Flags().String("avb-prop", "", "(AVB) Comma-separated KEY:VALUE properties to add")
+	AvbSigner.Flags().String("avb-kernel-cmdline", "", "(AVB) Kernel command line fragment to add")
+	AvbSigner.Flags().String("avb-chain-partition", "", "(AVB) Comma-separated NAME:ROLLBACK_INDEX_LOCATION:KEY_PATH chained partitions to add, with the key from \"avbtool extract_public_key\"")
+	AvbSigner.Flags().String("avb-include-descriptors-from", "", "(AVB) Comma-separated images to copy descriptors from")
+	signers.Register(AvbSigner)
+}
+
+func testPath(fp string) bool {
+	return strings.HasPrefix(filepath.Base(fp), "vbmeta") && strings.EqualFold(filepath.Ext(fp), ".img")
+}
+
+func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	u, err := extractFiles(r)
+	if err != nil {
+		return nil, err
+	}
+	var v *avb.VBMeta
+	var oldSize int64
+	partitionName := opts.Flags.GetString("avb-partition-name")
+	head := make([]byte, 4)
+	n, _ := io.ReadFull(u.image, head)
+	image := io.MultiReader(bytes.NewReader(head[:n]), u.image)
+	addFooter := false
+	switch {
+	case n == 0:
+		// build a new vbmeta image from the command-line options
+		v = new(avb.VBMeta)
+	case avb.IsVBMeta(head):
+		// standalone vbmeta, or the vbmeta from a partition with a footer
+		blob, err := ioutil.ReadAll(image)
+		if err != nil {
+			return nil, err
+		}
+		v, err = avb.Parse(blob)
+		if err != nil {
+			return nil, err
+		}
+		oldSize = int64(len(blob))
+	case partitionName != "":
+		desc, err := newHashDescriptor(image, u.imageSize, partitionName, opts)
+		if err != nil {
+			return nil, err
+		}
+		v = &avb.VBMeta{Descriptors: []avb.Descriptor{desc.Descriptor()}}
+		addFooter = true
+	default:
+		return nil, errors.New("not a vbmeta image or partition with an AVB footer; use --avb-partition-name to add a hash footer")
+	}
+	if err := updateVBMeta(v, u, opts); err != nil {
+		return nil, err
+	}
+	hash := opts.Hash
+	if hash != crypto.SHA512 {
+		hash = crypto.SHA256
+	}
+	blob, err := v.Sign(cert.Signer(), hash)
+	if err != nil {
+		return nil, err
+	}
+	signedSize := len(blob)
+	// keep any padding after the old image
+	if pad := oldSize - int64(len(blob)); pad > 0 {
+		blob = append(blob, make([]byte, pad)...)
+	}
+	patch := binpatch.New()
+	switch {
+	case u.footer != nil:
+		// rewrite the vbmeta in place and update the footer
+		maxSize := u.partitionSize - avb.FooterSize - int64(u.footer.VBMetaOffset)
+		if int64(len(blob)) > maxSize {
+			return nil, fmt.Errorf("signed vbmeta image of %d bytes does not fit in the partition", len(blob))
+		}
+		u.footer.VBMetaSize = uint64(signedSize)
+		patch.Add(int64(u.footer.VBMetaOffset), int64(len(blob)), blob)
+		patch.Add(u.partitionSize-avb.FooterSize, avb.FooterSize, u.footer.Marshal())
+	case addFooter:
+		var partitionSize int64
+		if s := opts.Flags.GetString("avb-partition-size"); s != "" {
+			partitionSize, err = strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid partition size: %w", err)
+			}
+		}
+		tail, err := avb.AppendFooter(u.imageSize, partitionSize, blob)
+		if err != nil {
+			return nil, err
+		}
+		patch.Add(u.imageSize, 0, tail)
+	default:
+		patch.Add(0, oldSize, blob)
+	}
+	opts.Audit.Attributes["avb.algorithm"] = v.Algorithm.String()
+	opts.Audit.Attributes["avb.rollback-index"] = v.RollbackIndex
+	if partitionName != "" {
+		opts.Audit.Attributes["avb.partition"] = partitionName
+	}
+	return opts.SetBinPatch(patch)
+}
+
+func newHashDescriptor(r io.Reader, size int64, partitionName string, opts signers.SignOpts) (*avb.HashDescriptor, error) {
+	salt := make([]byte, crypto.SHA256.Size())
+	if s := opts.Flags.GetString("avb-salt"); s != "" {
+		var err error
+		salt, err = hex.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid salt: %w", err)
+		}
+	} else if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return avb.NewHashDescriptor(r, partitionName, size, crypto.SHA256, salt)
+}
+
+// apply command-line options to the vbmeta header and descriptors
+func updateVBMeta(v *avb.VBMeta, u *upload, opts signers.SignOpts) error {
+	parseUint := func(name string, bits int) (uint64, bool, error) {
+		s := opts.Flags.GetString(name)
+		if s == "" {
+			return 0, false, nil
+		}
+		n, err := strconv.ParseUint(s, 0, bits)
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid value for --%s: %w", name, err)
+		}
+		return n, true, nil
+	}
+	if n, ok, err := parseUint("avb-rollback-index", 64); err != nil {
+		return err
+	} else if ok {
+		v.RollbackIndex = n
+	}
+	if n, ok, err := parseUint("avb-rollback-index-location", 32); err != nil {
+		return err
+	} else if ok {
+		v.RollbackIndexLocation = uint32(n)
+	}
+	if n, ok, err := parseUint("avb-flags", 32); err != nil {
+		return err
+	} else if ok {
+		v.Flags = uint32(n)
+	}
+	for _, blob := range u.includes {
+		included, err := avb.Parse(blob)
+		if err != nil {
+			return err
+		}
+		for _, desc := range included.Descriptors {
+			v.SetDescriptor(desc)
+		}
+	}
+	for _, chain := range u.chains {
+		v.SetDescriptor(chain.Descriptor())
+	}
+	for _, prop := range splitList(opts.Flags.GetString("avb-prop")) {
+		key, value, ok := strings.Cut(prop, ":")
+		if !ok {
+			return fmt.Errorf("invalid property %q, expected KEY:VALUE", prop)
+		}
+		v.SetDescriptor((&avb.PropertyDescriptor{Key: key, Value: value}).Descriptor())
+	}
+	if cmdline := opts.Flags.GetString("avb-kernel-cmdline"); cmdline != "" {
+		v.SetDescriptor((&avb.KernelCmdlineDescriptor{Cmdline: cmdline}).Descriptor())
+	}
+	v.ReleaseString = "relic " + config.Version
+	return nil
+}
+
+func verify(f *os.File, opts signers.VerifyOpts) ([]*signers.Signature, error) {
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	blob, footer, err := avb.ReadVBMeta(f, size)
+	if err != nil {
+		return nil, err
+	}
+	v, err := avb.Parse(blob)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := v.Verify()
+	if errors.Is(err, avb.ErrNotSigned) {
+		return nil, sigerrors.NotSignedError{Type: "vbmeta"}
+	} else if err != nil {
+		return nil, err
+	}
+	packageName := "vbmeta"
+	for _, desc := range v.Descriptors {
+		decoded, err := desc.Decode()
+		if err != nil {
+			return nil, err
+		}
+		// descriptors in a footer describe the partition they're attached to
+		var checker interface{ Check(io.ReaderAt) error }
+		var name string
+		switch d := decoded.(type) {
+		case *avb.HashDescriptor:
+			name, checker = d.PartitionName, d
+		case *avb.HashtreeDescriptor:
+			name, checker = d.PartitionName, d
+		}
+		if footer == nil || checker == nil {
+			continue
+		}
+		packageName = name
+		if !opts.NoDigests {
+			if err := checker.Check(f); err != nil {
+				return nil, err
+			}
+		}
+	}
+	signer, err := trustedSigner(pub, opts)
+	if err != nil {
+		return nil, err
+	}
+	return []*signers.Signature{{
+		Package: packageName,
+		SigInfo: fmt.Sprintf("%s rollback-index %d", v.Algorithm, v.RollbackIndex),
+		Hash:    v.Algorithm.Hash(),
+		Signer:  signer,
+	}}, nil
+}
+
+// identify the signing key, which must match one of the trusted
+// certificates
+func trustedSigner(pub *rsa.PublicKey, opts signers.VerifyOpts) (string, error) {
+	// avbtool identifies keys by the SHA-1 of the AVB public key
+	encoded, err := avb.EncodePublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	digest := sha1.Sum(encoded)
+	keyID := hex.EncodeToString(digest[:])
+	for _, cert := range opts.TrustedX509 {
+		if pub.Equal(cert.PublicKey) {
+			return fmt.Sprintf("`%s`(%s)", x509tools.FormatSubject(cert), keyID), nil
+		}
+	}
+	if len(opts.TrustedX509) != 0 {
+		return "", fmt.Errorf("vbmeta was signed by untrusted key %s", keyID)
+	} else if !opts.NoChain {
+		return "", errors.New("no trusted keys; use --cert to specify the key the image was signed with")
+	}
+	return keyID, nil
+}
@@ -0,0 +1,237 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package avb
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/sassoftware/relic/v7/lib/avb"
+	"github.com/sassoftware/relic/v7/signers"
+)
+
+// Files are read on the client and uploaded in a tarball along with the
+// image. Partition images with a footer only upload the vbmeta image.
+const (
+	imageName         = "image"
+	footerName        = "footer"
+	partitionSizeName = "partition-size"
+	chainPrefix       = "chain/"
+	includePrefix     = "include/"
+)
+
+func transform(f *os.File, opts signers.SignOpts) (signers.Transformer, error) {
+	t := &transformer{f: f}
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	vbmeta, footer, err := avb.ReadVBMeta(f, size)
+	if err == nil && footer != nil {
+		// only the vbmeta image needs to be signed
+		t.files = append(t.files,
+			tarFile{footerName, footer.Marshal()},
+			tarFile{partitionSizeName, []byte(strconv.FormatInt(size, 10))},
+		)
+		t.image = vbmeta
+	}
+	for _, spec := range splitList(opts.Flags.GetString("avb-chain-partition")) {
+		parts := strings.SplitN(spec, ":", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("invalid chain partition %q, expected NAME:ROLLBACK_INDEX_LOCATION:KEY_PATH", spec)
+		}
+		if _, err := strconv.ParseUint(parts[1], 10, 32); err != nil {
+			return nil, fmt.Errorf("invalid chain partition %q: %w", spec, err)
+		}
+		key, err := ioutil.ReadFile(parts[2])
+		if err != nil {
+			return nil, err
+		}
+		t.files = append(t.files, tarFile{chainPrefix + parts[0] + "/" + parts[1], key})
+	}
+	for i, fp := range splitList(opts.Flags.GetString("avb-include-descriptors-from")) {
+		blob, err := readVBMetaFile(fp)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fp, err)
+		}
+		t.files = append(t.files, tarFile{includePrefix + strconv.Itoa(i), blob})
+	}
+	return t, nil
+}
+
+func readVBMetaFile(fp string) ([]byte, error) {
+	f, err := os.Open(fp)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	blob, _, err := avb.ReadVBMeta(f, size)
+	return blob, err
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+type transformer struct {
+	f     *os.File
+	image []byte
+	files []tarFile
+}
+
+type tarFile struct {
+	Name string
+	Data []byte
+}
+
+func (t *transformer) GetReader() (io.Reader, error) {
+	r, w := io.Pipe()
+	go func() {
+		_ = w.CloseWithError(t.send(w))
+	}()
+	return r, nil
+}
+
+func (t *transformer) send(w io.Writer) error {
+	tw := tar.NewWriter(w)
+	for _, f := range t.files {
+		hdr := &tar.Header{Name: f.Name, Mode: 0644, Size: int64(len(f.Data))}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(f.Data); err != nil {
+			return err
+		}
+	}
+	// the image goes last so it can be streamed
+	if t.image != nil {
+		hdr := &tar.Header{Name: imageName, Mode: 0644, Size: int64(len(t.image))}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(t.image); err != nil {
+			return err
+		}
+		return tw.Close()
+	}
+	size, err := t.f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	hdr := &tar.Header{Name: imageName, Mode: 0644, Size: size}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if _, err := t.f.Seek(0, 0); err != nil {
+		return err
+	}
+	if _, err := io.Copy(tw, t.f); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+func (t *transformer) Apply(dest, mimeType string, result io.Reader) error {
+	return signers.ApplyBinPatch(t.f, dest, result)
+}
+
+type upload struct {
+	footer        *avb.Footer
+	partitionSize int64
+	chains        []*avb.ChainPartitionDescriptor
+	includes      [][]byte
+	image         io.Reader
+	imageSize     int64
+}
+
+// read the tarball produced by transform, stopping at the image
+func extractFiles(r io.Reader) (*upload, error) {
+	tr := tar.NewReader(r)
+	u := new(upload)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, errors.New("tar missing file \"image\"")
+		} else if err != nil {
+			return nil, err
+		}
+		if hdr.Name == imageName {
+			u.image = tr
+			u.imageSize = hdr.Size
+			return u, nil
+		}
+		blob, err := ioutil.ReadAll(io.LimitReader(tr, 1<<20))
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case hdr.Name == footerName:
+			u.footer, err = avb.ParseFooter(blob)
+			if err == nil && u.footer == nil {
+				err = errors.New("invalid footer")
+			}
+		case hdr.Name == partitionSizeName:
+			u.partitionSize, err = strconv.ParseInt(string(blob), 10, 64)
+		case strings.HasPrefix(hdr.Name, chainPrefix):
+			var chain *avb.ChainPartitionDescriptor
+			chain, err = parseChain(strings.TrimPrefix(hdr.Name, chainPrefix), blob)
+			u.chains = append(u.chains, chain)
+		case strings.HasPrefix(hdr.Name, includePrefix):
+			u.includes = append(u.includes, blob)
+		default:
+			err = fmt.Errorf("unexpected tar file %q", hdr.Name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func parseChain(name string, key []byte) (*avb.ChainPartitionDescriptor, error) {
+	i := strings.LastIndexByte(name, '/')
+	if i < 0 {
+		return nil, fmt.Errorf("invalid chain partition %q", name)
+	}
+	location, err := strconv.ParseUint(name[i+1:], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid chain partition %q", name)
+	}
+	if _, err := avb.DecodePublicKey(key); err != nil {
+		return nil, fmt.Errorf("chain partition %s: %w", name[:i], err)
+	}
+	return &avb.ChainPartitionDescriptor{
+		RollbackIndexLocation: uint32(location),
+		PartitionName:         name[:i],
+		PublicKey:             key,
+	}, nil
+}
@@ -0,0 +1,166 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cab
+
+// Sign cabinets nested inside of other cabinets, such as Windows Update .msu
+// packages
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/sassoftware/relic/v7/lib/authenticode"
+	"github.com/sassoftware/relic/v7/lib/cabfile"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/magic"
+	"github.com/sassoftware/relic/v7/signers"
+	"github.com/sassoftware/relic/v7/signers/sigerrors"
+)
+
+// maximum depth of nested cabinets
+const maxDepth = 4
+
+type nestedSigner struct {
+	patterns []string
+	resign   bool
+	cert     *certloader.Certificate
+	opts     signers.SignOpts
+	signed   []string
+}
+
+// return the list of member patterns to sign, if any
+func nestedPatterns(opts signers.SignOpts) []string {
+	value := opts.Flags.GetString("cab-nested")
+	if value == "" && strings.EqualFold(filepath.Ext(opts.Path), ".msu") {
+		value = "*.cab"
+	}
+	var patterns []string
+	for _, pattern := range strings.Split(value, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+func (s *nestedSigner) matches(name string) bool {
+	name = strings.ReplaceAll(name, "\\", "/")
+	for _, pattern := range s.patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, path.Base(name)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// sign matching members of a cabinet and then the cabinet itself
+func (s *nestedSigner) signCab(blob []byte, prefix string, depth int) ([]byte, error) {
+	if depth > maxDepth {
+		return nil, errors.New("cabinets are nested too deeply")
+	}
+	archive, err := cabfile.ReadArchive(blob)
+	if err != nil {
+		return nil, err
+	}
+	changed := false
+	for _, file := range archive.Files {
+		name := prefix + file.Name
+		if !s.matches(file.Name) {
+			continue
+		}
+		contents, err := archive.Contents(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		signed, err := s.signMember(contents, name, depth)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		} else if signed == nil {
+			continue
+		}
+		if err := archive.Replace(file, signed); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		changed = true
+	}
+	if changed {
+		blob, err = archive.Marshal()
+		if err != nil {
+			return nil, err
+		}
+	}
+	digest, err := cabfile.Digest(bytes.NewReader(blob), s.opts.Hash)
+	if err != nil {
+		return nil, err
+	}
+	patch, ts, err := authenticode.SignCabImprint(s.opts.Context(), digest, s.cert)
+	if err != nil {
+		return nil, err
+	}
+	if depth == 0 {
+		s.opts.Audit.SetCounterSignature(ts.CounterSignature)
+	}
+	return patch.ApplyBytes(blob)
+}
+
+// sign a single member, returning nil if it should be left as-is
+func (s *nestedSigner) signMember(blob []byte, name string, depth int) ([]byte, error) {
+	switch magic.Detect(bytes.NewReader(blob)) {
+	case magic.FileTypeCAB:
+		if !s.resign {
+			if _, err := authenticode.VerifyCab(bytes.NewReader(blob), true); err == nil {
+				return nil, nil
+			} else if !errors.As(err, new(sigerrors.NotSignedError)) {
+				return nil, err
+			}
+		}
+		signed, err := s.signCab(blob, name+"/", depth+1)
+		if err != nil {
+			return nil, err
+		}
+		s.signed = append(s.signed, name)
+		return signed, nil
+	case magic.FileTypePECOFF:
+		if !s.resign {
+			if _, err := authenticode.VerifyPE(bytes.NewReader(blob), true); err == nil {
+				return nil, nil
+			} else if !errors.As(err, new(sigerrors.NotSignedError)) {
+				return nil, err
+			}
+		}
+		signed, err := s.signPE(blob)
+		if err != nil {
+			return nil, err
+		}
+		s.signed = append(s.signed, name)
+		return signed, nil
+	default:
+		return nil, errors.New("don't know how to sign this member")
+	}
+}
+
+func (s *nestedSigner) signPE(blob []byte) ([]byte, error) {
+	signed, _, err := authenticode.SignPEBytes(s.opts.Context(), blob, s.opts.Hash, false, s.cert)
+	return signed, err
+}
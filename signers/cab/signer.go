@@ -20,9 +20,13 @@ package cab
 
 import (
 	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/sassoftware/relic/v7/lib/authenticode"
+	"github.com/sassoftware/relic/v7/lib/binpatch"
 	"github.com/sassoftware/relic/v7/lib/cabfile"
 	"github.com/sassoftware/relic/v7/lib/certloader"
 	"github.com/sassoftware/relic/v7/lib/magic"
@@ -32,16 +36,28 @@ import (
 var CabSigner = &signers.Signer{
 	Name:      "cab",
 	Magic:     magic.FileTypeCAB,
+	TestPath:  testPath,
 	CertTypes: signers.CertTypeX509,
 	Sign:      sign,
 	Verify:    verify,
+
+	RemoveSignature: removeSignature,
 }
 
 func init() {
+	CabSigner.Flags().String("cab-nested", "", "(CAB) Comma-separated patterns of inner cabinets and binaries to sign before the outer cabinet (default: *.cab for .msu files)")
+	CabSigner.Flags().Bool("cab-resign-nested", false, "(CAB) Re-sign nested members that already have a signature")
 	signers.Register(CabSigner)
 }
 
+func testPath(fp string) bool {
+	return strings.EqualFold(filepath.Ext(fp), ".msu")
+}
+
 func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	if patterns := nestedPatterns(opts); len(patterns) != 0 {
+		return signNested(r, cert, opts, patterns)
+	}
 	digest, err := cabfile.Digest(r, opts.Hash)
 	if err != nil {
 		return nil, err
@@ -54,6 +70,39 @@ func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]b
 	return opts.SetBinPatch(patch)
 }
 
+func signNested(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts, patterns []string) ([]byte, error) {
+	blob, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	s := &nestedSigner{
+		patterns: patterns,
+		resign:   opts.Flags.GetBool("cab-resign-nested"),
+		cert:     cert,
+		opts:     opts,
+	}
+	signed, err := s.signCab(blob, "", 0)
+	if err != nil {
+		return nil, err
+	}
+	opts.Audit.Attributes["cab.nested"] = s.signed
+	patch := binpatch.New()
+	patch.Add(0, int64(len(blob)), signed)
+	return opts.SetBinPatch(patch)
+}
+
+func removeSignature(f *os.File, dest string) error {
+	digest, err := cabfile.Digest(f, 0)
+	if err != nil {
+		return err
+	}
+	patch, err := digest.MakeRemovePatch()
+	if err != nil {
+		return err
+	}
+	return patch.Apply(f, dest)
+}
+
 func verify(f *os.File, opts signers.VerifyOpts) ([]*signers.Signature, error) {
 	sig, err := authenticode.VerifyCab(f, opts.NoDigests)
 	if err != nil {
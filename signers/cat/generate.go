@@ -0,0 +1,162 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cat
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sassoftware/relic/v7/lib/atomicfile"
+	"github.com/sassoftware/relic/v7/lib/authenticode"
+	"github.com/sassoftware/relic/v7/lib/magic"
+	"github.com/sassoftware/relic/v7/signers"
+)
+
+// If the input is a directory or a list of files instead of an existing
+// catalog, then build a new catalog on the client and upload it to be
+// signed.
+func transform(f *os.File, opts signers.SignOpts) (signers.Transformer, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	var members []string
+	if info.IsDir() {
+		members, err = scanDir(f.Name())
+	} else {
+		if magic.Detect(f) == magic.FileTypeCAT {
+			return signers.DefaultTransform(f), nil
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		members, err = readFileList(f)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(members) == 0 {
+		return nil, fmt.Errorf("no files to add to catalog from %s", f.Name())
+	}
+	cat := authenticode.NewCatalog(opts.Hash)
+	for _, osAttr := range splitList(opts.Flags.GetString("cat-os")) {
+		if err := cat.SetAttribute("OSAttr", osAttr); err != nil {
+			return nil, err
+		}
+	}
+	for _, fp := range members {
+		if err := addMember(cat, fp, opts.Hash); err != nil {
+			return nil, fmt.Errorf("%s: %w", fp, err)
+		}
+	}
+	cinfo, err := cat.ContentInfo()
+	if err != nil {
+		return nil, err
+	}
+	return &generated{source: f.Name(), content: cinfo.Raw}, nil
+}
+
+// list every regular file under a directory
+func scanDir(dir string) ([]string, error) {
+	var members []string
+	err := filepath.Walk(dir, func(fp string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			members = append(members, fp)
+		}
+		return nil
+	})
+	sort.Strings(members)
+	return members, err
+}
+
+// read a list of files, one per line, relative to the list's directory
+func readFileList(f *os.File) ([]string, error) {
+	var members []string
+	base := filepath.Dir(f.Name())
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !filepath.IsAbs(line) {
+			line = filepath.Join(base, line)
+		}
+		members = append(members, line)
+	}
+	return members, scanner.Err()
+}
+
+func addMember(cat *authenticode.Catalog, fp string, hash crypto.Hash) error {
+	f, err := os.Open(fp)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	indirect, err := authenticode.DigestCatalogMember(f, hash)
+	if err != nil {
+		return err
+	}
+	return cat.AddFile(filepath.Base(fp), indirect)
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// generated uploads a new, unsigned catalog and writes the signed result to
+// the destination
+type generated struct {
+	source  string
+	content []byte
+}
+
+func (g *generated) GetReader() (io.Reader, error) {
+	return bytes.NewReader(g.content), nil
+}
+
+func (g *generated) Apply(dest, mimeType string, result io.Reader) error {
+	if dest == g.source {
+		return errors.New("--output is required when generating a catalog")
+	}
+	f, err := atomicfile.WriteAny(dest)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, result); err != nil {
+		return err
+	}
+	return f.Commit()
+}
@@ -16,9 +16,11 @@
 
 package cat
 
-// Sign Microsoft security catalog files
+// Sign Microsoft security catalog files, or generate a new catalog from a
+// directory or a list of files
 
 import (
+	"encoding/asn1"
 	"errors"
 	"io"
 	"io/ioutil"
@@ -36,11 +38,13 @@ var CatSigner = &signers.Signer{
 	Name:      "cat",
 	Magic:     magic.FileTypeCAT,
 	CertTypes: signers.CertTypeX509,
+	Transform: transform,
 	Sign:      sign,
 	Verify:    pkcs.Verify,
 }
 
 func init() {
+	CatSigner.Flags().String("cat-os", "", "(CAT) Comma-separated OSAttr values for a generated catalog, e.g. 2:10.0")
 	signers.Register(CatSigner)
 }
 
@@ -49,21 +53,32 @@ func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]b
 	if err != nil {
 		return nil, err
 	}
-	oldpsd, err := pkcs7.Unmarshal(blob)
-	if err != nil {
+	var cinfo pkcs7.ContentInfo
+	if _, err := asn1.Unmarshal(blob, &cinfo); err != nil {
 		return nil, err
 	}
-	if !oldpsd.Content.ContentInfo.ContentType.Equal(authenticode.OidCertTrustList) {
+	if !cinfo.ContentType.Equal(authenticode.OidCertTrustList) {
+		// re-sign an existing catalog
+		oldpsd, err := pkcs7.Unmarshal(blob)
+		if err != nil {
+			return nil, err
+		}
+		cinfo = oldpsd.Content.ContentInfo
+	}
+	if !cinfo.ContentType.Equal(authenticode.OidCertTrustList) {
 		return nil, errors.New("not a security catalog")
 	}
-	sig := pkcs7.NewBuilder(cert.Signer(), cert.Chain(), opts.Hash)
-	if err := sig.SetContentInfo(oldpsd.Content.ContentInfo); err != nil {
+	sig := pkcs7.NewBuilder(cert.Signer(), cert.AuthenticodeChain(), opts.Hash)
+	if err := sig.SetContentInfo(cinfo); err != nil {
 		return nil, err
 	}
 	newpsd, err := sig.Sign()
 	if err != nil {
 		return nil, err
 	}
+	if err := cert.AttachRevocationInfo(newpsd); err != nil {
+		return nil, err
+	}
 	ts, err := pkcs9.TimestampAndMarshal(opts.Context(), newpsd, cert.Timestamper, true)
 	if err != nil {
 		return nil, err
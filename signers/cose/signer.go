@@ -0,0 +1,132 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cose
+
+// Sign arbitrary payloads, such as SUIT firmware manifests or verifiable
+// credentials, as a COSE_Sign1 message with the certificate chain in x5chain
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+
+	"github.com/rs/zerolog"
+
+	"github.com/sassoftware/relic/v7/lib/audit"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/cose"
+	"github.com/sassoftware/relic/v7/lib/pkcs7"
+	"github.com/sassoftware/relic/v7/lib/pkcs9"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+	"github.com/sassoftware/relic/v7/signers"
+)
+
+var CoseSigner = &signers.Signer{
+	Name:         "cose",
+	TestPath:     testPath,
+	FormatLog:    formatLog,
+	Sign:         sign,
+	VerifyStream: verify,
+}
+
+const maxPayload = 16 << 20
+
+func init() {
+	CoseSigner.Flags().Bool("cose-detached", false, "(COSE) Leave the payload out of the output")
+	CoseSigner.Flags().Bool("cose-pss", false, "(COSE) Use PS256/384/512 instead of RS256/384/512 for RSA keys")
+	CoseSigner.Flags().Bool("cose-no-x5chain", false, "(COSE) Don't embed the certificate chain in the x5chain header")
+	CoseSigner.Flags().String("cose-cty", "", "(COSE) Content type of the payload, as a media type or CoAP content format number")
+	CoseSigner.Flags().String("cose-kid", "", "(COSE) Key ID to put in the unprotected header")
+	signers.Register(CoseSigner)
+}
+
+func testPath(fp string) bool {
+	return filepath.Ext(fp) == ".cose"
+}
+
+func formatLog(attrs *audit.Info) *zerolog.Event {
+	return attrs.AttrsForLog("cose.")
+}
+
+func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	payload, err := ioutil.ReadAll(io.LimitReader(r, maxPayload+1))
+	if err != nil {
+		return nil, err
+	} else if len(payload) > maxPayload {
+		return nil, errors.New("COSE payload is too large")
+	}
+	copts := cose.SignOptions{
+		Hash: opts.Hash,
+		PSS:  opts.Flags.GetBool("cose-pss"),
+	}
+	if cty := opts.Flags.GetString("cose-cty"); cty != "" {
+		if n, err := strconv.ParseUint(cty, 10, 16); err == nil {
+			copts.ContentType = int64(n)
+		} else {
+			copts.ContentType = cty
+		}
+	}
+	if kid := opts.Flags.GetString("cose-kid"); kid != "" {
+		copts.KeyID = []byte(kid)
+	}
+	if !opts.Flags.GetBool("cose-no-x5chain") {
+		copts.Certificates = cert.Chain()
+	}
+	m, err := cose.Sign(payload, cert.Signer(), copts)
+	if err != nil {
+		return nil, err
+	}
+	opts.Audit.Attributes["cose.alg"] = string(m.Algorithm())
+	opts.Audit.SetMimeType("application/cose; cose-type=\"cose-sign1\"")
+	return m.Marshal(opts.Flags.GetBool("cose-detached"))
+}
+
+func verify(r io.Reader, opts signers.VerifyOpts) ([]*signers.Signature, error) {
+	blob, err := ioutil.ReadAll(io.LimitReader(r, 2*maxPayload))
+	if err != nil {
+		return nil, err
+	}
+	m, err := cose.Parse(blob)
+	if err != nil {
+		return nil, err
+	}
+	if m.Payload == nil && opts.Content != "" {
+		m.Payload, err = ioutil.ReadFile(opts.Content)
+		if err != nil {
+			return nil, err
+		}
+	}
+	signer, err := m.Verify(opts.TrustedX509)
+	if err != nil {
+		return nil, err
+	}
+	sig := &signers.Signature{
+		SigInfo: string(m.Algorithm()),
+		Hash:    m.Algorithm().Hash(),
+	}
+	if certs, _ := m.Certificates(); len(certs) != 0 {
+		sig.X509Signature = &pkcs9.TimestampedSignature{
+			Signature: pkcs7.Signature{Certificate: signer, Intermediates: certs},
+		}
+	} else {
+		sig.Signer = fmt.Sprintf("`%s`", x509tools.FormatSubject(signer))
+	}
+	return []*signers.Signature{sig}, nil
+}
@@ -0,0 +1,89 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cosign
+
+// Sign container image payloads for cosign. The client resolves the image
+// and sends either a simple signing payload or an in-toto statement, and gets
+// back a Sigstore bundle which it then attaches to the image. See "relic
+// remote sign-image".
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/rs/zerolog"
+
+	"github.com/sassoftware/relic/v7/lib/audit"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/cosign"
+	"github.com/sassoftware/relic/v7/lib/intoto"
+	"github.com/sassoftware/relic/v7/lib/sigstore"
+	"github.com/sassoftware/relic/v7/signers"
+)
+
+var CosignSigner = &signers.Signer{
+	Name:      "cosign",
+	Aliases:   []string{"oci-image"},
+	CertTypes: signers.CertTypeX509,
+	FormatLog: formatLog,
+	Sign:      sign,
+}
+
+const maxPayload = 1 << 20
+
+func init() {
+	signers.Register(CosignSigner)
+}
+
+func formatLog(attrs *audit.Info) *zerolog.Event {
+	return attrs.AttrsForLog("cosign.")
+}
+
+func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	payload, err := ioutil.ReadAll(io.LimitReader(r, maxPayload+1))
+	if err != nil {
+		return nil, err
+	} else if len(payload) > maxPayload {
+		return nil, errors.New("image signature payload is too large")
+	}
+	subj, err := cosign.ParsePayload(payload)
+	if err != nil {
+		return nil, err
+	}
+	opts.Audit.Attributes["cosign.image"] = subj.Name
+	opts.Audit.Attributes["cosign.digest"] = subj.Digest
+	if len(subj.Annotations) != 0 {
+		opts.Audit.Attributes["cosign.annotations"] = subj.Annotations
+	}
+	var bundle *sigstore.Bundle
+	if cosign.IsStatement(payload) {
+		bundle, err = sigstore.SignDSSE(opts.Context(), cert, intoto.PayloadType, payload)
+	} else {
+		hash := sigstore.HashForKey(cert.Leaf.PublicKey)
+		d := hash.New()
+		d.Write(payload)
+		bundle, err = sigstore.SignMessage(opts.Context(), cert, hash, d.Sum(nil))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("signing %s@%s: %w", subj.Name, subj.Digest, err)
+	}
+	opts.Audit.SetMimeType(sigstore.MediaType)
+	return json.Marshal(bundle)
+}
@@ -0,0 +1,122 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package crx
+
+// Sign Chrome extensions, producing a CRX3 package from a zip archive or
+// replacing the header of an existing one
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/rs/zerolog"
+
+	"github.com/sassoftware/relic/v7/lib/audit"
+	"github.com/sassoftware/relic/v7/lib/binpatch"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/crx"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+	"github.com/sassoftware/relic/v7/signers"
+	"github.com/sassoftware/relic/v7/signers/sigerrors"
+)
+
+var CrxSigner = &signers.Signer{
+	Name:      "crx",
+	Aliases:   []string{"chrome"},
+	TestPath:  testPath,
+	FormatLog: formatLog,
+	Sign:      sign,
+	Verify:    verify,
+}
+
+func init() {
+	signers.Register(CrxSigner)
+}
+
+func testPath(fp string) bool {
+	return filepath.Ext(fp) == ".crx"
+}
+
+func formatLog(attrs *audit.Info) *zerolog.Event {
+	return attrs.AttrsForLog("crx.")
+}
+
+func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	blob, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	pkg, err := crx.Parse(blob)
+	if err != nil {
+		return nil, err
+	}
+	header, err := pkg.Sign(cert.Signer())
+	if err != nil {
+		return nil, err
+	}
+	if spki, err := x509.MarshalPKIXPublicKey(cert.Signer().Public()); err == nil {
+		opts.Audit.Attributes["crx.id"] = crx.ExtensionID(crx.CrxID(spki))
+	}
+	patch := binpatch.New()
+	patch.Add(0, pkg.HeaderSize, header)
+	return opts.SetBinPatch(patch)
+}
+
+func verify(f *os.File, opts signers.VerifyOpts) ([]*signers.Signature, error) {
+	blob, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	pkg, err := crx.Parse(blob)
+	if err != nil {
+		return nil, err
+	}
+	id, keys, err := pkg.Verify()
+	if errors.Is(err, crx.ErrNotSigned) {
+		return nil, sigerrors.NotSignedError{Type: "crx"}
+	} else if err != nil {
+		return nil, err
+	}
+	sigs := make([]*signers.Signature, len(keys))
+	for i, key := range keys {
+		sigs[i] = &signers.Signature{
+			Package: id,
+			Hash:    crypto.SHA256,
+			Signer:  keyName(key, opts.TrustedX509),
+		}
+	}
+	return sigs, nil
+}
+
+// name a signing key after a matching trusted certificate, or else by its
+// fingerprint
+func keyName(key crypto.PublicKey, trusted []*x509.Certificate) string {
+	for _, cert := range trusted {
+		if k, ok := cert.PublicKey.(interface{ Equal(crypto.PublicKey) bool }); ok && k.Equal(key) {
+			return fmt.Sprintf("`%s`", x509tools.FormatSubject(cert))
+		}
+	}
+	spki, _ := x509.MarshalPKIXPublicKey(key)
+	return fmt.Sprintf("key %x", sha256.Sum256(spki))
+}
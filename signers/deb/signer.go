@@ -38,6 +38,8 @@ var DebSigner = &signers.Signer{
 	FormatLog: formatLog,
 	Sign:      sign,
 	Verify:    verify,
+
+	RemoveSignature: removeSignature,
 }
 
 func init() {
@@ -64,6 +66,14 @@ func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]b
 	return opts.SetBinPatch(sig.PatchSet)
 }
 
+func removeSignature(f *os.File, dest string) error {
+	patch, err := signdeb.RemoveSignatures(f)
+	if err != nil {
+		return err
+	}
+	return patch.Apply(f, dest)
+}
+
 func verify(f *os.File, opts signers.VerifyOpts) ([]*signers.Signature, error) {
 	sigmap, err := signdeb.Verify(f, opts.TrustedPgp, opts.NoDigests)
 	if err != nil {
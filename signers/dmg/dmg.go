@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/sassoftware/relic/v7/lib/certloader"
@@ -23,6 +24,8 @@ var signer = &signers.Signer{
 func init() {
 	signer.Flags().String("bundle-id", "", "(Apple) app bundle ID")
 	signer.Flags().String("requirements", "", "(Apple) requirements file to embed (binary only)")
+	signer.Flags().Bool("legacy-sha1", false, "(Apple) add a SHA-1 code directory for macOS before 10.11.4 and iOS before 11")
+	signer.Flags().Bool("notarize", false, "(Apple) submit the signed file for notarization and staple the ticket")
 	signers.Register(signer)
 }
 
@@ -44,6 +47,11 @@ func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]b
 	if v := args["requirements"]; v != nil {
 		params.Requirements = v
 	}
+	params.LegacySHA1 = opts.Flags.GetBool("legacy-sha1")
+	if params.SigningIdentity == "" && opts.Path != "" {
+		// like codesign, identify the image by its file name
+		params.SigningIdentity = strings.TrimSuffix(filepath.Base(opts.Path), ".dmg")
+	}
 	udifBytes := args[udifName]
 	patch, tsig, err := dmg.Sign(opts.Context(), udifBytes, payload, cert, params)
 	if err != nil {
@@ -0,0 +1,141 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dsc
+
+// Sign Debian source package descriptions (.dsc), upload descriptions
+// (.changes) and build information (.buildinfo) with a cleartext signature.
+// Files that are already signed have their old signature replaced.
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"golang.org/x/crypto/openpgp/packet"
+
+	"github.com/sassoftware/relic/v7/lib/atomicfile"
+	"github.com/sassoftware/relic/v7/lib/audit"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/pgptools"
+	"github.com/sassoftware/relic/v7/lib/signdeb"
+	"github.com/sassoftware/relic/v7/signers"
+)
+
+var DscSigner = &signers.Signer{
+	Name:         "dsc",
+	Aliases:      []string{"changes", "buildinfo"},
+	CertTypes:    signers.CertTypePgp,
+	TestPath:     testPath,
+	FormatLog:    formatLog,
+	Transform:    transform,
+	Sign:         sign,
+	VerifyStream: verify,
+}
+
+func init() {
+	signers.Register(DscSigner)
+}
+
+func testPath(fp string) bool {
+	return strings.HasSuffix(fp, ".dsc") || strings.HasSuffix(fp, ".changes") || strings.HasSuffix(fp, ".buildinfo")
+}
+
+func formatLog(attrs *audit.Info) *zerolog.Event {
+	return attrs.AttrsForLog("deb.")
+}
+
+type dscTransformer struct {
+	f        *os.File
+	document []byte
+}
+
+func transform(f *os.File, opts signers.SignOpts) (signers.Transformer, error) {
+	blob, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	document, err := signdeb.StripClearSign(blob)
+	if err != nil {
+		return nil, err
+	}
+	return &dscTransformer{f: f, document: document}, nil
+}
+
+func (t *dscTransformer) GetReader() (io.Reader, error) {
+	return bytes.NewReader(t.document), nil
+}
+
+func (t *dscTransformer) Apply(dest, mimeType string, result io.Reader) error {
+	sig, err := ioutil.ReadAll(result)
+	if err != nil {
+		return err
+	}
+	outfile, err := atomicfile.WriteAny(dest)
+	if err != nil {
+		return err
+	}
+	defer outfile.Close()
+	if err := signdeb.MergeClearSign(outfile, sig, t.document); err != nil {
+		return err
+	}
+	t.f.Close()
+	return outfile.Commit()
+}
+
+func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	document, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	info, err := signdeb.ParseSourceInfo(document)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	config := &packet.Config{
+		DefaultHash: opts.Hash,
+		Time:        func() time.Time { return opts.Time },
+	}
+	if err := pgptools.DetachClearSign(&buf, cert.PgpKey, bytes.NewReader(document), config); err != nil {
+		return nil, err
+	}
+	opts.Audit.Attributes["deb.name"] = info.Source
+	opts.Audit.Attributes["deb.version"] = info.Version
+	opts.Audit.Attributes["deb.arch"] = info.Arch
+	return buf.Bytes(), nil
+}
+
+func verify(r io.Reader, opts signers.VerifyOpts) ([]*signers.Signature, error) {
+	var document bytes.Buffer
+	sig, err := pgptools.VerifyClearSign(r, &document, opts.TrustedPgp)
+	if err != nil {
+		return nil, err
+	}
+	ret := &signers.Signature{
+		CreationTime: sig.CreationTime,
+		Hash:         sig.Hash,
+		SignerPgp:    sig.Key.Entity,
+	}
+	if info, err := signdeb.ParseSourceInfo(document.Bytes()); err == nil {
+		ret.Package = info.Source + "_" + info.Version
+	}
+	return []*signers.Signature{ret}, nil
+}
@@ -0,0 +1,145 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package efivar
+
+// Sign UEFI Secure Boot authenticated variable updates (PK, KEK, db, dbx).
+// The input is an EFI signature list, or a single certificate to be enrolled,
+// and the output is the signed update as accepted by SetVariable().
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/efivar"
+	"github.com/sassoftware/relic/v7/signers"
+)
+
+var EfiVarSigner = &signers.Signer{
+	Name:      "efivar",
+	Aliases:   []string{"uefi-var"},
+	CertTypes: signers.CertTypeX509,
+	TestPath:  testPath,
+	Sign:      sign,
+	Verify:    verify,
+}
+
+func init() {
+	EfiVarSigner.Flags().String("efi-var", "", "(UEFI) name of the variable to update: PK, KEK, db, dbx, ...")
+	EfiVarSigner.Flags().String("efi-vendor", "", "(UEFI) vendor GUID of the variable, if not a well-known Secure Boot variable")
+	EfiVarSigner.Flags().String("efi-owner", "", "(UEFI) owner GUID to use when enrolling a certificate")
+	EfiVarSigner.Flags().Bool("efi-append", false, "(UEFI) append to the variable instead of replacing it")
+	signers.Register(EfiVarSigner)
+}
+
+func testPath(fp string) bool {
+	return strings.HasSuffix(fp, ".esl") || strings.HasSuffix(fp, ".auth")
+}
+
+func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	blob, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	v := &efivar.AuthenticatedVariable{
+		Name:       opts.Flags.GetString("efi-var"),
+		Attributes: efivar.DefaultAttributes,
+		Time:       opts.Time,
+	}
+	if v.Name == "" {
+		return nil, errors.New("--efi-var is required")
+	}
+	if opts.Flags.GetBool("efi-append") {
+		v.Attributes |= efivar.AppendWrite
+	}
+	if vendor := opts.Flags.GetString("efi-vendor"); vendor != "" {
+		v.Vendor, err = efivar.ParseGUID(vendor)
+		if err != nil {
+			return nil, err
+		}
+	} else if vendor, ok := efivar.KnownVariables[v.Name]; ok {
+		v.Vendor = vendor
+	} else {
+		return nil, fmt.Errorf("--efi-vendor is required for variable %q", v.Name)
+	}
+	v.Data, err = signatureLists(blob, opts.Flags.GetString("efi-owner"))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := v.Sign(cert); err != nil {
+		return nil, err
+	}
+	opts.Audit.Attributes["efi.variable"] = v.Name
+	opts.Audit.Attributes["efi.vendor"] = v.Vendor.String()
+	opts.Audit.SetMimeType("application/octet-stream")
+	return v.Bytes(), nil
+}
+
+// signatureLists validates the input as EFI signature lists, or wraps it in
+// one if it is a certificate
+func signatureLists(blob []byte, owner string) ([]byte, error) {
+	der := blob
+	if block, _ := pem.Decode(blob); block != nil && block.Type == "CERTIFICATE" {
+		der = block.Bytes
+	}
+	if _, err := x509.ParseCertificate(der); err == nil {
+		if owner == "" {
+			return nil, errors.New("--efi-owner is required when enrolling a certificate")
+		}
+		ownerGUID, err := efivar.ParseGUID(owner)
+		if err != nil {
+			return nil, err
+		}
+		return efivar.X509SignatureList(ownerGUID, der).Bytes()
+	}
+	if _, err := efivar.ParseSignatureLists(blob); err != nil {
+		return nil, fmt.Errorf("input is not a certificate or EFI signature list: %w", err)
+	}
+	return blob, nil
+}
+
+func verify(f *os.File, opts signers.VerifyOpts) ([]*signers.Signature, error) {
+	blob, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	v, err := efivar.Parse(blob)
+	if err != nil {
+		return nil, err
+	}
+	ts, err := v.Verify(opts.NoDigests)
+	if err != nil {
+		return nil, err
+	}
+	pkg := v.Name
+	if pkg == "" {
+		pkg = "UEFI variable"
+	}
+	return []*signers.Signature{{
+		Package:       pkg,
+		CreationTime:  v.Time,
+		Hash:          crypto.SHA256,
+		X509Signature: ts,
+	}}, nil
+}
@@ -0,0 +1,137 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package fit
+
+// Sign U-Boot FIT images for verified boot, like "mkimage -k"
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sassoftware/relic/v7/lib/binpatch"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/fit"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+	"github.com/sassoftware/relic/v7/signers"
+)
+
+var FitSigner = &signers.Signer{
+	Name:     "fit",
+	Aliases:  []string{"uboot"},
+	TestPath: testPath,
+	Sign:     sign,
+	Verify:   verify,
+}
+
+func init() {
+	FitSigner.Flags().String("fit-key-name", "", "(FIT) Sign nodes with this key-name-hint, and use it to name new signature nodes (default: the key name)")
+	FitSigner.Flags().Bool("fit-pss", false, "(FIT) Use RSASSA-PSS padding for new signature nodes")
+	signers.Register(FitSigner)
+}
+
+func testPath(fp string) bool {
+	switch strings.ToLower(filepath.Ext(fp)) {
+	case ".itb", ".fit":
+		return true
+	}
+	return false
+}
+
+func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	blob, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	img, err := fit.Parse(blob)
+	if err != nil {
+		return nil, err
+	}
+	keyName := opts.Flags.GetString("fit-key-name")
+	if keyName == "" {
+		keyName = cert.KeyName
+	}
+	tree, signed, err := img.Sign(cert.Signer(), fit.SignOptions{
+		KeyName: keyName,
+		Hash:    opts.Hash,
+		PSS:     opts.Flags.GetBool("fit-pss"),
+		Time:    opts.Time,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var nodes []string
+	for _, sig := range signed {
+		nodes = append(nodes, sig.Path)
+	}
+	opts.Audit.Attributes["fit.key-name"] = keyName
+	opts.Audit.Attributes["fit.algo"] = signed[0].Algo
+	opts.Audit.Attributes["fit.nodes"] = strings.Join(nodes, ",")
+	patch := binpatch.New()
+	patch.Add(0, int64(img.DataOffset()), tree)
+	return opts.SetBinPatch(patch)
+}
+
+func verify(f *os.File, opts signers.VerifyOpts) ([]*signers.Signature, error) {
+	blob, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	img, err := fit.Parse(blob)
+	if err != nil {
+		return nil, err
+	}
+	if !opts.NoDigests {
+		if err := img.CheckHashes(); err != nil {
+			return nil, err
+		}
+	}
+	if len(opts.TrustedX509) == 0 {
+		return nil, errors.New("no trusted keys; use --cert to specify the key the image was signed with")
+	}
+	keys := make([]crypto.PublicKey, len(opts.TrustedX509))
+	for i, cert := range opts.TrustedX509 {
+		keys[i] = cert.PublicKey
+	}
+	verified, err := img.Verify(keys)
+	if err != nil {
+		return nil, err
+	}
+	var sigs []*signers.Signature
+	for _, sig := range verified {
+		var signer string
+		for _, cert := range opts.TrustedX509 {
+			if cert.PublicKey == sig.Key {
+				signer = fmt.Sprintf("`%s`", x509tools.FormatSubject(cert))
+				break
+			}
+		}
+		sigs = append(sigs, &signers.Signature{
+			Package:      sig.Path,
+			SigInfo:      sig.Algo,
+			Hash:         sig.Hash,
+			CreationTime: sig.Timestamp,
+			Signer:       signer,
+		})
+	}
+	return sigs, nil
+}
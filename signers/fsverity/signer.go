@@ -0,0 +1,71 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package fsverity
+
+// Produce fs-verity built-in signatures. The result is a detached DER PKCS#7
+// signature to pass to FS_IOC_ENABLE_VERITY, or to "fsverity enable
+// --signature".
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/fsverity"
+	"github.com/sassoftware/relic/v7/lib/pkcs7"
+	"github.com/sassoftware/relic/v7/signers"
+)
+
+var FsveritySigner = &signers.Signer{
+	Name:       "fsverity",
+	Aliases:    []string{"fs-verity"},
+	CertTypes:  signers.CertTypeX509,
+	AllowStdin: true,
+	Sign:       sign,
+}
+
+func init() {
+	FsveritySigner.Flags().Int("fsverity-block-size", fsverity.DefaultBlockSize, "(fs-verity) Merkle tree block size")
+	FsveritySigner.Flags().String("fsverity-salt", "", "(fs-verity) Merkle tree salt, in hex")
+	signers.Register(FsveritySigner)
+}
+
+func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	params := fsverity.Params{Hash: opts.Hash}
+	var err error
+	params.BlockSize, err = strconv.Atoi(opts.Flags.GetString("fsverity-block-size"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid block size: %w", err)
+	}
+	params.Salt, err = hex.DecodeString(opts.Flags.GetString("fsverity-salt"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid salt: %w", err)
+	}
+	digest, err := fsverity.Digest(r, params)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := fsverity.Sign(cert, opts.Hash, digest)
+	if err != nil {
+		return nil, err
+	}
+	opts.Audit.Attributes["fsverity.digest"] = fmt.Sprintf("%x", digest)
+	opts.Audit.SetMimeType(pkcs7.MimeType)
+	return sig.Raw, nil
+}
@@ -0,0 +1,84 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package gem
+
+// Sign RubyGems packages
+
+import (
+	"crypto"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"github.com/sassoftware/relic/v7/lib/audit"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/pkcs7"
+	"github.com/sassoftware/relic/v7/lib/pkcs9"
+	"github.com/sassoftware/relic/v7/lib/signgem"
+	"github.com/sassoftware/relic/v7/signers"
+	"github.com/sassoftware/relic/v7/signers/sigerrors"
+)
+
+var GemSigner = &signers.Signer{
+	Name:      "gem",
+	Aliases:   []string{"rubygems"},
+	CertTypes: signers.CertTypeX509,
+	TestPath:  testPath,
+	FormatLog: formatLog,
+	Sign:      sign,
+	Verify:    verify,
+}
+
+func init() {
+	signers.Register(GemSigner)
+}
+
+func testPath(fp string) bool {
+	return strings.HasSuffix(fp, ".gem")
+}
+
+func formatLog(attrs *audit.Info) *zerolog.Event {
+	return attrs.AttrsForLog("gem.")
+}
+
+func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	sig, err := signgem.Sign(r, cert.Signer(), cert.Chain(), opts.Time)
+	if err != nil {
+		return nil, err
+	}
+	opts.Audit.Attributes["gem.name"] = sig.Name
+	opts.Audit.Attributes["gem.version"] = sig.Version
+	return opts.SetBinPatch(sig.PatchSet)
+}
+
+func verify(f *os.File, opts signers.VerifyOpts) ([]*signers.Signature, error) {
+	info, err := signgem.Verify(f)
+	if err != nil {
+		return nil, err
+	} else if info == nil {
+		return nil, sigerrors.NotSignedError{Type: "gem"}
+	}
+	return []*signers.Signature{{
+		Package: info.Name + "-" + info.Version,
+		Hash:    crypto.SHA256,
+		X509Signature: &pkcs9.TimestampedSignature{Signature: pkcs7.Signature{
+			Certificate:   info.Certificates[0],
+			Intermediates: info.Certificates[1:],
+		}},
+	}}, nil
+}
@@ -0,0 +1,92 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package intoto
+
+// Sign in-toto statements, such as the SLSA provenance made by "relic sign
+// --attest", into a DSSE envelope. The output is one line of a .intoto.jsonl
+// file.
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+
+	"github.com/rs/zerolog"
+
+	"github.com/sassoftware/relic/v7/lib/audit"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/dsse"
+	"github.com/sassoftware/relic/v7/lib/intoto"
+	"github.com/sassoftware/relic/v7/signers"
+)
+
+var IntotoSigner = &signers.Signer{
+	Name:      "intoto",
+	Aliases:   []string{"in-toto", "slsa"},
+	FormatLog: formatLog,
+	Sign:      sign,
+}
+
+const maxStatement = 4 << 20
+
+func init() {
+	signers.Register(IntotoSigner)
+}
+
+func formatLog(attrs *audit.Info) *zerolog.Event {
+	return attrs.AttrsForLog("intoto.")
+}
+
+func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	payload, err := ioutil.ReadAll(io.LimitReader(r, maxStatement+1))
+	if err != nil {
+		return nil, err
+	} else if len(payload) > maxStatement {
+		return nil, errors.New("in-toto statement is too large")
+	}
+	stmt, err := intoto.Parse(payload)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(stmt.Subject))
+	for i, subj := range stmt.Subject {
+		names[i] = subj.Name
+	}
+	opts.Audit.Attributes["intoto.predicateType"] = stmt.PredicateType
+	opts.Audit.Attributes["intoto.subjects"] = names
+	env, err := SignStatement(cert, opts, payload)
+	if err != nil {
+		return nil, err
+	}
+	opts.Audit.SetMimeType("application/jsonl")
+	return env, nil
+}
+
+// SignStatement wraps a statement in a DSSE envelope, returning it as a line
+// of JSON
+func SignStatement(cert *certloader.Certificate, opts signers.SignOpts, statement []byte) ([]byte, error) {
+	env, err := dsse.Sign(cert.Signer(), opts.Hash, intoto.PayloadType, statement, "")
+	if err != nil {
+		return nil, err
+	}
+	blob, err := json.Marshal(env)
+	if err != nil {
+		return nil, err
+	}
+	return append(blob, '\n'), nil
+}
@@ -0,0 +1,251 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package iso
+
+// Sign ISO 9660 images. The signature is written alongside the image as
+// <image>.p7s or <image>.asc, or embedded in the system area.
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
+
+	"github.com/sassoftware/relic/v7/lib/atomicfile"
+	"github.com/sassoftware/relic/v7/lib/audit"
+	"github.com/sassoftware/relic/v7/lib/binpatch"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/isoimage"
+	"github.com/sassoftware/relic/v7/lib/pgptools"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+	"github.com/sassoftware/relic/v7/signers"
+	"github.com/sassoftware/relic/v7/signers/sigerrors"
+)
+
+var IsoSigner = &signers.Signer{
+	Name:      "iso",
+	TestPath:  testPath,
+	FormatLog: formatLog,
+	Transform: transform,
+	Sign:      sign,
+	Verify:    verify,
+}
+
+// file suffixes of detached signatures
+var detachedSuffixes = []struct {
+	suffix  string
+	sigType isoimage.SignatureType
+}{
+	{".p7s", isoimage.SignatureCMS},
+	{".asc", isoimage.SignaturePGP},
+}
+
+func init() {
+	IsoSigner.Flags().String("iso-sig-type", "", "(ISO) Signature type: cms or pgp. Defaults to cms unless the key only has a PGP certificate")
+	IsoSigner.Flags().Bool("iso-embed", false, "(ISO) Embed the signature in the system area instead of writing it alongside the image")
+	signers.Register(IsoSigner)
+}
+
+func testPath(fp string) bool {
+	return strings.HasSuffix(strings.ToLower(fp), ".iso")
+}
+
+func formatLog(attrs *audit.Info) *zerolog.Event {
+	return attrs.AttrsForLog("iso.")
+}
+
+type isoTransformer struct {
+	f *os.File
+}
+
+func transform(f *os.File, opts signers.SignOpts) (signers.Transformer, error) {
+	return &isoTransformer{f: f}, nil
+}
+
+func (t *isoTransformer) GetReader() (io.Reader, error) {
+	if _, err := t.f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return t.f, nil
+}
+
+// Patch an embedded signature into the image, or write a detached signature
+// next to it if the output is the image itself
+func (t *isoTransformer) Apply(dest, mimeType string, result io.Reader) error {
+	if mimeType == binpatch.MimeType {
+		return signers.ApplyBinPatch(t.f, dest, result)
+	}
+	if dest == t.f.Name() {
+		switch mimeType {
+		case "application/pgp-signature":
+			dest += ".asc"
+		default:
+			dest += ".p7s"
+		}
+	}
+	outfile, err := atomicfile.WriteAny(dest)
+	if err != nil {
+		return err
+	}
+	defer outfile.Close()
+	if _, err := io.Copy(outfile, result); err != nil {
+		return err
+	}
+	t.f.Close()
+	return outfile.Commit()
+}
+
+func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	var sigType isoimage.SignatureType
+	switch opts.Flags.GetString("iso-sig-type") {
+	case "cms":
+		sigType = isoimage.SignatureCMS
+	case "pgp":
+		sigType = isoimage.SignaturePGP
+	case "":
+		sigType = isoimage.SignatureCMS
+		if cert.Leaf == nil && cert.PgpKey != nil {
+			sigType = isoimage.SignaturePGP
+		}
+	default:
+		return nil, fmt.Errorf("unknown iso-sig-type %q", opts.Flags.GetString("iso-sig-type"))
+	}
+	img, err := isoimage.Read(r)
+	if err != nil {
+		return nil, err
+	}
+	var sig []byte
+	switch sigType {
+	case isoimage.SignatureCMS:
+		if cert.Leaf == nil {
+			return nil, errors.New("CMS signatures require a X.509 certificate")
+		}
+		ts, err := img.SignCMS(opts.Context(), cert, opts.Hash, opts.Time)
+		if err != nil {
+			return nil, err
+		}
+		opts.Audit.SetCounterSignature(ts.CounterSignature)
+		sig = ts.Raw
+	case isoimage.SignaturePGP:
+		if cert.PgpKey == nil {
+			return nil, errors.New("PGP signatures require a PGP certificate")
+		}
+		sig, err = img.SignPGP(cert.PgpKey, &packet.Config{
+			DefaultHash: opts.Hash,
+			Time:        func() time.Time { return opts.Time },
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	opts.Audit.Attributes["iso.volume"] = img.VolumeID
+	opts.Audit.Attributes["iso.sigtype"] = sigType.String()
+	if opts.Flags.GetBool("iso-embed") {
+		patch, err := img.EmbedPatch(sigType, sig)
+		if err != nil {
+			return nil, err
+		}
+		return opts.SetBinPatch(patch)
+	}
+	if sigType == isoimage.SignaturePGP {
+		var buf bytes.Buffer
+		w, err := armor.Encode(&buf, openpgp.SignatureType, nil)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(sig); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		buf.WriteByte('\n')
+		opts.Audit.SetMimeType("application/pgp-signature")
+		return buf.Bytes(), nil
+	}
+	opts.Audit.SetMimeType("application/pkcs7-signature")
+	return sig, nil
+}
+
+func verify(f *os.File, opts signers.VerifyOpts) ([]*signers.Signature, error) {
+	img, err := isoimage.Read(f)
+	if err != nil {
+		return nil, err
+	}
+	sigType, sig := img.Embedded()
+	if sig == nil {
+		// look for a detached signature
+		for _, d := range detachedSuffixes {
+			sig, err = ioutil.ReadFile(f.Name() + d.suffix)
+			if err == nil {
+				sigType = d.sigType
+				break
+			} else if !os.IsNotExist(err) {
+				return nil, err
+			}
+		}
+		if sig == nil {
+			return nil, sigerrors.NotSignedError{Type: "ISO image"}
+		}
+		if sigType == isoimage.SignaturePGP {
+			block, err := armor.Decode(bytes.NewReader(sig))
+			if err != nil {
+				return nil, err
+			}
+			sig, err = ioutil.ReadAll(block.Body)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	var ret *signers.Signature
+	switch sigType {
+	case isoimage.SignatureCMS:
+		ts, err := img.VerifyCMS(sig, opts.NoDigests)
+		if err != nil {
+			return nil, err
+		}
+		hash, _ := x509tools.PkixDigestToHash(ts.SignerInfo.DigestAlgorithm)
+		ret = &signers.Signature{Hash: hash, X509Signature: ts}
+	case isoimage.SignaturePGP:
+		pgpsig, err := img.VerifyPGP(sig, opts.TrustedPgp)
+		if err != nil {
+			if pgpsig != nil {
+				return nil, fmt.Errorf("bad signature from %s(%x) [%s]: %w", pgptools.EntityName(pgpsig.Key.Entity), pgpsig.Key.PublicKey.KeyId, pgpsig.CreationTime, err)
+			}
+			return nil, err
+		}
+		ret = &signers.Signature{
+			CreationTime: pgpsig.CreationTime,
+			Hash:         pgpsig.Hash,
+			SignerPgp:    pgpsig.Key.Entity,
+		}
+	default:
+		return nil, fmt.Errorf("unsupported embedded signature %s", sigType)
+	}
+	ret.Package = img.VolumeID
+	return []*signers.Signature{ret}, nil
+}
@@ -37,13 +37,15 @@ var JarSigner = &signers.Signer{
 	Transform: zipbased.Transform,
 	Sign:      sign,
 	Verify:    verify,
+
+	RemoveSignature: zipbased.RemoveSignature,
 }
 
 func init() {
 	JarSigner.Flags().Bool("sections-only", false, "(JAR) Don't compute hash of entire manifest")
 	JarSigner.Flags().Bool("inline-signature", false, "(JAR) Include .SF inside the signature block")
 	JarSigner.Flags().Bool("apk-v2-present", false, "(JAR) Add X-Android-APK-Signed header to signature")
-	JarSigner.Flags().String("key-alias", "RELIC", "(JAR, APK) Alias to use for the signed manifest")
+	JarSigner.Flags().String("key-alias", "RELIC", "(JAR, APK, AAB) Alias to use for the signed manifest")
 	signers.Register(JarSigner)
 }
 
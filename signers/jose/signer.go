@@ -0,0 +1,144 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jose
+
+// Sign arbitrary payloads, such as JWT claims or manifests, as a JWS in the
+// compact or flattened JSON serialization
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/rs/zerolog"
+
+	"github.com/sassoftware/relic/v7/lib/audit"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/jose"
+	"github.com/sassoftware/relic/v7/lib/pkcs7"
+	"github.com/sassoftware/relic/v7/lib/pkcs9"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+	"github.com/sassoftware/relic/v7/signers"
+)
+
+var JoseSigner = &signers.Signer{
+	Name:         "jws",
+	Aliases:      []string{"jose", "jwt"},
+	TestPath:     testPath,
+	FormatLog:    formatLog,
+	Sign:         sign,
+	VerifyStream: verify,
+}
+
+const maxPayload = 16 << 20
+
+func init() {
+	JoseSigner.Flags().Bool("jws-json", false, "(JWS) Output the flattened JSON serialization instead of the compact one")
+	JoseSigner.Flags().Bool("jws-detached", false, "(JWS) Leave the payload out of the output")
+	JoseSigner.Flags().Bool("jws-pss", false, "(JWS) Use PS256/384/512 instead of RS256/384/512 for RSA keys")
+	JoseSigner.Flags().Bool("jws-no-x5c", false, "(JWS) Don't embed the certificate chain in the x5c header")
+	JoseSigner.Flags().String("jws-typ", "", "(JWS) Value of the typ header, e.g. JWT")
+	JoseSigner.Flags().String("jws-cty", "", "(JWS) Value of the cty header")
+	JoseSigner.Flags().String("jws-kid", "", "(JWS) Value of the kid header")
+	signers.Register(JoseSigner)
+}
+
+func testPath(fp string) bool {
+	switch filepath.Ext(fp) {
+	case ".jws", ".jwt":
+		return true
+	}
+	return false
+}
+
+func formatLog(attrs *audit.Info) *zerolog.Event {
+	return attrs.AttrsForLog("jws.")
+}
+
+func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	payload, err := ioutil.ReadAll(io.LimitReader(r, maxPayload+1))
+	if err != nil {
+		return nil, err
+	} else if len(payload) > maxPayload {
+		return nil, errors.New("JWS payload is too large")
+	}
+	jopts := jose.SignOptions{
+		Hash:        opts.Hash,
+		PSS:         opts.Flags.GetBool("jws-pss"),
+		Type:        opts.Flags.GetString("jws-typ"),
+		ContentType: opts.Flags.GetString("jws-cty"),
+		KeyID:       opts.Flags.GetString("jws-kid"),
+	}
+	if !opts.Flags.GetBool("jws-no-x5c") {
+		jopts.Certificates = cert.Chain()
+	}
+	j, err := jose.Sign(payload, cert.Signer(), jopts)
+	if err != nil {
+		return nil, err
+	}
+	opts.Audit.Attributes["jws.alg"] = string(j.Header.Alg)
+	if jopts.Type != "" {
+		opts.Audit.Attributes["jws.typ"] = jopts.Type
+	}
+	detached := opts.Flags.GetBool("jws-detached")
+	if opts.Flags.GetBool("jws-json") {
+		opts.Audit.SetMimeType("application/jose+json")
+		blob, err := j.JSON(detached)
+		if err != nil {
+			return nil, err
+		}
+		return append(blob, '\n'), nil
+	}
+	opts.Audit.SetMimeType("application/jose")
+	return append(j.Compact(detached), '\n'), nil
+}
+
+func verify(r io.Reader, opts signers.VerifyOpts) ([]*signers.Signature, error) {
+	blob, err := ioutil.ReadAll(io.LimitReader(r, 2*maxPayload))
+	if err != nil {
+		return nil, err
+	}
+	j, err := jose.Parse(blob)
+	if err != nil {
+		return nil, err
+	}
+	if j.Payload == nil && opts.Content != "" {
+		j.Payload, err = ioutil.ReadFile(opts.Content)
+		if err != nil {
+			return nil, err
+		}
+	}
+	signer, err := j.Verify(opts.TrustedX509)
+	if err != nil {
+		return nil, err
+	}
+	sig := &signers.Signature{
+		SigInfo: string(j.Header.Alg),
+		Hash:    j.Header.Alg.Hash(),
+	}
+	if len(j.Header.X5c) != 0 {
+		certs, _ := j.Certificates()
+		sig.X509Signature = &pkcs9.TimestampedSignature{
+			Signature: pkcs7.Signature{Certificate: signer, Intermediates: certs},
+		}
+	} else {
+		sig.Signer = fmt.Sprintf("`%s`", x509tools.FormatSubject(signer))
+	}
+	return []*signers.Signature{sig}, nil
+}
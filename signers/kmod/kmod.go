@@ -0,0 +1,84 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package kmod
+
+// Sign Linux kernel modules
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/sassoftware/relic/v7/lib/binpatch"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/kmod"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+	"github.com/sassoftware/relic/v7/signers"
+)
+
+var KmodSigner = &signers.Signer{
+	Name:      "kmod",
+	Aliases:   []string{"ko"},
+	CertTypes: signers.CertTypeX509,
+	TestPath:  testPath,
+	Sign:      sign,
+	Verify:    verify,
+}
+
+func init() {
+	signers.Register(KmodSigner)
+}
+
+func testPath(fp string) bool {
+	return strings.HasSuffix(fp, ".ko")
+}
+
+func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	blob, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	// replace any existing signature
+	contents, _, err := kmod.Split(blob)
+	if err != nil {
+		return nil, err
+	}
+	sigblock, _, err := kmod.Sign(contents, cert, opts.Hash)
+	if err != nil {
+		return nil, err
+	}
+	patch := binpatch.New()
+	patch.Add(int64(len(contents)), int64(len(blob)-len(contents)), sigblock)
+	return opts.SetBinPatch(patch)
+}
+
+func verify(f *os.File, opts signers.VerifyOpts) ([]*signers.Signature, error) {
+	blob, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := kmod.Verify(blob, opts.TrustedX509, opts.NoDigests)
+	if err != nil {
+		return nil, err
+	}
+	hash, _ := x509tools.PkixDigestToHash(sig.SignerInfo.DigestAlgorithm)
+	return []*signers.Signature{{
+		Hash:          hash,
+		X509Signature: sig,
+	}}, nil
+}
@@ -6,19 +6,36 @@ import (
 	"io"
 	"os"
 
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/fruit/machos"
 	"github.com/sassoftware/relic/v7/lib/magic"
 	"github.com/sassoftware/relic/v7/signers"
 )
 
-var fatVerifier = &signers.Signer{
+var fatSigner = &signers.Signer{
 	Name:      "mach-o-fat",
 	Magic:     magic.FileTypeMachOFat,
 	CertTypes: signers.CertTypeX509,
+	Transform: transform,
+	Sign:      signFat,
 	Verify:    verifyFatFile,
 }
 
 func init() {
-	signers.Register(fatVerifier)
+	signers.Register(fatSigner)
+}
+
+func signFat(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	args, exec, err := extractFiles(r)
+	if err != nil {
+		return nil, err
+	}
+	params := signParams(args, opts)
+	patch, tsig, err := machos.SignFat(opts.Context(), exec, cert, params)
+	if err != nil {
+		return nil, err
+	}
+	return finishSign(patch, tsig, params, opts)
 }
 
 func verifyFatFile(f *os.File, opts signers.VerifyOpts) ([]*signers.Signature, error) {
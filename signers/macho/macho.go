@@ -4,11 +4,14 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 
+	"github.com/sassoftware/relic/v7/lib/binpatch"
 	"github.com/sassoftware/relic/v7/lib/certloader"
 	"github.com/sassoftware/relic/v7/lib/fruit/csblob"
 	"github.com/sassoftware/relic/v7/lib/fruit/machos"
 	"github.com/sassoftware/relic/v7/lib/magic"
+	"github.com/sassoftware/relic/v7/lib/pkcs9"
 	"github.com/sassoftware/relic/v7/signers"
 )
 
@@ -22,12 +25,17 @@ var signer = &signers.Signer{
 }
 
 func init() {
-	signer.Flags().String("bundle-id", "", "(Apple) app bundle ID")
-	signer.Flags().String("info-plist", "", "(Apple) Info.plist file to bind to the signature")
-	signer.Flags().String("entitlements", "", "(Apple) entitlements file to embed")
-	signer.Flags().Bool("hardened-runtime", false, "(Apple) enable hardened runtime")
-	signer.Flags().String("requirements", "", "(Apple) requirements file to embed (binary only)")
-	signer.Flags().String("resources", "", "(Apple) CodeResources file to bind to the signature")
+	// universal binaries take the same flags
+	for _, s := range []*signers.Signer{signer, fatSigner} {
+		s.Flags().String("bundle-id", "", "(Apple) app bundle ID")
+		s.Flags().String("info-plist", "", "(Apple) Info.plist file to bind to the signature")
+		s.Flags().String("entitlements", "", "(Apple) entitlements file to embed")
+		s.Flags().Bool("hardened-runtime", false, "(Apple) enable hardened runtime")
+		s.Flags().String("requirements", "", "(Apple) requirements file to embed (binary only)")
+		s.Flags().String("resources", "", "(Apple) CodeResources file to bind to the signature")
+		s.Flags().Bool("legacy-sha1", false, "(Apple) add a SHA-1 code directory for macOS before 10.11.4 and iOS before 11")
+		s.Flags().Bool("notarize", false, "(Apple) submit the signed file for notarization and staple the ticket")
+	}
 	signers.Register(signer)
 }
 
@@ -38,6 +46,15 @@ func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]b
 	if err != nil {
 		return nil, err
 	}
+	params := signParams(args, opts)
+	patch, tsig, err := machos.Sign(opts.Context(), exec, cert, params)
+	if err != nil {
+		return nil, err
+	}
+	return finishSign(patch, tsig, params, opts)
+}
+
+func signParams(args map[string][]byte, opts signers.SignOpts) *csblob.SignatureParams {
 	params := &csblob.SignatureParams{
 		HashFunc:        opts.Hash,
 		SigningIdentity: opts.Flags.GetString("bundle-id"),
@@ -57,10 +74,15 @@ func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]b
 	if opts.Flags.GetBool("hardened-runtime") {
 		params.Flags |= csblob.FlagRuntime
 	}
-	patch, tsig, err := machos.Sign(opts.Context(), exec, cert, params)
-	if err != nil {
-		return nil, err
+	params.LegacySHA1 = opts.Flags.GetBool("legacy-sha1")
+	if params.SigningIdentity == "" && params.InfoPlist == nil && opts.Path != "" {
+		// like codesign, identify a bare executable by its file name
+		params.SigningIdentity = filepath.Base(opts.Path)
 	}
+	return params
+}
+
+func finishSign(patch *binpatch.PatchSet, tsig *pkcs9.TimestampedSignature, params *csblob.SignatureParams, opts signers.SignOpts) ([]byte, error) {
 	opts.Audit.Attributes["mach-o.bundle-id"] = params.SigningIdentity
 	opts.Audit.Attributes["mach-o.team-id"] = params.TeamIdentifier
 	opts.Audit.SetCounterSignature(tsig.CounterSignature)
@@ -16,12 +16,16 @@
 
 package msi
 
-// Sign Microsoft Installer files
+// Sign Microsoft Installer packages, patches (.msp) and transforms (.mst)
 
 import (
+	"crypto/hmac"
+	"errors"
 	"io"
 	"io/ioutil"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/sassoftware/relic/v7/lib/atomicfile"
 	"github.com/sassoftware/relic/v7/lib/authenticode"
@@ -39,10 +43,13 @@ var MsiSigner = &signers.Signer{
 	Transform: transform,
 	Sign:      sign,
 	Verify:    verify,
+
+	RemoveSignature: removeSignature,
 }
 
 func init() {
 	MsiSigner.Flags().Bool("no-extended-sig", false, "(MSI) Don't emit a MsiDigitalSignatureEx digest")
+	MsiSigner.Flags().Bool("append", false, "(PE-COFF, MSI) Nest the new signature inside the existing one instead of replacing it")
 	signers.Register(MsiSigner)
 }
 
@@ -50,6 +57,8 @@ type msiTransformer struct {
 	f     *os.File
 	cdf   *comdoc.ComDoc
 	exsig []byte
+	// existing signature to nest the new one in
+	primary []byte
 }
 
 func transform(f *os.File, opts signers.SignOpts) (signers.Transformer, error) {
@@ -57,6 +66,9 @@ func transform(f *os.File, opts signers.SignOpts) (signers.Transformer, error) {
 	if err != nil {
 		return nil, err
 	}
+	if opts.Flags.GetBool("append") {
+		return appendTransform(f, cdf, opts)
+	}
 	var exsig []byte
 	noExtended := opts.Flags.GetBool("no-extended-sig")
 	if !noExtended {
@@ -65,7 +77,28 @@ func transform(f *os.File, opts signers.SignOpts) (signers.Transformer, error) {
 			return nil, err
 		}
 	}
-	return &msiTransformer{f, cdf, exsig}, nil
+	return &msiTransformer{f: f, cdf: cdf, exsig: exsig}, nil
+}
+
+// keep the existing signature and MsiDigitalSignatureEx stream. The new
+// signature covers the latter only if the primary signature does, which
+// requires the same digest algorithm.
+func appendTransform(f *os.File, cdf *comdoc.ComDoc, opts signers.SignOpts) (signers.Transformer, error) {
+	primary, exsig, err := authenticode.ReadMSISignature(cdf)
+	if err != nil {
+		return nil, err
+	}
+	if exsig != nil {
+		prehash, err := authenticode.PrehashMSI(cdf, opts.Hash)
+		if err != nil {
+			return nil, err
+		}
+		if !hmac.Equal(prehash, exsig) {
+			return nil, errors.New("existing signature has a MsiDigitalSignatureEx digest, so the appended signature must use the same digest algorithm")
+		}
+	}
+	opts.Flags.Values["no-extended-sig"] = strconv.FormatBool(exsig == nil)
+	return &msiTransformer{f: f, cdf: cdf, exsig: exsig, primary: primary}, nil
 }
 
 // transform the MSI to a tar stream for upload
@@ -84,6 +117,12 @@ func (t *msiTransformer) Apply(dest, mimeType string, result io.Reader) error {
 	if err != nil {
 		return err
 	}
+	if t.primary != nil {
+		blob, err = authenticode.AppendSignature(t.primary, blob)
+		if err != nil {
+			return err
+		}
+	}
 	// copy src to dest if needed, otherwise open in-place
 	f, err := atomicfile.WriteInPlace(t.f, dest)
 	if err != nil {
@@ -106,10 +145,17 @@ func (t *msiTransformer) Apply(dest, mimeType string, result io.Reader) error {
 // sign a transformed tarball and return the PKCS#7 blob
 func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
 	noExtended := opts.Flags.GetBool("no-extended-sig")
-	sum, err := authenticode.DigestMsiTar(r, opts.Hash, !noExtended)
+	sum, info, err := authenticode.DigestMsiTar(r, opts.Hash, !noExtended)
 	if err != nil {
 		return nil, err
 	}
+	opts.Audit.Attributes["msi.kind"] = info.Kind.String()
+	if code := info.PatchCode(); code != "" {
+		opts.Audit.Attributes["msi.patch-code"] = code
+	}
+	if targets := info.Targets(); len(targets) != 0 {
+		opts.Audit.Attributes["msi.targets"] = strings.Join(targets, ",")
+	}
 	ts, err := authenticode.SignMSIImprint(opts.Context(), sum, opts.Hash, cert)
 	if err != nil {
 		return nil, err
@@ -117,13 +163,44 @@ func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]b
 	return opts.SetPkcs7(ts)
 }
 
+// delete the signature streams, leaving the rest of the document in place
+func removeSignature(f *os.File, dest string) error {
+	af, err := atomicfile.WriteInPlace(f, dest)
+	if err != nil {
+		return err
+	}
+	defer af.Close()
+	cdf, err := comdoc.WriteFile(af.GetFile())
+	if err != nil {
+		return err
+	}
+	if err := authenticode.RemoveMSISignature(cdf); err != nil {
+		return err
+	}
+	if err := cdf.Close(); err != nil {
+		return err
+	}
+	return af.Commit()
+}
+
 func verify(f *os.File, opts signers.VerifyOpts) ([]*signers.Signature, error) {
 	sig, err := authenticode.VerifyMSI(f, opts.NoDigests)
 	if err != nil {
 		return nil, err
 	}
-	return []*signers.Signature{&signers.Signature{
-		Hash:          sig.HashFunc,
-		X509Signature: &sig.TimestampedSignature,
-	}}, nil
+	sigInfo := sig.Info.Kind.String()
+	if code := sig.Info.PatchCode(); code != "" {
+		sigInfo += " " + code
+	}
+	var ret []*signers.Signature
+	todo := []*authenticode.MSISignature{sig}
+	for len(todo) != 0 {
+		sig, todo = todo[0], append(todo[1:], todo[0].Nested...)
+		ret = append(ret, &signers.Signature{
+			SigInfo:       sigInfo,
+			Hash:          sig.HashFunc,
+			X509Signature: &sig.TimestampedSignature,
+		})
+	}
+	return ret, nil
 }
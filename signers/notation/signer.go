@@ -0,0 +1,93 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package notation
+
+// Sign Notary Project payloads for OCI artifacts. The client resolves the
+// artifact and sends the payload, and gets back a JWS or COSE envelope which
+// it then pushes as a referrer. See "relic remote sign-notation".
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/rs/zerolog"
+
+	"github.com/sassoftware/relic/v7/config"
+	"github.com/sassoftware/relic/v7/lib/audit"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/notation"
+	"github.com/sassoftware/relic/v7/signers"
+)
+
+var NotationSigner = &signers.Signer{
+	Name:      "notation",
+	CertTypes: signers.CertTypeX509,
+	FormatLog: formatLog,
+	Sign:      sign,
+}
+
+const maxPayload = 1 << 20
+
+func init() {
+	NotationSigner.Flags().String("notation-envelope", "jws", "(notation) Envelope format: jws or cose")
+	signers.Register(NotationSigner)
+}
+
+func formatLog(attrs *audit.Info) *zerolog.Event {
+	return attrs.AttrsForLog("notation.")
+}
+
+func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	var mediaType string
+	envelope := opts.Flags.GetString("notation-envelope")
+	switch envelope {
+	case "jws", "":
+		mediaType = notation.MediaTypeJWS
+	case "cose":
+		mediaType = notation.MediaTypeCOSE
+	default:
+		return nil, fmt.Errorf("unsupported envelope format %q", envelope)
+	}
+	payload, err := ioutil.ReadAll(io.LimitReader(r, maxPayload+1))
+	if err != nil {
+		return nil, err
+	} else if len(payload) > maxPayload {
+		return nil, errors.New("notation payload is too large")
+	}
+	p, err := notation.ParsePayload(payload)
+	if err != nil {
+		return nil, err
+	}
+	opts.Audit.Attributes["notation.digest"] = p.TargetArtifact.Digest
+	opts.Audit.Attributes["notation.mediaType"] = p.TargetArtifact.MediaType
+	opts.Audit.Attributes["notation.envelope"] = mediaType
+	blob, err := notation.Sign(opts.Context(), mediaType, notation.SignRequest{
+		Payload:      payload,
+		Signer:       cert.Signer(),
+		Certificates: cert.Chain(),
+		SigningTime:  opts.Time,
+		SigningAgent: config.UserAgent,
+		Timestamper:  cert.Timestamper,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("signing %s: %w", p.TargetArtifact.Digest, err)
+	}
+	opts.Audit.SetMimeType(mediaType)
+	return blob, nil
+}
@@ -0,0 +1,180 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package npm
+
+// Sign packed npm tarballs, producing either a Sigstore bundle with SLSA
+// provenance in <tarball>.sigstore, suitable for "npm publish
+// --provenance-file", or a registry dist.signatures entry in
+// <tarball>.sig.json
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/sassoftware/relic/v7/lib/atomicfile"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/intoto"
+	"github.com/sassoftware/relic/v7/lib/npm"
+	"github.com/sassoftware/relic/v7/lib/pkcs7"
+	"github.com/sassoftware/relic/v7/lib/pkcs9"
+	"github.com/sassoftware/relic/v7/lib/sigstore"
+	"github.com/sassoftware/relic/v7/signers"
+)
+
+var NpmSigner = &signers.Signer{
+	Name:      "npm",
+	TestPath:  testPath,
+	Transform: transform,
+	Sign:      sign,
+	Verify:    verify,
+}
+
+const (
+	formatProvenance = "provenance"
+	formatRegistry   = "registry"
+
+	provenanceSuffix = ".sigstore"
+	registrySuffix   = ".sig.json"
+)
+
+func init() {
+	NpmSigner.Flags().String("npm-format", formatProvenance, "(npm) Signature format: provenance (Sigstore bundle, X.509 key) or registry (dist.signatures entry)")
+	NpmSigner.Flags().String("npm-builder-id", npm.DefaultBuilderID, "(npm) Builder ID recorded in the provenance")
+	NpmSigner.Flags().String("npm-build-type", npm.DefaultBuildType, "(npm) Build type recorded in the provenance")
+	NpmSigner.Flags().String("npm-source-uri", "", "(npm) Git URI of the package source, e.g. git+https://host/repo@refs/heads/main")
+	NpmSigner.Flags().String("npm-source-commit", "", "(npm) Git commit of the package source")
+	NpmSigner.Flags().String("npm-invocation-id", "", "(npm) Build job or run identifier recorded in the provenance")
+	signers.Register(NpmSigner)
+}
+
+func testPath(fp string) bool {
+	return strings.HasSuffix(fp, ".tgz")
+}
+
+type npmTransformer struct {
+	f      *os.File
+	suffix string
+}
+
+func transform(f *os.File, opts signers.SignOpts) (signers.Transformer, error) {
+	t := &npmTransformer{f: f}
+	switch format := opts.Flags.GetString("npm-format"); format {
+	case formatProvenance:
+		t.suffix = provenanceSuffix
+	case formatRegistry:
+		t.suffix = registrySuffix
+	default:
+		return nil, fmt.Errorf("unknown npm-format %q", format)
+	}
+	return t, nil
+}
+
+func (t *npmTransformer) GetReader() (io.Reader, error) {
+	if _, err := t.f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return t.f, nil
+}
+
+// Write the signature next to the tarball, or to the output file if one was
+// given
+func (t *npmTransformer) Apply(dest, mimeType string, result io.Reader) error {
+	if dest == t.f.Name() {
+		dest += t.suffix
+	}
+	outfile, err := atomicfile.WriteAny(dest)
+	if err != nil {
+		return err
+	}
+	defer outfile.Close()
+	if _, err := io.Copy(outfile, result); err != nil {
+		return err
+	}
+	t.f.Close()
+	return outfile.Commit()
+}
+
+func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	pkg, err := npm.ReadPackage(r)
+	if err != nil {
+		return nil, err
+	}
+	opts.Audit.Attributes["npm.name"] = pkg.Name
+	opts.Audit.Attributes["npm.version"] = pkg.Version
+	opts.Audit.Attributes["npm.integrity"] = pkg.Integrity()
+	if opts.Flags.GetString("npm-format") == formatRegistry {
+		sig, err := npm.SignRegistry(cert.Signer(), pkg)
+		if err != nil {
+			return nil, err
+		}
+		opts.Audit.SetMimeType("application/json")
+		return json.Marshal(sig)
+	}
+	if cert.Leaf == nil {
+		return nil, errors.New("provenance bundles require a X.509 certificate")
+	}
+	stmt, err := npm.ProvenanceStatement(pkg, npm.BuildInfo{
+		BuildType:    opts.Flags.GetString("npm-build-type"),
+		BuilderID:    opts.Flags.GetString("npm-builder-id"),
+		InvocationID: opts.Flags.GetString("npm-invocation-id"),
+		SourceURI:    opts.Flags.GetString("npm-source-uri"),
+		SourceCommit: opts.Flags.GetString("npm-source-commit"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(stmt)
+	if err != nil {
+		return nil, err
+	}
+	bundle, err := sigstore.SignDSSE(opts.Context(), cert, intoto.PayloadType, payload)
+	if err != nil {
+		return nil, err
+	}
+	opts.Audit.SetMimeType(sigstore.MediaType)
+	return json.Marshal(bundle)
+}
+
+func verify(f *os.File, opts signers.VerifyOpts) ([]*signers.Signature, error) {
+	blob, err := ioutil.ReadFile(f.Name() + provenanceSuffix)
+	if err != nil {
+		return nil, err
+	}
+	bundle, err := sigstore.Parse(blob)
+	if err != nil {
+		return nil, err
+	}
+	pkg, err := npm.ReadPackage(f)
+	if err != nil {
+		return nil, err
+	}
+	v, _, err := npm.VerifyProvenance(bundle, pkg)
+	if err != nil {
+		return nil, err
+	}
+	sig := pkcs7.Signature{Certificate: v.Certificate, Intermediates: v.Chain}
+	return []*signers.Signature{{
+		Package:       pkg.Name + "@" + pkg.Version,
+		Hash:          sigstore.HashForKey(v.Certificate.PublicKey),
+		X509Signature: &pkcs9.TimestampedSignature{Signature: sig, CounterSignature: v.CounterSignature},
+	}}, nil
+}
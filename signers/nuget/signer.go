@@ -0,0 +1,93 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package nuget
+
+// Sign NuGet packages with an author or repository primary signature
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/signnuget"
+	"github.com/sassoftware/relic/v7/signers"
+	"github.com/sassoftware/relic/v7/signers/zipbased"
+)
+
+var NugetSigner = &signers.Signer{
+	Name:      "nuget",
+	Aliases:   []string{"nupkg"},
+	CertTypes: signers.CertTypeX509,
+	TestPath:  testPath,
+	Transform: zipbased.Transform,
+	Sign:      sign,
+	Verify:    verify,
+}
+
+func init() {
+	NugetSigner.Flags().String("nuget-type", signnuget.TypeAuthor, "(NuGet) Signature type: author or repository")
+	NugetSigner.Flags().String("nuget-service-index", "", "(NuGet) Service index URL of the repository, for repository signatures")
+	NugetSigner.Flags().String("nuget-owners", "", "(NuGet) Comma-separated package owners, for repository signatures")
+	signers.Register(NugetSigner)
+}
+
+func testPath(fp string) bool {
+	switch filepath.Ext(fp) {
+	case ".nupkg", ".snupkg":
+		return true
+	}
+	return false
+}
+
+func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	params := signnuget.Params{
+		Type:         opts.Flags.GetString("nuget-type"),
+		ServiceIndex: opts.Flags.GetString("nuget-service-index"),
+	}
+	if owners := opts.Flags.GetString("nuget-owners"); owners != "" {
+		params.Owners = strings.Split(owners, ",")
+	}
+	patch, ts, err := signnuget.Sign(opts.Context(), r, cert, opts.Hash, opts.Time, params)
+	if err != nil {
+		return nil, err
+	}
+	opts.Audit.SetCounterSignature(ts.CounterSignature)
+	opts.Audit.Attributes["nuget.type"] = params.Type
+	return opts.SetBinPatch(patch)
+}
+
+func verify(f *os.File, opts signers.VerifyOpts) ([]*signers.Signature, error) {
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := signnuget.Verify(f, size, opts.NoDigests)
+	if err != nil {
+		return nil, err
+	}
+	info := sig.Type
+	if sig.ServiceIndex != "" {
+		info += " " + sig.ServiceIndex
+	}
+	return []*signers.Signature{{
+		SigInfo:       info,
+		Hash:          sig.Hash,
+		X509Signature: sig.Signature,
+	}}, nil
+}
@@ -41,7 +41,11 @@ type SignOpts struct {
 	Time  time.Time
 	Flags *FlagValues
 	Audit *audit.Info
-	ctx   context.Context
+	// Caller and CallerRoles identify the client that a server is signing
+	// for. They are empty when signing locally.
+	Caller      string
+	CallerRoles []string
+	ctx         context.Context
 }
 
 // Convenience method to return a binary patch
@@ -82,6 +86,8 @@ type VerifyOpts struct {
 	NoChain     bool
 	Content     string
 	Compression magic.CompressionType
+	// AllowedSigners is the path to an ssh-keygen allowed_signers file
+	AllowedSigners string
 }
 
 type FlagValues struct {
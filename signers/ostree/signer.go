@@ -0,0 +1,214 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package ostree
+
+// Sign OSTree commits with ed25519 keys. A bare commit object gets its
+// signature added to the .commitmeta file next to it, and a Flatpak bundle
+// gets it added to the detached metadata embedded in the bundle.
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sassoftware/relic/v7/lib/atomicfile"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/ostree"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+	"github.com/sassoftware/relic/v7/signers"
+)
+
+var OstreeSigner = &signers.Signer{
+	Name:      "ostree",
+	Aliases:   []string{"flatpak"},
+	CertTypes: signers.CertTypeX509,
+	TestPath:  testPath,
+	Transform: transform,
+	Sign:      sign,
+	Verify:    verify,
+}
+
+func init() {
+	OstreeSigner.Flags().Bool("ostree-replace", false, "(OSTree) Replace existing signatures instead of adding to them")
+	signers.Register(OstreeSigner)
+}
+
+func testPath(fp string) bool {
+	switch filepath.Ext(fp) {
+	case ".commit", ".flatpak":
+		return true
+	}
+	return false
+}
+
+func isBundle(fp string) bool {
+	return filepath.Ext(fp) == ".flatpak"
+}
+
+func metaPath(fp string) string {
+	return strings.TrimSuffix(fp, ".commit") + ".commitmeta"
+}
+
+type ostreeTransformer struct {
+	f       *os.File
+	commit  []byte
+	bundle  *ostree.Bundle
+	replace bool
+}
+
+func transform(f *os.File, opts signers.SignOpts) (signers.Transformer, error) {
+	blob, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	t := &ostreeTransformer{f: f, commit: blob, replace: opts.Flags.GetBool("ostree-replace")}
+	if isBundle(f.Name()) {
+		t.bundle, err = ostree.ParseBundle(blob)
+		if err != nil {
+			return nil, err
+		}
+		t.commit = t.bundle.Commit()
+	} else if name := strings.TrimSuffix(filepath.Base(f.Name()), ".commit"); len(name) == 62 {
+		// objects/ab/cdef....commit
+		if sum := filepath.Base(filepath.Dir(f.Name())) + name; sum != ostree.Checksum(blob) {
+			return nil, fmt.Errorf("commit object does not match its name %s", sum)
+		}
+	}
+	return t, nil
+}
+
+func (t *ostreeTransformer) GetReader() (io.Reader, error) {
+	return bytes.NewReader(t.commit), nil
+}
+
+// Add the signature to the detached metadata. For a bare commit, the metadata
+// is written next to it or to the output file if one was given.
+func (t *ostreeTransformer) Apply(dest, mimeType string, result io.Reader) error {
+	sig, err := ioutil.ReadAll(result)
+	if err != nil {
+		return err
+	}
+	var meta []byte
+	if t.bundle != nil {
+		meta, err = t.bundle.DetachedMetadata()
+	} else {
+		meta, err = ioutil.ReadFile(metaPath(t.f.Name()))
+		if errors.Is(err, os.ErrNotExist) {
+			err = nil
+		}
+		if dest == t.f.Name() {
+			dest = metaPath(dest)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	meta, err = ostree.AddSignature(meta, sig, t.replace)
+	if err != nil {
+		return err
+	}
+	out := meta
+	if t.bundle != nil {
+		if err := t.bundle.SetDetachedMetadata(meta); err != nil {
+			return err
+		}
+		if out, err = t.bundle.Marshal(); err != nil {
+			return err
+		}
+	}
+	outfile, err := atomicfile.WriteAny(dest)
+	if err != nil {
+		return err
+	}
+	defer outfile.Close()
+	if _, err := outfile.Write(out); err != nil {
+		return err
+	}
+	t.f.Close()
+	return outfile.Commit()
+}
+
+func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	commit, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := ostree.Sign(commit, cert.Signer())
+	if err != nil {
+		return nil, err
+	}
+	opts.Audit.Attributes["ostree.commit"] = ostree.Checksum(commit)
+	if subject, err := ostree.Subject(commit); err == nil && subject != "" {
+		opts.Audit.Attributes["ostree.subject"] = subject
+	}
+	opts.Audit.SetMimeType("application/x-ostree-ed25519-signature")
+	return sig, nil
+}
+
+func verify(f *os.File, opts signers.VerifyOpts) ([]*signers.Signature, error) {
+	blob, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	commit := blob
+	var meta []byte
+	if isBundle(f.Name()) {
+		bundle, err := ostree.ParseBundle(blob)
+		if err != nil {
+			return nil, err
+		}
+		commit = bundle.Commit()
+		meta, err = bundle.DetachedMetadata()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		meta, err = ioutil.ReadFile(metaPath(f.Name()))
+		if err != nil {
+			return nil, err
+		}
+	}
+	var keys []ed25519.PublicKey
+	var certs []*x509.Certificate
+	for _, cert := range opts.TrustedX509 {
+		if key, ok := cert.PublicKey.(ed25519.PublicKey); ok {
+			keys = append(keys, key)
+			certs = append(certs, cert)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no trusted ed25519 keys; use --cert to specify known keys")
+	}
+	key, err := ostree.Verify(commit, meta, keys)
+	if err != nil {
+		return nil, err
+	}
+	sig := &signers.Signature{Package: ostree.Checksum(commit)}
+	for i, k := range keys {
+		if k.Equal(key) {
+			sig.Signer = fmt.Sprintf("`%s`", x509tools.FormatSubject(certs[i]))
+		}
+	}
+	return []*signers.Signature{sig}, nil
+}
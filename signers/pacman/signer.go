@@ -0,0 +1,108 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pacman
+
+// Sign Arch Linux packages and repository databases, producing a detached
+// binary signature in <file>.sig
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+
+	"github.com/sassoftware/relic/v7/lib/atomicfile"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/signers"
+)
+
+var PacmanSigner = &signers.Signer{
+	Name:      "pacman",
+	Aliases:   []string{"arch"},
+	CertTypes: signers.CertTypePgp,
+	TestPath:  testPath,
+	Transform: transform,
+	Sign:      sign,
+}
+
+func init() {
+	signers.Register(PacmanSigner)
+}
+
+func testPath(fp string) bool {
+	base := filepath.Base(fp)
+	if strings.HasSuffix(base, ".sig") {
+		return false
+	}
+	for _, infix := range []string{".pkg.tar", ".db.tar", ".files.tar"} {
+		if strings.Contains(base, infix) {
+			return true
+		}
+	}
+	return false
+}
+
+type pacmanTransformer struct {
+	f *os.File
+}
+
+func transform(f *os.File, opts signers.SignOpts) (signers.Transformer, error) {
+	return &pacmanTransformer{f: f}, nil
+}
+
+func (t *pacmanTransformer) GetReader() (io.Reader, error) {
+	if _, err := t.f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return t.f, nil
+}
+
+// Write the signature next to the package, or to the output file if one was
+// given
+func (t *pacmanTransformer) Apply(dest, mimeType string, result io.Reader) error {
+	if dest == t.f.Name() {
+		dest += ".sig"
+	}
+	outfile, err := atomicfile.WriteAny(dest)
+	if err != nil {
+		return err
+	}
+	defer outfile.Close()
+	if _, err := io.Copy(outfile, result); err != nil {
+		return err
+	}
+	t.f.Close()
+	return outfile.Commit()
+}
+
+func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	config := &packet.Config{
+		DefaultHash: opts.Hash,
+		Time:        func() time.Time { return opts.Time },
+	}
+	var buf bytes.Buffer
+	if err := openpgp.DetachSign(&buf, cert.PgpKey, r, config); err != nil {
+		return nil, err
+	}
+	opts.Audit.SetMimeType("application/pgp-signature")
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,163 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pdf
+
+// Sign PDF documents with PAdES signatures, appended as an incremental update
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog"
+
+	"github.com/sassoftware/relic/v7/lib/audit"
+	"github.com/sassoftware/relic/v7/lib/binpatch"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/pdf"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+	"github.com/sassoftware/relic/v7/signers"
+)
+
+var PdfSigner = &signers.Signer{
+	Name:      "pdf",
+	CertTypes: signers.CertTypeX509,
+	TestPath:  testPath,
+	FormatLog: formatLog,
+	Sign:      sign,
+	Verify:    verify,
+}
+
+func init() {
+	PdfSigner.Flags().String("pdf-field", "", "(PDF) Name of the signature field")
+	PdfSigner.Flags().String("pdf-reason", "", "(PDF) Reason for signing")
+	PdfSigner.Flags().String("pdf-location", "", "(PDF) Location of signing")
+	PdfSigner.Flags().String("pdf-contact", "", "(PDF) Contact information of the signer")
+	PdfSigner.Flags().String("pdf-page", "1", "(PDF) Page to place the signature on")
+	PdfSigner.Flags().String("pdf-rect", "", "(PDF) Make the signature visible at llx,lly,urx,ury on the page, in points")
+	PdfSigner.Flags().String("pdf-docmdp", "", "(PDF) Make a certification signature permitting 1=no changes, 2=form filling and signing, 3=also annotations")
+	signers.Register(PdfSigner)
+}
+
+func testPath(fp string) bool {
+	return strings.HasSuffix(strings.ToLower(fp), ".pdf")
+}
+
+func formatLog(attrs *audit.Info) *zerolog.Event {
+	return attrs.AttrsForLog("pdf.")
+}
+
+func parseOptions(flags *signers.FlagValues) (pdf.SignOptions, error) {
+	opts := pdf.SignOptions{
+		Field:       flags.GetString("pdf-field"),
+		Reason:      flags.GetString("pdf-reason"),
+		Location:    flags.GetString("pdf-location"),
+		ContactInfo: flags.GetString("pdf-contact"),
+	}
+	var err error
+	if v := flags.GetString("pdf-page"); v != "" {
+		opts.Page, err = strconv.Atoi(v)
+		if err != nil || opts.Page < 1 {
+			return opts, errors.New("invalid pdf-page")
+		}
+	}
+	if v := flags.GetString("pdf-docmdp"); v != "" {
+		opts.DocMDP, err = strconv.Atoi(v)
+		if err != nil || opts.DocMDP < 1 || opts.DocMDP > 3 {
+			return opts, errors.New("pdf-docmdp must be 1, 2 or 3")
+		}
+	}
+	if v := flags.GetString("pdf-rect"); v != "" {
+		coords := strings.Split(v, ",")
+		if len(coords) != 4 {
+			return opts, errors.New("pdf-rect must have 4 coordinates")
+		}
+		for i, c := range coords {
+			opts.Rect[i], err = strconv.ParseFloat(strings.TrimSpace(c), 64)
+			if err != nil {
+				return opts, fmt.Errorf("invalid pdf-rect: %w", err)
+			}
+		}
+		if opts.Rect[2] <= opts.Rect[0] || opts.Rect[3] <= opts.Rect[1] {
+			return opts, errors.New("pdf-rect must have a positive width and height")
+		}
+	}
+	return opts, nil
+}
+
+func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	sigOpts, err := parseOptions(opts.Flags)
+	if err != nil {
+		return nil, err
+	}
+	sigOpts.SigTime = opts.Time
+	blob, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := pdf.Open(blob)
+	if err != nil {
+		return nil, err
+	}
+	update, ts, err := pdf.Sign(opts.Context(), doc, cert, opts.Hash, sigOpts)
+	if err != nil {
+		return nil, err
+	}
+	opts.Audit.SetCounterSignature(ts.CounterSignature)
+	if sigOpts.DocMDP != 0 {
+		opts.Audit.Attributes["pdf.docmdp"] = sigOpts.DocMDP
+	}
+	patch := binpatch.New()
+	patch.Add(int64(len(blob)), 0, update)
+	return opts.SetBinPatch(patch)
+}
+
+func verify(f *os.File, opts signers.VerifyOpts) ([]*signers.Signature, error) {
+	blob, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := pdf.Open(blob)
+	if err != nil {
+		return nil, err
+	}
+	sigs, err := pdf.Verify(doc, opts.NoDigests)
+	if err != nil {
+		return nil, err
+	}
+	var ret []*signers.Signature
+	for _, sig := range sigs {
+		hash, _ := x509tools.PkixDigestToHash(sig.Signature.SignerInfo.DigestAlgorithm)
+		info := sig.Field
+		if !sig.CoversDocument {
+			info += " (partial)"
+		}
+		if sig.DocMDP != 0 {
+			info += fmt.Sprintf(" certified P=%d", sig.DocMDP)
+		}
+		ret = append(ret, &signers.Signature{
+			SigInfo:       info,
+			Hash:          hash,
+			X509Signature: sig.Signature,
+		})
+	}
+	return ret, nil
+}
@@ -25,6 +25,7 @@ import (
 	"github.com/sassoftware/relic/v7/lib/authenticode"
 	"github.com/sassoftware/relic/v7/lib/certloader"
 	"github.com/sassoftware/relic/v7/lib/magic"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
 	"github.com/sassoftware/relic/v7/signers"
 )
 
@@ -35,10 +36,13 @@ var PeSigner = &signers.Signer{
 	Sign:      sign,
 	Fixup:     authenticode.FixPEChecksum,
 	Verify:    verify,
+
+	RemoveSignature: removeSignature,
 }
 
 func init() {
-	PeSigner.Flags().Bool("page-hashes", false, "(PE-COFF) Add page hashes to signature")
+	PeSigner.Flags().Bool("page-hashes", false, "(PE-COFF) Add page hashes to signature, as required by some WDAC and driver policies. SHA-1 or SHA-256 only")
+	PeSigner.Flags().Bool("append", false, "(PE-COFF, MSI) Nest the new signature inside the existing one instead of replacing it")
 	signers.Register(PeSigner)
 }
 
@@ -48,7 +52,11 @@ func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]b
 	if err != nil {
 		return nil, err
 	}
-	patch, ts, err := digest.Sign(opts.Context(), cert)
+	signDigest := digest.Sign
+	if opts.Flags.GetBool("append") {
+		signDigest = digest.SignAppend
+	}
+	patch, ts, err := signDigest(opts.Context(), cert)
 	if err != nil {
 		return nil, err
 	}
@@ -57,6 +65,14 @@ func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]b
 	return opts.SetBinPatch(patch)
 }
 
+func removeSignature(f *os.File, dest string) error {
+	patch, err := authenticode.RemovePESignature(f)
+	if err != nil {
+		return err
+	}
+	return patch.Apply(f, dest)
+}
+
 func verify(f *os.File, opts signers.VerifyOpts) ([]*signers.Signature, error) {
 	sigs, err := authenticode.VerifyPE(f, opts.NoDigests)
 	if err != nil {
@@ -64,7 +80,12 @@ func verify(f *os.File, opts signers.VerifyOpts) ([]*signers.Signature, error) {
 	}
 	var ret []*signers.Signature
 	for _, sig := range sigs {
+		var sigInfo string
+		if len(sig.PageHashes) != 0 {
+			sigInfo = x509tools.HashNames[sig.PageHashFunc] + " page hashes"
+		}
 		ret = append(ret, &signers.Signature{
+			SigInfo:       sigInfo,
 			Hash:          sig.ImageHashFunc,
 			X509Signature: &sig.TimestampedSignature,
 		})
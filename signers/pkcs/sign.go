@@ -0,0 +1,59 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pkcs
+
+// Create detached PKCS#7 SignedData over arbitrary content
+
+import (
+	"io"
+	"io/ioutil"
+
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/pkcs7"
+	"github.com/sassoftware/relic/v7/lib/pkcs9"
+	"github.com/sassoftware/relic/v7/signers"
+)
+
+func Sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	blob, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	builder := pkcs7.NewBuilder(cert.Signer(), cert.Chain(), opts.Hash)
+	if err := builder.SetContentData(blob); err != nil {
+		return nil, err
+	}
+	if err := builder.AddAuthenticatedAttribute(pkcs7.OidAttributeSigningTime, opts.Time.UTC()); err != nil {
+		return nil, err
+	}
+	psd, err := builder.Sign()
+	if err != nil {
+		return nil, err
+	}
+	// sign with the content attached so the result can be checked, then
+	// strip it back out
+	ts, err := pkcs9.TimestampAndMarshal(opts.Context(), psd, cert.Timestamper, false)
+	if err != nil {
+		return nil, err
+	}
+	opts.Audit.SetCounterSignature(ts.CounterSignature)
+	if _, err := psd.Detach(); err != nil {
+		return nil, err
+	}
+	opts.Audit.SetMimeType("application/pkcs7-signature")
+	return psd.Marshal()
+}
@@ -16,7 +16,7 @@
 
 package pkcs
 
-// Verify PKCS#7 SignedData structures.
+// Sign and verify detached PKCS#7 SignedData structures.
 
 import (
 	"io/ioutil"
@@ -33,7 +33,7 @@ var PkcsSigner = &signers.Signer{
 	Name:      "pkcs7",
 	Magic:     magic.FileTypePKCS7,
 	CertTypes: signers.CertTypeX509,
-	Sign:      nil,
+	Sign:      Sign,
 	Verify:    Verify,
 }
 
@@ -38,6 +38,8 @@ var PsSigner = &signers.Signer{
 	Transform: transform,
 	Sign:      sign,
 	Verify:    verify,
+
+	RemoveSignature: removeSignature,
 }
 
 func init() {
@@ -81,6 +83,18 @@ func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]b
 	return opts.SetBinPatch(patch)
 }
 
+func removeSignature(f *os.File, dest string) error {
+	style, err := getStyle(f.Name())
+	if err != nil {
+		return err
+	}
+	patch, err := authenticode.RemovePowershellSignature(f, style)
+	if err != nil {
+		return err
+	}
+	return patch.Apply(f, dest)
+}
+
 func verify(f *os.File, opts signers.VerifyOpts) ([]*signers.Signature, error) {
 	style, err := getStyle(f.Name())
 	if err != nil {
@@ -0,0 +1,181 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pypi
+
+// Sign Python wheels and sdists, producing either a PEP 740 publish
+// attestation in <dist>.publish.attestation or a legacy detached PGP
+// signature in <dist>.asc
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+
+	"github.com/sassoftware/relic/v7/lib/atomicfile"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/pkcs7"
+	"github.com/sassoftware/relic/v7/lib/pkcs9"
+	"github.com/sassoftware/relic/v7/lib/pypi"
+	"github.com/sassoftware/relic/v7/signers"
+)
+
+var PypiSigner = &signers.Signer{
+	Name:      "pypi",
+	Aliases:   []string{"wheel", "sdist"},
+	TestPath:  testPath,
+	Transform: transform,
+	Sign:      sign,
+	Verify:    verify,
+}
+
+const (
+	formatAttestation = "attestation"
+	formatAsc         = "asc"
+)
+
+func init() {
+	PypiSigner.Flags().String("pypi-format", formatAttestation, "(PyPI) Signature format: attestation (PEP 740, X.509 key) or asc (detached PGP)")
+	signers.Register(PypiSigner)
+}
+
+func testPath(fp string) bool {
+	return pypi.IsDistribution(filepath.Base(fp))
+}
+
+type pypiTransformer struct {
+	f      *os.File
+	suffix string
+}
+
+func transform(f *os.File, opts signers.SignOpts) (signers.Transformer, error) {
+	t := &pypiTransformer{f: f}
+	switch format := opts.Flags.GetString("pypi-format"); format {
+	case formatAttestation:
+		t.suffix = pypi.AttestationSuffix
+	case formatAsc:
+		t.suffix = ".asc"
+	default:
+		return nil, fmt.Errorf("unknown pypi-format %q", format)
+	}
+	return t, nil
+}
+
+func (t *pypiTransformer) GetReader() (io.Reader, error) {
+	if _, err := t.f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return t.f, nil
+}
+
+// Write the signature next to the distribution, or to the output file if one
+// was given
+func (t *pypiTransformer) Apply(dest, mimeType string, result io.Reader) error {
+	if dest == t.f.Name() {
+		dest += t.suffix
+	}
+	outfile, err := atomicfile.WriteAny(dest)
+	if err != nil {
+		return err
+	}
+	defer outfile.Close()
+	if _, err := io.Copy(outfile, result); err != nil {
+		return err
+	}
+	t.f.Close()
+	return outfile.Commit()
+}
+
+func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	name := filepath.Base(opts.Path)
+	if !pypi.IsDistribution(name) {
+		return nil, errors.New("file name is not that of a wheel or sdist")
+	}
+	opts.Audit.Attributes["pypi.filename"] = name
+	if opts.Flags.GetString("pypi-format") == formatAsc {
+		return signAsc(r, cert, opts)
+	}
+	if cert.Leaf == nil {
+		return nil, errors.New("PEP 740 attestations require a X.509 certificate")
+	}
+	d := sha256.New()
+	if _, err := io.Copy(d, r); err != nil {
+		return nil, err
+	}
+	att, err := pypi.Attest(name, d.Sum(nil), cert.Signer(), cert.Leaf)
+	if err != nil {
+		return nil, err
+	}
+	blob, err := json.Marshal(att)
+	if err != nil {
+		return nil, err
+	}
+	opts.Audit.SetMimeType("application/json")
+	return blob, nil
+}
+
+func signAsc(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	if cert.PgpKey == nil {
+		return nil, errors.New("detached signatures require a PGP certificate")
+	}
+	config := &packet.Config{
+		DefaultHash: opts.Hash,
+		Time:        func() time.Time { return opts.Time },
+	}
+	var buf bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&buf, cert.PgpKey, r, config); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	opts.Audit.SetMimeType("application/pgp-signature")
+	return buf.Bytes(), nil
+}
+
+func verify(f *os.File, opts signers.VerifyOpts) ([]*signers.Signature, error) {
+	blob, err := ioutil.ReadFile(f.Name() + pypi.AttestationSuffix)
+	if err != nil {
+		return nil, fmt.Errorf("%w; use \"relic verify --content\" for .asc signatures", err)
+	}
+	att, err := pypi.Parse(blob)
+	if err != nil {
+		return nil, err
+	}
+	d := sha256.New()
+	if _, err := io.Copy(d, f); err != nil {
+		return nil, err
+	}
+	name := filepath.Base(f.Name())
+	cert, err := att.Verify(name, d.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return []*signers.Signature{{
+		Package:       name,
+		Hash:          crypto.SHA256,
+		X509Signature: &pkcs9.TimestampedSignature{Signature: pkcs7.Signature{Certificate: cert}},
+	}}, nil
+}
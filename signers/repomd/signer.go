@@ -0,0 +1,122 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package repomd
+
+// Sign Yum/DNF repository metadata, producing a detached armored signature in
+// repomd.xml.asc
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+
+	"github.com/sassoftware/relic/v7/lib/atomicfile"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/yumrepo"
+	"github.com/sassoftware/relic/v7/signers"
+)
+
+var RepomdSigner = &signers.Signer{
+	Name:      "repomd",
+	CertTypes: signers.CertTypePgp,
+	TestPath:  testPath,
+	Transform: transform,
+	Sign:      sign,
+}
+
+func init() {
+	RepomdSigner.Flags().Bool("repomd-check-packages", false, "(repomd) Check that every package matches the checksum in the primary metadata")
+	signers.Register(RepomdSigner)
+}
+
+func testPath(fp string) bool {
+	return filepath.Base(fp) == "repomd.xml"
+}
+
+type repomdTransformer struct {
+	f *os.File
+}
+
+// Check the metadata files, and optionally the packages, against repomd.xml
+// before signing it
+func transform(f *os.File, opts signers.SignOpts) (signers.Transformer, error) {
+	repo, err := yumrepo.Open(f.Name())
+	if err != nil {
+		return nil, err
+	}
+	if err := repo.CheckMetadata(); err != nil {
+		return nil, err
+	}
+	if opts.Flags.GetBool("repomd-check-packages") {
+		if err := repo.CheckPackages(); err != nil {
+			return nil, err
+		}
+	}
+	return &repomdTransformer{f: f}, nil
+}
+
+func (t *repomdTransformer) GetReader() (io.Reader, error) {
+	if _, err := t.f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return t.f, nil
+}
+
+// Write the signature next to repomd.xml, or to the output file if one was
+// given
+func (t *repomdTransformer) Apply(dest, mimeType string, result io.Reader) error {
+	if dest == t.f.Name() {
+		dest += ".asc"
+	}
+	outfile, err := atomicfile.WriteAny(dest)
+	if err != nil {
+		return err
+	}
+	defer outfile.Close()
+	if _, err := io.Copy(outfile, result); err != nil {
+		return err
+	}
+	t.f.Close()
+	return outfile.Commit()
+}
+
+func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	blob, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := yumrepo.Parse("", blob); err != nil {
+		return nil, err
+	}
+	config := &packet.Config{
+		DefaultHash: opts.Hash,
+		Time:        func() time.Time { return opts.Time },
+	}
+	var buf bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&buf, cert.PgpKey, bytes.NewReader(blob), config); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	opts.Audit.SetMimeType("application/pgp-signature")
+	return buf.Bytes(), nil
+}
@@ -28,12 +28,15 @@ import (
 
 	"github.com/rs/zerolog"
 	rpmutils "github.com/sassoftware/go-rpmutils"
+	"golang.org/x/crypto/openpgp"
 
 	"github.com/sassoftware/relic/v7/lib/audit"
 	"github.com/sassoftware/relic/v7/lib/binpatch"
 	"github.com/sassoftware/relic/v7/lib/certloader"
 	"github.com/sassoftware/relic/v7/lib/magic"
 	"github.com/sassoftware/relic/v7/lib/pgptools"
+	"github.com/sassoftware/relic/v7/lib/rpmpayload"
+	"github.com/sassoftware/relic/v7/lib/rpmsig"
 	"github.com/sassoftware/relic/v7/signers"
 	"github.com/sassoftware/relic/v7/signers/sigerrors"
 )
@@ -45,9 +48,12 @@ var RpmSigner = &signers.Signer{
 	FormatLog: formatLog,
 	Sign:      sign,
 	Verify:    verify,
+
+	RemoveSignature: removeSignature,
 }
 
 func init() {
+	RpmSigner.Flags().String("rpm-sig-format", "", "(RPM) Signature format: v4 (default) for the tags read by rpm 4, v6 for the OPENPGP tag read by rpm 6 and rpm-sequoia, or dual for both")
 	signers.Register(RpmSigner)
 }
 
@@ -55,7 +61,60 @@ func formatLog(attrs *audit.Info) *zerolog.Event {
 	return attrs.AttrsForLog("rpm.")
 }
 
+type payloadResult struct {
+	payload *rpmpayload.Payload
+	err     error
+}
+
 func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	var v6, dual bool
+	switch opts.Flags.GetString("rpm-sig-format") {
+	case "", "v4":
+	case "v6":
+		v6 = true
+	case "dual":
+		v6, dual = true, true
+	default:
+		return nil, fmt.Errorf("unknown rpm-sig-format %q", opts.Flags.GetString("rpm-sig-format"))
+	}
+	// check the payload against the digests in the header as it streams
+	// past, so that a damaged upload is not signed
+	pr, pw := io.Pipe()
+	checked := make(chan payloadResult, 1)
+	go func() {
+		p, err := rpmpayload.Check(pr)
+		// keep draining so the signer never blocks on a failed check
+		_, _ = io.Copy(io.Discard, pr)
+		checked <- payloadResult{p, err}
+	}()
+	tee := io.TeeReader(r, pw)
+	var patch *binpatch.PatchSet
+	var err error
+	if v6 {
+		patch, err = signV6(tee, cert, opts, dual)
+	} else {
+		patch, err = signV4(tee, cert, opts)
+	}
+	if err == nil {
+		_, err = io.Copy(io.Discard, tee)
+	}
+	pw.CloseWithError(err)
+	result := <-checked
+	if err != nil {
+		return nil, err
+	} else if result.err != nil {
+		return nil, result.err
+	}
+	opts.Audit.Attributes["rpm.compressor"] = result.payload.Compressor
+	if result.payload.Digest != "" {
+		opts.Audit.Attributes["rpm.payloaddigest"] = result.payload.Digest
+	}
+	return opts.SetBinPatch(patch)
+}
+
+// sign the header and the header plus payload with go-rpmutils, as read by
+// rpm 4
+func signV4(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) (*binpatch.PatchSet, error) {
 	config := &rpmutils.SignatureOptions{
 		Hash:         opts.Hash,
 		CreationTime: opts.Time.UTC().Round(time.Second),
@@ -75,25 +134,84 @@ func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]b
 	opts.Audit.Attributes["rpm.nevra"] = nevra(header)
 	opts.Audit.Attributes["rpm.md5"] = hex.EncodeToString(md5)
 	opts.Audit.Attributes["rpm.sha1"] = sha1
-	return opts.SetBinPatch(patch)
+	return patch, nil
+}
+
+// sign only the header, in the OPENPGP tag used by rpm 6 and optionally also
+// in the legacy header signature tag
+func signV6(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts, dual bool) (*binpatch.PatchSet, error) {
+	result, err := rpmsig.Sign(r, cert.PgpKey.PrivateKey, rpmsig.Options{
+		Hash:         opts.Hash,
+		CreationTime: opts.Time.UTC().Round(time.Second),
+		Legacy:       dual,
+	})
+	if err != nil {
+		return nil, err
+	}
+	patch := binpatch.New()
+	patch.Add(0, result.OriginalSize, result.SignatureHeader)
+	opts.Audit.Attributes["rpm.nevra"] = result.NEVRA
+	opts.Audit.Attributes["rpm.sha256"] = result.HeaderSHA256
+	return patch, nil
+}
+
+// remove the signatures from the signature header, keeping the digests
+func removeSignature(f *os.File, dest string) error {
+	result, err := rpmsig.Unsign(f)
+	if err != nil {
+		return err
+	}
+	patch := binpatch.New()
+	patch.Add(0, result.OriginalSize, result.SignatureHeader)
+	return patch.Apply(f, dest)
 }
 
 func verify(f *os.File, opts signers.VerifyOpts) ([]*signers.Signature, error) {
+	if !opts.NoDigests {
+		// check the payload digests and sizes, including the uncompressed
+		// digest and 64-bit sizes written by modern rpm
+		if _, err := rpmpayload.Check(f); err != nil {
+			return nil, err
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+	// signatures in the OPENPGP tag written by rpm 6
+	v6sigs, err := rpmsig.Verify(f, opts.TrustedPgp)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
 	// TODO: add a flag to skip payload digest to rpmutils.Verify
 	header, sigs, err := rpmutils.Verify(f, opts.TrustedPgp)
 	if err != nil {
 		return nil, err
 	}
+	for _, sig := range v6sigs {
+		sigs = append(sigs, &rpmutils.Signature{
+			Signer:       sig.Signer,
+			Hash:         sig.Hash,
+			CreationTime: sig.CreationTime,
+			KeyId:        sig.KeyID,
+		})
+	}
 	if len(sigs) == 0 {
 		return nil, sigerrors.NotSignedError{Type: "RPM"}
 	}
 	var ret []*signers.Signature
-	seen := make(map[uint64]bool)
+	// rpm 4 signs both the header and the header plus payload, and dual
+	// signing stores one signature in both the OPENPGP and legacy tags, so
+	// report each key and signing time once
+	seen := make(map[string]bool)
 	for _, sig := range sigs {
-		if seen[sig.KeyId] {
+		id := fmt.Sprintf("%s@%d", issuerFingerprint(sig), sig.CreationTime.Unix())
+		if seen[id] {
 			continue
 		}
-		seen[sig.KeyId] = true
+		seen[id] = true
 		rsig := &signers.Signature{
 			Package:      nevra(header),
 			CreationTime: sig.CreationTime,
@@ -112,6 +230,17 @@ func verify(f *os.File, opts signers.VerifyOpts) ([]*signers.Signature, error) {
 	return ret, nil
 }
 
+// issuerFingerprint identifies the key that made a signature by its
+// fingerprint, or by its key ID if the key is not known
+func issuerFingerprint(sig *rpmutils.Signature) string {
+	if sig.Signer != nil {
+		if keys := (openpgp.EntityList{sig.Signer}).KeysById(sig.KeyId); len(keys) != 0 {
+			return hex.EncodeToString(keys[0].PublicKey.Fingerprint[:])
+		}
+	}
+	return fmt.Sprintf("%016x", sig.KeyId)
+}
+
 func nevra(header *rpmutils.RpmHeader) string {
 	nevra, _ := header.GetNEVRA()
 	snevra := nevra.String()
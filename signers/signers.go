@@ -60,6 +60,9 @@ type Signer struct {
 	Sign func(io.Reader, *certloader.Certificate, SignOpts) ([]byte, error)
 	// Final step to run on the client after the file is patched
 	Fixup func(*os.File) error
+	// Remove all signatures from a file and write the result to the named
+	// path, which may be the input file. Fixup is run afterwards.
+	RemoveSignature func(*os.File, string) error
 
 	flags *pflag.FlagSet
 }
@@ -159,16 +162,33 @@ func ByFile(name, sigtype string) (*Signer, error) {
 	defer f.Close()
 	fileType, compressionType := magic.DetectCompressed(f)
 	if compressionType != magic.CompressedNone {
+		// only formats that are natively compressed can be signed as-is
+		if mod := ByFileName(name); mod != nil {
+			return mod, nil
+		}
 		return nil, errors.New("cannot sign compressed file")
 	}
-	if mod := ByMagic(fileType); mod != nil {
-		return mod, nil
-	} else if mod := ByFileName(name); mod != nil {
+	if mod := ByFileType(fileType, name); mod != nil {
 		return mod, nil
 	}
 	return nil, errors.New("unknown filetype")
 }
 
+// Return the signer module for a file with the given magic and name. Armored
+// PGP data could be any text format with an embedded signature, so in that
+// case a module claiming the file extension takes precedence.
+func ByFileType(fileType magic.FileType, name string) *Signer {
+	if fileType == magic.FileTypePGP {
+		if mod := ByFileName(name); mod != nil {
+			return mod
+		}
+	}
+	if mod := ByMagic(fileType); mod != nil {
+		return mod
+	}
+	return ByFileName(name)
+}
+
 // Create a FlagSet for flags associated with this module. These will be added
 // to "sign" and "remote sign", and transferred to a remote server via the URL
 // query parameters.
@@ -0,0 +1,96 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package smime
+
+// Sign RFC 822 messages, such as release announcements, with S/MIME
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/smime"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+	"github.com/sassoftware/relic/v7/signers"
+)
+
+var SmimeSigner = &signers.Signer{
+	Name:         "smime",
+	Aliases:      []string{"eml"},
+	CertTypes:    signers.CertTypeX509,
+	TestPath:     testPath,
+	Sign:         sign,
+	VerifyStream: verify,
+}
+
+const maxMessage = 64 << 20
+
+func init() {
+	SmimeSigner.Flags().Bool("smime-opaque", false, "(S/MIME) Create an application/pkcs7-mime message instead of multipart/signed")
+	signers.Register(SmimeSigner)
+}
+
+func testPath(fp string) bool {
+	return filepath.Ext(fp) == ".eml"
+}
+
+func readMessage(r io.Reader) ([]byte, error) {
+	blob, err := ioutil.ReadAll(io.LimitReader(r, maxMessage+1))
+	if err != nil {
+		return nil, err
+	} else if len(blob) > maxMessage {
+		return nil, errors.New("message is too large")
+	}
+	return blob, nil
+}
+
+func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	blob, err := readMessage(r)
+	if err != nil {
+		return nil, err
+	}
+	signed, ts, err := smime.Sign(opts.Context(), blob, cert, opts.Hash, opts.Time, opts.Flags.GetBool("smime-opaque"))
+	if err != nil {
+		return nil, err
+	}
+	opts.Audit.SetCounterSignature(ts.CounterSignature)
+	opts.Audit.SetMimeType("message/rfc822")
+	return signed, nil
+}
+
+func verify(r io.Reader, opts signers.VerifyOpts) ([]*signers.Signature, error) {
+	blob, err := readMessage(r)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := smime.Verify(blob, opts.NoDigests)
+	if err != nil {
+		return nil, err
+	}
+	hash, _ := x509tools.PkixDigestToHash(sig.Signature.SignerInfo.DigestAlgorithm)
+	info := "multipart/signed"
+	if sig.Opaque {
+		info = "application/pkcs7-mime"
+	}
+	return []*signers.Signature{{
+		SigInfo:       info,
+		Hash:          hash,
+		X509Signature: sig.Signature,
+	}}, nil
+}
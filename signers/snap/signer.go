@@ -0,0 +1,98 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package snap
+
+// Sign snapd assertions (account-key, snap-build, snap-revision, etc.). The
+// input is a JSON object of headers with an optional "body", the same as
+// accepted by "snap sign".
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/snapassert"
+	"github.com/sassoftware/relic/v7/signers"
+)
+
+var SnapSigner = &signers.Signer{
+	Name:         "snap-assertion",
+	Aliases:      []string{"snap"},
+	CertTypes:    signers.CertTypePgp,
+	TestPath:     testPath,
+	Sign:         sign,
+	VerifyStream: verify,
+}
+
+func init() {
+	signers.Register(SnapSigner)
+}
+
+func testPath(fp string) bool {
+	return filepath.Ext(fp) == ".assert"
+}
+
+func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	blob, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var headers map[string]interface{}
+	if err := json.Unmarshal(blob, &headers); err != nil {
+		return nil, errors.New("expected a JSON object of assertion headers")
+	}
+	var body []byte
+	if b, ok := headers["body"]; ok {
+		s, ok := b.(string)
+		if !ok {
+			return nil, errors.New("assertion body must be a string")
+		}
+		body = []byte(s)
+		delete(headers, "body")
+	}
+	if _, ok := headers["timestamp"]; !ok {
+		headers["timestamp"] = opts.Time.UTC().Format("2006-01-02T15:04:05Z")
+	}
+	signed, err := snapassert.Sign(headers, body, cert.PgpKey.PrivateKey, opts.Time)
+	if err != nil {
+		return nil, err
+	}
+	opts.Audit.SetMimeType("application/x.ubuntu.assertion")
+	opts.Audit.Attributes["snap.type"] = headers["type"]
+	opts.Audit.Attributes["snap.authority-id"] = headers["authority-id"]
+	return signed, nil
+}
+
+func verify(r io.Reader, opts signers.VerifyOpts) ([]*signers.Signature, error) {
+	blob, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	a, err := snapassert.Verify(blob, opts.TrustedPgp)
+	if err != nil {
+		return nil, err
+	}
+	return []*signers.Signature{{
+		Package:      a.Type,
+		CreationTime: a.Signature.CreationTime,
+		Hash:         a.Signature.Hash,
+		SignerPgp:    a.Signature.Key.Entity,
+	}}, nil
+}
@@ -0,0 +1,223 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package sshca
+
+// Issue OpenSSH user and host certificates, like "ssh-keygen -s". The input is
+// the public key to certify and the output is the certificate.
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/sshca"
+	"github.com/sassoftware/relic/v7/lib/sshsig"
+	"github.com/sassoftware/relic/v7/signers"
+)
+
+var SSHCASigner = &signers.Signer{
+	Name:         "sshca",
+	TestPath:     testPath,
+	Sign:         sign,
+	VerifyStream: verify,
+}
+
+const maxKeyFile = 64 << 10
+
+func init() {
+	SSHCASigner.Flags().String("sshca-principals", "", "(SSH CA) Comma-separated user names or host names to certify")
+	SSHCASigner.Flags().Bool("sshca-host", false, "(SSH CA) Issue a host certificate instead of a user certificate")
+	SSHCASigner.Flags().String("sshca-id", "", "(SSH CA) Key identity recorded in the certificate and in server logs (default: the key's comment)")
+	SSHCASigner.Flags().String("sshca-validity", "", "(SSH CA) Certificate lifetime, e.g. 8h (default: the longest the key's policy allows)")
+	SSHCASigner.Flags().String("sshca-force-command", "", "(SSH CA) Command forced for logins using the certificate")
+	SSHCASigner.Flags().String("sshca-source-address", "", "(SSH CA) Comma-separated CIDR addresses the certificate may be used from")
+	SSHCASigner.Flags().String("sshca-extensions", "", "(SSH CA) Comma-separated extensions for a user certificate, or \"none\" (default: the ssh-keygen set)")
+	signers.Register(SSHCASigner)
+}
+
+func testPath(fp string) bool {
+	return strings.HasSuffix(filepath.Base(fp), "-cert.pub")
+}
+
+func readKeyFile(r io.Reader) ([]byte, error) {
+	blob, err := ioutil.ReadAll(io.LimitReader(r, maxKeyFile+1))
+	if err != nil {
+		return nil, err
+	} else if len(blob) > maxKeyFile {
+		return nil, errors.New("public key file is too large")
+	}
+	return blob, nil
+}
+
+func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	policy := cert.SSHCAPolicy
+	if policy == nil {
+		return nil, fmt.Errorf("key %q is not configured as an SSH certificate authority", cert.KeyName)
+	}
+	blob, err := readKeyFile(r)
+	if err != nil {
+		return nil, err
+	}
+	pub, comment, _, _, err := ssh.ParseAuthorizedKey(blob)
+	if err != nil {
+		return nil, fmt.Errorf("parsing public key: %w", err)
+	}
+	req := &sshca.Request{
+		PublicKey:  pub,
+		Host:       opts.Flags.GetBool("sshca-host"),
+		KeyID:      opts.Flags.GetString("sshca-id"),
+		Principals: splitList(opts.Flags.GetString("sshca-principals")),
+		Validity:   policy.MaxValidityDuration(),
+		// the server fills these in from the client's credentials
+		Caller:      opts.Caller,
+		CallerRoles: opts.CallerRoles,
+	}
+	if req.KeyID == "" {
+		req.KeyID = comment
+	}
+	if v := opts.Flags.GetString("sshca-validity"); v != "" {
+		req.Validity, err = time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("sshca-validity: %w", err)
+		}
+	}
+	for _, name := range []string{"force-command", "source-address"} {
+		if v := opts.Flags.GetString("sshca-" + name); v != "" {
+			if req.CriticalOptions == nil {
+				req.CriticalOptions = make(map[string]string)
+			}
+			req.CriticalOptions[name] = v
+		}
+	}
+	if v := opts.Flags.GetString("sshca-extensions"); v != "" {
+		req.Extensions = make(map[string]string)
+		if v != "none" {
+			for _, name := range splitList(v) {
+				req.Extensions[name] = ""
+			}
+		}
+	}
+	if err := policy.Check(req); err != nil {
+		return nil, fmt.Errorf("key %q: %w", cert.KeyName, err)
+	}
+	sshCert, err := sshca.Issue(req, cert.Signer(), opts.Time)
+	if err != nil {
+		return nil, err
+	}
+	certType := "user"
+	if req.Host {
+		certType = "host"
+	}
+	opts.Audit.Attributes["sshca.type"] = certType
+	opts.Audit.Attributes["sshca.keyid"] = sshCert.KeyId
+	opts.Audit.Attributes["sshca.principals"] = sshCert.ValidPrincipals
+	opts.Audit.Attributes["sshca.serial"] = strconv.FormatUint(sshCert.Serial, 10)
+	opts.Audit.Attributes["sshca.fingerprint"] = ssh.FingerprintSHA256(pub)
+	opts.Audit.Attributes["sshca.validbefore"] = time.Unix(int64(sshCert.ValidBefore), 0).UTC()
+	out := bytes.TrimSpace(ssh.MarshalAuthorizedKey(sshCert))
+	if comment != "" {
+		out = append(out, ' ')
+		out = append(out, comment...)
+	}
+	return append(out, '\n'), nil
+}
+
+func verify(r io.Reader, opts signers.VerifyOpts) ([]*signers.Signature, error) {
+	blob, err := readKeyFile(r)
+	if err != nil {
+		return nil, err
+	}
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(blob)
+	if err != nil {
+		return nil, err
+	}
+	sshCert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return nil, errors.New("not an SSH certificate")
+	}
+	// checking any one principal verifies the CA signature and validity period
+	var principal string
+	if len(sshCert.ValidPrincipals) != 0 {
+		principal = sshCert.ValidPrincipals[0]
+	}
+	checker := &ssh.CertChecker{SupportedCriticalOptions: []string{"force-command", "source-address", "verify-required"}}
+	if err := checker.CheckCert(principal, sshCert); err != nil {
+		return nil, err
+	}
+	if opts.AllowedSigners != "" {
+		if err := checkAuthority(sshCert, opts.AllowedSigners); err != nil {
+			return nil, err
+		}
+	} else if !opts.NoChain {
+		return nil, errors.New("--allowed-signers with a cert-authority line is required to verify SSH certificates")
+	}
+	certType := "user"
+	if sshCert.CertType == ssh.HostCert {
+		certType = "host"
+	}
+	return []*signers.Signature{{
+		Package:      fmt.Sprintf("%s certificate %q for %s", certType, sshCert.KeyId, strings.Join(sshCert.ValidPrincipals, ",")),
+		CreationTime: time.Unix(int64(sshCert.ValidAfter), 0),
+		Signer:       "CA " + ssh.FingerprintSHA256(sshCert.SignatureKey),
+	}}, nil
+}
+
+// check that the issuing CA is listed as a cert-authority for all of the
+// certificate's principals
+func checkAuthority(sshCert *ssh.Certificate, path string) error {
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	allowed, err := sshsig.ParseAllowedSigners(blob)
+	if err != nil {
+		return err
+	}
+	caBlob := sshCert.SignatureKey.Marshal()
+	for _, principal := range sshCert.ValidPrincipals {
+		found := false
+		for _, signer := range allowed {
+			if signer.CertAuthority && bytes.Equal(signer.PublicKey.Marshal(), caBlob) && signer.MatchPrincipal(principal) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("CA %s is not trusted for principal %q", ssh.FingerprintSHA256(sshCert.SignatureKey), principal)
+		}
+	}
+	return nil
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,111 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package sshsig
+
+// Sign arbitrary files using the SSH signature format of "ssh-keygen -Y sign"
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/magic"
+	"github.com/sassoftware/relic/v7/lib/sshsig"
+	"github.com/sassoftware/relic/v7/signers"
+)
+
+var SSHSigSigner = &signers.Signer{
+	Name:         "sshsig",
+	Magic:        magic.FileTypeSSHSIG,
+	Sign:         sign,
+	VerifyStream: verify,
+}
+
+const maxSignature = 1 << 20
+
+func init() {
+	SSHSigSigner.Flags().String("sshsig-namespace", "file", "(SSH) Namespace the signature is valid for, such as \"file\" or \"git\"")
+	signers.Register(SSHSigSigner)
+}
+
+func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	namespace := opts.Flags.GetString("sshsig-namespace")
+	sig, err := sshsig.Sign(r, cert.Signer(), opts.Hash, namespace)
+	if err != nil {
+		return nil, err
+	}
+	opts.Audit.Attributes["sshsig.namespace"] = namespace
+	opts.Audit.Attributes["sshsig.fingerprint"] = ssh.FingerprintSHA256(sig.PublicKey)
+	return sig.Armor(), nil
+}
+
+func verify(r io.Reader, opts signers.VerifyOpts) ([]*signers.Signature, error) {
+	blob, err := ioutil.ReadAll(io.LimitReader(r, maxSignature))
+	if err != nil {
+		return nil, err
+	}
+	sig, err := sshsig.Parse(blob)
+	if err != nil {
+		return nil, err
+	}
+	if !opts.NoDigests {
+		if opts.Content == "" {
+			return nil, errors.New("--content is required to verify SSH signatures")
+		}
+		f, err := os.Open(opts.Content)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if err := sig.Verify(f, ""); err != nil {
+			return nil, err
+		}
+	}
+	var principals []string
+	if opts.AllowedSigners != "" {
+		allowedBlob, err := ioutil.ReadFile(opts.AllowedSigners)
+		if err != nil {
+			return nil, err
+		}
+		allowed, err := sshsig.ParseAllowedSigners(allowedBlob)
+		if err != nil {
+			return nil, err
+		}
+		principals = sig.Principals(allowed, time.Now())
+		if len(principals) == 0 {
+			return nil, fmt.Errorf("key %s is not an allowed signer for namespace %q", ssh.FingerprintSHA256(sig.PublicKey), sig.Namespace)
+		}
+	} else if !opts.NoChain {
+		return nil, errors.New("--allowed-signers is required to verify SSH signatures")
+	}
+	signer := ssh.FingerprintSHA256(sig.PublicKey)
+	if len(principals) != 0 {
+		signer = fmt.Sprintf("`%s`(%s)", strings.Join(principals, ","), signer)
+	}
+	return []*signers.Signature{{
+		SigInfo: "namespace " + sig.Namespace,
+		Hash:    sig.Hash(),
+		Signer:  signer,
+	}}, nil
+}
@@ -0,0 +1,293 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package tarmanifest
+
+// Sign tar archives with a manifest of member digests. The signed manifest is
+// either appended to the archive or written alongside it as
+// <archive>.p7s or <archive>.asc.
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
+
+	"github.com/sassoftware/relic/v7/lib/atomicfile"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/pgptools"
+	"github.com/sassoftware/relic/v7/lib/pkcs7"
+	"github.com/sassoftware/relic/v7/lib/pkcs9"
+	"github.com/sassoftware/relic/v7/lib/tarmanifest"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+	"github.com/sassoftware/relic/v7/signers"
+	"github.com/sassoftware/relic/v7/signers/pkcs"
+	"github.com/sassoftware/relic/v7/signers/sigerrors"
+)
+
+var TarSigner = &signers.Signer{
+	Name:      "tar",
+	TestPath:  testPath,
+	Transform: transform,
+	Sign:      sign,
+	Verify:    verify,
+}
+
+const (
+	sigTypeCMS = "cms"
+	sigTypePGP = "pgp"
+)
+
+// file suffixes of detached signatures and the member names they correspond to
+var detachedSuffixes = []struct{ suffix, name string }{
+	{".p7s", tarmanifest.CMSSignatureName},
+	{".asc", tarmanifest.PGPSignatureName},
+}
+
+func init() {
+	TarSigner.Flags().String("tar-sig-type", "", "(tar) Signature type: cms or pgp. Defaults to cms unless the key only has a PGP certificate")
+	TarSigner.Flags().Bool("tar-detached", false, "(tar) Write the signed manifest alongside the archive instead of appending it")
+	signers.Register(TarSigner)
+}
+
+func testPath(fp string) bool {
+	fp = strings.ToLower(fp)
+	for _, suffix := range []string{".tar", ".tar.gz", ".tar.zst", ".tzst"} {
+		if strings.HasSuffix(fp, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+type tarTransformer struct {
+	f        *os.File
+	detached bool
+}
+
+func transform(f *os.File, opts signers.SignOpts) (signers.Transformer, error) {
+	return &tarTransformer{f: f, detached: opts.Flags.GetBool("tar-detached")}, nil
+}
+
+func (t *tarTransformer) GetReader() (io.Reader, error) {
+	if _, err := t.f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return t.f, nil
+}
+
+// Replace the archive, or write a detached signature next to it if the
+// output is the archive itself
+func (t *tarTransformer) Apply(dest, mimeType string, result io.Reader) error {
+	if t.detached && dest == t.f.Name() {
+		switch mimeType {
+		case "application/pgp-signature":
+			dest += ".asc"
+		default:
+			dest += ".p7s"
+		}
+	}
+	outfile, err := atomicfile.WriteAny(dest)
+	if err != nil {
+		return err
+	}
+	defer outfile.Close()
+	if _, err := io.Copy(outfile, result); err != nil {
+		return err
+	}
+	t.f.Close()
+	return outfile.Commit()
+}
+
+func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	sigType := opts.Flags.GetString("tar-sig-type")
+	if sigType == "" {
+		sigType = sigTypeCMS
+		if cert.Leaf == nil && cert.PgpKey != nil {
+			sigType = sigTypePGP
+		}
+	}
+	detached := opts.Flags.GetBool("tar-detached")
+	r, compression, err := tarmanifest.Decompress(r)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	var zw io.WriteCloser
+	var tw *tar.Writer
+	if !detached {
+		zw, err = compression.NewWriter(&out)
+		if err != nil {
+			return nil, err
+		}
+		tw = tar.NewWriter(zw)
+	}
+	archive, err := tarmanifest.Read(r, tw)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := archive.Manifest.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	var sig []byte
+	var sigName string
+	switch sigType {
+	case sigTypeCMS:
+		if cert.Leaf == nil {
+			return nil, errors.New("CMS signatures require a X.509 certificate")
+		}
+		sig, err = pkcs.Sign(bytes.NewReader(manifest), cert, opts)
+		sigName = tarmanifest.CMSSignatureName
+	case sigTypePGP:
+		sig, err = signPgp(manifest, cert, opts)
+		sigName = tarmanifest.PGPSignatureName
+	default:
+		return nil, fmt.Errorf("unknown tar-sig-type %q", sigType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	opts.Audit.Attributes["tar.members"] = len(archive.Manifest.Members)
+	opts.Audit.Attributes["tar.sigtype"] = sigType
+	if detached {
+		// mimetype was set by the signature
+		return sig, nil
+	}
+	if err := tarmanifest.WriteSignature(tw, manifest, sigName, sig, opts.Time); err != nil {
+		return nil, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	opts.Audit.SetMimeType("application/x-tar")
+	return out.Bytes(), nil
+}
+
+func signPgp(manifest []byte, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	if cert.PgpKey == nil {
+		return nil, errors.New("PGP signatures require a PGP certificate")
+	}
+	config := &packet.Config{
+		DefaultHash: opts.Hash,
+		Time:        func() time.Time { return opts.Time },
+	}
+	var buf bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&buf, cert.PgpKey, bytes.NewReader(manifest), config); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	opts.Audit.SetMimeType("application/pgp-signature")
+	return buf.Bytes(), nil
+}
+
+func verify(f *os.File, opts signers.VerifyOpts) ([]*signers.Signature, error) {
+	r, _, err := tarmanifest.Decompress(f)
+	if err != nil {
+		return nil, err
+	}
+	archive, err := tarmanifest.Read(r, nil)
+	if err != nil {
+		return nil, err
+	}
+	manifest, sig, sigName := archive.StoredManifest, archive.Signature, archive.SignatureName
+	if manifest == nil {
+		// look for a detached signature over the computed manifest
+		manifest, err = archive.Manifest.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range detachedSuffixes {
+			sig, err = ioutil.ReadFile(f.Name() + d.suffix)
+			if err == nil {
+				sigName = d.name
+				break
+			} else if !os.IsNotExist(err) {
+				return nil, err
+			}
+		}
+		if sig == nil {
+			return nil, sigerrors.NotSignedError{Type: "tar archive"}
+		}
+	} else if !opts.NoDigests {
+		if err := archive.Check(manifest); err != nil {
+			return nil, err
+		}
+	}
+	var ret *signers.Signature
+	switch sigName {
+	case tarmanifest.CMSSignatureName:
+		ret, err = verifyCMS(manifest, sig, opts)
+	case tarmanifest.PGPSignatureName:
+		ret, err = verifyPgp(manifest, sig, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+	ret.SigInfo = fmt.Sprintf("%d members", len(archive.Manifest.Members))
+	return []*signers.Signature{ret}, nil
+}
+
+func verifyCMS(manifest, sig []byte, opts signers.VerifyOpts) (*signers.Signature, error) {
+	psd, err := pkcs7.Unmarshal(sig)
+	if err != nil {
+		return nil, err
+	}
+	pksig, err := psd.Content.Verify(manifest, opts.NoDigests)
+	if err != nil {
+		return nil, err
+	}
+	ts, err := pkcs9.VerifyOptionalTimestamp(pksig)
+	if err != nil {
+		return nil, err
+	}
+	hash, _ := x509tools.PkixDigestToHash(ts.SignerInfo.DigestAlgorithm)
+	return &signers.Signature{
+		Hash:          hash,
+		X509Signature: &ts,
+	}, nil
+}
+
+func verifyPgp(manifest, sig []byte, opts signers.VerifyOpts) (*signers.Signature, error) {
+	block, err := armor.Decode(bytes.NewReader(sig))
+	if err != nil {
+		return nil, err
+	}
+	pgpsig, err := pgptools.VerifyDetached(block.Body, bytes.NewReader(manifest), opts.TrustedPgp)
+	if err != nil {
+		if pgpsig != nil {
+			return nil, fmt.Errorf("bad signature from %s(%x) [%s]: %w", pgptools.EntityName(pgpsig.Key.Entity), pgpsig.Key.PublicKey.KeyId, pgpsig.CreationTime, err)
+		}
+		return nil, err
+	}
+	return &signers.Signature{
+		CreationTime: pgpsig.CreationTime,
+		Hash:         pgpsig.Hash,
+		SignerPgp:    pgpsig.Key.Entity,
+	}, nil
+}
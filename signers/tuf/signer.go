@@ -0,0 +1,186 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package tuf
+
+// Sign The Update Framework metadata: root, targets, snapshot, timestamp and
+// delegated targets roles. Existing signatures by other keys are kept, so
+// each holder of a root key can sign the same file in turn during a signing
+// ceremony, whether through the server or offline with a token.
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/sassoftware/relic/v7/lib/audit"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/tuf"
+	"github.com/sassoftware/relic/v7/signers"
+)
+
+var TUFSigner = &signers.Signer{
+	Name:         "tuf",
+	TestPath:     testPath,
+	FormatLog:    formatLog,
+	Sign:         sign,
+	VerifyStream: verify,
+}
+
+const maxMetadata = 16 << 20
+
+// top-level role files, optionally with a version prefix as in 2.root.json
+var rolePath = regexp.MustCompile(`^(?:[0-9]+\.)?(root|targets|snapshot|timestamp)\.json$`)
+
+func init() {
+	TUFSigner.Flags().String("tuf-keyid", "", "(TUF) Key ID to sign as, if the key isn't listed under its default ID")
+	signers.Register(TUFSigner)
+}
+
+func testPath(fp string) bool {
+	return rolePath.MatchString(filepath.Base(fp))
+}
+
+func formatLog(attrs *audit.Info) *zerolog.Event {
+	return attrs.AttrsForLog("tuf.")
+}
+
+func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	blob, err := ioutil.ReadAll(io.LimitReader(r, maxMetadata+1))
+	if err != nil {
+		return nil, err
+	} else if len(blob) > maxMetadata {
+		return nil, errors.New("TUF metadata is too large")
+	}
+	m, h, err := tuf.Parse(blob)
+	if err != nil {
+		return nil, err
+	}
+	signer := cert.Signer()
+	keyID := opts.Flags.GetString("tuf-keyid")
+	if keyID == "" && h.Type == "root" {
+		// root metadata lists the keys that sign it, so use the ID it has
+		var ok bool
+		keyID, ok = tuf.FindKey(h.Keys, signer.Public())
+		if !ok {
+			return nil, errors.New("signing key is not listed in the root metadata")
+		}
+	} else if keyID == "" {
+		key, err := tuf.PublicKey(signer.Public())
+		if err != nil {
+			return nil, err
+		}
+		keyID, err = key.ID()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := m.Sign(signer, keyID); err != nil {
+		return nil, err
+	}
+	opts.Audit.Attributes["tuf.type"] = h.Type
+	opts.Audit.Attributes["tuf.version"] = h.Version
+	opts.Audit.Attributes["tuf.keyid"] = keyID
+	if h.Type == "root" {
+		// record progress towards the threshold
+		keys, role, err := h.Delegation("root")
+		if err != nil {
+			return nil, err
+		}
+		valid, _ := m.Verify(keys, role)
+		opts.Audit.Attributes["tuf.signatures"] = len(valid)
+		opts.Audit.Attributes["tuf.threshold"] = role.Threshold
+	}
+	opts.Audit.SetMimeType("application/json")
+	return m.Marshal()
+}
+
+// Verify metadata against the keys delegated to it by the root or targets
+// metadata given with --content. Root metadata is also checked against its
+// own keys, and against the previous root if one is given.
+func verify(r io.Reader, opts signers.VerifyOpts) ([]*signers.Signature, error) {
+	blob, err := ioutil.ReadAll(io.LimitReader(r, maxMetadata+1))
+	if err != nil {
+		return nil, err
+	}
+	m, h, err := tuf.Parse(blob)
+	if err != nil {
+		return nil, err
+	}
+	var delegators []*tuf.Header
+	if h.Type == "root" {
+		delegators = append(delegators, h)
+	}
+	if opts.Content != "" {
+		parentBlob, err := ioutil.ReadFile(opts.Content)
+		if err != nil {
+			return nil, err
+		}
+		_, parent, err := tuf.Parse(parentBlob)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", opts.Content, err)
+		}
+		delegators = append(delegators, parent)
+	} else if h.Type != "root" {
+		return nil, fmt.Errorf("--content must name the root or delegating targets metadata to verify %s metadata", h.Type)
+	}
+	var sigs []*signers.Signature
+	seen := make(map[string]bool)
+	for _, parent := range delegators {
+		role := h.Type
+		if parent.Type == "targets" {
+			role = roleName(opts.FileName)
+		}
+		keys, delegation, err := parent.Delegation(role)
+		if err != nil {
+			return nil, err
+		}
+		valid, err := m.Verify(keys, delegation)
+		if err != nil {
+			return nil, fmt.Errorf("%s metadata: %w", role, err)
+		}
+		for _, keyID := range valid {
+			if seen[keyID] {
+				continue
+			}
+			seen[keyID] = true
+			sigs = append(sigs, &signers.Signature{
+				SigInfo: fmt.Sprintf("tuf %s v%d", role, h.Version),
+				Signer:  "keyid " + keyID,
+			})
+		}
+	}
+	if !h.Expires.IsZero() && h.Expires.Before(time.Now()) {
+		return nil, fmt.Errorf("%s metadata expired at %s", h.Type, h.Expires.Format(time.RFC3339))
+	}
+	return sigs, nil
+}
+
+// the name of a delegated role is its file name, less any version prefix
+func roleName(fp string) string {
+	name := strings.TrimSuffix(filepath.Base(fp), ".json")
+	if i := strings.IndexByte(name, '.'); i > 0 && strings.Trim(name[:i], "0123456789") == "" {
+		name = name[i+1:]
+	}
+	return name
+}
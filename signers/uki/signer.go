@@ -0,0 +1,141 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package uki
+
+// Sign systemd-stub unified kernel images. The sections are checked and
+// optionally updated before the whole image is Authenticode signed, since
+// changing any section after the fact would break the signature.
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/sassoftware/relic/v7/lib/authenticode"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/uki"
+	"github.com/sassoftware/relic/v7/signers"
+)
+
+var UKISigner = &signers.Signer{
+	Name:      "uki",
+	CertTypes: signers.CertTypeX509,
+	Sign:      sign,
+	Verify:    verify,
+}
+
+func init() {
+	UKISigner.Flags().String("uki-cmdline", "", "(UKI) Replace the kernel command line")
+	UKISigner.Flags().Bool("uki-pcr-sign", false, "(UKI) Add PCR 11 policy signatures made with the signing key")
+	UKISigner.Flags().String("uki-pcr-phases", strings.Join(uki.DefaultPhases, ","), "(UKI) Comma-separated boot phase paths to sign PCR policies for")
+	signers.Register(UKISigner)
+}
+
+func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	blob, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	img, err := uki.Parse(blob)
+	if err != nil {
+		return nil, err
+	}
+	if cmdline := opts.Flags.GetString("uki-cmdline"); cmdline != "" {
+		if err := img.SetSection(uki.SectionCmdline, []byte(cmdline)); err != nil {
+			return nil, err
+		}
+		opts.Audit.Attributes["uki.cmdline"] = cmdline
+	}
+	if err := img.Validate(); err != nil {
+		return nil, err
+	}
+	// a PCR signature from a previous build is no longer valid
+	img.RemoveSection(uki.SectionPCRSig)
+	if opts.Flags.GetBool("uki-pcr-sign") {
+		pkey, fingerprint, err := uki.PublicKeyPEM(cert.Leaf.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		if err := img.SetSection(uki.SectionPCRPKey, pkey); err != nil {
+			return nil, err
+		}
+		phases := strings.Split(opts.Flags.GetString("uki-pcr-phases"), ",")
+		pcrsig, err := uki.SignPCRPolicies(img, cert.Signer(), phases)
+		if err != nil {
+			return nil, err
+		}
+		if err := img.SetSection(uki.SectionPCRSig, pcrsig); err != nil {
+			return nil, err
+		}
+		opts.Audit.Attributes["uki.pcrpkey"] = fingerprint
+		opts.Audit.Attributes["uki.phases"] = strings.Join(phases, ",")
+	}
+	unsigned, err := img.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	signed, ts, err := authenticode.SignPEBytes(opts.Context(), unsigned, opts.Hash, false, cert)
+	if err != nil {
+		return nil, err
+	}
+	opts.Audit.SetCounterSignature(ts.CounterSignature)
+	opts.Audit.SetMimeType("application/efi")
+	return signed, nil
+}
+
+func verify(f *os.File, opts signers.VerifyOpts) ([]*signers.Signature, error) {
+	sigs, err := authenticode.VerifyPE(f, opts.NoDigests)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	blob, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	img, err := uki.Parse(blob)
+	if err != nil {
+		return nil, err
+	}
+	if err := img.Validate(); err != nil {
+		return nil, err
+	}
+	sigInfo := "uki"
+	if !opts.NoDigests {
+		// the signed phases aren't recorded, so only the signatures themselves
+		// can be checked
+		pcrsigs, err := uki.VerifyPCRSignatures(img, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(pcrsigs) != 0 {
+			sigInfo = "uki+pcrsig"
+		}
+	}
+	var ret []*signers.Signature
+	for _, sig := range sigs {
+		ret = append(ret, &signers.Signature{
+			SigInfo:       sigInfo,
+			Hash:          sig.ImageHashFunc,
+			X509Signature: &sig.TimestampedSignature,
+		})
+	}
+	return ret, nil
+}
@@ -0,0 +1,128 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package vba
+
+// Macro-enabled Office documents are zips holding the project in
+// word/vbaProject.bin, xl/vbaProject.bin, etc. The project is replaced with a
+// signed copy and the rest of the document is left alone.
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/sassoftware/relic/v7/lib/authenticode"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/zipslicer"
+	"github.com/sassoftware/relic/v7/signers"
+	"github.com/sassoftware/relic/v7/signers/zipbased"
+)
+
+const projectName = "vbaProject.bin"
+
+// standalone projects are uploaded as-is, documents are uploaded as a zip tar
+func transform(f *os.File, opts signers.SignOpts) (signers.Transformer, error) {
+	magic := make([]byte, len(cdfMagic))
+	if _, err := io.ReadFull(f, magic); err != nil {
+		return nil, err
+	}
+	if bytes.Equal(magic, cdfMagic) {
+		return signers.DefaultTransform(f), nil
+	}
+	return zipbased.Transform(f, opts)
+}
+
+func isProject(name string) bool {
+	return path.Base(name) == projectName
+}
+
+func signDocument(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts, kinds []authenticode.VBASigKind) ([]byte, error) {
+	inz, err := zipslicer.ReadZipTar(r)
+	if err != nil {
+		return nil, err
+	}
+	var name string
+	var unsigned []byte
+	m, err := inz.Mangle(func(f *zipslicer.MangleFile) error {
+		if !isProject(f.Name) {
+			return nil
+		} else if name != "" {
+			return errors.New("document contains more than one VBA project")
+		}
+		fr, err := f.Open()
+		if err != nil {
+			return err
+		}
+		defer fr.Close()
+		unsigned, err = ioutil.ReadAll(fr)
+		if err != nil {
+			return err
+		}
+		name = f.Name
+		f.Delete()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		return nil, errors.New("document does not contain a VBA project")
+	}
+	signed, err := signProject(bytes.NewReader(unsigned), cert, opts, kinds)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.NewFile(name, signed); err != nil {
+		return nil, err
+	}
+	patch, err := m.MakePatch(true)
+	if err != nil {
+		return nil, err
+	}
+	return opts.SetBinPatch(patch)
+}
+
+func verifyDocument(f *os.File, opts signers.VerifyOpts) ([]*signers.Signature, error) {
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	inz, err := zip.NewReader(f, size)
+	if err != nil {
+		return nil, err
+	}
+	for _, zf := range inz.File {
+		if !isProject(zf.Name) {
+			continue
+		}
+		fr, err := zf.Open()
+		if err != nil {
+			return nil, err
+		}
+		blob, err := ioutil.ReadAll(fr)
+		fr.Close()
+		if err != nil {
+			return nil, err
+		}
+		return verifyProject(bytes.NewReader(blob), opts)
+	}
+	return nil, errors.New("document does not contain a VBA project")
+}
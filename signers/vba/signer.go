@@ -0,0 +1,236 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package vba
+
+// Sign VBA macro projects, either as a standalone vbaProject.bin or inside of
+// a macro-enabled Office document
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sassoftware/relic/v7/lib/authenticode"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/comdoc"
+	"github.com/sassoftware/relic/v7/lib/pkcs9"
+	"github.com/sassoftware/relic/v7/lib/vba"
+	"github.com/sassoftware/relic/v7/signers"
+	"github.com/sassoftware/relic/v7/signers/sigerrors"
+)
+
+var VBASigner = &signers.Signer{
+	Name:      "vba",
+	CertTypes: signers.CertTypeX509,
+	TestPath:  testPath,
+	Transform: transform,
+	Sign:      sign,
+	Verify:    verify,
+}
+
+var officeExtensions = map[string]bool{
+	".docm": true, ".dotm": true,
+	".xlsm": true, ".xltm": true, ".xlam": true,
+	".pptm": true, ".potm": true, ".ppam": true,
+}
+
+var allKinds = []authenticode.VBASigKind{authenticode.VBASigLegacy, authenticode.VBASigAgile, authenticode.VBASigV3}
+
+var cdfMagic = []byte{0xd0, 0xcf, 0x11, 0xe0, 0xa1, 0xb1, 0x1a, 0xe1}
+
+func init() {
+	VBASigner.Flags().String("vba-signatures", "legacy,agile,v3", "(VBA) Comma-separated kinds of signature to add: legacy, agile, v3")
+	signers.Register(VBASigner)
+}
+
+func testPath(fp string) bool {
+	return officeExtensions[strings.ToLower(filepath.Ext(fp))] || strings.EqualFold(filepath.Base(fp), "vbaProject.bin")
+}
+
+func sigKinds(opts signers.SignOpts) ([]authenticode.VBASigKind, error) {
+	var kinds []authenticode.VBASigKind
+	for _, name := range strings.Split(opts.Flags.GetString("vba-signatures"), ",") {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "legacy":
+			kinds = append(kinds, authenticode.VBASigLegacy)
+		case "agile":
+			kinds = append(kinds, authenticode.VBASigAgile)
+		case "v3":
+			kinds = append(kinds, authenticode.VBASigV3)
+		case "":
+		default:
+			return nil, fmt.Errorf("unknown VBA signature kind %q", name)
+		}
+	}
+	if len(kinds) == 0 {
+		return nil, errors.New("no VBA signature kinds selected")
+	}
+	return kinds, nil
+}
+
+func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	kinds, err := sigKinds(opts)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(len(cdfMagic)); bytes.Equal(magic, cdfMagic) {
+		return signProject(br, cert, opts, kinds)
+	}
+	return signDocument(br, cert, opts, kinds)
+}
+
+// sign every kind of signature for a project and return the stream contents
+func signKinds(project *vba.Project, kinds []authenticode.VBASigKind, cert *certloader.Certificate, opts signers.SignOpts) (map[authenticode.VBASigKind][]byte, error) {
+	blobs := make(map[authenticode.VBASigKind][]byte, len(kinds))
+	var names []string
+	var ts *pkcs9.TimestampedSignature
+	for _, kind := range kinds {
+		blob, sig, err := authenticode.SignVBA(opts.Context(), project, kind, opts.Hash, cert)
+		if err != nil {
+			return nil, fmt.Errorf("%s signature: %w", kind, err)
+		}
+		blobs[kind] = blob
+		names = append(names, kind.String())
+		ts = sig
+	}
+	opts.Audit.Attributes["vba.project"] = project.Name
+	opts.Audit.Attributes["vba.signatures"] = strings.Join(names, ",")
+	opts.Audit.SetCounterSignature(ts.CounterSignature)
+	return blobs, nil
+}
+
+// sign a standalone vbaProject.bin by adding signature streams to it
+func signProject(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts, kinds []authenticode.VBASigKind) ([]byte, error) {
+	tmp, err := os.CreateTemp("", "relic-vba-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	if _, err := io.Copy(tmp, r); err != nil {
+		return nil, err
+	}
+	cdf, err := comdoc.WriteFile(tmp)
+	if err != nil {
+		return nil, err
+	}
+	project, err := vba.Open(cdf)
+	if err != nil {
+		return nil, err
+	}
+	blobs, err := signKinds(project, kinds, cert, opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, kind := range allKinds {
+		if blob := blobs[kind]; blob != nil {
+			err = cdf.AddFile(kind.StreamName(), blob)
+		} else {
+			// drop signatures of other kinds, which are no longer valid
+			err = cdf.DeleteFile(kind.StreamName())
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := cdf.Close(); err != nil {
+		return nil, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	opts.Audit.SetMimeType("application/vnd.ms-office.vbaProject")
+	return ioutil.ReadAll(tmp)
+}
+
+func verify(f *os.File, opts signers.VerifyOpts) ([]*signers.Signature, error) {
+	magic := make([]byte, len(cdfMagic))
+	if _, err := io.ReadFull(f, magic); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(magic, cdfMagic) {
+		return verifyDocument(f, opts)
+	}
+	return verifyProject(f, opts)
+}
+
+// verify the signature streams of a standalone vbaProject.bin
+func verifyProject(r io.ReaderAt, opts signers.VerifyOpts) ([]*signers.Signature, error) {
+	cdf, err := comdoc.ReadFile(r)
+	if err != nil {
+		return nil, err
+	}
+	files, err := cdf.ListDir(nil)
+	if err != nil {
+		return nil, err
+	}
+	streams := make(map[authenticode.VBASigKind][]byte)
+	for _, item := range files {
+		for _, kind := range allKinds {
+			if item.Name() == kind.StreamName() {
+				r, err := cdf.ReadStream(item)
+				if err != nil {
+					return nil, err
+				}
+				streams[kind], err = ioutil.ReadAll(r)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return verifyStreams(cdf, streams, opts)
+}
+
+// verify each signature stream against the project
+func verifyStreams(cdf *comdoc.ComDoc, streams map[authenticode.VBASigKind][]byte, opts signers.VerifyOpts) ([]*signers.Signature, error) {
+	if len(streams) == 0 {
+		return nil, sigerrors.NotSignedError{Type: "VBA project"}
+	}
+	var project *vba.Project
+	if !opts.NoDigests {
+		var err error
+		project, err = vba.Open(cdf)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var sigs []*signers.Signature
+	for _, kind := range allKinds {
+		blob := streams[kind]
+		if blob == nil {
+			continue
+		}
+		sig, err := authenticode.VerifyVBA(blob, kind, project)
+		if err != nil {
+			return nil, fmt.Errorf("%s signature: %w", kind, err)
+		}
+		sigs = append(sigs, &signers.Signature{
+			SigInfo:       kind.String(),
+			Hash:          sig.HashFunc,
+			X509Signature: &sig.TimestampedSignature,
+		})
+	}
+	return sigs, nil
+}
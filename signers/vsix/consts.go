@@ -29,6 +29,8 @@ const (
 	sigType       = "http://schemas.openxmlformats.org/package/2006/relationships/digital-signature/signature"
 	certType      = "http://schemas.openxmlformats.org/package/2006/relationships/digital-signature/certificate"
 
+	relTransformAlg = "http://schemas.openxmlformats.org/package/2006/RelationshipTransform"
+
 	defaultContentType = "application/octet-stream"
 	tsFormatXML        = "YYYY-MM-DDThh:mm:ss.sTZD"
 	tsFormatGo         = "2006-01-02T15:04:05.0-07:00"
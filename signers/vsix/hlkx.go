@@ -0,0 +1,164 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package vsix
+
+// Sign Windows hardware lab kit (.hlkx) driver submission packages. Unlike
+// VSIX, the package's own relationships are kept and covered by the signature
+// through the OPC relationship transform.
+
+import (
+	"crypto"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/signappx"
+	"github.com/sassoftware/relic/v7/lib/zipslicer"
+	"github.com/sassoftware/relic/v7/signers"
+	"github.com/sassoftware/relic/v7/signers/zipbased"
+)
+
+var HlkxSigner = &signers.Signer{
+	Name:      "hlkx",
+	CertTypes: signers.CertTypeX509,
+	TestPath:  testHlkx,
+	Transform: zipbased.Transform,
+	Sign:      signHlkx,
+	Verify:    verify,
+}
+
+func init() {
+	signers.Register(HlkxSigner)
+}
+
+func testHlkx(fp string) bool {
+	return strings.HasSuffix(strings.ToLower(fp), ".hlkx")
+}
+
+func signHlkx(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	m, rootRels, err := manglePackage(r, opts.Hash, digSigPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	// the root relationships get a pointer to the signature origin. Neither
+	// that relationship nor the origin part are covered by the signature.
+	sigName := path.Join(xmlSigPath, calcFileName(cert.Leaf)+".psdsxs")
+	rootRels.Append(originPath, sigOriginType)
+	contents, err := rootRels.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	if err := m.m.NewFile(relPath(""), contents); err != nil {
+		return nil, err
+	}
+	var originRels oxfRelationships
+	originRels.Append(sigName, sigType)
+	contents, err = originRels.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	if err := m.m.NewFile(relPath(originPath), contents); err != nil {
+		return nil, err
+	}
+	if err := m.m.NewFile(originPath, nil); err != nil {
+		return nil, err
+	}
+	sigfile, err := m.makeSignature(cert, opts, false, "")
+	if err != nil {
+		return nil, err
+	}
+	if err := m.m.NewFile(sigName, sigfile); err != nil {
+		return nil, err
+	}
+	if err := m.newCtypes(false); err != nil {
+		return nil, err
+	}
+	patch, err := m.m.MakePatch(true)
+	if err != nil {
+		return nil, err
+	}
+	return opts.SetBinPatch(patch)
+}
+
+// Digest every part of the package, including relationship parts, and remove
+// any previous signature found under sigDir. If visit is not nil then it is
+// called with the contents of each ordinary part.
+func manglePackage(r io.Reader, hash crypto.Hash, sigDir string, visit func(name string, contents []byte) error) (*mangler, *oxfRelationships, error) {
+	inz, err := zipslicer.ReadZipTar(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	m := &mangler{
+		digests: make(map[string][]byte),
+		relRefs: make(map[string][]string),
+		ctypes:  signappx.NewContentTypes(),
+		hash:    hash,
+	}
+	rootRels := new(oxfRelationships)
+	zm, err := inz.Mangle(func(f *zipslicer.MangleFile) error {
+		switch {
+		case f.Name == contentTypesPath:
+			f.Delete()
+			return m.parseTypes(f)
+		case strings.HasPrefix(f.Name, sigDir+"/"), strings.HasSuffix(f.Name, "/"):
+			f.Delete()
+			return nil
+		case path.Ext(f.Name) == ".rels":
+			blob, err := readMangleFile(f)
+			if err != nil {
+				return err
+			}
+			rels, err := unmarshalRels(blob)
+			if err != nil {
+				return fmt.Errorf("%s: %w", f.Name, err)
+			}
+			if f.Name == relPath("") {
+				// rewritten with the new signature origin
+				f.Delete()
+				rels.Remove(sigOriginType)
+				rootRels = rels
+			}
+			ids := rels.IDs()
+			m.relRefs[f.Name] = ids
+			m.digests[f.Name], err = rels.TransformDigest(ids, hash)
+			return err
+		case visit == nil:
+			sum, err := f.Digest(hash)
+			if err != nil {
+				return err
+			}
+			m.digests[f.Name] = sum
+			return nil
+		default:
+			blob, err := readMangleFile(f)
+			if err != nil {
+				return err
+			}
+			d := hash.New()
+			d.Write(blob)
+			m.digests[f.Name] = d.Sum(nil)
+			return visit(f.Name, blob)
+		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	m.m = zm
+	return m, rootRels, nil
+}
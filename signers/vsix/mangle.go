@@ -29,6 +29,7 @@ import (
 type mangler struct {
 	m       *zipslicer.Mangler
 	digests map[string][]byte
+	relRefs map[string][]string // relationship IDs signed in each .rels part
 	ctypes  *signappx.ContentTypes
 	hash    crypto.Hash
 }
@@ -0,0 +1,185 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package vsix
+
+// Sign Office Open XML documents (.docx, .xlsx, .pptx and friends). The
+// package is signed the same way as HLKX, but with the part names Office uses
+// and an additional idOfficeObject carrying the details Office shows in its
+// signature pane, including which signature line the signature belongs to.
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/beevik/etree"
+
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/signers"
+	"github.com/sassoftware/relic/v7/signers/zipbased"
+)
+
+const (
+	officeSigPath    = "_xmlsignatures"
+	officeOriginPath = officeSigPath + "/origin.sigs"
+	officeSigName    = officeSigPath + "/sig1.xml"
+	officeSigID      = "idPackageSignature"
+
+	nsOfficeDigSig = "http://schemas.microsoft.com/office/2006/digsig"
+
+	originContentType = "application/vnd.openxmlformats-package.digital-signature-origin"
+	sigContentType    = "application/vnd.openxmlformats-package.digital-signature-xmlsignature+xml"
+
+	// SignatureType values in SignatureInfoV1
+	officeSigTypeDefault = "1"
+	officeSigTypeLine    = "2"
+)
+
+var OoxmlSigner = &signers.Signer{
+	Name:      "ooxml",
+	CertTypes: signers.CertTypeX509,
+	TestPath:  testOoxml,
+	Transform: zipbased.Transform,
+	Sign:      signOoxml,
+	Verify:    verify,
+}
+
+// macro-enabled documents are left to the vba signer
+var ooxmlExtensions = map[string]bool{
+	".docx": true, ".dotx": true,
+	".xlsx": true, ".xltx": true,
+	".pptx": true, ".potx": true, ".ppsx": true,
+}
+
+func init() {
+	OoxmlSigner.Flags().String("signature-comments", "", "(OOXML) Purpose for signing the document")
+	OoxmlSigner.Flags().String("signature-line", "", "(OOXML) Setup ID of the signature line to sign")
+	signers.Register(OoxmlSigner)
+}
+
+func testOoxml(fp string) bool {
+	return ooxmlExtensions[strings.ToLower(path.Ext(fp))]
+}
+
+func signOoxml(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	setupID := opts.Flags.GetString("signature-line")
+	var visit func(string, []byte) error
+	var foundLine bool
+	if setupID != "" {
+		// signature lines are VML shapes in the document body
+		needle := []byte(strings.ToUpper(setupID))
+		visit = func(name string, contents []byte) error {
+			switch path.Ext(name) {
+			case ".xml", ".vml":
+				if bytes.Contains(bytes.ToUpper(contents), needle) {
+					foundLine = true
+				}
+			}
+			return nil
+		}
+	}
+	m, rootRels, err := manglePackage(r, opts.Hash, officeSigPath, visit)
+	if err != nil {
+		return nil, err
+	}
+	if setupID != "" && !foundLine {
+		return nil, fmt.Errorf("signature line %s not found in document", setupID)
+	}
+	rootRels.Append(officeOriginPath, sigOriginType)
+	contents, err := rootRels.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	if err := m.m.NewFile(relPath(""), contents); err != nil {
+		return nil, err
+	}
+	var originRels oxfRelationships
+	originRels.Append(officeSigName, sigType)
+	contents, err = originRels.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	if err := m.m.NewFile(relPath(officeOriginPath), contents); err != nil {
+		return nil, err
+	}
+	if err := m.m.NewFile(officeOriginPath, nil); err != nil {
+		return nil, err
+	}
+	office := officeObject(cert, setupID, opts.Flags.GetString("signature-comments"))
+	sigfile, err := m.makeSignature(cert, opts, false, officeSigID, office)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.m.NewFile(officeSigName, sigfile); err != nil {
+		return nil, err
+	}
+	for name := range m.ctypes.ByOverride {
+		if strings.HasPrefix(name, "/"+officeSigPath+"/") {
+			delete(m.ctypes.ByOverride, name)
+		}
+	}
+	m.ctypes.ByExt["sigs"] = originContentType
+	m.ctypes.ByOverride["/"+officeSigName] = sigContentType
+	contents, err = m.ctypes.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	if err := m.m.NewFile(contentTypesPath, contents); err != nil {
+		return nil, err
+	}
+	if setupID != "" {
+		opts.Audit.Attributes["ooxml.signature-line"] = setupID
+	}
+	patch, err := m.m.MakePatch(true)
+	if err != nil {
+		return nil, err
+	}
+	return opts.SetBinPatch(patch)
+}
+
+// Build the idOfficeObject holding SignatureInfoV1
+func officeObject(cert *certloader.Certificate, setupID, comments string) *etree.Element {
+	obj := etree.NewElement("Object")
+	obj.CreateAttr("Id", "idOfficeObject")
+	prop := obj.CreateElement("SignatureProperties").CreateElement("SignatureProperty")
+	prop.CreateAttr("Id", "idOfficeV1Details")
+	prop.CreateAttr("Target", "#"+officeSigID)
+	info := prop.CreateElement("SignatureInfoV1")
+	info.CreateAttr("xmlns", nsOfficeDigSig)
+	sigType, sigText := officeSigTypeDefault, ""
+	if setupID != "" {
+		sigType, sigText = officeSigTypeLine, cert.Leaf.Subject.CommonName
+	}
+	info.CreateElement("SetupID").SetText(setupID)
+	info.CreateElement("SignatureText").SetText(sigText)
+	info.CreateElement("SignatureImage")
+	info.CreateElement("SignatureComments").SetText(comments)
+	info.CreateElement("WindowsVersion").SetText("10.0")
+	info.CreateElement("OfficeVersion").SetText("16.0")
+	info.CreateElement("ApplicationVersion").SetText("16.0")
+	info.CreateElement("Monitors").SetText("1")
+	info.CreateElement("HorizontalResolution").SetText("1920")
+	info.CreateElement("VerticalResolution").SetText("1080")
+	info.CreateElement("ColorDepth").SetText("32")
+	info.CreateElement("SignatureProviderId").SetText("{00000000-0000-0000-0000-000000000000}")
+	info.CreateElement("SignatureProviderUrl")
+	info.CreateElement("SignatureProviderDetails").SetText("9")
+	info.CreateElement("SignatureType").SetText(sigType)
+	return obj
+}
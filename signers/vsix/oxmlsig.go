@@ -54,6 +54,12 @@ type reference struct {
 
 type method struct {
 	Algorithm string `xml:",attr"`
+	// RelationshipTransform only
+	RelationshipReferences []relationshipReference `xml:"RelationshipReference"`
+}
+
+type relationshipReference struct {
+	SourceID string `xml:"SourceId,attr"`
 }
 
 type property struct {
@@ -83,19 +89,14 @@ func checkManifest(files zipFiles, manifest *etree.Element) error {
 		if zf == nil {
 			return fmt.Errorf("validation failed: file not found: %s", p)
 		}
-		f, err := zf.Open()
-		if err != nil {
-			return fmt.Errorf("validation failed: %w", err)
-		}
 		_, hash := xmldsig.HashAlgorithm(ref.DigestMethod.Algorithm)
 		if !hash.Available() {
 			return errors.New("validation failed: unsupported digest algorithm")
 		}
-		d := hash.New()
-		if _, err := io.Copy(d, f); err != nil {
-			return err
+		refCalc, err := digestReference(files, p, ref, hash)
+		if err != nil {
+			return fmt.Errorf("validation failed: %s: %w", p, err)
 		}
-		refCalc := d.Sum(nil)
 		refv, err := base64.StdEncoding.DecodeString(ref.DigestValue)
 		if err != nil {
 			return errors.New("validation failed: invalid digest")
@@ -107,6 +108,32 @@ func checkManifest(files zipFiles, manifest *etree.Element) error {
 	return nil
 }
 
+func digestReference(files zipFiles, p string, ref reference, hash crypto.Hash) ([]byte, error) {
+	for _, tr := range ref.Transforms {
+		if tr.Algorithm != relTransformAlg {
+			continue
+		}
+		rels, err := parseRels(files, p)
+		if err != nil {
+			return nil, err
+		}
+		ids := make([]string, len(tr.RelationshipReferences))
+		for i, rr := range tr.RelationshipReferences {
+			ids[i] = rr.SourceID
+		}
+		return rels.TransformDigest(ids, hash)
+	}
+	f, err := files[p].Open()
+	if err != nil {
+		return nil, err
+	}
+	d := hash.New()
+	if _, err := io.Copy(d, f); err != nil {
+		return nil, err
+	}
+	return d.Sum(nil), nil
+}
+
 func checkTimestamp(root *etree.Element, encryptedDigest []byte) (*pkcs9.CounterSignature, error) {
 	tsEl := root.FindElement("Object/TimeStamp/EncodedTime")
 	if tsEl == nil {
@@ -184,7 +211,10 @@ func readSignature(files zipFiles) ([]byte, []*x509.Certificate, error) {
 	return sigblob, certs, nil
 }
 
-func (m *mangler) makeSignature(cert *certloader.Certificate, opts signers.SignOpts, detachCerts bool) ([]byte, error) {
+// Build the signature part. If sigID is set then it becomes the Id of the
+// Signature element, and any extra objects are signed along with the package
+// manifest.
+func (m *mangler) makeSignature(cert *certloader.Certificate, opts signers.SignOpts, detachCerts bool, sigID string, extra ...*etree.Element) ([]byte, error) {
 	hashUri := xmldsig.HashUris[opts.Hash]
 	if hashUri == "" {
 		return nil, errors.New("unsupported digest algorithm")
@@ -203,7 +233,7 @@ func (m *mangler) makeSignature(cert *certloader.Certificate, opts signers.SignO
 		ctype := m.ctypes.Find(name)
 		if ctype == "" {
 			ext := path.Ext(path.Base(name))
-			if ext[0] == '.' {
+			if ext != "" {
 				ctype = contentTypes[ext[1:]]
 			}
 		}
@@ -212,6 +242,17 @@ func (m *mangler) makeSignature(cert *certloader.Certificate, opts signers.SignO
 		}
 		ref := manifest.CreateElement("Reference")
 		ref.CreateAttr("URI", "/"+name+"?ContentType="+ctype)
+		if ids, ok := m.relRefs[name]; ok {
+			transforms := ref.CreateElement("Transforms")
+			relTransform := transforms.CreateElement("Transform")
+			relTransform.CreateAttr("Algorithm", relTransformAlg)
+			for _, id := range ids {
+				rr := relTransform.CreateElement("mdssi:RelationshipReference")
+				rr.CreateAttr("xmlns:mdssi", nsDigSig)
+				rr.CreateAttr("SourceId", id)
+			}
+			transforms.CreateElement("Transform").CreateAttr("Algorithm", xmldsig.AlgXMLExcC14nRec)
+		}
 		ref.CreateElement("DigestMethod").CreateAttr("Algorithm", hashUri)
 		ref.CreateElement("DigestValue").SetText(base64.StdEncoding.EncodeToString(digest))
 	}
@@ -219,7 +260,11 @@ func (m *mangler) makeSignature(cert *certloader.Certificate, opts signers.SignO
 	props := pkg.CreateElement("SignatureProperties")
 	proptime := props.CreateElement("SignatureProperty")
 	proptime.CreateAttr("Id", "idSignatureTime")
-	proptime.CreateAttr("Target", "")
+	target := ""
+	if sigID != "" {
+		target = "#" + sigID
+	}
+	proptime.CreateAttr("Target", target)
 	sigtime := proptime.CreateElement("SignatureTime")
 	sigtime.CreateAttr("xmlns", nsDigSig)
 	sigtime.CreateElement("Format").SetText(tsFormatXML)
@@ -229,10 +274,14 @@ func (m *mangler) makeSignature(cert *certloader.Certificate, opts signers.SignO
 	if !detachCerts {
 		xopts.IncludeX509 = true
 	}
-	sigel, err := xmldsig.SignEnveloping(pkg, opts.Hash, cert.Signer(), cert.Chain(), xopts)
+	objects := append([]*etree.Element{pkg}, extra...)
+	sigel, err := xmldsig.SignEnvelopingObjects(objects, opts.Hash, cert.Signer(), cert.Chain(), xopts)
 	if err != nil {
 		return nil, err
 	}
+	if sigID != "" {
+		sigel.CreateAttr("Id", sigID)
+	}
 	// timestamp
 	if cert.Timestamper != nil {
 		encryptedDigest, _ := base64.StdEncoding.DecodeString(sigel.SelectElement("SignatureValue").Text())
@@ -19,11 +19,15 @@ package vsix
 import (
 	"crypto"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"path"
+	"sort"
+	"strings"
 
 	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/zipslicer"
 )
 
 type oxfRelationships struct {
@@ -32,9 +36,10 @@ type oxfRelationships struct {
 }
 
 type oxfRelationship struct {
-	Target string `xml:",attr"`
-	Id     string `xml:",attr"`
-	Type   string `xml:",attr"`
+	Target     string `xml:",attr"`
+	Id         string `xml:",attr"`
+	Type       string `xml:",attr"`
+	TargetMode string `xml:",attr,omitempty"`
 }
 
 func readZip(files zipFiles, path string) ([]byte, error) {
@@ -54,6 +59,10 @@ func parseRels(files zipFiles, path string) (*oxfRelationships, error) {
 	if err != nil {
 		return nil, err
 	}
+	return unmarshalRels(blob)
+}
+
+func unmarshalRels(blob []byte) (*oxfRelationships, error) {
 	rels := new(oxfRelationships)
 	if err := xml.Unmarshal(blob, rels); err != nil {
 		return nil, fmt.Errorf("error parsing rels: %w", err)
@@ -70,6 +79,74 @@ func (rels *oxfRelationships) Find(rType string) string {
 	return ""
 }
 
+// Remove all relationships of the given type
+func (rels *oxfRelationships) Remove(rType string) {
+	kept := rels.Relationship[:0]
+	for _, rel := range rels.Relationship {
+		if rel.Type != rType {
+			kept = append(kept, rel)
+		}
+	}
+	rels.Relationship = kept
+}
+
+// IDs returns the sorted IDs of all relationships
+func (rels *oxfRelationships) IDs() []string {
+	ids := make([]string, len(rels.Relationship))
+	for i, rel := range rels.Relationship {
+		ids[i] = rel.Id
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// TransformDigest digests the selected relationships as transformed by the
+// OPC RelationshipTransform followed by C14N: sorted by ID, with the default
+// target mode filled in, and serialized canonically.
+func (rels *oxfRelationships) TransformDigest(ids []string, hash crypto.Hash) ([]byte, error) {
+	selected := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		selected[id] = true
+	}
+	sorted := make([]oxfRelationship, 0, len(ids))
+	for _, rel := range rels.Relationship {
+		if selected[rel.Id] {
+			sorted = append(sorted, rel)
+		}
+	}
+	if len(sorted) != len(selected) {
+		return nil, errors.New("relationship transform references a missing relationship")
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Id < sorted[j].Id })
+	var b strings.Builder
+	b.WriteString(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for _, rel := range sorted {
+		mode := rel.TargetMode
+		if mode == "" {
+			mode = "Internal"
+		}
+		fmt.Fprintf(&b, `<Relationship Id="%s" Target="%s" TargetMode="%s" Type="%s"></Relationship>`,
+			escapeC14nAttr(rel.Id), escapeC14nAttr(rel.Target), escapeC14nAttr(mode), escapeC14nAttr(rel.Type))
+	}
+	b.WriteString(`</Relationships>`)
+	d := hash.New()
+	d.Write([]byte(b.String()))
+	return d.Sum(nil), nil
+}
+
+var c14nAttrEscaper = strings.NewReplacer(
+	"&", "&amp;",
+	"<", "&lt;",
+	`"`, "&quot;",
+	"\t", "&#x9;",
+	"\n", "&#xA;",
+	"\r", "&#xD;",
+)
+
+func escapeC14nAttr(s string) string {
+	return c14nAttrEscaper.Replace(s)
+}
+
 func (rels *oxfRelationships) Append(zipPath, relType string) {
 	d := crypto.SHA1.New()
 	d.Write([]byte(zipPath))
@@ -117,6 +194,14 @@ func (m *mangler) addFile(name string, contents []byte) error {
 	return m.m.NewFile(name, contents)
 }
 
+func readMangleFile(f *zipslicer.MangleFile) ([]byte, error) {
+	fc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(fc)
+}
+
 func (m *mangler) newRels(parent, child, relType string) error {
 	var rels oxfRelationships
 	rels.Append(child, relType)
@@ -74,7 +74,7 @@ func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]b
 		}
 	}
 	// sign and add ctypes
-	sigfile, err := m.makeSignature(cert, opts, detachCerts)
+	sigfile, err := m.makeSignature(cert, opts, detachCerts, "")
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,110 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package wasm
+
+// Sign WebAssembly modules using the wasmsign2 signature custom section
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/wasm"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+	"github.com/sassoftware/relic/v7/signers"
+	"github.com/sassoftware/relic/v7/signers/sigerrors"
+)
+
+var WasmSigner = &signers.Signer{
+	Name:      "wasm",
+	CertTypes: signers.CertTypeX509,
+	TestPath:  testPath,
+	Sign:      sign,
+	Verify:    verify,
+}
+
+func init() {
+	WasmSigner.Flags().Bool("wasm-replace", false, "(WASM) Replace existing signatures instead of adding to them")
+	WasmSigner.Flags().Bool("wasm-split", false, "(WASM) Add delimiters around custom sections so they can be stripped without invalidating the signature")
+	signers.Register(WasmSigner)
+}
+
+func testPath(fp string) bool {
+	return strings.EqualFold(filepath.Ext(fp), ".wasm")
+}
+
+func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	blob, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	patch, err := wasm.Sign(blob, cert.Signer(), wasm.SignOptions{
+		KeyID:   cert.Leaf.SubjectKeyId,
+		Replace: opts.Flags.GetBool("wasm-replace"),
+		Split:   opts.Flags.GetBool("wasm-split"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(cert.Leaf.SubjectKeyId) != 0 {
+		opts.Audit.Attributes["wasm.keyid"] = hex.EncodeToString(cert.Leaf.SubjectKeyId)
+	}
+	return opts.SetBinPatch(patch)
+}
+
+func verify(f *os.File, opts signers.VerifyOpts) ([]*signers.Signature, error) {
+	blob, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	m, err := wasm.Parse(blob)
+	if err != nil {
+		return nil, err
+	}
+	var keys []ed25519.PublicKey
+	var certs []*x509.Certificate
+	for _, cert := range opts.TrustedX509 {
+		if key, ok := cert.PublicKey.(ed25519.PublicKey); ok {
+			keys = append(keys, key)
+			certs = append(certs, cert)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no trusted ed25519 keys; use --cert to specify known keys")
+	}
+	signed, err := m.Verify(keys, nil)
+	if errors.Is(err, wasm.ErrNotSigned) {
+		return nil, sigerrors.NotSignedError{Type: "wasm"}
+	} else if err != nil {
+		return nil, err
+	}
+	var sigs []*signers.Signature
+	for _, i := range signed {
+		sigs = append(sigs, &signers.Signature{
+			Signer: fmt.Sprintf("`%s`", x509tools.FormatSubject(certs[i])),
+		})
+	}
+	return sigs, nil
+}
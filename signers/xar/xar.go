@@ -20,6 +20,7 @@ var signer = &signers.Signer{
 }
 
 func init() {
+	signer.Flags().Bool("notarize", false, "(Apple) submit the signed file for notarization and staple the ticket")
 	signers.Register(signer)
 }
 
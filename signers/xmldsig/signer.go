@@ -0,0 +1,149 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package xmldsig
+
+// Sign arbitrary XML documents with enveloped signatures, or any file with a
+// detached XML signature
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/beevik/etree"
+
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/pkcs7"
+	"github.com/sassoftware/relic/v7/lib/pkcs9"
+	"github.com/sassoftware/relic/v7/lib/xmldsig"
+	"github.com/sassoftware/relic/v7/signers"
+)
+
+var XMLSigner = &signers.Signer{
+	Name:      "xmldsig",
+	Aliases:   []string{"xml"},
+	CertTypes: signers.CertTypeX509,
+	TestPath:  testPath,
+	Sign:      sign,
+	Verify:    verify,
+}
+
+func init() {
+	XMLSigner.Flags().String("xml-id", "", "(XML) Sign the element with this ID attribute instead of the whole document. The signature becomes its first child, as SAML expects.")
+	XMLSigner.Flags().Bool("xml-detached", false, "(XML) Create a detached signature document instead of signing the file in place")
+	XMLSigner.Flags().Bool("xml-keyvalue", false, "(XML) Add a KeyValue element with the public key")
+	signers.Register(XMLSigner)
+}
+
+func testPath(fp string) bool {
+	return strings.HasSuffix(strings.ToLower(fp), ".xml")
+}
+
+func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	blob, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	xopts := xmldsig.SignOptions{
+		IncludeX509:     true,
+		IncludeKeyValue: opts.Flags.GetBool("xml-keyvalue"),
+		ReferenceID:     opts.Flags.GetString("xml-id"),
+	}
+	if opts.Flags.GetBool("xml-detached") {
+		if xopts.ReferenceID != "" {
+			return nil, errors.New("xml-id and xml-detached are mutually exclusive")
+		}
+		if opts.Path == "" {
+			return nil, errors.New("detached signature requires a file name")
+		}
+		sig, err := xmldsig.SignDetached(blob, filepath.Base(opts.Path), opts.Hash, cert.Signer(), cert.Chain(), xopts)
+		if err != nil {
+			return nil, err
+		}
+		doc := etree.NewDocument()
+		doc.CreateProcInst("xml", `version="1.0" encoding="UTF-8"`)
+		doc.SetRoot(sig)
+		opts.Audit.SetMimeType("application/xml")
+		return doc.WriteToBytes()
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(blob); err != nil {
+		return nil, err
+	}
+	root := doc.Root()
+	if root == nil {
+		return nil, errors.New("document has no root element")
+	}
+	if xopts.ReferenceID != "" {
+		root = xmldsig.FindByID(root, xopts.ReferenceID)
+		if root == nil {
+			return nil, fmt.Errorf("element with ID %q not found", xopts.ReferenceID)
+		}
+	}
+	if err := xmldsig.Sign(root, root, opts.Hash, cert.Signer(), cert.Chain(), xopts); err != nil {
+		return nil, err
+	}
+	if children := root.ChildElements(); xopts.ReferenceID != "" && len(children) > 1 {
+		// move the signature from the end to the front
+		sig := children[len(children)-1]
+		root.RemoveChild(sig)
+		root.InsertChild(children[0], sig)
+	}
+	opts.Audit.SetMimeType("application/xml")
+	return doc.WriteToBytes()
+}
+
+func verify(f *os.File, opts signers.VerifyOpts) ([]*signers.Signature, error) {
+	doc := etree.NewDocument()
+	if _, err := doc.ReadFrom(f); err != nil {
+		return nil, err
+	}
+	root := doc.Root()
+	if root == nil {
+		return nil, errors.New("document has no root element")
+	}
+	var xs *xmldsig.Signature
+	var err error
+	if opts.Content != "" {
+		content, err := ioutil.ReadFile(opts.Content)
+		if err != nil {
+			return nil, err
+		}
+		xs, err = xmldsig.VerifyDetached(root, ".", content, opts.TrustedX509)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		xs, err = xmldsig.Verify(root, "//Signature", opts.TrustedX509)
+		if err != nil {
+			return nil, err
+		}
+	}
+	psig := pkcs7.Signature{Intermediates: xs.Certificates, Certificate: xs.Leaf()}
+	if psig.Certificate == nil {
+		return nil, errors.New("leaf x509 certificate not found")
+	}
+	return []*signers.Signature{{
+		SigInfo:       xs.URI,
+		Hash:          xs.Hash,
+		X509Signature: &pkcs9.TimestampedSignature{Signature: psig},
+	}}, nil
+}
@@ -0,0 +1,105 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package xpi
+
+// Sign Firefox add-ons
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/rs/zerolog"
+
+	"github.com/sassoftware/relic/v7/lib/audit"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/pkcs7"
+	"github.com/sassoftware/relic/v7/lib/pkcs9"
+	"github.com/sassoftware/relic/v7/lib/xpi"
+	"github.com/sassoftware/relic/v7/signers"
+	"github.com/sassoftware/relic/v7/signers/zipbased"
+)
+
+var XpiSigner = &signers.Signer{
+	Name:      "xpi",
+	Aliases:   []string{"firefox"},
+	CertTypes: signers.CertTypeX509,
+	TestPath:  testPath,
+	FormatLog: formatLog,
+	Transform: zipbased.Transform,
+	Sign:      sign,
+	Verify:    verify,
+}
+
+func init() {
+	signers.Register(XpiSigner)
+}
+
+func testPath(fp string) bool {
+	return filepath.Ext(fp) == ".xpi"
+}
+
+func formatLog(attrs *audit.Info) *zerolog.Event {
+	return attrs.AttrsForLog("xpi.")
+}
+
+func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	digest, err := xpi.DigestStream(r)
+	if err != nil {
+		return nil, err
+	}
+	patch, ts, err := digest.Sign(opts.Context(), cert, opts.Hash)
+	if err != nil {
+		return nil, err
+	}
+	if digest.ID != "" {
+		opts.Audit.Attributes["xpi.id"] = digest.ID
+	}
+	opts.Audit.SetCounterSignature(ts.CounterSignature)
+	return opts.SetBinPatch(patch)
+}
+
+func verify(f *os.File, opts signers.VerifyOpts) ([]*signers.Signature, error) {
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	inz, err := zip.NewReader(f, size)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := xpi.Verify(inz, opts.NoDigests)
+	if err != nil {
+		return nil, err
+	}
+	ret := []*signers.Signature{{
+		SigInfo:       "pkcs7",
+		Hash:          sig.PKCS7.Hash,
+		X509Signature: &sig.PKCS7.TimestampedSignature,
+	}}
+	for _, cs := range sig.COSE {
+		ret = append(ret, &signers.Signature{
+			SigInfo: "cose",
+			X509Signature: &pkcs9.TimestampedSignature{Signature: pkcs7.Signature{
+				Certificate:   cs.Certificate,
+				Intermediates: cs.Intermediates,
+			}},
+		})
+	}
+	return ret, nil
+}
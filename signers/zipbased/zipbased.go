@@ -20,6 +20,7 @@ import (
 	"io"
 	"os"
 
+	"github.com/sassoftware/relic/v7/lib/signjar"
 	"github.com/sassoftware/relic/v7/lib/zipslicer"
 	"github.com/sassoftware/relic/v7/signers"
 )
@@ -45,3 +46,21 @@ func (t *zipTransformer) GetReader() (io.Reader, error) {
 func (t *zipTransformer) Apply(dest, mimeType string, result io.Reader) error {
 	return signers.ApplyBinPatch(t.f, dest, result)
 }
+
+// RemoveSignature deletes the JAR signature files, and any APK signing block,
+// from a zip-based package
+func RemoveSignature(f *os.File, dest string) error {
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	inz, err := zipslicer.Read(f, size)
+	if err != nil {
+		return err
+	}
+	patch, err := signjar.RemoveSignatures(inz)
+	if err != nil {
+		return err
+	}
+	return patch.Apply(f, dest)
+}
@@ -6,19 +6,25 @@ import (
 	"crypto/ecdsa"
 	"crypto/rsa"
 	"crypto/x509"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
+	"strings"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
 	"github.com/aws/aws-sdk-go-v2/service/kms"
 	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 
 	"github.com/sassoftware/relic/v7/config"
 	"github.com/sassoftware/relic/v7/lib/passprompt"
 	"github.com/sassoftware/relic/v7/token"
 )
 
-const tokenType = "aws"
+const tokenType = "awskms"
 
 type awsToken struct {
 	config *config.Config
@@ -34,6 +40,8 @@ type awsKey struct {
 
 func init() {
 	token.Openers[tokenType] = open
+	// original name
+	token.Openers["aws"] = open
 }
 
 func open(conf *config.Config, tokenName string, pinProvider passprompt.PasswordGetter) (token.Token, error) {
@@ -41,11 +49,32 @@ func open(conf *config.Config, tokenName string, pinProvider passprompt.Password
 	if err != nil {
 		return nil, err
 	}
-	cfg, err := awsconfig.LoadDefaultConfig(context.Background())
+	// credentials come from the SDK's default chain: environment, shared
+	// config, then the instance, task or pod role
+	var opts []func(*awsconfig.LoadOptions) error
+	if tconf.Region != "" {
+		opts = append(opts, awsconfig.WithRegion(tconf.Region))
+	}
+	if tconf.Profile != "" {
+		opts = append(opts, awsconfig.WithSharedConfigProfile(tconf.Profile))
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(context.Background(), opts...)
 	if err != nil {
 		return nil, err
 	}
-	cli := kms.NewFromConfig(cfg)
+	if tconf.Role != "" {
+		provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), tconf.Role, func(o *stscreds.AssumeRoleOptions) {
+			o.RoleSessionName = "relic"
+		})
+		cfg.Credentials = aws.NewCredentialsCache(provider)
+	}
+	var kmsOpts []func(*kms.Options)
+	if tconf.Endpoint != "" {
+		kmsOpts = append(kmsOpts, func(o *kms.Options) {
+			o.EndpointResolver = kms.EndpointResolverFromURL(tconf.Endpoint)
+		})
+	}
+	cli := kms.NewFromConfig(cfg, kmsOpts...)
 	return &awsToken{
 		config: conf,
 		tconf:  tconf,
@@ -58,8 +87,9 @@ func (t *awsToken) Close() error {
 }
 
 func (t *awsToken) Ping(ctx context.Context) error {
-	// TODO
-	return nil
+	// any authenticated call will do
+	_, err := t.cli.ListKeys(ctx, &kms.ListKeysInput{Limit: aws.Int32(1)})
+	return err
 }
 
 func (t *awsToken) Config() *config.TokenConfig {
@@ -71,14 +101,20 @@ func (t *awsToken) GetKey(ctx context.Context, keyName string) (token.Key, error
 	if err != nil {
 		return nil, err
 	}
-	if keyConf.ID == "" {
-		return nil, fmt.Errorf("key %q must have \"id\" set to the ID or ARN of the key", keyName)
+	id := keyID(keyConf)
+	if id == "" {
+		return nil, fmt.Errorf("key %q must have \"id\" set to the ID or ARN of the key, or \"label\" set to an alias", keyName)
 	}
-	id := keyConf.ID
 	resp, err := t.cli.GetPublicKey(ctx, &kms.GetPublicKeyInput{KeyId: &id})
 	if err != nil {
 		return nil, err
 	}
+	if resp.KeyUsage != types.KeyUsageTypeSignVerify {
+		return nil, token.KeyUsageError{
+			Key: keyName,
+			Err: fmt.Errorf("KMS key usage is %s, not SIGN_VERIFY", resp.KeyUsage),
+		}
+	}
 	pub, err := x509.ParsePKIXPublicKey(resp.PublicKey)
 	if err != nil {
 		return nil, err
@@ -90,6 +126,19 @@ func (t *awsToken) GetKey(ctx context.Context, keyName string) (token.Key, error
 	}, nil
 }
 
+// KMS accepts a key ID, key ARN, alias name or alias ARN wherever a key ID is
+// expected. A label is treated as an alias name.
+func keyID(keyConf *config.KeyConfig) string {
+	switch {
+	case keyConf.ID != "":
+		return keyConf.ID
+	case keyConf.Label != "" && !strings.HasPrefix(keyConf.Label, "alias/"):
+		return "alias/" + keyConf.Label
+	default:
+		return keyConf.Label
+	}
+}
+
 func (t *awsToken) Import(keyName string, privKey crypto.PrivateKey) (token.Key, error) {
 	return nil, token.NotImplementedError{Op: "import-key", Type: tokenType}
 }
@@ -103,7 +152,68 @@ func (t *awsToken) Generate(keyName string, keyType token.KeyType, bits uint) (t
 }
 
 func (t *awsToken) ListKeys(opts token.ListOptions) error {
-	return token.NotImplementedError{Op: "list-keys", Type: tokenType}
+	ctx := context.Background()
+	aliases := make(map[string][]string)
+	ap := kms.NewListAliasesPaginator(t.cli, &kms.ListAliasesInput{})
+	for ap.HasMorePages() {
+		page, err := ap.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		for _, alias := range page.Aliases {
+			if alias.TargetKeyId != nil {
+				aliases[*alias.TargetKeyId] = append(aliases[*alias.TargetKeyId], aws.ToString(alias.AliasName))
+			}
+		}
+	}
+	kp := kms.NewListKeysPaginator(t.cli, &kms.ListKeysInput{})
+	for kp.HasMorePages() {
+		page, err := kp.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		for _, entry := range page.Keys {
+			id := aws.ToString(entry.KeyId)
+			if opts.ID != "" && opts.ID != id && opts.ID != aws.ToString(entry.KeyArn) {
+				continue
+			}
+			if opts.Label != "" && !hasAlias(aliases[id], opts.Label) {
+				continue
+			}
+			desc, err := t.cli.DescribeKey(ctx, &kms.DescribeKeyInput{KeyId: entry.KeyId})
+			if err != nil {
+				return err
+			}
+			meta := desc.KeyMetadata
+			if meta.KeyUsage != types.KeyUsageTypeSignVerify || meta.KeyState != types.KeyStateEnabled {
+				continue
+			}
+			fmt.Fprintf(opts.Output, "id:      %s\n", id)
+			fmt.Fprintf(opts.Output, "arn:     %s\n", aws.ToString(meta.Arn))
+			fmt.Fprintf(opts.Output, "spec:    %s\n", meta.KeySpec)
+			for _, alias := range aliases[id] {
+				fmt.Fprintf(opts.Output, "alias:   %s\n", alias)
+			}
+			if opts.Values {
+				resp, err := t.cli.GetPublicKey(ctx, &kms.GetPublicKeyInput{KeyId: entry.KeyId})
+				if err != nil {
+					return err
+				}
+				_ = pem.Encode(opts.Output, &pem.Block{Type: "PUBLIC KEY", Bytes: resp.PublicKey})
+			}
+			fmt.Fprintln(opts.Output)
+		}
+	}
+	return nil
+}
+
+func hasAlias(aliases []string, label string) bool {
+	for _, alias := range aliases {
+		if alias == label || alias == "alias/"+label {
+			return true
+		}
+	}
+	return false
 }
 
 func (k *awsKey) Public() crypto.PublicKey {
@@ -119,7 +229,7 @@ func (k *awsKey) SignContext(ctx context.Context, digest []byte, opts crypto.Sig
 	if err != nil {
 		return nil, err
 	}
-	id := k.kconf.ID
+	id := keyID(k.kconf)
 	resp, err := k.cli.Sign(ctx, &kms.SignInput{
 		KeyId:            &id,
 		Message:          digest,
@@ -165,7 +275,14 @@ func (k *awsKey) sigAlgorithm(opts crypto.SignerOpts) (string, error) {
 	}
 	switch k.pub.(type) {
 	case *rsa.PublicKey:
-		if _, ok := opts.(*rsa.PSSOptions); ok {
+		if pss, ok := opts.(*rsa.PSSOptions); ok {
+			// KMS always uses a salt as long as the digest
+			if pss.SaltLength != rsa.PSSSaltLengthEqualsHash && pss.SaltLength != rsa.PSSSaltLengthAuto && pss.SaltLength != opts.HashFunc().Size() {
+				return "", token.KeyUsageError{
+					Key: k.kconf.Name(),
+					Err: errors.New("AWS KMS only supports PSS with a salt length equal to the digest length"),
+				}
+			}
 			return "RSASSA_PSS_" + alg, nil
 		} else {
 			return "RSASSA_PKCS1_V1_5_" + alg, nil
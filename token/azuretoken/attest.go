@@ -0,0 +1,100 @@
+package azuretoken
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+
+	"github.com/sassoftware/relic/v7/lib/attestation"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/token"
+)
+
+// key attestation is only available in Managed HSM, and only in API versions
+// newer than the SDK relic uses
+const attestationAPIVersion = "7.6-preview.1"
+
+type keyAttestation struct {
+	Attributes struct {
+		Attestation *struct {
+			CertificatePEMFile    string `json:"certificatePemFile"`
+			PrivateKeyAttestation string `json:"privateKeyAttestation"`
+			PublicKeyAttestation  string `json:"publicKeyAttestation"`
+		} `json:"attestation"`
+	} `json:"attributes"`
+}
+
+// Attest returns the Managed HSM attestation for the key version
+func (k *kvKey) Attest(ctx context.Context) ([]byte, error) {
+	req, err := autorest.Prepare((&http.Request{}).WithContext(ctx),
+		autorest.AsGet(),
+		autorest.WithCustomBaseURL("{vaultBaseUrl}", map[string]interface{}{"vaultBaseUrl": k.kbase}),
+		autorest.WithPathParameters("/keys/{key-name}/{key-version}/attestation", map[string]interface{}{
+			"key-name":    autorest.Encode("path", k.kname),
+			"key-version": autorest.Encode("path", k.kversion),
+		}),
+		autorest.WithQueryParameters(map[string]interface{}{"api-version": attestationAPIVersion}),
+		k.cli.WithAuthorization())
+	if err != nil {
+		return nil, err
+	}
+	resp, err := k.cli.Send(req, autorest.DoRetryForStatusCodes(k.cli.RetryAttempts, k.cli.RetryDuration, autorest.StatusCodesForRetry...))
+	if err != nil {
+		return nil, err
+	}
+	var result keyAttestation
+	err = autorest.Respond(resp,
+		azure.WithErrorUnlessStatusCode(http.StatusOK),
+		autorest.ByUnmarshallingJSON(&result),
+		autorest.ByClosing())
+	if err != nil {
+		return nil, fmt.Errorf("fetching key attestation: %w", err)
+	}
+	att := result.Attributes.Attestation
+	if att == nil || att.PrivateKeyAttestation == "" {
+		return nil, token.KeyUsageError{
+			Key: k.kconf.Name(),
+			Err: errors.New("no attestation available, only Managed HSM keys are attested"),
+		}
+	}
+	var records [][]byte
+	for _, encoded := range []string{att.PrivateKeyAttestation, att.PublicKeyAttestation} {
+		if encoded == "" {
+			continue
+		}
+		record, err := decodeBytes(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("decoding key attestation: %w", err)
+		}
+		records = append(records, record)
+	}
+	certPEM, err := decodeBytes(att.CertificatePEMFile)
+	if err != nil {
+		return nil, fmt.Errorf("decoding attestation certificates: %w", err)
+	}
+	var certs []*x509.Certificate
+	if len(certPEM) != 0 {
+		certs, err = certloader.ParseX509Certificates(certPEM)
+		if err != nil {
+			return nil, fmt.Errorf("parsing attestation certificates: %w", err)
+		}
+	}
+	return attestation.MarshalHSM(records, certs), nil
+}
+
+// Key Vault usually encodes binary fields as unpadded base64url, but accept
+// standard base64 too
+func decodeBytes(v string) ([]byte, error) {
+	v = strings.TrimRight(v, "=")
+	if strings.ContainsAny(v, "+/") {
+		return base64.RawStdEncoding.DecodeString(v)
+	}
+	return base64.RawURLEncoding.DecodeString(v)
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"strings"
 
 	kvauth "github.com/Azure/azure-sdk-for-go/services/keyvault/auth"
 	"github.com/Azure/go-autorest/autorest"
@@ -18,6 +19,10 @@ import (
 // Configure azure authentication based on the token config and/or process
 // environment.
 func newAuthorizer(tconf *config.TokenConfig) (autorest.Authorizer, error) {
+	if isManagedHSM(tconf.Endpoint) && os.Getenv("AZURE_KEYVAULT_RESOURCE") == "" {
+		// Managed HSM tokens are issued for a different resource than vaults
+		os.Setenv("AZURE_KEYVAULT_RESOURCE", managedHSMResource)
+	}
 	if tconf.Pin == nil {
 		// PIN not present means use environment
 		return newAuthorizerFromEnvironment()
@@ -32,6 +37,13 @@ func newAuthorizer(tconf *config.TokenConfig) (autorest.Authorizer, error) {
 	return kvauth.NewAuthorizerFromFile()
 }
 
+const managedHSMResource = "https://managedhsm.azure.net"
+
+func isManagedHSM(endpoint string) bool {
+	u, err := url.Parse(endpoint)
+	return err == nil && strings.Contains(u.Hostname(), ".managedhsm.")
+}
+
 // If AZURE_BEARER_TOKEN_FILE is set then auth using that file, otherwise follow
 // the same route as keyvault/auth.
 //
@@ -8,6 +8,8 @@ import (
 	"net/url"
 	"strings"
 	"time"
+
+	"github.com/sassoftware/relic/v7/lib/certloader"
 )
 
 type certRef struct {
@@ -54,6 +56,13 @@ func (t *kvToken) loadCertificateVersion(ctx context.Context, baseURL, certName,
 	if cert.Cer != nil {
 		blob = *cert.Cer
 	}
+	if cert.Sid != nil {
+		// the certificate's secret holds the full chain, but reading it needs
+		// an additional permission so fall back to just the leaf
+		if chain, err := t.loadCertificateChain(ctx, *cert.Sid); err == nil {
+			blob = chain
+		}
+	}
 	return &certRef{
 		KeyName:    keyWords[2],
 		KeyVersion: keyWords[3],
@@ -101,6 +110,36 @@ func (t *kvToken) loadCertificateLatest(ctx context.Context, baseURL, certName s
 	return t.loadCertificateVersion(ctx, baseURL, words[2], words[3])
 }
 
+// fetch the certificate's backing secret and return the DER of every
+// certificate in it. Non-exportable keys leave only the certificates in the
+// secret, while exportable ones also include the private key, which is
+// ignored.
+func (t *kvToken) loadCertificateChain(ctx context.Context, secretID string) ([]byte, error) {
+	words, baseURL, err := parseKeyURL(secretID)
+	if err != nil {
+		return nil, err
+	}
+	if len(words) != 4 || words[1] != "secrets" {
+		return nil, fmt.Errorf("unexpected format for secret ID: %s", secretID)
+	}
+	secret, err := t.cli.GetSecret(ctx, baseURL, words[2], words[3])
+	if err != nil {
+		return nil, err
+	}
+	if secret.Value == nil || secret.ContentType == nil || *secret.ContentType != "application/x-pem-file" {
+		return nil, errors.New("certificate chain is not in PEM format")
+	}
+	certs, err := certloader.ParseX509Certificates([]byte(*secret.Value))
+	if err != nil {
+		return nil, err
+	}
+	var chain []byte
+	for _, cert := range certs {
+		chain = append(chain, cert.Raw...)
+	}
+	return chain, nil
+}
+
 var errKeyID = errors.New("id: expected URL of a certificate, certificate version, or key version")
 
 func parseKeyURL(keyURL string) (words []string, baseURL string, err error) {
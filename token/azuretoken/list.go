@@ -0,0 +1,104 @@
+package azuretoken
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+	"github.com/sassoftware/relic/v7/token"
+)
+
+// ListKeys enumerates the certificates and keys in the vault named by the
+// token's endpoint setting
+func (t *kvToken) ListKeys(opts token.ListOptions) error {
+	baseURL := t.tconf.Endpoint
+	if baseURL == "" {
+		return errors.New("listing keys requires \"endpoint\" to be set to the URL of the vault")
+	}
+	ctx := context.Background()
+	if !isManagedHSM(baseURL) {
+		// Managed HSM only stores keys
+		if err := t.listCertificates(ctx, baseURL, opts); err != nil {
+			return err
+		}
+	}
+	keys, err := t.cli.GetKeys(ctx, baseURL, nil)
+	if err != nil {
+		return fmt.Errorf("listing keys: %w", err)
+	}
+	for keys.NotDone() {
+		for _, item := range keys.Values() {
+			if item.Kid == nil || (item.Managed != nil && *item.Managed) {
+				// keys backing a certificate were already listed above
+				continue
+			}
+			words, _, err := parseKeyURL(*item.Kid)
+			if err != nil || len(words) < 3 {
+				continue
+			}
+			if opts.ID != "" && opts.ID != *item.Kid {
+				continue
+			}
+			if opts.Label != "" && opts.Label != words[2] {
+				continue
+			}
+			fmt.Fprintf(opts.Output, "id:      %s\n", *item.Kid)
+			fmt.Fprintf(opts.Output, "label:   %s\n", words[2])
+			if item.Attributes != nil && item.Attributes.Enabled != nil && !*item.Attributes.Enabled {
+				fmt.Fprintf(opts.Output, "enabled: false\n")
+			}
+			fmt.Fprintln(opts.Output)
+		}
+		if err := keys.NextWithContext(ctx); err != nil {
+			return fmt.Errorf("listing keys: %w", err)
+		}
+	}
+	return nil
+}
+
+func (t *kvToken) listCertificates(ctx context.Context, baseURL string, opts token.ListOptions) error {
+	certs, err := t.cli.GetCertificates(ctx, baseURL, nil)
+	if err != nil {
+		return fmt.Errorf("listing certificates: %w", err)
+	}
+	for certs.NotDone() {
+		for _, item := range certs.Values() {
+			if item.ID == nil {
+				continue
+			}
+			words, _, err := parseKeyURL(*item.ID)
+			if err != nil || len(words) < 3 {
+				continue
+			}
+			if opts.ID != "" && opts.ID != *item.ID {
+				continue
+			}
+			if opts.Label != "" && opts.Label != words[2] {
+				continue
+			}
+			ref, err := t.loadCertificateLatest(ctx, baseURL, words[2])
+			if err != nil {
+				fmt.Fprintf(opts.Output, "id:      %s\nerror:   %s\n\n", *item.ID, err)
+				continue
+			}
+			fmt.Fprintf(opts.Output, "id:      %s\n", *item.ID)
+			fmt.Fprintf(opts.Output, "label:   %s\n", words[2])
+			fmt.Fprintf(opts.Output, "key:     %s/keys/%s/%s\n", baseURL, ref.KeyName, ref.KeyVersion)
+			if cert, err := x509.ParseCertificate(ref.CertBlob); err == nil {
+				fmt.Fprintf(opts.Output, "subject: %s\n", x509tools.FormatSubject(cert))
+				fmt.Fprintf(opts.Output, "expires: %s\n", cert.NotAfter)
+				if opts.Values {
+					_ = pem.Encode(opts.Output, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+				}
+			}
+			fmt.Fprintln(opts.Output)
+		}
+		if err := certs.NextWithContext(ctx); err != nil {
+			return fmt.Errorf("listing certificates: %w", err)
+		}
+	}
+	return nil
+}
@@ -22,7 +22,7 @@ import (
 	"github.com/sassoftware/relic/v7/token"
 )
 
-const tokenType = "azure"
+const tokenType = "azurekv"
 
 type kvToken struct {
 	config *config.Config
@@ -43,6 +43,8 @@ type kvKey struct {
 
 func init() {
 	token.Openers[tokenType] = open
+	// original name
+	token.Openers["azure"] = open
 }
 
 func open(conf *config.Config, tokenName string, pinProvider passprompt.PasswordGetter) (token.Token, error) {
@@ -110,7 +112,6 @@ func (t *kvToken) getKey(ctx context.Context, keyConf *config.KeyConfig, pingOnl
 		if cert == nil {
 			return nil, errors.New("invalid keyID")
 		}
-		cert = &certRef{KeyName: words[0], KeyVersion: words[1]}
 	case len(words) == 4 && words[1] == "keys":
 		// directly to a key version, no cert provided
 		cert = &certRef{KeyName: words[2], KeyVersion: words[3]}
@@ -175,10 +176,6 @@ func (t *kvToken) Generate(keyName string, keyType token.KeyType, bits uint) (to
 	return nil, token.NotImplementedError{Op: "generate-key", Type: tokenType}
 }
 
-func (t *kvToken) ListKeys(opts token.ListOptions) error {
-	return token.NotImplementedError{Op: "list-keys", Type: tokenType}
-}
-
 func (k *kvKey) Public() crypto.PublicKey {
 	return k.pub
 }
@@ -28,6 +28,7 @@ import (
 	"github.com/sassoftware/relic/v7/config"
 	"github.com/sassoftware/relic/v7/lib/certloader"
 	"github.com/sassoftware/relic/v7/lib/passprompt"
+	"github.com/sassoftware/relic/v7/lib/sealedkey"
 	"github.com/sassoftware/relic/v7/token"
 )
 
@@ -100,7 +101,12 @@ func (tok *fileToken) GetKey(ctx context.Context, keyName string) (token.Key, er
 	}
 	*/
 	var privateKey crypto.PrivateKey
-	if keyConf.IsPkcs12 {
+	if sealedkey.IsSealed(blob) {
+		privateKey, err = tok.unseal(keyConf, blob)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", keyName, err)
+		}
+	} else if keyConf.IsPkcs12 {
 		cert, err := certloader.ParsePKCS12(blob, tok.prompt)
 		if err != nil {
 			return nil, err
@@ -0,0 +1,139 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package filetoken
+
+import (
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/sassoftware/relic/v7/config"
+	"github.com/sassoftware/relic/v7/lib/sealedkey"
+)
+
+// unseal decrypts a key sealed with a passphrase or with key shares
+func (tok *fileToken) unseal(keyConf *config.KeyConfig, blob []byte) (crypto.PrivateKey, error) {
+	info, err := sealedkey.Parse(blob)
+	if err != nil {
+		return nil, err
+	}
+	var der []byte
+	if info.KDF == sealedkey.KDFShamir {
+		der, err = tok.unsealShares(keyConf, info)
+	} else {
+		der, err = tok.unsealPassphrase(keyConf, info)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParsePKCS8PrivateKey(der)
+}
+
+// Use the token's pin if configured, so that the server can unlock the key,
+// otherwise prompt for it
+func (tok *fileToken) unsealPassphrase(keyConf *config.KeyConfig, info *sealedkey.Info) ([]byte, error) {
+	if tok.tokenConf.Pin != nil && *tok.tokenConf.Pin != "" {
+		return info.Open(*tok.tokenConf.Pin)
+	}
+	if tok.prompt == nil {
+		return nil, errors.New("sealed key requires a passphrase, but no pin is configured for the token")
+	}
+	for {
+		passphrase, err := tok.prompt.GetPasswd(fmt.Sprintf("Passphrase for key %s: ", keyConf.Name()))
+		if err != nil {
+			return nil, err
+		} else if passphrase == "" {
+			return nil, errors.New("aborted")
+		}
+		der, err := info.Open(passphrase)
+		if err == sealedkey.ErrIncorrectPassphrase {
+			fmt.Fprintln(os.Stderr, "Incorrect passphrase")
+			continue
+		}
+		return der, err
+	}
+}
+
+// Collect shares until the threshold is met. Shares that are missing or whose
+// custodian isn't present are skipped.
+func (tok *fileToken) unsealShares(keyConf *config.KeyConfig, info *sealedkey.Info) ([]byte, error) {
+	paths := keyConf.KeyShares
+	if len(paths) == 0 {
+		var err error
+		paths, err = filepath.Glob(keyConf.KeyFile + ".share-*")
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(paths)
+	}
+	var secrets [][]byte
+	seen := make(map[int]bool)
+	for _, path := range paths {
+		if len(secrets) >= info.Threshold {
+			break
+		}
+		blob, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		share, err := info.ParseShare(blob)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		} else if seen[share.Index] {
+			continue
+		}
+		secret, err := tok.unlockShare(share, path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		} else if secret == nil {
+			continue
+		}
+		seen[share.Index] = true
+		secrets = append(secrets, secret)
+	}
+	return info.OpenShared(secrets)
+}
+
+// unlockShare returns nil if the share's custodian skips it
+func (tok *fileToken) unlockShare(share *sealedkey.Share, path string) ([]byte, error) {
+	if !share.Encrypted {
+		return share.Unlock("")
+	}
+	if tok.prompt == nil {
+		return nil, nil
+	}
+	for {
+		passphrase, err := tok.prompt.GetPasswd(fmt.Sprintf("Passphrase for key share %d (%s), or empty to skip: ", share.Index, path))
+		if err != nil {
+			return nil, err
+		} else if passphrase == "" {
+			return nil, nil
+		}
+		secret, err := share.Unlock(passphrase)
+		if err == sealedkey.ErrIncorrectPassphrase {
+			fmt.Fprintln(os.Stderr, "Incorrect passphrase")
+			continue
+		}
+		return secret, err
+	}
+}
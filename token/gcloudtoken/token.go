@@ -1,6 +1,8 @@
 package gcloudtoken
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"crypto"
 	"crypto/rsa"
@@ -9,18 +11,36 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"strconv"
+	"strings"
 	"time"
 
 	kms "cloud.google.com/go/kms/apiv1"
+	"github.com/googleapis/gax-go/v2"
+	"google.golang.org/api/impersonate"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 	kmspb "google.golang.org/genproto/googleapis/cloud/kms/v1"
+	"google.golang.org/grpc/codes"
 
 	"github.com/sassoftware/relic/v7/config"
+	"github.com/sassoftware/relic/v7/lib/attestation"
+	"github.com/sassoftware/relic/v7/lib/certloader"
 	"github.com/sassoftware/relic/v7/lib/passprompt"
 	"github.com/sassoftware/relic/v7/token"
 )
 
-const tokenType = "gcloud"
+const tokenType = "gcpkms"
+
+// Cloud KMS enforces per-project request quotas, so back off for longer than
+// the client library's defaults when throttled
+var retryCodes = []codes.Code{codes.Unavailable, codes.ResourceExhausted, codes.DeadlineExceeded}
+
+var retryBackoff = gax.Backoff{
+	Initial:    250 * time.Millisecond,
+	Max:        30 * time.Second,
+	Multiplier: 2,
+}
 
 type gcloudToken struct {
 	config *config.Config
@@ -28,16 +48,30 @@ type gcloudToken struct {
 	cli    *kms.KeyManagementClient
 }
 
+// kmsClient is the subset of the Cloud KMS client used by keys
+type kmsClient interface {
+	AsymmetricSign(context.Context, *kmspb.AsymmetricSignRequest, ...gax.CallOption) (*kmspb.AsymmetricSignResponse, error)
+	GetCryptoKeyVersion(context.Context, *kmspb.GetCryptoKeyVersionRequest, ...gax.CallOption) (*kmspb.CryptoKeyVersion, error)
+}
+
+// versionIterator is implemented by *kms.CryptoKeyVersionIterator
+type versionIterator interface {
+	Next() (*kmspb.CryptoKeyVersion, error)
+}
+
 type gcloudKey struct {
 	kconf *config.KeyConfig
-	cli   *kms.KeyManagementClient
+	cli   kmsClient
 	pub   crypto.PublicKey
 	hash  crypto.Hash
 	pss   bool
+	name  string
 }
 
 func init() {
 	token.Openers[tokenType] = open
+	// original name
+	token.Openers["gcloud"] = open
 }
 
 func open(conf *config.Config, tokenName string, pinProvider passprompt.PasswordGetter) (token.Token, error) {
@@ -47,14 +81,36 @@ func open(conf *config.Config, tokenName string, pinProvider passprompt.Password
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
 	defer cancel()
+	// Without a credentials file, application default credentials are used,
+	// which includes GKE workload identity and the metadata server. A workload
+	// identity federation config can also be given as the credentials file.
 	var opts []option.ClientOption
 	if tconf.Pin != nil {
 		opts = append(opts, option.WithCredentialsFile(*tconf.Pin))
 	}
+	if tconf.Role != "" {
+		// the token source outlives open(), so don't give it the timeout
+		ts, err := impersonate.CredentialsTokenSource(context.Background(), impersonate.CredentialsConfig{
+			TargetPrincipal: tconf.Role,
+			Scopes:          kms.DefaultAuthScopes(),
+		}, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("impersonating %s: %w", tconf.Role, err)
+		}
+		opts = []option.ClientOption{option.WithTokenSource(ts)}
+	}
+	if tconf.Endpoint != "" {
+		opts = append(opts, option.WithEndpoint(tconf.Endpoint))
+	}
 	cli, err := kms.NewKeyManagementClient(ctx, opts...)
 	if err != nil {
 		return nil, err
 	}
+	retry := gax.WithRetry(func() gax.Retryer {
+		return gax.OnCodes(retryCodes, retryBackoff)
+	})
+	cli.CallOptions.GetPublicKey = append(cli.CallOptions.GetPublicKey, retry)
+	cli.CallOptions.AsymmetricSign = append(cli.CallOptions.AsymmetricSign, retry)
 	return &gcloudToken{
 		config: conf,
 		tconf:  tconf,
@@ -81,9 +137,20 @@ func (t *gcloudToken) GetKey(ctx context.Context, keyName string) (token.Key, er
 		return nil, err
 	}
 	if keyConf.ID == "" {
-		return nil, fmt.Errorf("key %q must have \"id\" set to the fully-quaified resource name of a Cloud KMS key version", keyName)
+		return nil, fmt.Errorf("key %q must have \"id\" set to the fully-qualified resource name of a Cloud KMS key or key version", keyName)
+	}
+	name := keyConf.ID
+	if !strings.Contains(name, "/cryptoKeyVersions/") {
+		it := t.cli.ListCryptoKeyVersions(ctx, &kmspb.ListCryptoKeyVersionsRequest{
+			Parent: name,
+			Filter: "state=ENABLED",
+		})
+		name, err = latestVersion(it, name)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", keyName, err)
+		}
 	}
-	resp, err := t.cli.GetPublicKey(ctx, &kmspb.GetPublicKeyRequest{Name: keyConf.ID})
+	resp, err := t.cli.GetPublicKey(ctx, &kmspb.GetPublicKeyRequest{Name: name})
 	if err != nil {
 		return nil, err
 	}
@@ -107,9 +174,33 @@ func (t *gcloudToken) GetKey(ctx context.Context, keyName string) (token.Key, er
 		pub:   pub,
 		hash:  hashFunc,
 		pss:   pss,
+		name:  name,
 	}, nil
 }
 
+// Asymmetric keys have no primary version, so pick the newest enabled one.
+// Software and Cloud HSM protection levels are treated the same.
+func latestVersion(it versionIterator, keyName string) (string, error) {
+	var latest string
+	var latestNum int
+	for {
+		ver, err := it.Next()
+		if err == iterator.Done {
+			break
+		} else if err != nil {
+			return "", err
+		}
+		num, _ := strconv.Atoi(ver.Name[strings.LastIndex(ver.Name, "/")+1:])
+		if latest == "" || num > latestNum {
+			latest, latestNum = ver.Name, num
+		}
+	}
+	if latest == "" {
+		return "", fmt.Errorf("no enabled versions of %s", keyName)
+	}
+	return latest, nil
+}
+
 func (t *gcloudToken) Import(keyName string, privKey crypto.PrivateKey) (token.Key, error) {
 	return nil, token.NotImplementedError{Op: "import-key", Type: tokenType}
 }
@@ -141,7 +232,7 @@ func (k *gcloudKey) SignContext(ctx context.Context, digest []byte, opts crypto.
 			Err: fmt.Errorf("tried to use digest %s but key requires digest %s", opts.HashFunc(), k.hash),
 		}
 	}
-	if _, ok := opts.(*rsa.PSSOptions); ok && !k.pss {
+	if pss, ok := opts.(*rsa.PSSOptions); ok && !k.pss {
 		return nil, token.KeyUsageError{
 			Key: k.kconf.Name(),
 			Err: errors.New("tried to use RSA-PSS signature but key uses PKCS#1"),
@@ -151,9 +242,14 @@ func (k *gcloudKey) SignContext(ctx context.Context, digest []byte, opts crypto.
 			Key: k.kconf.Name(),
 			Err: errors.New("tried to use PKCS#1 signature but key uses RSA-PSS"),
 		}
+	} else if ok && pss.SaltLength != rsa.PSSSaltLengthEqualsHash && pss.SaltLength != rsa.PSSSaltLengthAuto && pss.SaltLength != k.hash.Size() {
+		return nil, token.KeyUsageError{
+			Key: k.kconf.Name(),
+			Err: errors.New("Cloud KMS only supports PSS with a salt length equal to the digest length"),
+		}
 	}
 	req := &kmspb.AsymmetricSignRequest{
-		Name:   k.kconf.ID,
+		Name:   k.name,
 		Digest: &kmspb.Digest{},
 	}
 	switch k.hash {
@@ -176,6 +272,43 @@ func (k *gcloudKey) SignContext(ctx context.Context, digest []byte, opts crypto.
 	return resp.Signature, nil
 }
 
+// Attest returns the Cloud HSM attestation for the key version, along with the
+// adapter certificate chains published by Google
+func (k *gcloudKey) Attest(ctx context.Context) ([]byte, error) {
+	ver, err := k.cli.GetCryptoKeyVersion(ctx, &kmspb.GetCryptoKeyVersionRequest{Name: k.name})
+	if err != nil {
+		return nil, err
+	}
+	att := ver.Attestation
+	if att == nil || len(att.Content) == 0 {
+		return nil, token.KeyUsageError{
+			Key: k.kconf.Name(),
+			Err: fmt.Errorf("no attestation available for protection level %s, only HSM keys are attested", ver.ProtectionLevel),
+		}
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(att.Content))
+	if err != nil {
+		return nil, fmt.Errorf("decompressing attestation: %w", err)
+	}
+	record, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("decompressing attestation: %w", err)
+	}
+	var certs []*x509.Certificate
+	if chains := att.CertChains; chains != nil {
+		for _, chain := range [][]string{chains.CaviumCerts, chains.GoogleCardCerts, chains.GooglePartitionCerts} {
+			for _, certPEM := range chain {
+				parsed, err := certloader.ParseX509Certificates([]byte(certPEM))
+				if err != nil {
+					return nil, fmt.Errorf("parsing attestation certificate chain: %w", err)
+				}
+				certs = append(certs, parsed...)
+			}
+		}
+	}
+	return attestation.MarshalHSM([][]byte{record}, certs), nil
+}
+
 func (k *gcloudKey) Config() *config.KeyConfig {
 	return k.kconf
 }
@@ -0,0 +1,102 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package gcloudtoken
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/googleapis/gax-go/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/iterator"
+	kmspb "google.golang.org/genproto/googleapis/cloud/kms/v1"
+
+	"github.com/sassoftware/relic/v7/config"
+	"github.com/sassoftware/relic/v7/token"
+)
+
+const testKeyName = "projects/p/locations/global/keyRings/r/cryptoKeys/k"
+
+type fakeVersions []string
+
+func (f *fakeVersions) Next() (*kmspb.CryptoKeyVersion, error) {
+	if len(*f) == 0 {
+		return nil, iterator.Done
+	}
+	name := (*f)[0]
+	*f = (*f)[1:]
+	return &kmspb.CryptoKeyVersion{Name: testKeyName + "/cryptoKeyVersions/" + name}, nil
+}
+
+// fakeClient records sign requests and returns a fixed signature
+type fakeClient struct {
+	requests []*kmspb.AsymmetricSignRequest
+}
+
+func (f *fakeClient) AsymmetricSign(ctx context.Context, req *kmspb.AsymmetricSignRequest, opts ...gax.CallOption) (*kmspb.AsymmetricSignResponse, error) {
+	f.requests = append(f.requests, req)
+	return &kmspb.AsymmetricSignResponse{Signature: []byte("signature")}, nil
+}
+
+func (f *fakeClient) GetCryptoKeyVersion(ctx context.Context, req *kmspb.GetCryptoKeyVersionRequest, opts ...gax.CallOption) (*kmspb.CryptoKeyVersion, error) {
+	return &kmspb.CryptoKeyVersion{Name: req.Name}, nil
+}
+
+func TestLatestVersion(t *testing.T) {
+	// versions are compared numerically, not in listing order
+	it := &fakeVersions{"2", "10", "9"}
+	name, err := latestVersion(it, testKeyName)
+	require.NoError(t, err)
+	assert.Equal(t, testKeyName+"/cryptoKeyVersions/10", name)
+
+	_, err = latestVersion(&fakeVersions{}, testKeyName)
+	assert.ErrorContains(t, err, "no enabled versions")
+}
+
+func TestPSSSaltLength(t *testing.T) {
+	cli := new(fakeClient)
+	key := &gcloudKey{
+		kconf: new(config.Config).NewKey("kms"),
+		cli:   cli,
+		hash:  crypto.SHA256,
+		pss:   true,
+		name:  testKeyName + "/cryptoKeyVersions/1",
+	}
+	digest := sha256.Sum256([]byte("payload"))
+	for _, saltLength := range []int{rsa.PSSSaltLengthEqualsHash, rsa.PSSSaltLengthAuto, sha256.Size} {
+		opts := &rsa.PSSOptions{SaltLength: saltLength, Hash: crypto.SHA256}
+		sig, err := key.SignContext(context.Background(), digest[:], opts)
+		require.NoError(t, err, "salt length %d", saltLength)
+		assert.Equal(t, []byte("signature"), sig)
+	}
+	require.Len(t, cli.requests, 3)
+	assert.Equal(t, digest[:], cli.requests[0].Digest.GetSha256())
+
+	opts := &rsa.PSSOptions{SaltLength: 20, Hash: crypto.SHA256}
+	_, err := key.SignContext(context.Background(), digest[:], opts)
+	var usageErr token.KeyUsageError
+	require.ErrorAs(t, err, &usageErr)
+	assert.ErrorContains(t, err, "salt length equal to the digest length")
+	// PKCS#1 is refused for a PSS key
+	_, err = key.SignContext(context.Background(), digest[:], crypto.SHA256)
+	require.ErrorAs(t, err, &usageErr)
+	assert.Len(t, cli.requests, 3)
+}
@@ -0,0 +1,72 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package token
+
+import (
+	"context"
+	"time"
+)
+
+// Health describes the state of a token in more detail than Ping, so that
+// operators can tell a failing device apart from application errors. Fields a
+// token can't report are left empty.
+type Health struct {
+	// Whether the token responded to the check
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+	// Time taken by the check
+	Latency time.Duration `json:"latency"`
+	// Description of the slot or device holding the keys
+	Slot string `json:"slot,omitempty"`
+	// Signing sessions currently open, and the most the token will open
+	Sessions    int `json:"sessions,omitempty"`
+	MaxSessions int `json:"max_sessions,omitempty"`
+	// Login attempts left before the PIN is locked, if known
+	PINRetries *int `json:"pin_retries,omitempty"`
+	// Conditions that don't yet prevent signing, e.g. a PIN close to locking
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// TokenHealth is implemented by tokens that can report details about the
+// device or service behind them. Implementations should check connectivity
+// the same way Ping does.
+type TokenHealth interface {
+	Health(ctx context.Context) (*Health, error)
+}
+
+// CheckHealth checks a token and reports its health. Tokens that don't
+// implement TokenHealth are checked with Ping, so every token reports at
+// least whether it responded and how long it took.
+func CheckHealth(ctx context.Context, tok Token) *Health {
+	start := time.Now()
+	var h *Health
+	var err error
+	if th, ok := tok.(TokenHealth); ok {
+		h, err = th.Health(ctx)
+	} else {
+		err = tok.Ping(ctx)
+	}
+	if h == nil {
+		h = new(Health)
+	}
+	h.Latency = time.Since(start)
+	h.OK = err == nil
+	if err != nil {
+		h.Error = err.Error()
+	}
+	return h
+}
@@ -0,0 +1,25 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package keychaintoken provides a token backed by identities in the macOS
+// Keychain. Private keys are used in place through the Security framework, so
+// keys that can't be exported, including those held by a smart card, can be
+// used for signing.
+//
+// Keys are selected by the SHA-1 thumbprint of their certificate in the id
+// field, or by subject common name in the label field. The user's default
+// keychain search list is used.
+package keychaintoken
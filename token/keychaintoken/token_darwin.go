@@ -0,0 +1,379 @@
+//go:build darwin && cgo && !pure && !clientonly
+// +build darwin,cgo,!pure,!clientonly
+
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package keychaintoken
+
+/*
+#cgo LDFLAGS: -framework CoreFoundation -framework Security
+#include <stdlib.h>
+#include <CoreFoundation/CoreFoundation.h>
+#include <Security/Security.h>
+
+enum {
+	algRSAPKCS1 = 0,
+	algRSAPSS = 1,
+	algECDSA = 2,
+};
+
+static CFArrayRef copyIdentities(OSStatus *status) {
+	const void *keys[] = {kSecClass, kSecMatchLimit, kSecReturnRef};
+	const void *values[] = {kSecClassIdentity, kSecMatchLimitAll, kCFBooleanTrue};
+	CFDictionaryRef query = CFDictionaryCreate(NULL, keys, values, 3,
+		&kCFTypeDictionaryKeyCallBacks, &kCFTypeDictionaryValueCallBacks);
+	CFTypeRef result = NULL;
+	*status = SecItemCopyMatching(query, &result);
+	CFRelease(query);
+	return (CFArrayRef)result;
+}
+
+static SecIdentityRef identityAt(CFArrayRef identities, CFIndex i) {
+	return (SecIdentityRef)CFArrayGetValueAtIndex(identities, i);
+}
+
+static CFDataRef copyCertificateData(SecIdentityRef identity, OSStatus *status) {
+	SecCertificateRef cert = NULL;
+	*status = SecIdentityCopyCertificate(identity, &cert);
+	if (*status != errSecSuccess) {
+		return NULL;
+	}
+	CFDataRef data = SecCertificateCopyData(cert);
+	CFRelease(cert);
+	return data;
+}
+
+static SecKeyRef copyPrivateKey(SecIdentityRef identity, OSStatus *status) {
+	SecKeyRef key = NULL;
+	*status = SecIdentityCopyPrivateKey(identity, &key);
+	return key;
+}
+
+static SecKeyAlgorithm algorithmFor(int kind, int hashBits) {
+	switch (kind) {
+	case algRSAPKCS1:
+		switch (hashBits) {
+		case 160: return kSecKeyAlgorithmRSASignatureDigestPKCS1v15SHA1;
+		case 256: return kSecKeyAlgorithmRSASignatureDigestPKCS1v15SHA256;
+		case 384: return kSecKeyAlgorithmRSASignatureDigestPKCS1v15SHA384;
+		case 512: return kSecKeyAlgorithmRSASignatureDigestPKCS1v15SHA512;
+		}
+		break;
+	case algRSAPSS:
+		switch (hashBits) {
+		case 256: return kSecKeyAlgorithmRSASignatureDigestPSSSHA256;
+		case 384: return kSecKeyAlgorithmRSASignatureDigestPSSSHA384;
+		case 512: return kSecKeyAlgorithmRSASignatureDigestPSSSHA512;
+		}
+		break;
+	case algECDSA:
+		switch (hashBits) {
+		case 160: return kSecKeyAlgorithmECDSASignatureDigestX962SHA1;
+		case 256: return kSecKeyAlgorithmECDSASignatureDigestX962SHA256;
+		case 384: return kSecKeyAlgorithmECDSASignatureDigestX962SHA384;
+		case 512: return kSecKeyAlgorithmECDSASignatureDigestX962SHA512;
+		}
+		break;
+	}
+	return NULL;
+}
+
+// Returns the signature, or NULL and sets *errmsg which the caller must free
+static CFDataRef signDigest(SecKeyRef key, int kind, int hashBits, const UInt8 *digest, CFIndex digestLen, char **errmsg) {
+	*errmsg = NULL;
+	SecKeyAlgorithm alg = algorithmFor(kind, hashBits);
+	if (alg == NULL || !SecKeyIsAlgorithmSupported(key, kSecKeyOperationTypeSign, alg)) {
+		*errmsg = strdup("signature algorithm not supported by key");
+		return NULL;
+	}
+	CFDataRef data = CFDataCreate(NULL, digest, digestLen);
+	CFErrorRef err = NULL;
+	CFDataRef sig = SecKeyCreateSignature(key, alg, data, &err);
+	CFRelease(data);
+	if (sig == NULL) {
+		char buf[512] = "unknown error";
+		if (err != NULL) {
+			CFStringRef desc = CFErrorCopyDescription(err);
+			CFStringGetCString(desc, buf, sizeof(buf), kCFStringEncodingUTF8);
+			CFRelease(desc);
+			CFRelease(err);
+		}
+		*errmsg = strdup(buf);
+	}
+	return sig;
+}
+*/
+import "C"
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"github.com/sassoftware/relic/v7/config"
+	"github.com/sassoftware/relic/v7/lib/passprompt"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+	"github.com/sassoftware/relic/v7/token"
+)
+
+const tokenType = "keychain"
+
+type keychainToken struct {
+	config *config.Config
+	tconf  *config.TokenConfig
+
+	mu   sync.Mutex
+	keys []*keychainKey
+}
+
+type keychainKey struct {
+	kconf *config.KeyConfig
+	cert  *x509.Certificate
+	ref   C.SecKeyRef
+}
+
+func init() {
+	token.Openers[tokenType] = open
+}
+
+func open(conf *config.Config, tokenName string, pinProvider passprompt.PasswordGetter) (token.Token, error) {
+	tconf, err := conf.GetToken(tokenName)
+	if err != nil {
+		return nil, err
+	}
+	return &keychainToken{
+		config: conf,
+		tconf:  tconf,
+	}, nil
+}
+
+func (t *keychainToken) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, key := range t.keys {
+		C.CFRelease(C.CFTypeRef(key.ref))
+	}
+	t.keys = nil
+	return nil
+}
+
+func (t *keychainToken) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (t *keychainToken) Config() *config.TokenConfig {
+	return t.tconf
+}
+
+func (t *keychainToken) GetKey(ctx context.Context, keyName string) (token.Key, error) {
+	keyConf, err := t.config.GetKey(keyName)
+	if err != nil {
+		return nil, err
+	}
+	if keyConf.ID == "" && keyConf.Label == "" {
+		return nil, fmt.Errorf("key %q must have \"id\" set to a certificate thumbprint or \"label\" set to a subject name", keyName)
+	}
+	thumbprint, err := parseThumbprint(keyConf.ID)
+	if err != nil {
+		return nil, fmt.Errorf("key %q: %w", keyName, err)
+	}
+	var key *keychainKey
+	err = enumerate(func(identity C.SecIdentityRef, cert *x509.Certificate) (bool, error) {
+		if !matches(cert, thumbprint, keyConf.Label) {
+			return true, nil
+		}
+		var status C.OSStatus
+		ref := C.copyPrivateKey(identity, &status)
+		if status != C.errSecSuccess {
+			return false, fmt.Errorf("key %q: copying private key: OSStatus %d", keyName, status)
+		}
+		key = &keychainKey{kconf: keyConf, cert: cert, ref: ref}
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	} else if key == nil {
+		return nil, fmt.Errorf("key %q: identity not found in keychain", keyName)
+	}
+	t.mu.Lock()
+	t.keys = append(t.keys, key)
+	t.mu.Unlock()
+	return key, nil
+}
+
+// Call fn for each identity in the keychain until it returns false
+func enumerate(fn func(C.SecIdentityRef, *x509.Certificate) (bool, error)) error {
+	var status C.OSStatus
+	identities := C.copyIdentities(&status)
+	if status == C.errSecItemNotFound {
+		return nil
+	} else if status != C.errSecSuccess {
+		return fmt.Errorf("listing keychain identities: OSStatus %d", status)
+	}
+	defer C.CFRelease(C.CFTypeRef(identities))
+	count := C.CFArrayGetCount(identities)
+	for i := C.CFIndex(0); i < count; i++ {
+		identity := C.identityAt(identities, i)
+		data := C.copyCertificateData(identity, &status)
+		if status != C.errSecSuccess {
+			continue
+		}
+		der := C.GoBytes(unsafe.Pointer(C.CFDataGetBytePtr(data)), C.int(C.CFDataGetLength(data)))
+		C.CFRelease(C.CFTypeRef(data))
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			continue
+		}
+		if more, err := fn(identity, cert); err != nil || !more {
+			return err
+		}
+	}
+	return nil
+}
+
+func matches(cert *x509.Certificate, thumbprint []byte, label string) bool {
+	if thumbprint != nil {
+		digest := sha1.Sum(cert.Raw)
+		if !bytes.Equal(digest[:], thumbprint) {
+			return false
+		}
+	}
+	return label == "" || cert.Subject.CommonName == label
+}
+
+func parseThumbprint(id string) ([]byte, error) {
+	if id == "" {
+		return nil, nil
+	}
+	id = strings.NewReplacer(" ", "", ":", "").Replace(id)
+	thumbprint, err := hex.DecodeString(id)
+	if err != nil || len(thumbprint) != sha1.Size {
+		return nil, errors.New("id must be a SHA-1 certificate thumbprint in hex")
+	}
+	return thumbprint, nil
+}
+
+func (t *keychainToken) Import(keyName string, privKey crypto.PrivateKey) (token.Key, error) {
+	return nil, token.NotImplementedError{Op: "import-key", Type: tokenType}
+}
+
+func (t *keychainToken) ImportCertificate(cert *x509.Certificate, labelBase string) error {
+	return token.NotImplementedError{Op: "import-certificate", Type: tokenType}
+}
+
+func (t *keychainToken) Generate(keyName string, keyType token.KeyType, bits uint) (token.Key, error) {
+	return nil, token.NotImplementedError{Op: "generate-key", Type: tokenType}
+}
+
+func (t *keychainToken) ListKeys(opts token.ListOptions) error {
+	thumbprint, err := parseThumbprint(opts.ID)
+	if err != nil {
+		return err
+	}
+	return enumerate(func(identity C.SecIdentityRef, cert *x509.Certificate) (bool, error) {
+		if !matches(cert, thumbprint, opts.Label) {
+			return true, nil
+		}
+		fmt.Fprintf(opts.Output, "id:      %x\n", sha1.Sum(cert.Raw))
+		fmt.Fprintf(opts.Output, "label:   %s\n", cert.Subject.CommonName)
+		fmt.Fprintf(opts.Output, "subject: %s\n", x509tools.FormatSubject(cert))
+		fmt.Fprintf(opts.Output, "expires: %s\n", cert.NotAfter)
+		if opts.Values {
+			pem.Encode(opts.Output, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+		}
+		fmt.Fprintln(opts.Output)
+		return true, nil
+	})
+}
+
+func (k *keychainKey) Public() crypto.PublicKey {
+	return k.cert.PublicKey
+}
+
+func (k *keychainKey) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) (signature []byte, err error) {
+	return k.SignContext(context.Background(), digest, opts)
+}
+
+func (k *keychainKey) SignContext(ctx context.Context, digest []byte, opts crypto.SignerOpts) (signature []byte, err error) {
+	var kind C.int
+	switch k.cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		kind = C.algRSAPKCS1
+		if pss, ok := opts.(*rsa.PSSOptions); ok {
+			// the Security framework always uses a salt as long as the digest
+			if pss.SaltLength != rsa.PSSSaltLengthEqualsHash && pss.SaltLength != opts.HashFunc().Size() {
+				return nil, token.KeyUsageError{
+					Key: k.kconf.Name(),
+					Err: errors.New("PSS salt length must equal the digest length"),
+				}
+			}
+			kind = C.algRSAPSS
+		}
+	case *ecdsa.PublicKey:
+		kind = C.algECDSA
+	default:
+		return nil, token.KeyUsageError{
+			Key: k.kconf.Name(),
+			Err: fmt.Errorf("unsupported public key type %T", k.cert.PublicKey),
+		}
+	}
+	if len(digest) == 0 || len(digest) != opts.HashFunc().Size() {
+		return nil, token.KeyUsageError{
+			Key: k.kconf.Name(),
+			Err: fmt.Errorf("unsupported digest algorithm %s", opts.HashFunc()),
+		}
+	}
+	var errmsg *C.char
+	sig := C.signDigest(k.ref, kind, C.int(opts.HashFunc().Size()*8),
+		(*C.UInt8)(unsafe.Pointer(&digest[0])), C.CFIndex(len(digest)), &errmsg)
+	if errmsg != nil {
+		defer C.free(unsafe.Pointer(errmsg))
+		return nil, token.KeyUsageError{Key: k.kconf.Name(), Err: errors.New(C.GoString(errmsg))}
+	}
+	defer C.CFRelease(C.CFTypeRef(sig))
+	// ECDSA signatures are already in ASN.1 form
+	return C.GoBytes(unsafe.Pointer(C.CFDataGetBytePtr(sig)), C.int(C.CFDataGetLength(sig))), nil
+}
+
+func (k *keychainKey) Config() *config.KeyConfig {
+	return k.kconf
+}
+
+func (k *keychainKey) Certificate() []byte {
+	return k.cert.Raw
+}
+
+func (k *keychainKey) GetID() []byte {
+	digest := sha1.Sum(k.cert.Raw)
+	return digest[:]
+}
+
+func (k *keychainKey) ImportCertificate(cert *x509.Certificate) error {
+	return token.NotImplementedError{Op: "import-certificate", Type: tokenType}
+}
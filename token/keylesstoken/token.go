@@ -0,0 +1,154 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package keylesstoken implements keyless signing: each key is an ephemeral
+// ECDSA key that only exists in memory, and the key's issuer (normally
+// Fulcio) certifies it for the CI job's OIDC identity at signing time. The
+// private key is never stored, so the certificate and a transparency log
+// entry are the only record of it.
+package keylesstoken
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+	"sync"
+
+	"github.com/sassoftware/relic/v7/config"
+	"github.com/sassoftware/relic/v7/lib/passprompt"
+	"github.com/sassoftware/relic/v7/token"
+)
+
+const tokenType = "keyless"
+
+func init() {
+	token.Openers[tokenType] = open
+}
+
+type keylessToken struct {
+	config *config.Config
+	tconf  *config.TokenConfig
+
+	mu   sync.Mutex
+	keys map[string]*ecdsa.PrivateKey
+}
+
+type keylessKey struct {
+	*ecdsa.PrivateKey
+	kconf *config.KeyConfig
+}
+
+func open(conf *config.Config, tokenName string, pinProvider passprompt.PasswordGetter) (token.Token, error) {
+	tconf, err := conf.GetToken(tokenName)
+	if err != nil {
+		return nil, err
+	}
+	return &keylessToken{
+		config: conf,
+		tconf:  tconf,
+		keys:   make(map[string]*ecdsa.PrivateKey),
+	}, nil
+}
+
+func (t *keylessToken) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.keys = make(map[string]*ecdsa.PrivateKey)
+	return nil
+}
+
+func (t *keylessToken) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (t *keylessToken) Config() *config.TokenConfig {
+	return t.tconf
+}
+
+// GetKey returns the ephemeral key for keyName, generating it on first use.
+// The key lasts as long as the token is open.
+func (t *keylessToken) GetKey(ctx context.Context, keyName string) (token.Key, error) {
+	keyConf, err := t.config.GetKey(keyName)
+	if err != nil {
+		return nil, err
+	}
+	if keyConf.Issuer == nil {
+		return nil, fmt.Errorf("key %q: keyless keys need an issuer to certify them, such as fulcio", keyName)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	priv := t.keys[keyName]
+	if priv == nil {
+		priv, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		t.keys[keyName] = priv
+	}
+	return &keylessKey{PrivateKey: priv, kconf: keyConf}, nil
+}
+
+func (t *keylessToken) Import(keyName string, privKey crypto.PrivateKey) (token.Key, error) {
+	return nil, token.NotImplementedError{Op: "import-key", Type: tokenType}
+}
+
+func (t *keylessToken) ImportCertificate(cert *x509.Certificate, labelBase string) error {
+	return token.NotImplementedError{Op: "import-certificate", Type: tokenType}
+}
+
+func (t *keylessToken) Generate(keyName string, keyType token.KeyType, bits uint) (token.Key, error) {
+	return nil, token.NotImplementedError{Op: "generate-key", Type: tokenType}
+}
+
+func (t *keylessToken) ListKeys(opts token.ListOptions) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for name := range t.keys {
+		fmt.Fprintf(opts.Output, "key: %s (ephemeral)\n", name)
+	}
+	return nil
+}
+
+func (k *keylessKey) SignContext(ctx context.Context, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return k.PrivateKey.Sign(rand.Reader, digest, opts)
+}
+
+func (k *keylessKey) Config() *config.KeyConfig {
+	return k.kconf
+}
+
+func (k *keylessKey) Certificate() []byte {
+	return nil
+}
+
+// GetID returns a digest of the public key
+func (k *keylessKey) GetID() []byte {
+	spki, err := x509.MarshalPKIXPublicKey(k.Public())
+	if err != nil {
+		return nil
+	}
+	d := sha256.Sum256(spki)
+	return d[:]
+}
+
+func (k *keylessKey) ImportCertificate(cert *x509.Certificate) error {
+	return token.NotImplementedError{Op: "import-certificate", Type: tokenType}
+}
@@ -0,0 +1,323 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package kmiptoken implements a token backed by a key manager that speaks
+// KMIP, such as Fortanix DSM, Thales CipherTrust or IBM GKLM
+package kmiptoken
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/sassoftware/relic/v7/config"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/kmip"
+	"github.com/sassoftware/relic/v7/lib/passprompt"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+	"github.com/sassoftware/relic/v7/token"
+)
+
+const (
+	tokenType   = "kmip"
+	defaultPort = "5696"
+)
+
+type kmipToken struct {
+	config *config.Config
+	tconf  *config.TokenConfig
+	cli    *kmip.Client
+}
+
+type kmipKey struct {
+	kconf *config.KeyConfig
+	cli   *kmip.Client
+	id    string
+	pub   crypto.PublicKey
+}
+
+func init() {
+	token.Openers[tokenType] = open
+}
+
+func open(conf *config.Config, tokenName string, pinProvider passprompt.PasswordGetter) (token.Token, error) {
+	tconf, err := conf.GetToken(tokenName)
+	if err != nil {
+		return nil, err
+	}
+	if tconf.Endpoint == "" {
+		return nil, fmt.Errorf("token %q must have \"endpoint\" set to the host:port of the key manager", tokenName)
+	}
+	addr := tconf.Endpoint
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, defaultPort)
+	}
+	tlsconf := &tls.Config{MinVersion: tls.VersionTLS12}
+	if err := x509tools.LoadCertPool(tconf.CaCert, tlsconf); err != nil {
+		return nil, err
+	}
+	if tconf.CertFile != "" {
+		cert, err := certloader.LoadX509KeyPair(tconf.CertFile, tconf.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsconf.Certificates = []tls.Certificate{cert.TLS()}
+	}
+	x509tools.SetKeyLogFile(tlsconf)
+	cli := &kmip.Client{Address: addr, TLSConfig: tlsconf}
+	if tconf.KMIPVersion != "" {
+		major, minor, err := parseVersion(tconf.KMIPVersion)
+		if err != nil {
+			return nil, fmt.Errorf("token %q: %w", tokenName, err)
+		}
+		cli.Major, cli.Minor = major, minor
+	}
+	return &kmipToken{
+		config: conf,
+		tconf:  tconf,
+		cli:    cli,
+	}, nil
+}
+
+func parseVersion(v string) (major, minor int32, err error) {
+	majorStr, minorStr, _ := strings.Cut(v, ".")
+	maj, err1 := strconv.ParseInt(majorStr, 10, 32)
+	min, err2 := strconv.ParseInt(minorStr, 10, 32)
+	if err1 != nil || err2 != nil || maj < 1 || maj > 2 || (maj == 1 && min < 2) {
+		return 0, 0, fmt.Errorf("unsupported KMIP version %q, expected 1.2 through 2.x", v)
+	}
+	return int32(maj), int32(min), nil
+}
+
+func (t *kmipToken) Close() error {
+	return t.cli.Close()
+}
+
+func (t *kmipToken) Ping(ctx context.Context) error {
+	return t.cli.Query(ctx)
+}
+
+func (t *kmipToken) Config() *config.TokenConfig {
+	return t.tconf
+}
+
+func (t *kmipToken) GetKey(ctx context.Context, keyName string) (token.Key, error) {
+	keyConf, err := t.config.GetKey(keyName)
+	if err != nil {
+		return nil, err
+	}
+	privID, pubID := keyConf.ID, ""
+	switch {
+	case privID != "":
+		pubID, err = t.cli.PublicKeyLink(ctx, privID)
+	case keyConf.Label != "":
+		// locate and fetch links in a single round trip
+		privID, pubID, err = t.cli.FindPrivateKey(ctx, keyConf.Label)
+	default:
+		return nil, fmt.Errorf("key %q must have \"id\" or \"label\" set", keyName)
+	}
+	if errors.Is(err, kmip.ErrNotFound) {
+		return nil, fmt.Errorf("key %q: private key %q not found", keyName, keyConf.Label)
+	} else if err != nil {
+		return nil, fmt.Errorf("key %q: %w", keyName, err)
+	}
+	var pub crypto.PublicKey
+	if pubID != "" {
+		pub, err = t.cli.GetPublicKey(ctx, pubID)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", keyName, err)
+		}
+	} else if keyConf.X509Certificate != "" {
+		// some servers don't link the halves of a key pair, so fall back to
+		// the configured certificate
+		pub, err = publicFromFile(keyConf.X509Certificate)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", keyName, err)
+		}
+	} else {
+		return nil, fmt.Errorf("key %q: private key %s has no linked public key, set \"x509certificate\" to provide it", keyName, privID)
+	}
+	return &kmipKey{
+		kconf: keyConf,
+		cli:   t.cli,
+		id:    privID,
+		pub:   pub,
+	}, nil
+}
+
+func publicFromFile(path string) (crypto.PublicKey, error) {
+	blob, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	certs, err := certloader.ParseX509Certificates(blob)
+	if err != nil {
+		return nil, err
+	}
+	return certs[0].PublicKey, nil
+}
+
+func (t *kmipToken) Import(keyName string, privKey crypto.PrivateKey) (token.Key, error) {
+	return nil, token.NotImplementedError{Op: "import-key", Type: tokenType}
+}
+
+func (t *kmipToken) ImportCertificate(cert *x509.Certificate, labelBase string) error {
+	return token.NotImplementedError{Op: "import-certificate", Type: tokenType}
+}
+
+func (t *kmipToken) Generate(keyName string, keyType token.KeyType, bits uint) (token.Key, error) {
+	return nil, token.NotImplementedError{Op: "generate-key", Type: tokenType}
+}
+
+func (t *kmipToken) ListKeys(opts token.ListOptions) error {
+	ctx := context.Background()
+	var ids []string
+	if opts.ID != "" {
+		ids = []string{opts.ID}
+	} else {
+		results, err := t.cli.Do(ctx, t.cli.LocateOp(opts.Label, kmip.ObjectPrivateKey))
+		if err != nil {
+			return err
+		}
+		ids = kmip.Located(results[0])
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	// fetch attributes for all keys in one request
+	ops := make([]kmip.Operation, len(ids))
+	for i, id := range ids {
+		ops[i] = kmip.AttributesOp(id)
+	}
+	results, err := t.cli.Do(ctx, ops...)
+	if err != nil {
+		return err
+	}
+	for i, id := range ids {
+		fmt.Fprintf(opts.Output, "id:      %s\n", id)
+		for _, name := range kmip.ObjectNames(results[i]) {
+			fmt.Fprintf(opts.Output, "label:   %s\n", name)
+		}
+		pubID := kmip.LinkedPublicKey(results[i])
+		if pubID != "" {
+			fmt.Fprintf(opts.Output, "public:  %s\n", pubID)
+		}
+		if opts.Values && pubID != "" {
+			pub, err := t.cli.GetPublicKey(ctx, pubID)
+			if err != nil {
+				return err
+			}
+			der, err := x509.MarshalPKIXPublicKey(pub)
+			if err != nil {
+				return err
+			}
+			_ = pem.Encode(opts.Output, &pem.Block{Type: "PUBLIC KEY", Bytes: der})
+		}
+		fmt.Fprintln(opts.Output)
+	}
+	return nil
+}
+
+func (k *kmipKey) Public() crypto.PublicKey {
+	return k.pub
+}
+
+func (k *kmipKey) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) (signature []byte, err error) {
+	return k.SignContext(context.Background(), digest, opts)
+}
+
+func (k *kmipKey) SignContext(ctx context.Context, digest []byte, opts crypto.SignerOpts) (signature []byte, err error) {
+	var params kmip.SignParameters
+	switch opts.HashFunc() {
+	case crypto.SHA1:
+		params.Hash = kmip.HashSHA1
+	case crypto.SHA224:
+		params.Hash = kmip.HashSHA224
+	case crypto.SHA256:
+		params.Hash = kmip.HashSHA256
+	case crypto.SHA384:
+		params.Hash = kmip.HashSHA384
+	case crypto.SHA512:
+		params.Hash = kmip.HashSHA512
+	default:
+		return nil, token.KeyUsageError{
+			Key: k.kconf.Name(),
+			Err: fmt.Errorf("unsupported digest algorithm %s", opts.HashFunc()),
+		}
+	}
+	switch pub := k.pub.(type) {
+	case *rsa.PublicKey:
+		params.Algorithm = kmip.AlgorithmRSA
+		params.Padding = kmip.PaddingPKCS1v15
+		if pss, ok := opts.(*rsa.PSSOptions); ok {
+			params.Padding = kmip.PaddingPSS
+			switch pss.SaltLength {
+			case rsa.PSSSaltLengthAuto, rsa.PSSSaltLengthEqualsHash:
+				params.SaltLength = int32(opts.HashFunc().Size())
+			default:
+				params.SaltLength = int32(pss.SaltLength)
+			}
+		}
+		return k.cli.Sign(ctx, k.id, params, digest)
+	case *ecdsa.PublicKey:
+		params.Algorithm = kmip.AlgorithmECDSA
+		sig, err := k.cli.Sign(ctx, k.id, params, digest)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := x509tools.UnmarshalEcdsaSignature(sig); err == nil {
+			return sig, nil
+		}
+		// some servers return the raw r || s form
+		esig, err := x509tools.UnpackEcdsaSignature(sig)
+		if err != nil {
+			return nil, err
+		}
+		return esig.Marshal(), nil
+	default:
+		return nil, token.KeyUsageError{
+			Key: k.kconf.Name(),
+			Err: fmt.Errorf("unsupported key type %T", pub),
+		}
+	}
+}
+
+func (k *kmipKey) Config() *config.KeyConfig {
+	return k.kconf
+}
+
+func (k *kmipKey) Certificate() []byte {
+	return nil
+}
+
+func (k *kmipKey) GetID() []byte {
+	return []byte(k.id)
+}
+
+func (k *kmipKey) ImportCertificate(cert *x509.Certificate) error {
+	return token.NotImplementedError{Op: "import-certificate", Type: tokenType}
+}
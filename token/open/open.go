@@ -30,7 +30,15 @@ import (
 	_ "github.com/sassoftware/relic/v7/token/azuretoken"
 	_ "github.com/sassoftware/relic/v7/token/filetoken"
 	_ "github.com/sassoftware/relic/v7/token/gcloudtoken"
+	_ "github.com/sassoftware/relic/v7/token/keylesstoken"
+	_ "github.com/sassoftware/relic/v7/token/kmiptoken"
+	_ "github.com/sassoftware/relic/v7/token/remotetoken"
 	_ "github.com/sassoftware/relic/v7/token/scdtoken"
+	_ "github.com/sassoftware/relic/v7/token/sshagenttoken"
+	_ "github.com/sassoftware/relic/v7/token/thresholdtoken"
+	_ "github.com/sassoftware/relic/v7/token/tpmtoken"
+	_ "github.com/sassoftware/relic/v7/token/vaulttoken"
+	_ "github.com/sassoftware/relic/v7/token/wincerttoken"
 )
 
 func Token(cfg *config.Config, tokenName string, prompt passprompt.PasswordGetter) (token.Token, error) {
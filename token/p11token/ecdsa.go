@@ -45,14 +45,15 @@ func (key *Key) toEcdsaKey() (crypto.PublicKey, error) {
 	return eckey, nil
 }
 
-// Sign a digest using token ECDSA private key
-func (key *Key) signECDSA(digest []byte) (der []byte, err error) {
-	mech := pkcs11.NewMechanism(pkcs11.CKM_ECDSA, nil)
-	err = key.token.ctx.SignInit(key.token.sh, []*pkcs11.Mechanism{mech}, key.priv)
+// Sign a digest, or a message for hash-and-sign mechanisms, using token ECDSA
+// private key
+func (key *Key) signECDSA(sh pkcs11.SessionHandle, priv pkcs11.ObjectHandle, data []byte) (der []byte, err error) {
+	mech := pkcs11.NewMechanism(key.mechType(pkcs11.CKM_ECDSA), nil)
+	err = key.token.ctx.SignInit(sh, []*pkcs11.Mechanism{mech}, priv)
 	if err != nil {
 		return nil, err
 	}
-	sig, err := key.token.ctx.Sign(key.token.sh, digest)
+	sig, err := key.token.ctx.Sign(sh, data)
 	if err != nil {
 		return nil, err
 	}
@@ -81,11 +82,7 @@ func ecdsaImportAttrs(priv *ecdsa.PrivateKey) (pubAttrs, privAttrs []*pkcs11.Att
 }
 
 // Generate ECDSA-specific public attributes to generate an ECSDA key in the token
-func ecdsaGenerateAttrs(bits uint) ([]*pkcs11.Attribute, *pkcs11.Mechanism, error) {
-	curve, err := x509tools.CurveByBits(bits)
-	if err != nil {
-		return nil, nil, err
-	}
+func ecdsaGenerateAttrs(curve *x509tools.CurveDefinition) ([]*pkcs11.Attribute, *pkcs11.Mechanism, error) {
 	pubAttrs := []*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, curve.ToDer())}
 	mech := pkcs11.NewMechanism(pkcs11.CKM_EC_KEY_PAIR_GEN, nil)
 	return pubAttrs, mech, nil
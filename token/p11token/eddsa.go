@@ -0,0 +1,103 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package p11token
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/asn1"
+	"errors"
+
+	"github.com/miekg/pkcs11"
+)
+
+// PKCS#11 3.0 values, which the pkcs11 package predates
+const (
+	CKK_EC_EDWARDS              = 0x40
+	CKM_EC_EDWARDS_KEY_PAIR_GEN = 0x1055
+	CKM_EDDSA                   = 0x1057
+
+	// Thales Luna firmware before PKCS#11 3.0 support
+	CKK_LUNA_EC_EDWARDS              = pkcs11.CKK_VENDOR_DEFINED + 0x12
+	CKM_LUNA_EC_EDWARDS_KEY_PAIR_GEN = pkcs11.CKM_VENDOR_DEFINED + 0xC01
+	CKM_LUNA_EDDSA                   = pkcs11.CKM_VENDOR_DEFINED + 0xC03
+)
+
+var (
+	oidEd25519 = asn1.ObjectIdentifier{1, 3, 101, 112}
+	// CKA_EC_PARAMS may hold either the OID or the curve name
+	ed25519Params     = []byte{0x06, 0x03, 0x2b, 0x65, 0x70}
+	ed25519NameParams = append([]byte{0x13, 0x0c}, "edwards25519"...)
+)
+
+func isEdwards(keyType uint) bool {
+	return keyType == CKK_EC_EDWARDS || keyType == CKK_LUNA_EC_EDWARDS
+}
+
+func (key *Key) toEd25519Key() (ed25519.PublicKey, error) {
+	ecparams := key.token.getAttribute(key.pub, pkcs11.CKA_EC_PARAMS)
+	ecpoint := key.token.getAttribute(key.pub, pkcs11.CKA_EC_POINT)
+	if len(ecparams) == 0 || len(ecpoint) == 0 {
+		return nil, errors.New("unable to retrieve EdDSA public key")
+	}
+	if !bytes.Equal(ecparams, ed25519Params) && !bytes.Equal(ecparams, ed25519NameParams) {
+		var oid asn1.ObjectIdentifier
+		if _, err := asn1.Unmarshal(ecparams, &oid); err != nil || !oid.Equal(oidEd25519) {
+			return nil, errors.New("unsupported EdDSA curve")
+		}
+	}
+	return parseEdwardsPoint(ecpoint)
+}
+
+// CKA_EC_POINT should be a DER octet string, but some tokens return the raw point
+func parseEdwardsPoint(ecpoint []byte) (ed25519.PublicKey, error) {
+	if len(ecpoint) == ed25519.PublicKeySize {
+		return ed25519.PublicKey(ecpoint), nil
+	}
+	var raw []byte
+	if _, err := asn1.Unmarshal(ecpoint, &raw); err != nil || len(raw) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid EdDSA public key")
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+// Sign a message with pure Ed25519, falling back to the vendor mechanism if
+// the token doesn't know the standard one
+func (key *Key) signEdDSA(sh pkcs11.SessionHandle, priv pkcs11.ObjectHandle, message []byte) ([]byte, error) {
+	var err error
+	mechTypes := []uint{CKM_EDDSA, CKM_LUNA_EDDSA}
+	if key.mech != nil {
+		mechTypes = []uint{key.mech.typ}
+	}
+	for _, mechType := range mechTypes {
+		mech := pkcs11.NewMechanism(mechType, nil)
+		err = key.token.ctx.SignInit(sh, []*pkcs11.Mechanism{mech}, priv)
+		if rv, ok := err.(pkcs11.Error); ok && rv == pkcs11.CKR_MECHANISM_INVALID {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		return key.token.ctx.Sign(sh, message)
+	}
+	return nil, err
+}
+
+func ed25519GenerateAttrs() ([]*pkcs11.Attribute, *pkcs11.Mechanism, error) {
+	pubAttrs := []*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, ed25519Params)}
+	mech := pkcs11.NewMechanism(CKM_EC_EDWARDS_KEY_PAIR_GEN, nil)
+	return pubAttrs, mech, nil
+}
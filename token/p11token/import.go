@@ -29,6 +29,8 @@ import (
 
 	"github.com/miekg/pkcs11"
 
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+	"github.com/sassoftware/relic/v7/signers/sigerrors"
 	"github.com/sassoftware/relic/v7/token"
 )
 
@@ -50,16 +52,28 @@ var newPrivateKeyAttrs = []*pkcs11.Attribute{
 	pkcs11.NewAttribute(pkcs11.CKA_SIGN, true),
 }
 
-// Import a PKCS#8 encoded key using a random 3DES key and the Unwrap function.
-// For some HSMs this is the only way to import keys.
+// Import a PKCS#8 encoded key using a random wrapping key and the Unwrap
+// function. For some HSMs this is the only way to import keys.
 func (tok *Token) importPkcs8(pk8 []byte, attrs []*pkcs11.Attribute) (err error) {
-	// Generate a temporary 3DES key
-	genMech := []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_DES3_KEY_GEN, nil)}
-	wrapKey, err := tok.ctx.GenerateKey(tok.sh, genMech, []*pkcs11.Attribute{
+	// Generate a temporary wrapping key
+	genMech := []*pkcs11.Mechanism{pkcs11.NewMechanism(tok.quirks.wrapKeyGen, nil)}
+	genAttrs := []*pkcs11.Attribute{
 		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, false),
 		pkcs11.NewAttribute(pkcs11.CKA_ENCRYPT, true),
 		pkcs11.NewAttribute(pkcs11.CKA_UNWRAP, true),
-	})
+	}
+	var iv []byte
+	if tok.quirks.wrapMech == pkcs11.CKM_AES_KEY_WRAP_PAD {
+		genAttrs = append(genAttrs,
+			pkcs11.NewAttribute(pkcs11.CKA_WRAP, true),
+			pkcs11.NewAttribute(pkcs11.CKA_VALUE_LEN, 32))
+	} else {
+		iv = make([]byte, 8)
+		if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+			return err
+		}
+	}
+	wrapKey, err := tok.ctx.GenerateKey(tok.sh, genMech, genAttrs)
 	if err != nil {
 		return err
 	}
@@ -70,11 +84,7 @@ func (tok *Token) importPkcs8(pk8 []byte, attrs []*pkcs11.Attribute) (err error)
 		}
 	}()
 	// Encrypt key
-	iv := make([]byte, 8)
-	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
-		return err
-	}
-	encMech := []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_DES3_CBC_PAD, iv)}
+	encMech := []*pkcs11.Mechanism{pkcs11.NewMechanism(tok.quirks.wrapMech, iv)}
 	if err := tok.ctx.EncryptInit(tok.sh, encMech, wrapKey); err != nil {
 		return err
 	}
@@ -89,6 +99,17 @@ func (tok *Token) importPkcs8(pk8 []byte, attrs []*pkcs11.Attribute) (err error)
 	return nil
 }
 
+// createPublicKey creates a public key object, retrying without the optional
+// attributes if the module doesn't support them
+func (tok *Token) createPublicKey(attrs []*pkcs11.Attribute) (pkcs11.ObjectHandle, error) {
+	attrs = tok.quirks.template(attrs)
+	handle, err := tok.ctx.CreateObject(tok.sh, attrs)
+	if isAttributeError(err) && len(tok.quirks.optionalPublicAttrs) != 0 {
+		handle, err = tok.ctx.CreateObject(tok.sh, dropAttrs(attrs, tok.quirks.optionalPublicAttrs))
+	}
+	return handle, err
+}
+
 // Import an RSA or ECDSA private key into the token
 func (tok *Token) Import(keyName string, privKey crypto.PrivateKey) (token.Key, error) {
 	keyConf, err := tok.config.GetKey(keyName)
@@ -123,17 +144,21 @@ func (tok *Token) Import(keyName string, privKey crypto.PrivateKey) (token.Key,
 		pkcs11.NewAttribute(pkcs11.CKA_LABEL, keyConf.Label),
 	}
 	pubAttrs := attrConcat(commonAttrs, newPublicKeyAttrs, pubTypeAttrs)
-	privAttrsSensitive := attrConcat(commonAttrs, newPrivateKeyAttrs, privTypeAttrs)
-	pubHandle, err := tok.ctx.CreateObject(tok.sh, pubAttrs)
+	privAttrsSensitive := tok.quirks.template(attrConcat(commonAttrs, newPrivateKeyAttrs, privTypeAttrs))
+	pubHandle, err := tok.createPublicKey(pubAttrs)
 	if err != nil {
 		return nil, err
 	}
-	_, err = tok.ctx.CreateObject(tok.sh, privAttrsSensitive)
+	if tok.quirks.unwrapImport {
+		err = pkcs11.Error(pkcs11.CKR_TEMPLATE_INCONSISTENT)
+	} else {
+		_, err = tok.ctx.CreateObject(tok.sh, privAttrsSensitive)
+	}
 	if err2, ok := err.(pkcs11.Error); ok && err2 == pkcs11.CKR_TEMPLATE_INCONSISTENT {
 		// Some HSMs don't seem to allow importing private keys directly so use
 		// key wrapping to sneak it in. Exclude the "sensitive" attrs since
 		// only the flags, label etc. are useful for Unwrap
-		privAttrsUnwrap := attrConcat(commonAttrs, newPrivateKeyAttrs)
+		privAttrsUnwrap := tok.quirks.template(attrConcat(commonAttrs, newPrivateKeyAttrs))
 		var pk8 []byte
 		pk8, err = x509.MarshalPKCS8PrivateKey(privKey)
 		if err == nil {
@@ -148,8 +173,28 @@ func (tok *Token) Import(keyName string, privKey crypto.PrivateKey) (token.Key,
 	return tok.getKey(keyConf, keyName)
 }
 
-// Generate an RSA or ECDSA key in the token
+// Generate an RSA, ECDSA or Ed25519 key in the token
 func (tok *Token) Generate(keyName string, keyType token.KeyType, bits uint) (token.Key, error) {
+	if keyType == token.KeyTypeEcdsa {
+		curve, err := x509tools.CurveByBits(bits)
+		if err != nil {
+			return nil, err
+		}
+		return tok.generate(keyName, keyType, 0, curve)
+	}
+	return tok.generate(keyName, keyType, bits, nil)
+}
+
+// GenerateCurve generates an ECDSA key on a named curve in the token
+func (tok *Token) GenerateCurve(keyName string, curveName string) (token.Key, error) {
+	curve, err := x509tools.CurveByName(curveName)
+	if err != nil {
+		return nil, err
+	}
+	return tok.generate(keyName, token.KeyTypeEcdsa, 0, curve)
+}
+
+func (tok *Token) generate(keyName string, keyType token.KeyType, bits uint, curve *x509tools.CurveDefinition) (token.Key, error) {
 	tok.mutex.Lock()
 	defer tok.mutex.Unlock()
 	keyConf, err := tok.config.GetKey(keyName)
@@ -169,7 +214,9 @@ func (tok *Token) Generate(keyName string, keyType token.KeyType, bits uint) (to
 	case token.KeyTypeRsa:
 		pubTypeAttrs, mech, err = rsaGenerateAttrs(bits)
 	case token.KeyTypeEcdsa:
-		pubTypeAttrs, mech, err = ecdsaGenerateAttrs(bits)
+		pubTypeAttrs, mech, err = ecdsaGenerateAttrs(curve)
+	case token.KeyTypeEd25519:
+		pubTypeAttrs, mech, err = ed25519GenerateAttrs()
 	default:
 		return nil, errors.New("Unsupported key type")
 	}
@@ -180,20 +227,52 @@ func (tok *Token) Generate(keyName string, keyType token.KeyType, bits uint) (to
 		pkcs11.NewAttribute(pkcs11.CKA_ID, keyID),
 		pkcs11.NewAttribute(pkcs11.CKA_LABEL, keyConf.Label),
 	}
-	pubAttrs := attrConcat(commonAttrs, newPublicKeyAttrs, pubTypeAttrs)
-	privAttrs := attrConcat(commonAttrs, newPrivateKeyAttrs)
-	if _, _, err := tok.ctx.GenerateKeyPair(tok.sh, []*pkcs11.Mechanism{mech}, pubAttrs, privAttrs); err != nil {
-		if err2, ok := err.(pkcs11.Error); ok && err2 == pkcs11.CKR_MECHANISM_INVALID && mech.Mechanism == pkcs11.CKM_RSA_X9_31_KEY_PAIR_GEN {
-			mech.Mechanism = pkcs11.CKM_RSA_PKCS_KEY_PAIR_GEN
-			if _, _, err := tok.ctx.GenerateKeyPair(tok.sh, []*pkcs11.Mechanism{mech}, pubAttrs, privAttrs); err != nil {
-				return nil, err
-			}
-		} else {
-			return nil, err
-		}
+	if tok.quirks.vendorEdwards && mech.Mechanism == CKM_EC_EDWARDS_KEY_PAIR_GEN {
+		mech.Mechanism = CKM_LUNA_EC_EDWARDS_KEY_PAIR_GEN
+	}
+	pubAttrs := tok.quirks.template(attrConcat(commonAttrs, newPublicKeyAttrs, pubTypeAttrs))
+	privAttrs := tok.quirks.template(attrConcat(commonAttrs, newPrivateKeyAttrs))
+	err = tok.generateKeyPair(mech, pubAttrs, privAttrs)
+	if isAttributeError(err) && len(tok.quirks.optionalPublicAttrs) != 0 {
+		err = tok.generateKeyPair(mech, dropAttrs(pubAttrs, tok.quirks.optionalPublicAttrs), privAttrs)
+	}
+	if err != nil {
+		return nil, err
 	}
 	keyConf.ID = hex.EncodeToString(keyID)
-	return tok.getKey(keyConf, keyName)
+	key, err := tok.getKey(keyConf, keyName)
+	if _, ok := err.(sigerrors.KeyNotFoundError); ok {
+		// the module assigned its own CKA_ID, so find the key by label and
+		// record the ID it was given
+		keyConf.ID = ""
+		key, err = tok.getKey(keyConf, keyName)
+		if err == nil {
+			keyConf.ID = hex.EncodeToString(tok.getAttribute(key.priv, pkcs11.CKA_ID))
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// generateKeyPair generates a key pair, falling back to an alternate
+// mechanism if the module doesn't support the first choice
+func (tok *Token) generateKeyPair(mech *pkcs11.Mechanism, pubAttrs, privAttrs []*pkcs11.Attribute) error {
+	_, _, err := tok.ctx.GenerateKeyPair(tok.sh, []*pkcs11.Mechanism{mech}, pubAttrs, privAttrs)
+	if err == nil {
+		return nil
+	}
+	fallback := map[uint]uint{
+		pkcs11.CKM_RSA_X9_31_KEY_PAIR_GEN: pkcs11.CKM_RSA_PKCS_KEY_PAIR_GEN,
+		CKM_EC_EDWARDS_KEY_PAIR_GEN:       CKM_LUNA_EC_EDWARDS_KEY_PAIR_GEN,
+		CKM_LUNA_EC_EDWARDS_KEY_PAIR_GEN:  CKM_EC_EDWARDS_KEY_PAIR_GEN,
+	}[mech.Mechanism]
+	if err2, ok := err.(pkcs11.Error); ok && err2 == pkcs11.CKR_MECHANISM_INVALID && fallback != 0 {
+		fb := pkcs11.NewMechanism(fallback, nil)
+		_, _, err = tok.ctx.GenerateKeyPair(tok.sh, []*pkcs11.Mechanism{fb}, pubAttrs, privAttrs)
+	}
+	return err
 }
 
 func attrConcat(attrSets ...[]*pkcs11.Attribute) []*pkcs11.Attribute {
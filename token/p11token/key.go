@@ -19,7 +19,6 @@ package p11token
 import (
 	"context"
 	"crypto"
-	"crypto/rand"
 	"errors"
 	"fmt"
 	"io"
@@ -40,6 +39,11 @@ type Key struct {
 	pub             pkcs11.ObjectHandle
 	priv            pkcs11.ObjectHandle
 	pubParsed       crypto.PublicKey
+	// mechanism and PSS mask generation function overriding the defaults
+	mech *mechanism
+	mgf  uint
+	// connection generation the handles were found in
+	gen uint64
 }
 
 func (token *Token) GetKey(ctx context.Context, keyName string) (token.Key, error) {
@@ -59,6 +63,7 @@ func (token *Token) getKey(keyConf *config.KeyConfig, keyName string) (*Key, err
 		keyConf:         keyConf,
 		PgpCertificate:  keyConf.PgpCertificate,
 		X509Certificate: keyConf.X509Certificate,
+		gen:             token.gen,
 	}
 	key.priv, err = token.findKey(keyConf, pkcs11.CKO_PRIVATE_KEY)
 	if err != nil {
@@ -81,12 +86,22 @@ func (token *Token) getKey(keyConf *config.KeyConfig, keyName string) (*Key, err
 		key.pubParsed, err = key.toRsaKey()
 	case CKK_ECDSA:
 		key.pubParsed, err = key.toEcdsaKey()
+	case CKK_EC_EDWARDS, CKK_LUNA_EC_EDWARDS:
+		key.pubParsed, err = key.toEd25519Key()
 	default:
 		return nil, errors.New("Unsupported key type")
 	}
 	if err != nil {
 		return nil, err
 	}
+	key.mech, err = parseMechanism(keyConf.Mechanism, key.keyType)
+	if err != nil {
+		return nil, fmt.Errorf("key %q: %w", keyConf.Name(), err)
+	}
+	key.mgf, err = parseMGF(keyConf.MGF)
+	if err != nil {
+		return nil, fmt.Errorf("key %q: %w", keyConf.Name(), err)
+	}
 	return key, nil
 }
 
@@ -139,19 +154,90 @@ func (key *Key) GetID() []byte {
 	return key.token.getAttribute(key.priv, pkcs11.CKA_ID)
 }
 
-func (key *Key) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+// privateHandle returns the private key handle for use with a session,
+// finding the key again if the token reconnected since it was last used
+func (key *Key) privateHandle(s session) (pkcs11.ObjectHandle, error) {
 	key.token.mutex.Lock()
 	defer key.token.mutex.Unlock()
-	switch key.keyType {
-	case CKK_RSA:
-		return key.signRSA(digest, opts)
-	case CKK_ECDSA:
-		return key.signECDSA(digest)
-	default:
-		return nil, errors.New("Unsupported key type")
+	if key.gen == s.gen {
+		return key.priv, nil
 	}
+	priv, err := key.token.findKey(key.keyConf, pkcs11.CKO_PRIVATE_KEY)
+	if err != nil {
+		return 0, err
+	}
+	key.priv = priv
+	key.gen = key.token.gen
+	if key.gen != s.gen {
+		// session predates the reconnect and will fail anyway
+		return 0, pkcs11.Error(pkcs11.CKR_SESSION_HANDLE_INVALID)
+	}
+	return priv, nil
+}
+
+func (key *Key) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return key.SignContext(context.Background(), digest, opts)
 }
 
+// SignContext signs using a session from the token's pool, so concurrent
+// requests don't wait on each other
 func (key *Key) SignContext(ctx context.Context, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
-	return key.Sign(rand.Reader, digest, opts)
+	if isEdwards(key.keyType) && opts.HashFunc() != 0 {
+		return nil, token.KeyUsageError{
+			Key: key.keyConf.Name(),
+			Err: errors.New("ed25519 keys can't sign a prehashed digest"),
+		}
+	}
+	if key.tokenHashes() {
+		return nil, token.KeyUsageError{
+			Key: key.keyConf.Name(),
+			Err: fmt.Errorf("mechanism %s hashes the message in the token, so it can't sign a prehashed digest", key.mech.name),
+		}
+	}
+	return key.sign(ctx, digest, opts)
+}
+
+// SignData signs a complete message. Hash-and-sign mechanisms such as
+// CKM_ECDSA_SHA384 are given the message; otherwise it is hashed here.
+func (key *Key) SignData(ctx context.Context, data []byte, opts crypto.SignerOpts) ([]byte, error) {
+	hash := opts.HashFunc()
+	switch {
+	case isEdwards(key.keyType):
+		return key.SignContext(ctx, data, opts)
+	case key.tokenHashes():
+		if hash != key.mech.hash {
+			return nil, token.KeyUsageError{
+				Key: key.keyConf.Name(),
+				Err: fmt.Errorf("tried to use digest %s but mechanism %s requires digest %s", hash, key.mech.name, key.mech.hash),
+			}
+		}
+		return key.sign(ctx, data, opts)
+	case !hash.Available():
+		return nil, errors.New("unsupported hash function")
+	}
+	d := hash.New()
+	d.Write(data)
+	return key.SignContext(ctx, d.Sum(nil), opts)
+}
+
+func (key *Key) sign(ctx context.Context, data []byte, opts crypto.SignerOpts) ([]byte, error) {
+	var sig []byte
+	err := key.token.withSession(ctx, func(s session) error {
+		priv, err := key.privateHandle(s)
+		if err != nil {
+			return err
+		}
+		switch key.keyType {
+		case CKK_RSA:
+			sig, err = key.signRSA(s.sh, priv, data, opts)
+		case CKK_ECDSA:
+			sig, err = key.signECDSA(s.sh, priv, data)
+		case CKK_EC_EDWARDS, CKK_LUNA_EC_EDWARDS:
+			sig, err = key.signEdDSA(s.sh, priv, data)
+		default:
+			err = errors.New("Unsupported key type")
+		}
+		return err
+	})
+	return sig, err
 }
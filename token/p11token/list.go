@@ -45,9 +45,11 @@ var classNames = map[uint]string{
 }
 
 var keyTypes = map[uint]string{
-	pkcs11.CKK_RSA: "rsa",
-	pkcs11.CKK_DSA: "dsa",
-	pkcs11.CKK_EC:  "ec",
+	pkcs11.CKK_RSA:      "rsa",
+	pkcs11.CKK_DSA:      "dsa",
+	pkcs11.CKK_EC:       "ec",
+	CKK_EC_EDWARDS:      "ec_edwards",
+	CKK_LUNA_EC_EDWARDS: "ec_edwards",
 }
 
 func (tok *Token) ListKeys(opts token.ListOptions) (err error) {
@@ -155,6 +157,11 @@ func (tok *Token) printKey(opts token.ListOptions, handle pkcs11.ObjectHandle) {
 				fmt.Fprintf(opts.Output, " y:       0x%x\n", y)
 			}
 		}
+	case CKK_EC_EDWARDS, CKK_LUNA_EC_EDWARDS:
+		ecpoint := tok.getAttribute(handle, pkcs11.CKA_EC_POINT)
+		if pub, err := parseEdwardsPoint(ecpoint); err == nil && opts.Values {
+			fmt.Fprintf(opts.Output, " point:   0x%x\n", []byte(pub))
+		}
 	}
 }
 
@@ -0,0 +1,132 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package p11token
+
+import (
+	"crypto"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/pkcs11"
+)
+
+// mechanism is a signing mechanism chosen by a key's "mechanism" option,
+// overriding the default for its key type
+type mechanism struct {
+	name string
+	typ  uint
+	// key type the mechanism applies to, or 0 for vendor mechanisms
+	keyType uint
+	// for hash-and-sign mechanisms, the digest the token computes itself
+	hash crypto.Hash
+	// RSA padding the mechanism produces: pkcs1, pss, or empty if unknown
+	padding string
+}
+
+var knownMechanisms = []mechanism{
+	{"CKM_RSA_PKCS", pkcs11.CKM_RSA_PKCS, CKK_RSA, 0, "pkcs1"},
+	{"CKM_SHA1_RSA_PKCS", pkcs11.CKM_SHA1_RSA_PKCS, CKK_RSA, crypto.SHA1, "pkcs1"},
+	{"CKM_SHA224_RSA_PKCS", pkcs11.CKM_SHA224_RSA_PKCS, CKK_RSA, crypto.SHA224, "pkcs1"},
+	{"CKM_SHA256_RSA_PKCS", pkcs11.CKM_SHA256_RSA_PKCS, CKK_RSA, crypto.SHA256, "pkcs1"},
+	{"CKM_SHA384_RSA_PKCS", pkcs11.CKM_SHA384_RSA_PKCS, CKK_RSA, crypto.SHA384, "pkcs1"},
+	{"CKM_SHA512_RSA_PKCS", pkcs11.CKM_SHA512_RSA_PKCS, CKK_RSA, crypto.SHA512, "pkcs1"},
+	{"CKM_RSA_PKCS_PSS", pkcs11.CKM_RSA_PKCS_PSS, CKK_RSA, 0, "pss"},
+	{"CKM_SHA1_RSA_PKCS_PSS", pkcs11.CKM_SHA1_RSA_PKCS_PSS, CKK_RSA, crypto.SHA1, "pss"},
+	{"CKM_SHA224_RSA_PKCS_PSS", pkcs11.CKM_SHA224_RSA_PKCS_PSS, CKK_RSA, crypto.SHA224, "pss"},
+	{"CKM_SHA256_RSA_PKCS_PSS", pkcs11.CKM_SHA256_RSA_PKCS_PSS, CKK_RSA, crypto.SHA256, "pss"},
+	{"CKM_SHA384_RSA_PKCS_PSS", pkcs11.CKM_SHA384_RSA_PKCS_PSS, CKK_RSA, crypto.SHA384, "pss"},
+	{"CKM_SHA512_RSA_PKCS_PSS", pkcs11.CKM_SHA512_RSA_PKCS_PSS, CKK_RSA, crypto.SHA512, "pss"},
+	{"CKM_ECDSA", pkcs11.CKM_ECDSA, CKK_ECDSA, 0, ""},
+	{"CKM_ECDSA_SHA1", pkcs11.CKM_ECDSA_SHA1, CKK_ECDSA, crypto.SHA1, ""},
+	{"CKM_ECDSA_SHA224", pkcs11.CKM_ECDSA_SHA224, CKK_ECDSA, crypto.SHA224, ""},
+	{"CKM_ECDSA_SHA256", pkcs11.CKM_ECDSA_SHA256, CKK_ECDSA, crypto.SHA256, ""},
+	{"CKM_ECDSA_SHA384", pkcs11.CKM_ECDSA_SHA384, CKK_ECDSA, crypto.SHA384, ""},
+	{"CKM_ECDSA_SHA512", pkcs11.CKM_ECDSA_SHA512, CKK_ECDSA, crypto.SHA512, ""},
+	{"CKM_EDDSA", CKM_EDDSA, CKK_EC_EDWARDS, 0, ""},
+}
+
+var mgfTypes = map[string]uint{
+	"CKG_MGF1_SHA1":   pkcs11.CKG_MGF1_SHA1,
+	"CKG_MGF1_SHA224": pkcs11.CKG_MGF1_SHA224,
+	"CKG_MGF1_SHA256": pkcs11.CKG_MGF1_SHA256,
+	"CKG_MGF1_SHA384": pkcs11.CKG_MGF1_SHA384,
+	"CKG_MGF1_SHA512": pkcs11.CKG_MGF1_SHA512,
+}
+
+// parseMechanism looks up a mechanism by name, with or without the CKM_
+// prefix, or by number for vendor-defined mechanisms. Vendor mechanisms are
+// passed the same parameters as the default mechanism they replace.
+func parseMechanism(name string, keyType uint) (*mechanism, error) {
+	if name == "" {
+		return nil, nil
+	}
+	var mech *mechanism
+	if typ, err := strconv.ParseUint(name, 0, 32); err == nil {
+		mech = &mechanism{name: name, typ: uint(typ)}
+	} else {
+		upper := strings.ToUpper(name)
+		if !strings.HasPrefix(upper, "CKM_") {
+			upper = "CKM_" + upper
+		}
+		for _, known := range knownMechanisms {
+			if known.name == upper {
+				mech = new(mechanism)
+				*mech = known
+				break
+			}
+		}
+		if mech == nil {
+			return nil, fmt.Errorf("unknown mechanism %q", name)
+		}
+	}
+	if mech.keyType != 0 && mech.keyType != keyType && !(isEdwards(mech.keyType) && isEdwards(keyType)) {
+		return nil, fmt.Errorf("mechanism %s can't be used with this type of key", mech.name)
+	}
+	return mech, nil
+}
+
+// parseMGF looks up a PSS mask generation function by name, with or without
+// the CKG_MGF1_ prefix
+func parseMGF(name string) (uint, error) {
+	if name == "" {
+		return 0, nil
+	}
+	upper := strings.ToUpper(strings.ReplaceAll(name, "-", ""))
+	if !strings.HasPrefix(upper, "CKG_MGF1_") {
+		upper = "CKG_MGF1_" + upper
+	}
+	mgf, ok := mgfTypes[upper]
+	if !ok {
+		return 0, fmt.Errorf("unknown mask generation function %q", name)
+	}
+	return mgf, nil
+}
+
+// mechType returns the overridden mechanism type, or def if there isn't one
+func (key *Key) mechType(def uint) uint {
+	if key.mech != nil {
+		return key.mech.typ
+	}
+	return def
+}
+
+// tokenHashes returns true if the token computes the digest itself, and so
+// must be given the whole message
+func (key *Key) tokenHashes() bool {
+	return key.mech != nil && key.mech.hash != 0
+}
@@ -0,0 +1,190 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package p11token
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/miekg/pkcs11"
+)
+
+// quirks describes how a vendor's PKCS#11 module departs from what relic
+// otherwise assumes, so that it can be worked around without patching.
+type quirks struct {
+	name string
+	// match reports whether the profile applies to a module, given its
+	// fingerprint (see moduleFingerprint)
+	match func(fingerprint string) bool
+	// CKR_USER_ALREADY_LOGGED_IN from C_Login means the login is already in
+	// effect, e.g. because the module shares it between applications
+	sharedLogin bool
+	// skip logging in if the token doesn't set CKF_LOGIN_REQUIRED, e.g. for
+	// module-protected keys
+	optionalLogin bool
+	// attributes left out of new key templates because the module rejects them
+	omitAttrs []uint
+	// attributes of new public keys that are dropped and the request retried
+	// if the module reports them as invalid
+	optionalPublicAttrs []uint
+	// import private keys by unwrapping them instead of trying C_CreateObject
+	// first, and the key type and mechanism to wrap them with
+	unwrapImport bool
+	wrapKeyGen   uint
+	wrapMech     uint
+	// try the vendor's Ed25519 key generation mechanism first
+	vendorEdwards bool
+}
+
+var defaultQuirks = &quirks{
+	name:                "default",
+	optionalPublicAttrs: []uint{pkcs11.CKA_PRIVATE},
+	wrapKeyGen:          pkcs11.CKM_DES3_KEY_GEN,
+	wrapMech:            pkcs11.CKM_DES3_CBC_PAD,
+}
+
+// built-in profiles, checked in order
+var knownQuirks = []*quirks{
+	{
+		// AWS CloudHSM doesn't allow private keys to be created in plaintext,
+		// has no 3DES wrapping, and logs in once per application
+		name: "cloudhsm",
+		match: func(fp string) bool {
+			return strings.Contains(fp, "cloudhsm")
+		},
+		sharedLogin:         true,
+		omitAttrs:           []uint{pkcs11.CKA_PRIVATE},
+		optionalPublicAttrs: []uint{pkcs11.CKA_VERIFY},
+		unwrapImport:        true,
+		wrapKeyGen:          pkcs11.CKM_AES_KEY_GEN,
+		wrapMech:            pkcs11.CKM_AES_KEY_WRAP_PAD,
+	},
+	{
+		// Thales (SafeNet) Luna predates the standard EdDSA mechanisms and
+		// shares the partition login between processes on the same client
+		name: "luna",
+		match: func(fp string) bool {
+			return strings.Contains(fp, "safenet") || strings.Contains(fp, "luna")
+		},
+		sharedLogin:         true,
+		optionalPublicAttrs: []uint{pkcs11.CKA_PRIVATE},
+		wrapKeyGen:          pkcs11.CKM_DES3_KEY_GEN,
+		wrapMech:            pkcs11.CKM_DES3_CBC_PAD,
+		vendorEdwards:       true,
+	},
+	{
+		// Entrust nCipher exposes module-protected keys in a slot that needs
+		// no login, and only imports private keys by unwrapping
+		name: "ncipher",
+		match: func(fp string) bool {
+			return strings.Contains(fp, "ncipher") || strings.Contains(fp, "nfast")
+		},
+		optionalLogin:       true,
+		optionalPublicAttrs: []uint{pkcs11.CKA_PRIVATE},
+		unwrapImport:        true,
+		wrapKeyGen:          pkcs11.CKM_DES3_KEY_GEN,
+		wrapMech:            pkcs11.CKM_DES3_CBC_PAD,
+	},
+}
+
+// moduleFingerprint identifies the module and token, lowercased for matching
+func moduleFingerprint(lib pkcs11.Info, tok pkcs11.TokenInfo) string {
+	return strings.ToLower(fmt.Sprintf("%s|%s|%d.%d|%s|%s",
+		strings.TrimSpace(lib.ManufacturerID), strings.TrimSpace(lib.LibraryDescription),
+		lib.LibraryVersion.Major, lib.LibraryVersion.Minor,
+		strings.TrimSpace(tok.ManufacturerID), strings.TrimSpace(tok.Model)))
+}
+
+// selectQuirks picks the profile named in the configuration, or else the
+// first built-in profile that matches the module
+func selectQuirks(name, fingerprint string) (*quirks, error) {
+	switch name = strings.ToLower(name); name {
+	case "":
+		for _, q := range knownQuirks {
+			if q.match(fingerprint) {
+				return q, nil
+			}
+		}
+		return defaultQuirks, nil
+	case "none", defaultQuirks.name:
+		return defaultQuirks, nil
+	}
+	for _, q := range knownQuirks {
+		if q.name == name {
+			return q, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown pkcs11 quirks profile %q", name)
+}
+
+// detectQuirks fingerprints the module and token in the selected slot. Must be
+// called after the slot is found.
+func (tok *Token) detectQuirks() error {
+	lib, err := tok.ctx.GetInfo()
+	if err != nil {
+		return err
+	}
+	info, err := tok.ctx.GetTokenInfo(tok.slot)
+	if err != nil {
+		return err
+	}
+	tok.quirks, err = selectQuirks(tok.tokenConf.Quirks, moduleFingerprint(lib, info))
+	tok.loginRequired = info.Flags&pkcs11.CKF_LOGIN_REQUIRED != 0
+	return err
+}
+
+// template removes attributes the module rejects
+func (q *quirks) template(attrs []*pkcs11.Attribute) []*pkcs11.Attribute {
+	if len(q.omitAttrs) == 0 {
+		return attrs
+	}
+	return dropAttrs(attrs, q.omitAttrs)
+}
+
+// isAttributeError reports whether the module refused a template because of
+// an attribute it doesn't support
+func isAttributeError(err error) bool {
+	rv, ok := err.(pkcs11.Error)
+	if !ok {
+		return false
+	}
+	switch rv {
+	case pkcs11.CKR_ATTRIBUTE_TYPE_INVALID,
+		pkcs11.CKR_ATTRIBUTE_VALUE_INVALID,
+		pkcs11.CKR_ATTRIBUTE_READ_ONLY,
+		pkcs11.CKR_TEMPLATE_INCONSISTENT:
+		return true
+	}
+	return false
+}
+
+func dropAttrs(attrs []*pkcs11.Attribute, drop []uint) []*pkcs11.Attribute {
+	ret := make([]*pkcs11.Attribute, 0, len(attrs))
+	for _, attr := range attrs {
+		keep := true
+		for _, typ := range drop {
+			if attr.Type == typ {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			ret = append(ret, attr)
+		}
+	}
+	return ret
+}
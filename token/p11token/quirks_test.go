@@ -0,0 +1,40 @@
+package p11token
+
+import (
+	"testing"
+
+	"github.com/miekg/pkcs11"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectQuirks(t *testing.T) {
+	cases := []struct {
+		lib, model, expect string
+	}{
+		{"SafeNet", "LunaSA 7.8.0", "luna"},
+		{"nCipher Corp. Ltd", "", "ncipher"},
+		{"Marvell Semiconductor, Inc.|AWS CloudHSM", "", "cloudhsm"},
+		{"SoftHSM", "SoftHSM v2", "default"},
+	}
+	for _, c := range cases {
+		fp := moduleFingerprint(pkcs11.Info{ManufacturerID: c.lib}, pkcs11.TokenInfo{Model: c.model})
+		q, err := selectQuirks("", fp)
+		require.NoError(t, err)
+		assert.Equal(t, c.expect, q.name, c.lib)
+	}
+	q, err := selectQuirks("None", "safenet")
+	require.NoError(t, err)
+	assert.Equal(t, defaultQuirks, q)
+	_, err = selectQuirks("bogus", "")
+	assert.Error(t, err)
+}
+
+func TestDropAttrs(t *testing.T) {
+	attrs := attrConcat(newPublicKeyAttrs)
+	dropped := dropAttrs(attrs, []uint{pkcs11.CKA_PRIVATE})
+	assert.Len(t, dropped, len(attrs)-1)
+	for _, attr := range dropped {
+		assert.NotEqual(t, uint(pkcs11.CKA_PRIVATE), attr.Type)
+	}
+}
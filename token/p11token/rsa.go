@@ -20,12 +20,14 @@ import (
 	"crypto"
 	"crypto/rsa"
 	"errors"
+	"fmt"
 	"math"
 	"math/big"
 
 	"github.com/miekg/pkcs11"
 
 	"github.com/sassoftware/relic/v7/lib/x509tools"
+	"github.com/sassoftware/relic/v7/token"
 )
 
 // Convert token RSA public key to *rsa.PublicKey
@@ -73,37 +75,56 @@ func (key *Key) newPssMech(opts *rsa.PSSOptions) (*pkcs11.Mechanism, error) {
 	case rsa.PSSSaltLengthEqualsHash:
 		saltLength = opts.Hash.Size()
 	}
+	if key.mgf != 0 {
+		// some HSMs only implement one mask generation function
+		mgfType = key.mgf
+	}
 	args := make([]byte, ulongSize*3)
 	putUlong(args, hashAlg)
 	putUlong(args[ulongSize:], mgfType)
 	putUlong(args[ulongSize*2:], uint(saltLength))
-	return pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS_PSS, args), nil
+	return pkcs11.NewMechanism(key.mechType(pkcs11.CKM_RSA_PKCS_PSS), args), nil
 }
 
-// Sign a digest using token RSA private key
-func (key *Key) signRSA(digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+// Sign a digest, or a message for hash-and-sign mechanisms, using token RSA
+// private key
+func (key *Key) signRSA(sh pkcs11.SessionHandle, priv pkcs11.ObjectHandle, data []byte, opts crypto.SignerOpts) ([]byte, error) {
 	var mech *pkcs11.Mechanism
 	if opts == nil || opts.HashFunc() == 0 {
 		return nil, errors.New("signer options are required")
-	} else if pss, ok := opts.(*rsa.PSSOptions); ok {
+	}
+	pss, isPSS := opts.(*rsa.PSSOptions)
+	if key.mech != nil && key.mech.padding != "" && (key.mech.padding == "pss") != isPSS {
+		padding := "PKCS#1 v1.5"
+		if isPSS {
+			padding = "RSA-PSS"
+		}
+		return nil, token.KeyUsageError{
+			Key: key.keyConf.Name(),
+			Err: fmt.Errorf("tried to make a %s signature but key uses mechanism %s", padding, key.mech.name),
+		}
+	}
+	if isPSS {
 		var err error
 		mech, err = key.newPssMech(pss)
 		if err != nil {
 			return nil, err
 		}
 	} else {
-		var ok bool
-		digest, ok = x509tools.MarshalDigest(opts.HashFunc(), digest)
-		if !ok {
-			return nil, errors.New("unsupported hash function")
+		if !key.tokenHashes() {
+			var ok bool
+			data, ok = x509tools.MarshalDigest(opts.HashFunc(), data)
+			if !ok {
+				return nil, errors.New("unsupported hash function")
+			}
 		}
-		mech = pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS, nil)
+		mech = pkcs11.NewMechanism(key.mechType(pkcs11.CKM_RSA_PKCS), nil)
 	}
-	err := key.token.ctx.SignInit(key.token.sh, []*pkcs11.Mechanism{mech}, key.priv)
+	err := key.token.ctx.SignInit(sh, []*pkcs11.Mechanism{mech}, priv)
 	if err != nil {
 		return nil, err
 	}
-	return key.token.ctx.Sign(key.token.sh, digest)
+	return key.token.ctx.Sign(sh, data)
 }
 
 // Generate RSA-specific public and private key attributes from a PrivateKey
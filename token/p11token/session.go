@@ -0,0 +1,191 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package p11token
+
+import (
+	"context"
+	"errors"
+
+	"github.com/miekg/pkcs11"
+)
+
+const defaultMaxSessions = 8
+
+// session is a handle from the pool, tagged with the connection generation it
+// was opened in. Sessions and object handles from an older generation are
+// invalid after a reconnect.
+type session struct {
+	sh  pkcs11.SessionHandle
+	gen uint64
+}
+
+// sessionPool holds idle signing sessions. All sessions belong to the same
+// application as the primary session, so they share its login state.
+type sessionPool struct {
+	idle []session
+	// limits the number of sessions checked out at once
+	sem chan struct{}
+}
+
+func newSessionPool(max int) *sessionPool {
+	if max <= 0 {
+		max = defaultMaxSessions
+	}
+	return &sessionPool{sem: make(chan struct{}, max)}
+}
+
+// Errors that indicate the device went away or the sessions were invalidated,
+// e.g. because the HSM was restarted
+func isConnectionError(err error) bool {
+	rv, ok := err.(pkcs11.Error)
+	if !ok {
+		return false
+	}
+	switch rv {
+	case pkcs11.CKR_DEVICE_ERROR,
+		pkcs11.CKR_DEVICE_REMOVED,
+		pkcs11.CKR_TOKEN_NOT_PRESENT,
+		pkcs11.CKR_SESSION_HANDLE_INVALID,
+		pkcs11.CKR_SESSION_CLOSED,
+		pkcs11.CKR_USER_NOT_LOGGED_IN,
+		pkcs11.CKR_KEY_HANDLE_INVALID,
+		pkcs11.CKR_OBJECT_HANDLE_INVALID,
+		pkcs11.CKR_CRYPTOKI_NOT_INITIALIZED:
+		return true
+	}
+	return false
+}
+
+// getSession takes an idle session from the pool or opens a new one
+func (tok *Token) getSession(ctx context.Context) (session, error) {
+	select {
+	case tok.pool.sem <- struct{}{}:
+	case <-ctx.Done():
+		return session{}, ctx.Err()
+	}
+	tok.mutex.Lock()
+	defer tok.mutex.Unlock()
+	if tok.ctx == nil {
+		<-tok.pool.sem
+		return session{}, errors.New("token is closed")
+	}
+	if n := len(tok.pool.idle); n > 0 {
+		s := tok.pool.idle[n-1]
+		tok.pool.idle = tok.pool.idle[:n-1]
+		return s, nil
+	}
+	sh, err := tok.ctx.OpenSession(tok.slot, pkcs11.CKF_SERIAL_SESSION)
+	if err != nil {
+		<-tok.pool.sem
+		return session{}, err
+	}
+	return session{sh: sh, gen: tok.gen}, nil
+}
+
+// putSession returns a session to the pool, or closes it if it failed or is
+// from before a reconnect
+func (tok *Token) putSession(s session, err error) {
+	defer func() { <-tok.pool.sem }()
+	tok.mutex.Lock()
+	defer tok.mutex.Unlock()
+	if tok.ctx == nil {
+		return
+	}
+	if s.gen != tok.gen || isConnectionError(err) {
+		_ = tok.ctx.CloseSession(s.sh)
+		return
+	}
+	tok.pool.idle = append(tok.pool.idle, s)
+}
+
+// withSession runs fn with a pooled session. If the device reports that the
+// session or login was lost, the token reconnects and fn is tried once more.
+func (tok *Token) withSession(ctx context.Context, fn func(session) error) error {
+	for attempt := 0; ; attempt++ {
+		s, err := tok.getSession(ctx)
+		if err == nil {
+			err = fn(s)
+			tok.putSession(s, err)
+		}
+		if attempt > 0 || !isConnectionError(err) {
+			return err
+		}
+		if err := tok.reconnectFrom(s.gen); err != nil {
+			return err
+		}
+	}
+}
+
+// reconnectFrom reconnects unless another caller already did so since the
+// given generation
+func (tok *Token) reconnectFrom(gen uint64) error {
+	tok.mutex.Lock()
+	defer tok.mutex.Unlock()
+	if tok.ctx == nil {
+		return errors.New("token is closed")
+	}
+	if gen != tok.gen {
+		return nil
+	}
+	return tok.reconnect()
+}
+
+// reconnect discards all sessions, opens a new primary session and logs in
+// again. The slot is looked up again in case the device renumbered it. Must
+// be called with the mutex held.
+func (tok *Token) reconnect() error {
+	tok.gen++
+	for _, s := range tok.pool.idle {
+		_ = tok.ctx.CloseSession(s.sh)
+	}
+	tok.pool.idle = nil
+	_ = tok.ctx.CloseSession(tok.sh)
+	slot, err := tok.findSlot()
+	if rv, ok := err.(pkcs11.Error); ok && rv == pkcs11.CKR_CRYPTOKI_NOT_INITIALIZED {
+		// the library itself lost its state
+		if err := tok.ctx.Initialize(); err != nil {
+			return err
+		}
+		slot, err = tok.findSlot()
+	}
+	if err != nil {
+		return err
+	}
+	tok.slot = slot
+	if err := tok.detectQuirks(); err != nil {
+		return err
+	}
+	tok.sh, err = tok.ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION)
+	if err != nil {
+		return err
+	}
+	return tok.autoLogIn()
+}
+
+// prune closes idle sessions that no longer respond. Must be called with the
+// mutex held.
+func (tok *Token) prune() {
+	live := tok.pool.idle[:0]
+	for _, s := range tok.pool.idle {
+		if _, err := tok.ctx.GetSessionInfo(s.sh); err != nil {
+			_ = tok.ctx.CloseSession(s.sh)
+			continue
+		}
+		live = append(live, s)
+	}
+	tok.pool.idle = live
+}
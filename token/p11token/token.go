@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"io"
 	"runtime"
+	"strings"
 	"sync"
 
 	"github.com/miekg/pkcs11"
@@ -56,11 +57,21 @@ var providerMap map[string]*pkcs11.Ctx
 var providerMutex sync.Mutex
 
 type Token struct {
-	config    *config.Config
-	tokenConf *config.TokenConfig
-	ctx       *pkcs11.Ctx
-	sh        pkcs11.SessionHandle
-	mutex     sync.Mutex
+	config      *config.Config
+	tokenConf   *config.TokenConfig
+	pinProvider passprompt.PasswordGetter
+	ctx         *pkcs11.Ctx
+	slot        uint
+	// primary session, which holds the login and is used for management
+	sh pkcs11.SessionHandle
+	// sessions for signing
+	pool *sessionPool
+	// incremented each time the sessions are reopened
+	gen uint64
+	// vendor workarounds for the module
+	quirks        *quirks
+	loginRequired bool
+	mutex         sync.Mutex
 }
 
 func List(provider string, output io.Writer) error {
@@ -97,9 +108,11 @@ func Open(config *config.Config, tokenName string, pinProvider passprompt.Passwo
 		return nil, err
 	}
 	tok := &Token{
-		ctx:       ctx,
-		config:    config,
-		tokenConf: tokenConf,
+		ctx:         ctx,
+		config:      config,
+		tokenConf:   tokenConf,
+		pinProvider: pinProvider,
+		pool:        newSessionPool(tokenConf.MaxSessions),
 	}
 	runtime.SetFinalizer(tok, (*Token).Close)
 	slot, err := tok.findSlot()
@@ -107,6 +120,11 @@ func Open(config *config.Config, tokenName string, pinProvider passprompt.Passwo
 		tok.Close()
 		return nil, err
 	}
+	tok.slot = slot
+	if err := tok.detectQuirks(); err != nil {
+		tok.Close()
+		return nil, err
+	}
 	mode := uint(pkcs11.CKF_SERIAL_SESSION | pkcs11.CKF_RW_SESSION)
 	sh, err := tok.ctx.OpenSession(slot, mode)
 	if err != nil {
@@ -114,7 +132,9 @@ func Open(config *config.Config, tokenName string, pinProvider passprompt.Passwo
 		return nil, err
 	}
 	tok.sh = sh
-	err = tok.autoLogIn(pinProvider)
+	tok.mutex.Lock()
+	err = tok.autoLogIn()
+	tok.mutex.Unlock()
 	if err != nil {
 		tok.Close()
 		return nil, err
@@ -159,6 +179,10 @@ func (tok *Token) Close() error {
 	defer tok.mutex.Unlock()
 	var err error
 	if tok.ctx != nil {
+		for _, s := range tok.pool.idle {
+			_ = tok.ctx.CloseSession(s.sh)
+		}
+		tok.pool.idle = nil
 		err = tok.ctx.CloseSession(tok.sh)
 		tok.ctx = nil
 		runtime.SetFinalizer(tok, nil)
@@ -174,7 +198,7 @@ func (tok *Token) findSlot() (uint, error) {
 	tokenConf := tok.tokenConf
 	slots, err := tok.ctx.GetSlotList(false)
 	if err != nil {
-		return 0, nil
+		return 0, err
 	}
 	candidates := make([]uint, 0, len(slots))
 	for _, slot := range slots {
@@ -201,40 +225,93 @@ func (tok *Token) findSlot() (uint, error) {
 	}
 }
 
-// Test that the token is responding and the user is (still) logged in
+// Test that the token is responding and the user is (still) logged in. Must be
+// called with the mutex held.
 func (tok *Token) isLoggedIn() (bool, error) {
-	tok.mutex.Lock()
-	defer tok.mutex.Unlock()
 	info, err := tok.ctx.GetSessionInfo(tok.sh)
 	if err != nil {
 		return false, err
 	}
+	if tok.skipLogin() {
+		return true, nil
+	}
 	return (info.State == CKS_RO_USER_FUNCTIONS || info.State == CKS_RW_USER_FUNCTIONS || info.State == CKS_RW_SO_FUNCTIONS), nil
 }
 
+// Ping checks the health of the token, and reconnects and logs in again if
+// the device was restarted or the login was lost
 func (tok *Token) Ping(ctx context.Context) error {
+	tok.mutex.Lock()
+	defer tok.mutex.Unlock()
+	if tok.ctx == nil {
+		return errors.New("token is closed")
+	}
+	tok.prune()
 	loggedIn, err := tok.isLoggedIn()
-	if err != nil {
+	if err == nil && loggedIn {
+		return nil
+	} else if err != nil && !isConnectionError(err) {
 		return err
-	} else if !loggedIn {
-		return errors.New("token not logged in")
+	}
+	if err := tok.reconnect(); err != nil {
+		return fmt.Errorf("reconnecting to token: %w", err)
 	}
 	return nil
 }
 
-func (tok *Token) login(user uint, pin string) error {
+// Health checks the token like Ping, then reports the device, the session
+// pool, and the PIN state. PKCS#11 only exposes whether few PIN attempts
+// remain, so PINRetries is only set for the last attempt or a locked PIN.
+func (tok *Token) Health(ctx context.Context) (*token.Health, error) {
+	if err := tok.Ping(ctx); err != nil {
+		return nil, err
+	}
 	tok.mutex.Lock()
 	defer tok.mutex.Unlock()
+	h := &token.Health{
+		Sessions:    len(tok.pool.sem) + len(tok.pool.idle),
+		MaxSessions: cap(tok.pool.sem),
+	}
+	info, err := tok.ctx.GetTokenInfo(tok.slot)
+	if err != nil {
+		return nil, err
+	}
+	h.Slot = fmt.Sprintf("%d: %s %s serial %s",
+		tok.slot, strings.TrimSpace(info.ManufacturerID), strings.TrimSpace(info.Model), strings.TrimSpace(info.SerialNumber))
+	var retries int
+	switch {
+	case info.Flags&pkcs11.CKF_USER_PIN_LOCKED != 0:
+		h.PINRetries = &retries
+		h.Warnings = append(h.Warnings, "user PIN is locked")
+	case info.Flags&pkcs11.CKF_USER_PIN_FINAL_TRY != 0:
+		retries = 1
+		h.PINRetries = &retries
+		h.Warnings = append(h.Warnings, "one user PIN attempt remains")
+	case info.Flags&pkcs11.CKF_USER_PIN_COUNT_LOW != 0:
+		h.Warnings = append(h.Warnings, "user PIN attempts are running low")
+	}
+	return h, nil
+}
+
+func (tok *Token) login(user uint, pin string) error {
 	err := tok.ctx.Login(tok.sh, user, pin)
 	if err != nil {
 		if rv, ok := err.(pkcs11.Error); ok && rv == pkcs11.CKR_PIN_INCORRECT {
 			return sigerrors.PinIncorrectError{}
+		} else if ok && rv == pkcs11.CKR_USER_ALREADY_LOGGED_IN && tok.quirks.sharedLogin {
+			return nil
 		}
 	}
 	return err
 }
 
-func (tok *Token) autoLogIn(pinProvider passprompt.PasswordGetter) error {
+// skipLogin reports whether the token can be used without logging in
+func (tok *Token) skipLogin() bool {
+	return tok.quirks.optionalLogin && !tok.loginRequired && tok.tokenConf.Pin == nil
+}
+
+// Must be called with the mutex held
+func (tok *Token) autoLogIn() error {
 	tokenConf := tok.tokenConf
 	loggedIn, err := tok.isLoggedIn()
 	if err != nil {
@@ -258,7 +335,7 @@ func (tok *Token) autoLogIn(pinProvider passprompt.PasswordGetter) error {
 	}
 	initialPrompt := fmt.Sprintf("PIN for token %s user %08x: ", tokenConf.Name(), user)
 	keyringUser := fmt.Sprintf("%s.%08x", tokenConf.Name(), user)
-	return token.Login(tokenConf, pinProvider, loginFunc, keyringUser, initialPrompt)
+	return token.Login(tokenConf, tok.pinProvider, loginFunc, keyringUser, initialPrompt)
 }
 
 func (tok *Token) getAttribute(handle pkcs11.ObjectHandle, attr uint) []byte {
@@ -0,0 +1,21 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package pivtoken provides a token that talks to a YubiKey's PIV application
+// directly over PC/SC, without a PKCS#11 module. Keys are selected by slot in
+// the id field, e.g. "9c", and the card is selected by serial number or by a
+// substring of the reader name in the token's label field.
+package pivtoken
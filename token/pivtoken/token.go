@@ -0,0 +1,433 @@
+//go:build cgo && !pure && !clientonly
+// +build cgo,!pure,!clientonly
+
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pivtoken
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-piv/piv-go/piv"
+
+	"github.com/sassoftware/relic/v7/config"
+	"github.com/sassoftware/relic/v7/lib/attestation"
+	"github.com/sassoftware/relic/v7/lib/passprompt"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+	"github.com/sassoftware/relic/v7/token"
+)
+
+const tokenType = "piv"
+
+type pivToken struct {
+	config *config.Config
+	tconf  *config.TokenConfig
+	serial uint32
+	pin    string
+	// the card handle can only be used by one caller at a time
+	mu sync.Mutex
+	yk *piv.YubiKey
+}
+
+type pivKey struct {
+	kconf *config.KeyConfig
+	tok   *pivToken
+	slot  piv.Slot
+	pub   crypto.PublicKey
+	cert  *x509.Certificate
+}
+
+func init() {
+	token.Openers[tokenType] = open
+}
+
+func open(conf *config.Config, tokenName string, prompt passprompt.PasswordGetter) (token.Token, error) {
+	tconf, err := conf.GetToken(tokenName)
+	if err != nil {
+		return nil, err
+	}
+	tok := &pivToken{config: conf, tconf: tconf}
+	if err := tok.openCard(); err != nil {
+		return nil, err
+	}
+	if err := tok.login(prompt); err != nil {
+		tok.yk.Close()
+		return nil, err
+	}
+	return tok, nil
+}
+
+// find the card matching the token's serial and label
+func (tok *pivToken) openCard() error {
+	cards, err := piv.Cards()
+	if err != nil {
+		return fmt.Errorf("listing smart cards: %w", err)
+	}
+	var lastErr error
+	for _, card := range cards {
+		if !strings.Contains(strings.ToLower(card), strings.ToLower(tok.tconf.Label)) {
+			continue
+		}
+		yk, err := piv.Open(card)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		serial, err := yk.Serial()
+		if err != nil {
+			yk.Close()
+			lastErr = err
+			continue
+		}
+		if tok.tconf.Serial != "" && tok.tconf.Serial != strconv.FormatUint(uint64(serial), 10) {
+			yk.Close()
+			continue
+		}
+		tok.yk = yk
+		tok.serial = serial
+		return nil
+	}
+	if lastErr != nil {
+		return fmt.Errorf("opening PIV card: %w", lastErr)
+	}
+	return fmt.Errorf("no PIV card found matching token %s", tok.tconf.Name())
+}
+
+func (tok *pivToken) login(prompt passprompt.PasswordGetter) error {
+	loginFunc := func(pin string) (bool, error) {
+		var authErr piv.AuthErr
+		if err := tok.yk.VerifyPIN(pin); err == nil {
+			tok.pin = pin
+			return true, nil
+		} else if errors.As(err, &authErr) {
+			if authErr.Retries == 0 {
+				return false, errors.New("PIN is blocked")
+			}
+			return false, nil
+		} else {
+			return false, err
+		}
+	}
+	serial := strconv.FormatUint(uint64(tok.serial), 10)
+	initialPrompt := fmt.Sprintf("PIN for token %s (serial %s): ", tok.tconf.Name(), serial)
+	return token.Login(tok.tconf, prompt, loginFunc, serial, initialPrompt)
+}
+
+func (tok *pivToken) Close() error {
+	tok.mu.Lock()
+	defer tok.mu.Unlock()
+	if tok.yk == nil {
+		return nil
+	}
+	err := tok.yk.Close()
+	tok.yk = nil
+	return err
+}
+
+func (tok *pivToken) Ping(ctx context.Context) error {
+	tok.mu.Lock()
+	defer tok.mu.Unlock()
+	_, err := tok.yk.Serial()
+	return err
+}
+
+// Health checks the device like Ping and reports its remaining PIN attempts
+func (tok *pivToken) Health(ctx context.Context) (*token.Health, error) {
+	tok.mu.Lock()
+	defer tok.mu.Unlock()
+	serial, err := tok.yk.Serial()
+	if err != nil {
+		return nil, err
+	}
+	h := &token.Health{Slot: fmt.Sprintf("YubiKey serial %d", serial)}
+	retries, err := tok.yk.Retries()
+	if err != nil {
+		return nil, err
+	}
+	h.PINRetries = &retries
+	if retries <= 1 {
+		h.Warnings = append(h.Warnings, fmt.Sprintf("%d PIN attempts remain", retries))
+	}
+	return h, nil
+}
+
+func (tok *pivToken) Config() *config.TokenConfig {
+	return tok.tconf
+}
+
+// parse a slot in hex, e.g. 9a 9c 9d 9e or a retired slot 82-95
+func parseSlot(id string) (piv.Slot, error) {
+	v, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(id), "0x"), 16, 8)
+	if err == nil {
+		switch v {
+		case 0x9a:
+			return piv.SlotAuthentication, nil
+		case 0x9c:
+			return piv.SlotSignature, nil
+		case 0x9d:
+			return piv.SlotKeyManagement, nil
+		case 0x9e:
+			return piv.SlotCardAuthentication, nil
+		}
+		if slot, ok := piv.RetiredKeyManagementSlot(uint32(v)); ok {
+			return slot, nil
+		}
+	}
+	return piv.Slot{}, fmt.Errorf("invalid PIV slot %q", id)
+}
+
+func (tok *pivToken) GetKey(ctx context.Context, keyName string) (token.Key, error) {
+	keyConf, err := tok.config.GetKey(keyName)
+	if err != nil {
+		return nil, err
+	}
+	slot, err := parseSlot(keyConf.ID)
+	if err != nil {
+		return nil, fmt.Errorf("key %q: %w", keyName, err)
+	}
+	tok.mu.Lock()
+	defer tok.mu.Unlock()
+	key := &pivKey{kconf: keyConf, tok: tok, slot: slot}
+	if cert, err := tok.yk.Certificate(slot); err == nil {
+		key.cert = cert
+		key.pub = cert.PublicKey
+	} else if attest, err2 := tok.yk.Attest(slot); err2 == nil {
+		// no certificate loaded yet, but a key generated on the device can
+		// still be attested
+		key.pub = attest.PublicKey
+	} else {
+		return nil, fmt.Errorf("key %q: reading slot %s: %w", keyName, keyConf.ID, err)
+	}
+	return key, nil
+}
+
+func (tok *pivToken) Import(keyName string, privKey crypto.PrivateKey) (token.Key, error) {
+	return nil, token.NotImplementedError{Op: "import-key", Type: tokenType}
+}
+
+func (tok *pivToken) ImportCertificate(cert *x509.Certificate, labelBase string) error {
+	return token.NotImplementedError{Op: "import-certificate", Type: tokenType}
+}
+
+func (tok *pivToken) managementKey() ([24]byte, error) {
+	if tok.tconf.ManagementKey == "" {
+		return piv.DefaultManagementKey, nil
+	}
+	var key [24]byte
+	raw, err := hex.DecodeString(tok.tconf.ManagementKey)
+	if err != nil || len(raw) != len(key) {
+		return key, errors.New("managementkey must be 48 hex digits")
+	}
+	copy(key[:], raw)
+	return key, nil
+}
+
+func (tok *pivToken) Generate(keyName string, keyType token.KeyType, bits uint) (token.Key, error) {
+	var alg piv.Algorithm
+	switch {
+	case keyType == token.KeyTypeRsa && bits == 1024:
+		alg = piv.AlgorithmRSA1024
+	case keyType == token.KeyTypeRsa && bits == 2048:
+		alg = piv.AlgorithmRSA2048
+	case keyType == token.KeyTypeEcdsa && bits == 256:
+		alg = piv.AlgorithmEC256
+	case keyType == token.KeyTypeEcdsa && bits == 384:
+		alg = piv.AlgorithmEC384
+	default:
+		return nil, fmt.Errorf("PIV does not support %d-bit keys of this type", bits)
+	}
+	return tok.generate(keyName, alg)
+}
+
+func (tok *pivToken) GenerateCurve(keyName, curveName string) (token.Key, error) {
+	switch strings.ToLower(curveName) {
+	case "ed25519":
+		return tok.generate(keyName, piv.AlgorithmEd25519)
+	case "p256", "p-256", "prime256v1", "secp256r1":
+		return tok.generate(keyName, piv.AlgorithmEC256)
+	case "p384", "p-384", "secp384r1":
+		return tok.generate(keyName, piv.AlgorithmEC384)
+	default:
+		return nil, fmt.Errorf("PIV does not support curve %q", curveName)
+	}
+}
+
+func (tok *pivToken) generate(keyName string, alg piv.Algorithm) (token.Key, error) {
+	keyConf, err := tok.config.GetKey(keyName)
+	if err != nil {
+		return nil, err
+	}
+	slot, err := parseSlot(keyConf.ID)
+	if err != nil {
+		return nil, fmt.Errorf("key %q: %w", keyName, err)
+	}
+	mgmt, err := tok.managementKey()
+	if err != nil {
+		return nil, err
+	}
+	opts := piv.Key{Algorithm: alg}
+	switch strings.ToLower(keyConf.PINPolicy) {
+	case "":
+	case "never":
+		opts.PINPolicy = piv.PINPolicyNever
+	case "once":
+		opts.PINPolicy = piv.PINPolicyOnce
+	case "always":
+		opts.PINPolicy = piv.PINPolicyAlways
+	default:
+		return nil, fmt.Errorf("key %q: pinpolicy must be one of: never once always", keyName)
+	}
+	switch strings.ToLower(keyConf.TouchPolicy) {
+	case "":
+	case "never":
+		opts.TouchPolicy = piv.TouchPolicyNever
+	case "cached":
+		opts.TouchPolicy = piv.TouchPolicyCached
+	case "always":
+		opts.TouchPolicy = piv.TouchPolicyAlways
+	default:
+		return nil, fmt.Errorf("key %q: touchpolicy must be one of: never cached always", keyName)
+	}
+	tok.mu.Lock()
+	defer tok.mu.Unlock()
+	pub, err := tok.yk.GenerateKey(mgmt, slot, opts)
+	if err != nil {
+		return nil, fmt.Errorf("generating key: %w", err)
+	}
+	return &pivKey{kconf: keyConf, tok: tok, slot: slot, pub: pub}, nil
+}
+
+func (tok *pivToken) ListKeys(opts token.ListOptions) error {
+	slots := []piv.Slot{piv.SlotAuthentication, piv.SlotSignature, piv.SlotKeyManagement, piv.SlotCardAuthentication}
+	for i := uint32(0x82); i <= 0x95; i++ {
+		slot, _ := piv.RetiredKeyManagementSlot(i)
+		slots = append(slots, slot)
+	}
+	tok.mu.Lock()
+	defer tok.mu.Unlock()
+	for _, slot := range slots {
+		id := fmt.Sprintf("%x", slot.Key)
+		if opts.ID != "" && !strings.EqualFold(opts.ID, id) {
+			continue
+		}
+		cert, err := tok.yk.Certificate(slot)
+		if err != nil {
+			continue
+		}
+		if opts.Label != "" && cert.Subject.CommonName != opts.Label {
+			continue
+		}
+		fmt.Fprintf(opts.Output, "id:      %s\n", id)
+		fmt.Fprintf(opts.Output, "subject: %s\n", x509tools.FormatSubject(cert))
+		fmt.Fprintf(opts.Output, "expires: %s\n", cert.NotAfter)
+		if attest, err := tok.yk.Attest(slot); err == nil {
+			if a, err := attestation.Parse(attest); err == nil {
+				fmt.Fprintf(opts.Output, "policy:  pin=%s touch=%s\n", a.PINPolicy, a.TouchPolicy)
+			}
+		}
+		if opts.Values {
+			_ = pem.Encode(opts.Output, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+		}
+		fmt.Fprintln(opts.Output)
+	}
+	return nil
+}
+
+func (k *pivKey) Public() crypto.PublicKey {
+	return k.pub
+}
+
+func (k *pivKey) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) (signature []byte, err error) {
+	return k.SignContext(context.Background(), digest, opts)
+}
+
+func (k *pivKey) SignContext(ctx context.Context, digest []byte, opts crypto.SignerOpts) (signature []byte, err error) {
+	switch k.pub.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+	default:
+		return nil, token.KeyUsageError{
+			Key: k.kconf.Name(),
+			Err: fmt.Errorf("unsupported public key type %T", k.pub),
+		}
+	}
+	k.tok.mu.Lock()
+	defer k.tok.mu.Unlock()
+	priv, err := k.tok.yk.PrivateKey(k.slot, k.pub, piv.KeyAuth{PIN: k.tok.pin})
+	if err != nil {
+		return nil, err
+	}
+	return priv.(crypto.Signer).Sign(nil, digest, opts)
+}
+
+func (k *pivKey) Config() *config.KeyConfig {
+	return k.kconf
+}
+
+func (k *pivKey) Certificate() []byte {
+	if k.cert == nil {
+		return nil
+	}
+	return k.cert.Raw
+}
+
+func (k *pivKey) GetID() []byte {
+	return []byte{byte(k.slot.Key)}
+}
+
+func (k *pivKey) ImportCertificate(cert *x509.Certificate) error {
+	mgmt, err := k.tok.managementKey()
+	if err != nil {
+		return err
+	}
+	k.tok.mu.Lock()
+	defer k.tok.mu.Unlock()
+	if err := k.tok.yk.SetCertificate(mgmt, k.slot, cert); err != nil {
+		return err
+	}
+	k.cert = cert
+	return nil
+}
+
+// Attest returns the device's attestation of this key, followed by the
+// device's attestation certificate, in the form expected by the attestation
+// package
+func (k *pivKey) Attest(ctx context.Context) ([]byte, error) {
+	k.tok.mu.Lock()
+	defer k.tok.mu.Unlock()
+	leaf, err := k.tok.yk.Attest(k.slot)
+	if err != nil {
+		return nil, err
+	}
+	intermediate, err := k.tok.yk.AttestationCertificate()
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]byte{}, leaf.Raw...), intermediate.Raw...), nil
+}
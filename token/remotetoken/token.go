@@ -0,0 +1,236 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package remotetoken implements a token that delegates signing operations to
+// another relic server over gRPC. Package formats are handled locally, so only
+// digests and signatures cross the network.
+package remotetoken
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+
+	"github.com/sassoftware/relic/v7/config"
+	"github.com/sassoftware/relic/v7/internal/tokenrpc"
+	"github.com/sassoftware/relic/v7/internal/workerrpc"
+	"github.com/sassoftware/relic/v7/lib/certloader"
+	"github.com/sassoftware/relic/v7/lib/passprompt"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+	"github.com/sassoftware/relic/v7/token"
+)
+
+const tokenType = "relic"
+
+type remoteToken struct {
+	config *config.Config
+	tconf  *config.TokenConfig
+	conn   *grpc.ClientConn
+}
+
+type remoteKey struct {
+	kconf  *config.KeyConfig
+	tok    *remoteToken
+	public crypto.PublicKey
+	id     []byte
+	cert   []byte
+}
+
+func init() {
+	token.Openers[tokenType] = open
+}
+
+func open(conf *config.Config, tokenName string, pinProvider passprompt.PasswordGetter) (token.Token, error) {
+	tconf, err := conf.GetToken(tokenName)
+	if err != nil {
+		return nil, err
+	}
+	if tconf.Endpoint == "" {
+		return nil, fmt.Errorf("token %q must have \"endpoint\" set to the host:port of the upstream server", tokenName)
+	}
+	tlsconf := &tls.Config{MinVersion: tls.VersionTLS12}
+	if err := x509tools.LoadCertPool(tconf.CaCert, tlsconf); err != nil {
+		return nil, err
+	}
+	if tconf.CertFile == "" {
+		return nil, fmt.Errorf("token %q must have \"certfile\" and \"keyfile\" set to authenticate to the upstream server", tokenName)
+	}
+	cert, err := certloader.LoadX509KeyPair(tconf.CertFile, tconf.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsconf.Certificates = []tls.Certificate{cert.TLS()}
+	x509tools.SetKeyLogFile(tlsconf)
+	// connecting is lazy, so this doesn't block on the upstream server
+	conn, err := grpc.Dial(tconf.Endpoint, grpc.WithTransportCredentials(credentials.NewTLS(tlsconf)))
+	if err != nil {
+		return nil, err
+	}
+	return &remoteToken{
+		config: conf,
+		tconf:  tconf,
+		conn:   conn,
+	}, nil
+}
+
+func (t *remoteToken) Close() error {
+	return t.conn.Close()
+}
+
+func (t *remoteToken) request(ctx context.Context, method string, rr *workerrpc.Request) (*workerrpc.Response, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		timeout := time.Minute
+		if t.tconf.Timeout != 0 {
+			timeout = time.Second * time.Duration(t.tconf.Timeout)
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	resp, err := tokenrpc.Invoke(ctx, t.conn, method, rr)
+	if err != nil {
+		return nil, convertError(rr.KeyName, err)
+	}
+	return resp, nil
+}
+
+// map status codes set by the upstream server back to token errors
+func convertError(keyName string, err error) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	switch st.Code() {
+	case codes.FailedPrecondition:
+		return token.KeyUsageError{Key: keyName, Err: errors.New(st.Message())}
+	case codes.Unimplemented:
+		return token.NotImplementedError{Op: "remote", Type: tokenType}
+	default:
+		return fmt.Errorf("upstream server: %s", st.Message())
+	}
+}
+
+func (t *remoteToken) Ping(ctx context.Context) error {
+	_, err := t.request(ctx, tokenrpc.MethodPing, &workerrpc.Request{})
+	return err
+}
+
+func (t *remoteToken) Config() *config.TokenConfig {
+	return t.tconf
+}
+
+// the name of the key on the upstream server defaults to the local name
+func upstreamName(kconf *config.KeyConfig) string {
+	if kconf.Label != "" {
+		return kconf.Label
+	}
+	return kconf.Name()
+}
+
+func (t *remoteToken) GetKey(ctx context.Context, keyName string) (token.Key, error) {
+	kconf, err := t.config.GetKey(keyName)
+	if err != nil {
+		return nil, err
+	}
+	res, err := t.request(ctx, tokenrpc.MethodGetKey, &workerrpc.Request{
+		KeyName: upstreamName(kconf),
+		KeyID:   token.KeyID(ctx),
+	})
+	if err != nil {
+		return nil, err
+	}
+	pub, err := x509.ParsePKIXPublicKey(res.Value)
+	if err != nil {
+		return nil, err
+	}
+	return &remoteKey{
+		kconf:  kconf,
+		tok:    t,
+		public: pub,
+		id:     res.ID,
+		cert:   res.Cert,
+	}, nil
+}
+
+func (t *remoteToken) Import(keyName string, privKey crypto.PrivateKey) (token.Key, error) {
+	return nil, token.NotImplementedError{Op: "import-key", Type: tokenType}
+}
+
+func (t *remoteToken) ImportCertificate(cert *x509.Certificate, labelBase string) error {
+	return token.NotImplementedError{Op: "import-certificate", Type: tokenType}
+}
+
+func (t *remoteToken) Generate(keyName string, keyType token.KeyType, bits uint) (token.Key, error) {
+	return nil, token.NotImplementedError{Op: "generate-key", Type: tokenType}
+}
+
+func (t *remoteToken) ListKeys(opts token.ListOptions) error {
+	return token.NotImplementedError{Op: "list-keys", Type: tokenType}
+}
+
+func (k *remoteKey) Config() *config.KeyConfig {
+	return k.kconf
+}
+
+func (k *remoteKey) Certificate() []byte {
+	return k.cert
+}
+
+func (k *remoteKey) Public() crypto.PublicKey {
+	return k.public
+}
+
+func (k *remoteKey) GetID() []byte {
+	return k.id
+}
+
+func (k *remoteKey) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return k.SignContext(context.Background(), digest, opts)
+}
+
+func (k *remoteKey) SignContext(ctx context.Context, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	rr := &workerrpc.Request{
+		KeyName: upstreamName(k.kconf),
+		KeyID:   k.id,
+		Digest:  digest,
+	}
+	if opts != nil {
+		rr.Hash = uint(opts.HashFunc())
+		if o, ok := opts.(*rsa.PSSOptions); ok {
+			rr.SaltLength = &o.SaltLength
+		}
+	}
+	res, err := k.tok.request(ctx, tokenrpc.MethodSign, rr)
+	if err != nil {
+		return nil, err
+	}
+	return res.Value, nil
+}
+
+func (k *remoteKey) ImportCertificate(cert *x509.Certificate) error {
+	return token.NotImplementedError{Op: "import-certificate", Type: tokenType}
+}
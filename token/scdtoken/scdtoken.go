@@ -20,6 +20,7 @@ import (
 	"context"
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
@@ -203,6 +204,8 @@ func (tok *scdToken) ListKeys(opts token.ListOptions) error {
 					fmt.Fprintf(opts.Output, " bits:        %d\n", curve.Bits)
 				}
 				fmt.Fprintf(opts.Output, " x:           %x\n y:           %x\n", k.X, k.Y)
+			case ed25519.PublicKey:
+				fmt.Fprintf(opts.Output, " ed25519:     %x\n", []byte(k))
 			}
 		}
 	}
@@ -224,7 +227,7 @@ func (tok *scdToken) GetKey(ctx context.Context, keyName string) (token.Key, err
 		key = kc
 		break
 	}
-	if key.KeyId == "" {
+	if key == nil {
 		return nil, fmt.Errorf("key %s not found in token %s", keyName, tok.tokenConf.Name())
 	}
 	pubkey, err := key.Public()
@@ -0,0 +1,312 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package sshagenttoken implements a token backed by an SSH agent, including
+// forwarded agents and agents fronting hardware keys. Keys are selected by
+// SHA-256 fingerprint in the id field or by comment in the label field.
+//
+// An agent hashes the message itself, so RSA and ECDSA keys can only be used
+// by signers that sign a complete message through token.DataSigner, such as
+// SSH signatures. Ed25519 keys also work as a regular crypto.Signer.
+package sshagenttoken
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+
+	"github.com/sassoftware/relic/v7/config"
+	"github.com/sassoftware/relic/v7/lib/passprompt"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+	"github.com/sassoftware/relic/v7/token"
+)
+
+const tokenType = "ssh-agent"
+
+type agentToken struct {
+	config *config.Config
+	tconf  *config.TokenConfig
+	socket string
+}
+
+type agentKey struct {
+	kconf  *config.KeyConfig
+	tok    *agentToken
+	sshPub ssh.PublicKey
+	pub    crypto.PublicKey
+}
+
+func init() {
+	token.Openers[tokenType] = open
+}
+
+func open(conf *config.Config, tokenName string, pinProvider passprompt.PasswordGetter) (token.Token, error) {
+	tconf, err := conf.GetToken(tokenName)
+	if err != nil {
+		return nil, err
+	}
+	socket := tconf.Endpoint
+	if socket == "" {
+		socket = os.Getenv("SSH_AUTH_SOCK")
+	}
+	if socket == "" {
+		return nil, fmt.Errorf("token %q: SSH_AUTH_SOCK is not set and no endpoint is configured", tokenName)
+	}
+	return &agentToken{
+		config: conf,
+		tconf:  tconf,
+		socket: socket,
+	}, nil
+}
+
+// Each operation uses its own connection, so a restarted or re-forwarded
+// agent is picked up without reopening the token
+func (t *agentToken) withAgent(ctx context.Context, f func(agent.ExtendedAgent) error) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", t.socket)
+	if err != nil {
+		return fmt.Errorf("connecting to ssh-agent: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	return f(agent.NewClient(conn))
+}
+
+func (t *agentToken) Close() error {
+	return nil
+}
+
+func (t *agentToken) Ping(ctx context.Context) error {
+	return t.withAgent(ctx, func(a agent.ExtendedAgent) error {
+		_, err := a.List()
+		return err
+	})
+}
+
+func (t *agentToken) Config() *config.TokenConfig {
+	return t.tconf
+}
+
+func (t *agentToken) GetKey(ctx context.Context, keyName string) (token.Key, error) {
+	keyConf, err := t.config.GetKey(keyName)
+	if err != nil {
+		return nil, err
+	}
+	if keyConf.ID == "" && keyConf.Label == "" {
+		return nil, fmt.Errorf("key %q must have \"id\" set to a SHA256 fingerprint or \"label\" set to a key comment", keyName)
+	}
+	var found *agent.Key
+	err = t.withAgent(ctx, func(a agent.ExtendedAgent) error {
+		keys, err := a.List()
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if keyMatches(key, keyConf.ID, keyConf.Label) {
+				found = key
+				return nil
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	} else if found == nil {
+		return nil, fmt.Errorf("key %q not found in ssh-agent", keyName)
+	}
+	parsed, err := ssh.ParsePublicKey(found.Blob)
+	if err != nil {
+		return nil, fmt.Errorf("key %q: %w", keyName, err)
+	}
+	// security key signatures include extra data, so only plain keys work
+	cpub, ok := parsed.(ssh.CryptoPublicKey)
+	if !ok || strings.HasPrefix(found.Type(), "sk-") {
+		return nil, fmt.Errorf("key %q: unsupported key type %s", keyName, found.Type())
+	}
+	return &agentKey{
+		kconf:  keyConf,
+		tok:    t,
+		sshPub: found,
+		pub:    cpub.CryptoPublicKey(),
+	}, nil
+}
+
+func keyMatches(key *agent.Key, id, label string) bool {
+	if id != "" && ssh.FingerprintSHA256(key) != id {
+		return false
+	}
+	if label != "" && key.Comment != label {
+		return false
+	}
+	return true
+}
+
+func (t *agentToken) Import(keyName string, privKey crypto.PrivateKey) (token.Key, error) {
+	return nil, token.NotImplementedError{Op: "import-key", Type: tokenType}
+}
+
+func (t *agentToken) ImportCertificate(cert *x509.Certificate, labelBase string) error {
+	return token.NotImplementedError{Op: "import-certificate", Type: tokenType}
+}
+
+func (t *agentToken) Generate(keyName string, keyType token.KeyType, bits uint) (token.Key, error) {
+	return nil, token.NotImplementedError{Op: "generate-key", Type: tokenType}
+}
+
+func (t *agentToken) ListKeys(opts token.ListOptions) error {
+	return t.withAgent(context.Background(), func(a agent.ExtendedAgent) error {
+		keys, err := a.List()
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if !keyMatches(key, opts.ID, opts.Label) {
+				continue
+			}
+			fmt.Fprintf(opts.Output, "id:      %s\n", ssh.FingerprintSHA256(key))
+			fmt.Fprintf(opts.Output, "label:   %s\n", key.Comment)
+			fmt.Fprintf(opts.Output, "type:    %s\n", key.Type())
+			if opts.Values {
+				opts.Output.Write(ssh.MarshalAuthorizedKey(key))
+			}
+			fmt.Fprintln(opts.Output)
+		}
+		return nil
+	})
+}
+
+func (k *agentKey) Public() crypto.PublicKey {
+	return k.pub
+}
+
+func (k *agentKey) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) (signature []byte, err error) {
+	return k.SignContext(context.Background(), digest, opts)
+}
+
+// SignContext signs a message with an Ed25519 key. Other key types can't sign
+// a prehashed digest.
+func (k *agentKey) SignContext(ctx context.Context, digest []byte, opts crypto.SignerOpts) (signature []byte, err error) {
+	if _, ok := k.pub.(ed25519.PublicKey); !ok || opts.HashFunc() != 0 {
+		return nil, token.KeyUsageError{
+			Key: k.kconf.Name(),
+			Err: errors.New("ssh-agent can only sign complete messages, not digests"),
+		}
+	}
+	return k.SignData(ctx, digest, opts)
+}
+
+// SignData signs a complete message, hashing it with the digest given in opts
+func (k *agentKey) SignData(ctx context.Context, data []byte, opts crypto.SignerOpts) (signature []byte, err error) {
+	var flags agent.SignatureFlags
+	switch pub := k.pub.(type) {
+	case *rsa.PublicKey:
+		switch opts.HashFunc() {
+		case crypto.SHA1:
+		case crypto.SHA256:
+			flags = agent.SignatureFlagRsaSha256
+		case crypto.SHA512:
+			flags = agent.SignatureFlagRsaSha512
+		default:
+			return nil, k.usageError(fmt.Errorf("ssh-agent can't sign RSA with digest %s", opts.HashFunc()))
+		}
+		if _, ok := opts.(*rsa.PSSOptions); ok {
+			return nil, k.usageError(errors.New("ssh-agent can't make RSA-PSS signatures"))
+		}
+	case *ecdsa.PublicKey:
+		// the curve decides the digest
+		if want := curveHash(pub); opts.HashFunc() != want {
+			return nil, k.usageError(fmt.Errorf("ssh-agent signs with digest %s for this key", want))
+		}
+	case ed25519.PublicKey:
+		if opts.HashFunc() != 0 {
+			return nil, k.usageError(errors.New("ed25519 keys can't sign with a digest"))
+		}
+	}
+	var sig *ssh.Signature
+	err = k.tok.withAgent(ctx, func(a agent.ExtendedAgent) error {
+		var err error
+		sig, err = a.SignWithFlags(k.sshPub, data, flags)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return unpackSignature(sig)
+}
+
+func (k *agentKey) usageError(err error) error {
+	return token.KeyUsageError{Key: k.kconf.Name(), Err: err}
+}
+
+func curveHash(pub *ecdsa.PublicKey) crypto.Hash {
+	switch pub.Curve.Params().BitSize {
+	case 256:
+		return crypto.SHA256
+	case 384:
+		return crypto.SHA384
+	default:
+		return crypto.SHA512
+	}
+}
+
+// convert a signature from SSH wire format to the form crypto.Signer returns
+func unpackSignature(sig *ssh.Signature) ([]byte, error) {
+	switch sig.Format {
+	case ssh.KeyAlgoRSA, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoED25519:
+		return sig.Blob, nil
+	case ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521:
+		var ecSig struct {
+			R, S *big.Int
+		}
+		if err := ssh.Unmarshal(sig.Blob, &ecSig); err != nil {
+			return nil, err
+		}
+		return x509tools.EcdsaSignature{R: ecSig.R, S: ecSig.S}.Marshal(), nil
+	default:
+		return nil, fmt.Errorf("unsupported ssh signature format %s", sig.Format)
+	}
+}
+
+func (k *agentKey) Config() *config.KeyConfig {
+	return k.kconf
+}
+
+func (k *agentKey) Certificate() []byte {
+	return nil
+}
+
+func (k *agentKey) GetID() []byte {
+	return []byte(ssh.FingerprintSHA256(k.sshPub))
+}
+
+func (k *agentKey) ImportCertificate(cert *x509.Certificate) error {
+	return token.NotImplementedError{Op: "import-certificate", Type: tokenType}
+}
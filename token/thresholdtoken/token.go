@@ -0,0 +1,316 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package thresholdtoken implements a composite token where each signature
+// must first be approved by M of N approver keys held on other tokens, such as
+// operators' YubiKeys, before the signing key on another token is used.
+package thresholdtoken
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/sassoftware/relic/v7/config"
+	"github.com/sassoftware/relic/v7/lib/passprompt"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+	"github.com/sassoftware/relic/v7/token"
+)
+
+const (
+	tokenType      = "threshold"
+	approvalPrefix = "relic threshold approval\x00"
+)
+
+type thresholdToken struct {
+	config *config.Config
+	tconf  *config.TokenConfig
+	prompt passprompt.PasswordGetter
+
+	mu     sync.Mutex
+	tokens map[string]token.Token
+}
+
+type thresholdKey struct {
+	token.Key
+	kconf     *config.KeyConfig
+	approvers []token.Key
+	// public key of each approver, so each key counts once
+	approverIDs []string
+	threshold   int
+}
+
+func init() {
+	token.Openers[tokenType] = open
+}
+
+func open(conf *config.Config, tokenName string, pinProvider passprompt.PasswordGetter) (token.Token, error) {
+	tconf, err := conf.GetToken(tokenName)
+	if err != nil {
+		return nil, err
+	}
+	return &thresholdToken{
+		config: conf,
+		tconf:  tconf,
+		prompt: pinProvider,
+		tokens: make(map[string]token.Token),
+	}, nil
+}
+
+func (t *thresholdToken) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var errs []string
+	for name, tok := range t.tokens {
+		if err := tok.Close(); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", name, err))
+		}
+	}
+	t.tokens = make(map[string]token.Token)
+	if len(errs) != 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Ping checks every component token that has been opened
+func (t *thresholdToken) Ping(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for name, tok := range t.tokens {
+		if err := tok.Ping(ctx); err != nil {
+			return fmt.Errorf("token %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (t *thresholdToken) Config() *config.TokenConfig {
+	return t.tconf
+}
+
+// openKey opens a component key, opening its token if needed
+func (t *thresholdToken) openKey(ctx context.Context, keyName string) (token.Key, error) {
+	kconf, err := t.config.GetKey(keyName)
+	if err != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	tok := t.tokens[kconf.Token]
+	if tok == nil {
+		tok, err = t.openToken(kconf.Token)
+		if err != nil {
+			t.mu.Unlock()
+			return nil, err
+		}
+		t.tokens[kconf.Token] = tok
+	}
+	t.mu.Unlock()
+	return tok.GetKey(ctx, keyName)
+}
+
+func (t *thresholdToken) openToken(tokenName string) (token.Token, error) {
+	tconf, err := t.config.GetToken(tokenName)
+	if err != nil {
+		return nil, err
+	}
+	if tconf.Type == tokenType {
+		return nil, fmt.Errorf("token %q: threshold tokens can't be nested", tokenName)
+	}
+	ofunc := token.Openers[tconf.Type]
+	if ofunc == nil {
+		return nil, fmt.Errorf("token %q: unknown token type %s", tokenName, tconf.Type)
+	}
+	return ofunc(t.config, tokenName, t.prompt)
+}
+
+func (t *thresholdToken) GetKey(ctx context.Context, keyName string) (token.Key, error) {
+	kconf, err := t.config.GetKey(keyName)
+	if err != nil {
+		return nil, err
+	}
+	if kconf.Signer == "" {
+		return nil, fmt.Errorf("key %q must have \"signer\" set to the key that produces signatures", keyName)
+	}
+	threshold := kconf.Threshold
+	if threshold == 0 {
+		threshold = len(kconf.Approvers)
+	}
+	if threshold < 1 || threshold > len(kconf.Approvers) {
+		return nil, fmt.Errorf("key %q: threshold must be between 1 and the number of approvers", keyName)
+	}
+	signer, err := t.openKey(ctx, kconf.Signer)
+	if err != nil {
+		return nil, fmt.Errorf("key %q: signer: %w", keyName, err)
+	}
+	key := &thresholdKey{
+		Key:       signer,
+		kconf:     kconf,
+		threshold: threshold,
+	}
+	// a key listed twice, or the signer also approving, would let one key
+	// holder meet the threshold alone
+	names := make(map[string]bool)
+	seen := make(map[string]string)
+	if _, err := distinctKey(seen, kconf.Signer, signer); err != nil {
+		return nil, fmt.Errorf("key %q: %w", keyName, err)
+	}
+	for _, name := range kconf.Approvers {
+		if names[name] {
+			return nil, fmt.Errorf("key %q: approver %s is listed more than once", keyName, name)
+		}
+		names[name] = true
+		approver, err := t.openKey(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: approver %s: %w", keyName, name, err)
+		}
+		id, err := distinctKey(seen, name, approver)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", keyName, err)
+		}
+		key.approvers = append(key.approvers, approver)
+		key.approverIDs = append(key.approverIDs, id)
+	}
+	return key, nil
+}
+
+// distinctKey records the key's public key in seen and returns it as an
+// identifier, or returns an error if another key had the same public key
+func distinctKey(seen map[string]string, name string, key token.Key) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+	id := string(der)
+	if other, ok := seen[id]; ok {
+		return "", fmt.Errorf("%s and %s are the same key", other, name)
+	}
+	seen[id] = name
+	return id, nil
+}
+
+func (t *thresholdToken) Import(keyName string, privKey crypto.PrivateKey) (token.Key, error) {
+	return nil, token.NotImplementedError{Op: "import-key", Type: tokenType}
+}
+
+func (t *thresholdToken) ImportCertificate(cert *x509.Certificate, labelBase string) error {
+	return token.NotImplementedError{Op: "import-certificate", Type: tokenType}
+}
+
+func (t *thresholdToken) Generate(keyName string, keyType token.KeyType, bits uint) (token.Key, error) {
+	return nil, token.NotImplementedError{Op: "generate-key", Type: tokenType}
+}
+
+// ListKeys shows the keys configured on this token and who must approve them
+func (t *thresholdToken) ListKeys(opts token.ListOptions) error {
+	for name, kconf := range t.config.Keys {
+		if kconf.Token != t.tconf.Name() || kconf.Alias != "" {
+			continue
+		}
+		if opts.Label != "" && opts.Label != name {
+			continue
+		}
+		threshold := kconf.Threshold
+		if threshold == 0 {
+			threshold = len(kconf.Approvers)
+		}
+		fmt.Fprintf(opts.Output, "label:     %s\n", name)
+		fmt.Fprintf(opts.Output, "signer:    %s\n", kconf.Signer)
+		fmt.Fprintf(opts.Output, "approvers: %s\n", strings.Join(kconf.Approvers, ", "))
+		fmt.Fprintf(opts.Output, "threshold: %d of %d\n", threshold, len(kconf.Approvers))
+		fmt.Fprintln(opts.Output)
+	}
+	return nil
+}
+
+func (k *thresholdKey) Config() *config.KeyConfig {
+	return k.kconf
+}
+
+func (k *thresholdKey) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return k.SignContext(context.Background(), digest, opts)
+}
+
+// SignContext collects approvals one approver at a time, stopping as soon as
+// enough have been given, then signs with the signer key
+func (k *thresholdKey) SignContext(ctx context.Context, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	challenge := approvalChallenge(k.kconf.Name(), digest)
+	approved := make(map[string]bool)
+	var refusals []string
+	for i, approver := range k.approvers {
+		if len(approved) >= k.threshold {
+			break
+		} else if approved[k.approverIDs[i]] {
+			continue
+		}
+		if err := approve(ctx, approver, challenge); err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			refusals = append(refusals, fmt.Sprintf("%s: %s", k.kconf.Approvers[i], err))
+			continue
+		}
+		approved[k.approverIDs[i]] = true
+	}
+	if len(approved) < k.threshold {
+		return nil, token.KeyUsageError{
+			Key: k.kconf.Name(),
+			Err: fmt.Errorf("got %d of %d required approvals (%s)", len(approved), k.threshold, strings.Join(refusals, "; ")),
+		}
+	}
+	return k.Key.SignContext(ctx, digest, opts)
+}
+
+// The approvers sign a digest of the key name and the digest being signed, so
+// an approval can't be replayed for a different key or payload
+func approvalChallenge(keyName string, digest []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte(approvalPrefix))
+	h.Write([]byte(keyName))
+	h.Write([]byte{0})
+	h.Write(digest)
+	return h.Sum(nil)
+}
+
+// approve asks an approver key to sign the challenge and checks the result,
+// so a token that returns garbage doesn't count as an approval
+func approve(ctx context.Context, approver token.Key, challenge []byte) error {
+	if pub, ok := approver.Public().(ed25519.PublicKey); ok {
+		sig, err := approver.SignContext(ctx, challenge, crypto.Hash(0))
+		if err != nil {
+			return err
+		}
+		if !ed25519.Verify(pub, challenge, sig) {
+			return errors.New("approval signature is invalid")
+		}
+		return nil
+	}
+	sig, err := approver.SignContext(ctx, challenge, crypto.SHA256)
+	if err != nil {
+		return err
+	}
+	if err := x509tools.Verify(approver.Public(), crypto.SHA256, challenge, sig); err != nil {
+		return fmt.Errorf("approval signature is invalid: %w", err)
+	}
+	return nil
+}
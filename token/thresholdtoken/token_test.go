@@ -0,0 +1,126 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package thresholdtoken
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sassoftware/relic/v7/config"
+	"github.com/sassoftware/relic/v7/token"
+	_ "github.com/sassoftware/relic/v7/token/filetoken"
+)
+
+// Build a config with a file token holding a signer and three approver keys,
+// plus a threshold key named "release"
+func testConfig(t *testing.T, approvers []string, threshold int) *config.Config {
+	conf := new(config.Config)
+	conf.NewToken("file").Type = "file"
+	conf.NewToken("threshold").Type = tokenType
+	dir := t.TempDir()
+	for _, name := range []string{"signer", "alice", "bob", "carol"} {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		require.NoError(t, err)
+		path := filepath.Join(dir, name+".key")
+		require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600))
+		kconf := conf.NewKey(name)
+		kconf.Token = "file"
+		kconf.KeyFile = path
+	}
+	// same key file as alice under another name
+	again := conf.NewKey("alice-again")
+	again.Token = "file"
+	again.KeyFile = conf.Keys["alice"].KeyFile
+	kconf := conf.NewKey("release")
+	kconf.Token = "threshold"
+	kconf.Signer = "signer"
+	kconf.Approvers = approvers
+	kconf.Threshold = threshold
+	return conf
+}
+
+func getKey(t *testing.T, conf *config.Config) (token.Key, error) {
+	tok, err := open(conf, "threshold", nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { tok.Close() })
+	return tok.GetKey(context.Background(), "release")
+}
+
+// refusingKey is an approver that declines to approve
+type refusingKey struct {
+	token.Key
+}
+
+func (refusingKey) SignContext(context.Context, []byte, crypto.SignerOpts) ([]byte, error) {
+	return nil, errors.New("declined")
+}
+
+func TestThresholdMet(t *testing.T) {
+	key, err := getKey(t, testConfig(t, []string{"alice", "bob", "carol"}, 2))
+	require.NoError(t, err)
+	digest := sha256.Sum256([]byte("payload"))
+	sig, err := key.SignContext(context.Background(), digest[:], crypto.SHA256)
+	require.NoError(t, err)
+	assert.True(t, ecdsa.VerifyASN1(key.Public().(*ecdsa.PublicKey), digest[:], sig))
+}
+
+func TestThresholdNotMet(t *testing.T) {
+	key, err := getKey(t, testConfig(t, []string{"alice", "bob", "carol"}, 2))
+	require.NoError(t, err)
+	tkey := key.(*thresholdKey)
+	tkey.approvers[1] = refusingKey{tkey.approvers[1]}
+	tkey.approvers[2] = refusingKey{tkey.approvers[2]}
+	digest := sha256.Sum256([]byte("payload"))
+	_, err = key.SignContext(context.Background(), digest[:], crypto.SHA256)
+	var usageErr token.KeyUsageError
+	require.ErrorAs(t, err, &usageErr)
+	assert.ErrorContains(t, err, "got 1 of 2 required approvals")
+	assert.ErrorContains(t, err, "bob: declined")
+}
+
+func TestDuplicateApprovers(t *testing.T) {
+	cases := []struct {
+		name      string
+		approvers []string
+		err       string
+	}{
+		{"same name", []string{"alice", "alice", "bob"}, "approver alice is listed more than once"},
+		{"same key", []string{"alice", "alice-again"}, "alice and alice-again are the same key"},
+		{"signer approves", []string{"signer", "alice"}, "signer and signer are the same key"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := getKey(t, testConfig(t, c.approvers, 2))
+			assert.ErrorContains(t, err, c.err)
+		})
+	}
+}
@@ -30,8 +30,9 @@ type KeyType uint
 
 const (
 	// Values match CKK_RSA etc.
-	KeyTypeRsa   KeyType = 0
-	KeyTypeEcdsa KeyType = 3
+	KeyTypeRsa     KeyType = 0
+	KeyTypeEcdsa   KeyType = 3
+	KeyTypeEd25519 KeyType = 0x40
 )
 
 type Token interface {
@@ -53,6 +54,29 @@ type Token interface {
 	ListKeys(opts ListOptions) error
 }
 
+// CurveGenerator is implemented by tokens that can generate keys on a curve
+// selected by name, such as P-256 or ed25519, rather than by size
+type CurveGenerator interface {
+	GenerateCurve(keyName string, curveName string) (Key, error)
+}
+
+// Attester is implemented by keys whose device can produce an attestation that
+// the key was generated in hardware
+type Attester interface {
+	// Attest returns a DER attestation certificate for the key followed by
+	// any intermediate certificates, or a cloud HSM attestation bundle as
+	// produced by attestation.MarshalHSM
+	Attest(ctx context.Context) ([]byte, error)
+}
+
+// DataSigner is implemented by keys that can sign a complete message, which
+// is hashed by the token using the digest in opts. Keys that can't sign a
+// prehashed digest, such as those in an SSH agent, can still be used by
+// signers that check for this interface.
+type DataSigner interface {
+	SignData(ctx context.Context, data []byte, opts crypto.SignerOpts) ([]byte, error)
+}
+
 type Key interface {
 	crypto.Signer
 	SignContext(context.Context, []byte, crypto.SignerOpts) ([]byte, error)
@@ -56,3 +56,11 @@ func (c *Cache) GetKey(ctx context.Context, keyName string) (token.Key, error) {
 	}
 	return key, nil
 }
+
+// Health passes through to the underlying token, which is never cached
+func (c *Cache) Health(ctx context.Context) (*token.Health, error) {
+	if th, ok := c.Token.(token.TokenHealth); ok {
+		return th.Health(ctx)
+	}
+	return nil, c.Token.Ping(ctx)
+}
@@ -66,6 +66,16 @@ func (m Metrics) Ping(ctx context.Context) (err error) {
 	return m.Token.Ping(ctx)
 }
 
+func (m Metrics) Health(ctx context.Context) (h *token.Health, err error) {
+	defer func(start time.Time) {
+		observe(m.Token.Config().Name(), "health", start, err)
+	}(time.Now())
+	if th, ok := m.Token.(token.TokenHealth); ok {
+		return th.Health(ctx)
+	}
+	return nil, m.Token.Ping(ctx)
+}
+
 func (m Metrics) GetKey(ctx context.Context, keyName string) (key token.Key, err error) {
 	defer func(start time.Time) {
 		observe(m.Token.Config().Name(), "getKey", start, err)
@@ -0,0 +1,21 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package tpmtoken provides a token backed by keys stored in a TPM 2.0 device.
+// Keys are referenced by their persistent handle in the id field, and are
+// created as children of the storage root key. Use of a key can be bound to
+// the current values of a set of PCRs.
+package tpmtoken
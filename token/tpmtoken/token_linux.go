@@ -0,0 +1,421 @@
+//go:build linux
+// +build linux
+
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package tpmtoken
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpmutil"
+
+	"github.com/sassoftware/relic/v7/config"
+	"github.com/sassoftware/relic/v7/lib/passprompt"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+	"github.com/sassoftware/relic/v7/token"
+)
+
+const (
+	tokenType     = "tpm2"
+	defaultDevice = "/dev/tpmrm0"
+	// well-known handle of the storage root key
+	defaultSRK      = 0x81000001
+	persistentFirst = 0x81000000
+)
+
+type tpmToken struct {
+	config *config.Config
+	tconf  *config.TokenConfig
+	// the TPM processes one command at a time
+	mu  sync.Mutex
+	dev io.ReadWriteCloser
+}
+
+type tpmKey struct {
+	kconf  *config.KeyConfig
+	tok    *tpmToken
+	handle tpmutil.Handle
+	pub    crypto.PublicKey
+}
+
+func init() {
+	token.Openers[tokenType] = open
+}
+
+func open(conf *config.Config, tokenName string, pinProvider passprompt.PasswordGetter) (token.Token, error) {
+	tconf, err := conf.GetToken(tokenName)
+	if err != nil {
+		return nil, err
+	}
+	device := tconf.Provider
+	if device == "" {
+		device = defaultDevice
+	}
+	dev, err := tpmutil.OpenTPM(device)
+	if err != nil {
+		return nil, fmt.Errorf("opening TPM: %w", err)
+	}
+	return &tpmToken{
+		config: conf,
+		tconf:  tconf,
+		dev:    dev,
+	}, nil
+}
+
+func (t *tpmToken) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.dev == nil {
+		return nil
+	}
+	err := t.dev.Close()
+	t.dev = nil
+	return err
+}
+
+func (t *tpmToken) Ping(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, _, err := tpm2.GetCapability(t.dev, tpm2.CapabilityTPMProperties, 1, uint32(tpm2.Manufacturer))
+	return err
+}
+
+func (t *tpmToken) Config() *config.TokenConfig {
+	return t.tconf
+}
+
+// password used to authorize keys, and the SRK when creating keys
+func (t *tpmToken) password() string {
+	if t.tconf.Pin != nil {
+		return *t.tconf.Pin
+	}
+	return ""
+}
+
+func parseHandle(s string) (tpmutil.Handle, error) {
+	v, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(s), "0x"), 16, 32)
+	if err != nil || v < persistentFirst || v > persistentFirst+0xffffff {
+		return 0, fmt.Errorf("invalid persistent handle %q", s)
+	}
+	return tpmutil.Handle(v), nil
+}
+
+func (t *tpmToken) GetKey(ctx context.Context, keyName string) (token.Key, error) {
+	keyConf, err := t.config.GetKey(keyName)
+	if err != nil {
+		return nil, err
+	}
+	if keyConf.ID == "" {
+		return nil, fmt.Errorf("key %q must have \"id\" set to a persistent handle, e.g. 0x81000010", keyName)
+	}
+	handle, err := parseHandle(keyConf.ID)
+	if err != nil {
+		return nil, fmt.Errorf("key %q: %w", keyName, err)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	pub, err := readPublic(t.dev, handle)
+	if err != nil {
+		return nil, fmt.Errorf("key %q: %w", keyName, err)
+	}
+	return &tpmKey{
+		kconf:  keyConf,
+		tok:    t,
+		handle: handle,
+		pub:    pub,
+	}, nil
+}
+
+func readPublic(dev io.ReadWriter, handle tpmutil.Handle) (crypto.PublicKey, error) {
+	tpub, _, _, err := tpm2.ReadPublic(dev, handle)
+	if err != nil {
+		return nil, err
+	}
+	if tpub.Attributes&tpm2.FlagSign == 0 {
+		return nil, errors.New("not a signing key")
+	}
+	return tpub.Key()
+}
+
+func (t *tpmToken) Import(keyName string, privKey crypto.PrivateKey) (token.Key, error) {
+	return nil, token.NotImplementedError{Op: "import-key", Type: tokenType}
+}
+
+func (t *tpmToken) ImportCertificate(cert *x509.Certificate, labelBase string) error {
+	return token.NotImplementedError{Op: "import-certificate", Type: tokenType}
+}
+
+// Generate creates a key under the SRK and makes it persistent at the handle
+// given by the key's id. If the key config lists PCRs then the key can only be
+// used while those PCRs hold their current values.
+func (t *tpmToken) Generate(keyName string, keyType token.KeyType, bits uint) (token.Key, error) {
+	keyConf, err := t.config.GetKey(keyName)
+	if err != nil {
+		return nil, err
+	}
+	if keyConf.ID == "" {
+		return nil, fmt.Errorf("key %q must have \"id\" set to a persistent handle, e.g. 0x81000010", keyName)
+	}
+	handle, err := parseHandle(keyConf.ID)
+	if err != nil {
+		return nil, fmt.Errorf("key %q: %w", keyName, err)
+	}
+	srk := tpmutil.Handle(defaultSRK)
+	if t.tconf.SRK != "" {
+		srk, err = parseHandle(t.tconf.SRK)
+		if err != nil {
+			return nil, fmt.Errorf("token %q: srk: %w", t.tconf.Name(), err)
+		}
+	}
+	template := tpm2.Public{
+		NameAlg:    tpm2.AlgSHA256,
+		Attributes: tpm2.FlagSign | tpm2.FlagFixedTPM | tpm2.FlagFixedParent | tpm2.FlagSensitiveDataOrigin,
+	}
+	switch keyType {
+	case token.KeyTypeRsa:
+		template.Type = tpm2.AlgRSA
+		template.RSAParameters = &tpm2.RSAParams{
+			Sign:    &tpm2.SigScheme{Alg: tpm2.AlgNull},
+			KeyBits: uint16(bits),
+		}
+	case token.KeyTypeEcdsa:
+		curve, err := tpmCurve(bits)
+		if err != nil {
+			return nil, err
+		}
+		template.Type = tpm2.AlgECC
+		template.ECCParameters = &tpm2.ECCParams{
+			Sign:    &tpm2.SigScheme{Alg: tpm2.AlgNull},
+			CurveID: curve,
+		}
+	default:
+		return nil, errors.New("unsupported key type")
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(keyConf.PCRs) != 0 {
+		// without the user-with-auth flag, the password alone can't be used
+		// to bypass the policy
+		template.AuthPolicy, err = t.policyDigest(keyConf.PCRs)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		template.Attributes |= tpm2.FlagUserWithAuth
+	}
+	password := t.password()
+	private, public, _, _, _, err := tpm2.CreateKey(t.dev, srk, tpm2.PCRSelection{}, password, password, template)
+	if err != nil {
+		return nil, fmt.Errorf("creating key: %w", err)
+	}
+	transient, _, err := tpm2.Load(t.dev, srk, password, public, private)
+	if err != nil {
+		return nil, fmt.Errorf("loading key: %w", err)
+	}
+	defer tpm2.FlushContext(t.dev, transient)
+	if err := tpm2.EvictControl(t.dev, "", tpm2.HandleOwner, transient, handle); err != nil {
+		return nil, fmt.Errorf("persisting key at %s: %w", keyConf.ID, err)
+	}
+	pub, err := readPublic(t.dev, handle)
+	if err != nil {
+		return nil, err
+	}
+	return &tpmKey{
+		kconf:  keyConf,
+		tok:    t,
+		handle: handle,
+		pub:    pub,
+	}, nil
+}
+
+func tpmCurve(bits uint) (tpm2.EllipticCurve, error) {
+	switch bits {
+	case 256:
+		return tpm2.CurveNISTP256, nil
+	case 384:
+		return tpm2.CurveNISTP384, nil
+	case 521:
+		return tpm2.CurveNISTP521, nil
+	default:
+		return 0, fmt.Errorf("unsupported ECDSA key size %d", bits)
+	}
+}
+
+// compute the policy digest binding a key to the current PCR values, and to
+// the password if one is configured
+func (t *tpmToken) policyDigest(pcrs []int) ([]byte, error) {
+	session, _, err := tpm2.StartAuthSession(t.dev, tpm2.HandleNull, tpm2.HandleNull, make([]byte, 16), nil, tpm2.SessionTrial, tpm2.AlgNull, tpm2.AlgSHA256)
+	if err != nil {
+		return nil, fmt.Errorf("starting trial session: %w", err)
+	}
+	defer tpm2.FlushContext(t.dev, session)
+	if err := t.applyPolicy(session, pcrs); err != nil {
+		return nil, err
+	}
+	return tpm2.PolicyGetDigest(t.dev, session)
+}
+
+func (t *tpmToken) applyPolicy(session tpmutil.Handle, pcrs []int) error {
+	sel := tpm2.PCRSelection{Hash: tpm2.AlgSHA256, PCRs: pcrs}
+	if err := tpm2.PolicyPCR(t.dev, session, nil, sel); err != nil {
+		return fmt.Errorf("applying PCR policy: %w", err)
+	}
+	if t.password() != "" {
+		if err := tpm2.PolicyPassword(t.dev, session); err != nil {
+			return fmt.Errorf("applying password policy: %w", err)
+		}
+	}
+	return nil
+}
+
+func (t *tpmToken) ListKeys(opts token.ListOptions) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	handles, _, err := tpm2.GetCapability(t.dev, tpm2.CapabilityHandles, 256, persistentFirst)
+	if err != nil {
+		return err
+	}
+	for _, h := range handles {
+		handle, ok := h.(tpmutil.Handle)
+		if !ok {
+			continue
+		}
+		id := fmt.Sprintf("0x%08x", uint32(handle))
+		if opts.ID != "" && !strings.EqualFold(opts.ID, id) {
+			continue
+		}
+		pub, err := readPublic(t.dev, handle)
+		if err != nil {
+			// storage keys and the like
+			continue
+		}
+		fmt.Fprintf(opts.Output, "id:      %s\n", id)
+		switch k := pub.(type) {
+		case *rsa.PublicKey:
+			fmt.Fprintf(opts.Output, "type:    RSA %d\n", k.N.BitLen())
+		case *ecdsa.PublicKey:
+			fmt.Fprintf(opts.Output, "type:    ECDSA %s\n", k.Curve.Params().Name)
+		}
+		if opts.Values {
+			der, err := x509.MarshalPKIXPublicKey(pub)
+			if err != nil {
+				return err
+			}
+			_ = pem.Encode(opts.Output, &pem.Block{Type: "PUBLIC KEY", Bytes: der})
+		}
+		fmt.Fprintln(opts.Output)
+	}
+	return nil
+}
+
+func (k *tpmKey) Public() crypto.PublicKey {
+	return k.pub
+}
+
+func (k *tpmKey) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) (signature []byte, err error) {
+	return k.SignContext(context.Background(), digest, opts)
+}
+
+func (k *tpmKey) SignContext(ctx context.Context, digest []byte, opts crypto.SignerOpts) (signature []byte, err error) {
+	hashAlg, err := tpm2.HashToAlgorithm(opts.HashFunc())
+	if err != nil {
+		return nil, token.KeyUsageError{Key: k.kconf.Name(), Err: err}
+	}
+	scheme := &tpm2.SigScheme{Hash: hashAlg}
+	switch k.pub.(type) {
+	case *rsa.PublicKey:
+		if pss, ok := opts.(*rsa.PSSOptions); ok {
+			// the TPM uses a salt as long as the digest
+			if pss.SaltLength != rsa.PSSSaltLengthEqualsHash && pss.SaltLength != rsa.PSSSaltLengthAuto && pss.SaltLength != opts.HashFunc().Size() {
+				return nil, token.KeyUsageError{
+					Key: k.kconf.Name(),
+					Err: errors.New("TPM only supports PSS with a salt length equal to the digest length"),
+				}
+			}
+			scheme.Alg = tpm2.AlgRSAPSS
+		} else {
+			scheme.Alg = tpm2.AlgRSASSA
+		}
+	case *ecdsa.PublicKey:
+		scheme.Alg = tpm2.AlgECDSA
+	default:
+		return nil, token.KeyUsageError{
+			Key: k.kconf.Name(),
+			Err: fmt.Errorf("unsupported public key type %T", k.pub),
+		}
+	}
+	k.tok.mu.Lock()
+	defer k.tok.mu.Unlock()
+	dev := k.tok.dev
+	var sig *tpm2.Signature
+	if len(k.kconf.PCRs) != 0 {
+		session, _, err := tpm2.StartAuthSession(dev, tpm2.HandleNull, tpm2.HandleNull, make([]byte, 16), nil, tpm2.SessionPolicy, tpm2.AlgNull, tpm2.AlgSHA256)
+		if err != nil {
+			return nil, fmt.Errorf("starting policy session: %w", err)
+		}
+		defer tpm2.FlushContext(dev, session)
+		if err := k.tok.applyPolicy(session, k.kconf.PCRs); err != nil {
+			return nil, err
+		}
+		sig, err = tpm2.SignWithSession(dev, session, k.handle, k.tok.password(), digest, nil, scheme)
+	} else {
+		sig, err = tpm2.Sign(dev, k.handle, k.tok.password(), digest, nil, scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case sig.RSA != nil:
+		return sig.RSA.Signature, nil
+	case sig.ECC != nil:
+		return x509tools.EcdsaSignature{R: sig.ECC.R, S: sig.ECC.S}.Marshal(), nil
+	default:
+		return nil, errors.New("TPM returned an unexpected signature type")
+	}
+}
+
+func (k *tpmKey) Config() *config.KeyConfig {
+	return k.kconf
+}
+
+func (k *tpmKey) Certificate() []byte {
+	return nil
+}
+
+func (k *tpmKey) GetID() []byte {
+	var id [4]byte
+	binary.BigEndian.PutUint32(id[:], uint32(k.handle))
+	return id[:]
+}
+
+func (k *tpmKey) ImportCertificate(cert *x509.Certificate) error {
+	return token.NotImplementedError{Op: "import-certificate", Type: tokenType}
+}
@@ -0,0 +1,279 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package vaulttoken
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sassoftware/relic/v7/config"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+)
+
+const maxResponse = 1 << 20
+
+// client is a minimal Vault HTTP API client covering login and the transit
+// secrets engine
+type client struct {
+	tconf     *config.TokenConfig
+	addr      string
+	namespace string
+	http      *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+type vaultResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Auth   *vaultAuth      `json:"auth"`
+	Errors []string        `json:"errors"`
+}
+
+type vaultAuth struct {
+	ClientToken   string `json:"client_token"`
+	LeaseDuration int64  `json:"lease_duration"`
+	Renewable     bool   `json:"renewable"`
+}
+
+// Error returned by the Vault API
+type vaultError struct {
+	Status int
+	Errors []string
+}
+
+func (e vaultError) Error() string {
+	if len(e.Errors) == 0 {
+		return fmt.Sprintf("vault: HTTP %d", e.Status)
+	}
+	return fmt.Sprintf("vault: HTTP %d: %s", e.Status, strings.Join(e.Errors, "; "))
+}
+
+func newClient(tconf *config.TokenConfig) (*client, error) {
+	addr := tconf.Endpoint
+	if addr == "" {
+		addr = os.Getenv("VAULT_ADDR")
+	}
+	if addr == "" {
+		return nil, errors.New("endpoint or VAULT_ADDR must be set to the address of the Vault server")
+	}
+	namespace := tconf.Namespace
+	if namespace == "" {
+		namespace = os.Getenv("VAULT_NAMESPACE")
+	}
+	tlsconf := &tls.Config{}
+	if err := x509tools.LoadCertPool(tconf.CaCert, tlsconf); err != nil {
+		return nil, err
+	}
+	x509tools.SetKeyLogFile(tlsconf)
+	timeout := tconf.Timeout
+	if timeout == 0 {
+		timeout = 60
+	}
+	return &client{
+		tconf:     tconf,
+		addr:      strings.TrimSuffix(addr, "/"),
+		namespace: namespace,
+		http: &http.Client{
+			Timeout:   time.Second * time.Duration(timeout),
+			Transport: &http.Transport{TLSClientConfig: tlsconf},
+		},
+	}, nil
+}
+
+// do makes an authenticated API call and decodes the response data into out.
+// If the token was rejected it logs in again and retries once.
+func (c *client) do(ctx context.Context, method, path string, body, out interface{}) error {
+	token, err := c.getToken(ctx, false)
+	if err != nil {
+		return err
+	}
+	err = c.call(ctx, method, path, token, body, out)
+	var verr vaultError
+	if errors.As(err, &verr) && verr.Status == http.StatusForbidden && c.canLogin() {
+		token, err = c.getToken(ctx, true)
+		if err != nil {
+			return err
+		}
+		err = c.call(ctx, method, path, token, body, out)
+	}
+	return err
+}
+
+func (c *client) call(ctx context.Context, method, path, token string, body, out interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		blob, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(blob)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.addr+"/v1/"+path, reqBody)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if c.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", c.namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("vault: %w", err)
+	}
+	defer resp.Body.Close()
+	blob, err := io.ReadAll(io.LimitReader(resp.Body, maxResponse))
+	if err != nil {
+		return fmt.Errorf("vault: %w", err)
+	}
+	var vresp vaultResponse
+	if len(blob) != 0 {
+		if err := json.Unmarshal(blob, &vresp); err != nil && resp.StatusCode < 300 {
+			return fmt.Errorf("vault: decoding response: %w", err)
+		}
+	}
+	if resp.StatusCode >= 300 {
+		return vaultError{Status: resp.StatusCode, Errors: vresp.Errors}
+	}
+	switch out := out.(type) {
+	case nil:
+	case *vaultAuth:
+		if vresp.Auth == nil {
+			return errors.New("vault: login response did not include a token")
+		}
+		*out = *vresp.Auth
+	default:
+		if len(vresp.Data) == 0 {
+			return errors.New("vault: response did not include any data")
+		}
+		if err := json.Unmarshal(vresp.Data, out); err != nil {
+			return fmt.Errorf("vault: decoding response: %w", err)
+		}
+	}
+	return nil
+}
+
+func (c *client) authMethod() string {
+	if c.tconf.AuthMethod == "" {
+		return "token"
+	}
+	return strings.ToLower(c.tconf.AuthMethod)
+}
+
+func (c *client) canLogin() bool {
+	return c.authMethod() != "token"
+}
+
+// getToken returns a Vault token, logging in if there isn't a current one
+func (c *client) getToken(ctx context.Context, force bool) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" && !force && (c.expires.IsZero() || time.Until(c.expires) > time.Minute) {
+		return c.token, nil
+	}
+	var err error
+	var auth vaultAuth
+	switch c.authMethod() {
+	case "token":
+		auth.ClientToken, err = c.staticToken()
+	case "approle":
+		auth, err = c.login(ctx, "approle", map[string]string{
+			"role_id":   c.tconf.Role,
+			"secret_id": c.secret(),
+		})
+	case "jwt":
+		var jwt []byte
+		if c.tconf.Pin == nil || *c.tconf.Pin == "" {
+			return "", errors.New("vault: jwt auth requires \"pin\" to be set to the path of the JWT")
+		}
+		jwt, err = os.ReadFile(*c.tconf.Pin)
+		if err != nil {
+			return "", err
+		}
+		auth, err = c.login(ctx, "jwt", map[string]string{
+			"role": c.tconf.Role,
+			"jwt":  string(bytes.TrimSpace(jwt)),
+		})
+	default:
+		return "", fmt.Errorf("vault: unsupported auth method %q, expected one of: token approle jwt", c.tconf.AuthMethod)
+	}
+	if err != nil {
+		return "", err
+	}
+	c.token = auth.ClientToken
+	c.expires = time.Time{}
+	if auth.LeaseDuration > 0 {
+		c.expires = time.Now().Add(time.Second * time.Duration(auth.LeaseDuration))
+	}
+	return c.token, nil
+}
+
+func (c *client) login(ctx context.Context, method string, body map[string]string) (vaultAuth, error) {
+	mount := c.tconf.AuthMount
+	if mount == "" {
+		mount = method
+	}
+	var auth vaultAuth
+	if err := c.call(ctx, http.MethodPost, "auth/"+strings.Trim(mount, "/")+"/login", "", body, &auth); err != nil {
+		return auth, fmt.Errorf("vault: %s login: %w", method, err)
+	}
+	return auth, nil
+}
+
+func (c *client) secret() string {
+	if c.tconf.Pin != nil {
+		return *c.tconf.Pin
+	}
+	return ""
+}
+
+// Token auth takes the token from the config, the environment, or the file
+// written by "vault login", in that order
+func (c *client) staticToken() (string, error) {
+	if token := c.secret(); token != "" {
+		return token, nil
+	}
+	if token := os.Getenv("VAULT_TOKEN"); token != "" {
+		return token, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	blob, err := os.ReadFile(filepath.Join(home, ".vault-token"))
+	if err != nil {
+		return "", fmt.Errorf("vault: no token configured: %w", err)
+	}
+	return string(bytes.TrimSpace(blob)), nil
+}
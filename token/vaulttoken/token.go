@@ -0,0 +1,366 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package vaulttoken implements a token backed by the transit secrets engine
+// of HashiCorp Vault
+package vaulttoken
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sassoftware/relic/v7/config"
+	"github.com/sassoftware/relic/v7/lib/passprompt"
+	"github.com/sassoftware/relic/v7/token"
+)
+
+const (
+	tokenType    = "vault"
+	defaultMount = "transit"
+)
+
+type vaultToken struct {
+	config *config.Config
+	tconf  *config.TokenConfig
+	cli    *client
+}
+
+type vaultKey struct {
+	kconf   *config.KeyConfig
+	cli     *client
+	path    string
+	pub     crypto.PublicKey
+	version int
+}
+
+// transit key as returned by the read key endpoint
+type transitKey struct {
+	Type          string                       `json:"type"`
+	LatestVersion int                          `json:"latest_version"`
+	MinVersion    int                          `json:"min_decryption_version"`
+	Keys          map[string]transitKeyVersion `json:"keys"`
+}
+
+type transitKeyVersion struct {
+	PublicKey string `json:"public_key"`
+}
+
+func init() {
+	token.Openers[tokenType] = open
+}
+
+func open(conf *config.Config, tokenName string, pinProvider passprompt.PasswordGetter) (token.Token, error) {
+	tconf, err := conf.GetToken(tokenName)
+	if err != nil {
+		return nil, err
+	}
+	cli, err := newClient(tconf)
+	if err != nil {
+		return nil, err
+	}
+	return &vaultToken{
+		config: conf,
+		tconf:  tconf,
+		cli:    cli,
+	}, nil
+}
+
+func (t *vaultToken) Close() error {
+	return nil
+}
+
+func (t *vaultToken) Ping(ctx context.Context) error {
+	// confirms both connectivity and that the token is still valid
+	var self struct{}
+	return t.cli.do(ctx, http.MethodGet, "auth/token/lookup-self", nil, &self)
+}
+
+func (t *vaultToken) Config() *config.TokenConfig {
+	return t.tconf
+}
+
+func (t *vaultToken) mount() string {
+	if t.tconf.Mount != "" {
+		return strings.Trim(t.tconf.Mount, "/")
+	}
+	return defaultMount
+}
+
+func (t *vaultToken) keyPath(op, name string) string {
+	return t.mount() + "/" + op + "/" + url.PathEscape(name)
+}
+
+func (t *vaultToken) GetKey(ctx context.Context, keyName string) (token.Key, error) {
+	keyConf, err := t.config.GetKey(keyName)
+	if err != nil {
+		return nil, err
+	}
+	if keyConf.Label == "" {
+		return nil, fmt.Errorf("key %q must have \"label\" set to the name of a transit key", keyName)
+	}
+	var tkey transitKey
+	if err := t.cli.do(ctx, http.MethodGet, t.keyPath("keys", keyConf.Label), nil, &tkey); err != nil {
+		return nil, fmt.Errorf("key %q: %w", keyName, err)
+	}
+	version := tkey.LatestVersion
+	if wantKeyID := token.KeyID(ctx); len(wantKeyID) != 0 {
+		// reusing a key the client saw before
+		version, err = strconv.Atoi(string(wantKeyID))
+		if err != nil {
+			return nil, errors.New("invalid keyID")
+		}
+	} else if keyConf.ID != "" {
+		// pinned to a specific version
+		version, err = strconv.Atoi(keyConf.ID)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: id must be a key version number", keyName)
+		}
+	}
+	pub, err := tkey.publicKey(version)
+	if err != nil {
+		return nil, fmt.Errorf("key %q: %w", keyName, err)
+	}
+	return &vaultKey{
+		kconf:   keyConf,
+		cli:     t.cli,
+		path:    t.keyPath("sign", keyConf.Label),
+		pub:     pub,
+		version: version,
+	}, nil
+}
+
+func (k *transitKey) publicKey(version int) (crypto.PublicKey, error) {
+	ver, ok := k.Keys[strconv.Itoa(version)]
+	if !ok || ver.PublicKey == "" {
+		return nil, fmt.Errorf("transit key version %d not found or is not an asymmetric key", version)
+	}
+	if k.Type == "ed25519" {
+		raw, err := base64.StdEncoding.DecodeString(ver.PublicKey)
+		if err != nil || len(raw) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid ed25519 public key")
+		}
+		return ed25519.PublicKey(raw), nil
+	}
+	block, _ := pem.Decode([]byte(ver.PublicKey))
+	if block == nil {
+		return nil, errors.New("expected PEM in public key response")
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+func (t *vaultToken) Import(keyName string, privKey crypto.PrivateKey) (token.Key, error) {
+	return nil, token.NotImplementedError{Op: "import-key", Type: tokenType}
+}
+
+func (t *vaultToken) ImportCertificate(cert *x509.Certificate, labelBase string) error {
+	return token.NotImplementedError{Op: "import-certificate", Type: tokenType}
+}
+
+func (t *vaultToken) Generate(keyName string, keyType token.KeyType, bits uint) (token.Key, error) {
+	keyConf, err := t.config.GetKey(keyName)
+	if err != nil {
+		return nil, err
+	}
+	if keyConf.Label == "" {
+		return nil, fmt.Errorf("key %q must have \"label\" set to the name of a transit key", keyName)
+	}
+	var ttype string
+	switch keyType {
+	case token.KeyTypeRsa:
+		ttype = fmt.Sprintf("rsa-%d", bits)
+	case token.KeyTypeEcdsa:
+		if bits == 521 {
+			ttype = "ecdsa-p521"
+		} else {
+			ttype = fmt.Sprintf("ecdsa-p%d", bits)
+		}
+	default:
+		return nil, errors.New("unsupported key type")
+	}
+	ctx := context.Background()
+	body := map[string]interface{}{"type": ttype}
+	if err := t.cli.do(ctx, http.MethodPost, t.keyPath("keys", keyConf.Label), body, nil); err != nil {
+		return nil, err
+	}
+	return t.GetKey(ctx, keyName)
+}
+
+func (t *vaultToken) ListKeys(opts token.ListOptions) error {
+	ctx := context.Background()
+	var list struct {
+		Keys []string `json:"keys"`
+	}
+	if err := t.cli.do(ctx, "LIST", t.mount()+"/keys", nil, &list); err != nil {
+		return err
+	}
+	for _, name := range list.Keys {
+		if opts.Label != "" && opts.Label != name {
+			continue
+		}
+		var tkey transitKey
+		if err := t.cli.do(ctx, http.MethodGet, t.keyPath("keys", name), nil, &tkey); err != nil {
+			return err
+		}
+		var versions []int
+		for v := range tkey.Keys {
+			n, _ := strconv.Atoi(v)
+			versions = append(versions, n)
+		}
+		sort.Ints(versions)
+		for _, version := range versions {
+			if opts.ID != "" && opts.ID != strconv.Itoa(version) {
+				continue
+			}
+			pub, err := tkey.publicKey(version)
+			if err != nil {
+				// symmetric key
+				break
+			}
+			fmt.Fprintf(opts.Output, "label:   %s\n", name)
+			fmt.Fprintf(opts.Output, "id:      %d\n", version)
+			fmt.Fprintf(opts.Output, "type:    %s\n", tkey.Type)
+			if version == tkey.LatestVersion {
+				fmt.Fprintf(opts.Output, "latest:  true\n")
+			}
+			if opts.Values {
+				der, err := x509.MarshalPKIXPublicKey(pub)
+				if err != nil {
+					return err
+				}
+				_ = pem.Encode(opts.Output, &pem.Block{Type: "PUBLIC KEY", Bytes: der})
+			}
+			fmt.Fprintln(opts.Output)
+		}
+	}
+	return nil
+}
+
+func (k *vaultKey) Public() crypto.PublicKey {
+	return k.pub
+}
+
+func (k *vaultKey) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) (signature []byte, err error) {
+	return k.SignContext(context.Background(), digest, opts)
+}
+
+func (k *vaultKey) SignContext(ctx context.Context, digest []byte, opts crypto.SignerOpts) (signature []byte, err error) {
+	version := k.version
+	if wantKeyID := token.KeyID(ctx); len(wantKeyID) != 0 {
+		// reusing a key the client saw before
+		version, err = strconv.Atoi(string(wantKeyID))
+		if err != nil {
+			return nil, errors.New("invalid keyID")
+		}
+	}
+	body := map[string]interface{}{
+		"input":       base64.StdEncoding.EncodeToString(digest),
+		"key_version": version,
+	}
+	if _, ok := k.pub.(ed25519.PublicKey); ok {
+		// ed25519 signs the message itself
+		if opts.HashFunc() != 0 {
+			return nil, token.KeyUsageError{
+				Key: k.kconf.Name(),
+				Err: errors.New("ed25519 keys can't sign a prehashed digest"),
+			}
+		}
+	} else {
+		alg, err := k.hashAlgorithm(opts.HashFunc())
+		if err != nil {
+			return nil, err
+		}
+		body["prehashed"] = true
+		body["hash_algorithm"] = alg
+	}
+	if _, ok := k.pub.(*rsa.PublicKey); ok {
+		if pss, ok := opts.(*rsa.PSSOptions); ok {
+			body["signature_algorithm"] = "pss"
+			switch pss.SaltLength {
+			case rsa.PSSSaltLengthAuto:
+				body["salt_length"] = "auto"
+			case rsa.PSSSaltLengthEqualsHash:
+				body["salt_length"] = "hash"
+			default:
+				body["salt_length"] = strconv.Itoa(pss.SaltLength)
+			}
+		} else {
+			body["signature_algorithm"] = "pkcs1v15"
+		}
+	}
+	var resp struct {
+		Signature string `json:"signature"`
+	}
+	if err := k.cli.do(ctx, http.MethodPost, k.path, body, &resp); err != nil {
+		return nil, err
+	}
+	// vault:v1:base64
+	parts := strings.SplitN(resp.Signature, ":", 3)
+	if len(parts) != 3 || parts[0] != "vault" {
+		return nil, errors.New("vault: unexpected signature format")
+	}
+	return base64.StdEncoding.DecodeString(parts[2])
+}
+
+func (k *vaultKey) hashAlgorithm(hash crypto.Hash) (string, error) {
+	switch hash {
+	case crypto.SHA1:
+		return "sha1", nil
+	case crypto.SHA224:
+		return "sha2-224", nil
+	case crypto.SHA256:
+		return "sha2-256", nil
+	case crypto.SHA384:
+		return "sha2-384", nil
+	case crypto.SHA512:
+		return "sha2-512", nil
+	default:
+		return "", token.KeyUsageError{
+			Key: k.kconf.Name(),
+			Err: fmt.Errorf("unsupported digest algorithm %s", hash),
+		}
+	}
+}
+
+func (k *vaultKey) Config() *config.KeyConfig {
+	return k.kconf
+}
+
+func (k *vaultKey) Certificate() []byte {
+	return nil
+}
+
+// GetID returns the key version, so that a client of the worker signs with the
+// same version it retrieved the public key for
+func (k *vaultKey) GetID() []byte {
+	return []byte(strconv.Itoa(k.version))
+}
+
+func (k *vaultKey) ImportCertificate(cert *x509.Certificate) error {
+	return token.NotImplementedError{Op: "import-certificate", Type: tokenType}
+}
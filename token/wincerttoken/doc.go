@@ -0,0 +1,25 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package wincerttoken provides a token backed by the Windows certificate
+// store. Keys are used in place through CNG and never leave the store, so
+// non-exportable and smart card keys can be used for signing.
+//
+// The token provider selects the store as "location/name", for example
+// "CurrentUser/My" (the default) or "LocalMachine/My". Keys are selected by
+// the SHA-1 thumbprint of their certificate in the id field, or by subject
+// common name in the label field.
+package wincerttoken
@@ -0,0 +1,394 @@
+//go:build windows
+// +build windows
+
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package wincerttoken
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+
+	"github.com/sassoftware/relic/v7/config"
+	"github.com/sassoftware/relic/v7/lib/passprompt"
+	"github.com/sassoftware/relic/v7/lib/x509tools"
+	"github.com/sassoftware/relic/v7/token"
+)
+
+const tokenType = "windows"
+
+const (
+	ncryptPadPKCS1Flag = 0x2
+	ncryptPadPSSFlag   = 0x8
+	ncryptSilentFlag   = 0x40
+)
+
+var (
+	modncrypt            = windows.NewLazySystemDLL("ncrypt.dll")
+	procNCryptSignHash   = modncrypt.NewProc("NCryptSignHash")
+	procNCryptFreeObject = modncrypt.NewProc("NCryptFreeObject")
+)
+
+// BCRYPT_PKCS1_PADDING_INFO
+type pkcs1PaddingInfo struct {
+	AlgID *uint16
+}
+
+// BCRYPT_PSS_PADDING_INFO
+type pssPaddingInfo struct {
+	AlgID   *uint16
+	SaltLen uint32
+}
+
+type winToken struct {
+	config *config.Config
+	tconf  *config.TokenConfig
+	store  windows.Handle
+
+	mu   sync.Mutex
+	keys []*winKey
+}
+
+type winKey struct {
+	kconf  *config.KeyConfig
+	cert   *x509.Certificate
+	ctx    *windows.CertContext
+	handle uintptr // NCRYPT_KEY_HANDLE
+	free   bool
+}
+
+func init() {
+	token.Openers[tokenType] = open
+}
+
+func open(conf *config.Config, tokenName string, pinProvider passprompt.PasswordGetter) (token.Token, error) {
+	tconf, err := conf.GetToken(tokenName)
+	if err != nil {
+		return nil, err
+	}
+	store, err := openStore(tconf.Provider)
+	if err != nil {
+		return nil, fmt.Errorf("opening certificate store %q: %w", tconf.Provider, err)
+	}
+	return &winToken{
+		config: conf,
+		tconf:  tconf,
+		store:  store,
+	}, nil
+}
+
+// Open a system store named like "LocalMachine/My"
+func openStore(name string) (windows.Handle, error) {
+	location := uint32(windows.CERT_SYSTEM_STORE_CURRENT_USER)
+	if i := strings.IndexAny(name, `/\`); i >= 0 {
+		switch strings.ToLower(name[:i]) {
+		case "currentuser", "user":
+		case "localmachine", "machine":
+			location = windows.CERT_SYSTEM_STORE_LOCAL_MACHINE
+		default:
+			return 0, fmt.Errorf("unknown store location %q", name[:i])
+		}
+		name = name[i+1:]
+	}
+	if name == "" {
+		name = "My"
+	}
+	namePtr, err := windows.UTF16PtrFromString(name)
+	if err != nil {
+		return 0, err
+	}
+	flags := location | windows.CERT_STORE_OPEN_EXISTING_FLAG | windows.CERT_STORE_READONLY_FLAG
+	return windows.CertOpenStore(windows.CERT_STORE_PROV_SYSTEM, 0, 0, flags, uintptr(unsafe.Pointer(namePtr)))
+}
+
+func (t *winToken) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, key := range t.keys {
+		key.close()
+	}
+	t.keys = nil
+	if t.store != 0 {
+		err := windows.CertCloseStore(t.store, 0)
+		t.store = 0
+		return err
+	}
+	return nil
+}
+
+func (t *winToken) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (t *winToken) Config() *config.TokenConfig {
+	return t.tconf
+}
+
+func (t *winToken) GetKey(ctx context.Context, keyName string) (token.Key, error) {
+	keyConf, err := t.config.GetKey(keyName)
+	if err != nil {
+		return nil, err
+	}
+	if keyConf.ID == "" && keyConf.Label == "" {
+		return nil, fmt.Errorf("key %q must have \"id\" set to a certificate thumbprint or \"label\" set to a subject name", keyName)
+	}
+	thumbprint, err := parseThumbprint(keyConf.ID)
+	if err != nil {
+		return nil, fmt.Errorf("key %q: %w", keyName, err)
+	}
+	var found *windows.CertContext
+	var cert *x509.Certificate
+	err = t.enumerate(func(certCtx *windows.CertContext, parsed *x509.Certificate) bool {
+		if thumbprint != nil {
+			digest := sha1.Sum(parsed.Raw)
+			if !bytes.Equal(digest[:], thumbprint) {
+				return true
+			}
+		}
+		if keyConf.Label != "" && parsed.Subject.CommonName != keyConf.Label {
+			return true
+		}
+		found = windows.CertDuplicateCertificateContext(certCtx)
+		cert = parsed
+		return false
+	})
+	if err != nil {
+		return nil, err
+	} else if found == nil {
+		return nil, fmt.Errorf("key %q: certificate not found in store %q", keyName, t.tconf.Provider)
+	}
+	key := &winKey{kconf: keyConf, cert: cert, ctx: found}
+	// ONLY_NCRYPT still works for legacy CryptoAPI keys as CNG opens them
+	// through its compatibility layer
+	var keySpec uint32
+	flags := uint32(windows.CRYPT_ACQUIRE_ONLY_NCRYPT_KEY_FLAG | windows.CRYPT_ACQUIRE_SILENT_FLAG)
+	var handle windows.Handle
+	if err := windows.CryptAcquireCertificatePrivateKey(found, flags, nil, &handle, &keySpec, &key.free); err != nil {
+		windows.CertFreeCertificateContext(found)
+		return nil, fmt.Errorf("key %q: acquiring private key: %w", keyName, err)
+	}
+	key.handle = uintptr(handle)
+	t.mu.Lock()
+	t.keys = append(t.keys, key)
+	t.mu.Unlock()
+	return key, nil
+}
+
+// Call fn for each certificate in the store until it returns false
+func (t *winToken) enumerate(fn func(*windows.CertContext, *x509.Certificate) bool) error {
+	var certCtx *windows.CertContext
+	for {
+		var err error
+		certCtx, err = windows.CertEnumCertificatesInStore(t.store, certCtx)
+		if err == syscall.Errno(windows.CRYPT_E_NOT_FOUND) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		der := unsafe.Slice(certCtx.EncodedCert, certCtx.Length)
+		parsed, err := x509.ParseCertificate(append([]byte(nil), der...))
+		if err != nil {
+			continue
+		}
+		if !fn(certCtx, parsed) {
+			windows.CertFreeCertificateContext(certCtx)
+			return nil
+		}
+	}
+}
+
+func parseThumbprint(id string) ([]byte, error) {
+	if id == "" {
+		return nil, nil
+	}
+	id = strings.NewReplacer(" ", "", ":", "").Replace(id)
+	thumbprint, err := hex.DecodeString(id)
+	if err != nil || len(thumbprint) != sha1.Size {
+		return nil, errors.New("id must be a SHA-1 certificate thumbprint in hex")
+	}
+	return thumbprint, nil
+}
+
+func (t *winToken) Import(keyName string, privKey crypto.PrivateKey) (token.Key, error) {
+	return nil, token.NotImplementedError{Op: "import-key", Type: tokenType}
+}
+
+func (t *winToken) ImportCertificate(cert *x509.Certificate, labelBase string) error {
+	return token.NotImplementedError{Op: "import-certificate", Type: tokenType}
+}
+
+func (t *winToken) Generate(keyName string, keyType token.KeyType, bits uint) (token.Key, error) {
+	return nil, token.NotImplementedError{Op: "generate-key", Type: tokenType}
+}
+
+func (t *winToken) ListKeys(opts token.ListOptions) error {
+	thumbprint, err := parseThumbprint(opts.ID)
+	if err != nil {
+		return err
+	}
+	return t.enumerate(func(certCtx *windows.CertContext, cert *x509.Certificate) bool {
+		digest := sha1.Sum(cert.Raw)
+		if thumbprint != nil && !bytes.Equal(digest[:], thumbprint) {
+			return true
+		}
+		if opts.Label != "" && cert.Subject.CommonName != opts.Label {
+			return true
+		}
+		fmt.Fprintf(opts.Output, "id:      %x\n", digest)
+		fmt.Fprintf(opts.Output, "label:   %s\n", cert.Subject.CommonName)
+		fmt.Fprintf(opts.Output, "subject: %s\n", x509tools.FormatSubject(cert))
+		fmt.Fprintf(opts.Output, "expires: %s\n", cert.NotAfter)
+		if opts.Values {
+			pem.Encode(opts.Output, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+		}
+		fmt.Fprintln(opts.Output)
+		return true
+	})
+}
+
+func (k *winKey) close() {
+	if k.free && k.handle != 0 {
+		procNCryptFreeObject.Call(k.handle)
+	}
+	k.handle = 0
+	if k.ctx != nil {
+		windows.CertFreeCertificateContext(k.ctx)
+		k.ctx = nil
+	}
+}
+
+func (k *winKey) Public() crypto.PublicKey {
+	return k.cert.PublicKey
+}
+
+func (k *winKey) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) (signature []byte, err error) {
+	return k.SignContext(context.Background(), digest, opts)
+}
+
+func (k *winKey) SignContext(ctx context.Context, digest []byte, opts crypto.SignerOpts) (signature []byte, err error) {
+	var padding unsafe.Pointer
+	var flags uint32 = ncryptSilentFlag
+	switch pub := k.cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		algID, err := hashAlgID(opts.HashFunc())
+		if err != nil {
+			return nil, token.KeyUsageError{Key: k.kconf.Name(), Err: err}
+		}
+		if pss, ok := opts.(*rsa.PSSOptions); ok {
+			saltLen := pss.SaltLength
+			switch saltLen {
+			case rsa.PSSSaltLengthAuto:
+				saltLen = (pub.N.BitLen()-1+7)/8 - 2 - opts.HashFunc().Size()
+			case rsa.PSSSaltLengthEqualsHash:
+				saltLen = opts.HashFunc().Size()
+			}
+			padding = unsafe.Pointer(&pssPaddingInfo{AlgID: algID, SaltLen: uint32(saltLen)})
+			flags |= ncryptPadPSSFlag
+		} else {
+			padding = unsafe.Pointer(&pkcs1PaddingInfo{AlgID: algID})
+			flags |= ncryptPadPKCS1Flag
+		}
+	case *ecdsa.PublicKey:
+	default:
+		return nil, token.KeyUsageError{
+			Key: k.kconf.Name(),
+			Err: fmt.Errorf("unsupported public key type %T", pub),
+		}
+	}
+	sig, err := k.signHash(padding, digest, flags)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := k.cert.PublicKey.(*ecdsa.PublicKey); ok {
+		// CNG returns r||s
+		parsed, err := x509tools.UnpackEcdsaSignature(sig)
+		if err != nil {
+			return nil, err
+		}
+		sig = parsed.Marshal()
+	}
+	return sig, nil
+}
+
+func (k *winKey) signHash(padding unsafe.Pointer, digest []byte, flags uint32) ([]byte, error) {
+	var size uint32
+	// first call to get the signature size
+	r, _, _ := procNCryptSignHash.Call(k.handle, uintptr(padding),
+		uintptr(unsafe.Pointer(&digest[0])), uintptr(len(digest)),
+		0, 0, uintptr(unsafe.Pointer(&size)), uintptr(flags))
+	if r != 0 {
+		return nil, fmt.Errorf("NCryptSignHash: %w", syscall.Errno(r))
+	}
+	sig := make([]byte, size)
+	r, _, _ = procNCryptSignHash.Call(k.handle, uintptr(padding),
+		uintptr(unsafe.Pointer(&digest[0])), uintptr(len(digest)),
+		uintptr(unsafe.Pointer(&sig[0])), uintptr(size), uintptr(unsafe.Pointer(&size)), uintptr(flags))
+	if r != 0 {
+		return nil, fmt.Errorf("NCryptSignHash: %w", syscall.Errno(r))
+	}
+	return sig[:size], nil
+}
+
+func hashAlgID(hash crypto.Hash) (*uint16, error) {
+	var name string
+	switch hash {
+	case crypto.SHA1:
+		name = "SHA1"
+	case crypto.SHA256:
+		name = "SHA256"
+	case crypto.SHA384:
+		name = "SHA384"
+	case crypto.SHA512:
+		name = "SHA512"
+	default:
+		return nil, fmt.Errorf("unsupported digest algorithm %s", hash)
+	}
+	return windows.UTF16PtrFromString(name)
+}
+
+func (k *winKey) Config() *config.KeyConfig {
+	return k.kconf
+}
+
+func (k *winKey) Certificate() []byte {
+	return k.cert.Raw
+}
+
+func (k *winKey) GetID() []byte {
+	digest := sha1.Sum(k.cert.Raw)
+	return digest[:]
+}
+
+func (k *winKey) ImportCertificate(cert *x509.Certificate) error {
+	return token.NotImplementedError{Op: "import-certificate", Type: tokenType}
+}
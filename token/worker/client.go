@@ -61,6 +61,22 @@ func (t *WorkerToken) Ping(ctx context.Context) error {
 	return err
 }
 
+// Health asks the worker for the token's health. The response is the
+// token's Health as JSON.
+func (t *WorkerToken) Health(ctx context.Context) (*token.Health, error) {
+	resp, err := t.request(ctx, workerrpc.Health, workerrpc.Request{})
+	if err != nil {
+		return nil, err
+	}
+	h := new(token.Health)
+	if len(resp.Value) != 0 {
+		if err := json.Unmarshal(resp.Value, h); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
 func (t *WorkerToken) Config() *config.TokenConfig {
 	return t.tconf
 }